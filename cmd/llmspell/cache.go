@@ -0,0 +1,87 @@
+// ABOUTME: The cache command, which lists and purges the LLM responses spells cached through llm.cache
+// ABOUTME: Responses are kept in LLMSPELL_LLM_CACHE, a directory or redis:// URL, else ~/.llmspell/llm-cache
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+	"github.com/lexlapax/go-llmspell/pkg/statestore"
+)
+
+// cachePromptWidth is how much of each prompt cache list shows
+const cachePromptWidth = 60
+
+// runCacheCommand handles cache list and cache purge; list prints JSON
+// with --output json
+func runCacheCommand(args []string, output string) {
+	if len(args) < 1 || (args[0] != "list" && args[0] != "purge") {
+		fmt.Println(i18n.T("cli.usage.cache_short"))
+		os.Exit(1)
+	}
+
+	store, err := newResponseStore()
+	if err == nil && store == nil {
+		err = fmt.Errorf("no home directory to keep the cache in; set LLMSPELL_LLM_CACHE")
+	}
+	if err != nil {
+		fatalf("cli.error.llm_cache", err)
+	}
+	cache := bridge.NewResponseCache(store, nil)
+
+	if args[0] == "purge" {
+		n, err := cache.Purge()
+		if err != nil {
+			fatalf("cli.error.llm_cache", err)
+		}
+		fmt.Println(i18n.T("cli.cache.purged", n))
+		return
+	}
+
+	entries, err := cache.Entries()
+	if err != nil {
+		fatalf("cli.error.llm_cache", err)
+	}
+	if output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			fatalf("cli.error.llm_cache", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s  %-8s  %-32s  %s\n", entry.Created.Format("2006-01-02 15:04:05"), entry.Method, entry.Model, excerpt(entry.Prompt, cachePromptWidth))
+	}
+	fmt.Println(i18n.T("cli.cache.entries", len(entries)))
+}
+
+// newResponseStore returns where spells cache LLM responses:
+// LLMSPELL_LLM_CACHE, a directory or redis:// URL, else
+// ~/.llmspell/llm-cache, or nil when there is no home directory
+func newResponseStore() (bridge.ResponseStore, error) {
+	if location := os.Getenv("LLMSPELL_LLM_CACHE"); location != "" {
+		return statestore.OpenResponseStore(location)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil
+	}
+	return bridge.NewFileResponseStore(filepath.Join(home, ".llmspell", "llm-cache")), nil
+}
+
+// excerpt shortens text to one line of at most width characters
+func excerpt(text string, width int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+	return string(runes[:width-3]) + "..."
+}
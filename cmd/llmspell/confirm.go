@@ -0,0 +1,73 @@
+// ABOUTME: Asks on the terminal before a spell runs a tool that requires confirmation
+// ABOUTME: Without a terminal there is no prompt, and the security profile's policy refuses such tools
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+// confirmParamsWidth is how much of a tool's parameters a prompt shows
+const confirmParamsWidth = 200
+
+// terminalPrompt returns a prompter reading answers from stdin, or nil
+// when stdin is not a terminal
+func terminalPrompt() security.Prompter {
+	if !isTerminal(os.Stdin) {
+		return nil
+	}
+	return newPrompter(os.Stdin, os.Stderr)
+}
+
+// newPrompter asks on out and reads answers from in, a line at a time.
+// Lines are read in the background, so a prompt gives up when the run
+// stops.
+func newPrompter(in io.Reader, out io.Writer) security.Prompter {
+	var once sync.Once
+	lines := make(chan string)
+	return func(ctx context.Context, tool string, params map[string]interface{}) (security.Answer, error) {
+		once.Do(func() {
+			go func() {
+				defer close(lines)
+				scanner := bufio.NewScanner(in)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		})
+
+		data, _ := json.Marshal(params)
+		fmt.Fprint(out, i18n.T("confirm.prompt", tool, excerpt(string(data), confirmParamsWidth)))
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return security.AnswerNo, io.EOF
+			}
+			return parseAnswer(line), nil
+		case <-ctx.Done():
+			fmt.Fprintln(out)
+			return security.AnswerNo, ctx.Err()
+		}
+	}
+}
+
+// parseAnswer reads y or yes, a or always; anything else is no
+func parseAnswer(line string) security.Answer {
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return security.AnswerYes
+	case "a", "always":
+		return security.AnswerAlways
+	}
+	return security.AnswerNo
+}
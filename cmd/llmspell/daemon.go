@@ -0,0 +1,519 @@
+// ABOUTME: llmspell daemon: queues spell jobs from a Unix socket and runs them in warm workers
+// ABOUTME: Workers are isolated children started ahead of time with a Lua engine already created
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+// jobFD is the descriptor a worker reads its job from; the second entry of
+// ExtraFiles becomes fd 4 in the child
+const jobFD = 4
+
+// defaultWorkers is how many spells the daemon runs at once unless
+// --workers says otherwise
+const defaultWorkers = 4
+
+// maxQueuedJobs is how many jobs may wait for a worker; further jobs are
+// turned away
+const maxQueuedJobs = 64
+
+// daemonJob is what a client sends the daemon, and the daemon a worker. The
+// spell path is absolute, and the spell runs in Dir. Timeout can only
+// tighten the daemon's own.
+type daemonJob struct {
+	Spell   string        `json:"spell"`
+	Args    []string      `json:"args,omitempty"`
+	Dir     string        `json:"dir,omitempty"`
+	Timeout time.Duration `json:"timeout_ns,omitempty"`
+}
+
+// daemonEvent is a line the daemon sends a client about its job: "queued"
+// with the number of jobs ahead of it, "output" with what the spell
+// printed, then "done" with how it ended
+type daemonEvent struct {
+	Event  string     `json:"event"`
+	ID     string     `json:"id,omitempty"`
+	Ahead  int        `json:"ahead,omitempty"`
+	Data   string     `json:"data,omitempty"`
+	Status *runStatus `json:"status,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// eventWriter sends daemon events to a client, the spell's output as
+// "output" events
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (w *eventWriter) send(event daemonEvent) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(event)
+}
+
+func (w *eventWriter) Write(p []byte) (int, error) {
+	if err := w.send(daemonEvent{Event: "output", Data: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// warmWorker is an isolated child waiting for its job, or why one could
+// not be started
+type warmWorker struct {
+	child  *isolatedChild
+	jobs   *os.File
+	output *workerOutput
+	cancel context.CancelFunc
+	err    error
+}
+
+// workerOutput passes a worker's output on to the client of its job, or to
+// the daemon's stderr before it has one
+type workerOutput struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (o *workerOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.w == nil {
+		return os.Stderr.Write(p)
+	}
+	return o.w.Write(p)
+}
+
+// attach sends the output that follows to w
+func (o *workerOutput) attach(w io.Writer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.w = w
+}
+
+// spellDaemon runs queued spell jobs, at most workers at a time, each in a
+// worker started before the job arrived
+type spellDaemon struct {
+	opts    runOptions
+	ctx     context.Context
+	slots   chan struct{}
+	warm    chan *warmWorker
+	jobs    sync.WaitGroup
+	workers sync.WaitGroup
+
+	mu     sync.Mutex
+	queued int
+}
+
+// newSpellDaemon creates a daemon running jobs under opts and starts its
+// warm workers. Cancelling ctx stops them.
+func newSpellDaemon(ctx context.Context, opts runOptions, workers int) *spellDaemon {
+	d := &spellDaemon{
+		opts:  opts,
+		ctx:   ctx,
+		slots: make(chan struct{}, workers),
+		warm:  make(chan *warmWorker, workers),
+	}
+	for i := 0; i < workers; i++ {
+		d.refill()
+	}
+	return d
+}
+
+// refill starts a worker for the pool in the background
+func (d *spellDaemon) refill() {
+	d.workers.Add(1)
+	go func() {
+		defer d.workers.Done()
+		w := d.startWorker()
+		select {
+		case d.warm <- w:
+		case <-d.ctx.Done():
+			w.stop()
+		}
+	}()
+}
+
+// startWorker starts a child that prepares to run a spell, then waits for
+// its job
+func (d *spellDaemon) startWorker() *warmWorker {
+	ctx, cancel := context.WithCancel(d.ctx)
+	child, err := newIsolatedChild(ctx, []string{"worker"}, d.opts)
+	if err != nil {
+		cancel()
+		return &warmWorker{err: err}
+	}
+	jobReader, jobWriter, err := os.Pipe()
+	if err != nil {
+		cancel()
+		return &warmWorker{err: err}
+	}
+	output := &workerOutput{}
+	child.cmd.Stdout, child.cmd.Stderr = output, output
+	child.cmd.ExtraFiles = append(child.cmd.ExtraFiles, jobReader)
+	err = child.start()
+	jobReader.Close()
+	if err != nil {
+		jobWriter.Close()
+		cancel()
+		return &warmWorker{err: err}
+	}
+	return &warmWorker{child: child, jobs: jobWriter, output: output, cancel: cancel}
+}
+
+// stop ends a worker that was never given a job
+func (w *warmWorker) stop() {
+	if w.err != nil {
+		return
+	}
+	w.jobs.Close()
+	w.cancel()
+	_, _, _ = w.child.wait()
+}
+
+// serve accepts jobs on l until the daemon's context is done
+func (d *spellDaemon) serve(l net.Listener) error {
+	go func() {
+		<-d.ctx.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if d.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		d.jobs.Add(1)
+		go func() {
+			defer d.jobs.Done()
+			d.handle(conn)
+		}()
+	}
+}
+
+// wait waits for the jobs in progress and the workers to end after the
+// daemon's context is done
+func (d *spellDaemon) wait() {
+	d.jobs.Wait()
+	d.workers.Wait()
+	for {
+		select {
+		case w := <-d.warm:
+			w.stop()
+		default:
+			return
+		}
+	}
+}
+
+// handle runs the job a client sends, reporting on it as it goes. The job
+// is cancelled if the client goes away.
+func (d *spellDaemon) handle(conn net.Conn) {
+	defer conn.Close()
+	events := &eventWriter{enc: json.NewEncoder(conn)}
+
+	var job daemonJob
+	if err := json.NewDecoder(io.LimitReader(conn, 1<<20)).Decode(&job); err != nil {
+		_ = events.send(daemonEvent{Event: "done", Error: fmt.Sprintf("invalid job: %v", err)})
+		return
+	}
+	if !filepath.IsAbs(job.Spell) {
+		_ = events.send(daemonEvent{Event: "done", Error: fmt.Sprintf("spell %q is not an absolute path", job.Spell)})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
+	go func() {
+		// Clients send nothing after the job, so a read ends when they go
+		_, _ = io.Copy(io.Discard, conn)
+		cancel()
+	}()
+
+	status := runStatus{ID: bridge.NewCorrelationID(), Spell: job.Spell}
+	if err := d.enqueue(ctx, events, status.ID); err != nil {
+		_ = events.send(daemonEvent{Event: "done", Error: err.Error()})
+		return
+	}
+	defer func() { <-d.slots }()
+
+	status.Started = time.Now()
+	summary, decodeErr, err := d.run(ctx, job, events)
+	status.finish(summary, decodeErr, err)
+	if ctx.Err() != nil && status.Status != runSucceeded {
+		status.Status, status.Reason = runCancelled, "interrupt"
+	}
+	_ = events.send(daemonEvent{Event: "done", Status: &status})
+}
+
+// errQueueFull is returned when too many jobs are waiting for a worker
+var errQueueFull = fmt.Errorf("%d jobs are already queued; try again later", maxQueuedJobs)
+
+// enqueue waits for a free slot, telling the client how many jobs are
+// ahead of its own
+func (d *spellDaemon) enqueue(ctx context.Context, events *eventWriter, id string) error {
+	d.mu.Lock()
+	if d.queued >= maxQueuedJobs {
+		d.mu.Unlock()
+		return errQueueFull
+	}
+	ahead := d.queued
+	d.queued++
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.queued--
+		d.mu.Unlock()
+	}()
+
+	if err := events.send(daemonEvent{Event: "queued", ID: id, Ahead: ahead}); err != nil {
+		return err
+	}
+	select {
+	case d.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run hands the job to a warm worker, starting another for the pool, and
+// waits for it. The spell's output goes to w.
+func (d *spellDaemon) run(ctx context.Context, job daemonJob, w io.Writer) (summary runSummary, decodeErr, err error) {
+	var worker *warmWorker
+	select {
+	case worker = <-d.warm:
+	case <-ctx.Done():
+		return runSummary{}, ctx.Err(), ctx.Err()
+	}
+	d.refill()
+	if worker.err != nil {
+		return runSummary{}, worker.err, worker.err
+	}
+	stop := context.AfterFunc(ctx, worker.cancel)
+	defer stop()
+	defer worker.cancel()
+
+	worker.output.attach(w)
+	job.Timeout = d.timeout(job.Timeout)
+	if err := json.NewEncoder(worker.jobs).Encode(job); err != nil {
+		worker.cancel()
+	}
+	worker.jobs.Close()
+	return worker.child.wait()
+}
+
+// timeout returns the job's timeout, which may only tighten the daemon's
+func (d *spellDaemon) timeout(job time.Duration) time.Duration {
+	if job > 0 && (d.opts.Timeout == 0 || job < d.opts.Timeout) {
+		return job
+	}
+	return d.opts.Timeout
+}
+
+// runWorker is a daemon's worker: it restricts this process as the daemon
+// asked and creates a Lua engine, then runs the job it is sent in it
+func runWorker(isolation security.Isolation, opts runOptions) {
+	if err := isolation.Apply(); err != nil {
+		fatalf("cli.error.isolation", err)
+	}
+
+	warm, err := lua.NewLuaEngine(spellConfig())
+	if err != nil {
+		fatalf("cli.error.create_engine", err)
+	}
+
+	var job daemonJob
+	jobs := os.NewFile(jobFD, "job")
+	if err := json.NewDecoder(jobs).Decode(&job); err != nil {
+		if errors.Is(err, io.EOF) {
+			// The daemon stopped before it had a job for this worker
+			os.Exit(0)
+		}
+		fatalf("cli.error.daemon_job", err)
+	}
+	jobs.Close()
+	if job.Dir != "" {
+		if err := os.Chdir(job.Dir); err != nil {
+			fatalf("cli.error.daemon_job", err)
+		}
+	}
+
+	summary := os.NewFile(summaryFD, "summary")
+	defer summary.Close()
+
+	opts.Timeout = job.Timeout
+	opts.Warm = warm
+	opts.Output = "json"
+	opts.Summary = summary
+	opts.NoMetrics = true
+	runSpell(job.Spell, job.Args, opts)
+}
+
+// defaultSocket returns the daemon's socket: LLMSPELL_SOCKET, or a socket
+// for this user in the temporary directory
+func defaultSocket() string {
+	if socket := os.Getenv("LLMSPELL_SOCKET"); socket != "" {
+		return socket
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("llmspell-%d.sock", os.Getuid()))
+}
+
+// parseWorkers reads the --workers flag
+func parseWorkers(value string) int {
+	if value == "" {
+		return defaultWorkers
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		if err == nil {
+			err = fmt.Errorf("must be at least 1")
+		}
+		fatalf("cli.error.workers", value, err)
+	}
+	return n
+}
+
+// listenSocket listens on the Unix socket at path, which only this user may
+// connect to. A socket left behind by a daemon that is gone is replaced.
+func listenSocket(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Create the socket without permissions for others
+	mask := syscall.Umask(0077)
+	l, err := net.Listen("unix", path)
+	syscall.Umask(mask)
+	return l, err
+}
+
+// runDaemonCommand runs jobs sent to socket until interrupted, then
+// cancels the jobs in progress
+func runDaemonCommand(socket string, workers int, opts runOptions) {
+	l, err := listenSocket(socket)
+	if err != nil {
+		fatalf("cli.error.daemon", err)
+	}
+	defer l.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	d := newSpellDaemon(ctx, opts, workers)
+	fmt.Println(i18n.T("daemon.listening", socket, workers))
+	if err := d.serve(l); err != nil {
+		log.Print(i18n.T("cli.error.daemon", err))
+	}
+	d.wait()
+	log.Print(i18n.T("daemon.stopped"))
+}
+
+// runSubmitCommand sends a spell to the daemon on socket, prints its output
+// and summary as they arrive, and exits as the spell did
+func runSubmitCommand(args []string, socket, output string, timeout time.Duration) {
+	if len(args) < 1 {
+		fmt.Println(i18n.T("cli.error.spell_path_required"))
+		fmt.Println(i18n.T("cli.usage.submit"))
+		os.Exit(1)
+	}
+	spellPath, err := filepath.Abs(args[0])
+	if err != nil {
+		fatalf("cli.error.access_spell", err)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		fatalf("cli.error.access_spell", err)
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		fatalf("cli.error.daemon_connect", socket, err)
+	}
+	defer conn.Close()
+
+	// Ctrl-C drops the connection, which cancels the job
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, func() { conn.Close() })
+
+	job := daemonJob{Spell: spellPath, Args: args[1:], Dir: dir, Timeout: timeout}
+	if err := json.NewEncoder(conn).Encode(job); err != nil {
+		fatalf("cli.error.daemon_connect", socket, err)
+	}
+
+	status, err := followJob(conn, os.Stdout)
+	if err != nil {
+		if ctx.Err() != nil {
+			exitCancelled(engine.ErrInterrupted)
+		}
+		fatalf("cli.error.daemon_job", err)
+	}
+	if status.Summary != nil {
+		if err := status.Summary.write(os.Stdout, output); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	switch {
+	case status.ExitCode != nil:
+		os.Exit(*status.ExitCode)
+	case status.Error != "":
+		fatalf("cli.error.daemon_job", status.Error)
+	}
+}
+
+// followJob copies a job's output from the daemon's events to w, and
+// returns how the job ended
+func followJob(r io.Reader, w io.Writer) (*runStatus, error) {
+	dec := json.NewDecoder(r)
+	for {
+		var event daemonEvent
+		if err := dec.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch event.Event {
+		case "queued":
+			if event.Ahead > 0 {
+				log.Print(i18n.T("daemon.queued", event.Ahead))
+			}
+		case "output":
+			_, _ = io.WriteString(w, event.Data)
+		case "done":
+			if event.Error != "" {
+				return nil, errors.New(event.Error)
+			}
+			return event.Status, nil
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// ABOUTME: Global hooks an operator declares in a hooks file to run before and after every spell
+// ABOUTME: A hook is a Lua script or a built-in behavior; a failing pre-hook stops the run
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// postHookTimeout bounds how long all post-hooks may run together. They
+// run under a fresh context, as the spell's may already be cancelled.
+var postHookTimeout = 30 * time.Second
+
+// runHooks are the hooks read from the file named by --hooks or
+// LLMSPELL_HOOKS, as in
+//
+//	{"pre": ["log", "require-env:API_TOKEN", "hooks/prefix.lua"],
+//	 "post": ["log", "hooks/notify.lua"]}
+//
+// Entries ending in .lua are scripts, relative to the hooks file; others
+// name built-in hooks. Hooks run in the spell's engine after its bridges
+// are set up, in the order listed, around the top-level spell only.
+type runHooks struct {
+	Pre  []string `json:"pre"`
+	Post []string `json:"post"`
+
+	// dir is where the hooks file is, to resolve script paths
+	dir string
+}
+
+// hookRun describes the run a hook is called for. Err and Duration are
+// only set for post-hooks.
+type hookRun struct {
+	Spell    string
+	RunID    string
+	Params   map[string]string
+	Err      error
+	Duration time.Duration
+}
+
+// builtinHook is a hook behavior named in the hooks file instead of a
+// script. Some take an argument after a colon, as in
+// "require-env:API_TOKEN". phase is "pre" or "post".
+type builtinHook func(phase, arg string, run hookRun) error
+
+// builtinHooks are the behaviors hooks files may name
+var builtinHooks = map[string]builtinHook{
+	"log":         logHook,
+	"require-env": requireEnvHook,
+}
+
+// loadHooks reads the hooks file at path, or the one LLMSPELL_HOOKS names.
+// It returns nil when neither is set. Every entry is checked, so a typo
+// fails before any spell runs.
+func loadHooks(path string) (*runHooks, error) {
+	if path == "" {
+		path = os.Getenv("LLMSPELL_HOOKS")
+	}
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	hooks := &runHooks{dir: filepath.Dir(path)}
+	if err := json.Unmarshal(data, hooks); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, spec := range append(append([]string{}, hooks.Pre...), hooks.Post...) {
+		if err := hooks.check(spec); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return hooks, nil
+}
+
+// check reports whether spec names an existing script or a known built-in
+func (h *runHooks) check(spec string) error {
+	if isHookScript(spec) {
+		if _, err := os.Stat(h.scriptPath(spec)); err != nil {
+			return fmt.Errorf("hook script %s: %w", spec, err)
+		}
+		return nil
+	}
+	name, arg, _ := strings.Cut(spec, ":")
+	if _, ok := builtinHooks[name]; !ok {
+		return fmt.Errorf("unknown hook %q", spec)
+	}
+	if name == "require-env" && arg == "" {
+		return fmt.Errorf("hook %q needs a variable name, as in require-env:API_TOKEN", spec)
+	}
+	return nil
+}
+
+func isHookScript(spec string) bool {
+	return strings.HasSuffix(spec, ".lua")
+}
+
+func (h *runHooks) scriptPath(spec string) string {
+	if filepath.IsAbs(spec) {
+		return spec
+	}
+	return filepath.Join(h.dir, spec)
+}
+
+// hookStateOf returns the Lua state hook scripts run in: the spell's own,
+// or for a Tengo or JavaScript spell a bare state without bridges,
+// released by the returned function
+func hookStateOf(eng spellEngine) (*lua.LState, func()) {
+	if luaEngine, ok := eng.(interface{ GetLuaState() *lua.LState }); ok {
+		return luaEngine.GetLuaState(), func() {}
+	}
+	L := lua.NewState()
+	return L, L.Close
+}
+
+// runPre runs the pre-hooks in order and returns the first failure, which
+// should stop the run. A script fails by raising an error or by returning
+// false and a reason.
+func (h *runHooks) runPre(ctx context.Context, L *lua.LState, run hookRun) error {
+	if h == nil {
+		return nil
+	}
+	for _, spec := range h.Pre {
+		if err := h.run(ctx, L, spec, "pre", run); err != nil {
+			return fmt.Errorf("%s: %w", spec, err)
+		}
+	}
+	return nil
+}
+
+// runPost runs the post-hooks in order. A failing post-hook cannot undo
+// the run, so it is reported as a warning and the rest still run.
+func (h *runHooks) runPost(L *lua.LState, run hookRun, warnings *bridge.Warnings) {
+	if h == nil || len(h.Post) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeoutCause(context.Background(), postHookTimeout, engine.ErrExecutionTimeout)
+	defer cancel()
+	for _, spec := range h.Post {
+		if err := h.run(ctx, L, spec, "post", run); err != nil {
+			warnings.Add(bridge.WarnHook, i18n.T("run.post_hook_failed", spec, err), map[string]interface{}{"hook": spec})
+		}
+	}
+}
+
+// run calls one hook for phase
+func (h *runHooks) run(ctx context.Context, L *lua.LState, spec, phase string, run hookRun) error {
+	if !isHookScript(spec) {
+		name, arg, _ := strings.Cut(spec, ":")
+		return builtinHooks[name](phase, arg, run)
+	}
+
+	fn, err := L.LoadFile(h.scriptPath(spec))
+	if err != nil {
+		return err
+	}
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+
+	L.Push(fn)
+	L.Push(hookTable(L, phase, run))
+	if err := L.PCall(1, 2, nil); err != nil {
+		return engine.WrapCancel(ctx, err)
+	}
+	ok, reason := L.Get(-2), L.Get(-1)
+	L.Pop(2)
+	if ok == lua.LFalse {
+		if reason == lua.LNil {
+			return fmt.Errorf("hook returned false")
+		}
+		return fmt.Errorf("%s", reason.String())
+	}
+	return nil
+}
+
+// hookTable is what a hook script receives as its argument (local hook =
+// ...): the phase, the spell's name, the run ID and the spell's params.
+// Post-hooks also get status ("success", "error", or a cancellation reason
+// such as "deadline"), error, and duration in seconds.
+func hookTable(L *lua.LState, phase string, run hookRun) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("phase", lua.LString(phase))
+	t.RawSetString("spell", lua.LString(run.Spell))
+	t.RawSetString("run_id", lua.LString(run.RunID))
+	params := L.NewTable()
+	for k, v := range run.Params {
+		params.RawSetString(k, lua.LString(v))
+	}
+	t.RawSetString("params", params)
+	if phase == "post" {
+		t.RawSetString("status", lua.LString(hookStatus(run.Err)))
+		if run.Err != nil {
+			t.RawSetString("error", lua.LString(run.Err.Error()))
+		}
+		t.RawSetString("duration", lua.LNumber(run.Duration.Seconds()))
+	}
+	return t
+}
+
+// hookStatus says how a run ended
+func hookStatus(err error) string {
+	if err == nil {
+		return "success"
+	}
+	if reason := engine.CancelReason(err); reason != "" {
+		return reason
+	}
+	return "error"
+}
+
+// logHook logs when the spell starts and ends
+func logHook(phase, _ string, run hookRun) error {
+	if phase == "pre" {
+		log.Printf("hook: spell %s starting (run %s)", run.Spell, run.RunID)
+		return nil
+	}
+	log.Printf("hook: spell %s finished in %s: %s (run %s)", run.Spell, run.Duration.Round(time.Millisecond), hookStatus(run.Err), run.RunID)
+	return nil
+}
+
+// requireEnvHook stops the run unless the environment variable arg is set,
+// such as a token the spell's callers must provide
+func requireEnvHook(phase, arg string, _ hookRun) error {
+	if phase == "pre" && os.Getenv(arg) == "" {
+		return fmt.Errorf("environment variable %s is not set", arg)
+	}
+	return nil
+}
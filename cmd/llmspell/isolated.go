@@ -0,0 +1,273 @@
+// ABOUTME: Runs spells in a separate, restricted child process for --isolated and isolating profiles
+// ABOUTME: The child applies resource limits and seccomp, then returns its run summary, and any state changes, over pipes
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+// summaryFD is the descriptor an isolated child writes its run summary to;
+// the first entry of ExtraFiles becomes fd 3 in the child
+const summaryFD = 3
+
+// stateEventsFD is the descriptor an isolated child writes its state
+// changes to, as JSON lines, when stateEventsEnv is set
+const stateEventsFD = 4
+
+// stateEventsEnv tells an isolated child its parent follows its state
+const stateEventsEnv = "LLMSPELL_STATE_EVENTS"
+
+// runIsolated runs a spell in a child process of this executable, so a
+// malicious spell cannot corrupt the parent. The child's output is passed
+// through and its summary is printed here.
+func runIsolated(spellPath string, args []string, opts runOptions) {
+	// Ctrl-C reaches the child too; give it time to clean up
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	child, err := newIsolatedChild(ctx, append([]string{"run", spellPath}, args...), opts)
+	if err != nil {
+		fatalf("cli.error.isolated_start", err)
+	}
+	child.cmd.Stdin, child.cmd.Stdout, child.cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// fatalf and os.Exit skip deferred calls, so clean up explicitly
+	if err := child.start(); err != nil {
+		fatalf("cli.error.isolated_start", err)
+	}
+
+	summary, decodeErr, err := child.wait()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.Exited() {
+			// The child has already reported why it failed
+			os.Exit(exitErr.ExitCode())
+		}
+		// Killed by a signal, such as SIGXCPU or SIGKILL from a resource limit
+		switch {
+		case ctx.Err() != nil:
+			exitCancelled(fmt.Errorf("%w: %w", engine.ErrInterrupted, err))
+		case errors.As(err, &exitErr) && security.KilledByLimit(exitErr.ProcessState):
+			exitCancelled(fmt.Errorf("%w: %w", engine.ErrResourceLimit, err))
+		}
+		fatalf("cli.error.isolated_failed", err)
+	}
+	if decodeErr != nil {
+		fatalf("cli.error.isolated_summary", decodeErr)
+	}
+
+	summary.Isolated = true
+	if err := summary.write(os.Stdout, opts.Output); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	recordToolMetrics(summary)
+}
+
+// isolatedChild is a child process of this executable that runs a spell
+// under isolation and sends its run summary back over a pipe
+type isolatedChild struct {
+	cmd *exec.Cmd
+
+	summary, summaryWriter *os.File
+
+	// events carries the state changes to onEvent, until eventsDone is
+	// closed, when the parent asked for them
+	events, eventsWriter *os.File
+	onEvent              func(bridge.StateEvent)
+	eventsDone           chan struct{}
+
+	// cleanup releases what the isolation set up
+	cleanup func()
+}
+
+// executable finds the binary isolated children run
+var executable = os.Executable
+
+// childIsolation returns the restrictions of a child run with opts: those
+// of opts.Profile, or the default isolation
+func childIsolation(opts runOptions) security.Isolation {
+	if opts.Profile.Isolation != nil {
+		return *opts.Profile.Isolation
+	}
+	return security.DefaultIsolation()
+}
+
+// newIsolatedChild prepares a child that runs command, such as "run" and a
+// spell, under the isolation of opts.Profile, or the default isolation.
+// Cancelling ctx interrupts it. When opts.StateEvents is set, it is called
+// with the changes to the spell's state. The caller connects its standard
+// streams, then starts it.
+func newIsolatedChild(ctx context.Context, command []string, opts runOptions) (*isolatedChild, error) {
+	isolation := childIsolation(opts)
+
+	exe, err := executable()
+	if err != nil {
+		return nil, err
+	}
+
+	profile := opts.Profile.Name
+	if opts.Profile.Path != "" {
+		profile = opts.Profile.Path
+	}
+	childArgs := []string{"--profile", profile, "--lang", i18n.Default().Language()}
+	if opts.LLMLog != "" {
+		childArgs = append(childArgs, "--llm-log", opts.LLMLog)
+	}
+	if opts.CacheTTL > 0 {
+		childArgs = append(childArgs, "--cache-ttl", opts.CacheTTL.String())
+	}
+	if opts.NoCache {
+		childArgs = append(childArgs, "--no-cache")
+	}
+	childArgs = append(childArgs, "--call-timeout", opts.CallTimeout.String())
+	if opts.Timeout > 0 {
+		childArgs = append(childArgs, "--timeout", opts.Timeout.String())
+	}
+	if opts.MaxLLMCalls > 0 {
+		childArgs = append(childArgs, "--max-llm-calls", strconv.Itoa(opts.MaxLLMCalls))
+	}
+	if opts.Snapshot != "" {
+		childArgs = append(childArgs, "--snapshot", opts.Snapshot)
+	}
+	if opts.ReplayPath != "" {
+		childArgs = append(childArgs, "--replay", opts.ReplayPath)
+	}
+	if opts.HooksPath != "" {
+		childArgs = append(childArgs, "--hooks", opts.HooksPath)
+	}
+	if !opts.Now.IsZero() && opts.ReplayPath == "" {
+		childArgs = append(childArgs, "--now", opts.Now.Format(time.RFC3339Nano))
+	}
+	if opts.ProfileSpell != "" {
+		childArgs = append(childArgs, "--profile-spell", opts.ProfileSpell)
+	}
+	childArgs = append(childArgs, command...)
+
+	summaryReader, summaryWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, exe, childArgs...)
+	cmd.ExtraFiles = []*os.File{summaryWriter}
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = 5 * time.Second
+	child := &isolatedChild{cmd: cmd, summary: summaryReader, summaryWriter: summaryWriter}
+	if opts.StateEvents != nil {
+		if child.events, child.eventsWriter, err = os.Pipe(); err != nil {
+			child.closePipes()
+			return nil, err
+		}
+		child.onEvent = opts.StateEvents
+		cmd.ExtraFiles = append(cmd.ExtraFiles, child.eventsWriter)
+		cmd.Env = append(cmd.Environ(), stateEventsEnv+"=1")
+	}
+	if child.cleanup, err = isolation.PrepareCommand(cmd); err != nil {
+		child.closePipes()
+		return nil, fmt.Errorf("cannot isolate spell process: %w", err)
+	}
+	return child, nil
+}
+
+// closePipes closes both ends of the child's pipes
+func (c *isolatedChild) closePipes() {
+	for _, f := range []*os.File{c.summary, c.summaryWriter, c.events, c.eventsWriter} {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// start starts the child. The parent's ends of the pipes are closed once
+// the child has its own, so reading them ends when it exits.
+func (c *isolatedChild) start() error {
+	err := c.cmd.Start()
+	c.summaryWriter.Close()
+	if c.eventsWriter != nil {
+		c.eventsWriter.Close()
+	}
+	if err != nil {
+		c.summary.Close()
+		if c.events != nil {
+			c.events.Close()
+		}
+		c.cleanup()
+		return err
+	}
+	if c.events != nil {
+		c.eventsDone = make(chan struct{})
+		go c.readEvents()
+	}
+	return nil
+}
+
+// readEvents passes the state changes the child sends to onEvent, until
+// the child exits or sends something else
+func (c *isolatedChild) readEvents() {
+	defer close(c.eventsDone)
+	defer c.events.Close()
+	dec := json.NewDecoder(c.events)
+	for {
+		var event bridge.StateEvent
+		if err := dec.Decode(&event); err != nil {
+			// Drain the pipe so the child never blocks on it
+			_, _ = io.Copy(io.Discard, c.events)
+			return
+		}
+		c.onEvent(event)
+	}
+}
+
+// wait reads the child's summary and waits for it to exit. decodeErr says
+// why there was no summary; err is how the child exited.
+func (c *isolatedChild) wait() (summary runSummary, decodeErr, err error) {
+	decodeErr = json.NewDecoder(c.summary).Decode(&summary)
+	err = c.cmd.Wait()
+	c.summary.Close()
+	if c.eventsDone != nil {
+		<-c.eventsDone
+	}
+	c.cleanup()
+	return summary, decodeErr, err
+}
+
+// runIsolatedChild restricts this process as its parent asked, then runs the
+// spell and sends the summary back as JSON
+func runIsolatedChild(isolation security.Isolation, spellPath string, args []string, opts runOptions) {
+	if err := isolation.Apply(); err != nil {
+		fatalf("cli.error.isolation", err)
+	}
+
+	summary := os.NewFile(summaryFD, "summary")
+	defer summary.Close()
+
+	opts.Output = "json"
+	opts.Summary = summary
+	opts.NoMetrics = true
+	if os.Getenv(stateEventsEnv) != "" {
+		// Children of this process have no such pipe
+		os.Unsetenv(stateEventsEnv)
+		events := os.NewFile(stateEventsFD, "state-events")
+		defer events.Close()
+		enc := json.NewEncoder(events)
+		opts.StateEvents = func(event bridge.StateEvent) { _ = enc.Encode(event) }
+	}
+	runSpell(spellPath, args, opts)
+}
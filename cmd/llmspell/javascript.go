@@ -0,0 +1,69 @@
+// ABOUTME: Runs JavaScript spells: registers the llm, tools, agents, and state modules in a goja engine
+// ABOUTME: Modules start their bridges on first use and are restricted like the Lua ones
+
+package main
+
+import (
+	"context"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	jsengine "github.com/lexlapax/go-llmspell/pkg/engine/goja"
+)
+
+// prepareJavaScript registers the llm, tools, agents, and state modules in
+// eng as globals, each built when the spell first uses it. As for Lua,
+// every module is restricted according to the security profile.
+func (s *spellSession) prepareJavaScript(eng *jsengine.GojaEngine, spellName string, spell *bridge.SpellBridge) *spellBridges {
+	sb := newSpellBridges(s.args, s.callLog)
+	sb.watchdog = s.watch
+	sb.guard = s.guard
+	sb.confirm = s.confirm
+	sb.toolResults = s.tools
+	sb.plugins = s.plugins
+	sb.responses = s.replies
+	sb.replayProviders = s.replayProviders
+	sb.warnings = s.warnings
+
+	if s.clock != nil {
+		eng.SetClock(s.clock)
+	}
+
+	_ = eng.RegisterModuleLoader("llm", func() (jsengine.Module, error) {
+		llmBridge, ok := sb.startLLM()
+		if !ok {
+			return s.restrictJavaScript(eng, "llm", jsengine.LLMModule(eng, &mockLLM{})), nil
+		}
+		// LLM responses are only reused when the operator asked for results
+		// to persist, as repeated prompts may expect fresh answers
+		if s.cache.Persistent() {
+			llmBridge.SetResponseCache(s.cache)
+		}
+		return s.restrictJavaScript(eng, "llm", jsengine.LLMModule(eng, llmBridge)), nil
+	})
+	_ = eng.RegisterModuleLoader("tools", func() (jsengine.Module, error) {
+		toolBridge, _ := sb.tools.Get(context.Background())
+		return s.restrictJavaScript(eng, "tools", jsengine.ToolsModule(eng, toolBridge.(*bridge.ToolBridge))), nil
+	})
+	_ = eng.RegisterModuleLoader("agents", func() (jsengine.Module, error) {
+		agentBridge, err := sb.agents.Get(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return s.restrictJavaScript(eng, "agents", jsengine.AgentsModule(eng, agentBridge.(bridge.AgentBridge))), nil
+	})
+	_ = eng.RegisterModuleLoader("state", func() (jsengine.Module, error) {
+		return s.restrictJavaScript(eng, "state", jsengine.StateModule(eng, spell.State(), s.states, spell.Channels())), nil
+	})
+	return sb
+}
+
+// restrictJavaScript applies the session's method policy, rate limits, and
+// call budget to a JavaScript module, and counts and profiles its calls
+func (s *spellSession) restrictJavaScript(eng *jsengine.GojaEngine, module string, m jsengine.Module) jsengine.Module {
+	jsengine.ApplyMethodPolicy(eng, module, m, &s.profile.Methods)
+	jsengine.ApplyRateLimits(eng, module, m, s.limiter)
+	jsengine.ApplyCallBudget(eng, module, m, s.budget)
+	jsengine.ApplyCallStats(module, m, s.calls)
+	jsengine.ApplyProfile(module, m, s.profiler)
+	return m
+}
@@ -5,19 +5,34 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/clock"
 	"github.com/lexlapax/go-llmspell/pkg/engine"
+	jsengine "github.com/lexlapax/go-llmspell/pkg/engine/goja"
 	"github.com/lexlapax/go-llmspell/pkg/engine/lua"
 	"github.com/lexlapax/go-llmspell/pkg/engine/lua/bridges"
 	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	tengoengine "github.com/lexlapax/go-llmspell/pkg/engine/tengo"
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+	"github.com/lexlapax/go-llmspell/pkg/statestore"
 	"github.com/lexlapax/go-llmspell/pkg/tools"
 )
 
@@ -30,65 +45,675 @@ func main() {
 		}
 	}
 
-	if len(os.Args) < 2 {
+	args, lang := extractFlag(os.Args[1:], "lang")
+	args, profile := extractFlag(args, "profile")
+	args, output := extractFlag(args, "output")
+	args, llmLog := extractFlag(args, "llm-log")
+	args, isolated := extractSwitch(args, "isolated")
+	args, cacheTTL := extractFlag(args, "cache-ttl")
+	args, noCache := extractSwitch(args, "no-cache")
+	args, callTimeout := extractFlag(args, "call-timeout")
+	args, timeout := extractFlag(args, "timeout")
+	args, maxLLMCalls := extractFlag(args, "max-llm-calls")
+	args, snapshot := extractFlag(args, "snapshot")
+	args, replay := extractFlag(args, "replay")
+	args, hooksPath := extractFlag(args, "hooks")
+	args, now := extractFlag(args, "now")
+	args, profileSpell := extractFlag(args, "profile-spell")
+	args, socket := extractFlag(args, "socket")
+	args, workers := extractFlag(args, "workers")
+	setupLanguage(lang)
+
+	if len(args) < 1 {
 		printUsage()
 		os.Exit(1)
 	}
 
-	command := os.Args[1]
+	command := args[0]
+
+	// runOpts gathers the options for commands that run spells
+	runOpts := func() runOptions {
+		opts := runOptions{
+			Profile:      loadProfile(profile),
+			Output:       output,
+			LLMLog:       llmLog,
+			CacheTTL:     parseCacheTTL(cacheTTL),
+			NoCache:      noCache,
+			CallTimeout:  parseCallTimeout(callTimeout),
+			Timeout:      parseTimeout(timeout),
+			MaxLLMCalls:  parseMaxLLMCalls(maxLLMCalls),
+			Snapshot:     snapshot,
+			HooksPath:    hooksPath,
+			Now:          parseNow(now),
+			ProfileSpell: profileSpell,
+		}
+		hooks, err := loadHooks(hooksPath)
+		if err != nil {
+			fatalf("cli.error.hooks", err)
+		}
+		opts.Hooks = hooks
+		return opts
+	}
 
 	switch command {
 	case "run":
-		if len(os.Args) < 3 {
-			fmt.Println("Error: spell path required")
-			fmt.Println("Usage: llmspell run <spell-path> [param=value ...]")
+		if len(args) < 2 && replay == "" {
+			fmt.Println(i18n.T("cli.error.spell_path_required"))
+			fmt.Println(i18n.T("cli.usage.run_short"))
 			os.Exit(1)
 		}
-		runSpell(os.Args[2], os.Args[3:])
+		opts := runOpts()
+		spellPath, spellArgs := "", args[1:]
+		if len(spellArgs) > 0 {
+			spellPath, spellArgs = spellArgs[0], spellArgs[1:]
+		}
+		if replay != "" {
+			spellPath, spellArgs = opts.replay(replay, spellPath, spellArgs)
+		}
+		isolation, child, err := security.IsolationFromEnv()
+		if err != nil {
+			fatalf("cli.error.isolation", err)
+		}
+		switch {
+		case child:
+			runIsolatedChild(isolation, spellPath, spellArgs, opts)
+		case isolated || opts.Profile.Isolation != nil:
+			runIsolated(spellPath, spellArgs, opts)
+		default:
+			runSpell(spellPath, spellArgs, opts)
+		}
+	case "serve":
+		runServeCommand(args[1:], runOpts())
+	case "mcp-serve":
+		runMCPServeCommand(args[1:], runOpts())
+	case "daemon":
+		if socket == "" {
+			socket = defaultSocket()
+		}
+		runDaemonCommand(socket, parseWorkers(workers), runOpts())
+	case "submit":
+		if socket == "" {
+			socket = defaultSocket()
+		}
+		runSubmitCommand(args[1:], socket, output, parseTimeout(timeout))
+	case "worker":
+		// Started by a daemon to run one of its jobs
+		isolation, child, err := security.IsolationFromEnv()
+		if err != nil || !child {
+			fatalf("cli.error.isolation", fmt.Errorf("workers are started by llmspell daemon: %v", err))
+		}
+		runWorker(isolation, runOpts())
+	case "tools":
+		runToolsCommand(args[1:])
+	case "security":
+		runSecurityCommand(args[1:], loadProfile(profile))
+	case "state":
+		runStateCommand(args[1:])
+	case "cache":
+		runCacheCommand(args[1:], output)
+	case "metrics":
+		runMetricsCommand(args[1:], output)
+	case "secrets":
+		runSecretsCommand(args[1:], os.Stdin)
 	case "help", "-h", "--help":
 		printUsage()
 	case "version", "-v", "--version":
 		fmt.Println("llmspell v0.1.0")
 	default:
-		fmt.Printf("Unknown command: %s\n", command)
+		fmt.Println(i18n.T("cli.error.unknown_command", command))
 		printUsage()
 		os.Exit(1)
 	}
 }
 
+// extractFlag removes a --name flag from the arguments and returns its value
+func extractFlag(args []string, name string) ([]string, string) {
+	flag := "--" + name
+	rest := make([]string, 0, len(args))
+	value := ""
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == flag && i+1 < len(args):
+			value = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], flag+"="):
+			value = strings.TrimPrefix(args[i], flag+"=")
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return rest, value
+}
+
+// extractSwitch removes a --name flag that takes no value and reports
+// whether it was present
+func extractSwitch(args []string, name string) ([]string, bool) {
+	flag := "--" + name
+	rest := make([]string, 0, len(args))
+	found := false
+	for _, arg := range args {
+		if arg == flag {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, found
+}
+
+// loadProfile resolves the security profile, built in or a .json file,
+// from the --profile flag or LLMSPELL_SECURITY_PROFILE
+func loadProfile(name string) security.Profile {
+	name = security.DetectProfile(name)
+	lookup := security.LookupProfile
+	if strings.HasSuffix(name, ".json") {
+		lookup = security.LoadProfile
+	}
+	profile, err := lookup(name)
+	if err != nil {
+		fatalf("cli.error.security_profile", err)
+	}
+	return profile
+}
+
+// parseCacheTTL reads how long cached results last across runs from the
+// --cache-ttl flag or LLMSPELL_CACHE_TTL; zero keeps them for one run
+func parseCacheTTL(value string) time.Duration {
+	return parseDuration(value, "LLMSPELL_CACHE_TTL", 0, "cli.error.cache_ttl")
+}
+
+// defaultCallTimeout is how long an LLM or tool call may run before the
+// watchdog abandons it
+const defaultCallTimeout = time.Minute
+
+// parseCallTimeout reads how long an LLM or tool call may run from the
+// --call-timeout flag or LLMSPELL_CALL_TIMEOUT; zero only abandons calls
+// still running when the spell is stopped
+func parseCallTimeout(value string) time.Duration {
+	return parseDuration(value, "LLMSPELL_CALL_TIMEOUT", defaultCallTimeout, "cli.error.call_timeout")
+}
+
+// parseTimeout reads how long a spell may run from the --timeout flag or
+// LLMSPELL_TIMEOUT; zero lets it run until it finishes
+func parseTimeout(value string) time.Duration {
+	return parseDuration(value, "LLMSPELL_TIMEOUT", 0, "cli.error.timeout")
+}
+
+// parseDuration reads a duration flag, falling back to the environment
+// variable env and then to def. Invalid or negative values are fatal.
+func parseDuration(value, env string, def time.Duration, errID string) time.Duration {
+	if value == "" {
+		value = os.Getenv(env)
+	}
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		if err == nil {
+			err = fmt.Errorf("must not be negative")
+		}
+		fatalf(errID, value, err)
+	}
+	return d
+}
+
+// parseMaxLLMCalls reads how many LLM requests a run may make from the
+// --max-llm-calls flag or LLMSPELL_MAX_LLM_CALLS; zero means no limit
+func parseMaxLLMCalls(value string) int {
+	if value == "" {
+		value = os.Getenv("LLMSPELL_MAX_LLM_CALLS")
+	}
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		if err == nil {
+			err = fmt.Errorf("must not be negative")
+		}
+		fatalf("cli.error.max_llm_calls", value, err)
+	}
+	return n
+}
+
+// parseNow reads the time the run's clock is stopped at from the --now
+// flag; zero means the run uses the system clock
+func parseNow(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	now, err := clock.Parse(value)
+	if err != nil {
+		fatalf("cli.error.now", value, err)
+	}
+	return now
+}
+
+// runContext returns the context a spell runs under and a function that
+// cancels it with a cause. Ctrl-C or SIGTERM cancels it with
+// engine.ErrInterrupted, and a timeout, when set, with
+// engine.ErrExecutionTimeout. stop releases the context's resources.
+func runContext(timeout time.Duration) (ctx context.Context, cancel context.CancelCauseFunc, stop func()) {
+	ctx, cancel = context.WithCancelCause(context.Background())
+	stopTimeout := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, stopTimeout = context.WithTimeoutCause(ctx, timeout, engine.ErrExecutionTimeout)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel(engine.ErrInterrupted)
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel, func() {
+		signal.Stop(signals)
+		stopTimeout()
+		cancel(nil)
+	}
+}
+
+// rootTrace starts the run's trace, joining the one in TRACEPARENT when a
+// tracing parent process set it
+func rootTrace() bridge.TraceContext {
+	if traceparent := os.Getenv(bridge.TraceparentEnv); traceparent != "" {
+		trace, err := bridge.ParseTraceparent(traceparent)
+		if err == nil {
+			return trace
+		}
+		log.Printf("Warning: %v", err)
+	}
+	return bridge.NewTraceContext()
+}
+
+// newResultCache creates the cache sub-spell results are memoized in, or
+// nil when caching is off. Entries persist under ~/.llmspell/cache when a
+// TTL is set.
+func newResultCache(opts runOptions) *bridge.ResultCache {
+	if opts.NoCache {
+		return nil
+	}
+	cacheOpts := bridge.ResultCacheOptions{TTL: opts.CacheTTL}
+	if opts.CacheTTL > 0 {
+		if home, err := os.UserHomeDir(); err == nil {
+			cacheOpts.Dir = filepath.Join(home, ".llmspell", "cache")
+		}
+	}
+	return bridge.NewResultCache(cacheOpts)
+}
+
+// Limits of the cache spells use through the cache module, shared by a
+// spell and its sub-spells
+const (
+	scriptCacheEntries = 1024
+	scriptCacheBytes   = 16 << 20
+)
+
+const (
+	// stateVersions is how many versions of each saved state are kept
+	stateVersions = 10
+
+	// stateSnapshotEvery is how often a saved state version is written in
+	// full; the versions between hold only what changed
+	stateSnapshotEvery = 5
+)
+
+// newStateStore returns where spells save state across runs:
+// LLMSPELL_STATE_STORE, a directory or a sqlite://, redis://, or s3:// URL
+// that instances can share, else LLMSPELL_STATE_DIR or ~/.llmspell/state.
+// Versions are compressed and saved as changes between full snapshots, and
+// the last stateVersions of each state are kept.
+func newStateStore() *bridge.SavedStates {
+	opts := bridge.SavedStatesOptions{Compress: true, Keep: stateVersions, SnapshotEvery: stateSnapshotEvery}
+	if location := os.Getenv("LLMSPELL_STATE_STORE"); location != "" {
+		store, err := statestore.Open(location)
+		if err != nil {
+			fatalf("cli.error.state_store", err)
+		}
+		return bridge.NewSavedStates(store, opts)
+	}
+
+	dir := os.Getenv("LLMSPELL_STATE_DIR")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		dir = filepath.Join(home, ".llmspell", "state")
+	}
+	return bridge.NewSavedStates(bridge.NewFileStateStore(dir), opts)
+}
+
+// newScriptCache creates the backend of the cache module, or nil, which
+// caches nothing, with --no-cache
+func newScriptCache(opts runOptions) bridge.CacheBackend {
+	if opts.NoCache {
+		return nil
+	}
+	return bridge.NewMemoryCache(scriptCacheEntries, scriptCacheBytes)
+}
+
+// Limits of the cache of deterministic tools' results, shared by a spell
+// and its sub-spells
+const (
+	toolCacheEntries = 1024
+	toolCacheBytes   = 16 << 20
+	toolCacheTTL     = 15 * time.Minute
+)
+
+// newToolCache returns the backend deterministic tools' results are cached
+// in, or nil with --no-cache
+func newToolCache(opts runOptions) bridge.CacheBackend {
+	if opts.NoCache {
+		return nil
+	}
+	return bridge.NewMemoryCache(toolCacheEntries, toolCacheBytes)
+}
+
+// loadPlugins reads the tool plugins of ~/.llmspell/plugins.json, which
+// load when a spell first uses the tools module. An invalid file is
+// reported to warnings.
+func loadPlugins(warnings *bridge.Warnings) *bridge.Plugins {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	config, err := bridge.LoadPluginsConfig(filepath.Join(home, ".llmspell", "plugins.json"))
+	if err != nil && !os.IsNotExist(err) {
+		warnings.Add(bridge.WarnConfig, err.Error(), nil)
+	}
+	return bridge.NewPlugins(config)
+}
+
+// newLLMCache returns the store spells cache LLM responses in once they
+// enable llm.cache, or nil, leaving them without one, with --no-cache
+func newLLMCache(opts runOptions) bridge.ResponseStore {
+	if opts.NoCache {
+		return nil
+	}
+	store, err := newResponseStore()
+	if err != nil {
+		fatalf("cli.error.llm_cache", err)
+	}
+	return store
+}
+
+// newVectorStore returns the store of the vectorstore module:
+// LLMSPELL_VECTOR_STORE, memory or a sqlite:// or qdrant:// URL, else
+// ~/.llmspell/vectors.db, or memory when there is no home directory
+func newVectorStore() (bridge.VectorStore, error) {
+	if location := os.Getenv("LLMSPELL_VECTOR_STORE"); location != "" {
+		return statestore.OpenVectorStore(location)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return bridge.NewMemoryVectorStore(), nil
+	}
+	dir := filepath.Join(home, ".llmspell")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return statestore.NewSQLiteVectorStore(filepath.Join(dir, "vectors.db"))
+}
+
+// openCallLog opens the LLM call log named by the --llm-log flag or
+// LLMSPELL_LLM_LOG: JSON lines appended to a file, or written to stderr for
+// "-". Prompt and response text is only logged when LLMSPELL_LLM_LOG_BODIES
+// is true. It returns nil and a no-op close when no log is configured.
+func openCallLog(path, runID string) (*bridge.CallLogger, func()) {
+	if path == "" {
+		path = os.Getenv("LLMSPELL_LLM_LOG")
+	}
+	if path == "" {
+		return nil, func() {}
+	}
+
+	out := os.Stderr
+	closeLog := func() {}
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			fatalf("cli.error.open_llm_log", err)
+		}
+		out = f
+		closeLog = func() { _ = f.Close() }
+	}
+
+	logBodies, _ := strconv.ParseBool(os.Getenv("LLMSPELL_LLM_LOG_BODIES"))
+	logger := slog.New(slog.NewJSONHandler(out, nil))
+	return bridge.NewCallLogger(logger, bridge.CallLogOptions{
+		RunID:           runID,
+		LogBodies:       logBodies,
+		SpanFromContext: bridge.SpanFromContext,
+	}), closeLog
+}
+
+// setupLanguage loads the message catalog for the chosen language. Users can
+// override or add translations with <lang>.json files in ~/.llmspell/locales
+// or in the directory named by LLMSPELL_LOCALE_DIR.
+func setupLanguage(lang string) {
+	var dirs []string
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".llmspell", "locales"))
+	}
+	dirs = append(dirs, os.Getenv("LLMSPELL_LOCALE_DIR"))
+
+	catalog, err := i18n.New(i18n.DetectLanguage(lang), dirs...)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	i18n.SetDefault(catalog)
+}
+
+// exitCancelled exits with the code for why the spell was cancelled, if it
+// was, so automation can tell an interrupt from a timeout or budget
+func exitCancelled(err error) {
+	if reason := engine.CancelReason(err); reason != "" {
+		log.Print(i18n.T("cli.error.spell_cancelled", reason, err))
+		os.Exit(engine.ExitCode(err))
+	}
+}
+
+// fatalf logs a translated error message and exits
+func fatalf(id string, args ...interface{}) {
+	log.Fatal(i18n.T(id, args...))
+}
+
 func printUsage() {
-	fmt.Println("llmspell - Cast scripting spells to animate LLM golems")
+	fmt.Println(i18n.T("cli.usage.title"))
+	fmt.Println()
+	fmt.Println(i18n.T("cli.usage.heading"))
+	fmt.Println(i18n.T("cli.usage.run"))
+	fmt.Println(i18n.T("cli.usage.serve"))
+	fmt.Println(i18n.T("cli.usage.mcp_serve"))
+	fmt.Println(i18n.T("cli.usage.daemon"))
+	fmt.Println(i18n.T("cli.usage.submit"))
+	fmt.Println(i18n.T("cli.usage.tools_docs"))
+	fmt.Println(i18n.T("cli.usage.tools_openapi"))
+	fmt.Println(i18n.T("cli.usage.security_show"))
+	fmt.Println(i18n.T("cli.usage.state_export"))
+	fmt.Println(i18n.T("cli.usage.state_import"))
+	fmt.Println(i18n.T("cli.usage.cache_list"))
+	fmt.Println(i18n.T("cli.usage.cache_purge"))
+	fmt.Println(i18n.T("cli.usage.metrics_tools"))
+	fmt.Println(i18n.T("cli.usage.secrets_set"))
+	fmt.Println(i18n.T("cli.usage.secrets_list"))
+	fmt.Println(i18n.T("cli.usage.secrets_delete"))
+	fmt.Println(i18n.T("cli.usage.help"))
+	fmt.Println(i18n.T("cli.usage.version"))
 	fmt.Println()
-	fmt.Println("Usage:")
-	fmt.Println("  llmspell run <spell-path> [param=value ...]  Run a spell")
-	fmt.Println("  llmspell help                                 Show this help")
-	fmt.Println("  llmspell version                              Show version")
+	fmt.Println(i18n.T("cli.usage.options"))
+	fmt.Println(i18n.T("cli.usage.lang"))
+	fmt.Println(i18n.T("cli.usage.profile"))
+	fmt.Println(i18n.T("cli.usage.output"))
+	fmt.Println(i18n.T("cli.usage.llm_log"))
+	fmt.Println(i18n.T("cli.usage.isolated"))
+	fmt.Println(i18n.T("cli.usage.no_cache"))
+	fmt.Println(i18n.T("cli.usage.cache_ttl"))
+	fmt.Println(i18n.T("cli.usage.call_timeout"))
+	fmt.Println(i18n.T("cli.usage.timeout"))
+	fmt.Println(i18n.T("cli.usage.max_llm_calls"))
+	fmt.Println(i18n.T("cli.usage.snapshot"))
+	fmt.Println(i18n.T("cli.usage.replay"))
+	fmt.Println(i18n.T("cli.usage.hooks"))
+	fmt.Println(i18n.T("cli.usage.now"))
+	fmt.Println(i18n.T("cli.usage.profile_spell"))
+	fmt.Println(i18n.T("cli.usage.socket"))
+	fmt.Println(i18n.T("cli.usage.workers"))
 	fmt.Println()
-	fmt.Println("Examples:")
+	fmt.Println(i18n.T("cli.usage.examples"))
 	fmt.Println("  llmspell run examples/spells/hello-llm")
 	fmt.Println("  llmspell run examples/spells/tool-example")
 	fmt.Println("  llmspell run my-spell.lua topic=\"AI safety\"")
 	fmt.Println()
-	fmt.Println("Environment Variables:")
-	fmt.Println("  OPENAI_API_KEY      OpenAI API key")
-	fmt.Println("  ANTHROPIC_API_KEY   Anthropic API key")
-	fmt.Println("  GEMINI_API_KEY      Google Gemini API key")
-	fmt.Println("  MOCK_LLM            Set to 'true' to use mock LLM for testing")
+	fmt.Println(i18n.T("cli.usage.environment"))
+	fmt.Println(i18n.T("cli.usage.env_openai"))
+	fmt.Println(i18n.T("cli.usage.env_anthropic"))
+	fmt.Println(i18n.T("cli.usage.env_gemini"))
+	fmt.Println(i18n.T("cli.usage.env_mock"))
+	fmt.Println(i18n.T("cli.usage.env_lang"))
+	fmt.Println(i18n.T("cli.usage.env_profile"))
+	fmt.Println(i18n.T("cli.usage.env_llm_log"))
+	fmt.Println(i18n.T("cli.usage.env_llm_log_bodies"))
+	fmt.Println(i18n.T("cli.usage.env_cache_ttl"))
+	fmt.Println(i18n.T("cli.usage.env_call_timeout"))
+	fmt.Println(i18n.T("cli.usage.env_timeout"))
+	fmt.Println(i18n.T("cli.usage.env_max_llm_calls"))
+	fmt.Println(i18n.T("cli.usage.env_hooks"))
+	fmt.Println(i18n.T("cli.usage.env_socket"))
+	fmt.Println(i18n.T("cli.usage.env_state_dir"))
+	fmt.Println(i18n.T("cli.usage.env_state_store"))
+	fmt.Println(i18n.T("cli.usage.env_llm_cache"))
+	fmt.Println(i18n.T("cli.usage.env_vector_store"))
+	fmt.Println(i18n.T("cli.usage.env_metrics"))
+	fmt.Println(i18n.T("cli.usage.env_secrets_file"))
+	fmt.Println(i18n.T("cli.usage.env_secrets_key"))
+}
+
+// runOptions are the settings for one spell run
+type runOptions struct {
+	// Profile restricts which bridge methods the spell may call
+	Profile security.Profile
+
+	// Output selects the run summary format: "json" or text
+	Output string
+
+	// LLMLog is where LLM calls are logged: a file path, "-" for stderr,
+	// or empty to use LLMSPELL_LLM_LOG
+	LLMLog string
+
+	// Summary receives the run summary; nil means stdout
+	Summary io.Writer
+
+	// StateEvents, when set, is called with each change to the spell's
+	// state, including those its sub-spells write through to it
+	StateEvents func(bridge.StateEvent)
+
+	// CacheTTL keeps sub-spell results and LLM responses across runs for
+	// this long; zero memoizes sub-spells within the run only
+	CacheTTL time.Duration
+
+	// NoCache turns result caching off
+	NoCache bool
+
+	// CallTimeout is how long an LLM or tool call may run before the
+	// watchdog abandons it; zero only abandons calls when the spell stops
+	CallTimeout time.Duration
+
+	// Timeout stops the spell after this long; zero means no limit
+	Timeout time.Duration
+
+	// MaxLLMCalls stops the spell when it tries to make more LLM requests
+	// than this, counting sub-spells; zero means no limit
+	MaxLLMCalls int
+
+	// Snapshot is where to record the run so it can be replayed; empty
+	// records nothing
+	Snapshot string
+
+	// Replay, when set, is the snapshot being re-run: math.random is seeded
+	// as it was and LLM requests are answered from its recording
+	Replay *runSnapshot
+
+	// ReplayPath is the file Replay was read from
+	ReplayPath string
+
+	// Hooks run before and after the spell; nil runs none
+	Hooks *runHooks
+
+	// HooksPath is the file Hooks was read from, passed on to an isolated
+	// child
+	HooksPath string
+
+	// Now, when set, stops the spell's clock at this time, so time.now(),
+	// time.date() and the timestamps the run records do not change
+	// between runs; zero uses the system clock
+	Now time.Time
+
+	// ProfileSpell, when set, profiles the run: the summary breaks its time
+	// down by script and bridge method, and the call stacks are written to
+	// this file for flame graph tools
+	ProfileSpell string
+
+	// Warm is a Lua engine created before the spell was known, as a daemon
+	// worker does; a Lua spell runs in it and other spells close it
+	Warm *lua.LuaEngine
+
+	// NoMetrics leaves the run's tool executions unrecorded, as in child
+	// processes whose parent records them from the summary
+	NoMetrics bool
+}
+
+// replay loads the snapshot at path and applies its settings, so the run
+// repeats the recorded one. The recorded spell and arguments are used
+// unless spellPath names a spell; output flags still apply. Results are
+// not cached, as every LLM request is answered from the snapshot.
+func (o *runOptions) replay(path, spellPath string, args []string) (string, []string) {
+	snapshot, err := loadSnapshot(path)
+	if err != nil {
+		fatalf("cli.error.read_snapshot", err)
+	}
+
+	o.Replay, o.ReplayPath = snapshot, path
+	o.Profile = loadProfile(snapshot.Config.Profile)
+	o.Timeout = snapshot.Config.Timeout
+	o.CallTimeout = snapshot.Config.CallTimeout
+	o.MaxLLMCalls = snapshot.Config.MaxLLMCalls
+	o.NoCache = true
+	o.Now = snapshot.Config.Now
+	if o.Now.IsZero() {
+		// Snapshots from before the clock was recorded
+		o.Now = snapshot.Created
+	}
+
+	if spellPath == "" {
+		spellPath, args = snapshot.Spell.Path, snapshot.Args
+	}
+	return spellPath, args
 }
 
-func runSpell(spellPath string, args []string) {
+func runSpell(spellPath string, args []string, opts runOptions) {
+	start := time.Now()
+	runID := bridge.NewCorrelationID()
+	memory := startMemorySampler(50 * time.Millisecond)
+
 	// Determine if it's a directory or file
 	info, err := os.Stat(spellPath)
 	if err != nil {
-		log.Fatalf("Cannot access spell: %v", err)
+		fatalf("cli.error.access_spell", err)
 	}
 
 	var mainScript string
 	var spellName string
 
 	if info.IsDir() {
-		// Look for main.lua in the directory
-		mainScript = filepath.Join(spellPath, "main.lua")
+		mainScript = findMainScript(spellPath)
 		spellName = filepath.Base(spellPath)
 	} else {
 		// Single file spell
@@ -98,103 +723,1075 @@ func runSpell(spellPath string, args []string) {
 
 	// Check if the script exists
 	if _, err := os.Stat(mainScript); err != nil {
-		log.Fatalf("Cannot find spell script: %v", err)
+		fatalf("cli.error.find_script", err)
 	}
 
 	fmt.Printf("🧙 Running spell: %s\n\n", spellName)
 
-	// Create Lua engine
-	config := &engine.Config{
-		MaxExecutionTime: 30,
-		MaxMemory:        64 * 1024 * 1024,
+	// Warnings from the spell, its sub-spells, and the bridges are listed
+	// when it ends
+	warnings := bridge.NewWarnings()
+
+	// A stopped clock makes time-dependent spells repeatable
+	runClock := clock.Real
+	if !opts.Now.IsZero() {
+		runClock = clock.NewManual(opts.Now)
 	}
+	warnings.SetClock(runClock)
 
-	eng, err := lua.NewLuaEngine(config)
-	if err != nil {
-		log.Fatalf("Failed to create Lua engine: %v", err)
+	// A snapshot records the seed for math.random and the start of the
+	// clock, and a replay reuses them
+	var seed int64
+	var responses *bridge.ResponseLog
+	var snapshot *runSnapshot
+	switch {
+	case opts.Replay != nil:
+		fmt.Println(i18n.T("run.replaying", opts.Replay.RunID, opts.Replay.Created.Format(time.RFC3339)))
+		for _, file := range opts.Replay.changedFiles(spellPath, mainScript) {
+			warnings.Add(bridge.WarnSnapshot, i18n.T("run.snapshot_changed", file), map[string]interface{}{"file": file})
+		}
+		seed = opts.Replay.Seed
+		responses = bridge.ReplayResponses(opts.Replay.LLM)
+	case opts.Snapshot != "":
+		seed = time.Now().UnixNano()
+		responses = bridge.NewResponseLog()
+		snapshot, err = newRunSnapshot(runID, spellName, spellPath, mainScript, args, opts, seed, runClock.Now())
+		if err != nil {
+			fatalf("cli.error.write_snapshot", err)
+		}
 	}
-	defer eng.Close()
 
-	// Initialize bridges
-	initializeBridges(eng, spellName)
+	// Log LLM calls under this run's ID
+	callLog, closeCallLog := openCallLog(opts.LLMLog, runID)
+	defer closeCallLog()
+
+	// The run stops on Ctrl-C, at its timeout, or when its budget runs out. The
+	// engine closes first, so its cleanup can still see why it stopped.
+	ctx, cancel, stopRun := runContext(opts.Timeout)
+	defer stopRun()
+
+	config := spellConfig()
+
+	// Initialize bridges; sub-spells run in fresh engines set up the same way
+	session := &spellSession{
+		args:     args,
+		profile:  opts.Profile,
+		limiter:  security.NewRateLimiter(opts.Profile.RateLimits),
+		guard:    security.NewToolGuard(opts.Profile.ToolLimits, opts.Profile.CircuitBreakers),
+		confirm:  security.NewToolConfirmer(opts.Profile.Confirmation, terminalPrompt()),
+		calls:    bridge.NewCallStats(),
+		callLog:  callLog,
+		cache:    newResultCache(opts),
+		scripts:  newScriptCache(opts),
+		tools:    newToolCache(opts),
+		plugins:  loadPlugins(warnings),
+		llmCache: newLLMCache(opts),
+		watch:    bridge.NewWatchdog(opts.CallTimeout, nil),
+		seed:     seed,
+		clock:    runClock,
+		replies:  responses,
+		warnings: warnings,
+		warm:     opts.Warm,
+		states:   newStateStore(),
+	}
+	defer session.plugins.Close()
+	if opts.ProfileSpell != "" {
+		session.profiler = bridge.NewProfiler()
+	}
+	if opts.Replay != nil {
+		session.replayProviders = opts.Replay.replayProviders()
+	}
+	if opts.MaxLLMCalls > 0 {
+		session.budget = bridge.NewCallBudget(opts.MaxLLMCalls, isLLMRequest, cancel)
+		session.budget.SetWarnings(warnings)
+	}
+	state := bridge.NewSharedState()
+	if quota := opts.Profile.State; quota != nil {
+		state.SetQuota(*quota)
+	}
+	if opts.StateEvents != nil {
+		state.Watch(opts.StateEvents)
+	}
+	spell := bridge.NewSpellBridge(bridge.SpellOptions{
+		Dir:      filepath.Dir(mainScript),
+		Config:   *config,
+		Trace:    rootTrace(),
+		Cache:    session.cache,
+		Prepare:  session.prepareEngine,
+		State:    state,
+		Channels: bridge.NewStateChannels(opts.Profile.Channels, opts.Profile.State),
+	})
+	eng, spellBridges := session.newEngine(config, mainScript, spellName, spell)
+	defer eng.Close()
+	if eng.Name() == "tengo" && (!opts.Now.IsZero() || opts.Snapshot != "" || opts.Replay != nil) {
+		warnings.Add(bridge.WarnConfig, i18n.T("run.tengo_clock"), nil)
+	}
 
 	// Set up parameters
 	setupParams(eng, args)
 
+	ctx = bridge.ContextWithTrace(ctx, spell.Trace())
+
+	// Global pre-hooks may stop the run before the spell is loaded
+	hookInfo := hookRun{Spell: spellName, RunID: runID, Params: parseParams(args)}
+	hookState, closeHookState := hookStateOf(eng)
+	defer closeHookState()
+	if err := opts.Hooks.runPre(ctx, hookState, hookInfo); err != nil {
+		_ = eng.Close()
+		exitCancelled(err)
+		fatalf("cli.error.pre_hook", err)
+	}
+
 	// Load and execute the spell
 	err = eng.LoadScriptFile(mainScript)
 	if err != nil {
-		log.Fatalf("Failed to load spell: %v", err)
+		fatalf("cli.error.load_spell", err)
 	}
 
 	fmt.Println("=== Spell Output ===")
-	err = eng.Execute(context.Background())
+	err = eng.Execute(ctx)
+	hookInfo.Err, hookInfo.Duration = err, time.Since(start)
+	hookWarnings := warnings
+	if err != nil {
+		// A failed run ends before warnings are listed, so post-hook
+		// failures are logged instead
+		hookWarnings = nil
+	}
+	opts.Hooks.runPost(hookState, hookInfo, hookWarnings)
+	if session.profiler != nil {
+		session.profiler.Stop()
+		if writeErr := writeProfile(opts.ProfileSpell, session.profiler); writeErr != nil {
+			log.Print(i18n.T("cli.error.write_profile", writeErr))
+		}
+	}
+	if snapshot != nil {
+		snapshot.finish(spellBridges, responses, err)
+		if writeErr := snapshot.write(opts.Snapshot); writeErr != nil {
+			log.Print(i18n.T("cli.error.write_snapshot", writeErr))
+		} else {
+			fmt.Println(i18n.T("run.snapshot_written", opts.Snapshot))
+		}
+	}
 	if err != nil {
-		log.Fatalf("Failed to execute spell: %v", err)
+		// Exiting skips deferred calls, so release temp files first
+		_ = eng.Close()
+		exitCancelled(err)
+		fatalf("cli.error.execute_spell", err)
 	}
 	fmt.Println("\n=== Spell Complete ===")
+
+	summary := newRunSummary(runID, time.Since(start), memory.Stop(), session.calls, spellBridges)
+	summary.Spell = spellName
+	summary.Cache = session.cache.Stats()
+	summary.TraceID = spell.Trace().TraceID
+	summary.StuckCalls = session.watch.Stuck()
+	summary.Warnings = warnings.List()
+	if session.profiler != nil {
+		report := session.profiler.Report()
+		summary.Profile = &report
+	}
+	fmt.Println()
+	out := opts.Summary
+	if out == nil {
+		out = os.Stdout
+	}
+	if err := summary.write(out, opts.Output); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if !opts.NoMetrics {
+		recordToolMetrics(summary)
+	}
+}
+
+// findMainScript returns the main script of a spell directory: main.lua,
+// or else a main script in another language. When there is none, it
+// returns the path main.lua would have.
+func findMainScript(dir string) string {
+	mainScript := filepath.Join(dir, "main.lua")
+	if _, err := os.Stat(mainScript); os.IsNotExist(err) {
+		matches, _ := filepath.Glob(filepath.Join(dir, "main.*"))
+		sort.Strings(matches)
+		for _, match := range matches {
+			if _, err := engine.DiscoverEngineByExtension(filepath.Ext(match)); err == nil {
+				return match
+			}
+		}
+	}
+	return mainScript
+}
+
+func runToolsCommand(args []string) {
+	if len(args) < 1 || (args[0] != "docs" && args[0] != "openapi") {
+		fmt.Println(i18n.T("cli.usage.tools_short"))
+		os.Exit(1)
+	}
+
+	toolBridge, err := bridge.NewToolBridgeWithBuiltins(tools.NewRegistry(), tools.DefaultBuiltinToolConfig())
+	if err != nil {
+		fatalf("cli.error.load_tools", err)
+	}
+
+	if args[0] == "openapi" {
+		writeOpenAPI(toolBridge, args[1:])
+		return
+	}
+
+	if len(args) > 1 {
+		doc, err := toolBridge.ToolDoc(args[1])
+		if err != nil {
+			fatalf("cli.error.document_tool", err)
+		}
+		fmt.Print(doc["markdown"])
+		return
+	}
+
+	// Print each tool's docs as soon as it is ready
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = toolBridge.StreamToolDocs(ctx, func(doc map[string]interface{}) error {
+		fmt.Println(doc["markdown"])
+		return nil
+	})
+	if err != nil {
+		fatalf("cli.error.document_tools", err)
+	}
+}
+
+// runSecurityCommand handles the security subcommands
+func runSecurityCommand(args []string, profile security.Profile) {
+	if len(args) < 1 || args[0] != "show" {
+		fmt.Println(i18n.T("cli.usage.security_short"))
+		os.Exit(1)
+	}
+
+	fmt.Println(i18n.T("security.profile", profile.Name))
+	fmt.Println(i18n.T("security.description", profile.Description))
+	fmt.Println(i18n.T("security.available", strings.Join(security.ProfileNames(), ", ")))
+	fmt.Println()
+
+	fmt.Println(i18n.T("security.methods"))
+	if len(profile.Methods.Allow) == 0 {
+		fmt.Println(i18n.T("security.allow_all"))
+	} else {
+		fmt.Println(i18n.T("security.allow", strings.Join(profile.Methods.Allow, ", ")))
+	}
+	if len(profile.Methods.Deny) > 0 {
+		fmt.Println(i18n.T("security.deny", strings.Join(profile.Methods.Deny, ", ")))
+	}
+	fmt.Println()
+	fmt.Println(i18n.T("security.rate_limits"))
+	if len(profile.RateLimits) == 0 && len(profile.ToolLimits) == 0 {
+		fmt.Println(i18n.T("security.no_rate_limits"))
+	}
+	for _, limit := range profile.RateLimits {
+		fmt.Println(i18n.T("security.rate_limit", limit.Method, limit.Calls, limit.Per))
+	}
+	for _, limit := range profile.ToolLimits {
+		fmt.Println(i18n.T("security.tool_limit", limit.Tool, limit.Calls, limit.Per))
+	}
+	if len(profile.CircuitBreakers) == 0 {
+		fmt.Println(i18n.T("security.no_circuit_breakers"))
+	}
+	for _, breaker := range profile.CircuitBreakers {
+		fmt.Println(i18n.T("security.circuit_breaker", breaker.Tool, breaker.Failures, breaker.Window, breaker.Cooldown))
+	}
+	fmt.Println()
+	if quota := profile.State; quota != nil {
+		eviction := quota.Eviction
+		if eviction == "" {
+			eviction = security.EvictReject
+		}
+		fmt.Println(i18n.T("security.state_quota", quota.MaxKeys, quota.MaxBytes>>20, quota.TTL, eviction))
+	} else {
+		fmt.Println(i18n.T("security.no_state_quota"))
+	}
+	if channels := profile.Channels; channels.IsZero() {
+		fmt.Println(i18n.T("security.state_channels_all"))
+	} else {
+		allow, deny := "*", "-"
+		if len(channels.Allow) > 0 {
+			allow = strings.Join(channels.Allow, ", ")
+		}
+		if len(channels.Deny) > 0 {
+			deny = strings.Join(channels.Deny, ", ")
+		}
+		fmt.Println(i18n.T("security.state_channels", allow, deny))
+	}
+	if policy := profile.HTTP; policy.IsZero() {
+		fmt.Println(i18n.T("security.http_all"))
+	} else {
+		allow, deny := "*", "-"
+		if len(policy.Allow) > 0 {
+			allow = strings.Join(policy.Allow, ", ")
+		}
+		if len(policy.Deny) > 0 {
+			deny = strings.Join(policy.Deny, ", ")
+		}
+		fmt.Println(i18n.T("security.http", allow, deny))
+	}
+	if len(profile.FS.Roots) == 0 {
+		fmt.Println(i18n.T("security.fs_default"))
+	} else {
+		roots := make([]string, len(profile.FS.Roots))
+		for i, root := range profile.FS.Roots {
+			roots[i] = root.Name + "=" + root.Path
+			if root.ReadOnly {
+				roots[i] += " " + i18n.T("security.fs_read_only")
+			}
+		}
+		fmt.Println(i18n.T("security.fs_roots", strings.Join(roots, ", ")))
+	}
+	if policy := profile.FS; len(policy.Deny) > 0 || policy.ReadOnly || policy.WriteQuota > 0 {
+		deny := "-"
+		if len(policy.Deny) > 0 {
+			deny = strings.Join(policy.Deny, ", ")
+		}
+		fmt.Println(i18n.T("security.fs_rules", deny, policy.ReadOnly, policy.WriteQuota))
+	}
+	if len(profile.Permissions) == 0 {
+		fmt.Println(i18n.T("security.permissions_none"))
+	} else {
+		permissions := make([]string, len(profile.Permissions))
+		for i, permission := range profile.Permissions {
+			permissions[i] = string(permission)
+		}
+		fmt.Println(i18n.T("security.permissions", strings.Join(permissions, ", ")))
+	}
+	if names := profile.Exec.Names(); len(names) == 0 {
+		fmt.Println(i18n.T("security.exec_none"))
+	} else {
+		fmt.Println(i18n.T("security.exec", strings.Join(names, ", ")))
+	}
+	if iso := profile.Isolation; iso != nil {
+		fmt.Println(i18n.T("security.isolation", iso.CPUTime, iso.Memory>>20, iso.OpenFiles, iso.Seccomp, iso.DropPrivileges))
+	} else {
+		fmt.Println(i18n.T("security.no_isolation"))
+	}
+	confirmation := profile.Confirmation
+	switch confirmation.Mode {
+	case security.ConfirmAllow:
+		fmt.Println(i18n.T("security.confirmation_allow"))
+	case security.ConfirmDeny:
+		fmt.Println(i18n.T("security.confirmation_deny"))
+	default:
+		fmt.Println(i18n.T("security.confirmation_prompt"))
+	}
+	if len(confirmation.Allow) > 0 || len(confirmation.Require) > 0 {
+		allow, require := "-", "-"
+		if len(confirmation.Allow) > 0 {
+			allow = strings.Join(confirmation.Allow, ", ")
+		}
+		if len(confirmation.Require) > 0 {
+			require = strings.Join(confirmation.Require, ", ")
+		}
+		fmt.Println(i18n.T("security.confirmation_tools", allow, require))
+	}
+}
+
+// writeOpenAPI streams the tool catalog's OpenAPI document to a file, or to
+// stdout when no path is given
+func writeOpenAPI(toolBridge *bridge.ToolBridge, args []string) {
+	out := os.Stdout
+	if len(args) > 0 {
+		f, err := os.Create(args[0])
+		if err != nil {
+			fatalf("cli.error.write_openapi", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if err := toolBridge.WriteOpenAPI(out, tools.DefaultOpenAPIInfo()); err != nil {
+		fatalf("cli.error.write_openapi", err)
+	}
 }
 
-func initializeBridges(eng *lua.LuaEngine, spellName string) {
+// spellSession is what a spell shares with the sub-spells it runs: its
+// arguments, security profile, rate limits, tool guard and confirmer, call counts, LLM call log,
+// result cache, the backends of the cache module and of tool results, watchdog for hung calls, LLM call budget, warnings, clock,
+// profiler, and, for runs that are recorded or replayed, the math.random
+// seed and LLM responses
+type spellSession struct {
+	args     []string
+	profile  security.Profile
+	limiter  *security.RateLimiter
+	guard    *security.ToolGuard
+	confirm  *security.ToolConfirmer
+	calls    *bridge.CallStats
+	callLog  *bridge.CallLogger
+	cache    *bridge.ResultCache
+	scripts  bridge.CacheBackend
+	tools    bridge.CacheBackend
+	plugins  *bridge.Plugins
+	llmCache bridge.ResponseStore
+	watch    *bridge.Watchdog
+	budget   *bridge.CallBudget
+	seed     int64
+	clock    clock.Clock
+	replies  *bridge.ResponseLog
+	warnings *bridge.Warnings
+	profiler *bridge.Profiler
+
+	// replayProviders are the providers a replayed run could use
+	replayProviders []string
+
+	// warm is the engine created ahead of the spell, if any
+	warm *lua.LuaEngine
+
+	// states saves spell state across runs; nil when there is no home
+	// directory to save it in
+	states *bridge.SavedStates
+}
+
+// spellConfig returns the engine settings for a top-level spell
+func spellConfig() *engine.Config {
+	return &engine.Config{
+		MaxExecutionTime: 30,
+		MaxMemory:        64 * 1024 * 1024,
+	}
+}
+
+// prepare registers the bridges, including the spell and state modules,
+// in eng and restricts each bridge module according to the security
+// profile as it loads
+func (s *spellSession) prepare(eng *lua.LuaEngine, spellName string, spell *bridge.SpellBridge) *spellBridges {
+	sb := initializeBridges(eng, spellName, s.args, s.callLog, spell.Trace().TraceID, assertMode(s.profile))
+	sb.watchdog = s.watch
+	sb.guard = s.guard
+	sb.confirm = s.confirm
+	sb.toolResults = s.tools
+	sb.plugins = s.plugins
+	sb.responses = s.replies
+	sb.replayProviders = s.replayProviders
+	sb.warnings = s.warnings
+
+	luaState := eng.GetLuaState()
+	stdlib.RegisterWarn(luaState, s.warnings.Sink(bridge.WarnSpell))
+	if policy := s.profile.HTTP; !policy.IsZero() {
+		// The http module only reaches the destinations the profile allows,
+		// as do MCP servers and imported OpenAPI operations
+		sb.checkURL = policy.Check
+		config := stdlib.DefaultHTTPConfig()
+		config.CheckURL = policy.Check
+		stdlib.RegisterHTTP(luaState, stdlib.NewHTTPClient(config))
+
+		// As do notifications to webhooks
+		notify := *sb.notify
+		notify.CheckURL = policy.Check
+		notifier, err := stdlib.NewNotifier(&notify)
+		if err != nil {
+			// A channel the profile refuses leaves the spell without channels
+			s.warnings.Add(bridge.WarnConfig, err.Error(), nil)
+			notifier, _ = stdlib.NewNotifier(nil)
+		}
+		stdlib.RegisterNotify(luaState, notifier)
+	}
+	// The fs module, the modules writing through it, the rag and db
+	// modules, and OpenAPI imports keep to the files the profile allows
+	files := stdlib.NewFS(fsConfig(s.profile.FS))
+	stdlib.RegisterFiles(luaState, files, sb.stdlibConfig)
+	sb.checkPath = files.CheckPath
+	if s.seed != 0 {
+		stdlib.SeedRandom(luaState, s.seed)
+	}
+	if s.clock != nil {
+		stdlib.SetClock(luaState, s.clock)
+	}
+	// The standard library is in place from the start rather than loaded
+	// through sb.modules, so the profile restricts it now
+	for _, module := range stdlib.Modules() {
+		bridges.ApplyMethodPolicy(luaState, module, &s.profile.Methods)
+		bridges.ApplyRateLimits(luaState, module, s.limiter)
+		bridges.ApplyCallBudget(luaState, module, s.budget)
+	}
+	sb.modules.Register("spell", func() error {
+		return bridges.RegisterSpellModule(luaState, spell)
+	})
+	sb.modules.Register("state", func() error {
+		return bridges.RegisterStateModule(luaState, spell.State(), s.states, bridge.NewStateTransforms(s.cache), spell.Channels())
+	})
+	sb.modules.Register("cache", func() error {
+		return bridges.RegisterCacheModule(luaState, bridge.NewScriptCache(bridge.ScriptCacheOptions{
+			Backend:   s.scripts,
+			Namespace: spellName,
+			Stats:     s.cache,
+		}))
+	})
+	// The vectorstore and rag modules share a store, opened on first use
+	var vectors *bridge.VectorStoreBridge
+	openVectors := func() (*bridge.VectorStoreBridge, error) {
+		if vectors != nil {
+			return vectors, nil
+		}
+		store, err := newVectorStore()
+		if err != nil {
+			return nil, fmt.Errorf("vector store: %w", err)
+		}
+		embed := func(ctx context.Context, texts []string) ([][]float64, error) {
+			// Text the store embeds counts like a call to embeddings.embed_batch
+			if s.budget != nil {
+				if err := s.budget.Spend("embeddings.embed_batch"); err != nil {
+					return nil, err
+				}
+			}
+			embeddingsBridge, _ := sb.embeddings.Get(ctx)
+			return embeddingsBridge.(*bridge.EmbeddingsBridge).EmbedBatch(ctx, texts)
+		}
+		vectors = bridge.NewVectorStoreBridge(store, embed)
+		return vectors, nil
+	}
+	sb.modules.Register("vectorstore", func() error {
+		vb, err := openVectors()
+		if err != nil {
+			return err
+		}
+		return bridges.RegisterVectorStoreModule(luaState, vb)
+	})
+	sb.modules.Register("rag", func() error {
+		vb, err := openVectors()
+		if err != nil {
+			return err
+		}
+		// index_dir reads the directories the fs module may
+		return bridges.RegisterRAGModule(luaState, vb, files.CheckPath)
+	})
+	sb.modules.Register("db", func() error {
+		// SQLite files go where the fs module may write
+		return bridges.RegisterDatabaseModule(luaState, bridge.NewDatabaseBridge(bridge.DatabaseOptions{
+			Denied:    s.profile.Require(security.PermissionDatabase),
+			CheckPath: files.CheckWrite,
+		}))
+	})
+	sb.modules.Register("exec", func() error {
+		// Only the commands the profile lists, and only when it grants exec
+		return bridges.RegisterExecModule(luaState, bridge.NewExecBridge(bridge.ExecOptions{
+			Denied: s.profile.Require(security.PermissionExec),
+			Policy: s.profile.Exec,
+		}))
+	})
+	sb.modules.Register("secrets", func() error {
+		// The operator's secrets, which the http and llm modules send
+		// without the spell seeing them
+		return bridges.RegisterSecretsModule(luaState, bridge.NewSecretsBridge(sb.secrets()))
+	})
+	sb.modules.OnLoad(func(module string) {
+		// LLM responses are only reused when the operator asked for results
+		// to persist, as repeated prompts may expect fresh answers
+		if module == "llm" {
+			if llmBridge, ok := sb.llmBridge(); ok {
+				if s.cache.Persistent() {
+					llmBridge.SetResponseCache(s.cache)
+				}
+				// Spells opt in to this one through llm.cache
+				if s.llmCache != nil {
+					llmBridge.SetScriptResponseCache(bridge.NewResponseCache(s.llmCache, s.cache))
+				}
+			}
+		}
+		bridges.ApplyDeprecations(luaState, module, s.warnings)
+		bridges.ApplyMethodPolicy(luaState, module, &s.profile.Methods)
+		bridges.ApplyRateLimits(luaState, module, s.limiter)
+		bridges.ApplyCallBudget(luaState, module, s.budget)
+		bridges.ApplyCallStats(luaState, module, s.calls)
+		bridges.ApplyProfile(luaState, module, s.profiler)
+		bridges.ApplyResults(luaState, module)
+	})
+	return sb
+}
+
+// prepareEngine sets up the fresh engine of a sub-spell. Engines other
+// than Lua, Tengo, and JavaScript get no bridges.
+func (s *spellSession) prepareEngine(eng engine.Engine, spellName string, spell *bridge.SpellBridge) error {
+	switch e := eng.(type) {
+	case *lua.LuaEngine:
+		s.prepare(e, spellName, spell)
+	case *tengoengine.TengoEngine:
+		s.prepareTengo(e, spellName, spell)
+	case *jsengine.GojaEngine:
+		s.prepareJavaScript(e, spellName, spell)
+	}
+	return nil
+}
+
+// fsConfig turns a profile's fs policy into the fs module's configuration.
+// Without roots, spells reach the working directory, as by default.
+func fsConfig(policy security.FSPolicy) *stdlib.FSConfig {
+	config := stdlib.DefaultFSConfig()
+	if len(policy.Roots) > 0 {
+		config.AllowedPaths = nil
+	}
+	for _, root := range policy.Roots {
+		config.Roots = append(config.Roots, stdlib.FSRoot{Name: root.Name, Path: root.Path, ReadOnly: root.ReadOnly})
+	}
+	config.DeniedPaths = policy.Deny
+	config.ReadOnly = policy.ReadOnly
+	config.WriteQuota = policy.WriteQuota
+	return config
+}
+
+// spellEngine is the engine a top-level spell runs in
+type spellEngine interface {
+	engine.Engine
+	Close() error
+}
+
+// newEngine creates the engine for mainScript, the one its
+// #!llmspell:<language> line or extension picks, and registers the bridges
+// in it. Lua runs scripts that pick no engine, in the session's warm
+// engine when it has one.
+func (s *spellSession) newEngine(config *engine.Config, mainScript, spellName string, spell *bridge.SpellBridge) (spellEngine, *spellBridges) {
+	warm := s.warm
+	s.warm = nil
+
+	name, err := engine.DetectEngine(mainScript)
+	switch {
+	case errors.Is(err, engine.ErrUnknownLanguage):
+		fatalf("cli.error.create_engine", err)
+	case err != nil:
+		name = "lua"
+	}
+	if name != "lua" && warm != nil {
+		_ = warm.Close()
+	}
+
+	switch name {
+	case "lua":
+		if warm != nil {
+			return warm, s.prepare(warm, spellName, spell)
+		}
+	case "tengo":
+		eng, err := tengoengine.NewTengoEngine(config)
+		if err != nil {
+			fatalf("cli.error.create_engine", err)
+		}
+		return eng, s.prepareTengo(eng, spellName, spell)
+	case "javascript":
+		eng, err := jsengine.NewGojaEngine(config)
+		if err != nil {
+			fatalf("cli.error.create_engine", err)
+		}
+		return eng, s.prepareJavaScript(eng, spellName, spell)
+	default:
+		fatalf("cli.error.create_engine", fmt.Errorf("the %s engine has no bridges to run spells with", name))
+	}
+
+	eng, err := lua.NewLuaEngine(config)
+	if err != nil {
+		fatalf("cli.error.create_engine", err)
+	}
+	return eng, s.prepare(eng, spellName, spell)
+}
+
+// spellBridges are the bridges a spell can use. Each is created, and its Lua
+// module loaded, only when the spell first touches it.
+type spellBridges struct {
+	tools      *bridge.LazyBridge
+	agents     *bridge.LazyBridge
+	llm        *bridge.LazyBridge
+	embeddings *bridge.LazyBridge
+	modules    *bridges.LazyModules
+
+	// watchdog abandons hung LLM and Go tool calls; nil waits for them
+	watchdog *bridge.Watchdog
+
+	// guard applies per-tool rate limits and circuit breakers; nil allows
+	// every tool call
+	guard *security.ToolGuard
+
+	// confirm asks before tools that require confirmation run; nil runs
+	// them without asking
+	confirm *security.ToolConfirmer
+
+	// toolResults caches the results of deterministic tools; nil caches
+	// none
+	toolResults bridge.CacheBackend
+
+	// plugins provide operator-installed tools; nil provides none
+	plugins *bridge.Plugins
+
+	// notify configures the notify module's channels
+	notify *stdlib.NotifyConfig
+
+	// stdlibConfig is the standard library's configuration, kept for
+	// modules registered again under the security profile
+	stdlibConfig *stdlib.Config
+
+	// checkURL vets the servers the mcp module connects to and the OpenAPI
+	// documents and operations tools.import_openapi reaches; nil allows
+	// any
+	checkURL func(*url.URL) error
+
+	// checkPath resolves the OpenAPI documents tools.import_openapi reads
+	// from files, as the fs module would; nil leaves it to the tools module
+	checkPath func(string) (string, error)
+
+	// responses records LLM responses for a snapshot, or answers from one
+	// for a replay, with replayProviders standing in for the recorded
+	// providers; nil records nothing
+	responses       *bridge.ResponseLog
+	replayProviders []string
+
+	// warnings collects soft failures; nil logs them
+	warnings *bridge.Warnings
+}
+
+// toolBridge returns the tool bridge, or nil if the spell never used it
+func (sb *spellBridges) toolBridge() *bridge.ToolBridge {
+	if done, _ := sb.tools.Initialized(); !done {
+		return nil
+	}
+	toolBridge, _ := sb.tools.Get(context.Background())
+	tb, _ := toolBridge.(*bridge.ToolBridge)
+	return tb
+}
+
+// llmBridge returns the LLM bridge if the spell started it successfully
+func (sb *spellBridges) llmBridge() (*bridge.LLMBridge, bool) {
+	if done, _ := sb.llm.Initialized(); !done {
+		return nil, false
+	}
+	llmBridge, err := sb.llm.Get(context.Background())
+	if err != nil {
+		return nil, false
+	}
+	b, ok := llmBridge.(*bridge.LLMBridge)
+	return b, ok
+}
+
+// loads reports the bridges the spell used and how long each took to start
+func (sb *spellBridges) loads() []bridgeLoad {
+	var loads []bridgeLoad
+	for _, lazy := range []*bridge.LazyBridge{sb.tools, sb.agents, sb.llm, sb.embeddings} {
+		if done, d := lazy.Initialized(); done {
+			loads = append(loads, bridgeLoad{Name: lazy.Name(), Duration: d})
+		}
+	}
+	return loads
+}
+
+// assertMode is what a failed log.assert does under profile, which
+// LoadProfile has checked names a mode
+func assertMode(profile security.Profile) stdlib.AssertMode {
+	mode, _ := stdlib.ParseAssertMode(profile.Asserts)
+	return mode
+}
+
+// initializeBridges registers the standard library and the tools, mcp,
+// agents, llm, and embeddings modules. The modules are placeholders until the
+// spell uses them, so a spell pays only for the bridges it needs. Spell arguments may pick
+// the LLM model (see configureModels); LLM calls are logged to callLog when
+// it is not nil. log.trace entries join traceID when it is set.
+// Notifications go to the channels of ~/.llmspell/notify.json, and a
+// failed log.assert does what asserts says.
+func initializeBridges(eng *lua.LuaEngine, spellName string, args []string, callLog *bridge.CallLogger, traceID string, asserts stdlib.AssertMode) *spellBridges {
+	sb := newSpellBridges(args, callLog)
+	sb.notify = sb.notifyConfig()
+
 	// Register standard library
 	stdlibConfig := &stdlib.Config{
-		SpellName: spellName,
-		LogLevel:  slog.LevelInfo,
-		Storage:   stdlib.DefaultStorageConfig(),
-		HTTP:      stdlib.DefaultHTTPConfig(),
+		SpellName:  spellName,
+		TraceID:    traceID,
+		LogLevel:   slog.LevelInfo,
+		Storage:    stdlib.DefaultStorageConfig(),
+		HTTP:       stdlib.DefaultHTTPConfig(),
+		Notify:     sb.notify,
+		Report:     &stdlib.ReportConfig{PDFRenderer: stdlib.CommandPDFRenderer()},
+		AssertMode: asserts,
 	}
 
 	luaState := eng.GetLuaState()
 	if err := stdlib.RegisterAll(luaState, stdlibConfig); err != nil {
-		log.Fatalf("Failed to register stdlib: %v", err)
+		fatalf("cli.error.register_stdlib", err)
+	}
+	sb.stdlibConfig = stdlibConfig
+
+	sb.modules = bridges.NewLazyModules(luaState)
+
+	sb.modules.Register("tools", func() error {
+		toolBridge, _ := sb.tools.Get(context.Background())
+		return bridges.RegisterToolsModule(luaState, toolBridge.(*bridge.ToolBridge))
+	})
+
+	// MCP servers' tools join the tool bridge, so the tools module lists
+	// and runs them
+	sb.modules.Register("mcp", func() error {
+		toolBridge, _ := sb.tools.Get(context.Background())
+		config := sb.mcpConfig()
+		config.CheckURL = sb.checkURL
+		return bridges.RegisterMCPModule(luaState, bridge.NewMCPBridge(toolBridge.(*bridge.ToolBridge), config))
+	})
+
+	sb.modules.Register("agents", func() error {
+		agentBridge, err := sb.agents.Get(context.Background())
+		if err != nil {
+			return err
+		}
+		return bridges.RegisterAgentsModule(luaState, agentBridge.(bridge.AgentBridge))
+	})
+
+	// Modules load while the spell runs and the engine is locked, so
+	// loaders use the Lua state directly
+	mockLLM := func() error {
+		if err := luaState.DoString(mockLLMScript); err != nil {
+			return fmt.Errorf("failed to register mock LLM: %w", err)
+		}
+		return nil
 	}
 
-	// Register tools bridge with built-in tools
-	toolRegistry := tools.NewRegistry()
-	toolBridge, err := bridge.NewToolBridgeWithBuiltins(toolRegistry, tools.DefaultBuiltinToolConfig())
+	sb.modules.Register("llm", func() error {
+		llmBridge, ok := sb.startLLM()
+		if !ok {
+			return mockLLM()
+		}
+		adapter := bridges.NewLLMBridgeAdapter(llmBridge)
+		return bridges.NewLLMBridge(adapter).Register(luaState)
+	})
+
+	sb.modules.Register("embeddings", func() error {
+		embeddingsBridge, _ := sb.embeddings.Get(context.Background())
+		return bridges.RegisterEmbeddingsModule(luaState, embeddingsBridge.(*bridge.EmbeddingsBridge))
+	})
+
+	return sb
+}
+
+// mcpConfig reads the MCP servers spells may connect to by name from
+// ~/.llmspell/mcp.json. An invalid file is reported to sb.warnings.
+func (sb *spellBridges) mcpConfig() bridge.MCPConfig {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		log.Printf("Warning: Failed to create tool bridge with builtins: %v", err)
-		// Fallback to bridge without builtins
-		toolBridge = bridge.NewToolBridge(toolRegistry)
+		return bridge.MCPConfig{}
 	}
-	if err := bridges.RegisterToolsModule(luaState, toolBridge); err != nil {
-		log.Printf("Warning: Failed to register tools module: %v", err)
+	config, err := bridge.LoadMCPConfig(filepath.Join(home, ".llmspell", "mcp.json"))
+	if err != nil && !os.IsNotExist(err) {
+		sb.warnings.Add(bridge.WarnConfig, err.Error(), nil)
 	}
+	return config
+}
 
-	// Register agents bridge
-	agentBridge, err := bridge.NewAgentBridge(context.Background())
+// notifyConfig reads the channels the notify module sends to from
+// ~/.llmspell/notify.json. Settings given as "secret:NAME" are looked up
+// in the secrets file when the channel is first used, and are only sent
+// to the hosts the secret allows. An invalid file is reported to
+// sb.warnings, and leaves the spell without channels.
+func (sb *spellBridges) notifyConfig() *stdlib.NotifyConfig {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		log.Printf("Warning: Failed to create agent bridge: %v", err)
-	} else {
-		if err := bridges.RegisterAgentsModule(luaState, agentBridge); err != nil {
-			log.Printf("Warning: Failed to register agents module: %v", err)
+		return stdlib.DefaultNotifyConfig()
+	}
+	config, err := stdlib.LoadNotifyConfig(filepath.Join(home, ".llmspell", "notify.json"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			sb.warnings.Add(bridge.WarnConfig, err.Error(), nil)
+		}
+		return stdlib.DefaultNotifyConfig()
+	}
+
+	var once sync.Once
+	var secrets bridge.SecretsConfig
+	config.Secret = func(ctx context.Context, name string) (string, func(string) bool, error) {
+		once.Do(func() { secrets = sb.secrets() })
+		secret, value, err := secrets.Resolve(ctx, name)
+		if err != nil {
+			return "", nil, err
 		}
+		return value, secret.Allows, nil
+	}
+	if _, err := stdlib.NewNotifier(config); err != nil {
+		sb.warnings.Add(bridge.WarnConfig, err.Error(), nil)
+		return stdlib.DefaultNotifyConfig()
+	}
+	return config
+}
+
+// secrets reads the credentials the secrets module and imported OpenAPI
+// operations may use from ~/.llmspell/secrets.json. An invalid file is
+// reported to sb.warnings.
+func (sb *spellBridges) secrets() bridge.SecretsConfig {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return bridge.SecretsConfig{}
+	}
+	config, err := bridge.LoadSecrets(filepath.Join(home, ".llmspell", "secrets.json"))
+	if err != nil && !os.IsNotExist(err) {
+		sb.warnings.Add(bridge.WarnConfig, err.Error(), nil)
 	}
+	return config
+}
 
-	// Register LLM bridge
-	if os.Getenv("MOCK_LLM") == "true" {
+// startLLM starts the LLM bridge for the spell's llm module. It returns
+// false when the spell should use the mock LLM instead: when MOCK_LLM=true,
+// when replaying a run that had no provider, or when no provider is
+// configured.
+func (sb *spellBridges) startLLM() (*bridge.LLMBridge, bool) {
+	useMock := os.Getenv("MOCK_LLM") == "true"
+	if sb.responses.Replaying() {
+		// A replay uses the mock when the recorded run had no provider
+		useMock = len(sb.replayProviders) == 0
+	}
+	if useMock {
 		fmt.Println("🎭 Using mock LLM for demonstration")
-		registerMockLLM(eng)
-	} else {
-		llmBridge, err := bridge.NewLLMBridge()
+		return nil, false
+	}
+
+	llmBridge, err := sb.llm.Get(context.Background())
+	if err != nil {
+		fmt.Printf("⚠️  LLM Bridge not available: %v\n", err)
+		fmt.Println("   Set OPENAI_API_KEY, ANTHROPIC_API_KEY, or GEMINI_API_KEY to enable LLM features.")
+		fmt.Println("   Running with mock LLM functions...")
+		return nil, false
+	}
+
+	fmt.Printf("✅ LLM Bridge initialized with provider: %s\n\n", llmBridge.(*bridge.LLMBridge).GetCurrentProvider())
+	return llmBridge.(*bridge.LLMBridge), true
+}
+
+// newSpellBridges creates the tools, agents, llm, and embeddings bridges
+// of a spell, each started the first time the spell uses it. The bridges
+// are created after the caller sets sb.watchdog, sb.guard, sb.confirm,
+// sb.toolResults, sb.plugins, sb.responses, and sb.warnings.
+func newSpellBridges(args []string, callLog *bridge.CallLogger) *spellBridges {
+	var sb *spellBridges
+	sb = &spellBridges{
+		tools: bridge.NewLazyBridge("tools", func(ctx context.Context) (interface{}, error) {
+			// Tools bridge with built-in tools
+			toolRegistry := tools.NewRegistry()
+			toolBridge, err := bridge.NewToolBridgeWithBuiltins(toolRegistry, tools.DefaultBuiltinToolConfig())
+			if err != nil {
+				sb.warnings.Add(bridge.WarnTools, fmt.Sprintf("built-in tools unavailable: %v", err), nil)
+				// Fallback to bridge without builtins
+				toolBridge = bridge.NewToolBridge(toolRegistry)
+			}
+			toolBridge.SetWatchdog(sb.watchdog)
+			toolBridge.SetToolGuard(sb.guard)
+			toolBridge.SetConfirmer(sb.confirm)
+			toolBridge.SetResultCache(sb.toolResults, toolCacheTTL)
+			toolBridge.SetSecrets(sb.secrets())
+			toolBridge.SetCheckURL(sb.checkURL)
+			toolBridge.SetCheckPath(sb.checkPath)
+			if err := toolBridge.AddPlugins(ctx, sb.plugins); err != nil {
+				sb.warnings.Add(bridge.WarnTools, err.Error(), nil)
+			}
+			return toolBridge, nil
+		}),
+		// Agents call the spell's tools, including those it registers,
+		// through the tool bridge
+		agents: bridge.NewLazyBridge("agents", func(ctx context.Context) (interface{}, error) {
+			toolBridge, err := sb.tools.Get(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return bridge.NewAgentBridgeWithTools(ctx, toolBridge.(*bridge.ToolBridge).AgentTools())
+		}),
+		llm: bridge.NewLazyBridge("llm", func(ctx context.Context) (interface{}, error) {
+			var llmBridge *bridge.LLMBridge
+			if sb.responses.Replaying() {
+				llmBridge = bridge.NewReplayLLMBridge(sb.responses, sb.replayProviders...)
+			} else {
+				var err error
+				if llmBridge, err = bridge.NewLLMBridge(); err != nil {
+					return nil, err
+				}
+			}
+			configureModels(llmBridge, parseParams(args), sb.warnings)
+			llmBridge.SetCallLogger(callLog)
+			llmBridge.SetWatchdog(sb.watchdog)
+			llmBridge.SetResponseLog(sb.responses)
+			return llmBridge, nil
+		}),
+		embeddings: bridge.NewLazyBridge("embeddings", func(ctx context.Context) (interface{}, error) {
+			// Replays and the mock LLM stay offline: embedding fails, while
+			// the similarity and token functions still work
+			if sb.responses.Replaying() || os.Getenv("MOCK_LLM") == "true" {
+				return &bridge.EmbeddingsBridge{}, nil
+			}
+			embeddingsBridge := bridge.NewEmbeddingsBridge()
+			embeddingsBridge.SetWatchdog(sb.watchdog)
+			return embeddingsBridge, nil
+		}),
+	}
+	return sb
+}
+
+// configureModels applies model aliases from ~/.llmspell/models.json and
+// the routing policy from ~/.llmspell/routing.json, then the spell's own
+// choices: model.<alias>=provider/model overrides an alias, model=<name>
+// selects the model requests use, providers=<model>,<model> routes calls
+// over those models instead, and context_fallback.<model>=<larger> and
+// context_trim=<tokens> say how to retry prompts that overflow the context
+// window. Invalid settings, failovers, and retries after a prompt
+// overflowed are reported to warnings.
+func configureModels(llmBridge *bridge.LLMBridge, params map[string]string, warnings *bridge.Warnings) {
+	var routing bridge.RoutingPolicy
+	if home, err := os.UserHomeDir(); err == nil {
+		aliases, err := bridge.LoadModelAliases(filepath.Join(home, ".llmspell", "models.json"))
+		switch {
+		case err == nil:
+			llmBridge.SetModelAliases(aliases)
+		case !os.IsNotExist(err):
+			warnings.Add(bridge.WarnConfig, err.Error(), nil)
+		}
+
+		policy, err := bridge.LoadRoutingPolicy(filepath.Join(home, ".llmspell", "routing.json"))
+		switch {
+		case err == nil:
+			routing = policy
+		case !os.IsNotExist(err):
+			warnings.Add(bridge.WarnConfig, err.Error(), nil)
+		}
+	}
+
+	overrides := bridge.ModelAliases{}
+	for key, value := range params {
+		alias, ok := strings.CutPrefix(key, "model.")
+		if !ok {
+			continue
+		}
+		target, err := bridge.ParseModelTarget(value)
+		if err != nil {
+			warnings.Add(bridge.WarnConfig, err.Error(), map[string]interface{}{"param": key})
+			continue
+		}
+		overrides[alias] = []bridge.ModelTarget{target}
+	}
+	llmBridge.SetModelAliases(overrides)
+
+	if model := params["model"]; model != "" {
+		if err := llmBridge.SetModel(model); err != nil {
+			warnings.Add(bridge.WarnConfig, err.Error(), map[string]interface{}{"param": "model"})
+		}
+	}
+
+	if providers := params["providers"]; providers != "" {
+		routing.Models = strings.Split(providers, ",")
+	}
+	if err := llmBridge.SetRouting(routing); err != nil {
+		warnings.Add(bridge.WarnConfig, err.Error(), map[string]interface{}{"param": "providers"})
+	}
+	llmBridge.SetFailoverHandler(func(failover bridge.Failover) {
+		warnings.Add(bridge.WarnLLM, failover.String(), nil)
+	})
+
+	for key, value := range params {
+		if model, ok := strings.CutPrefix(key, "context_fallback."); ok {
+			llmBridge.SetContextFallback(model, value)
+		}
+	}
+	if trim := params["context_trim"]; trim != "" {
+		tokens, err := strconv.Atoi(trim)
 		if err != nil {
-			fmt.Printf("⚠️  LLM Bridge not available: %v\n", err)
-			fmt.Println("   Set OPENAI_API_KEY, ANTHROPIC_API_KEY, or GEMINI_API_KEY to enable LLM features.")
-			fmt.Println("   Running with mock LLM functions...")
-			registerMockLLM(eng)
+			warnings.Add(bridge.WarnConfig, fmt.Sprintf("invalid context_trim %q: %v", trim, err), map[string]interface{}{"param": "context_trim"})
 		} else {
-			fmt.Printf("✅ LLM Bridge initialized with provider: %s\n\n", llmBridge.GetCurrentProvider())
-			adapter := bridges.NewLLMBridgeAdapter(llmBridge)
-			luaBridge := bridges.NewLLMBridge(adapter)
-			if err := luaBridge.Register(luaState); err != nil {
-				log.Fatalf("Failed to register LLM bridge: %v", err)
-			}
+			llmBridge.SetContextTrim(tokens)
 		}
 	}
+	llmBridge.SetContextAdjustmentHandler(func(adjustment bridge.ContextAdjustment) {
+		warnings.Add(bridge.WarnLLM, "retried after a context-length error: "+adjustment.String(), nil)
+	})
 }
 
-func setupParams(eng *lua.LuaEngine, args []string) {
-	// Parse parameters
+// parseParams collects key=value spell arguments
+func parseParams(args []string) map[string]string {
 	params := make(map[string]string)
 	for _, arg := range args {
 		if strings.Contains(arg, "=") {
@@ -204,11 +1801,22 @@ func setupParams(eng *lua.LuaEngine, args []string) {
 			}
 		}
 	}
+	return params
+}
+
+func setupParams(eng engine.Engine, args []string) {
+	params := parseParams(args)
+	if _, ok := eng.(*lua.LuaEngine); !ok {
+		if err := eng.SetVariable("params", params); err != nil {
+			log.Printf("Warning: Failed to set up parameters: %v", err)
+		}
+		return
+	}
 
-	// Create params table
+	// Create params table; keys are quoted so names like model.fast work
 	paramsScript := "params = {"
 	for k, v := range params {
-		paramsScript += fmt.Sprintf("\n\t%s = %q,", k, v)
+		paramsScript += fmt.Sprintf("\n\t[%q] = %q,", k, v)
 	}
 	paramsScript += "\n}"
 
@@ -224,11 +1832,14 @@ func setupParams(eng *lua.LuaEngine, args []string) {
 	}
 }
 
-func registerMockLLM(eng *lua.LuaEngine) {
-	// Create mock LLM module
-	mockScript := `
+// mockLLMScript defines an llm module that answers without calling a provider
+const mockLLMScript = `
 llm = {
 	chat = function(prompt)
+		if type(prompt) == "table" then
+			local last = prompt[#prompt] or {}
+			prompt = type(last.content) == "string" and last.content or "(" .. #prompt .. " messages)"
+		end
 		return "[Mock LLM Response] I received your prompt: '" .. prompt .. "'. This is a mock response for demonstration."
 	end,
 	complete = function(prompt, maxTokens)
@@ -243,23 +1854,76 @@ llm = {
 	set_provider = function(name)
 		return "[Mock] Would switch to provider: " .. name
 	end,
+	set_api_key = function(name, key)
+	end,
 	stream_chat = function(prompt, callback)
 		-- Mock streaming by calling callback with chunks
 		callback("[Mock streaming: ")
 		callback(prompt)
 		callback(" - completed]")
 		return nil
+	end,
+	stream_complete = function(prompt, callback, options)
+		local text = ""
+		for i, chunk in ipairs({prompt, "... ", "[Mock streamed completion]"}) do
+			text = text .. chunk
+			if callback(chunk, i) == false then
+				break
+			end
+		end
+		return text
+	end,
+	batch = function(prompts, options)
+		local results = {}
+		for i, prompt in ipairs(prompts) do
+			local text = type(prompt) == "string" and prompt or "messages"
+			results[i] = {ok = true, response = "Mock response to: " .. text, duration = 0, prompt_tokens = 0, response_tokens = 0}
+		end
+		return results, {succeeded = #results, failed = 0, prompt_tokens = 0, response_tokens = 0, duration = 0}
+	end,
+	generate_structured = function(prompt, schema, options)
+		local value = {}
+		for name, property in pairs(schema.properties or {}) do
+			if property.type == "string" then
+				value[name] = "mock " .. name
+			elseif property.type == "number" or property.type == "integer" then
+				value[name] = 0
+			elseif property.type == "boolean" then
+				value[name] = true
+			end
+		end
+		return value, 1
+	end,
+	set_model = function(name)
+		llm._model = name
+	end,
+	get_model = function()
+		return llm._model or "default"
+	end,
+	resolve_model = function(name)
+		return {provider = "mock", model = name}
+	end,
+	set_context_fallback = function(model, larger) end,
+	set_context_trim = function(tokens) end,
+	set_routing = function(options) end,
+	cache = {
+		enable = function(options) end,
+		disable = function() end,
+		bypass = function(bypass) end,
+		status = function()
+			return {available = false, enabled = false, ttl = 0, bypass = false}
+		end
+	},
+	last_adjustment = function()
+		return nil
 	end
 }
 `
-	err := eng.LoadScript(strings.NewReader(mockScript))
-	if err != nil {
-		log.Printf("Warning: Failed to register mock LLM: %v", err)
-		return
-	}
 
-	err = eng.Execute(context.Background())
-	if err != nil {
-		log.Printf("Warning: Failed to execute mock LLM setup: %v", err)
+// registerMockLLM defines the mock llm module in the engine's Lua state
+func registerMockLLM(eng *lua.LuaEngine) error {
+	if err := eng.GetLuaState().DoString(mockLLMScript); err != nil {
+		return fmt.Errorf("failed to register mock LLM: %w", err)
 	}
+	return nil
 }
@@ -4,21 +4,50 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
 	"github.com/lexlapax/go-llmspell/pkg/engine"
 	"github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	"github.com/lexlapax/go-llmspell/pkg/mcp"
+	"github.com/lexlapax/go-llmspell/pkg/security"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// TestMain lets the test binary stand in for llmspell when runIsolated
+// starts it as an isolated child, or a test starts it to check exit codes
+func TestMain(m *testing.M) {
+	if os.Getenv(security.IsolationEnv) != "" || os.Getenv("LLMSPELL_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	if os.Getenv("LLMSPELL_METRICS") == "" {
+		// Test runs stay out of the user's metrics
+		os.Setenv("LLMSPELL_METRICS", "off")
+	}
+	os.Exit(m.Run())
+}
+
 // captureOutput captures stdout and stderr during test execution
 func captureOutput(_ *testing.T, fn func()) (stdout, stderr string) {
 	// Save original stdout and stderr
@@ -110,6 +139,13 @@ func TestSetupParams(t *testing.T) {
 				"another": "param",
 			},
 		},
+		{
+			name: "dotted parameter name",
+			args: []string{"model.fast=anthropic/claude-3-5-haiku-latest"},
+			expectedParams: map[string]string{
+				"model.fast": "anthropic/claude-3-5-haiku-latest",
+			},
+		},
 		{
 			name:           "no parameters",
 			args:           []string{},
@@ -125,7 +161,7 @@ func TestSetupParams(t *testing.T) {
 			for key, expectedValue := range tt.expectedParams {
 				// Get the value from Lua
 				err := eng.LoadScript(strings.NewReader(`
-					testValue = params.` + key + `
+					testValue = params["` + key + `"]
 				`))
 				require.NoError(t, err)
 
@@ -150,7 +186,7 @@ func TestRegisterMockLLM(t *testing.T) {
 	defer eng.Close()
 
 	// Register mock LLM
-	registerMockLLM(eng)
+	require.NoError(t, registerMockLLM(eng))
 
 	// Test chat function
 	err = eng.LoadScript(strings.NewReader(`
@@ -222,7 +258,7 @@ func TestInitializeBridges(t *testing.T) {
 	defer os.Unsetenv("MOCK_LLM")
 
 	// Initialize bridges
-	initializeBridges(eng, "test-spell")
+	initializeBridges(eng, "test-spell", nil, nil, "", stdlib.AssertRaise)
 
 	// Check that standard library is available
 	err = eng.LoadScript(strings.NewReader(`
@@ -262,7 +298,7 @@ func TestRunSpellWithFile(t *testing.T) {
 
 	// Capture output
 	stdout, stderr := captureOutput(t, func() {
-		runSpell(spellFile, []string{})
+		runSpell(spellFile, []string{}, runOptions{})
 	})
 
 	// Check output
@@ -296,7 +332,7 @@ func TestRunSpellWithDirectory(t *testing.T) {
 
 	// Capture output with parameters
 	stdout, stderr := captureOutput(t, func() {
-		runSpell(spellDir, []string{"test=value123"})
+		runSpell(spellDir, []string{"test=value123"}, runOptions{})
 	})
 
 	// Check output
@@ -307,6 +343,891 @@ func TestRunSpellWithDirectory(t *testing.T) {
 	assert.Empty(t, stderr)
 }
 
+func TestRunSpellWithStrictProfile(t *testing.T) {
+	spellFile := filepath.Join(t.TempDir(), "strict.lua")
+	spellContent := `
+		local result, err = tools.execute("calculator", {expression = "1+1"})
+		print("execute: " .. tostring(err))
+		print("listed: " .. tostring(#tools.list() > 0))
+	`
+	require.NoError(t, os.WriteFile(spellFile, []byte(spellContent), 0644))
+
+	os.Setenv("MOCK_LLM", "true")
+	defer os.Unsetenv("MOCK_LLM")
+
+	profile, err := security.LookupProfile("strict")
+	require.NoError(t, err)
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{Profile: profile})
+	})
+
+	assert.Contains(t, stdout, "execute: permission denied: tools.execute")
+	assert.Contains(t, stdout, "listed: true")
+}
+
+func TestRunSpellAssertMode(t *testing.T) {
+	spellFile := filepath.Join(t.TempDir(), "asserts.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		print("assert: " .. tostring(log.assert(false, "totals do not match")))
+		print("continued")
+	`), 0644))
+	t.Setenv("MOCK_LLM", "true")
+
+	// The production profile logs a failed assertion and carries on
+	profile, err := security.LookupProfile("standard")
+	require.NoError(t, err)
+	profile.Asserts = security.AssertLog
+	stdout, stderr := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{Profile: profile})
+	})
+	assert.Contains(t, stdout, "assert: false")
+	assert.Contains(t, stdout, "continued")
+	assert.Contains(t, stdout+stderr, "totals do not match")
+
+	// Other profiles stop the spell
+	assert.Equal(t, stdlib.AssertRaise, assertMode(security.Profile{}))
+	production, err := security.LookupProfile("production")
+	require.NoError(t, err)
+	assert.Equal(t, stdlib.AssertLog, assertMode(production))
+}
+
+func TestRunSpellStdlibPolicy(t *testing.T) {
+	spellFile := filepath.Join(t.TempDir(), "stdlib.lua")
+	spellContent := `
+		local response, err = http.get("http://127.0.0.1:1/")
+		print("http: " .. tostring(err))
+		local dir, err = fs.temp_dir()
+		print("fs: " .. tostring(err))
+		print("json: " .. json.encode({ok = true}))
+		for i = 1, 3 do
+			local _, err = time.now()
+			if err then print("time " .. i .. ": " .. err) end
+		end
+	`
+	require.NoError(t, os.WriteFile(spellFile, []byte(spellContent), 0644))
+	t.Setenv("MOCK_LLM", "true")
+
+	profile := security.Profile{
+		Name:       "custom",
+		Methods:    security.MethodPolicy{Deny: []string{"http.*", "fs.*"}},
+		RateLimits: []security.RateLimit{{Method: "time.now", Calls: 2, Per: time.Minute}},
+	}
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{Profile: profile})
+	})
+	assert.Contains(t, stdout, "http: permission denied: http.get")
+	assert.Contains(t, stdout, "fs: permission denied: fs.temp_dir")
+	assert.Contains(t, stdout, `json: {"ok":true}`)
+	assert.Contains(t, stdout, "time 3: rate limit exceeded")
+	assert.NotContains(t, stdout, "time 2:")
+}
+
+func TestRunSpellSummary(t *testing.T) {
+	spellFile := filepath.Join(t.TempDir(), "summary.lua")
+	spellContent := `
+		tools.register("shout", "Upper-cases text", {}, function(params)
+			return string.upper(params.text)
+		end, {deterministic = true})
+		tools.execute("shout", {text = "hi"})
+		tools.execute("shout", {text = "hi"})
+		tools.execute("no_such_tool", {})
+	`
+	require.NoError(t, os.WriteFile(spellFile, []byte(spellContent), 0644))
+
+	os.Setenv("MOCK_LLM", "true")
+	defer os.Unsetenv("MOCK_LLM")
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{})
+	})
+	assert.Contains(t, stdout, "=== Run Summary ===")
+	assert.Contains(t, stdout, "Bridge calls: 4")
+	assert.Contains(t, stdout, "(1 failed)")
+	assert.Contains(t, stdout, "2/2 succeeded (100%) (1 from the cache)")
+
+	stdout, _ = captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{Output: "json"})
+	})
+	start := strings.Index(stdout, "{")
+	require.GreaterOrEqual(t, start, 0, "Expected a JSON summary in:\n%s", stdout)
+
+	var summary runSummary
+	require.NoError(t, json.Unmarshal([]byte(stdout[start:]), &summary))
+	assert.Len(t, summary.RunID, 16)
+	require.Len(t, summary.Bridges, 1, "Only the tools bridge should start")
+	assert.Equal(t, "tools", summary.Bridges[0].Name)
+	assert.Equal(t, 4, summary.BridgeCalls)
+	assert.Equal(t, 0, summary.LLMCalls)
+	require.Len(t, summary.ToolExecutions, 1)
+	assert.Equal(t, "shout", summary.ToolExecutions[0].Name)
+	assert.Equal(t, 1, summary.ToolExecutions[0].CacheHits)
+	assert.Positive(t, summary.WallTime)
+	assert.Positive(t, summary.PeakMemory)
+}
+
+func TestRunSpellWarnings(t *testing.T) {
+	spellFile := filepath.Join(t.TempDir(), "warnings.lua")
+	spellContent := `
+		for i = 1, 3 do
+			warn("slow source", {url = "https://example.com"})
+		end
+		warn("deprecated option")
+	`
+	require.NoError(t, os.WriteFile(spellFile, []byte(spellContent), 0644))
+	t.Setenv("MOCK_LLM", "true")
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{})
+	})
+	assert.Contains(t, stdout, "Warnings: 2")
+	assert.Contains(t, stdout, "[spell] slow source (3 times)")
+
+	stdout, _ = captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{Output: "json"})
+	})
+	start := strings.Index(stdout, "{")
+	require.GreaterOrEqual(t, start, 0, "Expected a JSON summary in:\n%s", stdout)
+
+	var summary runSummary
+	require.NoError(t, json.Unmarshal([]byte(stdout[start:]), &summary))
+	require.Len(t, summary.Warnings, 2)
+	assert.Equal(t, bridge.WarnSpell, summary.Warnings[0].Source)
+	assert.Equal(t, 3, summary.Warnings[0].Count)
+	assert.Equal(t, "https://example.com", summary.Warnings[0].Data["url"])
+	assert.Equal(t, "deprecated option", summary.Warnings[1].Message)
+}
+
+func TestRunSpellHooks(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	spellFile := write("greet.lua", `print("prefix: " .. (PROMPT_PREFIX or "none"))`)
+	write("prefix.lua", `
+		local hook = ...
+		PROMPT_PREFIX = "[" .. hook.spell .. " for " .. hook.params.who .. "]"
+	`)
+	write("after.lua", `
+		local hook = ...
+		print("after: " .. hook.phase .. " " .. hook.status)
+		error("notifier down")
+	`)
+	write("deny.lua", `return false, "outside business hours"`)
+	hooksFile := write("hooks.json", `{"pre": ["log", "prefix.lua"], "post": ["after.lua", "log"]}`)
+	t.Setenv("MOCK_LLM", "true")
+
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	hooks, err := loadHooks(hooksFile)
+	require.NoError(t, err)
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{"who=ops"}, runOptions{Hooks: hooks})
+	})
+	assert.Contains(t, stdout, "prefix: [greet for ops]", "Pre-hooks run in the spell's engine")
+	assert.Contains(t, stdout, "after: post success")
+	assert.Contains(t, stdout, "[hook] post-run hook after.lua failed", "A failing post-hook is a warning")
+	assert.Contains(t, logged.String(), "hook: spell greet starting")
+	assert.Contains(t, logged.String(), "hook: spell greet finished")
+
+	// LLMSPELL_HOOKS names the file when --hooks is not given
+	t.Setenv("LLMSPELL_HOOKS", hooksFile)
+	hooks, err = loadHooks("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"log", "prefix.lua"}, hooks.Pre)
+
+	for content, want := range map[string]string{
+		`{"pre": ["missing.lua"]}`: "hook script missing.lua",
+		`{"post": ["notify"]}`:     `unknown hook "notify"`,
+		`{"pre": ["require-env"]}`: "needs a variable name",
+		`{"pre": "log"}`:           "cannot unmarshal",
+	} {
+		_, err := loadHooks(write("bad.json", content))
+		require.Error(t, err, content)
+		assert.Contains(t, err.Error(), want)
+	}
+
+	// A failing pre-hook stops the run before the spell starts
+	for hook, want := range map[string]string{
+		"deny.lua":                        "deny.lua: outside business hours",
+		"require-env:LLMSPELL_TEST_UNSET": "require-env:LLMSPELL_TEST_UNSET: environment variable LLMSPELL_TEST_UNSET is not set",
+	} {
+		write("deny.json", `{"pre": ["`+hook+`"]}`)
+		cmd := exec.Command(os.Args[0], "--lang", "en", "--hooks", filepath.Join(dir, "deny.json"), "run", spellFile)
+		cmd.Env = append(os.Environ(), "LLMSPELL_TEST_MAIN=1")
+		output, err := cmd.CombinedOutput()
+		require.Error(t, err, "Output:\n%s", output)
+		assert.Contains(t, string(output), "Pre-run hook stopped the spell: "+want)
+		assert.NotContains(t, string(output), "prefix:")
+	}
+}
+
+func TestRunSpellSubSpells(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "double"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "double", "main.lua"), []byte(`
+		local depth = spell.depth()
+		tools.execute("no_such_tool", {})
+		return {value = params.n * 2, depth = depth}
+	`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "recurse.lua"), []byte(`
+		local result, err = spell.run("recurse.lua")
+		return err or result
+	`), 0644))
+
+	spellFile := filepath.Join(dir, "router.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		local result, err = spell.run("double", {n = 21})
+		print("double: " .. tostring(result and result.value) .. " at depth " .. tostring(result and result.depth) .. " " .. tostring(err))
+		local again = spell.run("double", {n = 21})
+		spell.run("double", {n = 21}, {cache = false})
+		print("memoized: " .. tostring(again and again.value))
+		print("eval: " .. tostring(spell.eval("return params.x + 1", "lua", {x = 1})))
+		print("leaked: " .. tostring(value))
+		local nested = spell.run("recurse.lua")
+		print("recurse: " .. tostring(nested))
+		local _, err = spell.eval("return 1", "cobol")
+		print("engine: " .. tostring(err))
+	`), 0644))
+
+	os.Setenv("MOCK_LLM", "true")
+	defer os.Unsetenv("MOCK_LLM")
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{Output: "json"})
+	})
+	assert.Contains(t, stdout, "double: 42 at depth 2 nil")
+	assert.Contains(t, stdout, "memoized: 42")
+	assert.Contains(t, stdout, "eval: 2")
+	assert.Contains(t, stdout, "leaked: nil")
+	assert.Contains(t, stdout, "recurse: spell recursion depth exceeded")
+	assert.Contains(t, stdout, `engine: engine "cobol" not found`)
+
+	// Sub-spell bridge calls count toward the run
+	start := strings.Index(stdout, "{\n")
+	require.GreaterOrEqual(t, start, 0, "Expected a JSON summary in:\n%s", stdout)
+	var summary runSummary
+	require.NoError(t, json.Unmarshal([]byte(stdout[start:]), &summary))
+	assert.Greater(t, summary.BridgeCalls, 6, "The router itself makes six calls")
+	assert.Equal(t, 1, summary.Cache[bridge.CacheSpell].Hits)
+	assert.Equal(t, 1, summary.Cache[bridge.CacheSpell].Bypassed)
+
+	// Profiles that do not allow the spell module deny it
+	profile, err := security.LookupProfile("strict")
+	require.NoError(t, err)
+	stdout, _ = captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{Profile: profile})
+	})
+	assert.Contains(t, stdout, "permission denied: spell.run")
+}
+
+func TestRunSpellCache(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "child.lua"), []byte(`
+		return tostring(cache.get("answer"))
+	`), 0644))
+	spellFile := filepath.Join(dir, "parent.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		local calls = 0
+		local function answer() calls = calls + 1; return 42 end
+		cache.memoize("answer", answer)
+		print("answer: " .. cache.memoize("answer", answer) .. " after " .. calls .. " call")
+		print("child sees: " .. spell.run("child.lua", {}, {cache = false}))
+	`), 0644))
+	t.Setenv("MOCK_LLM", "true")
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{Output: "json"})
+	})
+	assert.Contains(t, stdout, "answer: 42 after 1 call")
+	assert.Contains(t, stdout, "child sees: nil", "Each spell has its own namespace")
+
+	start := strings.Index(stdout, "{\n")
+	require.GreaterOrEqual(t, start, 0, "Expected a JSON summary in:\n%s", stdout)
+	var summary runSummary
+	require.NoError(t, json.Unmarshal([]byte(stdout[start:]), &summary))
+	assert.Equal(t, bridge.CacheStats{Hits: 1, Misses: 2}, summary.Cache[bridge.CacheScript])
+
+	stdout, _ = captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{NoCache: true})
+	})
+	assert.Contains(t, stdout, "after 2 call", "--no-cache turns the cache module off")
+}
+
+func TestRunSpellVectorStore(t *testing.T) {
+	spellFile := filepath.Join(t.TempDir(), "rag.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		print("stored: " .. vectorstore.upsert("docs", {
+			{id = "cats", vector = {1, 0}, text = "Cats purr."},
+			{id = "dogs", vector = {0, 1}, text = "Dogs bark."},
+		}))
+		print("closest: " .. vectorstore.query("docs", {vector = {0.9, 0.1}, top_k = 1})[1].text)
+		local _, err = vectorstore.query("docs", "which pet purrs?")
+		print("embedding: " .. tostring(err ~= nil))
+		print("chunks: " .. #rag.chunk("one\n\ntwo", {max_tokens = 1}))
+	`), 0644))
+	t.Setenv("MOCK_LLM", "true")
+	t.Setenv("LLMSPELL_VECTOR_STORE", "memory")
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{})
+	})
+	assert.Contains(t, stdout, "stored: 2")
+	assert.Contains(t, stdout, "closest: Cats purr.")
+	assert.Contains(t, stdout, "embedding: true", "Mock runs have no embeddings provider")
+	assert.Contains(t, stdout, "chunks: 2")
+}
+
+func TestRunSpellMCP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     *int64 `json:"id"`
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.ID == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		results := map[string]interface{}{
+			"initialize": map[string]interface{}{"protocolVersion": "2025-03-26", "serverInfo": map[string]interface{}{"name": "clock"}},
+			"tools/list": map[string]interface{}{"tools": []interface{}{map[string]interface{}{"name": "now", "description": "The time"}}},
+			"tools/call": map[string]interface{}{"content": []interface{}{map[string]interface{}{"type": "text", "text": "noon"}}},
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": results[req.Method]})
+	}))
+	defer server.Close()
+
+	home := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".llmspell"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".llmspell", "mcp.json"),
+		[]byte(`{"servers": {"clock": {"url": "`+server.URL+`"}}}`), 0644))
+	t.Setenv("HOME", home)
+	t.Setenv("MOCK_LLM", "true")
+
+	spellFile := filepath.Join(t.TempDir(), "mcp.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		print("configured: " .. table.concat(mcp.configured(), ","))
+		mcp.connect("clock")
+		for _, tool in ipairs(tools.list()) do
+			if tool.source == "mcp:clock" then
+				print("tool: " .. tool.name .. " = " .. tools.execute(tool.name, {}))
+			end
+		end
+	`), 0644))
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{})
+	})
+	assert.Contains(t, stdout, "configured: clock")
+	assert.Contains(t, stdout, "tool: clock__now = noon")
+}
+
+func TestRunSpellOpenAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/openapi.yaml" {
+			fmt.Fprint(w, "openapi: 3.0.0\ninfo: {title: Greeter, version: '1'}\nservers: [{url: /}]\n"+
+				"paths:\n  /hello/{name}:\n    get: {operationId: hello, parameters: [{name: name, in: path}]}\n")
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "hello "+strings.TrimPrefix(r.URL.Path, "/hello/"))
+	}))
+	defer server.Close()
+
+	home := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".llmspell"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".llmspell", "secrets.json"),
+		[]byte(`{"secrets": {"greeter": {"value": "env:TEST_GREETER_TOKEN", "hosts": ["127.0.0.1"]}}}`), 0600))
+	t.Setenv("HOME", home)
+	t.Setenv("TEST_GREETER_TOKEN", "t0ken")
+	t.Setenv("MOCK_LLM", "true")
+
+	spellFile := filepath.Join(t.TempDir(), "openapi.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		local names = assert(tools.import_openapi(params.url, {prefix = "greeter_", auth = {secret = "greeter"}}))
+		print("imported: " .. table.concat(names, ","))
+		print("said: " .. tools.execute("greeter_hello", {name = "world"}))
+	`), 0644))
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{"url=" + server.URL + "/openapi.yaml"}, runOptions{})
+	})
+	assert.Contains(t, stdout, "imported: greeter_hello")
+	assert.Contains(t, stdout, "said: hello world")
+}
+
+func TestRunSpellPlugins(t *testing.T) {
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, "stamp.sh")
+	require.NoError(t, os.WriteFile(plugin, []byte(`
+		while read -r line; do
+			id=$(echo "$line" | sed 's/.*"id":\([0-9]*\).*/\1/')
+			case "$line" in
+			*'"describe"'*) echo '{"jsonrpc":"2.0","id":'$id',"result":{"tools":[{"name":"stamp","description":"Stamps text"}]}}' ;;
+			*) echo '{"jsonrpc":"2.0","id":'$id',"result":"stamped"}' ;;
+			esac
+		done
+	`), 0644))
+
+	home := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".llmspell"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".llmspell", "plugins.json"),
+		[]byte(`{"plugins": [{"name": "stamps", "command": "sh", "args": ["`+plugin+`"]}, {"name": "gone", "path": "`+filepath.Join(dir, "gone.so")+`"}]}`), 0644))
+	t.Setenv("HOME", home)
+	t.Setenv("MOCK_LLM", "true")
+
+	spellFile := filepath.Join(dir, "plugins.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		local tool = tools.get("stamp")
+		print("source: " .. tool.source)
+		print("said: " .. tools.execute("stamp", {text = "hi"}))
+	`), 0644))
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{})
+	})
+	assert.Contains(t, stdout, "source: plugin:stamps")
+	assert.Contains(t, stdout, "said: stamped")
+	assert.Contains(t, stdout, "plugin gone")
+}
+
+func TestRunSpellSharedState(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "worker.lua"), []byte(`
+		state.set("found", state.get("topic") .. " facts")
+		return spell.traceparent()
+	`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "relay.tengo"), []byte(`
+		state := import("state")
+		state.attach("handoff").set("note", "from tengo")
+	`), 0644))
+
+	spellFile := filepath.Join(dir, "orchestrator.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		state.set("topic", "go")
+		local traceparent = spell.run("worker.lua")
+		print("found: " .. tostring(state.get("found")))
+		print("child trace: " .. traceparent:sub(4, 35))
+		local _, err = spell.run("worker.lua", {}, {cache = false, state = false})
+		print("isolated: " .. tostring(err ~= nil))
+		spell.run("relay.tengo", {}, {state = false})
+		print("handoff: " .. state.attach("handoff").get("note"))
+	`), 0644))
+
+	os.Setenv("MOCK_LLM", "true")
+	defer os.Unsetenv("MOCK_LLM")
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{})
+	})
+	assert.Contains(t, stdout, "found: go facts")
+	assert.Contains(t, stdout, "child trace: 4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Contains(t, stdout, "isolated: true", "An isolated worker cannot read the topic")
+	assert.Contains(t, stdout, "handoff: from tengo", "Spells that share no state meet on a channel")
+	assert.Contains(t, stdout, "Trace ID: 4bf92f3577b34da6a3ce929d0e0e4736")
+}
+
+func TestOpenCallLog(t *testing.T) {
+	os.Unsetenv("LLMSPELL_LLM_LOG")
+	callLog, closeLog := openCallLog("", "run-1")
+	assert.Nil(t, callLog)
+	closeLog()
+
+	path := filepath.Join(t.TempDir(), "llm.jsonl")
+	callLog, closeLog = openCallLog(path, "run-1")
+	require.NotNil(t, callLog)
+	closeLog()
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestRunSpellIsolated(t *testing.T) {
+	spellFile := filepath.Join(t.TempDir(), "isolated.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`print("hello from " .. params.who)`), 0644))
+
+	os.Setenv("MOCK_LLM", "true")
+	defer os.Unsetenv("MOCK_LLM")
+
+	// Privileges stay as they are so the child can run the test binary
+	profile := security.Profile{Name: "standard", Isolation: &security.Isolation{OpenFiles: 128, Seccomp: true}}
+	stdout, _ := captureOutput(t, func() {
+		runIsolated(spellFile, []string{"who=child"}, runOptions{Profile: profile, Output: "json"})
+	})
+	assert.Contains(t, stdout, "hello from child")
+
+	start := strings.LastIndex(stdout, "{\n")
+	require.GreaterOrEqual(t, start, 0, "Expected a JSON summary in:\n%s", stdout)
+
+	var summary runSummary
+	require.NoError(t, json.Unmarshal([]byte(stdout[start:]), &summary))
+	assert.True(t, summary.Isolated)
+	assert.NotEmpty(t, summary.RunID)
+}
+
+func TestExtractSwitch(t *testing.T) {
+	args, found := extractSwitch([]string{"--isolated", "run", "spell.lua"}, "isolated")
+	assert.True(t, found)
+	assert.Equal(t, []string{"run", "spell.lua"}, args)
+
+	_, found = extractSwitch(args, "isolated")
+	assert.False(t, found)
+}
+
+func TestParseCacheTTL(t *testing.T) {
+	t.Setenv("LLMSPELL_CACHE_TTL", "")
+	assert.Zero(t, parseCacheTTL(""))
+	assert.Equal(t, 90*time.Minute, parseCacheTTL("1h30m"))
+
+	t.Setenv("LLMSPELL_CACHE_TTL", "10m")
+	assert.Equal(t, 10*time.Minute, parseCacheTTL(""))
+	assert.Equal(t, time.Hour, parseCacheTTL("1h"), "The flag wins over the environment")
+
+	assert.Nil(t, newResultCache(runOptions{NoCache: true}))
+	assert.False(t, newResultCache(runOptions{}).Persistent())
+}
+
+func TestParseCallTimeout(t *testing.T) {
+	t.Setenv("LLMSPELL_CALL_TIMEOUT", "")
+	assert.Equal(t, defaultCallTimeout, parseCallTimeout(""))
+	assert.Zero(t, parseCallTimeout("0"))
+
+	t.Setenv("LLMSPELL_CALL_TIMEOUT", "5s")
+	assert.Equal(t, 5*time.Second, parseCallTimeout(""))
+	assert.Equal(t, 2*time.Minute, parseCallTimeout("2m"), "The flag wins over the environment")
+}
+
+func TestParseRunLimits(t *testing.T) {
+	t.Setenv("LLMSPELL_TIMEOUT", "")
+	t.Setenv("LLMSPELL_MAX_LLM_CALLS", "")
+	assert.Zero(t, parseTimeout(""))
+	assert.Zero(t, parseMaxLLMCalls(""))
+	assert.Equal(t, 5*time.Minute, parseTimeout("5m"))
+	assert.Equal(t, 20, parseMaxLLMCalls("20"))
+
+	t.Setenv("LLMSPELL_MAX_LLM_CALLS", "3")
+	assert.Equal(t, 3, parseMaxLLMCalls(""))
+}
+
+func TestRunSpellClock(t *testing.T) {
+	spellFile := filepath.Join(t.TempDir(), "clock.lua")
+	script := `
+		print("today: " .. time.date("!%Y-%m-%d %H:%M:%S"))
+		print("now: " .. time.now())
+		warn("checked the clock")
+	`
+	require.NoError(t, os.WriteFile(spellFile, []byte(script), 0644))
+	t.Setenv("MOCK_LLM", "true")
+
+	assert.True(t, parseNow("").IsZero())
+	now := parseNow("2024-03-01T09:30:00Z")
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{Now: now, Output: "json"})
+	})
+	assert.Contains(t, stdout, "today: 2024-03-01 09:30:00")
+	assert.Contains(t, stdout, "now: 1709285400\n")
+
+	start := strings.Index(stdout, "{")
+	require.GreaterOrEqual(t, start, 0, "Expected a JSON summary in:\n%s", stdout)
+	var summary runSummary
+	require.NoError(t, json.Unmarshal([]byte(stdout[start:]), &summary))
+	require.Len(t, summary.Warnings, 1)
+	assert.True(t, now.Equal(summary.Warnings[0].Time), "Warnings are timestamped by the run's clock")
+}
+
+func TestRunSpellProfile(t *testing.T) {
+	dir := t.TempDir()
+	spellFile := filepath.Join(dir, "profiled.lua")
+	script := `
+		tools.register("remember", "Stores text", {}, function(params)
+			state.set("text", params.text)
+			return params.text
+		end)
+		for i = 1, 3 do
+			tools.execute("remember", {text = "note " .. i})
+		end
+		print("remembered: " .. state.get("text"))
+	`
+	require.NoError(t, os.WriteFile(spellFile, []byte(script), 0644))
+	t.Setenv("MOCK_LLM", "true")
+
+	stacksFile := filepath.Join(dir, "profile.folded")
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{}, runOptions{ProfileSpell: stacksFile, Output: "json"})
+	})
+	assert.Contains(t, stdout, "remembered: note 3")
+
+	start := strings.Index(stdout, "{")
+	require.GreaterOrEqual(t, start, 0, "Expected a JSON summary in:\n%s", stdout)
+	var summary runSummary
+	require.NoError(t, json.Unmarshal([]byte(stdout[start:]), &summary))
+	require.NotNil(t, summary.Profile)
+	calls := make(map[string]int)
+	for _, entry := range summary.Profile.Methods {
+		calls[entry.Name] = entry.Calls
+	}
+	assert.Equal(t, 3, calls["tools.execute"])
+	assert.Equal(t, 3, calls["state.set"])
+	assert.Contains(t, summary.Profile.Kinds, bridge.ProfileScript)
+	assert.Contains(t, summary.Profile.Kinds, bridge.ProfileTools)
+
+	stacks, err := os.ReadFile(stacksFile)
+	require.NoError(t, err)
+	assert.Regexp(t, `(?m)^spell \d+$`, string(stacks))
+	assert.Regexp(t, `(?m)^spell;tools\.execute;state\.set \d+$`, string(stacks), "Calls inside a tool are nested under it")
+}
+
+func TestRunTengoSpell(t *testing.T) {
+	dir := t.TempDir()
+	spellFile := filepath.Join(dir, "greet.tengo")
+	script := `
+		fmt := import("fmt")
+		llm := import("llm")
+		state := import("state")
+		tools := import("tools")
+
+		answer := llm.chat("Hello " + params.name)
+		state.set("answer", answer)
+		fmt.println("answer: " + state.get("answer"))
+		fmt.println("missing tool failed: ", is_error(tools.execute("no_such_tool", {})))
+	`
+	require.NoError(t, os.WriteFile(spellFile, []byte(script), 0644))
+	t.Setenv("MOCK_LLM", "true")
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{"name=Ada"}, runOptions{Output: "json"})
+	})
+	assert.Contains(t, stdout, "answer: [Mock LLM Response] I received your prompt: 'Hello Ada'")
+	assert.Contains(t, stdout, "missing tool failed: true")
+
+	start := strings.Index(stdout, "{")
+	require.GreaterOrEqual(t, start, 0, "Expected a JSON summary in:\n%s", stdout)
+	var summary runSummary
+	require.NoError(t, json.Unmarshal([]byte(stdout[start:]), &summary))
+	assert.Equal(t, 1, summary.LLMCalls)
+	for _, stat := range summary.Methods {
+		if stat.Name == "tools.execute" {
+			assert.Equal(t, 1, stat.Failures, "A returned error value counts as a failure")
+		}
+	}
+}
+
+func TestRunTengoSpellPolicy(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tengo"), []byte(`
+		fmt := import("fmt")
+		tools := import("tools")
+		fmt.println("denied: ", tools.execute("calculator", {expression: "1+1"}))
+	`), 0644))
+	profile, err := security.LookupProfile("strict")
+	require.NoError(t, err)
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(dir, nil, runOptions{Profile: profile})
+	})
+	assert.Contains(t, stdout, "denied: error:")
+}
+
+func TestRunJavaScriptSpell(t *testing.T) {
+	dir := t.TempDir()
+	spellFile := filepath.Join(dir, "greet.js")
+	script := `
+		tools.register("shout", "Shouts its text", {type: "object"}, function(p) {
+			return p.text.toUpperCase();
+		});
+		const answer = llm.chat("Hello " + params.name);
+		state.set("answer", answer);
+		console.log("answer: " + state.get("answer"));
+		console.log("shouted: " + tools.execute("shout", {text: "hi"}));
+		try {
+			tools.execute("no_such_tool", {});
+		} catch (e) {
+			console.log("missing tool failed: true");
+		}
+		console.log("agents: " + agents.list().length);
+	`
+	require.NoError(t, os.WriteFile(spellFile, []byte(script), 0644))
+	t.Setenv("MOCK_LLM", "true")
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{"name=Ada"}, runOptions{Output: "json"})
+	})
+	assert.Contains(t, stdout, "answer: [Mock LLM Response] I received your prompt: 'Hello Ada'")
+	assert.Contains(t, stdout, "shouted: HI", "A tool the spell registers runs through the tool bridge")
+	assert.Contains(t, stdout, "missing tool failed: true")
+	assert.Contains(t, stdout, "agents: 0")
+
+	start := strings.Index(stdout, "{")
+	require.GreaterOrEqual(t, start, 0, "Expected a JSON summary in:\n%s", stdout)
+	var summary runSummary
+	require.NoError(t, json.Unmarshal([]byte(stdout[start:]), &summary))
+	assert.Equal(t, 1, summary.LLMCalls)
+	for _, stat := range summary.Methods {
+		if stat.Name == "tools.execute" {
+			assert.Equal(t, 1, stat.Failures, "A thrown error counts as a failure")
+		}
+	}
+}
+
+func TestRunJavaScriptSpellPolicy(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.js"), []byte(`
+		try {
+			tools.execute("calculator", {expression: "1+1"});
+		} catch (e) {
+			console.log("denied: " + e.message);
+		}
+	`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub.lua"), []byte(`
+		local result = spell.run("child.js", {n = "20"})
+		print("doubled: " .. tostring(result.doubled))
+	`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "child.js"), []byte(`
+		var result = {doubled: Number(params.n) * 2};
+	`), 0644))
+	profile, err := security.LookupProfile("strict")
+	require.NoError(t, err)
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(dir, nil, runOptions{Profile: profile})
+		runSpell(filepath.Join(dir, "sub.lua"), nil, runOptions{})
+	})
+	assert.Contains(t, stdout, "denied: ")
+	assert.Contains(t, stdout, "doubled: 40", "A Lua spell runs a JavaScript sub-spell and gets its result")
+}
+
+func TestRunSpellShebang(t *testing.T) {
+	dir := t.TempDir()
+	tengoFile := filepath.Join(dir, "greet.spell")
+	require.NoError(t, os.WriteFile(tengoFile, []byte("#!llmspell:tengo\nfmt := import(\"fmt\")\nfmt.println(\"from tengo\")\n"), 0644))
+	luaFile := filepath.Join(dir, "greet.lua")
+	require.NoError(t, os.WriteFile(luaFile, []byte("#!llmspell:lua\nprint(\"from lua\")\n"), 0644))
+
+	stdout, _ := captureOutput(t, func() {
+		runSpell(tengoFile, nil, runOptions{})
+		runSpell(luaFile, nil, runOptions{})
+	})
+	assert.Contains(t, stdout, "from tengo")
+	assert.Contains(t, stdout, "from lua")
+}
+
+func TestRunContext(t *testing.T) {
+	ctx, _, stop := runContext(0)
+	self, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, self.Signal(os.Interrupt))
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Ctrl-C to cancel the run")
+	}
+	assert.ErrorIs(t, context.Cause(ctx), engine.ErrInterrupted)
+	stop()
+
+	ctx, cancel, stop := runContext(time.Millisecond)
+	defer stop()
+	<-ctx.Done()
+	assert.ErrorIs(t, context.Cause(ctx), engine.ErrExecutionTimeout)
+	cancel(engine.ErrBudgetExhausted)
+	assert.ErrorIs(t, context.Cause(ctx), engine.ErrExecutionTimeout, "The first cause wins")
+}
+
+func TestRunSpellTimeout(t *testing.T) {
+	spellFile := filepath.Join(t.TempDir(), "forever.lua")
+	script := `
+		spell.on_exit(function(reason) print("exit hook: " .. reason) end)
+		while true do end
+	`
+	require.NoError(t, os.WriteFile(spellFile, []byte(script), 0644))
+
+	cmd := exec.Command(os.Args[0], "--lang", "en", "--timeout", "100ms", "run", spellFile)
+	cmd.Env = append(os.Environ(), "LLMSPELL_TEST_MAIN=1", "MOCK_LLM=true")
+	output, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr, "Output:\n%s", output)
+	assert.Equal(t, engine.ExitDeadline, exitErr.ExitCode())
+	assert.Contains(t, string(output), "Spell cancelled (deadline)")
+	assert.Contains(t, string(output), "exit hook: deadline", "Exit hooks should run after the deadline")
+}
+
+func TestRunSpellSnapshotReplay(t *testing.T) {
+	t.Setenv("MOCK_LLM", "true")
+	t.Setenv("LLMSPELL_TEST_TOKEN", "hunter2")
+
+	tmpDir := t.TempDir()
+	spellFile := filepath.Join(tmpDir, "dice.lua")
+	script := `print("rolls: " .. math.random(1000) .. " " .. math.random(1000) .. " " .. params.who)`
+	require.NoError(t, os.WriteFile(spellFile, []byte(script), 0644))
+	snapshotFile := filepath.Join(tmpDir, "snapshot.json")
+
+	rolls := func(stdout string) string {
+		for _, line := range strings.Split(stdout, "\n") {
+			if strings.HasPrefix(line, "rolls: ") {
+				return line
+			}
+		}
+		return ""
+	}
+
+	recorded, _ := captureOutput(t, func() {
+		runSpell(spellFile, []string{"who=alice"}, runOptions{Snapshot: snapshotFile})
+	})
+	assert.Contains(t, recorded, "Snapshot written to "+snapshotFile)
+
+	snapshot, err := loadSnapshot(snapshotFile)
+	require.NoError(t, err)
+	assert.NotZero(t, snapshot.Seed)
+	assert.Equal(t, []string{"who=alice"}, snapshot.Args)
+	assert.Contains(t, snapshot.Spell.Files, "dice.lua")
+	assert.Equal(t, "[REDACTED]", snapshot.Config.Env["LLMSPELL_TEST_TOKEN"])
+	assert.False(t, snapshot.Config.Now.IsZero(), "The start of the clock is recorded")
+
+	// Replaying runs the recorded spell with the recorded arguments and seed
+	opts := runOptions{}
+	spellPath, args := opts.replay(snapshotFile, "", nil)
+	assert.Equal(t, []string{"who=alice"}, args)
+	assert.True(t, snapshot.Config.Now.Equal(opts.Now), "A replay's clock is stopped at the recorded start")
+	replayed, _ := captureOutput(t, func() {
+		runSpell(spellPath, args, opts)
+	})
+	assert.Contains(t, replayed, "Replaying snapshot of run "+snapshot.RunID)
+	require.NotEmpty(t, rolls(recorded))
+	assert.Equal(t, rolls(recorded), rolls(replayed))
+	assert.NotContains(t, replayed, "changed since the snapshot")
+
+	// Edits to the spell are reported as warnings
+	require.NoError(t, os.WriteFile(spellFile, []byte(script+"\n"), 0644))
+	replayed, _ = captureOutput(t, func() {
+		runSpell(spellPath, args, opts)
+	})
+	assert.Contains(t, replayed, "[snapshot] dice.lua changed since the snapshot")
+}
+
+func TestExtractFlag(t *testing.T) {
+	args, value := extractFlag([]string{"--lang", "es", "run", "spell.lua", "--profile=strict"}, "profile")
+	assert.Equal(t, "strict", value)
+	assert.Equal(t, []string{"--lang", "es", "run", "spell.lua"}, args)
+
+	args, value = extractFlag(args, "lang")
+	assert.Equal(t, "es", value)
+	assert.Equal(t, []string{"run", "spell.lua"}, args)
+
+	args, value = extractFlag(args, "lang")
+	assert.Empty(t, value)
+	assert.Equal(t, []string{"run", "spell.lua"}, args)
+}
+
 func TestMainCommands(t *testing.T) {
 	// Save original os.Args
 	oldArgs := os.Args
@@ -554,3 +1475,811 @@ ANOTHER_VAR=another_value`
 	os.Unsetenv("TEST_VAR")
 	os.Unsetenv("ANOTHER_VAR")
 }
+
+// BenchmarkColdStart measures creating an engine, registering the standard
+// library and bridges, and running a spell that uses no bridge
+func BenchmarkColdStart(b *testing.B) {
+	os.Setenv("MOCK_LLM", "true")
+	defer os.Unsetenv("MOCK_LLM")
+
+	devNull, err := os.Open(os.DevNull)
+	require.NoError(b, err)
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	for i := 0; i < b.N; i++ {
+		eng, err := lua.NewLuaEngine(&engine.Config{MaxExecutionTime: 30, MaxMemory: 64 * 1024 * 1024})
+		require.NoError(b, err)
+		initializeBridges(eng, "bench", nil, nil, "", stdlib.AssertRaise)
+		require.NoError(b, eng.LoadScript(strings.NewReader(`local answer = 6 * 7`)))
+		require.NoError(b, eng.Execute(context.Background()))
+		eng.Close()
+	}
+}
+
+func TestServe(t *testing.T) {
+	t.Setenv("MOCK_LLM", "true")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello.lua"), []byte(`print("hello from " .. params.who)`), 0644))
+
+	// Privileges stay as they are so the children can run the test binary
+	profile := security.Profile{Name: "standard", Isolation: &security.Isolation{OpenFiles: 128, Seccomp: true}}
+	spells := newSpellServer(runOptions{Profile: profile, CallTimeout: time.Minute}, dir, "serve-token")
+	server := httptest.NewServer(spells.handler())
+	defer server.Close()
+	defer spells.shutdown()
+	client := &http.Client{Transport: bearerTransport("serve-token")}
+
+	submit := func(req runRequest) (*http.Response, runStatus) {
+		body, err := json.Marshal(req)
+		require.NoError(t, err)
+		resp, err := client.Post(server.URL+"/runs", "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var status runStatus
+		_ = json.NewDecoder(resp.Body).Decode(&status)
+		return resp, status
+	}
+	output := func(id string) string {
+		resp, err := client.Get(server.URL + "/runs/" + id + "/output")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(data)
+	}
+	status := func(id string) runStatus {
+		resp, err := client.Get(server.URL + "/runs/" + id)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var status runStatus
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		return status
+	}
+
+	t.Run("spell by path", func(t *testing.T) {
+		resp, run := submit(runRequest{Spell: "hello.lua", Params: map[string]string{"who": "the server"}})
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, "/runs/"+run.ID, resp.Header.Get("Location"))
+
+		// The output is followed until the run ends
+		assert.Contains(t, output(run.ID), "hello from the server")
+
+		done := status(run.ID)
+		assert.Equal(t, runSucceeded, done.Status)
+		require.NotNil(t, done.Summary)
+		assert.True(t, done.Summary.Isolated)
+		assert.Equal(t, 0, *done.ExitCode)
+	})
+
+	t.Run("source", func(t *testing.T) {
+		resp, run := submit(runRequest{Source: `error("broken spell")`})
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Contains(t, output(run.ID), "broken spell")
+		assert.Equal(t, runFailed, status(run.ID).Status)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		resp, run := submit(runRequest{Source: `while true do end`})
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/runs/"+run.ID, nil)
+		require.NoError(t, err)
+		cancelResp, err := client.Do(req)
+		require.NoError(t, err)
+		cancelResp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, cancelResp.StatusCode)
+
+		output(run.ID)
+		done := status(run.ID)
+		assert.Equal(t, runCancelled, done.Status)
+		assert.Equal(t, "interrupt", done.Reason)
+	})
+
+	t.Run("state events", func(t *testing.T) {
+		resp, run := submit(runRequest{Source: `
+			state.set("step", 1)
+			state.set("step", 2)
+			spell.eval("state.set('done', true)")
+			state.delete("step")`})
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/runs/" + run.ID + "/events?access_token=serve-token"
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// Whenever the client joins, the snapshot and the changes after it
+		// add up to the final state
+		var snapshot stateSnapshot
+		require.NoError(t, conn.ReadJSON(&snapshot))
+		assert.Equal(t, stateSnapshotMessage, snapshot.Type)
+		assert.Equal(t, run.ID, snapshot.Run)
+		values, seq := snapshot.Values, snapshot.Seq
+		for {
+			var changed stateChanged
+			if err := conn.ReadJSON(&changed); err != nil {
+				assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "%v", err)
+				break
+			}
+			assert.Equal(t, stateChangedMessage, changed.Type)
+			assert.Greater(t, changed.Event.Seq, seq)
+			seq = changed.Event.Seq
+			if changed.Event.Op == bridge.StateDelete {
+				delete(values, changed.Event.Key)
+			} else {
+				values[changed.Event.Key] = changed.Event.Value
+			}
+		}
+		assert.Equal(t, map[string]interface{}{"done": true}, values)
+		assert.Equal(t, uint64(4), seq)
+		assert.Equal(t, runSucceeded, status(run.ID).Status)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		_, run := submit(runRequest{Source: `while true do end`, Timeout: "200ms"})
+		output(run.ID)
+		done := status(run.ID)
+		assert.Equal(t, runCancelled, done.Status)
+		assert.Equal(t, "deadline", done.Reason)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		for _, req := range []runRequest{
+			{},
+			{Spell: "../hello.lua"},
+			{Spell: "/etc/passwd"},
+			{Spell: "missing.lua"},
+			{Spell: "hello.lua", Source: "print(1)"},
+			{Source: "print(1)", Engine: "cobol"},
+			{Spell: "hello.lua", Timeout: "soon"},
+		} {
+			resp, _ := submit(req)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "%+v", req)
+		}
+
+		resp, err := client.Get(server.URL + "/runs/unknown")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("guarded", func(t *testing.T) {
+		body := strings.NewReader(`{"source": "print(1)"}`)
+
+		// Without the token
+		resp, err := http.Post(server.URL+"/runs", "application/json", body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "Bearer")
+
+		// A cross-origin form or no-cors fetch cannot send JSON
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/runs", body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set("Origin", "https://evil.example")
+		resp, err = client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+		// A rebound domain still names itself in the Host header
+		req, err = http.NewRequest(http.MethodGet, server.URL+"/runs", nil)
+		require.NoError(t, err)
+		req.Host = "evil.example:8080"
+		resp, err = client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMisdirectedRequest, resp.StatusCode)
+
+		for host, allowed := range map[string]bool{
+			"localhost:8080": true, "127.0.0.1": true, "[::1]:8080": true, "10.0.0.5:8080": true,
+			"spells.internal:8080": false, "spells.internal.": false, "evil.example": false,
+		} {
+			assert.Equal(t, allowed, spells.allowedHost(host), host)
+		}
+		spells.host = "spells.internal"
+		assert.True(t, spells.allowedHost("spells.internal.:8080"))
+		spells.host = ""
+	})
+
+	resp, err := client.Get(server.URL + "/runs")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var runs []runStatus
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&runs))
+	assert.Len(t, runs, 5)
+}
+
+func TestServeEvictsFinishedRuns(t *testing.T) {
+	spells := newSpellServer(runOptions{}, t.TempDir(), "")
+	spells.keep, spells.retention = 2, time.Hour
+	now := time.Now()
+	add := func(id string, finishedAgo time.Duration, running bool) {
+		run := &serverRun{output: newRunOutput(), events: newRunEvents(), status: runStatus{ID: id, Status: runSucceeded, Started: now.Add(-2 * time.Hour)}}
+		if running {
+			run.status.Status = runRunning
+		} else {
+			finished := now.Add(-finishedAgo)
+			run.status.Finished = &finished
+		}
+		spells.runs[id] = run
+	}
+	add("running", 0, true)
+	add("expired", 2*time.Hour, false)
+	add("oldest", 30*time.Minute, false)
+	add("older", 20*time.Minute, false)
+	add("newest", time.Minute, false)
+
+	server := httptest.NewServer(spells.handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/runs")
+	require.NoError(t, err)
+	var statuses []runStatus
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&statuses))
+	resp.Body.Close()
+
+	var ids []string
+	for _, status := range statuses {
+		ids = append(ids, status.ID)
+	}
+	assert.ElementsMatch(t, []string{"running", "older", "newest"}, ids, "Expected expired runs and those beyond the limit to be forgotten")
+	resp, err = http.Get(server.URL + "/runs/oldest/output")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServeSourceDroppingPrivileges(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("only root drops privileges")
+	}
+	t.Setenv("MOCK_LLM", "true")
+
+	// The children run as nobody, so they need a copy of the test binary
+	// outside the build's private directory
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	data, err := os.ReadFile(exe)
+	require.NoError(t, err)
+	dir, err := os.MkdirTemp("", "llmspell-serve-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Chmod(dir, 0755))
+	copied := filepath.Join(dir, "llmspell.test")
+	require.NoError(t, os.WriteFile(copied, data, 0755))
+	defer func(original func() (string, error)) { executable = original }(executable)
+	executable = func() (string, error) { return copied, nil }
+
+	profile := security.Profile{Name: "standard", Isolation: &security.Isolation{DropPrivileges: true}}
+	spells := newSpellServer(runOptions{Profile: profile, CallTimeout: time.Minute}, dir, "")
+	defer spells.shutdown()
+
+	run, err := spells.start(runRequest{Source: `print("running as nobody")`})
+	require.NoError(t, err)
+	<-run.done
+	status := run.snapshot()
+	assert.Equal(t, runSucceeded, status.Status, string(run.output.data))
+	assert.Contains(t, string(run.output.data), "running as nobody")
+}
+
+// bearerTransport adds a bearer token to each request
+type bearerTransport string
+
+func (t bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+string(t))
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestMCPServe(t *testing.T) {
+	t.Setenv("MOCK_LLM", "true")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello.lua"), []byte(`print("hello from " .. params.who)`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.lua"), []byte(`error("broken spell")`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a spell"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "greeter"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "greeter", "main.lua"), []byte(`print(params.greeting .. ", " .. params.name)`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "greeter", "spell.yaml"), []byte(`
+name: greeter
+description: Greets someone
+parameters:
+  name:
+    type: string
+    description: Who to greet
+    required: true
+  greeting:
+    type: string
+    default: Hello
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tools.lua"), []byte(`
+		tools.register("shout", "Shout text", {type = "object", properties = {text = {type = "string"}}}, function(params)
+			return params.text:upper()
+		end)
+		tools.register("hello", "Clashes with the hello spell", {type = "object"}, function() return "tool" end)
+	`), 0644))
+
+	// Privileges stay as they are so the children can run the test binary
+	profile := security.Profile{Name: "standard", Isolation: &security.Isolation{OpenFiles: 128, Seccomp: true}}
+	server, err := newMCPServer(dir, runOptions{Profile: profile, CallTimeout: time.Minute})
+	require.NoError(t, err)
+	defer server.Close()
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	go server.Serve(context.Background(), serverR, serverW)
+	ctx := context.Background()
+	client := mcp.NewClient(mcp.NewStdioTransport(clientR, clientW, clientW.Close))
+	defer client.Close()
+	require.NoError(t, client.Initialize(ctx))
+
+	served, err := client.ListTools(ctx)
+	require.NoError(t, err)
+	offered := map[string]mcp.Tool{}
+	for _, tool := range served {
+		offered[tool.Name] = tool
+	}
+	for _, name := range []string{"hello", "broken", "greeter", "shout", "web_fetch"} {
+		assert.Contains(t, offered, name)
+	}
+	assert.NotContains(t, offered, "notes")
+	assert.NotContains(t, offered, "tools")
+	assert.Equal(t, "Greets someone", offered["greeter"].Description)
+	assert.JSONEq(t, `{"type":"object","required":["name"],"properties":{
+		"name":{"type":"string","description":"Who to greet"},
+		"greeting":{"type":"string","default":"Hello"}}}`, string(offered["greeter"].InputSchema))
+
+	call := func(name string, arguments map[string]interface{}) *mcp.ToolResult {
+		result, err := client.CallTool(ctx, name, arguments)
+		require.NoError(t, err)
+		return result
+	}
+
+	result := call("hello", map[string]interface{}{"who": "a host"})
+	assert.False(t, result.IsError)
+	assert.Equal(t, "hello from a host", result.Text(), "The spell's output without the run's framing")
+	assert.Equal(t, "Hello, Ada", call("greeter", map[string]interface{}{"name": "Ada"}).Text())
+	assert.True(t, call("greeter", nil).IsError, "A required parameter is missing")
+
+	result = call("broken", nil)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Text(), "broken spell")
+
+	assert.Equal(t, "HEY", call("shout", map[string]interface{}{"text": "hey"}).Text())
+
+	t.Run("strict profile", func(t *testing.T) {
+		strict, err := security.LookupProfile("strict")
+		require.NoError(t, err)
+		server, err := newMCPServer(dir, runOptions{Profile: strict})
+		require.NoError(t, err)
+		defer server.Close()
+		assert.Equal(t, 3, server.spells)
+		assert.Equal(t, 0, server.tools, "Strict spells cannot run tools, so none are offered")
+	})
+}
+
+func TestDaemon(t *testing.T) {
+	t.Setenv("MOCK_LLM", "true")
+
+	dir := t.TempDir()
+	hello := filepath.Join(dir, "hello.lua")
+	require.NoError(t, os.WriteFile(hello, []byte(`print("hello from " .. params.who)`), 0644))
+	loop := filepath.Join(dir, "loop.lua")
+	require.NoError(t, os.WriteFile(loop, []byte(`while true do end`), 0644))
+
+	socket := filepath.Join(dir, "d.sock")
+	l, err := listenSocket(socket)
+	require.NoError(t, err)
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Zero(t, info.Mode().Perm()&0077, "Only the daemon's user may connect")
+
+	_, err = listenSocket(socket)
+	assert.Error(t, err, "A second daemon must not take over the socket")
+
+	// Privileges stay as they are so the workers can run the test binary
+	profile := security.Profile{Name: "standard", Isolation: &security.Isolation{OpenFiles: 128, Seccomp: true}}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := newSpellDaemon(ctx, runOptions{Profile: profile, CallTimeout: time.Minute}, 1)
+	served := make(chan error, 1)
+	go func() { served <- d.serve(l) }()
+
+	submit := func(job daemonJob) (string, *runStatus, error) {
+		conn, err := net.Dial("unix", socket)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, json.NewEncoder(conn).Encode(job))
+		var out strings.Builder
+		status, err := followJob(conn, &out)
+		return out.String(), status, err
+	}
+
+	out, status, err := submit(daemonJob{Spell: hello, Args: []string{"who=a worker"}})
+	require.NoError(t, err)
+	assert.Contains(t, out, "hello from a worker")
+	assert.Equal(t, runSucceeded, status.Status)
+	require.NotNil(t, status.Summary)
+	assert.True(t, status.Summary.Isolated)
+
+	// One worker runs the jobs in turn, each stopped by its own timeout
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, status, err := submit(daemonJob{Spell: loop, Timeout: 200 * time.Millisecond})
+			if assert.NoError(t, err) {
+				assert.Equal(t, runCancelled, status.Status)
+				assert.Equal(t, "deadline", status.Reason)
+				assert.Equal(t, engine.ExitDeadline, *status.ExitCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, _, err = submit(daemonJob{Spell: "hello.lua"})
+	assert.ErrorContains(t, err, "not an absolute path")
+
+	cancel()
+	require.NoError(t, <-served)
+	d.wait()
+}
+
+func TestStateExportImport(t *testing.T) {
+	t.Setenv("LLMSPELL_STATE_STORE", "")
+	t.Setenv("LLMSPELL_STATE_DIR", t.TempDir())
+	store := newStateStore()
+	state := bridge.NewSharedState()
+	require.NoError(t, state.Set("topic", "tides"))
+	_, err := store.Persist("crawl", state)
+	require.NoError(t, err)
+
+	backup := filepath.Join(t.TempDir(), "crawl.yaml")
+	require.NoError(t, exportState(store, "crawl", 0, backup, ""))
+	data, err := os.ReadFile(backup)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "topic: tides", "The extension should pick YAML")
+	assert.Error(t, exportState(store, "missing", 0, backup, ""))
+
+	name, version, err := importState(store, backup, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "crawl", name)
+	assert.Equal(t, 2, version)
+
+	name, version, err = importState(store, backup, "handoff", "")
+	require.NoError(t, err)
+	assert.Equal(t, "handoff", name)
+	values, _, err := store.Values(name, version)
+	require.NoError(t, err)
+	assert.Equal(t, "tides", values["topic"])
+}
+
+func TestCacheCommand(t *testing.T) {
+	t.Setenv("LLMSPELL_LLM_CACHE", t.TempDir())
+	store, err := newResponseStore()
+	require.NoError(t, err)
+	cache := bridge.NewResponseCache(store, nil)
+	require.NoError(t, cache.Enable(0))
+	require.NoError(t, cache.Put(bridge.CachedResponse{
+		Key:      "abc123",
+		Method:   "chat",
+		Model:    "openai/gpt-4o-mini",
+		Prompt:   "Summarize\nthe tides report " + strings.Repeat("in detail ", 10),
+		Response: "Tides rise.",
+	}))
+
+	stdout, _ := captureOutput(t, func() { runCacheCommand([]string{"list"}, "") })
+	assert.Contains(t, stdout, "openai/gpt-4o-mini")
+	assert.Contains(t, stdout, "Summarize the tides report in detail", "Prompts are shown on one line")
+	assert.Contains(t, stdout, "...")
+	assert.Contains(t, stdout, "1 cached responses")
+
+	stdout, _ = captureOutput(t, func() { runCacheCommand([]string{"list"}, "json") })
+	var entries []bridge.CachedResponse
+	require.NoError(t, json.Unmarshal([]byte(stdout), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "Tides rise.", entries[0].Response)
+
+	stdout, _ = captureOutput(t, func() { runCacheCommand([]string{"purge"}, "") })
+	assert.Contains(t, stdout, "Deleted 1 cached responses")
+	remaining, err := cache.Entries()
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+}
+
+func TestMetricsCommand(t *testing.T) {
+	t.Setenv("LLMSPELL_METRICS", filepath.Join(t.TempDir(), "metrics.db"))
+	t.Setenv("MOCK_LLM", "true")
+
+	stdout, _ := captureOutput(t, func() { runMetricsCommand([]string{"tools"}, "") })
+	assert.Contains(t, stdout, "No tool runs recorded")
+
+	spellFile := filepath.Join(t.TempDir(), "shout.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		tools.register("shout", "Shouts text", {type = "object"}, function(params)
+			if params.text == "" then
+				error("nothing to shout")
+			end
+			return params.text:upper()
+		end)
+		tools.execute("shout", {text = "hi"})
+		tools.execute("shout", {text = "there"})
+		tools.execute("shout", {text = ""})
+	`), 0644))
+	captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{}) })
+	captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{}) })
+
+	stdout, _ = captureOutput(t, func() { runMetricsCommand([]string{"tools", "--window", "1d"}, "") })
+	assert.Contains(t, stdout, "Tool usage from")
+	assert.Regexp(t, `shout\s+2\s+6\s+33\.3%`, stdout)
+	assert.Contains(t, stdout, "new")
+
+	stdout, _ = captureOutput(t, func() { runMetricsCommand([]string{"tools"}, "json") })
+	var report bridge.ToolReport
+	require.NoError(t, json.Unmarshal([]byte(stdout), &report))
+	require.Len(t, report.Tools, 1)
+	assert.Equal(t, "shout", report.Tools[0].Tool)
+	assert.Equal(t, 2, report.Tools[0].Failures)
+
+	window, err := parseWindow("7d")
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, window)
+	for _, bad := range []string{"0d", "-2h", "week"} {
+		_, err := parseWindow(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRunSpellConfirmation(t *testing.T) {
+	t.Setenv("MOCK_LLM", "true")
+	spellFile := filepath.Join(t.TempDir(), "wipe.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		tools.register("wipe", "Wipes the scratch directory", {}, function() return "wiped" end, {confirm = true})
+		local result, err = tools.execute("wipe", {})
+		print("result: " .. tostring(result))
+		print("error: " .. tostring(err))
+	`), 0644))
+
+	// Tests have no terminal to ask on
+	stdout, _ := captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{}) })
+	assert.Contains(t, stdout, "result: nil")
+	assert.Contains(t, stdout, "no terminal to ask")
+
+	profile := security.Profile{Confirmation: security.ConfirmationPolicy{Allow: []string{"wipe"}}}
+	stdout, _ = captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{Profile: profile}) })
+	assert.Contains(t, stdout, "result: wiped")
+}
+
+func TestRunSpellHTTPPolicy(t *testing.T) {
+	t.Setenv("MOCK_LLM", "true")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "reached "+r.URL.Path)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	profileFile := filepath.Join(dir, "team.json")
+	require.NoError(t, os.WriteFile(profileFile, []byte(fmt.Sprintf(`{"http": {"allow": [%q]}}`, server.URL+"/public/")), 0644))
+	spellFile := filepath.Join(dir, "fetch.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(fmt.Sprintf(`
+		print(http.get(%q))
+		print(http.get(%q))
+	`, server.URL+"/public/a", server.URL+"/private/b")), 0644))
+
+	profile := loadProfile(profileFile)
+	assert.Equal(t, "team", profile.Name)
+	stdout, _ := captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{Profile: profile}) })
+	assert.Contains(t, stdout, "reached /public/a")
+	assert.NotContains(t, stdout, "reached /private/b")
+	assert.Contains(t, stdout, "not in the security profile's allowlist")
+}
+
+func TestRunSpellFSPolicy(t *testing.T) {
+	t.Setenv("MOCK_LLM", "true")
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "input.txt"), []byte("hello"), 0644))
+	spellFile := filepath.Join(t.TempDir(), "files.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		print("read: " .. tostring(fs.read("work:input.txt")))
+		print("write: " .. tostring(select(2, fs.write("work:output.txt", "done"))))
+		print("temp: " .. tostring(fs.write(fs.temp_file(), "scratch")))
+	`), 0644))
+
+	profile := security.Profile{FS: security.FSPolicy{
+		Roots: []security.FSRoot{{Name: "work", Path: dir, ReadOnly: true}},
+	}}
+	stdout, _ := captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{Profile: profile}) })
+	assert.Contains(t, stdout, "read: hello")
+	assert.Contains(t, stdout, "write: access denied: work:output.txt is read-only")
+	assert.Contains(t, stdout, "temp: true")
+	assert.NoFileExists(t, filepath.Join(dir, "output.txt"))
+}
+
+func TestRunSpellDatabase(t *testing.T) {
+	t.Setenv("MOCK_LLM", "true")
+	spellFile := filepath.Join(t.TempDir(), "db.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		local conn, err = db.open("sqlite", ":memory:")
+		if not conn then
+			print("open: " .. err)
+			return
+		end
+		conn:exec("CREATE TABLE notes (body TEXT)")
+		conn:exec("INSERT INTO notes (body) VALUES (?)", "remember")
+		print("note: " .. conn:query("SELECT body FROM notes")[1].body)
+	`), 0644))
+
+	standard, err := security.LookupProfile("standard")
+	require.NoError(t, err)
+	stdout, _ := captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{Profile: standard}) })
+	assert.Contains(t, stdout, "note: remember")
+
+	stdout, _ = captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{Profile: security.Profile{}}) })
+	assert.Contains(t, stdout, "does not grant the database permission")
+}
+
+func TestRunSpellExec(t *testing.T) {
+	t.Setenv("MOCK_LLM", "true")
+	spellFile := filepath.Join(t.TempDir(), "exec.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		local result, err = exec.run("echo", {text = "from a command"})
+		if not result then
+			print("exec: " .. err)
+			return
+		end
+		print("output: " .. result.stdout)
+	`), 0644))
+
+	// The operator allowlists the command in a profile that grants exec
+	profile, err := security.LookupProfile("standard")
+	require.NoError(t, err)
+	profile.Exec = security.ExecPolicy{Commands: map[string]security.ExecCommand{
+		"echo": {Path: "echo", Args: []string{"{{text}}"}},
+	}}
+	stdout, _ := captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{Profile: profile}) })
+	assert.Contains(t, stdout, "output: from a command")
+
+	stdout, _ = captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{Profile: security.Profile{Exec: profile.Exec}}) })
+	assert.Contains(t, stdout, "does not grant the exec permission")
+
+	// The sandbox profile does not even allow the call
+	strict, err := security.LookupProfile("strict")
+	require.NoError(t, err)
+	strict.Exec = profile.Exec
+	stdout, _ = captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{Profile: strict}) })
+	assert.Contains(t, stdout, "exec.run is not allowed")
+}
+
+func TestRunSpellSecrets(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		fmt.Fprint(w, "welcome")
+	}))
+	defer server.Close()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("MOCK_LLM", "true")
+	t.Setenv("LLMSPELL_SECRETS_FILE", filepath.Join(home, "secrets.enc"))
+	t.Setenv("LLMSPELL_SECRETS_KEY", "passphrase")
+
+	// The operator stores the token in the encrypted file and names it
+	stdout, _ := captureOutput(t, func() { runSecretsCommand([]string{"set", "api"}, strings.NewReader("t0ken\n")) })
+	assert.Contains(t, stdout, "Saved api")
+	stdout, _ = captureOutput(t, func() { runSecretsCommand([]string{"list"}, nil) })
+	assert.Contains(t, stdout, "api\n1 entries")
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".llmspell"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".llmspell", "secrets.json"),
+		[]byte(`{"secrets": {"api": {"value": "file:api", "hosts": ["127.0.0.1"]}}}`), 0600))
+
+	spellFile := filepath.Join(t.TempDir(), "secrets.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		local token = secrets.get("api")
+		print("handle: " .. tostring(token) .. " " .. json.encode({token = token}))
+		print("reply: " .. http.get("`+server.URL+`", {headers = {Authorization = token:format("Bearer %s")}}))
+		print("elsewhere: " .. select(2, http.get("http://localhost:1", {headers = {Authorization = token}})))
+	`), 0644))
+
+	stdout, _ = captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{}) })
+	assert.Contains(t, stdout, `handle: secret(api) {"token":null}`)
+	assert.Contains(t, stdout, "reply: welcome")
+	assert.Contains(t, stdout, `elsewhere: secret "api" may not be sent to localhost`)
+	assert.NotContains(t, stdout, "t0ken")
+	assert.Equal(t, "Bearer t0ken", auth)
+
+	stdout, _ = captureOutput(t, func() { runSecretsCommand([]string{"delete", "api"}, nil) })
+	assert.Contains(t, stdout, "Deleted api")
+}
+
+func TestRunSpellReportPDF(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Fake converter is a shell script")
+	}
+	t.Setenv("MOCK_LLM", "true")
+
+	// A fake wkhtmltopdf that copies its input HTML to the output path
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "wkhtmltopdf"),
+		[]byte("#!/bin/sh\nfor a; do in=$out; out=$a; done\n/bin/cp \"$in\" \"$out\"\n"), 0755))
+	t.Setenv("PATH", bin)
+
+	spellFile := filepath.Join(t.TempDir(), "report.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		local pdf, err = report.pdf({title = "Quarterly"})
+		print("pdf: " .. tostring(pdf and pdf:find("<h1>Quarterly</h1>", 1, true) ~= nil) .. " " .. tostring(err))
+	`), 0644))
+
+	stdout, _ := captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{}) })
+	assert.Contains(t, stdout, "pdf: true nil")
+}
+
+func TestRunSpellNotify(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, r.URL.Path+" "+string(body))
+	}))
+	defer server.Close()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("MOCK_LLM", "true")
+	t.Setenv("TEAM_HOOK", server.URL+"/hooks/t0ken")
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".llmspell"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".llmspell", "secrets.json"), []byte(`{"secrets": {
+		"team_hook": {"value": "env:TEAM_HOOK", "hosts": ["127.0.0.1"]},
+		"other_hook": {"value": "env:TEAM_HOOK", "hosts": ["hooks.slack.com"]}
+	}}`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".llmspell", "notify.json"), []byte(`{"channels": {
+		"team": {"type": "slack", "url": "secret:team_hook"},
+		"elsewhere": {"type": "webhook", "url": "secret:other_hook"}
+	}}`), 0600))
+
+	spellFile := filepath.Join(t.TempDir(), "notify.lua")
+	require.NoError(t, os.WriteFile(spellFile, []byte(`
+		print("channels: " .. table.concat(notify.channels(), ","))
+		print("sent: " .. tostring(notify.send("team", {subject = "Report", body = "All done"})))
+		print("elsewhere: " .. select(2, notify.send("elsewhere", {body = "x"})))
+	`), 0644))
+
+	stdout, _ := captureOutput(t, func() { runSpell(spellFile, []string{}, runOptions{}) })
+	assert.Contains(t, stdout, "channels: elsewhere,team")
+	assert.Contains(t, stdout, "sent: true")
+	assert.Contains(t, stdout, "elsewhere: notify channel elsewhere: the channel's secret may not be sent to 127.0.0.1")
+	assert.NotContains(t, stdout, "t0ken")
+	require.Len(t, received, 1, "Only the channel whose secret allows the host is sent to")
+	assert.Equal(t, `/hooks/t0ken {"text":"*Report*\nAll done"}`, received[0])
+}
+
+func TestPrompter(t *testing.T) {
+	var out strings.Builder
+	prompt := newPrompter(strings.NewReader("y\nmaybe\nAlways\n"), &out)
+	ctx := context.Background()
+	for _, want := range []security.Answer{security.AnswerYes, security.AnswerNo, security.AnswerAlways} {
+		answer, err := prompt(ctx, "wipe", map[string]interface{}{"dir": "/tmp/scratch"})
+		require.NoError(t, err)
+		assert.Equal(t, want, answer)
+	}
+	assert.Contains(t, out.String(), `The spell wants to run wipe with {"dir":"/tmp/scratch"}`)
+
+	_, err := prompt(ctx, "wipe", nil)
+	assert.ErrorIs(t, err, io.EOF, "Without more input the call is declined")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = newPrompter(blockingReader{}, io.Discard)(cancelled, "wipe", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// blockingReader never returns, like a terminal no one answers
+type blockingReader struct{}
+
+func (blockingReader) Read([]byte) (int, error) {
+	select {}
+}
@@ -0,0 +1,410 @@
+// ABOUTME: llmspell mcp-serve: offers a directory's spells and tools to MCP hosts, such as Claude Desktop, over stdio
+// ABOUTME: Spells run as isolated children; tools are the built-in tools and those the directory's tools.lua registers
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+	"github.com/lexlapax/go-llmspell/pkg/mcp"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+	"gopkg.in/yaml.v3"
+)
+
+// mcpToolsScript is the script of a served directory that registers the
+// tools offered alongside its spells. It is not offered as a spell itself.
+const mcpToolsScript = "tools.lua"
+
+// spellManifest is the part of a spell's spell.yaml that describes it to
+// MCP hosts
+type spellManifest struct {
+	Description string                    `yaml:"description"`
+	Parameters  map[string]spellParameter `yaml:"parameters"`
+}
+
+// spellParameter is a parameter a spell declares in its spell.yaml
+type spellParameter struct {
+	Type        string      `yaml:"type"`
+	Description string      `yaml:"description"`
+	Required    bool        `yaml:"required"`
+	Default     interface{} `yaml:"default"`
+}
+
+// servedSpell is a spell offered to MCP hosts as a tool
+type servedSpell struct {
+	name     string
+	path     string
+	manifest spellManifest
+}
+
+// findSpells lists the spells in dir: directories with a main script, and
+// scripts other than tools.lua. A spell directory's spell.yaml describes
+// the spell; one that cannot be read is logged and ignored.
+func findSpells(dir string) ([]servedSpell, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var spells []servedSpell
+	for _, entry := range entries {
+		name, path := entry.Name(), filepath.Join(dir, entry.Name())
+		if strings.HasPrefix(name, ".") || name == mcpToolsScript {
+			continue
+		}
+		spell := servedSpell{name: mcpToolName(name), path: path}
+		if entry.IsDir() {
+			if _, err := os.Stat(findMainScript(path)); err != nil {
+				continue
+			}
+			if data, err := os.ReadFile(filepath.Join(path, "spell.yaml")); err == nil {
+				if err := yaml.Unmarshal(data, &spell.manifest); err != nil {
+					log.Printf("Warning: ignoring %s: %v", filepath.Join(path, "spell.yaml"), err)
+				}
+			}
+		} else {
+			if _, err := engine.DiscoverEngineByExtension(filepath.Ext(name)); err != nil {
+				continue
+			}
+			spell.name = mcpToolName(strings.TrimSuffix(name, filepath.Ext(name)))
+		}
+		spells = append(spells, spell)
+	}
+	return spells, nil
+}
+
+// mcpToolName turns a spell's name into a tool name, which MCP hosts
+// accept when it is at most 64 letters, digits, '_' and '-'
+func mcpToolName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// tool describes the spell to MCP hosts, with the parameters its
+// spell.yaml declares
+func (s servedSpell) tool() mcp.Tool {
+	description := s.manifest.Description
+	if description == "" {
+		description = fmt.Sprintf("Run the %s spell", s.name)
+	}
+
+	properties := map[string]interface{}{}
+	required := []string{}
+	for name, param := range s.manifest.Parameters {
+		property := map[string]interface{}{"type": schemaType(param.Type)}
+		if param.Description != "" {
+			property["description"] = param.Description
+		}
+		if param.Default != nil {
+			property["default"] = param.Default
+		}
+		properties[name] = property
+		if param.Required {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	data, _ := json.Marshal(schema)
+	return mcp.Tool{Name: s.name, Description: description, InputSchema: data}
+}
+
+// schemaType maps a spell.yaml parameter type to a JSON schema type;
+// unknown types are strings, as spells receive them
+func schemaType(t string) string {
+	switch t {
+	case "string", "number", "integer", "boolean", "array", "object":
+		return t
+	}
+	return "string"
+}
+
+// args turns the arguments of a call into the spell's key=value
+// arguments, filling in the defaults of its spell.yaml
+func (s servedSpell) args(arguments map[string]interface{}) ([]string, error) {
+	values := make(map[string]interface{}, len(arguments))
+	for name, param := range s.manifest.Parameters {
+		if param.Default != nil {
+			values[name] = param.Default
+		}
+	}
+	for name, value := range arguments {
+		values[name] = value
+	}
+	for name, param := range s.manifest.Parameters {
+		if _, ok := values[name]; param.Required && !ok {
+			return nil, fmt.Errorf("parameter %q is required", name)
+		}
+	}
+
+	args := make([]string, 0, len(values))
+	for name, value := range values {
+		var text string
+		switch v := value.(type) {
+		case string:
+			text = v
+		case float64:
+			text = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool, int:
+			text = fmt.Sprint(v)
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %q: %w", name, err)
+			}
+			text = string(data)
+		}
+		args = append(args, name+"="+text)
+	}
+	return args, nil
+}
+
+// spellOutput returns what a spell printed, without the lines runSpell
+// frames it with. A failed spell's output ends with its error.
+func spellOutput(output string) string {
+	if _, rest, ok := strings.Cut(output, "=== Spell Output ===\n"); ok {
+		output = rest
+	}
+	if before, _, ok := strings.Cut(output, "\n=== Spell Complete ==="); ok {
+		output = before
+	}
+	return strings.TrimSpace(output)
+}
+
+// mcpServer offers spells and tools to MCP hosts. Spells run in isolated
+// children under opts, as many at once as llmspell serve runs.
+type mcpServer struct {
+	*mcp.Server
+	opts  runOptions
+	slots chan struct{}
+
+	// spells and tools count what is offered
+	spells, tools int
+
+	// eng runs tools.lua, whose tools share its Lua state and so run one
+	// at a time under luaMu
+	eng   *lua.LuaEngine
+	luaMu sync.Mutex
+
+	// plugins provide tools alongside the built-in ones
+	plugins *bridge.Plugins
+}
+
+// newMCPServer offers the spells in dir and, when the security profile
+// lets spells run tools, the built-in tools and those dir's tools.lua
+// registers. Spells win over tools of the same name.
+func newMCPServer(dir string, opts runOptions) (*mcpServer, error) {
+	spells, err := findSpells(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &mcpServer{
+		Server: mcp.NewServer("llmspell", "0.1.0"),
+		opts:   opts,
+		slots:  make(chan struct{}, maxServerRuns),
+	}
+	taken := make(map[string]bool, len(spells))
+	for _, spell := range spells {
+		spell := spell
+		taken[spell.name] = true
+		s.spells++
+		s.AddTool(spell.tool(), func(ctx context.Context, arguments map[string]interface{}) (*mcp.ToolResult, error) {
+			return s.runSpell(ctx, spell, arguments)
+		})
+	}
+
+	if !opts.Profile.Methods.Allows("tools", "execute") {
+		return s, nil
+	}
+	toolBridge, err := s.loadTools(filepath.Join(dir, mcpToolsScript))
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	for _, info := range toolBridge.ListTools() {
+		name, _ := info["name"].(string)
+		if taken[name] {
+			log.Print(i18n.T("mcp_serve.tool_clash", name))
+			continue
+		}
+		description, _ := info["description"].(string)
+		schema, _ := json.Marshal(info["parameters"])
+		script := info["source"] == "script"
+		s.tools++
+		s.AddTool(mcp.Tool{Name: name, Description: description, InputSchema: schema},
+			func(ctx context.Context, arguments map[string]interface{}) (*mcp.ToolResult, error) {
+				return s.runTool(ctx, toolBridge, name, script, arguments)
+			})
+	}
+	return s, nil
+}
+
+// loadTools creates the tool bridge with the built-in tools, then runs
+// the tools script at path, if there is one, to register its tools
+func (s *mcpServer) loadTools(path string) (*bridge.ToolBridge, error) {
+	eng, err := lua.NewLuaEngine(spellConfig())
+	if err != nil {
+		return nil, err
+	}
+	s.eng = eng
+	sb := initializeBridges(eng, "tools", nil, nil, "", assertMode(s.opts.Profile))
+	sb.guard = security.NewToolGuard(s.opts.Profile.ToolLimits, s.opts.Profile.CircuitBreakers)
+	// Stdin carries the protocol, so there is no one to ask
+	sb.confirm = security.NewToolConfirmer(s.opts.Profile.Confirmation, nil)
+	s.plugins = loadPlugins(nil)
+	sb.plugins = s.plugins
+	toolBridge, err := sb.tools.Get(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if err := eng.LoadScriptFile(path); err != nil {
+			return nil, err
+		}
+		if err := eng.Execute(context.Background()); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return toolBridge.(*bridge.ToolBridge), nil
+}
+
+// runSpell runs a spell in an isolated child and returns what it printed.
+// A spell that fails returns its output as a failed result.
+func (s *mcpServer) runSpell(ctx context.Context, spell servedSpell, arguments map[string]interface{}) (*mcp.ToolResult, error) {
+	args, err := spell.args(arguments)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		return nil, errServerBusy
+	}
+
+	child, err := newIsolatedChild(ctx, append([]string{"run", spell.path}, args...), s.opts)
+	if err != nil {
+		return nil, err
+	}
+	var output bytes.Buffer
+	child.cmd.Stdout, child.cmd.Stderr = &output, &output
+	if err := child.start(); err != nil {
+		return nil, err
+	}
+
+	var status runStatus
+	status.finish(child.wait())
+	text := spellOutput(output.String())
+	if status.Status == runSucceeded {
+		return &mcp.ToolResult{Content: []mcp.Content{{Type: "text", Text: text}}}, nil
+	}
+	message := "spell " + status.Status
+	if status.Reason != "" {
+		message += " (" + status.Reason + ")"
+	}
+	if status.Error != "" {
+		message += ": " + status.Error
+	}
+	if text != "" {
+		message += "\n" + text
+	}
+	return nil, errors.New(message)
+}
+
+// runTool runs a tool of the tool bridge. Tools registered by the tools
+// script run one at a time, stopping when ctx is done.
+func (s *mcpServer) runTool(ctx context.Context, tb *bridge.ToolBridge, name string, script bool, arguments map[string]interface{}) (*mcp.ToolResult, error) {
+	if script {
+		s.luaMu.Lock()
+		defer s.luaMu.Unlock()
+		L := s.eng.GetLuaState()
+		L.SetContext(ctx)
+		defer L.RemoveContext()
+	}
+
+	value, err := tb.ExecuteTool(ctx, name, arguments)
+	if err != nil {
+		return nil, err
+	}
+	if text, ok := value.(string); ok {
+		return &mcp.ToolResult{Content: []mcp.Content{{Type: "text", Text: text}}}, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	result := &mcp.ToolResult{Content: []mcp.Content{{Type: "text", Text: string(data)}}}
+	if object, ok := value.(map[string]interface{}); ok {
+		result.StructuredContent = object
+	}
+	return result, nil
+}
+
+// Close releases the Lua state of the tools script and stops the plugins
+func (s *mcpServer) Close() {
+	if s.eng != nil {
+		s.eng.Close()
+	}
+	s.plugins.Close()
+}
+
+// runMCPServeCommand offers the spells and tools of a directory, the
+// working directory by default, to the MCP host that started llmspell,
+// until the host closes its input or llmspell is interrupted
+func runMCPServeCommand(args []string, opts runOptions) {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		fatalf("cli.error.mcp_serve", err)
+	}
+
+	// Messages to the host go to stdout, so anything else printed, such as
+	// the output of the tools script, goes to stderr
+	protocol := os.Stdout
+	os.Stdout = os.Stderr
+
+	server, err := newMCPServer(dir, opts)
+	if err != nil {
+		fatalf("cli.error.mcp_serve", err)
+	}
+	defer server.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Print(i18n.T("mcp_serve.ready", server.spells, server.tools, dir))
+	if err := server.Serve(ctx, os.Stdin, protocol); err != nil && !errors.Is(err, context.Canceled) {
+		fatalf("cli.error.mcp_serve", err)
+	}
+}
@@ -0,0 +1,173 @@
+// ABOUTME: Tool metrics kept across runs, and the metrics command that reports usage, trends, and anomalies
+// ABOUTME: Runs record their tool executions in LLMSPELL_METRICS, a SQLite file or "off", else ~/.llmspell/metrics.db
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+	"github.com/lexlapax/go-llmspell/pkg/statestore"
+)
+
+// metricsRetention is how long tool metrics are kept
+const metricsRetention = 90 * 24 * time.Hour
+
+// defaultMetricsWindow is the window metrics tools reports on
+const defaultMetricsWindow = 7 * 24 * time.Hour
+
+// newToolMetrics opens where runs record their tool metrics:
+// LLMSPELL_METRICS, a SQLite file, else ~/.llmspell/metrics.db. It returns
+// nil when LLMSPELL_METRICS is "off" or there is no home directory.
+func newToolMetrics() (*statestore.SQLiteToolMetrics, error) {
+	path := os.Getenv("LLMSPELL_METRICS")
+	switch path {
+	case "off":
+		return nil, nil
+	case "":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		dir := filepath.Join(home, ".llmspell")
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, "metrics.db")
+	}
+	return statestore.NewSQLiteToolMetrics(path)
+}
+
+// recordToolMetrics adds the tool executions of a finished run to the
+// metrics store and drops those past metricsRetention. Failures are
+// logged, as the run itself succeeded.
+func recordToolMetrics(summary runSummary) {
+	if len(summary.ToolExecutions) == 0 {
+		return
+	}
+	store, err := newToolMetrics()
+	if err != nil {
+		log.Print(i18n.T("cli.error.metrics", err))
+		return
+	}
+	if store == nil {
+		return
+	}
+	defer store.Close()
+
+	now := time.Now()
+	err = store.RecordToolRuns(bridge.ToolRunsOf(summary.RunID, summary.Spell, now, summary.ToolExecutions))
+	if err == nil {
+		_, err = store.PruneToolRuns(now.Add(-metricsRetention))
+	}
+	if err != nil {
+		log.Print(i18n.T("cli.error.metrics", err))
+	}
+}
+
+// runMetricsCommand handles metrics tools [--window 7d], which reports on
+// tool usage over the window and compares it with the window before; it
+// prints JSON with --output json
+func runMetricsCommand(args []string, output string) {
+	args, windowFlag := extractFlag(args, "window")
+	if len(args) != 1 || args[0] != "tools" {
+		fmt.Println(i18n.T("cli.usage.metrics_short"))
+		os.Exit(1)
+	}
+	window := defaultMetricsWindow
+	if windowFlag != "" {
+		var err error
+		if window, err = parseWindow(windowFlag); err != nil {
+			fatalf("cli.error.metrics_window", windowFlag, err)
+		}
+	}
+
+	store, err := newToolMetrics()
+	if err == nil && store == nil {
+		err = fmt.Errorf("metrics are not recorded; unset LLMSPELL_METRICS or set it to a file")
+	}
+	if err != nil {
+		fatalf("cli.error.metrics", err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	runs, err := store.ToolRuns(now.Add(-2 * window))
+	if err != nil {
+		fatalf("cli.error.metrics", err)
+	}
+	report := bridge.NewToolReport(runs, now, window)
+
+	if output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fatalf("cli.error.metrics", err)
+		}
+		return
+	}
+	printToolReport(report)
+}
+
+// parseWindow reads a window such as 7d, 12h, or 90m
+func parseWindow(value string) (time.Duration, error) {
+	var window time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if window, err = time.ParseDuration(value); err != nil {
+			return 0, err
+		}
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return window, nil
+}
+
+// printToolReport prints a report as a table of tools, with the change in
+// calls from the previous window, followed by its anomalies
+func printToolReport(report bridge.ToolReport) {
+	fmt.Println(i18n.T("cli.metrics.heading", report.From.Format("2006-01-02 15:04"), report.To.Format("2006-01-02 15:04")))
+	if len(report.Tools) == 0 {
+		fmt.Println(i18n.T("cli.metrics.none"))
+		return
+	}
+	fmt.Printf("%-24s %6s %8s %8s %10s %8s  %s\n", i18n.T("cli.metrics.tool"), i18n.T("cli.metrics.runs"), i18n.T("cli.metrics.calls"),
+		i18n.T("cli.metrics.failed"), i18n.T("cli.metrics.average"), i18n.T("cli.metrics.cached"), i18n.T("cli.metrics.trend"))
+	for _, tool := range report.Tools {
+		fmt.Printf("%-24s %6d %8d %7.1f%% %10s %8d  %s\n", tool.Tool, tool.Runs, tool.Calls, tool.FailureRate()*100,
+			tool.AverageDuration().Round(time.Millisecond), tool.CacheHits, callsTrend(tool))
+	}
+
+	if len(report.Anomalies) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println(i18n.T("cli.metrics.anomalies"))
+	for _, anomaly := range report.Anomalies {
+		fmt.Println("  " + anomaly.String())
+	}
+}
+
+// callsTrend describes how a tool's calls changed from the previous window
+func callsTrend(tool bridge.ToolTrend) string {
+	if tool.Previous.Calls == 0 {
+		return i18n.T("cli.metrics.new")
+	}
+	change := float64(tool.Calls-tool.Previous.Calls) / float64(tool.Previous.Calls) * 100
+	return fmt.Sprintf("%+.0f%%", change)
+}
@@ -0,0 +1,87 @@
+// ABOUTME: The secrets command, which keeps entries of the encrypted secrets file that file: secrets refer to
+// ABOUTME: Values are read from stdin so they stay out of shell history; the passphrase is LLMSPELL_SECRETS_KEY
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+)
+
+// maxSecretSize bounds a value secrets set reads
+const maxSecretSize = 64 << 10
+
+// runSecretsCommand handles secrets set <name>, which reads the value from
+// in, secrets list, and secrets delete <name>
+func runSecretsCommand(args []string, in io.Reader) {
+	valid := len(args) == 1 && args[0] == "list" ||
+		len(args) == 2 && (args[0] == "set" || args[0] == "delete")
+	if !valid {
+		fmt.Println(i18n.T("cli.usage.secrets_short"))
+		os.Exit(1)
+	}
+
+	file := &bridge.SecretFile{Path: bridge.DefaultSecretFile(), Passphrase: os.Getenv("LLMSPELL_SECRETS_KEY")}
+	entries, err := file.Load()
+	if err != nil {
+		fatalf("cli.error.secrets", err)
+	}
+
+	switch args[0] {
+	case "list":
+		names := make([]string, 0, len(entries))
+		for name := range entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		fmt.Println(i18n.T("cli.secrets.entries", len(names), file.Path))
+	case "set":
+		if f, ok := in.(*os.File); ok && isTerminal(f) {
+			fmt.Fprint(os.Stderr, i18n.T("cli.secrets.prompt", args[1]))
+		}
+		value, err := readSecretValue(in)
+		if err != nil {
+			fatalf("cli.error.secrets", err)
+		}
+		entries[args[1]] = value
+		if err := file.Save(entries); err != nil {
+			fatalf("cli.error.secrets", err)
+		}
+		fmt.Println(i18n.T("cli.secrets.saved", args[1], file.Path))
+	case "delete":
+		if _, ok := entries[args[1]]; !ok {
+			fatalf("cli.error.secrets", fmt.Errorf("%s has no entry %q", file.Path, args[1]))
+		}
+		delete(entries, args[1])
+		if err := file.Save(entries); err != nil {
+			fatalf("cli.error.secrets", err)
+		}
+		fmt.Println(i18n.T("cli.secrets.deleted", args[1], file.Path))
+	}
+}
+
+// readSecretValue reads a value up to maxSecretSize, without the line end
+// that follows it
+func readSecretValue(in io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(in, maxSecretSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxSecretSize {
+		return "", fmt.Errorf("the value is larger than %d bytes", maxSecretSize)
+	}
+	value := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+	if value == "" {
+		return "", fmt.Errorf("the value is empty")
+	}
+	return value, nil
+}
@@ -0,0 +1,667 @@
+// ABOUTME: llmspell serve: an HTTP API to submit spells, follow their output and state, and cancel them
+// ABOUTME: Each run is an isolated child process; the server tracks its status and summary
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+// defaultServeAddr is where llmspell serve listens unless told otherwise.
+// It is only reachable from this machine, as whoever can reach it can run
+// spells.
+const defaultServeAddr = "127.0.0.1:8080"
+
+// serveTokenEnv names the variable holding the bearer token clients of
+// llmspell serve must present; without it the server makes one up and
+// prints it when it starts
+const serveTokenEnv = "LLMSPELL_SERVE_TOKEN"
+
+// maxServerRuns is how many spells the server runs at once; further
+// submissions are turned away until one finishes
+const maxServerRuns = 8
+
+// Finished runs, with their output and state changes, are kept for
+// clients to read until there are more than keptRuns of them or they
+// finished longer than runRetention ago
+const (
+	keptRuns     = 100
+	runRetention = time.Hour
+)
+
+// Run statuses reported by the API
+const (
+	runRunning   = "running"
+	runSucceeded = "succeeded"
+	runFailed    = "failed"
+	runCancelled = "cancelled"
+)
+
+// runRequest is the body of POST /runs. It names a spell by Spell, a path
+// relative to the directory the server was started in, or gives its Source
+// in the language Engine names ("lua" by default). Timeout and
+// MaxLLMCalls can only tighten the server's own limits.
+type runRequest struct {
+	Spell       string            `json:"spell,omitempty"`
+	Source      string            `json:"source,omitempty"`
+	Engine      string            `json:"engine,omitempty"`
+	Params      map[string]string `json:"params,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"`
+	MaxLLMCalls int               `json:"max_llm_calls,omitempty"`
+}
+
+// runStatus is what the API reports about a run. Reason says why a
+// cancelled run stopped, as engine.CancelReason names it.
+type runStatus struct {
+	ID       string      `json:"id"`
+	Spell    string      `json:"spell"`
+	Status   string      `json:"status"`
+	Reason   string      `json:"reason,omitempty"`
+	ExitCode *int        `json:"exit_code,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Started  time.Time   `json:"started"`
+	Finished *time.Time  `json:"finished,omitempty"`
+	Summary  *runSummary `json:"summary,omitempty"`
+}
+
+// serverRun is a spell the server started
+type serverRun struct {
+	cancel context.CancelFunc
+	output *runOutput
+	events *runEvents
+	done   chan struct{}
+
+	mu     sync.Mutex
+	status runStatus
+
+	// cancelled is set when a client asked for the run to stop
+	cancelled bool
+}
+
+// snapshot returns the run's status as it is now
+func (r *serverRun) snapshot() runStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// spellServer runs spells submitted over HTTP, each in an isolated child
+// process under the server's run options
+type spellServer struct {
+	opts runOptions
+	root string
+
+	// token is the bearer token every request must carry; empty accepts
+	// any caller
+	token string
+
+	// host is the name the server was told to listen on, which requests
+	// may address besides localhost and IP addresses
+	host string
+
+	// keep and retention bound the finished runs the server remembers
+	keep      int
+	retention time.Duration
+
+	mu   sync.Mutex
+	runs map[string]*serverRun
+	busy int
+	wg   sync.WaitGroup
+}
+
+// newSpellServer creates a server running spells with opts, finding those
+// submitted by path under root, for callers presenting token
+func newSpellServer(opts runOptions, root, token string) *spellServer {
+	return &spellServer{
+		opts:      opts,
+		root:      root,
+		token:     token,
+		keep:      keptRuns,
+		retention: runRetention,
+		runs:      make(map[string]*serverRun),
+	}
+}
+
+// handler routes the API:
+//
+//	POST   /runs             submit a spell; returns its status
+//	GET    /runs             list runs, newest first
+//	GET    /runs/{id}        a run's status, with its summary once it ends
+//	GET    /runs/{id}/output the run's output, streamed until it ends
+//	GET    /runs/{id}/events a WebSocket of the run's state changes
+//	DELETE /runs/{id}        cancel a run
+//
+// Every request must carry the server's bearer token and address the
+// server by localhost, an IP address, or the name it listens on, so
+// neither other pages in a browser nor DNS rebinding can reach it.
+func (s *spellServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /runs", s.handleSubmit)
+	mux.HandleFunc("GET /runs", s.handleList)
+	mux.HandleFunc("GET /runs/{id}", s.handleStatus)
+	mux.HandleFunc("GET /runs/{id}/output", s.handleOutput)
+	mux.HandleFunc("GET /runs/{id}/events", s.handleEvents)
+	mux.HandleFunc("DELETE /runs/{id}", s.handleCancel)
+	return s.guard(mux)
+}
+
+// guard turns away requests for other hosts and without the token
+func (s *spellServer) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowedHost(r.Host) {
+			writeAPIError(w, http.StatusMisdirectedRequest, fmt.Errorf("host %q is not served here", r.Host))
+			return
+		}
+		if s.token != "" && subtle.ConstantTimeCompare([]byte(requestToken(r)), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="llmspell"`)
+			writeAPIError(w, http.StatusUnauthorized, errors.New("a valid bearer token is required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedHost reports whether a request's Host header names this server:
+// localhost, an IP address, or the host name it listens on. A page that
+// rebinds its own domain to this machine still sends that domain.
+func (s *spellServer) allowedHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	return s.host != "" && host == s.host
+}
+
+// requestToken returns the bearer token of a request. Browsers cannot set
+// headers on a WebSocket, so the events socket may pass it as the
+// access_token query parameter instead.
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if strings.HasSuffix(r.URL.Path, "/events") {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// newServeToken makes up a random bearer token
+func newServeToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *spellServer) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	// A JSON body cannot be sent cross-origin without a CORS preflight,
+	// which the server never grants
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeAPIError(w, http.StatusUnsupportedMediaType, errors.New("the request body must be application/json"))
+		return
+	}
+	var req runRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	run, err := s.start(req)
+	switch {
+	case errors.Is(err, errServerBusy):
+		writeAPIError(w, http.StatusTooManyRequests, err)
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	status := run.snapshot()
+	w.Header().Set("Location", "/runs/"+status.ID)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func (s *spellServer) handleList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.evict(time.Now())
+	statuses := make([]runStatus, 0, len(s.runs))
+	for _, run := range s.runs {
+		statuses = append(statuses, run.snapshot())
+	}
+	s.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Started.After(statuses[j].Started)
+	})
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *spellServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if run := s.lookup(w, r); run != nil {
+		writeJSON(w, http.StatusOK, run.snapshot())
+	}
+}
+
+func (s *spellServer) handleOutput(w http.ResponseWriter, r *http.Request) {
+	run := s.lookup(w, r)
+	if run == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	flusher, _ := w.(http.Flusher)
+	_ = run.output.follow(r.Context(), w, flusher)
+}
+
+func (s *spellServer) handleCancel(w http.ResponseWriter, r *http.Request) {
+	run := s.lookup(w, r)
+	if run == nil {
+		return
+	}
+	run.mu.Lock()
+	if run.status.Status == runRunning {
+		run.cancelled = true
+		run.cancel()
+	}
+	run.mu.Unlock()
+	writeJSON(w, http.StatusAccepted, run.snapshot())
+}
+
+// lookup finds the run the request names, or responds 404
+func (s *spellServer) lookup(w http.ResponseWriter, r *http.Request) *serverRun {
+	s.mu.Lock()
+	run := s.runs[r.PathValue("id")]
+	s.mu.Unlock()
+	if run == nil {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("no run %q", r.PathValue("id")))
+	}
+	return run
+}
+
+// errServerBusy is returned when the server is already running as many
+// spells as it may
+var errServerBusy = fmt.Errorf("already running %d spells; try again later", maxServerRuns)
+
+// start checks a request and starts its run
+func (s *spellServer) start(req runRequest) (*serverRun, error) {
+	opts := s.opts
+	if req.Timeout != "" {
+		timeout, err := time.ParseDuration(req.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", req.Timeout)
+		}
+		if opts.Timeout == 0 || timeout < opts.Timeout {
+			opts.Timeout = timeout
+		}
+	}
+	if req.MaxLLMCalls < 0 {
+		return nil, fmt.Errorf("invalid max_llm_calls %d", req.MaxLLMCalls)
+	}
+	if req.MaxLLMCalls > 0 && (opts.MaxLLMCalls == 0 || req.MaxLLMCalls < opts.MaxLLMCalls) {
+		opts.MaxLLMCalls = req.MaxLLMCalls
+	}
+
+	spellPath, name, cleanup, err := s.spellFor(req)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, len(req.Params))
+	for key, value := range req.Params {
+		args = append(args, key+"="+value)
+	}
+	sort.Strings(args)
+
+	s.mu.Lock()
+	if s.busy >= maxServerRuns {
+		s.mu.Unlock()
+		cleanup()
+		return nil, errServerBusy
+	}
+	s.busy++
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &serverRun{
+		cancel: cancel,
+		output: newRunOutput(),
+		events: newRunEvents(),
+		done:   make(chan struct{}),
+		status: runStatus{ID: bridge.NewCorrelationID(), Spell: name, Status: runRunning, Started: time.Now()},
+	}
+	opts.StateEvents = run.events.add
+	child, err := newIsolatedChild(ctx, append([]string{"run", spellPath}, args...), opts)
+	if err == nil {
+		child.cmd.Stdout, child.cmd.Stderr = run.output, run.output
+		err = child.start()
+	}
+	if err != nil {
+		cancel()
+		cleanup()
+		s.release()
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.runs[run.status.ID] = run
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.release()
+		defer cleanup()
+		summary, decodeErr, err := child.wait()
+		cancel()
+		run.finish(summary, decodeErr, err)
+
+		s.mu.Lock()
+		s.evict(time.Now())
+		s.mu.Unlock()
+	}()
+	return run, nil
+}
+
+// evict forgets the finished runs that finished more than s.retention
+// before now, and the oldest beyond the s.keep most recent, with their
+// output and state changes. s.mu must be held.
+func (s *spellServer) evict(now time.Time) {
+	var finished []runStatus
+	for id, run := range s.runs {
+		status := run.snapshot()
+		if status.Finished == nil {
+			continue
+		}
+		if now.Sub(*status.Finished) > s.retention {
+			delete(s.runs, id)
+			continue
+		}
+		finished = append(finished, status)
+	}
+	if len(finished) <= s.keep {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].Finished.After(*finished[j].Finished)
+	})
+	for _, status := range finished[s.keep:] {
+		delete(s.runs, status.ID)
+	}
+}
+
+// release frees the slot of a run that ended
+func (s *spellServer) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.busy--
+}
+
+// spellFor returns the script a request runs and the spell's name. Source
+// is written to a temporary spell directory, which cleanup removes.
+func (s *spellServer) spellFor(req runRequest) (path, name string, cleanup func(), err error) {
+	switch {
+	case req.Spell != "" && req.Source != "":
+		return "", "", nil, fmt.Errorf("give either spell or source, not both")
+	case req.Spell != "":
+		// Paths stay within the server's directory
+		if !filepath.IsLocal(req.Spell) {
+			return "", "", nil, fmt.Errorf("spell %q is not a path within the server's directory", req.Spell)
+		}
+		path = filepath.Join(s.root, req.Spell)
+		if _, err := os.Stat(path); err != nil {
+			return "", "", nil, fmt.Errorf("cannot access spell: %w", err)
+		}
+		return path, req.Spell, func() {}, nil
+	case req.Source != "":
+		lang := req.Engine
+		if lang == "" {
+			lang = "lua"
+		}
+		metadata, err := engine.DefaultRegistry().GetMetadata(lang)
+		if err != nil || len(metadata.FileExtensions) == 0 {
+			return "", "", nil, fmt.Errorf("unknown engine %q", lang)
+		}
+		dir, err := os.MkdirTemp("", "llmspell-serve-")
+		if err != nil {
+			return "", "", nil, err
+		}
+		path = filepath.Join(dir, "main"+metadata.FileExtensions[0])
+		if err := os.WriteFile(path, []byte(req.Source), 0600); err != nil {
+			os.RemoveAll(dir)
+			return "", "", nil, err
+		}
+		// A child that drops privileges must still be able to read it
+		if err := childIsolation(s.opts).GiveToChild(dir, path); err != nil {
+			os.RemoveAll(dir)
+			return "", "", nil, err
+		}
+		return path, "source", func() { os.RemoveAll(dir) }, nil
+	}
+	return "", "", nil, fmt.Errorf("spell or source is required")
+}
+
+// finish records how the run's child exited
+func (r *serverRun) finish(summary runSummary, decodeErr, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status.finish(summary, decodeErr, err)
+	if r.cancelled && r.status.Status != runSucceeded {
+		r.status.Status, r.status.Reason = runCancelled, "interrupt"
+	}
+	r.output.close()
+	r.events.close()
+	close(r.done)
+}
+
+// finish records how an isolated child running the spell exited, as
+// isolatedChild.wait reports it, and the tool metrics of its summary
+func (st *runStatus) finish(summary runSummary, decodeErr, err error) {
+	finished := time.Now()
+	st.Finished = &finished
+	st.Status = runSucceeded
+	if decodeErr == nil {
+		summary.Isolated = true
+		st.Summary = &summary
+		recordToolMetrics(summary)
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		code := 0
+		st.ExitCode = &code
+	case errors.As(err, &exitErr) && exitErr.Exited():
+		code := exitErr.ExitCode()
+		st.ExitCode = &code
+		st.Status = runFailed
+		if reason := exitReason(code); reason != "" {
+			st.Status, st.Reason = runCancelled, reason
+		}
+	case errors.As(err, &exitErr) && security.KilledByLimit(exitErr.ProcessState):
+		// Killed by a signal, such as SIGXCPU, for exceeding a resource limit
+		st.Status, st.Reason, st.Error = runCancelled, "resource_limit", err.Error()
+	default:
+		st.Status, st.Error = runFailed, err.Error()
+	}
+}
+
+// exitReason names the cancellation reason a spell's exit code stands for,
+// or "" for other codes
+func exitReason(code int) string {
+	switch code {
+	case engine.ExitInterrupted:
+		return "interrupt"
+	case engine.ExitDeadline:
+		return "deadline"
+	case engine.ExitBudget:
+		return "budget"
+	case engine.ExitResourceLimit:
+		return "resource_limit"
+	}
+	return ""
+}
+
+// shutdown cancels the runs in progress and waits for them to end
+func (s *spellServer) shutdown() {
+	s.mu.Lock()
+	for _, run := range s.runs {
+		run.cancel()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// runOutput collects what a run prints and lets any number of readers
+// follow it
+type runOutput struct {
+	mu      sync.Mutex
+	data    []byte
+	closed  bool
+	changed chan struct{}
+}
+
+func newRunOutput() *runOutput {
+	return &runOutput{changed: make(chan struct{})}
+}
+
+// Write appends to the output and wakes its followers
+func (o *runOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.data = append(o.data, p...)
+	close(o.changed)
+	o.changed = make(chan struct{})
+	return len(p), nil
+}
+
+// close marks the end of the output
+func (o *runOutput) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.closed = true
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// follow copies the output to w as it is written, flushing after each
+// piece, until it ends or ctx is done
+func (o *runOutput) follow(ctx context.Context, w io.Writer, flusher http.Flusher) error {
+	offset := 0
+	for {
+		o.mu.Lock()
+		chunk, closed, changed := o.data[offset:], o.closed, o.changed
+		o.mu.Unlock()
+
+		if len(chunk) > 0 {
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			offset += len(chunk)
+		}
+		if closed {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// writeAPIError responds with an error as {"error": "..."}
+func writeAPIError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// runServeCommand serves the API on addr until interrupted, then cancels
+// the runs in progress
+func runServeCommand(args []string, opts runOptions) {
+	addr := defaultServeAddr
+	if len(args) > 0 {
+		addr = args[0]
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		fatalf("cli.error.serve", err)
+	}
+
+	token := os.Getenv(serveTokenEnv)
+	generated := token == ""
+	if generated {
+		if token, err = newServeToken(); err != nil {
+			fatalf("cli.error.serve", err)
+		}
+	}
+
+	spells := newSpellServer(opts, root, token)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		spells.host = strings.ToLower(host)
+	}
+	server := &http.Server{Addr: addr, Handler: spells.handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		spells.shutdown()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Println(i18n.T("serve.listening", addr))
+	if generated {
+		fmt.Println(i18n.T("serve.token", token, serveTokenEnv))
+	}
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatalf("cli.error.serve", err)
+	}
+	<-ctx.Done()
+	log.Print(i18n.T("serve.stopped"))
+}
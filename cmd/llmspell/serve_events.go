@@ -0,0 +1,158 @@
+// ABOUTME: Streams a served run's state changes to clients over a WebSocket
+// ABOUTME: Each client gets a state.snapshot of the values so far, then a state.changed message per change
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+)
+
+// Types of the messages GET /runs/{id}/events sends
+const (
+	stateSnapshotMessage = "state.snapshot"
+	stateChangedMessage  = "state.changed"
+)
+
+// eventsWriteTimeout is how long a client may take to accept a message
+// before it is disconnected
+const eventsWriteTimeout = 10 * time.Second
+
+// stateSnapshot is the first message a client gets: the run's values after
+// the change numbered Seq, or before any change when Seq is zero
+type stateSnapshot struct {
+	Type   string                 `json:"type"`
+	Run    string                 `json:"run"`
+	Seq    uint64                 `json:"seq"`
+	Values map[string]interface{} `json:"values"`
+}
+
+// stateChanged is a message for each change after the snapshot
+type stateChanged struct {
+	Type  string            `json:"type"`
+	Run   string            `json:"run"`
+	Event bridge.StateEvent `json:"event"`
+}
+
+// eventsUpgrader accepts WebSocket connections from pages served by the
+// same host only, so other pages cannot use a token they come across
+var eventsUpgrader = websocket.Upgrader{}
+
+// runEvents collects the changes to a run's state and lets any number of
+// clients follow them
+type runEvents struct {
+	mu      sync.Mutex
+	values  map[string]interface{}
+	events  []bridge.StateEvent
+	closed  bool
+	changed chan struct{}
+}
+
+func newRunEvents() *runEvents {
+	return &runEvents{values: make(map[string]interface{}), changed: make(chan struct{})}
+}
+
+// add records a change and wakes the followers
+func (e *runEvents) add(event bridge.StateEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if event.Op == bridge.StateDelete {
+		delete(e.values, event.Key)
+	} else {
+		e.values[event.Key] = event.Value
+	}
+	e.events = append(e.events, event)
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// close marks the end of the changes
+func (e *runEvents) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.closed = true
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// follow sends a snapshot of the values so far, then each change, until
+// the run ends or ctx is done
+func (e *runEvents) follow(ctx context.Context, run string, send func(interface{}) error) error {
+	e.mu.Lock()
+	snapshot := stateSnapshot{Type: stateSnapshotMessage, Run: run, Values: make(map[string]interface{}, len(e.values))}
+	for key, value := range e.values {
+		snapshot.Values[key] = value
+	}
+	if len(e.events) > 0 {
+		snapshot.Seq = e.events[len(e.events)-1].Seq
+	}
+	offset := len(e.events)
+	e.mu.Unlock()
+	if err := send(snapshot); err != nil {
+		return err
+	}
+
+	for {
+		e.mu.Lock()
+		events, closed, changed := e.events[offset:], e.closed, e.changed
+		e.mu.Unlock()
+
+		for _, event := range events {
+			if err := send(stateChanged{Type: stateChangedMessage, Run: run, Event: event}); err != nil {
+				return err
+			}
+		}
+		offset += len(events)
+		if closed {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *spellServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	run := s.lookup(w, r)
+	if run == nil {
+		return
+	}
+	conn, err := eventsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded
+		return
+	}
+	defer conn.Close()
+
+	// Clients send nothing, but reading notices when they go away
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	id := run.snapshot().ID
+	err = run.events.follow(ctx, id, func(message interface{}) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+		return conn.WriteJSON(message)
+	})
+	if err == nil {
+		// The run ended
+		closing := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "run finished")
+		_ = conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(eventsWriteTimeout))
+	}
+}
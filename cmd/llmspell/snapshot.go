@@ -0,0 +1,266 @@
+// ABOUTME: Run snapshots that record what is needed to repeat a spell run
+// ABOUTME: --snapshot writes one after a run; --replay re-runs it without calling LLM providers
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+)
+
+// snapshotVersion is the format of snapshot files this build reads and writes
+const snapshotVersion = 1
+
+// runSnapshot records a spell run: the spell's files, its arguments and
+// settings, the seed for math.random, and every LLM response it received.
+// Replaying it runs the same spell with the same inputs and answers LLM
+// requests from the recording.
+type runSnapshot struct {
+	Version   int                       `json:"version"`
+	Created   time.Time                 `json:"created"`
+	RunID     string                    `json:"run_id"`
+	Spell     spellSnapshot             `json:"spell"`
+	Args      []string                  `json:"args"`
+	Config    snapshotConfig            `json:"config"`
+	Provider  string                    `json:"provider,omitempty"`
+	Providers []string                  `json:"providers,omitempty"`
+	Model     string                    `json:"model,omitempty"`
+	Seed      int64                     `json:"seed"`
+	LLM       []bridge.RecordedResponse `json:"llm"`
+	Error     string                    `json:"error,omitempty"`
+}
+
+// spellSnapshot identifies the spell that ran: Files maps each of its
+// files, relative to the spell directory, to a SHA-256 of its contents
+type spellSnapshot struct {
+	Name  string            `json:"name"`
+	Path  string            `json:"path"`
+	Main  string            `json:"main"`
+	Files map[string]string `json:"files"`
+}
+
+// snapshotConfig is the resolved configuration of a run. Environment
+// variables that hold secrets are recorded as [REDACTED].
+type snapshotConfig struct {
+	Profile     string            `json:"profile"`
+	Timeout     time.Duration     `json:"timeout_ns,omitempty"`
+	CallTimeout time.Duration     `json:"call_timeout_ns"`
+	MaxLLMCalls int               `json:"max_llm_calls,omitempty"`
+	CacheTTL    time.Duration     `json:"cache_ttl_ns,omitempty"`
+	NoCache     bool              `json:"no_cache,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+
+	// Now is the time the run's clock started at; a replay's clock is
+	// stopped at it
+	Now time.Time `json:"now"`
+}
+
+// newRunSnapshot starts the snapshot of a run; the LLM bridge details and
+// responses are filled in when the run ends
+func newRunSnapshot(runID, spellName, spellPath, mainScript string, args []string, opts runOptions, seed int64, now time.Time) (*runSnapshot, error) {
+	files, err := hashSpellFiles(spellPath, mainScript)
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(spellPath)
+	if err != nil {
+		return nil, err
+	}
+	return &runSnapshot{
+		Version: snapshotVersion,
+		Created: time.Now().UTC(),
+		RunID:   runID,
+		Spell: spellSnapshot{
+			Name:  spellName,
+			Path:  absPath,
+			Main:  filepath.Base(mainScript),
+			Files: files,
+		},
+		Args: append([]string{}, args...),
+		Config: snapshotConfig{
+			Profile:     opts.Profile.Name,
+			Timeout:     opts.Timeout,
+			CallTimeout: opts.CallTimeout,
+			MaxLLMCalls: opts.MaxLLMCalls,
+			CacheTTL:    opts.CacheTTL,
+			NoCache:     opts.NoCache,
+			Env:         snapshotEnv(os.Environ()),
+			Now:         now,
+		},
+		Seed: seed,
+	}, nil
+}
+
+// finish records how the run ended: the LLM bridge it used, the responses
+// it received, and its error, if any
+func (s *runSnapshot) finish(sb *spellBridges, responses *bridge.ResponseLog, runErr error) {
+	if llmBridge, ok := sb.llmBridge(); ok {
+		s.Provider = llmBridge.GetCurrentProvider()
+		s.Model = llmBridge.GetModel()
+		s.Providers = llmBridge.ListProviders()
+		sort.Strings(s.Providers)
+	}
+	s.LLM = responses.Responses()
+	if s.LLM == nil {
+		s.LLM = []bridge.RecordedResponse{}
+	}
+	if runErr != nil {
+		s.Error = runErr.Error()
+	}
+}
+
+// write saves the snapshot as indented JSON, readable only by its owner
+// since it holds prompts and responses
+func (s *runSnapshot) write(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// replayProviders lists the providers the recorded run could use, its
+// current provider first
+func (s *runSnapshot) replayProviders() []string {
+	if s.Provider == "" {
+		return nil
+	}
+	providers := []string{s.Provider}
+	for _, name := range s.Providers {
+		if name != s.Provider {
+			providers = append(providers, name)
+		}
+	}
+	return providers
+}
+
+// changedFiles lists the spell files that differ from the snapshot,
+// including ones added or removed since
+func (s *runSnapshot) changedFiles(spellPath, mainScript string) []string {
+	current, err := hashSpellFiles(spellPath, mainScript)
+	if err != nil {
+		return []string{spellPath}
+	}
+
+	var changed []string
+	for name, hash := range s.Spell.Files {
+		if current[name] != hash {
+			changed = append(changed, name)
+		}
+	}
+	for name := range current {
+		if _, ok := s.Spell.Files[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// loadSnapshot reads a snapshot written by --snapshot
+func loadSnapshot(path string) (*runSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s runSnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("%s: unsupported snapshot version %d", path, s.Version)
+	}
+	return &s, nil
+}
+
+// hashSpellFiles hashes the files a spell is made of: every file under a
+// spell directory, skipping hidden ones, or the script of a single-file spell
+func hashSpellFiles(spellPath, mainScript string) (map[string]string, error) {
+	files := make(map[string]string)
+	info, err := os.Stat(spellPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		hash, err := hashFile(mainScript)
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.Base(mainScript)] = hash
+		return files, nil
+	}
+
+	err = filepath.WalkDir(spellPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != spellPath {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(spellPath, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// snapshotEnv picks the environment variables that affect a run from environ
+// and redacts the ones holding API keys and other secrets
+func snapshotEnv(environ []string) map[string]string {
+	env := make(map[string]string)
+	for _, entry := range environ {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(name, "LLMSPELL_"), name == "MOCK_LLM", strings.HasSuffix(name, "_API_KEY"):
+		default:
+			continue
+		}
+		upper := strings.ToUpper(name)
+		for _, secret := range []string{"KEY", "TOKEN", "SECRET", "PASSWORD"} {
+			if strings.Contains(upper, secret) {
+				value = "[REDACTED]"
+				break
+			}
+		}
+		env[name] = value
+	}
+	return env
+}
@@ -0,0 +1,107 @@
+// ABOUTME: The state command, which exports saved spell state and imports it again
+// ABOUTME: Moves state between stores and spells as JSON, YAML, or msgpack, for backups and handoffs
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+)
+
+// runStateCommand handles state export and state import
+func runStateCommand(args []string) {
+	args, format := extractFlag(args, "format")
+	args, version := extractFlag(args, "state-version")
+	if len(args) < 2 || (args[0] != "export" && args[0] != "import") {
+		fmt.Println(i18n.T("cli.usage.state_short"))
+		os.Exit(1)
+	}
+
+	store := newStateStore()
+	if store == nil {
+		fatalf("cli.error.state_store", fmt.Errorf("no home directory to keep state in; set LLMSPELL_STATE_DIR"))
+	}
+	// The file to export to, or the name to import under
+	target := ""
+	if len(args) > 2 {
+		target = args[2]
+	}
+	if args[0] == "export" {
+		n := 0
+		if version != "" {
+			var err error
+			if n, err = strconv.Atoi(version); err != nil || n < 1 {
+				fatalf("cli.error.state_export", fmt.Errorf("invalid version %q", version))
+			}
+		}
+		if err := exportState(store, args[1], n, target, format); err != nil {
+			fatalf("cli.error.state_export", err)
+		}
+		return
+	}
+
+	name, n, err := importState(store, args[1], target, format)
+	if err != nil {
+		fatalf("cli.error.state_import", err)
+	}
+	fmt.Println(i18n.T("cli.state.imported", name, n))
+}
+
+// exportState writes a version of the saved state name to path, or to
+// stdout when path is empty or -, in format, or else the format path's
+// extension names
+func exportState(store *bridge.SavedStates, name string, version int, path, format string) error {
+	export, err := store.Export(name, version)
+	if err != nil {
+		return err
+	}
+	if path == "" || path == "-" {
+		if format == "" {
+			format = bridge.StateFormatJSON
+		}
+		out := bufio.NewWriter(os.Stdout)
+		if err := bridge.ExportState(out, format, export); err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+
+	if format == "" {
+		format = bridge.StateFormatForPath(path)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := bridge.ExportState(f, format, export); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// importState saves the state exported to path, or to stdin for -, as the
+// next version of name, or of the name it was exported under, and returns
+// the name and version
+func importState(store *bridge.SavedStates, path, name, format string) (string, int, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", 0, err
+		}
+		defer f.Close()
+		in = f
+	}
+	export, err := bridge.ImportState(in, format)
+	if err != nil {
+		return "", 0, err
+	}
+	return store.Import(name, export)
+}
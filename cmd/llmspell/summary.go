@@ -0,0 +1,251 @@
+// ABOUTME: End-of-run accounting for spells: bridge calls, tool executions, memory, and time
+// ABOUTME: Prints the summary as text or JSON after a spell finishes
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+)
+
+// runSummary is what a spell run consumed
+type runSummary struct {
+	RunID          string                       `json:"run_id"`
+	Spell          string                       `json:"spell"`
+	TraceID        string                       `json:"trace_id,omitempty"`
+	Isolated       bool                         `json:"isolated,omitempty"`
+	WallTime       time.Duration                `json:"wall_time_ns"`
+	PeakMemory     uint64                       `json:"peak_memory_bytes"`
+	Bridges        []bridgeLoad                 `json:"bridges"`
+	BridgeCalls    int                          `json:"bridge_calls"`
+	Methods        []bridge.CallStat            `json:"methods"`
+	LLMCalls       int                          `json:"llm_calls"`
+	ToolExecutions []bridge.CallStat            `json:"tool_executions"`
+	Cache          map[string]bridge.CacheStats `json:"cache,omitempty"`
+	StuckCalls     []bridge.StuckCall           `json:"stuck_calls,omitempty"`
+	Warnings       []bridge.Warning             `json:"warnings"`
+	Profile        *bridge.ProfileReport        `json:"profile,omitempty"`
+}
+
+// bridgeLoad is a bridge a spell used and how long it took to start
+type bridgeLoad struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// newRunSummary aggregates the counters collected during a run
+func newRunSummary(runID string, wall time.Duration, peak uint64, calls *bridge.CallStats, sb *spellBridges) runSummary {
+	summary := runSummary{
+		RunID:          runID,
+		WallTime:       wall,
+		PeakMemory:     peak,
+		Bridges:        []bridgeLoad{},
+		Methods:        calls.Snapshot(),
+		ToolExecutions: []bridge.CallStat{},
+		Warnings:       []bridge.Warning{},
+	}
+	for _, stat := range summary.Methods {
+		summary.BridgeCalls += stat.Calls
+		if isLLMRequest(stat.Name) {
+			summary.LLMCalls += stat.Calls
+		}
+	}
+	if sb != nil {
+		summary.Bridges = append(summary.Bridges, sb.loads()...)
+		if toolBridge := sb.toolBridge(); toolBridge != nil {
+			summary.ToolExecutions = toolBridge.ExecutionStats()
+		}
+	}
+	return summary
+}
+
+// isLLMRequest reports whether an llm or embeddings bridge method sends a
+// request to a model, as opposed to listing or switching providers
+func isLLMRequest(method string) bool {
+	switch method {
+	case "llm.chat", "llm.complete", "llm.stream_chat", "llm.stream_complete", "llm.batch", "llm.generate_structured", "llm.chat_async", "llm.complete_async", "llm.stream_chat_async",
+		"embeddings.embed", "embeddings.embed_batch":
+		return true
+	}
+	return false
+}
+
+// write prints the summary as text, or as JSON when format is "json"
+func (s runSummary) write(w io.Writer, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	fmt.Fprintln(w, i18n.T("summary.heading"))
+	fmt.Fprintln(w, i18n.T("summary.run_id", s.RunID))
+	if s.TraceID != "" {
+		fmt.Fprintln(w, i18n.T("summary.trace_id", s.TraceID))
+	}
+	if s.Isolated {
+		fmt.Fprintln(w, i18n.T("summary.isolated"))
+	}
+	fmt.Fprintln(w, i18n.T("summary.wall_time", s.WallTime.Round(time.Millisecond)))
+	fmt.Fprintln(w, i18n.T("summary.peak_memory", float64(s.PeakMemory)/(1024*1024)))
+	loads := make([]string, len(s.Bridges))
+	for i, load := range s.Bridges {
+		loads[i] = fmt.Sprintf("%s (%s)", load.Name, load.Duration.Round(time.Microsecond))
+	}
+	if len(loads) == 0 {
+		loads = append(loads, i18n.T("summary.none"))
+	}
+	fmt.Fprintln(w, i18n.T("summary.bridges", strings.Join(loads, ", ")))
+	fmt.Fprintln(w, i18n.T("summary.bridge_calls", s.BridgeCalls))
+	for _, stat := range s.Methods {
+		line := fmt.Sprintf("  %-24s %d", stat.Name, stat.Calls)
+		if stat.Failures > 0 {
+			line += " " + i18n.T("summary.failed", stat.Failures)
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintln(w, i18n.T("summary.llm_calls", s.LLMCalls))
+	kinds := make([]string, 0, len(s.Cache))
+	for kind := range s.Cache {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		stats := s.Cache[kind]
+		fmt.Fprintln(w, i18n.T("summary.cache", kind, stats.Hits, stats.Misses, stats.Bypassed))
+	}
+	if len(s.StuckCalls) > 0 {
+		fmt.Fprintln(w, i18n.T("summary.stuck_calls", len(s.StuckCalls)))
+		for _, call := range s.StuckCalls {
+			fmt.Fprintf(w, "  %-24s %s\n", call.Name, time.Since(call.Started).Round(time.Millisecond))
+		}
+	}
+	if len(s.ToolExecutions) > 0 {
+		fmt.Fprintln(w, i18n.T("summary.tool_executions"))
+		for _, stat := range s.ToolExecutions {
+			rate := 100 * float64(stat.Successes()) / float64(stat.Calls)
+			line := i18n.T("summary.succeeded", stat.Successes(), stat.Calls, rate)
+			if stat.CacheHits > 0 {
+				line += " " + i18n.T("summary.cache_hits", stat.CacheHits)
+			}
+			fmt.Fprintf(w, "  %-24s %s\n", stat.Name, line)
+		}
+	}
+	if len(s.Warnings) > 0 {
+		fmt.Fprintln(w, i18n.T("summary.warnings", len(s.Warnings)))
+		for _, warning := range s.Warnings {
+			line := fmt.Sprintf("  [%s] %s", warning.Source, warning.Message)
+			if warning.Count > 1 {
+				line += " " + i18n.T("summary.repeated", warning.Count)
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	if s.Profile != nil {
+		writeProfileText(w, s.Profile)
+	}
+	return nil
+}
+
+// profileMethods is how many of the slowest bridge methods the text
+// summary lists
+const profileMethods = 10
+
+// writeProfileText prints where the run's time went: the share of the
+// script and each kind of bridge method, then the methods that took
+// longest, leaving out calls made inside them
+func writeProfileText(w io.Writer, p *bridge.ProfileReport) {
+	share := func(d time.Duration) float64 {
+		if p.Wall <= 0 {
+			return 0
+		}
+		return 100 * float64(d) / float64(p.Wall)
+	}
+
+	fmt.Fprintln(w, i18n.T("summary.profile", p.Wall.Round(time.Millisecond)))
+	for _, kind := range []string{bridge.ProfileScript, bridge.ProfileLLM, bridge.ProfileTools, bridge.ProfileBridge} {
+		if d, ok := p.Kinds[kind]; ok {
+			fmt.Fprintf(w, "  %-24s %10s %5.1f%%\n", kind, d.Round(time.Microsecond), share(d))
+		}
+	}
+	for i, entry := range p.Methods {
+		if i == profileMethods {
+			break
+		}
+		fmt.Fprintf(w, "    %-22s %10s %5.1f%%  %s\n", entry.Name, entry.Self.Round(time.Microsecond), share(entry.Self), i18n.T("summary.profile_calls", entry.Calls))
+	}
+}
+
+// writeProfile writes the run's call stacks to path in folded format
+func writeProfile(path string, p *bridge.Profiler) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := p.WriteFolded(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// memorySampler tracks the peak heap size while a spell runs
+type memorySampler struct {
+	mu   sync.Mutex
+	peak uint64
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startMemorySampler samples the heap every interval until stopped
+func startMemorySampler(interval time.Duration) *memorySampler {
+	m := &memorySampler{stop: make(chan struct{}), done: make(chan struct{})}
+	m.sample()
+
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.sample()
+			}
+		}
+	}()
+	return m
+}
+
+func (m *memorySampler) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stats.HeapAlloc > m.peak {
+		m.peak = stats.HeapAlloc
+	}
+}
+
+// Stop ends sampling and returns the peak heap size seen
+func (m *memorySampler) Stop() uint64 {
+	close(m.stop)
+	<-m.done
+	m.sample()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.peak
+}
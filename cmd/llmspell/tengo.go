@@ -0,0 +1,106 @@
+// ABOUTME: Runs Tengo spells: registers the llm, tools, and state modules in a Tengo engine
+// ABOUTME: Modules start their bridges on first import and are restricted like the Lua ones
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/d5/tengo/v2"
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	tengoengine "github.com/lexlapax/go-llmspell/pkg/engine/tengo"
+)
+
+// prepareTengo registers the llm, tools, and state modules in eng, each
+// built when the spell first imports it. As for Lua, every module is
+// restricted according to the security profile.
+func (s *spellSession) prepareTengo(eng *tengoengine.TengoEngine, spellName string, spell *bridge.SpellBridge) *spellBridges {
+	sb := newSpellBridges(s.args, s.callLog)
+	sb.watchdog = s.watch
+	sb.guard = s.guard
+	sb.confirm = s.confirm
+	sb.toolResults = s.tools
+	sb.plugins = s.plugins
+	sb.responses = s.replies
+	sb.replayProviders = s.replayProviders
+	sb.warnings = s.warnings
+
+	eng.RegisterModuleLoader("llm", func() (map[string]tengo.Object, error) {
+		llmBridge, ok := sb.startLLM()
+		if !ok {
+			return s.restrictTengo("llm", tengoengine.LLMModule(eng, &mockLLM{})), nil
+		}
+		// LLM responses are only reused when the operator asked for results
+		// to persist, as repeated prompts may expect fresh answers
+		if s.cache.Persistent() {
+			llmBridge.SetResponseCache(s.cache)
+		}
+		return s.restrictTengo("llm", tengoengine.LLMModule(eng, llmBridge)), nil
+	})
+	eng.RegisterModuleLoader("tools", func() (map[string]tengo.Object, error) {
+		toolBridge, _ := sb.tools.Get(context.Background())
+		return s.restrictTengo("tools", tengoengine.ToolsModule(eng, toolBridge.(*bridge.ToolBridge))), nil
+	})
+	eng.RegisterModuleLoader("state", func() (map[string]tengo.Object, error) {
+		return s.restrictTengo("state", tengoengine.StateModule(spell.State(), s.states, spell.Channels())), nil
+	})
+	return sb
+}
+
+// restrictTengo applies the session's method policy, rate limits, and call
+// budget to a Tengo module, and counts and profiles its calls
+func (s *spellSession) restrictTengo(module string, attrs map[string]tengo.Object) map[string]tengo.Object {
+	tengoengine.ApplyMethodPolicy(module, attrs, &s.profile.Methods)
+	tengoengine.ApplyRateLimits(module, attrs, s.limiter)
+	tengoengine.ApplyCallBudget(module, attrs, s.budget)
+	tengoengine.ApplyCallStats(module, attrs, s.calls)
+	tengoengine.ApplyProfile(module, attrs, s.profiler)
+	return attrs
+}
+
+// mockLLM answers a Tengo spell's llm module without calling a provider,
+// as mockLLMScript does for Lua
+type mockLLM struct {
+	model string
+}
+
+func (m *mockLLM) Chat(ctx context.Context, prompt string) (string, error) {
+	return "[Mock LLM Response] I received your prompt: '" + prompt + "'. This is a mock response for demonstration.", nil
+}
+
+func (m *mockLLM) ChatMessages(ctx context.Context, messages []bridge.ChatMessage) (string, error) {
+	prompt := fmt.Sprintf("(%d messages)", len(messages))
+	if n := len(messages); n > 0 && len(messages[n-1].Content) == 1 {
+		prompt = messages[n-1].Content[0].Text
+	}
+	return m.Chat(ctx, prompt)
+}
+
+func (m *mockLLM) Complete(ctx context.Context, prompt string, maxTokens int) (string, error) {
+	return fmt.Sprintf("%s... [Mock completion with max %d tokens]", prompt, maxTokens), nil
+}
+
+func (m *mockLLM) GetCurrentProvider() string {
+	return "mock"
+}
+
+func (m *mockLLM) ListProviders() []string {
+	return []string{"mock"}
+}
+
+func (m *mockLLM) SetProvider(name string) error {
+	return nil
+}
+
+func (m *mockLLM) GetModel() string {
+	if m.model == "" {
+		return "default"
+	}
+	return m.model
+}
+
+func (m *mockLLM) SetModel(name string) error {
+	m.model = name
+	return nil
+}
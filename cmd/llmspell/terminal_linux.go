@@ -0,0 +1,18 @@
+// ABOUTME: Terminal detection on Linux, for asking before destructive tools run
+// ABOUTME: A file is a terminal when it has terminal attributes, which /dev/null does not
+
+//go:build linux
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS)
+	return err == nil
+}
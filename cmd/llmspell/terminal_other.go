@@ -0,0 +1,14 @@
+// ABOUTME: Terminal detection on other platforms, for asking before destructive tools run
+// ABOUTME: Any character device counts as a terminal
+
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package main
+
+import "os"
+
+// isTerminal reports whether f is a character device, such as a console
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
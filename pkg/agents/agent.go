@@ -34,6 +34,14 @@ func NewDefaultAgent(config Config) Agent {
 	}
 }
 
+// toolRegistry returns the registry the agent's tools come from
+func (a *defaultAgent) toolRegistry() tools.Registry {
+	if a.config.ToolRegistry != nil {
+		return a.config.ToolRegistry
+	}
+	return tools.DefaultRegistry
+}
+
 // Name returns the agent's unique identifier
 func (a *defaultAgent) Name() string {
 	return a.config.Name
@@ -68,7 +76,7 @@ func (a *defaultAgent) Initialize(ctx context.Context) error {
 	}
 
 	// Add tools if specified
-	toolRegistry := tools.DefaultRegistry
+	toolRegistry := a.toolRegistry()
 	for _, toolName := range a.tools {
 		tool, err := toolRegistry.Get(toolName)
 		if err != nil {
@@ -259,8 +267,7 @@ func (a *defaultAgent) AddTool(toolName string) error {
 
 	// If initialized, add to llms agent
 	if a.initialized && a.llmsAgent != nil {
-		toolRegistry := tools.DefaultRegistry
-		tool, err := toolRegistry.Get(toolName)
+		tool, err := a.toolRegistry().Get(toolName)
 		if err != nil {
 			return fmt.Errorf("tool %s not found: %w", toolName, err)
 		}
@@ -5,8 +5,10 @@ package agents
 
 import (
 	"context"
-	"errors"
 	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+	"github.com/lexlapax/go-llmspell/pkg/validation"
 )
 
 // Role represents the role of a message in a conversation
@@ -61,6 +63,10 @@ type Config struct {
 	// Tools is a list of tool names available to the agent
 	Tools []string `json:"tools,omitempty"`
 
+	// ToolRegistry resolves the names in Tools; tools.DefaultRegistry when
+	// nil
+	ToolRegistry tools.Registry `json:"-"`
+
 	// MaxTokens limits the response length
 	MaxTokens int `json:"max_tokens,omitempty"`
 
@@ -71,21 +77,25 @@ type Config struct {
 	Timeout time.Duration `json:"timeout,omitempty"`
 }
 
-// Validate checks if the configuration is valid
+// Validate checks if the configuration is valid. The error is a
+// *validation.Result listing every problem found.
 func (c Config) Validate() error {
+	result := &validation.Result{}
 	if c.Name == "" {
-		return errors.New("agent name is required")
+		result.Add(validation.Required("name"))
 	}
 	if c.Provider == "" {
-		return errors.New("provider is required")
+		result.Add(validation.Required("provider"))
 	}
 	if c.Model == "" {
-		return errors.New("model is required")
+		result.Add(validation.Required("model"))
 	}
-	if c.Temperature < 0 || c.Temperature > 2 {
-		return errors.New("temperature must be between 0 and 2")
+	if c.Temperature < 0 {
+		result.Addf("temperature", validation.CodeMinimum, "must be ≥ 0, got %g", c.Temperature)
+	} else if c.Temperature > 2 {
+		result.Addf("temperature", validation.CodeMaximum, "must be ≤ 2, got %g", c.Temperature)
 	}
-	return nil
+	return result.Err()
 }
 
 // ExecutionOptions provides options for agent execution
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/lexlapax/go-llmspell/pkg/validation"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -93,6 +94,18 @@ func TestAgentInterface(t *testing.T) {
 		}
 	})
 
+	t.Run("Config validation messages", func(t *testing.T) {
+		err := Config{Name: "test-agent", Temperature: 5}.Validate()
+		require.Error(t, err)
+		assert.Equal(t, "field 'provider' is required; field 'model' is required; field 'temperature' must be ≤ 2, got 5", err.Error())
+
+		var result *validation.Result
+		require.ErrorAs(t, err, &result)
+		require.Len(t, result.Errors, 3)
+		assert.Equal(t, validation.CodeMaximum, result.Errors[2].Code)
+		assert.Equal(t, "temperature", result.Errors[2].Field)
+	})
+
 	t.Run("Message types", func(t *testing.T) {
 		// Test message creation
 		userMsg := NewUserMessage("Hello")
@@ -48,8 +48,13 @@ func (t *toolAdapter) Execute(ctx context.Context, params interface{}) (interfac
 
 // ParameterSchema returns the tool's parameter schema
 func (t *toolAdapter) ParameterSchema() *schemadomain.Schema {
-	// Get the raw JSON schema from our tool
-	rawSchema := t.tool.Parameters()
+	// Get the raw JSON schema from our tool, with references inlined
+	rawSchema, err := tools.ResolveRefs(t.tool.Parameters())
+	if err != nil {
+		return &schemadomain.Schema{
+			Type: "object",
+		}
+	}
 
 	// Parse it into a map
 	var schemaMap map[string]interface{}
@@ -0,0 +1,65 @@
+// ABOUTME: Exposes a tool bridge's tools to agents as a tools.Registry
+// ABOUTME: Agent tool calls go through ExecuteTool, so script tools, guards, the result cache, and stats apply
+
+package bridge
+
+import (
+	"context"
+
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+// agentTools is the registry view of a tool bridge that agents use
+type agentTools struct {
+	tb *ToolBridge
+}
+
+// agentTool runs a tool through the bridge it came from
+type agentTool struct {
+	tools.Tool
+	tb *ToolBridge
+}
+
+// AgentTools returns the bridge's tools as a registry for agents. Agents
+// then call every tool a spell can, including those it registered, and
+// their calls are limited, cached, and counted like the spell's own.
+func (tb *ToolBridge) AgentTools() tools.Registry {
+	return agentTools{tb: tb}
+}
+
+// Register adds a tool to the bridge
+func (r agentTools) Register(tool tools.Tool) error {
+	if err := r.tb.registry.Register(tool); err != nil {
+		return err
+	}
+	r.tb.toolChanged(tool.Name())
+	return nil
+}
+
+// Get returns a tool whose calls go through the bridge
+func (r agentTools) Get(name string) (tools.Tool, error) {
+	tool, err := r.tb.registry.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return &agentTool{Tool: tool, tb: r.tb}, nil
+}
+
+// List returns the bridge's tools, whose calls go through the bridge
+func (r agentTools) List() []tools.Tool {
+	list := r.tb.registry.List()
+	for i, tool := range list {
+		list[i] = &agentTool{Tool: tool, tb: r.tb}
+	}
+	return list
+}
+
+// Remove unregisters a tool from the bridge
+func (r agentTools) Remove(name string) error {
+	return r.tb.RemoveTool(name)
+}
+
+// Execute calls the tool through the bridge
+func (t *agentTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return t.tb.ExecuteTool(ctx, t.Name(), params)
+}
@@ -0,0 +1,45 @@
+// ABOUTME: Tests for the registry view of a tool bridge that agents use
+// ABOUTME: Validates that agent tool calls reach script tools through the bridge and are counted
+
+package bridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+func TestAgentTools(t *testing.T) {
+	tb := NewToolBridge(tools.NewRegistry())
+	tb.RegisterToolWith("greet", "Greets", map[string]interface{}{"type": "object"},
+		func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			return "hello " + params["name"].(string), nil
+		}, ToolOptions{})
+
+	registry := tb.AgentTools()
+	tool, err := registry.Get("greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := tool.Execute(context.Background(), map[string]interface{}{"name": "ada"})
+	if err != nil || result != "hello ada" {
+		t.Errorf("Execute() = %v, %v", result, err)
+	}
+	if stats := tb.ExecutionStats(); len(stats) != 1 || stats[0].Calls != 1 {
+		t.Errorf("Expected the agent's call to be counted, got %+v", stats)
+	}
+
+	if list := registry.List(); len(list) != 1 || list[0].Name() != "greet" {
+		t.Errorf("List() = %v", list)
+	}
+	if _, err := registry.Get("missing"); err == nil {
+		t.Error("Expected a missing tool to fail")
+	}
+	if err := registry.Remove("greet"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tb.GetTool("greet"); err == nil {
+		t.Error("Expected the tool to be removed from the bridge")
+	}
+}
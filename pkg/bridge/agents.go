@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/lexlapax/go-llmspell/pkg/agents"
+	"github.com/lexlapax/go-llmspell/pkg/tools"
 )
 
 // AgentBridge provides script access to the agent system
@@ -42,6 +43,9 @@ type AgentBridge interface {
 type agentBridge struct {
 	ctx      context.Context
 	registry agents.Registry
+
+	// tools resolves agents' tool names; nil uses tools.DefaultRegistry
+	tools tools.Registry
 }
 
 // NewAgentBridge creates a new agent bridge
@@ -52,6 +56,16 @@ func NewAgentBridge(ctx context.Context) (AgentBridge, error) {
 	}, nil
 }
 
+// NewAgentBridgeWithTools creates an agent bridge whose agents find their
+// tools in registry, such as the tools of a spell's tool bridge
+func NewAgentBridgeWithTools(ctx context.Context, registry tools.Registry) (AgentBridge, error) {
+	return &agentBridge{
+		ctx:      ctx,
+		registry: agents.DefaultRegistry(),
+		tools:    registry,
+	}, nil
+}
+
 // Create creates a new agent with the given configuration
 func (b *agentBridge) Create(config map[string]interface{}) (string, error) {
 	// Convert map to agents.Config
@@ -85,6 +99,8 @@ func (b *agentBridge) Create(config map[string]interface{}) (string, error) {
 		agentConfig.MaxTokens = int(maxTokens)
 	} else if maxTokens, ok := config["maxTokens"].(int); ok {
 		agentConfig.MaxTokens = maxTokens
+	} else if maxTokens, ok := config["maxTokens"].(int64); ok {
+		agentConfig.MaxTokens = int(maxTokens)
 	}
 
 	if temperature, ok := config["temperature"].(float64); ok {
@@ -95,6 +111,8 @@ func (b *agentBridge) Create(config map[string]interface{}) (string, error) {
 		agentConfig.Timeout = time.Duration(timeout) * time.Second
 	} else if timeout, ok := config["timeout"].(int); ok {
 		agentConfig.Timeout = time.Duration(timeout) * time.Second
+	} else if timeout, ok := config["timeout"].(int64); ok {
+		agentConfig.Timeout = time.Duration(timeout) * time.Second
 	}
 
 	// Handle tools array
@@ -110,6 +128,7 @@ func (b *agentBridge) Create(config map[string]interface{}) (string, error) {
 	}
 
 	// Create the agent
+	agentConfig.ToolRegistry = b.tools
 	agent, err := b.registry.Create(agentConfig)
 	if err != nil {
 		return "", err
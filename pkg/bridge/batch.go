@@ -0,0 +1,179 @@
+// ABOUTME: Batch LLM requests: a pool of workers sends many prompts at once, each with its own timeout
+// ABOUTME: Reports every prompt's response or error, and the estimated token usage of the whole batch
+
+package bridge
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultBatchConcurrency is how many requests of a batch are in flight at
+// once unless the options say otherwise
+const DefaultBatchConcurrency = 4
+
+// BatchRequest is one request of a batch: a prompt, or a conversation when
+// Messages is set
+type BatchRequest struct {
+	Prompt   string
+	Messages []ChatMessage
+}
+
+// BatchOptions configure a batch
+type BatchOptions struct {
+	// Concurrency is how many requests run at once; zero uses
+	// DefaultBatchConcurrency
+	Concurrency int
+
+	// Timeout limits each request; zero leaves them to the call timeout
+	Timeout time.Duration
+
+	// MaxTokens, when above zero, sends prompts as completions of at most
+	// this many tokens instead of chat messages
+	MaxTokens int
+}
+
+// BatchResult is the outcome of one request. Token counts are estimates,
+// as providers do not report usage through the bridge.
+type BatchResult struct {
+	Index          int           `json:"index"`
+	Response       string        `json:"response,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	Duration       time.Duration `json:"duration"`
+	PromptTokens   int           `json:"prompt_tokens"`
+	ResponseTokens int           `json:"response_tokens"`
+}
+
+// OK reports whether the request succeeded
+func (r BatchResult) OK() bool {
+	return r.Error == ""
+}
+
+// BatchReport is the outcome of a batch: a result per request, in the order
+// of the requests, and totals over all of them
+type BatchReport struct {
+	Results        []BatchResult `json:"results"`
+	Succeeded      int           `json:"succeeded"`
+	Failed         int           `json:"failed"`
+	PromptTokens   int           `json:"prompt_tokens"`
+	ResponseTokens int           `json:"response_tokens"`
+	Duration       time.Duration `json:"duration"`
+}
+
+// ToMap returns the totals of the report for scripts, with durations in
+// seconds; the results are left out
+func (r BatchReport) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"succeeded":       r.Succeeded,
+		"failed":          r.Failed,
+		"prompt_tokens":   r.PromptTokens,
+		"response_tokens": r.ResponseTokens,
+		"duration":        r.Duration.Seconds(),
+	}
+}
+
+// ToMap returns the result for scripts, with the duration in seconds
+func (r BatchResult) ToMap() map[string]interface{} {
+	result := map[string]interface{}{
+		"ok":              r.OK(),
+		"duration":        r.Duration.Seconds(),
+		"prompt_tokens":   r.PromptTokens,
+		"response_tokens": r.ResponseTokens,
+	}
+	if r.OK() {
+		result["response"] = r.Response
+	} else {
+		result["error"] = r.Error
+	}
+	return result
+}
+
+// Batch sends requests through a pool of opts.Concurrency workers and
+// waits for all of them. A request that fails does not stop the others;
+// its result carries the error. Once ctx ends, requests not yet sent fail
+// with its cause.
+func (b *LLMBridge) Batch(ctx context.Context, requests []BatchRequest, opts BatchOptions) BatchReport {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	if concurrency > len(requests) {
+		concurrency = len(requests)
+	}
+
+	start := time.Now()
+	report := BatchReport{Results: make([]BatchResult, len(requests))}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				report.Results[i] = b.batchRequest(ctx, i, requests[i], opts)
+			}
+		}()
+	}
+
+feed:
+	for i := range requests {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			for ; i < len(requests); i++ {
+				report.Results[i] = BatchResult{Index: i, Error: context.Cause(ctx).Error()}
+			}
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	for _, result := range report.Results {
+		if result.OK() {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+		report.PromptTokens += result.PromptTokens
+		report.ResponseTokens += result.ResponseTokens
+	}
+	report.Duration = time.Since(start)
+	return report
+}
+
+// batchRequest sends one request of a batch
+func (b *LLMBridge) batchRequest(ctx context.Context, index int, request BatchRequest, opts BatchOptions) BatchResult {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	prompt := request.Prompt
+	if request.Messages != nil {
+		prompt = Transcript(request.Messages)
+	}
+	result := BatchResult{Index: index, PromptTokens: EstimateTokens(prompt)}
+	start := time.Now()
+
+	var response string
+	var err error
+	switch {
+	case request.Messages != nil:
+		response, err = b.ChatMessages(ctx, request.Messages)
+	case opts.MaxTokens > 0:
+		response, err = b.Complete(ctx, prompt, opts.MaxTokens)
+	default:
+		response, err = b.Chat(ctx, prompt)
+	}
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Response = response
+	result.ResponseTokens = EstimateTokens(response)
+	return result
+}
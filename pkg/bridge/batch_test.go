@@ -0,0 +1,147 @@
+// ABOUTME: Tests for batch LLM requests
+// ABOUTME: Validates the worker pool limit, result order, partial failures, timeouts, and token totals
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+)
+
+func TestBatch(t *testing.T) {
+	// batchBridge answers "echo: <prompt>" after a short wait, fails
+	// prompts starting with "fail", and hangs on "hang" until cancelled
+	batchBridge := func(inFlight, peak *int) *LLMBridge {
+		var mu sync.Mutex
+		answer := func(ctx context.Context, prompt string) (string, error) {
+			mu.Lock()
+			*inFlight++
+			if *inFlight > *peak {
+				*peak = *inFlight
+			}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				*inFlight--
+				mu.Unlock()
+			}()
+
+			switch {
+			case strings.HasPrefix(prompt, "fail"):
+				return "", errors.New("provider refused")
+			case prompt == "hang":
+				<-ctx.Done()
+				return "", ctx.Err()
+			}
+			time.Sleep(5 * time.Millisecond)
+			return "echo: " + prompt, nil
+		}
+		return &LLMBridge{
+			providers: map[string]domain.Provider{"mock": &MockProvider{
+				generateMsgFunc: func(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.Response, error) {
+					response, err := answer(ctx, messages[len(messages)-1].Content[0].Text)
+					return domain.Response{Content: response}, err
+				},
+				generateFunc: func(ctx context.Context, prompt string, options ...domain.Option) (string, error) {
+					return answer(ctx, prompt)
+				},
+			}},
+			current: "mock",
+		}
+	}
+
+	t.Run("keeps order and limits concurrency", func(t *testing.T) {
+		var inFlight, peak int
+		b := batchBridge(&inFlight, &peak)
+		requests := make([]BatchRequest, 10)
+		for i := range requests {
+			requests[i] = BatchRequest{Prompt: strings.Repeat("x", i+1)}
+		}
+
+		report := b.Batch(context.Background(), requests, BatchOptions{Concurrency: 3})
+		if report.Succeeded != 10 || report.Failed != 0 {
+			t.Fatalf("Unexpected totals: %+v", report)
+		}
+		for i, result := range report.Results {
+			if result.Index != i || result.Response != "echo: "+requests[i].Prompt {
+				t.Errorf("Result %d = %+v", i, result)
+			}
+		}
+		if peak > 3 || peak < 2 {
+			t.Errorf("Expected up to 3 requests at once, saw %d", peak)
+		}
+		if report.PromptTokens == 0 || report.ResponseTokens <= report.PromptTokens {
+			t.Errorf("Unexpected token totals: %d prompt, %d response", report.PromptTokens, report.ResponseTokens)
+		}
+	})
+
+	t.Run("reports partial failures and timeouts", func(t *testing.T) {
+		var inFlight, peak int
+		b := batchBridge(&inFlight, &peak)
+		requests := []BatchRequest{
+			{Prompt: "one"},
+			{Prompt: "fail two"},
+			{Prompt: "hang"},
+			{Messages: []ChatMessage{{Role: "user", Content: []ChatPart{{Type: "text", Text: "four"}}}}},
+		}
+
+		report := b.Batch(context.Background(), requests, BatchOptions{Timeout: 50 * time.Millisecond})
+		if report.Succeeded != 2 || report.Failed != 2 {
+			t.Fatalf("Unexpected totals: %+v", report)
+		}
+		if !strings.Contains(report.Results[1].Error, "provider refused") {
+			t.Errorf("Expected the provider's error, got %q", report.Results[1].Error)
+		}
+		if !strings.Contains(report.Results[2].Error, "deadline") {
+			t.Errorf("Expected the request to time out, got %q", report.Results[2].Error)
+		}
+		if report.Results[3].Response != "echo: four" {
+			t.Errorf("Expected messages to be sent as a conversation, got %+v", report.Results[3])
+		}
+		if result := report.Results[1].ToMap(); result["ok"] != false || result["error"] == nil {
+			t.Errorf("Unexpected ToMap(): %v", result)
+		}
+	})
+
+	t.Run("sends completions with max tokens", func(t *testing.T) {
+		var inFlight, peak int
+		b := batchBridge(&inFlight, &peak)
+		var limits []int
+		var mu sync.Mutex
+		provider := b.providers["mock"].(*MockProvider)
+		answer := provider.generateFunc
+		provider.generateFunc = func(ctx context.Context, prompt string, options ...domain.Option) (string, error) {
+			opts := &domain.ProviderOptions{}
+			for _, option := range options {
+				option(opts)
+			}
+			mu.Lock()
+			limits = append(limits, opts.MaxTokens)
+			mu.Unlock()
+			return answer(ctx, prompt)
+		}
+
+		report := b.Batch(context.Background(), []BatchRequest{{Prompt: "a"}, {Prompt: "b"}}, BatchOptions{MaxTokens: 16})
+		if report.Succeeded != 2 || len(limits) != 2 || limits[0] != 16 {
+			t.Errorf("Expected two completions of 16 tokens, got %+v and %v", report, limits)
+		}
+	})
+
+	t.Run("fails requests not sent before cancellation", func(t *testing.T) {
+		var inFlight, peak int
+		b := batchBridge(&inFlight, &peak)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		report := b.Batch(ctx, []BatchRequest{{Prompt: "a"}, {Prompt: "b"}, {Prompt: "c"}}, BatchOptions{Concurrency: 1})
+		if report.Succeeded+report.Failed != 3 || report.Failed < 2 {
+			t.Errorf("Expected the unsent requests to fail, got %+v", report)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+// ABOUTME: Call budgets that stop a spell run once it has made too many calls
+// ABOUTME: The call over budget is refused and cancels the run with a budget cause
+
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+)
+
+// budgetWarnPercent is how much of a budget may be used before a warning
+const budgetWarnPercent = 80
+
+// CallBudget caps how many calls a spell run, including its sub-spells, may
+// make to the methods it counts. Unlike a rate limit, which only refuses
+// calls for a while, running out of budget ends the run: the call over
+// budget is refused and the run is cancelled with engine.ErrBudgetExhausted.
+// It is safe for concurrent use.
+type CallBudget struct {
+	limit  int
+	counts func(method string) bool
+	cancel context.CancelCauseFunc
+
+	mu       sync.Mutex
+	used     int
+	warnings *Warnings
+	warned   bool
+}
+
+// NewCallBudget allows limit calls to the methods counts accepts, given as
+// "module.method", and cancels the run through cancel when they run out
+func NewCallBudget(limit int, counts func(method string) bool, cancel context.CancelCauseFunc) *CallBudget {
+	return &CallBudget{limit: limit, counts: counts, cancel: cancel}
+}
+
+// SetWarnings warns through w, once, when the run has used 80% of the budget
+func (b *CallBudget) SetWarnings(w *Warnings) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.warnings = w
+}
+
+// CallArgs are the arguments of a call, as CallCost looks at them in any
+// script engine. i counts from 0.
+type CallArgs interface {
+	// Len returns how many items argument i holds, if it is a list
+	Len(i int) (int, bool)
+	// Number returns the number argument i holds under field, if it is a
+	// table or object with one
+	Number(i int, field string) (float64, bool)
+}
+
+// CallCost is how many budgeted calls a call to method with args makes:
+// one per prompt for llm.batch, one per attempt it may take for
+// llm.generate_structured, else one. Every engine prices calls with it.
+func CallCost(method string, args CallArgs) int {
+	switch method {
+	case "llm.batch":
+		if n, ok := args.Len(0); ok {
+			return n
+		}
+	case "llm.generate_structured":
+		retries := DefaultStructuredRetries
+		if n, ok := args.Number(2, "retries"); ok && n >= 0 {
+			retries = int(n)
+		}
+		return retries + 1
+	}
+	return 1
+}
+
+// Counts reports whether calls to method draw on the budget
+func (b *CallBudget) Counts(method string) bool {
+	return b != nil && b.counts(method)
+}
+
+// Spend takes one call to method from the budget. Once the budget is used
+// up it cancels the run and returns an error wrapping
+// engine.ErrBudgetExhausted.
+func (b *CallBudget) Spend(method string) error {
+	return b.SpendN(method, 1)
+}
+
+// SpendN takes n calls to method from the budget at once, for a method
+// that makes several, such as a batch. When fewer than n are left, none
+// are taken and the run is cancelled as by Spend.
+func (b *CallBudget) SpendN(method string, n int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.used+n > b.limit {
+		err := fmt.Errorf("%w: %s would exceed the limit of %d calls", engine.ErrBudgetExhausted, method, b.limit)
+		b.cancel(err)
+		return err
+	}
+	b.used += n
+	if b.warnings != nil && !b.warned && b.used*100 >= b.limit*budgetWarnPercent {
+		b.warned = true
+		b.warnings.Add(WarnBudget, fmt.Sprintf("%d of %d budgeted calls used", b.used, b.limit),
+			map[string]interface{}{"used": b.used, "limit": b.limit})
+	}
+	return nil
+}
+
+// Used returns the number of calls made against the budget
+func (b *CallBudget) Used() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.used
+}
@@ -0,0 +1,106 @@
+// ABOUTME: Tests for call budgets
+// ABOUTME: Validates that only counted methods spend budget, what calls cost, and that running out cancels the run
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+)
+
+func TestCallBudget(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	budget := NewCallBudget(2, func(method string) bool { return method == "llm.chat" }, cancel)
+
+	if !budget.Counts("llm.chat") || budget.Counts("llm.list_providers") {
+		t.Fatal("Expected only llm.chat to count")
+	}
+	for i := 0; i < 2; i++ {
+		if err := budget.Spend("llm.chat"); err != nil {
+			t.Fatalf("Expected call %d within budget: %v", i+1, err)
+		}
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Expected the run to continue within budget")
+	}
+
+	err := budget.Spend("llm.chat")
+	if !errors.Is(err, engine.ErrBudgetExhausted) {
+		t.Fatalf("Expected ErrBudgetExhausted, got %v", err)
+	}
+	if !errors.Is(context.Cause(ctx), engine.ErrBudgetExhausted) {
+		t.Errorf("Expected the run cancelled for its budget, got %v", context.Cause(ctx))
+	}
+	if budget.Used() != 2 {
+		t.Errorf("Expected 2 calls used, got %d", budget.Used())
+	}
+
+	var none *CallBudget
+	if none.Counts("llm.chat") || none.Used() != 0 {
+		t.Error("Expected a nil budget to count nothing")
+	}
+}
+
+func TestCallBudgetWarning(t *testing.T) {
+	_, cancel := context.WithCancelCause(context.Background())
+	budget := NewCallBudget(5, func(string) bool { return true }, cancel)
+	warnings := NewWarnings()
+	budget.SetWarnings(warnings)
+
+	for i := 0; i < 3; i++ {
+		_ = budget.Spend("llm.chat")
+	}
+	if n := len(warnings.List()); n != 0 {
+		t.Fatalf("Expected no warning at 60%% of the budget, got %d", n)
+	}
+
+	_ = budget.Spend("llm.chat")
+	_ = budget.Spend("llm.chat")
+	list := warnings.List()
+	if len(list) != 1 || list[0].Source != WarnBudget || list[0].Count != 1 {
+		t.Errorf("Expected one budget warning, got %+v", list)
+	}
+}
+
+// callArgs is a list of arguments as CallCost reads them
+type callArgs []interface{}
+
+func (a callArgs) Len(i int) (int, bool) {
+	if i < len(a) {
+		list, ok := a[i].([]interface{})
+		return len(list), ok
+	}
+	return 0, false
+}
+
+func (a callArgs) Number(i int, field string) (float64, bool) {
+	if i < len(a) {
+		fields, _ := a[i].(map[string]interface{})
+		n, ok := fields[field].(float64)
+		return n, ok
+	}
+	return 0, false
+}
+
+func TestCallCost(t *testing.T) {
+	tests := []struct {
+		method string
+		args   callArgs
+		want   int
+	}{
+		{"llm.chat", callArgs{"hi"}, 1},
+		{"llm.batch", callArgs{[]interface{}{"a", "b", "c"}}, 3},
+		{"llm.batch", callArgs{}, 1},
+		{"llm.generate_structured", callArgs{"a", nil}, DefaultStructuredRetries + 1},
+		{"llm.generate_structured", callArgs{"a", nil, map[string]interface{}{"retries": float64(0)}}, 1},
+		{"llm.generate_structured", callArgs{"a", nil, map[string]interface{}{"retries": float64(-1)}}, DefaultStructuredRetries + 1},
+	}
+	for _, tt := range tests {
+		if got := CallCost(tt.method, tt.args); got != tt.want {
+			t.Errorf("CallCost(%s, %v) = %d, want %d", tt.method, tt.args, got, tt.want)
+		}
+	}
+}
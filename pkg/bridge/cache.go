@@ -0,0 +1,189 @@
+// ABOUTME: Key/value cache scripts use directly through the cache module, namespaced per spell
+// ABOUTME: Entries are JSON in a pluggable backend; the default keeps them in memory with LRU eviction
+
+package bridge
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CacheScript is the ResultCache stats kind for lookups scripts make
+// through the cache module
+const CacheScript = "script"
+
+// CacheBackend stores the encoded entries of script caches. Set reports
+// an error when the entry cannot be stored, such as one larger than the
+// backend allows. Implementations must be safe for concurrent use.
+type CacheBackend interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(key string)
+}
+
+// MemoryCache is a CacheBackend that keeps entries in memory and evicts
+// the least recently used once it holds more than MaxEntries entries or
+// MaxBytes bytes. A limit of zero does not apply.
+type MemoryCache struct {
+	maxEntries int
+	maxBytes   int64
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+	size    int64
+}
+
+// memoryEntry is an entry of a MemoryCache
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache creates an empty in-memory backend with the given limits
+func NewMemoryCache(maxEntries int, maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value of key unless it is missing or expired
+func (m *MemoryCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		m.remove(elem)
+		return nil, false
+	}
+	m.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set stores value under key for ttl, or until evicted when ttl is zero
+func (m *MemoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	if m.maxBytes > 0 && int64(len(value)) > m.maxBytes {
+		return fmt.Errorf("value of %d bytes is larger than the cache's limit of %d bytes", len(value), m.maxBytes)
+	}
+
+	entry := &memoryEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.entries[key]; ok {
+		m.remove(elem)
+	}
+	m.entries[key] = m.order.PushFront(entry)
+	m.size += int64(len(value))
+
+	for (m.maxEntries > 0 && m.order.Len() > m.maxEntries) || (m.maxBytes > 0 && m.size > m.maxBytes) {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+// Delete removes key
+func (m *MemoryCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.entries[key]; ok {
+		m.remove(elem)
+	}
+}
+
+// Len returns how many entries the cache holds, including expired ones
+// not yet looked up
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.order.Len()
+}
+
+func (m *MemoryCache) remove(elem *list.Element) {
+	entry := m.order.Remove(elem).(*memoryEntry)
+	delete(m.entries, entry.key)
+	m.size -= int64(len(entry.value))
+}
+
+// ScriptCacheOptions configure a ScriptCache
+type ScriptCacheOptions struct {
+	// Backend stores the entries; nil caches nothing, so every lookup
+	// misses
+	Backend CacheBackend
+
+	// Namespace keeps the keys of one spell apart from those of others
+	// sharing the backend, usually the spell's name
+	Namespace string
+
+	// Stats, when set, counts lookups under CacheScript
+	Stats *ResultCache
+}
+
+// ScriptCache is the cache a spell uses through the cache module. Values
+// are stored as JSON, so they come back as plain maps, lists, strings,
+// numbers and booleans.
+type ScriptCache struct {
+	opts ScriptCacheOptions
+}
+
+// NewScriptCache creates a spell's view of a cache backend
+func NewScriptCache(opts ScriptCacheOptions) *ScriptCache {
+	return &ScriptCache{opts: opts}
+}
+
+// Get returns the value cached under key
+func (c *ScriptCache) Get(key string) (interface{}, bool) {
+	if c.opts.Backend == nil {
+		c.opts.Stats.Bypass(CacheScript)
+		return nil, false
+	}
+	data, ok := c.opts.Backend.Get(c.key(key))
+	var value interface{}
+	if ok && json.Unmarshal(data, &value) != nil {
+		ok = false
+	}
+	c.opts.Stats.Record(CacheScript, ok)
+	return value, ok
+}
+
+// Set caches value under key for ttl; zero keeps it until the backend
+// evicts it
+func (c *ScriptCache) Set(key string, value interface{}, ttl time.Duration) error {
+	if c.opts.Backend == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cannot cache value: %w", err)
+	}
+	return c.opts.Backend.Set(c.key(key), data, ttl)
+}
+
+// Delete removes key
+func (c *ScriptCache) Delete(key string) {
+	if c.opts.Backend != nil {
+		c.opts.Backend.Delete(c.key(key))
+	}
+}
+
+func (c *ScriptCache) key(key string) string {
+	return c.opts.Namespace + "\x00" + key
+}
@@ -0,0 +1,108 @@
+// ABOUTME: Tests for the cache scripts use through the cache module
+// ABOUTME: Covers LRU eviction, size limits, TTL expiry, namespaces, and lookup stats
+
+package bridge
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	t.Run("evicts the least recently used entry", func(t *testing.T) {
+		m := NewMemoryCache(2, 0)
+		_ = m.Set("a", []byte("1"), 0)
+		_ = m.Set("b", []byte("2"), 0)
+		m.Get("a")
+		_ = m.Set("c", []byte("3"), 0)
+		if _, ok := m.Get("b"); ok {
+			t.Error("Expected b to be evicted")
+		}
+		if _, ok := m.Get("a"); !ok {
+			t.Error("Expected a recently used entry to stay")
+		}
+		if m.Len() != 2 {
+			t.Errorf("Expected 2 entries, got %d", m.Len())
+		}
+	})
+
+	t.Run("limits the total size", func(t *testing.T) {
+		m := NewMemoryCache(0, 10)
+		_ = m.Set("a", []byte("123456"), 0)
+		_ = m.Set("b", []byte("123456"), 0)
+		if _, ok := m.Get("a"); ok || m.Len() != 1 {
+			t.Error("Expected the oldest entry to make room")
+		}
+		_ = m.Set("b", []byte("12"), 0)
+		_ = m.Set("c", []byte("12345678"), 0)
+		if m.Len() != 2 {
+			t.Errorf("Expected replacing an entry to free its size, got %d entries", m.Len())
+		}
+
+		err := m.Set("big", []byte("12345678901"), 0)
+		if err == nil || !strings.Contains(err.Error(), "larger than the cache's limit of 10 bytes") {
+			t.Errorf("Expected an oversized value to be refused, got %v", err)
+		}
+		if m.Len() != 2 {
+			t.Error("Expected a refused value to evict nothing")
+		}
+	})
+
+	t.Run("expires entries", func(t *testing.T) {
+		m := NewMemoryCache(0, 0)
+		_ = m.Set("a", []byte("1"), time.Millisecond)
+		_ = m.Set("b", []byte("2"), 0)
+		time.Sleep(5 * time.Millisecond)
+		if _, ok := m.Get("a"); ok {
+			t.Error("Expected the entry to expire")
+		}
+		if _, ok := m.Get("b"); !ok {
+			t.Error("Expected an entry without a TTL to stay")
+		}
+		m.Delete("b")
+		if m.Len() != 0 {
+			t.Error("Expected Delete to remove the entry")
+		}
+	})
+}
+
+func TestScriptCache(t *testing.T) {
+	backend := NewMemoryCache(0, 0)
+	stats := NewResultCache(ResultCacheOptions{})
+	a := NewScriptCache(ScriptCacheOptions{Backend: backend, Namespace: "a", Stats: stats})
+	b := NewScriptCache(ScriptCacheOptions{Backend: backend, Namespace: "b", Stats: stats})
+
+	if err := a.Set("report", map[string]interface{}{"pages": 3}, 0); err != nil {
+		t.Fatal(err)
+	}
+	value, ok := a.Get("report")
+	if !ok || value.(map[string]interface{})["pages"] != float64(3) {
+		t.Errorf("Expected the cached value, got %v", value)
+	}
+	if _, ok := b.Get("report"); ok {
+		t.Error("Expected spells not to see each other's keys")
+	}
+	a.Delete("report")
+	if _, ok := a.Get("report"); ok {
+		t.Error("Expected the key to be deleted")
+	}
+	if got := stats.Stats()[CacheScript]; got.Hits != 1 || got.Misses != 2 {
+		t.Errorf("Expected 1 hit and 2 misses, got %+v", got)
+	}
+
+	if err := a.Set("fn", func() {}, 0); err == nil {
+		t.Error("Expected a value that cannot be encoded to be refused")
+	}
+
+	off := NewScriptCache(ScriptCacheOptions{Stats: stats})
+	if err := off.Set("k", "v", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := off.Get("k"); ok {
+		t.Error("Expected a cache without a backend to keep nothing")
+	}
+	if stats.Stats()[CacheScript].Bypassed != 1 {
+		t.Error("Expected the lookup to count as bypassed")
+	}
+}
@@ -0,0 +1,141 @@
+// ABOUTME: Audit logging for LLM calls, one correlation ID per call
+// ABOUTME: Logs request and response metadata to a slog sink; prompt and response text only on opt-in
+
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// CallLogOptions configures what the LLM call log records
+type CallLogOptions struct {
+	// RunID ties every call to the spell run that made it
+	RunID string
+
+	// LogBodies adds the prompt and response text. It is off by default
+	// because prompts often carry personal or secret data; without it only
+	// a hash of the prompt is logged.
+	LogBodies bool
+
+	// SpanFromContext returns the trace and span IDs of the caller, for
+	// example from an OpenTelemetry span, so records can be joined with traces
+	SpanFromContext func(ctx context.Context) (traceID, spanID string)
+}
+
+// CallLogger writes an "llm request" and an "llm response" record for every
+// LLM call. A nil CallLogger logs nothing.
+type CallLogger struct {
+	logger *slog.Logger
+	opts   CallLogOptions
+}
+
+// NewCallLogger creates a call log writing to logger
+func NewCallLogger(logger *slog.Logger, opts CallLogOptions) *CallLogger {
+	return &CallLogger{logger: logger, opts: opts}
+}
+
+// NewCorrelationID returns a random 16-character hex ID
+func NewCorrelationID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// PromptHash identifies a prompt without revealing it
+func PromptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// loggedCall is one LLM call in progress
+type loggedCall struct {
+	log    *CallLogger
+	ctx    context.Context
+	id     string
+	method string
+	start  time.Time
+}
+
+// begin logs the request for a call to model and returns the call to finish
+func (l *CallLogger) begin(ctx context.Context, method, model string, target ModelTarget, prompt string) *loggedCall {
+	if l == nil {
+		return nil
+	}
+
+	call := &loggedCall{log: l, ctx: ctx, id: NewCorrelationID(), method: method, start: time.Now()}
+	attrs := append(call.common(),
+		slog.String("model", model),
+		slog.String("target", target.String()),
+		slog.Int("prompt_tokens", EstimateTokens(prompt)),
+		slog.String("prompt_hash", PromptHash(prompt)),
+	)
+	if l.opts.LogBodies {
+		attrs = append(attrs, slog.String("prompt", prompt))
+	}
+	l.logger.LogAttrs(ctx, slog.LevelInfo, "llm request", attrs...)
+	return call
+}
+
+// end logs the response. target is the model that answered, which differs
+// from the requested one after a context adjustment.
+func (c *loggedCall) end(target ModelTarget, adjustment *ContextAdjustment, response, finishReason string, err error) {
+	if c == nil {
+		return
+	}
+
+	attrs := append(c.common(),
+		slog.String("target", target.String()),
+		slog.Int("response_tokens", EstimateTokens(response)),
+		slog.String("finish_reason", finishReason),
+		slog.Duration("latency", time.Since(c.start)),
+	)
+	if adjustment != nil {
+		attrs = append(attrs, slog.String("adjustment", adjustment.String()))
+	}
+	if c.log.opts.LogBodies {
+		attrs = append(attrs, slog.String("response", response))
+	}
+
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	c.log.logger.LogAttrs(c.ctx, level, "llm response", attrs...)
+}
+
+// common returns the attributes shared by the request and response records
+func (c *loggedCall) common() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("correlation_id", c.id),
+		slog.String("method", c.method),
+	}
+	if c.log.opts.RunID != "" {
+		attrs = append(attrs, slog.String("run_id", c.log.opts.RunID))
+	}
+	if c.log.opts.SpanFromContext != nil {
+		if traceID, spanID := c.log.opts.SpanFromContext(c.ctx); traceID != "" {
+			attrs = append(attrs, slog.String("trace_id", traceID), slog.String("span_id", spanID))
+		}
+	}
+	return attrs
+}
+
+// finishReason describes how a call ended. Providers do not report their
+// own finish reasons through go-llms, so this only tells success from failure
+// and calls the watchdog abandoned.
+func finishReason(err error) string {
+	if errors.Is(err, ErrCallTimeout) {
+		return "timeout"
+	}
+	if err != nil {
+		return "error"
+	}
+	return "stop"
+}
@@ -0,0 +1,112 @@
+// ABOUTME: Tests for the LLM call audit log
+// ABOUTME: Validates correlated request/response records, redaction, and trace IDs
+
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+)
+
+// decodeRecords parses JSON log lines
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestCallLog(t *testing.T) {
+	prompt := "my secret prompt"
+
+	t.Run("correlates request and response without bodies", func(t *testing.T) {
+		var buf bytes.Buffer
+		bridge := &LLMBridge{
+			providers: map[string]domain.Provider{"mock": &MockProvider{}},
+			current:   "mock",
+		}
+		bridge.SetCallLogger(NewCallLogger(slog.New(slog.NewJSONHandler(&buf, nil)), CallLogOptions{RunID: "run-1"}))
+
+		if _, err := bridge.Chat(context.Background(), prompt); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(buf.String(), "secret") || strings.Contains(buf.String(), "mock chat response") {
+			t.Errorf("Expected bodies to be left out by default: %s", buf.String())
+		}
+
+		records := decodeRecords(t, &buf)
+		if len(records) != 2 {
+			t.Fatalf("Expected request and response records, got %d", len(records))
+		}
+		request, response := records[0], records[1]
+		if request["msg"] != "llm request" || response["msg"] != "llm response" {
+			t.Errorf("Unexpected messages: %v, %v", request["msg"], response["msg"])
+		}
+		if request["correlation_id"] == "" || request["correlation_id"] != response["correlation_id"] {
+			t.Errorf("Expected a shared correlation ID, got %v and %v", request["correlation_id"], response["correlation_id"])
+		}
+		if request["run_id"] != "run-1" || request["method"] != "chat" || request["target"] != "mock" {
+			t.Errorf("Unexpected request record: %v", request)
+		}
+		if request["prompt_hash"] != PromptHash(prompt) {
+			t.Errorf("Expected prompt hash %s, got %v", PromptHash(prompt), request["prompt_hash"])
+		}
+		if response["finish_reason"] != "stop" || response["response_tokens"].(float64) <= 0 {
+			t.Errorf("Unexpected response record: %v", response)
+		}
+		if _, ok := response["latency"]; !ok {
+			t.Error("Expected latency in the response record")
+		}
+	})
+
+	t.Run("logs bodies, errors, and spans when asked", func(t *testing.T) {
+		var buf bytes.Buffer
+		bridge := &LLMBridge{
+			providers: map[string]domain.Provider{"mock": &MockProvider{
+				generateFunc: func(ctx context.Context, prompt string, options ...domain.Option) (string, error) {
+					return "", errors.New("upstream failure")
+				},
+			}},
+			current: "mock",
+		}
+		bridge.SetCallLogger(NewCallLogger(slog.New(slog.NewJSONHandler(&buf, nil)), CallLogOptions{
+			LogBodies: true,
+			SpanFromContext: func(ctx context.Context) (string, string) {
+				return "trace-1", "span-1"
+			},
+		}))
+
+		if _, err := bridge.Complete(context.Background(), prompt, 10); err == nil {
+			t.Fatal("Expected the completion to fail")
+		}
+
+		records := decodeRecords(t, &buf)
+		request, response := records[0], records[1]
+		if request["prompt"] != prompt || request["trace_id"] != "trace-1" || request["span_id"] != "span-1" {
+			t.Errorf("Unexpected request record: %v", request)
+		}
+		if response["level"] != "ERROR" || response["finish_reason"] != "error" ||
+			!strings.Contains(response["error"].(string), "upstream failure") {
+			t.Errorf("Unexpected response record: %v", response)
+		}
+	})
+
+	t.Run("nil logger is a no-op", func(t *testing.T) {
+		var log *CallLogger
+		log.begin(context.Background(), "chat", DefaultModel, ModelTarget{}, prompt).end(ModelTarget{}, nil, "", "stop", nil)
+	})
+}
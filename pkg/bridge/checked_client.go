@@ -0,0 +1,38 @@
+// ABOUTME: HTTP clients that send requests, redirects included, only to the URLs a check allows
+// ABOUTME: Bridges reaching servers on a script's behalf use them to keep to the security profile's HTTP policy
+
+package bridge
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// checkedTransport refuses requests to the URLs check refuses
+type checkedTransport struct {
+	check func(*url.URL) error
+	base  http.RoundTripper
+}
+
+// RoundTrip sends req if check allows its URL
+func (t checkedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.check(req.URL); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// checkedClient returns a client with timeout, zero for none, whose
+// requests and the redirects they follow go only where check allows; nil
+// check allows any URL
+func checkedClient(check func(*url.URL) error, timeout time.Duration) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if check != nil {
+		client.Transport = checkedTransport{check: check, base: http.DefaultTransport}
+	}
+	return client
+}
@@ -0,0 +1,215 @@
+// ABOUTME: Recovers LLM calls that fail because the prompt exceeds the context window
+// ABOUTME: Retries once on a larger-context model or with the prompt trimmed to a token budget
+
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+)
+
+// contextLengthMarkers are fragments of the errors providers return when a
+// prompt does not fit the model's context window
+var contextLengthMarkers = []string{
+	"context_length_exceeded",
+	"context length",
+	"context window",
+	"maximum context",
+	"prompt is too long",
+	"too many tokens",
+	"input token count",
+	"reduce the length",
+}
+
+// IsContextLengthError reports whether err says the prompt was too long for
+// the model
+func IsContextLengthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, marker := range contextLengthMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// EstimateTokens gives a rough token count for text, at about four
+// characters per token. It is meant for budgeting, not billing.
+func EstimateTokens(text string) int {
+	return (len([]rune(text)) + 3) / 4
+}
+
+// TrimToTokens keeps roughly the last maxTokens tokens of text, dropping
+// the oldest content first and starting at a word boundary
+func TrimToTokens(text string, maxTokens int) string {
+	runes := []rune(text)
+	keep := maxTokens * 4
+	if maxTokens <= 0 || len(runes) <= keep {
+		return text
+	}
+
+	tail := runes[len(runes)-keep:]
+	for i, r := range tail {
+		if unicode.IsSpace(r) {
+			return strings.TrimLeftFunc(string(tail[i:]), unicode.IsSpace)
+		}
+	}
+	return string(tail)
+}
+
+// ContextAdjustment describes how a call was changed to fit the context window
+type ContextAdjustment struct {
+	// Kind is "model" when the call moved to a larger model, or "trim"
+	// when the prompt was shortened
+	Kind       string `json:"kind"`
+	From       string `json:"from,omitempty"`
+	To         string `json:"to,omitempty"`
+	FromTokens int    `json:"from_tokens,omitempty"`
+	ToTokens   int    `json:"to_tokens,omitempty"`
+}
+
+func (a ContextAdjustment) String() string {
+	if a.Kind == "trim" {
+		return fmt.Sprintf("prompt trimmed from about %d to %d tokens to fit the context window", a.FromTokens, a.ToTokens)
+	}
+	return fmt.Sprintf("switched from %s to %s for a larger context window", a.From, a.To)
+}
+
+// ContextRecovery configures what the bridge does when a prompt is too long
+// for the model. Nothing is retried unless one of the fields is set.
+type ContextRecovery struct {
+	// Larger maps a model (alias, provider/model, or model name) to a
+	// larger-context model to retry with
+	Larger map[string]string
+
+	// TrimTokens, when positive, retries with the prompt cut to about this
+	// many tokens if no larger model is configured
+	TrimTokens int
+}
+
+// SetContextFallback sets the larger-context model to retry with when a
+// call to model overflows its context window
+func (b *LLMBridge) SetContextFallback(model, larger string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.recovery.Larger == nil {
+		b.recovery.Larger = make(map[string]string)
+	}
+	b.recovery.Larger[model] = larger
+}
+
+// SetContextTrim sets the token budget prompts are trimmed to on overflow;
+// zero disables trimming
+func (b *LLMBridge) SetContextTrim(tokens int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.recovery.TrimTokens = tokens
+}
+
+// SetContextAdjustmentHandler registers a function called whenever a call
+// is adjusted to fit the context window
+func (b *LLMBridge) SetContextAdjustmentHandler(fn func(ContextAdjustment)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.onAdjust = fn
+}
+
+// LastAdjustment returns the adjustment made to the most recent call, if any
+func (b *LLMBridge) LastAdjustment() (ContextAdjustment, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.lastAdjustment == nil {
+		return ContextAdjustment{}, false
+	}
+	return *b.lastAdjustment, true
+}
+
+// withContextRecovery runs call against the selected model, or the models
+// of the routing policy when one is set, and, if it fails with a
+// context-length error, retries once after moving to a larger model or
+// trimming the prompt. call is given the target each attempt goes to. It
+// returns the target of the last attempt and the adjustment made, if any.
+func (b *LLMBridge) withContextRecovery(ctx context.Context, prompt string, call func(provider domain.Provider, target ModelTarget, prompt string) error) (ModelTarget, *ContextAdjustment, error) {
+	if policy := b.getRouting(); policy != nil {
+		return b.route(ctx, *policy, prompt, call)
+	}
+	return b.recoverContext(b.GetModel(), prompt, call)
+}
+
+// recoverContext runs call against model, recovering from a context-length
+// error as withContextRecovery describes
+func (b *LLMBridge) recoverContext(model, prompt string, call func(provider domain.Provider, target ModelTarget, prompt string) error) (ModelTarget, *ContextAdjustment, error) {
+	provider, target, err := b.providerFor(model)
+	if err != nil {
+		return ModelTarget{}, nil, err
+	}
+
+	b.setAdjustment(nil)
+	err = call(provider, target, prompt)
+	if !IsContextLengthError(err) {
+		return target, nil, err
+	}
+
+	b.mu.RLock()
+	recovery := b.recovery
+	b.mu.RUnlock()
+
+	var adjustment ContextAdjustment
+	if larger := lookupLarger(recovery.Larger, model, target); larger != "" {
+		largerProvider, largerTarget, resolveErr := b.providerFor(larger)
+		if resolveErr != nil {
+			return target, nil, fmt.Errorf("%w (larger model %s unavailable: %v)", err, larger, resolveErr)
+		}
+		provider = largerProvider
+		adjustment = ContextAdjustment{Kind: "model", From: target.String(), To: largerTarget.String()}
+		target = largerTarget
+	} else if recovery.TrimTokens > 0 && EstimateTokens(prompt) > recovery.TrimTokens {
+		trimmed := TrimToTokens(prompt, recovery.TrimTokens)
+		adjustment = ContextAdjustment{Kind: "trim", FromTokens: EstimateTokens(prompt), ToTokens: EstimateTokens(trimmed)}
+		prompt = trimmed
+	} else {
+		return target, nil, err
+	}
+
+	b.setAdjustment(&adjustment)
+	if retryErr := call(provider, target, prompt); retryErr != nil {
+		return target, &adjustment, fmt.Errorf("%w (retried after %s)", retryErr, adjustment)
+	}
+	return target, &adjustment, nil
+}
+
+// lookupLarger finds the configured larger model for a logical model or
+// the target it resolved to
+func lookupLarger(larger map[string]string, model string, target ModelTarget) string {
+	for _, key := range []string{model, target.String(), target.Model} {
+		if key == "" {
+			continue
+		}
+		if to, ok := larger[key]; ok {
+			return to
+		}
+	}
+	return ""
+}
+
+func (b *LLMBridge) setAdjustment(adjustment *ContextAdjustment) {
+	b.mu.Lock()
+	b.lastAdjustment = adjustment
+	handler := b.onAdjust
+	b.mu.Unlock()
+
+	if adjustment != nil && handler != nil {
+		handler(*adjustment)
+	}
+}
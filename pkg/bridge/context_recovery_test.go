@@ -0,0 +1,142 @@
+// ABOUTME: Tests for recovering LLM calls that overflow the context window
+// ABOUTME: Validates error detection, prompt trimming, and retries on a larger model
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+)
+
+func TestIsContextLengthError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("This model's maximum context length is 8192 tokens"), true},
+		{errors.New(`{"code": "context_length_exceeded"}`), true},
+		{errors.New("prompt is too long: 250000 tokens > 200000 maximum"), true},
+		{errors.New("rate limit exceeded"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsContextLengthError(tt.err); got != tt.want {
+			t.Errorf("IsContextLengthError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestTrimToTokens(t *testing.T) {
+	text := "first line of old history\nsecond line\nthe latest question"
+	trimmed := TrimToTokens(text, 6)
+	if !strings.HasSuffix(text, trimmed) || EstimateTokens(trimmed) > 6 {
+		t.Errorf("Expected the end of the text within budget, got %q", trimmed)
+	}
+	if strings.HasPrefix(trimmed, " ") || trimmed == "" {
+		t.Errorf("Expected trimming at a word boundary, got %q", trimmed)
+	}
+	if TrimToTokens("short", 10) != "short" {
+		t.Error("Expected text within budget to be unchanged")
+	}
+}
+
+// overflowProvider fails with a context-length error for prompts longer than limit
+func overflowProvider(limit int, calls *[]string) *MockProvider {
+	return &MockProvider{
+		generateMsgFunc: func(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.Response, error) {
+			prompt := messages[0].Content[0].Text
+			*calls = append(*calls, prompt)
+			if len(prompt) > limit {
+				return domain.Response{}, errors.New("maximum context length exceeded")
+			}
+			return domain.Response{Content: "ok"}, nil
+		},
+	}
+}
+
+func TestContextRecovery(t *testing.T) {
+	longPrompt := strings.Repeat("history ", 20) + "question"
+
+	t.Run("fails without configuration", func(t *testing.T) {
+		var calls []string
+		bridge := &LLMBridge{
+			providers: map[string]domain.Provider{"small": overflowProvider(40, &calls)},
+			current:   "small",
+		}
+
+		_, err := bridge.Chat(context.Background(), longPrompt)
+		if !IsContextLengthError(err) || len(calls) != 1 {
+			t.Errorf("Expected one failed call, got %v after %d calls", err, len(calls))
+		}
+		if _, adjusted := bridge.LastAdjustment(); adjusted {
+			t.Error("Expected no adjustment")
+		}
+	})
+
+	t.Run("switches to a larger model", func(t *testing.T) {
+		var smallCalls, bigCalls []string
+		bridge := &LLMBridge{
+			providers: map[string]domain.Provider{
+				"small": overflowProvider(40, &smallCalls),
+				"big":   overflowProvider(1000, &bigCalls),
+			},
+			current: "small",
+		}
+		bridge.SetModelAliases(ModelAliases{"large": {{Provider: "big"}}})
+		bridge.SetContextFallback(DefaultModel, "large")
+
+		var reported []ContextAdjustment
+		bridge.SetContextAdjustmentHandler(func(a ContextAdjustment) {
+			reported = append(reported, a)
+		})
+
+		response, err := bridge.Chat(context.Background(), longPrompt)
+		if err != nil || response != "ok" {
+			t.Fatalf("Expected retry to succeed, got %q, %v", response, err)
+		}
+		if len(smallCalls) != 1 || len(bigCalls) != 1 || bigCalls[0] != longPrompt {
+			t.Errorf("Expected one call per model with the full prompt, got %d and %d", len(smallCalls), len(bigCalls))
+		}
+
+		adjustment, ok := bridge.LastAdjustment()
+		if !ok || adjustment.Kind != "model" || adjustment.From != "small" || adjustment.To != "big" {
+			t.Errorf("Unexpected adjustment: %+v", adjustment)
+		}
+		if len(reported) != 1 {
+			t.Errorf("Expected the handler to be told once, got %d", len(reported))
+		}
+
+		// The next call that fits clears the adjustment
+		if _, err := bridge.Chat(context.Background(), "hi"); err != nil {
+			t.Fatal(err)
+		}
+		if _, adjusted := bridge.LastAdjustment(); adjusted {
+			t.Error("Expected adjustment to be cleared")
+		}
+	})
+
+	t.Run("trims the prompt", func(t *testing.T) {
+		var calls []string
+		bridge := &LLMBridge{
+			providers: map[string]domain.Provider{"small": overflowProvider(40, &calls)},
+			current:   "small",
+		}
+		bridge.SetContextTrim(8)
+
+		if _, err := bridge.Chat(context.Background(), longPrompt); err != nil {
+			t.Fatalf("Expected trimmed retry to succeed: %v", err)
+		}
+		if len(calls) != 2 || !strings.HasSuffix(calls[1], "question") {
+			t.Errorf("Expected a retry with the end of the prompt, got %q", calls)
+		}
+
+		adjustment, ok := bridge.LastAdjustment()
+		if !ok || adjustment.Kind != "trim" || adjustment.ToTokens > 8 {
+			t.Errorf("Unexpected adjustment: %+v", adjustment)
+		}
+	})
+}
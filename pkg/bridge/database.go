@@ -0,0 +1,359 @@
+// ABOUTME: Database bridge: SQLite and Postgres databases for scripts, with parameterized queries and transactions
+// ABOUTME: Each open database is a connection pool; rows come back as column-keyed maps, and all are closed when the spell ends
+
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// Drivers for the databases scripts may open
+	_ "github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// guardedSQLite is the SQLite driver scripts use. It allows no attached
+// databases, so SQL cannot reach files CheckPath never saw through ATTACH
+// DATABASE or VACUUM INTO.
+const guardedSQLite = "sqlite3_guarded"
+
+func init() {
+	sql.Register(guardedSQLite, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			conn.SetLimit(sqlite3.SQLITE_LIMIT_ATTACHED, 0)
+			return nil
+		},
+	})
+}
+
+// Database drivers scripts may open
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// sqlDrivers maps the drivers scripts name to the registered Go drivers
+var sqlDrivers = map[string]string{
+	DriverSQLite:   guardedSQLite,
+	DriverPostgres: "postgres",
+}
+
+// defaultMaxRows is how many rows a query may return unless the options
+// say otherwise
+const defaultMaxRows = 10000
+
+// DatabaseOptions configures a DatabaseBridge
+type DatabaseOptions struct {
+	// Denied, when set, is why scripts may not open databases, such as a
+	// security profile without security.PermissionDatabase
+	Denied error
+
+	// CheckPath vets the file of a SQLite database and returns the path to
+	// open; nil allows any file. In-memory databases need no file.
+	CheckPath func(path string) (string, error)
+
+	// MaxRows caps the rows one query returns; zero means 10,000
+	MaxRows int
+}
+
+// PoolOptions sizes the connection pool of a database. Zero values keep
+// database/sql's defaults, except that SQLite in memory always uses one
+// connection, as each connection would see a database of its own.
+type PoolOptions struct {
+	MaxOpen     int
+	MaxIdle     int
+	MaxLifetime time.Duration
+	MaxIdleTime time.Duration
+}
+
+// DatabaseBridge opens databases for one spell run and closes them when
+// it ends
+type DatabaseBridge struct {
+	options DatabaseOptions
+
+	mu     sync.Mutex
+	open   map[*Database]bool
+	closed bool
+}
+
+// NewDatabaseBridge creates a bridge with options
+func NewDatabaseBridge(options DatabaseOptions) *DatabaseBridge {
+	if options.MaxRows <= 0 {
+		options.MaxRows = defaultMaxRows
+	}
+	return &DatabaseBridge{options: options, open: make(map[*Database]bool)}
+}
+
+// Drivers lists the drivers Open accepts
+func (b *DatabaseBridge) Drivers() []string {
+	drivers := make([]string, 0, len(sqlDrivers))
+	for name := range sqlDrivers {
+		drivers = append(drivers, name)
+	}
+	sort.Strings(drivers)
+	return drivers
+}
+
+// Open connects to a database: for sqlite, dsn is a file path or
+// ":memory:", with optional ?parameters; for postgres, a connection URL or
+// key=value string. The connection is checked before Open returns.
+func (b *DatabaseBridge) Open(ctx context.Context, driver, dsn string, pool PoolOptions) (*Database, error) {
+	if b.options.Denied != nil {
+		return nil, b.options.Denied
+	}
+	goDriver, ok := sqlDrivers[driver]
+	if !ok {
+		return nil, fmt.Errorf("unknown database driver %q (available: %s)", driver, strings.Join(b.Drivers(), ", "))
+	}
+
+	memory := false
+	if driver == DriverSQLite {
+		var err error
+		if dsn, memory, err = b.sqliteDSN(dsn); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open(goDriver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if memory {
+		pool.MaxOpen = 1
+	}
+	if pool.MaxOpen > 0 {
+		db.SetMaxOpenConns(pool.MaxOpen)
+	}
+	if pool.MaxIdle > 0 {
+		db.SetMaxIdleConns(pool.MaxIdle)
+	}
+	// An in-memory database lives only as long as its connection
+	if pool.MaxLifetime > 0 && !memory {
+		db.SetConnMaxLifetime(pool.MaxLifetime)
+	}
+	if pool.MaxIdleTime > 0 && !memory {
+		db.SetConnMaxIdleTime(pool.MaxIdleTime)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot connect to %s database: %w", driver, err)
+	}
+
+	d := &Database{db: db, bridge: b, Driver: driver}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		db.Close()
+		return nil, errors.New("the spell has ended")
+	}
+	b.open[d] = true
+	return d, nil
+}
+
+// sqliteDSN vets the file of a SQLite DSN, and reports whether the
+// database is in memory
+func (b *DatabaseBridge) sqliteDSN(dsn string) (string, bool, error) {
+	path, params, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	if path == "" || path == ":memory:" || memoryMode(params) {
+		return dsn, true, nil
+	}
+	if b.options.CheckPath != nil {
+		checked, err := b.options.CheckPath(path)
+		if err != nil {
+			return "", false, err
+		}
+		path = checked
+	}
+	if params != "" {
+		return "file:" + path + "?" + params, false, nil
+	}
+	return "file:" + path, false, nil
+}
+
+// memoryMode reports whether DSN parameters open the database in memory;
+// parameters that cannot be parsed do not
+func memoryMode(params string) bool {
+	query, err := url.ParseQuery(params)
+	if err != nil {
+		return false
+	}
+	modes := query["mode"]
+	for _, mode := range modes {
+		if mode != "memory" {
+			return false
+		}
+	}
+	return len(modes) > 0
+}
+
+// Close closes every database the bridge opened; later calls to Open fail
+func (b *DatabaseBridge) Close() error {
+	b.mu.Lock()
+	open := b.open
+	b.open = make(map[*Database]bool)
+	b.closed = true
+	b.mu.Unlock()
+
+	var errs []error
+	for d := range open {
+		errs = append(errs, d.db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Database is an open database and its connection pool
+type Database struct {
+	db     *sql.DB
+	bridge *DatabaseBridge
+
+	// Driver is the driver the database was opened with
+	Driver string
+}
+
+// Query runs a statement that returns rows, with args for its
+// placeholders: ? for SQLite, $1, $2, ... for Postgres
+func (d *Database) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	return queryRows(ctx, d.db, d.bridge.options.MaxRows, query, args)
+}
+
+// Exec runs a statement that returns no rows
+func (d *Database) Exec(ctx context.Context, query string, args ...interface{}) (ExecResult, error) {
+	return execStatement(ctx, d.db, query, args)
+}
+
+// Begin starts a transaction, which holds one connection of the pool until
+// it is committed or rolled back
+func (d *Database) Begin(ctx context.Context) (*Transaction, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Transaction{tx: tx, maxRows: d.bridge.options.MaxRows}, nil
+}
+
+// Stats reports on the connection pool
+func (d *Database) Stats() sql.DBStats {
+	return d.db.Stats()
+}
+
+// Close closes the database and its connections
+func (d *Database) Close() error {
+	d.bridge.mu.Lock()
+	delete(d.bridge.open, d)
+	d.bridge.mu.Unlock()
+	return d.db.Close()
+}
+
+// Transaction is a transaction on a Database
+type Transaction struct {
+	tx      *sql.Tx
+	maxRows int
+}
+
+// Query runs a statement that returns rows in the transaction
+func (t *Transaction) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	return queryRows(ctx, t.tx, t.maxRows, query, args)
+}
+
+// Exec runs a statement that returns no rows in the transaction
+func (t *Transaction) Exec(ctx context.Context, query string, args ...interface{}) (ExecResult, error) {
+	return execStatement(ctx, t.tx, query, args)
+}
+
+// Commit commits the transaction
+func (t *Transaction) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback abandons the transaction; after Commit it does nothing
+func (t *Transaction) Rollback() error {
+	if err := t.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+	return nil
+}
+
+// ExecResult is what a statement without rows did
+type ExecResult struct {
+	RowsAffected int64 `json:"rows_affected"`
+	// LastInsertID is the row SQLite inserted last; Postgres does not
+	// report it, so use RETURNING with Query there
+	LastInsertID int64 `json:"last_insert_id"`
+}
+
+// queryer is a database or a transaction
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// queryRows runs query and reads up to maxRows rows as maps keyed by
+// column; NULL columns are left out
+func queryRows(ctx context.Context, q queryer, maxRows int, query string, args []interface{}) ([]map[string]interface{}, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := []map[string]interface{}{}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if len(result) == maxRows {
+			return nil, fmt.Errorf("query returned more than %d rows; add a LIMIT", maxRows)
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if value := columnValue(values[i]); value != nil {
+				row[column] = value
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// columnValue converts a scanned value to one scripts can use: bytes
+// become strings and times RFC 3339 strings
+func columnValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+// execStatement runs a statement without rows. Drivers that cannot report
+// the last insert ID leave it zero.
+func execStatement(ctx context.Context, q queryer, query string, args []interface{}) (ExecResult, error) {
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	var exec ExecResult
+	if exec.RowsAffected, err = result.RowsAffected(); err != nil {
+		return ExecResult{}, err
+	}
+	exec.LastInsertID, _ = result.LastInsertId()
+	return exec, nil
+}
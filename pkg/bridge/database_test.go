@@ -0,0 +1,186 @@
+// ABOUTME: Tests for the database bridge against SQLite
+// ABOUTME: Validates parameterized statements, transactions, row limits, file checks, pooling, and closing
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDatabaseBridge(t *testing.T) {
+	ctx := context.Background()
+	b := NewDatabaseBridge(DatabaseOptions{MaxRows: 3})
+	db, err := b.Open(ctx, DriverSQLite, ":memory:", PoolOptions{MaxOpen: 8})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if got := db.Stats().MaxOpenConnections; got != 1 {
+		t.Errorf("Expected an in-memory database to use one connection, got %d", got)
+	}
+
+	if _, err := db.Exec(ctx, "CREATE TABLE notes (id INTEGER PRIMARY KEY, title TEXT NOT NULL, body BLOB, score REAL)"); err != nil {
+		t.Fatalf("CREATE failed: %v", err)
+	}
+	result, err := db.Exec(ctx, "INSERT INTO notes (title, body, score) VALUES (?, ?, ?)", "first", []byte("hello"), 1.5)
+	if err != nil || result.RowsAffected != 1 || result.LastInsertID != 1 {
+		t.Fatalf("Unexpected insert result %+v, %v", result, err)
+	}
+	if _, err := db.Exec(ctx, "INSERT INTO notes (title) VALUES (?)", "'; DROP TABLE notes; --"); err != nil {
+		t.Fatalf("INSERT failed: %v", err)
+	}
+
+	rows, err := db.Query(ctx, "SELECT id, title, body, score FROM notes ORDER BY id")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["title"] != "first" || rows[0]["body"] != "hello" || rows[0]["score"] != 1.5 {
+		t.Errorf("Unexpected rows %v", rows)
+	}
+	if _, ok := rows[1]["body"]; ok || rows[1]["title"] != "'; DROP TABLE notes; --" {
+		t.Errorf("Expected NULL columns to be left out and parameters bound as values, got %v", rows[1])
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM notes"); err != nil {
+		t.Fatalf("DELETE failed: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if rows, _ := db.Query(ctx, "SELECT id FROM notes"); len(rows) != 2 {
+		t.Errorf("Expected the rollback to keep both notes, got %d", len(rows))
+	}
+
+	tx, _ = db.Begin(ctx)
+	for i := 0; i < 2; i++ {
+		if _, err := tx.Exec(ctx, "INSERT INTO notes (title) VALUES (?)", "more"); err != nil {
+			t.Fatalf("INSERT failed: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Errorf("Expected rollback after commit to do nothing, got %v", err)
+	}
+
+	if _, err := db.Query(ctx, "SELECT id FROM notes"); err == nil || !strings.Contains(err.Error(), "more than 3 rows") {
+		t.Errorf("Expected the row limit to stop the query, got %v", err)
+	}
+	if _, err := db.Query(ctx, "SELECT nope FROM notes"); err == nil {
+		t.Error("Expected an error for a bad column")
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := db.Query(ctx, "SELECT 1"); err == nil {
+		t.Error("Expected the database to be closed with the bridge")
+	}
+	if _, err := b.Open(ctx, DriverSQLite, ":memory:", PoolOptions{}); err == nil {
+		t.Error("Expected Open to fail after Close")
+	}
+}
+
+func TestDatabaseBridgeOpen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	var checked []string
+	b := NewDatabaseBridge(DatabaseOptions{CheckPath: func(path string) (string, error) {
+		checked = append(checked, path)
+		if strings.HasPrefix(path, dir) {
+			return path, nil
+		}
+		return "", errors.New("access denied")
+	}})
+	defer b.Close()
+
+	file := filepath.Join(dir, "app.db")
+	db, err := b.Open(ctx, DriverSQLite, "file:"+file+"?_busy_timeout=1000", PoolOptions{MaxOpen: 4, MaxIdle: 2})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := db.Exec(ctx, "CREATE TABLE t (x)"); err != nil {
+		t.Fatalf("CREATE failed: %v", err)
+	}
+	if got := db.Stats().MaxOpenConnections; got != 4 {
+		t.Errorf("Expected a pool of 4, got %d", got)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := b.Open(ctx, DriverSQLite, "/etc/app.db", PoolOptions{}); err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("Expected files outside the check to be refused, got %v", err)
+	}
+	if len(checked) != 2 || checked[0] != file {
+		t.Errorf("Expected both files to be checked, got %v", checked)
+	}
+
+	// Only a mode parameter of memory keeps a DSN off the disk
+	outside := filepath.Join(t.TempDir(), "outside.db")
+	for _, dsn := range []string{"file:" + outside + "?x=mode=memory", "file:" + outside + "?mode=memory&mode=rwc"} {
+		if _, err := b.Open(ctx, DriverSQLite, dsn, PoolOptions{}); err == nil || !strings.Contains(err.Error(), "access denied") {
+			t.Errorf("Expected %s to be checked and refused, got %v", dsn, err)
+		}
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("Expected no file created outside the check, got %v", err)
+	}
+	checked = nil
+	memory, err := b.Open(ctx, DriverSQLite, "file:shared?mode=memory&cache=shared", PoolOptions{})
+	if err != nil {
+		t.Fatalf("Open of a named in-memory database failed: %v", err)
+	}
+	memory.Close()
+	if len(checked) != 0 {
+		t.Errorf("Expected an in-memory database to need no check, got %v", checked)
+	}
+
+	if _, err := b.Open(ctx, "mysql", "", PoolOptions{}); err == nil || !strings.Contains(err.Error(), "postgres, sqlite") {
+		t.Errorf("Expected an unknown driver error listing the drivers, got %v", err)
+	}
+	if _, err := b.Open(ctx, DriverPostgres, "postgres://llmspell@127.0.0.1:1/none?sslmode=disable&connect_timeout=2", PoolOptions{}); err == nil || !strings.Contains(err.Error(), "cannot connect to postgres") {
+		t.Errorf("Expected a connection error, got %v", err)
+	}
+
+	denied := NewDatabaseBridge(DatabaseOptions{Denied: errors.New("permission denied")})
+	if _, err := denied.Open(ctx, DriverSQLite, ":memory:", PoolOptions{}); err == nil || err.Error() != "permission denied" {
+		t.Errorf("Expected Open to be denied, got %v", err)
+	}
+}
+
+func TestDatabaseBridgeAttach(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	b := NewDatabaseBridge(DatabaseOptions{CheckPath: func(path string) (string, error) {
+		return "", errors.New("access denied")
+	}})
+	defer b.Close()
+
+	db, err := b.Open(ctx, DriverSQLite, ":memory:", PoolOptions{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	escaped := filepath.Join(dir, "escaped.db")
+	if _, err := db.Exec(ctx, "ATTACH DATABASE '"+escaped+"' AS x"); err == nil {
+		t.Error("Expected ATTACH DATABASE to be refused")
+	}
+	if _, err := db.Exec(ctx, "CREATE TABLE t (a)"); err != nil {
+		t.Fatalf("CREATE failed: %v", err)
+	}
+	if _, err := db.Exec(ctx, "VACUUM INTO '"+escaped+"'"); err == nil {
+		t.Error("Expected VACUUM INTO to be refused")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*")); len(matches) != 0 {
+		t.Errorf("Expected no files outside the check, got %v", matches)
+	}
+}
@@ -0,0 +1,453 @@
+// ABOUTME: Embeddings bridge: turns text into vectors through the OpenAI or Gemini embeddings APIs
+// ABOUTME: Also ranks vectors by cosine similarity and estimates token counts, for retrieval in spells
+
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Default models of the embeddings providers
+const (
+	DefaultOpenAIEmbeddingModel = "text-embedding-3-small"
+	DefaultGeminiEmbeddingModel = "text-embedding-004"
+)
+
+// maxEmbedBatch is how many texts go in one request; larger batches are
+// split, as providers limit the inputs of a request
+const maxEmbedBatch = 100
+
+// ErrNoEmbeddingsProvider is returned when text is embedded without a
+// provider that supports embeddings
+var ErrNoEmbeddingsProvider = errors.New("no embeddings provider is available (set OPENAI_API_KEY or GEMINI_API_KEY)")
+
+// Embedder turns texts into vectors through a provider's API, one vector
+// per text, in order
+type Embedder interface {
+	// Embed returns the vectors of texts from model
+	Embed(ctx context.Context, model string, texts []string) ([][]float64, error)
+
+	// DefaultModel is the model used unless the bridge selects another
+	DefaultModel() string
+}
+
+// EmbeddingsBridge gives scripts text embeddings from the providers that
+// offer them, and the vector math to use them. Anthropic has no
+// embeddings API, so OpenAI and Gemini are the providers it detects.
+type EmbeddingsBridge struct {
+	mu        sync.RWMutex
+	embedders map[string]Embedder
+	current   string
+	model     string
+	watchdog  *Watchdog
+}
+
+// NewEmbeddingsBridge creates a bridge with the providers whose API key is
+// set. Without one, embedding fails with ErrNoEmbeddingsProvider but the
+// similarity and token functions still work.
+func NewEmbeddingsBridge() *EmbeddingsBridge {
+	b := &EmbeddingsBridge{embedders: make(map[string]Embedder)}
+	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
+		b.SetEmbedder("openai", &OpenAIEmbedder{APIKey: key})
+	}
+	if key := os.Getenv("GEMINI_API_KEY"); key != "" {
+		b.SetEmbedder("gemini", &GeminiEmbedder{APIKey: key})
+	}
+	return b
+}
+
+// SetEmbedder registers embedder as provider name, and selects it when no
+// provider is selected yet
+func (b *EmbeddingsBridge) SetEmbedder(name string, embedder Embedder) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.embedders == nil {
+		b.embedders = make(map[string]Embedder)
+	}
+	b.embedders[name] = embedder
+	if b.current == "" {
+		b.current = name
+	}
+}
+
+// SetWatchdog abandons embedding requests that outlive its timeout; nil
+// waits for them
+func (b *EmbeddingsBridge) SetWatchdog(w *Watchdog) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.watchdog = w
+}
+
+// Providers lists the providers that can embed text, sorted
+func (b *EmbeddingsBridge) Providers() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	names := make([]string, 0, len(b.embedders))
+	for name := range b.embedders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Provider returns the selected provider, empty when there is none
+func (b *EmbeddingsBridge) Provider() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.current
+}
+
+// SetProvider selects the provider texts are embedded with, going back to
+// its default model
+func (b *EmbeddingsBridge) SetProvider(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.embedders[name]; !ok {
+		return fmt.Errorf("embeddings provider %s not available", name)
+	}
+	b.current = name
+	b.model = ""
+	return nil
+}
+
+// SetModel selects the model of the current provider; empty uses its
+// default
+func (b *EmbeddingsBridge) SetModel(model string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.model = model
+}
+
+// Model returns the model texts are embedded with, empty when there is no
+// provider
+func (b *EmbeddingsBridge) Model() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.model != "" {
+		return b.model
+	}
+	if embedder, ok := b.embedders[b.current]; ok {
+		return embedder.DefaultModel()
+	}
+	return ""
+}
+
+// Embed returns the vector of text
+func (b *EmbeddingsBridge) Embed(ctx context.Context, text string) ([]float64, error) {
+	vectors, err := b.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// EmbedBatch returns the vectors of texts, in order. Large batches are
+// sent in several requests.
+func (b *EmbeddingsBridge) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("no texts to embed")
+	}
+	b.mu.RLock()
+	embedder, ok := b.embedders[b.current]
+	watchdog := b.watchdog
+	b.mu.RUnlock()
+	if !ok {
+		return nil, ErrNoEmbeddingsProvider
+	}
+	model := b.Model()
+
+	vectors := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += maxEmbedBatch {
+		chunk := texts[start:min(start+maxEmbedBatch, len(texts))]
+		result, err := watchdog.Call(ctx, "embeddings.embed", func(ctx context.Context) (interface{}, error) {
+			return embedder.Embed(ctx, model, chunk)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("embedding failed: %w", err)
+		}
+		chunkVectors := result.([][]float64)
+		if len(chunkVectors) != len(chunk) {
+			return nil, fmt.Errorf("embedding failed: %d vectors for %d texts", len(chunkVectors), len(chunk))
+		}
+		vectors = append(vectors, chunkVectors...)
+	}
+	return vectors, nil
+}
+
+// CountTokens estimates the tokens of text, as EstimateTokens does
+func (b *EmbeddingsBridge) CountTokens(text string) int {
+	return EstimateTokens(text)
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, from
+// -1 to 1. A zero vector is similar to nothing, at 0.
+func CosineSimilarity(a, b []float64) (float64, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("vectors have different dimensions: %d and %d", len(a), len(b))
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0, nil
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB)), nil
+}
+
+// SimilarityMatch is a vector ranked by RankBySimilarity
+type SimilarityMatch struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+}
+
+// RankBySimilarity returns the k vectors most similar to query, most
+// similar first; k of zero or less ranks them all
+func RankBySimilarity(query []float64, vectors [][]float64, k int) ([]SimilarityMatch, error) {
+	matches := make([]SimilarityMatch, len(vectors))
+	for i, vector := range vectors {
+		score, err := CosineSimilarity(query, vector)
+		if err != nil {
+			return nil, fmt.Errorf("vector %d: %w", i+1, err)
+		}
+		matches[i] = SimilarityMatch{Index: i, Score: score}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if k > 0 && k < len(matches) {
+		matches = matches[:k]
+	}
+	return matches, nil
+}
+
+// OpenAIEmbedder embeds texts through the OpenAI embeddings API
+type OpenAIEmbedder struct {
+	APIKey string
+
+	// BaseURL is the API root; defaults to https://api.openai.com/v1
+	BaseURL string
+
+	// Client sends requests; defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// DefaultModel returns DefaultOpenAIEmbeddingModel
+func (e *OpenAIEmbedder) DefaultModel() string {
+	return DefaultOpenAIEmbeddingModel
+}
+
+// Embed returns the vectors of texts from model
+func (e *OpenAIEmbedder) Embed(ctx context.Context, model string, texts []string) ([][]float64, error) {
+	base := e.BaseURL
+	if base == "" {
+		base = "https://api.openai.com/v1"
+	}
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	headers := map[string]string{"Authorization": "Bearer " + e.APIKey}
+	body := map[string]interface{}{"model": model, "input": texts}
+	if err := postJSON(ctx, e.Client, base+"/embeddings", headers, body, &response); err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, item := range response.Data {
+		if item.Index < 0 || item.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index %d out of range", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// GeminiEmbedder embeds texts through the Gemini embeddings API
+type GeminiEmbedder struct {
+	APIKey string
+
+	// BaseURL is the API root; defaults to
+	// https://generativelanguage.googleapis.com/v1beta
+	BaseURL string
+
+	// Client sends requests; defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// DefaultModel returns DefaultGeminiEmbeddingModel
+func (e *GeminiEmbedder) DefaultModel() string {
+	return DefaultGeminiEmbeddingModel
+}
+
+// Embed returns the vectors of texts from model
+func (e *GeminiEmbedder) Embed(ctx context.Context, model string, texts []string) ([][]float64, error) {
+	base := e.BaseURL
+	if base == "" {
+		base = "https://generativelanguage.googleapis.com/v1beta"
+	}
+	type part struct {
+		Text string `json:"text"`
+	}
+	type request struct {
+		Model   string `json:"model"`
+		Content struct {
+			Parts []part `json:"parts"`
+		} `json:"content"`
+	}
+	requests := make([]request, len(texts))
+	for i, text := range texts {
+		requests[i].Model = "models/" + model
+		requests[i].Content.Parts = []part{{Text: text}}
+	}
+
+	var response struct {
+		Embeddings []struct {
+			Values []float64 `json:"values"`
+		} `json:"embeddings"`
+	}
+	endpoint := fmt.Sprintf("%s/models/%s:batchEmbedContents?key=%s", base, url.PathEscape(model), url.QueryEscape(e.APIKey))
+	if err := postJSON(ctx, e.Client, endpoint, nil, map[string]interface{}{"requests": requests}, &response); err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float64, len(response.Embeddings))
+	for i, embedding := range response.Embeddings {
+		vectors[i] = embedding.Values
+	}
+	return vectors, nil
+}
+
+// postJSON posts body as JSON and decodes the response into out. Error
+// statuses are returned with the start of the response body.
+func postJSON(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, body, out interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Name returns the name of the bridge
+func (b *EmbeddingsBridge) Name() string {
+	return "embeddings"
+}
+
+// Methods returns information about all methods exposed by this bridge
+func (b *EmbeddingsBridge) Methods() []MethodInfo {
+	return []MethodInfo{
+		{
+			Name:        "embed",
+			Description: "Turn text into a vector with the selected provider",
+			Parameters: []ParameterInfo{
+				{Name: "text", Type: "string", Required: true, Description: "Text to embed"},
+			},
+			ReturnType: "number[]",
+		},
+		{
+			Name:        "embedBatch",
+			Description: "Turn many texts into vectors, in order",
+			Parameters: []ParameterInfo{
+				{Name: "texts", Type: "array", Required: true, Description: "Texts to embed"},
+			},
+			ReturnType: "number[][]",
+		},
+		{
+			Name:        "similarity",
+			Description: "Cosine similarity of two vectors, from -1 to 1",
+			Parameters: []ParameterInfo{
+				{Name: "a", Type: "array", Required: true, Description: "A vector"},
+				{Name: "b", Type: "array", Required: true, Description: "A vector of the same dimension"},
+			},
+			ReturnType: "number",
+		},
+		{
+			Name:        "topK",
+			Description: "Rank vectors by their similarity to a query vector",
+			Parameters: []ParameterInfo{
+				{Name: "query", Type: "array", Required: true, Description: "Vector to compare with"},
+				{Name: "vectors", Type: "array", Required: true, Description: "Vectors to rank"},
+				{Name: "k", Type: "number", Required: false, Description: "How many to return; all by default"},
+			},
+			ReturnType: "SimilarityMatch[]",
+		},
+		{
+			Name:        "countTokens",
+			Description: "Estimate the tokens of text",
+			Parameters: []ParameterInfo{
+				{Name: "text", Type: "string", Required: true, Description: "Text to count"},
+			},
+			ReturnType: "number",
+		},
+		{
+			Name:        "setProvider",
+			Description: "Select the provider texts are embedded with",
+			Parameters: []ParameterInfo{
+				{Name: "name", Type: "string", Required: true, Description: "openai or gemini"},
+			},
+			ReturnType: "void",
+		},
+		{
+			Name:        "setModel",
+			Description: "Select the embedding model of the provider",
+			Parameters: []ParameterInfo{
+				{Name: "model", Type: "string", Required: true, Description: "Model name; empty for the provider's default"},
+			},
+			ReturnType: "void",
+		},
+	}
+}
+
+// Initialize prepares the bridge for use
+func (b *EmbeddingsBridge) Initialize(ctx context.Context) error {
+	// Providers are detected in NewEmbeddingsBridge
+	return nil
+}
+
+// Cleanup releases any resources held by the bridge
+func (b *EmbeddingsBridge) Cleanup(ctx context.Context) error {
+	return nil
+}
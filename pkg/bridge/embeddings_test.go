@@ -0,0 +1,156 @@
+// ABOUTME: Tests for the embeddings bridge
+// ABOUTME: Validates the OpenAI and Gemini requests, batching, provider selection, and the similarity helpers
+
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lengthEmbedder embeds each text as {length, 1}, recording batch sizes
+type lengthEmbedder struct {
+	batches []int
+}
+
+func (e *lengthEmbedder) Embed(ctx context.Context, model string, texts []string) ([][]float64, error) {
+	e.batches = append(e.batches, len(texts))
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float64{float64(len(text)), 1}
+	}
+	return vectors, nil
+}
+
+func (e *lengthEmbedder) DefaultModel() string {
+	return "length"
+}
+
+func TestEmbeddingsBridge(t *testing.T) {
+	t.Run("embeds in batches", func(t *testing.T) {
+		embedder := &lengthEmbedder{}
+		bridge := &EmbeddingsBridge{}
+		bridge.SetEmbedder("fake", embedder)
+
+		texts := make([]string, maxEmbedBatch+5)
+		for i := range texts {
+			texts[i] = strings.Repeat("a", i)
+		}
+		vectors, err := bridge.EmbedBatch(context.Background(), texts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vectors) != len(texts) || vectors[42][0] != 42 {
+			t.Errorf("Expected a vector per text in order, got %d", len(vectors))
+		}
+		if !reflect.DeepEqual(embedder.batches, []int{maxEmbedBatch, 5}) {
+			t.Errorf("Expected two requests, got %v", embedder.batches)
+		}
+	})
+
+	t.Run("selects providers and models", func(t *testing.T) {
+		bridge := &EmbeddingsBridge{}
+		if _, err := bridge.Embed(context.Background(), "hi"); !errors.Is(err, ErrNoEmbeddingsProvider) {
+			t.Errorf("Expected ErrNoEmbeddingsProvider, got %v", err)
+		}
+		bridge.SetEmbedder("openai", &OpenAIEmbedder{})
+		bridge.SetEmbedder("gemini", &GeminiEmbedder{})
+		if bridge.Provider() != "openai" || bridge.Model() != DefaultOpenAIEmbeddingModel {
+			t.Errorf("Expected the first provider, got %s %s", bridge.Provider(), bridge.Model())
+		}
+
+		bridge.SetModel("text-embedding-3-large")
+		if err := bridge.SetProvider("gemini"); err != nil {
+			t.Fatal(err)
+		}
+		if bridge.Model() != DefaultGeminiEmbeddingModel {
+			t.Errorf("Expected switching providers to reset the model, got %s", bridge.Model())
+		}
+		if err := bridge.SetProvider("anthropic"); err == nil {
+			t.Error("Expected an unknown provider to be refused")
+		}
+		if !reflect.DeepEqual(bridge.Providers(), []string{"gemini", "openai"}) {
+			t.Errorf("Unexpected providers: %v", bridge.Providers())
+		}
+	})
+}
+
+func TestEmbedders(t *testing.T) {
+	t.Run("openai", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Model string   `json:"model"`
+				Input []string `json:"input"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if r.URL.Path != "/embeddings" || r.Header.Get("Authorization") != "Bearer key" || body.Model != "small" || len(body.Input) != 2 {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			// Items may come back in any order
+			_, _ = w.Write([]byte(`{"data": [{"index": 1, "embedding": [0, 1]}, {"index": 0, "embedding": [1, 0]}]}`))
+		}))
+		defer server.Close()
+
+		embedder := &OpenAIEmbedder{APIKey: "key", BaseURL: server.URL}
+		vectors, err := embedder.Embed(context.Background(), "small", []string{"a", "b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(vectors, [][]float64{{1, 0}, {0, 1}}) {
+			t.Errorf("Embed() = %v", vectors)
+		}
+
+		if _, err := embedder.Embed(context.Background(), "large", []string{"a"}); err == nil || !strings.Contains(err.Error(), "status 400") {
+			t.Errorf("Expected the error status, got %v", err)
+		}
+	})
+
+	t.Run("gemini", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/models/text-embedding-004:batchEmbedContents" || r.URL.Query().Get("key") != "key" {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{"embeddings": [{"values": [0.5, 0.5]}]}`))
+		}))
+		defer server.Close()
+
+		embedder := &GeminiEmbedder{APIKey: "key", BaseURL: server.URL}
+		vectors, err := embedder.Embed(context.Background(), embedder.DefaultModel(), []string{"a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(vectors, [][]float64{{0.5, 0.5}}) {
+			t.Errorf("Embed() = %v", vectors)
+		}
+	})
+}
+
+func TestSimilarity(t *testing.T) {
+	score, err := CosineSimilarity([]float64{1, 0}, []float64{1, 1})
+	if err != nil || math.Abs(score-math.Sqrt2/2) > 1e-9 {
+		t.Errorf("CosineSimilarity() = %v, %v", score, err)
+	}
+	if score, _ := CosineSimilarity([]float64{0, 0}, []float64{1, 1}); score != 0 {
+		t.Errorf("Expected a zero vector to score 0, got %v", score)
+	}
+	if _, err := CosineSimilarity([]float64{1}, []float64{1, 1}); err == nil {
+		t.Error("Expected different dimensions to be refused")
+	}
+
+	matches, err := RankBySimilarity([]float64{1, 0}, [][]float64{{0, 1}, {1, 0}, {1, 1}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].Index != 1 || matches[1].Index != 2 {
+		t.Errorf("RankBySimilarity() = %+v", matches)
+	}
+}
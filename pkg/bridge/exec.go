@@ -0,0 +1,314 @@
+// ABOUTME: Exec bridge: runs the external commands a security profile allowlists, with parameters filled into their arguments
+// ABOUTME: Commands run without a shell, in a minimal environment, under a timeout and resource limits, with capped output
+
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+// ErrStopCommand is returned by a CommandRequest's OnLine to stop the
+// command without failing the run
+var ErrStopCommand = errors.New("stop command")
+
+// execWaitDelay is how long a command's output may stay open after the
+// command is killed, such as by a process it started
+const execWaitDelay = time.Second
+
+// execEnv are the variables of llmspell's environment commands get
+var execEnv = []string{"PATH", "HOME", "LANG"}
+
+// ExecOptions configures an ExecBridge
+type ExecOptions struct {
+	// Denied, when set, is why scripts may not run commands, such as a
+	// security profile without security.PermissionExec
+	Denied error
+
+	// Policy lists the commands scripts may run
+	Policy security.ExecPolicy
+}
+
+// CommandInfo describes a command scripts may run
+type CommandInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Params      []string `json:"params"`
+}
+
+// CommandRequest is one run of a command
+type CommandRequest struct {
+	// Params fill the command's argument templates
+	Params map[string]string
+
+	// Stdin is the command's input; empty gives it none
+	Stdin string
+
+	// Timeout shortens the command's timeout; it cannot lengthen it
+	Timeout time.Duration
+
+	// OnLine, when set, receives each line of output as it arrives, with
+	// stream "stdout" or "stderr". It is called on the goroutine that called
+	// Run. Returning an error kills the command; Run returns the error,
+	// unless it is ErrStopCommand.
+	OnLine func(stream, line string) error
+}
+
+// CommandResult is how a command ended and what it wrote
+type CommandResult struct {
+	// ExitCode is the command's exit status, or -1 when a signal ended it
+	ExitCode int           `json:"exit_code"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	Duration time.Duration `json:"duration"`
+
+	// Truncated reports output beyond the policy's limit that was dropped
+	Truncated bool `json:"truncated"`
+
+	// Signal names the signal that ended the command, such as "killed" or
+	// "CPU time limit exceeded"
+	Signal string `json:"signal,omitempty"`
+
+	// Stopped reports a command OnLine stopped with ErrStopCommand
+	Stopped bool `json:"stopped"`
+}
+
+// ExecBridge runs commands for one spell run and kills those still running
+// when it ends
+type ExecBridge struct {
+	options ExecOptions
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// NewExecBridge creates a bridge with options
+func NewExecBridge(options ExecOptions) *ExecBridge {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ExecBridge{options: options, ctx: ctx, cancel: cancel}
+}
+
+// Commands lists the commands scripts may run, or none when they are
+// denied
+func (b *ExecBridge) Commands() []CommandInfo {
+	if b.options.Denied != nil {
+		return nil
+	}
+	var commands []CommandInfo
+	for _, name := range b.options.Policy.Names() {
+		command := b.options.Policy.Commands[name]
+		params := command.Params()
+		if params == nil {
+			params = []string{}
+		}
+		commands = append(commands, CommandInfo{Name: name, Description: command.Description, Params: params})
+	}
+	return commands
+}
+
+// Close kills the commands still running; later runs fail
+func (b *ExecBridge) Close() error {
+	b.cancel()
+	return nil
+}
+
+// Run runs the command name with request's parameters and waits for it to
+// end. A command that exits with a non-zero status is not an error; its
+// result says how it ended. One that runs out of time is.
+func (b *ExecBridge) Run(ctx context.Context, name string, request CommandRequest) (*CommandResult, error) {
+	if b.options.Denied != nil {
+		return nil, b.options.Denied
+	}
+	if b.ctx.Err() != nil {
+		return nil, errors.New("the exec module is closed")
+	}
+	policy := b.options.Policy
+	command, ok := policy.Commands[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown command %q (available: %s)", name, strings.Join(policy.Names(), ", "))
+	}
+	args, err := command.Expand(request.Params)
+	if err != nil {
+		return nil, fmt.Errorf("command %s: %w", name, err)
+	}
+
+	timeout := policy.TimeoutOf(command)
+	if request.Timeout > 0 && request.Timeout < timeout {
+		timeout = request.Timeout
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	stop := context.AfterFunc(b.ctx, cancel)
+	defer stop()
+
+	cmd := exec.CommandContext(runCtx, command.Path, args...)
+	cmd.Dir = command.Dir
+	cmd.WaitDelay = execWaitDelay
+	for _, key := range execEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+	cmd.Env = append(cmd.Env, command.Env...)
+	if request.Stdin != "" {
+		cmd.Stdin = strings.NewReader(request.Stdin)
+	}
+
+	var lines chan commandLine
+	quit := make(chan struct{})
+	defer close(quit)
+	if request.OnLine != nil {
+		lines = make(chan commandLine)
+	}
+	limit := policy.OutputLimit()
+	stdout := &commandOutput{stream: "stdout", limit: limit, lines: lines, quit: quit}
+	stderr := &commandOutput{stream: "stderr", limit: limit, lines: lines, quit: quit}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	start := time.Now()
+	if err := security.StartExec(cmd, policy.Limits); err != nil {
+		return nil, fmt.Errorf("command %s: %w", name, err)
+	}
+
+	// Lines reach OnLine here, on the caller's goroutine, until the command
+	// ends; once it fails, the rest are dropped
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	var lineErr error
+	for waiting := true; waiting; {
+		select {
+		case line := <-lines:
+			if lineErr == nil {
+				if lineErr = request.OnLine(line.stream, line.text); lineErr != nil {
+					cancel()
+				}
+			}
+		case err = <-done:
+			waiting = false
+		}
+	}
+	if request.OnLine != nil && lineErr == nil {
+		for _, output := range []*commandOutput{stdout, stderr} {
+			if rest := output.rest(); rest != "" {
+				if lineErr = request.OnLine(output.stream, rest); lineErr != nil {
+					break
+				}
+			}
+		}
+	}
+
+	result := &CommandResult{
+		ExitCode:  cmd.ProcessState.ExitCode(),
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Duration:  time.Since(start),
+		Truncated: stdout.truncated || stderr.truncated,
+		Stopped:   errors.Is(lineErr, ErrStopCommand),
+	}
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.Signal = status.Signal().String()
+	}
+
+	switch {
+	case lineErr != nil && !result.Stopped:
+		return nil, lineErr
+	case result.Stopped:
+		return result, nil
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case b.ctx.Err() != nil:
+		return nil, errors.New("the exec module is closed")
+	case runCtx.Err() != nil:
+		return nil, fmt.Errorf("command %s timed out after %s", name, timeout)
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("command %s: %w", name, err)
+	}
+	return result, nil
+}
+
+// commandLine is a line a command wrote
+type commandLine struct {
+	stream string
+	text   string
+}
+
+// commandOutput keeps a stream of a command's output up to limit bytes
+// and, when lines is set, sends each complete line there until quit is
+// closed
+type commandOutput struct {
+	stream string
+	limit  int64
+	lines  chan<- commandLine
+	quit   <-chan struct{}
+
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	partial   []byte
+	truncated bool
+}
+
+// Write keeps what fits under the limit and passes lines on; it never
+// fails, so the command is not stopped by a full buffer
+func (o *commandOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	keep := p
+	if room := o.limit - int64(o.buf.Len()); int64(len(keep)) > room {
+		keep = keep[:max(room, 0)]
+		o.truncated = true
+	}
+	o.buf.Write(keep)
+	var complete []string
+	if o.lines != nil {
+		o.partial = append(o.partial, p...)
+		for {
+			i := bytes.IndexByte(o.partial, '\n')
+			if i < 0 {
+				break
+			}
+			complete = append(complete, strings.TrimSuffix(string(o.partial[:i]), "\r"))
+			o.partial = o.partial[i+1:]
+		}
+		// A line longer than the limit is passed on in pieces
+		if int64(len(o.partial)) >= o.limit {
+			complete = append(complete, string(o.partial))
+			o.partial = nil
+		}
+	}
+	o.mu.Unlock()
+
+	for _, text := range complete {
+		select {
+		case o.lines <- commandLine{stream: o.stream, text: text}:
+		case <-o.quit:
+			return len(p), nil
+		}
+	}
+	return len(p), nil
+}
+
+// rest returns the last line, which did not end with a newline
+func (o *commandOutput) rest() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	rest := string(o.partial)
+	o.partial = nil
+	return rest
+}
+
+// String returns the output kept
+func (o *commandOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
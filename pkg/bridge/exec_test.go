@@ -0,0 +1,137 @@
+// ABOUTME: Tests for the exec bridge
+// ABOUTME: Validates allowlisting, templated arguments, output capture and streaming, timeouts, and resource limits
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+func TestExecBridge(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands need a POSIX shell")
+	}
+	t.Setenv("TEST_EXEC_API_KEY", "s3cret")
+	b := NewExecBridge(ExecOptions{Policy: security.ExecPolicy{
+		Commands: map[string]security.ExecCommand{
+			"greet": {Path: "sh", Args: []string{"-c", `echo "hello, $1"; echo "to stderr" >&2; exit 3`, "greet", "{{name}}"}, Description: "Greets"},
+			"env":   {Path: "sh", Args: []string{"-c", "env"}, Env: []string{"GREETING=hi"}},
+			"cat":   {Path: "cat"},
+			"count": {Path: "sh", Args: []string{"-c", "i=0; while [ $i -lt 100 ]; do echo line $i; i=$((i+1)); done"}},
+			"sleep": {Path: "sleep", Args: []string{"{{seconds}}"}, Timeout: 5 * time.Second},
+		},
+		MaxOutput: 64,
+	}})
+	defer b.Close()
+	ctx := context.Background()
+
+	commands := b.Commands()
+	if len(commands) != 5 || commands[3].Name != "greet" || commands[3].Params[0] != "name" || commands[3].Description != "Greets" {
+		t.Errorf("Unexpected commands %+v", commands)
+	}
+
+	result, err := b.Run(ctx, "greet", CommandRequest{Params: map[string]string{"name": "world; rm -rf /"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 3 || result.Stdout != "hello, world; rm -rf /\n" || result.Stderr != "to stderr\n" || result.Truncated {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	result, err = b.Run(ctx, "env", CommandRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Stdout, "GREETING=hi") || strings.Contains(result.Stdout, "TEST_EXEC_API_KEY") {
+		t.Errorf("Expected a minimal environment, got %q", result.Stdout)
+	}
+
+	if result, err = b.Run(ctx, "cat", CommandRequest{Stdin: "piped"}); err != nil || result.Stdout != "piped" {
+		t.Errorf("Expected stdin to reach the command, got %+v, %v", result, err)
+	}
+
+	result, err = b.Run(ctx, "count", CommandRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Stdout) != 64 || !result.Truncated {
+		t.Errorf("Expected output capped at 64 bytes, got %d", len(result.Stdout))
+	}
+
+	var lines []string
+	result, err = b.Run(ctx, "count", CommandRequest{OnLine: func(stream, line string) error {
+		lines = append(lines, stream+": "+line)
+		if len(lines) == 3 {
+			return ErrStopCommand
+		}
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Stopped || len(lines) != 3 || lines[2] != "stdout: line 2" {
+		t.Errorf("Expected to stop after three lines, got %v, %+v", lines, result)
+	}
+	failure := errors.New("callback failed")
+	if _, err := b.Run(ctx, "count", CommandRequest{OnLine: func(stream, line string) error { return failure }}); err != failure {
+		t.Errorf("Expected the callback's error, got %v", err)
+	}
+
+	start := time.Now()
+	_, err = b.Run(ctx, "sleep", CommandRequest{Params: map[string]string{"seconds": "10"}, Timeout: 100 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") || time.Since(start) > 3*time.Second {
+		t.Errorf("Expected a timeout, got %v after %s", err, time.Since(start))
+	}
+
+	if _, err := b.Run(ctx, "rm", CommandRequest{}); err == nil || !strings.Contains(err.Error(), `unknown command "rm"`) {
+		t.Errorf("Expected an unknown command to fail, got %v", err)
+	}
+	if _, err := b.Run(ctx, "greet", CommandRequest{Params: map[string]string{"name": "-rf"}}); err == nil {
+		t.Error("Expected a parameter that looks like an option to fail")
+	}
+
+	b.Close()
+	if _, err := b.Run(ctx, "cat", CommandRequest{}); err == nil {
+		t.Error("Expected a closed bridge to fail")
+	}
+
+	denied := NewExecBridge(ExecOptions{Denied: security.ErrMethodDenied, Policy: security.ExecPolicy{
+		Commands: map[string]security.ExecCommand{"cat": {Path: "cat"}},
+	}})
+	if _, err := denied.Run(ctx, "cat", CommandRequest{}); !errors.Is(err, security.ErrMethodDenied) || len(denied.Commands()) != 0 {
+		t.Errorf("Expected a denied bridge to run nothing, got %v", err)
+	}
+}
+
+func TestExecBridgeLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are only set on Linux")
+	}
+	b := NewExecBridge(ExecOptions{Policy: security.ExecPolicy{
+		Commands: map[string]security.ExecCommand{
+			"spin":   {Path: "sh", Args: []string{"-c", "while :; do :; done"}},
+			"limits": {Path: "sh", Args: []string{"-c", "ulimit -n"}},
+		},
+		Limits: security.ExecLimits{CPUTime: time.Second, OpenFiles: 32},
+	}})
+	defer b.Close()
+
+	result, err := b.Run(context.Background(), "limits", CommandRequest{})
+	if err != nil || strings.TrimSpace(result.Stdout) != "32" {
+		t.Errorf("Expected 32 open files, got %+v, %v", result, err)
+	}
+	result, err = b.Run(context.Background(), "spin", CommandRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != -1 || result.Signal == "" {
+		t.Errorf("Expected the CPU limit to end the command, got %+v", result)
+	}
+}
@@ -0,0 +1,187 @@
+// ABOUTME: Futures for bridge calls that run in the background, independent of any script engine
+// ABOUTME: Each engine adapter maps a Future to its own async idiom: coroutines, promises, or polling
+
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Future is the pending result of a bridge call running in its own
+// goroutine. Along the way the call may emit items, such as the chunks of a
+// streamed response, which are kept in order until taken with Next.
+//
+// A Future only holds Go values, so it does not depend on how a script
+// engine handles async work. Each engine's adapter maps it to its own idiom:
+// the Lua engine suspends the calling coroutine until the future is ready
+// (or blocks, outside a coroutine), an engine with native promises would
+// settle a promise from Done, and one without either would give scripts a
+// handle to poll.
+type Future struct {
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	updated chan struct{} // closed, and replaced, on each emit and when done
+	items   []interface{}
+	done    bool
+	result  interface{}
+	err     error
+	doneCh  chan struct{}
+}
+
+// Async starts fn in its own goroutine and returns its future. fn gets a
+// context that ends when ctx does or the future is cancelled, and a function
+// to emit items with. If fn has not returned shortly after ctx ends, the
+// future resolves with the context's cause without it, so like a Watchdog
+// call, fn must touch nothing but Go state.
+func Async(ctx context.Context, fn func(ctx context.Context, emit func(item interface{})) (interface{}, error)) *Future {
+	ctx, cancel := context.WithCancel(ctx)
+	f := newFuture(cancel)
+
+	go func() {
+		var result interface{}
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				result, err = nil, fmt.Errorf("async call panicked: %v", r)
+			}
+			f.resolve(result, err)
+		}()
+		result, err = fn(ctx, f.emit)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-f.doneCh:
+			return
+		}
+		// Give a call that honors its context the chance to return its own error
+		timer := time.NewTimer(abandonGrace)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			f.resolve(nil, context.Cause(ctx))
+		case <-f.doneCh:
+		}
+	}()
+	return f
+}
+
+// Resolved returns a future that is already done, for calls that had to
+// run synchronously, such as tools implemented in script code
+func Resolved(result interface{}, err error) *Future {
+	f := newFuture(func() {})
+	f.resolve(result, err)
+	return f
+}
+
+// NewFuture returns a pending future and the function that resolves it, for
+// results produced outside Async, such as by a task that a script engine
+// runs in a coroutine. Only the first call to resolve counts.
+func NewFuture() (*Future, func(result interface{}, err error)) {
+	f := newFuture(func() {})
+	return f, f.resolve
+}
+
+func newFuture(cancel context.CancelFunc) *Future {
+	return &Future{
+		cancel:  cancel,
+		updated: make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+}
+
+// emit queues an item for Next; items emitted after the future is done are
+// dropped
+func (f *Future) emit(item interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done {
+		return
+	}
+	f.items = append(f.items, item)
+	f.notify()
+}
+
+// resolve settles the future; only the first call counts
+func (f *Future) resolve(result interface{}, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done {
+		return
+	}
+	f.done, f.result, f.err = true, result, err
+	f.notify()
+	close(f.doneCh)
+	f.cancel()
+}
+
+// notify wakes everyone waiting on Updated; f.mu must be held
+func (f *Future) notify() {
+	close(f.updated)
+	f.updated = make(chan struct{})
+}
+
+// Done returns a channel that is closed when the future resolves
+func (f *Future) Done() <-chan struct{} {
+	return f.doneCh
+}
+
+// Updated returns a channel that is closed when the future next emits an
+// item or resolves. Call it again for the update after that.
+func (f *Future) Updated() <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done {
+		return f.doneCh
+	}
+	return f.updated
+}
+
+// Poll reports whether the future has resolved and, if so, its result
+func (f *Future) Poll() (done bool, result interface{}, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.done, f.result, f.err
+}
+
+// Wait blocks until the future resolves or ctx ends, and returns its result
+func (f *Future) Wait(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.doneCh:
+		_, result, err := f.Poll()
+		return result, err
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// Next takes the oldest item not yet taken. ok is false if there is none
+// yet; done then tells whether more can still come.
+func (f *Future) Next() (item interface{}, ok, done bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.items) == 0 {
+		return nil, false, f.done
+	}
+	item = f.items[0]
+	f.items[0] = nil
+	f.items = f.items[1:]
+	return item, true, f.done && len(f.items) == 0
+}
+
+// Pending returns how many emitted items have not been taken yet
+func (f *Future) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.items)
+}
+
+// Cancel ends the context of the call; the future resolves with
+// context.Canceled unless the call has finished already
+func (f *Future) Cancel() {
+	f.cancel()
+}
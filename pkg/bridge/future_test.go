@@ -0,0 +1,122 @@
+// ABOUTME: Tests for futures of bridge calls running in the background
+// ABOUTME: Validates results, emitted items, cancellation, and async tool execution
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+func TestFutureResult(t *testing.T) {
+	release := make(chan struct{})
+	f := Async(context.Background(), func(ctx context.Context, emit func(interface{})) (interface{}, error) {
+		emit("a")
+		emit("b")
+		<-release
+		return "done", nil
+	})
+
+	<-f.Updated()
+	if done, _, _ := f.Poll(); done {
+		t.Fatal("Expected the future to be pending")
+	}
+	close(release)
+
+	result, err := f.Wait(context.Background())
+	if err != nil || result != "done" {
+		t.Fatalf("Expected done, got %v, %v", result, err)
+	}
+	var items []interface{}
+	for {
+		item, ok, _ := f.Next()
+		if !ok {
+			break
+		}
+		items = append(items, item)
+	}
+	if len(items) != 2 || items[0] != "a" || items[1] != "b" {
+		t.Errorf("Expected the emitted items in order, got %v", items)
+	}
+	if _, ok, done := f.Next(); ok || !done {
+		t.Error("Expected no more items once taken")
+	}
+}
+
+func TestFutureCancel(t *testing.T) {
+	f := Async(context.Background(), func(ctx context.Context, emit func(interface{})) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	f.Cancel()
+
+	if _, err := f.Wait(context.Background()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestFutureAbandonsCallIgnoringContext(t *testing.T) {
+	cause := errors.New("spell stopped")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+
+	f := Async(ctx, func(ctx context.Context, emit func(interface{})) (interface{}, error) {
+		<-release // ignores ctx
+		return "late", nil
+	})
+	cancel(cause)
+
+	select {
+	case <-f.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected the future to resolve once its context ended")
+	}
+	if _, _, err := f.Poll(); !errors.Is(err, cause) {
+		t.Errorf("Expected the context's cause, got %v", err)
+	}
+}
+
+func TestFuturePanic(t *testing.T) {
+	f := Async(context.Background(), func(ctx context.Context, emit func(interface{})) (interface{}, error) {
+		panic("boom")
+	})
+	if _, err := f.Wait(context.Background()); err == nil {
+		t.Error("Expected a panicking call to fail")
+	}
+}
+
+func TestExecuteToolAsync(t *testing.T) {
+	registry := tools.NewRegistry()
+	upper := func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return "OK", nil
+	}
+	if err := registry.Register(tools.NewFunctionTool("upper", "Upper", nil, upper)); err != nil {
+		t.Fatal(err)
+	}
+	tb := NewToolBridge(registry)
+	if err := tb.RegisterTool("script", "Script tool", nil, func(map[string]interface{}) (interface{}, error) {
+		return "script", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := tb.ExecuteToolAsync(context.Background(), "upper", nil).Wait(context.Background())
+	if err != nil || result != "OK" {
+		t.Errorf("Expected OK, got %v, %v", result, err)
+	}
+
+	// Script tools run before ExecuteToolAsync returns
+	f := tb.ExecuteToolAsync(context.Background(), "script", nil)
+	if done, result, err := f.Poll(); !done || result != "script" || err != nil {
+		t.Errorf("Expected a resolved future, got %v, %v, %v", done, result, err)
+	}
+
+	if _, err := tb.ExecuteToolAsync(context.Background(), "missing", nil).Wait(context.Background()); err == nil {
+		t.Error("Expected an error for a missing tool")
+	}
+}
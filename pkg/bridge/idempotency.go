@@ -0,0 +1,123 @@
+// ABOUTME: Idempotency keys and retries for tool executions that mutate the outside world
+// ABOUTME: Retried attempts share one key, and a completed call is not run again under its key
+
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ToolCallOptions configure ExecuteToolWith
+type ToolCallOptions struct {
+	// IdempotencyKey identifies the call. Every attempt of the call gets
+	// the same key, and once the call succeeds, a later call with the key
+	// returns its result without running the tool. Empty generates a key
+	// for the attempts of this call only.
+	IdempotencyKey string
+
+	// Retries is how many times a transient failure is retried
+	Retries int
+
+	// Backoff is the wait before the first retry, doubled before each
+	// further one
+	Backoff time.Duration
+}
+
+// idempotencyKeyType is the context key of a tool call's idempotency key
+type idempotencyKeyType struct{}
+
+// WithIdempotencyKey attaches a tool call's idempotency key to ctx
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyType{}, key)
+}
+
+// IdempotencyKey returns the idempotency key of the tool call ctx belongs
+// to, or "" outside ExecuteToolWith. Tools that make external changes send
+// it along, such as in an Idempotency-Key header, so the service can drop
+// the repeats of a retried request.
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyType{}).(string)
+	return key
+}
+
+// completedCall is the result of a call made under an idempotency key
+type completedCall struct {
+	params string
+	result interface{}
+}
+
+// IsTransientError reports whether a tool failure may pass on a retry:
+// a call the watchdog abandoned, or a network timeout
+func IsTransientError(err error) bool {
+	if errors.Is(err, ErrCallTimeout) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// ExecuteToolWith executes a tool under an idempotency key, retrying
+// transient failures. A key that already completed a call returns that
+// call's result, and reusing it with different parameters is an error.
+// Retries wait for opts.Backoff, doubling, and stop when ctx is done.
+func (tb *ToolBridge) ExecuteToolWith(ctx context.Context, name string, params map[string]interface{}, opts ToolCallOptions) (interface{}, error) {
+	key := opts.IdempotencyKey
+	if key == "" {
+		key = newIdempotencyKey()
+	}
+	id := name + "\x00" + key
+	paramsKey := CacheKey(params)
+
+	tb.doneMu.Lock()
+	done, ok := tb.done[id]
+	tb.doneMu.Unlock()
+	if ok {
+		if done.params != paramsKey {
+			return nil, fmt.Errorf("idempotency key %q was already used with different parameters for tool %s", key, name)
+		}
+		return done.result, nil
+	}
+
+	ctx = WithIdempotencyKey(ctx, key)
+	backoff := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		result, err := tb.ExecuteTool(ctx, name, params)
+		if err == nil {
+			if opts.IdempotencyKey != "" {
+				tb.doneMu.Lock()
+				if tb.done == nil {
+					tb.done = make(map[string]completedCall)
+				}
+				tb.done[id] = completedCall{params: paramsKey, result: result}
+				tb.doneMu.Unlock()
+			}
+			return result, nil
+		}
+		if attempt >= opts.Retries || !IsTransientError(err) {
+			if attempt > 0 {
+				err = fmt.Errorf("%w (after %d retries)", err, attempt)
+			}
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// newIdempotencyKey generates a key for a call given none
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,84 @@
+// ABOUTME: Tests for idempotency keys and retries of tool executions
+// ABOUTME: Covers key propagation, deduplication, and which failures are retried
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+func TestExecuteToolWith(t *testing.T) {
+	registry := tools.NewRegistry()
+	bridge := NewToolBridge(registry)
+
+	// charge fails transiently as often as told, then records the key it
+	// was charged under
+	var keys []string
+	failures := 0
+	charge := tools.NewFunctionTool("charge", "Charges a card", []byte(`{"type":"object"}`),
+		func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			keys = append(keys, IdempotencyKey(ctx))
+			if failures > 0 {
+				failures--
+				return nil, fmt.Errorf("gateway: %w", ErrCallTimeout)
+			}
+			return fmt.Sprintf("charged %v", params["amount"]), nil
+		})
+	if err := registry.Register(charge); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	params := map[string]interface{}{"amount": 5.0}
+
+	t.Run("retries with one key", func(t *testing.T) {
+		keys, failures = nil, 2
+		result, err := bridge.ExecuteToolWith(ctx, "charge", params, ToolCallOptions{Retries: 2})
+		if err != nil || result != "charged 5" {
+			t.Fatalf("Expected the third attempt to succeed, got %v, %v", result, err)
+		}
+		if len(keys) != 3 || keys[0] == "" || keys[1] != keys[0] || keys[2] != keys[0] {
+			t.Errorf("Expected every attempt to share a generated key, got %q", keys)
+		}
+	})
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		keys, failures = nil, 5
+		_, err := bridge.ExecuteToolWith(ctx, "charge", params, ToolCallOptions{Retries: 1})
+		if !errors.Is(err, ErrCallTimeout) || !strings.Contains(err.Error(), "after 1 retries") || len(keys) != 2 {
+			t.Errorf("Expected two attempts and the last error, got %v after %d", err, len(keys))
+		}
+	})
+
+	t.Run("does not retry other failures", func(t *testing.T) {
+		keys = nil
+		_, err := bridge.ExecuteToolWith(ctx, "missing", params, ToolCallOptions{Retries: 3})
+		if err == nil || len(keys) != 0 {
+			t.Errorf("Expected one failed lookup, got %v", err)
+		}
+	})
+
+	t.Run("runs a keyed call once", func(t *testing.T) {
+		keys, failures = nil, 0
+		opts := ToolCallOptions{IdempotencyKey: "order-42"}
+		for i := 0; i < 2; i++ {
+			result, err := bridge.ExecuteToolWith(ctx, "charge", params, opts)
+			if err != nil || result != "charged 5" {
+				t.Fatalf("Unexpected result %v, %v", result, err)
+			}
+		}
+		if len(keys) != 1 || keys[0] != "order-42" {
+			t.Errorf("Expected one charge under the given key, got %q", keys)
+		}
+
+		_, err := bridge.ExecuteToolWith(ctx, "charge", map[string]interface{}{"amount": 6.0}, opts)
+		if err == nil || !strings.Contains(err.Error(), "different parameters") {
+			t.Errorf("Expected reusing the key with other parameters to fail, got %v", err)
+		}
+	})
+}
@@ -40,6 +40,10 @@ type MethodInfo struct {
 
 	// IsAsync indicates if this method returns a promise/future
 	IsAsync bool
+
+	// ReturnsResult indicates the method returns a Result instead of a
+	// value and an error
+	ReturnsResult bool
 }
 
 // ParameterInfo describes a method parameter
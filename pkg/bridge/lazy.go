@@ -0,0 +1,94 @@
+// ABOUTME: Lazily constructed bridges that only initialize on first use
+// ABOUTME: Construction runs once, even under concurrent first access, and its result is cached
+
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LazyBridge stands in for a bridge that is expensive to create, such as
+// one that loads built-in tools or connects to LLM providers. The bridge is
+// created the first time Get is called, and initialized too if it
+// implements Bridge; later calls, from any goroutine or engine, share the
+// result. Callers type-assert the value to the bridge type create returns.
+type LazyBridge struct {
+	name   string
+	create func(ctx context.Context) (interface{}, error)
+
+	mu       sync.Mutex
+	done     bool
+	bridge   interface{}
+	err      error
+	duration time.Duration
+}
+
+// NewLazyBridge registers create to build the bridge called name on demand
+func NewLazyBridge(name string, create func(ctx context.Context) (interface{}, error)) *LazyBridge {
+	return &LazyBridge{name: name, create: create}
+}
+
+// Get creates and initializes the bridge on first use and returns it. A
+// failure is cached too, so a broken bridge is not retried on every access.
+func (l *LazyBridge) Get(ctx context.Context) (interface{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.done {
+		return l.bridge, l.err
+	}
+
+	start := time.Now()
+	l.bridge, l.err = l.create(ctx)
+	if b, ok := l.bridge.(Bridge); ok && l.err == nil {
+		if err := b.Initialize(ctx); err != nil {
+			l.bridge, l.err = nil, fmt.Errorf("failed to initialize bridge %q: %w", l.name, err)
+		}
+	}
+	l.duration = time.Since(start)
+	l.done = true
+	return l.bridge, l.err
+}
+
+// Initialized reports whether the bridge has been created, and how long
+// creating and initializing it took
+func (l *LazyBridge) Initialized() (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.done, l.duration
+}
+
+// Name returns the name of the bridge
+func (l *LazyBridge) Name() string {
+	return l.name
+}
+
+// Methods returns the methods of the underlying bridge, creating it if needed
+func (l *LazyBridge) Methods() []MethodInfo {
+	bridge, err := l.Get(context.Background())
+	if b, ok := bridge.(Bridge); ok && err == nil {
+		return b.Methods()
+	}
+	return nil
+}
+
+// Initialize does nothing; the bridge initializes on first use
+func (l *LazyBridge) Initialize(ctx context.Context) error {
+	return nil
+}
+
+// Cleanup cleans up the underlying bridge if it was ever created
+func (l *LazyBridge) Cleanup(ctx context.Context) error {
+	l.mu.Lock()
+	bridge := l.bridge
+	l.mu.Unlock()
+
+	if b, ok := bridge.(Bridge); ok {
+		return b.Cleanup(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// ABOUTME: Tests for lazily constructed bridges
+// ABOUTME: Validates single construction under concurrent first access and cached failures
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLazyBridgeConcurrentFirstAccess(t *testing.T) {
+	var created atomic.Int32
+	lazy := NewLazyBridge("llm", func(ctx context.Context) (interface{}, error) {
+		created.Add(1)
+		return &LLMBridge{}, nil
+	})
+
+	if done, _ := lazy.Initialized(); done {
+		t.Fatal("Expected no construction before first use")
+	}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 16)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = lazy.Get(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	if created.Load() != 1 {
+		t.Errorf("Expected one construction, got %d", created.Load())
+	}
+	for _, result := range results {
+		if result != results[0] {
+			t.Fatal("Expected every caller to share the same bridge")
+		}
+	}
+	if done, _ := lazy.Initialized(); !done {
+		t.Error("Expected the bridge to be initialized")
+	}
+	if lazy.Name() != "llm" || len(lazy.Methods()) == 0 {
+		t.Errorf("Expected the llm bridge's methods, got %d", len(lazy.Methods()))
+	}
+}
+
+func TestLazyBridgeCachesFailure(t *testing.T) {
+	attempts := 0
+	lazy := NewLazyBridge("agents", func(ctx context.Context) (interface{}, error) {
+		attempts++
+		return nil, errors.New("unavailable")
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := lazy.Get(context.Background()); err == nil {
+			t.Fatal("Expected an error")
+		}
+	}
+	if attempts != 1 {
+		t.Errorf("Expected one attempt, got %d", attempts)
+	}
+	if err := lazy.Cleanup(context.Background()); err != nil {
+		t.Errorf("Expected cleanup of a failed bridge to succeed: %v", err)
+	}
+}
@@ -5,6 +5,7 @@ package bridge
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -22,12 +23,51 @@ type LLMBridge struct {
 	providers map[string]domain.Provider
 	mu        sync.RWMutex
 	current   string // current provider name
+
+	// model is the logical model requests use; aliases resolve it, and
+	// modelProviders caches a provider per resolved provider/model
+	model          string
+	aliases        ModelAliases
+	modelProviders map[string]domain.Provider
+
+	// apiKeys are keys scripts set for providers, used instead of the
+	// keys in the environment
+	apiKeys map[string]string
+
+	// recovery handles prompts that overflow the context window
+	recovery       ContextRecovery
+	onAdjust       func(ContextAdjustment)
+	lastAdjustment *ContextAdjustment
+
+	// routing spreads calls over several models; nil uses the selected
+	// model. latencies averages each routed model's response time.
+	routing    *RoutingPolicy
+	onFailover func(Failover)
+	latencies  map[string]time.Duration
+
+	// callLog audits every LLM call; nil disables it
+	callLog *CallLogger
+
+	// watchdog abandons provider calls that hang; nil waits
+	watchdog *Watchdog
+
+	// responses caches chat and completion responses; nil disables it
+	responses *ResultCache
+
+	// scriptCache caches responses while the spell has it enabled
+	scriptCache *ResponseCache
+
+	// responseLog records responses for a run snapshot, or replays them
+	responseLog *ResponseLog
 }
 
 // NewLLMBridge creates a new bridge instance
 func NewLLMBridge() (*LLMBridge, error) {
 	bridge := &LLMBridge{
-		providers: make(map[string]domain.Provider),
+		providers:      make(map[string]domain.Provider),
+		model:          DefaultModel,
+		aliases:        DefaultModelAliases(),
+		modelProviders: make(map[string]domain.Provider),
 	}
 
 	// Auto-detect and initialize available providers from environment
@@ -72,13 +112,31 @@ func NewLLMBridge() (*LLMBridge, error) {
 
 // initProvider initializes a provider by name
 func (b *LLMBridge) initProvider(name string) error {
+	provider, err := createProvider(ModelTarget{Provider: name}, "")
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.providers[name] = provider
+	b.mu.Unlock()
+
+	return nil
+}
+
+// createProvider creates a provider for a target, using the provider's
+// default model when the target names none, and apiKey, or the key in the
+// environment when it is empty
+func createProvider(target ModelTarget, apiKey string) (domain.Provider, error) {
 	// Create HTTP client with proper timeout
 	httpClient := &http.Client{
 		Timeout: 120 * time.Second, // 2 minutes
 	}
 
 	config := llmutil.ModelConfig{
-		Provider: name,
+		Provider: target.Provider,
+		Model:    target.Model,
+		APIKey:   apiKey,
 		Options: []domain.ProviderOption{
 			domain.NewHTTPClientOption(httpClient),
 			domain.NewTimeoutOption(120000), // 120 seconds in milliseconds
@@ -87,14 +145,9 @@ func (b *LLMBridge) initProvider(name string) error {
 
 	provider, err := llmutil.CreateProvider(config)
 	if err != nil {
-		return fmt.Errorf("failed to create %s provider: %w", name, err)
+		return nil, fmt.Errorf("failed to create %s provider: %w", target, err)
 	}
-
-	b.mu.Lock()
-	b.providers[name] = provider
-	b.mu.Unlock()
-
-	return nil
+	return provider, nil
 }
 
 // SetProvider switches to a different provider
@@ -110,6 +163,49 @@ func (b *LLMBridge) SetProvider(name string) error {
 	return nil
 }
 
+// providerHosts are the hosts each provider's API key is sent to
+var providerHosts = map[string]string{
+	"openai":    "api.openai.com",
+	"anthropic": "api.anthropic.com",
+	"gemini":    "generativelanguage.googleapis.com",
+}
+
+// ProviderHost returns the host a provider's API key is sent to, or ""
+// for a provider the bridge cannot create
+func ProviderHost(name string) string {
+	return providerHosts[name]
+}
+
+// SetAPIKey makes a provider available with key, in place of the key in
+// the environment, for the requests that follow
+func (b *LLMBridge) SetAPIKey(name, key string) error {
+	if ProviderHost(name) == "" {
+		return fmt.Errorf("unknown provider %q", name)
+	}
+	provider, err := createProvider(ModelTarget{Provider: name}, key)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.providers[name] = provider
+	if b.apiKeys == nil {
+		b.apiKeys = make(map[string]string)
+	}
+	b.apiKeys[name] = key
+	// Providers of specific models were created with the old key
+	for target := range b.modelProviders {
+		if strings.HasPrefix(target, name+"/") {
+			delete(b.modelProviders, target)
+		}
+	}
+	if b.current == "" {
+		b.current = name
+	}
+	return nil
+}
+
 // GetCurrentProvider returns the name of the current provider
 func (b *LLMBridge) GetCurrentProvider() string {
 	b.mu.RLock()
@@ -129,26 +225,209 @@ func (b *LLMBridge) ListProviders() []string {
 	return providers
 }
 
-// getProvider returns the current provider
-func (b *LLMBridge) getProvider() (domain.Provider, error) {
+// SetModelAliases adds or replaces logical model names
+func (b *LLMBridge) SetModelAliases(aliases ModelAliases) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.aliases = b.aliases.Merge(aliases)
+}
+
+// SetModel selects the model for subsequent requests: an alias such as
+// "fast", a "provider/model" pair, or a model of the current provider
+func (b *LLMBridge) SetModel(name string) error {
+	if _, err := b.ResolveModel(name); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.model = name
+	return nil
+}
+
+// GetModel returns the logical model requests use
+func (b *LLMBridge) GetModel() string {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	provider, exists := b.providers[b.current]
-	if !exists {
-		return nil, fmt.Errorf("current provider '%s' not found", b.current)
+	if b.model == "" {
+		return DefaultModel
 	}
-	return provider, nil
+	return b.model
 }
 
-// Chat sends a chat message to the LLM
-func (b *LLMBridge) Chat(ctx context.Context, prompt string) (string, error) {
-	provider, err := b.getProvider()
+// ResolveModel returns the provider and model a name currently resolves to
+func (b *LLMBridge) ResolveModel(name string) (ModelTarget, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.resolveLocked(name)
+}
+
+func (b *LLMBridge) resolveLocked(name string) (ModelTarget, error) {
+	return b.aliases.Resolve(name, b.current, func(provider string) bool {
+		_, ok := b.providers[provider]
+		return ok
+	})
+}
+
+// providerFor returns the provider serving a model name and the target the
+// name resolved to
+func (b *LLMBridge) providerFor(name string) (domain.Provider, ModelTarget, error) {
+	b.mu.RLock()
+	target, err := b.resolveLocked(name)
 	if err != nil {
-		return "", err
+		b.mu.RUnlock()
+		return nil, ModelTarget{}, err
+	}
+	if target.Model == "" {
+		provider := b.providers[target.Provider]
+		b.mu.RUnlock()
+		return provider, target, nil
+	}
+	provider, exists := b.modelProviders[target.String()]
+	apiKey := b.apiKeys[target.Provider]
+	b.mu.RUnlock()
+	if exists {
+		return provider, target, nil
+	}
+
+	provider, err = createProvider(target, apiKey)
+	if err != nil {
+		return nil, ModelTarget{}, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if existing, ok := b.modelProviders[target.String()]; ok {
+		return existing, target, nil
+	}
+	if b.modelProviders == nil {
+		b.modelProviders = make(map[string]domain.Provider)
+	}
+	b.modelProviders[target.String()] = provider
+	return provider, target, nil
+}
+
+// SetCallLogger logs every LLM call to l; nil turns logging off
+func (b *LLMBridge) SetCallLogger(l *CallLogger) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.callLog = l
+}
+
+// SetWatchdog abandons chat and completion requests to providers that
+// outlive w's timeout; nil waits for every request to return. Streaming
+// requests call back into the script, so they are never abandoned.
+func (b *LLMBridge) SetWatchdog(w *Watchdog) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.watchdog = w
+}
+
+// SetResponseCache answers repeated chat and completion prompts for the
+// same model from cache; nil turns caching off. Streaming is never cached.
+func (b *LLMBridge) SetResponseCache(c *ResultCache) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.responses = c
+}
+
+// SetScriptResponseCache gives the spell a response cache it can turn on
+// and off through llm.cache; nil leaves it without one. The cache set with
+// SetResponseCache, if any, takes precedence.
+func (b *LLMBridge) SetScriptResponseCache(c *ResponseCache) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.scriptCache = c
+}
+
+// ScriptResponseCache returns the cache set with SetScriptResponseCache
+func (b *LLMBridge) ScriptResponseCache() *ResponseCache {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.scriptCache
+}
+
+// getWatchdog returns the watchdog for provider calls, if any
+func (b *LLMBridge) getWatchdog() *Watchdog {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.watchdog
+}
+
+// cachedResponse looks up a response for the selected model and returns
+// the key to store a fresh response under; the key is empty when caching
+// is off
+func (b *LLMBridge) cachedResponse(method, prompt string, options ...interface{}) (string, string, bool) {
+	b.mu.RLock()
+	responses, scriptCache := b.responses, b.scriptCache
+	b.mu.RUnlock()
+	if responses == nil && !scriptCache.Enabled() {
+		return "", "", false
+	}
+
+	key, _ := b.responseKey(method, prompt, options...)
+	if key == "" {
+		return "", "", false
+	}
+	if responses == nil {
+		response, ok := scriptCache.Get(key)
+		return response, key, ok
+	}
+	if cached, ok := responses.Get(CacheLLM, key); ok {
+		if response, ok := cached.(string); ok {
+			return response, key, true
+		}
+	}
+	return "", key, false
+}
+
+// cacheResponse stores a response to method under a key from
+// cachedResponse
+func (b *LLMBridge) cacheResponse(key, method, prompt, response string) {
+	if key == "" {
+		return
+	}
+	b.mu.RLock()
+	responses, scriptCache := b.responses, b.scriptCache
+	b.mu.RUnlock()
+	if responses != nil {
+		responses.Put(CacheLLM, key, response)
+		return
+	}
+
+	target, _ := b.ResolveModel(b.GetModel())
+	entry := CachedResponse{Key: key, Method: method, Model: target.String(), Prompt: prompt, Response: response}
+	// A response that cannot be cached is still returned
+	_ = scriptCache.Put(entry)
+}
+
+// beginCall logs an LLM request against the selected model
+func (b *LLMBridge) beginCall(ctx context.Context, method, prompt string) *loggedCall {
+	b.mu.RLock()
+	callLog := b.callLog
+	b.mu.RUnlock()
+	if callLog == nil {
+		return nil
 	}
 
-	messages := []domain.Message{
+	model := b.GetModel()
+	target, _ := b.ResolveModel(model)
+	return callLog.begin(ctx, method, model, target, prompt)
+}
+
+// userMessage wraps a prompt as a single user message
+func userMessage(prompt string) []domain.Message {
+	return []domain.Message{
 		{
 			Role: domain.RoleUser,
 			Content: []domain.ContentPart{
@@ -159,74 +438,261 @@ func (b *LLMBridge) Chat(ctx context.Context, prompt string) (string, error) {
 			},
 		},
 	}
+}
 
-	response, err := provider.GenerateMessage(ctx, messages)
-	if err != nil {
-		return "", fmt.Errorf("LLM completion failed: %w", err)
+// assistantMessage wraps text as the start of the model's reply
+func assistantMessage(text string) domain.Message {
+	return domain.Message{
+		Role: domain.RoleAssistant,
+		Content: []domain.ContentPart{
+			{
+				Type: domain.ContentTypeText,
+				Text: text,
+			},
+		},
 	}
-
-	return response.Content, nil
 }
 
-// Complete generates text completion
-func (b *LLMBridge) Complete(ctx context.Context, prompt string, maxTokens int) (string, error) {
-	provider, err := b.getProvider()
+// Chat sends a chat message to the LLM
+func (b *LLMBridge) Chat(ctx context.Context, prompt string) (string, error) {
+	if response, replaying, err := b.replayedResponse("chat", prompt); replaying {
+		return response, err
+	}
+
+	cached, key, ok := b.cachedResponse("chat", prompt)
+	if ok {
+		b.recordResponse("chat", prompt, cached)
+		return cached, nil
+	}
+
+	call := b.beginCall(ctx, "chat", prompt)
+	watchdog := b.getWatchdog()
+
+	var content string
+	target, adjustment, err := b.withContextRecovery(ctx, prompt, func(provider domain.Provider, _ ModelTarget, prompt string) error {
+		response, err := watchdog.Call(ctx, "llm.chat", func(ctx context.Context) (interface{}, error) {
+			return provider.GenerateMessage(ctx, userMessage(prompt))
+		})
+		if err != nil {
+			return fmt.Errorf("LLM completion failed: %w", err)
+		}
+		content = response.(domain.Response).Content
+		return nil
+	})
+	call.end(target, adjustment, content, finishReason(err), err)
 	if err != nil {
 		return "", err
 	}
 
+	b.cacheResponse(key, "chat", prompt, content)
+	b.recordResponse("chat", prompt, content)
+	return content, nil
+}
+
+// Complete generates text completion
+func (b *LLMBridge) Complete(ctx context.Context, prompt string, maxTokens int) (string, error) {
 	// Use Generate method with options
 	options := []domain.Option{}
 	if maxTokens > 0 {
 		options = append(options, domain.WithMaxTokens(maxTokens))
 	}
 
-	response, err := provider.Generate(ctx, prompt, options...)
+	if response, replaying, err := b.replayedResponse("complete", prompt, maxTokens); replaying {
+		return response, err
+	}
+
+	cached, key, ok := b.cachedResponse("complete", prompt, maxTokens)
+	if ok {
+		b.recordResponse("complete", prompt, cached, maxTokens)
+		return cached, nil
+	}
+
+	call := b.beginCall(ctx, "complete", prompt)
+	watchdog := b.getWatchdog()
+
+	var response string
+	target, adjustment, err := b.withContextRecovery(ctx, prompt, func(provider domain.Provider, _ ModelTarget, prompt string) error {
+		result, err := watchdog.Call(ctx, "llm.complete", func(ctx context.Context) (interface{}, error) {
+			return provider.Generate(ctx, prompt, options...)
+		})
+		if err != nil {
+			return fmt.Errorf("completion failed: %w", err)
+		}
+		response = result.(string)
+		return nil
+	})
+	call.end(target, adjustment, response, finishReason(err), err)
 	if err != nil {
-		return "", fmt.Errorf("completion failed: %w", err)
+		return "", err
 	}
 
+	b.cacheResponse(key, "complete", prompt, response)
+	b.recordResponse("complete", prompt, response, maxTokens)
 	return response, nil
 }
 
-// StreamChat sends a chat message and streams the response
+// StreamChat sends a chat message and streams the response to callback. A
+// stream that breaks off before the response finishes returns a
+// *StreamError with the text delivered so far. Returning ErrStopStream
+// from callback ends the stream early, without an error.
 func (b *LLMBridge) StreamChat(ctx context.Context, prompt string, callback func(chunk string) error) error {
-	provider, err := b.getProvider()
+	return b.ResumeStreamChat(ctx, prompt, StreamPosition{}, callback)
+}
+
+// StreamChatAsync starts StreamChat in the background. The future emits each
+// chunk as a string and resolves with the whole response; if the stream
+// breaks off, its error carries the StreamPosition reached.
+func (b *LLMBridge) StreamChatAsync(ctx context.Context, prompt string) *Future {
+	return Async(ctx, func(ctx context.Context, emit func(interface{})) (interface{}, error) {
+		var position StreamPosition
+		err := b.StreamChat(ctx, prompt, func(chunk string) error {
+			position.advance(chunk)
+			emit(chunk)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return position.Partial, nil
+	})
+}
+
+// ResumeStreamChat continues a response to prompt that was interrupted at
+// from, streaming only the rest to callback. The partial text is sent back
+// as the start of the model's reply; models that accept a prefilled reply,
+// such as Anthropic's, continue where they stopped, while others may repeat
+// or rephrase part of it. An empty position streams a fresh response. A
+// *StreamError from a resumed stream counts from the original start.
+func (b *LLMBridge) ResumeStreamChat(ctx context.Context, prompt string, from StreamPosition, callback func(chunk string) error) error {
+	method := "streamChat"
+	if from.Partial != "" {
+		method = "resumeStreamChat"
+	}
+
+	// A replayed stream delivers the recorded response as one chunk
+	if response, replaying, err := b.replayedResponse(method, prompt, from.Partial); replaying {
+		if err != nil {
+			return err
+		}
+		if response != "" {
+			if err := callback(response); err != nil {
+				return fmt.Errorf("callback error: %w", err)
+			}
+		}
+		return nil
+	}
+
+	// Start streaming; an oversized prompt is rejected before any chunk
+	// arrives, so only starting the stream is retried
+	call := b.beginCall(ctx, method, prompt)
+
+	var stream domain.ResponseStream
+	target, adjustment, err := b.withContextRecovery(ctx, prompt, func(provider domain.Provider, _ ModelTarget, prompt string) error {
+		messages := userMessage(prompt)
+		if from.Partial != "" {
+			messages = append(messages, assistantMessage(from.Partial))
+		}
+		var err error
+		stream, err = provider.StreamMessage(ctx, messages)
+		if err != nil {
+			return fmt.Errorf("failed to start stream: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
+		call.end(target, adjustment, "", finishReason(err), err)
 		return err
 	}
 
-	// Create message for streaming
-	messages := []domain.Message{
-		{
-			Role: domain.RoleUser,
-			Content: []domain.ContentPart{
-				{
-					Type: domain.ContentTypeText,
-					Text: prompt,
-				},
-			},
-		},
+	received, reason, err := readStream(ctx, stream, from, callback)
+	call.end(target, adjustment, received, reason, err)
+	if err != nil {
+		return err
+	}
+	b.recordResponse(method, prompt, received, from.Partial)
+	return nil
+}
+
+// StreamComplete generates a completion of prompt, with at most maxTokens
+// when above zero, and streams it to callback as it arrives. The next
+// chunk is only read once callback returns, so a slow consumer holds the
+// provider back rather than letting the response pile up. Cancelling ctx
+// ends the stream with a *StreamError, like a dropped connection.
+func (b *LLMBridge) StreamComplete(ctx context.Context, prompt string, maxTokens int, callback func(chunk string) error) error {
+	// A replayed stream delivers the recorded response as one chunk
+	if response, replaying, err := b.replayedResponse("streamComplete", prompt, maxTokens); replaying {
+		if err != nil {
+			return err
+		}
+		if response != "" {
+			if err := callback(response); err != nil && !errors.Is(err, ErrStopStream) {
+				return fmt.Errorf("callback error: %w", err)
+			}
+		}
+		return nil
+	}
+
+	options := []domain.Option{}
+	if maxTokens > 0 {
+		options = append(options, domain.WithMaxTokens(maxTokens))
 	}
 
-	// Start streaming
-	stream, err := provider.StreamMessage(ctx, messages)
+	// Stopping early must also stop the provider sending
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	call := b.beginCall(ctx, "streamComplete", prompt)
+
+	var stream domain.ResponseStream
+	target, adjustment, err := b.withContextRecovery(ctx, prompt, func(provider domain.Provider, _ ModelTarget, prompt string) error {
+		var err error
+		stream, err = provider.Stream(ctx, prompt, options...)
+		if err != nil {
+			return fmt.Errorf("failed to start stream: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to start stream: %w", err)
+		call.end(target, adjustment, "", finishReason(err), err)
+		return err
+	}
+
+	received, reason, err := readStream(ctx, stream, StreamPosition{}, callback)
+	call.end(target, adjustment, received, reason, err)
+	if err != nil {
+		return err
 	}
+	b.recordResponse("streamComplete", prompt, received, maxTokens)
+	return nil
+}
 
-	// Process stream chunks from channel
+// readStream passes the chunks of stream to callback until the response
+// finishes, callback stops it, or the stream breaks off, which returns a
+// *StreamError counting from from. It returns the text received and the
+// finish reason for the call log.
+func readStream(ctx context.Context, stream domain.ResponseStream, from StreamPosition, callback func(chunk string) error) (string, string, error) {
+	position := from
+	var received strings.Builder
 	for token := range stream {
-		if err := callback(token.Text); err != nil {
-			return fmt.Errorf("callback error: %w", err)
+		received.WriteString(token.Text)
+		if token.Text != "" {
+			if err := callback(token.Text); errors.Is(err, ErrStopStream) {
+				return received.String(), "stopped", nil
+			} else if err != nil {
+				return received.String(), "callback_error", fmt.Errorf("callback error: %w", err)
+			}
+			position.advance(token.Text)
 		}
 
 		if token.Finished {
-			break
+			return received.String(), "stop", nil
 		}
 	}
 
-	return nil
+	cause := ErrStreamIncomplete
+	if ctx.Err() != nil {
+		cause = context.Cause(ctx)
+	}
+	return received.String(), "interrupted", &StreamError{StreamPosition: position, Err: cause}
 }
 
 // ModelInfo represents information about an available model
@@ -358,10 +824,43 @@ func (b *LLMBridge) Methods() []MethodInfo {
 			Parameters: []ParameterInfo{
 				{Name: "prompt", Type: "string", Required: true, Description: "The message to send"},
 				{Name: "callback", Type: "function", Required: true, Description: "Function to handle stream chunks"},
+				{Name: "options", Type: "object", Required: false, Description: "Options; resume continues an interrupted stream"},
 			},
 			ReturnType: "void",
 			IsAsync:    true,
 		},
+		{
+			Name:        "streamComplete",
+			Description: "Generate a text completion and stream it to a callback as it arrives",
+			Parameters: []ParameterInfo{
+				{Name: "prompt", Type: "string", Required: true, Description: "The text prompt"},
+				{Name: "callback", Type: "function", Required: true, Description: "Function to handle stream chunks; returning false stops the stream"},
+				{Name: "options", Type: "object", Required: false, Description: "Options; max_tokens limits the completion"},
+			},
+			ReturnType: "string",
+			IsAsync:    true,
+		},
+		{
+			Name:        "batch",
+			Description: "Send many prompts at once through a pool of workers and report each one's response or error",
+			Parameters: []ParameterInfo{
+				{Name: "prompts", Type: "array", Required: true, Description: "Prompts, or lists of chat messages"},
+				{Name: "options", Type: "object", Required: false, Description: "concurrency, timeout in seconds per request, and max_tokens for completions"},
+			},
+			ReturnType: "BatchReport",
+			IsAsync:    false,
+		},
+		{
+			Name:        "generateStructured",
+			Description: "Generate JSON matching a schema, retrying with repair prompts when the output does not match",
+			Parameters: []ParameterInfo{
+				{Name: "prompt", Type: "string", Required: true, Description: "What to generate"},
+				{Name: "schema", Type: "object", Required: true, Description: "JSON schema the output must match"},
+				{Name: "options", Type: "object", Required: false, Description: "retries: repair prompts to send after invalid output"},
+			},
+			ReturnType: "any",
+			IsAsync:    false,
+		},
 		{
 			Name:        "setProvider",
 			Description: "Switch to a different LLM provider",
@@ -371,6 +870,66 @@ func (b *LLMBridge) Methods() []MethodInfo {
 			ReturnType: "void",
 			IsAsync:    false,
 		},
+		{
+			Name:        "setModel",
+			Description: "Select the model for subsequent requests by alias (default, fast, smart), provider/model, or model name",
+			Parameters: []ParameterInfo{
+				{Name: "name", Type: "string", Required: true, Description: "Model alias or name"},
+			},
+			ReturnType: "void",
+			IsAsync:    false,
+		},
+		{
+			Name:        "getModel",
+			Description: "Get the logical model requests use",
+			Parameters:  []ParameterInfo{},
+			ReturnType:  "string",
+			IsAsync:     false,
+		},
+		{
+			Name:        "resolveModel",
+			Description: "Resolve a model alias or name to a provider and model",
+			Parameters: []ParameterInfo{
+				{Name: "name", Type: "string", Required: true, Description: "Model alias or name"},
+			},
+			ReturnType: "ModelTarget",
+			IsAsync:    false,
+		},
+		{
+			Name:        "setContextFallback",
+			Description: "Retry calls that overflow a model's context window on a larger model",
+			Parameters: []ParameterInfo{
+				{Name: "model", Type: "string", Required: true, Description: "Model alias or name that overflows"},
+				{Name: "larger", Type: "string", Required: true, Description: "Larger-context model to retry with"},
+			},
+			ReturnType: "void",
+			IsAsync:    false,
+		},
+		{
+			Name:        "setContextTrim",
+			Description: "Retry calls that overflow the context window with the prompt trimmed to a token budget",
+			Parameters: []ParameterInfo{
+				{Name: "tokens", Type: "number", Required: true, Description: "Approximate token budget; 0 disables trimming"},
+			},
+			ReturnType: "void",
+			IsAsync:    false,
+		},
+		{
+			Name:        "setRouting",
+			Description: "Route calls over an ordered list of models, retrying and failing over on rate limits and server errors",
+			Parameters: []ParameterInfo{
+				{Name: "options", Type: "object", Required: true, Description: "providers lists the models; retries, backoff, and latency tune the routing"},
+			},
+			ReturnType: "void",
+			IsAsync:    false,
+		},
+		{
+			Name:        "lastAdjustment",
+			Description: "Get the context-window adjustment made to the most recent call",
+			Parameters:  []ParameterInfo{},
+			ReturnType:  "ContextAdjustment",
+			IsAsync:     false,
+		},
 		{
 			Name:        "getCurrentProvider",
 			Description: "Get the name of the current provider",
@@ -417,6 +976,7 @@ func (b *LLMBridge) Cleanup(ctx context.Context) error {
 
 	// Clear providers
 	b.providers = nil
+	b.modelProviders = nil
 	b.current = ""
 
 	return nil
@@ -6,10 +6,12 @@ package bridge
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/lexlapax/go-llms/pkg/llm/domain"
 	schemadomain "github.com/lexlapax/go-llms/pkg/schema/domain"
@@ -151,6 +153,53 @@ func TestLLMBridge(t *testing.T) {
 		}
 	})
 
+	t.Run("model aliases", func(t *testing.T) {
+		bridge := &LLMBridge{
+			providers: make(map[string]domain.Provider),
+			current:   "openai",
+		}
+
+		var used string
+		for _, name := range []string{"openai", "anthropic"} {
+			name := name
+			bridge.providers[name] = &MockProvider{
+				generateMsgFunc: func(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.Response, error) {
+					used = name
+					return domain.Response{Content: "ok"}, nil
+				},
+			}
+		}
+		bridge.SetModelAliases(ModelAliases{
+			"fast": {{Provider: "gemini", Model: "gemini-1.5-flash"}, {Provider: "anthropic"}},
+		})
+
+		if bridge.GetModel() != DefaultModel {
+			t.Errorf("expected default model, got %s", bridge.GetModel())
+		}
+		if _, err := bridge.Chat(context.Background(), "hi"); err != nil || used != "openai" {
+			t.Errorf("expected default model on current provider, got %s (%v)", used, err)
+		}
+
+		if err := bridge.SetModel("fast"); err != nil {
+			t.Fatalf("failed to set model: %v", err)
+		}
+		if _, err := bridge.Chat(context.Background(), "hi"); err != nil || used != "anthropic" {
+			t.Errorf("expected fast alias to fall back to anthropic, got %s (%v)", used, err)
+		}
+
+		target, err := bridge.ResolveModel("fast")
+		if err != nil || target.Provider != "anthropic" {
+			t.Errorf("unexpected resolution: %v, %v", target, err)
+		}
+
+		if err := bridge.SetModel("gemini/gemini-1.5-pro"); err == nil {
+			t.Error("expected error selecting a model of an unavailable provider")
+		}
+		if bridge.GetModel() != "fast" {
+			t.Errorf("expected failed selection to keep the model, got %s", bridge.GetModel())
+		}
+	})
+
 	t.Run("chat functionality", func(t *testing.T) {
 		bridge := &LLMBridge{
 			providers: make(map[string]domain.Provider),
@@ -263,6 +312,62 @@ func TestLLMBridge(t *testing.T) {
 		}
 	})
 
+	t.Run("streaming completion", func(t *testing.T) {
+		var maxTokens int
+		providerDone := make(chan struct{})
+		provider := &MockProvider{streamFunc: func(ctx context.Context, prompt string, options ...domain.Option) (domain.ResponseStream, error) {
+			opts := domain.DefaultOptions()
+			for _, option := range options {
+				option(opts)
+			}
+			maxTokens = opts.MaxTokens
+			ch := make(chan domain.Token)
+			go func() {
+				defer close(providerDone)
+				defer close(ch)
+				for i := 0; ; i++ {
+					select {
+					case <-ctx.Done():
+						return
+					case ch <- domain.Token{Text: fmt.Sprintf("w%d ", i)}:
+					}
+				}
+			}()
+			return ch, nil
+		}}
+		bridge := &LLMBridge{providers: map[string]domain.Provider{"test": provider}, current: "test"}
+
+		var received []string
+		err := bridge.StreamComplete(context.Background(), "count", 50, func(chunk string) error {
+			received = append(received, chunk)
+			if len(received) == 3 {
+				return ErrStopStream
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("StreamComplete() error = %v", err)
+		}
+		if got := strings.Join(received, ""); got != "w0 w1 w2 " || maxTokens != 50 {
+			t.Errorf("Received %q with max tokens %d", got, maxTokens)
+		}
+		select {
+		case <-providerDone:
+		case <-time.After(time.Second):
+			t.Error("Expected stopping the stream to stop the provider")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		providerDone = make(chan struct{})
+		err = bridge.StreamComplete(ctx, "count", 0, func(chunk string) error {
+			cancel()
+			return nil
+		})
+		if position, ok := StreamPositionOf(err); !ok || !errors.Is(err, context.Canceled) || position.Chunks == 0 {
+			t.Errorf("Expected a cancelled stream to report where it stopped, got %v", err)
+		}
+	})
+
 	t.Run("bridge interface implementation", func(t *testing.T) {
 		bridge := &LLMBridge{
 			providers: make(map[string]domain.Provider),
@@ -276,8 +381,8 @@ func TestLLMBridge(t *testing.T) {
 
 		// Test Methods
 		methods := bridge.Methods()
-		if len(methods) != 8 {
-			t.Errorf("expected 8 methods, got %d", len(methods))
+		if len(methods) != 18 {
+			t.Errorf("expected 18 methods, got %d", len(methods))
 		}
 
 		// Verify key methods exist
@@ -289,6 +394,8 @@ func TestLLMBridge(t *testing.T) {
 		expectedMethods := []string{
 			"chat", "complete", "streamChat", "setProvider",
 			"getCurrentProvider", "listProviders", "listModels", "listModelsForProvider",
+			"setModel", "getModel", "resolveModel",
+			"setContextFallback", "setContextTrim", "lastAdjustment",
 		}
 
 		for _, expected := range expectedMethods {
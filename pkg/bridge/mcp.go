@@ -0,0 +1,352 @@
+// ABOUTME: MCP bridge: connects to Model Context Protocol servers and adds their tools to the tool bridge
+// ABOUTME: Tools are registered as <server>__<tool> with the source mcp:<server>; resources can be listed and read
+
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lexlapax/go-llmspell/pkg/mcp"
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+// MCPToolSeparator joins a server's name and a tool's name into the name
+// the tool is registered under. Providers accept it in tool names.
+const MCPToolSeparator = "__"
+
+// MCPConfig names the servers spells may connect to by name
+type MCPConfig struct {
+	Servers map[string]mcp.ServerConfig `json:"servers"`
+
+	// CheckURL, when set, vets every request to a server at a URL,
+	// including each redirect
+	CheckURL func(*url.URL) error `json:"-"`
+}
+
+// LoadMCPConfig reads server definitions from a JSON file:
+//
+//	{"servers": {"files": {"command": "mcp-server-filesystem", "args": ["/data"]}, "search": {"url": "https://example.com/mcp"}}}
+func LoadMCPConfig(path string) (MCPConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return MCPConfig{}, err
+	}
+	var config MCPConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return MCPConfig{}, fmt.Errorf("invalid MCP config %s: %w", path, err)
+	}
+	for name := range config.Servers {
+		if err := checkServerName(name); err != nil {
+			return MCPConfig{}, fmt.Errorf("invalid MCP config %s: %w", path, err)
+		}
+	}
+	return config, nil
+}
+
+// mcpServer is a connected server and the tools registered for it
+type mcpServer struct {
+	client *mcp.Client
+	tools  []string
+}
+
+// MCPBridge connects to MCP servers and registers their tools with a tool
+// bridge, so scripts and agents call them like any other tool
+type MCPBridge struct {
+	tools  *ToolBridge
+	config MCPConfig
+
+	mu      sync.Mutex
+	servers map[string]*mcpServer
+}
+
+// NewMCPBridge registers tools with tb; config names the servers Connect
+// can reach without a definition of their own
+func NewMCPBridge(tb *ToolBridge, config MCPConfig) *MCPBridge {
+	return &MCPBridge{tools: tb, config: config, servers: make(map[string]*mcpServer)}
+}
+
+// Connect starts a session with a server under name, using server, or the
+// configured definition when server is nil, and registers its tools. It
+// returns the names the tools are registered under.
+func (b *MCPBridge) Connect(ctx context.Context, name string, server *mcp.ServerConfig) ([]string, error) {
+	if err := checkServerName(name); err != nil {
+		return nil, err
+	}
+	if server == nil {
+		configured, ok := b.config.Servers[name]
+		if !ok {
+			return nil, fmt.Errorf("no MCP server %q is configured", name)
+		}
+		server = &configured
+	}
+	if server.URL != "" && b.config.CheckURL != nil {
+		checked := *server
+		checked.Client = checkedClient(b.config.CheckURL, 0)
+		server = &checked
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.servers[name]; ok {
+		return nil, fmt.Errorf("MCP server %q is already connected", name)
+	}
+
+	client, err := mcp.Connect(ctx, *server)
+	if err != nil {
+		return nil, fmt.Errorf("MCP server %s: %w", name, err)
+	}
+	serverTools, err := client.ListTools(ctx)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("MCP server %s: %w", name, err)
+	}
+
+	connected := &mcpServer{client: client}
+	for _, serverTool := range serverTools {
+		tool := newMCPTool(name, client, serverTool)
+		if err := b.tools.registry.Register(tool); err != nil {
+			b.removeTools(connected)
+			client.Close()
+			return nil, fmt.Errorf("MCP server %s: %w", name, err)
+		}
+		b.tools.toolChanged(tool.Name())
+		connected.tools = append(connected.tools, tool.Name())
+	}
+	b.servers[name] = connected
+	return append([]string(nil), connected.tools...), nil
+}
+
+// Disconnect removes the tools of the server connected as name and ends
+// its session
+func (b *MCPBridge) Disconnect(name string) error {
+	b.mu.Lock()
+	server, ok := b.servers[name]
+	delete(b.servers, name)
+	b.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("MCP server %q is not connected", name)
+	}
+	b.removeTools(server)
+	return server.client.Close()
+}
+
+// removeTools unregisters the tools of server
+func (b *MCPBridge) removeTools(server *mcpServer) {
+	for _, name := range server.tools {
+		b.tools.RemoveTool(name)
+	}
+}
+
+// Servers describes the connected servers, sorted by name
+func (b *MCPBridge) Servers() []map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	names := make([]string, 0, len(b.servers))
+	for name := range b.servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]map[string]interface{}, len(names))
+	for i, name := range names {
+		server := b.servers[name]
+		info := server.client.Info()
+		result[i] = map[string]interface{}{
+			"name":     name,
+			"server":   info.Name,
+			"version":  info.Version,
+			"protocol": info.Protocol,
+			"tools":    append([]string(nil), server.tools...),
+		}
+	}
+	return result
+}
+
+// Configured lists the servers Connect can reach by name alone, sorted
+func (b *MCPBridge) Configured() []string {
+	names := make([]string, 0, len(b.config.Servers))
+	for name := range b.config.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ListResources lists the resources of the server connected as name
+func (b *MCPBridge) ListResources(ctx context.Context, name string) ([]mcp.Resource, error) {
+	client, err := b.client(name)
+	if err != nil {
+		return nil, err
+	}
+	return client.ListResources(ctx)
+}
+
+// ReadResource reads a resource of the server connected as name
+func (b *MCPBridge) ReadResource(ctx context.Context, name, uri string) ([]mcp.ResourceContents, error) {
+	client, err := b.client(name)
+	if err != nil {
+		return nil, err
+	}
+	return client.ReadResource(ctx, uri)
+}
+
+// client returns the client of the server connected as name
+func (b *MCPBridge) client(name string) (*mcp.Client, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	server, ok := b.servers[name]
+	if !ok {
+		return nil, fmt.Errorf("MCP server %q is not connected", name)
+	}
+	return server.client, nil
+}
+
+// Close disconnects every server
+func (b *MCPBridge) Close() error {
+	b.mu.Lock()
+	names := make([]string, 0, len(b.servers))
+	for name := range b.servers {
+		names = append(names, name)
+	}
+	b.mu.Unlock()
+
+	for _, name := range names {
+		b.Disconnect(name)
+	}
+	return nil
+}
+
+// checkServerName accepts names of letters, digits, '-' and '_', which can
+// start a tool name
+func checkServerName(name string) error {
+	if name == "" || strings.Contains(name, MCPToolSeparator) || strings.IndexFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+	}) >= 0 {
+		return fmt.Errorf("invalid MCP server name %q: use letters, digits, '-' and single '_'", name)
+	}
+	return nil
+}
+
+// newMCPTool wraps a server's tool for the tool registry
+func newMCPTool(server string, client *mcp.Client, tool mcp.Tool) *tools.FunctionTool {
+	schema := tool.InputSchema
+	if len(schema) == 0 {
+		schema = json.RawMessage(`{"type":"object"}`)
+	}
+	return tools.NewFunctionTool(server+MCPToolSeparator+tool.Name, tool.Description, schema,
+		func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			result, err := client.CallTool(ctx, tool.Name, params)
+			if err != nil {
+				return nil, err
+			}
+			return mcpToolValue(result)
+		},
+	).WithMetadata("mcp", "mcp", server).WithSource("mcp:" + server)
+}
+
+// mcpToolValue turns a tool result into a value for scripts: its
+// structured content, else its text, else its content items. A failure the
+// tool reported is returned as an error.
+func mcpToolValue(result *mcp.ToolResult) (interface{}, error) {
+	if result.IsError {
+		text := result.Text()
+		if text == "" {
+			text = "the tool reported an error"
+		}
+		return nil, fmt.Errorf("%s", text)
+	}
+	if result.StructuredContent != nil {
+		return result.StructuredContent, nil
+	}
+
+	textOnly := true
+	for _, content := range result.Content {
+		textOnly = textOnly && content.Type == "text"
+	}
+	if textOnly {
+		return result.Text(), nil
+	}
+	items := make([]interface{}, len(result.Content))
+	for i, content := range result.Content {
+		var item map[string]interface{}
+		data, _ := json.Marshal(content)
+		json.Unmarshal(data, &item)
+		items[i] = item
+	}
+	return items, nil
+}
+
+// Name returns the name of the bridge
+func (b *MCPBridge) Name() string {
+	return "mcp"
+}
+
+// Methods returns information about all methods exposed by this bridge
+func (b *MCPBridge) Methods() []MethodInfo {
+	return []MethodInfo{
+		{
+			Name:        "connect",
+			Description: "Connect to an MCP server and register its tools",
+			Parameters: []ParameterInfo{
+				{Name: "name", Type: "string", Required: true, Description: "Name of the server, a prefix of its tools' names"},
+				{Name: "server", Type: "object", Required: false, Description: "command, args, and env, or url and headers; the configured server when omitted"},
+			},
+			ReturnType: "string[]",
+		},
+		{
+			Name:        "disconnect",
+			Description: "Remove a server's tools and end its session",
+			Parameters: []ParameterInfo{
+				{Name: "name", Type: "string", Required: true, Description: "Name of the server"},
+			},
+			ReturnType: "void",
+		},
+		{
+			Name:        "servers",
+			Description: "List the connected servers",
+			ReturnType:  "object[]",
+		},
+		{
+			Name:        "configured",
+			Description: "List the servers that can be connected by name",
+			ReturnType:  "string[]",
+		},
+		{
+			Name:        "listResources",
+			Description: "List a server's resources",
+			Parameters: []ParameterInfo{
+				{Name: "name", Type: "string", Required: true, Description: "Name of the server"},
+			},
+			ReturnType: "object[]",
+		},
+		{
+			Name:        "readResource",
+			Description: "Read a server's resource",
+			Parameters: []ParameterInfo{
+				{Name: "name", Type: "string", Required: true, Description: "Name of the server"},
+				{Name: "uri", Type: "string", Required: true, Description: "URI of the resource"},
+			},
+			ReturnType: "object[]",
+		},
+	}
+}
+
+// Initialize prepares the bridge for use
+func (b *MCPBridge) Initialize(ctx context.Context) error {
+	return nil
+}
+
+// Cleanup disconnects every server
+func (b *MCPBridge) Cleanup(ctx context.Context) error {
+	return b.Close()
+}
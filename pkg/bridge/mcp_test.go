@@ -0,0 +1,224 @@
+// ABOUTME: Tests for the MCP bridge against an HTTP MCP server
+// ABOUTME: Validates tool registration with a source tag, tool calls through the tool bridge, resources, and disconnecting
+
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/mcp"
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+// mcpHandler is an MCP server offering a weather tool and a resource
+func mcpHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     *int64 `json:"id"`
+		Method string `json:"method"`
+		Params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		} `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.ID == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var result interface{}
+	switch req.Method {
+	case "initialize":
+		result = map[string]interface{}{"protocolVersion": mcp.ProtocolVersion, "serverInfo": map[string]interface{}{"name": "weather-server", "version": "2.0"}}
+	case "tools/list":
+		result = map[string]interface{}{"tools": []interface{}{
+			map[string]interface{}{"name": "forecast", "description": "Forecast for a city", "inputSchema": map[string]interface{}{
+				"type": "object", "properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}},
+			}},
+			map[string]interface{}{"name": "stations", "description": "Weather stations"},
+		}}
+	case "tools/call":
+		switch req.Params.Name {
+		case "forecast":
+			city, _ := req.Params.Arguments["city"].(string)
+			if city == "" {
+				result = map[string]interface{}{"content": []interface{}{map[string]interface{}{"type": "text", "text": "city is required"}}, "isError": true}
+			} else {
+				result = map[string]interface{}{"content": []interface{}{map[string]interface{}{"type": "text", "text": "Sunny in " + city}}}
+			}
+		default:
+			result = map[string]interface{}{"structuredContent": map[string]interface{}{"count": 3}, "content": []interface{}{}}
+		}
+	case "resources/list":
+		result = map[string]interface{}{"resources": []interface{}{map[string]interface{}{"uri": "weather://alerts", "name": "alerts"}}}
+	case "resources/read":
+		result = map[string]interface{}{"contents": []interface{}{map[string]interface{}{"uri": "weather://alerts", "text": "none"}}}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+}
+
+func TestMCPBridge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(mcpHandler))
+	defer server.Close()
+	ctx := context.Background()
+
+	tb := NewToolBridge(tools.NewRegistry())
+	mb := NewMCPBridge(tb, MCPConfig{Servers: map[string]mcp.ServerConfig{"weather": {URL: server.URL}}})
+	defer mb.Close()
+
+	names, err := mb.Connect(ctx, "weather", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"weather__forecast", "weather__stations"}) {
+		t.Errorf("Connect() = %v", names)
+	}
+
+	t.Run("lists tools with their source", func(t *testing.T) {
+		listed := tb.ListTools()
+		if len(listed) != 2 {
+			t.Fatalf("Expected the server's tools, got %v", listed)
+		}
+		forecast := listed[0]
+		if forecast["name"] != "weather__forecast" || forecast["source"] != "mcp:weather" || forecast["category"] != "mcp" {
+			t.Errorf("Unexpected tool: %v", forecast)
+		}
+		if !reflect.DeepEqual(forecast["tags"], []string{"mcp", "weather"}) {
+			t.Errorf("Unexpected tags: %v", forecast["tags"])
+		}
+		if params, _ := forecast["parameters"].(map[string]interface{}); params["properties"] == nil {
+			t.Errorf("Expected the input schema as parameters, got %v", forecast["parameters"])
+		}
+		if params, _ := listed[1]["parameters"].(map[string]interface{}); params["type"] != "object" {
+			t.Errorf("Expected a tool without a schema to take an object, got %v", listed[1]["parameters"])
+		}
+	})
+
+	t.Run("calls tools", func(t *testing.T) {
+		result, err := tb.ExecuteTool(ctx, "weather__forecast", map[string]interface{}{"city": "Oslo"})
+		if err != nil || result != "Sunny in Oslo" {
+			t.Errorf("ExecuteTool() = %v, %v", result, err)
+		}
+		if _, err := tb.ExecuteTool(ctx, "weather__forecast", nil); err == nil || err.Error() != "city is required" {
+			t.Errorf("Expected the tool's error, got %v", err)
+		}
+		result, err = tb.ExecuteTool(ctx, "weather__stations", nil)
+		if err != nil || !reflect.DeepEqual(result, map[string]interface{}{"count": float64(3)}) {
+			t.Errorf("Expected structured content, got %v, %v", result, err)
+		}
+	})
+
+	t.Run("reads resources", func(t *testing.T) {
+		resources, err := mb.ListResources(ctx, "weather")
+		if err != nil || len(resources) != 1 || resources[0].URI != "weather://alerts" {
+			t.Errorf("ListResources() = %v, %v", resources, err)
+		}
+		contents, err := mb.ReadResource(ctx, "weather", "weather://alerts")
+		if err != nil || len(contents) != 1 || contents[0].Text != "none" {
+			t.Errorf("ReadResource() = %v, %v", contents, err)
+		}
+		if _, err := mb.ListResources(ctx, "other"); err == nil {
+			t.Error("Expected an error for a server that is not connected")
+		}
+	})
+
+	t.Run("describes servers", func(t *testing.T) {
+		servers := mb.Servers()
+		if len(servers) != 1 || servers[0]["server"] != "weather-server" || servers[0]["version"] != "2.0" {
+			t.Errorf("Servers() = %v", servers)
+		}
+		if !reflect.DeepEqual(mb.Configured(), []string{"weather"}) {
+			t.Errorf("Configured() = %v", mb.Configured())
+		}
+	})
+
+	t.Run("refuses bad connections", func(t *testing.T) {
+		if _, err := mb.Connect(ctx, "weather", nil); err == nil || !strings.Contains(err.Error(), "already connected") {
+			t.Errorf("Expected a second connection to be refused, got %v", err)
+		}
+		if _, err := mb.Connect(ctx, "unknown", nil); err == nil {
+			t.Error("Expected an unconfigured server to be refused")
+		}
+		if _, err := mb.Connect(ctx, "a__b", &mcp.ServerConfig{URL: server.URL}); err == nil {
+			t.Error("Expected an invalid name to be refused")
+		}
+		// A clash with a script's tool leaves no tools of the server behind
+		tb.RegisterTool("other__stations", "", nil, func(map[string]interface{}) (interface{}, error) { return nil, nil })
+		if _, err := mb.Connect(ctx, "other", &mcp.ServerConfig{URL: server.URL}); err == nil {
+			t.Error("Expected a clash to be refused")
+		}
+		if _, err := tb.GetTool("other__forecast"); err == nil {
+			t.Error("Expected the tools of a refused server to be removed")
+		}
+		tb.RemoveTool("other__stations")
+	})
+
+	t.Run("disconnects", func(t *testing.T) {
+		if err := mb.Disconnect("weather"); err != nil {
+			t.Fatal(err)
+		}
+		if listed := tb.ListTools(); len(listed) != 0 {
+			t.Errorf("Expected the server's tools to be removed, got %v", listed)
+		}
+		if err := mb.Disconnect("weather"); err == nil {
+			t.Error("Expected a second disconnect to fail")
+		}
+	})
+}
+
+func TestMCPBridgeCheckURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(mcpHandler))
+	defer server.Close()
+	ctx := context.Background()
+
+	var checked []string
+	refuse := func(u *url.URL) error {
+		checked = append(checked, u.String())
+		return fmt.Errorf("%s is not allowed", u.Host)
+	}
+	tb := NewToolBridge(tools.NewRegistry())
+	mb := NewMCPBridge(tb, MCPConfig{Servers: map[string]mcp.ServerConfig{"weather": {URL: server.URL}}, CheckURL: refuse})
+	defer mb.Close()
+
+	if _, err := mb.Connect(ctx, "weather", nil); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Expected a configured server the check refuses to be refused, got %v", err)
+	}
+	if _, err := mb.Connect(ctx, "script", &mcp.ServerConfig{URL: server.URL}); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Expected a script's server the check refuses to be refused, got %v", err)
+	}
+	if len(checked) != 2 {
+		t.Errorf("Expected both servers to be checked, got %v", checked)
+	}
+	if listed := tb.ListTools(); len(listed) != 0 {
+		t.Errorf("Expected no tools from refused servers, got %v", listed)
+	}
+}
+
+func TestLoadMCPConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mcp.json")
+	os.WriteFile(path, []byte(`{"servers": {"files": {"command": "mcp-files", "args": ["/data"], "env": {"DEBUG": "1"}}}}`), 0644)
+	config, err := LoadMCPConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mcp.ServerConfig{Command: "mcp-files", Args: []string{"/data"}, Env: map[string]string{"DEBUG": "1"}}
+	if !reflect.DeepEqual(config.Servers["files"], want) {
+		t.Errorf("LoadMCPConfig() = %+v", config)
+	}
+
+	os.WriteFile(path, []byte(`{"servers": {"bad name": {"url": "http://localhost"}}}`), 0644)
+	if _, err := LoadMCPConfig(path); err == nil {
+		t.Error("Expected an invalid server name to be refused")
+	}
+}
@@ -0,0 +1,222 @@
+// ABOUTME: Result cache shared by sub-spell memoization and LLM responses
+// ABOUTME: Entries live for a run, or on disk across runs until their TTL expires
+
+package bridge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Cache kinds for the entries of a ResultCache
+const (
+	// CacheSpell holds the results of spell.run
+	CacheSpell = "spell"
+
+	// CacheLLM holds LLM responses
+	CacheLLM = "llm"
+)
+
+// CacheStats counts how a kind of cache entry was used
+type CacheStats struct {
+	Hits     int `json:"hits"`
+	Misses   int `json:"misses"`
+	Bypassed int `json:"bypassed,omitempty"`
+}
+
+// ResultCacheOptions configure a ResultCache
+type ResultCacheOptions struct {
+	// TTL is how long entries stay valid; zero keeps them for the life of
+	// the cache only
+	TTL time.Duration
+
+	// Dir, with a TTL, stores entries as files so later runs can use them
+	Dir string
+}
+
+// ResultCache memoizes results by a key derived from their inputs. Values
+// must survive a JSON round trip when entries are stored on disk, which
+// holds for anything a script can return.
+type ResultCache struct {
+	opts ResultCacheOptions
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	stats   map[string]*CacheStats
+}
+
+// cacheEntry is a cached value and when it stops being valid
+type cacheEntry struct {
+	Value   interface{} `json:"value"`
+	Expires time.Time   `json:"expires,omitempty"`
+}
+
+// NewResultCache creates an empty cache
+func NewResultCache(opts ResultCacheOptions) *ResultCache {
+	return &ResultCache{
+		opts:    opts,
+		entries: make(map[string]cacheEntry),
+		stats:   make(map[string]*CacheStats),
+	}
+}
+
+// CacheKey hashes the inputs of a computation into a cache key
+func CacheKey(parts ...interface{}) string {
+	hash := sha256.New()
+	enc := json.NewEncoder(hash)
+	for _, part := range parts {
+		// Maps encode with sorted keys, so equal inputs hash the same
+		if err := enc.Encode(part); err != nil {
+			fmt.Fprintf(hash, "%#v\n", part)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Get returns the cached value for key, if there is a valid one. A nil
+// cache never hits.
+func (c *ResultCache) Get(kind, key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := kind + "-" + key
+	entry, ok := c.entries[id]
+	if !ok {
+		entry, ok = c.load(id)
+	}
+	if ok && !entry.Expires.IsZero() && time.Now().After(entry.Expires) {
+		delete(c.entries, id)
+		ok = false
+	}
+	if ok {
+		c.statsFor(kind).Hits++
+		return entry.Value, true
+	}
+	c.statsFor(kind).Misses++
+	return nil, false
+}
+
+// Put caches value under key
+func (c *ResultCache) Put(kind, key string, value interface{}) {
+	if c == nil {
+		return
+	}
+
+	entry := cacheEntry{Value: value}
+	if c.opts.TTL > 0 {
+		entry.Expires = time.Now().Add(c.opts.TTL)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := kind + "-" + key
+	c.entries[id] = entry
+	c.store(id, entry)
+}
+
+// Bypass counts a lookup the caller chose to skip
+func (c *ResultCache) Bypass(kind string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.statsFor(kind).Bypassed++
+}
+
+// Record counts a lookup of kind made elsewhere, such as in the backend of
+// a ScriptCache, as a hit or a miss
+func (c *ResultCache) Record(kind string, hit bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if hit {
+		c.statsFor(kind).Hits++
+	} else {
+		c.statsFor(kind).Misses++
+	}
+}
+
+// Stats returns the usage counts of each kind of entry
+func (c *ResultCache) Stats() map[string]CacheStats {
+	stats := make(map[string]CacheStats)
+	if c == nil {
+		return stats
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for kind, s := range c.stats {
+		stats[kind] = *s
+	}
+	return stats
+}
+
+// Persistent reports whether entries outlive the run
+func (c *ResultCache) Persistent() bool {
+	return c != nil && c.opts.TTL > 0 && c.opts.Dir != ""
+}
+
+func (c *ResultCache) statsFor(kind string) *CacheStats {
+	s, ok := c.stats[kind]
+	if !ok {
+		s = &CacheStats{}
+		c.stats[kind] = s
+	}
+	return s
+}
+
+// load reads an entry stored by an earlier run
+func (c *ResultCache) load(id string) (cacheEntry, bool) {
+	if !c.Persistent() {
+		return cacheEntry{}, false
+	}
+	data, err := os.ReadFile(filepath.Join(c.opts.Dir, id+".json"))
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return cacheEntry{}, false
+	}
+	c.entries[id] = entry
+	return entry, true
+}
+
+// store writes an entry for later runs; failures only lose the entry
+func (c *ResultCache) store(id string, entry cacheEntry) {
+	if !c.Persistent() {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(c.opts.Dir, 0700); err != nil {
+		return
+	}
+	path := filepath.Join(c.opts.Dir, id+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, path)
+}
@@ -0,0 +1,168 @@
+// ABOUTME: Tests for the result cache behind sub-spell memoization and LLM responses
+// ABOUTME: Validates hits, bypasses, TTL expiry, persistence across runs, and cached LLM calls
+
+package bridge
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+)
+
+func TestCacheKey(t *testing.T) {
+	a := CacheKey("spell.lua", map[string]interface{}{"a": 1, "b": "x"})
+	b := CacheKey("spell.lua", map[string]interface{}{"b": "x", "a": 1})
+	if a != b {
+		t.Error("Expected equal params to give equal keys")
+	}
+	if a == CacheKey("spell.lua", map[string]interface{}{"a": 2, "b": "x"}) {
+		t.Error("Expected different params to give different keys")
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	t.Run("memoizes within a run", func(t *testing.T) {
+		cache := NewResultCache(ResultCacheOptions{})
+		if _, ok := cache.Get(CacheSpell, "k"); ok {
+			t.Fatal("Expected a miss on an empty cache")
+		}
+		cache.Put(CacheSpell, "k", "v")
+		if value, ok := cache.Get(CacheSpell, "k"); !ok || value != "v" {
+			t.Errorf("Expected a hit, got %v %v", value, ok)
+		}
+		cache.Bypass(CacheSpell)
+
+		stats := cache.Stats()[CacheSpell]
+		if stats != (CacheStats{Hits: 1, Misses: 1, Bypassed: 1}) {
+			t.Errorf("Unexpected stats %+v", stats)
+		}
+		if cache.Persistent() {
+			t.Error("Expected a cache without a TTL to stay in memory")
+		}
+	})
+
+	t.Run("persists across runs until the TTL expires", func(t *testing.T) {
+		dir := t.TempDir()
+		first := NewResultCache(ResultCacheOptions{TTL: time.Hour, Dir: dir})
+		first.Put(CacheSpell, "k", map[string]interface{}{"n": 1})
+
+		second := NewResultCache(ResultCacheOptions{TTL: time.Hour, Dir: dir})
+		value, ok := second.Get(CacheSpell, "k")
+		if !ok {
+			t.Fatal("Expected a later run to see the entry")
+		}
+		if value.(map[string]interface{})["n"] != float64(1) {
+			t.Errorf("Unexpected value %v", value)
+		}
+		if info, err := os.Stat(filepath.Join(dir, "spell-k.json")); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("Expected a private cache file: %v", err)
+		}
+
+		expired := NewResultCache(ResultCacheOptions{TTL: time.Nanosecond, Dir: t.TempDir()})
+		expired.Put(CacheSpell, "k", "v")
+		time.Sleep(time.Millisecond)
+		if _, ok := expired.Get(CacheSpell, "k"); ok {
+			t.Error("Expected an expired entry to miss")
+		}
+	})
+
+	t.Run("a nil cache never hits", func(t *testing.T) {
+		var cache *ResultCache
+		cache.Put(CacheLLM, "k", "v")
+		if _, ok := cache.Get(CacheLLM, "k"); ok {
+			t.Error("Expected a miss")
+		}
+		if len(cache.Stats()) != 0 {
+			t.Error("Expected no stats")
+		}
+	})
+}
+
+func TestSpellBridgeMemoization(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "slow.echo")
+	if err := os.WriteFile(script, []byte("slow"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := 0
+	cache := NewResultCache(ResultCacheOptions{})
+	spell := NewSpellBridge(SpellOptions{
+		Engines: newEchoRegistry(t),
+		Cache:   cache,
+		Prepare: func(eng engine.Engine, name string, child *SpellBridge) error {
+			runs++
+			return nil
+		},
+	})
+
+	ctx := context.Background()
+	params := map[string]interface{}{"n": 1}
+	for i := 0; i < 2; i++ {
+		if _, err := spell.Run(ctx, script, params, SpellRunOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("Expected identical inputs to run once, ran %d times", runs)
+	}
+
+	if _, err := spell.Run(ctx, script, map[string]interface{}{"n": 2}, SpellRunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := spell.Run(ctx, script, params, SpellRunOptions{NoCache: true}); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 3 {
+		t.Errorf("Expected new params and bypasses to run, ran %d times", runs)
+	}
+
+	// Editing the spell invalidates its results
+	if err := os.WriteFile(script, []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := spell.Run(ctx, script, params, SpellRunOptions{})
+	if err != nil || result != "edited map[n:1]" {
+		t.Errorf("Expected the edited spell to run, got %v %v", result, err)
+	}
+
+	stats := spell.CacheStats()[CacheSpell]
+	if stats != (CacheStats{Hits: 1, Misses: 3, Bypassed: 1}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestLLMResponseCache(t *testing.T) {
+	calls := 0
+	bridge := &LLMBridge{
+		providers: map[string]domain.Provider{"mock": &MockProvider{
+			generateMsgFunc: func(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.Response, error) {
+				calls++
+				return domain.Response{Content: "answer"}, nil
+			},
+		}},
+		current: "mock",
+	}
+	bridge.SetResponseCache(NewResultCache(ResultCacheOptions{}))
+
+	for i := 0; i < 2; i++ {
+		response, err := bridge.Chat(context.Background(), "same prompt")
+		if err != nil || response != "answer" {
+			t.Fatalf("Unexpected response %q: %v", response, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected one provider call, got %d", calls)
+	}
+
+	if _, err := bridge.Chat(context.Background(), "another prompt"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected a new prompt to reach the provider, got %d calls", calls)
+	}
+}
@@ -0,0 +1,280 @@
+// ABOUTME: Conversations scripts pass to llm.chat, and their adaptation to each provider's rules
+// ABOUTME: System messages, tool calls and tool results are reshaped so one message list works everywhere
+
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+)
+
+// ChatMessage is one message of a conversation as a script writes it.
+// Assistant messages may carry the tool calls the model made, and tool
+// messages the result of one of them.
+type ChatMessage struct {
+	Role       string         `json:"role"`
+	Content    []ChatPart     `json:"content,omitempty"`
+	ToolCalls  []ChatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+	Name       string         `json:"name,omitempty"`
+}
+
+// ChatPart is a piece of a message's content: text, or an image given by
+// URL or as base64 data with its media type
+type ChatPart struct {
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Data      string `json:"data,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+}
+
+// ChatToolCall is a tool call an assistant message records
+type ChatToolCall struct {
+	ID        string                 `json:"id,omitempty"`
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// ParseChatMessages reads a conversation converted from a script: a list
+// of tables with a role and content, where content is a string or a list
+// of parts such as {type = "image", url = "..."}
+func ParseChatMessages(value interface{}) ([]ChatMessage, error) {
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("messages must be a non-empty list")
+	}
+
+	messages := make([]ChatMessage, len(list))
+	for i, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("message %d must be a table", i+1)
+		}
+		content := fields["content"]
+		if text, isText := content.(string); isText {
+			content = []interface{}{map[string]interface{}{"type": "text", "text": text}}
+		}
+		raw, err := json.Marshal(map[string]interface{}{
+			"role":         fields["role"],
+			"content":      content,
+			"tool_calls":   fields["tool_calls"],
+			"tool_call_id": fields["tool_call_id"],
+			"name":         fields["name"],
+		})
+		if err == nil {
+			err = json.Unmarshal(raw, &messages[i])
+		}
+		if err == nil {
+			err = messages[i].check()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i+1, err)
+		}
+	}
+	return messages, nil
+}
+
+// check reports what is wrong with a message
+func (m ChatMessage) check() error {
+	switch domain.Role(m.Role) {
+	case domain.RoleSystem, domain.RoleUser, domain.RoleAssistant:
+	case domain.RoleTool:
+		if m.ToolCallID == "" && m.Name == "" {
+			return fmt.Errorf("a tool message needs the tool_call_id or name of the call it answers")
+		}
+	default:
+		return fmt.Errorf("unknown role %q; expected system, user, assistant, or tool", m.Role)
+	}
+	if len(m.ToolCalls) > 0 && m.Role != string(domain.RoleAssistant) {
+		return fmt.Errorf("only assistant messages can have tool_calls")
+	}
+	for _, call := range m.ToolCalls {
+		if call.Name == "" {
+			return fmt.Errorf("a tool call needs a name")
+		}
+	}
+	for _, part := range m.Content {
+		switch part.Type {
+		case "text":
+		case "image":
+			if part.URL == "" && part.Data == "" {
+				return fmt.Errorf("an image needs a url or data")
+			}
+			if part.Data != "" && part.MediaType == "" {
+				return fmt.Errorf("image data needs a media_type")
+			}
+		default:
+			return fmt.Errorf("unknown content type %q; expected text or image", part.Type)
+		}
+	}
+	return nil
+}
+
+// text joins the message's text parts
+func (m ChatMessage) text() string {
+	var texts []string
+	for _, part := range m.Content {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// AdaptMessages translates a conversation into the messages to send to a
+// provider, following its rules:
+//
+//   - Anthropic and Gemini take one system prompt ahead of the
+//     conversation and need user and assistant turns to alternate, so
+//     system messages are joined into the first message, tool results
+//     become user turns, and consecutive turns of one role are merged.
+//   - OpenAI and other providers keep system messages where they are and
+//     get tool results as tool messages.
+//
+// Tool calls are described in the text of the assistant message that made
+// them, and tool results name the call they answer, so every provider sees
+// which result belongs to which call.
+func AdaptMessages(provider string, messages []ChatMessage) []domain.Message {
+	strict := provider == "anthropic" || provider == "gemini"
+
+	var system []string
+	adapted := make([]domain.Message, 0, len(messages)+1)
+	for _, m := range messages {
+		role := domain.Role(m.Role)
+		parts := contentParts(m)
+		switch {
+		case role == domain.RoleSystem && strict:
+			system = append(system, m.text())
+			continue
+		case role == domain.RoleTool:
+			parts = []domain.ContentPart{textPart(toolResultText(m))}
+			if strict {
+				role = domain.RoleUser
+			}
+		}
+		for _, call := range m.ToolCalls {
+			parts = append(parts, textPart(toolCallText(call)))
+		}
+
+		if last := len(adapted) - 1; strict && last >= 0 && adapted[last].Role == role {
+			adapted[last].Content = append(adapted[last].Content, parts...)
+			continue
+		}
+		adapted = append(adapted, domain.Message{Role: role, Content: parts})
+	}
+
+	if len(system) > 0 {
+		prompt := domain.NewTextMessage(domain.RoleSystem, strings.Join(system, "\n\n"))
+		adapted = append([]domain.Message{prompt}, adapted...)
+	}
+	return adapted
+}
+
+// contentParts converts the content of a message
+func contentParts(m ChatMessage) []domain.ContentPart {
+	parts := make([]domain.ContentPart, 0, len(m.Content))
+	for _, part := range m.Content {
+		if part.Type == "text" {
+			parts = append(parts, textPart(part.Text))
+			continue
+		}
+		source := domain.SourceInfo{Type: domain.SourceTypeURL, URL: part.URL, MediaType: part.MediaType}
+		if part.Data != "" {
+			source = domain.SourceInfo{Type: domain.SourceTypeBase64, Data: part.Data, MediaType: part.MediaType}
+		}
+		parts = append(parts, domain.ContentPart{Type: domain.ContentTypeImage, Image: &domain.ImageContent{Source: source}})
+	}
+	return parts
+}
+
+func textPart(text string) domain.ContentPart {
+	return domain.ContentPart{Type: domain.ContentTypeText, Text: text}
+}
+
+// toolCallText describes a tool call, as in
+// `Called tool weather (call_1) with {"city":"Oslo"}`
+func toolCallText(call ChatToolCall) string {
+	text := "Called tool " + call.Name
+	if call.ID != "" {
+		text += " (" + call.ID + ")"
+	}
+	if len(call.Arguments) > 0 {
+		args, _ := json.Marshal(call.Arguments)
+		text += " with " + string(args)
+	}
+	return text
+}
+
+// toolResultText presents a tool result with the call it answers
+func toolResultText(m ChatMessage) string {
+	label := m.Name
+	if m.ToolCallID != "" {
+		label = strings.TrimSpace(label + " (" + m.ToolCallID + ")")
+	}
+	return "Result of tool " + label + ": " + m.text()
+}
+
+// Transcript renders a conversation as text, one "role: text" line per
+// message, for the call log and as the prompt response caches key on
+func Transcript(messages []ChatMessage) string {
+	lines := make([]string, len(messages))
+	for i, m := range messages {
+		text := m.text()
+		for _, part := range m.Content {
+			if part.Type == "image" {
+				text = strings.TrimSpace(text + " [image]")
+			}
+		}
+		for _, call := range m.ToolCalls {
+			text = strings.TrimSpace(text + " [" + toolCallText(call) + "]")
+		}
+		lines[i] = m.Role + ": " + text
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ChatMessages sends a conversation to the LLM and returns the reply. The
+// messages are adapted to the provider of the model the call goes to,
+// including a larger model tried after the context window overflows, so a
+// spell can switch providers without changing how it builds messages.
+// Conversations are not trimmed to fit the context window.
+func (b *LLMBridge) ChatMessages(ctx context.Context, messages []ChatMessage) (string, error) {
+	prompt := Transcript(messages)
+	if response, replaying, err := b.replayedResponse("chat", prompt, messages); replaying {
+		return response, err
+	}
+
+	cached, key, ok := b.cachedResponse("chat", prompt, messages)
+	if ok {
+		b.recordResponse("chat", prompt, cached, messages)
+		return cached, nil
+	}
+
+	call := b.beginCall(ctx, "chat", prompt)
+	watchdog := b.getWatchdog()
+
+	var content string
+	target, adjustment, err := b.withContextRecovery(ctx, "", func(provider domain.Provider, target ModelTarget, _ string) error {
+		response, err := watchdog.Call(ctx, "llm.chat", func(ctx context.Context) (interface{}, error) {
+			return provider.GenerateMessage(ctx, AdaptMessages(target.Provider, messages))
+		})
+		if err != nil {
+			return fmt.Errorf("LLM completion failed: %w", err)
+		}
+		content = response.(domain.Response).Content
+		return nil
+	})
+	call.end(target, adjustment, content, finishReason(err), err)
+	if err != nil {
+		return "", err
+	}
+
+	b.cacheResponse(key, "chat", prompt, content)
+	b.recordResponse("chat", prompt, content, messages)
+	return content, nil
+}
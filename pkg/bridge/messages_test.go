@@ -0,0 +1,134 @@
+// ABOUTME: Tests for script conversations and their adaptation to each provider
+// ABOUTME: Covers parsing, system/tool message handling per provider, and ChatMessages
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+)
+
+// conversation is a tool-using exchange with system messages at both ends
+func conversation(t *testing.T) []ChatMessage {
+	t.Helper()
+	messages, err := ParseChatMessages([]interface{}{
+		map[string]interface{}{"role": "system", "content": "Be brief."},
+		map[string]interface{}{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "What is the weather here?"},
+			map[string]interface{}{"type": "image", "url": "https://example.com/sky.png"},
+		}},
+		map[string]interface{}{"role": "assistant", "tool_calls": []interface{}{
+			map[string]interface{}{"id": "call_1", "name": "weather", "arguments": map[string]interface{}{"city": "Oslo"}},
+		}},
+		map[string]interface{}{"role": "tool", "tool_call_id": "call_1", "name": "weather", "content": "rain"},
+		map[string]interface{}{"role": "system", "content": "Answer in one word."},
+		map[string]interface{}{"role": "user", "content": "Umbrella?"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+func TestParseChatMessages(t *testing.T) {
+	messages := conversation(t)
+	if len(messages) != 6 || messages[1].Content[1].URL != "https://example.com/sky.png" {
+		t.Fatalf("Unexpected messages: %+v", messages)
+	}
+	if call := messages[2].ToolCalls[0]; call.Name != "weather" || call.Arguments["city"] != "Oslo" {
+		t.Errorf("Unexpected tool call: %+v", call)
+	}
+
+	bad := []struct {
+		message interface{}
+		want    string
+	}{
+		{map[string]interface{}{"role": "narrator", "content": "hi"}, "unknown role"},
+		{map[string]interface{}{"role": "tool", "content": "rain"}, "tool_call_id or name"},
+		{map[string]interface{}{"role": "user", "content": []interface{}{map[string]interface{}{"type": "image"}}}, "url or data"},
+		{map[string]interface{}{"role": "user", "tool_calls": []interface{}{map[string]interface{}{"name": "x"}}}, "only assistant"},
+		{"hello", "must be a table"},
+	}
+	for _, tc := range bad {
+		_, err := ParseChatMessages([]interface{}{tc.message})
+		if err == nil || !strings.Contains(err.Error(), tc.want) || !strings.HasPrefix(err.Error(), "message 1") {
+			t.Errorf("Expected an error about %q for %v, got %v", tc.want, tc.message, err)
+		}
+	}
+	if _, err := ParseChatMessages([]interface{}{}); err == nil {
+		t.Error("Expected an error for no messages")
+	}
+}
+
+func TestAdaptMessages(t *testing.T) {
+	roles := func(messages []domain.Message) string {
+		var names []string
+		for _, m := range messages {
+			names = append(names, string(m.Role))
+		}
+		return strings.Join(names, ",")
+	}
+
+	t.Run("anthropic", func(t *testing.T) {
+		adapted := AdaptMessages("anthropic", conversation(t))
+		if got := roles(adapted); got != "system,user,assistant,user" {
+			t.Fatalf("Expected one leading system message and alternating turns, got %s", got)
+		}
+		if text := adapted[0].Content[0].Text; text != "Be brief.\n\nAnswer in one word." {
+			t.Errorf("Expected system messages joined, got %q", text)
+		}
+		if adapted[1].Content[1].Type != domain.ContentTypeImage || adapted[1].Content[1].Image.Source.URL == "" {
+			t.Errorf("Expected the image to be kept, got %+v", adapted[1].Content[1])
+		}
+		if text := adapted[2].Content[0].Text; text != `Called tool weather (call_1) with {"city":"Oslo"}` {
+			t.Errorf("Unexpected tool call text %q", text)
+		}
+		last := adapted[3].Content
+		if len(last) != 2 || last[0].Text != "Result of tool weather (call_1): rain" || last[1].Text != "Umbrella?" {
+			t.Errorf("Expected the tool result merged with the next user turn, got %+v", last)
+		}
+	})
+
+	t.Run("openai", func(t *testing.T) {
+		adapted := AdaptMessages("openai", conversation(t))
+		if got := roles(adapted); got != "system,user,assistant,tool,system,user" {
+			t.Fatalf("Expected messages kept in place, got %s", got)
+		}
+		if text := adapted[3].Content[0].Text; text != "Result of tool weather (call_1): rain" {
+			t.Errorf("Unexpected tool result text %q", text)
+		}
+	})
+}
+
+func TestChatMessages(t *testing.T) {
+	var sent [][]domain.Message
+	provider := func(fail bool) *MockProvider {
+		return &MockProvider{
+			generateMsgFunc: func(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.Response, error) {
+				sent = append(sent, messages)
+				if fail {
+					return domain.Response{}, errors.New("maximum context length exceeded")
+				}
+				return domain.Response{Content: "Yes"}, nil
+			},
+		}
+	}
+	bridge := &LLMBridge{
+		providers: map[string]domain.Provider{"openai": provider(true), "anthropic": provider(false)},
+		current:   "openai",
+	}
+	bridge.SetModelAliases(ModelAliases{"large": {{Provider: "anthropic"}}})
+	bridge.SetContextFallback(DefaultModel, "large")
+
+	response, err := bridge.ChatMessages(context.Background(), conversation(t))
+	if err != nil || response != "Yes" {
+		t.Fatalf("Expected the larger model to answer, got %q, %v", response, err)
+	}
+	if len(sent) != 2 || len(sent[0]) != 6 || len(sent[1]) != 4 {
+		t.Errorf("Expected each provider to get its own shape of the conversation, got %d calls", len(sent))
+	}
+}
@@ -0,0 +1,154 @@
+// ABOUTME: Logical model names (aliases) that resolve to a concrete provider and model
+// ABOUTME: Lets spells ask for "fast" or "smart" instead of hardcoding provider model IDs
+
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultModel is the logical model used when a spell does not pick one. It
+// resolves to the current provider's default model unless configured.
+const DefaultModel = "default"
+
+// ModelTarget is a concrete model on a provider. An empty Model means the
+// provider's own default model.
+type ModelTarget struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"`
+}
+
+// ParseModelTarget parses "provider/model" or a bare "provider"
+func ParseModelTarget(s string) (ModelTarget, error) {
+	provider, model, _ := strings.Cut(strings.TrimSpace(s), "/")
+	if provider == "" {
+		return ModelTarget{}, fmt.Errorf("invalid model %q: expected provider/model", s)
+	}
+	return ModelTarget{Provider: provider, Model: model}, nil
+}
+
+func (t ModelTarget) String() string {
+	if t.Model == "" {
+		return t.Provider
+	}
+	return t.Provider + "/" + t.Model
+}
+
+// ModelAliases maps logical model names to candidate targets in order of
+// preference. The first candidate whose provider is available is used, so
+// one alias works whichever provider keys are configured.
+type ModelAliases map[string][]ModelTarget
+
+// DefaultModelAliases returns the built-in "fast" and "smart" aliases
+func DefaultModelAliases() ModelAliases {
+	return ModelAliases{
+		"fast": {
+			{Provider: "openai", Model: "gpt-4o-mini"},
+			{Provider: "anthropic", Model: "claude-3-5-haiku-latest"},
+			{Provider: "gemini", Model: "gemini-1.5-flash"},
+		},
+		"smart": {
+			{Provider: "openai", Model: "gpt-4o"},
+			{Provider: "anthropic", Model: "claude-3-5-sonnet-latest"},
+			{Provider: "gemini", Model: "gemini-1.5-pro"},
+		},
+	}
+}
+
+// LoadModelAliases reads aliases from a JSON file mapping each name to a
+// "provider/model" string or a list of them in order of preference:
+//
+//	{"fast": ["anthropic/claude-3-5-haiku-latest", "openai/gpt-4o-mini"], "default": "openai/gpt-4o"}
+func LoadModelAliases(path string) (ModelAliases, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid model config %s: %w", path, err)
+	}
+
+	aliases := make(ModelAliases, len(raw))
+	for name, value := range raw {
+		var specs []string
+		if err := json.Unmarshal(value, &specs); err != nil {
+			var spec string
+			if err := json.Unmarshal(value, &spec); err != nil {
+				return nil, fmt.Errorf("invalid model config %s: alias %q must be a string or list of strings", path, name)
+			}
+			specs = []string{spec}
+		}
+
+		for _, spec := range specs {
+			target, err := ParseModelTarget(spec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid model config %s: alias %q: %w", path, name, err)
+			}
+			aliases[name] = append(aliases[name], target)
+		}
+	}
+	return aliases, nil
+}
+
+// Merge returns a copy of a with the aliases in overrides replacing any of
+// the same name
+func (a ModelAliases) Merge(overrides ModelAliases) ModelAliases {
+	merged := make(ModelAliases, len(a)+len(overrides))
+	for name, targets := range a {
+		merged[name] = targets
+	}
+	for name, targets := range overrides {
+		merged[name] = targets
+	}
+	return merged
+}
+
+// Resolve turns a model name into a concrete target. Names are tried as an
+// alias, then as "provider/model", then as a model of the current provider.
+// available reports whether a provider can be used.
+func (a ModelAliases) Resolve(name, current string, available func(provider string) bool) (ModelTarget, error) {
+	if name == "" {
+		name = DefaultModel
+	}
+
+	if candidates, ok := a[name]; ok {
+		for _, target := range candidates {
+			if available(target.Provider) {
+				return target, nil
+			}
+		}
+		return ModelTarget{}, fmt.Errorf("no available provider for model %q (candidates: %s)", name, joinTargets(candidates))
+	}
+
+	var target ModelTarget
+	switch {
+	case name == DefaultModel:
+		target = ModelTarget{Provider: current}
+	case strings.Contains(name, "/"):
+		parsed, err := ParseModelTarget(name)
+		if err != nil {
+			return ModelTarget{}, err
+		}
+		target = parsed
+	default:
+		target = ModelTarget{Provider: current, Model: name}
+	}
+
+	if !available(target.Provider) {
+		return ModelTarget{}, fmt.Errorf("provider '%s' not available for model %q", target.Provider, name)
+	}
+	return target, nil
+}
+
+func joinTargets(targets []ModelTarget) string {
+	names := make([]string, len(targets))
+	for i, target := range targets {
+		names[i] = target.String()
+	}
+	return strings.Join(names, ", ")
+}
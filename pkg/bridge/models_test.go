@@ -0,0 +1,76 @@
+// ABOUTME: Tests for logical model names and their resolution
+// ABOUTME: Validates alias fallback order, explicit targets, and config loading
+
+package bridge
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestModelAliasesResolve(t *testing.T) {
+	aliases := DefaultModelAliases().Merge(ModelAliases{
+		"cheap": {{Provider: "local", Model: "tiny"}},
+	})
+	available := func(provider string) bool {
+		return provider == "anthropic" || provider == "gemini"
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", "anthropic"},
+		{"default", "anthropic"},
+		{"fast", "anthropic/claude-3-5-haiku-latest"},
+		{"smart", "anthropic/claude-3-5-sonnet-latest"},
+		{"gemini/gemini-1.5-pro", "gemini/gemini-1.5-pro"},
+		{"claude-3-opus-latest", "anthropic/claude-3-opus-latest"},
+	}
+	for _, tt := range tests {
+		target, err := aliases.Resolve(tt.name, "anthropic", available)
+		if err != nil {
+			t.Errorf("Resolve(%q) failed: %v", tt.name, err)
+			continue
+		}
+		if target.String() != tt.want {
+			t.Errorf("Resolve(%q) = %s, want %s", tt.name, target, tt.want)
+		}
+	}
+
+	for _, name := range []string{"cheap", "openai/gpt-4o"} {
+		if _, err := aliases.Resolve(name, "anthropic", available); err == nil {
+			t.Errorf("Expected error resolving %q without its provider", name)
+		}
+	}
+}
+
+func TestLoadModelAliases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "models.json")
+	config := `{
+		"fast": ["gemini/gemini-1.5-flash", "openai/gpt-4o-mini"],
+		"default": "anthropic"
+	}`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	aliases, err := LoadModelAliases(path)
+	if err != nil {
+		t.Fatalf("LoadModelAliases failed: %v", err)
+	}
+	if len(aliases["fast"]) != 2 || aliases["fast"][0].String() != "gemini/gemini-1.5-flash" {
+		t.Errorf("Unexpected fast alias: %v", aliases["fast"])
+	}
+	if len(aliases["default"]) != 1 || aliases["default"][0] != (ModelTarget{Provider: "anthropic"}) {
+		t.Errorf("Unexpected default alias: %v", aliases["default"])
+	}
+
+	if err := os.WriteFile(path, []byte(`{"fast": 3}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadModelAliases(path); err == nil {
+		t.Error("Expected error for invalid alias value")
+	}
+}
@@ -0,0 +1,237 @@
+// ABOUTME: Imports the operations of an OpenAPI 3 document into the tool bridge as custom tools
+// ABOUTME: Credentials come from operator-configured secrets, sent only to the hosts each secret allows
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+// maxOpenAPIDocument bounds the OpenAPI documents ImportOpenAPI reads
+const maxOpenAPIDocument = 10 << 20
+
+// OpenAPIAuth says how imported operations authenticate with a secret.
+// Type is "bearer" (the default), "basic" with a "user:password" secret,
+// or "api_key", sent as the header or query parameter Name as In says.
+type OpenAPIAuth struct {
+	Type   string
+	Secret string
+	Name   string
+	In     string
+}
+
+// OpenAPIImport says which operations ImportOpenAPI imports and how
+type OpenAPIImport struct {
+	// Prefix is prepended to every tool's name
+	Prefix string
+	// BaseURL replaces the document's servers
+	BaseURL string
+	// Operations and Tags, when set, keep only the operations with one of
+	// these operationIds or with one of these tags
+	Operations []string
+	Tags       []string
+	// Headers are sent with every request
+	Headers map[string]string
+	Auth    *OpenAPIAuth
+	// CheckPath, when set, resolves a document read from a file and refuses
+	// paths outside the allowed directories
+	CheckPath func(path string) (string, error)
+	// CheckURL, when set, vets the URL a document is read from and every
+	// request the imported tools send, including each redirect
+	CheckURL func(*url.URL) error
+}
+
+// importedTool marks a tool imported from an OpenAPI document. Like script
+// tools it is a custom tool scripts may list and unregister; errors have
+// its secret redacted.
+type importedTool struct {
+	*tools.FunctionTool
+	secret string
+}
+
+// Execute runs the operation, redacting the secret, as it is or as it
+// appears in a URL, from its error
+func (t *importedTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	result, err := t.FunctionTool.Execute(ctx, params)
+	if err == nil || t.secret == "" {
+		return result, err
+	}
+	msg := strings.ReplaceAll(err.Error(), t.secret, DefaultRedaction)
+	msg = strings.ReplaceAll(msg, url.QueryEscape(t.secret), DefaultRedaction)
+	if msg != err.Error() {
+		return nil, errors.New(msg)
+	}
+	return nil, err
+}
+
+// SetSecrets sets the secrets imported operations may authenticate with
+func (tb *ToolBridge) SetSecrets(config SecretsConfig) {
+	tb.secrets.Store(&config)
+}
+
+// SetCheckURL has every OpenAPI import vet URLs with check, in place of
+// the caller's CheckURL; nil leaves imports to the caller's
+func (tb *ToolBridge) SetCheckURL(check func(*url.URL) error) {
+	if check == nil {
+		tb.checkURL.Store(nil)
+		return
+	}
+	tb.checkURL.Store(&check)
+}
+
+// SetCheckPath has every OpenAPI import read documents from files with
+// check, in place of the caller's CheckPath; nil leaves imports to the
+// caller's
+func (tb *ToolBridge) SetCheckPath(check func(path string) (string, error)) {
+	if check == nil {
+		tb.checkPath.Store(nil)
+		return
+	}
+	tb.checkPath.Store(&check)
+}
+
+// ImportOpenAPI registers a tool for each operation of the OpenAPI 3
+// document at source, a URL or a file path, and returns their names. The
+// tools are registered together: if one cannot be, none are.
+func (tb *ToolBridge) ImportOpenAPI(ctx context.Context, source string, opts OpenAPIImport) ([]string, error) {
+	if check := tb.checkURL.Load(); check != nil {
+		opts.CheckURL = *check
+	}
+	if check := tb.checkPath.Load(); check != nil {
+		opts.CheckPath = *check
+	}
+	data, specURL, err := readOpenAPIDocument(ctx, source, opts.CheckPath, opts.CheckURL)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := tools.ParseOpenAPI(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	importOpts := tools.OpenAPIImportOptions{
+		Prefix:     opts.Prefix,
+		BaseURL:    opts.BaseURL,
+		SpecURL:    specURL,
+		Operations: opts.Operations,
+		Tags:       opts.Tags,
+		Headers:    opts.Headers,
+	}
+	if opts.CheckURL != nil {
+		importOpts.Client = checkedClient(opts.CheckURL, 30*time.Second)
+	}
+	var secret string
+	if opts.Auth != nil {
+		importOpts.Authorize, secret, err = tb.openAPIAuthorizer(ctx, *opts.Auth)
+		if err != nil {
+			return nil, err
+		}
+	}
+	list, err := tools.OpenAPITools(doc, importOpts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	names := make([]string, 0, len(list))
+	for _, tool := range list {
+		if err := tb.registry.Register(&importedTool{FunctionTool: tool, secret: secret}); err != nil {
+			for _, name := range names {
+				tb.RemoveTool(name)
+			}
+			return nil, err
+		}
+		tb.toolChanged(tool.Name())
+		names = append(names, tool.Name())
+	}
+	return names, nil
+}
+
+// readOpenAPIDocument reads a document from a URL checkURL allows or a
+// file checkPath allows. For a URL it also returns the URL, which relative
+// server URLs resolve against.
+func readOpenAPIDocument(ctx context.Context, source string, checkPath func(string) (string, error), checkURL func(*url.URL) error) ([]byte, string, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		path := source
+		if checkPath != nil {
+			var err error
+			if path, err = checkPath(source); err != nil {
+				return nil, "", err
+			}
+		}
+		data, err := os.ReadFile(path)
+		return data, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := checkedClient(checkURL, 30*time.Second).Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s: %s", source, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOpenAPIDocument))
+	return data, source, err
+}
+
+// openAPIAuthorizer returns the function that adds a secret to the
+// requests of imported operations, and the secret's value
+func (tb *ToolBridge) openAPIAuthorizer(ctx context.Context, auth OpenAPIAuth) (func(*http.Request) error, string, error) {
+	var config SecretsConfig
+	if stored := tb.secrets.Load(); stored != nil {
+		config = *stored
+	}
+	secret, value, err := config.Resolve(ctx, auth.Secret)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var apply func(*http.Request)
+	switch auth.Type {
+	case "", "bearer":
+		apply = func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+value) }
+	case "basic":
+		user, password, _ := strings.Cut(value, ":")
+		apply = func(req *http.Request) { req.SetBasicAuth(user, password) }
+	case "api_key":
+		if auth.Name == "" {
+			return nil, "", fmt.Errorf("api_key auth needs a name")
+		}
+		switch auth.In {
+		case "", "header":
+			apply = func(req *http.Request) { req.Header.Set(auth.Name, value) }
+		case "query":
+			apply = func(req *http.Request) {
+				query := req.URL.Query()
+				query.Set(auth.Name, value)
+				req.URL.RawQuery = query.Encode()
+			}
+		default:
+			return nil, "", fmt.Errorf("api_key auth goes in a header or the query, not %q", auth.In)
+		}
+	default:
+		return nil, "", fmt.Errorf("unknown auth type %q", auth.Type)
+	}
+
+	return func(req *http.Request) error {
+		if !secret.Allows(req.URL.Hostname()) {
+			return fmt.Errorf("secret %q may not be sent to %s", auth.Secret, req.URL.Hostname())
+		}
+		apply(req)
+		return nil
+	}, value, nil
+}
@@ -0,0 +1,229 @@
+// ABOUTME: Tests for importing OpenAPI operations into the tool bridge
+// ABOUTME: Validates custom tool registration, URL checks, secret injection limited to allowed hosts, redaction, and loading secrets
+
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+const todoSpec = `{
+	"openapi": "3.1.0",
+	"info": {"title": "Todo", "version": "1.0"},
+	"servers": [{"url": "/api"}],
+	"paths": {
+		"/todos/{id}": {
+			"get": {
+				"operationId": "getTodo",
+				"parameters": [{"name": "id", "in": "path", "schema": {"type": "integer"}}]
+			}
+		}
+	}
+}`
+
+func TestImportOpenAPI(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/openapi.json":
+			fmt.Fprint(w, todoSpec)
+		case "/api/todos/1":
+			auth = r.Header.Get("Authorization")
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id": 1, "title": "write tests"}`)
+		default:
+			http.Error(w, "no todo "+r.URL.Query().Get("key"), http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	host := strings.Split(strings.TrimPrefix(server.URL, "http://"), ":")[0]
+
+	t.Setenv("TEST_TODO_TOKEN", "s3cret")
+	tb := NewToolBridge(tools.NewRegistry())
+	tb.SetSecrets(SecretsConfig{Secrets: map[string]Secret{
+		"todo":  {Value: "env:TEST_TODO_TOKEN", Hosts: []string{host}},
+		"other": {Value: "s3cret", Hosts: []string{"*.example.com"}},
+	}})
+	ctx := context.Background()
+
+	names, err := tb.ImportOpenAPI(ctx, server.URL+"/openapi.json", OpenAPIImport{Prefix: "todo_", Auth: &OpenAPIAuth{Secret: "todo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "todo_getTodo" {
+		t.Fatalf("ImportOpenAPI() = %v", names)
+	}
+	custom := tb.ListCustomTools()
+	if len(custom) != 1 || custom[0]["source"] != "openapi:Todo" || custom[0]["category"] != "openapi" {
+		t.Errorf("Expected the tool among the custom tools, got %v", custom)
+	}
+
+	result, err := tb.ExecuteTool(ctx, "todo_getTodo", map[string]interface{}{"id": float64(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo, ok := result.(map[string]interface{}); !ok || todo["title"] != "write tests" || auth != "Bearer s3cret" {
+		t.Errorf("Unexpected result %v with authorization %q", result, auth)
+	}
+
+	// Importing again clashes, and registers nothing
+	if _, err := tb.ImportOpenAPI(ctx, server.URL+"/openapi.json", OpenAPIImport{Prefix: "todo_"}); err == nil {
+		t.Error("Expected a name clash")
+	}
+	if err := tb.UnregisterCustomTool("todo_getTodo"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An API key in the query is redacted from errors
+	names, err = tb.ImportOpenAPI(ctx, server.URL+"/openapi.json", OpenAPIImport{
+		BaseURL: server.URL + "/missing",
+		Auth:    &OpenAPIAuth{Type: "api_key", Secret: "todo", Name: "key", In: "query"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tb.ExecuteTool(ctx, names[0], map[string]interface{}{"id": float64(1)})
+	if err == nil || strings.Contains(err.Error(), "s3cret") || !strings.Contains(err.Error(), DefaultRedaction) {
+		t.Errorf("Expected a redacted error, got %v", err)
+	}
+	tb.UnregisterCustomTool(names[0])
+
+	// A secret is only sent to its hosts
+	names, err = tb.ImportOpenAPI(ctx, server.URL+"/openapi.json", OpenAPIImport{Auth: &OpenAPIAuth{Secret: "other"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tb.ExecuteTool(ctx, names[0], map[string]interface{}{"id": float64(1)}); err == nil || !strings.Contains(err.Error(), "may not be sent") {
+		t.Errorf("Expected the secret to be refused, got %v", err)
+	}
+
+	for _, auth := range []OpenAPIAuth{{Secret: "missing"}, {Secret: "todo", Type: "digest"}, {Secret: "todo", Type: "api_key"}} {
+		if _, err := tb.ImportOpenAPI(ctx, server.URL+"/openapi.json", OpenAPIImport{Prefix: "x_", Auth: &auth}); err == nil {
+			t.Errorf("Expected auth %+v to be refused", auth)
+		}
+	}
+}
+
+func TestImportOpenAPICheckURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/openapi.json":
+			fmt.Fprint(w, todoSpec)
+		case "/moved.json":
+			http.Redirect(w, r, "/private/openapi.json", http.StatusFound)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	// Only the document and the API under /api may be reached
+	check := func(u *url.URL) error {
+		if u.Path != "/openapi.json" && u.Path != "/moved.json" && !strings.HasPrefix(u.Path, "/api/") {
+			return fmt.Errorf("%s is not allowed", u.Path)
+		}
+		return nil
+	}
+	tb := NewToolBridge(tools.NewRegistry())
+	tb.SetCheckURL(check)
+
+	names, err := tb.ImportOpenAPI(ctx, server.URL+"/openapi.json", OpenAPIImport{Prefix: "ok_"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tb.ExecuteTool(ctx, names[0], map[string]interface{}{"id": float64(1)}); err != nil {
+		t.Errorf("Expected an allowed operation to run, got %v", err)
+	}
+
+	names, err = tb.ImportOpenAPI(ctx, server.URL+"/openapi.json", OpenAPIImport{Prefix: "base_", BaseURL: server.URL + "/internal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tb.ExecuteTool(ctx, names[0], map[string]interface{}{"id": float64(1)}); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Expected a base_url the check refuses to be refused, got %v", err)
+	}
+
+	if _, err := tb.ImportOpenAPI(ctx, server.URL+"/moved.json", OpenAPIImport{Prefix: "moved_"}); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Expected a redirect the check refuses to be refused, got %v", err)
+	}
+
+	// The bridge's check replaces the caller's
+	allow := func(*url.URL) error { return nil }
+	if _, err := tb.ImportOpenAPI(ctx, server.URL+"/private/openapi.json", OpenAPIImport{Prefix: "private_", CheckURL: allow}); err == nil {
+		t.Error("Expected the bridge's check to apply over the caller's")
+	}
+}
+
+func TestImportOpenAPIFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "todo.json")
+	if err := os.WriteFile(path, []byte(todoSpec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tb := NewToolBridge(tools.NewRegistry())
+	ctx := context.Background()
+
+	// Relative servers need a base URL when the document is a file
+	if _, err := tb.ImportOpenAPI(ctx, path, OpenAPIImport{}); err == nil || !strings.Contains(err.Error(), "base URL") {
+		t.Errorf("Expected a base URL to be needed, got %v", err)
+	}
+	refuse := func(string) (string, error) { return "", fmt.Errorf("path not allowed") }
+	if _, err := tb.ImportOpenAPI(ctx, path, OpenAPIImport{BaseURL: "http://localhost", CheckPath: refuse}); err == nil {
+		t.Error("Expected CheckPath to refuse the file")
+	}
+	names, err := tb.ImportOpenAPI(ctx, path, OpenAPIImport{BaseURL: "http://localhost"})
+	if err != nil || len(names) != 1 {
+		t.Errorf("ImportOpenAPI() = %v, %v", names, err)
+	}
+
+	// The bridge's check resolves files, in place of the caller's
+	session := NewToolBridge(tools.NewRegistry())
+	session.SetCheckPath(func(name string) (string, error) {
+		if name != "specs:todo.json" {
+			return "", fmt.Errorf("access denied: %s", name)
+		}
+		return path, nil
+	})
+	allow := func(name string) (string, error) { return name, nil }
+	if _, err := session.ImportOpenAPI(ctx, path, OpenAPIImport{BaseURL: "http://localhost", CheckPath: allow}); err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("Expected the bridge's check to refuse the file, got %v", err)
+	}
+	if names, err := session.ImportOpenAPI(ctx, "specs:todo.json", OpenAPIImport{BaseURL: "http://localhost"}); err != nil || len(names) != 1 {
+		t.Errorf("ImportOpenAPI() of a path the check resolves = %v, %v", names, err)
+	}
+}
+
+func TestLoadSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	os.WriteFile(path, []byte(`{"secrets": {"github": {"value": "env:GITHUB_TOKEN", "hosts": ["api.github.com"]}}}`), 0600)
+	config, err := LoadSecrets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := config.Secrets["github"]
+	if secret.Value != "env:GITHUB_TOKEN" || !secret.Allows("API.github.com") || secret.Allows("github.com.evil.test") {
+		t.Errorf("Unexpected secret %+v", secret)
+	}
+	if !(Secret{Hosts: []string{"*.example.com"}}).Allows("api.example.com") {
+		t.Error("Expected a wildcard to match a subdomain")
+	}
+
+	os.WriteFile(path, []byte(`{`), 0600)
+	if _, err := LoadSecrets(path); err == nil {
+		t.Error("Expected an invalid file to fail")
+	}
+	if _, err := LoadSecrets(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected a missing file, got %v", err)
+	}
+}
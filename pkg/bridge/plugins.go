@@ -0,0 +1,290 @@
+// ABOUTME: Tool plugins: Go shared objects or subprocesses that add operator-provided tools to the tool bridge
+// ABOUTME: Subprocess plugins speak newline-delimited JSON-RPC on stdio; plugins load once and their tools carry the source plugin:<name>
+
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"plugin"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lexlapax/go-llmspell/pkg/mcp"
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+// PluginSymbol is the function a Go plugin exports to provide its tools:
+//
+//	func Tools() []tools.Tool
+const PluginSymbol = "Tools"
+
+// PluginConfig describes a plugin: a Go plugin built with
+// -buildmode=plugin at Path, or a program started with Command that serves
+// tools on its stdin and stdout
+type PluginConfig struct {
+	Name    string            `json:"name"`
+	Path    string            `json:"path,omitempty"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+// PluginsConfig lists the plugins to load
+type PluginsConfig struct {
+	Plugins []PluginConfig `json:"plugins"`
+}
+
+// LoadPluginsConfig reads plugin definitions from a JSON file:
+//
+//	{"plugins": [{"name": "acme", "path": "/opt/acme/tools.so"}, {"name": "crm", "command": "crm-tools", "args": ["--stdio"]}]}
+func LoadPluginsConfig(path string) (PluginsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PluginsConfig{}, err
+	}
+	var config PluginsConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return PluginsConfig{}, fmt.Errorf("invalid plugins file %s: %w", path, err)
+	}
+	for _, p := range config.Plugins {
+		if err := p.check(); err != nil {
+			return PluginsConfig{}, fmt.Errorf("invalid plugins file %s: %w", path, err)
+		}
+	}
+	return config, nil
+}
+
+// check accepts a named plugin with a path or a command, not both
+func (p PluginConfig) check() error {
+	switch {
+	case p.Name == "":
+		return errors.New("a plugin needs a name")
+	case p.Path != "" && p.Command != "":
+		return fmt.Errorf("plugin %s has a path or a command, not both", p.Name)
+	case p.Path == "" && p.Command == "":
+		return fmt.Errorf("plugin %s needs a path or a command", p.Name)
+	}
+	return nil
+}
+
+// Plugins loads the tools of configured plugins the first time they are
+// needed. Subprocesses keep running until Close. It is safe for concurrent
+// use, and a nil Plugins has no tools.
+type Plugins struct {
+	config PluginsConfig
+
+	once   sync.Once
+	tools  []tools.Tool
+	err    error
+	procs  []*pluginProcess
+	closed atomic.Bool
+}
+
+// NewPlugins creates the plugins config describes without loading them
+func NewPlugins(config PluginsConfig) *Plugins {
+	return &Plugins{config: config}
+}
+
+// Tools loads the plugins, once, and returns their tools. Plugins that
+// fail to load are left out and reported in the error.
+func (p *Plugins) Tools(ctx context.Context) ([]tools.Tool, error) {
+	if p == nil {
+		return nil, nil
+	}
+	p.once.Do(func() {
+		var errs []error
+		for _, config := range p.config.Plugins {
+			var list []tools.Tool
+			var err error
+			if config.Path != "" {
+				list, err = loadGoPlugin(config)
+			} else {
+				list, err = p.startProcess(ctx, config)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("plugin %s: %w", config.Name, err))
+				continue
+			}
+			p.tools = append(p.tools, list...)
+		}
+		p.err = errors.Join(errs...)
+	})
+	return p.tools, p.err
+}
+
+// Close stops the plugins' subprocesses
+func (p *Plugins) Close() error {
+	if p == nil || p.closed.Swap(true) {
+		return nil
+	}
+	// Wait for a load in progress, so no process starts after Close
+	p.once.Do(func() {})
+	var errs []error
+	for _, proc := range p.procs {
+		errs = append(errs, proc.transport.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// AddPlugins registers the tools of plugins. Plugins that fail to load,
+// and tools whose names are taken, are reported in the error; the other
+// tools are registered.
+func (tb *ToolBridge) AddPlugins(ctx context.Context, plugins *Plugins) error {
+	list, err := plugins.Tools(ctx)
+	errs := []error{err}
+	for _, tool := range list {
+		if regErr := tb.registry.Register(tool); regErr != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tools.MetadataFor(tool).Source, regErr))
+			continue
+		}
+		tb.toolChanged(tool.Name())
+	}
+	return errors.Join(errs...)
+}
+
+// pluginTool is a tool from a Go plugin, reporting the plugin as its
+// source
+type pluginTool struct {
+	tools.Tool
+	source string
+}
+
+// Metadata returns the tool's own metadata with the plugin as its source
+func (t *pluginTool) Metadata() tools.Metadata {
+	meta := tools.MetadataFor(t.Tool)
+	meta.Source = t.source
+	return meta
+}
+
+// IsDeterministic reports whether the plugin marked the tool deterministic
+func (t *pluginTool) IsDeterministic() bool {
+	return tools.IsDeterministic(t.Tool)
+}
+
+// RequiresConfirmation reports whether the plugin asked for the tool to be
+// confirmed before it runs
+func (t *pluginTool) RequiresConfirmation() bool {
+	return tools.RequiresConfirmation(t.Tool)
+}
+
+// loadGoPlugin opens a Go plugin and calls its Tools function
+func loadGoPlugin(config PluginConfig) ([]tools.Tool, error) {
+	opened, err := plugin.Open(config.Path)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := opened.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+	provide, ok := symbol.(func() []tools.Tool)
+	if !ok {
+		return nil, fmt.Errorf("%s is a %T, not a func() []tools.Tool", PluginSymbol, symbol)
+	}
+
+	var list []tools.Tool
+	for _, tool := range provide() {
+		if tool != nil {
+			list = append(list, &pluginTool{Tool: tool, source: "plugin:" + config.Name})
+		}
+	}
+	return list, nil
+}
+
+// pluginProcess is a running subprocess plugin
+type pluginProcess struct {
+	transport mcp.Transport
+	nextID    atomic.Int64
+}
+
+// pluginToolSpec is how a subprocess plugin describes a tool
+type pluginToolSpec struct {
+	Name          string          `json:"name"`
+	Description   string          `json:"description"`
+	Parameters    json.RawMessage `json:"parameters,omitempty"`
+	Output        json.RawMessage `json:"output,omitempty"`
+	Version       string          `json:"version,omitempty"`
+	Category      string          `json:"category,omitempty"`
+	Tags          []string        `json:"tags,omitempty"`
+	Deterministic bool            `json:"deterministic,omitempty"`
+	Confirm       bool            `json:"requires_confirmation,omitempty"`
+}
+
+// startProcess starts a subprocess plugin and asks it to describe its
+// tools. A plugin that fails to describe them is stopped.
+func (p *Plugins) startProcess(ctx context.Context, config PluginConfig) ([]tools.Tool, error) {
+	transport, err := mcp.StartStdio(mcp.ServerConfig{Command: config.Command, Args: config.Args, Env: config.Env})
+	if err != nil {
+		return nil, err
+	}
+	proc := &pluginProcess{transport: transport}
+
+	var described struct {
+		Tools []pluginToolSpec `json:"tools"`
+	}
+	if err := proc.call(ctx, "describe", nil, &described); err != nil {
+		transport.Close()
+		return nil, err
+	}
+	p.procs = append(p.procs, proc)
+
+	list := make([]tools.Tool, 0, len(described.Tools))
+	for _, spec := range described.Tools {
+		if spec.Name == "" {
+			continue
+		}
+		list = append(list, proc.tool(config.Name, spec))
+	}
+	return list, nil
+}
+
+// tool wraps a tool the plugin described
+func (proc *pluginProcess) tool(plugin string, spec pluginToolSpec) *tools.FunctionTool {
+	schema := spec.Parameters
+	if len(schema) == 0 {
+		schema = json.RawMessage(`{"type":"object"}`)
+	}
+	category := spec.Category
+	if category == "" {
+		category = "plugin"
+	}
+	tool := tools.NewFunctionTool(spec.Name, spec.Description, schema,
+		func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			var result interface{}
+			err := proc.call(ctx, "execute", map[string]interface{}{"tool": spec.Name, "params": params}, &result)
+			return result, err
+		},
+	).WithMetadata(category, spec.Tags...).WithSource("plugin:" + plugin).
+		WithDeterministic(spec.Deterministic).WithConfirmation(spec.Confirm)
+	if spec.Version != "" {
+		tool.WithVersion(spec.Version)
+	}
+	if len(spec.Output) > 0 {
+		tool.WithOutput(spec.Output)
+	}
+	return tool
+}
+
+// call sends a request to the plugin and decodes its result into out. An
+// error the plugin returns is reported with its message alone.
+func (proc *pluginProcess) call(ctx context.Context, method string, params, out interface{}) error {
+	id := proc.nextID.Add(1)
+	resp, err := proc.transport.RoundTrip(ctx, &mcp.Request{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return fmt.Errorf("%s: no response", method)
+	}
+	if resp.Error != nil {
+		return errors.New(resp.Error.Message)
+	}
+	if len(resp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, out)
+}
@@ -0,0 +1,131 @@
+// ABOUTME: Tests for tool plugins loaded from Go shared objects or subprocesses
+// ABOUTME: The test binary stands in for a subprocess plugin speaking JSON-RPC on stdio
+
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+// TestPluginProcess is not a test: run by TestPlugins with
+// LLMSPELL_TEST_PLUGIN set, it serves an "echo" and a "fail" tool
+func TestPluginProcess(t *testing.T) {
+	if os.Getenv("LLMSPELL_TEST_PLUGIN") == "" {
+		t.Skip("run as a plugin by TestPlugins")
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			ID     int64  `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Tool   string                 `json:"tool"`
+				Params map[string]interface{} `json:"params"`
+			} `json:"params"`
+		}
+		json.Unmarshal(scanner.Bytes(), &req)
+		reply := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		switch {
+		case req.Method == "describe":
+			reply["result"] = map[string]interface{}{"tools": []interface{}{
+				map[string]interface{}{"name": "echo", "description": "Echoes its text", "deterministic": true, "tags": []string{"text"}},
+				map[string]interface{}{"name": "fail", "description": "Always fails"},
+			}}
+		case req.Params.Tool == "echo":
+			reply["result"] = map[string]interface{}{"text": req.Params.Params["text"]}
+		default:
+			reply["error"] = map[string]interface{}{"code": 1, "message": "no luck today"}
+		}
+		data, _ := json.Marshal(reply)
+		fmt.Println(string(data))
+	}
+	os.Exit(0)
+}
+
+func TestPlugins(t *testing.T) {
+	plugins := NewPlugins(PluginsConfig{Plugins: []PluginConfig{
+		{Name: "helper", Command: os.Args[0], Args: []string{"-test.run=^TestPluginProcess$"}, Env: map[string]string{"LLMSPELL_TEST_PLUGIN": "1"}},
+		{Name: "broken", Command: filepath.Join(t.TempDir(), "missing")},
+		{Name: "shared", Path: filepath.Join(t.TempDir(), "missing.so")},
+	}})
+	defer plugins.Close()
+
+	tb := NewToolBridge(tools.NewRegistry())
+	tb.RegisterTool("fail", "Taken by a script", map[string]interface{}{}, func(map[string]interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	ctx := context.Background()
+	err := tb.AddPlugins(ctx, plugins)
+	if err == nil || !strings.Contains(err.Error(), "plugin broken") || !strings.Contains(err.Error(), "plugin shared") ||
+		!strings.Contains(err.Error(), "plugin:helper") {
+		t.Errorf("Expected the failed plugins and the clash to be reported, got %v", err)
+	}
+
+	info, err := tb.GetTool("echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info["source"] != "plugin:helper" || info["category"] != "plugin" || info["deterministic"] != true {
+		t.Errorf("Unexpected tool info %v", info)
+	}
+	result, err := tb.ExecuteTool(ctx, "echo", map[string]interface{}{"text": "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.(map[string]interface{})["text"] != "hi" {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	// Another bridge shares the running plugin
+	other := NewToolBridge(tools.NewRegistry())
+	other.AddPlugins(ctx, plugins)
+	if _, err := other.ExecuteTool(ctx, "fail", nil); err == nil || err.Error() != "no luck today" {
+		t.Errorf("Expected the plugin's error, got %v", err)
+	}
+
+	plugins.Close()
+	if _, err := tb.ExecuteTool(ctx, "echo", map[string]interface{}{"text": "hi"}); err == nil {
+		t.Error("Expected a call after Close to fail")
+	}
+
+	var none *Plugins
+	if err := tb.AddPlugins(ctx, none); err != nil {
+		t.Errorf("A nil Plugins should add nothing: %v", err)
+	}
+}
+
+func TestLoadPluginsConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugins.json")
+	os.WriteFile(path, []byte(`{"plugins": [{"name": "crm", "command": "crm-tools", "args": ["--stdio"]}]}`), 0600)
+	config, err := LoadPluginsConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Plugins) != 1 || config.Plugins[0].Command != "crm-tools" {
+		t.Errorf("Unexpected config %+v", config)
+	}
+
+	for _, data := range []string{
+		`{`,
+		`{"plugins": [{"command": "crm-tools"}]}`,
+		`{"plugins": [{"name": "crm"}]}`,
+		`{"plugins": [{"name": "crm", "command": "crm-tools", "path": "crm.so"}]}`,
+	} {
+		os.WriteFile(path, []byte(data), 0600)
+		if _, err := LoadPluginsConfig(path); err == nil {
+			t.Errorf("Expected %s to be refused", data)
+		}
+	}
+	if _, err := LoadPluginsConfig(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected a missing file, got %v", err)
+	}
+}
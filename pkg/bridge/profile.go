@@ -0,0 +1,220 @@
+// ABOUTME: Spell profiler that attributes a run's time to the script and to each bridge method
+// ABOUTME: Builds a breakdown by method and kind, and folded stacks for flame graph tools
+
+package bridge
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profile kinds that bridge methods are grouped into
+const (
+	ProfileScript = "script"
+	ProfileLLM    = "llm"
+	ProfileTools  = "tools"
+	ProfileBridge = "bridge"
+)
+
+// profileRoot names the spell at the bottom of every folded stack
+const profileRoot = "spell"
+
+// ProfileEntry is the time a run spent in one bridge method. Total counts
+// the whole of each call; Self leaves out the calls made inside it, such as
+// those of a sub-spell run by spell.run or a Lua tool run by tools.execute.
+type ProfileEntry struct {
+	Name  string        `json:"name"`
+	Kind  string        `json:"kind"`
+	Calls int           `json:"calls"`
+	Total time.Duration `json:"total_ns"`
+	Self  time.Duration `json:"self_ns"`
+}
+
+// ProfileReport is where a run's time went. Kinds adds up the self time of
+// the script and of each kind of bridge method, which together make up
+// Wall.
+type ProfileReport struct {
+	Wall    time.Duration            `json:"wall_ns"`
+	Kinds   map[string]time.Duration `json:"kinds_ns"`
+	Methods []ProfileEntry           `json:"methods"`
+}
+
+// Profiler times the bridge calls of a run, including those of its
+// sub-spells, keeping track of which calls were made inside which. Calls
+// must begin and end in order, as they do on the goroutine running the
+// script. It reads the system clock even when the run's clock is fixed, as
+// a profile of a stopped clock would be empty.
+type Profiler struct {
+	mu      sync.Mutex
+	started time.Time
+	stopped time.Time
+	stack   []profileFrame
+	methods map[string]*ProfileEntry
+	stacks  map[string]time.Duration
+	top     time.Duration
+	now     func() time.Time
+}
+
+// profileFrame is a call in progress
+type profileFrame struct {
+	name     string
+	path     string
+	start    time.Time
+	children time.Duration
+
+	// recursive is set for a call made inside another call of the same
+	// method, whose time that call already counts
+	recursive bool
+}
+
+// NewProfiler creates a profiler and starts timing the run
+func NewProfiler() *Profiler {
+	p := &Profiler{
+		methods: make(map[string]*ProfileEntry),
+		stacks:  make(map[string]time.Duration),
+		now:     time.Now,
+	}
+	p.started = p.now()
+	return p
+}
+
+// Begin records the start of a call to the bridge method name
+func (p *Profiler) Begin(name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	frame := profileFrame{name: name, path: profileRoot + ";" + name, start: p.now()}
+	if n := len(p.stack); n > 0 {
+		frame.path = p.stack[n-1].path + ";" + name
+	}
+	for _, caller := range p.stack {
+		frame.recursive = frame.recursive || caller.name == name
+	}
+	p.stack = append(p.stack, frame)
+}
+
+// End records the end of the call last begun
+func (p *Profiler) End() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(p.stack)
+	if n == 0 {
+		return
+	}
+	frame := p.stack[n-1]
+	p.stack = p.stack[:n-1]
+
+	total := p.now().Sub(frame.start)
+	self := total - frame.children
+	if n > 1 {
+		p.stack[n-2].children += total
+	} else {
+		p.top += total
+	}
+
+	entry, ok := p.methods[frame.name]
+	if !ok {
+		entry = &ProfileEntry{Name: frame.name, Kind: ProfileKind(frame.name)}
+		p.methods[frame.name] = entry
+	}
+	entry.Calls++
+	entry.Self += self
+	if !frame.recursive {
+		entry.Total += total
+	}
+	p.stacks[frame.path] += self
+}
+
+// Stop ends the run's timing
+func (p *Profiler) Stop() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped.IsZero() {
+		p.stopped = p.now()
+	}
+}
+
+// ProfileKind groups a bridge method: LLM requests and model management
+// under "llm", tool calls under "tools", and other modules under "bridge"
+func ProfileKind(method string) string {
+	module, _, _ := strings.Cut(method, ".")
+	switch module {
+	case "llm":
+		return ProfileLLM
+	case "tools":
+		return ProfileTools
+	}
+	return ProfileBridge
+}
+
+// Report returns the breakdown of the run so far. Time not spent in a
+// bridge call is the script's.
+func (p *Profiler) Report() ProfileReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	report := ProfileReport{
+		Wall:    p.wall(),
+		Kinds:   map[string]time.Duration{ProfileScript: p.wall() - p.top},
+		Methods: make([]ProfileEntry, 0, len(p.methods)),
+	}
+	for _, entry := range p.methods {
+		report.Methods = append(report.Methods, *entry)
+		report.Kinds[entry.Kind] += entry.Self
+	}
+	sort.Slice(report.Methods, func(i, j int) bool {
+		a, b := report.Methods[i], report.Methods[j]
+		if a.Self != b.Self {
+			return a.Self > b.Self
+		}
+		return a.Name < b.Name
+	})
+	return report
+}
+
+// WriteFolded writes the profile as folded stacks, one "spell;a;b micros"
+// line per call path, which flamegraph.pl, speedscope, and inferno read
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	p.mu.Lock()
+	stacks := make(map[string]time.Duration, len(p.stacks)+1)
+	for path, self := range p.stacks {
+		stacks[path] = self
+	}
+	stacks[profileRoot] = p.wall() - p.top
+	p.mu.Unlock()
+
+	paths := make([]string, 0, len(stacks))
+	for path := range stacks {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if _, err := fmt.Fprintf(w, "%s %d\n", path, stacks[path].Microseconds()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Profiler) wall() time.Duration {
+	end := p.stopped
+	if end.IsZero() {
+		end = p.now()
+	}
+	return end.Sub(p.started)
+}
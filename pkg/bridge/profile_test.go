@@ -0,0 +1,69 @@
+// ABOUTME: Tests for the spell profiler
+// ABOUTME: Covers self and total time of nested calls, kinds, and folded stacks
+
+package bridge
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfiler(t *testing.T) {
+	now := time.Unix(0, 0)
+	p := NewProfiler()
+	p.started = now
+	p.now = func() time.Time { return now }
+	tick := func(ms int) { now = now.Add(time.Duration(ms) * time.Millisecond) }
+
+	// 10ms of script, then a sub-spell that calls the LLM, then a tool
+	tick(10)
+	p.Begin("spell.run")
+	tick(5)
+	p.Begin("spell.run")
+	p.Begin("llm.chat")
+	tick(40)
+	p.End()
+	p.End()
+	p.End()
+	p.Begin("tools.execute")
+	tick(20)
+	p.End()
+	tick(5)
+	p.Stop()
+	tick(100)
+
+	report := p.Report()
+	if report.Wall != 80*time.Millisecond {
+		t.Fatalf("Expected 80ms of wall time, got %s", report.Wall)
+	}
+	want := map[string]time.Duration{
+		ProfileScript: 15 * time.Millisecond,
+		ProfileBridge: 5 * time.Millisecond,
+		ProfileLLM:    40 * time.Millisecond,
+		ProfileTools:  20 * time.Millisecond,
+	}
+	for kind, d := range want {
+		if report.Kinds[kind] != d {
+			t.Errorf("Expected %s for %s, got %s", d, kind, report.Kinds[kind])
+		}
+	}
+
+	if first := report.Methods[0]; first.Name != "llm.chat" || first.Self != 40*time.Millisecond {
+		t.Errorf("Expected the slowest method first, got %+v", first)
+	}
+	for _, entry := range report.Methods {
+		if entry.Name == "spell.run" && (entry.Calls != 2 || entry.Total != 45*time.Millisecond) {
+			t.Errorf("Expected a nested call not to be counted twice, got %+v", entry)
+		}
+	}
+
+	var folded strings.Builder
+	if err := p.WriteFolded(&folded); err != nil {
+		t.Fatal(err)
+	}
+	wantFolded := "spell 15000\nspell;spell.run 5000\nspell;spell.run;spell.run 0\nspell;spell.run;spell.run;llm.chat 40000\nspell;tools.execute 20000\n"
+	if folded.String() != wantFolded {
+		t.Errorf("Unexpected folded stacks:\n%s", folded.String())
+	}
+}
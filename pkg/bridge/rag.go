@@ -0,0 +1,568 @@
+// ABOUTME: Retrieval-augmented generation on top of the vector store: token-aware chunking, indexing, and asking
+// ABOUTME: Answers cite the numbered chunks they were given, with each chunk's source file and line range
+
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultChunkTokens is the estimated size of a chunk unless the
+	// options say otherwise
+	DefaultChunkTokens = 256
+
+	// DefaultChunkOverlap is how many estimated tokens of a chunk's end
+	// start the next one unless the options say otherwise
+	DefaultChunkOverlap = 32
+
+	// DefaultRAGTopK is how many chunks an answer is given unless the
+	// options say otherwise
+	DefaultRAGTopK = 4
+
+	// DefaultRAGNamespace is the vector store namespace used when none is
+	// given
+	DefaultRAGNamespace = "default"
+
+	// maxIndexFileSize is the size of the largest file IndexDir reads
+	maxIndexFileSize = 4 << 20
+)
+
+// DefaultIndexExtensions are the file extensions IndexDir reads unless the
+// options say otherwise
+var DefaultIndexExtensions = []string{".md", ".markdown", ".txt", ".rst"}
+
+// ChunkOptions size chunks in estimated tokens (see EstimateTokens)
+type ChunkOptions struct {
+	// MaxTokens is the most a chunk holds; zero uses DefaultChunkTokens
+	MaxTokens int
+
+	// Overlap is how much of the end of a chunk the next one repeats, so
+	// text cut at a boundary is found whole in one of them; zero uses
+	// DefaultChunkOverlap and a negative value turns overlap off
+	Overlap int
+}
+
+// TextChunk is a piece of a text, with the lines it spans, from 1
+type TextChunk struct {
+	Index     int    `json:"index"`
+	Text      string `json:"text"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Tokens    int    `json:"tokens"`
+}
+
+// chunkUnit is a piece of text that is not split further: a paragraph, a
+// line of a long paragraph, or a run of words of a long line
+type chunkUnit struct {
+	text       string
+	start, end int
+}
+
+// ChunkText splits text into chunks of at most opts.MaxTokens estimated
+// tokens. Chunks end between paragraphs where they can, then between
+// lines, then between words; a word longer than a chunk is cut.
+func ChunkText(text string, opts ChunkOptions) []TextChunk {
+	maxTokens := opts.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = DefaultChunkTokens
+	}
+	overlap := opts.Overlap
+	if overlap == 0 {
+		overlap = DefaultChunkOverlap
+	}
+
+	// Long lines are split into runs of words small enough to overlap
+	runTokens := maxTokens
+	if overlap > 0 && overlap < maxTokens {
+		runTokens = overlap
+	}
+
+	var chunks []TextChunk
+	var current []chunkUnit
+	emit := func() {
+		joined := joinUnits(current)
+		chunks = append(chunks, TextChunk{
+			Index:     len(chunks) + 1,
+			Text:      joined,
+			StartLine: current[0].start,
+			EndLine:   current[len(current)-1].end,
+			Tokens:    EstimateTokens(joined),
+		})
+	}
+
+	for _, unit := range splitUnits(text, maxTokens, runTokens) {
+		if len(current) > 0 && EstimateTokens(joinUnits(append(current, unit))) > maxTokens {
+			emit()
+			current = overlapTail(current, overlap)
+			if len(current) > 0 && EstimateTokens(joinUnits(append(current, unit))) > maxTokens {
+				current = nil
+			}
+		}
+		current = append(current, unit)
+	}
+	if len(current) > 0 {
+		emit()
+	}
+	return chunks
+}
+
+// splitUnits breaks text into units of at most maxTokens, splitting long
+// lines into runs of words of at most runTokens
+func splitUnits(text string, maxTokens, runTokens int) []chunkUnit {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var units []chunkUnit
+	var paragraph []string
+	start := 0
+
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		joined := strings.Join(paragraph, "\n")
+		if EstimateTokens(joined) <= maxTokens {
+			units = append(units, chunkUnit{joined, start, start + len(paragraph) - 1})
+		} else {
+			for i, line := range paragraph {
+				units = append(units, splitLine(line, start+i, maxTokens, runTokens)...)
+			}
+		}
+		paragraph = nil
+	}
+
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			flush()
+			continue
+		}
+		if len(paragraph) == 0 {
+			start = i + 1
+		}
+		paragraph = append(paragraph, line)
+	}
+	flush()
+	return units
+}
+
+// splitLine keeps a line of at most maxTokens whole, and breaks a longer
+// one into runs of words of at most runTokens
+func splitLine(line string, number, maxTokens, runTokens int) []chunkUnit {
+	if EstimateTokens(line) <= maxTokens {
+		return []chunkUnit{{line, number, number}}
+	}
+	var units []chunkUnit
+	var run []string
+	for _, word := range strings.Fields(line) {
+		for EstimateTokens(word) > maxTokens {
+			cut := []rune(word)[:maxTokens*4]
+			units = append(units, chunkUnit{string(cut), number, number})
+			word = word[len(string(cut)):]
+		}
+		if len(run) > 0 && EstimateTokens(strings.Join(append(run, word), " ")) > runTokens {
+			units = append(units, chunkUnit{strings.Join(run, " "), number, number})
+			run = nil
+		}
+		run = append(run, word)
+	}
+	if len(run) > 0 {
+		units = append(units, chunkUnit{strings.Join(run, " "), number, number})
+	}
+	return units
+}
+
+// joinUnits joins units with the space that separated them: a blank line
+// between paragraphs, a newline between lines, and a space between words
+func joinUnits(units []chunkUnit) string {
+	var b strings.Builder
+	for i, unit := range units {
+		if i > 0 {
+			switch previous := units[i-1]; {
+			case unit.start > previous.end+1:
+				b.WriteString("\n\n")
+			case unit.start > previous.end:
+				b.WriteString("\n")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(unit.text)
+	}
+	return b.String()
+}
+
+// overlapTail returns the last units of a chunk that fit in overlap
+// tokens, leaving out at least the first unit so chunking moves on
+func overlapTail(units []chunkUnit, overlap int) []chunkUnit {
+	if overlap < 0 {
+		return nil
+	}
+	first := len(units)
+	for first > 1 && EstimateTokens(joinUnits(units[first-1:])) <= overlap {
+		first--
+	}
+	return append([]chunkUnit(nil), units[first:]...)
+}
+
+// GenerateFunc answers a prompt, as LLMBridge.Chat does
+type GenerateFunc func(ctx context.Context, prompt string) (string, error)
+
+// IndexOptions configure indexing
+type IndexOptions struct {
+	Chunk ChunkOptions
+
+	// Extensions are the extensions of the files IndexDir reads;
+	// DefaultIndexExtensions when empty
+	Extensions []string
+
+	// Metadata is added to the metadata of every chunk
+	Metadata map[string]interface{}
+
+	// CheckPath, when set, vets every file and directory IndexDir walks;
+	// those it refuses are left out
+	CheckPath func(path string) (string, error)
+}
+
+// IndexStats count what IndexDir did
+type IndexStats struct {
+	Files   int `json:"files"`
+	Chunks  int `json:"chunks"`
+	Skipped int `json:"skipped"`
+}
+
+// AskOptions configure a question
+type AskOptions struct {
+	// TopK is how many chunks the answer is given; zero uses DefaultRAGTopK
+	TopK int
+
+	// Filter keeps chunks whose metadata has each of its keys with an
+	// equal value
+	Filter map[string]interface{}
+
+	// MinScore leaves out chunks less similar to the question than this
+	MinScore float64
+}
+
+// Citation is a chunk an answer was given, numbered as in the prompt.
+// Cited reports whether the answer refers to it.
+type Citation struct {
+	Number    int     `json:"number"`
+	Source    string  `json:"source"`
+	Chunk     int     `json:"chunk"`
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+	Score     float64 `json:"score"`
+	Text      string  `json:"text"`
+	Cited     bool    `json:"cited"`
+}
+
+// Answer is the response to a question and the chunks it was given
+type Answer struct {
+	Text      string     `json:"answer"`
+	Citations []Citation `json:"citations"`
+}
+
+// RAGBridge indexes documents as chunks in a vector store and answers
+// questions from the chunks most similar to them
+type RAGBridge struct {
+	store    *VectorStoreBridge
+	generate GenerateFunc
+}
+
+// NewRAGBridge keeps chunks in store and answers with generate
+func NewRAGBridge(store *VectorStoreBridge, generate GenerateFunc) *RAGBridge {
+	return &RAGBridge{store: store, generate: generate}
+}
+
+// Index splits text into chunks and stores them in namespace under the
+// IDs <source>#<chunk>, and returns the number of chunks. Indexing a
+// source again replaces its chunks by ID; when the text got shorter, the
+// chunks past its new end are left until they are deleted.
+func (b *RAGBridge) Index(ctx context.Context, namespace, source, text string, opts IndexOptions) (int, error) {
+	if source == "" {
+		return 0, fmt.Errorf("a source is required")
+	}
+	records := chunkRecords(source, text, opts)
+	if err := b.store.Upsert(ctx, namespace, records); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// IndexDir indexes the files under dir with the extensions of opts, naming
+// each source by its path joined to dir. Hidden directories are skipped,
+// as are files that are not UTF-8 text or larger than 4 MB. Chunks are
+// embedded a hundred at a time, across files.
+func (b *RAGBridge) IndexDir(ctx context.Context, namespace, dir string, opts IndexOptions) (IndexStats, error) {
+	extensions := opts.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultIndexExtensions
+	}
+
+	var stats IndexStats
+	var pending []VectorRecord
+	flush := func() error {
+		if err := b.store.Upsert(ctx, namespace, pending); err != nil {
+			return err
+		}
+		stats.Chunks += len(pending)
+		pending = nil
+		return nil
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if opts.CheckPath != nil {
+			if _, err := opts.CheckPath(path); err != nil {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if entry.IsDir() {
+			if path != dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !hasExtension(entry.Name(), extensions) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() > maxIndexFileSize {
+			stats.Skipped++
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !utf8.Valid(data) {
+			stats.Skipped++
+			return nil
+		}
+
+		stats.Files++
+		pending = append(pending, chunkRecords(filepath.ToSlash(path), string(data), opts)...)
+		if len(pending) >= maxEmbedBatch {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && len(pending) > 0 {
+		err = flush()
+	}
+	return stats, err
+}
+
+// chunkRecords turns the chunks of text into records of source
+func chunkRecords(source, text string, opts IndexOptions) []VectorRecord {
+	chunks := ChunkText(text, opts.Chunk)
+	records := make([]VectorRecord, len(chunks))
+	for i, chunk := range chunks {
+		metadata := make(map[string]interface{}, len(opts.Metadata)+4)
+		for key, value := range opts.Metadata {
+			metadata[key] = value
+		}
+		metadata["source"] = source
+		metadata["chunk"] = chunk.Index
+		metadata["start_line"] = chunk.StartLine
+		metadata["end_line"] = chunk.EndLine
+		records[i] = VectorRecord{
+			ID:       fmt.Sprintf("%s#%d", source, chunk.Index),
+			Text:     chunk.Text,
+			Metadata: metadata,
+		}
+	}
+	return records
+}
+
+// hasExtension reports whether name ends in one of extensions, in any case
+func hasExtension(name string, extensions []string) bool {
+	ext := filepath.Ext(name)
+	for _, want := range extensions {
+		if !strings.HasPrefix(want, ".") {
+			want = "." + want
+		}
+		if strings.EqualFold(ext, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ask answers question from the chunks of namespace most similar to it.
+// The model is asked to cite chunks by number, as in [2]; the answer lists
+// every chunk it was given and marks those it cites.
+func (b *RAGBridge) Ask(ctx context.Context, namespace, question string, opts AskOptions) (*Answer, error) {
+	if question == "" {
+		return nil, fmt.Errorf("a question is required")
+	}
+	if b.generate == nil {
+		return nil, fmt.Errorf("no LLM to answer with")
+	}
+	topK := opts.TopK
+	if topK <= 0 {
+		topK = DefaultRAGTopK
+	}
+	matches, err := b.store.Query(ctx, namespace, VectorQuery{Text: question, TopK: topK, Filter: opts.Filter})
+	if err != nil {
+		return nil, err
+	}
+
+	var citations []Citation
+	for _, match := range matches {
+		if match.Score < opts.MinScore {
+			continue
+		}
+		source, _ := match.Metadata["source"].(string)
+		if source == "" {
+			source = match.ID
+		}
+		citations = append(citations, Citation{
+			Number:    len(citations) + 1,
+			Source:    source,
+			Chunk:     metadataInt(match.Metadata["chunk"]),
+			StartLine: metadataInt(match.Metadata["start_line"]),
+			EndLine:   metadataInt(match.Metadata["end_line"]),
+			Score:     match.Score,
+			Text:      match.Text,
+		})
+	}
+	if len(citations) == 0 {
+		return nil, fmt.Errorf("nothing indexed in namespace %q matches the question", namespace)
+	}
+
+	response, err := b.generate(ctx, ragPrompt(question, citations))
+	if err != nil {
+		return nil, err
+	}
+	for _, number := range citedNumbers(response) {
+		if number >= 1 && number <= len(citations) {
+			citations[number-1].Cited = true
+		}
+	}
+	return &Answer{Text: response, Citations: citations}, nil
+}
+
+// ragPrompt asks question about the numbered chunks of citations
+func ragPrompt(question string, citations []Citation) string {
+	var b strings.Builder
+	b.WriteString("Answer the question using only the numbered sources below. ")
+	b.WriteString("Cite the sources you use by number in square brackets, like [1]. ")
+	b.WriteString("If the sources do not contain the answer, say so.\n\nSources:\n")
+	for _, citation := range citations {
+		fmt.Fprintf(&b, "\n[%d] %s", citation.Number, citation.Source)
+		if citation.StartLine > 0 {
+			fmt.Fprintf(&b, ", lines %d-%d", citation.StartLine, citation.EndLine)
+		}
+		fmt.Fprintf(&b, "\n%s\n", citation.Text)
+	}
+	fmt.Fprintf(&b, "\nQuestion: %s", question)
+	return b.String()
+}
+
+// citationPattern matches citations such as [2] and [1, 3]
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// citedNumbers returns the source numbers a response cites
+func citedNumbers(response string) []int {
+	var numbers []int
+	for _, match := range citationPattern.FindAllStringSubmatch(response, -1) {
+		for _, field := range strings.Split(match[1], ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(field)); err == nil {
+				numbers = append(numbers, n)
+			}
+		}
+	}
+	return numbers
+}
+
+// metadataInt reads a number from metadata, which stores may return as
+// float64 after a trip through JSON
+func metadataInt(value interface{}) int {
+	switch n := value.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+// Name returns the name of the bridge
+func (b *RAGBridge) Name() string {
+	return "rag"
+}
+
+// Methods returns information about all methods exposed by this bridge
+func (b *RAGBridge) Methods() []MethodInfo {
+	return []MethodInfo{
+		{
+			Name:        "chunk",
+			Description: "Split text into chunks of an estimated number of tokens",
+			Parameters: []ParameterInfo{
+				{Name: "text", Type: "string", Required: true, Description: "Text to split"},
+				{Name: "options", Type: "object", Required: false, Description: "max_tokens and overlap"},
+			},
+			ReturnType: "TextChunk[]",
+		},
+		{
+			Name:        "index",
+			Description: "Chunk a text and store it in the vector store",
+			Parameters: []ParameterInfo{
+				{Name: "source", Type: "string", Required: true, Description: "Name of the text, used in citations"},
+				{Name: "text", Type: "string", Required: true, Description: "Text to index"},
+				{Name: "options", Type: "object", Required: false, Description: "namespace, max_tokens, overlap, and metadata"},
+			},
+			ReturnType: "number",
+		},
+		{
+			Name:        "indexDir",
+			Description: "Chunk and store the text files under a directory",
+			Parameters: []ParameterInfo{
+				{Name: "dir", Type: "string", Required: true, Description: "Directory to index"},
+				{Name: "options", Type: "object", Required: false, Description: "namespace, extensions, max_tokens, overlap, and metadata"},
+			},
+			ReturnType: "IndexStats",
+		},
+		{
+			Name:        "ask",
+			Description: "Answer a question from the indexed chunks most similar to it, with citations",
+			Parameters: []ParameterInfo{
+				{Name: "question", Type: "string", Required: true, Description: "Question to answer"},
+				{Name: "options", Type: "object", Required: false, Description: "namespace, top_k, filter, and min_score"},
+			},
+			ReturnType: "Answer",
+		},
+	}
+}
+
+// Initialize prepares the bridge for use
+func (b *RAGBridge) Initialize(ctx context.Context) error {
+	return nil
+}
+
+// Cleanup releases any resources held by the bridge
+func (b *RAGBridge) Cleanup(ctx context.Context) error {
+	return nil
+}
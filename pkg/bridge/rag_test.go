@@ -0,0 +1,209 @@
+// ABOUTME: Tests for the RAG bridge: chunking, indexing texts and directories, and answering with citations
+// ABOUTME: Uses an in-memory vector store and an embedder that places texts by the words they mention
+
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkText(t *testing.T) {
+	t.Run("keeps paragraphs whole", func(t *testing.T) {
+		text := "First paragraph\nspans two lines.\n\nSecond one.\n\n\nThird one, after two blank lines."
+		chunks := ChunkText(text, ChunkOptions{MaxTokens: 10, Overlap: -1})
+		var got [][3]interface{}
+		for _, chunk := range chunks {
+			got = append(got, [3]interface{}{chunk.Text, chunk.StartLine, chunk.EndLine})
+			if chunk.Tokens > 10 {
+				t.Errorf("Chunk %d has %d tokens", chunk.Index, chunk.Tokens)
+			}
+		}
+		want := [][3]interface{}{
+			{"First paragraph\nspans two lines.", 1, 2},
+			{"Second one.", 4, 4},
+			{"Third one, after two blank lines.", 7, 7},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ChunkText() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("packs small paragraphs together", func(t *testing.T) {
+		chunks := ChunkText("One.\n\nTwo.\n\nThree.", ChunkOptions{})
+		if len(chunks) != 1 || chunks[0].Text != "One.\n\nTwo.\n\nThree." || chunks[0].EndLine != 5 {
+			t.Errorf("Unexpected chunks: %+v", chunks)
+		}
+	})
+
+	t.Run("splits long lines between words and overlaps", func(t *testing.T) {
+		words := strings.Repeat("word ", 40)
+		chunks := ChunkText(words, ChunkOptions{MaxTokens: 10, Overlap: 3})
+		if len(chunks) < 4 {
+			t.Fatalf("Expected a long line to be split, got %+v", chunks)
+		}
+		for _, chunk := range chunks {
+			if chunk.Tokens > 10 || chunk.StartLine != 1 || chunk.EndLine != 1 {
+				t.Errorf("Unexpected chunk: %+v", chunk)
+			}
+		}
+		if !strings.HasPrefix(chunks[1].Text, "word word") || !strings.HasSuffix(chunks[0].Text, "word") {
+			t.Errorf("Expected words to be kept whole, got %+v", chunks[:2])
+		}
+		total := 0
+		for _, chunk := range chunks {
+			total += len(strings.Fields(chunk.Text))
+		}
+		if total <= 40 {
+			t.Errorf("Expected chunks to overlap, got %d words in all", total)
+		}
+	})
+
+	t.Run("cuts words longer than a chunk", func(t *testing.T) {
+		chunks := ChunkText(strings.Repeat("x", 100), ChunkOptions{MaxTokens: 5, Overlap: -1})
+		if len(chunks) != 5 || chunks[0].Text != strings.Repeat("x", 20) {
+			t.Errorf("Unexpected chunks: %+v", chunks)
+		}
+	})
+
+	if chunks := ChunkText(" \n\n", ChunkOptions{}); len(chunks) != 0 {
+		t.Errorf("Expected no chunks of blank text, got %+v", chunks)
+	}
+}
+
+func TestRAGBridge(t *testing.T) {
+	ctx := context.Background()
+	// embed places texts on an axis per topic they mention
+	embed := func(ctx context.Context, texts []string) ([][]float64, error) {
+		vectors := make([][]float64, len(texts))
+		for i, text := range texts {
+			text = strings.ToLower(text)
+			vectors[i] = []float64{0, 0, 0.1}
+			for axis, topic := range []string{"leave", "laptop"} {
+				if strings.Contains(text, topic) {
+					vectors[i][axis] = 1
+				}
+			}
+		}
+		return vectors, nil
+	}
+	var prompts []string
+	generate := func(ctx context.Context, prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		return "Staff get 25 days [1].", nil
+	}
+	rb := NewRAGBridge(NewVectorStoreBridge(NewMemoryVectorStore(), embed), generate)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"hr/leave.md":       "# Leave\n\nStaff get 25 days of leave a year.",
+		"it/laptops.txt":    "Laptops are replaced every three years.",
+		"it/script.sh":      "echo leave",
+		".git/leave.md":     "hidden leave notes",
+		"it/binary.txt":     "\xff\xfe leave",
+		"hr/handbook.MD":    "The handbook covers leave and laptops.",
+		"notes/empty.md":    "",
+		"notes/untitled.md": "Meeting notes.",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := rb.IndexDir(ctx, "handbook", dir, IndexOptions{Metadata: map[string]interface{}{"team": "all"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (IndexStats{Files: 5, Chunks: 4, Skipped: 1}) {
+		t.Errorf("IndexDir() = %+v", stats)
+	}
+
+	// Files and directories CheckPath refuses are left out
+	checkPath := func(path string) (string, error) {
+		if name := filepath.Base(path); name == "notes" || name == "laptops.txt" {
+			return "", fmt.Errorf("access denied: %s matches a denied path", path)
+		}
+		return path, nil
+	}
+	denied, err := rb.IndexDir(ctx, "denied", dir, IndexOptions{CheckPath: checkPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if denied != (IndexStats{Files: 2, Chunks: 2, Skipped: 1}) {
+		t.Errorf("IndexDir() with denied paths = %+v", denied)
+	}
+
+	t.Run("answers with citations", func(t *testing.T) {
+		answer, err := rb.Ask(ctx, "handbook", "How much leave do I get?", AskOptions{TopK: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if answer.Text != "Staff get 25 days [1]." || len(answer.Citations) != 2 {
+			t.Fatalf("Unexpected answer: %+v", answer)
+		}
+		first := answer.Citations[0]
+		want := Citation{
+			Number: 1, Source: filepath.ToSlash(filepath.Join(dir, "hr/leave.md")), Chunk: 1,
+			StartLine: 1, EndLine: 3, Score: first.Score, Text: "# Leave\n\nStaff get 25 days of leave a year.", Cited: true,
+		}
+		if !reflect.DeepEqual(first, want) {
+			t.Errorf("Citations[0] = %+v, want %+v", first, want)
+		}
+		if answer.Citations[1].Cited {
+			t.Errorf("Expected the second chunk not to be cited: %+v", answer.Citations[1])
+		}
+		prompt := prompts[len(prompts)-1]
+		if !strings.Contains(prompt, "[1] "+want.Source+", lines 1-3\n") || !strings.HasSuffix(prompt, "Question: How much leave do I get?") {
+			t.Errorf("Unexpected prompt:\n%s", prompt)
+		}
+	})
+
+	t.Run("filters and thresholds", func(t *testing.T) {
+		answer, err := rb.Ask(ctx, "handbook", "leave", AskOptions{MinScore: 0.5, Filter: map[string]interface{}{"team": "all"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, citation := range answer.Citations {
+			if citation.Score < 0.5 {
+				t.Errorf("Expected chunks below the threshold to be left out: %+v", citation)
+			}
+		}
+		if _, err := rb.Ask(ctx, "handbook", "leave", AskOptions{Filter: map[string]interface{}{"team": "it"}}); err == nil {
+			t.Error("Expected an error when no chunk matches")
+		}
+	})
+
+	t.Run("indexes a text", func(t *testing.T) {
+		n, err := rb.Index(ctx, "memo", "memo", "Laptop refresh is in May.", IndexOptions{})
+		if err != nil || n != 1 {
+			t.Fatalf("Index() = %d, %v", n, err)
+		}
+		answer, err := rb.Ask(ctx, "memo", "When do laptops get replaced?", AskOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if answer.Citations[0].Source != "memo" || answer.Citations[0].Chunk != 1 {
+			t.Errorf("Unexpected citations: %+v", answer.Citations)
+		}
+		if _, err := rb.Index(ctx, "memo", "", "text", IndexOptions{}); err == nil {
+			t.Error("Expected a source to be required")
+		}
+	})
+}
+
+func TestCitedNumbers(t *testing.T) {
+	got := citedNumbers("As [1] and [2, 3] say, not [x] or [].")
+	if !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("citedNumbers() = %v", got)
+	}
+}
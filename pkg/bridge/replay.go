@@ -0,0 +1,200 @@
+// ABOUTME: Records the LLM responses a run receives so a later run can replay them
+// ABOUTME: A replaying bridge answers from the recording and never calls a provider
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+	schemadomain "github.com/lexlapax/go-llms/pkg/schema/domain"
+)
+
+// ErrNotRecorded is returned when a replayed run makes an LLM request the
+// recorded run did not make
+var ErrNotRecorded = errors.New("LLM request not in the recording")
+
+// RecordedResponse is one LLM response a run received. Key identifies the
+// request the same way the response cache does: by method, model, prompt,
+// and options.
+type RecordedResponse struct {
+	Key      string `json:"key"`
+	Method   string `json:"method"`
+	Model    string `json:"model"`
+	Prompt   string `json:"prompt"`
+	Response string `json:"response"`
+}
+
+// ResponseLog records LLM responses in the order a run received them, or
+// replays a recording. A request made several times replays its responses
+// in order, repeating the last one once they run out.
+type ResponseLog struct {
+	mu        sync.Mutex
+	replaying bool
+	responses []RecordedResponse
+	byKey     map[string][]int
+	replayed  map[string]int
+}
+
+// NewResponseLog creates an empty log that records responses
+func NewResponseLog() *ResponseLog {
+	return &ResponseLog{byKey: make(map[string][]int)}
+}
+
+// ReplayResponses creates a log that answers requests from a recording
+func ReplayResponses(responses []RecordedResponse) *ResponseLog {
+	l := &ResponseLog{
+		replaying: true,
+		byKey:     make(map[string][]int),
+		replayed:  make(map[string]int),
+	}
+	for _, response := range responses {
+		l.add(response)
+	}
+	return l
+}
+
+// Replaying reports whether the log answers requests instead of recording
+func (l *ResponseLog) Replaying() bool {
+	return l != nil && l.replaying
+}
+
+// Responses returns the recorded responses in the order they were received
+func (l *ResponseLog) Responses() []RecordedResponse {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]RecordedResponse(nil), l.responses...)
+}
+
+// record adds a response a run received; a replaying log keeps its recording
+func (l *ResponseLog) record(response RecordedResponse) {
+	if l == nil || l.replaying {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.add(response)
+}
+
+// replay returns the next recorded response to the request with key
+func (l *ResponseLog) replay(key string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	indexes := l.byKey[key]
+	if len(indexes) == 0 {
+		return "", false
+	}
+	next := l.replayed[key]
+	if next < len(indexes)-1 {
+		l.replayed[key] = next + 1
+	}
+	return l.responses[indexes[next]].Response, true
+}
+
+func (l *ResponseLog) add(response RecordedResponse) {
+	l.byKey[response.Key] = append(l.byKey[response.Key], len(l.responses))
+	l.responses = append(l.responses, response)
+}
+
+// SetResponseLog records every chat, completion, and finished stream
+// response in l, including ones answered from cache. A replaying log
+// answers those requests instead of the provider. nil turns recording off.
+func (b *LLMBridge) SetResponseLog(l *ResponseLog) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.responseLog = l
+}
+
+// responseKey identifies a request to the selected model
+func (b *LLMBridge) responseKey(method, prompt string, options ...interface{}) (string, string) {
+	target, err := b.ResolveModel(b.GetModel())
+	if err != nil {
+		return "", ""
+	}
+	return CacheKey(append([]interface{}{method, target.String(), prompt}, options...)...), target.String()
+}
+
+// replayedResponse answers a request from a replaying response log. The
+// second result reports whether the log is replaying; a request it did not
+// record fails with ErrNotRecorded.
+func (b *LLMBridge) replayedResponse(method, prompt string, options ...interface{}) (string, bool, error) {
+	b.mu.RLock()
+	log := b.responseLog
+	b.mu.RUnlock()
+	if !log.Replaying() {
+		return "", false, nil
+	}
+
+	key, model := b.responseKey(method, prompt, options...)
+	if response, ok := log.replay(key); ok {
+		return response, true, nil
+	}
+	return "", true, fmt.Errorf("%w: %s to %s", ErrNotRecorded, method, model)
+}
+
+// recordResponse adds a response the spell received to the response log
+func (b *LLMBridge) recordResponse(method, prompt, response string, options ...interface{}) {
+	b.mu.RLock()
+	log := b.responseLog
+	b.mu.RUnlock()
+	if log == nil || log.Replaying() {
+		return
+	}
+
+	key, model := b.responseKey(method, prompt, options...)
+	log.record(RecordedResponse{Key: key, Method: method, Model: model, Prompt: prompt, Response: response})
+}
+
+// NewReplayLLMBridge creates a bridge that answers every request from a
+// recording and needs no API keys. providers names the providers the
+// recorded run could use, so its models resolve the same way.
+func NewReplayLLMBridge(log *ResponseLog, providers ...string) *LLMBridge {
+	b := &LLMBridge{
+		providers:      make(map[string]domain.Provider),
+		model:          DefaultModel,
+		aliases:        DefaultModelAliases(),
+		modelProviders: make(map[string]domain.Provider),
+		responseLog:    log,
+	}
+	for _, name := range providers {
+		b.providers[name] = replayProvider{}
+	}
+	if len(providers) > 0 {
+		b.current = providers[0]
+	}
+	return b
+}
+
+// replayProvider stands in for a provider while replaying; requests the
+// recording answers never reach it
+type replayProvider struct{}
+
+func (replayProvider) Generate(ctx context.Context, prompt string, options ...domain.Option) (string, error) {
+	return "", ErrNotRecorded
+}
+
+func (replayProvider) GenerateMessage(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.Response, error) {
+	return domain.Response{}, ErrNotRecorded
+}
+
+func (replayProvider) GenerateWithSchema(ctx context.Context, prompt string, schema *schemadomain.Schema, options ...domain.Option) (interface{}, error) {
+	return nil, ErrNotRecorded
+}
+
+func (replayProvider) Stream(ctx context.Context, prompt string, options ...domain.Option) (domain.ResponseStream, error) {
+	return nil, ErrNotRecorded
+}
+
+func (replayProvider) StreamMessage(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.ResponseStream, error) {
+	return nil, ErrNotRecorded
+}
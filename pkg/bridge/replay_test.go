@@ -0,0 +1,103 @@
+// ABOUTME: Tests for recording LLM responses and replaying them without a provider
+// ABOUTME: Verifies replayed requests get recorded answers in order and unknown ones fail
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+)
+
+func TestResponseLogRecordAndReplay(t *testing.T) {
+	answers := []string{"first", "second"}
+	calls := 0
+	recording := &LLMBridge{
+		providers: map[string]domain.Provider{
+			"openai": &MockProvider{
+				generateMsgFunc: func(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.Response, error) {
+					answer := answers[calls%len(answers)]
+					calls++
+					return domain.Response{Content: answer}, nil
+				},
+			},
+		},
+		current: "openai",
+		aliases: DefaultModelAliases(),
+	}
+	log := NewResponseLog()
+	recording.SetResponseLog(log)
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := recording.Chat(ctx, "roll"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	var chunks string
+	if err := recording.StreamChat(ctx, "stream", func(chunk string) error {
+		chunks += chunk
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses := log.Responses()
+	if len(responses) != 3 {
+		t.Fatalf("expected 3 recorded responses, got %d", len(responses))
+	}
+	if responses[0].Method != "chat" || responses[0].Prompt != "roll" || responses[0].Response != "first" {
+		t.Errorf("unexpected first response: %+v", responses[0])
+	}
+
+	replay := NewReplayLLMBridge(ReplayResponses(responses), "openai")
+	for _, want := range []string{"first", "second", "second"} {
+		got, err := replay.Chat(ctx, "roll")
+		if err != nil {
+			t.Fatalf("unexpected replay error: %v", err)
+		}
+		if got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+
+	var replayed string
+	if err := replay.StreamChat(ctx, "stream", func(chunk string) error {
+		replayed += chunk
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected replay error: %v", err)
+	}
+	if replayed != chunks {
+		t.Errorf("expected replayed stream %q, got %q", chunks, replayed)
+	}
+
+	if _, err := replay.Chat(ctx, "something new"); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("expected ErrNotRecorded, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("replay should not call the provider, got %d calls", calls)
+	}
+}
+
+func TestResponseLogRecordsCacheHits(t *testing.T) {
+	b := &LLMBridge{
+		providers: map[string]domain.Provider{"openai": &MockProvider{}},
+		current:   "openai",
+		aliases:   DefaultModelAliases(),
+	}
+	b.SetResponseCache(NewResultCache(ResultCacheOptions{}))
+	log := NewResponseLog()
+	b.SetResponseLog(log)
+
+	for i := 0; i < 2; i++ {
+		if _, err := b.Complete(context.Background(), "finish this", 10); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := len(log.Responses()); n != 2 {
+		t.Errorf("expected the cached response to be recorded too, got %d responses", n)
+	}
+}
@@ -0,0 +1,350 @@
+// ABOUTME: Opt-in cache of LLM responses that spells turn on through llm.cache, keyed by a hash of the prompt
+// ABOUTME: Entries live in a ResponseStore, files in a directory by default, that the cache command can list and purge
+
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoResponseCache is returned when a spell turns on response caching
+// but no store was configured for it
+var ErrNoResponseCache = errors.New("no LLM response cache is configured")
+
+// ResponseStore keeps the entries of a ResponseCache, which the cache
+// command lists and purges. Implementations must be safe for concurrent
+// use.
+type ResponseStore interface {
+	CacheBackend
+
+	// Keys lists the keys of the entries that have not expired
+	Keys() ([]string, error)
+
+	// Purge deletes every entry and returns how many there were
+	Purge() (int, error)
+}
+
+// CachedResponse is an entry of a ResponseCache
+type CachedResponse struct {
+	Key      string    `json:"key"`
+	Method   string    `json:"method"`
+	Model    string    `json:"model"`
+	Prompt   string    `json:"prompt"`
+	Response string    `json:"response"`
+	Created  time.Time `json:"created"`
+}
+
+// ResponseCacheStatus is what a spell has set for its response cache
+type ResponseCacheStatus struct {
+	Enabled bool          `json:"enabled"`
+	TTL     time.Duration `json:"ttl"`
+	Bypass  bool          `json:"bypass"`
+}
+
+// ResponseCache answers repeated chat and completion prompts, for the same
+// model and options, with the response they got before, so that iterating
+// on a spell does not pay for the same call twice. It is off until a spell
+// enables it. Prompts must match exactly.
+type ResponseCache struct {
+	store ResponseStore
+	stats *ResultCache
+
+	mu     sync.Mutex
+	status ResponseCacheStatus
+}
+
+// NewResponseCache creates a cache over store, off until enabled. Lookups
+// are counted under CacheLLM in stats, when set.
+func NewResponseCache(store ResponseStore, stats *ResultCache) *ResponseCache {
+	return &ResponseCache{store: store, stats: stats}
+}
+
+// Enable turns caching on, keeping new entries for ttl, or until the store
+// drops them when ttl is zero
+func (c *ResponseCache) Enable(ttl time.Duration) error {
+	if c == nil || c.store == nil {
+		return ErrNoResponseCache
+	}
+	if ttl < 0 {
+		return fmt.Errorf("cache TTL must not be negative")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.Enabled = true
+	c.status.TTL = ttl
+	return nil
+}
+
+// Disable turns caching off; entries stay in the store for later runs
+func (c *ResponseCache) Disable() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.Enabled = false
+}
+
+// SetBypass skips lookups while on, so calls reach the provider and their
+// fresh responses replace the cached ones
+func (c *ResponseCache) SetBypass(bypass bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.Bypass = bypass
+}
+
+// Status returns the settings of the cache
+func (c *ResponseCache) Status() ResponseCacheStatus {
+	if c == nil {
+		return ResponseCacheStatus{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.status
+}
+
+// Enabled reports whether responses are being cached
+func (c *ResponseCache) Enabled() bool {
+	return c.Status().Enabled
+}
+
+// Get returns the response cached under key
+func (c *ResponseCache) Get(key string) (string, bool) {
+	status := c.Status()
+	if !status.Enabled {
+		return "", false
+	}
+	if status.Bypass {
+		c.stats.Bypass(CacheLLM)
+		return "", false
+	}
+
+	data, ok := c.store.Get(key)
+	var entry CachedResponse
+	if ok && json.Unmarshal(data, &entry) != nil {
+		ok = false
+	}
+	c.stats.Record(CacheLLM, ok)
+	return entry.Response, ok
+}
+
+// Put caches a response under its key, when caching is on
+func (c *ResponseCache) Put(entry CachedResponse) error {
+	status := c.Status()
+	if !status.Enabled {
+		return nil
+	}
+	if entry.Created.IsZero() {
+		entry.Created = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return c.store.Set(entry.Key, data, status.TTL)
+}
+
+// Entries lists the cached responses, oldest first
+func (c *ResponseCache) Entries() ([]CachedResponse, error) {
+	if c == nil || c.store == nil {
+		return nil, ErrNoResponseCache
+	}
+	keys, err := c.store.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]CachedResponse, 0, len(keys))
+	for _, key := range keys {
+		data, ok := c.store.Get(key)
+		if !ok {
+			continue
+		}
+		var entry CachedResponse
+		if json.Unmarshal(data, &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Created.Before(entries[j].Created)
+	})
+	return entries, nil
+}
+
+// Purge deletes every cached response and returns how many there were
+func (c *ResponseCache) Purge() (int, error) {
+	if c == nil || c.store == nil {
+		return 0, ErrNoResponseCache
+	}
+	return c.store.Purge()
+}
+
+// FileResponseStore is a ResponseStore keeping each entry in a JSON file of
+// a directory, created on first write
+type FileResponseStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// fileCacheEntry is the content of a FileResponseStore file
+type fileCacheEntry struct {
+	Value   json.RawMessage `json:"value"`
+	Expires time.Time       `json:"expires,omitempty"`
+}
+
+// NewFileResponseStore keeps entries in dir
+func NewFileResponseStore(dir string) *FileResponseStore {
+	return &FileResponseStore{dir: dir}
+}
+
+// Get returns the value of key unless it is missing or expired
+func (f *FileResponseStore) Get(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.read(key)
+	if !ok {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+// Set stores value under key for ttl, or until purged when ttl is zero
+func (f *FileResponseStore) Set(key string, value []byte, ttl time.Duration) error {
+	if !json.Valid(value) {
+		return fmt.Errorf("cache values must be JSON")
+	}
+	entry := fileCacheEntry{Value: value}
+	if ttl > 0 {
+		entry.Expires = time.Now().Add(ttl)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.MkdirAll(f.dir, 0o700); err != nil {
+		return err
+	}
+	// Write then rename, so a reader never sees half an entry
+	tmp, err := os.CreateTemp(f.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(key))
+}
+
+// Delete removes key
+func (f *FileResponseStore) Delete(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	os.Remove(f.path(key))
+}
+
+// Keys lists the keys that have not expired, deleting those that have
+func (f *FileResponseStore) Keys() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names, err := f.names()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		key := strings.TrimSuffix(name, ".json")
+		if _, ok := f.read(key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Purge deletes every entry, expired or not
+func (f *FileResponseStore) Purge() (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names, err := f.names()
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(f.dir, name)); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+	}
+	return len(names), nil
+}
+
+// read returns the entry of key, deleting it if expired. f.mu must be held.
+func (f *FileResponseStore) read(key string) (fileCacheEntry, bool) {
+	data, err := os.ReadFile(f.path(key))
+	if err != nil {
+		return fileCacheEntry{}, false
+	}
+	var entry fileCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return fileCacheEntry{}, false
+	}
+	if !entry.Expires.IsZero() && time.Now().After(entry.Expires) {
+		os.Remove(f.path(key))
+		return fileCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// names lists the entry files, sorted. f.mu must be held.
+func (f *FileResponseStore) names() ([]string, error) {
+	dirEntries, err := os.ReadDir(f.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range dirEntries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// path returns the file of key; keys are hex hashes, so safe as names
+func (f *FileResponseStore) path(key string) string {
+	return filepath.Join(f.dir, filepath.Base(key)+".json")
+}
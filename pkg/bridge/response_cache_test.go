@@ -0,0 +1,118 @@
+// ABOUTME: Tests for the opt-in LLM response cache scripts control
+// ABOUTME: Validates enabling, bypass, TTLs, listing and purging entries, and the file store
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+)
+
+func TestResponseCache(t *testing.T) {
+	newBridge := func(t *testing.T) (*LLMBridge, *ResponseCache, *ResultCache, *int) {
+		calls := 0
+		b := &LLMBridge{
+			providers: map[string]domain.Provider{"mock": &MockProvider{
+				generateMsgFunc: func(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.Response, error) {
+					calls++
+					return domain.Response{Content: "answer"}, nil
+				},
+			}},
+			current: "mock",
+		}
+		stats := NewResultCache(ResultCacheOptions{})
+		cache := NewResponseCache(NewFileResponseStore(t.TempDir()), stats)
+		b.SetScriptResponseCache(cache)
+		return b, cache, stats, &calls
+	}
+	chat := func(t *testing.T, b *LLMBridge, prompt string) {
+		t.Helper()
+		if response, err := b.Chat(context.Background(), prompt); err != nil || response != "answer" {
+			t.Fatalf("Chat() = %q, %v", response, err)
+		}
+	}
+
+	t.Run("is off until enabled", func(t *testing.T) {
+		b, cache, _, calls := newBridge(t)
+		chat(t, b, "same prompt")
+		chat(t, b, "same prompt")
+		if *calls != 2 {
+			t.Errorf("Expected both calls to reach the provider, got %d", *calls)
+		}
+		if entries, _ := cache.Entries(); len(entries) != 0 {
+			t.Errorf("Expected nothing cached, got %d entries", len(entries))
+		}
+	})
+
+	t.Run("answers repeated prompts once enabled", func(t *testing.T) {
+		b, cache, stats, calls := newBridge(t)
+		if err := cache.Enable(time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		chat(t, b, "same prompt")
+		chat(t, b, "same prompt")
+		if *calls != 1 {
+			t.Errorf("Expected one provider call, got %d", *calls)
+		}
+		if got := stats.Stats()[CacheLLM]; got.Hits != 1 || got.Misses != 1 {
+			t.Errorf("Unexpected stats: %+v", got)
+		}
+
+		entries, err := cache.Entries()
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("Entries() = %v, %v", entries, err)
+		}
+		if entries[0].Method != "chat" || entries[0].Model != "mock" || entries[0].Prompt != "same prompt" || entries[0].Response != "answer" {
+			t.Errorf("Unexpected entry: %+v", entries[0])
+		}
+
+		if n, err := cache.Purge(); err != nil || n != 1 {
+			t.Errorf("Purge() = %d, %v", n, err)
+		}
+		chat(t, b, "same prompt")
+		if *calls != 2 {
+			t.Errorf("Expected the purged prompt to reach the provider, got %d calls", *calls)
+		}
+	})
+
+	t.Run("bypass refreshes entries", func(t *testing.T) {
+		b, cache, stats, calls := newBridge(t)
+		_ = cache.Enable(0)
+		chat(t, b, "same prompt")
+		cache.SetBypass(true)
+		chat(t, b, "same prompt")
+		cache.SetBypass(false)
+		chat(t, b, "same prompt")
+		if *calls != 2 {
+			t.Errorf("Expected the bypassed call to reach the provider, got %d calls", *calls)
+		}
+		if got := stats.Stats()[CacheLLM]; got.Bypassed != 1 || got.Hits != 1 {
+			t.Errorf("Unexpected stats: %+v", got)
+		}
+	})
+
+	t.Run("entries expire", func(t *testing.T) {
+		b, cache, _, calls := newBridge(t)
+		_ = cache.Enable(time.Millisecond)
+		chat(t, b, "same prompt")
+		time.Sleep(5 * time.Millisecond)
+		chat(t, b, "same prompt")
+		if *calls != 2 {
+			t.Errorf("Expected the expired entry to be missed, got %d calls", *calls)
+		}
+	})
+
+	t.Run("needs a store", func(t *testing.T) {
+		if err := NewResponseCache(nil, nil).Enable(0); !errors.Is(err, ErrNoResponseCache) {
+			t.Errorf("Enable() without a store = %v", err)
+		}
+		var cache *ResponseCache
+		if err := cache.Enable(0); !errors.Is(err, ErrNoResponseCache) {
+			t.Errorf("Enable() on nil = %v", err)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+// ABOUTME: Result values that carry a bridge call's outcome as one script value
+// ABOUTME: Spells can check ok instead of relying on each engine's error conventions
+
+package bridge
+
+import "errors"
+
+// Result is the outcome of a bridge call as a single value, {ok, value,
+// error}. Engines report errors their own way, such as a second return
+// value in Lua or an exception in JavaScript; a Result looks the same in
+// every engine, so spells can handle errors uniformly.
+type Result struct {
+	OK    bool        `json:"ok"`
+	Value interface{} `json:"value,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// NewResult makes the result of a call that returned value and err
+func NewResult(value interface{}, err error) Result {
+	if err != nil {
+		return Result{Error: err.Error()}
+	}
+	return Result{OK: true, Value: value}
+}
+
+// Unwrap returns the value and error the result was made from
+func (r Result) Unwrap() (interface{}, error) {
+	if !r.OK {
+		return nil, errors.New(r.Error)
+	}
+	return r.Value, nil
+}
+
+// ToScript converts the result to the map engines convert to a script
+// object or table
+func (r Result) ToScript() map[string]interface{} {
+	script := map[string]interface{}{"ok": r.OK, "value": r.Value}
+	if !r.OK {
+		script["error"] = r.Error
+	}
+	return script
+}
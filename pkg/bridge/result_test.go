@@ -0,0 +1,33 @@
+// ABOUTME: Tests for results carrying a bridge call's outcome as one value
+// ABOUTME: Validates construction, unwrapping, and the script representation
+
+package bridge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResult(t *testing.T) {
+	ok := NewResult("value", nil)
+	if !ok.OK || ok.Value != "value" {
+		t.Errorf("Expected a successful result, got %+v", ok)
+	}
+	if value, err := ok.Unwrap(); value != "value" || err != nil {
+		t.Errorf("Expected the value back, got %v, %v", value, err)
+	}
+	if script := ok.ToScript(); script["ok"] != true || script["value"] != "value" || script["error"] != nil {
+		t.Errorf("Unexpected script value %v", script)
+	}
+
+	failed := NewResult("ignored", errors.New("boom"))
+	if failed.OK || failed.Value != nil || failed.Error != "boom" {
+		t.Errorf("Expected a failed result, got %+v", failed)
+	}
+	if _, err := failed.Unwrap(); err == nil || err.Error() != "boom" {
+		t.Errorf("Expected the error back, got %v", err)
+	}
+	if script := failed.ToScript(); script["ok"] != false || script["error"] != "boom" {
+		t.Errorf("Unexpected script value %v", script)
+	}
+}
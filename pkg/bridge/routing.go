@@ -0,0 +1,307 @@
+// ABOUTME: Routes LLM calls over an ordered list of models, retrying and failing over on rate limits and server errors
+// ABOUTME: Can try the models fastest first, by the latency observed on earlier calls
+
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+)
+
+// DefaultRouteBackoff is the wait before the first retry of a routed model
+// when the policy sets none; each further retry waits twice as long
+const DefaultRouteBackoff = 500 * time.Millisecond
+
+// routeLatencyWeight is the weight a new measurement gets in a model's
+// average latency
+const routeLatencyWeight = 0.3
+
+// RoutingPolicy spreads calls over several models. Each call goes to the
+// first model; a rate limit (429) or server error (5xx) is retried on the
+// same model up to Retries times, then the call fails over to the next
+// model. Other errors are returned at once, as another model would likely
+// fail the same way.
+type RoutingPolicy struct {
+	// Models are tried in order: aliases, "provider/model" pairs, or
+	// provider names for the provider's default model. Models whose
+	// provider is not available are skipped.
+	Models []string
+
+	// Retries is how many times a model is retried before failing over
+	Retries int
+
+	// Backoff is the wait before the first retry, doubling after each;
+	// zero uses DefaultRouteBackoff
+	Backoff time.Duration
+
+	// ByLatency tries the models with the lowest average latency first.
+	// Models not yet measured go first, so that each gets measured.
+	ByLatency bool
+}
+
+// Failover describes a call moving from one routed model to the next
+type Failover struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error"`
+}
+
+func (f Failover) String() string {
+	return fmt.Sprintf("failed over from %s to %s after %d attempt(s): %s", f.From, f.To, f.Attempts, f.Error)
+}
+
+// retryableMarkers are fragments of the errors providers return for rate
+// limits and server-side failures
+var retryableMarkers = []string{
+	"status 429",
+	"status 500",
+	"status 502",
+	"status 503",
+	"status 504",
+	"rate limit",
+	"too many requests",
+	"overloaded",
+	"internal server error",
+	"bad gateway",
+	"service unavailable",
+	"gateway timeout",
+}
+
+// IsRetryableError reports whether err is a rate limit, server error, or
+// timeout that another attempt, or another model, may get past
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var providerErr *domain.ProviderError
+	if errors.As(err, &providerErr) && (providerErr.StatusCode == 429 || providerErr.StatusCode >= 500) {
+		return true
+	}
+	for _, sentinel := range []error{
+		domain.ErrRateLimitExceeded,
+		domain.ErrProviderUnavailable,
+		domain.ErrNetworkConnectivity,
+		domain.ErrTimeout,
+		ErrCallTimeout,
+	} {
+		if errors.Is(err, sentinel) {
+			return true
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, marker := range retryableMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadRoutingPolicy reads a routing policy from a JSON file:
+//
+//	{"providers": ["anthropic/claude-3-5-sonnet-latest", "openai/gpt-4o"], "retries": 2, "backoff": "1s", "latency": true}
+func LoadRoutingPolicy(path string) (RoutingPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RoutingPolicy{}, err
+	}
+
+	var raw struct {
+		Providers []string `json:"providers"`
+		Retries   int      `json:"retries"`
+		Backoff   string   `json:"backoff"`
+		Latency   bool     `json:"latency"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return RoutingPolicy{}, fmt.Errorf("invalid routing config %s: %w", path, err)
+	}
+
+	policy := RoutingPolicy{Models: raw.Providers, Retries: raw.Retries, ByLatency: raw.Latency}
+	if raw.Backoff != "" {
+		if policy.Backoff, err = time.ParseDuration(raw.Backoff); err != nil {
+			return RoutingPolicy{}, fmt.Errorf("invalid routing config %s: backoff: %w", path, err)
+		}
+	}
+	if err := policy.validate(); err != nil {
+		return RoutingPolicy{}, fmt.Errorf("invalid routing config %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+func (p RoutingPolicy) validate() error {
+	for _, model := range p.Models {
+		if strings.TrimSpace(model) == "" {
+			return fmt.Errorf("routed model names must not be empty")
+		}
+	}
+	if p.Retries < 0 || p.Backoff < 0 {
+		return fmt.Errorf("routing retries and backoff must not be negative")
+	}
+	return nil
+}
+
+// SetRouting routes subsequent calls over policy's models instead of the
+// selected model. A policy without models turns routing off.
+func (b *LLMBridge) SetRouting(policy RoutingPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.routing = nil
+	if len(policy.Models) > 0 {
+		policy.Models = append([]string(nil), policy.Models...)
+		b.routing = &policy
+	}
+	return nil
+}
+
+// SetFailoverHandler registers a function called whenever a routed call
+// moves on to the next model
+func (b *LLMBridge) SetFailoverHandler(fn func(Failover)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.onFailover = fn
+}
+
+// RouteLatencies returns the average latency of each routed model that has
+// answered a call
+func (b *LLMBridge) RouteLatencies() map[string]time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	latencies := make(map[string]time.Duration, len(b.latencies))
+	for model, latency := range b.latencies {
+		latencies[model] = latency
+	}
+	return latencies
+}
+
+// route runs call over the models of policy, as RoutingPolicy describes,
+// recovering from context-length errors on each. It returns the target and
+// adjustment of the last attempt.
+func (b *LLMBridge) route(ctx context.Context, policy RoutingPolicy, prompt string, call func(provider domain.Provider, target ModelTarget, prompt string) error) (ModelTarget, *ContextAdjustment, error) {
+	models := b.routeOrder(policy)
+	backoff := policy.Backoff
+	if backoff == 0 {
+		backoff = DefaultRouteBackoff
+	}
+
+	var target ModelTarget
+	var adjustment *ContextAdjustment
+	var err error
+	for i, model := range models {
+		attempts := 0
+		for attempts <= policy.Retries {
+			if attempts > 0 {
+				select {
+				case <-time.After(backoff << (attempts - 1)):
+				case <-ctx.Done():
+					return target, adjustment, fmt.Errorf("%w (routing stopped: %v)", err, context.Cause(ctx))
+				}
+			}
+			attempts++
+
+			name := b.routedModel(model)
+			if _, resolveErr := b.ResolveModel(name); resolveErr != nil {
+				// A model whose provider is unavailable is skipped
+				err = resolveErr
+				break
+			}
+			start := time.Now()
+			target, adjustment, err = b.recoverContext(name, prompt, call)
+			if err == nil {
+				b.observeLatency(model, time.Since(start))
+				return target, adjustment, nil
+			}
+			if !IsRetryableError(err) {
+				return target, adjustment, err
+			}
+		}
+
+		if i+1 < len(models) {
+			b.reportFailover(Failover{From: model, To: models[i+1], Attempts: attempts, Error: err.Error()})
+		}
+	}
+	return target, adjustment, fmt.Errorf("%w (all %d routed models failed)", err, len(models))
+}
+
+// routableProviders are the providers a bare name in a routing policy
+// may refer to, whether or not their key is set
+var routableProviders = []string{"openai", "anthropic", "gemini"}
+
+// routedModel turns a bare provider name in a routing policy into the
+// "provider/" form for its default model; other names are left as they are
+func (b *LLMBridge) routedModel(model string) string {
+	if strings.Contains(model, "/") {
+		return model
+	}
+	b.mu.RLock()
+	_, alias := b.aliases[model]
+	_, provider := b.providers[model]
+	b.mu.RUnlock()
+	if !alias && (provider || slices.Contains(routableProviders, model)) {
+		return model + "/"
+	}
+	return model
+}
+
+// routeOrder returns the models of policy in the order to try them
+func (b *LLMBridge) routeOrder(policy RoutingPolicy) []string {
+	models := append([]string(nil), policy.Models...)
+	if !policy.ByLatency {
+		return models
+	}
+
+	latencies := b.RouteLatencies()
+	sort.SliceStable(models, func(i, j int) bool {
+		return latencies[models[i]] < latencies[models[j]]
+	})
+	return models
+}
+
+// observeLatency folds the latency of a successful call into model's
+// average
+func (b *LLMBridge) observeLatency(model string, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.latencies == nil {
+		b.latencies = make(map[string]time.Duration)
+	}
+	if average, ok := b.latencies[model]; ok {
+		latency = time.Duration(float64(average)*(1-routeLatencyWeight) + float64(latency)*routeLatencyWeight)
+	}
+	b.latencies[model] = latency
+}
+
+func (b *LLMBridge) reportFailover(failover Failover) {
+	b.mu.RLock()
+	handler := b.onFailover
+	b.mu.RUnlock()
+
+	if handler != nil {
+		handler(failover)
+	}
+}
+
+// getRouting returns the routing policy, if any
+func (b *LLMBridge) getRouting() *RoutingPolicy {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.routing
+}
@@ -0,0 +1,199 @@
+// ABOUTME: Tests for routing LLM calls over several models
+// ABOUTME: Validates retries, failover on rate limits and server errors, latency ordering, and the routing config
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+)
+
+// failingProvider fails the first failures calls with err, then answers
+// with its name
+func failingProvider(name string, failures int, err error, calls *[]string) *MockProvider {
+	return &MockProvider{
+		generateMsgFunc: func(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.Response, error) {
+			*calls = append(*calls, name)
+			if failures > 0 {
+				failures--
+				return domain.Response{}, err
+			}
+			return domain.Response{Content: name}, nil
+		},
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{domain.NewProviderError("openai", "Generate", 429, "slow down", nil), true},
+		{domain.NewProviderError("anthropic", "Generate", 529, "overloaded", nil), true},
+		{domain.NewProviderError("openai", "Generate", 401, "bad key", nil), false},
+		{errors.New("request failed: 503 Service Unavailable"), true},
+		{ErrCallTimeout, true},
+		{errors.New("prompt is too long"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryableError(tt.err); got != tt.want {
+			t.Errorf("IsRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRouting(t *testing.T) {
+	rateLimited := domain.NewProviderError("primary", "Generate", 429, "rate limited", nil)
+
+	t.Run("retries then fails over", func(t *testing.T) {
+		var calls []string
+		bridge := &LLMBridge{
+			providers: map[string]domain.Provider{
+				"primary": failingProvider("primary", 5, rateLimited, &calls),
+				"backup":  failingProvider("backup", 0, nil, &calls),
+			},
+			current: "primary",
+		}
+		if err := bridge.SetRouting(RoutingPolicy{Models: []string{"primary", "backup"}, Retries: 1, Backoff: time.Millisecond}); err != nil {
+			t.Fatal(err)
+		}
+		var failovers []Failover
+		bridge.SetFailoverHandler(func(f Failover) { failovers = append(failovers, f) })
+
+		response, err := bridge.Chat(context.Background(), "hi")
+		if err != nil || response != "backup" {
+			t.Fatalf("Chat() = %q, %v", response, err)
+		}
+		if !reflect.DeepEqual(calls, []string{"primary", "primary", "backup"}) {
+			t.Errorf("Expected a retry then a failover, got %v", calls)
+		}
+		if len(failovers) != 1 || failovers[0].From != "primary" || failovers[0].To != "backup" || failovers[0].Attempts != 2 {
+			t.Errorf("Unexpected failovers: %+v", failovers)
+		}
+	})
+
+	t.Run("returns other errors at once", func(t *testing.T) {
+		var calls []string
+		bridge := &LLMBridge{
+			providers: map[string]domain.Provider{
+				"primary": failingProvider("primary", 1, domain.NewProviderError("primary", "Generate", 401, "bad key", nil), &calls),
+				"backup":  failingProvider("backup", 0, nil, &calls),
+			},
+			current: "primary",
+		}
+		_ = bridge.SetRouting(RoutingPolicy{Models: []string{"primary", "backup"}, Retries: 2})
+
+		if _, err := bridge.Chat(context.Background(), "hi"); err == nil || len(calls) != 1 {
+			t.Errorf("Expected one failed call, got %v after %v", err, calls)
+		}
+	})
+
+	t.Run("skips unavailable providers and reports when all fail", func(t *testing.T) {
+		var calls []string
+		bridge := &LLMBridge{
+			providers: map[string]domain.Provider{"primary": failingProvider("primary", 5, rateLimited, &calls)},
+			current:   "primary",
+		}
+		_ = bridge.SetRouting(RoutingPolicy{Models: []string{"missing/model", "primary"}})
+
+		_, err := bridge.Chat(context.Background(), "hi")
+		if !IsRetryableError(err) || len(calls) != 1 {
+			t.Errorf("Expected the rate limit after one call, got %v after %v", err, calls)
+		}
+	})
+
+	t.Run("stops retrying when the context ends", func(t *testing.T) {
+		var calls []string
+		bridge := &LLMBridge{
+			providers: map[string]domain.Provider{"primary": failingProvider("primary", 5, rateLimited, &calls)},
+			current:   "primary",
+		}
+		_ = bridge.SetRouting(RoutingPolicy{Models: []string{"primary"}, Retries: 3, Backoff: time.Hour})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := bridge.Chat(ctx, "hi"); err == nil || len(calls) != 1 {
+			t.Errorf("Expected routing to stop during the backoff, got %v after %v", err, calls)
+		}
+	})
+
+	t.Run("tries the fastest model first", func(t *testing.T) {
+		var calls []string
+		slow := failingProvider("slow", 0, nil, &calls)
+		answer := slow.generateMsgFunc
+		slow.generateMsgFunc = func(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.Response, error) {
+			time.Sleep(20 * time.Millisecond)
+			return answer(ctx, messages, options...)
+		}
+		bridge := &LLMBridge{
+			providers: map[string]domain.Provider{"slow": slow, "fast": failingProvider("fast", 0, nil, &calls)},
+			current:   "slow",
+		}
+		_ = bridge.SetRouting(RoutingPolicy{Models: []string{"slow", "fast"}, ByLatency: true})
+
+		// Each model is measured once before the fastest is preferred
+		for i := 0; i < 4; i++ {
+			if i == 1 {
+				bridge.latencies = map[string]time.Duration{"slow": time.Second}
+			}
+			if _, err := bridge.Chat(context.Background(), "hi"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !reflect.DeepEqual(calls, []string{"slow", "fast", "fast", "fast"}) {
+			t.Errorf("Expected the faster model to be preferred, got %v", calls)
+		}
+		if latencies := bridge.RouteLatencies(); latencies["fast"] == 0 || latencies["fast"] >= latencies["slow"] {
+			t.Errorf("Unexpected latencies: %v", latencies)
+		}
+	})
+
+	t.Run("an empty policy turns routing off", func(t *testing.T) {
+		bridge := &LLMBridge{}
+		_ = bridge.SetRouting(RoutingPolicy{Models: []string{"a"}})
+		_ = bridge.SetRouting(RoutingPolicy{})
+		if bridge.getRouting() != nil {
+			t.Error("Expected routing to be off")
+		}
+		if err := bridge.SetRouting(RoutingPolicy{Models: []string{""}}); err == nil {
+			t.Error("Expected an empty model name to be refused")
+		}
+	})
+}
+
+func TestLoadRoutingPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routing.json")
+	config := `{"providers": ["anthropic/claude-3-5-sonnet-latest", "openai"], "retries": 2, "backoff": "250ms", "latency": true}`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadRoutingPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RoutingPolicy{
+		Models:    []string{"anthropic/claude-3-5-sonnet-latest", "openai"},
+		Retries:   2,
+		Backoff:   250 * time.Millisecond,
+		ByLatency: true,
+	}
+	if !reflect.DeepEqual(policy, want) {
+		t.Errorf("LoadRoutingPolicy() = %+v, want %+v", policy, want)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"backoff": "soon"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRoutingPolicy(path); err == nil {
+		t.Error("Expected an invalid backoff to be refused")
+	}
+}
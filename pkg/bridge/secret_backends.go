@@ -0,0 +1,435 @@
+// ABOUTME: Where secrets are looked up: environment variables, a passphrase-encrypted file, HashiCorp Vault, and AWS Secrets Manager
+// ABOUTME: Each backend is configured from the environment, the way its own tools are
+
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// SecretBackend looks up secret values by reference: what follows the
+// scheme in a secret's value
+type SecretBackend interface {
+	Lookup(ctx context.Context, ref string) (string, error)
+}
+
+// SecretBackendFunc adapts a function to SecretBackend
+type SecretBackendFunc func(ctx context.Context, ref string) (string, error)
+
+// Lookup calls f
+func (f SecretBackendFunc) Lookup(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// secretTimeout bounds a lookup in Vault or AWS
+const secretTimeout = 30 * time.Second
+
+// DefaultSecretBackends returns the backends of the env, file, vault, and
+// aws schemes, configured from the environment:
+//
+//   - file reads LLMSPELL_SECRETS_FILE, else ~/.llmspell/secrets.enc, with
+//     the passphrase in LLMSPELL_SECRETS_KEY
+//   - vault reads VAULT_ADDR, VAULT_TOKEN, and VAULT_NAMESPACE
+//   - aws reads AWS_REGION or AWS_DEFAULT_REGION, AWS_ACCESS_KEY_ID,
+//     AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, and
+//     AWS_ENDPOINT_URL_SECRETS_MANAGER or AWS_ENDPOINT_URL
+func DefaultSecretBackends() map[string]SecretBackend {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	return map[string]SecretBackend{
+		"env": SecretBackendFunc(func(ctx context.Context, name string) (string, error) {
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			return value, nil
+		}),
+		"file": &SecretFile{Path: DefaultSecretFile(), Passphrase: os.Getenv("LLMSPELL_SECRETS_KEY")},
+		"vault": &VaultSecrets{
+			Address:   os.Getenv("VAULT_ADDR"),
+			Token:     os.Getenv("VAULT_TOKEN"),
+			Namespace: os.Getenv("VAULT_NAMESPACE"),
+		},
+		"aws": &AWSSecrets{
+			Region:          region,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			Endpoint:        endpoint,
+		},
+	}
+}
+
+// DefaultSecretFile returns LLMSPELL_SECRETS_FILE, else
+// ~/.llmspell/secrets.enc
+func DefaultSecretFile() string {
+	if path := os.Getenv("LLMSPELL_SECRETS_FILE"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".llmspell", "secrets.enc")
+}
+
+// secretFileIterations is how many PBKDF2 rounds turn the passphrase into
+// the file's key
+const secretFileIterations = 600000
+
+// SecretFile is a file of named secrets encrypted with a passphrase, using
+// AES-256-GCM and a key derived with PBKDF2-SHA256. Its entries are
+// decrypted once and kept for later lookups.
+type SecretFile struct {
+	Path       string
+	Passphrase string
+
+	mu      sync.Mutex
+	entries map[string]string
+}
+
+// secretFileData is a SecretFile on disk
+type secretFileData struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Data       string `json:"data"`
+}
+
+// Lookup returns the entry named ref
+func (f *SecretFile) Lookup(ctx context.Context, ref string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.entries == nil {
+		entries, err := f.Load()
+		if err != nil {
+			return "", err
+		}
+		f.entries = entries
+	}
+	value, ok := f.entries[ref]
+	if !ok {
+		return "", fmt.Errorf("%s has no entry %q", f.Path, ref)
+	}
+	return value, nil
+}
+
+// Load decrypts the file's entries; a file that does not exist has none
+func (f *SecretFile) Load() (map[string]string, error) {
+	if f.Passphrase == "" {
+		return nil, errors.New("the secrets file needs a passphrase in LLMSPELL_SECRETS_KEY")
+	}
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored secretFileData
+	if err := json.Unmarshal(data, &stored); err != nil || stored.Version != 1 {
+		return nil, fmt.Errorf("%s is not a secrets file", f.Path)
+	}
+	salt, err1 := base64.StdEncoding.DecodeString(stored.Salt)
+	nonce, err2 := base64.StdEncoding.DecodeString(stored.Nonce)
+	sealed, err3 := base64.StdEncoding.DecodeString(stored.Data)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, fmt.Errorf("%s is not a secrets file: %w", f.Path, err)
+	}
+	gcm, err := f.cipher(salt, stored.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("%s is not a secrets file", f.Path)
+	}
+	plain, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt %s: wrong passphrase, or the file was changed", f.Path)
+	}
+	entries := map[string]string{}
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Path, err)
+	}
+	return entries, nil
+}
+
+// Save encrypts entries into the file with a fresh salt and nonce,
+// replacing it whole
+func (f *SecretFile) Save(entries map[string]string) error {
+	if f.Passphrase == "" {
+		return errors.New("the secrets file needs a passphrase in LLMSPELL_SECRETS_KEY")
+	}
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	gcm, err := f.cipher(salt, secretFileIterations)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(secretFileData{
+		Version:    1,
+		Iterations: secretFileIterations,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Data:       base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plain, nil)),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), ".secrets-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.Path); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.entries = nil
+	f.mu.Unlock()
+	return nil
+}
+
+// cipher derives the file's key from the passphrase
+func (f *SecretFile) cipher(salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations <= 0 {
+		return nil, fmt.Errorf("%s is not a secrets file", f.Path)
+	}
+	key, err := pbkdf2.Key(sha256.New, f.Passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// VaultSecrets reads fields of secrets in a HashiCorp Vault KV version 2
+// engine. A reference is mount/path#field, such as secret/github#token;
+// the field defaults to "value".
+type VaultSecrets struct {
+	Address   string
+	Token     string
+	Namespace string
+
+	// Client sends the requests; nil uses a client with a 30 second timeout
+	Client *http.Client
+}
+
+// Lookup reads the field ref names
+func (v *VaultSecrets) Lookup(ctx context.Context, ref string) (string, error) {
+	if v.Address == "" || v.Token == "" {
+		return "", errors.New("vault secrets need VAULT_ADDR and VAULT_TOKEN")
+	}
+	path, field, _ := strings.Cut(ref, "#")
+	if field == "" {
+		field = "value"
+	}
+	mount, rest, ok := strings.Cut(strings.Trim(path, "/"), "/")
+	if !ok || rest == "" {
+		return "", fmt.Errorf("vault secret %q must be mount/path#field", ref)
+	}
+
+	endpoint := strings.TrimRight(v.Address, "/") + "/v1/" + mount + "/data/" + rest
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	var reply struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+		Errors []string `json:"errors"`
+	}
+	status, err := secretRequest(v.Client, req, &reply)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("vault: %s: %d %s", path, status, strings.Join(reply.Errors, "; "))
+	}
+	value, ok := reply.Data.Data[field]
+	if !ok {
+		return "", fmt.Errorf("vault: %s has no field %q", path, field)
+	}
+	return secretString(value)
+}
+
+// AWSSecrets reads secrets from AWS Secrets Manager, signing requests with
+// the given credentials. A reference is a secret's name or ARN, with
+// #field to read one field of a secret that holds a JSON object.
+type AWSSecrets struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Endpoint replaces https://secretsmanager.<region>.amazonaws.com
+	Endpoint string
+
+	// Client sends the requests; nil uses a client with a 30 second timeout
+	Client *http.Client
+
+	// now dates requests; nil uses time.Now
+	now func() time.Time
+}
+
+// Lookup reads the secret ref names
+func (a *AWSSecrets) Lookup(ctx context.Context, ref string) (string, error) {
+	if a.Region == "" || a.AccessKeyID == "" || a.SecretAccessKey == "" {
+		return "", errors.New("aws secrets need AWS_REGION, AWS_ACCESS_KEY_ID, and AWS_SECRET_ACCESS_KEY")
+	}
+	id, field, _ := strings.Cut(ref, "#")
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + a.Region + ".amazonaws.com/"
+	}
+	body, _ := json.Marshal(map[string]string{"SecretId": id})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if err := a.sign(req, body); err != nil {
+		return "", fmt.Errorf("aws: %w", err)
+	}
+
+	var reply struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary []byte `json:"SecretBinary"`
+		Type         string `json:"__type"`
+		Message      string `json:"message"`
+	}
+	status, err := secretRequest(a.Client, req, &reply)
+	if err != nil {
+		return "", fmt.Errorf("aws: %w", err)
+	}
+	if status != http.StatusOK {
+		kind := reply.Type[strings.LastIndex(reply.Type, "#")+1:]
+		return "", fmt.Errorf("aws: %s: %d %s %s", id, status, kind, reply.Message)
+	}
+	value := reply.SecretString
+	if value == "" {
+		value = string(reply.SecretBinary)
+	}
+	if field == "" {
+		return value, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("aws: %s does not hold a JSON object", id)
+	}
+	fieldValue, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("aws: %s has no field %q", id, field)
+	}
+	return secretString(fieldValue)
+}
+
+// sign adds an AWS Signature Version 4 to a request for Secrets Manager
+func (a *AWSSecrets) sign(req *http.Request, body []byte) error {
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+	sum := sha256.Sum256(body)
+	credentials := aws.Credentials{
+		AccessKeyID:     a.AccessKeyID,
+		SecretAccessKey: a.SecretAccessKey,
+		SessionToken:    a.SessionToken,
+	}
+	return v4.NewSigner().SignHTTP(req.Context(), credentials, req, hex.EncodeToString(sum[:]), "secretsmanager", a.Region, now())
+}
+
+// secretRequest sends a request to a secrets service and decodes its JSON
+// reply, of any status, into reply
+func secretRequest(client *http.Client, req *http.Request, reply interface{}) (int, error) {
+	if client == nil {
+		client = &http.Client{Timeout: secretTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(data, reply); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("unexpected reply: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// secretString returns a field's value as a string, encoding values that
+// are not strings as JSON
+func secretString(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
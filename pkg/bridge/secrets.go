@@ -0,0 +1,209 @@
+// ABOUTME: Secrets spells use by name without seeing them, from the environment, an encrypted file, Vault, or AWS Secrets Manager
+// ABOUTME: Scripts hold opaque handles, which the http and llm modules reveal only for the hosts a secret allows
+
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Secret is a credential spells may use by name without seeing it. Value
+// is the credential, or where to find it:
+//
+//	env:NAME          the environment variable NAME
+//	file:NAME         the entry NAME of the encrypted secrets file
+//	vault:PATH#FIELD  a field of a Vault KV version 2 secret, such as vault:secret/github#token
+//	aws:ID[#FIELD]    an AWS Secrets Manager secret, or a field of one that holds JSON
+//
+// The secret is sent only to the hosts in Hosts, and nowhere when it lists
+// none; "*.example.com" matches subdomains, and "*" any host.
+type Secret struct {
+	Value string   `json:"value"`
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// SecretsConfig holds the secrets spells may use by name
+type SecretsConfig struct {
+	Secrets map[string]Secret `json:"secrets"`
+
+	// Backends look up values by the scheme before their first colon; nil
+	// uses DefaultSecretBackends
+	Backends map[string]SecretBackend `json:"-"`
+}
+
+// LoadSecrets reads secrets from a JSON file:
+//
+//	{"secrets": {"github": {"value": "env:GITHUB_TOKEN", "hosts": ["api.github.com"]}}}
+func LoadSecrets(path string) (SecretsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SecretsConfig{}, err
+	}
+	var config SecretsConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return SecretsConfig{}, fmt.Errorf("invalid secrets file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Resolve returns the named secret and its value, looked up in the
+// backend its scheme names. A value with no known scheme is the secret
+// itself.
+func (c SecretsConfig) Resolve(ctx context.Context, name string) (Secret, string, error) {
+	secret, found := c.Secrets[name]
+	if !found {
+		return Secret{}, "", fmt.Errorf("no secret %q is configured", name)
+	}
+	backends := c.Backends
+	if backends == nil {
+		backends = DefaultSecretBackends()
+	}
+
+	value := secret.Value
+	if scheme, ref, ok := strings.Cut(value, ":"); ok {
+		if backend, known := backends[scheme]; known {
+			var err error
+			if value, err = backend.Lookup(ctx, ref); err != nil {
+				return Secret{}, "", fmt.Errorf("secret %q: %w", name, err)
+			}
+		}
+	}
+	if value == "" {
+		return Secret{}, "", fmt.Errorf("secret %q is empty", name)
+	}
+	return secret, value, nil
+}
+
+// Allows reports whether the secret may be sent to host
+func (s Secret) Allows(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range s.Hosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok && strings.HasSuffix(host, suffix) || host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// SecretsBridge hands scripts handles to the configured secrets. Each
+// value is looked up once per run, when a script first asks for it.
+type SecretsBridge struct {
+	config SecretsConfig
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// NewSecretsBridge creates a bridge to the secrets in config
+func NewSecretsBridge(config SecretsConfig) *SecretsBridge {
+	return &SecretsBridge{config: config, values: make(map[string]string)}
+}
+
+// Names lists the configured secrets
+func (b *SecretsBridge) Names() []string {
+	names := make([]string, 0, len(b.config.Secrets))
+	for name := range b.config.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Handle returns a handle to the named secret. The value is looked up now,
+// so a missing secret is reported to the script that asks for it.
+func (b *SecretsBridge) Handle(ctx context.Context, name string) (*SecretHandle, error) {
+	secret, err := b.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretHandle{bridge: b, name: name, secret: secret}, nil
+}
+
+// lookup returns the named secret, looking its value up on first use
+func (b *SecretsBridge) lookup(ctx context.Context, name string) (Secret, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.values[name]; ok {
+		return b.config.Secrets[name], nil
+	}
+	secret, value, err := b.config.Resolve(ctx, name)
+	if err != nil {
+		return Secret{}, err
+	}
+	b.values[name] = value
+	return secret, nil
+}
+
+// value returns the value lookup found
+func (b *SecretsBridge) value(name string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.values[name]
+}
+
+// SecretHandle stands for a secret in a script. It never shows the value:
+// modules that send secrets call Reveal for the host they send it to.
+type SecretHandle struct {
+	bridge *SecretsBridge
+	name   string
+	secret Secret
+	// template surrounds the value, with %s where it goes
+	template string
+}
+
+// Name returns the name of the secret
+func (h *SecretHandle) Name() string {
+	return h.name
+}
+
+// String shows the handle, not the secret
+func (h *SecretHandle) String() string {
+	return "secret(" + h.name + ")"
+}
+
+// MarshalJSON encodes the handle as the redaction marker
+func (h *SecretHandle) MarshalJSON() ([]byte, error) {
+	return json.Marshal(DefaultRedaction)
+}
+
+// Format returns a handle whose value is the secret placed in template at
+// its one %s, such as "Bearer %s"
+func (h *SecretHandle) Format(template string) (*SecretHandle, error) {
+	if strings.Count(template, "%s") != 1 {
+		return nil, fmt.Errorf("template must contain %%s once, got %q", template)
+	}
+	if h.template != "" {
+		template = strings.Replace(template, "%s", h.template, 1)
+	}
+	formatted := *h
+	formatted.template = template
+	return &formatted, nil
+}
+
+// Allows reports whether the secret may be sent to host
+func (h *SecretHandle) Allows(host string) bool {
+	return h.secret.Allows(host)
+}
+
+// Reveal returns the value to send to host, or an error when the secret
+// may not be sent there
+func (h *SecretHandle) Reveal(host string) (string, error) {
+	if len(h.secret.Hosts) == 0 {
+		return "", fmt.Errorf("secret %q lists no hosts it may be sent to", h.name)
+	}
+	if !h.Allows(host) {
+		return "", fmt.Errorf("secret %q may not be sent to %s", h.name, host)
+	}
+	value := h.bridge.value(h.name)
+	if h.template != "" {
+		value = strings.Replace(h.template, "%s", value, 1)
+	}
+	return value, nil
+}
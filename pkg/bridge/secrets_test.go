@@ -0,0 +1,232 @@
+// ABOUTME: Tests for secrets and their backends
+// ABOUTME: Validates handles limited to allowed hosts, the encrypted file, and lookups in Vault and AWS Secrets Manager
+
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretsBridge(t *testing.T) {
+	t.Setenv("TEST_SECRET_TOKEN", "s3cret")
+	lookups := 0
+	secrets := NewSecretsBridge(SecretsConfig{
+		Secrets: map[string]Secret{
+			"token":   {Value: "env:TEST_SECRET_TOKEN", Hosts: []string{"*.example.com"}},
+			"literal": {Value: "plain"},
+			"counted": {Value: "count:x"},
+			"missing": {Value: "env:TEST_SECRET_MISSING"},
+		},
+		Backends: map[string]SecretBackend{
+			"env": DefaultSecretBackends()["env"],
+			"count": SecretBackendFunc(func(ctx context.Context, ref string) (string, error) {
+				lookups++
+				return "counted-" + ref, nil
+			}),
+		},
+	})
+	ctx := context.Background()
+
+	if got := strings.Join(secrets.Names(), ","); got != "counted,literal,missing,token" {
+		t.Errorf("Unexpected names %s", got)
+	}
+
+	token, err := secrets.Handle(ctx, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.String() != "secret(token)" || strings.Contains(fmt.Sprint(token), "s3cret") {
+		t.Errorf("Expected the handle to hide its value, got %s", token)
+	}
+	if data, _ := json.Marshal(map[string]interface{}{"auth": token}); strings.Contains(string(data), "s3cret") {
+		t.Errorf("Expected JSON to hide the value, got %s", data)
+	}
+	if value, err := token.Reveal("api.example.com"); err != nil || value != "s3cret" {
+		t.Errorf("Expected the value for an allowed host, got %q, %v", value, err)
+	}
+	if _, err := token.Reveal("evil.test"); err == nil || !strings.Contains(err.Error(), "may not be sent to evil.test") {
+		t.Errorf("Expected a host that is not allowed to be refused, got %v", err)
+	}
+	if !token.Allows("api.example.com") || token.Allows("evil.test") {
+		t.Error("Unexpected Allows results")
+	}
+
+	bearer, err := token.Format("Bearer %s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	quoted, _ := bearer.Format("[%s]")
+	if value, _ := quoted.Reveal("api.example.com"); value != "[Bearer s3cret]" {
+		t.Errorf("Expected nested templates, got %q", value)
+	}
+	if _, err := token.Format("no placeholder"); err == nil {
+		t.Error("Expected a template without a placeholder to be refused")
+	}
+
+	literal, err := secrets.Handle(ctx, "literal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := literal.Reveal("anywhere.test"); err == nil || !strings.Contains(err.Error(), "lists no hosts") {
+		t.Errorf("Expected a secret without hosts to be sent nowhere, got %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := secrets.Handle(ctx, "counted"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("Expected one lookup per run, got %d", lookups)
+	}
+
+	if _, err := secrets.Handle(ctx, "missing"); err == nil || !strings.Contains(err.Error(), "TEST_SECRET_MISSING is not set") {
+		t.Errorf("Expected an unset variable to be reported, got %v", err)
+	}
+	if _, err := secrets.Handle(ctx, "nope"); err == nil || !strings.Contains(err.Error(), `no secret "nope"`) {
+		t.Errorf("Expected an unknown secret to be reported, got %v", err)
+	}
+}
+
+func TestSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	file := &SecretFile{Path: path, Passphrase: "correct horse"}
+
+	entries, err := file.Load()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Expected a missing file to have no entries, got %v, %v", entries, err)
+	}
+	if err := file.Save(map[string]string{"github": "ghp_123", "slack": "xoxb-456"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "ghp_123") {
+		t.Error("Expected the file to be encrypted")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the file to be private, got %v", info.Mode())
+	}
+
+	if value, err := file.Lookup(context.Background(), "github"); err != nil || value != "ghp_123" {
+		t.Errorf("Expected the stored value, got %q, %v", value, err)
+	}
+	if _, err := file.Lookup(context.Background(), "nope"); err == nil {
+		t.Error("Expected a missing entry to fail")
+	}
+
+	wrong := &SecretFile{Path: path, Passphrase: "wrong"}
+	if _, err := wrong.Load(); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("Expected a wrong passphrase to fail, got %v", err)
+	}
+	if _, err := (&SecretFile{Path: path}).Load(); err == nil {
+		t.Error("Expected a missing passphrase to fail")
+	}
+}
+
+func TestVaultSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors": ["permission denied"]}`)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/github" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+			return
+		}
+		fmt.Fprint(w, `{"data": {"data": {"token": "ghp_vault", "value": "default", "port": 8080}}}`)
+	}))
+	defer server.Close()
+	vault := &VaultSecrets{Address: server.URL, Token: "root"}
+	ctx := context.Background()
+
+	for ref, want := range map[string]string{
+		"secret/github#token": "ghp_vault",
+		"secret/github":       "default",
+		"secret/github#port":  "8080",
+	} {
+		if value, err := vault.Lookup(ctx, ref); err != nil || value != want {
+			t.Errorf("%s: expected %q, got %q, %v", ref, want, value, err)
+		}
+	}
+	if _, err := vault.Lookup(ctx, "secret/github#nope"); err == nil || !strings.Contains(err.Error(), `no field "nope"`) {
+		t.Errorf("Expected a missing field to fail, got %v", err)
+	}
+	if _, err := vault.Lookup(ctx, "secret/other#token"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected a missing secret to fail, got %v", err)
+	}
+	if _, err := vault.Lookup(ctx, "github"); err == nil {
+		t.Error("Expected a path without a mount to fail")
+	}
+	denied := &VaultSecrets{Address: server.URL, Token: "guest"}
+	if _, err := denied.Lookup(ctx, "secret/github#token"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Expected Vault's error, got %v", err)
+	}
+}
+
+func TestAWSSecrets(t *testing.T) {
+	var authorization, target, token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		target = r.Header.Get("X-Amz-Target")
+		token = r.Header.Get("X-Amz-Security-Token")
+		var body struct{ SecretId string }
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		switch body.SecretId {
+		case "prod/db":
+			fmt.Fprint(w, `{"Name": "prod/db", "SecretString": "{\"password\": \"hunter2\"}"}`)
+		case "plain":
+			fmt.Fprint(w, `{"SecretString": "just-a-string"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type": "com.amazonaws.secretsmanager#ResourceNotFoundException", "message": "Secrets Manager can't find the specified secret."}`)
+		}
+	}))
+	defer server.Close()
+	aws := &AWSSecrets{
+		Region:          "eu-west-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		SessionToken:    "session",
+		Endpoint:        server.URL,
+		now:             func() time.Time { return time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC) },
+	}
+	ctx := context.Background()
+
+	if value, err := aws.Lookup(ctx, "prod/db#password"); err != nil || value != "hunter2" {
+		t.Errorf("Expected the field, got %q, %v", value, err)
+	}
+	if target != "secretsmanager.GetSecretValue" || token != "session" {
+		t.Errorf("Unexpected target %q or token %q", target, token)
+	}
+	prefix := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20240301/eu-west-1/secretsmanager/aws4_request, " +
+		"SignedHeaders=content-length;content-type;host;x-amz-date;x-amz-security-token;x-amz-target, Signature="
+	if !strings.HasPrefix(authorization, prefix) || len(authorization) != len(prefix)+64 {
+		t.Errorf("Unexpected authorization %q", authorization)
+	}
+
+	if value, err := aws.Lookup(ctx, "plain"); err != nil || value != "just-a-string" {
+		t.Errorf("Expected the whole secret, got %q, %v", value, err)
+	}
+	if _, err := aws.Lookup(ctx, "plain#field"); err == nil || !strings.Contains(err.Error(), "JSON object") {
+		t.Errorf("Expected a field of a string secret to fail, got %v", err)
+	}
+	if _, err := aws.Lookup(ctx, "nope"); err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Errorf("Expected AWS's error, got %v", err)
+	}
+	if _, err := (&AWSSecrets{}).Lookup(ctx, "prod/db"); err == nil {
+		t.Error("Expected lookups without credentials to fail")
+	}
+}
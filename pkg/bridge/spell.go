@@ -0,0 +1,354 @@
+// ABOUTME: Spell bridge that lets a spell run other spells and code snippets
+// ABOUTME: Each call gets a fresh engine from the engine registry, within a recursion depth limit
+
+package bridge
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+// DefaultMaxSpellDepth limits how deeply spells may nest when MaxDepth is not set
+const DefaultMaxSpellDepth = 8
+
+// ErrSpellDepth is returned when running a sub-spell would exceed the depth limit
+var ErrSpellDepth = errors.New("spell recursion depth exceeded")
+
+// SpellOptions configure a SpellBridge
+type SpellOptions struct {
+	// Dir is the directory relative sub-spell paths are resolved against,
+	// normally the directory of the spell that is running
+	Dir string
+
+	// MaxDepth limits how many spells may be nested, counting the top-level
+	// spell; zero means DefaultMaxSpellDepth
+	MaxDepth int
+
+	// Engines creates the engines sub-spells run in; nil means the global
+	// registry
+	Engines *engine.Registry
+
+	// Config configures each engine
+	Config engine.Config
+
+	// State is the top-level spell's shared state; nil starts empty state
+	State *SharedState
+
+	// Channels are the named states the spell and its sub-spells can
+	// attach to; nil gives them their own, open to any name
+	Channels *StateChannels
+
+	// Trace is the top-level spell's span; the zero value starts a new trace
+	Trace TraceContext
+
+	// Cache memoizes sub-spell results by spell and params; nil turns
+	// memoization off
+	Cache *ResultCache
+
+	// Prepare sets up a fresh engine before its script loads: registering
+	// bridges and applying the caller's security profile. spell is the
+	// bridge the engine should expose to its script, one level deeper,
+	// with the sub-spell's state and span.
+	Prepare func(eng engine.Engine, name string, spell *SpellBridge) error
+}
+
+// SpellRunOptions adjust a single run or eval
+type SpellRunOptions struct {
+	// NoCache runs the spell even if a cached result exists, for spells
+	// that are not deterministic
+	NoCache bool
+
+	// State decides what of the caller's shared state the sub-spell sees
+	State StateInheritance
+
+	// StateID attaches the sub-spell to the state of the caller or one of
+	// its ancestors by ID, instead of the caller's own
+	StateID string
+}
+
+// SpellBridge runs sub-spells for a spell. Every run or eval gets its own
+// engine, so sub-spells cannot see or change the caller's globals; values
+// pass in through the params global and out through the script's return
+// value.
+type SpellBridge struct {
+	opts  SpellOptions
+	depth int
+	state *SharedState
+	trace TraceContext
+}
+
+// NewSpellBridge creates the spell bridge for a top-level spell
+func NewSpellBridge(opts SpellOptions) *SpellBridge {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultMaxSpellDepth
+	}
+	if opts.Engines == nil {
+		opts.Engines = engine.DefaultRegistry()
+	}
+	state := opts.State
+	if state == nil {
+		state = NewSharedState()
+	}
+	if opts.Channels == nil {
+		opts.Channels = NewStateChannels(security.ChannelPolicy{}, nil)
+	}
+	trace := opts.Trace
+	if trace.TraceID == "" {
+		trace = NewTraceContext()
+	}
+	return &SpellBridge{opts: opts, depth: 1, state: state, trace: trace}
+}
+
+// State returns the shared state of the spell using this bridge
+func (b *SpellBridge) State() *SharedState {
+	return b.state
+}
+
+// Channels returns the named states shared by every spell of the run
+func (b *SpellBridge) Channels() *StateChannels {
+	return b.opts.Channels
+}
+
+// Trace returns the span of the spell using this bridge
+func (b *SpellBridge) Trace() TraceContext {
+	return b.trace
+}
+
+// Depth returns how deeply the spell using this bridge is nested; the
+// top-level spell is at depth 1
+func (b *SpellBridge) Depth() int {
+	return b.depth
+}
+
+// MaxDepth returns the nesting limit
+func (b *SpellBridge) MaxDepth() int {
+	return b.opts.MaxDepth
+}
+
+// Run runs the spell at path, a script file or a directory with a main
+// script, and returns the value the script returns. Results are memoized
+// by the script's path and contents plus params, so running a sub-spell
+// again with the same inputs returns the earlier result.
+func (b *SpellBridge) Run(ctx context.Context, path string, params map[string]interface{}, opts SpellRunOptions) (interface{}, error) {
+	if !filepath.IsAbs(path) && b.opts.Dir != "" {
+		path = filepath.Join(b.opts.Dir, path)
+	}
+	script, name, err := b.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	engineName, err := b.opts.Engines.Detect(script)
+	if err != nil {
+		return nil, fmt.Errorf("cannot run spell %q: %w", name, err)
+	}
+
+	var key string
+	if b.opts.Cache != nil {
+		if opts.NoCache {
+			b.opts.Cache.Bypass(CacheSpell)
+		} else if key, err = spellCacheKey(script, params); err == nil {
+			if result, ok := b.opts.Cache.Get(CacheSpell, key); ok {
+				return result, nil
+			}
+		}
+	}
+
+	result, err := b.execute(ctx, engineName, name, filepath.Dir(script), params, opts, func(eng engine.Engine) error {
+		return eng.LoadScriptFile(script)
+	})
+	if err == nil && key != "" {
+		b.opts.Cache.Put(CacheSpell, key, result)
+	}
+	return result, err
+}
+
+// spellCacheKey identifies a run of the script with params
+func spellCacheKey(script string, params map[string]interface{}) (string, error) {
+	abs, err := filepath.Abs(script)
+	if err != nil {
+		return "", err
+	}
+	contents, err := os.ReadFile(script)
+	if err != nil {
+		return "", err
+	}
+	return CacheKey(abs, sha256.Sum256(contents), params), nil
+}
+
+// CacheStats returns the usage counts of the result cache
+func (b *SpellBridge) CacheStats() map[string]CacheStats {
+	return b.opts.Cache.Stats()
+}
+
+// Eval runs code in a fresh engine of the named kind, "lua" when empty,
+// and returns the value the code returns
+func (b *SpellBridge) Eval(ctx context.Context, code, engineName string, params map[string]interface{}, opts SpellRunOptions) (interface{}, error) {
+	if engineName == "" {
+		engineName = "lua"
+	}
+	return b.execute(ctx, engineName, "eval", b.opts.Dir, params, opts, func(eng engine.Engine) error {
+		return eng.LoadScript(strings.NewReader(code))
+	})
+}
+
+// execute creates an engine one level deeper, loads a script into it and
+// runs it in a child span of the caller's trace
+func (b *SpellBridge) execute(ctx context.Context, engineName, name, dir string, params map[string]interface{}, opts SpellRunOptions, load func(engine.Engine) error) (interface{}, error) {
+	if b.depth >= b.opts.MaxDepth {
+		return nil, fmt.Errorf("%w: %q would run at depth %d, the limit is %d", ErrSpellDepth, name, b.depth+1, b.opts.MaxDepth)
+	}
+
+	state := b.state
+	if opts.StateID != "" {
+		var ok bool
+		if state, ok = b.state.Find(opts.StateID); !ok {
+			return nil, fmt.Errorf("no shared state %q is visible to this spell", opts.StateID)
+		}
+	}
+
+	factory, err := b.opts.Engines.GetFactory(engineName)
+	if err != nil {
+		return nil, err
+	}
+	eng, err := factory(b.opts.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s engine: %w", engineName, err)
+	}
+	if closer, ok := eng.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+
+	childOpts := b.opts
+	childOpts.Dir = dir
+	child := &SpellBridge{
+		opts:  childOpts,
+		depth: b.depth + 1,
+		state: state.Child(opts.State),
+		trace: b.trace.Child(),
+	}
+	// Locks the sub-spell forgot to release would block its caller
+	defer child.state.ReleaseLocks()
+	ctx = ContextWithTrace(ctx, child.trace)
+	if b.opts.Prepare != nil {
+		if err := b.opts.Prepare(eng, name, child); err != nil {
+			return nil, fmt.Errorf("failed to prepare spell %q: %w", name, err)
+		}
+	}
+
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+	if err := eng.SetVariable("params", params); err != nil {
+		return nil, fmt.Errorf("failed to set params for spell %q: %w", name, err)
+	}
+	if err := load(eng); err != nil {
+		return nil, fmt.Errorf("failed to load spell %q: %w", name, err)
+	}
+
+	if results, ok := eng.(engine.ResultEngine); ok {
+		result, err := results.ExecuteResult(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("spell %q failed: %w", name, err)
+		}
+		return result, nil
+	}
+	if err := eng.Execute(ctx); err != nil {
+		return nil, fmt.Errorf("spell %q failed: %w", name, err)
+	}
+	return nil, nil
+}
+
+// resolve finds the script to run for path and names the spell after it
+func (b *SpellBridge) resolve(path string) (script, name string, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot access spell: %w", err)
+	}
+	if !info.IsDir() {
+		return path, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), nil
+	}
+
+	// A spell directory holds a main script in any known language
+	matches, _ := filepath.Glob(filepath.Join(path, "main.*"))
+	sort.Strings(matches)
+	for _, match := range matches {
+		if _, err := b.opts.Engines.DiscoverByExtension(filepath.Ext(match)); err == nil {
+			return match, filepath.Base(path), nil
+		}
+	}
+	return "", "", fmt.Errorf("no main script found in spell %q", path)
+}
+
+// Name returns the name of the bridge
+func (b *SpellBridge) Name() string {
+	return "spell"
+}
+
+// Methods returns information about all methods exposed by this bridge
+func (b *SpellBridge) Methods() []MethodInfo {
+	return []MethodInfo{
+		{
+			Name:        "run",
+			Description: "Run another spell in a fresh engine and return its result",
+			Parameters: []ParameterInfo{
+				{Name: "path", Type: "string", Required: true, Description: "Spell file or directory, relative to the calling spell"},
+				{Name: "params", Type: "object", Required: false, Description: "Values the spell sees as params"},
+				{Name: "options", Type: "object", Required: false, Description: "cache = false skips cached results; state = false, a state ID, or {keys, read_only, id} controls shared state"},
+			},
+			ReturnType: "any",
+		},
+		{
+			Name:        "eval",
+			Description: "Run a code snippet in a fresh engine and return its result",
+			Parameters: []ParameterInfo{
+				{Name: "code", Type: "string", Required: true, Description: "Code to run"},
+				{Name: "engine", Type: "string", Required: false, Description: "Engine to run the code in", Default: "lua"},
+				{Name: "params", Type: "object", Required: false, Description: "Values the code sees as params"},
+				{Name: "options", Type: "object", Required: false, Description: "Shared state options, as for run"},
+			},
+			ReturnType: "any",
+		},
+		{
+			Name:        "cache_stats",
+			Description: "Return hits and misses of the sub-spell and LLM result cache",
+			ReturnType:  "object",
+		},
+		{
+			Name:        "traceparent",
+			Description: "Return the W3C traceparent of the current spell, for passing to other services",
+			ReturnType:  "string",
+		},
+		{
+			Name:        "depth",
+			Description: "Return how deeply the current spell is nested, and the limit",
+			ReturnType:  "number",
+		},
+		{
+			Name:        "on_exit",
+			Description: "Run a function when the spell ends, even on error or cancellation; it gets how the spell ended and the error",
+			Parameters: []ParameterInfo{
+				{Name: "fn", Type: "function", Required: true, Description: "Called as fn(reason, err); reason is nil on success, \"error\", or why the spell was cancelled"},
+			},
+			ReturnType: "nil",
+		},
+	}
+}
+
+// Initialize prepares the bridge for use
+func (b *SpellBridge) Initialize(ctx context.Context) error {
+	return nil
+}
+
+// Cleanup releases any resources held by the bridge
+func (b *SpellBridge) Cleanup(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,193 @@
+// ABOUTME: Tests for the spell bridge that runs sub-spells in fresh engines
+// ABOUTME: Validates spell resolution, params and results, and the recursion depth limit
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+)
+
+// echoEngine returns its script and the params it was given as its result
+type echoEngine struct {
+	script string
+	vars   map[string]interface{}
+}
+
+func (e *echoEngine) Name() string { return "echo" }
+
+func (e *echoEngine) LoadScript(reader io.Reader) error {
+	data, err := io.ReadAll(reader)
+	e.script = strings.TrimSpace(string(data))
+	return err
+}
+
+func (e *echoEngine) LoadScriptFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return e.LoadScript(file)
+}
+
+func (e *echoEngine) Execute(ctx context.Context) error {
+	_, err := e.ExecuteResult(ctx)
+	return err
+}
+
+func (e *echoEngine) ExecuteResult(ctx context.Context) (interface{}, error) {
+	return fmt.Sprintf("%s %v", e.script, e.vars["params"]), ctx.Err()
+}
+
+func (e *echoEngine) RegisterFunction(name string, fn interface{}) error { return nil }
+
+func (e *echoEngine) SetVariable(name string, value interface{}) error {
+	e.vars[name] = value
+	return nil
+}
+
+func (e *echoEngine) GetVariable(name string) (interface{}, error) {
+	return e.vars[name], nil
+}
+
+func newEchoRegistry(t *testing.T) *engine.Registry {
+	t.Helper()
+
+	registry := engine.NewRegistry()
+	err := registry.RegisterWithMetadata("echo", func(config engine.Config) (engine.Engine, error) {
+		return &echoEngine{vars: make(map[string]interface{})}, nil
+	}, engine.EngineMetadata{FileExtensions: []string{".echo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func TestSpellBridgeRun(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "summarize"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "summarize", "main.echo"), []byte("summary"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var prepared []string
+	spell := NewSpellBridge(SpellOptions{
+		Dir:     dir,
+		Engines: newEchoRegistry(t),
+		Prepare: func(eng engine.Engine, name string, child *SpellBridge) error {
+			prepared = append(prepared, fmt.Sprintf("%s@%d", name, child.Depth()))
+			return nil
+		},
+	})
+
+	result, err := spell.Run(context.Background(), "summarize", map[string]interface{}{"n": 3}, SpellRunOptions{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result != "summary map[n:3]" {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if len(prepared) != 1 || prepared[0] != "summarize@2" {
+		t.Errorf("Expected the sub-spell to be prepared one level deeper, got %v", prepared)
+	}
+
+	if _, err := spell.Run(context.Background(), "missing", nil, SpellRunOptions{}); err == nil {
+		t.Error("Expected an error for a missing spell")
+	}
+	if _, err := spell.Eval(context.Background(), "x", "python", nil, SpellRunOptions{}); err == nil {
+		t.Error("Expected an error for an unknown engine")
+	}
+}
+
+func TestSpellBridgeStateAndTrace(t *testing.T) {
+	var child *SpellBridge
+	spell := NewSpellBridge(SpellOptions{
+		Engines: newEchoRegistry(t),
+		Prepare: func(eng engine.Engine, name string, c *SpellBridge) error {
+			child = c
+			return nil
+		},
+	})
+	spell.State().Set("topic", "go")
+	ctx := context.Background()
+
+	if _, err := spell.Eval(ctx, "hi", "echo", nil, SpellRunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := child.State().Get("topic"); value != "go" {
+		t.Errorf("Expected the sub-spell to share state, got %v", value)
+	}
+	if child.Trace().TraceID != spell.Trace().TraceID || child.Trace().ParentSpanID != spell.Trace().SpanID {
+		t.Errorf("Expected the sub-spell to run in a child span, got %+v under %+v", child.Trace(), spell.Trace())
+	}
+
+	if _, err := spell.Eval(ctx, "hi", "echo", nil, SpellRunOptions{State: StateInheritance{Isolated: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := child.State().Get("topic"); ok {
+		t.Error("Expected isolated state to be empty")
+	}
+
+	// A grandchild can attach to the top-level state by ID
+	middle := child
+	if _, err := middle.Eval(ctx, "hi", "echo", nil, SpellRunOptions{StateID: spell.State().ID()}); err == nil {
+		t.Error("Expected an isolated sub-spell not to reach the top-level state")
+	}
+	if _, err := spell.Eval(ctx, "hi", "echo", nil, SpellRunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := child.Eval(ctx, "hi", "echo", nil, SpellRunOptions{StateID: spell.State().ID(), State: StateInheritance{ReadOnly: true}}); err != nil {
+		t.Fatal(err)
+	}
+	child.State().Set("topic", "rust")
+	if value, _ := spell.State().Get("topic"); value != "go" {
+		t.Errorf("Expected a read-only grandchild to leave the top-level state alone, got %v", value)
+	}
+}
+
+func TestSpellBridgeDepthLimit(t *testing.T) {
+	var deepest *SpellBridge
+	spell := NewSpellBridge(SpellOptions{
+		MaxDepth: 3,
+		Engines:  newEchoRegistry(t),
+		Prepare: func(eng engine.Engine, name string, child *SpellBridge) error {
+			deepest = child
+			return nil
+		},
+	})
+	if spell.Depth() != 1 || spell.MaxDepth() != 3 {
+		t.Fatalf("Expected depth 1 of 3, got %d of %d", spell.Depth(), spell.MaxDepth())
+	}
+
+	// Each eval hands the next level its own bridge
+	current := spell
+	for depth := 2; depth <= 3; depth++ {
+		result, err := current.Eval(context.Background(), "hi", "echo", nil, SpellRunOptions{})
+		if err != nil {
+			t.Fatalf("Eval at depth %d failed: %v", depth, err)
+		}
+		if result != "hi map[]" {
+			t.Errorf("Unexpected result %v", result)
+		}
+		if deepest.Depth() != depth {
+			t.Fatalf("Expected depth %d, got %d", depth, deepest.Depth())
+		}
+		current = deepest
+	}
+
+	_, err := current.Eval(context.Background(), "hi", "echo", nil, SpellRunOptions{})
+	if !errors.Is(err, ErrSpellDepth) {
+		t.Errorf("Expected ErrSpellDepth, got %v", err)
+	}
+}
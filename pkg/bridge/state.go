@@ -0,0 +1,242 @@
+// ABOUTME: Key/value state a spell shares with the sub-spells it runs
+// ABOUTME: Inheritance settings decide which keys a sub-spell sees and whether its writes reach the parent
+
+package bridge
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+// StateInheritance decides what a sub-spell's state shares with its parent
+type StateInheritance struct {
+	// Isolated gives the sub-spell fresh state that shares nothing
+	Isolated bool
+
+	// Keys limits the parent keys the sub-spell sees to those matching
+	// these patterns, where * matches any run of characters; empty means
+	// every key
+	Keys []string
+
+	// ReadOnly keeps the sub-spell's writes to itself instead of updating
+	// the parent's state
+	ReadOnly bool
+}
+
+// SharedState is key/value state for one spell. A sub-spell's state is a
+// layer over its parent's: it reads the parent's keys and, unless read
+// only, writes them back, so parent and sub-spells can coordinate. Values
+// are plain Go values, as converted from scripts.
+type SharedState struct {
+	id      string
+	parent  *SharedState
+	inherit StateInheritance
+
+	mu      sync.RWMutex
+	values  map[string]interface{}
+	history *stateHistory
+	schema  *StateSchema
+
+	// quota limits values, whose sizes and use usage tracks
+	quota  *security.StateQuota
+	usage  map[string]*keyUsage
+	counts quotaCounts
+	now    func() time.Time
+
+	// locks and the sequence numbers of changes are shared by every spell
+	// that shares this state
+	locks *stateLocks
+	seq   *atomic.Uint64
+}
+
+// NewSharedState creates empty state for a top-level spell
+func NewSharedState() *SharedState {
+	return &SharedState{
+		id:      NewCorrelationID(),
+		values:  make(map[string]interface{}),
+		history: newStateHistory(),
+		usage:   make(map[string]*keyUsage),
+		now:     time.Now,
+		locks:   newStateLocks(),
+		seq:     new(atomic.Uint64),
+	}
+}
+
+// ID identifies the state, so a sub-spell can attach to it by ID
+func (s *SharedState) ID() string {
+	return s.id
+}
+
+// Child creates the state for a sub-spell, under the same quota
+func (s *SharedState) Child(inherit StateInheritance) *SharedState {
+	child := NewSharedState()
+	s.mu.RLock()
+	child.quota, child.now = s.quota, s.now
+	s.mu.RUnlock()
+	if !inherit.Isolated {
+		child.parent = s
+		child.inherit = inherit
+		child.locks = s.locks
+		child.seq = s.seq
+	}
+	return child
+}
+
+// Find returns the state with the given ID among s and its ancestors
+func (s *SharedState) Find(id string) (*SharedState, bool) {
+	for state := s; state != nil; state = state.parent {
+		if state.id == id {
+			return state, true
+		}
+	}
+	return nil, false
+}
+
+// Get returns the value of key
+func (s *SharedState) Get(key string) (interface{}, bool) {
+	s.mu.RLock()
+	now := s.now()
+	value, ok := s.values[key]
+	if ok && s.expired(key, now) {
+		value, ok = nil, false
+	}
+	if ok {
+		s.touch(key, now)
+	}
+	s.mu.RUnlock()
+	if ok {
+		return value, true
+	}
+	if s.inherits(key) {
+		return s.parent.Get(key)
+	}
+	return nil, false
+}
+
+// Set stores value under key. It fails, changing nothing, when a strict
+// schema of this state or of one the write goes through rejects the value.
+func (s *SharedState) Set(key string, value interface{}) error {
+	return s.change(StateEvent{Op: StateSet, Key: key, Value: value, Source: s.id})
+}
+
+// SetValues sets each of values, in key order. Keys a strict schema
+// rejects keep their values and fail the call, but the others are set.
+func (s *SharedState) SetValues(values map[string]interface{}) error {
+	var errs []error
+	for _, key := range sortedKeys(values) {
+		if err := s.Set(key, values[key]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Delete removes key, unless a strict schema requires it
+func (s *SharedState) Delete(key string) error {
+	return s.change(StateEvent{Op: StateDelete, Key: key, Source: s.id})
+}
+
+// change makes a change in the state it lands in, and records it there
+func (s *SharedState) change(event StateEvent) error {
+	if s.writesThrough(event.Key) {
+		s.mu.RLock()
+		err := s.checkChange(event)
+		s.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+		return s.parent.change(event)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkChange(event); err != nil {
+		return err
+	}
+	if err := s.makeRoom(event); err != nil {
+		return err
+	}
+	event.Seq = s.seq.Add(1)
+	event.Time = s.now()
+	applyEvent(s.values, event)
+	s.track(event)
+	s.history.record(event)
+	return nil
+}
+
+// Keys lists the keys visible to this spell, sorted
+func (s *SharedState) Keys() []string {
+	seen := make(map[string]bool)
+	if s.parent != nil {
+		for _, key := range s.parent.Keys() {
+			if s.inherits(key) {
+				seen[key] = true
+			}
+		}
+	}
+
+	s.mu.RLock()
+	now := s.now()
+	for key := range s.values {
+		if !s.expired(key, now) {
+			seen[key] = true
+		}
+	}
+	s.mu.RUnlock()
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Values returns the values of the keys visible to this spell
+func (s *SharedState) Values() map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, key := range s.Keys() {
+		if value, ok := s.Get(key); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// sortedKeys returns the keys of values, sorted
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// inherits reports whether key is read from the parent
+func (s *SharedState) inherits(key string) bool {
+	if s.parent == nil {
+		return false
+	}
+	if len(s.inherit.Keys) == 0 {
+		return true
+	}
+	for _, pattern := range s.inherit.Keys {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writesThrough reports whether writes to key go to the parent
+func (s *SharedState) writesThrough(key string) bool {
+	return !s.inherit.ReadOnly && s.inherits(key)
+}
@@ -0,0 +1,75 @@
+// ABOUTME: Named state channels that spells in the same process attach to, to share state outside their own run tree
+// ABOUTME: The security profile decides which channel names spells may attach to
+
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+// ErrChannelDenied is returned when the security profile does not allow
+// attaching to a channel
+var ErrChannelDenied = errors.New("state channel not allowed")
+
+// StateChannels are the named states of one process. Spells that cannot
+// share state otherwise, such as sub-spells with isolated state or ones in
+// another engine, see each other's writes by attaching to the same channel.
+type StateChannels struct {
+	policy security.ChannelPolicy
+	quota  *security.StateQuota
+
+	mu       sync.Mutex
+	channels map[string]*SharedState
+}
+
+// NewStateChannels creates the channels of a process. policy decides
+// which names may be attached to, and each channel's state is limited to
+// quota, when set.
+func NewStateChannels(policy security.ChannelPolicy, quota *security.StateQuota) *StateChannels {
+	return &StateChannels{policy: policy, quota: quota, channels: make(map[string]*SharedState)}
+}
+
+// Attach returns a spell's view of the channel name, creating the channel
+// on first use. Writes through the view reach everyone attached, unless
+// inherit makes it read only; locks taken through it are the spell's own.
+func (c *StateChannels) Attach(name string, inherit StateInheritance) (*SharedState, error) {
+	if name == "" {
+		return nil, fmt.Errorf("state channel name is required")
+	}
+	if !c.policy.Allows(name) {
+		return nil, fmt.Errorf("%w: %q is not allowed by the security policy", ErrChannelDenied, name)
+	}
+	if inherit.Isolated {
+		return nil, fmt.Errorf("an isolated view of channel %q would share nothing", name)
+	}
+
+	c.mu.Lock()
+	channel, ok := c.channels[name]
+	if !ok {
+		channel = NewSharedState()
+		if c.quota != nil {
+			channel.SetQuota(*c.quota)
+		}
+		c.channels[name] = channel
+	}
+	c.mu.Unlock()
+	return channel.Child(inherit), nil
+}
+
+// Names lists the channels attached to so far, sorted
+func (c *StateChannels) Names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.channels))
+	for name := range c.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
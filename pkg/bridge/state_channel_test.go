@@ -0,0 +1,92 @@
+// ABOUTME: Tests for named state channels
+// ABOUTME: Validates sharing between unrelated spells, read-only views, locks, quotas, and the channel policy
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+func TestStateChannels(t *testing.T) {
+	t.Run("spells attached to a channel see each other's writes", func(t *testing.T) {
+		channels := NewStateChannels(security.ChannelPolicy{}, nil)
+		writer, err := channels.Attach("jobs", StateInheritance{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, _ := channels.Attach("jobs", StateInheritance{})
+		other, _ := channels.Attach("other", StateInheritance{})
+
+		if err := writer.Set("next", 7); err != nil {
+			t.Fatal(err)
+		}
+		if value, ok := reader.Get("next"); !ok || value != 7 {
+			t.Errorf("Get() through another view = %v, %v", value, ok)
+		}
+		if _, ok := other.Get("next"); ok {
+			t.Error("Expected channels to be separate")
+		}
+		if events := reader.History(EventFilter{}); len(events) != 1 || events[0].Source != writer.ID() {
+			t.Errorf("Expected the writer as the source of the change, got %+v", events)
+		}
+		if got := channels.Names(); !reflect.DeepEqual(got, []string{"jobs", "other"}) {
+			t.Errorf("Names() = %v", got)
+		}
+	})
+
+	t.Run("read-only views keep their writes", func(t *testing.T) {
+		channels := NewStateChannels(security.ChannelPolicy{}, nil)
+		shared, _ := channels.Attach("jobs", StateInheritance{})
+		scratch, _ := channels.Attach("jobs", StateInheritance{ReadOnly: true})
+		_ = shared.Set("status", "open")
+		_ = scratch.Set("status", "draft")
+
+		if value, _ := shared.Get("status"); value != "open" {
+			t.Errorf("Expected the read-only write to stay local, got %v", value)
+		}
+		if value, _ := scratch.Get("status"); value != "draft" {
+			t.Errorf("Get() through the read-only view = %v", value)
+		}
+		if _, err := channels.Attach("jobs", StateInheritance{Isolated: true}); err == nil {
+			t.Error("Expected an isolated view to be refused")
+		}
+	})
+
+	t.Run("locks are held by each view", func(t *testing.T) {
+		channels := NewStateChannels(security.ChannelPolicy{}, nil)
+		first, _ := channels.Attach("jobs", StateInheritance{})
+		second, _ := channels.Attach("jobs", StateInheritance{})
+		if _, err := first.Lock(context.Background(), "queue", LockOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := second.Lock(context.Background(), "queue", LockOptions{Wait: -1}); !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Lock() held through another view = %v, want ErrLockTimeout", err)
+		}
+		if info, _ := second.LockHolder("queue"); info.Owner != first.ID() {
+			t.Errorf("Expected the first view to hold the lock, got %q", info.Owner)
+		}
+	})
+
+	t.Run("the policy and quota apply", func(t *testing.T) {
+		channels := NewStateChannels(security.ChannelPolicy{Allow: []string{"team.*"}}, &security.StateQuota{MaxKeys: 1})
+		if _, err := channels.Attach("private", StateInheritance{}); !errors.Is(err, ErrChannelDenied) {
+			t.Errorf("Attach() of a denied channel = %v", err)
+		}
+		if _, err := channels.Attach("", StateInheritance{}); err == nil {
+			t.Error("Expected an unnamed channel to be refused")
+		}
+		view, err := channels.Attach("team.jobs", StateInheritance{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = view.Set("a", 1)
+		if err := view.Set("b", 2); !errors.Is(err, ErrStateQuota) {
+			t.Errorf("Expected the channel to have the quota, got %v", err)
+		}
+	})
+}
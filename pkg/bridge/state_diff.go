@@ -0,0 +1,192 @@
+// ABOUTME: Structural diffs between two sets of state values, such as a saved version and now
+// ABOUTME: Reports added, removed, and modified keys, optionally down to the fields that changed
+
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Kinds of FieldChange
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// StateDiff is how one set of state values differs from another
+type StateDiff struct {
+	// Added and Removed hold the keys only the newer or older values have
+	Added   map[string]interface{} `json:"added"`
+	Removed map[string]interface{} `json:"removed"`
+
+	// Modified holds the keys whose values differ
+	Modified map[string]ValueChange `json:"modified"`
+}
+
+// ValueChange is a key whose value differs
+type ValueChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+
+	// Changes lists the fields that differ within the value, for a deep
+	// diff of tables; a value that changed type is one change at its root
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// FieldChange is a field added, removed, or modified within a value. Path
+// leads to it from the key, as in "items[2].name"; the root is "".
+type FieldChange struct {
+	Path string      `json:"path"`
+	Kind string      `json:"kind"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Changed reports whether the values differ at all
+func (d StateDiff) Changed() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Modified) > 0
+}
+
+// ToMap returns the diff as plain values for scripts: added, removed, and
+// modified tables, with changed saying whether there is any difference
+func (d StateDiff) ToMap() map[string]interface{} {
+	modified := make(map[string]interface{}, len(d.Modified))
+	for key, change := range d.Modified {
+		entry := map[string]interface{}{"old": change.Old, "new": change.New}
+		if change.Changes != nil {
+			changes := make([]interface{}, len(change.Changes))
+			for i, c := range change.Changes {
+				field := map[string]interface{}{"path": c.Path, "kind": c.Kind}
+				if c.Old != nil {
+					field["old"] = c.Old
+				}
+				if c.New != nil {
+					field["new"] = c.New
+				}
+				changes[i] = field
+			}
+			entry["changes"] = changes
+		}
+		modified[key] = entry
+	}
+	return map[string]interface{}{
+		"added":    d.Added,
+		"removed":  d.Removed,
+		"modified": modified,
+		"changed":  d.Changed(),
+	}
+}
+
+// DiffStates compares two sets of state values. Values compare as they
+// would after being saved, so 3 and 3.0 are equal. With deep, each
+// modified value also lists the fields within it that changed.
+func DiffStates(from, to map[string]interface{}, deep bool) StateDiff {
+	diff := StateDiff{
+		Added:    make(map[string]interface{}),
+		Removed:  make(map[string]interface{}),
+		Modified: make(map[string]ValueChange),
+	}
+	for key, old := range from {
+		value, ok := to[key]
+		if !ok {
+			diff.Removed[key] = old
+			continue
+		}
+		old, value = normalizeValue(old), normalizeValue(value)
+		if reflect.DeepEqual(old, value) {
+			continue
+		}
+		change := ValueChange{Old: old, New: value}
+		if deep {
+			change.Changes = diffValues("", old, value, nil)
+		}
+		diff.Modified[key] = change
+	}
+	for key, value := range to {
+		if _, ok := from[key]; !ok {
+			diff.Added[key] = value
+		}
+	}
+	return diff
+}
+
+// diffValues appends the fields that differ between old and value, both
+// normalized, to changes
+func diffValues(path string, old, value interface{}, changes []FieldChange) []FieldChange {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(o)+len(v))
+		for key := range o {
+			keys = append(keys, key)
+		}
+		for key := range v {
+			if _, ok := o[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			field := key
+			if path != "" {
+				field = path + "." + key
+			}
+			changes = diffField(field, o, v, key, changes)
+		}
+		return changes
+	case []interface{}:
+		v, ok := value.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(o) || i < len(v); i++ {
+			field := fmt.Sprintf("%s[%d]", path, i+1)
+			switch {
+			case i >= len(v):
+				changes = append(changes, FieldChange{Path: field, Kind: ChangeRemoved, Old: o[i]})
+			case i >= len(o):
+				changes = append(changes, FieldChange{Path: field, Kind: ChangeAdded, New: v[i]})
+			case !reflect.DeepEqual(o[i], v[i]):
+				changes = diffValues(field, o[i], v[i], changes)
+			}
+		}
+		return changes
+	}
+	return append(changes, FieldChange{Path: path, Kind: ChangeModified, Old: old, New: value})
+}
+
+// diffField appends the change to key between two tables, if any
+func diffField(path string, old, value map[string]interface{}, key string, changes []FieldChange) []FieldChange {
+	o, inOld := old[key]
+	v, inNew := value[key]
+	switch {
+	case !inNew:
+		return append(changes, FieldChange{Path: path, Kind: ChangeRemoved, Old: o})
+	case !inOld:
+		return append(changes, FieldChange{Path: path, Kind: ChangeAdded, New: v})
+	case reflect.DeepEqual(o, v):
+		return changes
+	}
+	return diffValues(path, o, v, changes)
+}
+
+// normalizeValue returns value as it reads back after being saved as JSON,
+// or value itself if it cannot be
+func normalizeValue(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
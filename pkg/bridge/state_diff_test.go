@@ -0,0 +1,73 @@
+// ABOUTME: Tests for diffing sets of state values
+// ABOUTME: Validates added, removed, and modified keys and the field paths of deep diffs
+
+package bridge
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffStates(t *testing.T) {
+	from := map[string]interface{}{
+		"topic":  "tides",
+		"count":  3,
+		"gone":   true,
+		"report": map[string]interface{}{"title": "Draft", "tags": []interface{}{"sea", "moon"}, "notes": "x"},
+	}
+	to := map[string]interface{}{
+		"topic":  "tides",
+		"count":  float64(3),
+		"new":    "value",
+		"report": map[string]interface{}{"title": "Final", "tags": []interface{}{"sea"}, "pages": float64(4)},
+	}
+
+	diff := DiffStates(from, to, false)
+	if !diff.Changed() {
+		t.Fatal("Expected the states to differ")
+	}
+	if !reflect.DeepEqual(diff.Added, map[string]interface{}{"new": "value"}) {
+		t.Errorf("Added = %v", diff.Added)
+	}
+	if !reflect.DeepEqual(diff.Removed, map[string]interface{}{"gone": true}) {
+		t.Errorf("Removed = %v", diff.Removed)
+	}
+	if _, ok := diff.Modified["count"]; ok {
+		t.Error("3 and 3.0 should compare equal, as they do once saved")
+	}
+	if len(diff.Modified) != 1 || diff.Modified["report"].Changes != nil {
+		t.Errorf("Modified = %+v, want only report without field changes", diff.Modified)
+	}
+
+	deep := DiffStates(from, to, true)
+	want := []FieldChange{
+		{Path: "notes", Kind: ChangeRemoved, Old: "x"},
+		{Path: "pages", Kind: ChangeAdded, New: float64(4)},
+		{Path: "tags[2]", Kind: ChangeRemoved, Old: "moon"},
+		{Path: "title", Kind: ChangeModified, Old: "Draft", New: "Final"},
+	}
+	if got := deep.Modified["report"].Changes; !reflect.DeepEqual(got, want) {
+		t.Errorf("Changes = %+v, want %+v", got, want)
+	}
+
+	retyped := DiffStates(map[string]interface{}{"k": "text"}, map[string]interface{}{"k": []interface{}{"text"}}, true)
+	if changes := retyped.Modified["k"].Changes; len(changes) != 1 || changes[0].Path != "" || changes[0].Kind != ChangeModified {
+		t.Errorf("A value that changed type should be one change at its root, got %+v", changes)
+	}
+
+	if DiffStates(from, from, true).Changed() {
+		t.Error("Expected no difference between equal states")
+	}
+}
+
+func TestStateDiffToMap(t *testing.T) {
+	m := DiffStates(map[string]interface{}{"a": map[string]interface{}{"x": 1}}, map[string]interface{}{"a": map[string]interface{}{"x": 2}}, true).ToMap()
+	if m["changed"] != true {
+		t.Errorf("changed = %v", m["changed"])
+	}
+	entry := m["modified"].(map[string]interface{})["a"].(map[string]interface{})
+	change := entry["changes"].([]interface{})[0].(map[string]interface{})
+	if change["path"] != "x" || change["kind"] != ChangeModified || change["old"] != float64(1) || change["new"] != float64(2) {
+		t.Errorf("change = %v", change)
+	}
+}
@@ -0,0 +1,264 @@
+// ABOUTME: Export and import of spell state as JSON, YAML, or msgpack documents
+// ABOUTME: Binary values travel base64-encoded in the text formats, so artifacts survive the round trip
+
+package bridge
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tinylib/msgp/msgp"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of exported state
+const (
+	StateFormatJSON    = "json"
+	StateFormatYAML    = "yaml"
+	StateFormatMsgpack = "msgpack"
+)
+
+// artifactKey marks a binary value in the text formats, as
+// {"$base64": "<data>"}
+const artifactKey = "$base64"
+
+// StateExport is a state as exported: its values, and where they came from
+// when they were saved state
+type StateExport struct {
+	Name          string
+	Version       int
+	SchemaVersion int
+	Exported      time.Time
+	Values        map[string]interface{}
+}
+
+// StateFormatForPath returns the format a file's extension names, or JSON
+func StateFormatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return StateFormatYAML
+	case ".msgpack", ".mpk":
+		return StateFormatMsgpack
+	}
+	return StateFormatJSON
+}
+
+// ExportState writes export to w in format
+func ExportState(w io.Writer, format string, export StateExport) error {
+	if export.Exported.IsZero() {
+		export.Exported = time.Now()
+	}
+	doc := map[string]interface{}{
+		"exported": export.Exported.UTC().Format(time.RFC3339Nano),
+		"values":   export.Values,
+	}
+	if doc["values"] == nil {
+		doc["values"] = map[string]interface{}{}
+	}
+	if export.Name != "" {
+		doc["name"] = export.Name
+	}
+	if export.Version != 0 {
+		doc["version"] = export.Version
+	}
+	if export.SchemaVersion != 0 {
+		doc["schema_version"] = export.SchemaVersion
+	}
+
+	var data []byte
+	var err error
+	switch format {
+	case StateFormatJSON, "":
+		data, err = json.MarshalIndent(encodeArtifacts(doc), "", "  ")
+		data = append(data, '\n')
+	case StateFormatYAML:
+		data, err = yaml.Marshal(encodeArtifacts(doc))
+	case StateFormatMsgpack:
+		data, err = msgp.AppendIntf(nil, doc)
+	default:
+		return unknownStateFormat(format)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot export state as %s: %w", format, err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ImportState reads an exported state from r. An empty format is worked
+// out from the data.
+func ImportState(r io.Reader, format string) (StateExport, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return StateExport{}, err
+	}
+	if format == "" {
+		format = sniffStateFormat(data)
+	}
+
+	var doc interface{}
+	switch format {
+	case StateFormatJSON:
+		err = json.Unmarshal(data, &doc)
+	case StateFormatYAML:
+		err = yaml.Unmarshal(data, &doc)
+	case StateFormatMsgpack:
+		var rest []byte
+		if doc, rest, err = msgp.ReadIntfBytes(data); err == nil && len(rest) > 0 {
+			err = fmt.Errorf("%d bytes after the document", len(rest))
+		}
+	default:
+		return StateExport{}, unknownStateFormat(format)
+	}
+	if err != nil {
+		return StateExport{}, fmt.Errorf("cannot import state as %s: %w", format, err)
+	}
+
+	fields, ok := importedValue(doc).(map[string]interface{})
+	if !ok {
+		return StateExport{}, fmt.Errorf("cannot import state as %s: the document is not a map", format)
+	}
+	values, ok := fields["values"].(map[string]interface{})
+	if !ok {
+		return StateExport{}, fmt.Errorf("cannot import state as %s: the document has no map of values", format)
+	}
+	export := StateExport{Values: values}
+	export.Name, _ = fields["name"].(string)
+	export.Version = importedInt(fields["version"])
+	export.SchemaVersion = importedInt(fields["schema_version"])
+	if exported, ok := fields["exported"].(string); ok {
+		export.Exported, _ = time.Parse(time.RFC3339Nano, exported)
+	}
+	return export, nil
+}
+
+// Export returns a version of the saved state name, the latest when
+// version is zero, for ExportState
+func (s *SavedStates) Export(name string, version int) (StateExport, error) {
+	file, err := s.read(name, version)
+	if err != nil {
+		return StateExport{}, err
+	}
+	return StateExport{
+		Name:          name,
+		Version:       file.Version,
+		SchemaVersion: file.SchemaVersion,
+		Values:        file.Values,
+	}, nil
+}
+
+// Import saves the values of an exported state as the next version of
+// name, or of the name it was exported under when name is empty, and
+// returns the name and version
+func (s *SavedStates) Import(name string, export StateExport) (string, int, error) {
+	if name == "" {
+		name = export.Name
+	}
+	if name == "" {
+		return "", 0, fmt.Errorf("the exported state has no name; give one to import it under")
+	}
+	version, err := s.persist(name, export.Values, export.SchemaVersion)
+	return name, version, err
+}
+
+// sniffStateFormat guesses the format of exported data: msgpack documents
+// start with a map header and JSON ones with a brace; anything else is
+// read as YAML
+func sniffStateFormat(data []byte) string {
+	if len(data) > 0 && (data[0]&0xf0 == 0x80 || data[0] == 0xde || data[0] == 0xdf) {
+		return StateFormatMsgpack
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return StateFormatJSON
+	}
+	return StateFormatYAML
+}
+
+func unknownStateFormat(format string) error {
+	return fmt.Errorf("unknown state format %q, use json, yaml, or msgpack", format)
+}
+
+// encodeArtifacts returns value with binary data, byte slices and strings
+// that are not UTF-8, replaced by base64 artifacts, which text formats can
+// carry
+func encodeArtifacts(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = encodeArtifacts(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = encodeArtifacts(item)
+		}
+		return out
+	case []byte:
+		return map[string]interface{}{artifactKey: base64.StdEncoding.EncodeToString(v)}
+	case string:
+		if !utf8.ValidString(v) {
+			return map[string]interface{}{artifactKey: base64.StdEncoding.EncodeToString([]byte(v))}
+		}
+	}
+	return value
+}
+
+// importedValue turns a decoded document into state values: artifacts and
+// binary data become strings, as scripts see them, numbers become float64
+// as they do after saving, and maps get string keys
+func importedValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if encoded, ok := v[artifactKey].(string); ok && len(v) == 1 {
+			if data, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+				return string(data)
+			}
+		}
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = importedValue(item)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[fmt.Sprint(key)] = importedValue(item)
+		}
+		return importedValue(out)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = importedValue(item)
+		}
+		return out
+	case []byte:
+		return string(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return value
+}
+
+// importedInt reads a whole number field of an imported document
+func importedInt(value interface{}) int {
+	if n, ok := value.(float64); ok && n == math.Trunc(n) {
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+// ABOUTME: Tests for exporting and importing spell state
+// ABOUTME: Validates round trips in each format, binary artifacts, format detection, and saved state handoff
+
+package bridge
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStateExport(t *testing.T) {
+	binary := string([]byte{0x89, 'P', 'N', 'G', 0xff, 0x00})
+	values := map[string]interface{}{
+		"topic":  "tides",
+		"count":  float64(3),
+		"tags":   []interface{}{"a", "b"},
+		"nested": map[string]interface{}{"ok": true, "none": nil},
+		"image":  binary,
+	}
+
+	for _, format := range []string{StateFormatJSON, StateFormatYAML, StateFormatMsgpack} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			export := StateExport{Name: "crawl", Version: 4, SchemaVersion: 2, Values: values}
+			if err := ExportState(&buf, format, export); err != nil {
+				t.Fatal(err)
+			}
+			if format != StateFormatMsgpack && !strings.Contains(buf.String(), artifactKey) {
+				t.Errorf("Expected binary values as base64 artifacts in %s:\n%s", format, buf.String())
+			}
+
+			imported, err := ImportState(bytes.NewReader(buf.Bytes()), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(imported.Values, values) {
+				t.Errorf("ImportState() values = %#v, want %#v", imported.Values, values)
+			}
+			if imported.Name != "crawl" || imported.Version != 4 || imported.SchemaVersion != 2 || imported.Exported.IsZero() {
+				t.Errorf("ImportState() = %+v", imported)
+			}
+		})
+	}
+
+	t.Run("bad input", func(t *testing.T) {
+		if err := ExportState(&bytes.Buffer{}, "xml", StateExport{}); err == nil {
+			t.Error("Expected an unknown format to be rejected")
+		}
+		if _, err := ImportState(strings.NewReader(`{"name": "x"}`), ""); err == nil {
+			t.Error("Expected a document without values to be rejected")
+		}
+		if _, err := ImportState(strings.NewReader(`- a list`), StateFormatYAML); err == nil {
+			t.Error("Expected a document that is not a map to be rejected")
+		}
+		if got := StateFormatForPath("backup.YML"); got != StateFormatYAML {
+			t.Errorf("StateFormatForPath() = %q", got)
+		}
+	})
+
+	t.Run("saved state hands off", func(t *testing.T) {
+		from := NewSavedStates(NewFileStateStore(t.TempDir()), SavedStatesOptions{})
+		to := NewSavedStates(NewFileStateStore(t.TempDir()), SavedStatesOptions{})
+		state := NewSharedState()
+		_ = state.SetSchema(StateSchema{Schema: map[string]interface{}{"type": "object"}, Version: 2})
+		_ = state.Set("topic", "tides")
+		_, _ = from.Persist("crawl", state)
+
+		export, err := from.Export("crawl", 0)
+		if err != nil || export.Version != 1 || export.SchemaVersion != 2 {
+			t.Fatalf("Export() = %+v, %v", export, err)
+		}
+		name, version, err := to.Import("", export)
+		if err != nil || name != "crawl" || version != 1 {
+			t.Fatalf("Import() = %s, %d, %v", name, version, err)
+		}
+		if _, _, err := to.Import("copy", export); err != nil {
+			t.Fatal(err)
+		}
+		if values, _, _ := to.Values("copy", 0); values["topic"] != "tides" {
+			t.Errorf("Expected the imported values saved, got %v", values)
+		}
+		if _, _, err := to.Import("", StateExport{Values: map[string]interface{}{}}); err == nil {
+			t.Error("Expected an import without a name to fail")
+		}
+	})
+}
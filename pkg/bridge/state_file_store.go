@@ -0,0 +1,134 @@
+// ABOUTME: StateStore keeping saved spell state as files, a directory of versions per state
+// ABOUTME: Versions are <n>.json, or <n>.json.gz when compressed, and are never overwritten
+
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FileStateStore keeps saved states under a directory, one directory per
+// state with a file per version
+type FileStateStore struct {
+	dir string
+}
+
+// NewFileStateStore creates a store under dir, which is created when the
+// first state is saved
+func NewFileStateStore(dir string) *FileStateStore {
+	return &FileStateStore{dir: dir}
+}
+
+// Names lists the states with at least one version
+func (f *FileStateStore) Names() ([]string, error) {
+	entries, err := os.ReadDir(f.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() || !stateName.MatchString(entry.Name()) {
+			continue
+		}
+		if versions, err := f.Versions(entry.Name()); err == nil && len(versions) > 0 {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// Versions lists the versions of a state, oldest first
+func (f *FileStateStore) Versions(name string) ([]int, error) {
+	entries, err := os.ReadDir(filepath.Join(f.dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var versions []int
+	for _, entry := range entries {
+		base := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".gz"), ".json")
+		if base == entry.Name() {
+			continue
+		}
+		if version, err := strconv.Atoi(base); err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// Read returns the data of a version
+func (f *FileStateStore) Read(name string, version int) ([]byte, error) {
+	data, err := os.ReadFile(f.path(name, version))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s version %d", ErrStateNotFound, name, version)
+	}
+	return data, err
+}
+
+// Create writes a new version through a temporary file, so a failed write
+// never leaves a partial version behind, and links it into place only if
+// no other process created the version first
+func (f *FileStateStore) Create(name string, version int, data []byte) error {
+	dir := filepath.Join(f.dir, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if _, err := os.Stat(f.path(name, version)); err == nil {
+		return fmt.Errorf("%w: %s version %d", ErrVersionExists, name, version)
+	}
+
+	path := filepath.Join(dir, strconv.Itoa(version)+".json")
+	if IsGzip(data) {
+		path += ".gz"
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%w: %s version %d", ErrVersionExists, name, version)
+		}
+		return err
+	}
+	return nil
+}
+
+// Remove deletes a version, and the state's directory with its last one
+func (f *FileStateStore) Remove(name string, version int) error {
+	if err := os.Remove(f.path(name, version)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// Only succeeds once the directory is empty
+	_ = os.Remove(filepath.Join(f.dir, name))
+	return nil
+}
+
+// path returns the file of a version, compressed or not
+func (f *FileStateStore) path(name string, version int) string {
+	path := filepath.Join(f.dir, name, strconv.Itoa(version)+".json")
+	if _, err := os.Stat(path); err != nil {
+		return path + ".gz"
+	}
+	return path
+}
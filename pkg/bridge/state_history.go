@@ -0,0 +1,259 @@
+// ABOUTME: History of the changes to shared state, for querying and replaying them
+// ABOUTME: Bounded per state with eviction into a base snapshot, so replay stays exact
+
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+)
+
+// DefaultStateHistory is how many changes each state keeps before the
+// oldest are folded into its snapshot
+const DefaultStateHistory = 1000
+
+// Kinds of StateEvent
+const (
+	StateSet    = "set"
+	StateDelete = "delete"
+)
+
+// ErrHistoryEvicted is returned when replaying to a point older than the
+// history kept
+var ErrHistoryEvicted = errors.New("state history no longer reaches that far")
+
+// StateEvent is a change to shared state. Seq orders the changes of every
+// spell sharing the state.
+type StateEvent struct {
+	Seq  uint64    `json:"seq"`
+	Op   string    `json:"op"`
+	Key  string    `json:"key"`
+	Time time.Time `json:"time"`
+
+	// Value is the value set; nil for a delete
+	Value interface{} `json:"value,omitempty"`
+
+	// Source is the ID of the state of the spell that made the change,
+	// which may be a sub-spell writing through to its caller
+	Source string `json:"source"`
+
+	// Reason is ReasonExpired or ReasonEvicted for a delete the state's
+	// quota made
+	Reason string `json:"reason,omitempty"`
+}
+
+// EventFilter selects events from the history
+type EventFilter struct {
+	// Keys are patterns the key must match, where * matches any run of
+	// characters; empty means every key
+	Keys []string
+
+	// Op limits events to StateSet or StateDelete; empty means both
+	Op string
+
+	// Since skips events up to and including this sequence number
+	Since uint64
+
+	// Limit keeps the most recent events that match; zero keeps all
+	Limit int
+}
+
+// matches reports whether event passes the filter
+func (f EventFilter) matches(event StateEvent) bool {
+	if event.Seq <= f.Since || (f.Op != "" && event.Op != f.Op) {
+		return false
+	}
+	if len(f.Keys) == 0 {
+		return true
+	}
+	for _, pattern := range f.Keys {
+		if ok, _ := path.Match(pattern, event.Key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stateHistory is the changes made to one state's own values
+type stateHistory struct {
+	limit  int
+	events []StateEvent
+
+	// base holds the values before the first event kept, and evicted the
+	// sequence number of the last event folded into it
+	base    map[string]interface{}
+	evicted uint64
+
+	// watchers are called with each event as it is recorded
+	watchers  map[uint64]func(StateEvent)
+	watcherID uint64
+}
+
+func newStateHistory() *stateHistory {
+	return &stateHistory{limit: DefaultStateHistory, base: make(map[string]interface{})}
+}
+
+// record appends event and passes it to the watchers
+func (h *stateHistory) record(event StateEvent) {
+	h.events = append(h.events, event)
+	h.trim()
+	for _, id := range h.watcherIDs() {
+		h.watchers[id](event)
+	}
+}
+
+// watcherIDs returns the IDs of the watchers in the order they were added
+func (h *stateHistory) watcherIDs() []uint64 {
+	ids := make([]uint64, 0, len(h.watchers))
+	for id := range h.watchers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// trim folds the oldest events into base past the limit
+func (h *stateHistory) trim() {
+	if h.limit <= 0 || len(h.events) <= h.limit {
+		return
+	}
+	drop := len(h.events) - h.limit
+	for _, old := range h.events[:drop] {
+		applyEvent(h.base, old)
+		h.evicted = old.Seq
+	}
+	h.events = append(h.events[:0:0], h.events[drop:]...)
+}
+
+// valuesAt returns the state's own values after the events up to seq
+func (h *stateHistory) valuesAt(seq uint64) (map[string]interface{}, error) {
+	if seq < h.evicted {
+		return nil, fmt.Errorf("%w: replaying to %d needs changes up to %d that were dropped", ErrHistoryEvicted, seq, h.evicted)
+	}
+	values := make(map[string]interface{}, len(h.base))
+	for key, value := range h.base {
+		values[key] = value
+	}
+	for _, event := range h.events {
+		if event.Seq > seq {
+			break
+		}
+		applyEvent(values, event)
+	}
+	return values, nil
+}
+
+// applyEvent makes the change event records to values
+func applyEvent(values map[string]interface{}, event StateEvent) {
+	if event.Op == StateDelete {
+		delete(values, event.Key)
+		return
+	}
+	values[event.Key] = event.Value
+}
+
+// SetHistoryLimit sets how many changes this state keeps; zero or less
+// keeps every change
+func (s *SharedState) SetHistoryLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history.limit = n
+	s.history.trim()
+}
+
+// Watch calls fn with each change recorded in this state, including those
+// its sub-spells write through to it, until the returned stop is called.
+// fn runs while the state is locked, so it must not use the state.
+func (s *SharedState) Watch(fn func(StateEvent)) (stop func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := s.history
+	if h.watchers == nil {
+		h.watchers = make(map[uint64]func(StateEvent))
+	}
+	h.watcherID++
+	id := h.watcherID
+	h.watchers[id] = fn
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(h.watchers, id)
+	}
+}
+
+// LastSeq returns the sequence number of the latest change to any state
+// shared with this one
+func (s *SharedState) LastSeq() uint64 {
+	return s.seq.Load()
+}
+
+// History returns the changes to the keys visible to this spell that pass
+// filter, oldest first. Changes a sub-spell kept to itself, as a read-only
+// one does, are not visible to its caller.
+func (s *SharedState) History(filter EventFilter) []StateEvent {
+	var events []StateEvent
+	for state := s; state != nil; state = state.parent {
+		state.mu.RLock()
+		for _, event := range state.history.events {
+			if filter.matches(event) && s.sees(state, event.Key) {
+				events = append(events, event)
+			}
+		}
+		state.mu.RUnlock()
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Seq < events[j].Seq })
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[len(events)-filter.Limit:]
+	}
+	return events
+}
+
+// Replay reconstructs the values this spell saw right after the change
+// numbered seq, the same way every time, from the history of this state
+// and the ones it inherits from
+func (s *SharedState) Replay(seq uint64) (map[string]interface{}, error) {
+	var values map[string]interface{}
+	if s.parent != nil {
+		inherited, err := s.parent.Replay(seq)
+		if err != nil {
+			return nil, err
+		}
+		values = make(map[string]interface{}, len(inherited))
+		for key, value := range inherited {
+			if s.inherits(key) {
+				values[key] = value
+			}
+		}
+	}
+
+	s.mu.RLock()
+	own, err := s.history.valuesAt(seq)
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		return own, nil
+	}
+	for key, value := range own {
+		values[key] = value
+	}
+	return values, nil
+}
+
+// sees reports whether this spell sees key in ancestor, itself or one of
+// the states it inherits from
+func (s *SharedState) sees(ancestor *SharedState, key string) bool {
+	for state := s; state != ancestor; state = state.parent {
+		if !state.inherits(key) {
+			return false
+		}
+	}
+	return true
+}
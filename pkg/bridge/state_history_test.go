@@ -0,0 +1,130 @@
+// ABOUTME: Tests for the history of changes to shared state
+// ABOUTME: Validates filters, what sub-spells see, eviction, replaying to past points, and watching changes
+
+package bridge
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStateHistory(t *testing.T) {
+	t.Run("filters select by key pattern, kind, and sequence", func(t *testing.T) {
+		state := NewSharedState()
+		state.Set("task.1", "open")
+		state.Set("note", "x")
+		state.Set("task.2", "open")
+		state.Delete("task.1")
+
+		events := state.History(EventFilter{Keys: []string{"task.*"}})
+		if len(events) != 3 || events[0].Key != "task.1" || events[2].Op != StateDelete {
+			t.Fatalf("History(task.*) = %+v", events)
+		}
+		if events[0].Source != state.ID() || events[0].Time.IsZero() {
+			t.Errorf("Expected events to record their source and time, got %+v", events[0])
+		}
+		if got := state.History(EventFilter{Op: StateDelete}); len(got) != 1 || got[0].Key != "task.1" {
+			t.Errorf("History(deletes) = %+v", got)
+		}
+		if got := state.History(EventFilter{Since: 2, Limit: 1}); len(got) != 1 || got[0].Seq != 4 {
+			t.Errorf("History(since 2, limit 1) = %+v, want the latest event", got)
+		}
+		if state.LastSeq() != 4 {
+			t.Errorf("LastSeq() = %d, want 4", state.LastSeq())
+		}
+	})
+
+	t.Run("sub-spells see the changes they share", func(t *testing.T) {
+		parent := NewSharedState()
+		parent.Set("public.topic", "go")
+		parent.Set("secret", "token")
+		worker := parent.Child(StateInheritance{})
+		worker.Set("public.result", "done")
+		private := parent.Child(StateInheritance{Keys: []string{"public.*"}, ReadOnly: true})
+		private.Set("public.topic", "rust")
+
+		events := parent.History(EventFilter{})
+		if len(events) != 3 || events[2].Key != "public.result" || events[2].Source != worker.ID() {
+			t.Errorf("Expected the parent to see the worker's write but not the read-only child's, got %+v", events)
+		}
+		keys := []string{}
+		for _, event := range private.History(EventFilter{}) {
+			keys = append(keys, event.Key)
+		}
+		if !reflect.DeepEqual(keys, []string{"public.topic", "public.result", "public.topic"}) {
+			t.Errorf("Read-only child history keys = %v", keys)
+		}
+	})
+
+	t.Run("replay reconstructs past values", func(t *testing.T) {
+		parent := NewSharedState()
+		parent.Set("count", float64(1))
+		parent.Set("topic", "go")
+		child := parent.Child(StateInheritance{ReadOnly: true})
+		child.Set("count", float64(2))
+		parent.Delete("topic")
+
+		for seq, want := range map[uint64]map[string]interface{}{
+			0: {},
+			1: {"count": float64(1)},
+			3: {"count": float64(2), "topic": "go"},
+			4: {"count": float64(2)},
+		} {
+			got, err := child.Replay(seq)
+			if err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("Replay(%d) = %v, %v, want %v", seq, got, err, want)
+			}
+		}
+		if got, _ := parent.Replay(parent.LastSeq()); !reflect.DeepEqual(got, parent.Values()) {
+			t.Errorf("Replay(last) = %v, want the current values %v", got, parent.Values())
+		}
+	})
+
+	t.Run("eviction keeps replay exact", func(t *testing.T) {
+		state := NewSharedState()
+		state.SetHistoryLimit(3)
+		for i := 1; i <= 6; i++ {
+			state.Set("step", float64(i))
+			state.Set("last", float64(i))
+		}
+
+		if events := state.History(EventFilter{}); len(events) != 3 || events[0].Seq != 10 {
+			t.Fatalf("Expected the last 3 events to be kept, got %+v", events)
+		}
+		got, err := state.Replay(10)
+		want := map[string]interface{}{"step": float64(5), "last": float64(5)}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Replay(10) = %v, %v, want %v", got, err, want)
+		}
+		if _, err := state.Replay(4); !errors.Is(err, ErrHistoryEvicted) {
+			t.Errorf("Replay() past the history error = %v, want ErrHistoryEvicted", err)
+		}
+	})
+
+	t.Run("watchers see changes as they are made", func(t *testing.T) {
+		state := NewSharedState()
+		var seen []StateEvent
+		stop := state.Watch(func(event StateEvent) { seen = append(seen, event) })
+
+		state.Set("a", 1)
+		worker := state.Child(StateInheritance{})
+		worker.Set("b", 2)
+		scratch := state.Child(StateInheritance{ReadOnly: true})
+		scratch.Set("c", 3)
+		state.Delete("a")
+		stop()
+		state.Set("d", 4)
+
+		var keys []string
+		for _, event := range seen {
+			keys = append(keys, event.Op+" "+event.Key)
+		}
+		if want := []string{"set a", "set b", "delete a"}; !reflect.DeepEqual(keys, want) {
+			t.Errorf("Watched %v, want %v", keys, want)
+		}
+		if seen[1].Source != worker.ID() {
+			t.Errorf("Expected the sub-spell as the source, got %q", seen[1].Source)
+		}
+	})
+}
@@ -0,0 +1,210 @@
+// ABOUTME: Advisory locks on shared state keys, so a spell and its sub-spells can take turns
+// ABOUTME: Locks carry owner tokens and optional expiry; waits time out and deadlocks fail fast
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultLockWait is how long Lock waits for another spell's lock without
+// LockOptions.Wait
+const DefaultLockWait = 30 * time.Second
+
+// Lock errors
+var (
+	// ErrLockTimeout is returned when a lock stays held for longer than the
+	// caller would wait
+	ErrLockTimeout = errors.New("timed out waiting for state lock")
+
+	// ErrDeadlock is returned instead of waiting for a lock whose holder is
+	// waiting, directly or through others, for a lock the caller holds
+	ErrDeadlock = errors.New("state lock would deadlock")
+
+	// ErrNotLockHolder is returned when unlocking with a token that does not
+	// hold the lock, as after the lock expired
+	ErrNotLockHolder = errors.New("state lock is not held with this token")
+)
+
+// LockOptions adjust a single Lock
+type LockOptions struct {
+	// Wait is how long to wait for another spell to unlock; zero means
+	// DefaultLockWait, and a negative value fails at once
+	Wait time.Duration
+
+	// TTL releases the lock on its own after this long, in case its holder
+	// never unlocks; zero holds it until unlocked or the spell ends
+	TTL time.Duration
+}
+
+// LockInfo describes a held lock
+type LockInfo struct {
+	// Owner is the ID of the state of the spell holding the lock
+	Owner   string
+	Expires time.Time
+}
+
+// stateLocks are the locks of the spells sharing a state: a spell, its
+// sub-spells, and theirs
+type stateLocks struct {
+	mu    sync.Mutex
+	held  map[string]*stateLock
+	waits map[string]string // owner -> key it waits for
+}
+
+// stateLock is a held lock; released closes when it is unlocked or expires
+type stateLock struct {
+	owner    string
+	token    string
+	expires  time.Time
+	released chan struct{}
+}
+
+func newStateLocks() *stateLocks {
+	return &stateLocks{held: make(map[string]*stateLock), waits: make(map[string]string)}
+}
+
+// Lock takes the advisory lock on key for this spell and returns the token
+// to unlock it with. Locks only coordinate spells that lock the same key;
+// they do not stop anyone from reading or writing it. A spell cannot take
+// a lock it already holds.
+func (s *SharedState) Lock(ctx context.Context, key string, opts LockOptions) (string, error) {
+	wait := opts.Wait
+	if wait == 0 {
+		wait = DefaultLockWait
+	}
+	deadline := time.Now().Add(wait)
+	locks := s.locks
+
+	for {
+		locks.mu.Lock()
+		lock := locks.current(key)
+		if lock == nil {
+			lock = &stateLock{owner: s.id, token: NewCorrelationID(), released: make(chan struct{})}
+			if opts.TTL > 0 {
+				lock.expires = time.Now().Add(opts.TTL)
+			}
+			locks.held[key] = lock
+			locks.mu.Unlock()
+			return lock.token, nil
+		}
+		if lock.owner == s.id {
+			locks.mu.Unlock()
+			return "", fmt.Errorf("%w: this spell already holds %q", ErrDeadlock, key)
+		}
+		if cycle := locks.waitsOn(lock.owner, s.id); cycle {
+			locks.mu.Unlock()
+			return "", fmt.Errorf("%w: the spell holding %q is waiting for a lock this spell holds", ErrDeadlock, key)
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			locks.mu.Unlock()
+			return "", fmt.Errorf("%w %q", ErrLockTimeout, key)
+		}
+		locks.waits[s.id] = key
+		locks.mu.Unlock()
+
+		// Wake when the lock is released or expires, or the wait is over
+		if !lock.expires.IsZero() {
+			if until := time.Until(lock.expires); until < remaining {
+				remaining = until
+			}
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-lock.released:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+
+		locks.mu.Lock()
+		delete(locks.waits, s.id)
+		locks.mu.Unlock()
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+}
+
+// Unlock releases the lock on key that token holds
+func (s *SharedState) Unlock(key, token string) error {
+	locks := s.locks
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+
+	lock := locks.current(key)
+	if lock == nil || lock.token != token {
+		return fmt.Errorf("%w: %q", ErrNotLockHolder, key)
+	}
+	locks.release(key, lock)
+	return nil
+}
+
+// LockHolder describes the lock on key, if it is held
+func (s *SharedState) LockHolder(key string) (LockInfo, bool) {
+	locks := s.locks
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+
+	lock := locks.current(key)
+	if lock == nil {
+		return LockInfo{}, false
+	}
+	return LockInfo{Owner: lock.owner, Expires: lock.expires}, true
+}
+
+// ReleaseLocks releases the locks this spell still holds, as when it ends
+func (s *SharedState) ReleaseLocks() {
+	locks := s.locks
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+
+	for key, lock := range locks.held {
+		if lock.owner == s.id {
+			locks.release(key, lock)
+		}
+	}
+}
+
+// current returns the unexpired lock on key, releasing an expired one
+func (l *stateLocks) current(key string) *stateLock {
+	lock := l.held[key]
+	if lock != nil && !lock.expires.IsZero() && !time.Now().Before(lock.expires) {
+		l.release(key, lock)
+		return nil
+	}
+	return lock
+}
+
+// release removes a lock and wakes the spells waiting for it
+func (l *stateLocks) release(key string, lock *stateLock) {
+	delete(l.held, key)
+	close(lock.released)
+}
+
+// waitsOn reports whether owner waits, directly or through the holders of
+// the locks it waits for, on a lock target holds
+func (l *stateLocks) waitsOn(owner, target string) bool {
+	seen := make(map[string]bool)
+	for owner != "" && !seen[owner] {
+		seen[owner] = true
+		key, waiting := l.waits[owner]
+		if !waiting {
+			return false
+		}
+		lock := l.current(key)
+		if lock == nil {
+			return false
+		}
+		if lock.owner == target {
+			return true
+		}
+		owner = lock.owner
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+// ABOUTME: Tests for advisory locks on shared state keys
+// ABOUTME: Validates tokens, waiting and handoff, timeouts, expiry, deadlock detection, and release
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStateLocks(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("tokens unlock what they locked", func(t *testing.T) {
+		parent := NewSharedState()
+		child := parent.Child(StateInheritance{})
+
+		token, err := parent.Lock(ctx, "queue", LockOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info, ok := child.LockHolder("queue"); !ok || info.Owner != parent.ID() {
+			t.Errorf("LockHolder() = %+v, %v, want the parent", info, ok)
+		}
+		if _, err := child.Lock(ctx, "queue", LockOptions{Wait: -1}); !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Lock() of a held key error = %v, want ErrLockTimeout", err)
+		}
+		if _, err := parent.Lock(ctx, "queue", LockOptions{}); !errors.Is(err, ErrDeadlock) {
+			t.Errorf("Lock() of a key the spell holds error = %v, want ErrDeadlock", err)
+		}
+		if err := child.Unlock("queue", "wrong"); !errors.Is(err, ErrNotLockHolder) {
+			t.Errorf("Unlock() with the wrong token error = %v, want ErrNotLockHolder", err)
+		}
+		if err := child.Unlock("queue", token); err != nil {
+			t.Errorf("Unlock() with the token error = %v", err)
+		}
+		if _, ok := parent.LockHolder("queue"); ok {
+			t.Error("Expected the lock to be released")
+		}
+
+		isolated := parent.Child(StateInheritance{Isolated: true})
+		if _, err := parent.Lock(ctx, "queue", LockOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := isolated.Lock(ctx, "queue", LockOptions{Wait: -1}); err != nil {
+			t.Errorf("Expected isolated state to have its own locks, got %v", err)
+		}
+	})
+
+	t.Run("waiters get the lock when it is released", func(t *testing.T) {
+		parent := NewSharedState()
+		child := parent.Child(StateInheritance{})
+		token, _ := parent.Lock(ctx, "queue", LockOptions{})
+
+		got := make(chan error, 1)
+		go func() {
+			_, err := child.Lock(ctx, "queue", LockOptions{Wait: 5 * time.Second})
+			got <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+		if err := parent.Unlock("queue", token); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-got; err != nil {
+			t.Fatalf("Lock() after release error = %v", err)
+		}
+		if info, _ := parent.LockHolder("queue"); info.Owner != child.ID() {
+			t.Errorf("Expected the waiting child to hold the lock, got %+v", info)
+		}
+
+		child.ReleaseLocks()
+		if _, ok := parent.LockHolder("queue"); ok {
+			t.Error("Expected ReleaseLocks() to release the child's lock")
+		}
+	})
+
+	t.Run("locks expire after their TTL", func(t *testing.T) {
+		parent := NewSharedState()
+		child := parent.Child(StateInheritance{})
+		token, _ := parent.Lock(ctx, "queue", LockOptions{TTL: 30 * time.Millisecond})
+
+		start := time.Now()
+		if _, err := child.Lock(ctx, "queue", LockOptions{Wait: 5 * time.Second}); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Expected the waiter to wake when the lock expired, took %v", elapsed)
+		}
+		if err := parent.Unlock("queue", token); !errors.Is(err, ErrNotLockHolder) {
+			t.Errorf("Unlock() of an expired lock error = %v, want ErrNotLockHolder", err)
+		}
+	})
+
+	t.Run("deadlocks fail instead of waiting", func(t *testing.T) {
+		parent := NewSharedState()
+		first := parent.Child(StateInheritance{})
+		second := parent.Child(StateInheritance{})
+		if _, err := first.Lock(ctx, "a", LockOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := second.Lock(ctx, "b", LockOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		waiting := make(chan error, 1)
+		go func() {
+			_, err := second.Lock(ctx, "a", LockOptions{Wait: 5 * time.Second})
+			waiting <- err
+		}()
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			parent.locks.mu.Lock()
+			_, ok := parent.locks.waits[second.ID()]
+			parent.locks.mu.Unlock()
+			if ok {
+				break
+			}
+		}
+
+		if _, err := first.Lock(ctx, "b", LockOptions{Wait: 5 * time.Second}); !errors.Is(err, ErrDeadlock) {
+			t.Errorf("Lock() that would deadlock error = %v, want ErrDeadlock", err)
+		}
+		first.ReleaseLocks()
+		if err := <-waiting; err != nil {
+			t.Errorf("Expected the other spell to get the lock, got %v", err)
+		}
+	})
+
+	t.Run("cancellation stops the wait", func(t *testing.T) {
+		parent := NewSharedState()
+		child := parent.Child(StateInheritance{})
+		_, _ = parent.Lock(ctx, "queue", LockOptions{})
+
+		cancelled, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := child.Lock(cancelled, "queue", LockOptions{Wait: 5 * time.Second}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Lock() error = %v, want the context's error", err)
+		}
+	})
+}
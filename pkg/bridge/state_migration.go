@@ -0,0 +1,162 @@
+// ABOUTME: Migrations of saved spell state between versions of its schema
+// ABOUTME: Chains registered steps, validates the result against the target schema, and saves it as a new version
+
+package bridge
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// StateMigration moves the values of a state from one schema version to
+// another
+type StateMigration struct {
+	From, To int
+	Migrate  func(values map[string]interface{}) (map[string]interface{}, error)
+}
+
+// StateMigrations holds the migrations and schemas of a spell's state
+type StateMigrations struct {
+	mu         sync.Mutex
+	migrations map[int]map[int]StateMigration
+	schemas    map[int]map[string]interface{}
+}
+
+// NewStateMigrations creates an empty set of migrations
+func NewStateMigrations() *StateMigrations {
+	return &StateMigrations{
+		migrations: make(map[int]map[int]StateMigration),
+		schemas:    make(map[int]map[string]interface{}),
+	}
+}
+
+// Register adds a migration, replacing one between the same versions
+func (m *StateMigrations) Register(migration StateMigration) error {
+	if migration.From <= 0 || migration.To <= 0 || migration.From == migration.To {
+		return fmt.Errorf("a migration needs two different schema versions above zero, not %d and %d", migration.From, migration.To)
+	}
+	if migration.Migrate == nil {
+		return fmt.Errorf("the migration from schema version %d to %d needs a function", migration.From, migration.To)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.migrations[migration.From] == nil {
+		m.migrations[migration.From] = make(map[int]StateMigration)
+	}
+	m.migrations[migration.From][migration.To] = migration
+	return nil
+}
+
+// RegisterSchema sets the schema of a version, which migrations to it must
+// meet; versions without one are not checked
+func (m *StateMigrations) RegisterSchema(version int, schema map[string]interface{}) error {
+	if version <= 0 {
+		return fmt.Errorf("schema versions start at 1, not %d", version)
+	}
+	if t, ok := schema["type"]; ok && t != "object" {
+		return fmt.Errorf("a state schema must describe an object, not %v", t)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.schemas[version] = schema
+	return nil
+}
+
+// Path returns the shortest chain of migrations from one version to
+// another
+func (m *StateMigrations) Path(from, to int) ([]StateMigration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Breadth first, trying versions in order so the chain picked does
+	// not depend on map order
+	previous := map[int]StateMigration{}
+	queue := []int{from}
+	for len(queue) > 0 && from != to {
+		version := queue[0]
+		queue = queue[1:]
+		next := make([]int, 0, len(m.migrations[version]))
+		for v := range m.migrations[version] {
+			next = append(next, v)
+		}
+		sort.Ints(next)
+		for _, v := range next {
+			if _, seen := previous[v]; seen || v == from {
+				continue
+			}
+			previous[v] = m.migrations[version][v]
+			queue = append(queue, v)
+		}
+		if _, ok := previous[to]; ok {
+			break
+		}
+	}
+	if _, ok := previous[to]; !ok && from != to {
+		return nil, fmt.Errorf("no migrations lead from schema version %d to %d", from, to)
+	}
+
+	var path []StateMigration
+	for v := to; v != from; v = previous[v].From {
+		path = append([]StateMigration{previous[v]}, path...)
+	}
+	return path, nil
+}
+
+// Run passes values through the migrations from one version to another and
+// checks the result against the target version's schema
+func (m *StateMigrations) Run(values map[string]interface{}, from, to int) (map[string]interface{}, error) {
+	path, err := m.Path(from, to)
+	if err != nil {
+		return nil, err
+	}
+	values = copyValues(values)
+	for _, migration := range path {
+		if values, err = migration.Migrate(values); err != nil {
+			return nil, fmt.Errorf("migrating from schema version %d to %d: %w", migration.From, migration.To, err)
+		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+	}
+
+	m.mu.Lock()
+	schema, ok := m.schemas[to]
+	m.mu.Unlock()
+	if ok {
+		if err := validateStateValues(values, schema); err != nil {
+			return nil, fmt.Errorf("migrated state does not meet schema version %d: %w", to, err)
+		}
+	}
+	return values, nil
+}
+
+// Migrate runs the migrations over the latest version of the saved state
+// name and saves the result as a new version, which it returns. From may
+// be zero to use the schema version the state was saved with; a state
+// saved with another schema version than from is not migrated.
+func (s *SavedStates) Migrate(name string, from, to int, migrations *StateMigrations) (int, error) {
+	file, err := s.read(name, 0)
+	if err != nil {
+		return 0, err
+	}
+	if from == 0 {
+		from = file.SchemaVersion
+	}
+	if from == 0 {
+		return 0, fmt.Errorf("state %s version %d was saved without a schema version; give the version to migrate from", name, file.Version)
+	}
+	if file.SchemaVersion != 0 && file.SchemaVersion != from {
+		return 0, fmt.Errorf("state %s version %d has schema version %d, not %d", name, file.Version, file.SchemaVersion, from)
+	}
+
+	values, err := migrations.Run(file.Values, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("cannot migrate state %s: %w", name, err)
+	}
+	return s.persist(name, values, to)
+}
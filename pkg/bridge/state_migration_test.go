@@ -0,0 +1,120 @@
+// ABOUTME: Tests for migrating saved state between schema versions
+// ABOUTME: Validates chaining migrations, checking the target schema, and saving the result as a new version
+
+package bridge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStateMigrations(t *testing.T) {
+	newMigrations := func(t *testing.T) *StateMigrations {
+		migrations := NewStateMigrations()
+		steps := []StateMigration{
+			{From: 1, To: 2, Migrate: func(values map[string]interface{}) (map[string]interface{}, error) {
+				values["topics"] = []interface{}{values["topic"]}
+				delete(values, "topic")
+				return values, nil
+			}},
+			{From: 2, To: 3, Migrate: func(values map[string]interface{}) (map[string]interface{}, error) {
+				values["count"] = float64(len(values["topics"].([]interface{})))
+				return values, nil
+			}},
+			{From: 3, To: 1, Migrate: func(values map[string]interface{}) (map[string]interface{}, error) {
+				return map[string]interface{}{"topic": values["topics"].([]interface{})[0]}, nil
+			}},
+		}
+		for _, step := range steps {
+			if err := migrations.Register(step); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := migrations.RegisterSchema(3, map[string]interface{}{
+			"type":     "object",
+			"required": []interface{}{"topics", "count"},
+			"properties": map[string]interface{}{
+				"topics": map[string]interface{}{"type": "array"},
+				"count":  map[string]interface{}{"type": "number"},
+			},
+			"additionalProperties": false,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return migrations
+	}
+
+	t.Run("migrations chain", func(t *testing.T) {
+		migrations := newMigrations(t)
+		path, err := migrations.Path(1, 3)
+		if err != nil || len(path) != 2 || path[0].To != 2 || path[1].To != 3 {
+			t.Fatalf("Path(1, 3) = %+v, %v", path, err)
+		}
+		if path, err := migrations.Path(3, 2); err != nil || len(path) != 2 {
+			t.Errorf("Path(3, 2) = %+v, %v, want through version 1", path, err)
+		}
+		if _, err := migrations.Path(1, 4); err == nil {
+			t.Error("Expected no path to an unknown version")
+		}
+
+		input := map[string]interface{}{"topic": "tides"}
+		values, err := migrations.Run(input, 1, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{"topics": []interface{}{"tides"}, "count": float64(1)}
+		if !reflect.DeepEqual(values, want) {
+			t.Errorf("Run() = %v, want %v", values, want)
+		}
+		if input["topic"] != "tides" {
+			t.Error("Expected Run() to leave its input alone")
+		}
+
+		if _, err := migrations.Run(map[string]interface{}{"topic": "tides", "extra": true}, 1, 3); err == nil || !strings.Contains(err.Error(), "extra") {
+			t.Errorf("Run() of a result the target schema rejects = %v", err)
+		}
+		if err := migrations.Register(StateMigration{From: 2, To: 2, Migrate: func(values map[string]interface{}) (map[string]interface{}, error) {
+			return values, nil
+		}}); err == nil {
+			t.Error("Expected a migration to its own version to be rejected")
+		}
+	})
+
+	t.Run("saved state migrates to a new version", func(t *testing.T) {
+		migrations := newMigrations(t)
+		store := NewSavedStates(NewFileStateStore(t.TempDir()), SavedStatesOptions{})
+		state := NewSharedState()
+		_ = state.SetSchema(StateSchema{Schema: map[string]interface{}{"type": "object"}, Version: 1})
+		_ = state.Set("topic", "tides")
+		if _, err := store.Persist("run", state); err != nil {
+			t.Fatal(err)
+		}
+
+		version, err := store.Migrate("run", 0, 3, migrations)
+		if err != nil || version != 2 {
+			t.Fatalf("Migrate() = %d, %v", version, err)
+		}
+		values, _, _ := store.Values("run", 0)
+		if values["count"] != float64(1) {
+			t.Errorf("Expected the migrated values saved, got %v", values)
+		}
+		if old, _, _ := store.Values("run", 1); old["topic"] != "tides" {
+			t.Errorf("Expected the old version kept, got %v", old)
+		}
+
+		if _, err := store.Migrate("run", 1, 2, migrations); err == nil || !strings.Contains(err.Error(), "schema version 3") {
+			t.Errorf("Migrate() from the wrong version = %v", err)
+		}
+		bare := NewSharedState()
+		_ = bare.Set("topic", "x")
+		_, _ = store.Persist("bare", bare)
+		if _, err := store.Migrate("bare", 0, 2, migrations); err == nil {
+			t.Error("Expected a state saved without a schema version to need one given")
+		}
+		if _, err := store.Migrate("bare", 1, 2, migrations); err != nil {
+			t.Errorf("Migrate() with the version given = %v", err)
+		}
+	})
+}
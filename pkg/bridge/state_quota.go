@@ -0,0 +1,232 @@
+// ABOUTME: Quotas on a spell's shared state: keys expire, and writes over the key or byte limit are rejected or evict
+// ABOUTME: Tracks each key's size and use, and reports usage against the quota
+
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+// ErrStateQuota is returned when a write would take a state over its quota
+var ErrStateQuota = errors.New("state quota exceeded")
+
+// Reasons for deletes the state makes itself
+const (
+	ReasonExpired = "expired"
+	ReasonEvicted = "evicted"
+)
+
+// StateStats is the usage of a state's own keys against its quota
+type StateStats struct {
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+
+	// Expired, Evicted, and Rejected count the keys that outlived the TTL,
+	// the keys deleted to make room, and the writes refused
+	Expired  int `json:"expired"`
+	Evicted  int `json:"evicted"`
+	Rejected int `json:"rejected"`
+
+	Quota security.StateQuota `json:"quota"`
+}
+
+// ToMap returns the stats for scripts, with the TTL in seconds and zero
+// for limits that are not set
+func (s StateStats) ToMap() map[string]interface{} {
+	eviction := s.Quota.Eviction
+	if eviction == "" {
+		eviction = security.EvictReject
+	}
+	return map[string]interface{}{
+		"keys":      s.Keys,
+		"bytes":     s.Bytes,
+		"expired":   s.Expired,
+		"evicted":   s.Evicted,
+		"rejected":  s.Rejected,
+		"max_keys":  s.Quota.MaxKeys,
+		"max_bytes": s.Quota.MaxBytes,
+		"ttl":       s.Quota.TTL.Seconds(),
+		"eviction":  eviction,
+	}
+}
+
+// keyUsage is the size of a key and when it was last set and used
+type keyUsage struct {
+	size    int64
+	written time.Time
+	used    atomic.Int64
+}
+
+// quotaCounts are the counts StateStats reports
+type quotaCounts struct {
+	bytes                      int64
+	expired, evicted, rejected int
+}
+
+// SetQuota limits this state, and the states of sub-spells created from it
+// afterwards, to quota. Keys past the TTL go at once; keys over the other
+// limits stay until a write needs room.
+func (s *SharedState) SetQuota(quota security.StateQuota) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quota = nil
+	if !quota.IsZero() {
+		s.quota = &quota
+	}
+	s.sweep()
+}
+
+// Stats reports the usage of this state's own keys, leaving out those it
+// reads from its caller
+func (s *SharedState) Stats() StateStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep()
+	stats := StateStats{
+		Keys:     len(s.values),
+		Bytes:    s.counts.bytes,
+		Expired:  s.counts.expired,
+		Evicted:  s.counts.evicted,
+		Rejected: s.counts.rejected,
+	}
+	if s.quota != nil {
+		stats.Quota = *s.quota
+	}
+	return stats
+}
+
+// expired reports whether key has outlived the TTL. s.mu must be held.
+func (s *SharedState) expired(key string, now time.Time) bool {
+	if s.quota == nil || s.quota.TTL <= 0 {
+		return false
+	}
+	usage, ok := s.usage[key]
+	return ok && now.Sub(usage.written) >= s.quota.TTL
+}
+
+// touch marks key used, for LRU eviction. s.mu must be held, for reading
+// at least.
+func (s *SharedState) touch(key string, now time.Time) {
+	if usage, ok := s.usage[key]; ok {
+		usage.used.Store(now.UnixNano())
+	}
+}
+
+// sweep deletes the keys that outlived the TTL. s.mu must be held.
+func (s *SharedState) sweep() {
+	if s.quota == nil || s.quota.TTL <= 0 {
+		return
+	}
+	now := s.now()
+	for _, key := range sortedKeys(s.values) {
+		if s.expired(key, now) {
+			s.drop(key, ReasonExpired)
+			s.counts.expired++
+		}
+	}
+}
+
+// makeRoom gets the quota ready for event, evicting keys or failing as
+// the policy says. s.mu must be held.
+func (s *SharedState) makeRoom(event StateEvent) error {
+	s.sweep()
+	if s.quota == nil || event.Op != StateSet {
+		return nil
+	}
+	q := s.quota
+	size := stateSize(event.Key, event.Value)
+	keys, bytes := len(s.values), s.counts.bytes+size
+	if usage, ok := s.usage[event.Key]; ok {
+		bytes -= usage.size
+	} else {
+		keys++
+	}
+	over := func() bool {
+		return (q.MaxKeys > 0 && keys > q.MaxKeys) || (q.MaxBytes > 0 && bytes > q.MaxBytes)
+	}
+	if !over() {
+		return nil
+	}
+
+	reject := func(reason string) error {
+		s.counts.rejected++
+		return fmt.Errorf("%w: setting %q %s", ErrStateQuota, event.Key, reason)
+	}
+	if q.MaxBytes > 0 && size > q.MaxBytes {
+		return reject(fmt.Sprintf("needs %d bytes, more than the %d allowed", size, q.MaxBytes))
+	}
+	if q.Eviction != security.EvictLRU {
+		if q.MaxKeys > 0 && keys > q.MaxKeys {
+			return reject(fmt.Sprintf("would exceed %d keys", q.MaxKeys))
+		}
+		return reject(fmt.Sprintf("would exceed %d bytes", q.MaxBytes))
+	}
+
+	for over() {
+		victim := s.leastRecentlyUsed(event.Key)
+		if victim == "" {
+			return reject("leaves nothing to evict")
+		}
+		keys--
+		bytes -= s.usage[victim].size
+		s.drop(victim, ReasonEvicted)
+		s.counts.evicted++
+	}
+	return nil
+}
+
+// leastRecentlyUsed returns the key used longest ago, other than keep.
+// s.mu must be held.
+func (s *SharedState) leastRecentlyUsed(keep string) string {
+	victim, oldest := "", int64(0)
+	for _, key := range sortedKeys(s.values) {
+		if key == keep {
+			continue
+		}
+		if used := s.usage[key].used.Load(); victim == "" || used < oldest {
+			victim, oldest = key, used
+		}
+	}
+	return victim
+}
+
+// drop deletes key for reason, recording it in the history. s.mu must be
+// held.
+func (s *SharedState) drop(key, reason string) {
+	event := StateEvent{Seq: s.seq.Add(1), Op: StateDelete, Key: key, Time: s.now(), Source: s.id, Reason: reason}
+	applyEvent(s.values, event)
+	s.track(event)
+	s.history.record(event)
+}
+
+// track updates the usage of the key event changed. s.mu must be held.
+func (s *SharedState) track(event StateEvent) {
+	if usage, ok := s.usage[event.Key]; ok {
+		s.counts.bytes -= usage.size
+		delete(s.usage, event.Key)
+	}
+	if event.Op != StateSet {
+		return
+	}
+	usage := &keyUsage{size: stateSize(event.Key, event.Value), written: event.Time}
+	usage.used.Store(event.Time.UnixNano())
+	s.usage[event.Key] = usage
+	s.counts.bytes += usage.size
+}
+
+// stateSize is the size of a key and its value as JSON
+func stateSize(key string, value interface{}) int64 {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return int64(len(key))
+	}
+	return int64(len(key) + len(data))
+}
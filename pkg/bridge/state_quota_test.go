@@ -0,0 +1,107 @@
+// ABOUTME: Tests for quotas on shared state
+// ABOUTME: Validates key expiry, rejecting and evicting writes over quota, sub-spell quotas, and usage stats
+
+package bridge
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+func TestStateQuota(t *testing.T) {
+	t.Run("keys expire after the TTL", func(t *testing.T) {
+		now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+		state := NewSharedState()
+		state.now = func() time.Time { return now }
+		state.SetQuota(security.StateQuota{TTL: time.Minute})
+
+		_ = state.Set("old", 1)
+		now = now.Add(45 * time.Second)
+		_ = state.Set("new", 2)
+		if _, ok := state.Get("old"); !ok {
+			t.Fatal("Expected a key to last until the TTL")
+		}
+		now = now.Add(30 * time.Second)
+		if _, ok := state.Get("old"); ok {
+			t.Error("Expected a key past the TTL to be gone")
+		}
+		if got := state.Keys(); !reflect.DeepEqual(got, []string{"new"}) {
+			t.Errorf("Keys() = %v", got)
+		}
+
+		stats := state.Stats()
+		if stats.Keys != 1 || stats.Expired != 1 || stats.Quota.TTL != time.Minute {
+			t.Errorf("Stats() = %+v", stats)
+		}
+		events := state.History(EventFilter{Op: StateDelete})
+		if len(events) != 1 || events[0].Key != "old" || events[0].Reason != ReasonExpired {
+			t.Errorf("Expected the expiry in the history, got %+v", events)
+		}
+	})
+
+	t.Run("writes over quota are rejected", func(t *testing.T) {
+		state := NewSharedState()
+		state.SetQuota(security.StateQuota{MaxKeys: 2, MaxBytes: 40})
+		_ = state.Set("a", "x")
+		_ = state.Set("b", "y")
+		if err := state.Set("c", "z"); !errors.Is(err, ErrStateQuota) || !strings.Contains(err.Error(), "2 keys") {
+			t.Errorf("Set() of a key too many = %v", err)
+		}
+		if err := state.Set("a", "overwriting keeps the count"); err != nil {
+			t.Errorf("Set() of an existing key = %v", err)
+		}
+		if err := state.Set("b", strings.Repeat("y", 40)); !errors.Is(err, ErrStateQuota) {
+			t.Errorf("Set() of a value too large = %v", err)
+		}
+		_ = state.Delete("a")
+
+		stats := state.Stats()
+		if stats.Keys != 1 || stats.Bytes != int64(len(`b"y"`)) || stats.Rejected != 2 {
+			t.Errorf("Stats() = %+v", stats)
+		}
+	})
+
+	t.Run("lru evicts the least recently used keys", func(t *testing.T) {
+		now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+		state := NewSharedState()
+		state.now = func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		}
+		state.SetQuota(security.StateQuota{MaxKeys: 3, Eviction: security.EvictLRU})
+		_ = state.Set("a", 1)
+		_ = state.Set("b", 2)
+		_ = state.Set("c", 3)
+		state.Get("a")
+
+		if err := state.Set("d", 4); err != nil {
+			t.Fatal(err)
+		}
+		if got := state.Keys(); !reflect.DeepEqual(got, []string{"a", "c", "d"}) {
+			t.Errorf("Keys() = %v, want b evicted", got)
+		}
+		if stats := state.Stats(); stats.Evicted != 1 || stats.Rejected != 0 {
+			t.Errorf("Stats() = %+v", stats)
+		}
+	})
+
+	t.Run("sub-spells share the quota", func(t *testing.T) {
+		parent := NewSharedState()
+		parent.SetQuota(security.StateQuota{MaxKeys: 1})
+		_ = parent.Set("a", 1)
+		worker := parent.Child(StateInheritance{})
+		if err := worker.Set("b", 2); !errors.Is(err, ErrStateQuota) {
+			t.Errorf("Expected writes through to count against the caller's quota, got %v", err)
+		}
+		scratch := parent.Child(StateInheritance{Isolated: true})
+		_ = scratch.Set("b", 2)
+		if err := scratch.Set("c", 3); !errors.Is(err, ErrStateQuota) {
+			t.Errorf("Expected a sub-spell's own state to have the same quota, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+// ABOUTME: JSON schemas attached to shared state, checked on demand or on every write
+// ABOUTME: Strict schemas reject sets that break a key's schema and deletes of required keys
+
+package bridge
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lexlapax/go-llmspell/pkg/validation"
+)
+
+// StateSchema is a JSON schema for the values of a state, as an object
+// whose properties are its keys
+type StateSchema struct {
+	Schema map[string]interface{}
+
+	// Strict rejects writes that break the schema instead of leaving them
+	// for Validate to find
+	Strict bool
+
+	// Version numbers the schema, for migrating saved state written with
+	// an older one; zero leaves it unnumbered
+	Version int
+}
+
+// SetSchema attaches schema to this state, replacing any other, or removes
+// it when schema.Schema is nil. A strict schema also applies to the writes
+// of sub-spells that go through to this state.
+func (s *SharedState) SetSchema(schema StateSchema) error {
+	if schema.Schema != nil {
+		if t, ok := schema.Schema["type"]; ok && t != "object" {
+			return fmt.Errorf("a state schema must describe an object, not %v", t)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if schema.Schema == nil {
+		s.schema = nil
+		return nil
+	}
+	s.schema = &schema
+	return nil
+}
+
+// Schema returns the schema attached to this state, if any
+func (s *SharedState) Schema() (StateSchema, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.schema == nil {
+		return StateSchema{}, false
+	}
+	return *s.schema, true
+}
+
+// Validate checks the values this spell sees against the state's schema
+// and returns a *validation.Result error, or nil when they pass or there
+// is no schema
+func (s *SharedState) Validate() error {
+	schema, ok := s.Schema()
+	if !ok {
+		return nil
+	}
+	return validateStateValues(s.Values(), schema.Schema)
+}
+
+// validateStateValues checks values against a state schema and returns a
+// *validation.Result error, or nil when they pass
+func validateStateValues(values map[string]interface{}, schema map[string]interface{}) error {
+	result := &validation.Result{Errors: schemaValidator{}.validateSchema(values, schema, "")}
+
+	// The validator leaves out additionalProperties, which a state schema
+	// uses to list every key allowed
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := keySchema(schema, key); !ok {
+			result.Errors = append(result.Errors, unknownKey(key))
+		}
+	}
+	return result.Err()
+}
+
+// checkChange rejects a change the state's strict schema does not allow.
+// s.mu must be held.
+func (s *SharedState) checkChange(event StateEvent) error {
+	if s.schema == nil || !s.schema.Strict {
+		return nil
+	}
+	schema := s.schema.Schema
+
+	if event.Op == StateDelete {
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if name == event.Key {
+				return &validation.Result{Errors: []validation.Error{{
+					Field: event.Key, Code: validation.CodeRequired, Message: "is required by the state schema and cannot be deleted",
+				}}}
+			}
+		}
+		return nil
+	}
+
+	valueSchema, ok := keySchema(schema, event.Key)
+	if !ok {
+		return &validation.Result{Errors: []validation.Error{unknownKey(event.Key)}}
+	}
+	result := &validation.Result{Errors: schemaValidator{}.validateSchema(event.Value, valueSchema, event.Key)}
+	return result.Err()
+}
+
+// keySchema returns the schema of key's value: its property, or else
+// additionalProperties. Keys outside the properties are not allowed when
+// additionalProperties is false.
+func keySchema(schema map[string]interface{}, key string) (map[string]interface{}, bool) {
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		if property, ok := properties[key].(map[string]interface{}); ok {
+			return property, true
+		}
+	}
+	switch additional := schema["additionalProperties"].(type) {
+	case bool:
+		return map[string]interface{}{}, additional
+	case map[string]interface{}:
+		return additional, true
+	}
+	return map[string]interface{}{}, true
+}
+
+// unknownKey is the problem with a key the schema does not list
+func unknownKey(key string) validation.Error {
+	return validation.Error{Field: key, Code: validation.CodeInvalid, Message: "is not a key the state schema allows"}
+}
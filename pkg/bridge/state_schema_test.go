@@ -0,0 +1,119 @@
+// ABOUTME: Tests for JSON schemas attached to shared state
+// ABOUTME: Validates on-demand checks, strict sets and deletes, sub-spell writes, and loading saved state
+
+package bridge
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/validation"
+)
+
+func TestStateSchema(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"topic": map[string]interface{}{"type": "string"},
+			"count": map[string]interface{}{"type": "integer", "minimum": float64(0)},
+		},
+		"required":             []interface{}{"topic"},
+		"additionalProperties": false,
+	}
+
+	t.Run("validate reports every problem", func(t *testing.T) {
+		state := NewSharedState()
+		if err := state.Validate(); err != nil {
+			t.Errorf("Validate() without a schema = %v", err)
+		}
+		if err := state.SetSchema(StateSchema{Schema: schema}); err != nil {
+			t.Fatal(err)
+		}
+		if err := state.Set("count", float64(-1)); err != nil {
+			t.Fatalf("Expected a schema that is not strict to allow any write, got %v", err)
+		}
+		_ = state.Set("extra", true)
+
+		var result *validation.Result
+		if err := state.Validate(); !errors.As(err, &result) {
+			t.Fatalf("Validate() = %v, want a validation result", err)
+		}
+		fields := map[string]string{}
+		for _, e := range result.Errors {
+			fields[e.Field] = e.Code
+		}
+		if fields["topic"] != validation.CodeRequired || fields["count"] != validation.CodeMinimum || fields["extra"] != validation.CodeInvalid {
+			t.Errorf("Validate() errors = %+v", result.Errors)
+		}
+
+		if got, ok := state.Schema(); !ok || got.Strict {
+			t.Errorf("Schema() = %+v, %v", got, ok)
+		}
+		if err := state.SetSchema(StateSchema{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := state.Schema(); ok {
+			t.Error("Expected a nil schema to remove the schema")
+		}
+		if err := state.SetSchema(StateSchema{Schema: map[string]interface{}{"type": "array"}}); err == nil {
+			t.Error("Expected a schema that is not an object to be rejected")
+		}
+	})
+
+	t.Run("strict schemas reject writes", func(t *testing.T) {
+		parent := NewSharedState()
+		if err := parent.SetSchema(StateSchema{Schema: schema, Strict: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := parent.Set("topic", "go"); err != nil {
+			t.Fatal(err)
+		}
+		if err := parent.Set("count", "many"); err == nil || !strings.Contains(err.Error(), "count") {
+			t.Errorf("Set() of the wrong type error = %v", err)
+		}
+		if err := parent.Set("extra", 1); err == nil {
+			t.Error("Expected a key outside the schema to be rejected")
+		}
+		if err := parent.Delete("topic"); err == nil {
+			t.Error("Expected deleting a required key to be rejected")
+		}
+
+		// Sub-spells writing through meet the schema too, unless their
+		// writes stay their own
+		worker := parent.Child(StateInheritance{})
+		if err := worker.Set("count", float64(-5)); err == nil {
+			t.Error("Expected a sub-spell's write to meet its caller's schema")
+		}
+		scratch := parent.Child(StateInheritance{ReadOnly: true})
+		if err := scratch.Set("count", float64(-5)); err != nil {
+			t.Errorf("Expected a read-only sub-spell's own write to be allowed, got %v", err)
+		}
+
+		if value, _ := parent.Get("count"); value != nil {
+			t.Errorf("Expected rejected writes to change nothing, count = %v", value)
+		}
+		if events := parent.History(EventFilter{}); len(events) != 1 {
+			t.Errorf("Expected only the accepted write in the history, got %+v", events)
+		}
+	})
+
+	t.Run("loading saved state meets the schema", func(t *testing.T) {
+		store := NewSavedStates(NewFileStateStore(t.TempDir()), SavedStatesOptions{})
+		saved := NewSharedState()
+		_ = saved.Set("topic", "go")
+		_ = saved.Set("count", "many")
+		if _, err := store.Persist("run", saved); err != nil {
+			t.Fatal(err)
+		}
+
+		state := NewSharedState()
+		_ = state.SetSchema(StateSchema{Schema: schema, Strict: true})
+		if _, err := store.Load("run", 0, state); err == nil {
+			t.Error("Expected Load() to fail on a value the schema rejects")
+		}
+		if value, _ := state.Get("topic"); value != "go" {
+			t.Errorf("Expected the values that pass to load, topic = %v", value)
+		}
+	})
+}
@@ -0,0 +1,441 @@
+// ABOUTME: Versioned snapshots of spell state saved under a name, so later runs can load them
+// ABOUTME: SavedStates numbers, compresses, prunes, and optionally saves versions as deltas; a StateStore backend holds them
+
+package bridge
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+)
+
+// ErrStateNotFound is returned for a saved state or version that does not
+// exist
+var ErrStateNotFound = errors.New("saved state not found")
+
+// ErrVersionExists is returned by StateStore.Create for a version that was
+// already saved, as when another instance saved the same state first
+var ErrVersionExists = errors.New("state version already exists")
+
+// stateName is what a saved state may be called: stores use it in file
+// names and keys, so it cannot reach outside the store
+var stateName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// createAttempts is how many version numbers Persist tries when other
+// instances keep saving the same state first
+const createAttempts = 5
+
+// StateStore holds the versions of saved states: a directory, a database,
+// or an object store that several instances share. SavedStates decides
+// what the versions hold and which to keep.
+type StateStore interface {
+	// Names lists the states with at least one version
+	Names() ([]string, error)
+
+	// Versions lists the versions of a state, oldest first, and none for
+	// a state that was never saved
+	Versions(name string) ([]int, error)
+
+	// Read returns the data of a version, or ErrStateNotFound
+	Read(name string, version int) ([]byte, error)
+
+	// Create stores a new version, or fails with ErrVersionExists without
+	// changing the one already stored
+	Create(name string, version int, data []byte) error
+
+	// Remove deletes a version; removing one that does not exist is not an
+	// error
+	Remove(name string, version int) error
+}
+
+// SavedStatesOptions configure SavedStates
+type SavedStatesOptions struct {
+	// Compress gzips new versions; compressed and plain versions load alike
+	Compress bool
+
+	// Keep is how many versions of a state to keep, pruning the oldest;
+	// zero keeps every version. The versions the oldest kept one is
+	// rebuilt from are kept too.
+	Keep int
+
+	// SnapshotEvery, when above one, saves each version as the changes
+	// since the previous one, with every SnapshotEvery-th version in full.
+	// Loading a version rebuilds it from the nearest full one before it,
+	// so callers see whole versions either way.
+	SnapshotEvery int
+}
+
+// SavedStates saves spell state under a name, each save as a new version,
+// so a later run can pick up where an earlier one stopped or go back to an
+// older version. Values must survive a JSON round trip, which holds for
+// anything a script can store in state.
+type SavedStates struct {
+	store StateStore
+	opts  SavedStatesOptions
+}
+
+// SavedState describes a saved state and its versions
+type SavedState struct {
+	Name     string    `json:"name"`
+	Versions []int     `json:"versions"`
+	Latest   int       `json:"latest"`
+	Saved    time.Time `json:"saved"`
+}
+
+// stateFile is the content of a version
+type stateFile struct {
+	Name    string                 `json:"name"`
+	Version int                    `json:"version"`
+	Saved   time.Time              `json:"saved"`
+	Values  map[string]interface{} `json:"values"`
+
+	// SchemaVersion is the version of the state's schema when saved, if
+	// it had one with a version
+	SchemaVersion int `json:"schema_version,omitempty"`
+
+	// Base, when set, is the version Delta applies to, and the version
+	// holds only the changes in Delta rather than Values
+	Base  int         `json:"base,omitempty"`
+	Delta *stateDelta `json:"delta,omitempty"`
+}
+
+// stateDelta is what changed between two versions
+type stateDelta struct {
+	// Set holds the keys added or changed, with their new values
+	Set map[string]interface{} `json:"set,omitempty"`
+
+	// Deleted lists the keys removed
+	Deleted []string `json:"deleted,omitempty"`
+}
+
+// deltaOf returns the changes that turn from into to
+func deltaOf(from, to map[string]interface{}) *stateDelta {
+	diff := DiffStates(from, to, false)
+	delta := &stateDelta{Set: diff.Added}
+	for key, change := range diff.Modified {
+		delta.Set[key] = change.New
+	}
+	for key := range diff.Removed {
+		delta.Deleted = append(delta.Deleted, key)
+	}
+	sort.Strings(delta.Deleted)
+	return delta
+}
+
+// apply makes the changes in d to values
+func (d *stateDelta) apply(values map[string]interface{}) {
+	for _, key := range d.Deleted {
+		delete(values, key)
+	}
+	for key, value := range d.Set {
+		values[key] = value
+	}
+}
+
+// NewSavedStates saves state in store
+func NewSavedStates(store StateStore, opts SavedStatesOptions) *SavedStates {
+	return &SavedStates{store: store, opts: opts}
+}
+
+// Persist stores the keys state can see as the next version of name and
+// returns that version
+func (s *SavedStates) Persist(name string, state *SharedState) (int, error) {
+	schema, _ := state.Schema()
+	return s.persist(name, state.Values(), schema.Version)
+}
+
+// persist stores values with their schema version as the next version of
+// name
+func (s *SavedStates) persist(name string, values map[string]interface{}, schemaVersion int) (int, error) {
+	if err := checkStateName(name); err != nil {
+		return 0, err
+	}
+	file := stateFile{Name: name, Saved: time.Now(), Values: values, SchemaVersion: schemaVersion}
+
+	for attempt := 0; attempt < createAttempts; attempt++ {
+		versions, err := s.store.Versions(name)
+		if err != nil {
+			return 0, err
+		}
+		file.Version = 1
+		if len(versions) > 0 {
+			file.Version = versions[len(versions)-1] + 1
+		}
+		file.Values, file.Base, file.Delta = values, 0, nil
+		if s.opts.SnapshotEvery > 1 && len(versions) > 0 {
+			// A previous version that cannot be read gets a full snapshot
+			// after it rather than failing the save
+			previous, depth, err := s.rebuild(name, versions[len(versions)-1])
+			if err == nil && depth+1 < s.opts.SnapshotEvery {
+				file.Values, file.Base, file.Delta = nil, previous.Version, deltaOf(previous.Values, values)
+			}
+		}
+
+		data, err := encodeStateFile(file, s.opts.Compress)
+		if err != nil {
+			return 0, fmt.Errorf("cannot save state %q: %w", name, err)
+		}
+		err = s.store.Create(name, file.Version, data)
+		if errors.Is(err, ErrVersionExists) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.prune(name, append(versions, file.Version))
+		return file.Version, nil
+	}
+	return 0, fmt.Errorf("cannot save state %q: %w after %d attempts", name, ErrVersionExists, createAttempts)
+}
+
+// Load sets the values saved in a version of name in state, the latest
+// when version is zero, and returns the version loaded. Keys that were not
+// saved keep their values, as do keys whose saved values a strict schema
+// of state rejects, which fail the load.
+func (s *SavedStates) Load(name string, version int, state *SharedState) (int, error) {
+	values, version, err := s.Values(name, version)
+	if err != nil {
+		return 0, err
+	}
+	if err := state.SetValues(values); err != nil {
+		return 0, fmt.Errorf("cannot load state %s version %d: %w", name, version, err)
+	}
+	return version, nil
+}
+
+// Values returns the values saved in a version of name, the latest when
+// version is zero, and the version read
+func (s *SavedStates) Values(name string, version int) (map[string]interface{}, int, error) {
+	file, err := s.read(name, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	if file.Values == nil {
+		file.Values = make(map[string]interface{})
+	}
+	return file.Values, file.Version, nil
+}
+
+// List describes the saved states, sorted by name
+func (s *SavedStates) List() ([]SavedState, error) {
+	names, err := s.store.Names()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	var saved []SavedState
+	for _, name := range names {
+		versions, err := s.store.Versions(name)
+		if err != nil || len(versions) == 0 {
+			continue
+		}
+		state := SavedState{Name: name, Versions: versions, Latest: versions[len(versions)-1]}
+		if file, err := s.read(name, state.Latest); err == nil {
+			state.Saved = file.Saved
+		}
+		saved = append(saved, state)
+	}
+	return saved, nil
+}
+
+// Delete removes a version of name, or every version when version is zero
+func (s *SavedStates) Delete(name string, version int) error {
+	versions, err := s.versions(name)
+	if err != nil {
+		return err
+	}
+	if version != 0 {
+		if !containsVersion(versions, version) {
+			return fmt.Errorf("%w: %s version %d", ErrStateNotFound, name, version)
+		}
+		// A version others are saved as changes to must stay
+		for _, later := range versions {
+			if later <= version {
+				continue
+			}
+			if file, err := s.readFile(name, later); err == nil && file.Delta != nil && file.Base == version {
+				return fmt.Errorf("cannot delete state %s version %d: version %d is saved as changes to it", name, version, later)
+			}
+		}
+		versions = []int{version}
+	}
+	for _, v := range versions {
+		if err := s.store.Remove(name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// versions lists the versions of name, failing if there are none
+func (s *SavedStates) versions(name string) ([]int, error) {
+	if err := checkStateName(name); err != nil {
+		return nil, err
+	}
+	versions, err := s.store.Versions(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrStateNotFound, name)
+	}
+	return versions, nil
+}
+
+// read reads a version of name, the latest when version is zero
+func (s *SavedStates) read(name string, version int) (*stateFile, error) {
+	versions, err := s.versions(name)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		version = versions[len(versions)-1]
+	}
+	if !containsVersion(versions, version) {
+		return nil, fmt.Errorf("%w: %s version %d", ErrStateNotFound, name, version)
+	}
+	file, _, err := s.rebuild(name, version)
+	return file, err
+}
+
+// rebuild reads a version of name with all its values, applying the
+// changes saved since the nearest full version before it, and returns
+// how many versions of changes it applied
+func (s *SavedStates) rebuild(name string, version int) (*stateFile, int, error) {
+	var deltas []*stateFile
+	for {
+		file, err := s.readFile(name, version)
+		if err != nil {
+			return nil, 0, err
+		}
+		if file.Delta == nil {
+			if file.Values == nil {
+				file.Values = make(map[string]interface{})
+			}
+			for i := len(deltas) - 1; i >= 0; i-- {
+				deltas[i].Delta.apply(file.Values)
+			}
+			if len(deltas) == 0 {
+				return file, 0, nil
+			}
+			latest := deltas[0]
+			latest.Values, latest.Base, latest.Delta = file.Values, 0, nil
+			return latest, len(deltas), nil
+		}
+		if file.Base <= 0 || file.Base >= file.Version {
+			return nil, 0, fmt.Errorf("cannot read state %s version %d: invalid base version %d", name, file.Version, file.Base)
+		}
+		deltas = append(deltas, file)
+		version = file.Base
+	}
+}
+
+// readFile reads a version of name as saved, changes or all its values
+func (s *SavedStates) readFile(name string, version int) (*stateFile, error) {
+	data, err := s.store.Read(name, version)
+	if err != nil {
+		return nil, err
+	}
+	file, err := decodeStateFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read state %s version %d: %w", name, version, err)
+	}
+	return file, nil
+}
+
+// bases lists the versions a version of name is rebuilt from
+func (s *SavedStates) bases(name string, version int) ([]int, error) {
+	var bases []int
+	for {
+		file, err := s.readFile(name, version)
+		if err != nil {
+			return nil, err
+		}
+		if file.Delta == nil || file.Base <= 0 || file.Base >= file.Version {
+			return bases, nil
+		}
+		bases = append(bases, file.Base)
+		version = file.Base
+	}
+}
+
+// prune removes the oldest of versions beyond the number to keep, but for
+// those the kept versions are rebuilt from; failures only leave extra
+// versions behind
+func (s *SavedStates) prune(name string, versions []int) {
+	if s.opts.Keep <= 0 || len(versions) <= s.opts.Keep {
+		return
+	}
+	oldest := versions[len(versions)-s.opts.Keep]
+	bases, err := s.bases(name, oldest)
+	if err != nil {
+		return
+	}
+	for _, version := range versions[:len(versions)-s.opts.Keep] {
+		if !slices.Contains(bases, version) {
+			_ = s.store.Remove(name, version)
+		}
+	}
+}
+
+// checkStateName rejects names stores cannot use safely
+func checkStateName(name string) error {
+	if !stateName.MatchString(name) {
+		return fmt.Errorf("invalid state name %q: use letters, digits, '.', '_', and '-'", name)
+	}
+	return nil
+}
+
+// encodeStateFile returns a version's data, gzipped if compress is set
+func encodeStateFile(file stateFile, compress bool) ([]byte, error) {
+	data, err := json.Marshal(file)
+	if err != nil || !compress {
+		return data, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeStateFile reads a version's data, gzipped or not
+func decodeStateFile(data []byte) (*stateFile, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if IsGzip(data) {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	var file stateFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// IsGzip reports whether data starts as gzip data does
+func IsGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// containsVersion reports whether versions holds version
+func containsVersion(versions []int, version int) bool {
+	i := sort.SearchInts(versions, version)
+	return i < len(versions) && versions[i] == version
+}
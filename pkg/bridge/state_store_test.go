@@ -0,0 +1,235 @@
+// ABOUTME: Tests for saving spell state across runs in versioned files
+// ABOUTME: Validates round trips with and without gzip, versions, deltas, pruning, deletion, and races
+
+package bridge
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSavedStatesRoundTrip(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		store := NewSavedStates(NewFileStateStore(dir), SavedStatesOptions{Compress: compress})
+
+		state := NewSharedState()
+		state.Set("topic", "tides")
+		state.Set("findings", map[string]interface{}{"count": float64(2), "items": []interface{}{"a", "b"}})
+		version, err := store.Persist("research", state)
+		if err != nil || version != 1 {
+			t.Fatalf("Persist() = %d, %v, want version 1", version, err)
+		}
+
+		ext := ".json"
+		if compress {
+			ext = ".json.gz"
+		}
+		if _, err := os.Stat(filepath.Join(dir, "research", "1"+ext)); err != nil {
+			t.Errorf("Expected version file 1%s: %v", ext, err)
+		}
+
+		loaded := NewSharedState()
+		loaded.Set("other", "kept")
+		if version, err := store.Load("research", 0, loaded); err != nil || version != 1 {
+			t.Fatalf("Load() = %d, %v, want version 1", version, err)
+		}
+		for _, key := range []string{"topic", "findings"} {
+			want, _ := state.Get(key)
+			if got, _ := loaded.Get(key); !reflect.DeepEqual(got, want) {
+				t.Errorf("compress=%v: %s = %#v, want %#v", compress, key, got, want)
+			}
+		}
+		if got, _ := loaded.Get("other"); got != "kept" {
+			t.Error("Expected keys that were not saved to keep their values")
+		}
+	}
+}
+
+func TestSavedStatesVersions(t *testing.T) {
+	dir := t.TempDir()
+	store := NewSavedStates(NewFileStateStore(dir), SavedStatesOptions{Keep: 2})
+	state := NewSharedState()
+	for i := 1; i <= 3; i++ {
+		state.Set("step", float64(i))
+		if version, err := store.Persist("job", state); err != nil || version != i {
+			t.Fatalf("Persist() = %d, %v, want version %d", version, err, i)
+		}
+	}
+
+	// A store that compresses still reads the plain versions
+	store = NewSavedStates(NewFileStateStore(dir), SavedStatesOptions{Compress: true, Keep: 2})
+	state.Set("step", float64(4))
+	if version, err := store.Persist("job", state); err != nil || version != 4 {
+		t.Fatalf("Persist() = %d, %v, want version 4", version, err)
+	}
+
+	saved, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Name != "job" || saved[0].Latest != 4 || !reflect.DeepEqual(saved[0].Versions, []int{3, 4}) {
+		t.Fatalf("List() = %+v, want job with versions 3 and 4 after pruning", saved)
+	}
+
+	loaded := NewSharedState()
+	if _, err := store.Load("job", 3, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if step, _ := loaded.Get("step"); step != float64(3) {
+		t.Errorf("step = %v, want 3", step)
+	}
+	if _, err := store.Load("job", 1, loaded); !errors.Is(err, ErrStateNotFound) {
+		t.Errorf("Load() of a pruned version error = %v, want ErrStateNotFound", err)
+	}
+
+	if err := store.Delete("job", 4); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := store.Load("job", 0, loaded); err != nil || version != 3 {
+		t.Errorf("Load() after deleting the latest = %d, %v, want version 3", version, err)
+	}
+	if err := store.Delete("job", 0); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := store.List(); len(saved) != 0 {
+		t.Errorf("List() = %+v after deleting every version", saved)
+	}
+	if err := store.Delete("job", 0); !errors.Is(err, ErrStateNotFound) {
+		t.Errorf("Delete() of a missing state error = %v, want ErrStateNotFound", err)
+	}
+}
+
+func TestSavedStatesDeltas(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		store := NewSavedStates(NewFileStateStore(dir), SavedStatesOptions{Compress: compress, Keep: 3, SnapshotEvery: 3})
+		state := NewSharedState()
+		state.Set("topic", "tides")
+		want := make(map[int]map[string]interface{})
+		for i := 1; i <= 5; i++ {
+			state.Set("step", float64(i))
+			if i == 2 {
+				state.Set("draft", "rough")
+			}
+			if i == 4 {
+				state.Delete("draft")
+			}
+			if version, err := store.Persist("job", state); err != nil || version != i {
+				t.Fatalf("Persist() = %d, %v, want version %d", version, err, i)
+			}
+			want[i] = state.Values()
+		}
+
+		// Versions 1 and 4 are whole; the others hold changes to the one before
+		for version, base := range map[int]int{1: 0, 2: 1, 3: 2, 4: 0, 5: 4} {
+			file, err := store.readFile("job", version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.Base != base || (base == 0) != (file.Delta == nil) {
+				t.Errorf("compress=%v: version %d has base %d, delta %v, want base %d", compress, version, file.Base, file.Delta != nil, base)
+			}
+		}
+
+		// Keeping versions 3 to 5 keeps the ones version 3 is rebuilt from
+		saved, err := store.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(saved) != 1 || !reflect.DeepEqual(saved[0].Versions, []int{1, 2, 3, 4, 5}) {
+			t.Fatalf("compress=%v: List() = %+v, want versions 1 to 5", compress, saved)
+		}
+		for version := 1; version <= 5; version++ {
+			values, _, err := store.Values("job", version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(values, want[version]) {
+				t.Errorf("compress=%v: version %d = %#v, want %#v", compress, version, values, want[version])
+			}
+		}
+
+		state.Set("step", float64(6))
+		if _, err := store.Persist("job", state); err != nil {
+			t.Fatal(err)
+		}
+		if saved, _ := store.List(); !reflect.DeepEqual(saved[0].Versions, []int{4, 5, 6}) {
+			t.Errorf("compress=%v: versions = %v, want 4 to 6 once none need the older ones", compress, saved[0].Versions)
+		}
+
+		if err := store.Delete("job", 4); err == nil {
+			t.Errorf("compress=%v: Delete() of a version others are saved as changes to should fail", compress)
+		}
+		if err := store.Delete("job", 6); err != nil {
+			t.Fatal(err)
+		}
+		if version, err := store.Load("job", 0, NewSharedState()); err != nil || version != 5 {
+			t.Errorf("compress=%v: Load() after deleting the latest = %d, %v, want version 5", compress, version, err)
+		}
+	}
+}
+
+func TestSavedStatesErrors(t *testing.T) {
+	dir := t.TempDir()
+	store := NewSavedStates(NewFileStateStore(dir), SavedStatesOptions{})
+
+	for _, name := range []string{"", "..", "../up", "a/b", ".hidden"} {
+		if _, err := store.Persist(name, NewSharedState()); err == nil {
+			t.Errorf("Persist(%q) should reject the name", name)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "broken"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken", "1.json.gz"), []byte("not gzip"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load("broken", 0, NewSharedState()); err == nil {
+		t.Error("Expected an error for a corrupt version")
+	}
+}
+
+func TestSavedStatesConcurrentPersist(t *testing.T) {
+	// Separate SavedStates over one directory, as separate instances are
+	store := NewFileStateStore(t.TempDir())
+	const savers = 4
+
+	var wg sync.WaitGroup
+	versions := make(chan int, savers)
+	for i := 0; i < savers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			saved := NewSavedStates(store, SavedStatesOptions{})
+			version, err := saved.Persist("shared", NewSharedState())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			versions <- version
+		}()
+	}
+	wg.Wait()
+	close(versions)
+
+	seen := make(map[int]bool)
+	for version := range versions {
+		if seen[version] {
+			t.Errorf("Version %d was saved twice", version)
+		}
+		seen[version] = true
+	}
+	if got, _ := store.Versions("shared"); len(got) != savers {
+		t.Errorf("Versions() = %v, want %d versions", got, savers)
+	}
+
+	if err := store.Create("shared", 1, []byte("{}")); !errors.Is(err, ErrVersionExists) {
+		t.Errorf("Create() of an existing version error = %v, want ErrVersionExists", err)
+	}
+}
@@ -0,0 +1,68 @@
+// ABOUTME: Tests for state shared between a spell and its sub-spells
+// ABOUTME: Validates inheritance of keys, read-only children, isolation, and lookup by ID
+
+package bridge
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSharedState(t *testing.T) {
+	t.Run("children share the parent's keys", func(t *testing.T) {
+		parent := NewSharedState()
+		parent.Set("topic", "go")
+		child := parent.Child(StateInheritance{})
+
+		if value, ok := child.Get("topic"); !ok || value != "go" {
+			t.Errorf("Expected the child to see the parent's key, got %v", value)
+		}
+		child.Set("summary", "short")
+		if value, _ := parent.Get("summary"); value != "short" {
+			t.Errorf("Expected the child's write to reach the parent, got %v", value)
+		}
+		child.Delete("topic")
+		if _, ok := parent.Get("topic"); ok {
+			t.Error("Expected the child's delete to reach the parent")
+		}
+	})
+
+	t.Run("inheritance limits what the child sees", func(t *testing.T) {
+		parent := NewSharedState()
+		parent.Set("public.topic", "go")
+		parent.Set("secret", "token")
+		child := parent.Child(StateInheritance{Keys: []string{"public.*"}, ReadOnly: true})
+
+		if _, ok := child.Get("secret"); ok {
+			t.Error("Expected keys outside the patterns to be hidden")
+		}
+		if got := child.Keys(); !reflect.DeepEqual(got, []string{"public.topic"}) {
+			t.Errorf("Unexpected keys %v", got)
+		}
+
+		child.Set("public.topic", "rust")
+		if value, _ := child.Get("public.topic"); value != "rust" {
+			t.Errorf("Expected the child to see its own write, got %v", value)
+		}
+		if value, _ := parent.Get("public.topic"); value != "go" {
+			t.Errorf("Expected a read-only child to leave the parent alone, got %v", value)
+		}
+	})
+
+	t.Run("isolated children and lookup by ID", func(t *testing.T) {
+		parent := NewSharedState()
+		parent.Set("topic", "go")
+		isolated := parent.Child(StateInheritance{Isolated: true})
+		if _, ok := isolated.Get("topic"); ok {
+			t.Error("Expected isolated state to share nothing")
+		}
+
+		grandchild := parent.Child(StateInheritance{}).Child(StateInheritance{})
+		if found, ok := grandchild.Find(parent.ID()); !ok || found != parent {
+			t.Error("Expected to find an ancestor by ID")
+		}
+		if _, ok := isolated.Find(parent.ID()); ok {
+			t.Error("Expected isolated state not to reach its parent")
+		}
+	})
+}
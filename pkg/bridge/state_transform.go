@@ -0,0 +1,427 @@
+// ABOUTME: Named pipelines that transform the values of shared state: map, filter, redact, rename, script
+// ABOUTME: Runs are measured per pipeline and memoized in the run's result cache by pipeline and input
+
+package bridge
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CacheTransform is the ResultCache kind of transform results
+const CacheTransform = "transform"
+
+// Kinds of TransformStep
+const (
+	TransformMap    = "map"
+	TransformFilter = "filter"
+	TransformRedact = "redact"
+	TransformRename = "rename"
+	TransformScript = "script"
+)
+
+// DefaultRedaction replaces redacted values without a Replacement
+const DefaultRedaction = "[REDACTED]"
+
+// TransformStep is one step of a pipeline. Each kind reads its own fields:
+//
+//	map     Value for each key matching Keys
+//	filter  keeps the keys matching Keys for which Keep, if set, is true
+//	redact  replaces the values of keys matching Keys, or with Fields only
+//	        the fields with those names at any depth within them
+//	rename  moves each key of Names to its new name
+//	script  Script over all the values
+type TransformStep struct {
+	Kind string
+
+	// Keys are patterns, where * matches any run of characters, of the
+	// keys a step applies to; empty means every key
+	Keys []string
+
+	// Fields are the names of fields to redact within values
+	Fields []string
+
+	// Replacement replaces redacted values; nil means DefaultRedaction
+	Replacement interface{}
+
+	// Names maps old key names to new ones
+	Names map[string]string
+
+	Value  func(key string, value interface{}) (interface{}, error)
+	Keep   func(key string, value interface{}) (bool, error)
+	Script func(values map[string]interface{}) (map[string]interface{}, error)
+}
+
+// TransformPipeline is a named list of steps run in order
+type TransformPipeline struct {
+	Name  string
+	Steps []TransformStep
+
+	// NoCache runs the pipeline every time, for script steps that are not
+	// deterministic
+	NoCache bool
+}
+
+// TransformMetrics count the runs of a pipeline
+type TransformMetrics struct {
+	Runs      int `json:"runs"`
+	Failures  int `json:"failures"`
+	CacheHits int `json:"cache_hits"`
+
+	// Duration is the time spent running steps, leaving out cache hits
+	Duration time.Duration `json:"duration"`
+
+	// KeysIn and KeysOut are the number of keys of the last run's input
+	// and output
+	KeysIn  int `json:"keys_in"`
+	KeysOut int `json:"keys_out"`
+
+	// Redacted counts the values replaced by redact steps
+	Redacted int `json:"redacted"`
+}
+
+// StateTransforms holds a spell's pipelines and their metrics
+type StateTransforms struct {
+	cache *ResultCache
+
+	mu        sync.Mutex
+	pipelines map[string]*registeredPipeline
+	metrics   map[string]*TransformMetrics
+}
+
+// registeredPipeline is a pipeline and the ID its cached results are
+// filed under
+type registeredPipeline struct {
+	TransformPipeline
+	id string
+}
+
+// NewStateTransforms creates an empty set of pipelines that memoize their
+// results in cache; a nil cache memoizes nothing
+func NewStateTransforms(cache *ResultCache) *StateTransforms {
+	return &StateTransforms{
+		cache:     cache,
+		pipelines: make(map[string]*registeredPipeline),
+		metrics:   make(map[string]*TransformMetrics),
+	}
+}
+
+// Register adds a pipeline, replacing one with the same name
+func (t *StateTransforms) Register(p TransformPipeline) error {
+	if p.Name == "" {
+		return fmt.Errorf("a transform pipeline needs a name")
+	}
+	// Steps that only hold data are identified by it, so their results can
+	// be reused across runs; functions are not, so a pipeline with them
+	// gets an ID of its own
+	declarative := true
+	for i, step := range p.Steps {
+		if err := checkStep(step); err != nil {
+			return fmt.Errorf("transform %q step %d: %w", p.Name, i+1, err)
+		}
+		if step.Value != nil || step.Keep != nil || step.Script != nil {
+			declarative = false
+		}
+	}
+	id := NewCorrelationID()
+	if declarative {
+		id = CacheKey(describeSteps(p.Steps))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pipelines[p.Name] = &registeredPipeline{TransformPipeline: p, id: id}
+	if _, ok := t.metrics[p.Name]; !ok {
+		t.metrics[p.Name] = &TransformMetrics{}
+	}
+	return nil
+}
+
+// Names lists the registered pipelines, sorted
+func (t *StateTransforms) Names() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	names := make([]string, 0, len(t.pipelines))
+	for name := range t.pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run passes the values state shows this spell through the pipeline and
+// returns the result, leaving state alone
+func (t *StateTransforms) Run(name string, state *SharedState) (map[string]interface{}, error) {
+	t.mu.Lock()
+	p, ok := t.pipelines[name]
+	t.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no transform %q is registered", name)
+	}
+
+	input := state.Values()
+	key := CacheKey(CacheTransform, name, p.id, input)
+	if !p.NoCache {
+		if cached, ok := t.cache.Get(CacheTransform, key); ok {
+			if result, ok := cached.(map[string]interface{}); ok {
+				t.record(name, func(m *TransformMetrics) {
+					m.Runs++
+					m.CacheHits++
+					m.KeysIn, m.KeysOut = len(input), len(result)
+				})
+				return copyValues(result), nil
+			}
+		}
+	} else {
+		t.cache.Bypass(CacheTransform)
+	}
+
+	start := time.Now()
+	result, redacted, err := p.run(input)
+	elapsed := time.Since(start)
+	t.record(name, func(m *TransformMetrics) {
+		m.Runs++
+		m.Duration += elapsed
+		m.Redacted += redacted
+		if err != nil {
+			m.Failures++
+			return
+		}
+		m.KeysIn, m.KeysOut = len(input), len(result)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("transform %q: %w", name, err)
+	}
+	if !p.NoCache {
+		t.cache.Put(CacheTransform, key, copyValues(result))
+	}
+	return result, nil
+}
+
+// Apply runs the pipeline and makes state hold its result: keys it set or
+// changed are set and keys it dropped are deleted. It returns the result.
+func (t *StateTransforms) Apply(name string, state *SharedState) (map[string]interface{}, error) {
+	result, err := t.Run(name, state)
+	if err != nil {
+		return nil, err
+	}
+	before := state.Values()
+	keys := make([]string, 0, len(result))
+	for key := range result {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := state.Set(key, result[key]); err != nil {
+			return nil, err
+		}
+	}
+	for key := range before {
+		if _, ok := result[key]; !ok {
+			if err := state.Delete(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// Metrics returns the metrics of each pipeline
+func (t *StateTransforms) Metrics() map[string]TransformMetrics {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	metrics := make(map[string]TransformMetrics, len(t.metrics))
+	for name, m := range t.metrics {
+		metrics[name] = *m
+	}
+	return metrics
+}
+
+func (t *StateTransforms) record(name string, update func(m *TransformMetrics)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	update(t.metrics[name])
+}
+
+// run passes values through the steps and returns the result and the
+// number of values redacted
+func (p *registeredPipeline) run(values map[string]interface{}) (map[string]interface{}, int, error) {
+	values = copyValues(values)
+	redacted := 0
+	for i, step := range p.Steps {
+		var err error
+		switch step.Kind {
+		case TransformMap:
+			err = eachKey(values, step.Keys, func(key string, value interface{}) error {
+				mapped, err := step.Value(key, value)
+				values[key] = mapped
+				return err
+			})
+		case TransformFilter:
+			kept := make(map[string]interface{}, len(values))
+			err = eachKey(values, step.Keys, func(key string, value interface{}) error {
+				keep := true
+				if step.Keep != nil {
+					var err error
+					if keep, err = step.Keep(key, value); err != nil {
+						return err
+					}
+				}
+				if keep {
+					kept[key] = value
+				}
+				return nil
+			})
+			values = kept
+		case TransformRedact:
+			replacement := step.Replacement
+			if replacement == nil {
+				replacement = DefaultRedaction
+			}
+			_ = eachKey(values, step.Keys, func(key string, value interface{}) error {
+				if len(step.Fields) == 0 {
+					values[key] = replacement
+					redacted++
+					return nil
+				}
+				var n int
+				values[key], n = redactFields(value, step.Fields, replacement)
+				redacted += n
+				return nil
+			})
+		case TransformRename:
+			renamed := make(map[string]interface{}, len(values))
+			for key, value := range values {
+				if to, ok := step.Names[key]; ok {
+					key = to
+				}
+				renamed[key] = value
+			}
+			values = renamed
+		case TransformScript:
+			values, err = step.Script(values)
+			if err == nil && values == nil {
+				values = make(map[string]interface{})
+			}
+		}
+		if err != nil {
+			return nil, redacted, fmt.Errorf("step %d (%s): %w", i+1, step.Kind, err)
+		}
+	}
+	return values, redacted, nil
+}
+
+// eachKey calls fn with each key of values matching patterns, in order
+func eachKey(values map[string]interface{}, patterns []string, fn func(key string, value interface{}) error) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if matchesAny(patterns, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(key, values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchesAny reports whether key matches one of patterns, or patterns is
+// empty
+func matchesAny(patterns []string, key string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// redactFields returns value with the fields named in fields replaced at
+// any depth, copying the tables it changes, and how many it replaced
+func redactFields(value interface{}, fields []string, replacement interface{}) (interface{}, int) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		count := 0
+		for key, field := range v {
+			if matchesAny(fields, key) {
+				out[key] = replacement
+				count++
+				continue
+			}
+			var n int
+			out[key], n = redactFields(field, fields, replacement)
+			count += n
+		}
+		return out, count
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		count := 0
+		for i, item := range v {
+			var n int
+			out[i], n = redactFields(item, fields, replacement)
+			count += n
+		}
+		return out, count
+	}
+	return value, 0
+}
+
+// checkStep reports a step missing what its kind needs
+func checkStep(step TransformStep) error {
+	switch step.Kind {
+	case TransformMap:
+		if step.Value == nil {
+			return fmt.Errorf("map needs a function")
+		}
+	case TransformFilter, TransformRedact:
+	case TransformRename:
+		if len(step.Names) == 0 {
+			return fmt.Errorf("rename needs names")
+		}
+	case TransformScript:
+		if step.Script == nil {
+			return fmt.Errorf("script needs a function")
+		}
+	default:
+		return fmt.Errorf("unknown kind %q, use map, filter, redact, rename, or script", step.Kind)
+	}
+	return nil
+}
+
+// describeSteps returns the data of steps, to identify them
+func describeSteps(steps []TransformStep) []interface{} {
+	described := make([]interface{}, len(steps))
+	for i, step := range steps {
+		described[i] = map[string]interface{}{
+			"kind":        step.Kind,
+			"keys":        step.Keys,
+			"fields":      step.Fields,
+			"replacement": step.Replacement,
+			"names":       step.Names,
+		}
+	}
+	return described
+}
+
+// copyValues returns a shallow copy of values
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,156 @@
+// ABOUTME: Tests for transform pipelines over shared state
+// ABOUTME: Validates each kind of step, applying results, metrics, and memoizing in the result cache
+
+package bridge
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStateTransforms(t *testing.T) {
+	newState := func() *SharedState {
+		state := NewSharedState()
+		_ = state.Set("user", map[string]interface{}{
+			"name":  "ada",
+			"token": "secret",
+			"keys":  []interface{}{map[string]interface{}{"token": "nested"}},
+		})
+		_ = state.Set("public.topic", "tides")
+		_ = state.Set("public.count", float64(2))
+		_ = state.Set("scratch", "x")
+		return state
+	}
+
+	t.Run("steps run in order", func(t *testing.T) {
+		transforms := NewStateTransforms(nil)
+		err := transforms.Register(TransformPipeline{Name: "export", Steps: []TransformStep{
+			{Kind: TransformFilter, Keys: []string{"user", "public.*"}},
+			{Kind: TransformFilter, Keep: func(key string, value interface{}) (bool, error) { return key != "public.count", nil }},
+			{Kind: TransformRedact, Keys: []string{"user"}, Fields: []string{"token"}},
+			{Kind: TransformMap, Keys: []string{"public.*"}, Value: func(key string, value interface{}) (interface{}, error) {
+				return strings.ToUpper(value.(string)), nil
+			}},
+			{Kind: TransformRename, Names: map[string]string{"public.topic": "topic"}},
+			{Kind: TransformScript, Script: func(values map[string]interface{}) (map[string]interface{}, error) {
+				values["exported"] = true
+				return values, nil
+			}},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state := newState()
+		result, err := transforms.Run("export", state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{
+			"user": map[string]interface{}{
+				"name":  "ada",
+				"token": DefaultRedaction,
+				"keys":  []interface{}{map[string]interface{}{"token": DefaultRedaction}},
+			},
+			"topic":    "TIDES",
+			"exported": true,
+		}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("Run() = %v, want %v", result, want)
+		}
+		if user, _ := state.Get("user"); user.(map[string]interface{})["token"] != "secret" {
+			t.Error("Expected Run() to leave the state and its values alone")
+		}
+
+		metrics := transforms.Metrics()["export"]
+		if metrics.Runs != 1 || metrics.KeysIn != 4 || metrics.KeysOut != 3 || metrics.Redacted != 2 {
+			t.Errorf("Metrics() = %+v", metrics)
+		}
+	})
+
+	t.Run("apply makes state hold the result", func(t *testing.T) {
+		transforms := NewStateTransforms(nil)
+		_ = transforms.Register(TransformPipeline{Name: "tidy", Steps: []TransformStep{
+			{Kind: TransformFilter, Keys: []string{"public.*"}},
+			{Kind: TransformRedact, Keys: []string{"public.count"}, Replacement: float64(0)},
+		}})
+		state := newState()
+		if _, err := transforms.Apply("tidy", state); err != nil {
+			t.Fatal(err)
+		}
+		if got := state.Keys(); !reflect.DeepEqual(got, []string{"public.count", "public.topic"}) {
+			t.Errorf("Keys() after Apply() = %v", got)
+		}
+		if count, _ := state.Get("public.count"); count != float64(0) {
+			t.Errorf("public.count = %v, want the replacement", count)
+		}
+	})
+
+	t.Run("results are memoized by pipeline and input", func(t *testing.T) {
+		cache := NewResultCache(ResultCacheOptions{})
+		transforms := NewStateTransforms(cache)
+		calls := 0
+		_ = transforms.Register(TransformPipeline{Name: "count", Steps: []TransformStep{
+			{Kind: TransformScript, Script: func(values map[string]interface{}) (map[string]interface{}, error) {
+				calls++
+				return map[string]interface{}{"n": float64(len(values))}, nil
+			}},
+		}})
+
+		state := newState()
+		for i := 0; i < 2; i++ {
+			if result, err := transforms.Run("count", state); err != nil || result["n"] != float64(4) {
+				t.Fatalf("Run() = %v, %v", result, err)
+			}
+		}
+		_ = state.Set("more", true)
+		_, _ = transforms.Run("count", state)
+		if calls != 2 {
+			t.Errorf("Expected the pipeline to run once per input, ran %d times", calls)
+		}
+		if metrics := transforms.Metrics()["count"]; metrics.Runs != 3 || metrics.CacheHits != 1 {
+			t.Errorf("Metrics() = %+v", metrics)
+		}
+		if stats := cache.Stats()[CacheTransform]; stats.Hits != 1 || stats.Misses != 2 {
+			t.Errorf("cache stats = %+v", stats)
+		}
+
+		_ = transforms.Register(TransformPipeline{Name: "count", NoCache: true, Steps: []TransformStep{
+			{Kind: TransformScript, Script: func(values map[string]interface{}) (map[string]interface{}, error) {
+				calls++
+				return values, nil
+			}},
+		}})
+		_, _ = transforms.Run("count", state)
+		_, _ = transforms.Run("count", state)
+		if calls != 4 || cache.Stats()[CacheTransform].Bypassed != 2 {
+			t.Errorf("Expected NoCache to run every time, ran %d times", calls)
+		}
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		transforms := NewStateTransforms(nil)
+		if err := transforms.Register(TransformPipeline{Name: "bad", Steps: []TransformStep{{Kind: "sort"}}}); err == nil {
+			t.Error("Expected an unknown kind of step to be rejected")
+		}
+		if err := transforms.Register(TransformPipeline{Name: "bad", Steps: []TransformStep{{Kind: TransformMap}}}); err == nil {
+			t.Error("Expected a map without a function to be rejected")
+		}
+		if _, err := transforms.Run("missing", NewSharedState()); err == nil {
+			t.Error("Expected running an unknown pipeline to fail")
+		}
+
+		boom := errors.New("boom")
+		_ = transforms.Register(TransformPipeline{Name: "fails", Steps: []TransformStep{
+			{Kind: TransformMap, Value: func(string, interface{}) (interface{}, error) { return nil, boom }},
+		}})
+		if _, err := transforms.Run("fails", newState()); !errors.Is(err, boom) {
+			t.Errorf("Run() error = %v, want the step's error", err)
+		}
+		if metrics := transforms.Metrics()["fails"]; metrics.Failures != 1 {
+			t.Errorf("Metrics() = %+v, want a failure", metrics)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+// ABOUTME: Call counting for bridge methods and tool executions
+// ABOUTME: Aggregates calls, failures, and time per name for end-of-run reporting
+
+package bridge
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// CallStat summarizes the calls made under one name
+type CallStat struct {
+	Name     string        `json:"name"`
+	Calls    int           `json:"calls"`
+	Failures int           `json:"failures"`
+	Duration time.Duration `json:"duration_ns"`
+
+	// CacheHits are the calls answered from a cache, also counted in Calls
+	CacheHits int `json:"cache_hits,omitempty"`
+}
+
+// Successes returns the number of calls that did not fail
+func (s CallStat) Successes() int {
+	return s.Calls - s.Failures
+}
+
+// CallStats counts calls by name. It is safe for concurrent use.
+type CallStats struct {
+	mu    sync.Mutex
+	stats map[string]*CallStat
+}
+
+// NewCallStats creates an empty counter
+func NewCallStats() *CallStats {
+	return &CallStats{stats: make(map[string]*CallStat)}
+}
+
+// Record adds one call
+func (cs *CallStats) Record(name string, failed bool, d time.Duration) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	stat, ok := cs.stats[name]
+	if !ok {
+		stat = &CallStat{Name: name}
+		cs.stats[name] = stat
+	}
+	stat.Calls++
+	if failed {
+		stat.Failures++
+	}
+	stat.Duration += d
+}
+
+// RecordHit adds one call answered from a cache
+func (cs *CallStats) RecordHit(name string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	stat, ok := cs.stats[name]
+	if !ok {
+		stat = &CallStat{Name: name}
+		cs.stats[name] = stat
+	}
+	stat.Calls++
+	stat.CacheHits++
+}
+
+// Snapshot returns the current counts sorted by name
+func (cs *CallStats) Snapshot() []CallStat {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	list := make([]CallStat, 0, len(cs.stats))
+	for _, stat := range cs.stats {
+		list = append(list, *stat)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Total returns the number of calls recorded across all names
+func (cs *CallStats) Total() int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	total := 0
+	for _, stat := range cs.stats {
+		total += stat.Calls
+	}
+	return total
+}
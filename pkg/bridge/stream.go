@@ -0,0 +1,62 @@
+// ABOUTME: Position tracking for streamed LLM responses, so interrupted streams can be resumed
+// ABOUTME: A stream that breaks off reports the text delivered so far and where it stopped
+
+package bridge
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrStreamIncomplete is wrapped by a StreamError when the provider closed
+// the stream without saying the response was finished, as happens when the
+// connection drops
+var ErrStreamIncomplete = errors.New("stream ended before the response finished")
+
+// ErrStopStream is returned by a stream callback to end the stream early,
+// keeping what it received; the stream then reports no error
+var ErrStopStream = errors.New("stream stopped by the callback")
+
+// StreamPosition is how far a streamed response got. Chunks counts the
+// chunks delivered, so the next chunk has sequence number Chunks+1, and
+// Offset is the length in bytes of Partial, the text delivered so far.
+type StreamPosition struct {
+	Chunks  int    `json:"chunks"`
+	Offset  int    `json:"offset"`
+	Partial string `json:"partial"`
+}
+
+// advance records one more delivered chunk
+func (p *StreamPosition) advance(chunk string) {
+	p.Chunks++
+	p.Offset += len(chunk)
+	p.Partial += chunk
+}
+
+// StreamError reports a stream that stopped before the response finished,
+// because the connection dropped or the spell was cancelled. Its position
+// lets the spell keep the partial text or resume from it.
+type StreamError struct {
+	StreamPosition
+	Err error
+}
+
+// Error describes where the stream stopped and why
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("stream interrupted after %d chunks (%d bytes): %v", e.Chunks, e.Offset, e.Err)
+}
+
+// Unwrap returns why the stream stopped
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// StreamPositionOf returns where an interrupted stream stopped, if err
+// reports one
+func StreamPositionOf(err error) (StreamPosition, bool) {
+	var streamErr *StreamError
+	if errors.As(err, &streamErr) {
+		return streamErr.StreamPosition, true
+	}
+	return StreamPosition{}, false
+}
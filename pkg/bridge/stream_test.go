@@ -0,0 +1,113 @@
+// ABOUTME: Tests for interrupted and resumed LLM streams
+// ABOUTME: Verifies partial output is reported and resumed streams prefill the reply
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+)
+
+// droppingStream streams chunks and closes without a finished token, as a
+// provider does when the connection drops
+func droppingStream(chunks ...string) domain.ResponseStream {
+	ch := make(chan domain.Token, len(chunks))
+	for _, chunk := range chunks {
+		ch <- domain.Token{Text: chunk}
+	}
+	close(ch)
+	return ch
+}
+
+func TestStreamChatInterrupted(t *testing.T) {
+	bridge := &LLMBridge{
+		providers: map[string]domain.Provider{
+			"test": &MockProvider{
+				streamMsgFunc: func(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.ResponseStream, error) {
+					return droppingStream("Once ", "upon "), nil
+				},
+			},
+		},
+		current: "test",
+	}
+
+	var received []string
+	err := bridge.StreamChat(context.Background(), "tell a story", func(chunk string) error {
+		received = append(received, chunk)
+		return nil
+	})
+	if !errors.Is(err, ErrStreamIncomplete) {
+		t.Fatalf("expected ErrStreamIncomplete, got %v", err)
+	}
+
+	position, ok := StreamPositionOf(err)
+	if !ok {
+		t.Fatalf("expected a stream position in %v", err)
+	}
+	want := StreamPosition{Chunks: 2, Offset: 10, Partial: "Once upon "}
+	if position != want {
+		t.Errorf("expected position %+v, got %+v", want, position)
+	}
+	if strings.Join(received, "") != position.Partial {
+		t.Errorf("partial %q does not match delivered chunks %q", position.Partial, received)
+	}
+}
+
+func TestStreamChatCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cause := errors.New("stopped")
+
+	bridge := &LLMBridge{providers: map[string]domain.Provider{"test": &MockProvider{}}, current: "test"}
+	err := bridge.StreamChat(ctx, "test prompt", func(chunk string) error {
+		cancel(cause)
+		return nil
+	})
+	if !errors.Is(err, cause) {
+		t.Fatalf("expected the cancellation cause, got %v", err)
+	}
+	if position, ok := StreamPositionOf(err); !ok || position.Chunks == 0 {
+		t.Errorf("expected delivered chunks to be reported, got %+v", position)
+	}
+}
+
+func TestResumeStreamChat(t *testing.T) {
+	var sent []domain.Message
+	bridge := &LLMBridge{
+		providers: map[string]domain.Provider{
+			"test": &MockProvider{
+				streamMsgFunc: func(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.ResponseStream, error) {
+					sent = messages
+					ch := make(chan domain.Token, 1)
+					ch <- domain.Token{Text: "a time", Finished: true}
+					close(ch)
+					return ch, nil
+				},
+			},
+		},
+		current: "test",
+	}
+
+	from := StreamPosition{Chunks: 2, Offset: 10, Partial: "Once upon "}
+	var rest strings.Builder
+	err := bridge.ResumeStreamChat(context.Background(), "tell a story", from, func(chunk string) error {
+		rest.WriteString(chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rest.String() != "a time" {
+		t.Errorf("expected only the continuation, got %q", rest.String())
+	}
+
+	if len(sent) != 2 {
+		t.Fatalf("expected prompt and prefilled reply, got %d messages", len(sent))
+	}
+	if sent[1].Role != domain.RoleAssistant || sent[1].Content[0].Text != from.Partial {
+		t.Errorf("expected the partial reply as an assistant message, got %+v", sent[1])
+	}
+}
@@ -0,0 +1,121 @@
+// ABOUTME: Structured output: asks the LLM for JSON matching a schema and validates what comes back
+// ABOUTME: Invalid output is sent back with the validation errors as a repair prompt, up to a number of retries
+
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lexlapax/go-llms/pkg/structured/processor"
+)
+
+// DefaultStructuredRetries is how many repair prompts GenerateStructured
+// sends unless the options say otherwise
+const DefaultStructuredRetries = 2
+
+// StructuredOptions configure GenerateStructured
+type StructuredOptions struct {
+	// Retries is how many repair prompts are sent after invalid output;
+	// a negative value sends none, zero uses DefaultStructuredRetries
+	Retries int
+}
+
+// retries returns the number of repair prompts to send
+func (o StructuredOptions) retries() int {
+	switch {
+	case o.Retries < 0:
+		return 0
+	case o.Retries == 0:
+		return DefaultStructuredRetries
+	}
+	return o.Retries
+}
+
+// StructuredResult is output that matched its schema
+type StructuredResult struct {
+	Value    interface{} `json:"value"`
+	Raw      string      `json:"raw"`
+	Attempts int         `json:"attempts"`
+}
+
+// StructuredError is returned when no attempt produced output matching the
+// schema. Err is the problem with the last output: a *validation.Result,
+// or the reason it was not JSON.
+type StructuredError struct {
+	Attempts int
+	Raw      string
+	Err      error
+}
+
+func (e *StructuredError) Error() string {
+	return fmt.Sprintf("output did not match the schema after %d attempt(s): %v", e.Attempts, e.Err)
+}
+
+func (e *StructuredError) Unwrap() error {
+	return e.Err
+}
+
+// GenerateStructured asks for a JSON value matching schema, validated with
+// ValidateSchema. When the output is not JSON or does not match, the
+// output and what is wrong with it go back to the model in a repair
+// prompt, up to opts' retries. Each attempt is a chat call, so replays,
+// caching and routing apply to it. Errors from the calls themselves are
+// returned as they are; invalid output after the last attempt is returned
+// as a *StructuredError.
+func (b *LLMBridge) GenerateStructured(ctx context.Context, prompt string, schema map[string]interface{}, opts StructuredOptions) (StructuredResult, error) {
+	if len(schema) == 0 {
+		return StructuredResult{}, fmt.Errorf("a schema is required")
+	}
+	schemaJSON, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return StructuredResult{}, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	messages := []ChatMessage{textMessage("user", prompt+
+		"\n\nRespond with only a JSON value matching this JSON schema, without any other text:\n"+string(schemaJSON))}
+	attempts := opts.retries() + 1
+	var invalid *StructuredError
+	for attempt := 1; attempt <= attempts; attempt++ {
+		response, err := b.ChatMessages(ctx, messages)
+		if err != nil {
+			return StructuredResult{}, err
+		}
+
+		value, err := parseStructured(response, schema)
+		if err == nil {
+			return StructuredResult{Value: value, Raw: response, Attempts: attempt}, nil
+		}
+		invalid = &StructuredError{Attempts: attempt, Raw: response, Err: err}
+		messages = append(messages,
+			textMessage("assistant", response),
+			textMessage("user", "That response is not valid: "+err.Error()+
+				"\nRespond again with only the corrected JSON value matching the schema."))
+	}
+	return StructuredResult{}, invalid
+}
+
+// parseStructured extracts the JSON value of a response, which may be
+// wrapped in prose or a code fence, and validates it against schema
+func parseStructured(response string, schema map[string]interface{}) (interface{}, error) {
+	text := processor.ExtractJSON(response)
+	if text == "" {
+		text = strings.TrimSpace(response)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, errors.New("the response is not JSON")
+	}
+	if err := ValidateSchema(value, schema); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// textMessage is a message of role with text as its content
+func textMessage(role, text string) ChatMessage {
+	return ChatMessage{Role: role, Content: []ChatPart{{Type: "text", Text: text}}}
+}
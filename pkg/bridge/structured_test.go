@@ -0,0 +1,102 @@
+// ABOUTME: Tests for structured output generation
+// ABOUTME: Validates JSON extraction, schema validation, repair prompts, and the error after the last retry
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/go-llms/pkg/llm/domain"
+	"github.com/lexlapax/go-llmspell/pkg/validation"
+)
+
+func TestGenerateStructured(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"name", "age"},
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string"},
+			"age":  map[string]interface{}{"type": "integer", "minimum": float64(0)},
+		},
+	}
+
+	// structuredBridge answers with each of responses in turn, recording
+	// the conversations it was sent
+	structuredBridge := func(responses []string, sent *[][]domain.Message) *LLMBridge {
+		return &LLMBridge{
+			providers: map[string]domain.Provider{"mock": &MockProvider{
+				generateMsgFunc: func(ctx context.Context, messages []domain.Message, options ...domain.Option) (domain.Response, error) {
+					*sent = append(*sent, messages)
+					response := responses[0]
+					if len(responses) > 1 {
+						responses = responses[1:]
+					}
+					return domain.Response{Content: response}, nil
+				},
+			}},
+			current: "mock",
+		}
+	}
+
+	t.Run("extracts valid output", func(t *testing.T) {
+		var sent [][]domain.Message
+		bridge := structuredBridge([]string{"Here you go:\n```json\n{\"name\": \"Ada\", \"age\": 36}\n```"}, &sent)
+
+		result, err := bridge.GenerateStructured(context.Background(), "Describe Ada", schema, StructuredOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{"name": "Ada", "age": float64(36)}
+		if !reflect.DeepEqual(result.Value, want) || result.Attempts != 1 {
+			t.Errorf("GenerateStructured() = %+v", result)
+		}
+		if prompt := sent[0][0].Content[0].Text; !strings.Contains(prompt, "Describe Ada") || !strings.Contains(prompt, `"required"`) {
+			t.Errorf("Expected the prompt to include the schema, got %q", prompt)
+		}
+	})
+
+	t.Run("repairs invalid output", func(t *testing.T) {
+		var sent [][]domain.Message
+		bridge := structuredBridge([]string{"not json", `{"name": "Ada", "age": -1}`, `{"name": "Ada", "age": 36}`}, &sent)
+
+		result, err := bridge.GenerateStructured(context.Background(), "Describe Ada", schema, StructuredOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Attempts != 3 || len(sent) != 3 {
+			t.Errorf("Expected three attempts, got %d after %d calls", result.Attempts, len(sent))
+		}
+		last := sent[2]
+		if len(last) != 5 || last[3].Role != domain.RoleAssistant {
+			t.Fatalf("Expected the conversation to carry the invalid outputs, got %d messages", len(last))
+		}
+		if repair := last[4].Content[0].Text; !strings.Contains(repair, "age") {
+			t.Errorf("Expected the repair prompt to name the invalid field, got %q", repair)
+		}
+	})
+
+	t.Run("returns validation errors after the last retry", func(t *testing.T) {
+		var sent [][]domain.Message
+		bridge := structuredBridge([]string{`{"name": "Ada"}`}, &sent)
+
+		_, err := bridge.GenerateStructured(context.Background(), "Describe Ada", schema, StructuredOptions{Retries: 1})
+		var structuredErr *StructuredError
+		if !errors.As(err, &structuredErr) || structuredErr.Attempts != 2 || len(sent) != 2 {
+			t.Fatalf("Expected a StructuredError after two attempts, got %v", err)
+		}
+		var result *validation.Result
+		if !errors.As(err, &result) || result.Errors[0].Field != "age" {
+			t.Errorf("Expected the validation result of the last output, got %v", err)
+		}
+	})
+
+	t.Run("requires a schema", func(t *testing.T) {
+		if _, err := (&LLMBridge{}).GenerateStructured(context.Background(), "hi", nil, StructuredOptions{}); err == nil {
+			t.Error("Expected an error without a schema")
+		}
+	})
+}
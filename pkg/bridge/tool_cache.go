@@ -0,0 +1,112 @@
+// ABOUTME: Result cache for deterministic tools, keyed by tool name and canonical parameters
+// ABOUTME: Results are stored as JSON in a CacheBackend, which bounds their number, size, and lifetime
+
+package bridge
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+// toolCache stores the results of deterministic tools in a backend
+type toolCache struct {
+	backend CacheBackend
+	ttl     time.Duration
+
+	// keys are the entries this cache has read or written, by tool, so
+	// they can be dropped when the tool changes
+	mu   sync.Mutex
+	keys map[string]map[string]bool
+}
+
+// SetResultCache answers calls to deterministic tools that repeat earlier
+// parameters from backend, keeping results for ttl (zero until evicted).
+// Results are stored as JSON, so a cached result comes back as its JSON
+// decoding. A nil backend turns the cache off.
+func (tb *ToolBridge) SetResultCache(backend CacheBackend, ttl time.Duration) {
+	if backend == nil {
+		tb.results.Store(nil)
+		return
+	}
+	tb.results.Store(&toolCache{backend: backend, ttl: ttl})
+}
+
+// resultCache returns the cache for a tool's results, nil if they may not
+// be cached
+func (tb *ToolBridge) resultCache(tool tools.Tool) *toolCache {
+	if !tools.IsDeterministic(tool) {
+		return nil
+	}
+	return tb.results.Load()
+}
+
+// toolCacheKey derives the key of a call from the tool's name and its
+// parameters, whose maps encode with sorted keys
+func toolCacheKey(name string, params map[string]interface{}) string {
+	return "tool\x00" + name + "\x00" + CacheKey(params)
+}
+
+// get returns the cached result of a call; a nil cache never hits
+func (c *toolCache) get(name string, params map[string]interface{}) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	key := toolCacheKey(name, params)
+	data, ok := c.backend.Get(key)
+	if !ok {
+		return nil, false
+	}
+	c.track(name, key)
+	var result interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, false
+	}
+	return result, true
+}
+
+// put caches the result of a call. Results that cannot be encoded, or that
+// the backend refuses as too large, are not cached.
+func (c *toolCache) put(name string, params map[string]interface{}, result interface{}) {
+	if c == nil {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	key := toolCacheKey(name, params)
+	if c.backend.Set(key, data, c.ttl) == nil {
+		c.track(name, key)
+	}
+}
+
+// track remembers that key holds a result of the tool name
+func (c *toolCache) track(name, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		c.keys = make(map[string]map[string]bool)
+	}
+	if c.keys[name] == nil {
+		c.keys[name] = make(map[string]bool)
+	}
+	c.keys[name][key] = true
+}
+
+// forget drops the results of the tool name, which may no longer be what
+// it returns; a nil cache has none
+func (c *toolCache) forget(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	keys := c.keys[name]
+	delete(c.keys, name)
+	c.mu.Unlock()
+	for key := range keys {
+		c.backend.Delete(key)
+	}
+}
@@ -0,0 +1,122 @@
+// ABOUTME: Tests for caching the results of deterministic tools
+// ABOUTME: Validates keys from canonical parameters, cache hits in execution stats, failures, and expiry
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+func TestToolBridgeResultCache(t *testing.T) {
+	bridge := NewToolBridge(tools.NewRegistry())
+	backend := NewMemoryCache(10, 1024)
+	bridge.SetResultCache(backend, 0)
+
+	runs := map[string]int{}
+	handler := func(name string) tools.ToolFunc {
+		return func(_ context.Context, p map[string]interface{}) (interface{}, error) {
+			runs[name]++
+			if p["fail"] == true {
+				return nil, errors.New("failed")
+			}
+			return map[string]interface{}{"sum": p["a"].(float64) + p["b"].(float64)}, nil
+		}
+	}
+	params := map[string]interface{}{"type": "object"}
+	bridge.RegisterToolWith("add", "Adds", params, handler("add"), ToolOptions{Deterministic: true})
+	bridge.RegisterToolWith("add_now", "Adds, but not deterministically", params, handler("add_now"), ToolOptions{})
+
+	ctx := context.Background()
+	for _, p := range []map[string]interface{}{
+		{"a": 1.0, "b": 2.0},
+		{"b": 2.0, "a": 1.0},
+		{"a": 2.0, "b": 2.0},
+	} {
+		if _, err := bridge.ExecuteTool(ctx, "add", p); err != nil {
+			t.Fatal(err)
+		}
+		bridge.ExecuteTool(ctx, "add_now", p)
+	}
+	result, err := bridge.ExecuteTool(ctx, "add", map[string]interface{}{"a": 1.0, "b": 2.0})
+	if err != nil || result.(map[string]interface{})["sum"] != 3.0 {
+		t.Errorf("Expected the cached result, got %v, %v", result, err)
+	}
+	if runs["add"] != 2 || runs["add_now"] != 3 {
+		t.Errorf("Expected only new parameters to run the deterministic tool, got %v", runs)
+	}
+
+	// Failures are not cached
+	for i := 0; i < 2; i++ {
+		bridge.ExecuteTool(ctx, "add", map[string]interface{}{"fail": true})
+	}
+	if runs["add"] != 4 {
+		t.Errorf("Expected failed calls to run again, got %d runs", runs["add"])
+	}
+
+	stats := bridge.ExecutionStats()
+	if stats[0].Name != "add" || stats[0].Calls != 6 || stats[0].CacheHits != 2 || stats[0].Failures != 2 {
+		t.Errorf("Unexpected stats: %+v", stats[0])
+	}
+	if info, _ := bridge.GetTool("add"); info["deterministic"] != true {
+		t.Errorf("Expected the tool to be listed as deterministic, got %v", info)
+	}
+
+	// Results expire after the TTL
+	bridge.SetResultCache(backend, time.Millisecond)
+	bridge.ExecuteTool(ctx, "add", map[string]interface{}{"a": 5.0, "b": 5.0})
+	time.Sleep(5 * time.Millisecond)
+	bridge.ExecuteTool(ctx, "add", map[string]interface{}{"a": 5.0, "b": 5.0})
+	if runs["add"] != 6 {
+		t.Errorf("Expected an expired result to run again, got %d runs", runs["add"])
+	}
+
+	// Without a cache every call runs
+	bridge.SetResultCache(nil, 0)
+	bridge.ExecuteTool(ctx, "add", map[string]interface{}{"a": 1.0, "b": 2.0})
+	if runs["add"] != 7 {
+		t.Errorf("Expected the call to run without a cache, got %d runs", runs["add"])
+	}
+}
+
+func TestToolBridgeResultCacheReregister(t *testing.T) {
+	bridge := NewToolBridge(tools.NewRegistry())
+	backend := NewMemoryCache(10, 1024)
+	bridge.SetResultCache(backend, 0)
+
+	returning := func(version string) tools.ToolFunc {
+		return func(context.Context, map[string]interface{}) (interface{}, error) {
+			return version, nil
+		}
+	}
+	params := map[string]interface{}{"type": "object"}
+	ctx := context.Background()
+	call := map[string]interface{}{"x": 1.0}
+	options := ToolCallOptions{IdempotencyKey: "once"}
+
+	bridge.RegisterToolWith("calc", "Calculates", params, returning("v1"), ToolOptions{Deterministic: true})
+	if result, _ := bridge.ExecuteTool(ctx, "calc", call); result != "v1" {
+		t.Fatalf("Expected v1, got %v", result)
+	}
+	if result, _ := bridge.ExecuteToolWith(ctx, "calc", call, options); result != "v1" {
+		t.Fatalf("Expected v1, got %v", result)
+	}
+
+	if err := bridge.RemoveTool("calc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := backend.Get(toolCacheKey("calc", call)); ok {
+		t.Error("Expected removing the tool to drop its cached results")
+	}
+	bridge.RegisterToolWith("calc", "Calculates", params, returning("v2"), ToolOptions{Deterministic: true})
+	if result, _ := bridge.ExecuteTool(ctx, "calc", call); result != "v2" {
+		t.Errorf("Expected the re-registered tool to run, got %v", result)
+	}
+	if result, _ := bridge.ExecuteToolWith(ctx, "calc", call, options); result != "v2" {
+		t.Errorf("Expected the idempotency key to reach the re-registered tool, got %v", result)
+	}
+}
@@ -0,0 +1,223 @@
+// ABOUTME: Tool execution statistics kept across runs, and reports of usage, trends, and anomalies over time windows
+// ABOUTME: A ToolMetricsStore holds one row per tool per run; reports compare a window with the one before it
+
+package bridge
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ToolRun is what one spell run recorded for one tool
+type ToolRun struct {
+	RunID string    `json:"run_id"`
+	Spell string    `json:"spell"`
+	Time  time.Time `json:"time"`
+	CallStat
+}
+
+// ToolMetricsStore keeps the tool statistics of past runs
+type ToolMetricsStore interface {
+	// RecordToolRuns adds the statistics of a run
+	RecordToolRuns(runs []ToolRun) error
+
+	// ToolRuns returns the statistics recorded at or after since, oldest
+	// first
+	ToolRuns(since time.Time) ([]ToolRun, error)
+
+	// PruneToolRuns deletes the statistics recorded before before and
+	// returns how many rows it deleted
+	PruneToolRuns(before time.Time) (int, error)
+}
+
+// ToolRunsOf turns a run's tool statistics into rows for a metrics store
+func ToolRunsOf(runID, spell string, at time.Time, stats []CallStat) []ToolRun {
+	runs := make([]ToolRun, len(stats))
+	for i, stat := range stats {
+		runs[i] = ToolRun{RunID: runID, Spell: spell, Time: at, CallStat: stat}
+	}
+	return runs
+}
+
+// MemoryToolMetrics keeps tool statistics in memory. It is safe for
+// concurrent use.
+type MemoryToolMetrics struct {
+	mu   sync.Mutex
+	runs []ToolRun
+}
+
+// NewMemoryToolMetrics creates an empty in-memory metrics store
+func NewMemoryToolMetrics() *MemoryToolMetrics {
+	return &MemoryToolMetrics{}
+}
+
+// RecordToolRuns adds the statistics of a run
+func (m *MemoryToolMetrics) RecordToolRuns(runs []ToolRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs = append(m.runs, runs...)
+	sort.SliceStable(m.runs, func(i, j int) bool { return m.runs[i].Time.Before(m.runs[j].Time) })
+	return nil
+}
+
+// ToolRuns returns the statistics recorded at or after since, oldest first
+func (m *MemoryToolMetrics) ToolRuns(since time.Time) ([]ToolRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var runs []ToolRun
+	for _, run := range m.runs {
+		if !run.Time.Before(since) {
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+// PruneToolRuns deletes the statistics recorded before before
+func (m *MemoryToolMetrics) PruneToolRuns(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.runs[:0]
+	for _, run := range m.runs {
+		if !run.Time.Before(before) {
+			kept = append(kept, run)
+		}
+	}
+	pruned := len(m.runs) - len(kept)
+	m.runs = kept
+	return pruned, nil
+}
+
+// ToolUsage sums a tool's statistics over the runs of a window
+type ToolUsage struct {
+	Tool      string        `json:"tool"`
+	Runs      int           `json:"runs"`
+	Calls     int           `json:"calls"`
+	Failures  int           `json:"failures"`
+	CacheHits int           `json:"cache_hits"`
+	Duration  time.Duration `json:"duration_ns"`
+}
+
+// FailureRate returns the share of calls that failed
+func (u ToolUsage) FailureRate() float64 {
+	if u.Calls == 0 {
+		return 0
+	}
+	return float64(u.Failures) / float64(u.Calls)
+}
+
+// executed returns the calls that ran the tool rather than hitting a cache
+func (u ToolUsage) executed() int {
+	return u.Calls - u.CacheHits
+}
+
+// AverageDuration returns the average time of the calls that ran the tool
+func (u ToolUsage) AverageDuration() time.Duration {
+	if u.executed() <= 0 {
+		return 0
+	}
+	return u.Duration / time.Duration(u.executed())
+}
+
+// ToolTrend is a tool's usage in a window and in the window before it
+type ToolTrend struct {
+	ToolUsage
+	Previous ToolUsage `json:"previous"`
+}
+
+// ToolAnomaly is a change in a tool's behaviour worth a look
+type ToolAnomaly struct {
+	Tool string `json:"tool"`
+	// Kind is "failures" or "latency"
+	Kind     string  `json:"kind"`
+	Current  float64 `json:"current"`
+	Previous float64 `json:"previous"`
+}
+
+// String describes the anomaly
+func (a ToolAnomaly) String() string {
+	if a.Kind == "latency" {
+		return fmt.Sprintf("%s: average time rose from %s to %s", a.Tool,
+			time.Duration(a.Previous).Round(time.Millisecond), time.Duration(a.Current).Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%s: failure rate rose from %.0f%% to %.0f%%", a.Tool, a.Previous*100, a.Current*100)
+}
+
+// ToolReport describes tool usage over a window ending at To, compared
+// with the window of the same length before it
+type ToolReport struct {
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Tools     []ToolTrend   `json:"tools"`
+	Anomalies []ToolAnomaly `json:"anomalies"`
+}
+
+// Anomalies need this many calls in both windows to be reported, so a
+// single failure of a rarely used tool is not one
+const anomalyMinCalls = 5
+
+// NewToolReport reports on the runs of the window of length window ending
+// at now. runs should reach back two windows, for the comparison. A tool's
+// failure rate is anomalous when it is at least 20% and 10 points above
+// the previous window's; its average time when it has at least doubled.
+func NewToolReport(runs []ToolRun, now time.Time, window time.Duration) ToolReport {
+	from := now.Add(-window)
+	current := sumToolRuns(runs, from, now)
+	previous := sumToolRuns(runs, from.Add(-window), from)
+
+	report := ToolReport{From: from, To: now, Tools: []ToolTrend{}, Anomalies: []ToolAnomaly{}}
+	for name, usage := range current {
+		prev := previous[name]
+		prev.Tool = name
+		report.Tools = append(report.Tools, ToolTrend{ToolUsage: usage, Previous: prev})
+
+		if usage.Calls < anomalyMinCalls || prev.Calls < anomalyMinCalls {
+			continue
+		}
+		if rate, prevRate := usage.FailureRate(), prev.FailureRate(); rate >= 0.2 && rate-prevRate >= 0.1 {
+			report.Anomalies = append(report.Anomalies, ToolAnomaly{Tool: name, Kind: "failures", Current: rate, Previous: prevRate})
+		}
+		if usage.executed() >= anomalyMinCalls && prev.executed() >= anomalyMinCalls {
+			avg, prevAvg := usage.AverageDuration(), prev.AverageDuration()
+			if prevAvg > 0 && avg >= 2*prevAvg {
+				report.Anomalies = append(report.Anomalies, ToolAnomaly{Tool: name, Kind: "latency", Current: float64(avg), Previous: float64(prevAvg)})
+			}
+		}
+	}
+
+	// Busiest tools first
+	sort.Slice(report.Tools, func(i, j int) bool {
+		if report.Tools[i].Calls != report.Tools[j].Calls {
+			return report.Tools[i].Calls > report.Tools[j].Calls
+		}
+		return report.Tools[i].Tool < report.Tools[j].Tool
+	})
+	sort.Slice(report.Anomalies, func(i, j int) bool {
+		if report.Anomalies[i].Tool != report.Anomalies[j].Tool {
+			return report.Anomalies[i].Tool < report.Anomalies[j].Tool
+		}
+		return report.Anomalies[i].Kind < report.Anomalies[j].Kind
+	})
+	return report
+}
+
+// sumToolRuns sums the runs recorded after from and up to to by tool
+func sumToolRuns(runs []ToolRun, from, to time.Time) map[string]ToolUsage {
+	usage := make(map[string]ToolUsage)
+	for _, run := range runs {
+		if !run.Time.After(from) || run.Time.After(to) {
+			continue
+		}
+		u := usage[run.Name]
+		u.Tool = run.Name
+		u.Runs++
+		u.Calls += run.Calls
+		u.Failures += run.Failures
+		u.CacheHits += run.CacheHits
+		u.Duration += run.Duration
+		usage[run.Name] = u
+	}
+	return usage
+}
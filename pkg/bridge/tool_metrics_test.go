@@ -0,0 +1,60 @@
+// ABOUTME: Tests for tool usage reports built from the statistics of past runs
+// ABOUTME: Validates window sums, comparison with the previous window, and failure and latency anomalies
+
+package bridge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewToolReport(t *testing.T) {
+	now := time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	run := func(age time.Duration, stat CallStat) ToolRun {
+		return ToolRun{RunID: "r", Spell: "s", Time: now.Add(-age), CallStat: stat}
+	}
+	runs := []ToolRun{
+		// The week before
+		run(10*day, CallStat{Name: "web_fetch", Calls: 10, Failures: 1, Duration: time.Second}),
+		run(8*day, CallStat{Name: "summarize", Calls: 6, Duration: 600 * time.Millisecond}),
+		run(20*day, CallStat{Name: "web_fetch", Calls: 50}), // Outside both windows
+		// This week
+		run(2*day, CallStat{Name: "web_fetch", Calls: 6, Failures: 3, Duration: 600 * time.Millisecond}),
+		run(day, CallStat{Name: "web_fetch", Calls: 4, Failures: 1, Duration: 400 * time.Millisecond}),
+		run(day, CallStat{Name: "summarize", Calls: 8, CacheHits: 2, Duration: 1200 * time.Millisecond}),
+		run(0, CallStat{Name: "new_tool", Calls: 1}),
+	}
+
+	report := NewToolReport(runs, now, 7*day)
+	if !report.From.Equal(now.Add(-7*day)) || !report.To.Equal(now) {
+		t.Errorf("Unexpected window %s - %s", report.From, report.To)
+	}
+	if len(report.Tools) != 3 || report.Tools[0].Tool != "web_fetch" || report.Tools[2].Tool != "new_tool" {
+		t.Fatalf("Expected the busiest tools first, got %+v", report.Tools)
+	}
+
+	fetch := report.Tools[0]
+	if fetch.Runs != 2 || fetch.Calls != 10 || fetch.Failures != 4 || fetch.FailureRate() != 0.4 {
+		t.Errorf("Unexpected usage %+v", fetch.ToolUsage)
+	}
+	if fetch.Previous.Calls != 10 || fetch.Previous.FailureRate() != 0.1 {
+		t.Errorf("Unexpected previous usage %+v", fetch.Previous)
+	}
+	if summarize := report.Tools[1]; summarize.AverageDuration() != 200*time.Millisecond || summarize.Previous.AverageDuration() != 100*time.Millisecond {
+		t.Errorf("Expected averages over the calls that ran, got %s and %s", summarize.AverageDuration(), summarize.Previous.AverageDuration())
+	}
+	if report.Tools[2].Previous.Calls != 0 {
+		t.Errorf("A new tool has no previous usage, got %+v", report.Tools[2].Previous)
+	}
+
+	if len(report.Anomalies) != 2 {
+		t.Fatalf("Expected two anomalies, got %+v", report.Anomalies)
+	}
+	if a := report.Anomalies[0]; a.Tool != "summarize" || a.Kind != "latency" || a.String() != "summarize: average time rose from 100ms to 200ms" {
+		t.Errorf("Unexpected anomaly %+v: %s", a, a)
+	}
+	if a := report.Anomalies[1]; a.Tool != "web_fetch" || a.Kind != "failures" || a.String() != "web_fetch: failure rate rose from 10% to 40%" {
+		t.Errorf("Unexpected anomaly %+v: %s", a, a)
+	}
+}
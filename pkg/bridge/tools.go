@@ -7,13 +7,67 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/lexlapax/go-llmspell/pkg/security"
 	"github.com/lexlapax/go-llmspell/pkg/tools"
 )
 
-// ToolBridge provides tool functionality to script environments
+// ToolBridge provides tool functionality to script environments.
+// Discovery goes through a cached catalog of the registry, and both do their
+// own locking, so it is safe for concurrent use.
 type ToolBridge struct {
-	registry tools.Registry
+	registry *tools.Catalog
+	docs     *tools.DocGenerator
+	execs    *CallStats
+
+	// watchdog abandons built-in tool executions that hang; nil waits
+	watchdog atomic.Pointer[Watchdog]
+
+	// guard applies per-tool rate limits and circuit breakers; nil allows
+	// every call
+	guard atomic.Pointer[security.ToolGuard]
+
+	// confirm asks before tools that require confirmation run; nil runs
+	// them without asking
+	confirm atomic.Pointer[security.ToolConfirmer]
+
+	// results caches the results of deterministic tools; nil caches none
+	results atomic.Pointer[toolCache]
+
+	// secrets are the credentials imported OpenAPI operations may use
+	secrets atomic.Pointer[SecretsConfig]
+
+	// checkURL and checkPath vet the URLs and files of OpenAPI imports;
+	// nil leaves them to the caller
+	checkURL  atomic.Pointer[func(*url.URL) error]
+	checkPath atomic.Pointer[func(string) (string, error)]
+
+	// infos caches ListTools output for one catalog version
+	infoMu      sync.Mutex
+	infos       []map[string]interface{}
+	infoVersion uint64
+
+	// rules are the custom validation rules schemas can name
+	ruleMu sync.RWMutex
+	rules  map[string]ValidationRule
+
+	// done holds the results of ExecuteToolWith calls by tool and
+	// idempotency key
+	doneMu sync.Mutex
+	done   map[string]completedCall
+}
+
+// scriptTool marks a tool registered from a script, as opposed to a
+// built-in or host-provided tool
+type scriptTool struct {
+	*tools.FunctionTool
 }
 
 // NewToolBridge creates a new tool bridge
@@ -21,8 +75,15 @@ func NewToolBridge(registry tools.Registry) *ToolBridge {
 	if registry == nil {
 		registry = tools.DefaultRegistry
 	}
+
+	catalog, ok := registry.(*tools.Catalog)
+	if !ok {
+		catalog = tools.NewCatalog(registry)
+	}
 	return &ToolBridge{
-		registry: registry,
+		registry: catalog,
+		docs:     tools.NewDocGenerator(),
+		execs:    NewCallStats(),
 	}
 }
 
@@ -37,44 +98,130 @@ func NewToolBridgeWithBuiltins(registry tools.Registry, config *tools.BuiltinToo
 		return nil, fmt.Errorf("failed to register built-in tools: %w", err)
 	}
 
-	return &ToolBridge{
-		registry: registry,
-	}, nil
+	return NewToolBridge(registry), nil
 }
 
 // RegisterTool registers a new tool from script
 func (tb *ToolBridge) RegisterTool(name, description string, parameters map[string]interface{}, fn func(map[string]interface{}) (interface{}, error)) error {
+	return tb.RegisterToolWith(name, description, parameters, func(_ context.Context, params map[string]interface{}) (interface{}, error) {
+		return fn(params)
+	}, ToolOptions{})
+}
+
+// ToolOptions describe a tool registered from script beyond its schema
+type ToolOptions struct {
+	// Deterministic says the tool's result depends only on its parameters,
+	// so it may be answered from the result cache
+	Deterministic bool
+
+	// Confirm says the tool changes things outside the spell, so it is
+	// confirmed before it runs
+	Confirm bool
+}
+
+// RegisterToolWith registers a new tool from script with options. fn gets
+// the context of each call, so it can stop when an agent or the caller
+// gives up on it.
+func (tb *ToolBridge) RegisterToolWith(name, description string, parameters map[string]interface{}, fn tools.ToolFunc, opts ToolOptions) error {
 	// Convert parameters to JSON
 	paramsJSON, err := json.Marshal(parameters)
 	if err != nil {
 		return fmt.Errorf("failed to marshal parameters: %w", err)
 	}
 
-	// Create a function tool
-	tool := tools.NewFunctionTool(
-		name,
-		description,
-		paramsJSON,
-		func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-			// Call the script function
-			return fn(params)
-		},
-	)
+	// Create a function tool, marked as script-registered
+	tool := &scriptTool{tools.NewFunctionTool(name, description, paramsJSON, fn).
+		WithDeterministic(opts.Deterministic).WithConfirmation(opts.Confirm)}
 
 	// Register the tool
-	return tb.registry.Register(tool)
+	if err := tb.registry.Register(tool); err != nil {
+		return err
+	}
+	tb.toolChanged(name)
+	tb.docs.Doc(tool) // snapshot this version for DocDiff
+	return nil
 }
 
-// ExecuteTool executes a tool by name
+// ExecuteTool executes a tool by name. A deterministic tool called again
+// with the same parameters is answered from the result cache, if there is
+// one; a call the tool guard refuses, or that requires confirmation and is
+// not confirmed, fails without running the tool.
 func (tb *ToolBridge) ExecuteTool(ctx context.Context, name string, params map[string]interface{}) (interface{}, error) {
 	// Get the tool
 	tool, err := tb.registry.Get(name)
 	if err != nil {
 		return nil, err
 	}
+	cache := tb.resultCache(tool)
+	if result, ok := cache.get(name, params); ok {
+		tb.execs.RecordHit(name)
+		return result, nil
+	}
+	if err := tb.confirm.Load().Confirm(ctx, name, tools.RequiresConfirmation(tool), params); err != nil {
+		return nil, err
+	}
+	guard := tb.guard.Load()
+	if err := guard.Allow(name); err != nil {
+		return nil, err
+	}
 
-	// Execute the tool
-	return tool.Execute(ctx, params)
+	// Execute the tool. Script tools run in the script engine, so only Go
+	// tools may be abandoned by the watchdog.
+	start := time.Now()
+	var result interface{}
+	if _, isScript := tool.(*scriptTool); isScript {
+		result, err = tool.Execute(ctx, params)
+	} else {
+		result, err = tb.watchdog.Load().Call(ctx, "tools.execute "+name, func(ctx context.Context) (interface{}, error) {
+			return tool.Execute(ctx, params)
+		})
+	}
+	tb.execs.Record(name, err != nil, time.Since(start))
+	// A call stopped by the caller says nothing about the tool
+	guard.Done(name, err != nil && ctx.Err() == nil)
+	if err == nil {
+		cache.put(name, params, result)
+	}
+	return result, err
+}
+
+// ExecuteToolAsync starts ExecuteTool in the background. Tools registered
+// from a script run in the script engine, so they run before it returns and
+// the future is already resolved.
+func (tb *ToolBridge) ExecuteToolAsync(ctx context.Context, name string, params map[string]interface{}) *Future {
+	tool, err := tb.registry.Get(name)
+	if err != nil {
+		return Resolved(nil, err)
+	}
+	if _, isScript := tool.(*scriptTool); isScript {
+		return Resolved(tb.ExecuteTool(ctx, name, params))
+	}
+	return Async(ctx, func(ctx context.Context, _ func(interface{})) (interface{}, error) {
+		return tb.ExecuteTool(ctx, name, params)
+	})
+}
+
+// SetWatchdog abandons executions of Go tools that outlive w's timeout;
+// nil waits for every execution to return
+func (tb *ToolBridge) SetWatchdog(w *Watchdog) {
+	tb.watchdog.Store(w)
+}
+
+// SetToolGuard applies g's per-tool rate limits and circuit breakers to
+// tool executions; nil allows every call
+func (tb *ToolBridge) SetToolGuard(g *security.ToolGuard) {
+	tb.guard.Store(g)
+}
+
+// SetConfirmer has c confirm tools that require it before they run; nil
+// runs them without asking
+func (tb *ToolBridge) SetConfirmer(c *security.ToolConfirmer) {
+	tb.confirm.Store(c)
+}
+
+// ExecutionStats returns per-tool execution counts, failures, and time
+func (tb *ToolBridge) ExecutionStats() []CallStat {
+	return tb.execs.Snapshot()
 }
 
 // GetTool retrieves tool information
@@ -84,10 +231,67 @@ func (tb *ToolBridge) GetTool(name string) (map[string]interface{}, error) {
 		return nil, err
 	}
 
-	// Build tool info
+	return toolInfo(tool), nil
+}
+
+// ListTools returns all available tools, sorted by name. The descriptions
+// are cached until the tool set changes and must not be modified.
+func (tb *ToolBridge) ListTools() []map[string]interface{} {
+	version := tb.registry.Version()
+
+	tb.infoMu.Lock()
+	defer tb.infoMu.Unlock()
+
+	if tb.infos == nil || tb.infoVersion != version {
+		tb.infos = toolInfos(tb.registry.List())
+		tb.infoVersion = version
+	}
+	return append([]map[string]interface{}(nil), tb.infos...)
+}
+
+// RefreshTools discards the cached tool listing so the next discovery call
+// re-reads the registry. Only needed when the registry is changed directly
+// rather than through the bridge.
+func (tb *ToolBridge) RefreshTools() {
+	tb.registry.Refresh()
+}
+
+// ListCategories returns the distinct tool categories with tool counts
+func (tb *ToolBridge) ListCategories() []map[string]interface{} {
+	return facetInfos(tools.Categories(tb.registry))
+}
+
+// ListTags returns the distinct tool tags with tool counts
+func (tb *ToolBridge) ListTags() []map[string]interface{} {
+	return facetInfos(tools.Tags(tb.registry))
+}
+
+// ListByCategory returns the tools in a category
+func (tb *ToolBridge) ListByCategory(category string) []map[string]interface{} {
+	return toolInfos(tools.ListByCategory(tb.registry, category))
+}
+
+// ListByTag returns the tools carrying a tag
+func (tb *ToolBridge) ListByTag(tag string) []map[string]interface{} {
+	return toolInfos(tools.ListByTag(tb.registry, tag))
+}
+
+// toolInfo builds the script-facing description of a tool
+func toolInfo(tool tools.Tool) map[string]interface{} {
+	meta := tools.MetadataFor(tool)
+	tags := meta.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
 	info := map[string]interface{}{
-		"name":        tool.Name(),
-		"description": tool.Description(),
+		"name":                  tool.Name(),
+		"description":           tool.Description(),
+		"category":              meta.Category,
+		"tags":                  tags,
+		"source":                toolSource(tool, meta),
+		"deterministic":         tools.IsDeterministic(tool),
+		"requires_confirmation": tools.RequiresConfirmation(tool),
 	}
 
 	// Parse parameters to include as object
@@ -99,36 +303,246 @@ func (tb *ToolBridge) GetTool(name string) (map[string]interface{}, error) {
 		info["parameters"] = string(tool.Parameters())
 	}
 
-	return info, nil
+	return info
 }
 
-// ListTools returns all available tools
-func (tb *ToolBridge) ListTools() []map[string]interface{} {
-	tools := tb.registry.List()
-	result := make([]map[string]interface{}, len(tools))
+// toolSource says where a tool comes from: "script" for tools registered
+// from a script, the source of its metadata, or "builtin"
+func toolSource(tool tools.Tool, meta tools.Metadata) string {
+	if _, ok := tool.(*scriptTool); ok {
+		return "script"
+	}
+	if meta.Source != "" {
+		return meta.Source
+	}
+	return "builtin"
+}
 
-	for i, tool := range tools {
+// toolInfos builds the script-facing descriptions of several tools
+func toolInfos(list []tools.Tool) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(list))
+	for i, tool := range list {
+		result[i] = toolInfo(tool)
+	}
+	return result
+}
+
+// facetInfos converts category or tag counts for scripts
+func facetInfos(facets []tools.FacetCount) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(facets))
+	for i, facet := range facets {
 		result[i] = map[string]interface{}{
-			"name":        tool.Name(),
-			"description": tool.Description(),
+			"name":  facet.Name,
+			"count": facet.Count,
 		}
+	}
+	return result
+}
+
+// isCustomTool reports whether a tool was registered from a script or
+// imported from an OpenAPI document
+func isCustomTool(tool tools.Tool) bool {
+	switch tool.(type) {
+	case *scriptTool, *importedTool:
+		return true
+	}
+	return false
+}
 
-		// Parse parameters to include as object
-		var params interface{}
-		if err := json.Unmarshal(tool.Parameters(), &params); err == nil {
-			result[i]["parameters"] = params
-		} else {
-			// If parsing fails, return as string
-			result[i]["parameters"] = string(tool.Parameters())
+// ListCustomTools returns the tools registered from scripts or imported
+// from OpenAPI documents
+func (tb *ToolBridge) ListCustomTools() []map[string]interface{} {
+	custom := []tools.Tool{}
+	for _, tool := range tb.registry.List() {
+		if isCustomTool(tool) {
+			custom = append(custom, tool)
 		}
 	}
 
-	return result
+	sort.Slice(custom, func(i, j int) bool {
+		return custom[i].Name() < custom[j].Name()
+	})
+	return toolInfos(custom)
+}
+
+// UnregisterCustomTool removes a tool registered from a script or imported
+// from an OpenAPI document. Built-in and host-provided tools cannot be
+// removed this way.
+func (tb *ToolBridge) UnregisterCustomTool(name string) error {
+	tool, err := tb.registry.Get(name)
+	if err != nil {
+		return err
+	}
+
+	if !isCustomTool(tool) {
+		return fmt.Errorf("tool %q is not a custom tool", name)
+	}
+
+	return tb.RemoveTool(name)
+}
+
+// SearchTools returns the tools matching a query, ranked by relevance
+func (tb *ToolBridge) SearchTools(query string) []map[string]interface{} {
+	results := tools.Search(tb.registry, query)
+	matches := make([]map[string]interface{}, len(results))
+
+	for i, result := range results {
+		tags := result.Metadata.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		matches[i] = map[string]interface{}{
+			"name":        result.Metadata.Name,
+			"description": result.Metadata.Description,
+			"category":    result.Metadata.Category,
+			"tags":        tags,
+			"score":       result.Score,
+		}
+	}
+
+	return matches
 }
 
 // RemoveTool unregisters a tool
 func (tb *ToolBridge) RemoveTool(name string) error {
-	return tb.registry.Remove(name)
+	// Keep the outgoing version's docs so it can still be diffed
+	tb.snapshotDoc(name)
+
+	if err := tb.registry.Remove(name); err != nil {
+		return err
+	}
+	tb.toolChanged(name)
+	return nil
+}
+
+// toolChanged drops what the bridge remembers of a tool that was replaced
+// or removed: its docs, its cached results, and the results of calls made
+// under idempotency keys, so the next call reaches the tool as it is now
+func (tb *ToolBridge) toolChanged(name string) {
+	tb.docs.Invalidate(name)
+	tb.results.Load().forget(name)
+
+	tb.doneMu.Lock()
+	defer tb.doneMu.Unlock()
+	for id := range tb.done {
+		if tool, _, _ := strings.Cut(id, "\x00"); tool == name {
+			delete(tb.done, id)
+		}
+	}
+}
+
+// ToolDoc returns the generated documentation for a tool. Docs are cached
+// until the tool changes.
+func (tb *ToolBridge) ToolDoc(name string) (map[string]interface{}, error) {
+	tool, err := tb.registry.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return docInfo(tb.docs.Doc(tool)), nil
+}
+
+// StreamToolDocs documents every tool concurrently, calling fn with each
+// doc as it completes. fn runs on the calling goroutine, so it may call back
+// into a script engine; returning an error stops the stream.
+func (tb *ToolBridge) StreamToolDocs(ctx context.Context, fn func(map[string]interface{}) error) error {
+	return tb.docs.Stream(ctx, tb.registry.List(), 0, func(doc tools.ToolDoc) error {
+		return fn(docInfo(doc))
+	})
+}
+
+// WriteOpenAPI streams an OpenAPI document for every registered tool to w
+func (tb *ToolBridge) WriteOpenAPI(w io.Writer, info tools.OpenAPIInfo) error {
+	return tools.WriteOpenAPI(w, tb.registry.List(), info)
+}
+
+// ToolDocVersions lists the versions of a tool whose docs have been recorded
+func (tb *ToolBridge) ToolDocVersions(name string) []string {
+	tb.snapshotDoc(name)
+	return tb.docs.History().Versions(name)
+}
+
+// DocDiff compares the documentation of two recorded versions of a tool,
+// reporting added, removed, and changed parameters. Versions are recorded
+// whenever a tool is registered, removed, or documented through the bridge.
+func (tb *ToolBridge) DocDiff(name, fromVersion, toVersion string) (map[string]interface{}, error) {
+	tb.snapshotDoc(name)
+
+	diff, err := tb.docs.History().Diff(name, fromVersion, toVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	added := make([]interface{}, len(diff.Added))
+	for i, p := range diff.Added {
+		added[i] = p.Name
+	}
+	removed := make([]interface{}, len(diff.Removed))
+	for i, p := range diff.Removed {
+		removed[i] = p.Name
+	}
+	changed := make([]interface{}, len(diff.Changed))
+	for i, c := range diff.Changed {
+		changed[i] = map[string]interface{}{
+			"name":     c.Name,
+			"changes":  c.Changes,
+			"breaking": c.Breaking,
+		}
+	}
+
+	return map[string]interface{}{
+		"tool":                diff.Tool,
+		"from":                diff.From,
+		"to":                  diff.To,
+		"added":               added,
+		"removed":             removed,
+		"changed":             changed,
+		"description_changed": diff.DescriptionChanged,
+		"category_changed":    diff.CategoryChanged,
+		"tags_changed":        diff.TagsChanged,
+		"breaking":            diff.Breaking,
+	}, nil
+}
+
+// snapshotDoc records the current version of a tool's docs, if it exists
+func (tb *ToolBridge) snapshotDoc(name string) {
+	if tool, err := tb.registry.Get(name); err == nil {
+		tb.docs.Doc(tool)
+	}
+}
+
+// docInfo converts a tool doc for scripts
+func docInfo(doc tools.ToolDoc) map[string]interface{} {
+	params := make([]interface{}, len(doc.Parameters))
+	for i, p := range doc.Parameters {
+		param := map[string]interface{}{
+			"name":        p.Name,
+			"type":        p.Type,
+			"description": p.Description,
+			"required":    p.Required,
+		}
+		if p.Default != nil {
+			param["default"] = p.Default
+		}
+		if len(p.Enum) > 0 {
+			param["enum"] = p.Enum
+		}
+		params[i] = param
+	}
+
+	tags := doc.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return map[string]interface{}{
+		"name":        doc.Name,
+		"description": doc.Description,
+		"version":     doc.Version,
+		"category":    doc.Category,
+		"tags":        tags,
+		"parameters":  params,
+		"markdown":    doc.Markdown,
+	}
 }
 
 // ValidateParameters validates tool parameters against schema
@@ -149,32 +563,120 @@ func (tb *ToolBridge) ValidateParameters(name string, params map[string]interfac
 	if err := json.Unmarshal(schema, &schemaMap); err != nil {
 		return fmt.Errorf("failed to parse parameter schema: %w", err)
 	}
+	schemaMap, err = tools.ResolveSchemaRefs(schemaMap)
+	if err != nil {
+		return fmt.Errorf("invalid parameter schema: %w", err)
+	}
+
+	tb.ruleMu.RLock()
+	validator := schemaValidator{rules: tb.rules}
+	tb.ruleMu.RUnlock()
+	return validator.validate(params, schemaMap)
+}
+
+// RegisterValidationRule adds a custom rule that tool schemas can apply to
+// a parameter with "x-validate", replacing any rule of the same name
+func (tb *ToolBridge) RegisterValidationRule(name string, rule ValidationRule) error {
+	if name == "" {
+		return fmt.Errorf("validation rule name is required")
+	}
+	if rule == nil {
+		return fmt.Errorf("validation rule %s has no function", name)
+	}
+
+	// Rules are replaced rather than changed in place, so a validation in
+	// progress, which may run rules that register others, keeps its own
+	tb.ruleMu.Lock()
+	defer tb.ruleMu.Unlock()
+	rules := make(map[string]ValidationRule, len(tb.rules)+1)
+	for n, r := range tb.rules {
+		rules[n] = r
+	}
+	rules[name] = rule
+	tb.rules = rules
+	return nil
+}
+
+// ScaffoldInput builds a template input for a tool from its parameter schema.
+// Properties with defaults are filled in and required properties get
+// placeholder values, so scripts can see the expected shape before calling it.
+func (tb *ToolBridge) ScaffoldInput(name string) (map[string]interface{}, error) {
+	tool, err := tb.registry.Get(name)
+	if err != nil {
+		return nil, err
+	}
 
-	// Basic validation - check required fields
-	if properties, ok := schemaMap["properties"].(map[string]interface{}); ok {
-		if required, ok := schemaMap["required"].([]interface{}); ok {
-			for _, req := range required {
+	schema := tool.Parameters()
+	if len(schema) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	var schemaMap map[string]interface{}
+	if err := json.Unmarshal(schema, &schemaMap); err != nil {
+		return nil, fmt.Errorf("failed to parse parameter schema: %w", err)
+	}
+	schemaMap, err = tools.ResolveSchemaRefs(schemaMap)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameter schema: %w", err)
+	}
+
+	input, _ := ScaffoldSchema(schemaMap).(map[string]interface{})
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+	return input, nil
+}
+
+// ScaffoldSchema returns a template value for a JSON schema. Objects include
+// properties that have a default or are required; other values use the
+// schema's default, its first enum value, or a zero placeholder for its type.
+func ScaffoldSchema(schema map[string]interface{}) interface{} {
+	if def, ok := schema["default"]; ok {
+		return def
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	schemaType, _ := schema["type"].(string)
+	properties, hasProperties := schema["properties"].(map[string]interface{})
+	if schemaType == "" && hasProperties {
+		schemaType = "object"
+	}
+
+	switch schemaType {
+	case "object":
+		required := make(map[string]bool)
+		if reqList, ok := schema["required"].([]interface{}); ok {
+			for _, req := range reqList {
 				if reqName, ok := req.(string); ok {
-					if _, exists := params[reqName]; !exists {
-						return fmt.Errorf("missing required parameter: %s", reqName)
-					}
+					required[reqName] = true
 				}
 			}
 		}
 
-		// Type validation
-		for paramName, paramValue := range params {
-			if propDef, ok := properties[paramName].(map[string]interface{}); ok {
-				if propType, ok := propDef["type"].(string); ok {
-					if err := validateType(paramValue, propType); err != nil {
-						return fmt.Errorf("parameter %s: %w", paramName, err)
-					}
-				}
+		result := make(map[string]interface{})
+		for propName, propDef := range properties {
+			propSchema, ok := propDef.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if _, hasDefault := propSchema["default"]; hasDefault || required[propName] {
+				result[propName] = ScaffoldSchema(propSchema)
 			}
 		}
+		return result
+	case "array":
+		return []interface{}{}
+	case "string":
+		return ""
+	case "number", "integer":
+		return float64(0)
+	case "boolean":
+		return false
+	default:
+		return nil
 	}
-
-	return nil
 }
 
 // validateType checks if a value matches the expected type
@@ -191,10 +693,18 @@ func validateType(value interface{}, expectedType string) error {
 		default:
 			return fmt.Errorf("expected number, got %T", value)
 		}
+	case "integer":
+		if !isWhole(value) {
+			return fmt.Errorf("expected integer, got %v", value)
+		}
 	case "boolean":
 		if _, ok := value.(bool); !ok {
 			return fmt.Errorf("expected boolean, got %T", value)
 		}
+	case "null":
+		if value != nil {
+			return fmt.Errorf("expected null, got %T", value)
+		}
 	case "object":
 		if _, ok := value.(map[string]interface{}); !ok {
 			return fmt.Errorf("expected object, got %T", value)
@@ -203,6 +713,11 @@ func validateType(value interface{}, expectedType string) error {
 		switch value.(type) {
 		case []interface{}, []string, []float64, []int:
 			// Valid array types
+		case map[string]interface{}:
+			// Scripts cannot tell an empty array from an empty object
+			if len(value.(map[string]interface{})) > 0 {
+				return fmt.Errorf("expected array, got %T", value)
+			}
 		default:
 			return fmt.Errorf("expected array, got %T", value)
 		}
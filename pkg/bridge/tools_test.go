@@ -5,9 +5,15 @@ package bridge
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/lexlapax/go-llmspell/pkg/security"
 	"github.com/lexlapax/go-llmspell/pkg/tools"
 )
 
@@ -170,6 +176,201 @@ func TestToolBridge(t *testing.T) {
 		}
 	})
 
+	t.Run("scaffold input", func(t *testing.T) {
+		registry := tools.NewRegistry()
+		bridge := NewToolBridge(registry)
+
+		params := map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"url":     map[string]interface{}{"type": "string"},
+				"method":  map[string]interface{}{"type": "string", "enum": []interface{}{"GET", "POST"}},
+				"timeout": map[string]interface{}{"type": "number", "default": float64(30)},
+				"verbose": map[string]interface{}{"type": "boolean"},
+				"headers": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"accept": map[string]interface{}{"type": "string", "default": "*/*"},
+					},
+				},
+				"tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+			"required": []interface{}{"url", "method", "headers", "tags"},
+		}
+
+		err := bridge.RegisterTool("fetch", "Fetch a URL", params, func(p map[string]interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to register tool: %v", err)
+		}
+
+		input, err := bridge.ScaffoldInput("fetch")
+		if err != nil {
+			t.Fatalf("Failed to scaffold input: %v", err)
+		}
+
+		if input["url"] != "" {
+			t.Errorf("Expected empty string placeholder for url, got %v", input["url"])
+		}
+		if input["method"] != "GET" {
+			t.Errorf("Expected first enum value for method, got %v", input["method"])
+		}
+		if input["timeout"] != float64(30) {
+			t.Errorf("Expected default timeout 30, got %v", input["timeout"])
+		}
+		if _, exists := input["verbose"]; exists {
+			t.Error("Expected optional property without default to be omitted")
+		}
+		headers, ok := input["headers"].(map[string]interface{})
+		if !ok || headers["accept"] != "*/*" {
+			t.Errorf("Expected nested defaults in headers, got %v", input["headers"])
+		}
+		if tags, ok := input["tags"].([]interface{}); !ok || len(tags) != 0 {
+			t.Errorf("Expected empty array placeholder for tags, got %v", input["tags"])
+		}
+
+		// The scaffold is itself valid input
+		if err := bridge.ValidateParameters("fetch", input); err != nil {
+			t.Errorf("Scaffolded input failed validation: %v", err)
+		}
+
+		if _, err := bridge.ScaffoldInput("nonexistent"); err == nil {
+			t.Error("Expected error when scaffolding input for non-existent tool")
+		}
+	})
+
+	t.Run("schema references", func(t *testing.T) {
+		registry := tools.NewRegistry()
+		bridge := NewToolBridge(registry)
+
+		noop := func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			return nil, nil
+		}
+		_ = registry.Register(tools.NewFunctionTool("ship", "Ships a parcel", json.RawMessage(`{
+			"type": "object",
+			"properties": {"to": {"$ref": "#/$defs/address"}},
+			"required": ["to"],
+			"$defs": {"address": {"type": "object", "properties": {"city": {"type": "string"}}}}
+		}`), noop))
+		_ = registry.Register(tools.NewFunctionTool("loop", "Has a circular schema", json.RawMessage(`{
+			"type": "object",
+			"properties": {"node": {"$ref": "#/definitions/node"}},
+			"definitions": {"node": {"$ref": "#/definitions/node"}}
+		}`), noop))
+
+		if err := bridge.ValidateParameters("ship", map[string]interface{}{"to": map[string]interface{}{"city": "Oslo"}}); err != nil {
+			t.Errorf("Valid parameters failed validation: %v", err)
+		}
+		if err := bridge.ValidateParameters("ship", map[string]interface{}{"to": "Oslo"}); err == nil {
+			t.Error("Expected error for a referenced object type")
+		}
+		if err := bridge.ValidateParameters("loop", map[string]interface{}{}); err == nil || !strings.Contains(err.Error(), "circular") {
+			t.Errorf("Expected circular reference error, got %v", err)
+		}
+	})
+
+	t.Run("search tools", func(t *testing.T) {
+		registry := tools.NewRegistry()
+		bridge := NewToolBridge(registry)
+
+		noop := func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			return nil, nil
+		}
+		_ = registry.Register(tools.NewFunctionTool("web_fetch", "Fetches a URL", nil, noop).WithMetadata("web", "http"))
+		_ = registry.Register(tools.NewFunctionTool("summarize", "Summarizes fetched text", nil, noop))
+
+		results := bridge.SearchTools("fetch")
+		if len(results) != 2 {
+			t.Fatalf("Expected 2 results, got %d", len(results))
+		}
+		if results[0]["name"] != "web_fetch" || results[0]["category"] != "web" {
+			t.Errorf("Expected web_fetch ranked first with category, got %v", results[0])
+		}
+		if results[0]["score"].(float64) <= results[1]["score"].(float64) {
+			t.Errorf("Expected results ordered by score, got %v", results)
+		}
+	})
+
+	t.Run("categories and tags", func(t *testing.T) {
+		registry := tools.NewRegistry()
+		bridge := NewToolBridge(registry)
+
+		noop := func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			return nil, nil
+		}
+		_ = registry.Register(tools.NewFunctionTool("web_fetch", "Fetches a URL", nil, noop).WithMetadata("web", "http"))
+		_ = registry.Register(tools.NewFunctionTool("web_post", "Posts to a URL", nil, noop).WithMetadata("web", "http", "write"))
+		_ = registry.Register(tools.NewFunctionTool("echo", "Echoes input", nil, noop))
+
+		categories := bridge.ListCategories()
+		if len(categories) != 1 || categories[0]["name"] != "web" || categories[0]["count"] != 2 {
+			t.Errorf("Unexpected categories: %v", categories)
+		}
+
+		tags := bridge.ListTags()
+		if len(tags) != 2 || tags[0]["name"] != "http" || tags[0]["count"] != 2 || tags[1]["name"] != "write" {
+			t.Errorf("Unexpected tags: %v", tags)
+		}
+
+		byTag := bridge.ListByTag("write")
+		if len(byTag) != 1 || byTag[0]["name"] != "web_post" {
+			t.Errorf("Unexpected tools for tag: %v", byTag)
+		}
+
+		byCategory := bridge.ListByCategory("web")
+		if len(byCategory) != 2 || byCategory[0]["category"] != "web" {
+			t.Errorf("Unexpected tools for category: %v", byCategory)
+		}
+	})
+
+	t.Run("custom tools", func(t *testing.T) {
+		registry := tools.NewRegistry()
+		bridge := NewToolBridge(registry)
+
+		hostTool := tools.NewFunctionTool("host", "Registered by the host", nil,
+			func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+				return nil, nil
+			})
+		if err := registry.Register(hostTool); err != nil {
+			t.Fatalf("Failed to register host tool: %v", err)
+		}
+
+		handler := func(p map[string]interface{}) (interface{}, error) { return nil, nil }
+		for _, name := range []string{"beta", "alpha"} {
+			if err := bridge.RegisterTool(name, "Script tool", map[string]interface{}{}, handler); err != nil {
+				t.Fatalf("Failed to register tool: %v", err)
+			}
+		}
+
+		custom := bridge.ListCustomTools()
+		if len(custom) != 2 || custom[0]["name"] != "alpha" || custom[1]["name"] != "beta" {
+			t.Errorf("Expected only script tools, sorted, got %v", custom)
+		}
+
+		if err := bridge.UnregisterCustomTool("host"); err == nil {
+			t.Error("Expected error when unregistering a host tool")
+		}
+		if err := bridge.UnregisterCustomTool("missing"); err == nil {
+			t.Error("Expected error when unregistering a missing tool")
+		}
+		if err := bridge.UnregisterCustomTool("alpha"); err != nil {
+			t.Fatalf("Failed to unregister custom tool: %v", err)
+		}
+
+		if _, err := bridge.GetTool("alpha"); err == nil {
+			t.Error("Expected unregistered tool to be gone")
+		}
+		if custom := bridge.ListCustomTools(); len(custom) != 1 {
+			t.Errorf("Expected 1 custom tool after unregister, got %d", len(custom))
+		}
+
+		// The freed name can be registered again
+		if err := bridge.RegisterTool("alpha", "Script tool", map[string]interface{}{}, handler); err != nil {
+			t.Errorf("Failed to re-register tool: %v", err)
+		}
+	})
+
 	t.Run("nil registry", func(t *testing.T) {
 		// Test that nil registry uses default
 		bridge := NewToolBridge(nil)
@@ -194,6 +395,10 @@ func TestValidateType(t *testing.T) {
 		{"valid float64", float64(3.14), "number", false},
 		{"valid int", 42, "number", false},
 		{"invalid number", "123", "number", true},
+		{"valid integer", float64(3), "integer", false},
+		{"invalid integer", 3.5, "integer", true},
+		{"valid null", nil, "null", false},
+		{"invalid null", "", "null", true},
 
 		// Boolean tests
 		{"valid boolean", true, "boolean", false},
@@ -206,7 +411,9 @@ func TestValidateType(t *testing.T) {
 		// Array tests
 		{"valid array interface", []interface{}{1, 2, 3}, "array", false},
 		{"valid array string", []string{"a", "b", "c"}, "array", false},
+		{"valid empty table as array", map[string]interface{}{}, "array", false},
 		{"invalid array", "not an array", "array", true},
+		{"invalid object as array", map[string]interface{}{"a": 1}, "array", true},
 	}
 
 	for _, tt := range tests {
@@ -218,3 +425,276 @@ func TestValidateType(t *testing.T) {
 		})
 	}
 }
+
+func TestToolBridgeConcurrentRegistration(t *testing.T) {
+	registry := tools.NewRegistry()
+	bridge := NewToolBridge(registry)
+
+	params := map[string]interface{}{"type": "object"}
+	echo := func(p map[string]interface{}) (interface{}, error) {
+		return p, nil
+	}
+	if err := bridge.RegisterTool("shared", "Always present", params, echo); err != nil {
+		t.Fatalf("Failed to register tool: %v", err)
+	}
+
+	const workers = 8
+	const perWorker = 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker*2)
+
+	// Writers register and remove their own tools
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				name := fmt.Sprintf("tool_%d_%d", w, i)
+				if err := bridge.RegisterTool(name, "Concurrent tool", params, echo); err != nil {
+					errs <- err
+					continue
+				}
+				if i%2 == 0 {
+					if err := bridge.RemoveTool(name); err != nil {
+						errs <- err
+					}
+				}
+			}
+		}(w)
+	}
+
+	// Readers execute, list, and search while the writers run
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if _, err := bridge.ExecuteTool(context.Background(), "shared", map[string]interface{}{"i": i}); err != nil {
+					errs <- err
+				}
+				_ = bridge.ListTools()
+				_ = bridge.SearchTools("concurrent")
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Concurrent operation failed: %v", err)
+	}
+
+	// shared plus the odd-numbered tools from each writer remain
+	if got, want := len(bridge.ListTools()), 1+workers*perWorker/2; got != want {
+		t.Errorf("Expected %d tools after concurrent registration, got %d", want, got)
+	}
+}
+
+func TestToolBridgeListingCache(t *testing.T) {
+	registry := tools.NewRegistry()
+	bridge := NewToolBridge(registry)
+
+	params := map[string]interface{}{"type": "object"}
+	echo := func(p map[string]interface{}) (interface{}, error) {
+		return p, nil
+	}
+	if err := bridge.RegisterTool("b_tool", "Second", params, echo); err != nil {
+		t.Fatalf("Failed to register tool: %v", err)
+	}
+	if err := bridge.RegisterTool("a_tool", "First", params, echo); err != nil {
+		t.Fatalf("Failed to register tool: %v", err)
+	}
+
+	list := bridge.ListTools()
+	if len(list) != 2 || list[0]["name"] != "a_tool" {
+		t.Fatalf("Expected 2 tools sorted by name, got %v", list)
+	}
+
+	// Changes through the bridge invalidate the cache
+	if err := bridge.RemoveTool("a_tool"); err != nil {
+		t.Fatalf("Failed to remove tool: %v", err)
+	}
+	if list := bridge.ListTools(); len(list) != 1 {
+		t.Errorf("Expected removal to be visible, got %v", list)
+	}
+
+	// Direct registry changes need a refresh
+	if err := registry.Register(tools.NewFunctionTool("c_tool", "Direct", nil, nil)); err != nil {
+		t.Fatalf("Failed to register tool: %v", err)
+	}
+	if list := bridge.ListTools(); len(list) != 1 {
+		t.Errorf("Expected cached listing before refresh, got %v", list)
+	}
+	bridge.RefreshTools()
+	if list := bridge.ListTools(); len(list) != 2 {
+		t.Errorf("Expected refreshed listing, got %v", list)
+	}
+	if results := bridge.SearchTools("direct"); len(results) != 1 {
+		t.Errorf("Expected search to see refreshed tools, got %v", results)
+	}
+}
+
+// benchmarkCatalog builds a bridge over a catalog of n tools
+func benchmarkCatalog(b *testing.B, n int) (*ToolBridge, tools.Registry) {
+	registry := tools.NewRegistry()
+	params := []byte(`{"type":"object","properties":{"query":{"type":"string"},"limit":{"type":"number","default":10}},"required":["query"]}`)
+	for i := 0; i < n; i++ {
+		tool := tools.NewFunctionTool(fmt.Sprintf("tool_%03d", i), fmt.Sprintf("Catalog tool number %d for searching records", i), params, nil).
+			WithMetadata(fmt.Sprintf("category_%d", i%10), "catalog")
+		if err := registry.Register(tool); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return NewToolBridge(registry), registry
+}
+
+func BenchmarkToolBridgeListTools(b *testing.B) {
+	b.Run("cached", func(b *testing.B) {
+		bridge, _ := benchmarkCatalog(b, 500)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = bridge.ListTools()
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		bridge, _ := benchmarkCatalog(b, 500)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			bridge.RefreshTools()
+			_ = bridge.ListTools()
+		}
+	})
+}
+
+func BenchmarkToolBridgeSearchTools(b *testing.B) {
+	bridge, _ := benchmarkCatalog(b, 500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = bridge.SearchTools("records")
+	}
+}
+
+func TestToolBridgeDocDiff(t *testing.T) {
+	registry := tools.NewRegistry()
+	bridge := NewToolBridge(registry)
+
+	v1 := tools.NewFunctionTool("search", "Search records", []byte(`{
+		"type": "object",
+		"properties": {"query": {"type": "string"}, "mode": {"type": "string", "enum": ["fast", "full"]}},
+		"required": ["query"]
+	}`), nil).WithVersion("1.0")
+	v2 := tools.NewFunctionTool("search", "Search records", []byte(`{
+		"type": "object",
+		"properties": {"query": {"type": "string"}, "limit": {"type": "number", "default": 10}},
+		"required": ["query"]
+	}`), nil).WithVersion("2.0")
+
+	if err := registry.Register(v1); err != nil {
+		t.Fatalf("Failed to register tool: %v", err)
+	}
+	// Removing through the bridge keeps the outgoing version's docs
+	if err := bridge.RemoveTool("search"); err != nil {
+		t.Fatalf("Failed to remove tool: %v", err)
+	}
+	if err := registry.Register(v2); err != nil {
+		t.Fatalf("Failed to register tool: %v", err)
+	}
+
+	if versions := bridge.ToolDocVersions("search"); len(versions) != 2 || versions[1] != "2.0" {
+		t.Errorf("Expected versions 1.0 and 2.0, got %v", versions)
+	}
+
+	diff, err := bridge.DocDiff("search", "1.0", "2.0")
+	if err != nil {
+		t.Fatalf("DocDiff failed: %v", err)
+	}
+	added := diff["added"].([]interface{})
+	removed := diff["removed"].([]interface{})
+	if len(added) != 1 || added[0] != "limit" || len(removed) != 1 || removed[0] != "mode" {
+		t.Errorf("Unexpected diff: %v", diff)
+	}
+	if diff["breaking"] != true {
+		t.Error("Expected removing a parameter to be breaking")
+	}
+
+	if _, err := bridge.DocDiff("search", "0.9", "2.0"); err == nil {
+		t.Error("Expected error for unrecorded version")
+	}
+}
+
+func TestToolBridgeExecutionStats(t *testing.T) {
+	bridge := NewToolBridge(tools.NewRegistry())
+
+	params := map[string]interface{}{"type": "object"}
+	err := bridge.RegisterTool("flaky", "Fails on request", params, func(p map[string]interface{}) (interface{}, error) {
+		if p["fail"] == true {
+			return nil, errors.New("failed")
+		}
+		return "ok", nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to register tool: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, fail := range []bool{false, true, false} {
+		_, _ = bridge.ExecuteTool(ctx, "flaky", map[string]interface{}{"fail": fail})
+	}
+	// Unknown tools never run, so they are not counted
+	_, _ = bridge.ExecuteTool(ctx, "missing", nil)
+
+	stats := bridge.ExecutionStats()
+	if len(stats) != 1 {
+		t.Fatalf("Expected stats for one tool, got %+v", stats)
+	}
+	if stats[0].Name != "flaky" || stats[0].Calls != 3 || stats[0].Failures != 1 || stats[0].Successes() != 2 {
+		t.Errorf("Unexpected stats: %+v", stats[0])
+	}
+}
+
+func TestToolBridgeToolGuard(t *testing.T) {
+	bridge := NewToolBridge(tools.NewRegistry())
+	bridge.SetToolGuard(security.NewToolGuard(
+		[]security.ToolLimit{{Tool: "steady", Calls: 1, Per: time.Minute}},
+		[]security.CircuitBreaker{{Tool: "*", Failures: 2, Window: time.Minute, Cooldown: time.Minute}},
+	))
+
+	runs := 0
+	params := map[string]interface{}{"type": "object"}
+	bridge.RegisterTool("flaky", "Always fails", params, func(p map[string]interface{}) (interface{}, error) {
+		runs++
+		return nil, errors.New("failed")
+	})
+	bridge.RegisterTool("steady", "Always works", params, func(p map[string]interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+
+	// Calls the caller cancelled do not count as failures
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		bridge.ExecuteTool(cancelled, "flaky", nil)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := bridge.ExecuteTool(ctx, "flaky", nil); err == nil || errors.Is(err, security.ErrCircuitOpen) {
+			t.Fatalf("Expected the tool to run and fail, got %v", err)
+		}
+	}
+	if _, err := bridge.ExecuteTool(ctx, "flaky", nil); !errors.Is(err, security.ErrCircuitOpen) {
+		t.Errorf("Expected the circuit to be open, got %v", err)
+	}
+	if runs != 5 {
+		t.Errorf("Expected the refused call not to run the tool, ran %d times", runs)
+	}
+
+	if _, err := bridge.ExecuteTool(ctx, "steady", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bridge.ExecuteTool(ctx, "steady", nil); !errors.Is(err, security.ErrRateLimited) {
+		t.Errorf("Expected the tool limit to apply, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+// ABOUTME: Trace context carried from a spell into its sub-spells and LLM calls
+// ABOUTME: Uses W3C traceparent IDs so runs can join traces started elsewhere
+
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TraceparentEnv names the environment variable a run takes its parent
+// trace from, as OpenTelemetry tooling sets it for child processes
+const TraceparentEnv = "TRACEPARENT"
+
+// TraceContext identifies a span in a trace: the spell run or sub-spell
+// that is executing
+type TraceContext struct {
+	// TraceID is 32 hex characters shared by every span of the trace
+	TraceID string
+
+	// SpanID is 16 hex characters identifying this span
+	SpanID string
+
+	// ParentSpanID is the span this one was started from, if any
+	ParentSpanID string
+}
+
+// NewTraceContext starts a new trace
+func NewTraceContext() TraceContext {
+	return TraceContext{TraceID: randomHex(16), SpanID: randomHex(8)}
+}
+
+// ParseTraceparent reads a W3C traceparent header value, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", and returns a
+// new span that is a child of it
+func ParseTraceparent(value string) (TraceContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || !isHex(parts[1]) || !isHex(parts[2]) {
+		return TraceContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return TraceContext{}, fmt.Errorf("invalid traceparent %q: all-zero ID", value)
+	}
+	parent := TraceContext{TraceID: strings.ToLower(parts[1]), SpanID: strings.ToLower(parts[2])}
+	return parent.Child(), nil
+}
+
+// Child starts a span within the same trace
+func (t TraceContext) Child() TraceContext {
+	if t.TraceID == "" {
+		return NewTraceContext()
+	}
+	return TraceContext{TraceID: t.TraceID, SpanID: randomHex(8), ParentSpanID: t.SpanID}
+}
+
+// Traceparent formats the span as a W3C traceparent value, for passing to
+// other services
+func (t TraceContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", t.TraceID, t.SpanID)
+}
+
+type traceKey struct{}
+
+// ContextWithTrace returns a context carrying the span
+func ContextWithTrace(ctx context.Context, t TraceContext) context.Context {
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+// TraceFromContext returns the span a context carries
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	if ctx == nil {
+		return TraceContext{}, false
+	}
+	t, ok := ctx.Value(traceKey{}).(TraceContext)
+	return t, ok
+}
+
+// SpanFromContext returns the trace and span IDs a context carries, in the
+// form CallLogOptions.SpanFromContext expects
+func SpanFromContext(ctx context.Context) (traceID, spanID string) {
+	t, _ := TraceFromContext(ctx)
+	return t.TraceID, t.SpanID
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,59 @@
+// ABOUTME: Tests for trace context propagation
+// ABOUTME: Validates traceparent parsing, child spans, and context round trips
+
+package bridge
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	trace, err := ParseTraceparent("00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if trace.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || trace.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("Expected a child of the given span, got %+v", trace)
+	}
+	if len(trace.SpanID) != 16 || trace.SpanID == trace.ParentSpanID {
+		t.Errorf("Expected a new span ID, got %q", trace.SpanID)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"not-a-traceparent",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestTraceContext(t *testing.T) {
+	root := NewTraceContext()
+	if len(root.TraceID) != 32 || len(root.SpanID) != 16 {
+		t.Fatalf("Unexpected ID lengths in %+v", root)
+	}
+
+	child := root.Child()
+	if child.TraceID != root.TraceID || child.ParentSpanID != root.SpanID || child.SpanID == root.SpanID {
+		t.Errorf("Expected a child span of %+v, got %+v", root, child)
+	}
+
+	parsed, err := ParseTraceparent(child.Traceparent())
+	if err != nil || parsed.ParentSpanID != child.SpanID {
+		t.Errorf("Expected traceparent to round trip, got %+v, %v", parsed, err)
+	}
+
+	ctx := ContextWithTrace(context.Background(), child)
+	if traceID, spanID := SpanFromContext(ctx); traceID != child.TraceID || spanID != child.SpanID {
+		t.Errorf("Expected the span from the context, got %s/%s", traceID, spanID)
+	}
+	if traceID, _ := SpanFromContext(context.Background()); traceID != "" {
+		t.Errorf("Expected no trace in a bare context, got %s", traceID)
+	}
+}
@@ -0,0 +1,380 @@
+// ABOUTME: Validates tool parameters against their JSON schemas, including nested, composed and conditional ones
+// ABOUTME: Problems are collected in a validation.Result, naming the field path and why composed branches failed
+
+package bridge
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lexlapax/go-llmspell/pkg/validation"
+)
+
+// ValidateSchema checks a value against a JSON schema and returns the
+// problems found as a *validation.Result, or nil. It supports type (a name
+// or a list of them), enum, const, properties and required, items,
+// minimum and maximum (and their exclusive forms), minLength, maxLength,
+// minItems, maxItems and pattern, the allOf, anyOf, oneOf and not
+// combinators, and if/then/else conditions; other keywords are ignored.
+// References must be resolved first, see tools.ResolveRefs. Schemas that
+// name custom rules need the tool bridge's, see ValidateParameters.
+func ValidateSchema(value interface{}, schema map[string]interface{}) error {
+	return schemaValidator{}.validate(value, schema)
+}
+
+// ValidationRule is a custom check that schemas apply to a value with the
+// "x-validate" keyword, naming the rule or a list of rules. It returns nil
+// if value passes, or an error whose message says what is wrong with it,
+// as in "must be a valid ISBN".
+type ValidationRule func(value interface{}) error
+
+// schemaValidator validates values against schemas, with the custom rules
+// they may name
+type schemaValidator struct {
+	rules map[string]ValidationRule
+}
+
+// validate checks value against schema and returns a *validation.Result
+// error, or nil
+func (sv schemaValidator) validate(value interface{}, schema map[string]interface{}) error {
+	result := &validation.Result{Errors: sv.validateSchema(value, schema, "")}
+	return result.Err()
+}
+
+// validateSchema checks value, found at path, against schema
+func (sv schemaValidator) validateSchema(value interface{}, schema map[string]interface{}, path string) []validation.Error {
+	if err := validateSchemaType(value, schema["type"], path); err != nil {
+		return []validation.Error{*err}
+	}
+
+	var errs []validation.Error
+	if enum, ok := schema["enum"].([]interface{}); ok && !containsValue(enum, value) {
+		options := make([]string, len(enum))
+		for i, option := range enum {
+			options[i] = validation.FormatValue(option)
+		}
+		errs = append(errs, validation.Error{Field: path, Code: validation.CodeEnum,
+			Message: fmt.Sprintf("must be one of %s, got %s", strings.Join(options, ", "), validation.FormatValue(value))})
+	}
+	if expected, ok := schema["const"]; ok && !equalValues(expected, value) {
+		errs = append(errs, validation.Error{Field: path, Code: validation.CodeConst,
+			Message: fmt.Sprintf("must be %s, got %s", validation.FormatValue(expected), validation.FormatValue(value))})
+	}
+	errs = append(errs, validateBounds(value, schema, path)...)
+	errs = append(errs, sv.validateRules(value, schema["x-validate"], path)...)
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		errs = append(errs, sv.validateObject(val, schema, path)...)
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range val {
+				errs = append(errs, sv.validateSchema(item, items, path+"["+strconv.Itoa(i)+"]")...)
+			}
+		}
+	}
+
+	errs = append(errs, sv.validateComposition(value, schema, path)...)
+	return append(errs, sv.validateConditional(value, schema, path)...)
+}
+
+// validateSchemaType checks value against a schema's type keyword
+func validateSchemaType(value interface{}, schemaType interface{}, path string) *validation.Error {
+	var types []string
+	switch t := schemaType.(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, name := range t {
+			if s, ok := name.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+	if len(types) == 0 {
+		return nil
+	}
+
+	for _, name := range types {
+		if validateType(value, name) == nil {
+			return nil
+		}
+	}
+	expected := make([]string, len(types))
+	for i, name := range types {
+		expected[i] = withArticle(name)
+	}
+	return &validation.Error{Field: path, Code: validation.CodeType,
+		Message: fmt.Sprintf("must be %s, got %s", strings.Join(expected, " or "), validation.TypeName(value))}
+}
+
+// withArticle names a JSON type in a sentence
+func withArticle(name string) string {
+	switch name {
+	case "null":
+		return name
+	case "integer", "object", "array":
+		return "an " + name
+	}
+	return "a " + name
+}
+
+// validateBounds checks the numeric, length and pattern keywords that
+// apply to value's type
+func validateBounds(value interface{}, schema map[string]interface{}, path string) []validation.Error {
+	var errs []validation.Error
+	bound := func(keyword, code, format string, actual float64, fails func(limit float64) bool) {
+		if limit, ok := toFloat(schema[keyword]); ok && fails(limit) {
+			errs = append(errs, validation.Error{Field: path, Code: code,
+				Message: fmt.Sprintf(format, formatNumber(limit), formatNumber(actual))})
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		n := float64(utf8.RuneCountInString(v))
+		bound("minLength", validation.CodeMinLength, "must be at least %s characters long, got %s", n, func(l float64) bool { return n < l })
+		bound("maxLength", validation.CodeMaxLength, "must be at most %s characters long, got %s", n, func(l float64) bool { return n > l })
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				errs = append(errs, validation.Error{Field: path, Code: validation.CodePattern,
+					Message: fmt.Sprintf("must match the pattern %s", pattern)})
+			}
+		}
+	case []interface{}:
+		n := float64(len(v))
+		bound("minItems", validation.CodeMinItems, "must have at least %s items, got %s", n, func(l float64) bool { return n < l })
+		bound("maxItems", validation.CodeMaxItems, "must have at most %s items, got %s", n, func(l float64) bool { return n > l })
+	default:
+		if n, ok := toFloat(value); ok {
+			bound("minimum", validation.CodeMinimum, "must be ≥ %s, got %s", n, func(l float64) bool { return n < l })
+			bound("exclusiveMinimum", validation.CodeMinimum, "must be > %s, got %s", n, func(l float64) bool { return n <= l })
+			bound("maximum", validation.CodeMaximum, "must be ≤ %s, got %s", n, func(l float64) bool { return n > l })
+			bound("exclusiveMaximum", validation.CodeMaximum, "must be < %s, got %s", n, func(l float64) bool { return n >= l })
+		}
+	}
+	return errs
+}
+
+// validateRules runs the custom rules an x-validate keyword names; a rule
+// that is not registered is an error, so that a typo does not skip a check
+func (sv schemaValidator) validateRules(value interface{}, names interface{}, path string) []validation.Error {
+	var rules []string
+	switch n := names.(type) {
+	case string:
+		rules = []string{n}
+	case []interface{}:
+		for _, name := range n {
+			if s, ok := name.(string); ok {
+				rules = append(rules, s)
+			}
+		}
+	}
+
+	var errs []validation.Error
+	for _, name := range rules {
+		rule, ok := sv.rules[name]
+		if !ok {
+			errs = append(errs, validation.Error{Field: path, Code: validation.CodeRule,
+				Message: fmt.Sprintf("names unknown validation rule %q", name)})
+			continue
+		}
+		if err := rule(value); err != nil {
+			errs = append(errs, validation.Error{Field: path, Code: validation.CodeRule, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// formatNumber renders a number without a needless fraction
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// validateObject checks an object's required properties and the values of
+// the properties it has, in name order
+func (sv schemaValidator) validateObject(obj map[string]interface{}, schema map[string]interface{}, path string) []validation.Error {
+	var errs []validation.Error
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, req := range required {
+			if name, ok := req.(string); ok {
+				if _, exists := obj[name]; !exists {
+					errs = append(errs, validation.Required(joinPath(path, name)))
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if propSchema, ok := properties[name].(map[string]interface{}); ok {
+			errs = append(errs, sv.validateSchema(obj[name], propSchema, joinPath(path, name))...)
+		}
+	}
+	return errs
+}
+
+// validateComposition checks the allOf, anyOf, oneOf and not keywords.
+// allOf failures are reported as the errors of the branches; the others
+// are reported at path, with why each branch failed as details.
+func (sv schemaValidator) validateComposition(value interface{}, schema map[string]interface{}, path string) []validation.Error {
+	var errs []validation.Error
+	if branches, ok := schema["allOf"].([]interface{}); ok {
+		for _, branch := range branches {
+			errs = append(errs, sv.validateBranch(value, branch, path)...)
+		}
+	}
+
+	if branches, ok := schema["anyOf"].([]interface{}); ok {
+		matched, failures := sv.matchBranches(value, branches, path)
+		if len(matched) == 0 {
+			errs = append(errs, validation.Error{Field: path, Code: validation.CodeAnyOf,
+				Message: fmt.Sprintf("must match at least one of %d alternatives", len(branches)), Details: failures})
+		}
+	}
+
+	if branches, ok := schema["oneOf"].([]interface{}); ok {
+		matched, failures := sv.matchBranches(value, branches, path)
+		switch {
+		case len(matched) == 0:
+			errs = append(errs, validation.Error{Field: path, Code: validation.CodeOneOf,
+				Message: fmt.Sprintf("must match one of %d alternatives", len(branches)), Details: failures})
+		case len(matched) > 1:
+			numbers := make([]string, len(matched))
+			for i, n := range matched {
+				numbers[i] = strconv.Itoa(n + 1)
+			}
+			errs = append(errs, validation.Error{Field: path, Code: validation.CodeOneOf,
+				Message: fmt.Sprintf("must match exactly one of %d alternatives, but matches %s", len(branches), strings.Join(numbers, " and "))})
+		}
+	}
+
+	if not, ok := schema["not"]; ok {
+		if len(sv.validateBranch(value, not, path)) == 0 {
+			errs = append(errs, validation.Error{Field: path, Code: validation.CodeNot,
+				Message: "matches a schema it must not match"})
+		}
+	}
+	return errs
+}
+
+// validateConditional checks the if, then and else keywords: value must
+// match then if it matches if, and else otherwise. The error says which
+// branch applied.
+func (sv schemaValidator) validateConditional(value interface{}, schema map[string]interface{}, path string) []validation.Error {
+	cond, ok := schema["if"]
+	if !ok {
+		return nil
+	}
+
+	branch, applied := "then", "the if condition holds"
+	if len(sv.validateBranch(value, cond, path)) > 0 {
+		branch, applied = "else", "the if condition does not hold"
+	}
+	target, ok := schema[branch]
+	if !ok {
+		return nil
+	}
+	failures := sv.validateBranch(value, target, path)
+	if len(failures) == 0 {
+		return nil
+	}
+	return []validation.Error{{Field: path, Code: validation.CodeCondition,
+		Message: fmt.Sprintf("does not meet the %s requirements, which apply because %s", branch, applied),
+		Details: describe(failures, path)}}
+}
+
+// matchBranches returns the indexes of the branches value matches and why
+// the others failed, numbering alternatives from 1
+func (sv schemaValidator) matchBranches(value interface{}, branches []interface{}, path string) ([]int, []string) {
+	var matched []int
+	var failures []string
+	for i, branch := range branches {
+		if errs := sv.validateBranch(value, branch, path); len(errs) > 0 {
+			failures = append(failures, fmt.Sprintf("alternative %d: %s", i+1, strings.Join(describe(errs, path), ", ")))
+		} else {
+			matched = append(matched, i)
+		}
+	}
+	return matched, failures
+}
+
+// describe renders the errors of a branch relative to the field it checks
+func describe(errs []validation.Error, path string) []string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.RelativeTo(path)
+	}
+	return messages
+}
+
+// validateBranch checks value against a branch of a composed schema; a
+// branch that is not a schema object matches anything
+func (sv schemaValidator) validateBranch(value interface{}, branch interface{}, path string) []validation.Error {
+	schema, ok := branch.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return sv.validateSchema(value, schema, path)
+}
+
+// joinPath adds a property name to a parameter path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// containsValue reports whether an enum holds value
+func containsValue(enum []interface{}, value interface{}) bool {
+	for _, option := range enum {
+		if equalValues(option, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalValues compares scalar schema values, treating all numeric types
+// alike since scripts and JSON produce different ones
+func equalValues(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b) && fmt.Sprintf("%T", a) == fmt.Sprintf("%T", b)
+}
+
+// toFloat converts a numeric value to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// isWhole reports whether a numeric value is an integer
+func isWhole(v interface{}) bool {
+	f, ok := toFloat(v)
+	return ok && f == math.Trunc(f) && !math.IsInf(f, 0)
+}
@@ -0,0 +1,278 @@
+// ABOUTME: Tests for validating values against tool parameter schemas
+// ABOUTME: Covers nested properties, bounds, composition, if/then/else and the messages each produces
+
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+	"github.com/lexlapax/go-llmspell/pkg/validation"
+)
+
+func decodeTestSchema(t *testing.T, raw string) map[string]interface{} {
+	t.Helper()
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		t.Fatalf("invalid test schema: %v", err)
+	}
+	return schema
+}
+
+func TestValidateSchema(t *testing.T) {
+	schema := decodeTestSchema(t, `{
+		"type": "object",
+		"properties": {
+			"user": {
+				"oneOf": [
+					{"type": "string", "description": "A user ID"},
+					{"type": "object", "properties": {"name": {"type": "string"}, "age": {"type": "integer"}}, "required": ["name"]}
+				]
+			},
+			"tags": {"type": "array", "items": {"type": "string", "enum": ["a", "b"]}},
+			"limit": {"type": ["integer", "null"]},
+			"mode": {"anyOf": [{"const": "fast"}, {"const": "slow"}]},
+			"range": {"allOf": [{"type": "object", "required": ["min"]}, {"required": ["max"]}]},
+			"name": {"type": "string", "not": {"enum": ["root"]}}
+		},
+		"required": ["user"]
+	}`)
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   string
+	}{
+		{"string ID", map[string]interface{}{"user": "u-42"}, ""},
+		{"user object", map[string]interface{}{"user": map[string]interface{}{"name": "Ada", "age": float64(36)}}, ""},
+		{"missing user", map[string]interface{}{}, "field 'user' is required"},
+		{"user number", map[string]interface{}{"user": float64(42)},
+			"field 'user' must match one of 2 alternatives (alternative 1: must be a string, got number; alternative 2: must be an object, got number)"},
+		{"user without name", map[string]interface{}{"user": map[string]interface{}{"age": float64(36)}},
+			"alternative 2: field 'user.name' is required"},
+		{"user with fractional age", map[string]interface{}{"user": map[string]interface{}{"name": "Ada", "age": 36.5}},
+			"alternative 2: field 'user.age' must be an integer, got number"},
+		{"tags", map[string]interface{}{"user": "u", "tags": []interface{}{"a", "b"}}, ""},
+		{"bad tag", map[string]interface{}{"user": "u", "tags": []interface{}{"a", "c"}}, `field 'tags[1]' must be one of "a", "b", got "c"`},
+		{"null limit", map[string]interface{}{"user": "u", "limit": nil}, ""},
+		{"string limit", map[string]interface{}{"user": "u", "limit": "10"}, "field 'limit' must be an integer or null, got string"},
+		{"mode", map[string]interface{}{"user": "u", "mode": "slow"}, ""},
+		{"bad mode", map[string]interface{}{"user": "u", "mode": "medium"},
+			`field 'mode' must match at least one of 2 alternatives (alternative 1: must be "fast", got "medium"; alternative 2: must be "slow", got "medium")`},
+		{"range", map[string]interface{}{"user": "u", "range": map[string]interface{}{"min": 1, "max": 2}}, ""},
+		{"range without max", map[string]interface{}{"user": "u", "range": map[string]interface{}{"min": 1}},
+			"field 'range.max' is required"},
+		{"name", map[string]interface{}{"user": "u", "name": "ada"}, ""},
+		{"forbidden name", map[string]interface{}{"user": "u", "name": "root"}, "field 'name' matches a schema it must not match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSchema(tt.params, schema)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("expected valid parameters, got %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateSchemaOneOfAmbiguous(t *testing.T) {
+	schema := decodeTestSchema(t, `{"oneOf": [{"type": "number"}, {"type": "integer"}]}`)
+
+	if err := ValidateSchema(1.5, schema); err != nil {
+		t.Errorf("expected 1.5 to match only the number branch, got %v", err)
+	}
+	err := ValidateSchema(float64(2), schema)
+	if err == nil || !strings.Contains(err.Error(), "input must match exactly one of 2 alternatives, but matches 1 and 2") {
+		t.Errorf("expected an ambiguous oneOf error, got %v", err)
+	}
+}
+
+func TestValidateParametersComposedSchema(t *testing.T) {
+	registry := tools.NewRegistry()
+	bridge := NewToolBridge(registry)
+
+	noop := func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	_ = registry.Register(tools.NewFunctionTool("lookup", "Looks up a record by ID or by name", json.RawMessage(`{
+		"type": "object",
+		"properties": {"id": {"type": "string"}, "name": {"type": "string"}},
+		"oneOf": [{"required": ["id"]}, {"required": ["name"]}]
+	}`), noop))
+
+	if err := bridge.ValidateParameters("lookup", map[string]interface{}{"id": "r-1"}); err != nil {
+		t.Errorf("expected lookup by ID to validate, got %v", err)
+	}
+	if err := bridge.ValidateParameters("lookup", map[string]interface{}{"name": "Ada"}); err != nil {
+		t.Errorf("expected lookup by name to validate, got %v", err)
+	}
+
+	err := bridge.ValidateParameters("lookup", map[string]interface{}{})
+	want := "input must match one of 2 alternatives (alternative 1: field 'id' is required; alternative 2: field 'name' is required)"
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+	err = bridge.ValidateParameters("lookup", map[string]interface{}{"id": "r-1", "name": "Ada"})
+	if err == nil || !strings.Contains(err.Error(), "but matches 1 and 2") {
+		t.Errorf("expected an ambiguous lookup to fail, got %v", err)
+	}
+}
+
+func TestValidateSchemaConditional(t *testing.T) {
+	schema := decodeTestSchema(t, `{
+		"type": "object",
+		"properties": {
+			"mode": {"enum": ["file", "url"]},
+			"path": {"type": "string"},
+			"url": {"type": "string"}
+		},
+		"required": ["mode"],
+		"if": {"properties": {"mode": {"const": "file"}}},
+		"then": {"required": ["path"]},
+		"else": {"required": ["url"]}
+	}`)
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   string
+	}{
+		{"file with path", map[string]interface{}{"mode": "file", "path": "/tmp/a"}, ""},
+		{"url with url", map[string]interface{}{"mode": "url", "url": "https://example.com"}, ""},
+		{"file without path", map[string]interface{}{"mode": "file", "url": "https://example.com"},
+			"input does not meet the then requirements, which apply because the if condition holds (field 'path' is required)"},
+		{"url without url", map[string]interface{}{"mode": "url", "path": "/tmp/a"},
+			"input does not meet the else requirements, which apply because the if condition does not hold (field 'url' is required)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSchema(tt.params, schema)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("expected valid parameters, got %v", err)
+			case tt.want != "" && (err == nil || err.Error() != tt.want):
+				t.Errorf("expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// Without an else, parameters that do not match if are not constrained
+	delete(schema, "else")
+	if err := ValidateSchema(map[string]interface{}{"mode": "url"}, schema); err != nil {
+		t.Errorf("expected no else constraint, got %v", err)
+	}
+}
+
+func TestValidateSchemaBoundsAndMultipleErrors(t *testing.T) {
+	schema := decodeTestSchema(t, `{
+		"type": "object",
+		"properties": {
+			"temperature": {"type": "number", "minimum": 0, "maximum": 2},
+			"top_p": {"type": "number", "exclusiveMinimum": 0},
+			"name": {"type": "string", "minLength": 2, "maxLength": 5, "pattern": "^[a-z]+$"},
+			"stops": {"type": "array", "maxItems": 1}
+		},
+		"required": ["model", "name"]
+	}`)
+
+	err := ValidateSchema(map[string]interface{}{
+		"temperature": float64(5),
+		"top_p":       float64(0),
+		"name":        "Abcdefg",
+		"stops":       []interface{}{"a", "b"},
+	}, schema)
+
+	var result *validation.Result
+	if !errors.As(err, &result) {
+		t.Fatalf("expected a *validation.Result, got %T: %v", err, err)
+	}
+	want := []string{
+		"field 'model' is required",
+		"field 'name' must be at most 5 characters long, got 7",
+		"field 'name' must match the pattern ^[a-z]+$",
+		"field 'stops' must have at most 1 items, got 2",
+		"field 'temperature' must be ≤ 2, got 5",
+		"field 'top_p' must be > 0, got 0",
+	}
+	if len(result.Errors) != len(want) {
+		t.Fatalf("expected %d errors, got %v", len(want), result.Errors)
+	}
+	for i, w := range want {
+		if got := result.Errors[i].Error(); got != w {
+			t.Errorf("error %d: expected %q, got %q", i, w, got)
+		}
+	}
+	if result.Errors[4].Code != validation.CodeMaximum || result.Errors[4].Field != "temperature" {
+		t.Errorf("expected a maximum error for temperature, got %+v", result.Errors[4])
+	}
+}
+
+func TestValidateParametersCustomRules(t *testing.T) {
+	registry := tools.NewRegistry()
+	bridge := NewToolBridge(registry)
+
+	isbn := func(value interface{}) error {
+		s, _ := value.(string)
+		if len(strings.ReplaceAll(s, "-", "")) != 13 {
+			return errors.New("must be a valid ISBN")
+		}
+		return nil
+	}
+	if err := bridge.RegisterValidationRule("isbn", isbn); err != nil {
+		t.Fatalf("RegisterValidationRule failed: %v", err)
+	}
+	if err := bridge.RegisterValidationRule("", isbn); err == nil {
+		t.Error("expected an error for a rule without a name")
+	}
+	if err := bridge.RegisterValidationRule("nil", nil); err == nil {
+		t.Error("expected an error for a rule without a function")
+	}
+
+	noop := func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	_ = registry.Register(tools.NewFunctionTool("lookup_book", "Looks up a book", json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"isbn": {"type": "string", "x-validate": "isbn"},
+			"related": {"type": "array", "items": {"x-validate": ["isbn"]}},
+			"shelf": {"type": "string", "x-validate": "shelf_code"}
+		}
+	}`), noop))
+
+	if err := bridge.ValidateParameters("lookup_book", map[string]interface{}{
+		"isbn":    "978-0-13-468599-1",
+		"related": []interface{}{"9780134685991"},
+	}); err != nil {
+		t.Errorf("expected valid ISBNs to pass, got %v", err)
+	}
+
+	err := bridge.ValidateParameters("lookup_book", map[string]interface{}{
+		"isbn":    "12345",
+		"related": []interface{}{"9780134685991", "x"},
+		"shelf":   "A1",
+	})
+	want := "field 'isbn' must be a valid ISBN; field 'related[1]' must be a valid ISBN; field 'shelf' names unknown validation rule \"shelf_code\""
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+	var result *validation.Result
+	if errors.As(err, &result) && result.Errors[0].Code != validation.CodeRule {
+		t.Errorf("expected rule errors to have the rule code, got %s", result.Errors[0].Code)
+	}
+
+	// Rules are looked up when validating, so registering one fixes the schema
+	_ = bridge.RegisterValidationRule("shelf_code", func(value interface{}) error { return nil })
+	if err := bridge.ValidateParameters("lookup_book", map[string]interface{}{"shelf": "A1"}); err != nil {
+		t.Errorf("expected the newly registered rule to be used, got %v", err)
+	}
+}
@@ -0,0 +1,363 @@
+// ABOUTME: Vector store bridge: upserts, queries, and deletes vectors by namespace in a pluggable VectorStore
+// ABOUTME: Records and queries given as text are embedded first, so spells can index and search documents directly
+
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultVectorTopK is how many matches a query returns unless it says
+const DefaultVectorTopK = 10
+
+// VectorRecord is a vector stored under an ID in a namespace, with the
+// text it was embedded from, if any, and metadata to filter on
+type VectorRecord struct {
+	ID       string                 `json:"id"`
+	Vector   []float64              `json:"vector,omitempty"`
+	Text     string                 `json:"text,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// VectorQuery finds the records most similar to Vector. Filter keeps only
+// records whose metadata has each of its keys with an equal value.
+type VectorQuery struct {
+	Vector []float64
+	Text   string
+	TopK   int
+	Filter map[string]interface{}
+}
+
+// VectorMatch is a record found by a query, with its cosine similarity to
+// the query vector
+type VectorMatch struct {
+	VectorRecord
+	Score float64 `json:"score"`
+}
+
+// VectorStore keeps vector records in namespaces. Upserting a record
+// replaces the one with its ID; namespaces are created on first upsert.
+// Querying or deleting in a namespace that does not exist finds nothing.
+// Implementations must be safe for concurrent use.
+type VectorStore interface {
+	Upsert(ctx context.Context, namespace string, records []VectorRecord) error
+	Query(ctx context.Context, namespace string, query VectorQuery) ([]VectorMatch, error)
+	Delete(ctx context.Context, namespace string, ids []string) error
+
+	// Namespaces lists the namespaces with records, sorted
+	Namespaces(ctx context.Context) ([]string, error)
+
+	// Drop deletes a namespace and its records
+	Drop(ctx context.Context, namespace string) error
+}
+
+// EmbedFunc turns texts into vectors, one per text in order, as
+// EmbeddingsBridge.EmbedBatch does
+type EmbedFunc func(ctx context.Context, texts []string) ([][]float64, error)
+
+// VectorStoreBridge gives scripts a VectorStore, embedding the text of
+// records and queries that come without a vector
+type VectorStoreBridge struct {
+	store VectorStore
+	embed EmbedFunc
+}
+
+// NewVectorStoreBridge uses store, embedding text with embed; with a nil
+// embed, records and queries must carry their vectors
+func NewVectorStoreBridge(store VectorStore, embed EmbedFunc) *VectorStoreBridge {
+	return &VectorStoreBridge{store: store, embed: embed}
+}
+
+// Upsert stores records in namespace, embedding the text of those without
+// a vector in one batch
+func (b *VectorStoreBridge) Upsert(ctx context.Context, namespace string, records []VectorRecord) error {
+	if err := checkNamespace(namespace); err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	var texts []string
+	var missing []int
+	for i, record := range records {
+		if record.ID == "" {
+			return fmt.Errorf("record %d: an id is required", i+1)
+		}
+		if len(record.Vector) == 0 {
+			if record.Text == "" {
+				return fmt.Errorf("record %d: a vector or text is required", i+1)
+			}
+			texts = append(texts, record.Text)
+			missing = append(missing, i)
+		}
+	}
+	if len(texts) > 0 {
+		vectors, err := b.embedTexts(ctx, texts)
+		if err != nil {
+			return err
+		}
+		records = append([]VectorRecord(nil), records...)
+		for i, index := range missing {
+			records[index].Vector = vectors[i]
+		}
+	}
+	return b.store.Upsert(ctx, namespace, records)
+}
+
+// Query returns the records of namespace most similar to query, most
+// similar first, embedding its text when it has no vector
+func (b *VectorStoreBridge) Query(ctx context.Context, namespace string, query VectorQuery) ([]VectorMatch, error) {
+	if err := checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	if len(query.Vector) == 0 {
+		if query.Text == "" {
+			return nil, fmt.Errorf("a query needs a vector or text")
+		}
+		vectors, err := b.embedTexts(ctx, []string{query.Text})
+		if err != nil {
+			return nil, err
+		}
+		query.Vector = vectors[0]
+	}
+	if query.TopK <= 0 {
+		query.TopK = DefaultVectorTopK
+	}
+	return b.store.Query(ctx, namespace, query)
+}
+
+// Delete removes the records with ids from namespace
+func (b *VectorStoreBridge) Delete(ctx context.Context, namespace string, ids []string) error {
+	if err := checkNamespace(namespace); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return b.store.Delete(ctx, namespace, ids)
+}
+
+// Namespaces lists the namespaces with records
+func (b *VectorStoreBridge) Namespaces(ctx context.Context) ([]string, error) {
+	return b.store.Namespaces(ctx)
+}
+
+// Drop deletes namespace and its records
+func (b *VectorStoreBridge) Drop(ctx context.Context, namespace string) error {
+	if err := checkNamespace(namespace); err != nil {
+		return err
+	}
+	return b.store.Drop(ctx, namespace)
+}
+
+// embedTexts embeds texts, or explains that there is nothing to do it with
+func (b *VectorStoreBridge) embedTexts(ctx context.Context, texts []string) ([][]float64, error) {
+	if b.embed == nil {
+		return nil, fmt.Errorf("text cannot be embedded without an embeddings provider; pass vectors instead")
+	}
+	vectors, err := b.embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("embedding failed: %d vectors for %d texts", len(vectors), len(texts))
+	}
+	return vectors, nil
+}
+
+// checkNamespace accepts names of letters, digits, '-', '_' and '.', which
+// every backend can use as a table key or collection name
+func checkNamespace(namespace string) error {
+	if namespace == "" {
+		return fmt.Errorf("a namespace is required")
+	}
+	if strings.IndexFunc(namespace, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	}) >= 0 {
+		return fmt.Errorf("invalid namespace %q: use letters, digits, '-', '_' and '.'", namespace)
+	}
+	return nil
+}
+
+// RankRecords returns the records matching query's filter that are most
+// similar to its vector, at most TopK of them, most similar first. Stores
+// without an index of their own rank with it.
+func RankRecords(records []VectorRecord, query VectorQuery) ([]VectorMatch, error) {
+	matches := make([]VectorMatch, 0, len(records))
+	for _, record := range records {
+		if !MatchesFilter(record.Metadata, query.Filter) {
+			continue
+		}
+		score, err := CosineSimilarity(query.Vector, record.Vector)
+		if err != nil {
+			return nil, fmt.Errorf("record %s: %w", record.ID, err)
+		}
+		matches = append(matches, VectorMatch{VectorRecord: record, Score: score})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if query.TopK > 0 && query.TopK < len(matches) {
+		matches = matches[:query.TopK]
+	}
+	return matches, nil
+}
+
+// MatchesFilter reports whether metadata has each key of filter with an
+// equal value
+func MatchesFilter(metadata, filter map[string]interface{}) bool {
+	for key, want := range filter {
+		got, ok := metadata[key]
+		if !ok || !equalValues(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// MemoryVectorStore is a VectorStore keeping records in memory, for the
+// length of a run
+type MemoryVectorStore struct {
+	mu         sync.RWMutex
+	namespaces map[string]map[string]VectorRecord
+}
+
+// NewMemoryVectorStore creates an empty store
+func NewMemoryVectorStore() *MemoryVectorStore {
+	return &MemoryVectorStore{namespaces: make(map[string]map[string]VectorRecord)}
+}
+
+// Upsert stores records, replacing those with the same IDs
+func (m *MemoryVectorStore) Upsert(ctx context.Context, namespace string, records []VectorRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.namespaces[namespace]
+	if !ok {
+		stored = make(map[string]VectorRecord)
+		m.namespaces[namespace] = stored
+	}
+	for _, record := range records {
+		stored[record.ID] = record
+	}
+	return nil
+}
+
+// Query ranks the records of namespace against query
+func (m *MemoryVectorStore) Query(ctx context.Context, namespace string, query VectorQuery) ([]VectorMatch, error) {
+	m.mu.RLock()
+	records := make([]VectorRecord, 0, len(m.namespaces[namespace]))
+	for _, record := range m.namespaces[namespace] {
+		records = append(records, record)
+	}
+	m.mu.RUnlock()
+
+	// Ties keep the order of IDs rather than of the map
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+	return RankRecords(records, query)
+}
+
+// Delete removes records by ID
+func (m *MemoryVectorStore) Delete(ctx context.Context, namespace string, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.namespaces[namespace]
+	for _, id := range ids {
+		delete(stored, id)
+	}
+	if stored != nil && len(stored) == 0 {
+		delete(m.namespaces, namespace)
+	}
+	return nil
+}
+
+// Namespaces lists the namespaces with records
+func (m *MemoryVectorStore) Namespaces(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.namespaces))
+	for name := range m.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Drop deletes a namespace
+func (m *MemoryVectorStore) Drop(ctx context.Context, namespace string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.namespaces, namespace)
+	return nil
+}
+
+// Name returns the name of the bridge
+func (b *VectorStoreBridge) Name() string {
+	return "vectorstore"
+}
+
+// Methods returns information about all methods exposed by this bridge
+func (b *VectorStoreBridge) Methods() []MethodInfo {
+	return []MethodInfo{
+		{
+			Name:        "upsert",
+			Description: "Store records in a namespace, embedding the text of those without a vector",
+			Parameters: []ParameterInfo{
+				{Name: "namespace", Type: "string", Required: true, Description: "Namespace to store in"},
+				{Name: "records", Type: "array", Required: true, Description: "Records of id, vector or text, and metadata"},
+			},
+			ReturnType: "number",
+		},
+		{
+			Name:        "query",
+			Description: "Find the records most similar to a vector or text",
+			Parameters: []ParameterInfo{
+				{Name: "namespace", Type: "string", Required: true, Description: "Namespace to search"},
+				{Name: "query", Type: "object", Required: true, Description: "vector or text, top_k, and a metadata filter"},
+			},
+			ReturnType: "VectorMatch[]",
+		},
+		{
+			Name:        "delete",
+			Description: "Remove records by id",
+			Parameters: []ParameterInfo{
+				{Name: "namespace", Type: "string", Required: true, Description: "Namespace to remove from"},
+				{Name: "ids", Type: "array", Required: true, Description: "IDs of the records"},
+			},
+			ReturnType: "void",
+		},
+		{
+			Name:        "namespaces",
+			Description: "List the namespaces with records",
+			ReturnType:  "string[]",
+		},
+		{
+			Name:        "drop",
+			Description: "Delete a namespace and its records",
+			Parameters: []ParameterInfo{
+				{Name: "namespace", Type: "string", Required: true, Description: "Namespace to delete"},
+			},
+			ReturnType: "void",
+		},
+	}
+}
+
+// Initialize prepares the bridge for use
+func (b *VectorStoreBridge) Initialize(ctx context.Context) error {
+	return nil
+}
+
+// Cleanup releases any resources held by the bridge
+func (b *VectorStoreBridge) Cleanup(ctx context.Context) error {
+	return nil
+}
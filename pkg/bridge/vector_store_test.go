@@ -0,0 +1,107 @@
+// ABOUTME: Tests for the vector store bridge and the in-memory store
+// ABOUTME: Validates upserts, embedding of text, ranking, metadata filters, deletes, and namespaces
+
+package bridge
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVectorStoreBridge(t *testing.T) {
+	ctx := context.Background()
+	var embedded [][]string
+	// embed puts texts mentioning cats on one axis and the rest on another
+	embed := func(ctx context.Context, texts []string) ([][]float64, error) {
+		embedded = append(embedded, texts)
+		vectors := make([][]float64, len(texts))
+		for i, text := range texts {
+			vectors[i] = []float64{0, 1}
+			if strings.Contains(text, "cat") {
+				vectors[i] = []float64{1, 0}
+			}
+		}
+		return vectors, nil
+	}
+	vb := NewVectorStoreBridge(NewMemoryVectorStore(), embed)
+
+	err := vb.Upsert(ctx, "docs", []VectorRecord{
+		{ID: "a", Text: "cats purr", Metadata: map[string]interface{}{"lang": "en"}},
+		{ID: "b", Text: "dogs bark", Metadata: map[string]interface{}{"lang": "en"}},
+		{ID: "c", Vector: []float64{1, 0.1}, Metadata: map[string]interface{}{"lang": "fr"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(embedded, [][]string{{"cats purr", "dogs bark"}}) {
+		t.Errorf("Expected the texts to be embedded in one batch, got %v", embedded)
+	}
+
+	t.Run("ranks by similarity", func(t *testing.T) {
+		matches, err := vb.Query(ctx, "docs", VectorQuery{Text: "a cat", TopK: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 2 || matches[0].ID != "a" || matches[1].ID != "c" || matches[0].Text != "cats purr" {
+			t.Errorf("Unexpected matches: %+v", matches)
+		}
+	})
+
+	t.Run("filters on metadata", func(t *testing.T) {
+		matches, err := vb.Query(ctx, "docs", VectorQuery{Vector: []float64{1, 0}, Filter: map[string]interface{}{"lang": "en"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 2 || matches[0].ID != "a" || matches[1].ID != "b" {
+			t.Errorf("Unexpected matches: %+v", matches)
+		}
+	})
+
+	t.Run("keeps namespaces apart", func(t *testing.T) {
+		if err := vb.Upsert(ctx, "notes", []VectorRecord{{ID: "a", Vector: []float64{0, 1}}}); err != nil {
+			t.Fatal(err)
+		}
+		namespaces, _ := vb.Namespaces(ctx)
+		if !reflect.DeepEqual(namespaces, []string{"docs", "notes"}) {
+			t.Errorf("Namespaces() = %v", namespaces)
+		}
+		if err := vb.Drop(ctx, "notes"); err != nil {
+			t.Fatal(err)
+		}
+		if matches, _ := vb.Query(ctx, "notes", VectorQuery{Vector: []float64{0, 1}}); len(matches) != 0 {
+			t.Errorf("Expected a dropped namespace to be empty, got %+v", matches)
+		}
+	})
+
+	t.Run("deletes and replaces records", func(t *testing.T) {
+		if err := vb.Delete(ctx, "docs", []string{"a"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := vb.Upsert(ctx, "docs", []VectorRecord{{ID: "b", Vector: []float64{1, 0}}}); err != nil {
+			t.Fatal(err)
+		}
+		matches, _ := vb.Query(ctx, "docs", VectorQuery{Vector: []float64{1, 0}, TopK: 1})
+		if len(matches) != 1 || matches[0].ID != "b" || matches[0].Score != 1 {
+			t.Errorf("Unexpected matches: %+v", matches)
+		}
+	})
+
+	t.Run("refuses invalid input", func(t *testing.T) {
+		for _, records := range [][]VectorRecord{{{Text: "no id"}}, {{ID: "x"}}} {
+			if err := vb.Upsert(ctx, "docs", records); err == nil {
+				t.Errorf("Expected %+v to be refused", records)
+			}
+		}
+		if err := vb.Upsert(ctx, "../docs", []VectorRecord{{ID: "x", Vector: []float64{1}}}); err == nil {
+			t.Error("Expected an invalid namespace to be refused")
+		}
+		if _, err := vb.Query(ctx, "docs", VectorQuery{Vector: []float64{1, 0, 0}}); err == nil {
+			t.Error("Expected a vector of another dimension to be refused")
+		}
+		if err := NewVectorStoreBridge(NewMemoryVectorStore(), nil).Upsert(ctx, "docs", []VectorRecord{{ID: "x", Text: "hi"}}); err == nil {
+			t.Error("Expected text to be refused without an embeddings provider")
+		}
+	})
+}
@@ -0,0 +1,112 @@
+// ABOUTME: Collects advisory warnings from spells and bridges, kept apart from errors
+// ABOUTME: Warnings are listed when a run ends and in the JSON run summary
+
+package bridge
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/clock"
+)
+
+// Sources of warnings
+const (
+	// WarnSpell marks warnings a script raised with warn()
+	WarnSpell = "spell"
+
+	// WarnLLM marks warnings from the LLM bridge, such as a prompt retried
+	// after overflowing the context window
+	WarnLLM = "llm"
+
+	// WarnBudget marks a run nearing its call budget
+	WarnBudget = "budget"
+
+	// WarnTools marks problems setting up the tools bridge
+	WarnTools = "tools"
+
+	// WarnConfig marks settings that were ignored because they were invalid
+	WarnConfig = "config"
+
+	// WarnDeprecated marks calls to deprecated methods
+	WarnDeprecated = "deprecated"
+
+	// WarnSnapshot marks differences between a replayed run and its snapshot
+	WarnSnapshot = "snapshot"
+
+	// WarnHook marks global post-run hooks that failed
+	WarnHook = "hook"
+)
+
+// Warning is a non-fatal problem worth reporting. Count is how many times
+// the same warning was raised; Data and Time are from the first.
+type Warning struct {
+	Source  string                 `json:"source"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+	Time    time.Time              `json:"time"`
+	Count   int                    `json:"count"`
+}
+
+// Warnings collects the warnings of a run, including its sub-spells. A
+// warning raised again, such as one from inside a loop, is counted rather
+// than repeated. It is safe for concurrent use.
+type Warnings struct {
+	mu    sync.Mutex
+	list  []Warning
+	index map[[2]string]int
+	clock clock.Clock
+}
+
+// NewWarnings creates an empty collector
+func NewWarnings() *Warnings {
+	return &Warnings{index: make(map[[2]string]int), clock: clock.Real}
+}
+
+// SetClock makes warnings take their time from c
+func (w *Warnings) SetClock(c clock.Clock) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.clock = c
+}
+
+// Add records a warning from source. A nil collector logs it instead, so
+// warnings are never lost.
+func (w *Warnings) Add(source, message string, data map[string]interface{}) {
+	if w == nil {
+		log.Printf("Warning: %s: %s", source, message)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := [2]string{source, message}
+	if i, ok := w.index[key]; ok {
+		w.list[i].Count++
+		return
+	}
+	w.index[key] = len(w.list)
+	w.list = append(w.list, Warning{Source: source, Message: message, Data: data, Time: w.clock.Now(), Count: 1})
+}
+
+// Sink returns a function that adds warnings from source, for callers that
+// should not depend on the collector
+func (w *Warnings) Sink(source string) func(message string, data map[string]interface{}) {
+	return func(message string, data map[string]interface{}) {
+		w.Add(source, message, data)
+	}
+}
+
+// List returns the warnings in the order they were first raised
+func (w *Warnings) List() []Warning {
+	if w == nil {
+		return []Warning{}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]Warning{}, w.list...)
+}
@@ -0,0 +1,33 @@
+// ABOUTME: Tests for the warnings collector
+// ABOUTME: Verifies warnings keep their order and repeated ones are counted
+
+package bridge
+
+import "testing"
+
+func TestWarnings(t *testing.T) {
+	w := NewWarnings()
+	w.Add(WarnSpell, "slow source", map[string]interface{}{"url": "https://example.com"})
+	w.Add(WarnLLM, "prompt trimmed", nil)
+	w.Sink(WarnSpell)("slow source", nil)
+
+	list := w.List()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 warnings, got %d", len(list))
+	}
+	if list[0].Source != WarnSpell || list[0].Count != 2 {
+		t.Errorf("expected the repeated spell warning to be counted, got %+v", list[0])
+	}
+	if list[0].Data["url"] != "https://example.com" {
+		t.Errorf("expected the first warning's data to be kept, got %v", list[0].Data)
+	}
+	if list[1].Source != WarnLLM || list[1].Count != 1 {
+		t.Errorf("unexpected second warning: %+v", list[1])
+	}
+
+	var none *Warnings
+	none.Add(WarnConfig, "logged instead", nil)
+	if got := none.List(); got == nil || len(got) != 0 {
+		t.Errorf("expected an empty list from a nil collector, got %v", got)
+	}
+}
@@ -0,0 +1,170 @@
+// ABOUTME: Watchdog for bridge calls into code that may not honor context cancellation
+// ABOUTME: A call that outlives its timeout is abandoned and logged so the spell can continue
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCallTimeout is returned for a bridge call the watchdog abandoned
+var ErrCallTimeout = errors.New("bridge call timed out")
+
+// abandonGrace is how long a call may take to return after its context ends
+const abandonGrace = 100 * time.Millisecond
+
+// StuckCall describes a call the watchdog abandoned that has not returned yet
+type StuckCall struct {
+	Name    string        `json:"name"`
+	Started time.Time     `json:"started"`
+	Timeout time.Duration `json:"timeout_ns"`
+}
+
+// Watchdog runs bridge calls in their own goroutine and stops waiting for
+// one when its timeout passes or its context is done, even if the call
+// ignores the context. The abandoned goroutine keeps running until the call
+// returns; its result is then discarded.
+//
+// Only calls that touch nothing but Go state may be abandoned. A call that
+// runs script code, such as a tool or agent registered from Lua or a
+// streaming callback, must not be, since the abandoned goroutine would use
+// the script engine concurrently with the spell.
+type Watchdog struct {
+	timeout time.Duration
+	logger  *slog.Logger
+
+	mu    sync.Mutex
+	next  uint64
+	stuck map[uint64]StuckCall
+}
+
+// NewWatchdog creates a watchdog that abandons calls after timeout; zero
+// only abandons calls whose context is done. Stuck calls are logged to
+// logger, or to the default logger when it is nil.
+func NewWatchdog(timeout time.Duration, logger *slog.Logger) *Watchdog {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Watchdog{timeout: timeout, logger: logger, stuck: make(map[uint64]StuckCall)}
+}
+
+// Timeout returns how long a call may run
+func (w *Watchdog) Timeout() time.Duration {
+	if w == nil {
+		return 0
+	}
+	return w.timeout
+}
+
+// Call runs fn, passing it a context that ends at the timeout. If fn has not
+// returned shortly after that, Call returns an error wrapping ErrCallTimeout,
+// or the context's error if ctx ended first. A nil watchdog calls fn directly.
+func (w *Watchdog) Call(ctx context.Context, name string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if w == nil {
+		return fn(ctx)
+	}
+
+	callCtx, cancel := ctx, context.CancelFunc(func() {})
+	if w.timeout > 0 {
+		callCtx, cancel = context.WithTimeout(ctx, w.timeout)
+	}
+	defer cancel()
+
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	call := &watchedCall{StuckCall: StuckCall{Name: name, Started: time.Now(), Timeout: w.timeout}}
+
+	go func() {
+		var out outcome
+		defer func() {
+			if r := recover(); r != nil {
+				out = outcome{err: fmt.Errorf("%s panicked: %v", name, r)}
+			}
+			done <- out
+			w.finish(call)
+		}()
+		out.result, out.err = fn(callCtx)
+	}()
+
+	select {
+	case out := <-done:
+		return out.result, out.err
+	case <-callCtx.Done():
+	}
+
+	// Give a call that honors its context the chance to return its own error
+	timer := time.NewTimer(abandonGrace)
+	defer timer.Stop()
+	select {
+	case out := <-done:
+		return out.result, out.err
+	case <-timer.C:
+	}
+
+	w.mu.Lock()
+	if call.returned {
+		// The call returned just as the grace period ended
+		w.mu.Unlock()
+		out := <-done
+		return out.result, out.err
+	}
+	w.next++
+	call.id, call.abandoned = w.next, true
+	w.stuck[call.id] = call.StuckCall
+	w.mu.Unlock()
+	w.logger.Warn("abandoned stuck bridge call",
+		"call", name,
+		"elapsed", time.Since(call.Started),
+		"timeout", w.timeout)
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%s abandoned: %w", name, context.Cause(ctx))
+	}
+	return nil, fmt.Errorf("%w: %s did not return within %v", ErrCallTimeout, name, w.timeout)
+}
+
+// watchedCall tracks one call; its flags are guarded by the watchdog's mutex
+type watchedCall struct {
+	StuckCall
+	id        uint64
+	returned  bool
+	abandoned bool
+}
+
+// finish records that a call returned, logging calls that were abandoned
+func (w *Watchdog) finish(call *watchedCall) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	call.returned = true
+	if !call.abandoned {
+		return
+	}
+	delete(w.stuck, call.id)
+	w.logger.Info("abandoned bridge call returned", "call", call.Name, "elapsed", time.Since(call.Started))
+}
+
+// Stuck lists the abandoned calls that are still running, oldest first
+func (w *Watchdog) Stuck() []StuckCall {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	calls := make([]StuckCall, 0, len(w.stuck))
+	for _, call := range w.stuck {
+		calls = append(calls, call)
+	}
+	sort.Slice(calls, func(i, j int) bool { return calls[i].Started.Before(calls[j].Started) })
+	return calls
+}
@@ -0,0 +1,125 @@
+// ABOUTME: Tests for the bridge call watchdog
+// ABOUTME: Validates that hung calls are abandoned, tracked until they return, and script tools are not
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+func quietWatchdog(timeout time.Duration) *Watchdog {
+	return NewWatchdog(timeout, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestWatchdogAbandonsHungCall(t *testing.T) {
+	w := quietWatchdog(20 * time.Millisecond)
+	release := make(chan struct{})
+	returned := make(chan struct{})
+
+	_, err := w.Call(context.Background(), "tools.execute hang", func(ctx context.Context) (interface{}, error) {
+		defer close(returned)
+		<-release // ignores ctx
+		return "late", nil
+	})
+	if !errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("Expected ErrCallTimeout, got %v", err)
+	}
+	stuck := w.Stuck()
+	if len(stuck) != 1 || stuck[0].Name != "tools.execute hang" {
+		t.Fatalf("Expected the hung call to be tracked, got %+v", stuck)
+	}
+
+	close(release)
+	<-returned
+	deadline := time.Now().Add(time.Second)
+	for len(w.Stuck()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if len(w.Stuck()) != 0 {
+		t.Error("Expected the call to be forgotten once it returned")
+	}
+}
+
+func TestWatchdogHonoredContext(t *testing.T) {
+	w := quietWatchdog(20 * time.Millisecond)
+
+	// A call that stops with its context reports its own error
+	_, err := w.Call(context.Background(), "llm.chat", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, errors.New("request canceled")
+	})
+	if err == nil || errors.Is(err, ErrCallTimeout) {
+		t.Errorf("Expected the call's own error, got %v", err)
+	}
+
+	// Stopping the spell abandons the call even with no timeout
+	w = quietWatchdog(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = w.Call(ctx, "llm.complete", func(context.Context) (interface{}, error) {
+		select {}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWatchdogResults(t *testing.T) {
+	var w *Watchdog
+	result, err := w.Call(context.Background(), "direct", func(context.Context) (interface{}, error) {
+		return 42, nil
+	})
+	if err != nil || result != 42 {
+		t.Errorf("Expected a nil watchdog to call directly, got %v, %v", result, err)
+	}
+
+	w = quietWatchdog(time.Second)
+	_, err = w.Call(context.Background(), "boom", func(context.Context) (interface{}, error) {
+		panic("broken tool")
+	})
+	if err == nil {
+		t.Error("Expected a panic to become an error")
+	}
+}
+
+func TestToolBridgeWatchdog(t *testing.T) {
+	registry := tools.NewRegistry()
+	release := make(chan struct{})
+	defer close(release)
+	hang := func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		<-release
+		return nil, nil
+	}
+	if err := registry.Register(tools.NewFunctionTool("hang", "Never returns in time", nil, hang)); err != nil {
+		t.Fatal(err)
+	}
+
+	tb := NewToolBridge(registry)
+	tb.SetWatchdog(quietWatchdog(20 * time.Millisecond))
+	if _, err := tb.ExecuteTool(context.Background(), "hang", nil); !errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("Expected the Go tool to be abandoned, got %v", err)
+	}
+	if stats := tb.ExecutionStats(); len(stats) != 1 || stats[0].Failures != 1 {
+		t.Errorf("Expected the timeout to count as a failure, got %+v", stats)
+	}
+
+	// Script tools run in the script engine and are always waited for
+	err := tb.RegisterTool("slow_script", "Slow", nil, func(map[string]interface{}) (interface{}, error) {
+		time.Sleep(50 * time.Millisecond)
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := tb.ExecuteTool(context.Background(), "slow_script", nil)
+	if err != nil || result != "done" {
+		t.Errorf("Expected the script tool to finish, got %v, %v", result, err)
+	}
+}
@@ -0,0 +1,82 @@
+// ABOUTME: Clock abstraction so time-dependent spells can run against a fixed time
+// ABOUTME: Real reads the system clock; Manual stays where tests and replays set it
+
+package clock
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Clock tells the time. Everything a spell can observe the time through,
+// such as time.now(), log trace timestamps and call durations, reads it
+// from the run's Clock so a run can be repeated at the same time.
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is the system clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Since returns the time elapsed on c since t
+func Since(c Clock, t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Manual is a clock that only moves when told to. It is safe for
+// concurrent use.
+type Manual struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManual creates a clock stopped at t
+func NewManual(t time.Time) *Manual {
+	return &Manual{now: t}
+}
+
+// Now returns the time the clock was set to
+func (m *Manual) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.now
+}
+
+// Set moves the clock to t
+func (m *Manual) Set(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.now = t
+}
+
+// Advance moves the clock forward by d
+func (m *Manual) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.now = m.now.Add(d)
+}
+
+// Parse reads a time given on the command line: an RFC 3339 timestamp such
+// as 2024-03-01T09:30:00Z, a date such as 2024-03-01 (midnight UTC), or
+// seconds since the Unix epoch
+func Parse(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("want an RFC 3339 timestamp, a date like 2024-03-01, or Unix seconds")
+}
@@ -0,0 +1,51 @@
+// ABOUTME: Tests for the clock abstraction
+// ABOUTME: Covers the manual clock and parsing times given on the command line
+
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManual(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	c := NewManual(start)
+	if !c.Now().Equal(start) || !c.Now().Equal(start) {
+		t.Fatalf("Expected the clock to stay at %v, got %v", start, c.Now())
+	}
+
+	c.Advance(90 * time.Second)
+	if got := Since(c, start); got != 90*time.Second {
+		t.Errorf("Expected 90s to pass, got %v", got)
+	}
+	c.Set(start)
+	if got := Since(c, start); got != 0 {
+		t.Errorf("Expected Set to move the clock back, got %v", got)
+	}
+
+	if Since(Real, time.Now().Add(-time.Hour)) < time.Hour {
+		t.Error("Expected the real clock to tell the system time")
+	}
+}
+
+func TestParse(t *testing.T) {
+	for value, want := range map[string]time.Time{
+		"2024-03-01T09:30:00Z":      time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+		"2024-03-01T09:30:00.5Z":    time.Date(2024, 3, 1, 9, 30, 0, 500e6, time.UTC),
+		"2024-03-01":                time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		"1709285400":                time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+		"2024-03-01T10:30:00+01:00": time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+	} {
+		got, err := Parse(value)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("Parse(%q): expected %v, got %v (%v)", value, want, got, err)
+		}
+	}
+
+	for _, value := range []string{"", "yesterday", "2024-13-01", "1.5"} {
+		if _, err := Parse(value); err == nil {
+			t.Errorf("Parse(%q): expected an error", value)
+		}
+	}
+}
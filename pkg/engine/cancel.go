@@ -0,0 +1,90 @@
+// ABOUTME: Structured reasons for stopping a spell, carried as context cancellation causes
+// ABOUTME: Maps each reason to the error a script sees and the exit code the CLI returns
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Causes a spell run is cancelled with, via context.WithCancelCause and
+// friends, besides ErrExecutionTimeout for a spell that ran past its time
+// limit. Errors from a cancelled run wrap the cause, so callers can tell why
+// the spell stopped with errors.Is.
+var (
+	// ErrInterrupted means the user stopped the spell, e.g. with Ctrl-C
+	ErrInterrupted = errors.New("spell interrupted")
+
+	// ErrBudgetExhausted means the spell used up a call budget
+	ErrBudgetExhausted = errors.New("spell budget exhausted")
+
+	// ErrResourceLimit means the spell exceeded a CPU, memory, or similar limit
+	ErrResourceLimit = errors.New("spell resource limit exceeded")
+)
+
+// Exit codes for spells stopped by each cause. Other failures exit with 1.
+const (
+	ExitInterrupted   = 130 // as for a shell command killed by SIGINT
+	ExitDeadline      = 124 // as for timeout(1)
+	ExitBudget        = 3
+	ExitResourceLimit = 4
+)
+
+// CancelReason names why err says a spell was cancelled: "interrupt",
+// "deadline", "budget", or "resource_limit". It is empty for other errors.
+// A bare context.DeadlineExceeded counts as a deadline.
+func CancelReason(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrInterrupted):
+		return "interrupt"
+	case errors.Is(err, ErrExecutionTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "deadline"
+	case errors.Is(err, ErrBudgetExhausted):
+		return "budget"
+	case errors.Is(err, ErrResourceLimit), errors.Is(err, ErrMemoryLimitExceeded):
+		return "resource_limit"
+	}
+	return ""
+}
+
+// ExitCode returns the exit code for a spell that failed with err
+func ExitCode(err error) int {
+	switch CancelReason(err) {
+	case "interrupt":
+		return ExitInterrupted
+	case "deadline":
+		return ExitDeadline
+	case "budget":
+		return ExitBudget
+	case "resource_limit":
+		return ExitResourceLimit
+	}
+	if err == nil {
+		return 0
+	}
+	return 1
+}
+
+// CancelCause returns why ctx was cancelled, or nil if it was not. A
+// context cancelled without a cause reports context.Canceled.
+func CancelCause(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(ctx)
+}
+
+// WrapCancel adds the cancellation cause of ctx to err, which came from
+// running a script under ctx, so the cause survives errors from script
+// runtimes that only report "context canceled"
+func WrapCancel(ctx context.Context, err error) error {
+	cause := CancelCause(ctx)
+	if err == nil || cause == nil || errors.Is(err, cause) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", cause, err)
+}
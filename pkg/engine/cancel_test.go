@@ -0,0 +1,65 @@
+// ABOUTME: Tests for spell cancellation causes
+// ABOUTME: Validates reasons, exit codes, and that causes survive wrapped script errors
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCancelReason(t *testing.T) {
+	tests := []struct {
+		err    error
+		reason string
+		code   int
+	}{
+		{nil, "", 0},
+		{errors.New("syntax error"), "", 1},
+		{ErrInterrupted, "interrupt", ExitInterrupted},
+		{fmt.Errorf("script execution failed: %w", ErrExecutionTimeout), "deadline", ExitDeadline},
+		{context.DeadlineExceeded, "deadline", ExitDeadline},
+		{fmt.Errorf("%w: llm.chat", ErrBudgetExhausted), "budget", ExitBudget},
+		{ErrResourceLimit, "resource_limit", ExitResourceLimit},
+		{ErrMemoryLimitExceeded, "resource_limit", ExitResourceLimit},
+	}
+
+	for _, tt := range tests {
+		if got := CancelReason(tt.err); got != tt.reason {
+			t.Errorf("CancelReason(%v) = %q, want %q", tt.err, got, tt.reason)
+		}
+		if got := ExitCode(tt.err); got != tt.code {
+			t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.code)
+		}
+	}
+}
+
+func TestWrapCancel(t *testing.T) {
+	scriptErr := errors.New("<string>:1: context canceled")
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	if CancelCause(ctx) != nil || WrapCancel(ctx, scriptErr) != scriptErr {
+		t.Fatal("Expected no cause before cancellation")
+	}
+
+	cancel(ErrInterrupted)
+	if !errors.Is(CancelCause(ctx), ErrInterrupted) {
+		t.Errorf("Expected the interrupt cause, got %v", CancelCause(ctx))
+	}
+	err := WrapCancel(ctx, scriptErr)
+	if !errors.Is(err, ErrInterrupted) || !errors.Is(err, scriptErr) {
+		t.Errorf("Expected both the cause and the script error, got %v", err)
+	}
+	if WrapCancel(ctx, err) != err {
+		t.Error("Expected an error that has the cause to be left alone")
+	}
+
+	// Children report their parent's cause
+	child, stop := context.WithTimeout(ctx, 0)
+	defer stop()
+	if !errors.Is(CancelCause(child), ErrInterrupted) {
+		t.Errorf("Expected the parent's cause, got %v", CancelCause(child))
+	}
+}
@@ -0,0 +1,96 @@
+// ABOUTME: Detects the engine for a script from a #!llmspell:<engine> line or its file extension
+// ABOUTME: Also strips that line so engines whose syntax lacks shebangs can load the script
+
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnknownLanguage is returned for a #!llmspell: line naming a language
+// no registered engine runs
+var ErrUnknownLanguage = errors.New("no engine found for language")
+
+// ShebangPrefix starts a script's first line to name the engine that runs
+// it, as in "#!llmspell:tengo". It takes precedence over the extension.
+const ShebangPrefix = "#!llmspell:"
+
+// Shebang returns the language a script's first line names after
+// ShebangPrefix, or "" if it names none
+func Shebang(script []byte) string {
+	line, _, _ := bytes.Cut(script, []byte("\n"))
+	lang, ok := strings.CutPrefix(strings.TrimSpace(string(line)), ShebangPrefix)
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(lang))
+}
+
+// StripShebang blanks a "#!" first line, keeping the line break so that
+// errors still report the script's own line numbers
+func StripShebang(script []byte) []byte {
+	if !bytes.HasPrefix(script, []byte("#!")) {
+		return script
+	}
+	if i := bytes.IndexByte(script, '\n'); i >= 0 {
+		return script[i:]
+	}
+	return nil
+}
+
+// Detect finds the engine for the script at path: the one its
+// #!llmspell:<language> line names, or else the one that handles its file
+// extension. The language is an engine name, such as "lua", or an
+// extension one handles, such as "js".
+func (r *Registry) Detect(path string) (string, error) {
+	head, err := readFirstLine(path)
+	if err != nil {
+		return "", err
+	}
+	if lang := Shebang(head); lang != "" {
+		name, err := r.lookupLanguage(lang)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		return name, nil
+	}
+	return r.DiscoverByExtension(filepath.Ext(path))
+}
+
+// lookupLanguage finds the engine named lang, or handling .lang files
+func (r *Registry) lookupLanguage(lang string) (string, error) {
+	r.mu.RLock()
+	_, exists := r.engines[lang]
+	r.mu.RUnlock()
+	if exists {
+		return lang, nil
+	}
+	if name, err := r.DiscoverByExtension("." + lang); err == nil {
+		return name, nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownLanguage, lang)
+}
+
+// readFirstLine reads the first line of the file at path
+func readFirstLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// A first line longer than the buffer is cut short, which still holds
+	// any shebang
+	line, err := bufio.NewReader(f).ReadSlice('\n')
+	if len(line) == 0 && err != nil && err != io.EOF {
+		return nil, err
+	}
+	return line, nil
+}
@@ -0,0 +1,75 @@
+// ABOUTME: Tests for detecting a script's engine by shebang line or extension
+// ABOUTME: Validates language lookup, precedence, and shebang stripping
+
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	registry := NewRegistry()
+	factory := func(config Config) (Engine, error) {
+		return newMockEngine("mock"), nil
+	}
+	for name, ext := range map[string]string{"lua": ".lua", "tengo": ".tengo", "javascript": ".js"} {
+		if err := registry.RegisterWithMetadata(name, factory, EngineMetadata{FileExtensions: []string{ext}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	tests := []struct {
+		file    string
+		content string
+		want    string
+		wantErr error
+	}{
+		{file: "plain.lua", content: "print('hi')\n", want: "lua"},
+		{file: "plain.tengo", content: "x := 1", want: "tengo"},
+		{file: "named.lua", content: "#!llmspell:tengo\nx := 1\n", want: "tengo"},
+		{file: "by-extension", content: "#!llmspell:JS\nlet x = 1\n", want: "javascript"},
+		{file: "spaced.txt", content: "  #!llmspell: lua \r\nprint(1)\n", want: "lua"},
+		{file: "other.lua", content: "#!/usr/bin/env lua\nprint(1)\n", want: "lua"},
+		{file: "unknown.lua", content: "#!llmspell:cobol\n", wantErr: ErrUnknownLanguage},
+		{file: "empty.tengo", content: "", want: "tengo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := registry.Detect(path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Detect() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Detect() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := registry.Detect(filepath.Join(dir, "missing.lua")); err == nil {
+		t.Error("Expected an error for a missing script")
+	}
+}
+
+func TestStripShebang(t *testing.T) {
+	tests := map[string]string{
+		"#!llmspell:tengo\nx := 1\n": "\nx := 1\n",
+		"x := 1\n":                   "x := 1\n",
+		"#!llmspell:tengo":           "",
+	}
+	for script, want := range tests {
+		if got := string(StripShebang([]byte(script))); got != want {
+			t.Errorf("StripShebang(%q) = %q, want %q", script, got, want)
+		}
+	}
+}
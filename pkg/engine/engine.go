@@ -32,6 +32,16 @@ type Engine interface {
 	GetVariable(name string) (interface{}, error)
 }
 
+// ResultEngine is implemented by engines that can hand back the value a
+// script returns, such as a Lua chunk ending in "return result"
+type ResultEngine interface {
+	Engine
+
+	// ExecuteResult runs the loaded script and returns its first return
+	// value converted to Go, or nil if it returned nothing
+	ExecuteResult(ctx context.Context) (interface{}, error)
+}
+
 // Config contains configuration options for script engines
 type Config struct {
 	// MaxExecutionTime limits how long a script can run
@@ -0,0 +1,150 @@
+// ABOUTME: Converts values between Go and JavaScript for the goja engine and its modules
+// ABOUTME: Also reads the arguments of module functions, throwing a TypeError for bad ones
+
+package goja
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/dop251/goja"
+)
+
+// Export converts a script value to Go: objects to map[string]interface{},
+// arrays to []interface{}, whole numbers to int64, and undefined and null
+// to nil
+func Export(value goja.Value) interface{} {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return nil
+	}
+	return value.Export()
+}
+
+// ToValue converts a Go value to a script value. Maps and slices are
+// copied into plain objects and arrays, so a script cannot change the Go
+// value behind them, such as the spell's state, by assigning to its copy.
+func ToValue(vm *goja.Runtime, value interface{}) goja.Value {
+	if value == nil {
+		return goja.Null()
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		obj := vm.NewObject()
+		iter := rv.MapRange()
+		for iter.Next() {
+			_ = obj.Set(iter.Key().String(), ToValue(vm, iter.Value().Interface()))
+		}
+		return obj
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = ToValue(vm, rv.Index(i).Interface())
+		}
+		return vm.NewArray(items...)
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return goja.Null()
+		}
+	}
+	return vm.ToValue(value)
+}
+
+// typeName names the type of a script value as typeof would, with arrays
+// and null told apart
+func typeName(value goja.Value) string {
+	switch {
+	case value == nil || goja.IsUndefined(value):
+		return "undefined"
+	case goja.IsNull(value):
+		return "null"
+	}
+	switch value.Export().(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int64, float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case func(goja.FunctionCall) goja.Value:
+		return "function"
+	}
+	if _, ok := goja.AssertFunction(value); ok {
+		return "function"
+	}
+	return "object"
+}
+
+// throw fails the module function in progress with err, as a JavaScript
+// error the script can catch
+func throw(vm *goja.Runtime, err error) {
+	panic(vm.NewGoError(err))
+}
+
+// argError throws a TypeError for the argument at i of a module function
+func argError(vm *goja.Runtime, call goja.FunctionCall, i int, expected string) {
+	panic(vm.NewTypeError("%s argument must be %s, not %s", ordinal(i), expected, typeName(call.Argument(i))))
+}
+
+// stringArg reads the string argument at i
+func stringArg(vm *goja.Runtime, call goja.FunctionCall, i int) string {
+	s, ok := Export(call.Argument(i)).(string)
+	if !ok {
+		argError(vm, call, i, "a string")
+	}
+	return s
+}
+
+// intArg reads the whole-number argument at i, or def if it is missing
+func intArg(vm *goja.Runtime, call goja.FunctionCall, i int, def int64) int64 {
+	switch n := Export(call.Argument(i)).(type) {
+	case nil:
+		return def
+	case int64:
+		return n
+	case float64:
+		if n == float64(int64(n)) {
+			return int64(n)
+		}
+	}
+	argError(vm, call, i, "a whole number")
+	return 0
+}
+
+// mapArg reads the object argument at i, or nil if it is missing
+func mapArg(vm *goja.Runtime, call goja.FunctionCall, i int) map[string]interface{} {
+	switch m := Export(call.Argument(i)).(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		return m
+	}
+	argError(vm, call, i, "an object")
+	return nil
+}
+
+// functionArg reads the function argument at i
+func functionArg(vm *goja.Runtime, call goja.FunctionCall, i int) goja.Callable {
+	fn, ok := goja.AssertFunction(call.Argument(i))
+	if !ok {
+		argError(vm, call, i, "a function")
+	}
+	return fn
+}
+
+// ordinal names an argument position for error messages
+func ordinal(i int) string {
+	names := []string{"first", "second", "third", "fourth", "fifth"}
+	if i < len(names) {
+		return names[i]
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
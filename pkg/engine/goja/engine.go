@@ -0,0 +1,317 @@
+// ABOUTME: JavaScript script engine implementation using dop251/goja
+// ABOUTME: Runs JavaScript spells with Go functions, variables, and bridge modules as globals
+
+package goja
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/lexlapax/go-llmspell/pkg/clock"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+)
+
+func init() {
+	// Make JavaScript available to engine discovery, e.g. for sub-spells
+	_ = engine.RegisterEngineWithMetadata("javascript", func(config engine.Config) (engine.Engine, error) {
+		return NewGojaEngine(&config)
+	}, engine.EngineMetadata{
+		Description:    "JavaScript (ECMAScript 5.1 and much of ES6) via dop251/goja",
+		FileExtensions: []string{".js"},
+		MimeTypes:      []string{"text/javascript", "application/javascript"},
+	})
+}
+
+// ResultVariable is the global a JavaScript spell assigns the value it
+// hands back to, as for Tengo, since a script cannot return from its top
+// level
+const ResultVariable = "result"
+
+// maxCallStackSize bounds how deep script functions may call each other,
+// so runaway recursion fails the script instead of exhausting memory. goja
+// has no memory limit of its own.
+const maxCallStackSize = 10000
+
+// Module is a bridge module: the functions of a global object such as llm
+// or tools
+type Module map[string]Function
+
+// Function is a module function. It throws a JavaScript error, by
+// panicking with a goja value, when it fails.
+type Function = func(call goja.FunctionCall) goja.Value
+
+// GojaEngine implements the Engine interface for JavaScript. The runtime
+// has no I/O of its own; spells reach the outside world only through the
+// functions and modules registered in it.
+type GojaEngine struct {
+	config *engine.Config
+	vm     *goja.Runtime
+
+	mu      sync.Mutex
+	program *goja.Program
+	ctx     context.Context
+
+	// calls makes Go code calling back into the script, such as an agent
+	// calling a tool the spell defined, take turns: the runtime runs one
+	// call at a time, while the script waits in the Go function that led
+	// to the calls
+	calls sync.Mutex
+}
+
+// NewGojaEngine creates a new JavaScript engine instance
+func NewGojaEngine(config *engine.Config) (*GojaEngine, error) {
+	if config == nil {
+		config = &engine.Config{
+			MaxExecutionTime: 30,               // 30 seconds default
+			MaxMemory:        64 * 1024 * 1024, // 64MB default
+		}
+	}
+
+	vm := goja.New()
+	vm.SetMaxCallStackSize(maxCallStackSize)
+	e := &GojaEngine{
+		config: config,
+		vm:     vm,
+		ctx:    context.Background(),
+	}
+	if err := e.RegisterModule("console", ConsoleModule(e, os.Stdout, os.Stderr)); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Name returns the name of the engine
+func (e *GojaEngine) Name() string {
+	return "javascript"
+}
+
+// Runtime returns the goja runtime scripts run in, for callers that add
+// their own globals
+func (e *GojaEngine) Runtime() *goja.Runtime {
+	return e.vm
+}
+
+// SetClock makes Date and Date.now() tell time by c, so a run stopped at a
+// time with --now sees that time
+func (e *GojaEngine) SetClock(c clock.Clock) {
+	e.vm.SetTimeSource(c.Now)
+}
+
+// LoadScript loads and compiles a script from a reader. A #! first line,
+// which JavaScript would reject, is skipped.
+func (e *GojaEngine) LoadScript(reader io.Reader) error {
+	script, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read script: %w", err)
+	}
+	return e.compile("script", script)
+}
+
+// LoadScriptFile loads and compiles a script from a file path
+func (e *GojaEngine) LoadScriptFile(path string) error {
+	script, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to load script file: %w", err)
+	}
+	return e.compile(path, script)
+}
+
+func (e *GojaEngine) compile(name string, script []byte) error {
+	program, err := goja.Compile(name, string(engine.StripShebang(script)), false)
+	if err != nil {
+		return fmt.Errorf("failed to compile script: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.program = program
+	return nil
+}
+
+// Execute runs the loaded script. Runs share the runtime's globals, so a
+// script that declares top-level let or const runs once per engine.
+func (e *GojaEngine) Execute(ctx context.Context) error {
+	return e.run(ctx)
+}
+
+// ExecuteResult runs the loaded script and returns the value it assigned
+// to ResultVariable, or nil if it assigned none
+func (e *GojaEngine) ExecuteResult(ctx context.Context) (interface{}, error) {
+	if err := e.run(ctx); err != nil {
+		return nil, err
+	}
+	return e.GetVariable(ResultVariable)
+}
+
+// run runs the loaded script within the engine's time limit. A run that
+// is cancelled or times out is interrupted at the script's next
+// instruction; Go functions it is waiting on see the cancelled context.
+func (e *GojaEngine) run(ctx context.Context) error {
+	e.mu.Lock()
+	program := e.program
+	e.mu.Unlock()
+	if program == nil {
+		return fmt.Errorf("no script loaded")
+	}
+
+	if e.config.MaxExecutionTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, time.Duration(e.config.MaxExecutionTime)*time.Second, engine.ErrExecutionTimeout)
+		defer cancel()
+	}
+
+	e.setContext(ctx)
+	defer e.setContext(context.Background())
+
+	stop := context.AfterFunc(ctx, func() {
+		e.vm.Interrupt(context.Cause(ctx))
+	})
+	_, err := e.vm.RunProgram(program)
+	if !stop() {
+		e.vm.ClearInterrupt()
+	}
+
+	// A cancelled script says why it stopped, not just "context canceled"
+	if err := engine.WrapCancel(ctx, err); err != nil {
+		return fmt.Errorf("script execution failed: %w", err)
+	}
+	return nil
+}
+
+// Call calls a script function from Go, from any goroutine, while the
+// script waits on the call that led to it, as a tool the spell defined
+// does when an agent runs it. Calls take turns, a panic fails the call,
+// and the function is interrupted when ctx ends.
+func (e *GojaEngine) Call(ctx context.Context, fn goja.Callable, args ...interface{}) (result interface{}, err error) {
+	e.calls.Lock()
+	defer e.calls.Unlock()
+
+	// Module functions the call makes run under ctx, and the script's
+	// context is restored afterwards
+	scriptCtx := e.Context()
+	e.setContext(ctx)
+	defer e.setContext(scriptCtx)
+
+	stop := context.AfterFunc(ctx, func() {
+		e.vm.Interrupt(context.Cause(ctx))
+	})
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("script function panicked: %v", r)
+		}
+		if !stop() {
+			e.vm.ClearInterrupt()
+			// The script's own run may have been cancelled meanwhile
+			if cause := engine.CancelCause(scriptCtx); cause != nil {
+				e.vm.Interrupt(cause)
+			}
+		}
+	}()
+
+	values := make([]goja.Value, len(args))
+	for i, arg := range args {
+		values[i] = ToValue(e.vm, arg)
+	}
+	value, err := fn(goja.Undefined(), values...)
+	if err != nil {
+		return nil, engine.WrapCancel(ctx, err)
+	}
+	return Export(value), nil
+}
+
+// Context returns the context of the run or call in progress, for module
+// functions that make calls on the script's behalf, or context.Background
+// between runs
+func (e *GojaEngine) Context() context.Context {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.ctx
+}
+
+func (e *GojaEngine) setContext(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ctx = ctx
+}
+
+// RegisterFunction registers a Go function to be callable from JavaScript.
+// Arguments and results are converted as goja converts them, and a
+// returned non-nil error is thrown.
+func (e *GojaEngine) RegisterFunction(name string, fn interface{}) error {
+	if fn == nil || reflect.TypeOf(fn).Kind() != reflect.Func {
+		return fmt.Errorf("unsupported function signature: %T", fn)
+	}
+	return e.vm.Set(name, fn)
+}
+
+// SetVariable sets a global variable in the script context, copying maps
+// and slices into plain objects and arrays
+func (e *GojaEngine) SetVariable(name string, value interface{}) error {
+	if err := e.vm.Set(name, ToValue(e.vm, value)); err != nil {
+		return fmt.Errorf("failed to set variable %s: %w", name, err)
+	}
+	return nil
+}
+
+// GetVariable gets a global variable from the script context, or nil if
+// it is not defined
+func (e *GojaEngine) GetVariable(name string) (interface{}, error) {
+	value := e.vm.Get(name)
+	if value == nil {
+		return nil, nil
+	}
+	return Export(value), nil
+}
+
+// RegisterModule makes module a global object, as in llm.chat("Hello")
+func (e *GojaEngine) RegisterModule(name string, module Module) error {
+	return e.vm.Set(name, e.moduleObject(module))
+}
+
+// RegisterModuleLoader makes a global object whose functions are only
+// built when a script first uses it, so a spell pays only for the bridges
+// it uses. An error from load is thrown where the script first uses it.
+func (e *GojaEngine) RegisterModuleLoader(name string, load func() (Module, error)) error {
+	var once sync.Once
+	var module goja.Value
+	var loadErr error
+	getter := e.vm.ToValue(func(goja.FunctionCall) goja.Value {
+		once.Do(func() {
+			var m Module
+			if m, loadErr = load(); loadErr == nil {
+				module = e.moduleObject(m)
+			}
+		})
+		if loadErr != nil {
+			panic(e.vm.NewGoError(fmt.Errorf("failed to load module %s: %w", name, loadErr)))
+		}
+		return module
+	})
+	return e.vm.GlobalObject().DefineAccessorProperty(name, getter, nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+}
+
+// moduleObject makes an object of a module's functions, which scripts
+// cannot replace
+func (e *GojaEngine) moduleObject(module Module) *goja.Object {
+	obj := e.vm.NewObject()
+	for name, fn := range module {
+		_ = obj.DefineDataProperty(name, e.vm.ToValue(fn), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	}
+	return obj
+}
+
+// Close releases the loaded script
+func (e *GojaEngine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.program = nil
+	return nil
+}
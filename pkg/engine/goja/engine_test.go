@@ -0,0 +1,410 @@
+// ABOUTME: Tests for the JavaScript script engine implementation
+// ABOUTME: Validates execution, type conversion, function registration, modules, callbacks, and limits
+
+package goja
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/clock"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+// newTestEngine creates an engine with script loaded
+func newTestEngine(t *testing.T, config *engine.Config, script string) *GojaEngine {
+	t.Helper()
+	eng, err := NewGojaEngine(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := eng.LoadScript(strings.NewReader(script)); err != nil {
+		t.Fatalf("LoadScript() error = %v", err)
+	}
+	t.Cleanup(func() { _ = eng.Close() })
+	return eng
+}
+
+// TestEngineRegistered tests that .js scripts find the JavaScript engine
+func TestEngineRegistered(t *testing.T) {
+	name, err := engine.DiscoverEngineByExtension(".js")
+	if err != nil || name != "javascript" {
+		t.Fatalf("expected .js to map to the javascript engine, got %q, %v", name, err)
+	}
+	eng, err := engine.CreateEngine(name, engine.Config{MaxExecutionTime: 5})
+	if err != nil {
+		t.Fatalf("CreateEngine() error = %v", err)
+	}
+	if eng.Name() != "javascript" {
+		t.Errorf("Name() = %q", eng.Name())
+	}
+}
+
+// TestExecuteResult tests variables in, the result out, and conversions both ways
+func TestExecuteResult(t *testing.T) {
+	eng := newTestEngine(t, nil, `#!/usr/bin/env llmspell
+		let total = 0;
+		for (const n of params.numbers) { total += n; }
+		var result = {name: params.name.toUpperCase(), total: total, tags: params.tags, half: total / 4};
+	`)
+	if err := eng.SetVariable("params", map[string]interface{}{
+		"name":    "ada",
+		"numbers": []interface{}{1, 2, 3},
+		"tags":    []string{"a", "b"},
+	}); err != nil {
+		t.Fatalf("SetVariable() error = %v", err)
+	}
+
+	result, err := eng.ExecuteResult(context.Background())
+	if err != nil {
+		t.Fatalf("ExecuteResult() error = %v", err)
+	}
+	got, ok := result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a map result, got %T", result)
+	}
+	if got["name"] != "ADA" || got["total"] != int64(6) || got["half"] != 1.5 {
+		t.Errorf("unexpected result %v", got)
+	}
+	if tags, _ := got["tags"].([]interface{}); len(tags) != 2 || tags[1] != "b" {
+		t.Errorf("expected tags to round-trip, got %v", got["tags"])
+	}
+
+	total, err := eng.GetVariable("total")
+	if err != nil || total != int64(6) {
+		t.Errorf("GetVariable(total) = %v, %v", total, err)
+	}
+	if missing, _ := eng.GetVariable("missing"); missing != nil {
+		t.Errorf("expected nil for an undefined variable, got %v", missing)
+	}
+}
+
+// TestRegisterFunction tests calling Go functions, including ones that fail
+func TestRegisterFunction(t *testing.T) {
+	eng := newTestEngine(t, nil, `
+		let caught = "";
+		try { fail(); } catch (e) { caught = e.message; }
+		result = greet("world") + " " + repeat("ab", 2) + " " + caught;
+	`)
+	must := func(err error) {
+		if err != nil {
+			t.Fatalf("RegisterFunction() error = %v", err)
+		}
+	}
+	must(eng.RegisterFunction("greet", func(s string) string { return "hello " + s }))
+	must(eng.RegisterFunction("repeat", strings.Repeat))
+	must(eng.RegisterFunction("fail", func() error { return errors.New("it broke") }))
+	if err := eng.RegisterFunction("nope", 42); err == nil {
+		t.Error("expected a non-function to be rejected")
+	}
+
+	result, err := eng.ExecuteResult(context.Background())
+	if err != nil || result != "hello world abab it broke" {
+		t.Errorf("ExecuteResult() = %v, %v", result, err)
+	}
+}
+
+// TestSandbox tests that scripts have no I/O of their own and cannot run past their limits
+func TestSandbox(t *testing.T) {
+	t.Run("no require or process", func(t *testing.T) {
+		eng := newTestEngine(t, nil, `result = [typeof require, typeof process, typeof fetch].join(",")`)
+		result, err := eng.ExecuteResult(context.Background())
+		if err != nil || result != "undefined,undefined,undefined" {
+			t.Errorf("ExecuteResult() = %v, %v", result, err)
+		}
+	})
+
+	t.Run("execution time", func(t *testing.T) {
+		eng := newTestEngine(t, &engine.Config{MaxExecutionTime: 1}, `for (;;) {}`)
+		start := time.Now()
+		err := eng.Execute(context.Background())
+		if !errors.Is(err, engine.ErrExecutionTimeout) {
+			t.Errorf("expected a timeout, got %v", err)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("script ran for %s", time.Since(start))
+		}
+	})
+
+	t.Run("cancellation", func(t *testing.T) {
+		eng := newTestEngine(t, nil, `while (true) {}`)
+		ctx, cancel := context.WithCancelCause(context.Background())
+		time.AfterFunc(50*time.Millisecond, func() { cancel(engine.ErrInterrupted) })
+		if err := eng.Execute(ctx); !errors.Is(err, engine.ErrInterrupted) {
+			t.Errorf("expected the run to be cancelled, got %v", err)
+		}
+		// The next run is not stopped by the last one's interruption
+		ctx, stop := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer stop()
+		if err := eng.Execute(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a fresh run to time out, got %v", err)
+		}
+	})
+
+	t.Run("recursion", func(t *testing.T) {
+		eng := newTestEngine(t, nil, `function f(n) { return f(n + 1) + 1; } f(0);`)
+		if err := eng.Execute(context.Background()); err == nil {
+			t.Error("expected runaway recursion to fail")
+		}
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		eng, _ := NewGojaEngine(nil)
+		if err := eng.LoadScript(strings.NewReader("let = ;")); err == nil {
+			t.Error("expected a syntax error to fail loading")
+		}
+		if err := eng.Execute(context.Background()); err == nil {
+			t.Error("expected running without a script to fail")
+		}
+	})
+}
+
+// TestClock tests that Date tells the engine's clock's time
+func TestClock(t *testing.T) {
+	eng := newTestEngine(t, nil, `result = new Date().toISOString()`)
+	eng.SetClock(clock.NewManual(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)))
+	result, err := eng.ExecuteResult(context.Background())
+	if err != nil || result != "2024-03-01T12:00:00.000Z" {
+		t.Errorf("ExecuteResult() = %v, %v", result, err)
+	}
+}
+
+// fakeLLM answers chats by echoing the prompt, or fails for "fail"
+type fakeLLM struct {
+	provider string
+}
+
+func (f *fakeLLM) Chat(ctx context.Context, prompt string) (string, error) {
+	if prompt == "fail" {
+		return "", errors.New("provider unavailable")
+	}
+	return "echo: " + prompt, nil
+}
+
+func (f *fakeLLM) ChatMessages(ctx context.Context, messages []bridge.ChatMessage) (string, error) {
+	return f.Chat(ctx, bridge.Transcript(messages))
+}
+
+func (f *fakeLLM) Complete(ctx context.Context, prompt string, maxTokens int) (string, error) {
+	return prompt, nil
+}
+
+func (f *fakeLLM) GetCurrentProvider() string    { return f.provider }
+func (f *fakeLLM) ListProviders() []string       { return []string{"a", "b"} }
+func (f *fakeLLM) SetProvider(name string) error { f.provider = name; return nil }
+func (f *fakeLLM) GetModel() string              { return "" }
+func (f *fakeLLM) SetModel(name string) error    { return nil }
+
+// TestModules tests the bridge modules, the errors they throw, and their restrictions
+func TestModules(t *testing.T) {
+	eng := newTestEngine(t, nil, `
+		state.set("answer", llm.chat("hi"));
+		var failed = "";
+		try { llm.chat("fail"); } catch (e) { failed = e.message; }
+		var denied = "";
+		try { llm.set_provider("b"); } catch (e) { denied = e.message; }
+		result = {
+			answer: state.get("answer"),
+			missing: state.get("missing") === undefined,
+			failed: failed,
+			chat: llm.chat([{role: "user", content: "again"}]),
+			denied: denied,
+			providers: llm.list_providers()
+		};
+	`)
+	llm := &fakeLLM{provider: "a"}
+	stats := bridge.NewCallStats()
+	loads := 0
+	if err := eng.RegisterModuleLoader("llm", func() (Module, error) {
+		loads++
+		m := LLMModule(eng, llm)
+		ApplyMethodPolicy(eng, "llm", m, &security.MethodPolicy{Deny: []string{"llm.set_provider"}})
+		ApplyCallStats("llm", m, stats)
+		return m, nil
+	}); err != nil {
+		t.Fatalf("RegisterModuleLoader() error = %v", err)
+	}
+	if err := eng.RegisterModule("state", StateModule(eng, bridge.NewSharedState(), nil, nil)); err != nil {
+		t.Fatalf("RegisterModule() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := eng.ExecuteResult(context.Background()); err != nil {
+			t.Fatalf("ExecuteResult() error = %v", err)
+		}
+	}
+	result, _ := eng.GetVariable("result")
+	got := result.(map[string]interface{})
+	if got["answer"] != "echo: hi" || got["missing"] != true || got["failed"] != "provider unavailable" {
+		t.Errorf("unexpected result %v", got)
+	}
+	if chat, _ := got["chat"].(string); !strings.Contains(chat, "again") {
+		t.Errorf("expected a conversation to reach the bridge, got %v", got["chat"])
+	}
+	if denied, _ := got["denied"].(string); !strings.Contains(denied, "set_provider") || llm.provider != "a" {
+		t.Errorf("expected set_provider to be denied, got %v", got["denied"])
+	}
+	if providers, _ := got["providers"].([]interface{}); len(providers) != 2 {
+		t.Errorf("expected the providers as an array, got %v", got["providers"])
+	}
+	if loads != 1 {
+		t.Errorf("expected the module to be built once, got %d", loads)
+	}
+
+	for _, stat := range stats.Snapshot() {
+		if stat.Name == "llm.chat" && (stat.Calls != 6 || stat.Failures != 2) {
+			t.Errorf("expected 6 chats with 2 failures, got %+v", stat)
+		}
+	}
+}
+
+// TestCallBudgetCost tests that a batch spends a call per prompt
+func TestCallBudgetCost(t *testing.T) {
+	vm := goja.New()
+	prompts, _ := vm.RunString(`["a", "b", "c"]`)
+	options, _ := vm.RunString(`({retries: 0})`)
+	args := gojaCallArgs(goja.FunctionCall{Arguments: []goja.Value{prompts}})
+	if got := bridge.CallCost("llm.batch", args); got != 3 {
+		t.Errorf("expected a batch of 3 prompts to cost 3, got %d", got)
+	}
+	args = gojaCallArgs(goja.FunctionCall{Arguments: []goja.Value{vm.ToValue("a"), vm.ToValue(nil), options}})
+	if got := bridge.CallCost("llm.generate_structured", args); got != 1 {
+		t.Errorf("expected generate_structured without retries to cost 1, got %d", got)
+	}
+}
+
+// TestModuleLoaderError tests that a module that fails to load throws where it is used
+func TestModuleLoaderError(t *testing.T) {
+	eng := newTestEngine(t, nil, `
+		try { llm.chat("hi"); result = "loaded"; } catch (e) { result = e.message; }
+	`)
+	_ = eng.RegisterModuleLoader("llm", func() (Module, error) {
+		return nil, errors.New("no provider")
+	})
+	result, err := eng.ExecuteResult(context.Background())
+	if err != nil || !strings.Contains(fmt.Sprint(result), "no provider") {
+		t.Errorf("ExecuteResult() = %v, %v", result, err)
+	}
+}
+
+// fakeTools keeps the tools a spell registers, and runs them from another
+// goroutine as an agent would
+type fakeTools struct {
+	mu    sync.Mutex
+	funcs map[string]tools.ToolFunc
+}
+
+func (f *fakeTools) ExecuteTool(ctx context.Context, name string, params map[string]interface{}) (interface{}, error) {
+	f.mu.Lock()
+	fn, ok := f.funcs[name]
+	f.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("tool %s not found", name)
+	}
+	type reply struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan reply)
+	go func() {
+		result, err := fn(ctx, params)
+		done <- reply{result, err}
+	}()
+	r := <-done
+	return r.result, r.err
+}
+
+func (f *fakeTools) GetTool(name string) (map[string]interface{}, error) {
+	return map[string]interface{}{"name": name}, nil
+}
+
+func (f *fakeTools) ListTools() []map[string]interface{} { return nil }
+
+func (f *fakeTools) RegisterToolWith(name, description string, parameters map[string]interface{}, fn tools.ToolFunc, opts bridge.ToolOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.funcs[name] = fn
+	return nil
+}
+
+func (f *fakeTools) RemoveTool(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.funcs, name)
+	return nil
+}
+
+// TestToolsRegister tests that tools a spell defines run on other goroutines
+// while the spell waits, and that they stop with their context
+func TestToolsRegister(t *testing.T) {
+	eng := newTestEngine(t, nil, `
+		tools.register("double", "Doubles n", {type: "object"}, function(params) {
+			return {n: params.n * 2, answer: state.get("answer")};
+		});
+		tools.register("spin", "Never returns", {type: "object"}, function() { for (;;) {} }, {timeout: 0.05});
+		state.set("answer", 42);
+		let spun = "";
+		try { tools.execute("spin", {}); } catch (e) { spun = e.message; }
+		result = {doubled: tools.execute("double", {n: 21}), spun: spun};
+	`)
+	fake := &fakeTools{funcs: map[string]tools.ToolFunc{}}
+	_ = eng.RegisterModule("tools", ToolsModule(eng, fake))
+	_ = eng.RegisterModule("state", StateModule(eng, bridge.NewSharedState(), nil, nil))
+
+	result, err := eng.ExecuteResult(context.Background())
+	if err != nil {
+		t.Fatalf("ExecuteResult() error = %v", err)
+	}
+	got := result.(map[string]interface{})
+	doubled, _ := got["doubled"].(map[string]interface{})
+	if doubled["n"] != int64(42) || doubled["answer"] != int64(42) {
+		t.Errorf("expected the tool to run in the spell, got %v", got["doubled"])
+	}
+	if spun, _ := got["spun"].(string); !strings.Contains(spun, "deadline") {
+		t.Errorf("expected the spinning tool to time out, got %q", got["spun"])
+	}
+}
+
+// TestConsole tests that console writes its arguments as a line
+func TestConsole(t *testing.T) {
+	eng := newTestEngine(t, nil, `console.log("n =", 1, {a: [1, 2]}); console.error("oops");`)
+	var stdout, stderr bytes.Buffer
+	_ = eng.RegisterModule("console", ConsoleModule(eng, &stdout, &stderr))
+	if err := eng.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if stdout.String() != "n = 1 {\"a\":[1,2]}\n" || stderr.String() != "oops\n" {
+		t.Errorf("unexpected output %q, %q", stdout.String(), stderr.String())
+	}
+}
+
+// TestStateChannels tests that two engines meet on a named channel
+func TestStateChannels(t *testing.T) {
+	channels := bridge.NewStateChannels(security.ChannelPolicy{}, nil)
+	writer := newTestEngine(t, nil, `state.attach("handoff").set("note", "from js")`)
+	reader := newTestEngine(t, nil, `
+		const handoff = state.attach("handoff", {read_only: true});
+		result = handoff.name + ": " + handoff.get("note") + " " + state.channels().join(",");
+	`)
+	for _, eng := range []*GojaEngine{writer, reader} {
+		_ = eng.RegisterModule("state", StateModule(eng, bridge.NewSharedState(), nil, channels))
+	}
+
+	if err := writer.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	result, err := reader.ExecuteResult(context.Background())
+	if err != nil || result != "handoff: from js handoff" {
+		t.Errorf("ExecuteResult() = %v, %v", result, err)
+	}
+}
@@ -0,0 +1,679 @@
+// ABOUTME: Bridge modules JavaScript spells use: llm, tools, agents, state, and console
+// ABOUTME: Wraps the Go bridges as global objects whose functions throw errors on failure
+
+package goja
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+)
+
+// LLM is what the llm module needs of an LLM bridge
+type LLM interface {
+	Chat(ctx context.Context, prompt string) (string, error)
+	ChatMessages(ctx context.Context, messages []bridge.ChatMessage) (string, error)
+	Complete(ctx context.Context, prompt string, maxTokens int) (string, error)
+	GetCurrentProvider() string
+	ListProviders() []string
+	SetProvider(name string) error
+	GetModel() string
+	SetModel(name string) error
+}
+
+// Tools is what the tools module needs of a tool bridge
+type Tools interface {
+	ExecuteTool(ctx context.Context, name string, params map[string]interface{}) (interface{}, error)
+	GetTool(name string) (map[string]interface{}, error)
+	ListTools() []map[string]interface{}
+	RegisterToolWith(name, description string, parameters map[string]interface{}, fn tools.ToolFunc, opts bridge.ToolOptions) error
+	RemoveTool(name string) error
+}
+
+// LLMModule returns the llm module for a spell run by e:
+//
+//	const answer = llm.chat("Hello");
+//
+// chat takes a prompt or an array of messages, as llm.chat does in Lua.
+func LLMModule(e *GojaEngine, llm LLM) Module {
+	vm := e.vm
+	return Module{
+		"chat": func(call goja.FunctionCall) goja.Value {
+			var response string
+			var err error
+			switch arg := Export(call.Argument(0)).(type) {
+			case string:
+				response, err = llm.Chat(e.Context(), arg)
+			case []interface{}:
+				var messages []bridge.ChatMessage
+				if messages, err = bridge.ParseChatMessages(arg); err == nil {
+					response, err = llm.ChatMessages(e.Context(), messages)
+				}
+			default:
+				argError(vm, call, 0, "a string or an array")
+			}
+			if err != nil {
+				throw(vm, err)
+			}
+			return vm.ToValue(response)
+		},
+		"complete": func(call goja.FunctionCall) goja.Value {
+			prompt := stringArg(vm, call, 0)
+			maxTokens := intArg(vm, call, 1, 100)
+			response, err := llm.Complete(e.Context(), prompt, int(maxTokens))
+			if err != nil {
+				throw(vm, err)
+			}
+			return vm.ToValue(response)
+		},
+		"get_provider": func(call goja.FunctionCall) goja.Value {
+			return vm.ToValue(llm.GetCurrentProvider())
+		},
+		"list_providers": func(call goja.FunctionCall) goja.Value {
+			return ToValue(vm, llm.ListProviders())
+		},
+		"set_provider": func(call goja.FunctionCall) goja.Value {
+			if err := llm.SetProvider(stringArg(vm, call, 0)); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+		"get_model": func(call goja.FunctionCall) goja.Value {
+			return vm.ToValue(llm.GetModel())
+		},
+		"set_model": func(call goja.FunctionCall) goja.Value {
+			if err := llm.SetModel(stringArg(vm, call, 0)); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+	}
+}
+
+// ToolsModule returns the tools module for a spell run by e, with execute,
+// get, list, register, and remove as in Lua. A tool a spell registers runs
+// its function through e.Call, so agents can call it while the spell waits
+// on them.
+func ToolsModule(e *GojaEngine, toolBridge Tools) Module {
+	vm := e.vm
+	return Module{
+		"execute": func(call goja.FunctionCall) goja.Value {
+			name := stringArg(vm, call, 0)
+			params := mapArg(vm, call, 1)
+			if params == nil {
+				params = map[string]interface{}{}
+			}
+			result, err := toolBridge.ExecuteTool(e.Context(), name, params)
+			if err != nil {
+				throw(vm, err)
+			}
+			return ToValue(vm, result)
+		},
+		"get": func(call goja.FunctionCall) goja.Value {
+			info, err := toolBridge.GetTool(stringArg(vm, call, 0))
+			if err != nil {
+				throw(vm, err)
+			}
+			return ToValue(vm, info)
+		},
+		"list": func(call goja.FunctionCall) goja.Value {
+			return ToValue(vm, toolBridge.ListTools())
+		},
+		// register(name, description, parameters, fn[, options]); options
+		// take deterministic, confirm, and timeout (seconds) as in Lua
+		"register": func(call goja.FunctionCall) goja.Value {
+			name := stringArg(vm, call, 0)
+			description := stringArg(vm, call, 1)
+			parameters := mapArg(vm, call, 2)
+			if parameters == nil {
+				argError(vm, call, 2, "an object")
+			}
+			fn := functionArg(vm, call, 3)
+
+			var opts bridge.ToolOptions
+			var timeout time.Duration
+			if options := mapArg(vm, call, 4); options != nil {
+				opts.Deterministic, _ = options["deterministic"].(bool)
+				opts.Confirm, _ = options["confirm"].(bool)
+				timeout, _ = seconds(options, "timeout")
+			}
+			err := toolBridge.RegisterToolWith(name, description, parameters, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+				if timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, timeout)
+					defer cancel()
+				}
+				result, err := e.Call(ctx, fn, params)
+				if err != nil {
+					return nil, fmt.Errorf("tool %s failed: %w", name, err)
+				}
+				return result, nil
+			}, opts)
+			if err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+		"remove": func(call goja.FunctionCall) goja.Value {
+			if err := toolBridge.RemoveTool(stringArg(vm, call, 0)); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+	}
+}
+
+// AgentsModule returns the agents module for a spell run by e, with the
+// functions of Lua's agents module but register. stream calls its
+// callback with each chunk through e.Call; a callback that throws stops
+// the stream.
+func AgentsModule(e *GojaEngine, agents bridge.AgentBridge) Module {
+	vm := e.vm
+	return Module{
+		"create": func(call goja.FunctionCall) goja.Value {
+			config := mapArg(vm, call, 0)
+			if config == nil {
+				argError(vm, call, 0, "an object")
+			}
+			name, err := agents.Create(config)
+			if err != nil {
+				throw(vm, err)
+			}
+			return vm.ToValue(name)
+		},
+		"execute": func(call goja.FunctionCall) goja.Value {
+			name := stringArg(vm, call, 0)
+			input := stringArg(vm, call, 1)
+			result, err := agents.Execute(name, input, mapArg(vm, call, 2))
+			if err != nil {
+				throw(vm, err)
+			}
+			return vm.ToValue(result)
+		},
+		"stream": func(call goja.FunctionCall) goja.Value {
+			name := stringArg(vm, call, 0)
+			input := stringArg(vm, call, 1)
+			callback := functionArg(vm, call, 2)
+			err := agents.Stream(name, input, mapArg(vm, call, 3), func(chunk string) error {
+				_, err := e.Call(e.Context(), callback, chunk)
+				return err
+			})
+			if err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+		"list": func(call goja.FunctionCall) goja.Value {
+			return ToValue(vm, agents.List())
+		},
+		"get": func(call goja.FunctionCall) goja.Value {
+			info, err := agents.GetInfo(stringArg(vm, call, 0))
+			if err != nil {
+				throw(vm, err)
+			}
+			return ToValue(vm, info)
+		},
+		"remove": func(call goja.FunctionCall) goja.Value {
+			if err := agents.Remove(stringArg(vm, call, 0)); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+		"update_system_prompt": func(call goja.FunctionCall) goja.Value {
+			if err := agents.UpdateSystemPrompt(stringArg(vm, call, 0), stringArg(vm, call, 1)); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+		"add_tool": func(call goja.FunctionCall) goja.Value {
+			if err := agents.AddTool(stringArg(vm, call, 0), stringArg(vm, call, 1)); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+	}
+}
+
+// ConsoleModule returns the console object: log, info, and debug write a
+// line to stdout, and warn and error to stderr. Arguments are separated
+// by spaces, with objects and arrays as JSON.
+func ConsoleModule(e *GojaEngine, stdout, stderr io.Writer) Module {
+	vm := e.vm
+	print := func(w io.Writer) Function {
+		return func(call goja.FunctionCall) goja.Value {
+			parts := make([]string, len(call.Arguments))
+			for i, arg := range call.Arguments {
+				parts[i] = format(vm, arg)
+			}
+			fmt.Fprintln(w, strings.Join(parts, " "))
+			return goja.Undefined()
+		}
+	}
+	return Module{
+		"log":   print(stdout),
+		"info":  print(stdout),
+		"debug": print(stdout),
+		"warn":  print(stderr),
+		"error": print(stderr),
+	}
+}
+
+// format renders a value for the console: strings as they are, objects
+// and arrays as JSON, and the rest as String() does
+func format(vm *goja.Runtime, value goja.Value) string {
+	obj, ok := value.(*goja.Object)
+	if !ok {
+		return value.String()
+	}
+	if _, isFunction := goja.AssertFunction(obj); isFunction {
+		return value.String()
+	}
+	if _, isError := obj.Export().(error); isError || obj.ClassName() == "Error" {
+		return value.String()
+	}
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return value.String()
+	}
+	return string(data)
+}
+
+// StateModule returns the state module over a spell's shared state, the one
+// its sub-spells inherit from. State is saved to and loaded from store; a
+// nil store makes persist and the other saving functions throw. Spells
+// attach to the named states in channels; nil makes attach throw.
+func StateModule(e *GojaEngine, state *bridge.SharedState, store *bridge.SavedStates, channels *bridge.StateChannels) Module {
+	vm := e.vm
+	module := stateValues(vm, state)
+	for _, fns := range []Module{
+		stateSchema(vm, state),
+		stateLocks(e, state),
+		stateHistory(vm, state),
+		statePersistence(vm, state, store),
+		stateExport(vm, state),
+		stateChannels(e, channels),
+	} {
+		for name, fn := range fns {
+			module[name] = fn
+		}
+	}
+	return module
+}
+
+// stateValues returns get, set, delete, keys, and stats, which work on the
+// values of state. get returns undefined for a missing key.
+func stateValues(vm *goja.Runtime, state *bridge.SharedState) Module {
+	return Module{
+		"get": func(call goja.FunctionCall) goja.Value {
+			value, ok := state.Get(stringArg(vm, call, 0))
+			if !ok {
+				return goja.Undefined()
+			}
+			return ToValue(vm, value)
+		},
+		"set": func(call goja.FunctionCall) goja.Value {
+			key := stringArg(vm, call, 0)
+			if err := state.Set(key, Export(call.Argument(1))); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+		"delete": func(call goja.FunctionCall) goja.Value {
+			if err := state.Delete(stringArg(vm, call, 0)); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+		"keys": func(call goja.FunctionCall) goja.Value {
+			keys := state.Keys()
+			sort.Strings(keys)
+			return ToValue(vm, keys)
+		},
+		"stats": func(call goja.FunctionCall) goja.Value {
+			return ToValue(vm, state.Stats().ToMap())
+		},
+	}
+}
+
+// stateChannels returns attach, which returns an object with the value,
+// lock, and history functions over a named channel that other spells of
+// the run can attach to as well, and channels, which lists the channels
+// attached to so far. attach takes an optional object with read_only:
+// true, which keeps the handle's writes to itself.
+func stateChannels(e *GojaEngine, channels *bridge.StateChannels) Module {
+	vm := e.vm
+	return Module{
+		"attach": func(call goja.FunctionCall) goja.Value {
+			name := stringArg(vm, call, 0)
+			var inherit bridge.StateInheritance
+			if options := mapArg(vm, call, 1); options != nil {
+				inherit.ReadOnly, _ = options["read_only"].(bool)
+			}
+			if channels == nil {
+				throw(vm, errors.New("state channels are not available"))
+			}
+			state, err := channels.Attach(name, inherit)
+			if err != nil {
+				throw(vm, err)
+			}
+
+			handle := stateValues(vm, state)
+			for fnName, fn := range stateLocks(e, state) {
+				handle[fnName] = fn
+			}
+			for fnName, fn := range stateHistory(vm, state) {
+				handle[fnName] = fn
+			}
+			obj := e.moduleObject(handle)
+			_ = obj.Set("name", name)
+			return obj
+		},
+		"channels": func(call goja.FunctionCall) goja.Value {
+			var names []string
+			if channels != nil {
+				names = channels.Names()
+			}
+			return ToValue(vm, names)
+		},
+	}
+}
+
+// stateSchema returns set_schema, get_schema, and validate, which attach a
+// JSON schema to the state and check its values against it. With
+// {strict: true}, set and delete throw instead of breaking the schema.
+func stateSchema(vm *goja.Runtime, state *bridge.SharedState) Module {
+	return Module{
+		"set_schema": func(call goja.FunctionCall) goja.Value {
+			schema := bridge.StateSchema{Schema: mapArg(vm, call, 0)}
+			if options := mapArg(vm, call, 1); options != nil {
+				schema.Strict, _ = options["strict"].(bool)
+				if version, ok := options["version"].(int64); ok {
+					schema.Version = int(version)
+				}
+			}
+			if err := state.SetSchema(schema); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+		"get_schema": func(call goja.FunctionCall) goja.Value {
+			schema, ok := state.Schema()
+			if !ok {
+				return goja.Undefined()
+			}
+			return ToValue(vm, map[string]interface{}{"schema": schema.Schema, "strict": schema.Strict, "version": schema.Version})
+		},
+		"validate": func(call goja.FunctionCall) goja.Value {
+			if err := state.Validate(); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+	}
+}
+
+// seconds reads a number of seconds from an options object
+func seconds(options map[string]interface{}, name string) (time.Duration, bool) {
+	var n float64
+	switch v := options[name].(type) {
+	case int64:
+		n = float64(v)
+	case float64:
+		n = v
+	default:
+		return 0, false
+	}
+	return time.Duration(n * float64(time.Second)), true
+}
+
+// stateLocks returns lock, unlock, and is_locked, advisory locks on keys
+// that the spell and its sub-spells take turns with. lock takes an
+// optional object with timeout, how many seconds to wait, and ttl, after
+// how many seconds the lock releases itself.
+func stateLocks(e *GojaEngine, state *bridge.SharedState) Module {
+	vm := e.vm
+	return Module{
+		"lock": func(call goja.FunctionCall) goja.Value {
+			key := stringArg(vm, call, 0)
+			var opts bridge.LockOptions
+			if options := mapArg(vm, call, 1); options != nil {
+				if wait, ok := seconds(options, "timeout"); ok {
+					opts.Wait = wait
+					if opts.Wait == 0 {
+						opts.Wait = -1
+					}
+				}
+				opts.TTL, _ = seconds(options, "ttl")
+			}
+			token, err := state.Lock(e.Context(), key, opts)
+			if err != nil {
+				throw(vm, err)
+			}
+			return vm.ToValue(token)
+		},
+		"unlock": func(call goja.FunctionCall) goja.Value {
+			if err := state.Unlock(stringArg(vm, call, 0), stringArg(vm, call, 1)); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+		"is_locked": func(call goja.FunctionCall) goja.Value {
+			_, locked := state.LockHolder(stringArg(vm, call, 0))
+			return vm.ToValue(locked)
+		},
+	}
+}
+
+// stateHistory returns history, which lists the changes to the keys the
+// spell sees, replay, which rebuilds the values as they were after a
+// change, and last_seq, the number of the latest change. history takes an
+// optional object with keys, a pattern or array of patterns, op, since,
+// and limit.
+func stateHistory(vm *goja.Runtime, state *bridge.SharedState) Module {
+	return Module{
+		"history": func(call goja.FunctionCall) goja.Value {
+			var filter bridge.EventFilter
+			if options := mapArg(vm, call, 0); options != nil {
+				switch keys := options["keys"].(type) {
+				case string:
+					filter.Keys = []string{keys}
+				case []interface{}:
+					for _, pattern := range keys {
+						if pattern, ok := pattern.(string); ok {
+							filter.Keys = append(filter.Keys, pattern)
+						}
+					}
+				}
+				filter.Op, _ = options["op"].(string)
+				if since, ok := options["since"].(int64); ok && since > 0 {
+					filter.Since = uint64(since)
+				}
+				if limit, ok := options["limit"].(int64); ok {
+					filter.Limit = int(limit)
+				}
+			}
+
+			events := state.History(filter)
+			list := make([]interface{}, len(events))
+			for i, event := range events {
+				entry := map[string]interface{}{
+					"seq":    int64(event.Seq),
+					"op":     event.Op,
+					"key":    event.Key,
+					"value":  event.Value,
+					"time":   event.Time.Unix(),
+					"source": event.Source,
+				}
+				if event.Reason != "" {
+					entry["reason"] = event.Reason
+				}
+				list[i] = entry
+			}
+			return ToValue(vm, list)
+		},
+		"replay": func(call goja.FunctionCall) goja.Value {
+			seq := intArg(vm, call, 0, int64(state.LastSeq()))
+			if seq < 0 {
+				argError(vm, call, 0, "a non-negative number")
+			}
+			values, err := state.Replay(uint64(seq))
+			if err != nil {
+				throw(vm, err)
+			}
+			return ToValue(vm, values)
+		},
+		"last_seq": func(call goja.FunctionCall) goja.Value {
+			return vm.ToValue(int64(state.LastSeq()))
+		},
+	}
+}
+
+// stateExport returns export, which returns the state as a JSON or YAML
+// string or msgpack bytes in an ArrayBuffer, and import, which sets the
+// values of such a document
+func stateExport(vm *goja.Runtime, state *bridge.SharedState) Module {
+	return Module{
+		"export": func(call goja.FunctionCall) goja.Value {
+			format := bridge.StateFormatJSON
+			if !goja.IsUndefined(call.Argument(0)) {
+				format = stringArg(vm, call, 0)
+			}
+			schema, _ := state.Schema()
+			var buf bytes.Buffer
+			export := bridge.StateExport{Values: state.Values(), SchemaVersion: schema.Version}
+			if err := bridge.ExportState(&buf, format, export); err != nil {
+				throw(vm, err)
+			}
+			if format == bridge.StateFormatMsgpack {
+				return vm.ToValue(vm.NewArrayBuffer(buf.Bytes()))
+			}
+			return vm.ToValue(buf.String())
+		},
+		"import": func(call goja.FunctionCall) goja.Value {
+			var data []byte
+			switch v := Export(call.Argument(0)).(type) {
+			case string:
+				data = []byte(v)
+			case goja.ArrayBuffer:
+				data = v.Bytes()
+			default:
+				argError(vm, call, 0, "a string or an ArrayBuffer")
+			}
+			format := ""
+			if !goja.IsUndefined(call.Argument(1)) {
+				format = stringArg(vm, call, 1)
+			}
+			export, err := bridge.ImportState(bytes.NewReader(data), format)
+			if err != nil {
+				throw(vm, err)
+			}
+			if err := state.SetValues(export.Values); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+	}
+}
+
+// statePersistence returns persist, load, list_persisted, and
+// delete_persisted, which save the state under a name across runs, and
+// diff and diff_versions, which compare saved versions
+func statePersistence(vm *goja.Runtime, state *bridge.SharedState, store *bridge.SavedStates) Module {
+	// deepArg reads the deep field of an options object at i
+	deepArg := func(call goja.FunctionCall, i int) bool {
+		deep, _ := mapArg(vm, call, i)["deep"].(bool)
+		return deep
+	}
+	checkStore := func() {
+		if store == nil {
+			throw(vm, errors.New("saving state is not available"))
+		}
+	}
+
+	return Module{
+		"persist": func(call goja.FunctionCall) goja.Value {
+			name := stringArg(vm, call, 0)
+			checkStore()
+			version, err := store.Persist(name, state)
+			if err != nil {
+				throw(vm, err)
+			}
+			return vm.ToValue(version)
+		},
+		// load, diff, and delete_persisted take an optional version after
+		// the name; zero means the latest, or every version
+		"load": func(call goja.FunctionCall) goja.Value {
+			name := stringArg(vm, call, 0)
+			version := intArg(vm, call, 1, 0)
+			checkStore()
+			loaded, err := store.Load(name, int(version), state)
+			if err != nil {
+				throw(vm, err)
+			}
+			return vm.ToValue(loaded)
+		},
+		"list_persisted": func(call goja.FunctionCall) goja.Value {
+			checkStore()
+			saved, err := store.List()
+			if err != nil {
+				throw(vm, err)
+			}
+			list := make([]interface{}, len(saved))
+			for i, s := range saved {
+				list[i] = map[string]interface{}{
+					"name":     s.Name,
+					"versions": s.Versions,
+					"latest":   s.Latest,
+					"saved":    s.Saved.Unix(),
+				}
+			}
+			return ToValue(vm, list)
+		},
+		"diff": func(call goja.FunctionCall) goja.Value {
+			name := stringArg(vm, call, 0)
+			version := intArg(vm, call, 1, 0)
+			checkStore()
+			saved, _, err := store.Values(name, int(version))
+			if err != nil {
+				throw(vm, err)
+			}
+			return ToValue(vm, bridge.DiffStates(saved, state.Values(), deepArg(call, 2)).ToMap())
+		},
+		"diff_versions": func(call goja.FunctionCall) goja.Value {
+			name := stringArg(vm, call, 0)
+			if len(call.Arguments) < 3 {
+				panic(vm.NewTypeError("diff_versions takes a name and two versions"))
+			}
+			from := intArg(vm, call, 1, 0)
+			to := intArg(vm, call, 2, 0)
+			checkStore()
+			fromValues, _, err := store.Values(name, int(from))
+			if err != nil {
+				throw(vm, err)
+			}
+			toValues, _, err := store.Values(name, int(to))
+			if err != nil {
+				throw(vm, err)
+			}
+			return ToValue(vm, bridge.DiffStates(fromValues, toValues, deepArg(call, 3)).ToMap())
+		},
+		"delete_persisted": func(call goja.FunctionCall) goja.Value {
+			name := stringArg(vm, call, 0)
+			version := intArg(vm, call, 1, 0)
+			checkStore()
+			if err := store.Delete(name, int(version)); err != nil {
+				throw(vm, err)
+			}
+			return goja.Undefined()
+		},
+	}
+}
@@ -0,0 +1,144 @@
+// ABOUTME: Enforces method policies, rate limits, and call budgets on JavaScript bridge modules
+// ABOUTME: Also counts and profiles module calls, as the Lua bridges do, for run summaries
+
+package goja
+
+import (
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+// ApplyMethodPolicy enforces a method policy on the functions of a module
+// (e.g. "tools"). Functions the policy denies are replaced so that calling
+// them throws a permission error instead of reaching the bridge.
+func ApplyMethodPolicy(e *GojaEngine, module string, m Module, policy *security.MethodPolicy) {
+	if policy == nil {
+		return
+	}
+	wrapFunctions(m, func(name string) bool {
+		return !policy.Allows(module, name)
+	}, func(name string, fn Function) Function {
+		err := policy.Check(module, name)
+		return func(call goja.FunctionCall) goja.Value {
+			throw(e.vm, err)
+			return nil
+		}
+	})
+}
+
+// ApplyRateLimits checks each call to a limited function of a module
+// against the limiter. Calls over a limit throw a rate-limit error without
+// reaching the bridge.
+func ApplyRateLimits(e *GojaEngine, module string, m Module, limiter *security.RateLimiter) {
+	if limiter == nil {
+		return
+	}
+	wrapFunctions(m, func(name string) bool {
+		return limiter.Limits(module, name)
+	}, func(name string, fn Function) Function {
+		return func(call goja.FunctionCall) goja.Value {
+			if err := limiter.Allow(module, name); err != nil {
+				throw(e.vm, err)
+			}
+			return fn(call)
+		}
+	})
+}
+
+// ApplyCallBudget spends the calls bridge.CallCost prices from budget
+// before each call to a module function that draws on it. The call that
+// would go over budget throws a budget error, and the run is cancelled so
+// the spell stops.
+func ApplyCallBudget(e *GojaEngine, module string, m Module, budget *bridge.CallBudget) {
+	if budget == nil {
+		return
+	}
+	wrapFunctions(m, func(name string) bool {
+		return budget.Counts(module + "." + name)
+	}, func(name string, fn Function) Function {
+		return func(call goja.FunctionCall) goja.Value {
+			method := module + "." + name
+			if err := budget.SpendN(method, bridge.CallCost(method, gojaCallArgs(call))); err != nil {
+				throw(e.vm, err)
+			}
+			return fn(call)
+		}
+	})
+}
+
+// gojaCallArgs are the arguments of a JavaScript call, as bridge.CallCost
+// reads them
+type gojaCallArgs goja.FunctionCall
+
+// Len returns the length of argument i, if it is an array
+func (a gojaCallArgs) Len(i int) (int, bool) {
+	if list, ok := goja.FunctionCall(a).Argument(i).Export().([]interface{}); ok {
+		return len(list), true
+	}
+	return 0, false
+}
+
+// Number returns field of argument i, if it is an object holding a number
+// there
+func (a gojaCallArgs) Number(i int, field string) (float64, bool) {
+	object, ok := goja.FunctionCall(a).Argument(i).Export().(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+	switch n := object[field].(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// ApplyCallStats records each call to a module function in stats as
+// "module.function". A call counts as failed when it throws.
+func ApplyCallStats(module string, m Module, stats *bridge.CallStats) {
+	if stats == nil {
+		return
+	}
+	wrapFunctions(m, nil, func(name string, fn Function) Function {
+		return func(call goja.FunctionCall) goja.Value {
+			start := time.Now()
+			failed := true
+			defer func() {
+				stats.Record(module+"."+name, failed, time.Since(start))
+			}()
+			result := fn(call)
+			failed = false
+			return result
+		}
+	})
+}
+
+// ApplyProfile times each call to a module function with p as
+// "module.function"
+func ApplyProfile(module string, m Module, p *bridge.Profiler) {
+	if p == nil {
+		return
+	}
+	wrapFunctions(m, nil, func(name string, fn Function) Function {
+		return func(call goja.FunctionCall) goja.Value {
+			p.Begin(module + "." + name)
+			defer p.End()
+			return fn(call)
+		}
+	})
+}
+
+// wrapFunctions replaces each function of a module that selected accepts,
+// or every one if selected is nil, with what wrap makes of it
+func wrapFunctions(m Module, selected func(name string) bool, wrap func(name string, fn Function) Function) {
+	for name, fn := range m {
+		if selected != nil && !selected(name) {
+			continue
+		}
+		m[name] = wrap(name, fn)
+	}
+}
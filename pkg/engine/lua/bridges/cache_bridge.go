@@ -0,0 +1,87 @@
+// ABOUTME: Lua bridge for the spell's own cache of computed values
+// ABOUTME: Exposes cache.get, set, delete, and memoize to Lua scripts
+
+package bridges
+
+import (
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// RegisterCacheModule registers the cache module in Lua. TTLs are in
+// seconds; zero or none keeps an entry until the cache evicts it.
+func RegisterCacheModule(L *lua.LState, cache *bridge.ScriptCache) error {
+	cacheMod := L.NewTable()
+	converter := engLua.NewLuaConverter(L)
+
+	L.SetField(cacheMod, "get", L.NewFunction(func(L *lua.LState) int {
+		value, ok := cache.Get(L.CheckString(1))
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(converter.ToLua(value))
+		return 1
+	}))
+	L.SetField(cacheMod, "set", L.NewFunction(func(L *lua.LState) int {
+		key := L.CheckString(1)
+		value := L.CheckAny(2)
+		if _, ok := value.(*lua.LFunction); ok {
+			L.ArgError(2, "functions cannot be cached")
+			return 0
+		}
+		if err := cache.Set(key, converter.ToInterface(value), cacheTTL(L, 3)); err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(lua.LTrue)
+		return 1
+	}))
+	L.SetField(cacheMod, "delete", L.NewFunction(func(L *lua.LState) int {
+		cache.Delete(L.CheckString(1))
+		return 0
+	}))
+
+	// memoize(key, fn[, ttl]) returns the value cached under key, or calls
+	// fn and caches what it returns. A nil result, as from fn returning
+	// nil and an error, is passed back without being cached, and a value
+	// too large to cache is still returned.
+	L.SetField(cacheMod, "memoize", L.NewFunction(func(L *lua.LState) int {
+		key := L.CheckString(1)
+		fn := L.CheckFunction(2)
+		ttl := cacheTTL(L, 3)
+		if value, ok := cache.Get(key); ok {
+			L.Push(converter.ToLua(value))
+			return 1
+		}
+
+		L.Push(fn)
+		L.Call(0, 2)
+		value, errValue := L.Get(-2), L.Get(-1)
+		L.Pop(2)
+		if value == lua.LNil {
+			L.Push(lua.LNil)
+			L.Push(errValue)
+			return 2
+		}
+		_ = cache.Set(key, converter.ToInterface(value), ttl)
+		L.Push(value)
+		return 1
+	}))
+
+	L.SetGlobal("cache", cacheMod)
+	return nil
+}
+
+// cacheTTL reads an optional TTL in seconds
+func cacheTTL(L *lua.LState, n int) time.Duration {
+	seconds := float64(L.OptNumber(n, 0))
+	if seconds < 0 {
+		L.ArgError(n, "ttl must not be negative")
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,52 @@
+// ABOUTME: Tests for the Lua cache bridge
+// ABOUTME: Verifies get, set, delete, and memoize from Lua, and the size limit error
+
+package bridges
+
+import (
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestCacheBridge(t *testing.T) {
+	backend := bridge.NewMemoryCache(0, 64)
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterCacheModule(L, bridge.NewScriptCache(bridge.ScriptCacheOptions{Backend: backend, Namespace: "test"})))
+
+	err := L.DoString(`
+		assert(cache.get("missing") == nil)
+		assert(cache.set("summary", {words = 120, tags = {"go"}}, 60) == true)
+		local summary = cache.get("summary")
+		assert(summary.words == 120 and summary.tags[1] == "go")
+		cache.delete("summary")
+		assert(cache.get("summary") == nil)
+
+		local calls = 0
+		local function fetch()
+			calls = calls + 1
+			return "page " .. calls
+		end
+		assert(cache.memoize("page", fetch) == "page 1")
+		assert(cache.memoize("page", fetch) == "page 1", "The second call should hit")
+		assert(calls == 1)
+
+		local value, err = cache.memoize("broken", function() return nil, "offline" end)
+		assert(value == nil and err == "offline")
+		assert(cache.memoize("broken", function() return "back" end) == "back", "Failures should not be cached")
+
+		local ok, msg = cache.set("big", string.rep("x", 100))
+		assert(ok == nil and msg:find("larger than the cache's limit"), msg)
+		assert(cache.memoize("big", function() return string.rep("x", 100) end) == string.rep("x", 100))
+	`)
+	require.NoError(t, err)
+
+	err = L.DoString(`cache.set("fn", function() end)`)
+	assert.ErrorContains(t, err, "functions cannot be cached")
+	err = L.DoString(`cache.set("k", 1, -1)`)
+	assert.ErrorContains(t, err, "ttl must not be negative")
+}
@@ -0,0 +1,51 @@
+// ABOUTME: Counts calls to Lua bridge module functions for run reporting
+// ABOUTME: Wraps module functions to record each call, its duration, and whether it failed
+
+package bridges
+
+import (
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/clock"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ApplyCallStats wraps every Go function of the Lua module registered as the
+// global named module so that each call is recorded in stats as
+// "module.function". A call counts as failed when it raises an error or
+// returns nil followed by an error string, the bridges' error convention.
+func ApplyCallStats(L *lua.LState, module string, stats *bridge.CallStats) {
+	mod, ok := L.GetGlobal(module).(*lua.LTable)
+	if !ok || stats == nil {
+		return
+	}
+
+	counted := make(map[string]*lua.LFunction)
+	mod.ForEach(func(key, value lua.LValue) {
+		name, isString := key.(lua.LString)
+		if fn, isFunction := value.(*lua.LFunction); isString && isFunction && fn.IsG {
+			counted[string(name)] = fn
+		}
+	})
+
+	for name, fn := range counted {
+		L.SetField(mod, name, L.NewFunction(countCalls(stats, module+"."+name, fn.GFunction)))
+	}
+}
+
+// countCalls records each call to fn under name, timed by the state's clock
+func countCalls(stats *bridge.CallStats, name string, fn lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		c := stdlib.ClockOf(L)
+		start := c.Now()
+		failed := true
+		defer func() {
+			// Raised errors unwind through here before the deferred record
+			stats.Record(name, failed, clock.Since(c, start))
+		}()
+
+		n := fn(L)
+		failed = n >= 2 && L.Get(-n) == lua.LNil && L.Get(-n+1).Type() == lua.LTString
+		return n
+	}
+}
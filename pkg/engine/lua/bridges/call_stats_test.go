@@ -0,0 +1,49 @@
+// ABOUTME: Tests for counting calls to Lua bridge module functions
+// ABOUTME: Verifies calls, failures, and raised errors are recorded per function
+
+package bridges
+
+import (
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestApplyCallStats(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+	mockBridge.tools["echo"] = &mockToolInfo{
+		name: "echo",
+		handler: func(p map[string]interface{}) (interface{}, error) {
+			return "ok", nil
+		},
+	}
+
+	stats := bridge.NewCallStats()
+	ApplyCallStats(L, "tools", stats)
+
+	err := L.DoString(`
+		assert(tools.execute("echo", {}) == "ok")
+		local result, err = tools.execute("missing", {})
+		assert(result == nil and err ~= nil)
+		tools.list()
+		pcall(tools.execute) -- raises for the missing tool name
+	`)
+	require.NoError(t, err)
+
+	byName := make(map[string]bridge.CallStat)
+	for _, stat := range stats.Snapshot() {
+		byName[stat.Name] = stat
+	}
+	assert.Equal(t, 3, byName["tools.execute"].Calls)
+	assert.Equal(t, 2, byName["tools.execute"].Failures)
+	assert.Equal(t, 1, byName["tools.list"].Calls)
+	assert.Equal(t, 0, byName["tools.list"].Failures)
+	assert.Equal(t, 4, stats.Total())
+}
@@ -0,0 +1,283 @@
+// ABOUTME: Lua bridge for SQL databases, exposing the db module to scripts
+// ABOUTME: db.open returns a database with query, exec, begin, and transaction; rows are tables keyed by column
+
+package bridges
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Lua type names of open databases and transactions
+const (
+	databaseTypeName    = "db.database"
+	transactionTypeName = "db.transaction"
+)
+
+// RegisterDatabaseModule registers the db module in Lua. Databases the
+// script opened are closed when the spell ends. Functions and methods
+// return nil and an error message on failure.
+func RegisterDatabaseModule(L *lua.LState, db *bridge.DatabaseBridge) error {
+	mod := L.NewTable()
+	converter := engLua.NewLuaConverter(L)
+	stdlib.OnCleanup(L, func() { _ = db.Close() })
+
+	// Statements of databases and transactions take the same arguments
+	query := func(L *lua.LState, run func(string, []interface{}) ([]map[string]interface{}, error)) int {
+		statement := L.CheckString(2)
+		args, err := statementArgs(L, 3)
+		if err != nil {
+			return pushDatabaseError(L, err)
+		}
+		rows, err := run(statement, args)
+		if err != nil {
+			return pushDatabaseError(L, err)
+		}
+		L.Push(converter.ToLua(rows))
+		return 1
+	}
+	exec := func(L *lua.LState, run func(string, []interface{}) (bridge.ExecResult, error)) int {
+		statement := L.CheckString(2)
+		args, err := statementArgs(L, 3)
+		if err != nil {
+			return pushDatabaseError(L, err)
+		}
+		result, err := run(statement, args)
+		if err != nil {
+			return pushDatabaseError(L, err)
+		}
+		L.Push(converter.ToLua(result))
+		return 1
+	}
+
+	txMethods := map[string]lua.LGFunction{
+		// tx:query(sql, ...) returns the rows a statement selects
+		"query": func(L *lua.LState) int {
+			tx := checkTransaction(L, 1)
+			return query(L, func(sql string, args []interface{}) ([]map[string]interface{}, error) {
+				return tx.Query(scriptContext(L), sql, args...)
+			})
+		},
+		// tx:exec(sql, ...) returns {rows_affected, last_insert_id}
+		"exec": func(L *lua.LState) int {
+			tx := checkTransaction(L, 1)
+			return exec(L, func(sql string, args []interface{}) (bridge.ExecResult, error) {
+				return tx.Exec(scriptContext(L), sql, args...)
+			})
+		},
+		"commit": func(L *lua.LState) int {
+			return pushDatabaseResult(L, checkTransaction(L, 1).Commit())
+		},
+		"rollback": func(L *lua.LState) int {
+			return pushDatabaseResult(L, checkTransaction(L, 1).Rollback())
+		},
+	}
+	txMeta := L.NewTypeMetatable(transactionTypeName)
+	L.SetField(txMeta, "__index", L.SetFuncs(L.NewTable(), txMethods))
+
+	dbMethods := map[string]lua.LGFunction{
+		// database:query(sql, ...) returns the rows a statement selects.
+		// Placeholders are ? for SQLite and $1, $2, ... for Postgres; their
+		// values follow the statement, or come as one list.
+		"query": func(L *lua.LState) int {
+			d := checkDatabase(L, 1)
+			return query(L, func(sql string, args []interface{}) ([]map[string]interface{}, error) {
+				return d.Query(scriptContext(L), sql, args...)
+			})
+		},
+		// database:exec(sql, ...) returns {rows_affected, last_insert_id}
+		"exec": func(L *lua.LState) int {
+			d := checkDatabase(L, 1)
+			return exec(L, func(sql string, args []interface{}) (bridge.ExecResult, error) {
+				return d.Exec(scriptContext(L), sql, args...)
+			})
+		},
+		// database:begin() starts a transaction with query, exec, commit,
+		// and rollback
+		"begin": func(L *lua.LState) int {
+			tx, err := checkDatabase(L, 1).Begin(scriptContext(L))
+			if err != nil {
+				return pushDatabaseError(L, err)
+			}
+			pushUserData(L, tx, transactionTypeName)
+			return 1
+		},
+		// database:transaction(fn) calls fn(tx) and commits, returning what
+		// fn returned, or true. When fn raises an error or returns nil, err
+		// it rolls back and returns nil and the error.
+		"transaction": func(L *lua.LState) int {
+			d := checkDatabase(L, 1)
+			fn := L.CheckFunction(2)
+			tx, err := d.Begin(scriptContext(L))
+			if err != nil {
+				return pushDatabaseError(L, err)
+			}
+			txValue := pushUserData(L, tx, transactionTypeName)
+			L.Pop(1)
+
+			if err := L.CallByParam(lua.P{Fn: fn, NRet: 2, Protect: true}, txValue); err != nil {
+				_ = tx.Rollback()
+				if apiErr, ok := err.(*lua.ApiError); ok {
+					L.Push(lua.LNil)
+					L.Push(apiErr.Object)
+					return 2
+				}
+				return pushDatabaseError(L, err)
+			}
+			value, errValue := L.Get(-2), L.Get(-1)
+			L.Pop(2)
+			if value == lua.LNil && errValue != lua.LNil {
+				_ = tx.Rollback()
+				L.Push(lua.LNil)
+				L.Push(errValue)
+				return 2
+			}
+			if err := tx.Commit(); err != nil {
+				return pushDatabaseError(L, err)
+			}
+			if value == lua.LNil {
+				value = lua.LTrue
+			}
+			L.Push(value)
+			return 1
+		},
+		// database:stats() reports on the connection pool
+		"stats": func(L *lua.LState) int {
+			stats := checkDatabase(L, 1).Stats()
+			table := L.NewTable()
+			L.SetField(table, "open", lua.LNumber(stats.OpenConnections))
+			L.SetField(table, "in_use", lua.LNumber(stats.InUse))
+			L.SetField(table, "idle", lua.LNumber(stats.Idle))
+			L.SetField(table, "max_open", lua.LNumber(stats.MaxOpenConnections))
+			L.SetField(table, "wait_count", lua.LNumber(stats.WaitCount))
+			L.Push(table)
+			return 1
+		},
+		"close": func(L *lua.LState) int {
+			return pushDatabaseResult(L, checkDatabase(L, 1).Close())
+		},
+	}
+	dbMeta := L.NewTypeMetatable(databaseTypeName)
+	L.SetField(dbMeta, "__index", L.SetFuncs(L.NewTable(), dbMethods))
+
+	// open(driver, dsn[, pool]) opens a "sqlite" or "postgres" database.
+	// pool sizes its connection pool: max_open, max_idle, and max_lifetime
+	// and max_idle_time in seconds.
+	L.SetField(mod, "open", L.NewFunction(func(L *lua.LState) int {
+		driver := L.CheckString(1)
+		dsn := L.CheckString(2)
+		var pool bridge.PoolOptions
+		if options := L.OptTable(3, nil); options != nil {
+			pool.MaxOpen = int(lua.LVAsNumber(L.GetField(options, "max_open")))
+			pool.MaxIdle = int(lua.LVAsNumber(L.GetField(options, "max_idle")))
+			pool.MaxLifetime = seconds(L.GetField(options, "max_lifetime"))
+			pool.MaxIdleTime = seconds(L.GetField(options, "max_idle_time"))
+		}
+		d, err := db.Open(scriptContext(L), driver, dsn, pool)
+		if err != nil {
+			return pushDatabaseError(L, err)
+		}
+		pushUserData(L, d, databaseTypeName)
+		return 1
+	}))
+
+	// drivers() lists the drivers open accepts
+	L.SetField(mod, "drivers", L.NewFunction(func(L *lua.LState) int {
+		L.Push(converter.ToLua(db.Drivers()))
+		return 1
+	}))
+
+	L.SetGlobal("db", mod)
+	return nil
+}
+
+// statementArgs reads the values for a statement's placeholders from
+// position n on: one list of values, or the values themselves. Whole
+// numbers are bound as integers; tables cannot be bound.
+func statementArgs(L *lua.LState, n int) ([]interface{}, error) {
+	var values []lua.LValue
+	for i := n; i <= L.GetTop(); i++ {
+		values = append(values, L.Get(i))
+	}
+	if list, ok := L.Get(n).(*lua.LTable); ok && L.GetTop() == n {
+		values = values[:0]
+		for i := 1; i <= list.Len(); i++ {
+			values = append(values, list.RawGetInt(i))
+		}
+	}
+
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case lua.LNumber:
+			if f := float64(v); f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+				args[i] = int64(f)
+			} else {
+				args[i] = f
+			}
+		case lua.LString:
+			args[i] = string(v)
+		case lua.LBool:
+			args[i] = bool(v)
+		default:
+			if value != lua.LNil {
+				return nil, fmt.Errorf("parameter %d: a %s cannot be bound; encode it with json.encode", i+1, value.Type())
+			}
+		}
+	}
+	return args, nil
+}
+
+// seconds reads a duration given in seconds
+func seconds(value lua.LValue) time.Duration {
+	return time.Duration(float64(lua.LVAsNumber(value)) * float64(time.Second))
+}
+
+// pushUserData pushes value as userdata of the named type and returns it
+func pushUserData(L *lua.LState, value interface{}, typeName string) *lua.LUserData {
+	ud := L.NewUserData()
+	ud.Value = value
+	L.SetMetatable(ud, L.GetTypeMetatable(typeName))
+	L.Push(ud)
+	return ud
+}
+
+// checkDatabase returns the database at stack position n
+func checkDatabase(L *lua.LState, n int) *bridge.Database {
+	d, ok := L.CheckUserData(n).Value.(*bridge.Database)
+	if !ok {
+		L.ArgError(n, "database expected")
+	}
+	return d
+}
+
+// checkTransaction returns the transaction at stack position n
+func checkTransaction(L *lua.LState, n int) *bridge.Transaction {
+	tx, ok := L.CheckUserData(n).Value.(*bridge.Transaction)
+	if !ok {
+		L.ArgError(n, "transaction expected")
+	}
+	return tx
+}
+
+// pushDatabaseError pushes nil and the message for err
+func pushDatabaseError(L *lua.LState, err error) int {
+	L.Push(lua.LNil)
+	L.Push(scriptError(L, err))
+	return 2
+}
+
+// pushDatabaseResult pushes true, or nil and the message for err
+func pushDatabaseResult(L *lua.LState, err error) int {
+	if err != nil {
+		return pushDatabaseError(L, err)
+	}
+	L.Push(lua.LTrue)
+	return 1
+}
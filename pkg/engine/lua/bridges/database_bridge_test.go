@@ -0,0 +1,90 @@
+// ABOUTME: Tests for the Lua db module
+// ABOUTME: Verifies queries with bound parameters, transactions from Lua, and errors returned as values
+
+package bridges
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestDatabaseModule(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterDatabaseModule(L, bridge.NewDatabaseBridge(bridge.DatabaseOptions{})))
+
+	err := L.DoString(`
+		local drivers = db.drivers()
+		assert(drivers[1] == "postgres" and drivers[2] == "sqlite")
+
+		local conn = assert(db.open("sqlite", ":memory:", {max_open = 2}))
+		assert(conn:exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER, active BOOLEAN)"))
+
+		local result = assert(conn:exec("INSERT INTO users (name, age, active) VALUES (?, ?, ?)", "ada", 36, true))
+		assert(result.rows_affected == 1 and result.last_insert_id == 1)
+		assert(conn:exec("INSERT INTO users (name, age) VALUES (?, ?)", {"grace", 45}))
+
+		local rows = assert(conn:query("SELECT name, age, active FROM users WHERE age > ? ORDER BY id", 30))
+		assert(#rows == 2 and rows[1].name == "ada" and rows[1].age == 36 and rows[1].active == true)
+		assert(rows[2].active == nil, "NULL columns are nil")
+
+		local empty = assert(conn:query("SELECT * FROM users WHERE name = ?", "nobody"))
+		assert(#empty == 0)
+
+		local ok, err = conn:query("SELECT * FROM users WHERE name = ? AND age = ?", {nested = true}, 1)
+		assert(ok == nil and err:find("parameter 1"), err)
+		ok, err = conn:query("SELECT * FROM missing")
+		assert(ok == nil and err:find("no such table"), err)
+
+		-- A transaction that fails leaves nothing behind
+		ok, err = conn:transaction(function(tx)
+			assert(tx:exec("INSERT INTO users (name) VALUES (?)", "linus"))
+			error("changed my mind")
+		end)
+		assert(ok == nil and err:find("changed my mind"), err)
+		ok, err = conn:transaction(function(tx)
+			tx:exec("DELETE FROM users")
+			return nil, "not today"
+		end)
+		assert(ok == nil and err == "not today")
+		assert(#conn:query("SELECT id FROM users") == 2)
+
+		local count = assert(conn:transaction(function(tx)
+			tx:exec("INSERT INTO users (name) VALUES (?)", "linus")
+			return #tx:query("SELECT id FROM users")
+		end))
+		assert(count == 3)
+
+		local tx = assert(conn:begin())
+		tx:exec("DELETE FROM users")
+		assert(tx:rollback())
+		assert(#conn:query("SELECT id FROM users") == 3)
+
+		local stats = conn:stats()
+		assert(stats.max_open == 1, "In-memory databases use one connection")
+		assert(conn:close())
+		ok, err = conn:query("SELECT 1")
+		assert(ok == nil and err:find("closed"))
+
+		ok, err = db.open("mysql", "")
+		assert(ok == nil and err:find("unknown database driver"))
+	`)
+	require.NoError(t, err)
+}
+
+func TestDatabaseModuleDenied(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterDatabaseModule(L, bridge.NewDatabaseBridge(bridge.DatabaseOptions{
+		Denied: errors.New("permission denied: no database permission"),
+	})))
+
+	require.NoError(t, L.DoString(`conn, err = db.open("sqlite", ":memory:")`))
+	assert.Equal(t, lua.LNil, L.GetGlobal("conn"))
+	assert.Equal(t, "permission denied: no database permission", L.GetGlobal("err").String())
+}
@@ -0,0 +1,124 @@
+// ABOUTME: Registry of renamed and moved bridge methods that scripts may still call
+// ABOUTME: Deprecated names keep working and raise a one-time warning naming the replacement
+
+package bridges
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Deprecation describes a method scripts may still call by an old name.
+// Method and Replacement are "module.name"; calling Method forwards to
+// Replacement, which is looked up when the call is made, unless call
+// implements the old behavior itself.
+type Deprecation struct {
+	Method      string
+	Replacement string
+	Since       string
+	RemoveIn    string
+
+	// Note tells how to migrate when the replacement is not a drop-in
+	Note string
+
+	call func(replacement lua.LValue) lua.LGFunction
+}
+
+// deprecations lists every deprecated method; keep it ordered by module
+var deprecations = []Deprecation{
+	{
+		Method:      "llm.has_pending",
+		Replacement: "async.pending_count",
+		Since:       "0.1.0",
+		RemoveIn:    "0.2.0",
+		Note:        "check async.pending_count() > 0",
+		call: func(replacement lua.LValue) lua.LGFunction {
+			return func(L *lua.LState) int {
+				L.Push(replacement)
+				L.Call(0, 1)
+				count := L.Get(-1)
+				L.Pop(1)
+				L.Push(lua.LBool(lua.LVAsNumber(count) > 0))
+				return 1
+			}
+		},
+	},
+	{
+		Method:      "llm.process_callbacks",
+		Replacement: "async.process_callbacks",
+		Since:       "0.1.0",
+		RemoveIn:    "0.2.0",
+	},
+}
+
+// Deprecations returns the deprecated methods, for documentation and tools
+func Deprecations() []Deprecation {
+	return append([]Deprecation(nil), deprecations...)
+}
+
+// message describes the deprecation for script authors
+func (d Deprecation) message() string {
+	msg := fmt.Sprintf("%s is deprecated since %s and will be removed in %s; use %s", d.Method, d.Since, d.RemoveIn, d.Replacement)
+	if d.Note != "" {
+		msg += " (" + d.Note + ")"
+	}
+	return msg
+}
+
+// ApplyDeprecations defines the deprecated names of the Lua module
+// registered as the global named module. The first call through a
+// deprecated name adds a warning to warnings; every call behaves like the
+// replacement. Names the module still defines itself are left alone.
+func ApplyDeprecations(L *lua.LState, module string, warnings *bridge.Warnings) {
+	mod, ok := L.GetGlobal(module).(*lua.LTable)
+	if !ok {
+		return
+	}
+
+	for _, d := range deprecations {
+		name, ok := strings.CutPrefix(d.Method, module+".")
+		if !ok || mod.RawGetString(name) != lua.LNil {
+			continue
+		}
+		L.SetField(mod, name, L.NewFunction(deprecatedMethod(d, warnings)))
+	}
+}
+
+// deprecatedMethod warns once, then forwards each call to the replacement
+func deprecatedMethod(d Deprecation, warnings *bridge.Warnings) lua.LGFunction {
+	warned := false
+	return func(L *lua.LState) int {
+		if !warned {
+			warned = true
+			warnings.Add(bridge.WarnDeprecated, d.message(), map[string]interface{}{
+				"method":      d.Method,
+				"replacement": d.Replacement,
+				"since":       d.Since,
+				"remove_in":   d.RemoveIn,
+			})
+		}
+
+		module, name, _ := strings.Cut(d.Replacement, ".")
+		replacement := lua.LNil
+		if mod, ok := L.GetGlobal(module).(*lua.LTable); ok {
+			replacement = L.GetField(mod, name)
+		}
+		if replacement == lua.LNil {
+			L.RaiseError("%s is unavailable", d.Replacement)
+		}
+		if d.call != nil {
+			return d.call(replacement)(L)
+		}
+
+		top := L.GetTop()
+		L.Push(replacement)
+		for i := 1; i <= top; i++ {
+			L.Push(L.Get(i))
+		}
+		L.Call(top, lua.MultRet)
+		return L.GetTop() - top
+	}
+}
@@ -0,0 +1,57 @@
+// ABOUTME: Tests for deprecated bridge method names
+// ABOUTME: Verifies old names forward to their replacements and warn only once
+
+package bridges
+
+import (
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestApplyDeprecations(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	stdlib.RegisterAsyncCallback(L)
+	require.NoError(t, L.DoString(`llm = {chat = function() return "hi" end}`))
+
+	warnings := bridge.NewWarnings()
+	ApplyDeprecations(L, "llm", warnings)
+
+	require.NoError(t, L.DoString(`
+		assert(llm.has_pending() == false, "nothing should be pending")
+		assert(llm.has_pending() == false, "nothing should be pending")
+		assert(llm.process_callbacks() == 0, "process_callbacks should forward to async")
+		assert(llm.chat() == "hi", "other methods are untouched")
+	`))
+
+	list := warnings.List()
+	require.Len(t, list, 2, "Each deprecated method should warn once")
+	assert.Equal(t, bridge.WarnDeprecated, list[0].Source)
+	assert.Equal(t, 1, list[0].Count)
+	assert.Contains(t, list[0].Message, "llm.has_pending is deprecated since 0.1.0 and will be removed in 0.2.0; use async.pending_count")
+	assert.Equal(t, "async.process_callbacks", list[1].Data["replacement"])
+}
+
+func TestApplyDeprecationsKeepsDefinedMethods(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	require.NoError(t, L.DoString(`llm = {has_pending = function() return "own" end}`))
+	ApplyDeprecations(L, "llm", bridge.NewWarnings())
+
+	require.NoError(t, L.DoString(`assert(llm.has_pending() == "own", "a module's own method wins")`))
+}
+
+func TestDeprecationsAreComplete(t *testing.T) {
+	for _, d := range Deprecations() {
+		assert.NotEmpty(t, d.Replacement, d.Method)
+		assert.NotEmpty(t, d.Since, d.Method)
+		assert.NotEmpty(t, d.RemoveIn, d.Method)
+	}
+}
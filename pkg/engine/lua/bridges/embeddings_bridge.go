@@ -0,0 +1,176 @@
+// ABOUTME: Lua bridge for text embeddings, exposing the embeddings module to scripts
+// ABOUTME: Provides embed, embed_batch, similarity, top_k, count_tokens, and provider and model selection
+
+package bridges
+
+import (
+	"fmt"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// RegisterEmbeddingsModule registers the embeddings module in Lua. Vectors
+// are lists of numbers. Functions that can fail return nil and an error
+// message; setters return the message, or nothing.
+func RegisterEmbeddingsModule(L *lua.LState, eb *bridge.EmbeddingsBridge) error {
+	mod := L.NewTable()
+
+	// embed(text) returns the vector of text
+	L.SetField(mod, "embed", L.NewFunction(func(L *lua.LState) int {
+		vector, err := eb.Embed(scriptContext(L), L.CheckString(1))
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(vectorToLua(L, vector))
+		return 1
+	}))
+
+	// embed_batch(texts) returns a vector per text, in order
+	L.SetField(mod, "embed_batch", L.NewFunction(func(L *lua.LState) int {
+		list := L.CheckTable(1)
+		texts := make([]string, list.Len())
+		for i := range texts {
+			text, ok := list.RawGetInt(i + 1).(lua.LString)
+			if !ok {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(fmt.Sprintf("text %d must be a string", i+1)))
+				return 2
+			}
+			texts[i] = string(text)
+		}
+		vectors, err := eb.EmbedBatch(scriptContext(L), texts)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		result := L.CreateTable(len(vectors), 0)
+		for _, vector := range vectors {
+			result.Append(vectorToLua(L, vector))
+		}
+		L.Push(result)
+		return 1
+	}))
+
+	// similarity(a, b) returns the cosine similarity of two vectors
+	L.SetField(mod, "similarity", L.NewFunction(func(L *lua.LState) int {
+		a, errA := luaVector(L.CheckTable(1))
+		b, errB := luaVector(L.CheckTable(2))
+		score, err := 0.0, errA
+		if err == nil {
+			err = errB
+		}
+		if err == nil {
+			score, err = bridge.CosineSimilarity(a, b)
+		}
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(lua.LNumber(score))
+		return 1
+	}))
+
+	// top_k(query, vectors[, k]) returns {index, score} for the k vectors
+	// most similar to query, most similar first; all of them without k
+	L.SetField(mod, "top_k", L.NewFunction(func(L *lua.LState) int {
+		query, err := luaVector(L.CheckTable(1))
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString("query: " + err.Error()))
+			return 2
+		}
+		list := L.CheckTable(2)
+		k := L.OptInt(3, 0)
+		vectors := make([][]float64, list.Len())
+		for i := range vectors {
+			table, ok := list.RawGetInt(i + 1).(*lua.LTable)
+			if ok {
+				vectors[i], err = luaVector(table)
+			}
+			if !ok || err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(fmt.Sprintf("vector %d must be a list of numbers", i+1)))
+				return 2
+			}
+		}
+		matches, err := bridge.RankBySimilarity(query, vectors, k)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		result := L.CreateTable(len(matches), 0)
+		for _, match := range matches {
+			entry := L.NewTable()
+			L.SetField(entry, "index", lua.LNumber(match.Index+1))
+			L.SetField(entry, "score", lua.LNumber(match.Score))
+			result.Append(entry)
+		}
+		L.Push(result)
+		return 1
+	}))
+
+	// count_tokens(text) estimates the tokens of text
+	L.SetField(mod, "count_tokens", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LNumber(eb.CountTokens(L.CheckString(1))))
+		return 1
+	}))
+
+	L.SetField(mod, "list_providers", L.NewFunction(func(L *lua.LState) int {
+		result := L.NewTable()
+		for _, name := range eb.Providers() {
+			result.Append(lua.LString(name))
+		}
+		L.Push(result)
+		return 1
+	}))
+	L.SetField(mod, "get_provider", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(eb.Provider()))
+		return 1
+	}))
+	L.SetField(mod, "set_provider", L.NewFunction(func(L *lua.LState) int {
+		if err := eb.SetProvider(L.CheckString(1)); err != nil {
+			L.Push(lua.LString(err.Error()))
+			return 1
+		}
+		return 0
+	}))
+	L.SetField(mod, "get_model", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(eb.Model()))
+		return 1
+	}))
+	L.SetField(mod, "set_model", L.NewFunction(func(L *lua.LState) int {
+		eb.SetModel(L.OptString(1, ""))
+		return 0
+	}))
+
+	L.SetGlobal("embeddings", mod)
+	return nil
+}
+
+// luaVector reads a list of numbers
+func luaVector(table *lua.LTable) ([]float64, error) {
+	vector := make([]float64, table.Len())
+	for i := range vector {
+		n, ok := table.RawGetInt(i + 1).(lua.LNumber)
+		if !ok {
+			return nil, fmt.Errorf("element %d is not a number", i+1)
+		}
+		vector[i] = float64(n)
+	}
+	return vector, nil
+}
+
+// vectorToLua returns vector as a list of numbers
+func vectorToLua(L *lua.LState, vector []float64) *lua.LTable {
+	table := L.CreateTable(len(vector), 0)
+	for _, value := range vector {
+		table.Append(lua.LNumber(value))
+	}
+	return table
+}
@@ -0,0 +1,78 @@
+// ABOUTME: Tests for the Lua embeddings bridge
+// ABOUTME: Verifies embedding, the similarity helpers, provider selection, and errors from Lua
+
+package bridges
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// wordEmbedder embeds texts by whether they mention cats or dogs
+type wordEmbedder struct{}
+
+func (wordEmbedder) Embed(ctx context.Context, model string, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		switch text {
+		case "cat":
+			vectors[i] = []float64{1, 0}
+		case "dog":
+			vectors[i] = []float64{0, 1}
+		default:
+			vectors[i] = []float64{1, 1}
+		}
+	}
+	return vectors, nil
+}
+
+func (wordEmbedder) DefaultModel() string {
+	return "words"
+}
+
+func TestEmbeddingsBridge(t *testing.T) {
+	eb := &bridge.EmbeddingsBridge{}
+	eb.SetEmbedder("words", wordEmbedder{})
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterEmbeddingsModule(L, eb))
+
+	err := L.DoString(`
+		local cat = embeddings.embed("cat")
+		assert(#cat == 2 and cat[1] == 1 and cat[2] == 0)
+
+		local docs = embeddings.embed_batch({"dog", "pets", "cat"})
+		assert(#docs == 3)
+		local matches = embeddings.top_k(cat, docs, 2)
+		assert(#matches == 2 and matches[1].index == 3 and matches[1].score == 1)
+		assert(matches[2].index == 2)
+
+		assert(embeddings.similarity(cat, docs[1]) == 0)
+		local score, err = embeddings.similarity(cat, {1, 2, 3})
+		assert(score == nil and err:find("different dimensions"))
+		local docs, err = embeddings.embed_batch({"cat", 42})
+		assert(docs == nil and err:find("text 2"))
+
+		assert(embeddings.count_tokens("abcdefgh") == 2)
+		assert(embeddings.get_provider() == "words" and embeddings.get_model() == "words")
+		assert(embeddings.set_provider("anthropic"):find("not available"))
+		embeddings.set_model("bigger")
+		assert(embeddings.get_model() == "bigger")
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "bigger", eb.Model())
+
+	L2 := lua.NewState()
+	defer L2.Close()
+	require.NoError(t, RegisterEmbeddingsModule(L2, &bridge.EmbeddingsBridge{}))
+	require.NoError(t, L2.DoString(`
+		local vector, err = embeddings.embed("cat")
+		assert(vector == nil and err:find("no embeddings provider"))
+		assert(#embeddings.list_providers() == 0)
+	`))
+}
@@ -0,0 +1,110 @@
+// ABOUTME: Lua bridge for external commands, exposing the exec module to scripts
+// ABOUTME: exec.run runs a command the security profile allowlists, with parameters, stdin, a timeout, and streamed output
+
+package bridges
+
+import (
+	"fmt"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// RegisterExecModule registers the exec module in Lua. Commands still
+// running are killed when the spell ends. Functions return nil and an
+// error message on failure.
+func RegisterExecModule(L *lua.LState, commands *bridge.ExecBridge) error {
+	mod := L.NewTable()
+	stdlib.OnCleanup(L, func() { _ = commands.Close() })
+
+	// run(name[, params[, options]]) runs a command and returns {exit_code,
+	// stdout, stderr, duration, truncated, signal, stopped}; a non-zero exit
+	// code is not an error. params fill the command's {{name}} templates.
+	// options are stdin, timeout in seconds, which can only shorten the
+	// command's, and on_output, called as on_output(stream, line) for each
+	// line; returning false kills the command.
+	L.SetField(mod, "run", L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		request := bridge.CommandRequest{Params: make(map[string]string)}
+		var err error
+		L.OptTable(2, L.NewTable()).ForEach(func(key, value lua.LValue) {
+			switch value.(type) {
+			case lua.LString, lua.LNumber, lua.LBool:
+				request.Params[key.String()] = value.String()
+			default:
+				if err == nil {
+					err = fmt.Errorf("parameter %s: a %s cannot be an argument", key, value.Type())
+				}
+			}
+		})
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		options := L.OptTable(3, L.NewTable())
+		request.Stdin = lua.LVAsString(options.RawGetString("stdin"))
+		if timeout := options.RawGetString("timeout"); timeout != lua.LNil {
+			request.Timeout = seconds(timeout)
+		}
+		if fn, ok := options.RawGetString("on_output").(*lua.LFunction); ok {
+			request.OnLine = func(stream, line string) error {
+				if err := L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, lua.LString(stream), lua.LString(line)); err != nil {
+					return err
+				}
+				keep := L.Get(-1)
+				L.Pop(1)
+				if keep == lua.LFalse {
+					return bridge.ErrStopCommand
+				}
+				return nil
+			}
+		}
+
+		result, err := commands.Run(scriptContext(L), name, request)
+		if err != nil {
+			L.Push(lua.LNil)
+			if apiErr, ok := err.(*lua.ApiError); ok {
+				L.Push(apiErr.Object)
+			} else {
+				L.Push(scriptError(L, err))
+			}
+			return 2
+		}
+		table := L.NewTable()
+		table.RawSetString("exit_code", lua.LNumber(result.ExitCode))
+		table.RawSetString("stdout", lua.LString(result.Stdout))
+		table.RawSetString("stderr", lua.LString(result.Stderr))
+		table.RawSetString("duration", lua.LNumber(result.Duration.Seconds()))
+		table.RawSetString("truncated", lua.LBool(result.Truncated))
+		table.RawSetString("stopped", lua.LBool(result.Stopped))
+		if result.Signal != "" {
+			table.RawSetString("signal", lua.LString(result.Signal))
+		}
+		L.Push(table)
+		return 1
+	}))
+
+	// commands() lists the commands the script may run as {name,
+	// description, params}
+	L.SetField(mod, "commands", L.NewFunction(func(L *lua.LState) int {
+		list := L.NewTable()
+		for _, command := range commands.Commands() {
+			params := L.NewTable()
+			for _, param := range command.Params {
+				params.Append(lua.LString(param))
+			}
+			entry := L.NewTable()
+			entry.RawSetString("name", lua.LString(command.Name))
+			entry.RawSetString("description", lua.LString(command.Description))
+			entry.RawSetString("params", params)
+			list.Append(entry)
+		}
+		L.Push(list)
+		return 1
+	}))
+
+	L.SetGlobal("exec", mod)
+	return nil
+}
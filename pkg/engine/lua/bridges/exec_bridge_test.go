@@ -0,0 +1,83 @@
+// ABOUTME: Tests for the Lua exec module
+// ABOUTME: Verifies commands run with parameters and stdin, streamed output, and errors returned as values
+
+package bridges
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestExecModule(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands need a POSIX shell")
+	}
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterExecModule(L, bridge.NewExecBridge(bridge.ExecOptions{Policy: security.ExecPolicy{
+		Commands: map[string]security.ExecCommand{
+			"greet": {Path: "sh", Args: []string{"-c", `echo "hello, $1"; exit 2`, "greet", "{{name}}"}, Description: "Greets someone"},
+			"upper": {Path: "tr", Args: []string{"a-z", "A-Z"}},
+			"lines": {Path: "sh", Args: []string{"-c", "echo one; echo two >&2; echo three"}},
+			"sleep": {Path: "sleep", Args: []string{"5"}},
+		},
+	}})))
+
+	err := L.DoString(`
+		local commands = exec.commands()
+		assert(#commands == 4 and commands[1].name == "greet" and commands[1].params[1] == "name")
+		assert(commands[1].description == "Greets someone")
+
+		local result = assert(exec.run("greet", {name = "lua"}))
+		assert(result.exit_code == 2 and result.stdout == "hello, lua\n" and result.stderr == "")
+		assert(result.truncated == false and result.signal == nil and result.duration >= 0)
+
+		result = assert(exec.run("upper", nil, {stdin = "quiet"}))
+		assert(result.stdout == "QUIET", result.stdout)
+
+		local seen = {}
+		result = assert(exec.run("lines", {}, {on_output = function(stream, line)
+			table.insert(seen, stream .. ":" .. line)
+		end}))
+		assert(#seen == 3 and result.stdout == "one\nthree\n")
+
+		result = assert(exec.run("lines", {}, {on_output = function(stream, line)
+			return false
+		end}))
+		assert(result.stopped)
+
+		local ok, err = exec.run("lines", {}, {on_output = function() error("bad callback") end})
+		assert(ok == nil and err:find("bad callback"), err)
+		ok, err = exec.run("sleep", {}, {timeout = 0.1})
+		assert(ok == nil and err:find("timed out"), err)
+		ok, err = exec.run("greet", {name = {}})
+		assert(ok == nil and err:find("parameter name"), err)
+		ok, err = exec.run("greet", {})
+		assert(ok == nil and err:find("missing parameter"), err)
+		ok, err = exec.run("rm", {path = "/"})
+		assert(ok == nil and err:find("unknown command"), err)
+	`)
+	assert.NoError(t, err)
+}
+
+func TestExecModuleDenied(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterExecModule(L, bridge.NewExecBridge(bridge.ExecOptions{
+		Denied: security.Profile{}.Require(security.PermissionExec),
+		Policy: security.ExecPolicy{Commands: map[string]security.ExecCommand{"ls": {Path: "ls"}}},
+	})))
+
+	err := L.DoString(`
+		assert(#exec.commands() == 0)
+		local ok, err = exec.run("ls")
+		assert(ok == nil and err:find("does not grant the exec permission"), err)
+	`)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,86 @@
+// ABOUTME: Exit hooks that Lua spells register with spell.on_exit to clean up when they end
+// ABOUTME: Hooks run last-registered first, on success, error, or cancellation, within a time budget
+
+package bridges
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// exitHookTimeout bounds how long all of a spell's exit hooks may run
+// together; hooks still waiting when it runs out are skipped
+var exitHookTimeout = 5 * time.Second
+
+// Exit hooks per Lua state, run by stdlib.Cleanup when the engine closes
+var (
+	exitHooksMu sync.Mutex
+	exitHooks   = make(map[*lua.LState][]*lua.LFunction)
+)
+
+// OnExit registers fn to run when the spell in L ends, however it ends.
+// Hooks run when the engine closes, before the standard library removes
+// temp files, so they can still flush files and state.
+func OnExit(L *lua.LState, fn *lua.LFunction) {
+	exitHooksMu.Lock()
+	defer exitHooksMu.Unlock()
+
+	if _, registered := exitHooks[L]; !registered {
+		stdlib.OnCleanup(L, func() { runExitHooks(L) })
+	}
+	exitHooks[L] = append(exitHooks[L], fn)
+}
+
+// runExitHooks calls the exit hooks of L in reverse registration order.
+// Each hook gets how the spell ended: nil for success, "error", or a
+// cancellation reason such as "interrupt" or "deadline", then the error
+// message. The spell's own context may already be cancelled, so hooks run
+// under a fresh one limited to exitHookTimeout. A failing hook is logged
+// and the rest still run.
+func runExitHooks(L *lua.LState) {
+	exitHooksMu.Lock()
+	hooks := exitHooks[L]
+	delete(exitHooks, L)
+	exitHooksMu.Unlock()
+
+	reason, message := lua.LValue(lua.LNil), lua.LValue(lua.LNil)
+	if err := stdlib.ExitError(L); err != nil {
+		reason, message = lua.LString("error"), lua.LString(err.Error())
+		if cancel := engine.CancelReason(err); cancel != "" {
+			reason = lua.LString(cancel)
+		}
+	}
+
+	ctx, cancel := context.WithTimeoutCause(context.Background(), exitHookTimeout, engine.ErrExecutionTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if ctx.Err() != nil {
+			log.Printf("Warning: exit hooks ran out of time; %d skipped", i+1)
+			return
+		}
+		L.Push(hooks[i])
+		L.Push(reason)
+		L.Push(message)
+		if err := L.PCall(2, 0, nil); err != nil {
+			log.Printf("Warning: exit hook failed: %v", engine.WrapCancel(ctx, err))
+		}
+	}
+}
+
+// spellOnExit creates the Lua function spell.on_exit(fn). Hooks belong to
+// the spell's main state L, even when registered from a coroutine.
+func spellOnExit(L *lua.LState) lua.LGFunction {
+	return func(caller *lua.LState) int {
+		OnExit(L, caller.CheckFunction(1))
+		return 0
+	}
+}
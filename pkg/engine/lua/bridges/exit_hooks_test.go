@@ -0,0 +1,76 @@
+// ABOUTME: Tests for spell exit hooks registered with spell.on_exit
+// ABOUTME: Verifies hooks run in reverse order after cancellation, see how the spell ended, and stay within their time budget
+
+package bridges
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestExitHooks(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterSpellModule(L, &mockSpellBridge{}))
+
+	err := L.DoString(`
+		ran = {}
+		spell.on_exit(function(reason, err)
+			table.insert(ran, "first:" .. tostring(reason))
+		end)
+		spell.on_exit(function() error("flush failed") end)
+		local co = coroutine.create(function()
+			spell.on_exit(function(reason, err)
+				table.insert(ran, "last:" .. tostring(err))
+			end)
+		end)
+		coroutine.resume(co)
+	`)
+	require.NoError(t, err)
+
+	// The spell was interrupted, so its own context is done
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(engine.ErrInterrupted)
+	L.SetContext(ctx)
+	stdlib.SetExitError(L, fmt.Errorf("%w: stopped", engine.ErrInterrupted))
+	stdlib.Cleanup(L)
+	L.RemoveContext()
+
+	ran := L.GetGlobal("ran").(*lua.LTable)
+	require.Equal(t, 2, ran.Len(), "Every hook should run, even after one fails")
+	assert.Equal(t, "last:spell interrupted: stopped", ran.RawGetInt(1).String())
+	assert.Equal(t, "first:interrupt", ran.RawGetInt(2).String())
+
+	// Hooks run once
+	stdlib.Cleanup(L)
+	assert.Equal(t, 2, ran.Len())
+}
+
+func TestExitHooksTimeBudget(t *testing.T) {
+	defer func(timeout time.Duration) { exitHookTimeout = timeout }(exitHookTimeout)
+	exitHookTimeout = 20 * time.Millisecond
+
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterSpellModule(L, &mockSpellBridge{}))
+
+	err := L.DoString(`
+		skipped = true
+		spell.on_exit(function() skipped = false end)
+		spell.on_exit(function(reason) while true do end end)
+	`)
+	require.NoError(t, err)
+
+	start := time.Now()
+	stdlib.Cleanup(L)
+	assert.Less(t, time.Since(start), time.Second, "A hung hook should not hold up the exit")
+	assert.Equal(t, lua.LTrue, L.GetGlobal("skipped"), "Hooks after the budget runs out are skipped")
+}
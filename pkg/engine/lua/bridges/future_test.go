@@ -0,0 +1,92 @@
+// ABOUTME: Tests for Lua handles of bridge futures
+// ABOUTME: Validates awaiting and streaming from the main state and from coroutines
+
+package bridges
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestLLMBridgeStreamChatAsync(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	require.NoError(t, NewLLMBridge(mockBridge).Register(L))
+
+	// Outside a coroutine, next and await block
+	err := L.DoString(`
+		local f = llm.stream_chat_async("Hello")
+		local chunks = {}
+		for chunk in f.next, f do
+			table.insert(chunks, chunk)
+		end
+		assert(table.concat(chunks) == "Chunk 1: Processing data", "Chunks should match")
+		local response, err = f:await()
+		assert(err == nil, "Error should be nil")
+		assert(response == "Chunk 1: Processing data", "Response should match")
+		assert(f:done(), "Future should be done")
+	`)
+	require.NoError(t, err)
+	assert.True(t, mockBridge.streamCalled)
+
+	// Inside a coroutine, await yields the future until it is ready
+	err = L.DoString(`
+		local co = coroutine.create(function()
+			return llm.stream_chat_async("Hello"):await()
+		end)
+		local ok, value = coroutine.resume(co)
+		while coroutine.status(co) ~= "dead" do
+			assert(tostring(value) == "future", "Should yield the future")
+			ok, value = coroutine.resume(co)
+		end
+		assert(ok and value == "Chunk 1: Processing data", "Response should match")
+	`)
+	require.NoError(t, err)
+
+	mockBridge.streamError = &bridge.StreamError{
+		StreamPosition: bridge.StreamPosition{Chunks: 1, Offset: 4, Partial: "Part"},
+		Err:            errors.New("connection reset"),
+	}
+	err = L.DoString(`
+		local response, err, info = llm.stream_chat_async("Hello"):await()
+		assert(response == nil, "Response should be nil")
+		assert(err ~= nil, "Error should be set")
+		assert(info.partial == "Part" and info.chunks == 1, "Position should be reported")
+	`)
+	require.NoError(t, err)
+}
+
+func TestToolsExecuteAsync(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+	mockBridge.tools["echo_tool"] = &mockToolInfo{
+		name:       "echo_tool",
+		parameters: map[string]interface{}{},
+		handler: func(params map[string]interface{}) (interface{}, error) {
+			return map[string]interface{}{"echo": params["message"]}, nil
+		},
+	}
+
+	err := L.DoString(`
+		local f = tools.execute_async("echo_tool", {message = "Hello"})
+		local done, result = f:poll()
+		assert(done, "Future should be resolved")
+		assert(result.echo == "Hello", "Echo should match input")
+
+		local result, err = tools.execute_async("non_existent"):await()
+		assert(result == nil, "Result should be nil")
+		assert(err == "tool not found", "Error message should match")
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "non_existent", mockBridge.lastExecutedTool)
+}
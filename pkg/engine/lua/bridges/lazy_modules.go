@@ -0,0 +1,107 @@
+// ABOUTME: Lazily loaded Lua bridge modules that register as cheap placeholders
+// ABOUTME: A module's bridge is created on first field access, then hooks such as security policies run
+
+package bridges
+
+import (
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// LazyModules defers loading the bridge modules of one Lua state until a
+// script first uses them. Each module starts as an empty placeholder table
+// whose metatable loads the real module on the first read or write of a
+// field; the real module's fields are then copied into the placeholder, so
+// references taken before loading keep working. Iterating an unloaded
+// module with pairs sees no fields.
+type LazyModules struct {
+	L       *lua.LState
+	pending map[string]func() error
+	failed  map[string]error
+	hooks   []func(module string)
+	loaded  []string
+}
+
+// NewLazyModules creates lazy module support for L
+func NewLazyModules(L *lua.LState) *LazyModules {
+	return &LazyModules{L: L, pending: make(map[string]func() error), failed: make(map[string]error)}
+}
+
+// OnLoad adds a function that runs on each module right after it loads,
+// such as ApplyMethodPolicy. Hooks must be added before scripts run.
+func (lm *LazyModules) OnLoad(hook func(module string)) {
+	lm.hooks = append(lm.hooks, hook)
+}
+
+// Register sets the global named module to a placeholder. load must
+// register the real module as that global, e.g. with RegisterToolsModule.
+func (lm *LazyModules) Register(module string, load func() error) {
+	L := lm.L
+	placeholder := L.NewTable()
+	meta := L.NewTable()
+	L.SetField(meta, "__index", L.NewFunction(func(L *lua.LState) int {
+		key := L.CheckAny(2)
+		if err := lm.Load(module); err != nil {
+			L.RaiseError("%v", err)
+		}
+		L.Push(placeholder.RawGet(key))
+		return 1
+	}))
+	L.SetField(meta, "__newindex", L.NewFunction(func(L *lua.LState) int {
+		key, value := L.CheckAny(2), L.CheckAny(3)
+		if err := lm.Load(module); err != nil {
+			L.RaiseError("%v", err)
+		}
+		placeholder.RawSet(key, value)
+		return 0
+	}))
+	L.SetMetatable(placeholder, meta)
+	L.SetGlobal(module, placeholder)
+
+	lm.pending[module] = load
+}
+
+// Load loads a module now if it has not been loaded yet. A module that
+// failed to load keeps failing with the same error.
+func (lm *LazyModules) Load(module string) error {
+	if err, failed := lm.failed[module]; failed {
+		return err
+	}
+	load, ok := lm.pending[module]
+	if !ok {
+		return nil
+	}
+	delete(lm.pending, module)
+
+	L := lm.L
+	placeholder := L.GetGlobal(module).(*lua.LTable)
+	err := load()
+	real, isTable := L.GetGlobal(module).(*lua.LTable)
+	if err == nil && (!isTable || real == placeholder) {
+		err = fmt.Errorf("loader registered no module")
+	}
+	if err != nil {
+		L.SetGlobal(module, placeholder)
+		lm.failed[module] = fmt.Errorf("%s module unavailable: %w", module, err)
+		return lm.failed[module]
+	}
+
+	// Become the real module in place
+	L.SetMetatable(placeholder, L.GetMetatable(real))
+	real.ForEach(func(key, value lua.LValue) {
+		placeholder.RawSet(key, value)
+	})
+	L.SetGlobal(module, placeholder)
+	lm.loaded = append(lm.loaded, module)
+
+	for _, hook := range lm.hooks {
+		hook(module)
+	}
+	return nil
+}
+
+// Loaded lists the modules loaded so far, in load order
+func (lm *LazyModules) Loaded() []string {
+	return append([]string(nil), lm.loaded...)
+}
@@ -0,0 +1,73 @@
+// ABOUTME: Tests for lazily loaded Lua bridge modules
+// ABOUTME: Verifies modules load once on first access, keep early references, and run load hooks
+
+package bridges
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestLazyModules(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	loads := 0
+	modules := NewLazyModules(L)
+	modules.Register("tools", func() error {
+		loads++
+		return RegisterToolsModule(L, newMockToolBridge())
+	})
+
+	var hooked []string
+	profile, err := security.LookupProfile("strict")
+	require.NoError(t, err)
+	modules.OnLoad(func(module string) {
+		hooked = append(hooked, module)
+		ApplyMethodPolicy(L, module, &profile.Methods)
+	})
+
+	// Registering and taking a reference does not load the module
+	require.NoError(t, L.DoString(`early = tools`))
+	assert.Equal(t, 0, loads)
+	assert.Empty(t, modules.Loaded())
+
+	err = L.DoString(`
+		assert(type(tools.list) == "function", "First access should load the module")
+		assert(early.list == tools.list, "Early references should see the loaded module")
+		local _, err = tools.execute("anything", {})
+		assert(err:find("permission denied"), "Load hooks should apply: " .. tostring(err))
+		tools.custom = 42
+		assert(tools.custom == 42)
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, loads)
+	assert.Equal(t, []string{"tools"}, hooked)
+	assert.Equal(t, []string{"tools"}, modules.Loaded())
+}
+
+func TestLazyModulesLoadError(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	modules := NewLazyModules(L)
+	modules.Register("agents", func() error {
+		return errors.New("no agent runtime")
+	})
+
+	err := L.DoString(`local x = agents.list`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "agents module unavailable: no agent runtime")
+
+	// The failure is not retried but reported on every access
+	err = L.DoString(`agents.x = 1`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "agents module unavailable")
+	assert.Error(t, modules.Load("agents"))
+	assert.Empty(t, modules.Loaded())
+}
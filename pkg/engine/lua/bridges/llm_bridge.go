@@ -5,9 +5,14 @@ package bridges
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
 	llmspellua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
 	lua "github.com/yuin/gopher-lua"
 )
 
@@ -36,14 +41,34 @@ func (lb *LLMBridge) Register(L *lua.LState) error {
 	L.SetField(llmModule, "chat", L.NewFunction(lb.chat))
 	L.SetField(llmModule, "complete", L.NewFunction(lb.complete))
 	L.SetField(llmModule, "stream_chat", L.NewFunction(lb.streamChat))
+	L.SetField(llmModule, "stream_complete", L.NewFunction(lb.streamComplete))
+	L.SetField(llmModule, "batch", L.NewFunction(lb.batch))
+	L.SetField(llmModule, "generate_structured", L.NewFunction(lb.generateStructured))
 	L.SetField(llmModule, "list_models", L.NewFunction(lb.listModels))
 	L.SetField(llmModule, "list_providers", L.NewFunction(lb.listProviders))
 	L.SetField(llmModule, "get_provider", L.NewFunction(lb.getProvider))
 	L.SetField(llmModule, "set_provider", L.NewFunction(lb.setProvider))
+	L.SetField(llmModule, "set_api_key", L.NewFunction(lb.setAPIKey))
+	L.SetField(llmModule, "set_model", L.NewFunction(lb.setModel))
+	L.SetField(llmModule, "get_model", L.NewFunction(lb.getModel))
+	L.SetField(llmModule, "resolve_model", L.NewFunction(lb.resolveModel))
+	L.SetField(llmModule, "set_context_fallback", L.NewFunction(lb.setContextFallback))
+	L.SetField(llmModule, "set_context_trim", L.NewFunction(lb.setContextTrim))
+	L.SetField(llmModule, "last_adjustment", L.NewFunction(lb.lastAdjustment))
+	L.SetField(llmModule, "set_routing", L.NewFunction(lb.setRouting))
+
+	// Response cache controls
+	cacheModule := L.NewTable()
+	L.SetField(cacheModule, "enable", L.NewFunction(lb.cacheEnable))
+	L.SetField(cacheModule, "disable", L.NewFunction(lb.cacheDisable))
+	L.SetField(cacheModule, "bypass", L.NewFunction(lb.cacheBypass))
+	L.SetField(cacheModule, "status", L.NewFunction(lb.cacheStatus))
+	L.SetField(llmModule, "cache", cacheModule)
 
 	// Register async functions
 	L.SetField(llmModule, "chat_async", L.NewFunction(lb.chatAsync))
 	L.SetField(llmModule, "complete_async", L.NewFunction(lb.completeAsync))
+	L.SetField(llmModule, "stream_chat_async", L.NewFunction(lb.streamChatAsync))
 
 	// Register the module
 	L.SetGlobal("llm", llmModule)
@@ -51,16 +76,25 @@ func (lb *LLMBridge) Register(L *lua.LState) error {
 	return nil
 }
 
-// chat handles chat requests from Lua
-// Usage: result, err = llm.chat(prompt)
+// chat handles chat requests from Lua. Instead of a prompt it takes a
+// list of messages such as {role = "user", content = "..."}, which the
+// bridge adapts to the provider.
+// Usage: result, err = llm.chat(prompt_or_messages)
 func (lb *LLMBridge) chat(L *lua.LState) int {
-	prompt := L.CheckString(1)
-
-	// Call the bridge
-	result, err := lb.bridge.Chat(context.Background(), prompt)
+	var result string
+	var err error
+	if messages, ok := L.Get(1).(*lua.LTable); ok {
+		var parsed []bridge.ChatMessage
+		parsed, err = bridge.ParseChatMessages(lb.converter.ToInterface(messages))
+		if err == nil {
+			result, err = lb.bridge.ChatMessages(scriptContext(L), parsed)
+		}
+	} else {
+		result, err = lb.bridge.Chat(scriptContext(L), L.CheckString(1))
+	}
 	if err != nil {
 		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
+		L.Push(scriptError(L, err))
 		return 2
 	}
 
@@ -76,10 +110,10 @@ func (lb *LLMBridge) complete(L *lua.LState) int {
 	maxTokens := L.OptInt(2, 0) // Optional maxTokens parameter
 
 	// Call the bridge
-	result, err := lb.bridge.Complete(context.Background(), prompt, maxTokens)
+	result, err := lb.bridge.Complete(scriptContext(L), prompt, maxTokens)
 	if err != nil {
 		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
+		L.Push(scriptError(L, err))
 		return 2
 	}
 
@@ -88,46 +122,151 @@ func (lb *LLMBridge) complete(L *lua.LState) int {
 	return 1
 }
 
-// streamChat handles streaming chat requests from Lua
-// Usage: err = llm.stream_chat(prompt, callback)
+// streamChat handles streaming chat requests from Lua. The callback gets
+// each chunk and its sequence number, counted from 1. If the stream breaks
+// off, the error comes with a table of the partial text, the chunks
+// delivered, and the byte offset reached; passing that table back as
+// options.resume continues the response from there.
+// Usage: err, info = llm.stream_chat(prompt, callback[, {resume = info}])
 func (lb *LLMBridge) streamChat(L *lua.LState) int {
 	prompt := L.CheckString(1)
 	callback := L.CheckFunction(2)
+	options := L.OptTable(3, nil)
+
+	var from bridge.StreamPosition
+	if options != nil {
+		if resume, ok := options.RawGetString("resume").(*lua.LTable); ok {
+			from = streamPositionFromLua(resume)
+		}
+	}
 
 	// Create a Go callback that calls the Lua callback
+	seq := from.Chunks
+	ctx := scriptContext(L)
 	goCallback := func(chunk string) error {
-		// Push the callback and argument
-		L.Push(callback)
-		L.Push(lua.LString(chunk))
+		seq++
 
-		// Call the Lua function
-		if err := L.PCall(1, 1, nil); err != nil {
-			return fmt.Errorf("lua callback error: %w", err)
-		}
+		// The provider may deliver chunks on its own goroutine
+		var failed error
+		err := callLua(ctx, L, "stream callback", 0, func() error {
+			L.Push(callback)
+			L.Push(lua.LString(chunk))
+			L.Push(lua.LNumber(seq))
+			if err := L.PCall(2, 1, nil); err != nil {
+				return err
+			}
 
-		// Check if callback returned an error
-		if L.Get(-1).Type() != lua.LTNil {
-			errStr := L.ToString(-1)
-			L.Pop(1)
-			if errStr != "" {
-				return fmt.Errorf("%s", errStr)
+			// Check if callback returned an error
+			if L.Get(-1).Type() != lua.LTNil {
+				if errStr := L.ToString(-1); errStr != "" {
+					failed = fmt.Errorf("%s", errStr)
+				}
 			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("lua callback error: %w", err)
 		}
-		L.Pop(1)
-
-		return nil
+		return failed
 	}
 
 	// Call the bridge
-	err := lb.bridge.StreamChat(context.Background(), prompt, goCallback)
+	var err error
+	if from.Chunks > 0 || from.Partial != "" {
+		err = lb.bridge.ResumeStreamChat(ctx, prompt, from, goCallback)
+	} else {
+		err = lb.bridge.StreamChat(ctx, prompt, goCallback)
+	}
 	if err != nil {
-		L.Push(lua.LString(err.Error()))
+		L.Push(scriptError(L, err))
+		if position, ok := bridge.StreamPositionOf(err); ok {
+			L.Push(stdlib.StreamPositionToLua(L, position))
+			return 2
+		}
 		return 1
 	}
 
 	return 0
 }
 
+// streamComplete streams a text completion to a callback as it arrives.
+// The callback gets each chunk and its sequence number, counted from 1;
+// the next chunk waits until it returns, so slow rendering slows the
+// stream rather than buffering it. Returning false stops the stream and
+// keeps the text so far; returning a string fails it with that message.
+// The whole text is returned, or nil, the error, and a table like
+// stream_chat's if the stream broke off or the spell was cancelled.
+// Usage: text, err, info = llm.stream_complete(prompt, callback[, {max_tokens = n}])
+func (lb *LLMBridge) streamComplete(L *lua.LState) int {
+	prompt := L.CheckString(1)
+	callback := L.CheckFunction(2)
+	maxTokens := 0
+	if options := L.OptTable(3, nil); options != nil {
+		maxTokens = int(lua.LVAsNumber(options.RawGetString("max_tokens")))
+	}
+
+	var text strings.Builder
+	seq := 0
+	ctx := scriptContext(L)
+	err := lb.bridge.StreamComplete(ctx, prompt, maxTokens, func(chunk string) error {
+		seq++
+		text.WriteString(chunk)
+		ret := lua.LValue(lua.LNil)
+		err := callLua(ctx, L, "stream callback", 0, func() error {
+			L.Push(callback)
+			L.Push(lua.LString(chunk))
+			L.Push(lua.LNumber(seq))
+			if err := L.PCall(2, 1, nil); err != nil {
+				return err
+			}
+			ret = L.Get(-1)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("lua callback error: %w", err)
+		}
+		switch {
+		case ret == lua.LFalse:
+			return bridge.ErrStopStream
+		case ret.Type() == lua.LTString && ret.String() != "":
+			return errors.New(ret.String())
+		}
+		return nil
+	})
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(scriptError(L, err))
+		if position, ok := bridge.StreamPositionOf(err); ok {
+			L.Push(stdlib.StreamPositionToLua(L, position))
+			return 3
+		}
+		return 2
+	}
+	L.Push(lua.LString(text.String()))
+	return 1
+}
+
+// streamChatAsync starts a streaming chat in the background and returns a
+// future: f:next() gives each chunk, and f:await() the whole response, or
+// nil, the error, and a table like stream_chat's if the stream broke off.
+// Usage: f = llm.stream_chat_async(prompt)
+func (lb *LLMBridge) streamChatAsync(L *lua.LState) int {
+	prompt := L.CheckString(1)
+	stdlib.PushFuture(L, lb.bridge.StreamChatAsync(scriptContext(L), prompt), lb.converter.ToLua)
+	return 1
+}
+
+// streamPositionFromLua reads a table from stdlib.StreamPositionToLua. The offset
+// always matches the partial text, so a script cannot make them disagree.
+func streamPositionFromLua(info *lua.LTable) bridge.StreamPosition {
+	partial := lua.LVAsString(info.RawGetString("partial"))
+	return bridge.StreamPosition{
+		Chunks:  int(lua.LVAsNumber(info.RawGetString("chunks"))),
+		Offset:  len(partial),
+		Partial: partial,
+	}
+}
+
 // listModels returns available models
 // Usage: models, err = llm.list_models()
 func (lb *LLMBridge) listModels(L *lua.LState) int {
@@ -172,3 +311,171 @@ func (lb *LLMBridge) setProvider(L *lua.LState) int {
 
 	return 0
 }
+
+// setAPIKey makes a provider available with a key, a handle from the
+// secrets module or a string; the key never enters the script
+// Usage: err = llm.set_api_key(provider, secrets.get("openai"))
+func (lb *LLMBridge) setAPIKey(L *lua.LState) int {
+	name := L.CheckString(1)
+	var key string
+	switch value := L.Get(2).(type) {
+	case lua.LString:
+		key = string(value)
+	case *lua.LUserData:
+		handle, ok := value.Value.(*bridge.SecretHandle)
+		if !ok {
+			L.ArgError(2, "secret or string expected")
+		}
+		host := bridge.ProviderHost(name)
+		if host == "" {
+			L.Push(lua.LString(fmt.Sprintf("unknown provider %q", name)))
+			return 1
+		}
+		var err error
+		if key, err = handle.Reveal(host); err != nil {
+			L.Push(lua.LString(err.Error()))
+			return 1
+		}
+	default:
+		L.ArgError(2, "secret or string expected")
+	}
+
+	if err := lb.bridge.SetAPIKey(name, key); err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+	return 0
+}
+
+// setModel selects the model for subsequent requests
+// Usage: err = llm.set_model(name) -- "default", "fast", "smart", "provider/model", or a model name
+func (lb *LLMBridge) setModel(L *lua.LState) int {
+	name := L.CheckString(1)
+
+	if err := lb.bridge.SetModel(name); err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+
+	return 0
+}
+
+// getModel returns the logical model requests use
+// Usage: model = llm.get_model()
+func (lb *LLMBridge) getModel(L *lua.LState) int {
+	L.Push(lua.LString(lb.bridge.GetModel()))
+	return 1
+}
+
+// resolveModel returns the provider and model a name resolves to
+// Usage: target, err = llm.resolve_model(name) -- {provider = ..., model = ...}
+func (lb *LLMBridge) resolveModel(L *lua.LState) int {
+	name := L.OptString(1, lb.bridge.GetModel())
+
+	target, err := lb.bridge.ResolveModel(name)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(lb.converter.ToLua(target))
+	return 1
+}
+
+// setContextFallback retries calls that overflow model's context window on larger
+// Usage: llm.set_context_fallback("fast", "smart")
+func (lb *LLMBridge) setContextFallback(L *lua.LState) int {
+	lb.bridge.SetContextFallback(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+// setContextTrim trims overflowing prompts to a token budget and retries
+// Usage: llm.set_context_trim(tokens) -- 0 disables trimming
+func (lb *LLMBridge) setContextTrim(L *lua.LState) int {
+	lb.bridge.SetContextTrim(L.CheckInt(1))
+	return 0
+}
+
+// setRouting routes calls over an ordered list of models: rate limits and
+// server errors are retried after backoff seconds, doubling, then fail over
+// to the next model; latency = true tries the fastest model first. nil or
+// an empty list turns routing off.
+// Usage: err = llm.set_routing({providers = {"anthropic", "openai/gpt-4o"}, retries = 2, backoff = 0.5, latency = true})
+func (lb *LLMBridge) setRouting(L *lua.LState) int {
+	var policy bridge.RoutingPolicy
+	if options := L.OptTable(1, nil); options != nil {
+		if providers, ok := options.RawGetString("providers").(*lua.LTable); ok {
+			providers.ForEach(func(_, value lua.LValue) {
+				policy.Models = append(policy.Models, value.String())
+			})
+		}
+		if retries, ok := options.RawGetString("retries").(lua.LNumber); ok {
+			policy.Retries = int(retries)
+		}
+		if backoff, ok := options.RawGetString("backoff").(lua.LNumber); ok {
+			policy.Backoff = time.Duration(float64(backoff) * float64(time.Second))
+		}
+		policy.ByLatency = lua.LVAsBool(options.RawGetString("latency"))
+	}
+
+	if err := lb.bridge.SetRouting(policy); err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+	return 0
+}
+
+// cacheEnable answers repeated chat and completion prompts from the
+// response cache, keeping new entries for ttl seconds, or until purged
+// with llmspell cache purge when ttl is 0 or missing
+// Usage: err = llm.cache.enable({ttl = 3600})
+func (lb *LLMBridge) cacheEnable(L *lua.LState) int {
+	var ttl time.Duration
+	if options := L.OptTable(1, nil); options != nil {
+		if seconds, ok := options.RawGetString("ttl").(lua.LNumber); ok {
+			ttl = time.Duration(float64(seconds) * float64(time.Second))
+		}
+	}
+
+	if err := lb.bridge.EnableCache(ttl); err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+	return 0
+}
+
+// cacheDisable stops using the response cache; entries stay for later runs
+// Usage: llm.cache.disable()
+func (lb *LLMBridge) cacheDisable(L *lua.LState) int {
+	lb.bridge.DisableCache()
+	return 0
+}
+
+// cacheBypass skips cache lookups while on, so calls reach the provider
+// and refresh the cached responses
+// Usage: llm.cache.bypass(true) ... llm.cache.bypass(false)
+func (lb *LLMBridge) cacheBypass(L *lua.LState) int {
+	lb.bridge.BypassCache(L.OptBool(1, true))
+	return 0
+}
+
+// cacheStatus returns the response cache settings
+// Usage: status = llm.cache.status() -- {available = true, enabled = true, ttl = 3600, bypass = false}
+func (lb *LLMBridge) cacheStatus(L *lua.LState) int {
+	L.Push(lb.converter.ToLua(lb.bridge.CacheStatus()))
+	return 1
+}
+
+// lastAdjustment describes how the most recent call was changed to fit
+// Usage: adj = llm.last_adjustment() -- nil, or {kind = "model"|"trim", message = ..., ...}
+func (lb *LLMBridge) lastAdjustment(L *lua.LState) int {
+	adjustment := lb.bridge.LastAdjustment()
+	if adjustment == nil {
+		L.Push(lua.LNil)
+		return 1
+	}
+
+	L.Push(lb.converter.ToLua(adjustment))
+	return 1
+}
@@ -5,6 +5,7 @@ package bridges
 
 import (
 	"context"
+	"time"
 
 	"github.com/lexlapax/go-llmspell/pkg/bridge"
 )
@@ -29,11 +30,31 @@ func (a *LLMBridgeAdapter) Complete(ctx context.Context, prompt string, maxToken
 	return a.bridge.Complete(ctx, prompt, maxTokens)
 }
 
+// ChatMessages sends a conversation to the LLM
+func (a *LLMBridgeAdapter) ChatMessages(ctx context.Context, messages []bridge.ChatMessage) (string, error) {
+	return a.bridge.ChatMessages(ctx, messages)
+}
+
 // StreamChat sends a chat message and streams the response
 func (a *LLMBridgeAdapter) StreamChat(ctx context.Context, prompt string, callback func(chunk string) error) error {
 	return a.bridge.StreamChat(ctx, prompt, callback)
 }
 
+// StreamComplete generates a text completion and streams it to callback
+func (a *LLMBridgeAdapter) StreamComplete(ctx context.Context, prompt string, maxTokens int, callback func(chunk string) error) error {
+	return a.bridge.StreamComplete(ctx, prompt, maxTokens, callback)
+}
+
+// StreamChatAsync streams a chat response in the background
+func (a *LLMBridgeAdapter) StreamChatAsync(ctx context.Context, prompt string) *bridge.Future {
+	return a.bridge.StreamChatAsync(ctx, prompt)
+}
+
+// ResumeStreamChat continues a streamed response interrupted at from
+func (a *LLMBridgeAdapter) ResumeStreamChat(ctx context.Context, prompt string, from bridge.StreamPosition, callback func(chunk string) error) error {
+	return a.bridge.ResumeStreamChat(ctx, prompt, from, callback)
+}
+
 // ListModels returns available models - converts ModelInfo to map[string]interface{}
 func (a *LLMBridgeAdapter) ListModels(ctx context.Context) ([]map[string]interface{}, error) {
 	models, err := a.bridge.ListModels(ctx)
@@ -78,3 +99,105 @@ func (a *LLMBridgeAdapter) GetCurrentProvider() string {
 func (a *LLMBridgeAdapter) SetProvider(name string) error {
 	return a.bridge.SetProvider(name)
 }
+
+// SetAPIKey makes a provider available with key
+func (a *LLMBridgeAdapter) SetAPIKey(name, key string) error {
+	return a.bridge.SetAPIKey(name, key)
+}
+
+// SetModel selects the model for subsequent requests
+func (a *LLMBridgeAdapter) SetModel(name string) error {
+	return a.bridge.SetModel(name)
+}
+
+// GetModel returns the logical model requests use
+func (a *LLMBridgeAdapter) GetModel() string {
+	return a.bridge.GetModel()
+}
+
+// ResolveModel returns the provider and model a name resolves to
+func (a *LLMBridgeAdapter) ResolveModel(name string) (map[string]interface{}, error) {
+	target, err := a.bridge.ResolveModel(name)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{"provider": target.Provider}
+	// No model means the provider's own default
+	if target.Model != "" {
+		result["model"] = target.Model
+	}
+	return result, nil
+}
+
+// SetContextFallback sets the larger model to retry with on overflow
+func (a *LLMBridgeAdapter) SetContextFallback(model, larger string) {
+	a.bridge.SetContextFallback(model, larger)
+}
+
+// SetContextTrim sets the token budget prompts are trimmed to on overflow
+func (a *LLMBridgeAdapter) SetContextTrim(tokens int) {
+	a.bridge.SetContextTrim(tokens)
+}
+
+// Batch sends requests through a pool of workers
+func (a *LLMBridgeAdapter) Batch(ctx context.Context, requests []bridge.BatchRequest, opts bridge.BatchOptions) bridge.BatchReport {
+	return a.bridge.Batch(ctx, requests, opts)
+}
+
+// GenerateStructured asks for JSON matching schema
+func (a *LLMBridgeAdapter) GenerateStructured(ctx context.Context, prompt string, schema map[string]interface{}, opts bridge.StructuredOptions) (bridge.StructuredResult, error) {
+	return a.bridge.GenerateStructured(ctx, prompt, schema, opts)
+}
+
+// EnableCache turns on the spell's response cache
+func (a *LLMBridgeAdapter) EnableCache(ttl time.Duration) error {
+	return a.bridge.ScriptResponseCache().Enable(ttl)
+}
+
+// DisableCache turns off the spell's response cache
+func (a *LLMBridgeAdapter) DisableCache() {
+	a.bridge.ScriptResponseCache().Disable()
+}
+
+// BypassCache skips lookups in the spell's response cache while on
+func (a *LLMBridgeAdapter) BypassCache(bypass bool) {
+	a.bridge.ScriptResponseCache().SetBypass(bypass)
+}
+
+// CacheStatus converts the response cache settings to a map
+func (a *LLMBridgeAdapter) CacheStatus() map[string]interface{} {
+	cache := a.bridge.ScriptResponseCache()
+	status := cache.Status()
+	return map[string]interface{}{
+		"available": cache != nil,
+		"enabled":   status.Enabled,
+		"ttl":       status.TTL.Seconds(),
+		"bypass":    status.Bypass,
+	}
+}
+
+// SetRouting routes calls over several models
+func (a *LLMBridgeAdapter) SetRouting(policy bridge.RoutingPolicy) error {
+	return a.bridge.SetRouting(policy)
+}
+
+// LastAdjustment converts the most recent context adjustment to a map
+func (a *LLMBridgeAdapter) LastAdjustment() map[string]interface{} {
+	adjustment, ok := a.bridge.LastAdjustment()
+	if !ok {
+		return nil
+	}
+
+	result := map[string]interface{}{
+		"kind":    adjustment.Kind,
+		"message": adjustment.String(),
+	}
+	if adjustment.Kind == "trim" {
+		result["from_tokens"] = adjustment.FromTokens
+		result["to_tokens"] = adjustment.ToTokens
+	} else {
+		result["from"] = adjustment.From
+		result["to"] = adjustment.To
+	}
+	return result
+}
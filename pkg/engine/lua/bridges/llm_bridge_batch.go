@@ -0,0 +1,63 @@
+// ABOUTME: llm.batch, which sends many prompts at once through a pool of workers
+// ABOUTME: Returns a result per prompt, in order, and totals with the estimated token usage
+
+package bridges
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// batch sends each prompt, or list of messages as llm.chat takes, and
+// waits for all of them. concurrency limits how many are in flight (4 by
+// default), timeout limits each in seconds, and max_tokens sends prompts as
+// completions. A failed prompt does not stop the others: each result is
+// {ok, response or error, duration, prompt_tokens, response_tokens}.
+// Usage: results, totals = llm.batch(prompts, {concurrency = 8, timeout = 30})
+func (lb *LLMBridge) batch(L *lua.LState) int {
+	prompts := L.CheckTable(1)
+	var opts bridge.BatchOptions
+	if options := L.OptTable(2, nil); options != nil {
+		if concurrency, ok := options.RawGetString("concurrency").(lua.LNumber); ok {
+			opts.Concurrency = int(concurrency)
+		}
+		if timeout, ok := options.RawGetString("timeout").(lua.LNumber); ok {
+			opts.Timeout = time.Duration(float64(timeout) * float64(time.Second))
+		}
+		if maxTokens, ok := options.RawGetString("max_tokens").(lua.LNumber); ok {
+			opts.MaxTokens = int(maxTokens)
+		}
+	}
+
+	requests := make([]bridge.BatchRequest, prompts.Len())
+	for i := range requests {
+		switch prompt := prompts.RawGetInt(i + 1).(type) {
+		case lua.LString:
+			requests[i].Prompt = string(prompt)
+		case *lua.LTable:
+			messages, err := bridge.ParseChatMessages(lb.converter.ToInterface(prompt))
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(fmt.Sprintf("prompt %d: %v", i+1, err)))
+				return 2
+			}
+			requests[i].Messages = messages
+		default:
+			L.Push(lua.LNil)
+			L.Push(lua.LString(fmt.Sprintf("prompt %d: expected a string or a list of messages, got %s", i+1, prompt.Type())))
+			return 2
+		}
+	}
+
+	report := lb.bridge.Batch(scriptContext(L), requests, opts)
+	results := L.CreateTable(len(report.Results), 0)
+	for _, result := range report.Results {
+		results.Append(lb.converter.ToLua(result.ToMap()))
+	}
+	L.Push(results)
+	L.Push(lb.converter.ToLua(report.ToMap()))
+	return 2
+}
@@ -5,6 +5,9 @@ package bridges
 
 import (
 	"context"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
 )
 
 // LLMBridgeInterface defines the methods needed by the Lua LLM bridge
@@ -12,12 +15,27 @@ type LLMBridgeInterface interface {
 	// Chat sends a chat message to the LLM
 	Chat(ctx context.Context, prompt string) (string, error)
 
+	// ChatMessages sends a conversation to the LLM, adapted to the
+	// provider it goes to
+	ChatMessages(ctx context.Context, messages []bridge.ChatMessage) (string, error)
+
 	// Complete generates text completion
 	Complete(ctx context.Context, prompt string, maxTokens int) (string, error)
 
 	// StreamChat sends a chat message and streams the response
 	StreamChat(ctx context.Context, prompt string, callback func(chunk string) error) error
 
+	// ResumeStreamChat continues a streamed response interrupted at from
+	ResumeStreamChat(ctx context.Context, prompt string, from bridge.StreamPosition, callback func(chunk string) error) error
+
+	// StreamComplete generates a text completion and streams it to
+	// callback; returning bridge.ErrStopStream from callback ends it early
+	StreamComplete(ctx context.Context, prompt string, maxTokens int, callback func(chunk string) error) error
+
+	// StreamChatAsync streams a chat response in the background, emitting
+	// each chunk and resolving with the whole response
+	StreamChatAsync(ctx context.Context, prompt string) *bridge.Future
+
 	// ListModels returns available models
 	ListModels(ctx context.Context) ([]map[string]interface{}, error)
 
@@ -29,4 +47,53 @@ type LLMBridgeInterface interface {
 
 	// SetProvider switches to a different provider
 	SetProvider(name string) error
+
+	// SetAPIKey makes a provider available with key instead of the key in
+	// the environment
+	SetAPIKey(name, key string) error
+
+	// SetModel selects the model for subsequent requests by alias or name
+	SetModel(name string) error
+
+	// GetModel returns the logical model requests use
+	GetModel() string
+
+	// ResolveModel returns the provider and model a name resolves to
+	ResolveModel(name string) (map[string]interface{}, error)
+
+	// SetContextFallback sets the larger model to retry with when model's
+	// context window overflows
+	SetContextFallback(model, larger string)
+
+	// SetContextTrim sets the token budget prompts are trimmed to on overflow
+	SetContextTrim(tokens int)
+
+	// Batch sends requests through a pool of workers and reports each
+	// one's outcome
+	Batch(ctx context.Context, requests []bridge.BatchRequest, opts bridge.BatchOptions) bridge.BatchReport
+
+	// GenerateStructured asks for JSON matching schema, sending repair
+	// prompts when the output does not match
+	GenerateStructured(ctx context.Context, prompt string, schema map[string]interface{}, opts bridge.StructuredOptions) (bridge.StructuredResult, error)
+
+	// EnableCache caches responses for ttl, or until purged when zero
+	EnableCache(ttl time.Duration) error
+
+	// DisableCache stops caching responses
+	DisableCache()
+
+	// BypassCache skips cache lookups while on, refreshing the entries
+	BypassCache(bypass bool)
+
+	// CacheStatus returns the cache settings: enabled, ttl in seconds, and
+	// bypass
+	CacheStatus() map[string]interface{}
+
+	// SetRouting routes calls over several models with retries and
+	// failover; a policy without models turns routing off
+	SetRouting(policy bridge.RoutingPolicy) error
+
+	// LastAdjustment describes the context-window adjustment made to the
+	// most recent call, or returns nil if there was none
+	LastAdjustment() map[string]interface{}
 }
@@ -0,0 +1,44 @@
+// ABOUTME: llm.generate_structured, which asks the LLM for JSON matching a schema
+// ABOUTME: Returns the validated value as a table, or nil and the validation errors of the last attempt
+
+package bridges
+
+import (
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// generateStructured asks for a JSON value matching schema, a JSON schema
+// as a table. Output that is not JSON or does not match goes back to the
+// model with what is wrong with it, up to retries times (2 by default).
+// Returns the value and the number of attempts it took, or nil and an
+// error listing the problems with the last output.
+// Usage: local person, err = llm.generate_structured(prompt, schema, {retries = 3})
+func (lb *LLMBridge) generateStructured(L *lua.LState) int {
+	prompt := L.CheckString(1)
+	schema, ok := lb.converter.ToInterface(L.CheckTable(2)).(map[string]interface{})
+	if !ok {
+		L.Push(lua.LNil)
+		L.Push(lua.LString("schema must be a table with keys, such as {type = \"object\"}"))
+		return 2
+	}
+	var opts bridge.StructuredOptions
+	if options := L.OptTable(3, nil); options != nil {
+		if retries, ok := options.RawGetString("retries").(lua.LNumber); ok {
+			opts.Retries = int(retries)
+			if retries == 0 {
+				opts.Retries = -1
+			}
+		}
+	}
+
+	result, err := lb.bridge.GenerateStructured(scriptContext(L), prompt, schema, opts)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lb.converter.ToLua(result.Value))
+	L.Push(lua.LNumber(result.Attempts))
+	return 2
+}
@@ -7,7 +7,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lexlapax/go-llmspell/pkg/bridge"
 	"github.com/stretchr/testify/assert"
@@ -23,12 +25,15 @@ type mockLLMBridge struct {
 	chatCalled        bool
 	chatResponse      string
 	chatError         error
+	chatMessages      []bridge.ChatMessage
 	completeCalled    bool
 	completeResponse  string
 	completeError     error
 	streamCalled      bool
 	streamChunks      []string
 	streamError       error
+	streamResumedFrom bridge.StreamPosition
+	streamMaxTokens   int
 	listModelsCalled  bool
 	models            []map[string]interface{}
 	listModelsError   error
@@ -36,6 +41,15 @@ type mockLLMBridge struct {
 	currentProvider   string
 	setProviderError  error
 	setProviderCalled bool
+	apiKeys           map[string]string
+	model             string
+	contextFallbacks  map[string]string
+	contextTrim       int
+	routing           bridge.RoutingPolicy
+	cache             bridge.ResponseCacheStatus
+	batchOptions      bridge.BatchOptions
+	structuredOptions bridge.StructuredOptions
+	adjustment        map[string]interface{}
 }
 
 func newMockLLMBridge() *mockLLMBridge {
@@ -62,6 +76,11 @@ func (m *mockLLMBridge) Chat(ctx context.Context, prompt string) (string, error)
 	return fmt.Sprintf("Response to: %s", prompt), nil
 }
 
+func (m *mockLLMBridge) ChatMessages(ctx context.Context, messages []bridge.ChatMessage) (string, error) {
+	m.chatMessages = messages
+	return fmt.Sprintf("Response to %d messages", len(messages)), nil
+}
+
 func (m *mockLLMBridge) Complete(ctx context.Context, prompt string, maxTokens int) (string, error) {
 	m.completeCalled = true
 	if m.completeError != nil {
@@ -88,6 +107,35 @@ func (m *mockLLMBridge) StreamChat(ctx context.Context, prompt string, callback
 	return nil
 }
 
+func (m *mockLLMBridge) ResumeStreamChat(ctx context.Context, prompt string, from bridge.StreamPosition, callback func(string) error) error {
+	m.streamResumedFrom = from
+	return m.StreamChat(ctx, prompt, callback)
+}
+
+func (m *mockLLMBridge) StreamComplete(ctx context.Context, prompt string, maxTokens int, callback func(string) error) error {
+	m.streamMaxTokens = maxTokens
+	err := m.StreamChat(ctx, prompt, callback)
+	if errors.Is(err, bridge.ErrStopStream) {
+		return nil
+	}
+	return err
+}
+
+func (m *mockLLMBridge) StreamChatAsync(ctx context.Context, prompt string) *bridge.Future {
+	return bridge.Async(ctx, func(ctx context.Context, emit func(interface{})) (interface{}, error) {
+		var response string
+		err := m.StreamChat(ctx, prompt, func(chunk string) error {
+			response += chunk
+			emit(chunk)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return response, nil
+	})
+}
+
 func (m *mockLLMBridge) ListModels(ctx context.Context) ([]map[string]interface{}, error) {
 	m.listModelsCalled = true
 	if m.listModelsError != nil {
@@ -119,6 +167,121 @@ func (m *mockLLMBridge) SetProvider(name string) error {
 	return fmt.Errorf("provider not found: %s", name)
 }
 
+func (m *mockLLMBridge) SetAPIKey(name, key string) error {
+	if m.apiKeys == nil {
+		m.apiKeys = make(map[string]string)
+	}
+	m.apiKeys[name] = key
+	return nil
+}
+
+func (m *mockLLMBridge) SetModel(name string) error {
+	if _, err := m.ResolveModel(name); err != nil {
+		return err
+	}
+	m.model = name
+	return nil
+}
+
+func (m *mockLLMBridge) GetModel() string {
+	if m.model == "" {
+		return bridge.DefaultModel
+	}
+	return m.model
+}
+
+func (m *mockLLMBridge) SetContextFallback(model, larger string) {
+	if m.contextFallbacks == nil {
+		m.contextFallbacks = make(map[string]string)
+	}
+	m.contextFallbacks[model] = larger
+}
+
+func (m *mockLLMBridge) SetContextTrim(tokens int) {
+	m.contextTrim = tokens
+}
+
+func (m *mockLLMBridge) GenerateStructured(ctx context.Context, prompt string, schema map[string]interface{}, opts bridge.StructuredOptions) (bridge.StructuredResult, error) {
+	m.structuredOptions = opts
+	if prompt == "invalid" {
+		return bridge.StructuredResult{}, &bridge.StructuredError{Attempts: 3, Err: errors.New("field 'age' is required")}
+	}
+	value := map[string]interface{}{"type": schema["type"], "prompt": prompt}
+	return bridge.StructuredResult{Value: value, Raw: "{}", Attempts: 2}, nil
+}
+
+func (m *mockLLMBridge) Batch(ctx context.Context, requests []bridge.BatchRequest, opts bridge.BatchOptions) bridge.BatchReport {
+	m.batchOptions = opts
+	report := bridge.BatchReport{}
+	for i, request := range requests {
+		result := bridge.BatchResult{Index: i, PromptTokens: bridge.EstimateTokens(request.Prompt)}
+		if request.Messages != nil {
+			result.Response = fmt.Sprintf("Reply to %d messages", len(request.Messages))
+		} else if strings.HasPrefix(request.Prompt, "fail") {
+			result.Error = "provider refused"
+		} else {
+			result.Response = "Response to: " + request.Prompt
+		}
+		if result.OK() {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+		report.PromptTokens += result.PromptTokens
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+func (m *mockLLMBridge) EnableCache(ttl time.Duration) error {
+	m.cache.Enabled, m.cache.TTL = true, ttl
+	return nil
+}
+
+func (m *mockLLMBridge) DisableCache() {
+	m.cache.Enabled = false
+}
+
+func (m *mockLLMBridge) BypassCache(bypass bool) {
+	m.cache.Bypass = bypass
+}
+
+func (m *mockLLMBridge) CacheStatus() map[string]interface{} {
+	return map[string]interface{}{"available": true, "enabled": m.cache.Enabled, "ttl": m.cache.TTL.Seconds(), "bypass": m.cache.Bypass}
+}
+
+func (m *mockLLMBridge) SetRouting(policy bridge.RoutingPolicy) error {
+	if policy.Retries < 0 {
+		return errors.New("routing retries and backoff must not be negative")
+	}
+	m.routing = policy
+	return nil
+}
+
+func (m *mockLLMBridge) LastAdjustment() map[string]interface{} {
+	return m.adjustment
+}
+
+func (m *mockLLMBridge) ResolveModel(name string) (map[string]interface{}, error) {
+	available := func(provider string) bool {
+		for _, p := range m.providers {
+			if p == provider {
+				return true
+			}
+		}
+		return false
+	}
+	target, err := bridge.DefaultModelAliases().Resolve(name, m.currentProvider, available)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{"provider": target.Provider}
+	if target.Model != "" {
+		result["model"] = target.Model
+	}
+	return result, nil
+}
+
 func TestLLMBridgeRegister(t *testing.T) {
 	L := lua.NewState()
 	defer L.Close()
@@ -138,8 +301,10 @@ func TestLLMBridgeRegister(t *testing.T) {
 	llmTable := llm.(*lua.LTable)
 	functions := []string{
 		"chat", "complete", "stream_chat", "list_models",
-		"list_providers", "get_provider", "set_provider",
-		"chat_async", "complete_async",
+		"list_providers", "get_provider", "set_provider", "set_api_key",
+		"set_model", "get_model", "resolve_model",
+		"set_context_fallback", "set_context_trim", "last_adjustment",
+		"set_routing", "batch", "generate_structured", "chat_async", "complete_async",
 	}
 
 	for _, fn := range functions {
@@ -176,6 +341,44 @@ func TestLLMBridgeChat(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestLLMBridgeChatMessages(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	llmBridge := NewLLMBridge(mockBridge)
+	require.NoError(t, llmBridge.Register(L))
+
+	err := L.DoString(`
+		local response, err = llm.chat({
+			{role = "system", content = "Be brief."},
+			{role = "user", content = {
+				{type = "text", text = "What is this?"},
+				{type = "image", url = "https://example.com/cat.png"},
+			}},
+			{role = "assistant", tool_calls = {{id = "call_1", name = "lookup", arguments = {q = "cat"}}}},
+			{role = "tool", tool_call_id = "call_1", content = "a cat"},
+		})
+		assert(response == "Response to 4 messages", "Response should match")
+		assert(err == nil, "Error should be nil")
+	`)
+	require.NoError(t, err)
+	require.Len(t, mockBridge.chatMessages, 4)
+	assert.Equal(t, "https://example.com/cat.png", mockBridge.chatMessages[1].Content[1].URL)
+	assert.Equal(t, "lookup", mockBridge.chatMessages[2].ToolCalls[0].Name)
+	assert.Equal(t, "call_1", mockBridge.chatMessages[3].ToolCallID)
+
+	// Malformed messages are reported without calling the bridge
+	mockBridge.chatMessages = nil
+	err = L.DoString(`
+		local response, err = llm.chat({{role = "narrator", content = "hi"}})
+		assert(response == nil, "Response should be nil on error")
+		assert(err:find("unknown role"), "Error should name the problem")
+	`)
+	require.NoError(t, err)
+	assert.Nil(t, mockBridge.chatMessages)
+}
+
 func TestLLMBridgeComplete(t *testing.T) {
 	L := lua.NewState()
 	defer L.Close()
@@ -259,6 +462,99 @@ func TestLLMBridgeStreamChat(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestLLMBridgeStreamChatResume(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	llmBridge := NewLLMBridge(mockBridge)
+	require.NoError(t, llmBridge.Register(L))
+
+	// Chunks are numbered from 1
+	err := L.DoString(`
+		local seqs = {}
+		local err = llm.stream_chat("Hello", function(chunk, seq)
+			table.insert(seqs, seq)
+		end)
+		assert(err == nil, "Error should be nil")
+		assert(#seqs == 3 and seqs[1] == 1 and seqs[3] == 3, "Chunks should be numbered")
+	`)
+	require.NoError(t, err)
+
+	// An interrupted stream reports where it stopped
+	mockBridge.streamError = &bridge.StreamError{
+		StreamPosition: bridge.StreamPosition{Chunks: 2, Offset: 10, Partial: "Once upon "},
+		Err:            bridge.ErrStreamIncomplete,
+	}
+	err = L.DoString(`
+		interrupted_err, interrupted = llm.stream_chat("Tell a story", function(chunk) end)
+		assert(interrupted_err ~= nil, "Error should be set")
+		assert(interrupted.partial == "Once upon ", "Partial text should be returned")
+		assert(interrupted.chunks == 2, "Chunk count should be returned")
+		assert(interrupted.offset == 10, "Offset should be returned")
+	`)
+	require.NoError(t, err)
+
+	// Resuming continues the numbering from the interrupted stream
+	mockBridge.streamError = nil
+	err = L.DoString(`
+		local seqs = {}
+		local err = llm.stream_chat("Tell a story", function(chunk, seq)
+			table.insert(seqs, seq)
+		end, {resume = interrupted})
+		assert(err == nil, "Error should be nil")
+		assert(seqs[1] == 3, "Numbering should continue after the resumed chunks")
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, bridge.StreamPosition{Chunks: 2, Offset: 10, Partial: "Once upon "}, mockBridge.streamResumedFrom)
+}
+
+func TestLLMBridgeStreamComplete(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	llmBridge := NewLLMBridge(mockBridge)
+	require.NoError(t, llmBridge.Register(L))
+
+	err := L.DoString(`
+		local rendered = {}
+		local text, err = llm.stream_complete("Hello", function(chunk, seq)
+			rendered[seq] = chunk
+		end, {max_tokens = 64})
+		assert(err == nil and text == "Chunk 1: Processing data", "Should return the whole text")
+		assert(#rendered == 3 and rendered[2] == "Processing ", "Should render each chunk")
+
+		-- Returning false stops the stream and keeps what came so far
+		local seen = 0
+		local text, err = llm.stream_complete("Hello", function(chunk)
+			seen = seen + 1
+			return seen < 2
+		end)
+		assert(err == nil and seen == 2 and text == "Chunk 1: Processing ", "Should stop after two chunks")
+
+		local text, err = llm.stream_complete("Hello", function(chunk)
+			return "renderer broke"
+		end)
+		assert(text == nil and err == "renderer broke", "A returned string should fail the stream")
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, 0, mockBridge.streamMaxTokens)
+
+	// An interrupted stream reports where it stopped
+	mockBridge.streamError = &bridge.StreamError{
+		StreamPosition: bridge.StreamPosition{Chunks: 1, Offset: 5, Partial: "Once "},
+		Err:            context.Canceled,
+	}
+	err = L.DoString(`
+		local text, err, info = llm.stream_complete("Tell a story", function(chunk) end, {max_tokens = 64})
+		assert(text == nil and err ~= nil, "Error should be set")
+		assert(info.partial == "Once " and info.chunks == 1, "Position should be returned")
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, 64, mockBridge.streamMaxTokens)
+}
+
 func TestLLMBridgeListModels(t *testing.T) {
 	L := lua.NewState()
 	defer L.Close()
@@ -342,6 +638,187 @@ func TestLLMBridgeProviders(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestLLMBridgeSetAPIKey(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	require.NoError(t, NewLLMBridge(mockBridge).Register(L))
+	require.NoError(t, RegisterSecretsModule(L, bridge.NewSecretsBridge(bridge.SecretsConfig{Secrets: map[string]bridge.Secret{
+		"openai":   {Value: "sk-secret", Hosts: []string{"api.openai.com"}},
+		"internal": {Value: "sk-internal", Hosts: []string{"llm.internal.example"}},
+	}})))
+
+	err := L.DoString(`
+		assert(llm.set_api_key("openai", secrets.get("openai")) == nil)
+		assert(llm.set_api_key("gemini", "plain-key") == nil)
+
+		local err = llm.set_api_key("anthropic", secrets.get("internal"))
+		assert(err:find("may not be sent to api.anthropic.com"), err)
+		err = llm.set_api_key("nope", secrets.get("openai"))
+		assert(err:find("unknown provider"), err)
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"openai": "sk-secret", "gemini": "plain-key"}, mockBridge.apiKeys)
+}
+
+func TestLLMBridgeModels(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	mockBridge.providers = []string{"anthropic"}
+	mockBridge.currentProvider = "anthropic"
+	require.NoError(t, NewLLMBridge(mockBridge).Register(L))
+
+	err := L.DoString(`
+		assert(llm.get_model() == "default", "Should start on the default model")
+
+		local target = llm.resolve_model()
+		assert(target.provider == "anthropic" and target.model == nil, "Default should use the current provider")
+
+		target = llm.resolve_model("smart")
+		assert(target.model == "claude-3-5-sonnet-latest", "smart should fall back to an available provider")
+
+		assert(llm.set_model("fast") == nil)
+		assert(llm.get_model() == "fast")
+
+		local err = llm.set_model("openai/gpt-4o")
+		assert(err:find("not available"), "Should reject unavailable providers: " .. tostring(err))
+
+		local missing, resolveErr = llm.resolve_model("openai/gpt-4o")
+		assert(missing == nil and resolveErr ~= nil)
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "fast", mockBridge.model)
+}
+
+func TestLLMBridgeContextRecovery(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	require.NoError(t, NewLLMBridge(mockBridge).Register(L))
+
+	err := L.DoString(`
+		llm.set_context_fallback("fast", "smart")
+		llm.set_context_trim(2000)
+		assert(llm.last_adjustment() == nil, "No adjustment before any call")
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"fast": "smart"}, mockBridge.contextFallbacks)
+	assert.Equal(t, 2000, mockBridge.contextTrim)
+
+	mockBridge.adjustment = map[string]interface{}{"kind": "model", "from": "openai/gpt-4o-mini", "to": "gemini/gemini-1.5-pro"}
+	err = L.DoString(`
+		local adj = llm.last_adjustment()
+		assert(adj.kind == "model" and adj.to == "gemini/gemini-1.5-pro")
+	`)
+	require.NoError(t, err)
+}
+
+func TestLLMBridgeSetRouting(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	require.NoError(t, NewLLMBridge(mockBridge).Register(L))
+
+	err := L.DoString(`
+		assert(llm.set_routing({providers = {"anthropic", "openai/gpt-4o"}, retries = 2, backoff = 0.25, latency = true}) == nil)
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, bridge.RoutingPolicy{
+		Models:    []string{"anthropic", "openai/gpt-4o"},
+		Retries:   2,
+		Backoff:   250 * time.Millisecond,
+		ByLatency: true,
+	}, mockBridge.routing)
+
+	err = L.DoString(`
+		assert(llm.set_routing({providers = {"openai"}, retries = -1}) ~= nil, "Invalid settings are reported")
+		assert(llm.set_routing() == nil)
+	`)
+	require.NoError(t, err)
+	assert.Empty(t, mockBridge.routing.Models)
+}
+
+func TestLLMBridgeBatch(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	require.NoError(t, NewLLMBridge(mockBridge).Register(L))
+
+	err := L.DoString(`
+		local results, totals = llm.batch({
+			"first",
+			"fail second",
+			{{role = "system", content = "Be brief"}, {role = "user", content = "third"}},
+		}, {concurrency = 2, timeout = 1.5, max_tokens = 64})
+		assert(#results == 3)
+		assert(results[1].ok and results[1].response == "Response to: first")
+		assert(not results[2].ok and results[2].error == "provider refused" and results[2].response == nil)
+		assert(results[3].response == "Reply to 2 messages")
+		assert(totals.succeeded == 2 and totals.failed == 1 and totals.prompt_tokens > 0)
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, bridge.BatchOptions{Concurrency: 2, Timeout: 1500 * time.Millisecond, MaxTokens: 64}, mockBridge.batchOptions)
+
+	err = L.DoString(`
+		local results, err = llm.batch({"ok", 42})
+		assert(results == nil and err:find("prompt 2"), "Invalid prompts fail the batch")
+	`)
+	require.NoError(t, err)
+}
+
+func TestLLMBridgeGenerateStructured(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	require.NoError(t, NewLLMBridge(mockBridge).Register(L))
+
+	err := L.DoString(`
+		local schema = {type = "object", required = {"name"}, properties = {name = {type = "string"}}}
+		local value, attempts = llm.generate_structured("Describe Ada", schema, {retries = 0})
+		assert(value.type == "object" and value.prompt == "Describe Ada")
+		assert(attempts == 2)
+
+		local value, err = llm.generate_structured("invalid", schema)
+		assert(value == nil and err:find("after 3 attempt") and err:find("'age' is required"))
+
+		local value, err = llm.generate_structured("hi", {"not", "a", "schema"})
+		assert(value == nil and err:find("schema must be a table"))
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, bridge.StructuredOptions{}, mockBridge.structuredOptions, "The last call used the default retries")
+
+	require.NoError(t, L.DoString(`llm.generate_structured("hi", {type = "object"}, {retries = 0})`))
+	assert.Equal(t, bridge.StructuredOptions{Retries: -1}, mockBridge.structuredOptions, "Zero retries sends no repair prompts")
+}
+
+func TestLLMBridgeCache(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	require.NoError(t, NewLLMBridge(mockBridge).Register(L))
+
+	err := L.DoString(`
+		assert(llm.cache.status().enabled == false)
+		assert(llm.cache.enable({ttl = 90}) == nil)
+		llm.cache.bypass()
+		local status = llm.cache.status()
+		assert(status.enabled and status.ttl == 90 and status.bypass, "Settings are reported")
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, bridge.ResponseCacheStatus{Enabled: true, TTL: 90 * time.Second, Bypass: true}, mockBridge.cache)
+
+	require.NoError(t, L.DoString(`llm.cache.bypass(false); llm.cache.disable()`))
+	assert.Equal(t, bridge.ResponseCacheStatus{TTL: 90 * time.Second}, mockBridge.cache)
+}
+
 func TestLLMBridgeAsyncFunctions(t *testing.T) {
 	L := lua.NewState()
 	defer L.Close()
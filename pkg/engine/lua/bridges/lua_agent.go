@@ -67,35 +67,21 @@ func (la *LuaAgent) Execute(ctx context.Context, input string, options *agents.E
 
 	switch la.luaValue.Type() {
 	case lua.LTFunction:
-		return la.executeFunction(input, options)
+		return la.executeFunction(ctx, input, options)
 	case lua.LTTable:
-		return la.executeTable(input, options)
+		return la.executeTable(ctx, input, options)
 	default:
 		return nil, errors.New("execute not implemented for this Lua type")
 	}
 }
 
 // executeFunction handles execution when the agent is a Lua function
-func (la *LuaAgent) executeFunction(input string, options *agents.ExecutionOptions) (*agents.ExecutionResult, error) {
-	// Convert options to Lua
-	optionsLua := la.convertOptionsToLua(options)
-
-	// Call the function
-	err := la.L.CallByParam(lua.P{
-		Fn:      la.luaValue.(*lua.LFunction),
-		NRet:    2,
-		Protect: true,
-	}, lua.LString(input), optionsLua)
-
+func (la *LuaAgent) executeFunction(ctx context.Context, input string, options *agents.ExecutionOptions) (*agents.ExecutionResult, error) {
+	ret1, ret2, err := la.call(ctx, la.luaValue.(*lua.LFunction), lua.LString(input), la.convertOptionsToLua(options))
 	if err != nil {
 		return nil, fmt.Errorf("lua execution error: %w", err)
 	}
 
-	// Get return values
-	ret2 := la.L.Get(-1) // error (if any)
-	ret1 := la.L.Get(-2) // result
-	la.L.Pop(2)
-
 	// Check for error
 	if ret2.Type() == lua.LTString {
 		return nil, errors.New(lua.LVAsString(ret2))
@@ -110,32 +96,19 @@ func (la *LuaAgent) executeFunction(input string, options *agents.ExecutionOptio
 }
 
 // executeTable handles execution when the agent is a Lua table with methods
-func (la *LuaAgent) executeTable(input string, options *agents.ExecutionOptions) (*agents.ExecutionResult, error) {
+func (la *LuaAgent) executeTable(ctx context.Context, input string, options *agents.ExecutionOptions) (*agents.ExecutionResult, error) {
 	// Get the execute method
 	executeMethod := la.L.GetField(la.luaValue, "execute")
 	if executeMethod.Type() != lua.LTFunction {
 		return nil, errors.New("agent table must have an 'execute' method")
 	}
 
-	// Convert options to Lua
-	optionsLua := la.convertOptionsToLua(options)
-
 	// Call the method with self
-	err := la.L.CallByParam(lua.P{
-		Fn:      executeMethod.(*lua.LFunction),
-		NRet:    2,
-		Protect: true,
-	}, la.luaValue, lua.LString(input), optionsLua)
-
+	ret1, ret2, err := la.call(ctx, executeMethod.(*lua.LFunction), la.luaValue, lua.LString(input), la.convertOptionsToLua(options))
 	if err != nil {
 		return nil, fmt.Errorf("lua execution error: %w", err)
 	}
 
-	// Get return values
-	ret2 := la.L.Get(-1) // error (if any)
-	ret1 := la.L.Get(-2) // result
-	la.L.Pop(2)
-
 	// Check for error
 	if ret2.Type() == lua.LTString {
 		return nil, errors.New(lua.LVAsString(ret2))
@@ -180,20 +153,12 @@ func (la *LuaAgent) Stream(ctx context.Context, input string, options *agents.Ex
 	})
 
 	// Call the stream method
-	err := la.L.CallByParam(lua.P{
-		Fn:      streamMethod.(*lua.LFunction),
-		NRet:    1,
-		Protect: true,
-	}, la.luaValue, lua.LString(input), optionsLua, luaCallback)
-
+	ret, _, err := la.call(ctx, streamMethod.(*lua.LFunction), la.luaValue, lua.LString(input), optionsLua, luaCallback)
 	if err != nil {
 		return fmt.Errorf("lua stream error: %w", err)
 	}
 
 	// Check return value for error
-	ret := la.L.Get(-1)
-	la.L.Pop(1)
-
 	if ret.Type() == lua.LTString {
 		return errors.New(lua.LVAsString(ret))
 	}
@@ -223,6 +188,20 @@ func (la *LuaAgent) StreamWithHistory(ctx context.Context, messages []agents.Mes
 	return la.Stream(ctx, input, opts, callback)
 }
 
+// call calls fn through callLua, as agents run on their own goroutines,
+// and returns its first two results
+func (la *LuaAgent) call(ctx context.Context, fn *lua.LFunction, args ...lua.LValue) (ret1, ret2 lua.LValue, err error) {
+	ret1, ret2 = lua.LNil, lua.LNil
+	err = callLua(ctx, la.L, "agent "+la.name, 0, func() error {
+		if err := la.L.CallByParam(lua.P{Fn: fn, NRet: 2, Protect: true}, args...); err != nil {
+			return err
+		}
+		ret1, ret2 = la.L.Get(-2), la.L.Get(-1)
+		return nil
+	})
+	return ret1, ret2, err
+}
+
 // GetSystemPrompt returns the agent's system prompt
 func (la *LuaAgent) GetSystemPrompt() string {
 	la.mu.Lock()
@@ -1,17 +1,92 @@
 // ABOUTME: Lua-based tool implementation that properly handles function calls
-// ABOUTME: Stores Lua functions and executes them in the correct context
+// ABOUTME: callLua runs every call from Go into a script's Lua state one at a time, with panic safety and timeouts
 
 package bridges
 
 import (
 	"context"
 	"fmt"
+	"runtime"
 	"sync"
+	"time"
+	"weak"
 
+	"github.com/lexlapax/go-llmspell/pkg/engine"
 	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
 	lua "github.com/yuin/gopher-lua"
 )
 
+// stateLocks serializes the calls Go code makes into each Lua state, such
+// as an agent calling several script tools at once. Keys are weak, and an
+// entry is dropped when its state is collected.
+var stateLocks sync.Map // weak.Pointer[lua.LState] -> *sync.Mutex
+
+// stateLock returns the lock for calls into L
+func stateLock(L *lua.LState) *sync.Mutex {
+	key := weak.Make(L)
+	lock, loaded := stateLocks.LoadOrStore(key, &sync.Mutex{})
+	if !loaded {
+		runtime.AddCleanup(L, func(key weak.Pointer[lua.LState]) { stateLocks.Delete(key) }, key)
+	}
+	return lock.(*sync.Mutex)
+}
+
+// callKey keys the context of a call from Go into a Lua state to the lock
+// the calls it leads to take turns on
+type callKey struct{ L *lua.LState }
+
+// callLua runs call, which calls into L, for Go code that may run on any
+// goroutine while the script waits on the call that led to it, such as an
+// agent running a script tool. Calls take turns: a call made while another
+// waits on it, as when a tool's handler runs another script tool, takes
+// turns with the other calls that one leads to. The stack is restored
+// afterwards, a panic fails the call, and the call stops when ctx ends,
+// the script's run stops, or the timeout, if any, passes. name says what
+// was called in errors.
+func callLua(ctx context.Context, L *lua.LState, name string, timeout time.Duration, call func() error) (err error) {
+	lock := stateLock(L)
+	if inner, ok := ctx.Value(callKey{L}).(*sync.Mutex); ok {
+		lock = inner
+	}
+	lock.Lock()
+	defer lock.Unlock()
+
+	oldTop := L.GetTop()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s panicked: %v", name, r)
+		}
+		L.SetTop(oldTop)
+	}()
+
+	// The call runs under the script's context, ended early by ctx or the
+	// timeout, and the script's context is restored afterwards
+	scriptCtx := L.Context()
+	parent := scriptCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	callCtx, cancel := context.WithCancelCause(parent)
+	defer cancel(nil)
+	stop := context.AfterFunc(ctx, func() { cancel(context.Cause(ctx)) })
+	defer stop()
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		callCtx, cancelTimeout = context.WithTimeoutCause(callCtx, timeout, fmt.Errorf("%s timed out after %s", name, timeout))
+		defer cancelTimeout()
+	}
+	L.SetContext(context.WithValue(callCtx, callKey{L}, &sync.Mutex{}))
+	defer func() {
+		if scriptCtx != nil {
+			L.SetContext(scriptCtx)
+		} else {
+			L.RemoveContext()
+		}
+	}()
+
+	return engine.WrapCancel(callCtx, call())
+}
+
 // LuaTool wraps a Lua function as a tool
 type LuaTool struct {
 	name        string
@@ -20,7 +95,7 @@ type LuaTool struct {
 	fn          *lua.LFunction
 	L           *lua.LState
 	converter   *engLua.LuaConverter
-	mu          sync.Mutex
+	timeout     time.Duration
 }
 
 // NewLuaTool creates a new Lua-based tool
@@ -35,43 +110,52 @@ func NewLuaTool(name, description string, parameters map[string]interface{}, fn
 	}
 }
 
-// Execute runs the Lua tool function
-func (lt *LuaTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	lt.mu.Lock()
-	defer lt.mu.Unlock()
-
-	// Save current stack state
-	oldTop := lt.L.GetTop()
-	defer func() {
-		// Restore stack state
-		lt.L.SetTop(oldTop)
-	}()
+// SetTimeout stops calls that run longer than d; zero leaves them to the
+// caller's context and the script's
+func (lt *LuaTool) SetTimeout(d time.Duration) {
+	lt.timeout = d
+}
 
-	// Push the function and parameters
-	lt.L.Push(lt.fn)
-	lt.L.Push(lt.converter.ToLua(params))
+// Execute runs the Lua tool function through callLua, so it may be called
+// from any goroutine while the script waits on the call that led to it,
+// such as agents.execute.
+func (lt *LuaTool) Execute(ctx context.Context, params map[string]interface{}) (result interface{}, err error) {
+	var failed error
+	err = callLua(ctx, lt.L, "tool "+lt.name, lt.timeout, func() error {
+		oldTop := lt.L.GetTop()
 
-	// Call the function
-	if err := lt.L.PCall(1, lua.MultRet, nil); err != nil {
-		return nil, fmt.Errorf("tool execution failed: %w", err)
-	}
+		// Push the function and parameters
+		lt.L.Push(lt.fn)
+		lt.L.Push(lt.converter.ToLua(params))
 
-	// Get the results
-	nResults := lt.L.GetTop() - oldTop
-	if nResults == 0 {
-		return nil, nil
-	}
+		// Call the function
+		if err := lt.L.PCall(1, lua.MultRet, nil); err != nil {
+			return err
+		}
 
-	// Get the first result (from top of stack)
-	result := lt.L.Get(-nResults)
+		// Get the results
+		nResults := lt.L.GetTop() - oldTop
+		if nResults == 0 {
+			return nil
+		}
 
-	// Check if there's an error as second return value
-	if nResults >= 2 {
-		if errVal := lt.L.Get(-nResults + 1); errVal.Type() == lua.LTString {
-			return nil, fmt.Errorf("%s", errVal.String())
+		// Check if there's an error as second return value
+		if nResults >= 2 {
+			if errVal := lt.L.Get(-nResults + 1); errVal.Type() == lua.LTString {
+				failed = fmt.Errorf("%s", errVal.String())
+				return nil
+			}
 		}
-	}
 
-	// Convert result to Go value
-	return lt.converter.ToInterface(result), nil
+		// Convert the first result to a Go value
+		result = lt.converter.ToInterface(lt.L.Get(-nResults))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tool execution failed: %w", err)
+	}
+	if failed != nil {
+		return nil, failed
+	}
+	return result, nil
 }
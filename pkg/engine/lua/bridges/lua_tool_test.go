@@ -6,7 +6,9 @@ package bridges
 import (
 	"context"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
 	"github.com/stretchr/testify/assert"
@@ -444,3 +446,100 @@ func TestLuaToolComplexDataTypes(t *testing.T) {
 	assert.Equal(t, float64(1), user1["id"])
 	assert.Equal(t, "ALICE", user1["name"])
 }
+
+func TestLuaToolReentry(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	converter := engLua.NewLuaConverter(L)
+
+	require.NoError(t, L.DoString(`
+		calls = 0
+		function count(params)
+			calls = calls + 1
+			return calls
+		end
+		function spin(params)
+			while true do end
+		end
+	`))
+	count := NewLuaTool("count", "Counts calls", nil, L.GetGlobal("count").(*lua.LFunction), L, converter)
+
+	// Calls from other goroutines take turns in the state
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := count.Execute(context.Background(), nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, lua.LNumber(20), L.GetGlobal("calls"))
+
+	// A timeout or the caller's context stops the function, and the state
+	// keeps working afterwards
+	spin := NewLuaTool("spin", "Never returns", nil, L.GetGlobal("spin").(*lua.LFunction), L, converter)
+	spin.SetTimeout(50 * time.Millisecond)
+	_, err := spin.Execute(context.Background(), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tool spin timed out after 50ms")
+
+	spin.SetTimeout(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = spin.Execute(ctx, nil)
+	assert.Error(t, err)
+	assert.Nil(t, L.Context(), "The state's own context should be restored")
+
+	result, err := count.Execute(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, float64(21), result)
+
+	// A panic in Go code the function calls fails the call
+	L.SetGlobal("explode", L.NewFunction(func(*lua.LState) int { panic("boom") }))
+	require.NoError(t, L.DoString(`function boom() explode() end`))
+	boom := NewLuaTool("boom", "Panics", nil, L.GetGlobal("boom").(*lua.LFunction), L, converter)
+	_, err = boom.Execute(context.Background(), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+}
+
+func TestLuaToolNested(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	converter := engLua.NewLuaConverter(L)
+
+	require.NoError(t, L.DoString(`
+		function inner(params) return "inner" end
+		function outer(params) return "outer(" .. run_inner() .. ")" end
+	`))
+	inner := NewLuaTool("inner", "", nil, L.GetGlobal("inner").(*lua.LFunction), L, converter)
+	outer := NewLuaTool("outer", "", nil, L.GetGlobal("outer").(*lua.LFunction), L, converter)
+
+	// A tool whose handler runs another script tool, as tools.execute
+	// does, runs it rather than waiting on its own call
+	L.SetGlobal("run_inner", L.NewFunction(func(L *lua.LState) int {
+		result, err := inner.Execute(scriptContext(L), nil)
+		if err != nil {
+			L.RaiseError("%v", err)
+		}
+		L.Push(lua.LString(result.(string)))
+		return 1
+	}))
+
+	done := make(chan struct{})
+	var result interface{}
+	var err error
+	go func() {
+		defer close(done)
+		result, err = outer.Execute(context.Background(), nil)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Nested tool call deadlocked")
+	}
+	require.NoError(t, err)
+	assert.Equal(t, "outer(inner)", result)
+}
@@ -0,0 +1,145 @@
+// ABOUTME: Lua bridge for MCP servers, exposing the mcp module to scripts
+// ABOUTME: Connected servers' tools join the tools module; servers are disconnected when the spell ends
+
+package bridges
+
+import (
+	"fmt"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	"github.com/lexlapax/go-llmspell/pkg/mcp"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// RegisterMCPModule registers the mcp module in Lua. Scripts connect to
+// configured servers by name, or to servers at a URL of their own; only
+// configured servers are started as commands, so a script cannot run a
+// program. Functions return nil and an error message on failure.
+func RegisterMCPModule(L *lua.LState, mb *bridge.MCPBridge) error {
+	mod := L.NewTable()
+	converter := engLua.NewLuaConverter(L)
+	stdlib.OnCleanup(L, func() { mb.Close() })
+
+	// connect(name[, server]) registers the tools of a server, named
+	// <name>__<tool>, and returns their names. server is {url, headers};
+	// without it, the server configured as name is used.
+	L.SetField(mod, "connect", L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		var server *mcp.ServerConfig
+		if table := L.OptTable(2, nil); table != nil {
+			fields, _ := converter.ToInterface(table).(map[string]interface{})
+			if _, ok := fields["command"]; ok {
+				L.Push(lua.LNil)
+				L.Push(lua.LString("servers started by a command must be configured in ~/.llmspell/mcp.json"))
+				return 2
+			}
+			server = &mcp.ServerConfig{}
+			server.URL, _ = fields["url"].(string)
+			if headers, ok := fields["headers"].(map[string]interface{}); ok {
+				server.Headers = make(map[string]string, len(headers))
+				for key, value := range headers {
+					server.Headers[key] = fmt.Sprint(value)
+				}
+			}
+		}
+
+		names, err := mb.Connect(scriptContext(L), name, server)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		result := L.CreateTable(len(names), 0)
+		for _, name := range names {
+			result.Append(lua.LString(name))
+		}
+		L.Push(result)
+		return 1
+	}))
+
+	// disconnect(name) removes a server's tools and ends its session
+	L.SetField(mod, "disconnect", L.NewFunction(func(L *lua.LState) int {
+		if err := mb.Disconnect(L.CheckString(1)); err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(lua.LTrue)
+		return 1
+	}))
+
+	// servers() returns {name, server, version, protocol, tools} for each
+	// connected server
+	L.SetField(mod, "servers", L.NewFunction(func(L *lua.LState) int {
+		servers := mb.Servers()
+		result := L.CreateTable(len(servers), 0)
+		for _, server := range servers {
+			result.Append(converter.ToLua(server))
+		}
+		L.Push(result)
+		return 1
+	}))
+
+	// configured() lists the servers that can be connected by name
+	L.SetField(mod, "configured", L.NewFunction(func(L *lua.LState) int {
+		names := mb.Configured()
+		result := L.CreateTable(len(names), 0)
+		for _, name := range names {
+			result.Append(lua.LString(name))
+		}
+		L.Push(result)
+		return 1
+	}))
+
+	// list_resources(name) returns {uri, name, description, mime_type} for
+	// each resource of a server
+	L.SetField(mod, "list_resources", L.NewFunction(func(L *lua.LState) int {
+		resources, err := mb.ListResources(scriptContext(L), L.CheckString(1))
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		result := L.CreateTable(len(resources), 0)
+		for _, resource := range resources {
+			entry := L.NewTable()
+			L.SetField(entry, "uri", lua.LString(resource.URI))
+			L.SetField(entry, "name", lua.LString(resource.Name))
+			L.SetField(entry, "description", lua.LString(resource.Description))
+			L.SetField(entry, "mime_type", lua.LString(resource.MimeType))
+			result.Append(entry)
+		}
+		L.Push(result)
+		return 1
+	}))
+
+	// read_resource(name, uri) returns the contents of a resource, each
+	// {uri, mime_type, text} or {uri, mime_type, blob} with base64 data
+	L.SetField(mod, "read_resource", L.NewFunction(func(L *lua.LState) int {
+		contents, err := mb.ReadResource(scriptContext(L), L.CheckString(1), L.CheckString(2))
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		result := L.CreateTable(len(contents), 0)
+		for _, content := range contents {
+			entry := L.NewTable()
+			L.SetField(entry, "uri", lua.LString(content.URI))
+			L.SetField(entry, "mime_type", lua.LString(content.MimeType))
+			if content.Blob != "" {
+				L.SetField(entry, "blob", lua.LString(content.Blob))
+			} else {
+				L.SetField(entry, "text", lua.LString(content.Text))
+			}
+			result.Append(entry)
+		}
+		L.Push(result)
+		return 1
+	}))
+
+	L.SetGlobal("mcp", mod)
+	return nil
+}
@@ -0,0 +1,98 @@
+// ABOUTME: Tests for the Lua mcp bridge
+// ABOUTME: Verifies connecting to an HTTP MCP server, its tools in the tools module, resources, and refused commands
+
+package bridges
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/tools"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// notesServer is an MCP server with a tool that counts words and a note
+func notesServer(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     *int64 `json:"id"`
+		Method string `json:"method"`
+		Params struct {
+			Arguments map[string]interface{} `json:"arguments"`
+		} `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.ID == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	var result interface{}
+	switch req.Method {
+	case "initialize":
+		result = map[string]interface{}{"protocolVersion": "2025-03-26", "serverInfo": map[string]interface{}{"name": "notes", "version": "1.0"}}
+	case "tools/list":
+		result = map[string]interface{}{"tools": []interface{}{
+			map[string]interface{}{"name": "count", "description": "Count words", "inputSchema": map[string]interface{}{"type": "object"}},
+		}}
+	case "tools/call":
+		text, _ := req.Params.Arguments["text"].(string)
+		result = map[string]interface{}{"content": []interface{}{map[string]interface{}{"type": "text", "text": "2 words in " + text}}}
+	case "resources/list":
+		result = map[string]interface{}{"resources": []interface{}{map[string]interface{}{"uri": "notes://today", "name": "today", "mimeType": "text/plain"}}}
+	case "resources/read":
+		result = map[string]interface{}{"contents": []interface{}{map[string]interface{}{"uri": "notes://today", "text": "buy milk"}}}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+}
+
+func TestMCPBridge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		notesServer(w, r)
+	}))
+	defer server.Close()
+
+	tb := bridge.NewToolBridge(tools.NewRegistry())
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterToolsModule(L, tb))
+	require.NoError(t, RegisterMCPModule(L, bridge.NewMCPBridge(tb, bridge.MCPConfig{})))
+	L.SetGlobal("url", lua.LString(server.URL))
+
+	err := L.DoString(`
+		local names = mcp.connect("notes", {url = url, headers = {Authorization = "Bearer secret"}})
+		assert(#names == 1 and names[1] == "notes__count")
+
+		local listed = tools.list()
+		assert(#listed == 1 and listed[1].source == "mcp:notes" and listed[1].category == "mcp")
+		assert(tools.execute("notes__count", {text = "hello world"}) == "2 words in hello world")
+
+		local servers = mcp.servers()
+		assert(#servers == 1 and servers[1].name == "notes" and servers[1].server == "notes" and servers[1].tools[1] == "notes__count")
+		assert(#mcp.configured() == 0)
+
+		local resources = mcp.list_resources("notes")
+		assert(resources[1].uri == "notes://today" and resources[1].mime_type == "text/plain")
+		local contents = mcp.read_resource("notes", "notes://today")
+		assert(contents[1].text == "buy milk")
+
+		local names, err = mcp.connect("other", {url = url})
+		assert(names == nil and err:find("401"))
+		local names, err = mcp.connect("local", {command = "rm", args = {"-rf", "/"}})
+		assert(names == nil and err:find("must be configured"))
+		local names, err = mcp.connect("missing")
+		assert(names == nil and err:find("no MCP server"))
+
+		assert(mcp.disconnect("notes") == true)
+		assert(#tools.list() == 0)
+		local ok, err = mcp.disconnect("notes")
+		assert(ok == nil and err:find("not connected"))
+	`)
+	require.NoError(t, err)
+}
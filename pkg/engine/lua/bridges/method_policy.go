@@ -0,0 +1,137 @@
+// ABOUTME: Enforces security method policies, rate limits, and call budgets on Lua bridge modules
+// ABOUTME: Replaces denied functions with stubs and wraps rate-limited or budgeted ones with a check
+
+package bridges
+
+import (
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ApplyMethodPolicy enforces a method policy on the Lua module registered as
+// the global named module (e.g. "tools"). Functions the policy denies are
+// replaced so that calling them returns nil plus a permission error instead
+// of reaching the bridge. Modules that are not registered are skipped.
+func ApplyMethodPolicy(L *lua.LState, module string, policy *security.MethodPolicy) {
+	mod, ok := L.GetGlobal(module).(*lua.LTable)
+	if !ok || policy == nil {
+		return
+	}
+
+	var denied []string
+	mod.ForEach(func(key, value lua.LValue) {
+		name, isString := key.(lua.LString)
+		if _, isFunction := value.(*lua.LFunction); isString && isFunction && !policy.Allows(module, string(name)) {
+			denied = append(denied, string(name))
+		}
+	})
+
+	for _, name := range denied {
+		L.SetField(mod, name, L.NewFunction(deniedMethod(policy.Check(module, name))))
+	}
+}
+
+// deniedMethod creates a Lua function that always fails with err
+func deniedMethod(err error) lua.LGFunction {
+	return func(L *lua.LState) int {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+}
+
+// ApplyRateLimits wraps the functions of the Lua module registered as the
+// global named module so that each call is first checked against the
+// limiter. Calls over a limit return nil plus a rate-limit error without
+// reaching the bridge. Functions no limit applies to are left untouched.
+func ApplyRateLimits(L *lua.LState, module string, limiter *security.RateLimiter) {
+	mod, ok := L.GetGlobal(module).(*lua.LTable)
+	if !ok || limiter == nil {
+		return
+	}
+
+	limited := make(map[string]*lua.LFunction)
+	mod.ForEach(func(key, value lua.LValue) {
+		name, isString := key.(lua.LString)
+		fn, isFunction := value.(*lua.LFunction)
+		if isString && isFunction && fn.IsG && limiter.Limits(module, string(name)) {
+			limited[string(name)] = fn
+		}
+	})
+
+	for name, fn := range limited {
+		L.SetField(mod, name, L.NewFunction(rateLimited(limiter, module, name, fn.GFunction)))
+	}
+}
+
+// rateLimited checks the limiter before calling fn with the same arguments
+func rateLimited(limiter *security.RateLimiter, module, name string, fn lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		if err := limiter.Allow(module, name); err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		return fn(L)
+	}
+}
+
+// ApplyCallBudget wraps the functions of the Lua module registered as the
+// global named module that draw on budget. The call that would go over
+// budget returns nil plus a budget error, and the run is cancelled so the
+// spell stops.
+func ApplyCallBudget(L *lua.LState, module string, budget *bridge.CallBudget) {
+	mod, ok := L.GetGlobal(module).(*lua.LTable)
+	if !ok || budget == nil {
+		return
+	}
+
+	budgeted := make(map[string]*lua.LFunction)
+	mod.ForEach(func(key, value lua.LValue) {
+		name, isString := key.(lua.LString)
+		fn, isFunction := value.(*lua.LFunction)
+		if isString && isFunction && fn.IsG && budget.Counts(module+"."+string(name)) {
+			budgeted[string(name)] = fn
+		}
+	})
+
+	for name, fn := range budgeted {
+		L.SetField(mod, name, L.NewFunction(withinBudget(budget, module+"."+name, fn.GFunction)))
+	}
+}
+
+// withinBudget spends the calls fn makes from the budget before calling it
+func withinBudget(budget *bridge.CallBudget, method string, fn lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		if err := budget.SpendN(method, bridge.CallCost(method, luaCallArgs{L})); err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		return fn(L)
+	}
+}
+
+// luaCallArgs are the arguments of a Lua call, as bridge.CallCost reads them
+type luaCallArgs struct {
+	L *lua.LState
+}
+
+// Len returns the length of argument i, if it is a table
+func (a luaCallArgs) Len(i int) (int, bool) {
+	if table, ok := a.L.Get(i + 1).(*lua.LTable); ok {
+		return table.Len(), true
+	}
+	return 0, false
+}
+
+// Number returns field of argument i, if it is a table holding a number there
+func (a luaCallArgs) Number(i int, field string) (float64, bool) {
+	if table, ok := a.L.Get(i + 1).(*lua.LTable); ok {
+		if n, ok := table.RawGetString(field).(lua.LNumber); ok {
+			return float64(n), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,157 @@
+// ABOUTME: Tests for enforcing method policies, rate limits, and call budgets on Lua bridge modules
+// ABOUTME: Verifies denied, over-limit, or over-budget calls fail before reaching the bridge
+
+package bridges
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestApplyMethodPolicy(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+	mockBridge.tools["echo"] = &mockToolInfo{
+		name: "echo",
+		handler: func(p map[string]interface{}) (interface{}, error) {
+			return "ok", nil
+		},
+	}
+
+	profile, err := security.LookupProfile("strict")
+	require.NoError(t, err)
+	ApplyMethodPolicy(L, "tools", &profile.Methods)
+	// Modules that are not registered are left alone
+	ApplyMethodPolicy(L, "agents", &profile.Methods)
+
+	err = L.DoString(`
+		local result, err = tools.execute("echo", {})
+		assert(result == nil, "Denied method should not run")
+		assert(err:find("permission denied: tools.execute"), "Should report a permission error: " .. tostring(err))
+
+		local list = tools.list()
+		assert(#list == 1, "Allowed method should still work")
+	`)
+	require.NoError(t, err)
+	assert.Empty(t, mockBridge.lastExecutedTool)
+}
+
+func TestApplyRateLimits(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+	calls := 0
+	mockBridge.tools["echo"] = &mockToolInfo{
+		name: "echo",
+		handler: func(p map[string]interface{}) (interface{}, error) {
+			calls++
+			return p["text"], nil
+		},
+	}
+
+	limiter := security.NewRateLimiter([]security.RateLimit{
+		{Method: "tools.execute", Calls: 2, Per: time.Minute},
+	})
+	ApplyRateLimits(L, "tools", limiter)
+
+	err := L.DoString(`
+		for i = 1, 2 do
+			local result, err = tools.execute("echo", {text = "hi"})
+			assert(result == "hi" and err == nil, "Calls within the limit should pass arguments through")
+		end
+
+		local result, err = tools.execute("echo", {text = "hi"})
+		assert(result == nil, "Call over the limit should not run")
+		assert(err:find("rate limit exceeded: tools.execute allows 2 calls"), "Should report a rate-limit error: " .. tostring(err))
+
+		for i = 1, 5 do
+			assert(#tools.list() == 1, "Unlimited methods should keep working")
+		end
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestApplyCallBudget(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+	calls := 0
+	mockBridge.tools["echo"] = &mockToolInfo{
+		name: "echo",
+		handler: func(p map[string]interface{}) (interface{}, error) {
+			calls++
+			return "ok", nil
+		},
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	budget := bridge.NewCallBudget(1, func(method string) bool { return method == "tools.execute" }, cancel)
+	ApplyCallBudget(L, "tools", budget)
+
+	err := L.DoString(`
+		assert(tools.execute("echo", {}) == "ok", "The first call is within budget")
+		local result, err = tools.execute("echo", {})
+		assert(result == nil, "The call over budget should not run")
+		assert(err:find("spell budget exhausted: tools.execute"), "Should report the budget: " .. tostring(err))
+		assert(#tools.list() == 1, "Methods outside the budget should keep working")
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.True(t, errors.Is(context.Cause(ctx), engine.ErrBudgetExhausted))
+}
+
+func TestApplyCallBudgetBatch(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	require.NoError(t, NewLLMBridge(mockBridge).Register(L))
+	_, cancel := context.WithCancelCause(context.Background())
+	budget := bridge.NewCallBudget(3, func(method string) bool { return method == "llm.batch" }, cancel)
+	ApplyCallBudget(L, "llm", budget)
+
+	err := L.DoString(`
+		assert(llm.batch({"a", "b"}), "Two prompts fit the budget")
+		local results, err = llm.batch({"c", "d"})
+		assert(results == nil and err:find("spell budget exhausted"), "Each prompt counts: " .. tostring(err))
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, 2, budget.Used())
+}
+
+func TestApplyCallBudgetStructured(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockLLMBridge()
+	require.NoError(t, NewLLMBridge(mockBridge).Register(L))
+	_, cancel := context.WithCancelCause(context.Background())
+	budget := bridge.NewCallBudget(4, func(method string) bool { return method == "llm.generate_structured" }, cancel)
+	ApplyCallBudget(L, "llm", budget)
+
+	err := L.DoString(`
+		assert(llm.generate_structured("a", {type = "object"}), "Three attempts fit the budget")
+		assert(llm.generate_structured("b", {type = "object"}, {retries = 0}), "So does one more")
+		local value, err = llm.generate_structured("c", {type = "object"}, {retries = 0})
+		assert(value == nil and err:find("spell budget exhausted"), "Each attempt counts: " .. tostring(err))
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, 4, budget.Used())
+}
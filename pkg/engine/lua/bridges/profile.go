@@ -0,0 +1,41 @@
+// ABOUTME: Times calls to Lua bridge module functions for the spell profiler
+// ABOUTME: Wraps module functions so each call begins and ends a profiler frame
+
+package bridges
+
+import (
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ApplyProfile wraps every Go function of the Lua module registered as the
+// global named module so that each call is timed by p as
+// "module.function". A nil profiler leaves the module as it is.
+func ApplyProfile(L *lua.LState, module string, p *bridge.Profiler) {
+	mod, ok := L.GetGlobal(module).(*lua.LTable)
+	if !ok || p == nil {
+		return
+	}
+
+	profiled := make(map[string]*lua.LFunction)
+	mod.ForEach(func(key, value lua.LValue) {
+		name, isString := key.(lua.LString)
+		if fn, isFunction := value.(*lua.LFunction); isString && isFunction && fn.IsG {
+			profiled[string(name)] = fn
+		}
+	})
+
+	for name, fn := range profiled {
+		L.SetField(mod, name, L.NewFunction(profileCalls(p, module+"."+name, fn.GFunction)))
+	}
+}
+
+// profileCalls times each call to fn under name
+func profileCalls(p *bridge.Profiler, name string, fn lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		p.Begin(name)
+		// Raised errors unwind through here too
+		defer p.End()
+		return fn(L)
+	}
+}
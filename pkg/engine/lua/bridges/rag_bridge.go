@@ -0,0 +1,196 @@
+// ABOUTME: Lua bridge for retrieval-augmented generation, exposing the rag module to scripts
+// ABOUTME: Provides chunk, index, index_dir, and ask; answers come from the script's llm.chat with citations
+
+package bridges
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// RegisterRAGModule registers the rag module in Lua, keeping chunks in
+// store. Questions are answered by calling the script's llm.chat, so the
+// mock LLM, method policies, and the call budget apply as they do to the
+// script's own calls. checkPath resolves the directories index_dir may
+// read, and the files in them, and refuses the others. Functions return
+// nil and an error message on failure.
+func RegisterRAGModule(L *lua.LState, store *bridge.VectorStoreBridge, checkPath func(string) (string, error)) error {
+	mod := L.NewTable()
+	converter := engLua.NewLuaConverter(L)
+	rb := bridge.NewRAGBridge(store, func(ctx context.Context, prompt string) (string, error) {
+		return scriptChat(L, prompt)
+	})
+
+	// chunk(text[, options]) splits text into {index, text, start_line,
+	// end_line, tokens} chunks of options.max_tokens (256) estimated tokens
+	L.SetField(mod, "chunk", L.NewFunction(func(L *lua.LState) int {
+		text := L.CheckString(1)
+		opts := luaIndexOptions(converter, L.OptTable(2, nil))
+		chunks := bridge.ChunkText(text, opts.Chunk)
+		result := L.CreateTable(len(chunks), 0)
+		for _, chunk := range chunks {
+			entry := L.NewTable()
+			L.SetField(entry, "index", lua.LNumber(chunk.Index))
+			L.SetField(entry, "text", lua.LString(chunk.Text))
+			L.SetField(entry, "start_line", lua.LNumber(chunk.StartLine))
+			L.SetField(entry, "end_line", lua.LNumber(chunk.EndLine))
+			L.SetField(entry, "tokens", lua.LNumber(chunk.Tokens))
+			result.Append(entry)
+		}
+		L.Push(result)
+		return 1
+	}))
+
+	// index(source, text[, options]) chunks and stores text, returning the
+	// number of chunks
+	L.SetField(mod, "index", L.NewFunction(func(L *lua.LState) int {
+		source := L.CheckString(1)
+		text := L.CheckString(2)
+		options := L.OptTable(3, nil)
+		n, err := rb.Index(scriptContext(L), ragNamespace(options), source, text, luaIndexOptions(converter, options))
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(lua.LNumber(n))
+		return 1
+	}))
+
+	// index_dir(dir[, options]) indexes the text files under dir, returning
+	// {files, chunks, skipped}
+	L.SetField(mod, "index_dir", L.NewFunction(func(L *lua.LState) int {
+		dir := L.CheckString(1)
+		options := L.OptTable(2, nil)
+		resolved, err := checkPath(dir)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		opts := luaIndexOptions(converter, options)
+		opts.CheckPath = checkPath
+		stats, err := rb.IndexDir(scriptContext(L), ragNamespace(options), resolved, opts)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		result := L.NewTable()
+		L.SetField(result, "files", lua.LNumber(stats.Files))
+		L.SetField(result, "chunks", lua.LNumber(stats.Chunks))
+		L.SetField(result, "skipped", lua.LNumber(stats.Skipped))
+		L.Push(result)
+		return 1
+	}))
+
+	// ask(question[, options]) returns {answer, citations}; each citation
+	// has number, source, chunk, start_line, end_line, score, text, and
+	// cited, which is true when the answer refers to it
+	L.SetField(mod, "ask", L.NewFunction(func(L *lua.LState) int {
+		question := L.CheckString(1)
+		options := L.OptTable(2, nil)
+		var opts bridge.AskOptions
+		if options != nil {
+			fields, _ := converter.ToInterface(options).(map[string]interface{})
+			if topK, ok := fields["top_k"].(float64); ok {
+				opts.TopK = int(topK)
+			}
+			opts.MinScore, _ = fields["min_score"].(float64)
+			opts.Filter, _ = fields["filter"].(map[string]interface{})
+		}
+
+		answer, err := rb.Ask(scriptContext(L), ragNamespace(options), question, opts)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		result := L.NewTable()
+		L.SetField(result, "answer", lua.LString(answer.Text))
+		citations := L.CreateTable(len(answer.Citations), 0)
+		for _, citation := range answer.Citations {
+			entry := L.NewTable()
+			L.SetField(entry, "number", lua.LNumber(citation.Number))
+			L.SetField(entry, "source", lua.LString(citation.Source))
+			L.SetField(entry, "chunk", lua.LNumber(citation.Chunk))
+			L.SetField(entry, "start_line", lua.LNumber(citation.StartLine))
+			L.SetField(entry, "end_line", lua.LNumber(citation.EndLine))
+			L.SetField(entry, "score", lua.LNumber(citation.Score))
+			L.SetField(entry, "text", lua.LString(citation.Text))
+			L.SetField(entry, "cited", lua.LBool(citation.Cited))
+			citations.Append(entry)
+		}
+		L.SetField(result, "citations", citations)
+		L.Push(result)
+		return 1
+	}))
+
+	L.SetGlobal("rag", mod)
+	return nil
+}
+
+// ragNamespace reads the namespace of options, or the default
+func ragNamespace(options *lua.LTable) string {
+	if options != nil {
+		if namespace, ok := options.RawGetString("namespace").(lua.LString); ok {
+			return string(namespace)
+		}
+	}
+	return bridge.DefaultRAGNamespace
+}
+
+// luaIndexOptions reads max_tokens, overlap, extensions, and metadata
+func luaIndexOptions(converter *engLua.LuaConverter, options *lua.LTable) bridge.IndexOptions {
+	var opts bridge.IndexOptions
+	if options == nil {
+		return opts
+	}
+	fields, _ := converter.ToInterface(options).(map[string]interface{})
+	if maxTokens, ok := fields["max_tokens"].(float64); ok {
+		opts.Chunk.MaxTokens = int(maxTokens)
+	}
+	if overlap, ok := fields["overlap"].(float64); ok {
+		opts.Chunk.Overlap = int(overlap)
+		if overlap == 0 {
+			opts.Chunk.Overlap = -1
+		}
+	}
+	if extensions, ok := fields["extensions"].([]interface{}); ok {
+		for _, extension := range extensions {
+			if extension, ok := extension.(string); ok {
+				opts.Extensions = append(opts.Extensions, extension)
+			}
+		}
+	}
+	opts.Metadata, _ = fields["metadata"].(map[string]interface{})
+	return opts
+}
+
+// scriptChat sends prompt through the script's llm.chat
+func scriptChat(L *lua.LState, prompt string) (string, error) {
+	llm, ok := L.GetGlobal("llm").(*lua.LTable)
+	if !ok {
+		return "", fmt.Errorf("no llm module to answer with")
+	}
+	chat := L.GetField(llm, "chat")
+	if chat.Type() != lua.LTFunction {
+		return "", fmt.Errorf("no llm.chat to answer with")
+	}
+	if err := L.CallByParam(lua.P{Fn: chat, NRet: 2, Protect: true}, lua.LString(prompt)); err != nil {
+		return "", err
+	}
+	response, errValue := L.Get(-2), L.Get(-1)
+	L.Pop(2)
+	if text, ok := response.(lua.LString); ok {
+		return string(text), nil
+	}
+	if errValue != lua.LNil {
+		return "", fmt.Errorf("%s", L.ToStringMeta(errValue))
+	}
+	return "", fmt.Errorf("llm.chat returned no answer")
+}
@@ -0,0 +1,74 @@
+// ABOUTME: Tests for the Lua rag bridge
+// ABOUTME: Verifies chunking, indexing texts and directories, and answers with citations through a script's llm.chat
+
+package bridges
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestRAGBridge(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pets.md"), []byte("cat"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.md"), []byte("cat secrets"), 0644))
+	// checkPath allows dir, also named as the root "pets:", but not secret.md
+	checkPath := func(path string) (string, error) {
+		if path == "pets:" {
+			return dir, nil
+		}
+		if path != dir && filepath.Dir(path) != dir || filepath.Base(path) == "secret.md" {
+			return "", fmt.Errorf("access denied: %s is outside the allowed paths", path)
+		}
+		return path, nil
+	}
+
+	eb := &bridge.EmbeddingsBridge{}
+	eb.SetEmbedder("words", wordEmbedder{})
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterRAGModule(L, bridge.NewVectorStoreBridge(bridge.NewMemoryVectorStore(), eb.EmbedBatch), checkPath))
+	L.SetGlobal("dir", lua.LString(dir))
+
+	err := L.DoString(`
+		local chunks = rag.chunk("one\n\ntwo", {max_tokens = 1, overlap = 0})
+		assert(#chunks == 2 and chunks[2].text == "two" and chunks[2].start_line == 3 and chunks[2].tokens == 1)
+
+		assert(rag.index("dog.txt", "dog", {namespace = "pets", metadata = {kind = "canine"}}) == 1)
+		local stats = rag.index_dir(dir, {namespace = "pets"})
+		assert(stats.files == 1 and stats.chunks == 1 and stats.skipped == 0)
+		local stats = rag.index_dir("pets:", {namespace = "pets"})
+		assert(stats.files == 1, "Expected a named root to index the directory it resolves to")
+		local stats, err = rag.index_dir("/etc")
+		assert(stats == nil and err:find("access denied"))
+
+		local prompts = {}
+		llm = {chat = function(prompt)
+			table.insert(prompts, prompt)
+			return "Cats purr [1]."
+		end}
+		local result = rag.ask("cat", {namespace = "pets", top_k = 1})
+		assert(result.answer == "Cats purr [1].")
+		assert(#result.citations == 1)
+		local citation = result.citations[1]
+		assert(citation.number == 1 and citation.source == dir .. "/pets.md" and citation.cited)
+		assert(citation.chunk == 1 and citation.start_line == 1 and citation.end_line == 1 and citation.score == 1)
+		assert(prompts[1]:find("Question: cat", 1, true))
+
+		local result = rag.ask("cat", {namespace = "pets", filter = {kind = "canine"}})
+		assert(#result.citations == 1 and result.citations[1].source == "dog.txt")
+
+		llm = {chat = function() return nil, "over budget" end}
+		local result, err = rag.ask("cat", {namespace = "pets"})
+		assert(result == nil and err == "over budget")
+		local result, err = rag.ask("cat")
+		assert(result == nil and err:find("nothing indexed"))
+	`)
+	require.NoError(t, err)
+}
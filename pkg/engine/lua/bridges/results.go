@@ -0,0 +1,54 @@
+// ABOUTME: Result variants of bridge methods, under each module's try table
+// ABOUTME: llm.try.chat(prompt) returns one {ok, value, error} table instead of value and error
+
+package bridges
+
+import (
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// errorFirstMethods return only an error message, or nothing on success,
+// rather than a value and an error
+var errorFirstMethods = map[string]bool{
+	"llm.stream_chat":  true,
+	"llm.set_provider": true,
+	"llm.set_model":    true,
+}
+
+// ApplyResults adds a try table to the Lua module registered as the global
+// named module, holding a variant of each of its Go functions that returns
+// a result table: try.chat(prompt) returns {ok = true, value = response}
+// or {ok = false, error = message}. Return values after the error, such as
+// the position of a broken stream, are dropped. Call it after the other
+// wrappers, so the variants share their policies, limits, and stats.
+func ApplyResults(L *lua.LState, module string) {
+	mod, ok := L.GetGlobal(module).(*lua.LTable)
+	if !ok {
+		return
+	}
+
+	try := L.NewTable()
+	mod.ForEach(func(key, value lua.LValue) {
+		name, isString := key.(lua.LString)
+		if fn, isFunction := value.(*lua.LFunction); isString && isFunction && fn.IsG {
+			errorFirst := errorFirstMethods[module+"."+string(name)]
+			try.RawSetString(string(name), L.NewFunction(resultMethod(fn.GFunction, errorFirst)))
+		}
+	})
+	L.SetField(mod, "try", try)
+}
+
+// resultMethod calls fn and replaces what it returns with a result table
+func resultMethod(fn lua.LGFunction, errorFirst bool) lua.LGFunction {
+	return func(L *lua.LState) int {
+		n := fn(L)
+		values := make([]lua.LValue, n)
+		for i := 0; i < n; i++ {
+			values[i] = L.Get(-n + i)
+		}
+		L.Pop(n)
+		L.Push(stdlib.ResultFromReturns(L, values, errorFirst))
+		return 1
+	}
+}
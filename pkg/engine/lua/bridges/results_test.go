@@ -0,0 +1,49 @@
+// ABOUTME: Tests for the result variants of Lua bridge module functions
+// ABOUTME: Verifies value-and-error and error-only returns become result tables
+
+package bridges
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestApplyResults(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	stdlib.RegisterResult(L)
+
+	mockBridge := newMockLLMBridge()
+	require.NoError(t, NewLLMBridge(mockBridge).Register(L))
+	ApplyResults(L, "llm")
+
+	err := L.DoString(`
+		local r = llm.try.chat("Hello")
+		assert(r.ok and r:is_ok(), "Chat should succeed")
+		assert(r:unwrap() == "Response to: Hello", "Value should be the response")
+
+		local set = llm.try.set_provider("anthropic")
+		assert(set.ok and set.value == nil, "Switching provider should succeed")
+
+		-- The plain functions are unchanged
+		assert(llm.chat("Hello") == "Response to: Hello")
+	`)
+	require.NoError(t, err)
+
+	mockBridge.chatError = errors.New("chat failed")
+	mockBridge.setProviderError = errors.New("unknown provider")
+	err = L.DoString(`
+		local r = llm.try.chat("Hello")
+		assert(not r.ok and r.error == "chat failed", "Chat should fail")
+		assert(r:unwrap_or("fallback") == "fallback")
+		assert(not pcall(r.unwrap, r), "Unwrapping a failure should raise its error")
+
+		local set = llm.try.set_provider("nope")
+		assert(not set.ok and set.error == "unknown provider", "Error-only returns should fail")
+	`)
+	require.NoError(t, err)
+}
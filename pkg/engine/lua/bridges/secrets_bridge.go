@@ -0,0 +1,83 @@
+// ABOUTME: Lua bridge for secrets, exposing the secrets module to scripts
+// ABOUTME: secrets.get returns an opaque handle that http headers and llm.set_api_key accept; scripts never see the value
+
+package bridges
+
+import (
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// secretTypeName is the Lua type name of secret handles
+const secretTypeName = "secrets.handle"
+
+// RegisterSecretsModule registers the secrets module in Lua. Functions and
+// methods return nil and an error message on failure.
+func RegisterSecretsModule(L *lua.LState, secrets *bridge.SecretsBridge) error {
+	mod := L.NewTable()
+
+	methods := map[string]lua.LGFunction{
+		// handle:name() returns the secret's name
+		"name": func(L *lua.LState) int {
+			L.Push(lua.LString(checkSecret(L, 1).Name()))
+			return 1
+		},
+		// handle:format(template) returns a handle to the secret placed in
+		// template at its %s, such as "Bearer %s"
+		"format": func(L *lua.LState) int {
+			formatted, err := checkSecret(L, 1).Format(L.CheckString(2))
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			pushUserData(L, formatted, secretTypeName)
+			return 1
+		},
+	}
+	meta := L.NewTypeMetatable(secretTypeName)
+	L.SetField(meta, "__index", L.SetFuncs(L.NewTable(), methods))
+	L.SetField(meta, "__tostring", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(checkSecret(L, 1).String()))
+		return 1
+	}))
+	// Handles of the same secret are equal, whatever their templates
+	L.SetField(meta, "__eq", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LBool(checkSecret(L, 1).Name() == checkSecret(L, 2).Name()))
+		return 1
+	}))
+
+	// get(name) returns a handle to a secret the operator configured
+	L.SetField(mod, "get", L.NewFunction(func(L *lua.LState) int {
+		handle, err := secrets.Handle(scriptContext(L), L.CheckString(1))
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(scriptError(L, err))
+			return 2
+		}
+		pushUserData(L, handle, secretTypeName)
+		return 1
+	}))
+
+	// list() returns the names of the configured secrets
+	L.SetField(mod, "list", L.NewFunction(func(L *lua.LState) int {
+		names := L.NewTable()
+		for _, name := range secrets.Names() {
+			names.Append(lua.LString(name))
+		}
+		L.Push(names)
+		return 1
+	}))
+
+	L.SetGlobal("secrets", mod)
+	return nil
+}
+
+// checkSecret returns the secret handle at stack position n
+func checkSecret(L *lua.LState, n int) *bridge.SecretHandle {
+	handle, ok := L.CheckUserData(n).Value.(*bridge.SecretHandle)
+	if !ok {
+		L.ArgError(n, "secret expected")
+	}
+	return handle
+}
@@ -0,0 +1,52 @@
+// ABOUTME: Tests for the Lua secrets module
+// ABOUTME: Verifies handles hide their values and report secrets that cannot be found
+
+package bridges
+
+import (
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestSecretsModule(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	t.Setenv("TEST_SECRETS_TOKEN", "s3cret")
+	require.NoError(t, RegisterSecretsModule(L, bridge.NewSecretsBridge(bridge.SecretsConfig{Secrets: map[string]bridge.Secret{
+		"github": {Value: "env:TEST_SECRETS_TOKEN", Hosts: []string{"api.github.com"}},
+		"unset":  {Value: "env:TEST_SECRETS_UNSET"},
+	}})))
+
+	err := L.DoString(`
+		local names = secrets.list()
+		assert(#names == 2 and names[1] == "github" and names[2] == "unset")
+
+		local token = assert(secrets.get("github"))
+		assert(token:name() == "github")
+		assert(tostring(token) == "secret(github)")
+		assert(type(token) == "userdata")
+		assert(not pcall(function() return "Bearer " .. token end), "Handles cannot be concatenated")
+
+		local bearer = assert(token:format("Bearer %s"))
+		assert(tostring(bearer) == "secret(github)" and bearer == token)
+		local ok, err = token:format("Bearer")
+		assert(ok == nil and err:find("%%s"), err)
+
+		ok, err = secrets.get("unset")
+		assert(ok == nil and err:find("TEST_SECRETS_UNSET is not set"), err)
+		ok, err = secrets.get("nope")
+		assert(ok == nil and err:find('no secret "nope"'), err)
+	`)
+	require.NoError(t, err)
+
+	require.NoError(t, L.DoString(`handle = secrets.get("github")`))
+	ud, ok := L.GetGlobal("handle").(*lua.LUserData)
+	require.True(t, ok)
+	value, err := ud.Value.(*bridge.SecretHandle).Reveal("api.github.com")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", value)
+}
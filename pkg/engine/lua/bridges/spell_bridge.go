@@ -0,0 +1,160 @@
+// ABOUTME: Lua bridge for running sub-spells and code snippets from a spell
+// ABOUTME: Exposes spell.run, eval, cache_stats, traceparent, and depth to Lua scripts
+
+package bridges
+
+import (
+	"context"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// SpellBridgeInterface defines the methods needed by the Lua spell bridge
+type SpellBridgeInterface interface {
+	// Run runs the spell at path and returns its result
+	Run(ctx context.Context, path string, params map[string]interface{}, opts bridge.SpellRunOptions) (interface{}, error)
+
+	// Eval runs code in a fresh engine and returns its result
+	Eval(ctx context.Context, code, engineName string, params map[string]interface{}, opts bridge.SpellRunOptions) (interface{}, error)
+
+	// CacheStats returns the usage counts of the result cache
+	CacheStats() map[string]bridge.CacheStats
+
+	// Depth returns how deeply the current spell is nested
+	Depth() int
+
+	// MaxDepth returns the nesting limit
+	MaxDepth() int
+
+	// Trace returns the span of the current spell
+	Trace() bridge.TraceContext
+}
+
+// RegisterSpellModule registers the spell module in Lua
+func RegisterSpellModule(L *lua.LState, spellBridge SpellBridgeInterface) error {
+	spellMod := L.NewTable()
+	converter := engLua.NewLuaConverter(L)
+
+	L.SetField(spellMod, "run", L.NewFunction(spellRun(spellBridge, converter)))
+	L.SetField(spellMod, "eval", L.NewFunction(spellEval(spellBridge, converter)))
+	L.SetField(spellMod, "cache_stats", L.NewFunction(spellCacheStats(spellBridge, converter)))
+	L.SetField(spellMod, "traceparent", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(spellBridge.Trace().Traceparent()))
+		return 1
+	}))
+	L.SetField(spellMod, "depth", L.NewFunction(spellDepth(spellBridge)))
+	L.SetField(spellMod, "on_exit", L.NewFunction(spellOnExit(L)))
+
+	L.SetGlobal("spell", spellMod)
+	return nil
+}
+
+// spellRun creates a Lua function for running a sub-spell
+func spellRun(sb SpellBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		path := L.CheckString(1)
+		params := optParams(L, 2, converter)
+
+		result, err := sb.Run(scriptContext(L), path, params, spellRunOptions(L, 3))
+		return pushSpellResult(L, converter, result, err)
+	}
+}
+
+// spellEval creates a Lua function for running a code snippet
+func spellEval(sb SpellBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		code := L.CheckString(1)
+		engineName := L.OptString(2, "lua")
+		params := optParams(L, 3, converter)
+
+		result, err := sb.Eval(scriptContext(L), code, engineName, params, spellRunOptions(L, 4))
+		return pushSpellResult(L, converter, result, err)
+	}
+}
+
+// spellCacheStats creates a Lua function returning cache hits and misses
+// by kind, e.g. stats.spell.hits
+func spellCacheStats(sb SpellBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		stats := make(map[string]interface{})
+		for kind, s := range sb.CacheStats() {
+			stats[kind] = map[string]interface{}{
+				"hits":     s.Hits,
+				"misses":   s.Misses,
+				"bypassed": s.Bypassed,
+			}
+		}
+		L.Push(converter.ToLua(stats))
+		return 1
+	}
+}
+
+// spellRunOptions reads an optional options table at the given stack
+// position: cache = false skips cached results, and state is false for
+// isolated state, the ID of a state to attach to, or a table with keys,
+// read_only, and id
+func spellRunOptions(L *lua.LState, n int) bridge.SpellRunOptions {
+	var opts bridge.SpellRunOptions
+	options, ok := L.Get(n).(*lua.LTable)
+	if !ok {
+		return opts
+	}
+	opts.NoCache = options.RawGetString("cache") == lua.LFalse
+
+	switch state := options.RawGetString("state").(type) {
+	case lua.LBool:
+		opts.State.Isolated = !bool(state)
+	case lua.LString:
+		opts.StateID = string(state)
+	case *lua.LTable:
+		if keys, ok := state.RawGetString("keys").(*lua.LTable); ok {
+			keys.ForEach(func(_, key lua.LValue) {
+				opts.State.Keys = append(opts.State.Keys, key.String())
+			})
+		}
+		opts.State.ReadOnly = lua.LVAsBool(state.RawGetString("read_only"))
+		if id, ok := state.RawGetString("id").(lua.LString); ok {
+			opts.StateID = string(id)
+		}
+	}
+	return opts
+}
+
+// spellDepth creates a Lua function returning the nesting depth and limit
+func spellDepth(sb SpellBridgeInterface) lua.LGFunction {
+	return func(L *lua.LState) int {
+		L.Push(lua.LNumber(sb.Depth()))
+		L.Push(lua.LNumber(sb.MaxDepth()))
+		return 2
+	}
+}
+
+// scriptContext returns the running script's context, so stopping the
+// script also stops the calls it makes, and they join its trace
+func scriptContext(L *lua.LState) context.Context {
+	if ctx := L.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// scriptError is the message a bridge call returns to the script for err.
+// A call that failed because the script was cancelled says why, such as
+// "spell interrupted" or "spell budget exhausted".
+func scriptError(L *lua.LState, err error) lua.LString {
+	return lua.LString(engine.WrapCancel(scriptContext(L), err).Error())
+}
+
+// pushSpellResult pushes a sub-spell's result, or nil and the error
+func pushSpellResult(L *lua.LState, converter *engLua.LuaConverter, result interface{}, err error) int {
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(scriptError(L, err))
+		return 2
+	}
+	L.Push(converter.ToLua(result))
+	return 1
+}
@@ -0,0 +1,99 @@
+// ABOUTME: Tests for the Lua spell bridge
+// ABOUTME: Verifies spell.run, spell.eval, and spell.depth against a mock spell bridge
+
+package bridges
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// mockSpellBridge records calls and answers with canned results
+type mockSpellBridge struct {
+	lastPath    string
+	lastEngine  string
+	lastParams  map[string]interface{}
+	lastRunOpts bridge.SpellRunOptions
+}
+
+func (m *mockSpellBridge) Run(ctx context.Context, path string, params map[string]interface{}, opts bridge.SpellRunOptions) (interface{}, error) {
+	m.lastPath, m.lastParams, m.lastRunOpts = path, params, opts
+	if path == "broken" {
+		return nil, errors.New("spell \"broken\" failed")
+	}
+	return map[string]interface{}{"answer": 42.0}, nil
+}
+
+func (m *mockSpellBridge) Eval(ctx context.Context, code, engineName string, params map[string]interface{}, opts bridge.SpellRunOptions) (interface{}, error) {
+	m.lastEngine, m.lastParams = engineName, params
+	return code, nil
+}
+
+func (m *mockSpellBridge) CacheStats() map[string]bridge.CacheStats {
+	return map[string]bridge.CacheStats{bridge.CacheSpell: {Hits: 1, Misses: 2}}
+}
+
+func (m *mockSpellBridge) Trace() bridge.TraceContext {
+	return bridge.TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+}
+
+func (m *mockSpellBridge) Depth() int    { return 2 }
+func (m *mockSpellBridge) MaxDepth() int { return 8 }
+
+func TestSpellBridge(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mock := &mockSpellBridge{}
+	require.NoError(t, RegisterSpellModule(L, mock))
+
+	err := L.DoString(`
+		local result, err = spell.run("summarize", {text = "long"})
+		assert(err == nil, tostring(err))
+		assert(result.answer == 42, "run should return the sub-spell's result")
+
+		local _, err = spell.run("broken", {}, {cache = false})
+		assert(err:find("broken"), "run errors should be returned")
+
+		local stats = spell.cache_stats()
+		assert(stats.spell.hits == 1 and stats.spell.misses == 2)
+
+		local code = spell.eval("return 1")
+		assert(code == "return 1")
+
+		local depth, limit = spell.depth()
+		assert(depth == 2 and limit == 8)
+
+		assert(spell.traceparent() == "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "broken", mock.lastPath)
+	assert.True(t, mock.lastRunOpts.NoCache, "cache = false should bypass the cache")
+	assert.Equal(t, "lua", mock.lastEngine, "eval should default to Lua")
+	assert.Empty(t, mock.lastParams)
+}
+
+func TestSpellRunOptions(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mock := &mockSpellBridge{}
+	require.NoError(t, RegisterSpellModule(L, mock))
+
+	require.NoError(t, L.DoString(`spell.run("a", {}, {state = false})`))
+	assert.True(t, mock.lastRunOpts.State.Isolated)
+
+	require.NoError(t, L.DoString(`spell.run("a", {}, {state = "abc"})`))
+	assert.Equal(t, "abc", mock.lastRunOpts.StateID)
+
+	require.NoError(t, L.DoString(`spell.run("a", {}, {state = {keys = {"public.*"}, read_only = true, id = "root"}})`))
+	assert.Equal(t, bridge.StateInheritance{Keys: []string{"public.*"}, ReadOnly: true}, mock.lastRunOpts.State)
+	assert.Equal(t, "root", mock.lastRunOpts.StateID)
+	assert.False(t, mock.lastRunOpts.NoCache)
+}
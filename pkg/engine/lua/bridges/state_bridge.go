@@ -0,0 +1,484 @@
+// ABOUTME: Lua bridge for the state a spell shares with its sub-spells
+// ABOUTME: Exposes state.get, set, delete, keys, id, stats, schemas, locks, history, transforms, saving, migrations, export, and channels to Lua
+
+package bridges
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	"github.com/lexlapax/go-llmspell/pkg/validation"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// RegisterStateModule registers the state module in Lua. State is saved to
+// and loaded from store; a nil store makes persist and the other saving
+// functions fail. Transform pipelines the script registers go in
+// transforms, which must belong to this Lua state alone; nil gives it its
+// own, without a cache. Spells attach to the named states in channels; nil
+// makes attach fail.
+func RegisterStateModule(L *lua.LState, state *bridge.SharedState, store *bridge.SavedStates, transforms *bridge.StateTransforms, channels *bridge.StateChannels) error {
+	stateMod := L.NewTable()
+	registerStateValues(L, stateMod, state)
+	registerStateSchema(L, stateMod, state)
+	registerStateLocks(L, stateMod, state)
+	registerStateHistory(L, stateMod, state)
+	if transforms == nil {
+		transforms = bridge.NewStateTransforms(nil)
+	}
+	registerStateTransforms(L, stateMod, state, transforms)
+	registerStatePersistence(L, stateMod, state, store)
+	registerStateMigrations(L, stateMod, store)
+	registerStateExport(L, stateMod, state)
+	registerStateChannels(L, stateMod, channels)
+
+	L.SetGlobal("state", stateMod)
+	return nil
+}
+
+// registerStateValues adds get, set, delete, keys, stats, and id, which
+// work on the values of state
+func registerStateValues(L *lua.LState, stateMod *lua.LTable, state *bridge.SharedState) {
+	converter := engLua.NewLuaConverter(L)
+
+	L.SetField(stateMod, "get", L.NewFunction(func(L *lua.LState) int {
+		value, ok := state.Get(L.CheckString(1))
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(converter.ToLua(value))
+		return 1
+	}))
+	L.SetField(stateMod, "set", L.NewFunction(func(L *lua.LState) int {
+		key := L.CheckString(1)
+		value := L.CheckAny(2)
+		if _, ok := value.(*lua.LFunction); ok {
+			L.ArgError(2, "functions cannot be shared between spells")
+			return 0
+		}
+		if err := state.Set(key, converter.ToInterface(value)); err != nil {
+			L.RaiseError("%s", err.Error())
+		}
+		return 0
+	}))
+	L.SetField(stateMod, "delete", L.NewFunction(func(L *lua.LState) int {
+		if err := state.Delete(L.CheckString(1)); err != nil {
+			L.RaiseError("%s", err.Error())
+		}
+		return 0
+	}))
+	L.SetField(stateMod, "keys", L.NewFunction(func(L *lua.LState) int {
+		keys := L.NewTable()
+		for _, key := range state.Keys() {
+			keys.Append(lua.LString(key))
+		}
+		L.Push(keys)
+		return 1
+	}))
+	// stats returns the usage of the spell's own keys against its quota
+	L.SetField(stateMod, "stats", L.NewFunction(func(L *lua.LState) int {
+		L.Push(converter.ToLua(state.Stats().ToMap()))
+		return 1
+	}))
+	L.SetField(stateMod, "id", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(state.ID()))
+		return 1
+	}))
+}
+
+// registerStateSchema adds set_schema, get_schema, and validate, which
+// attach a JSON schema to the state and check its values against it. With
+// {strict = true}, set and delete raise an error instead of breaking the
+// schema.
+func registerStateSchema(L *lua.LState, stateMod *lua.LTable, state *bridge.SharedState) {
+	converter := engLua.NewLuaConverter(L)
+
+	// set_schema(schema[, {strict = true, version = n}]) attaches schema,
+	// or removes the schema given nil
+	L.SetField(stateMod, "set_schema", L.NewFunction(func(L *lua.LState) int {
+		var schema bridge.StateSchema
+		if table := L.OptTable(1, nil); table != nil {
+			schema.Schema, _ = converter.ToInterface(table).(map[string]interface{})
+			if schema.Schema == nil {
+				schema.Schema = make(map[string]interface{})
+			}
+		}
+		if options := L.OptTable(2, nil); options != nil {
+			schema.Strict = lua.LVAsBool(options.RawGetString("strict"))
+			schema.Version = int(lua.LVAsNumber(options.RawGetString("version")))
+		}
+		if err := state.SetSchema(schema); err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(lua.LTrue)
+		return 1
+	}))
+	// get_schema returns the schema, whether it is strict, and its version,
+	// or nil
+	L.SetField(stateMod, "get_schema", L.NewFunction(func(L *lua.LState) int {
+		schema, ok := state.Schema()
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(converter.ToLua(schema.Schema))
+		L.Push(lua.LBool(schema.Strict))
+		L.Push(lua.LNumber(schema.Version))
+		return 3
+	}))
+	// validate returns true, or false, a message, and a list of
+	// {field, code, message} like tools.validate
+	L.SetField(stateMod, "validate", L.NewFunction(func(L *lua.LState) int {
+		err := state.Validate()
+		if err == nil {
+			L.Push(lua.LTrue)
+			return 1
+		}
+		L.Push(lua.LFalse)
+		var result *validation.Result
+		if !errors.As(err, &result) {
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(lua.LString(validation.Formatter{}.Format(result)))
+		L.Push(validationErrorsToLua(L, result))
+		return 3
+	}))
+}
+
+// registerStateLocks adds lock, unlock, and is_locked, advisory locks on
+// keys that the spell and its sub-spells take turns with. lock takes an
+// optional table with timeout, how many seconds to wait, and ttl, after
+// how many seconds the lock releases itself.
+func registerStateLocks(L *lua.LState, stateMod *lua.LTable, state *bridge.SharedState) {
+	L.SetField(stateMod, "lock", L.NewFunction(func(L *lua.LState) int {
+		key := L.CheckString(1)
+		var opts bridge.LockOptions
+		if options := L.OptTable(2, nil); options != nil {
+			if timeout, ok := options.RawGetString("timeout").(lua.LNumber); ok {
+				opts.Wait = time.Duration(float64(timeout) * float64(time.Second))
+				if opts.Wait == 0 {
+					opts.Wait = -1
+				}
+			}
+			if ttl, ok := options.RawGetString("ttl").(lua.LNumber); ok {
+				opts.TTL = time.Duration(float64(ttl) * float64(time.Second))
+			}
+		}
+		ctx := L.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		token, err := state.Lock(ctx, key, opts)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(lua.LString(token))
+		return 1
+	}))
+	L.SetField(stateMod, "unlock", L.NewFunction(func(L *lua.LState) int {
+		if err := state.Unlock(L.CheckString(1), L.CheckString(2)); err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(lua.LTrue)
+		return 1
+	}))
+	// is_locked returns whether the key is locked and, if so, the state ID
+	// of the spell holding it
+	L.SetField(stateMod, "is_locked", L.NewFunction(func(L *lua.LState) int {
+		info, locked := state.LockHolder(L.CheckString(1))
+		if !locked {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LTrue)
+		L.Push(lua.LString(info.Owner))
+		return 2
+	}))
+}
+
+// registerStateHistory adds history, which lists the changes to the keys
+// the spell sees, replay, which rebuilds the values as they were after a
+// change, and last_seq, the number of the latest change
+func registerStateHistory(L *lua.LState, stateMod *lua.LTable, state *bridge.SharedState) {
+	converter := engLua.NewLuaConverter(L)
+
+	// history takes an optional table: keys, a pattern or list of patterns
+	// such as "task.*"; op, "set" or "delete"; since, a change number to
+	// list the changes after; and limit, to keep only the latest
+	L.SetField(stateMod, "history", L.NewFunction(func(L *lua.LState) int {
+		var filter bridge.EventFilter
+		if options := L.OptTable(1, nil); options != nil {
+			switch keys := options.RawGetString("keys").(type) {
+			case lua.LString:
+				filter.Keys = []string{string(keys)}
+			case *lua.LTable:
+				keys.ForEach(func(_, pattern lua.LValue) {
+					filter.Keys = append(filter.Keys, pattern.String())
+				})
+			}
+			if op, ok := options.RawGetString("op").(lua.LString); ok {
+				filter.Op = string(op)
+			}
+			if since, ok := options.RawGetString("since").(lua.LNumber); ok && since > 0 {
+				filter.Since = uint64(since)
+			}
+			if limit, ok := options.RawGetString("limit").(lua.LNumber); ok {
+				filter.Limit = int(limit)
+			}
+		}
+
+		events := L.NewTable()
+		for _, event := range state.History(filter) {
+			entry := L.NewTable()
+			entry.RawSetString("seq", lua.LNumber(event.Seq))
+			entry.RawSetString("op", lua.LString(event.Op))
+			entry.RawSetString("key", lua.LString(event.Key))
+			entry.RawSetString("value", converter.ToLua(event.Value))
+			entry.RawSetString("time", lua.LNumber(event.Time.Unix()))
+			entry.RawSetString("source", lua.LString(event.Source))
+			if event.Reason != "" {
+				entry.RawSetString("reason", lua.LString(event.Reason))
+			}
+			events.Append(entry)
+		}
+		L.Push(events)
+		return 1
+	}))
+	// replay returns the values the spell saw right after change seq, the
+	// latest by default, or nil and an error message once that change has
+	// left the history
+	L.SetField(stateMod, "replay", L.NewFunction(func(L *lua.LState) int {
+		seq := state.LastSeq()
+		if n := L.OptInt64(1, -1); n >= 0 {
+			seq = uint64(n)
+		}
+		values, err := state.Replay(seq)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(converter.ToLua(values))
+		return 1
+	}))
+	L.SetField(stateMod, "last_seq", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LNumber(state.LastSeq()))
+		return 1
+	}))
+}
+
+// registerStatePersistence adds persist, load, list_persisted, and
+// delete_persisted, which save the state under a name across runs, and
+// diff and diff_versions, which compare saved versions. Each returns nil
+// and an error message on failure.
+func registerStatePersistence(L *lua.LState, stateMod *lua.LTable, state *bridge.SharedState, store *bridge.SavedStates) {
+	converter := engLua.NewLuaConverter(L)
+	fail := func(L *lua.LState, err error) int {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	if store == nil {
+		unavailable := L.NewFunction(func(L *lua.LState) int {
+			return fail(L, errors.New("saving state is not available"))
+		})
+		for _, name := range []string{"persist", "load", "list_persisted", "delete_persisted", "diff", "diff_versions"} {
+			L.SetField(stateMod, name, unavailable)
+		}
+		return
+	}
+
+	L.SetField(stateMod, "persist", L.NewFunction(func(L *lua.LState) int {
+		version, err := store.Persist(L.CheckString(1), state)
+		if err != nil {
+			return fail(L, err)
+		}
+		L.Push(lua.LNumber(version))
+		return 1
+	}))
+	L.SetField(stateMod, "load", L.NewFunction(func(L *lua.LState) int {
+		version, err := store.Load(L.CheckString(1), L.OptInt(2, 0), state)
+		if err != nil {
+			return fail(L, err)
+		}
+		L.Push(lua.LNumber(version))
+		return 1
+	}))
+	L.SetField(stateMod, "list_persisted", L.NewFunction(func(L *lua.LState) int {
+		saved, err := store.List()
+		if err != nil {
+			return fail(L, err)
+		}
+		list := L.NewTable()
+		for _, s := range saved {
+			versions := make([]interface{}, len(s.Versions))
+			for i, v := range s.Versions {
+				versions[i] = v
+			}
+			list.Append(converter.ToLua(map[string]interface{}{
+				"name":     s.Name,
+				"versions": versions,
+				"latest":   s.Latest,
+				"saved":    s.Saved.Unix(),
+			}))
+		}
+		L.Push(list)
+		return 1
+	}))
+	// diff compares a saved version, the latest by default, with the
+	// state now; {deep = true} lists the fields that changed in tables
+	L.SetField(stateMod, "diff", L.NewFunction(func(L *lua.LState) int {
+		saved, _, err := store.Values(L.CheckString(1), L.OptInt(2, 0))
+		if err != nil {
+			return fail(L, err)
+		}
+		diff := bridge.DiffStates(saved, state.Values(), deepOption(L, 3))
+		L.Push(converter.ToLua(diff.ToMap()))
+		return 1
+	}))
+	L.SetField(stateMod, "diff_versions", L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		from, _, err := store.Values(name, L.CheckInt(2))
+		if err != nil {
+			return fail(L, err)
+		}
+		to, _, err := store.Values(name, L.CheckInt(3))
+		if err != nil {
+			return fail(L, err)
+		}
+		diff := bridge.DiffStates(from, to, deepOption(L, 4))
+		L.Push(converter.ToLua(diff.ToMap()))
+		return 1
+	}))
+	L.SetField(stateMod, "delete_persisted", L.NewFunction(func(L *lua.LState) int {
+		if err := store.Delete(L.CheckString(1), L.OptInt(2, 0)); err != nil {
+			return fail(L, err)
+		}
+		L.Push(lua.LTrue)
+		return 1
+	}))
+}
+
+// registerStateMigrations adds register_migration, which registers a
+// function that moves saved values from one schema version to another,
+// and migrate, which chains them over the latest version of a saved state
+// and saves the result as a new version
+func registerStateMigrations(L *lua.LState, stateMod *lua.LTable, store *bridge.SavedStates) {
+	converter := engLua.NewLuaConverter(L)
+	migrations := bridge.NewStateMigrations()
+	fail := func(L *lua.LState, err error) int {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	// register_migration(from, to, fn[, {schema = schema}]) registers fn,
+	// which takes the values and returns the migrated ones, or nil and an
+	// error message; schema is the one version to must meet
+	L.SetField(stateMod, "register_migration", L.NewFunction(func(L *lua.LState) int {
+		from, to, fn := L.CheckInt(1), L.CheckInt(2), L.CheckFunction(3)
+		migrate := func(values map[string]interface{}) (map[string]interface{}, error) {
+			top := L.GetTop()
+			defer L.SetTop(top)
+			if err := L.CallByParam(lua.P{Fn: fn, NRet: 2, Protect: true}, converter.ToLua(values)); err != nil {
+				return nil, err
+			}
+			result, message := L.Get(-2), L.Get(-1)
+			if result == lua.LNil && message != lua.LNil {
+				return nil, errors.New(message.String())
+			}
+			if result == lua.LNil {
+				return nil, nil
+			}
+			migrated, ok := converter.ToInterface(result).(map[string]interface{})
+			if !ok {
+				return nil, errors.New("a migration must return a table of values")
+			}
+			return migrated, nil
+		}
+		if err := migrations.Register(bridge.StateMigration{From: from, To: to, Migrate: migrate}); err != nil {
+			return fail(L, err)
+		}
+		if options := L.OptTable(4, nil); options != nil {
+			if table, ok := options.RawGetString("schema").(*lua.LTable); ok {
+				schema, _ := converter.ToInterface(table).(map[string]interface{})
+				if schema == nil {
+					schema = make(map[string]interface{})
+				}
+				if err := migrations.RegisterSchema(to, schema); err != nil {
+					return fail(L, err)
+				}
+			}
+		}
+		L.Push(lua.LTrue)
+		return 1
+	}))
+	// migrate(name, from, to) returns the new version; from may be nil to
+	// use the schema version the state was saved with
+	L.SetField(stateMod, "migrate", L.NewFunction(func(L *lua.LState) int {
+		if store == nil {
+			return fail(L, errors.New("saving state is not available"))
+		}
+		version, err := store.Migrate(L.CheckString(1), L.OptInt(2, 0), L.CheckInt(3), migrations)
+		if err != nil {
+			return fail(L, err)
+		}
+		L.Push(lua.LNumber(version))
+		return 1
+	}))
+}
+
+// registerStateExport adds export, which returns the state as a JSON,
+// YAML, or msgpack document, and import, which sets the values of one, so
+// spells can hand state to each other and to other programs
+func registerStateExport(L *lua.LState, stateMod *lua.LTable, state *bridge.SharedState) {
+	fail := func(L *lua.LState, err error) int {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	// export([format]) returns the document, JSON by default
+	L.SetField(stateMod, "export", L.NewFunction(func(L *lua.LState) int {
+		schema, _ := state.Schema()
+		var buf bytes.Buffer
+		export := bridge.StateExport{Values: state.Values(), SchemaVersion: schema.Version}
+		if err := bridge.ExportState(&buf, L.OptString(1, bridge.StateFormatJSON), export); err != nil {
+			return fail(L, err)
+		}
+		L.Push(lua.LString(buf.String()))
+		return 1
+	}))
+	// import(data[, format]) sets the document's values, leaving other keys
+	// alone; the format is worked out from the data when not given
+	L.SetField(stateMod, "import", L.NewFunction(func(L *lua.LState) int {
+		export, err := bridge.ImportState(strings.NewReader(L.CheckString(1)), L.OptString(2, ""))
+		if err != nil {
+			return fail(L, err)
+		}
+		if err := state.SetValues(export.Values); err != nil {
+			return fail(L, err)
+		}
+		L.Push(lua.LTrue)
+		return 1
+	}))
+}
+
+// deepOption reads the deep field of an optional options table at n
+func deepOption(L *lua.LState, n int) bool {
+	options := L.OptTable(n, nil)
+	return options != nil && lua.LVAsBool(options.RawGetString("deep"))
+}
@@ -0,0 +1,359 @@
+// ABOUTME: Tests for the Lua state bridge
+// ABOUTME: Verifies that values set from Lua are shared, checked, locked, replayed, and saved across runs
+
+package bridges
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestStateBridge(t *testing.T) {
+	parent := bridge.NewSharedState()
+	parent.Set("topic", "go")
+
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterStateModule(L, parent.Child(bridge.StateInheritance{}), nil, nil, nil))
+
+	err := L.DoString(`
+		assert(state.get("topic") == "go", "Parent keys should be visible")
+		assert(state.get("missing") == nil)
+		state.set("findings", {count = 2, items = {"a", "b"}})
+		local keys = state.keys()
+		assert(#keys == 2 and keys[1] == "findings" and keys[2] == "topic")
+		assert(type(state.id()) == "string")
+		state.delete("topic")
+	`)
+	require.NoError(t, err)
+
+	findings, ok := parent.Get("findings")
+	require.True(t, ok, "Writes should reach the parent's state")
+	assert.Equal(t, float64(2), findings.(map[string]interface{})["count"])
+	_, ok = parent.Get("topic")
+	assert.False(t, ok)
+
+	err = L.DoString(`state.set("fn", function() end)`)
+	assert.Error(t, err, "Functions cannot cross into other spells")
+
+	err = L.DoString(`
+		local version, err = state.persist("run")
+		assert(version == nil and err:find("not available"), "Saving needs a store")
+	`)
+	require.NoError(t, err)
+}
+
+func TestStateSchema(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterStateModule(L, bridge.NewSharedState(), nil, nil, nil))
+
+	err := L.DoString(`
+		assert(state.get_schema() == nil)
+		assert(state.set_schema({
+			type = "object",
+			properties = {count = {type = "integer", minimum = 0}},
+			required = {"count"},
+		}))
+		local ok, message, errors = state.validate()
+		assert(ok == false and message:find("count") and errors[1].code == "required")
+
+		state.set("count", -1)
+		assert(state.validate() == false, "A schema that is not strict only reports problems")
+
+		local schema, strict = state.get_schema()
+		assert(schema.properties.count.minimum == 0 and strict == false)
+		assert(state.set_schema(schema, {strict = true}))
+		local set_ok, set_err = pcall(state.set, "count", "many")
+		assert(not set_ok and tostring(set_err):find("count"), "Strict schemas reject bad writes")
+		assert(not pcall(state.delete, "count"), "Strict schemas keep required keys")
+		state.set("count", 3)
+		assert(state.validate() == true)
+
+		local bad, err = state.set_schema({type = "string"})
+		assert(bad == nil and err:find("object"))
+	`)
+	require.NoError(t, err)
+}
+
+func TestStateTransforms(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	state := bridge.NewSharedState()
+	require.NoError(t, RegisterStateModule(L, state, nil, bridge.NewStateTransforms(bridge.NewResultCache(bridge.ResultCacheOptions{})), nil))
+
+	err := L.DoString(`
+		state.set("user", {name = "ada", token = "secret"})
+		state.set("public.topic", "tides")
+		state.set("scratch", "x")
+
+		assert(state.register_transform("export", {
+			{op = "filter", keys = {"user", "public.*"}},
+			{op = "redact", keys = "user", fields = {"token"}, replacement = "***"},
+			{op = "map", keys = "public.*", fn = function(value) return value:upper() end},
+			{op = "rename", names = {["public.topic"] = "topic"}},
+			{op = "script", fn = function(values) values.exported = true return values end},
+		}))
+		local values = state.transform("export")
+		assert(values.user.token == "***" and values.topic == "TIDES" and values.exported)
+		assert(values.scratch == nil and state.get("scratch") == "x", "transform leaves the state alone")
+		state.transform("export")
+
+		local m = state.transform_metrics().export
+		assert(m.runs == 2 and m.cache_hits == 1 and m.keys_in == 3 and m.keys_out == 3 and m.redacted == 1)
+
+		state.transform("export", {apply = true})
+		assert(state.get("scratch") == nil and state.get("topic") == "TIDES")
+
+		assert(state.register_transform("fails", {
+			{op = "map", fn = function() return nil, "no good" end},
+		}, {cache = false}))
+		local bad, err = state.transform("fails")
+		assert(bad == nil and err:find("no good"))
+		local bad, err = state.register_transform("bad", {{op = "sort"}})
+		assert(bad == nil and err:find("unknown kind"))
+		local bad, err = state.transform("missing")
+		assert(bad == nil and err:find("missing"))
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"exported", "topic", "user"}, state.Keys())
+}
+
+func TestStateLocks(t *testing.T) {
+	parent := bridge.NewSharedState()
+	token, err := parent.Lock(context.Background(), "held", bridge.LockOptions{})
+	require.NoError(t, err)
+
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterStateModule(L, parent.Child(bridge.StateInheritance{}), nil, nil, nil))
+
+	err = L.DoString(`
+		local token, err = state.lock("queue", {ttl = 60})
+		assert(type(token) == "string", err)
+		local locked, owner = state.is_locked("queue")
+		assert(locked and owner == state.id(), "The spell should hold the lock")
+
+		local again, err = state.lock("queue")
+		assert(again == nil and err:find("already holds"))
+		assert(state.unlock("queue", "wrong") == nil)
+		assert(state.unlock("queue", token) == true)
+		assert(state.is_locked("queue") == false)
+
+		local ok, err = state.lock("held", {timeout = 0})
+		assert(ok == nil and err:find("timed out"), "A lock held elsewhere should time out")
+		local locked, owner = state.is_locked("held")
+		assert(locked and owner ~= state.id())
+	`)
+	require.NoError(t, err)
+	assert.NoError(t, parent.Unlock("held", token))
+}
+
+func TestStateHistory(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterStateModule(L, bridge.NewSharedState(), nil, nil, nil))
+
+	err := L.DoString(`
+		state.set("task.1", "open")
+		state.set("note", {text = "hi"})
+		state.set("task.1", "done")
+		state.delete("note")
+		assert(state.last_seq() == 4)
+
+		local tasks = state.history({keys = "task.*"})
+		assert(#tasks == 2 and tasks[2].value == "done" and tasks[2].source == state.id())
+		local latest = state.history({limit = 1})
+		assert(#latest == 1 and latest[1].op == "delete" and latest[1].key == "note")
+		assert(#state.history({since = 2, keys = {"note", "task.*"}}) == 2)
+
+		local before = state.replay(2)
+		assert(before["task.1"] == "open" and before.note.text == "hi")
+		local now = state.replay()
+		assert(now["task.1"] == "done" and now.note == nil)
+	`)
+	require.NoError(t, err)
+}
+
+func TestStatePersistence(t *testing.T) {
+	store := bridge.NewSavedStates(bridge.NewFileStateStore(t.TempDir()), bridge.SavedStatesOptions{Compress: true})
+
+	run := func(script string) {
+		L := lua.NewState()
+		defer L.Close()
+		require.NoError(t, RegisterStateModule(L, bridge.NewSharedState(), store, nil, nil))
+		require.NoError(t, L.DoString(script))
+	}
+
+	run(`
+		state.set("progress", {done = 3, items = {"a", "b", "c"}})
+		assert(state.persist("crawl") == 1)
+		state.set("progress", {done = 4})
+		assert(state.persist("crawl") == 2)
+		local version, err = state.persist("../escape")
+		assert(version == nil and err:find("invalid state name"))
+	`)
+	run(`
+		assert(state.load("crawl") == 2, "The latest version loads by default")
+		assert(state.get("progress").done == 4)
+		assert(state.load("crawl", 1) == 1)
+		assert(state.get("progress").items[3] == "c")
+
+		local saved = state.list_persisted()
+		assert(#saved == 1 and saved[1].name == "crawl" and saved[1].latest == 2)
+		assert(#saved[1].versions == 2)
+
+		local diff = state.diff_versions("crawl", 1, 2, {deep = true})
+		assert(diff.changed and next(diff.added) == nil and next(diff.removed) == nil)
+		local progress = diff.modified.progress
+		assert(progress.old.done == 3 and progress.new.done == 4)
+		assert(#progress.changes == 2, "done changed and items was removed")
+
+		state.set("progress", {done = 3, items = {"a", "b", "c"}})
+		state.set("extra", true)
+		diff = state.diff("crawl", 1)
+		assert(diff.changed and diff.added.extra == true and next(diff.modified) == nil)
+		assert(not state.diff_versions("crawl", 2, 2).changed)
+
+		assert(state.delete_persisted("crawl", 1))
+		local version, err = state.load("crawl", 1)
+		assert(version == nil and err:find("not found"))
+		assert(state.delete_persisted("crawl"))
+		assert(#state.list_persisted() == 0)
+	`)
+}
+
+func TestStateMigration(t *testing.T) {
+	store := bridge.NewSavedStates(bridge.NewFileStateStore(t.TempDir()), bridge.SavedStatesOptions{})
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterStateModule(L, bridge.NewSharedState(), store, nil, nil))
+
+	err := L.DoString(`
+		assert(state.set_schema({type = "object"}, {version = 1}))
+		local _, _, version = state.get_schema()
+		assert(version == 1)
+		state.set("topic", "tides")
+		assert(state.persist("notes") == 1)
+
+		assert(state.register_migration(1, 2, function(values)
+			values.topics = {values.topic}
+			values.topic = nil
+			return values
+		end))
+		assert(state.register_migration(2, 3, function(values)
+			values.count = #values.topics
+			return values
+		end, {schema = {type = "object", required = {"count"}, properties = {count = {type = "integer"}}}}))
+
+		assert(state.migrate("notes", nil, 3) == 2)
+		state.load("notes")
+		assert(state.get("count") == 1 and state.get("topics")[1] == "tides")
+
+		local bad, err = state.migrate("notes", 1, 3)
+		assert(bad == nil and err:find("schema version 3"))
+		assert(state.register_migration(3, 4, function() return nil, "cannot go on" end))
+		local bad, err = state.migrate("notes", 3, 4)
+		assert(bad == nil and err:find("cannot go on"))
+		local bad, err = state.register_migration(4, 4, function(values) return values end)
+		assert(bad == nil)
+	`)
+	require.NoError(t, err)
+}
+
+func TestStateExport(t *testing.T) {
+	source := lua.NewState()
+	defer source.Close()
+	require.NoError(t, RegisterStateModule(source, bridge.NewSharedState(), nil, nil, nil))
+	require.NoError(t, source.DoString(`
+		state.set("topic", "tides")
+		state.set("image", "\137PNG\255")
+		exported = state.export()
+		assert(exported:find('"topic": "tides"') and exported:find("$base64", 1, true))
+
+		local bad, err = state.export("xml")
+		assert(bad == nil and err:find("unknown state format"))
+		assert(state.import(state.export("yaml")) == true)
+		assert(state.import(state.export("msgpack")) == true)
+		local bad, err = state.import("[1, 2]", "json")
+		assert(bad == nil and err:find("not a map"))
+	`))
+
+	target := bridge.NewSharedState()
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterStateModule(L, target, nil, nil, nil))
+	L.SetGlobal("exported", source.GetGlobal("exported"))
+	require.NoError(t, L.DoString(`assert(state.import(exported))`))
+	image, _ := target.Get("image")
+	assert.Equal(t, "\x89PNG\xff", image, "Binary values should survive as artifacts")
+}
+
+func TestStateStats(t *testing.T) {
+	state := bridge.NewSharedState()
+	state.SetQuota(security.StateQuota{MaxKeys: 2, Eviction: security.EvictLRU})
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterStateModule(L, state, nil, nil, nil))
+
+	err := L.DoString(`
+		state.set("a", 1)
+		state.set("b", 2)
+		state.set("c", 3)
+		local stats = state.stats()
+		assert(stats.keys == 2 and stats.max_keys == 2 and stats.evicted == 1 and stats.eviction == "lru")
+		local evicted = state.history({op = "delete"})
+		assert(evicted[1].key == "a" and evicted[1].reason == "evicted")
+	`)
+	require.NoError(t, err)
+}
+
+func TestStateChannels(t *testing.T) {
+	channels := bridge.NewStateChannels(security.ChannelPolicy{Deny: []string{"private.*"}}, nil)
+
+	// Two spells of the same run that share no state of their own
+	writer := lua.NewState()
+	defer writer.Close()
+	require.NoError(t, RegisterStateModule(writer, bridge.NewSharedState(), nil, nil, channels))
+	require.NoError(t, writer.DoString(`
+		local jobs = assert(state.attach("jobs"))
+		jobs.set("next", {id = 7, task = "summarize"})
+		assert(jobs.name == "jobs" and jobs.lock("next"))
+		state.set("mine", true)
+	`))
+
+	reader := lua.NewState()
+	defer reader.Close()
+	require.NoError(t, RegisterStateModule(reader, bridge.NewSharedState(), nil, nil, channels))
+	require.NoError(t, reader.DoString(`
+		local jobs = assert(state.attach("jobs"))
+		assert(jobs.get("next").task == "summarize")
+		assert(state.get("mine") == nil)
+		local locked, owner = jobs.is_locked("next")
+		assert(locked and owner ~= jobs.id())
+		assert(#jobs.history() == 1)
+
+		local peek = assert(state.attach("jobs", {read_only = true}))
+		peek.set("next", "draft")
+		assert(jobs.get("next").id == 7)
+
+		local denied, err = state.attach("private.keys")
+		assert(denied == nil and err:find("not allowed"))
+		local names = state.channels()
+		assert(#names == 1 and names[1] == "jobs")
+	`))
+
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterStateModule(L, bridge.NewSharedState(), nil, nil, nil))
+	require.NoError(t, L.DoString(`
+		local none, err = state.attach("jobs")
+		assert(none == nil and err:find("not available"))
+	`))
+}
@@ -0,0 +1,54 @@
+// ABOUTME: Lua functions for attaching to named state channels shared across the spells of a process
+// ABOUTME: state.attach returns a handle with the get, set, lock, and history functions of the state module
+
+package bridges
+
+import (
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// registerStateChannels adds attach, which returns a handle on a named
+// channel that other spells of the run can attach to as well, and
+// channels, which lists the channels attached to so far. attach takes an
+// optional table with read_only = true, which keeps the handle's writes to
+// itself, and returns nil and an error message when the channel is not
+// allowed.
+func registerStateChannels(L *lua.LState, stateMod *lua.LTable, channels *bridge.StateChannels) {
+	L.SetField(stateMod, "attach", L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		var inherit bridge.StateInheritance
+		if options := L.OptTable(2, nil); options != nil {
+			inherit.ReadOnly = lua.LVAsBool(options.RawGetString("read_only"))
+		}
+		if channels == nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString("state channels are not available"))
+			return 2
+		}
+		state, err := channels.Attach(name, inherit)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		handle := L.NewTable()
+		registerStateValues(L, handle, state)
+		registerStateLocks(L, handle, state)
+		registerStateHistory(L, handle, state)
+		L.SetField(handle, "name", lua.LString(name))
+		L.Push(handle)
+		return 1
+	}))
+	L.SetField(stateMod, "channels", L.NewFunction(func(L *lua.LState) int {
+		names := L.NewTable()
+		if channels != nil {
+			for _, name := range channels.Names() {
+				names.Append(lua.LString(name))
+			}
+		}
+		L.Push(names)
+		return 1
+	}))
+}
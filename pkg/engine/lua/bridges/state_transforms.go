@@ -0,0 +1,176 @@
+// ABOUTME: Transform pipelines for the Lua state module, built from step tables and Lua functions
+// ABOUTME: Registers, runs, and applies pipelines over the spell's state and reports their metrics
+
+package bridges
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// registerStateTransforms adds register_transform, transform, and
+// transform_metrics. Steps are tables with op "map", "filter", "redact",
+// "rename", or "script":
+//
+//	{op = "map", keys = "public.*", fn = function(value, key) return new end}
+//	{op = "filter", keys = {"a", "b.*"}, fn = function(value, key) return keep end}
+//	{op = "redact", keys = "user", fields = {"token"}, replacement = "***"}
+//	{op = "rename", names = {old = "new"}}
+//	{op = "script", fn = function(values) return new_values end}
+func registerStateTransforms(L *lua.LState, stateMod *lua.LTable, state *bridge.SharedState, transforms *bridge.StateTransforms) {
+	converter := engLua.NewLuaConverter(L)
+	fail := func(L *lua.LState, err error) int {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	// register_transform(name, steps[, {cache = false}]) returns true, or
+	// nil and an error message
+	L.SetField(stateMod, "register_transform", L.NewFunction(func(L *lua.LState) int {
+		pipeline := bridge.TransformPipeline{Name: L.CheckString(1)}
+		var err error
+		L.CheckTable(2).ForEach(func(_, value lua.LValue) {
+			if err != nil {
+				return
+			}
+			var step bridge.TransformStep
+			if step, err = luaTransformStep(L, converter, value); err == nil {
+				pipeline.Steps = append(pipeline.Steps, step)
+			}
+		})
+		if err != nil {
+			return fail(L, fmt.Errorf("transform %q: %w", pipeline.Name, err))
+		}
+		if options := L.OptTable(3, nil); options != nil {
+			pipeline.NoCache = options.RawGetString("cache") == lua.LFalse
+		}
+		if err := transforms.Register(pipeline); err != nil {
+			return fail(L, err)
+		}
+		L.Push(lua.LTrue)
+		return 1
+	}))
+	// transform(name[, {apply = true}]) returns the transformed values, and
+	// with apply also makes the state hold them
+	L.SetField(stateMod, "transform", L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		run := transforms.Run
+		if options := L.OptTable(2, nil); options != nil && lua.LVAsBool(options.RawGetString("apply")) {
+			run = transforms.Apply
+		}
+		result, err := run(name, state)
+		if err != nil {
+			return fail(L, err)
+		}
+		L.Push(converter.ToLua(result))
+		return 1
+	}))
+	L.SetField(stateMod, "transform_metrics", L.NewFunction(func(L *lua.LState) int {
+		metrics := L.NewTable()
+		for name, m := range transforms.Metrics() {
+			metrics.RawSetString(name, converter.ToLua(map[string]interface{}{
+				"runs":        m.Runs,
+				"failures":    m.Failures,
+				"cache_hits":  m.CacheHits,
+				"duration_ms": float64(m.Duration.Microseconds()) / 1000,
+				"keys_in":     m.KeysIn,
+				"keys_out":    m.KeysOut,
+				"redacted":    m.Redacted,
+			}))
+		}
+		L.Push(metrics)
+		return 1
+	}))
+}
+
+// luaTransformStep reads a step table
+func luaTransformStep(L *lua.LState, converter *engLua.LuaConverter, value lua.LValue) (bridge.TransformStep, error) {
+	table, ok := value.(*lua.LTable)
+	if !ok {
+		return bridge.TransformStep{}, errors.New("each step must be a table")
+	}
+	step := bridge.TransformStep{
+		Kind:   lua.LVAsString(table.RawGetString("op")),
+		Keys:   luaStrings(table.RawGetString("keys")),
+		Fields: luaStrings(table.RawGetString("fields")),
+	}
+	if replacement := table.RawGetString("replacement"); replacement != lua.LNil {
+		step.Replacement = converter.ToInterface(replacement)
+	}
+	if names, ok := table.RawGetString("names").(*lua.LTable); ok {
+		step.Names = make(map[string]string)
+		names.ForEach(func(from, to lua.LValue) {
+			step.Names[from.String()] = to.String()
+		})
+	}
+
+	fn, _ := table.RawGetString("fn").(*lua.LFunction)
+	if fn == nil {
+		return step, nil
+	}
+	// call runs fn with args and returns its first result, failing on an
+	// error raised or returned as nil and a message
+	call := func(args ...lua.LValue) (lua.LValue, error) {
+		top := L.GetTop()
+		defer L.SetTop(top)
+		if err := L.CallByParam(lua.P{Fn: fn, NRet: 2, Protect: true}, args...); err != nil {
+			return nil, err
+		}
+		result, message := L.Get(-2), L.Get(-1)
+		if result == lua.LNil && message != lua.LNil {
+			return nil, errors.New(message.String())
+		}
+		return result, nil
+	}
+	switch step.Kind {
+	case bridge.TransformMap:
+		step.Value = func(key string, value interface{}) (interface{}, error) {
+			result, err := call(converter.ToLua(value), lua.LString(key))
+			if err != nil {
+				return nil, err
+			}
+			return converter.ToInterface(result), nil
+		}
+	case bridge.TransformFilter:
+		step.Keep = func(key string, value interface{}) (bool, error) {
+			result, err := call(converter.ToLua(value), lua.LString(key))
+			return lua.LVAsBool(result), err
+		}
+	case bridge.TransformScript:
+		step.Script = func(values map[string]interface{}) (map[string]interface{}, error) {
+			result, err := call(converter.ToLua(values))
+			if err != nil {
+				return nil, err
+			}
+			if result == lua.LNil {
+				return nil, nil
+			}
+			out, ok := converter.ToInterface(result).(map[string]interface{})
+			if !ok {
+				return nil, errors.New("a script step must return a table of values")
+			}
+			return out, nil
+		}
+	}
+	return step, nil
+}
+
+// luaStrings reads a string or a list of strings
+func luaStrings(value lua.LValue) []string {
+	switch v := value.(type) {
+	case lua.LString:
+		return []string{string(v)}
+	case *lua.LTable:
+		var list []string
+		v.ForEach(func(_, item lua.LValue) {
+			list = append(list, item.String())
+		})
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// ABOUTME: Conditional tool execution for the Lua tools module
+// ABOUTME: Routes parameters to one of several tools based on a script function
+
+package bridges
+
+import (
+	"fmt"
+
+	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// toolsBranch creates a Lua function that runs one of two tools depending on a predicate
+// Usage: result, err = tools.branch(predicate, if_tool, else_tool, params)
+func toolsBranch(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		predicate := L.CheckFunction(1)
+		ifTool := L.CheckString(2)
+		elseTool := L.OptString(3, "")
+		params := optParams(L, 4, converter)
+
+		choice, err := callRouter(L, predicate, converter.ToLua(params))
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(fmt.Sprintf("branch predicate failed: %v", err)))
+			return 2
+		}
+
+		tool := ifTool
+		if !lua.LVAsBool(choice) {
+			tool = elseTool
+		}
+		if tool == "" {
+			// No else tool: nothing to run
+			L.Push(lua.LNil)
+			return 1
+		}
+
+		return executeRouted(L, tb, converter, tool, params)
+	}
+}
+
+// toolsSwitch creates a Lua function that runs the tool chosen by a selector
+// Usage: result, err = tools.switch(selector, {case = "tool", default = "tool"}, params)
+func toolsSwitch(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		selector := L.CheckFunction(1)
+		cases := L.CheckTable(2)
+		params := optParams(L, 3, converter)
+
+		key, err := callRouter(L, selector, converter.ToLua(params))
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(fmt.Sprintf("switch selector failed: %v", err)))
+			return 2
+		}
+
+		tool := cases.RawGet(key)
+		if tool == lua.LNil {
+			tool = cases.RawGetString("default")
+		}
+		name, ok := tool.(lua.LString)
+		if !ok {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(fmt.Sprintf("no tool for case %s", key.String())))
+			return 2
+		}
+
+		return executeRouted(L, tb, converter, string(name), params)
+	}
+}
+
+// optParams reads an optional parameters table at the given stack position
+func optParams(L *lua.LState, n int, converter *engLua.LuaConverter) map[string]interface{} {
+	if L.GetTop() >= n && L.Get(n).Type() == lua.LTTable {
+		if params, ok := converter.ToInterface(L.Get(n)).(map[string]interface{}); ok {
+			return params
+		}
+	}
+	return make(map[string]interface{})
+}
+
+// callRouter calls a predicate or selector with the parameters, through
+// callLua like every call from Go into the script, and returns its first
+// result
+func callRouter(L *lua.LState, fn *lua.LFunction, params lua.LValue) (lua.LValue, error) {
+	result := lua.LValue(lua.LNil)
+	err := callLua(scriptContext(L), L, "router", 0, func() error {
+		L.Push(fn)
+		L.Push(params)
+		if err := L.PCall(1, 1, nil); err != nil {
+			return err
+		}
+		result = L.Get(-1)
+		return nil
+	})
+	return result, err
+}
+
+// executeRouted runs the chosen tool and pushes its result the way tools.execute does
+func executeRouted(L *lua.LState, tb ToolBridgeInterface, converter *engLua.LuaConverter, tool string, params map[string]interface{}) int {
+	result, err := tb.ExecuteTool(scriptContext(L), tool, params)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(scriptError(L, err))
+		return 2
+	}
+
+	L.Push(converter.ToLua(result))
+	return 1
+}
@@ -0,0 +1,78 @@
+// ABOUTME: Tests for conditional tool execution in the Lua tools module
+// ABOUTME: Verifies tools.branch and tools.switch routing and error handling
+
+package bridges
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func newRoutingTestState(t *testing.T) (*lua.LState, *mockToolBridge) {
+	L := lua.NewState()
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+
+	for _, name := range []string{"small", "large", "text", "fallback"} {
+		name := name
+		mockBridge.tools[name] = &mockToolInfo{
+			name: name,
+			handler: func(p map[string]interface{}) (interface{}, error) {
+				return name, nil
+			},
+		}
+	}
+	return L, mockBridge
+}
+
+func TestToolsBranch(t *testing.T) {
+	L, mockBridge := newRoutingTestState(t)
+	defer L.Close()
+
+	err := L.DoString(`
+		local function is_large(p) return p.size > 100 end
+
+		local result, err = tools.branch(is_large, "large", "small", {size = 500})
+		assert(err == nil and result == "large", "Should run the if tool")
+
+		result, err = tools.branch(is_large, "large", "small", {size = 5})
+		assert(err == nil and result == "small", "Should run the else tool")
+
+		result, err = tools.branch(is_large, "large", nil, {size = 5})
+		assert(result == nil and err == nil, "Should run nothing without an else tool")
+
+		result, err = tools.branch(function() error("bad predicate") end, "large", "small", {})
+		assert(result == nil and err:find("branch predicate failed"), "Should report predicate errors")
+
+		result, err = tools.branch(function() return true end, "missing", "small")
+		assert(result == nil and err == "tool not found", "Should report tool errors")
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "missing", mockBridge.lastExecutedTool)
+}
+
+func TestToolsSwitch(t *testing.T) {
+	L, _ := newRoutingTestState(t)
+	defer L.Close()
+
+	err := L.DoString(`
+		local routes = {small = "small", text = "text", default = "fallback"}
+		local function kind(p) return p.kind end
+
+		local result, err = tools.switch(kind, routes, {kind = "text"})
+		assert(err == nil and result == "text", "Should run the matching case")
+
+		result, err = tools.switch(kind, routes, {kind = "video"})
+		assert(err == nil and result == "fallback", "Should fall back to default")
+
+		result, err = tools.switch(kind, {small = "small"}, {kind = "video"})
+		assert(result == nil and err == "no tool for case video", "Should report unmatched cases")
+
+		result, err = tools.switch(function(p) return #p.items end, {[2] = "large"}, {items = {1, 2}})
+		assert(err == nil and result == "large", "Should match non-string keys")
+	`)
+	require.NoError(t, err)
+}
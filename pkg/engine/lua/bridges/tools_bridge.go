@@ -5,8 +5,15 @@ package bridges
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
 
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
 	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	"github.com/lexlapax/go-llmspell/pkg/validation"
 	lua "github.com/yuin/gopher-lua"
 )
 
@@ -21,10 +28,29 @@ func RegisterToolsModule(L *lua.LState, toolBridge ToolBridgeInterface) error {
 	// Register functions
 	L.SetField(toolsMod, "register", L.NewFunction(toolsRegister(toolBridge, converter)))
 	L.SetField(toolsMod, "execute", L.NewFunction(toolsExecute(toolBridge, converter)))
+	L.SetField(toolsMod, "execute_async", L.NewFunction(toolsExecuteAsync(toolBridge, converter)))
 	L.SetField(toolsMod, "get", L.NewFunction(toolsGet(toolBridge, converter)))
 	L.SetField(toolsMod, "list", L.NewFunction(toolsList(toolBridge, converter)))
+	L.SetField(toolsMod, "pipeline", L.NewFunction(toolsPipeline(toolBridge, converter)))
+	L.SetField(toolsMod, "branch", L.NewFunction(toolsBranch(toolBridge, converter)))
+	L.SetField(toolsMod, "switch", L.NewFunction(toolsSwitch(toolBridge, converter)))
+	L.SetField(toolsMod, "search", L.NewFunction(toolsSearch(toolBridge, converter)))
+	L.SetField(toolsMod, "list_categories", L.NewFunction(toolsListCategories(toolBridge, converter)))
+	L.SetField(toolsMod, "list_tags", L.NewFunction(toolsListTags(toolBridge, converter)))
+	L.SetField(toolsMod, "list_by_category", L.NewFunction(toolsListByCategory(toolBridge, converter)))
+	L.SetField(toolsMod, "list_by_tag", L.NewFunction(toolsListByTag(toolBridge, converter)))
+	L.SetField(toolsMod, "refresh", L.NewFunction(toolsRefresh(toolBridge)))
 	L.SetField(toolsMod, "remove", L.NewFunction(toolsRemove(toolBridge)))
+	L.SetField(toolsMod, "list_custom", L.NewFunction(toolsListCustom(toolBridge, converter)))
+	L.SetField(toolsMod, "unregister_custom", L.NewFunction(toolsUnregisterCustom(toolBridge)))
+	L.SetField(toolsMod, "import_openapi", L.NewFunction(toolsImportOpenAPI(toolBridge, converter)))
 	L.SetField(toolsMod, "validate", L.NewFunction(toolsValidate(toolBridge, converter)))
+	L.SetField(toolsMod, "register_validator", L.NewFunction(toolsRegisterValidator(toolBridge, converter)))
+	L.SetField(toolsMod, "doc", L.NewFunction(toolsDoc(toolBridge, converter)))
+	L.SetField(toolsMod, "docs", L.NewFunction(toolsDocs(toolBridge, converter)))
+	L.SetField(toolsMod, "doc_versions", L.NewFunction(toolsDocVersions(toolBridge, converter)))
+	L.SetField(toolsMod, "doc_diff", L.NewFunction(toolsDocDiff(toolBridge, converter)))
+	L.SetField(toolsMod, "scaffold_input", L.NewFunction(toolsScaffoldInput(toolBridge, converter)))
 
 	// Register the module
 	L.SetGlobal("tools", toolsMod)
@@ -32,6 +58,7 @@ func RegisterToolsModule(L *lua.LState, toolBridge ToolBridgeInterface) error {
 }
 
 // toolsRegister creates a Lua function for registering tools
+// Usage: ok, err = tools.register(name, description, parameters, fn[, {deterministic = true, confirm = true, timeout = seconds}])
 func toolsRegister(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
 	return func(L *lua.LState) int {
 		// Get arguments
@@ -57,16 +84,21 @@ func toolsRegister(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.L
 		}
 		fn := L.Get(4).(*lua.LFunction)
 
-		// Create a Lua tool wrapper
+		// Create a Lua tool wrapper, which agents can call too
 		luaTool := NewLuaTool(name, description, params, fn, L, converter)
 
-		// Create a Go function that delegates to the Lua tool
-		goFunc := func(p map[string]interface{}) (interface{}, error) {
-			return luaTool.Execute(context.Background(), p)
+		// Register the tool; deterministic = true in the options lets its
+		// results be cached, confirm = true has calls confirmed before they
+		// run, and timeout stops calls that run too long
+		var opts bridge.ToolOptions
+		if table := L.OptTable(5, nil); table != nil {
+			opts.Deterministic = lua.LVAsBool(table.RawGetString("deterministic"))
+			opts.Confirm = lua.LVAsBool(table.RawGetString("confirm"))
+			if timeout, ok := table.RawGetString("timeout").(lua.LNumber); ok && timeout > 0 {
+				luaTool.SetTimeout(time.Duration(float64(timeout) * float64(time.Second)))
+			}
 		}
-
-		// Register the tool
-		err := tb.RegisterTool(name, description, params, goFunc)
+		err := tb.RegisterToolWith(name, description, params, luaTool.Execute, opts)
 		if err != nil {
 			L.Push(lua.LNil)
 			L.Push(lua.LString(err.Error()))
@@ -78,7 +110,10 @@ func toolsRegister(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.L
 	}
 }
 
-// toolsExecute creates a Lua function for executing tools
+// toolsExecute creates a Lua function for executing tools. An options
+// table with idempotency_key, retries, or backoff (seconds) makes the call
+// through ExecuteToolWith.
+// Usage: result, err = tools.execute(name, params[, opts])
 func toolsExecute(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
 	return func(L *lua.LState) int {
 		// Get arguments
@@ -96,12 +131,17 @@ func toolsExecute(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LG
 			params = make(map[string]interface{})
 		}
 
-		// Execute the tool
-		ctx := context.Background()
-		result, err := tb.ExecuteTool(ctx, name, params)
+		// Execute the tool, stopping with the script
+		var result interface{}
+		var err error
+		if opts := L.OptTable(3, nil); opts != nil {
+			result, err = tb.ExecuteToolWith(scriptContext(L), name, params, toolCallOptions(L, opts))
+		} else {
+			result, err = tb.ExecuteTool(scriptContext(L), name, params)
+		}
 		if err != nil {
 			L.Push(lua.LNil)
-			L.Push(lua.LString(err.Error()))
+			L.Push(scriptError(L, err))
 			return 2
 		}
 
@@ -111,6 +151,43 @@ func toolsExecute(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LG
 	}
 }
 
+// toolCallOptions reads the options table of tools.execute
+func toolCallOptions(L *lua.LState, opts *lua.LTable) bridge.ToolCallOptions {
+	var callOpts bridge.ToolCallOptions
+	if key, ok := opts.RawGetString("idempotency_key").(lua.LString); ok {
+		callOpts.IdempotencyKey = string(key)
+	}
+	if retries, ok := opts.RawGetString("retries").(lua.LNumber); ok {
+		if retries < 0 {
+			L.ArgError(3, "retries must not be negative")
+		}
+		callOpts.Retries = int(retries)
+	}
+	if backoff, ok := opts.RawGetString("backoff").(lua.LNumber); ok {
+		if backoff < 0 {
+			L.ArgError(3, "backoff must not be negative")
+		}
+		callOpts.Backoff = time.Duration(float64(backoff) * float64(time.Second))
+	}
+	return callOpts
+}
+
+// toolsExecuteAsync creates a Lua function that starts a tool in the
+// background and returns a future for its result. Tools registered from
+// Lua run before it returns.
+// Usage: f = tools.execute_async(name, params); result, err = f:await()
+func toolsExecuteAsync(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		name := L.CheckString(1)
+		params, _ := converter.ToInterface(L.OptTable(2, L.NewTable())).(map[string]interface{})
+		if params == nil {
+			params = make(map[string]interface{})
+		}
+		stdlib.PushFuture(L, tb.ExecuteToolAsync(scriptContext(L), name, params), converter.ToLua)
+		return 1
+	}
+}
+
 // toolsGet creates a Lua function for getting tool information
 func toolsGet(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
 	return func(L *lua.LState) int {
@@ -140,6 +217,62 @@ func toolsList(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFun
 	}
 }
 
+// toolsSearch creates a Lua function for ranked tool search
+func toolsSearch(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		query := L.CheckString(1)
+
+		results := tb.SearchTools(query)
+
+		L.Push(converter.ToLua(results))
+		return 1
+	}
+}
+
+// toolsListCategories creates a Lua function for listing tool categories
+func toolsListCategories(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		L.Push(converter.ToLua(tb.ListCategories()))
+		return 1
+	}
+}
+
+// toolsListTags creates a Lua function for listing tool tags
+func toolsListTags(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		L.Push(converter.ToLua(tb.ListTags()))
+		return 1
+	}
+}
+
+// toolsListByCategory creates a Lua function for listing the tools in a category
+func toolsListByCategory(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		category := L.CheckString(1)
+
+		L.Push(converter.ToLua(tb.ListByCategory(category)))
+		return 1
+	}
+}
+
+// toolsListByTag creates a Lua function for listing the tools carrying a tag
+func toolsListByTag(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		tag := L.CheckString(1)
+
+		L.Push(converter.ToLua(tb.ListByTag(tag)))
+		return 1
+	}
+}
+
+// toolsRefresh creates a Lua function for discarding the cached tool listing
+func toolsRefresh(tb ToolBridgeInterface) lua.LGFunction {
+	return func(L *lua.LState) int {
+		tb.RefreshTools()
+		return 0
+	}
+}
+
 // toolsRemove creates a Lua function for removing tools
 func toolsRemove(tb ToolBridgeInterface) lua.LGFunction {
 	return func(L *lua.LState) int {
@@ -157,7 +290,93 @@ func toolsRemove(tb ToolBridgeInterface) lua.LGFunction {
 	}
 }
 
-// toolsValidate creates a Lua function for validating parameters
+// toolsListCustom creates a Lua function for listing script-registered tools
+func toolsListCustom(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		L.Push(converter.ToLua(tb.ListCustomTools()))
+		return 1
+	}
+}
+
+// toolsUnregisterCustom creates a Lua function for removing script-registered tools
+func toolsUnregisterCustom(tb ToolBridgeInterface) lua.LGFunction {
+	return func(L *lua.LState) int {
+		name := L.CheckString(1)
+
+		err := tb.UnregisterCustomTool(name)
+		if err != nil {
+			L.Push(lua.LFalse)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		L.Push(lua.LTrue)
+		return 1
+	}
+}
+
+// toolsImportOpenAPI creates a Lua function that registers a custom tool for
+// each operation of an OpenAPI 3 document, read from a URL or from a file in
+// the directories fs may read. A tool bridge given the session's checks
+// with SetCheckPath uses them in place of the default fs configuration. Options are prefix, base_url, operations,
+// tags, headers, and auth = {secret, type, name, in}, where secret names one
+// of the operator's secrets.
+// Usage: names, err = tools.import_openapi(source[, opts])
+func toolsImportOpenAPI(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		source := L.CheckString(1)
+		opts := bridge.OpenAPIImport{CheckPath: stdlib.NewFS(nil).CheckPath}
+		if table := L.OptTable(2, nil); table != nil {
+			fields, _ := converter.ToInterface(table).(map[string]interface{})
+			opts.Prefix, _ = fields["prefix"].(string)
+			opts.BaseURL, _ = fields["base_url"].(string)
+			opts.Operations = interfaceStrings(fields["operations"])
+			opts.Tags = interfaceStrings(fields["tags"])
+			if headers, ok := fields["headers"].(map[string]interface{}); ok {
+				opts.Headers = make(map[string]string, len(headers))
+				for key, value := range headers {
+					opts.Headers[key] = fmt.Sprint(value)
+				}
+			}
+			if auth, ok := fields["auth"].(map[string]interface{}); ok {
+				opts.Auth = &bridge.OpenAPIAuth{}
+				opts.Auth.Secret, _ = auth["secret"].(string)
+				opts.Auth.Type, _ = auth["type"].(string)
+				opts.Auth.Name, _ = auth["name"].(string)
+				opts.Auth.In, _ = auth["in"].(string)
+			}
+		}
+
+		names, err := tb.ImportOpenAPI(scriptContext(L), source, opts)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		result := L.CreateTable(len(names), 0)
+		for _, name := range names {
+			result.Append(lua.LString(name))
+		}
+		L.Push(result)
+		return 1
+	}
+}
+
+// interfaceStrings returns the strings of a list converted from Lua
+func interfaceStrings(v interface{}) []string {
+	list, _ := v.([]interface{})
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// toolsValidate creates a Lua function for validating parameters:
+// tools.validate(name, params[, {verbose = true}]) returns true, or false,
+// a message and, for schema problems, a list of {field, code, message}
 func toolsValidate(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
 	return func(L *lua.LState) int {
 		// Get arguments
@@ -179,11 +398,201 @@ func toolsValidate(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.L
 		err := tb.ValidateParameters(name, params)
 		if err != nil {
 			L.Push(lua.LFalse)
+			var result *validation.Result
+			if !errors.As(err, &result) {
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			verbose := false
+			if opts, ok := L.Get(3).(*lua.LTable); ok {
+				verbose = lua.LVAsBool(opts.RawGetString("verbose"))
+			}
+			L.Push(lua.LString(validation.Formatter{Verbose: verbose}.Format(result)))
+			L.Push(validationErrorsToLua(L, result))
+			return 3
+		}
+
+		L.Push(lua.LTrue)
+		return 1
+	}
+}
+
+// toolsRegisterValidator creates a Lua function for adding custom
+// validation rules: tools.register_validator(name, fn) lets schemas check
+// a parameter with fn by naming the rule in "x-validate". fn(value) returns
+// true if the value passes, or false and a message saying what is wrong.
+// It may also return a future, such as a task started with async.run,
+// which is awaited and judged by its result the same way.
+func toolsRegisterValidator(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		name := L.CheckString(1)
+		fn := L.CheckFunction(2)
+
+		rule := func(value interface{}) error {
+			oldTop := L.GetTop()
+			defer L.SetTop(oldTop)
+
+			if err := L.CallByParam(lua.P{Fn: fn, NRet: 2, Protect: true}, converter.ToLua(value)); err != nil {
+				return fmt.Errorf("validation rule %s failed: %w", name, err)
+			}
+			ok, msg := L.Get(-2), L.Get(-1)
+
+			if stdlib.IsFuture(ok) {
+				if err := L.CallByParam(lua.P{Fn: L.GetField(ok, "await"), NRet: 2, Protect: true}, ok); err != nil {
+					return fmt.Errorf("validation rule %s failed: %w", name, err)
+				}
+				ok, msg = L.Get(-2), L.Get(-1)
+			}
+
+			if lua.LVAsBool(ok) {
+				return nil
+			}
+			if s, isString := msg.(lua.LString); isString && s != "" {
+				return errors.New(string(s))
+			}
+			return fmt.Errorf("does not pass the %s rule", name)
+		}
+
+		if err := tb.RegisterValidationRule(name, rule); err != nil {
+			L.Push(lua.LNil)
 			L.Push(lua.LString(err.Error()))
 			return 2
 		}
-
 		L.Push(lua.LTrue)
 		return 1
 	}
 }
+
+// validationErrorsToLua converts the errors of a validation result to a
+// list of {field, code, message, details} tables
+func validationErrorsToLua(L *lua.LState, result *validation.Result) *lua.LTable {
+	list := L.NewTable()
+	for _, err := range result.Errors {
+		entry := L.NewTable()
+		entry.RawSetString("field", lua.LString(err.Field))
+		entry.RawSetString("code", lua.LString(err.Code))
+		entry.RawSetString("message", lua.LString(err.Message))
+		if len(err.Details) > 0 {
+			details := L.NewTable()
+			for _, detail := range err.Details {
+				details.Append(lua.LString(detail))
+			}
+			entry.RawSetString("details", details)
+		}
+		list.Append(entry)
+	}
+	return list
+}
+
+// toolsScaffoldInput creates a Lua function for generating template tool inputs
+func toolsScaffoldInput(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		name := L.CheckString(1)
+
+		input, err := tb.ScaffoldInput(name)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		L.Push(converter.ToLua(input))
+		return 1
+	}
+}
+
+// toolsDoc creates a Lua function for getting a tool's generated documentation
+func toolsDoc(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		name := L.CheckString(1)
+
+		doc, err := tb.ToolDoc(name)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		L.Push(converter.ToLua(doc))
+		return 1
+	}
+}
+
+// errStopDocs ends a docs stream when the callback returns false
+var errStopDocs = errors.New("stopped")
+
+// toolsDocs creates a Lua function for documenting every tool. With a
+// callback, docs are passed to it as they are generated and returning false
+// stops; without one, all docs are returned sorted by name.
+func toolsDocs(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		callback := L.OptFunction(1, nil)
+
+		ctx := L.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		var docs []map[string]interface{}
+		err := tb.StreamToolDocs(ctx, func(doc map[string]interface{}) error {
+			if callback == nil {
+				docs = append(docs, doc)
+				return nil
+			}
+			if err := L.CallByParam(lua.P{Fn: callback, NRet: 1, Protect: true}, converter.ToLua(doc)); err != nil {
+				return err
+			}
+			keepGoing := L.Get(-1) != lua.LFalse
+			L.Pop(1)
+			if !keepGoing {
+				return errStopDocs
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopDocs) {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		if callback != nil {
+			L.Push(lua.LTrue)
+			return 1
+		}
+
+		sort.Slice(docs, func(i, j int) bool {
+			return docs[i]["name"].(string) < docs[j]["name"].(string)
+		})
+		L.Push(converter.ToLua(docs))
+		return 1
+	}
+}
+
+// toolsDocVersions creates a Lua function for listing a tool's recorded doc versions
+func toolsDocVersions(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		name := L.CheckString(1)
+
+		L.Push(converter.ToLua(tb.ToolDocVersions(name)))
+		return 1
+	}
+}
+
+// toolsDocDiff creates a Lua function for comparing two versions of a tool's docs
+func toolsDocDiff(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		name := L.CheckString(1)
+		from := L.CheckString(2)
+		to := L.CheckString(3)
+
+		diff, err := tb.DocDiff(name, from, to)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		L.Push(converter.ToLua(diff))
+		return 1
+	}
+}
@@ -5,6 +5,9 @@ package bridges
 
 import (
 	"context"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/tools"
 )
 
 // ToolBridgeInterface defines the methods needed by the Lua tools bridge
@@ -12,18 +15,74 @@ type ToolBridgeInterface interface {
 	// RegisterTool registers a new tool from script
 	RegisterTool(name, description string, parameters map[string]interface{}, fn func(map[string]interface{}) (interface{}, error)) error
 
+	// RegisterToolWith registers a new tool from script with options, such
+	// as whether its results may be cached; fn gets each call's context
+	RegisterToolWith(name, description string, parameters map[string]interface{}, fn tools.ToolFunc, opts bridge.ToolOptions) error
+
 	// ExecuteTool executes a tool by name with given parameters
 	ExecuteTool(ctx context.Context, name string, params map[string]interface{}) (interface{}, error)
 
+	// ExecuteToolWith executes a tool under an idempotency key, retrying
+	// transient failures
+	ExecuteToolWith(ctx context.Context, name string, params map[string]interface{}, opts bridge.ToolCallOptions) (interface{}, error)
+
+	// ExecuteToolAsync executes a tool in the background
+	ExecuteToolAsync(ctx context.Context, name string, params map[string]interface{}) *bridge.Future
+
 	// GetTool returns information about a specific tool
 	GetTool(name string) (map[string]interface{}, error)
 
 	// ListTools returns information about all registered tools
 	ListTools() []map[string]interface{}
 
+	// SearchTools returns tools matching a query, best match first
+	SearchTools(query string) []map[string]interface{}
+
+	// ListCategories returns the distinct tool categories with counts
+	ListCategories() []map[string]interface{}
+
+	// ListTags returns the distinct tool tags with counts
+	ListTags() []map[string]interface{}
+
+	// ListByCategory returns the tools in a category
+	ListByCategory(category string) []map[string]interface{}
+
+	// ListByTag returns the tools carrying a tag
+	ListByTag(tag string) []map[string]interface{}
+
+	// RefreshTools discards any cached discovery listing
+	RefreshTools()
+
 	// RemoveTool removes a tool by name
 	RemoveTool(name string) error
 
+	// ListCustomTools returns information about tools registered from scripts
+	ListCustomTools() []map[string]interface{}
+
+	// UnregisterCustomTool removes a tool registered from a script
+	UnregisterCustomTool(name string) error
+
+	// ImportOpenAPI registers a tool for each operation of an OpenAPI document
+	ImportOpenAPI(ctx context.Context, source string, opts bridge.OpenAPIImport) ([]string, error)
+
 	// ValidateParameters validates tool parameters
 	ValidateParameters(name string, params map[string]interface{}) error
+
+	// RegisterValidationRule adds a custom rule schemas can name with x-validate
+	RegisterValidationRule(name string, rule bridge.ValidationRule) error
+
+	// ToolDoc returns generated documentation for a tool
+	ToolDoc(name string) (map[string]interface{}, error)
+
+	// StreamToolDocs calls fn with each tool's documentation as it is generated
+	StreamToolDocs(ctx context.Context, fn func(map[string]interface{}) error) error
+
+	// ToolDocVersions lists the recorded documentation versions of a tool
+	ToolDocVersions(name string) []string
+
+	// DocDiff compares the documentation of two versions of a tool
+	DocDiff(name, fromVersion, toVersion string) (map[string]interface{}, error)
+
+	// ScaffoldInput builds a template input from a tool's parameter schema
+	ScaffoldInput(name string) (map[string]interface{}, error)
 }
@@ -6,10 +6,19 @@ package bridges
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
+	"github.com/lexlapax/go-llmspell/pkg/security"
 	"github.com/lexlapax/go-llmspell/pkg/tools"
+	"github.com/lexlapax/go-llmspell/pkg/validation"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	lua "github.com/yuin/gopher-lua"
@@ -25,15 +34,21 @@ type mockToolBridge struct {
 	executeErr         error
 	validateCalled     bool
 	validateErr        error
+	refreshCount       int
 	lastExecutedTool   string
 	lastExecutedParams map[string]interface{}
+	lastCallOptions    bridge.ToolCallOptions
 }
 
 type mockToolInfo struct {
 	name        string
 	description string
+	category    string
+	tags        []string
 	parameters  map[string]interface{}
 	handler     func(map[string]interface{}) (interface{}, error)
+	ctxHandler  tools.ToolFunc
+	custom      bool
 }
 
 func newMockToolBridge() *mockToolBridge {
@@ -53,10 +68,31 @@ func (m *mockToolBridge) RegisterTool(name, description string, parameters map[s
 		description: description,
 		parameters:  parameters,
 		handler:     handler,
+		custom:      true,
 	}
 	return nil
 }
 
+func (m *mockToolBridge) RegisterToolWith(name, description string, parameters map[string]interface{}, handler tools.ToolFunc, opts bridge.ToolOptions) error {
+	err := m.RegisterTool(name, description, parameters, func(params map[string]interface{}) (interface{}, error) {
+		return handler(context.Background(), params)
+	})
+	if err != nil {
+		return err
+	}
+	m.tools[name].ctxHandler = handler
+	return nil
+}
+
+func (m *mockToolBridge) ExecuteToolAsync(ctx context.Context, name string, params map[string]interface{}) *bridge.Future {
+	return bridge.Resolved(m.ExecuteTool(ctx, name, params))
+}
+
+func (m *mockToolBridge) ExecuteToolWith(ctx context.Context, name string, params map[string]interface{}, opts bridge.ToolCallOptions) (interface{}, error) {
+	m.lastCallOptions = opts
+	return m.ExecuteTool(ctx, name, params)
+}
+
 func (m *mockToolBridge) ExecuteTool(ctx context.Context, name string, params map[string]interface{}) (interface{}, error) {
 	m.executeCalled = true
 	m.lastExecutedTool = name
@@ -75,6 +111,9 @@ func (m *mockToolBridge) ExecuteTool(ctx context.Context, name string, params ma
 		return nil, errors.New("tool not found")
 	}
 
+	if tool.ctxHandler != nil {
+		return tool.ctxHandler(ctx, params)
+	}
 	if tool.handler != nil {
 		return tool.handler(params)
 	}
@@ -112,6 +151,77 @@ func (m *mockToolBridge) ListTools() []map[string]interface{} {
 	return result
 }
 
+func (m *mockToolBridge) SearchTools(query string) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, tool := range m.tools {
+		if strings.Contains(tool.name, query) || strings.Contains(tool.description, query) {
+			result = append(result, map[string]interface{}{
+				"name":        tool.name,
+				"description": tool.description,
+				"score":       float64(1),
+			})
+		}
+	}
+	return result
+}
+
+func (m *mockToolBridge) ListCategories() []map[string]interface{} {
+	counts := make(map[string]int)
+	for _, tool := range m.tools {
+		if tool.category != "" {
+			counts[tool.category]++
+		}
+	}
+	return mockFacets(counts)
+}
+
+func (m *mockToolBridge) ListTags() []map[string]interface{} {
+	counts := make(map[string]int)
+	for _, tool := range m.tools {
+		for _, tag := range tool.tags {
+			counts[tag]++
+		}
+	}
+	return mockFacets(counts)
+}
+
+func (m *mockToolBridge) ListByCategory(category string) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, tool := range m.tools {
+		if tool.category == category {
+			result = append(result, map[string]interface{}{"name": tool.name, "category": tool.category})
+		}
+	}
+	return result
+}
+
+func (m *mockToolBridge) ListByTag(tag string) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, tool := range m.tools {
+		for _, t := range tool.tags {
+			if t == tag {
+				result = append(result, map[string]interface{}{"name": tool.name, "category": tool.category})
+			}
+		}
+	}
+	return result
+}
+
+func mockFacets(counts map[string]int) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for name, count := range counts {
+		result = append(result, map[string]interface{}{"name": name, "count": count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i]["name"].(string) < result[j]["name"].(string)
+	})
+	return result
+}
+
+func (m *mockToolBridge) RefreshTools() {
+	m.refreshCount++
+}
+
 func (m *mockToolBridge) RemoveTool(name string) error {
 	if _, exists := m.tools[name]; !exists {
 		return errors.New("tool not found")
@@ -120,6 +230,35 @@ func (m *mockToolBridge) RemoveTool(name string) error {
 	return nil
 }
 
+func (m *mockToolBridge) ListCustomTools() []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, tool := range m.tools {
+		if tool.custom {
+			result = append(result, map[string]interface{}{
+				"name":        tool.name,
+				"description": tool.description,
+			})
+		}
+	}
+	return result
+}
+
+func (m *mockToolBridge) UnregisterCustomTool(name string) error {
+	tool, exists := m.tools[name]
+	if !exists {
+		return errors.New("tool not found")
+	}
+	if !tool.custom {
+		return errors.New("not a custom tool")
+	}
+	delete(m.tools, name)
+	return nil
+}
+
+func (m *mockToolBridge) ImportOpenAPI(ctx context.Context, source string, opts bridge.OpenAPIImport) ([]string, error) {
+	return nil, errors.New("not supported")
+}
+
 func (m *mockToolBridge) ValidateParameters(name string, params map[string]interface{}) error {
 	m.validateCalled = true
 	if m.validateErr != nil {
@@ -136,6 +275,69 @@ func (m *mockToolBridge) ValidateParameters(name string, params map[string]inter
 	return nil
 }
 
+func (m *mockToolBridge) ToolDoc(name string) (map[string]interface{}, error) {
+	tool, exists := m.tools[name]
+	if !exists {
+		return nil, errors.New("tool not found")
+	}
+
+	return map[string]interface{}{
+		"name":        tool.name,
+		"description": tool.description,
+		"markdown":    "## " + tool.name,
+	}, nil
+}
+
+func (m *mockToolBridge) StreamToolDocs(ctx context.Context, fn func(map[string]interface{}) error) error {
+	names := make([]string, 0, len(m.tools))
+	for name := range m.tools {
+		names = append(names, name)
+	}
+	// Reverse order, like a stream that does not finish in name order
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	for _, name := range names {
+		doc, _ := m.ToolDoc(name)
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockToolBridge) ToolDocVersions(name string) []string {
+	if _, exists := m.tools[name]; !exists {
+		return []string{}
+	}
+	return []string{"1.0", "2.0"}
+}
+
+func (m *mockToolBridge) DocDiff(name, fromVersion, toVersion string) (map[string]interface{}, error) {
+	if fromVersion != "1.0" || toVersion != "2.0" {
+		return nil, errors.New("no documentation recorded")
+	}
+	return map[string]interface{}{
+		"tool":     name,
+		"added":    []interface{}{"limit"},
+		"removed":  []interface{}{},
+		"breaking": false,
+	}, nil
+}
+
+func (m *mockToolBridge) RegisterValidationRule(name string, rule bridge.ValidationRule) error {
+	return nil
+}
+
+func (m *mockToolBridge) ScaffoldInput(name string) (map[string]interface{}, error) {
+	tool, exists := m.tools[name]
+	if !exists {
+		return nil, errors.New("tool not found")
+	}
+
+	input, _ := bridge.ScaffoldSchema(tool.parameters).(map[string]interface{})
+	return input, nil
+}
+
 func TestRegisterToolsModule(t *testing.T) {
 	L := lua.NewState()
 	defer L.Close()
@@ -152,7 +354,10 @@ func TestRegisterToolsModule(t *testing.T) {
 	// Check if all functions are registered
 	toolsTable := tools.(*lua.LTable)
 	functions := []string{
-		"register", "execute", "get", "list", "remove", "validate",
+		"register", "execute", "get", "list", "search", "remove", "validate", "scaffold_input",
+		"list_categories", "list_tags", "list_by_category", "list_by_tag",
+		"list_custom", "unregister_custom", "import_openapi", "pipeline", "branch", "switch", "refresh",
+		"doc", "docs", "doc_versions", "doc_diff",
 	}
 
 	for _, fn := range functions {
@@ -260,6 +465,17 @@ func TestToolsExecute(t *testing.T) {
 		assert(err == "tool not found", "Error message should match")
 	`)
 	require.NoError(t, err)
+
+	// Test execution with idempotency and retry options
+	err = L.DoString(`
+		local result, err = tools.execute("echo_tool", {message = "Hi"}, {idempotency_key = "k1", retries = 2, backoff = 0.5})
+		assert(result.echo == "Hi", "Echo should match input")
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, bridge.ToolCallOptions{IdempotencyKey: "k1", Retries: 2, Backoff: 500 * time.Millisecond}, mockBridge.lastCallOptions)
+
+	err = L.DoString(`tools.execute("echo_tool", {}, {retries = -1})`)
+	assert.Error(t, err)
 }
 
 func TestToolsGet(t *testing.T) {
@@ -350,6 +566,61 @@ func TestToolsList(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestToolsSearch(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+
+	mockBridge.tools["web_fetch"] = &mockToolInfo{name: "web_fetch", description: "Fetches a URL"}
+	mockBridge.tools["calculator"] = &mockToolInfo{name: "calculator", description: "Does math"}
+
+	err := L.DoString(`
+		local results = tools.search("fetch")
+		assert(#results == 1, "Should find one tool")
+		assert(results[1].name == "web_fetch", "Should find web_fetch")
+		assert(results[1].score == 1, "Should include the score")
+
+		local none = tools.search("nothing")
+		assert(#none == 0, "Should find no tools")
+	`)
+	require.NoError(t, err)
+}
+
+func TestToolsTaxonomy(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+
+	mockBridge.tools["web_fetch"] = &mockToolInfo{name: "web_fetch", category: "web", tags: []string{"http", "builtin"}}
+	mockBridge.tools["web_post"] = &mockToolInfo{name: "web_post", category: "web", tags: []string{"http"}}
+	mockBridge.tools["file_read"] = &mockToolInfo{name: "file_read", category: "file", tags: []string{"builtin"}}
+
+	err := L.DoString(`
+		local categories = tools.list_categories()
+		assert(#categories == 2, "Should have two categories")
+		assert(categories[1].name == "file" and categories[1].count == 1, "file category should have one tool")
+		assert(categories[2].name == "web" and categories[2].count == 2, "web category should have two tools")
+
+		local tags = tools.list_tags()
+		assert(#tags == 2, "Should have two tags")
+		assert(tags[1].name == "builtin" and tags[1].count == 2, "builtin tag should have two tools")
+
+		local builtins = tools.list_by_tag("builtin")
+		assert(#builtins == 2, "Should find two builtin tools")
+
+		local web = tools.list_by_category("web")
+		assert(#web == 2, "Should find two web tools")
+		assert(web[1].category == "web", "Tools should carry their category")
+
+		assert(#tools.list_by_tag("missing") == 0, "Unknown tag should find nothing")
+	`)
+	require.NoError(t, err)
+}
+
 func TestToolsRemove(t *testing.T) {
 	L := lua.NewState()
 	defer L.Close()
@@ -390,6 +661,155 @@ func TestToolsRemove(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestToolsCustom(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+
+	mockBridge.tools["web_fetch"] = &mockToolInfo{name: "web_fetch"}
+
+	err := L.DoString(`
+		assert(tools.register("mine", "A script tool", {}, function(p) return p end))
+		assert(#tools.list() == 2, "Should list all tools")
+
+		local custom = tools.list_custom()
+		assert(#custom == 1 and custom[1].name == "mine", "Should list only script tools")
+
+		local ok, err = tools.unregister_custom("web_fetch")
+		assert(ok == false and err == "not a custom tool", "Should refuse non-custom tools")
+
+		ok, err = tools.unregister_custom("mine")
+		assert(ok == true and err == nil, "Should unregister script tools")
+		assert(#tools.list_custom() == 0, "No custom tools should remain")
+	`)
+	require.NoError(t, err)
+	assert.Contains(t, mockBridge.tools, "web_fetch")
+}
+
+func TestToolsImportOpenAPI(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/openapi.json" {
+			fmt.Fprint(w, `{
+				"openapi": "3.0.3",
+				"info": {"title": "Quotes", "version": "2.1"},
+				"servers": [{"url": "/v2"}],
+				"paths": {
+					"/quotes": {"get": {"operationId": "random", "tags": ["quotes"], "parameters": [{"name": "topic", "in": "query"}]}},
+					"/admin": {"delete": {"operationId": "purge", "tags": ["admin"]}}
+				}
+			}`)
+			return
+		}
+		got = r
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"quote": "Less is more"}`)
+	}))
+	defer server.Close()
+
+	tb := bridge.NewToolBridge(tools.NewRegistry())
+	tb.SetSecrets(bridge.SecretsConfig{Secrets: map[string]bridge.Secret{"quotes": {Value: "k3y", Hosts: []string{"127.0.0.1"}}}})
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterToolsModule(L, tb))
+	L.SetGlobal("url", lua.LString(server.URL+"/openapi.json"))
+
+	err := L.DoString(`
+		local names = tools.import_openapi(url, {
+			prefix = "quotes_",
+			tags = {"quotes"},
+			headers = {["X-Client"] = "spell"},
+			auth = {type = "api_key", secret = "quotes", name = "X-API-Key"},
+		})
+		assert(#names == 1 and names[1] == "quotes_random")
+
+		local custom = tools.list_custom()
+		assert(#custom == 1 and custom[1].source == "openapi:Quotes")
+		assert(tools.execute("quotes_random", {topic = "design"}).quote == "Less is more")
+
+		local names, err = tools.import_openapi(url, {auth = {secret = "missing"}})
+		assert(names == nil and err:find("no secret"))
+		local names, err = tools.import_openapi("/etc/openapi.json")
+		assert(names == nil and err ~= nil)
+
+		assert(tools.unregister_custom("quotes_random") == true)
+		assert(#tools.list() == 0)
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "/v2/quotes", got.URL.Path)
+	assert.Equal(t, "topic=design", got.URL.RawQuery)
+	assert.Equal(t, "k3y", got.Header.Get("X-API-Key"))
+	assert.Equal(t, "spell", got.Header.Get("X-Client"))
+}
+
+func TestToolsRefresh(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+
+	require.NoError(t, L.DoString(`tools.refresh()`))
+	assert.Equal(t, 1, mockBridge.refreshCount)
+}
+
+func TestToolsDocs(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+
+	mockBridge.tools["alpha"] = &mockToolInfo{name: "alpha", description: "First"}
+	mockBridge.tools["beta"] = &mockToolInfo{name: "beta", description: "Second"}
+	mockBridge.tools["gamma"] = &mockToolInfo{name: "gamma", description: "Third"}
+
+	err := L.DoString(`
+		local doc = assert(tools.doc("alpha"))
+		assert(doc.markdown == "## alpha")
+
+		local missing, err = tools.doc("nope")
+		assert(missing == nil and err == "tool not found")
+
+		local all = tools.docs()
+		assert(#all == 3 and all[1].name == "alpha" and all[3].name == "gamma", "Expected docs sorted by name")
+
+		local seen = {}
+		assert(tools.docs(function(d)
+			table.insert(seen, d.name)
+			return #seen < 2
+		end))
+		assert(#seen == 2 and seen[1] == "gamma", "Expected the callback to stop the stream")
+
+		local res, err = tools.docs(function(d) error("boom") end)
+		assert(res == nil and err:find("boom"))
+	`)
+	require.NoError(t, err)
+}
+
+func TestToolsDocDiff(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+	mockBridge.tools["search"] = &mockToolInfo{name: "search"}
+
+	err := L.DoString(`
+		local versions = tools.doc_versions("search")
+		assert(#versions == 2 and versions[2] == "2.0")
+
+		local diff = assert(tools.doc_diff("search", "1.0", "2.0"))
+		assert(diff.added[1] == "limit" and #diff.removed == 0 and diff.breaking == false)
+
+		local res, err = tools.doc_diff("search", "0.1", "2.0")
+		assert(res == nil and err:find("no documentation"))
+	`)
+	require.NoError(t, err)
+}
+
 func TestToolsValidate(t *testing.T) {
 	L := lua.NewState()
 	defer L.Close()
@@ -430,6 +850,24 @@ func TestToolsValidate(t *testing.T) {
 	`)
 	require.NoError(t, err)
 
+	// Test schema problems, tersely and in detail
+	result := &validation.Result{}
+	result.Add(validation.Required("required_param"))
+	result.Addf("count", validation.CodeMaximum, "must be ≤ 2, got %d", 5)
+	mockBridge.validateErr = result
+	err = L.DoString(`
+		local success, err, problems = tools.validate("validated_tool", {count = 5})
+		assert(success == false)
+		assert(err == "field 'required_param' is required; field 'count' must be ≤ 2, got 5", err)
+		assert(#problems == 2)
+		assert(problems[1].field == "required_param" and problems[1].code == "required")
+		assert(problems[2].message == "must be ≤ 2, got 5")
+
+		local _, detailed = tools.validate("validated_tool", {count = 5}, {verbose = true})
+		assert(detailed == "2 validation errors\n  required_param: is required\n  count: must be ≤ 2, got 5", detailed)
+	`)
+	require.NoError(t, err)
+
 	// Test validation of non-existent tool
 	mockBridge.validateErr = nil
 	err = L.DoString(`
@@ -441,6 +879,40 @@ func TestToolsValidate(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestToolsScaffoldInput(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+
+	mockBridge.tools["search"] = &mockToolInfo{
+		name: "search",
+		parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{"type": "string"},
+				"limit": map[string]interface{}{"type": "number", "default": float64(10)},
+				"exact": map[string]interface{}{"type": "boolean"},
+			},
+			"required": []interface{}{"query"},
+		},
+	}
+
+	err := L.DoString(`
+		local input, err = tools.scaffold_input("search")
+		assert(err == nil, "Error should be nil")
+		assert(input.query == "", "Required string should get a placeholder")
+		assert(input.limit == 10, "Default should be filled in")
+		assert(input.exact == nil, "Optional field without default should be omitted")
+
+		local missing, err = tools.scaffold_input("non_existent")
+		assert(missing == nil, "Result should be nil")
+		assert(err == "tool not found", "Error message should match")
+	`)
+	require.NoError(t, err)
+}
+
 func TestToolsIntegration(t *testing.T) {
 	// Skip if not integration test
 	if testing.Short() {
@@ -542,3 +1014,97 @@ func TestLuaToolExecution(t *testing.T) {
 	resultMap2 := result2.(map[string]interface{})
 	assert.Equal(t, float64(8), resultMap2["counter"])
 }
+
+func TestToolsRegisterValidator(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	stdlib.RegisterAsyncCallback(L)
+	stdlib.RegisterAsyncScheduler(L)
+
+	toolBridge := bridge.NewToolBridge(tools.NewRegistry())
+	require.NoError(t, RegisterToolsModule(L, toolBridge))
+
+	err := L.DoString(`
+		assert(tools.register_validator("isbn", function(value)
+			local digits = tostring(value):gsub("-", "")
+			if #digits ~= 13 then
+				return false, "must be a valid ISBN"
+			end
+			return true
+		end))
+
+		-- Rules may return a future, which is awaited
+		assert(tools.register_validator("available", function(value)
+			return async.run(function() return value ~= "9780000000000" end)
+		end))
+
+		assert(tools.register("lookup_book", "Looks up a book", {
+			type = "object",
+			properties = {
+				isbn = {type = "string", ["x-validate"] = {"isbn", "available"}},
+			},
+		}, function(params) return params.isbn end))
+
+		assert(tools.validate("lookup_book", {isbn = "978-0-13-468599-1"}))
+
+		local ok, err, problems = tools.validate("lookup_book", {isbn = "123"})
+		assert(ok == false)
+		assert(err == "field 'isbn' must be a valid ISBN", err)
+		assert(problems[1].code == "rule" and problems[1].field == "isbn")
+
+		ok, err = tools.validate("lookup_book", {isbn = "9780000000000"})
+		assert(ok == false)
+		assert(err == "field 'isbn' does not pass the available rule", err)
+
+		local res, regErr = tools.register_validator("", function() return true end)
+		assert(res == nil and regErr:find("name is required"))
+	`)
+	require.NoError(t, err)
+}
+
+func TestToolsRegisterDeterministic(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	toolBridge := bridge.NewToolBridge(tools.NewRegistry())
+	toolBridge.SetResultCache(bridge.NewMemoryCache(10, 1024), 0)
+	require.NoError(t, RegisterToolsModule(L, toolBridge))
+
+	err := L.DoString(`
+		local runs = 0
+		assert(tools.register("square", "Squares a number", {}, function(p)
+			runs = runs + 1
+			return p.n * p.n
+		end, {deterministic = true}))
+
+		assert(tools.execute("square", {n = 3}) == 9)
+		assert(tools.execute("square", {n = 3}) == 9)
+		assert(runs == 1, "Repeated calls should come from the cache")
+		assert(tools.get("square").deterministic == true)
+	`)
+	require.NoError(t, err)
+}
+
+func TestToolsRegisterConfirm(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	toolBridge := bridge.NewToolBridge(tools.NewRegistry())
+	toolBridge.SetConfirmer(security.NewToolConfirmer(security.ConfirmationPolicy{Mode: security.ConfirmDeny}, nil))
+	require.NoError(t, RegisterToolsModule(L, toolBridge))
+
+	err := L.DoString(`
+		local runs = 0
+		local function wipe() runs = runs + 1; return "wiped" end
+		assert(tools.register("wipe", "Wipes the scratch directory", {}, wipe, {confirm = true}))
+		assert(tools.register("peek", "Lists the scratch directory", {}, wipe))
+
+		local result, err = tools.execute("wipe", {})
+		assert(result == nil and err:find("not confirmed"), tostring(err))
+		assert(runs == 0, "A declined tool should not run")
+		assert(tools.execute("peek", {}) == "wiped")
+		assert(tools.get("wipe").requires_confirmation == true)
+		assert(tools.get("peek").requires_confirmation == false)
+	`)
+	require.NoError(t, err)
+}
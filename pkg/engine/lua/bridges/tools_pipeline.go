@@ -0,0 +1,162 @@
+// ABOUTME: Tool composition for the Lua tools module
+// ABOUTME: Builds pipeline tools that run steps in order, mapping each output into the next input
+
+package bridges
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// pipelineStep is one tool call in a pipeline
+type pipelineStep struct {
+	tool     string
+	mapInput *lua.LFunction
+}
+
+// toolsPipeline creates a Lua function for registering pipeline tools
+// Usage: ok, err = tools.pipeline(name, {"tool_a", {name = "tool_b", map_input = fn}}, description)
+func toolsPipeline(tb ToolBridgeInterface, converter *engLua.LuaConverter) lua.LGFunction {
+	return func(L *lua.LState) int {
+		name := L.CheckString(1)
+		stepsTable := L.CheckTable(2)
+
+		steps, err := parsePipelineSteps(stepsTable)
+		if err != nil {
+			L.ArgError(2, err.Error())
+			return 0
+		}
+
+		toolNames := make([]string, len(steps))
+		for i, step := range steps {
+			toolNames[i] = step.tool
+		}
+		description := L.OptString(3, "Pipeline: "+strings.Join(toolNames, " -> "))
+
+		// The pipeline accepts whatever its first step accepts, unless the
+		// first step maps its input
+		parameters := map[string]interface{}{"type": "object"}
+		if steps[0].mapInput == nil {
+			if info, err := tb.GetTool(steps[0].tool); err == nil {
+				if params, ok := info["parameters"].(map[string]interface{}); ok {
+					parameters = params
+				}
+			}
+		}
+
+		// Each step runs under the context of the call to the pipeline, so
+		// cancelling the caller, such as an agent, stops the pipeline
+		run := func(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+			return runPipeline(ctx, L, tb, converter, steps, input)
+		}
+
+		if err := tb.RegisterToolWith(name, description, parameters, run, bridge.ToolOptions{}); err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		L.Push(lua.LTrue)
+		return 1
+	}
+}
+
+// parsePipelineSteps reads steps given either as tool names or as
+// {name = tool, map_input = fn} tables
+func parsePipelineSteps(stepsTable *lua.LTable) ([]pipelineStep, error) {
+	steps := []pipelineStep{}
+
+	for i := 1; i <= stepsTable.Len(); i++ {
+		switch v := stepsTable.RawGetInt(i).(type) {
+		case lua.LString:
+			steps = append(steps, pipelineStep{tool: string(v)})
+		case *lua.LTable:
+			toolName, ok := v.RawGetString("name").(lua.LString)
+			if !ok || toolName == "" {
+				return nil, fmt.Errorf("step %d must have a tool name", i)
+			}
+			step := pipelineStep{tool: string(toolName)}
+			switch mapper := v.RawGetString("map_input").(type) {
+			case *lua.LFunction:
+				step.mapInput = mapper
+			case *lua.LNilType:
+			default:
+				return nil, fmt.Errorf("step %d: map_input must be a function", i)
+			}
+			steps = append(steps, step)
+		default:
+			return nil, fmt.Errorf("step %d must be a tool name or table", i)
+		}
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("pipeline needs at least one step")
+	}
+
+	return steps, nil
+}
+
+// runPipeline executes the steps in order, stopping at the first error
+func runPipeline(ctx context.Context, L *lua.LState, tb ToolBridgeInterface, converter *engLua.LuaConverter, steps []pipelineStep, input map[string]interface{}) (interface{}, error) {
+	var current interface{} = input
+
+	for i, step := range steps {
+		if step.mapInput != nil {
+			mapped, err := callMapper(ctx, L, converter, step.mapInput, current)
+			if err != nil {
+				return nil, fmt.Errorf("pipeline step %d (%s): map_input failed: %w", i+1, step.tool, err)
+			}
+			current = mapped
+		}
+
+		params, ok := current.(map[string]interface{})
+		if !ok {
+			if current != nil {
+				return nil, fmt.Errorf("pipeline step %d (%s): input must be a table, got %T", i+1, step.tool, current)
+			}
+			params = make(map[string]interface{})
+		}
+
+		result, err := tb.ExecuteTool(ctx, step.tool, params)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline step %d (%s): %w", i+1, step.tool, err)
+		}
+		current = result
+	}
+
+	return current, nil
+}
+
+// callMapper calls a Lua mapping function with the previous step's output,
+// through callLua, since a pipeline may run on an agent's goroutine. Like
+// tool handlers, a mapper may return nil, "error" to fail the pipeline.
+func callMapper(ctx context.Context, L *lua.LState, converter *engLua.LuaConverter, fn *lua.LFunction, value interface{}) (result interface{}, err error) {
+	var failed error
+	err = callLua(ctx, L, "map_input", 0, func() error {
+		L.Push(fn)
+		L.Push(converter.ToLua(value))
+		if err := L.PCall(1, 2, nil); err != nil {
+			return err
+		}
+
+		if errVal := L.Get(-1); errVal.Type() == lua.LTString {
+			failed = fmt.Errorf("%s", errVal.String())
+			return nil
+		}
+
+		result = converter.ToInterface(L.Get(-2))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if failed != nil {
+		return nil, failed
+	}
+	return result, nil
+}
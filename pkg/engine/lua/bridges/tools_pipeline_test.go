@@ -0,0 +1,179 @@
+// ABOUTME: Tests for pipeline tools in the Lua tools module
+// ABOUTME: Verifies step ordering, input mapping, short-circuiting on errors, and the caller's context
+
+package bridges
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestToolsPipeline(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+
+	calls := []string{}
+	mockBridge.tools["fetch"] = &mockToolInfo{
+		name:       "fetch",
+		parameters: map[string]interface{}{"type": "object", "required": []interface{}{"url"}},
+		handler: func(p map[string]interface{}) (interface{}, error) {
+			calls = append(calls, "fetch")
+			return map[string]interface{}{"content": "page at " + p["url"].(string)}, nil
+		},
+	}
+	mockBridge.tools["upper"] = &mockToolInfo{
+		name: "upper",
+		handler: func(p map[string]interface{}) (interface{}, error) {
+			calls = append(calls, "upper")
+			return map[string]interface{}{"text": "UPPER(" + p["text"].(string) + ")"}, nil
+		},
+	}
+	mockBridge.tools["broken"] = &mockToolInfo{
+		name: "broken",
+		handler: func(p map[string]interface{}) (interface{}, error) {
+			calls = append(calls, "broken")
+			return nil, errors.New("boom")
+		},
+	}
+
+	t.Run("runs steps in order", func(t *testing.T) {
+		calls = nil
+		err := L.DoString(`
+			local ok, err = tools.pipeline("fetch_upper", {
+				"fetch",
+				{name = "upper", map_input = function(prev) return {text = prev.content} end},
+			})
+			assert(ok == true and err == nil, "Pipeline should register")
+
+			local result, err = tools.execute("fetch_upper", {url = "example.com"})
+			assert(err == nil, "Pipeline should succeed: " .. tostring(err))
+			assert(result.text == "UPPER(page at example.com)", "Unexpected result: " .. tostring(result.text))
+		`)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"fetch", "upper"}, calls)
+
+		info := mockBridge.tools["fetch_upper"]
+		assert.Equal(t, "Pipeline: fetch -> upper", info.description)
+		assert.Equal(t, mockBridge.tools["fetch"].parameters, info.parameters)
+	})
+
+	t.Run("short-circuits on tool error", func(t *testing.T) {
+		calls = nil
+		err := L.DoString(`
+			assert(tools.pipeline("fails", {"fetch", {name = "broken", map_input = function(prev) return {} end}, "upper"}))
+			local result, err = tools.execute("fails", {url = "x"})
+			assert(result == nil, "Result should be nil")
+			assert(err:find("pipeline step 2 %(broken%): boom"), "Unexpected error: " .. err)
+		`)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"fetch", "broken"}, calls)
+	})
+
+	t.Run("short-circuits on mapper error", func(t *testing.T) {
+		calls = nil
+		err := L.DoString(`
+			assert(tools.pipeline("bad_map", {
+				"fetch",
+				{name = "upper", map_input = function(prev) return nil, "no content" end},
+			}))
+			local result, err = tools.execute("bad_map", {url = "x"})
+			assert(result == nil, "Result should be nil")
+			assert(err:find("map_input failed: no content"), "Unexpected error: " .. err)
+		`)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"fetch"}, calls)
+	})
+
+	t.Run("rejects invalid steps", func(t *testing.T) {
+		err := L.DoString(`tools.pipeline("empty", {})`)
+		assert.Error(t, err)
+
+		err = L.DoString(`tools.pipeline("bad", {{map_input = function() end}})`)
+		assert.Error(t, err)
+	})
+}
+
+func TestToolsPipelineContext(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	mockBridge := newMockToolBridge()
+	require.NoError(t, RegisterToolsModule(L, mockBridge))
+
+	type key struct{}
+	seen := []interface{}{}
+	step := func(ctx context.Context, p map[string]interface{}) (interface{}, error) {
+		seen = append(seen, ctx.Value(key{}))
+		return p, ctx.Err()
+	}
+	require.NoError(t, mockBridge.RegisterToolWith("first", "", nil, step, bridge.ToolOptions{}))
+	require.NoError(t, mockBridge.RegisterToolWith("second", "", nil, step, bridge.ToolOptions{}))
+	require.NoError(t, L.DoString(`assert(tools.pipeline("both", {"first", "second"}))`))
+
+	// Every step runs under the context the pipeline is called with
+	ctx := context.WithValue(context.Background(), key{}, "caller")
+	_, err := mockBridge.ExecuteTool(ctx, "both", map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"caller", "caller"}, seen)
+
+	// A cancelled caller stops the pipeline at its next step
+	seen = nil
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = mockBridge.ExecuteTool(cancelled, "both", map[string]interface{}{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, seen, 1)
+}
+
+func TestToolsPipelineReentry(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	converter := engLua.NewLuaConverter(L)
+
+	L.SetGlobal("explode", L.NewFunction(func(*lua.LState) int { panic("boom") }))
+	require.NoError(t, L.DoString(`
+		mapped = 0
+		function count(p) mapped = mapped + 1 return p end
+		function fail(p) explode() end
+	`))
+	count := L.GetGlobal("count").(*lua.LFunction)
+
+	// Mappers called from other goroutines, as in pipelines agents run,
+	// take turns in the state
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := callMapper(context.Background(), L, converter, count, map[string]interface{}{})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, lua.LNumber(20), L.GetGlobal("mapped"))
+
+	// A panic in a mapper fails the call, and the stack is restored
+	_, err := callMapper(context.Background(), L, converter, L.GetGlobal("fail").(*lua.LFunction), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+	assert.Equal(t, 0, L.GetTop())
+
+	// A cancelled caller stops the mapper
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, L.DoString(`function spin(p) while true do end end`))
+	_, err = callMapper(ctx, L, converter, L.GetGlobal("spin").(*lua.LFunction), nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, L.Context(), "The state's own context should be restored")
+}
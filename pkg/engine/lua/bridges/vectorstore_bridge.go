@@ -0,0 +1,210 @@
+// ABOUTME: Lua bridge for vector stores, exposing the vectorstore module to scripts
+// ABOUTME: Provides upsert, query, delete, namespaces, and drop; text is embedded through the embeddings bridge
+
+package bridges
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	engLua "github.com/lexlapax/go-llmspell/pkg/engine/lua"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// RegisterVectorStoreModule registers the vectorstore module in Lua.
+// Every function takes the namespace first. Records are tables of id,
+// vector or text, and metadata; records and queries given as text are
+// embedded first. Functions return nil and an error message on failure.
+func RegisterVectorStoreModule(L *lua.LState, vb *bridge.VectorStoreBridge) error {
+	mod := L.NewTable()
+	converter := engLua.NewLuaConverter(L)
+
+	// upsert(namespace, records) stores records and returns how many
+	L.SetField(mod, "upsert", L.NewFunction(func(L *lua.LState) int {
+		namespace := L.CheckString(1)
+		list := L.CheckTable(2)
+		records := make([]bridge.VectorRecord, list.Len())
+		for i := range records {
+			record, err := vectorRecord(converter.ToInterface(list.RawGetInt(i + 1)))
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(fmt.Sprintf("record %d: %v", i+1, err)))
+				return 2
+			}
+			records[i] = record
+		}
+		if err := vb.Upsert(scriptContext(L), namespace, records); err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(lua.LNumber(len(records)))
+		return 1
+	}))
+
+	// query(namespace, query) returns {id, score, text, metadata} for the
+	// records most similar to query, most similar first. query is text, or
+	// a table of vector or text, top_k (10 by default), and filter, which
+	// keeps records whose metadata has each of its keys with an equal value.
+	L.SetField(mod, "query", L.NewFunction(func(L *lua.LState) int {
+		namespace := L.CheckString(1)
+		var query bridge.VectorQuery
+		switch arg := L.CheckAny(2).(type) {
+		case lua.LString:
+			query.Text = string(arg)
+		case *lua.LTable:
+			fields, _ := converter.ToInterface(arg).(map[string]interface{})
+			var err error
+			if query.Vector, err = vectorValue(fields["vector"]); err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString("query vector: " + err.Error()))
+				return 2
+			}
+			query.Text, _ = fields["text"].(string)
+			if topK, ok := fields["top_k"].(float64); ok {
+				query.TopK = int(topK)
+			}
+			query.Filter, _ = fields["filter"].(map[string]interface{})
+		default:
+			L.ArgError(2, "expected text or a query table")
+			return 0
+		}
+
+		matches, err := vb.Query(scriptContext(L), namespace, query)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		result := L.CreateTable(len(matches), 0)
+		for _, match := range matches {
+			entry := L.NewTable()
+			L.SetField(entry, "id", lua.LString(match.ID))
+			L.SetField(entry, "score", lua.LNumber(match.Score))
+			if match.Text != "" {
+				L.SetField(entry, "text", lua.LString(match.Text))
+			}
+			if match.Metadata != nil {
+				L.SetField(entry, "metadata", converter.ToLua(match.Metadata))
+			}
+			result.Append(entry)
+		}
+		L.Push(result)
+		return 1
+	}))
+
+	// delete(namespace, ids) removes records by id, one or a list of them
+	L.SetField(mod, "delete", L.NewFunction(func(L *lua.LState) int {
+		namespace := L.CheckString(1)
+		var ids []string
+		switch arg := L.CheckAny(2).(type) {
+		case *lua.LTable:
+			for i := 1; i <= arg.Len(); i++ {
+				id, err := recordID(converter.ToInterface(arg.RawGetInt(i)))
+				if err != nil {
+					L.Push(lua.LNil)
+					L.Push(lua.LString(fmt.Sprintf("id %d: %v", i, err)))
+					return 2
+				}
+				ids = append(ids, id)
+			}
+		default:
+			id, err := recordID(converter.ToInterface(arg))
+			if err != nil {
+				L.ArgError(2, err.Error())
+				return 0
+			}
+			ids = []string{id}
+		}
+		if err := vb.Delete(scriptContext(L), namespace, ids); err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(lua.LTrue)
+		return 1
+	}))
+
+	L.SetField(mod, "namespaces", L.NewFunction(func(L *lua.LState) int {
+		names, err := vb.Namespaces(scriptContext(L))
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		result := L.CreateTable(len(names), 0)
+		for _, name := range names {
+			result.Append(lua.LString(name))
+		}
+		L.Push(result)
+		return 1
+	}))
+
+	// drop(namespace) deletes a namespace and its records
+	L.SetField(mod, "drop", L.NewFunction(func(L *lua.LState) int {
+		if err := vb.Drop(scriptContext(L), L.CheckString(1)); err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(lua.LTrue)
+		return 1
+	}))
+
+	L.SetGlobal("vectorstore", mod)
+	return nil
+}
+
+// vectorRecord reads a record converted from a script
+func vectorRecord(item interface{}) (bridge.VectorRecord, error) {
+	fields, ok := item.(map[string]interface{})
+	if !ok {
+		return bridge.VectorRecord{}, fmt.Errorf("must be a table with an id")
+	}
+	id, err := recordID(fields["id"])
+	if err != nil {
+		return bridge.VectorRecord{}, err
+	}
+	vector, err := vectorValue(fields["vector"])
+	if err != nil {
+		return bridge.VectorRecord{}, fmt.Errorf("vector: %w", err)
+	}
+	record := bridge.VectorRecord{ID: id, Vector: vector}
+	record.Text, _ = fields["text"].(string)
+	record.Metadata, _ = fields["metadata"].(map[string]interface{})
+	return record, nil
+}
+
+// recordID reads an id, a string or a number
+func recordID(value interface{}) (string, error) {
+	switch id := value.(type) {
+	case string:
+		if id != "" {
+			return id, nil
+		}
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("an id must be a non-empty string or a number")
+}
+
+// vectorValue reads an optional list of numbers
+func vectorValue(value interface{}) ([]float64, error) {
+	if value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be a list of numbers")
+	}
+	vector := make([]float64, len(list))
+	for i, item := range list {
+		n, ok := item.(float64)
+		if !ok {
+			return nil, fmt.Errorf("element %d is not a number", i+1)
+		}
+		vector[i] = n
+	}
+	return vector, nil
+}
@@ -0,0 +1,62 @@
+// ABOUTME: Tests for the Lua vectorstore bridge
+// ABOUTME: Verifies upserts of vectors and text, queries with filters, deletes, namespaces, and errors from Lua
+
+package bridges
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestVectorStoreBridge(t *testing.T) {
+	eb := &bridge.EmbeddingsBridge{}
+	eb.SetEmbedder("words", wordEmbedder{})
+	store := bridge.NewMemoryVectorStore()
+	L := lua.NewState()
+	defer L.Close()
+	require.NoError(t, RegisterVectorStoreModule(L, bridge.NewVectorStoreBridge(store, eb.EmbedBatch)))
+
+	err := L.DoString(`
+		local n = vectorstore.upsert("pets", {
+			{id = "c1", text = "cat", metadata = {kind = "feline"}},
+			{id = "d1", text = "dog", metadata = {kind = "canine"}},
+			{id = 7, vector = {1, 1}, metadata = {kind = "feline"}},
+		})
+		assert(n == 3)
+
+		local matches = vectorstore.query("pets", "cat")
+		assert(#matches == 3 and matches[1].id == "c1" and matches[1].score == 1)
+		assert(matches[1].text == "cat" and matches[1].metadata.kind == "feline")
+		assert(matches[3].id == "d1")
+
+		local matches = vectorstore.query("pets", {vector = {0, 1}, top_k = 1, filter = {kind = "feline"}})
+		assert(#matches == 1 and matches[1].id == "7")
+
+		assert(vectorstore.delete("pets", {"c1", 7}) == true)
+		assert(vectorstore.delete("pets", "d1") == true)
+		assert(#vectorstore.query("pets", "cat") == 0)
+
+		assert(vectorstore.upsert("notes", {}) == 0)
+		vectorstore.upsert("notes", {{id = "n", vector = {1, 0}}})
+		local namespaces = vectorstore.namespaces()
+		assert(#namespaces == 1 and namespaces[1] == "notes")
+		assert(vectorstore.drop("notes") == true)
+
+		local n, err = vectorstore.upsert("pets", {{id = "x"}})
+		assert(n == nil and err:find("record 1: a vector or text is required"))
+		local n, err = vectorstore.upsert("pets", {{text = "cat"}})
+		assert(n == nil and err:find("record 1: an id"))
+		local matches, err = vectorstore.query("bad/name", "cat")
+		assert(matches == nil and err:find("invalid namespace"))
+	`)
+	require.NoError(t, err)
+
+	namespaces, err := store.Namespaces(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, namespaces)
+}
@@ -15,6 +15,17 @@ import (
 	lua "github.com/yuin/gopher-lua"
 )
 
+func init() {
+	// Make Lua available to engine discovery, e.g. for sub-spells
+	_ = engine.RegisterEngineWithMetadata("lua", func(config engine.Config) (engine.Engine, error) {
+		return NewLuaEngine(&config)
+	}, engine.EngineMetadata{
+		Description:    "Lua 5.1 via gopher-lua",
+		FileExtensions: []string{".lua"},
+		MimeTypes:      []string{"text/x-lua"},
+	})
+}
+
 // LuaEngine implements the Engine interface for Lua scripts
 type LuaEngine struct {
 	vm               *lua.LState
@@ -58,6 +69,7 @@ func (e *LuaEngine) initVM() error {
 
 	// Close existing VM if any
 	if e.vm != nil {
+		stdlib.Cleanup(e.vm)
 		e.vm.Close()
 	}
 
@@ -131,8 +143,8 @@ func (e *LuaEngine) LoadScript(reader io.Reader) error {
 		return fmt.Errorf("failed to read script: %w", err)
 	}
 
-	// Compile the script
-	fn, err := e.vm.LoadString(string(script))
+	// Compile the script; a #! line is skipped, as LoadFile does
+	fn, err := e.vm.LoadString(string(engine.StripShebang(script)))
 	if err != nil {
 		return fmt.Errorf("failed to compile script: %w", err)
 	}
@@ -178,8 +190,10 @@ func (e *LuaEngine) Execute(ctx context.Context) error {
 	// Update VM context
 	e.vm.SetContext(ctx)
 
-	// Run the script (synchronously to avoid race conditions)
-	err := e.vm.PCall(0, lua.MultRet, nil)
+	// Run the script (synchronously to avoid race conditions). A cancelled
+	// script says why it stopped, not just "context canceled".
+	err := engine.WrapCancel(ctx, e.vm.PCall(0, lua.MultRet, nil))
+	stdlib.SetExitError(e.vm, err)
 	e.mu.Unlock()
 
 	if err != nil {
@@ -189,6 +203,28 @@ func (e *LuaEngine) Execute(ctx context.Context) error {
 	return nil
 }
 
+// ExecuteResult runs the loaded script and returns the first value it
+// returns, converted to Go
+func (e *LuaEngine) ExecuteResult(ctx context.Context) (interface{}, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.loaded {
+		return nil, fmt.Errorf("no script loaded")
+	}
+
+	e.vm.SetContext(ctx)
+	err := engine.WrapCancel(ctx, e.vm.PCall(0, 1, nil))
+	stdlib.SetExitError(e.vm, err)
+	if err != nil {
+		return nil, fmt.Errorf("script execution failed: %w", err)
+	}
+
+	result := e.vm.Get(-1)
+	e.vm.Pop(1)
+	return NewLuaConverter(e.vm).ToInterface(result), nil
+}
+
 // RegisterFunction registers a Go function to be callable from Lua
 func (e *LuaEngine) RegisterFunction(name string, fn interface{}) error {
 	e.mu.Lock()
@@ -255,6 +291,7 @@ func (e *LuaEngine) Close() error {
 	}
 
 	if e.vm != nil {
+		stdlib.Cleanup(e.vm)
 		e.vm.Close()
 		e.vm = nil
 	}
@@ -351,6 +388,8 @@ func goToLua(L *lua.LState, value interface{}) (lua.LValue, error) {
 		return lua.LString(v), nil
 	case []byte:
 		return lua.LString(string(v)), nil
+	case map[string]interface{}, []interface{}:
+		return NewLuaConverter(L).ToLua(v), nil
 	default:
 		// For complex types, we'll implement proper conversion in conversions.go
 		return lua.LNil, fmt.Errorf("unsupported type: %T", value)
@@ -5,11 +5,13 @@ package lua
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/lexlapax/go-llmspell/pkg/engine"
+	"github.com/lexlapax/go-llmspell/pkg/engine/lua/stdlib"
 )
 
 // TestNewLuaEngine tests engine creation
@@ -160,6 +162,38 @@ func TestExecute(t *testing.T) {
 	}
 }
 
+// TestExecuteResult tests returning values from scripts and the engine registry entry
+func TestExecuteResult(t *testing.T) {
+	eng, err := engine.CreateEngine("lua", engine.Config{MaxExecutionTime: 5})
+	if err != nil {
+		t.Fatalf("failed to create engine from registry: %v", err)
+	}
+	luaEng := eng.(*LuaEngine)
+	defer luaEng.Close()
+
+	if err := eng.SetVariable("params", map[string]interface{}{"n": 2}); err != nil {
+		t.Fatalf("failed to set table variable: %v", err)
+	}
+	if err := eng.LoadScript(strings.NewReader(`return {doubled = params.n * 2, tags = {"a", "b"}}`)); err != nil {
+		t.Fatalf("failed to load script: %v", err)
+	}
+
+	result, err := luaEng.ExecuteResult(context.Background())
+	if err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	values, ok := result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a map, got %T", result)
+	}
+	if values["doubled"] != float64(4) {
+		t.Errorf("expected doubled = 4, got %v", values["doubled"])
+	}
+	if tags, ok := values["tags"].([]interface{}); !ok || len(tags) != 2 {
+		t.Errorf("expected two tags, got %v", values["tags"])
+	}
+}
+
 // TestRegisterFunction tests function registration
 func TestRegisterFunction(t *testing.T) {
 	tests := []struct {
@@ -358,6 +392,30 @@ func TestContextCancellation(t *testing.T) {
 	}
 }
 
+// TestCancellationCause tests that a cancelled script reports why it stopped
+func TestCancellationCause(t *testing.T) {
+	eng, err := NewLuaEngine(nil)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer eng.Close()
+
+	if err := eng.LoadScript(strings.NewReader(`while true do end`)); err != nil {
+		t.Fatalf("failed to load script: %v", err)
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(10*time.Millisecond, func() { cancel(engine.ErrInterrupted) })
+
+	err = eng.Execute(ctx)
+	if !errors.Is(err, engine.ErrInterrupted) {
+		t.Errorf("expected the interrupt cause, got %v", err)
+	}
+	if !errors.Is(stdlib.CancelCause(eng.GetLuaState()), engine.ErrInterrupted) {
+		t.Error("expected cleanup hooks to see the interrupt cause")
+	}
+}
+
 // TestLoadScriptFile tests loading scripts from files
 func TestLoadScriptFile(t *testing.T) {
 	eng, err := NewLuaEngine(nil)
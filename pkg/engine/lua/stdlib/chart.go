@@ -0,0 +1,506 @@
+// ABOUTME: Chart module for Lua scripts
+// ABOUTME: Renders line, bar, scatter, and pie charts from data series as SVG or PNG
+
+package stdlib
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ChartSeries is one named data series
+type ChartSeries struct {
+	Name  string
+	X     []float64 // optional for line charts, required for scatter
+	Y     []float64
+	Color string // "#rrggbb"; defaults to the palette
+}
+
+// ChartSpec describes a chart to render
+type ChartSpec struct {
+	Type   string // line, bar, scatter, or pie
+	Title  string
+	XLabel string
+	YLabel string
+	Width  int
+	Height int
+	Labels []string // category labels for bar and pie charts, x labels for line charts
+	Series []ChartSeries
+}
+
+var chartPalette = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7"}
+
+var (
+	chartInk  = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	chartGrid = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+)
+
+// RegisterChart registers the chart module; files are written through fs
+func RegisterChart(L *lua.LState, fs *FS) {
+	chartModule := L.NewTable()
+
+	L.SetField(chartModule, "svg", L.NewFunction(chartRender(RenderChartSVG)))
+	L.SetField(chartModule, "png", L.NewFunction(chartRender(RenderChartPNG)))
+	L.SetField(chartModule, "save", L.NewFunction(func(L *lua.LState) int {
+		return chartSave(L, fs)
+	}))
+
+	L.SetGlobal("chart", chartModule)
+}
+
+// chartRender wraps a renderer as a Lua function
+// Usage: data, err = chart.svg(spec) / chart.png(spec)
+func chartRender(render func(ChartSpec) ([]byte, error)) lua.LGFunction {
+	return func(L *lua.LState) int {
+		spec, err := parseChartSpec(L.CheckTable(1))
+		if err != nil {
+			return pushError(L, err)
+		}
+
+		data, err := render(spec)
+		if err != nil {
+			return pushError(L, err)
+		}
+
+		L.Push(lua.LString(data))
+		return 1
+	}
+}
+
+// chartSave renders a chart to a file, choosing the format from its extension
+// Usage: err = chart.save(path, spec)
+func chartSave(L *lua.LState, fs *FS) int {
+	path := L.CheckString(1)
+	spec, err := parseChartSpec(L.CheckTable(2))
+	if err != nil {
+		return pushOptionalError(L, err)
+	}
+
+	if _, err := fs.CheckWrite(path); err != nil {
+		return pushOptionalError(L, err)
+	}
+
+	var data []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".svg":
+		data, err = RenderChartSVG(spec)
+	case ".png":
+		data, err = RenderChartPNG(spec)
+	default:
+		err = fmt.Errorf("unsupported chart format %q (use .svg or .png)", filepath.Ext(path))
+	}
+	if err != nil {
+		return pushOptionalError(L, err)
+	}
+
+	return pushOptionalError(L, fs.WriteFile(path, data))
+}
+
+// parseChartSpec reads a chart spec from a Lua table. A top-level values list
+// is shorthand for a single series.
+func parseChartSpec(tbl *lua.LTable) (ChartSpec, error) {
+	spec := ChartSpec{
+		Type:   lua.LVAsString(tbl.RawGetString("type")),
+		Title:  lua.LVAsString(tbl.RawGetString("title")),
+		XLabel: lua.LVAsString(tbl.RawGetString("x_label")),
+		YLabel: lua.LVAsString(tbl.RawGetString("y_label")),
+		Width:  int(lua.LVAsNumber(tbl.RawGetString("width"))),
+		Height: int(lua.LVAsNumber(tbl.RawGetString("height"))),
+		Labels: luaStrings(tbl.RawGetString("labels")),
+	}
+
+	if series, ok := tbl.RawGetString("series").(*lua.LTable); ok {
+		var err error
+		series.ForEach(func(_, v lua.LValue) {
+			s, ok := v.(*lua.LTable)
+			if !ok {
+				err = fmt.Errorf("each series must be a table")
+				return
+			}
+			spec.Series = append(spec.Series, ChartSeries{
+				Name:  lua.LVAsString(s.RawGetString("name")),
+				X:     luaNumbers(s.RawGetString("x")),
+				Y:     luaNumbers(s.RawGetString("values")),
+				Color: lua.LVAsString(s.RawGetString("color")),
+			})
+		})
+		if err != nil {
+			return spec, err
+		}
+	} else if values := luaNumbers(tbl.RawGetString("values")); values != nil {
+		spec.Series = []ChartSeries{{Y: values, X: luaNumbers(tbl.RawGetString("x"))}}
+	}
+
+	return spec, nil
+}
+
+// luaNumbers converts a Lua array to floats, or nil if it is not a table
+func luaNumbers(lv lua.LValue) []float64 {
+	tbl, ok := lv.(*lua.LTable)
+	if !ok {
+		return nil
+	}
+	values := make([]float64, 0, tbl.Len())
+	for i := 1; i <= tbl.Len(); i++ {
+		values = append(values, float64(lua.LVAsNumber(tbl.RawGetInt(i))))
+	}
+	return values
+}
+
+// luaStrings converts a Lua array to strings, or nil if it is not a table
+func luaStrings(lv lua.LValue) []string {
+	tbl, ok := lv.(*lua.LTable)
+	if !ok {
+		return nil
+	}
+	values := make([]string, 0, tbl.Len())
+	for i := 1; i <= tbl.Len(); i++ {
+		values = append(values, lua.LVAsString(tbl.RawGetInt(i)))
+	}
+	return values
+}
+
+// RenderChartSVG renders a chart as SVG markup
+func RenderChartSVG(spec ChartSpec) ([]byte, error) {
+	spec, err := normalizeChart(spec)
+	if err != nil {
+		return nil, err
+	}
+	c := newSVGCanvas(spec.Width, spec.Height)
+	drawChart(c, spec)
+	return c.encode()
+}
+
+// RenderChartPNG renders a chart as a PNG image
+func RenderChartPNG(spec ChartSpec) ([]byte, error) {
+	spec, err := normalizeChart(spec)
+	if err != nil {
+		return nil, err
+	}
+	c := newPNGCanvas(spec.Width, spec.Height)
+	drawChart(c, spec)
+	return c.encode()
+}
+
+// normalizeChart validates a spec and fills in defaults
+func normalizeChart(spec ChartSpec) (ChartSpec, error) {
+	if spec.Type == "" {
+		spec.Type = "line"
+	}
+	if spec.Width <= 0 {
+		spec.Width = 640
+	}
+	if spec.Height <= 0 {
+		spec.Height = 400
+	}
+	if spec.Width > 4096 || spec.Height > 4096 {
+		return spec, fmt.Errorf("chart size %dx%d exceeds 4096x4096", spec.Width, spec.Height)
+	}
+	if len(spec.Series) == 0 {
+		return spec, fmt.Errorf("chart has no data series")
+	}
+
+	for i := range spec.Series {
+		s := &spec.Series[i]
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("Series %d", i+1)
+		}
+		if s.Color == "" {
+			s.Color = chartPalette[i%len(chartPalette)]
+		}
+		if _, err := parseHexColor(s.Color); err != nil {
+			return spec, err
+		}
+		if len(s.X) > 0 && len(s.X) != len(s.Y) {
+			return spec, fmt.Errorf("series %q has %d x values but %d y values", s.Name, len(s.X), len(s.Y))
+		}
+	}
+
+	switch spec.Type {
+	case "line", "bar":
+	case "scatter":
+		for _, s := range spec.Series {
+			if len(s.X) == 0 {
+				return spec, fmt.Errorf("scatter series %q needs x values", s.Name)
+			}
+		}
+	case "pie":
+		for _, v := range spec.Series[0].Y {
+			if v < 0 {
+				return spec, fmt.Errorf("pie chart values must not be negative")
+			}
+		}
+	default:
+		return spec, fmt.Errorf("unknown chart type %q (use line, bar, scatter, or pie)", spec.Type)
+	}
+
+	return spec, nil
+}
+
+// parseHexColor parses a "#rrggbb" color
+func parseHexColor(s string) (color.RGBA, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	if err != nil || len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("invalid color %q (use #rrggbb)", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
+}
+
+func seriesColor(s ChartSeries) color.RGBA {
+	c, _ := parseHexColor(s.Color)
+	return c
+}
+
+func paletteColor(i int) color.RGBA {
+	c, _ := parseHexColor(chartPalette[i%len(chartPalette)])
+	return c
+}
+
+// chartArea is the plotting rectangle inside the margins
+type chartArea struct {
+	left, top, right, bottom float64
+}
+
+// drawChart lays out a normalized chart on a canvas
+func drawChart(c canvas, spec ChartSpec) {
+	w, h := float64(spec.Width), float64(spec.Height)
+	area := chartArea{left: 60, top: 20, right: w - 20, bottom: h - 40}
+	if spec.Title != "" {
+		c.text(w/2, 20, spec.Title, "middle", chartInk)
+		area.top = 40
+	}
+	if spec.XLabel != "" {
+		c.text((area.left+area.right)/2, h-8, spec.XLabel, "middle", chartInk)
+		area.bottom = h - 50
+	}
+	if spec.YLabel != "" {
+		c.text(8, area.top-8, spec.YLabel, "start", chartInk)
+	}
+
+	var legend []string
+	var colors []color.RGBA
+	if spec.Type == "pie" {
+		legend = pieLegend(spec)
+		for i := range legend {
+			colors = append(colors, paletteColor(i))
+		}
+	} else if len(spec.Series) > 1 {
+		for _, s := range spec.Series {
+			legend = append(legend, s.Name)
+			colors = append(colors, seriesColor(s))
+		}
+	}
+	if len(legend) > 0 {
+		area.right = w - 150
+		for i, name := range legend {
+			y := area.top + float64(i)*18
+			c.rect(area.right+20, y, 10, 10, colors[i])
+			c.text(area.right+36, y+10, name, "start", chartInk)
+		}
+	}
+
+	switch spec.Type {
+	case "pie":
+		drawPie(c, spec, area)
+	case "bar":
+		drawBars(c, spec, area)
+	default:
+		drawXY(c, spec, area)
+	}
+}
+
+// pieLegend labels each slice with its share of the total
+func pieLegend(spec ChartSpec) []string {
+	values := spec.Series[0].Y
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	legend := make([]string, len(values))
+	for i, v := range values {
+		label := fmt.Sprintf("Slice %d", i+1)
+		if i < len(spec.Labels) {
+			label = spec.Labels[i]
+		}
+		pct := 0.0
+		if total > 0 {
+			pct = v / total * 100
+		}
+		legend[i] = fmt.Sprintf("%s (%.0f%%)", label, pct)
+	}
+	return legend
+}
+
+func drawPie(c canvas, spec ChartSpec, area chartArea) {
+	values := spec.Series[0].Y
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	if total == 0 {
+		return
+	}
+
+	cx, cy := (area.left+area.right)/2, (area.top+area.bottom)/2
+	r := math.Min(area.right-area.left, area.bottom-area.top) / 2
+	start := -math.Pi / 2
+	for i, v := range values {
+		end := start + v/total*2*math.Pi
+		c.wedge(cx, cy, r, start, end, paletteColor(i))
+		start = end
+	}
+}
+
+// drawAxes draws the y grid with tick labels and returns the value-to-pixel mapping
+func drawAxes(c canvas, area chartArea, lo, hi float64) func(float64) float64 {
+	ticks := niceTicks(lo, hi, 5)
+	lo, hi = math.Min(lo, ticks[0]), math.Max(hi, ticks[len(ticks)-1])
+	toY := func(v float64) float64 {
+		return area.bottom - (v-lo)/(hi-lo)*(area.bottom-area.top)
+	}
+
+	for _, t := range ticks {
+		y := toY(t)
+		c.line(area.left, y, area.right, y, chartGrid, 1)
+		c.text(area.left-6, y+4, formatTick(t), "end", chartInk)
+	}
+	c.line(area.left, area.top, area.left, area.bottom, chartInk, 1)
+	c.line(area.left, area.bottom, area.right, area.bottom, chartInk, 1)
+	return toY
+}
+
+func drawBars(c canvas, spec ChartSpec, area chartArea) {
+	n := 0
+	lo, hi := 0.0, 0.0
+	for _, s := range spec.Series {
+		n = max(n, len(s.Y))
+		for _, v := range s.Y {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+	}
+	if n == 0 {
+		return
+	}
+	toY := drawAxes(c, area, lo, hi)
+
+	group := (area.right - area.left) / float64(n)
+	bar := group * 0.8 / float64(len(spec.Series))
+	for i := 0; i < n; i++ {
+		x := area.left + group*float64(i) + group*0.1
+		for j, s := range spec.Series {
+			if i >= len(s.Y) {
+				continue
+			}
+			top, base := toY(math.Max(s.Y[i], 0)), toY(math.Min(s.Y[i], 0))
+			c.rect(x+bar*float64(j), top, bar, base-top, seriesColor(s))
+		}
+		label := strconv.Itoa(i + 1)
+		if i < len(spec.Labels) {
+			label = spec.Labels[i]
+		}
+		c.text(area.left+group*(float64(i)+0.5), area.bottom+16, label, "middle", chartInk)
+	}
+}
+
+func drawXY(c canvas, spec ChartSpec, area chartArea) {
+	xs := func(s ChartSeries, i int) float64 {
+		if len(s.X) > 0 {
+			return s.X[i]
+		}
+		return float64(i)
+	}
+
+	xlo, xhi := math.Inf(1), math.Inf(-1)
+	ylo, yhi := math.Inf(1), math.Inf(-1)
+	for _, s := range spec.Series {
+		for i, v := range s.Y {
+			xlo, xhi = math.Min(xlo, xs(s, i)), math.Max(xhi, xs(s, i))
+			ylo, yhi = math.Min(ylo, v), math.Max(yhi, v)
+		}
+	}
+	if math.IsInf(xlo, 1) {
+		return
+	}
+	toY := drawAxes(c, area, ylo, yhi)
+
+	if xlo == xhi {
+		xlo, xhi = xlo-1, xhi+1
+	}
+	toX := func(v float64) float64 {
+		return area.left + (v-xlo)/(xhi-xlo)*(area.right-area.left)
+	}
+
+	// Category labels when given, otherwise numeric ticks
+	if len(spec.Labels) > 0 && spec.Type == "line" {
+		for i, label := range spec.Labels {
+			c.text(toX(float64(i)), area.bottom+16, label, "middle", chartInk)
+		}
+	} else {
+		for _, t := range niceTicks(xlo, xhi, 5) {
+			if t >= xlo && t <= xhi {
+				c.text(toX(t), area.bottom+16, formatTick(t), "middle", chartInk)
+			}
+		}
+	}
+
+	for _, s := range spec.Series {
+		col := seriesColor(s)
+		for i, v := range s.Y {
+			x, y := toX(xs(s, i)), toY(v)
+			if spec.Type == "scatter" {
+				c.circle(x, y, 3.5, col)
+				continue
+			}
+			if i > 0 {
+				c.line(toX(xs(s, i-1)), toY(s.Y[i-1]), x, y, col, 2)
+			}
+		}
+	}
+}
+
+// niceTicks returns about n evenly spaced round values covering [lo, hi]
+func niceTicks(lo, hi float64, n int) []float64 {
+	if lo == hi {
+		lo, hi = lo-1, hi+1
+	}
+	raw := (hi - lo) / float64(n)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := mag
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*mag {
+			step = m * mag
+			break
+		}
+	}
+
+	// Snap to whole multiples of the step, dividing for fractional steps so
+	// 0.3 comes out as 0.3 rather than 0.30000000000000004
+	snap := func(k float64) float64 {
+		if step < 1 {
+			return k / math.Round(1/step)
+		}
+		return k * step
+	}
+
+	var ticks []float64
+	for t := math.Floor(lo/step) * step; ; t += step {
+		ticks = append(ticks, snap(math.Round(t/step)))
+		if t >= hi-step*1e-9 {
+			return ticks
+		}
+	}
+}
+
+// formatTick prints a tick value without trailing zeros
+func formatTick(v float64) string {
+	if v == 0 {
+		v = 0 // drop the sign of negative zero
+	}
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
@@ -0,0 +1,164 @@
+// ABOUTME: Drawing surfaces for the chart module
+// ABOUTME: Renders the same chart primitives to SVG markup or a PNG raster
+
+package stdlib
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// canvas is the set of primitives charts are drawn with
+type canvas interface {
+	line(x1, y1, x2, y2 float64, c color.RGBA, width float64)
+	rect(x, y, w, h float64, c color.RGBA)
+	circle(cx, cy, r float64, c color.RGBA)
+	wedge(cx, cy, r, start, end float64, c color.RGBA)
+	// text draws s with its baseline at y; anchor is start, middle, or end
+	text(x, y float64, s string, anchor string, c color.RGBA)
+	encode() ([]byte, error)
+}
+
+// svgCanvas builds SVG markup
+type svgCanvas struct {
+	width, height int
+	buf           strings.Builder
+}
+
+func newSVGCanvas(width, height int) *svgCanvas {
+	c := &svgCanvas{width: width, height: height}
+	fmt.Fprintf(&c.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(&c.buf, `<rect width="%d" height="%d" fill="#ffffff"/>`+"\n", width, height)
+	return c
+}
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (c *svgCanvas) line(x1, y1, x2, y2 float64, col color.RGBA, width float64) {
+	fmt.Fprintf(&c.buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="%.1f"/>`+"\n",
+		x1, y1, x2, y2, svgColor(col), width)
+}
+
+func (c *svgCanvas) rect(x, y, w, h float64, col color.RGBA) {
+	fmt.Fprintf(&c.buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n",
+		x, y, w, h, svgColor(col))
+}
+
+func (c *svgCanvas) circle(cx, cy, r float64, col color.RGBA) {
+	fmt.Fprintf(&c.buf, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s"/>`+"\n", cx, cy, r, svgColor(col))
+}
+
+func (c *svgCanvas) wedge(cx, cy, r, start, end float64, col color.RGBA) {
+	if end-start >= 2*math.Pi-1e-9 {
+		c.circle(cx, cy, r, col)
+		return
+	}
+	large := 0
+	if end-start > math.Pi {
+		large = 1
+	}
+	fmt.Fprintf(&c.buf, `<path d="M%.1f,%.1f L%.1f,%.1f A%.1f,%.1f 0 %d,1 %.1f,%.1f Z" fill="%s" stroke="#ffffff"/>`+"\n",
+		cx, cy, cx+r*math.Cos(start), cy+r*math.Sin(start), r, r, large,
+		cx+r*math.Cos(end), cy+r*math.Sin(end), svgColor(col))
+}
+
+func (c *svgCanvas) text(x, y float64, s string, anchor string, col color.RGBA) {
+	fmt.Fprintf(&c.buf, `<text x="%.1f" y="%.1f" text-anchor="%s" fill="%s">%s</text>`+"\n",
+		x, y, anchor, svgColor(col), html.EscapeString(s))
+}
+
+func (c *svgCanvas) encode() ([]byte, error) {
+	return []byte(c.buf.String() + "</svg>\n"), nil
+}
+
+// pngCanvas rasterizes onto an RGBA image, using a fixed bitmap font for text
+type pngCanvas struct {
+	img *image.RGBA
+}
+
+func newPNGCanvas(width, height int) *pngCanvas {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	return &pngCanvas{img: img}
+}
+
+func (c *pngCanvas) line(x1, y1, x2, y2 float64, col color.RGBA, width float64) {
+	steps := int(math.Max(math.Abs(x2-x1), math.Abs(y2-y1))) + 1
+	half := math.Max(width/2, 0.5)
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		x := x1 + (x2-x1)*t
+		y := y1 + (y2-y1)*t
+		c.rect(x-half+0.5, y-half+0.5, 2*half, 2*half, col)
+	}
+}
+
+func (c *pngCanvas) rect(x, y, w, h float64, col color.RGBA) {
+	r := image.Rect(int(math.Floor(x)), int(math.Floor(y)), int(math.Floor(x+w)), int(math.Floor(y+h)))
+	draw.Draw(c.img, r, image.NewUniform(col), image.Point{}, draw.Src)
+}
+
+func (c *pngCanvas) circle(cx, cy, r float64, col color.RGBA) {
+	c.fill(cx, cy, r, func(dx, dy float64) bool { return true }, col)
+}
+
+func (c *pngCanvas) wedge(cx, cy, r, start, end float64, col color.RGBA) {
+	c.fill(cx, cy, r, func(dx, dy float64) bool {
+		a := math.Atan2(dy, dx)
+		for a < start {
+			a += 2 * math.Pi
+		}
+		return a <= end
+	}, col)
+}
+
+// fill colors the pixels within r of (cx, cy) that satisfy inside
+func (c *pngCanvas) fill(cx, cy, r float64, inside func(dx, dy float64) bool, col color.RGBA) {
+	for y := int(cy - r); y <= int(cy+r); y++ {
+		for x := int(cx - r); x <= int(cx+r); x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			if dx*dx+dy*dy <= r*r && inside(dx, dy) {
+				c.img.SetRGBA(x, y, col)
+			}
+		}
+	}
+}
+
+func (c *pngCanvas) text(x, y float64, s string, anchor string, col color.RGBA) {
+	d := &font.Drawer{
+		Dst:  c.img,
+		Src:  image.NewUniform(col),
+		Face: basicfont.Face7x13,
+	}
+	width := float64(d.MeasureString(s).Round())
+	switch anchor {
+	case "middle":
+		x -= width / 2
+	case "end":
+		x -= width
+	}
+	d.Dot = fixed.P(int(x), int(y))
+	d.DrawString(s)
+}
+
+func (c *pngCanvas) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,113 @@
+// ABOUTME: Tests for the chart module
+// ABOUTME: Verifies SVG and PNG rendering for each chart type, validation, and file output
+
+package stdlib
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestChartRender(t *testing.T) {
+	series := []ChartSeries{
+		{Name: "2023", X: []float64{1, 2, 3}, Y: []float64{3, -1, 4}},
+		{Name: "2024", X: []float64{1, 2, 3}, Y: []float64{2, 5, 1}, Color: "#112233"},
+	}
+
+	for _, chartType := range []string{"line", "bar", "scatter", "pie"} {
+		spec := ChartSpec{Type: chartType, Title: "Sales & costs", Labels: []string{"Q1", "Q2", "Q3"}, Series: series}
+		if chartType == "pie" {
+			spec.Series = []ChartSeries{{Y: []float64{1, 2, 3}}}
+		}
+
+		svg, err := RenderChartSVG(spec)
+		if err != nil {
+			t.Fatalf("%s: SVG render failed: %v", chartType, err)
+		}
+		if !strings.HasPrefix(string(svg), "<svg") || !strings.Contains(string(svg), "Sales &amp; costs") {
+			t.Errorf("%s: unexpected SVG: %.200s", chartType, svg)
+		}
+
+		data, err := RenderChartPNG(spec)
+		if err != nil {
+			t.Fatalf("%s: PNG render failed: %v", chartType, err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil || img.Bounds().Dx() != 640 || img.Bounds().Dy() != 400 {
+			t.Errorf("%s: expected a 640x400 PNG, got %v", chartType, err)
+		}
+	}
+
+	bad := []ChartSpec{
+		{Type: "radar", Series: series},
+		{Type: "line"},
+		{Type: "scatter", Series: []ChartSeries{{Y: []float64{1}}}},
+		{Type: "pie", Series: []ChartSeries{{Y: []float64{1, -1}}}},
+		{Type: "bar", Series: []ChartSeries{{Y: []float64{1}, Color: "red"}}},
+		{Type: "line", Series: []ChartSeries{{X: []float64{1}, Y: []float64{1, 2}}}},
+	}
+	for _, spec := range bad {
+		if _, err := RenderChartSVG(spec); err == nil {
+			t.Errorf("Expected error for %+v", spec)
+		}
+	}
+}
+
+func TestNiceTicks(t *testing.T) {
+	tests := []struct {
+		lo, hi float64
+		want   []float64
+	}{
+		{0, 9, []float64{0, 2, 4, 6, 8, 10}},
+		{-3, 4, []float64{-4, -2, 0, 2, 4}},
+		{0.1, 0.45, []float64{0.1, 0.2, 0.3, 0.4, 0.5}},
+		{5, 5, []float64{4, 4.5, 5, 5.5, 6}},
+	}
+	for _, tt := range tests {
+		if got := niceTicks(tt.lo, tt.hi, 5); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("niceTicks(%v, %v) = %v, want %v", tt.lo, tt.hi, got, tt.want)
+		}
+	}
+}
+
+func TestChartLua(t *testing.T) {
+	dir := t.TempDir()
+
+	L := lua.NewState()
+	defer L.Close()
+	RegisterChart(L, NewFS(&FSConfig{AllowedPaths: []string{dir}}))
+	L.SetGlobal("out_dir", lua.LString(dir))
+
+	err := L.DoString(`
+		local svg = assert(chart.svg({
+			type = "bar",
+			labels = {"EU", "US"},
+			series = {{name = "Revenue", values = {3, 5}}, {name = "Cost", values = {2, 4}}},
+		}))
+		assert(svg:find("Revenue", 1, true), "Expected legend")
+
+		local png = assert(chart.png({type = "pie", values = {1, 1}, labels = {"a", "b"}}))
+		assert(png:sub(2, 4) == "PNG")
+
+		local res, err = chart.svg({type = "line"})
+		assert(res == nil and err:find("no data"))
+
+		assert(chart.save(out_dir .. "/trend.png", {values = {1, 3, 2}}) == nil)
+		assert(chart.save(out_dir .. "/trend.gif", {values = {1}}):find("unsupported"))
+		assert(chart.save("/etc/trend.svg", {values = {1}}) ~= nil)
+	`)
+	if err != nil {
+		t.Fatalf("Chart script failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "trend.png")); err != nil {
+		t.Errorf("Expected saved chart: %v", err)
+	}
+}
@@ -0,0 +1,594 @@
+// ABOUTME: Compression module for Lua scripts (gzip, zip, tar)
+// ABOUTME: Works on strings in memory and streams files through the fs allow-list
+
+package stdlib
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// CompressConfig holds configuration for the compress module
+type CompressConfig struct {
+	// MaxDecompressedSize limits how much data a single decompression may
+	// produce, protecting against compression bombs
+	MaxDecompressedSize int64
+}
+
+// DefaultCompressConfig returns a default compress configuration
+func DefaultCompressConfig() *CompressConfig {
+	return &CompressConfig{
+		MaxDecompressedSize: 100 * 1024 * 1024, // 100MB
+	}
+}
+
+// Compressor provides compression functionality for Lua scripts
+type Compressor struct {
+	config *CompressConfig
+	fs     *FS
+}
+
+// NewCompressor creates a compressor whose file operations go through fs
+func NewCompressor(config *CompressConfig, fs *FS) *Compressor {
+	if config == nil {
+		config = DefaultCompressConfig()
+	}
+	if fs == nil {
+		fs = NewFS(nil)
+	}
+
+	return &Compressor{
+		config: config,
+		fs:     fs,
+	}
+}
+
+// RegisterCompress registers the compress module with all functions
+func RegisterCompress(L *lua.LState, c *Compressor) {
+	compressModule := L.NewTable()
+
+	// In-memory functions
+	L.SetField(compressModule, "gzip", L.NewClosure(c.gzipFn))
+	L.SetField(compressModule, "gunzip", L.NewClosure(c.gunzipFn))
+	L.SetField(compressModule, "zip", L.NewClosure(c.zipFn))
+	L.SetField(compressModule, "unzip", L.NewClosure(c.unzipFn))
+	L.SetField(compressModule, "tar", L.NewClosure(c.tarFn))
+	L.SetField(compressModule, "untar", L.NewClosure(c.untarFn))
+
+	// Streaming file functions
+	L.SetField(compressModule, "gzip_file", L.NewClosure(c.gzipFileFn))
+	L.SetField(compressModule, "gunzip_file", L.NewClosure(c.gunzipFileFn))
+	L.SetField(compressModule, "zip_dir", L.NewClosure(c.zipDirFn))
+	L.SetField(compressModule, "unzip_file", L.NewClosure(c.unzipFileFn))
+	L.SetField(compressModule, "tar_dir", L.NewClosure(c.tarDirFn))
+	L.SetField(compressModule, "untar_file", L.NewClosure(c.untarFileFn))
+
+	L.SetGlobal("compress", compressModule)
+}
+
+// limitedCopy copies src to dst, failing once more than limit bytes are written
+func (c *Compressor) limitedCopy(dst io.Writer, src io.Reader) (int64, error) {
+	n, err := io.Copy(dst, io.LimitReader(src, c.config.MaxDecompressedSize+1))
+	if err != nil {
+		return n, err
+	}
+	if n > c.config.MaxDecompressedSize {
+		return n, fmt.Errorf("decompressed data exceeds %d bytes", c.config.MaxDecompressedSize)
+	}
+	return n, nil
+}
+
+// sortedFiles returns the names of a {name = content} table in order, with contents
+func sortedFiles(files *lua.LTable) ([]string, map[string]string) {
+	contents := make(map[string]string)
+	files.ForEach(func(k, v lua.LValue) {
+		if name, ok := k.(lua.LString); ok {
+			contents[string(name)] = lua.LVAsString(v)
+		}
+	})
+
+	names := make([]string, 0, len(contents))
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, contents
+}
+
+// pushError pushes nil and an error message
+func pushError(L *lua.LState, err error) int {
+	L.Push(lua.LNil)
+	L.Push(lua.LString(err.Error()))
+	return 2
+}
+
+// gzipFn compresses a string
+// Usage: data = compress.gzip(text, [level])
+func (c *Compressor) gzipFn(L *lua.LState) int {
+	data := L.CheckString(1)
+	level := L.OptInt(2, gzip.DefaultCompression)
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return pushError(L, err)
+	}
+	if _, err := w.Write([]byte(data)); err != nil {
+		return pushError(L, err)
+	}
+	if err := w.Close(); err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lua.LString(buf.String()))
+	return 1
+}
+
+// gunzipFn decompresses a gzip string
+// Usage: text, err = compress.gunzip(data)
+func (c *Compressor) gunzipFn(L *lua.LState) int {
+	data := L.CheckString(1)
+
+	r, err := gzip.NewReader(strings.NewReader(data))
+	if err != nil {
+		return pushError(L, fmt.Errorf("invalid gzip data: %w", err))
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	if _, err := c.limitedCopy(&buf, r); err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lua.LString(buf.String()))
+	return 1
+}
+
+// zipFn builds a zip archive from a {name = content} table
+// Usage: data, err = compress.zip({["a.txt"] = "hello"})
+func (c *Compressor) zipFn(L *lua.LState) int {
+	names, contents := sortedFiles(L.CheckTable(1))
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		fw, err := w.Create(name)
+		if err != nil {
+			return pushError(L, err)
+		}
+		if _, err := fw.Write([]byte(contents[name])); err != nil {
+			return pushError(L, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lua.LString(buf.String()))
+	return 1
+}
+
+// unzipFn extracts a zip archive into a {name = content} table
+// Usage: files, err = compress.unzip(data)
+func (c *Compressor) unzipFn(L *lua.LState) int {
+	data := L.CheckString(1)
+
+	r, err := zip.NewReader(strings.NewReader(data), int64(len(data)))
+	if err != nil {
+		return pushError(L, fmt.Errorf("invalid zip data: %w", err))
+	}
+
+	files := L.NewTable()
+	var total int64
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return pushError(L, err)
+		}
+		var buf bytes.Buffer
+		n, err := c.limitedCopy(&buf, rc)
+		rc.Close()
+		total += n
+		if err == nil && total > c.config.MaxDecompressedSize {
+			err = fmt.Errorf("decompressed data exceeds %d bytes", c.config.MaxDecompressedSize)
+		}
+		if err != nil {
+			return pushError(L, err)
+		}
+		L.SetField(files, f.Name, lua.LString(buf.String()))
+	}
+
+	L.Push(files)
+	return 1
+}
+
+// tarFn builds a tar archive from a {name = content} table
+// Usage: data, err = compress.tar({["a.txt"] = "hello"})
+func (c *Compressor) tarFn(L *lua.LState) int {
+	names, contents := sortedFiles(L.CheckTable(1))
+
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, name := range names {
+		content := contents[name]
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}
+		if err := w.WriteHeader(hdr); err != nil {
+			return pushError(L, err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			return pushError(L, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lua.LString(buf.String()))
+	return 1
+}
+
+// untarFn extracts a tar archive into a {name = content} table
+// Usage: files, err = compress.untar(data)
+func (c *Compressor) untarFn(L *lua.LState) int {
+	data := L.CheckString(1)
+
+	r := tar.NewReader(strings.NewReader(data))
+	files := L.NewTable()
+	var total int64
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return pushError(L, fmt.Errorf("invalid tar data: %w", err))
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		var buf bytes.Buffer
+		n, err := c.limitedCopy(&buf, r)
+		total += n
+		if err == nil && total > c.config.MaxDecompressedSize {
+			err = fmt.Errorf("decompressed data exceeds %d bytes", c.config.MaxDecompressedSize)
+		}
+		if err != nil {
+			return pushError(L, err)
+		}
+		L.SetField(files, hdr.Name, lua.LString(buf.String()))
+	}
+
+	L.Push(files)
+	return 1
+}
+
+// checkPaths validates a source path against the allow-list, and a
+// destination path for writing
+func (c *Compressor) checkPaths(src, dst string) (string, string, error) {
+	srcPath, err := c.fs.CheckPath(src)
+	if err != nil {
+		return "", "", err
+	}
+	dstPath, err := c.fs.CheckWrite(dst)
+	if err != nil {
+		return "", "", err
+	}
+	return srcPath, dstPath, nil
+}
+
+// gzipFileFn compresses a file to another file without loading it into memory
+// Usage: err = compress.gzip_file(src, dst)
+func (c *Compressor) gzipFileFn(L *lua.LState) int {
+	err := c.convertFile(L.CheckString(1), L.CheckString(2), func(dst io.Writer, src io.Reader) error {
+		w := gzip.NewWriter(dst)
+		if _, err := io.Copy(w, src); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+	return pushOptionalError(L, err)
+}
+
+// gunzipFileFn decompresses a gzip file to another file
+// Usage: err = compress.gunzip_file(src, dst)
+func (c *Compressor) gunzipFileFn(L *lua.LState) int {
+	err := c.convertFile(L.CheckString(1), L.CheckString(2), func(dst io.Writer, src io.Reader) error {
+		r, err := gzip.NewReader(src)
+		if err != nil {
+			return fmt.Errorf("invalid gzip data: %w", err)
+		}
+		defer r.Close()
+		_, err = c.limitedCopy(dst, r)
+		return err
+	})
+	return pushOptionalError(L, err)
+}
+
+// convertFile streams src through convert into dst, removing dst on failure
+func (c *Compressor) convertFile(src, dst string, convert func(io.Writer, io.Reader) error) error {
+	srcPath, dstPath, err := c.checkPaths(src, dst)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := c.fs.openWrite(dstPath, os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+
+	err = convert(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dstPath)
+	}
+	return err
+}
+
+// pushOptionalError pushes an error string, or nothing on success
+func pushOptionalError(L *lua.LState, err error) int {
+	if err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+	return 0
+}
+
+// walkFiles calls fn for every regular file under dir with its slash-separated relative name
+func (c *Compressor) walkFiles(dir string, fn func(path, name string, info os.FileInfo) error) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, err := c.fs.CheckPath(path); err != nil {
+			// Denied entries, and everything in denied directories, are left out
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return fn(path, filepath.ToSlash(rel), info)
+	})
+}
+
+// copyFileTo streams a file's contents into w
+func copyFileTo(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// zipDirFn writes every file under a directory into a zip archive
+// Usage: err = compress.zip_dir(dir, dst)
+func (c *Compressor) zipDirFn(L *lua.LState) int {
+	err := c.archiveDir(L.CheckString(1), L.CheckString(2), func(out io.Writer, dir string) error {
+		w := zip.NewWriter(out)
+		err := c.walkFiles(dir, func(path, name string, info os.FileInfo) error {
+			fw, err := w.Create(name)
+			if err != nil {
+				return err
+			}
+			return copyFileTo(fw, path)
+		})
+		if err != nil {
+			return err
+		}
+		return w.Close()
+	})
+	return pushOptionalError(L, err)
+}
+
+// tarDirFn writes every file under a directory into a tar archive,
+// gzip-compressed when the destination ends in .gz or .tgz
+// Usage: err = compress.tar_dir(dir, dst)
+func (c *Compressor) tarDirFn(L *lua.LState) int {
+	dst := L.CheckString(2)
+	err := c.archiveDir(L.CheckString(1), dst, func(out io.Writer, dir string) error {
+		var gz *gzip.Writer
+		if isGzipName(dst) {
+			gz = gzip.NewWriter(out)
+			out = gz
+		}
+
+		w := tar.NewWriter(out)
+		err := c.walkFiles(dir, func(path, name string, info os.FileInfo) error {
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = name
+			if err := w.WriteHeader(hdr); err != nil {
+				return err
+			}
+			return copyFileTo(w, path)
+		})
+		if err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		if gz != nil {
+			return gz.Close()
+		}
+		return nil
+	})
+	return pushOptionalError(L, err)
+}
+
+// isGzipName reports whether a tar file name implies gzip compression
+func isGzipName(name string) bool {
+	return strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// archiveDir validates paths and streams an archive of dir into dst
+func (c *Compressor) archiveDir(dir, dst string, write func(io.Writer, string) error) error {
+	dirPath, dstPath, err := c.checkPaths(dir, dst)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.fs.openWrite(dstPath, os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+
+	err = write(out, dirPath)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dstPath)
+	}
+	return err
+}
+
+// extractTarget resolves an archive entry name under dir, rejecting entries
+// that would escape it
+func (c *Compressor) extractTarget(dir, name string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if target != dir && !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %q escapes the destination", name)
+	}
+	return c.fs.CheckWrite(target)
+}
+
+// writeExtracted creates a file (and its parents) from an archive entry
+func (c *Compressor) writeExtracted(target string, r io.Reader, budget *int64) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := c.fs.openWrite(target, os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(out, io.LimitReader(r, *budget+1))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	*budget -= n
+	if err == nil && *budget < 0 {
+		err = fmt.Errorf("decompressed data exceeds %d bytes", c.config.MaxDecompressedSize)
+	}
+	return err
+}
+
+// unzipFileFn extracts a zip file into a directory
+// Usage: err = compress.unzip_file(src, dir)
+func (c *Compressor) unzipFileFn(L *lua.LState) int {
+	srcPath, dirPath, err := c.checkPaths(L.CheckString(1), L.CheckString(2))
+	if err != nil {
+		return pushOptionalError(L, err)
+	}
+
+	r, err := zip.OpenReader(srcPath)
+	if err != nil {
+		return pushOptionalError(L, fmt.Errorf("invalid zip file: %w", err))
+	}
+	defer r.Close()
+
+	budget := c.config.MaxDecompressedSize
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		target, err := c.extractTarget(dirPath, f.Name)
+		if err != nil {
+			return pushOptionalError(L, err)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return pushOptionalError(L, err)
+		}
+		err = c.writeExtracted(target, rc, &budget)
+		rc.Close()
+		if err != nil {
+			return pushOptionalError(L, err)
+		}
+	}
+
+	return 0
+}
+
+// untarFileFn extracts a tar file (optionally gzip-compressed) into a directory
+// Usage: err = compress.untar_file(src, dir)
+func (c *Compressor) untarFileFn(L *lua.LState) int {
+	src := L.CheckString(1)
+	srcPath, dirPath, err := c.checkPaths(src, L.CheckString(2))
+	if err != nil {
+		return pushOptionalError(L, err)
+	}
+
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return pushOptionalError(L, err)
+	}
+	defer f.Close()
+
+	var in io.Reader = f
+	if isGzipName(src) {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return pushOptionalError(L, fmt.Errorf("invalid gzip data: %w", err))
+		}
+		defer gz.Close()
+		in = gz
+	}
+
+	r := tar.NewReader(in)
+	budget := c.config.MaxDecompressedSize
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return pushOptionalError(L, fmt.Errorf("invalid tar data: %w", err))
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		target, err := c.extractTarget(dirPath, hdr.Name)
+		if err != nil {
+			return pushOptionalError(L, err)
+		}
+		if err := c.writeExtracted(target, r, &budget); err != nil {
+			return pushOptionalError(L, err)
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,168 @@
+// ABOUTME: Tests for the compress module
+// ABOUTME: Verifies gzip/zip/tar round trips, file streaming, denied files, and extraction safety
+
+package stdlib
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func newCompressTestState(t *testing.T, config *CompressConfig) (*lua.LState, string) {
+	L := lua.NewState()
+	dir := t.TempDir()
+	RegisterCompress(L, NewCompressor(config, NewFS(&FSConfig{AllowedPaths: []string{dir}})))
+	L.SetGlobal("dir", lua.LString(dir))
+	return L, dir
+}
+
+func TestCompressInMemory(t *testing.T) {
+	L, _ := newCompressTestState(t, nil)
+	defer L.Close()
+
+	err := L.DoString(`
+		local text = string.rep("hello world ", 100)
+		local packed = compress.gzip(text)
+		assert(#packed < #text, "gzip should shrink repetitive text")
+		assert(compress.gunzip(packed) == text, "gzip round trip")
+
+		local bad, err = compress.gunzip("not gzip")
+		assert(bad == nil and err:find("invalid gzip data"))
+
+		local files = {["a.txt"] = "alpha", ["dir/b.txt"] = "beta"}
+		for _, kind in ipairs({"zip", "tar"}) do
+			local archive = compress[kind](files)
+			local out = compress["un" .. kind](archive)
+			assert(out["a.txt"] == "alpha" and out["dir/b.txt"] == "beta", kind .. " round trip")
+		end
+	`)
+	if err != nil {
+		t.Fatalf("In-memory compression failed: %v", err)
+	}
+}
+
+func TestCompressFiles(t *testing.T) {
+	L, dir := newCompressTestState(t, nil)
+	defer L.Close()
+
+	src := filepath.Join(dir, "src")
+	for name, content := range map[string]string{"a.txt": "alpha", "sub/b.txt": "beta"} {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := L.DoString(`
+		assert(compress.gzip_file(dir .. "/src/a.txt", dir .. "/a.txt.gz") == nil)
+		assert(compress.gunzip_file(dir .. "/a.txt.gz", dir .. "/a.copy") == nil)
+
+		assert(compress.zip_dir(dir .. "/src", dir .. "/out.zip") == nil)
+		assert(compress.unzip_file(dir .. "/out.zip", dir .. "/unzipped") == nil)
+
+		assert(compress.tar_dir(dir .. "/src", dir .. "/out.tar.gz") == nil)
+		assert(compress.untar_file(dir .. "/out.tar.gz", dir .. "/untarred") == nil)
+
+		local err = compress.gzip_file("/etc/hosts", dir .. "/hosts.gz")
+		assert(err and err:find("access denied"), "Expected access denied")
+	`)
+	if err != nil {
+		t.Fatalf("File compression failed: %v", err)
+	}
+
+	for path, want := range map[string]string{
+		"a.copy":             "alpha",
+		"unzipped/a.txt":     "alpha",
+		"unzipped/sub/b.txt": "beta",
+		"untarred/a.txt":     "alpha",
+		"untarred/sub/b.txt": "beta",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Errorf("Expected %s to exist: %v", path, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestCompressDirDenied(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	dir := t.TempDir()
+	RegisterCompress(L, NewCompressor(nil, NewFS(&FSConfig{AllowedPaths: []string{dir}, DeniedPaths: []string{".env", "secrets"}})))
+	L.SetGlobal("dir", lua.LString(dir))
+
+	for name, content := range map[string]string{"a.txt": "alpha", ".env": "KEY=1", "secrets/key.txt": "key"} {
+		path := filepath.Join(dir, "src", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := L.DoString(`
+		assert(compress.zip_dir(dir .. "/src", dir .. "/out.zip") == nil)
+		assert(compress.tar_dir(dir .. "/src", dir .. "/out.tar") == nil)
+		assert(compress.unzip_file(dir .. "/out.zip", dir .. "/unzipped") == nil)
+		assert(compress.untar_file(dir .. "/out.tar", dir .. "/untarred") == nil)
+	`)
+	if err != nil {
+		t.Fatalf("Archiving failed: %v", err)
+	}
+
+	for _, out := range []string{"unzipped", "untarred"} {
+		if _, err := os.Stat(filepath.Join(dir, out, "a.txt")); err != nil {
+			t.Errorf("Expected %s/a.txt to be archived: %v", out, err)
+		}
+		for _, name := range []string{".env", "secrets/key.txt"} {
+			if _, err := os.Stat(filepath.Join(dir, out, name)); !os.IsNotExist(err) {
+				t.Errorf("Expected denied %s to be left out of %s, got %v", name, out, err)
+			}
+		}
+	}
+}
+
+func TestCompressExtractionSafety(t *testing.T) {
+	L, dir := newCompressTestState(t, &CompressConfig{MaxDecompressedSize: 64})
+	defer L.Close()
+
+	// An archive entry that tries to escape the destination
+	evil := filepath.Join(dir, "evil.zip")
+	f, err := os.Create(evil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	fw, _ := w.Create("../escaped.txt")
+	_, _ = fw.Write([]byte("gotcha"))
+	_ = w.Close()
+	_ = f.Close()
+
+	err = L.DoString(`
+		local err = compress.unzip_file(dir .. "/evil.zip", dir .. "/out")
+		assert(err and err:find("escapes the destination"), "Expected zip-slip rejection, got " .. tostring(err))
+
+		local bomb = compress.gzip(string.rep("x", 1000))
+		local out, err = compress.gunzip(bomb)
+		assert(out == nil and err:find("exceeds 64 bytes"), "Expected size limit error")
+	`)
+	if err != nil {
+		t.Fatalf("Extraction safety script failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "escaped.txt")); !os.IsNotExist(err) {
+		t.Error("Expected escaped file not to be written")
+	}
+}
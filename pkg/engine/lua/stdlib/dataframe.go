@@ -0,0 +1,685 @@
+// ABOUTME: Dataframe module for Lua scripts with chainable tabular operations
+// ABOUTME: Provides df.from_csv(), from_json(), from_rows() and lazy filter/select/sort/group_by/join
+
+package stdlib
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// dfRow is one row of a dataframe, keyed by column name
+type dfRow map[string]interface{}
+
+// dfData is a materialized dataframe
+type dfData struct {
+	columns []string
+	rows    []dfRow
+}
+
+// dfOp derives one dataframe from another; ops run in the Lua thread that
+// materializes the frame, so they may call Lua functions
+type dfOp func(L *lua.LState, in *dfData) (*dfData, error)
+
+// DataFrame is a lazily evaluated table. Transformations record an op on
+// top of their parent and nothing runs until rows are requested.
+type DataFrame struct {
+	parent *DataFrame
+	op     dfOp
+	data   *dfData // set once materialized
+}
+
+// dfGroup is the result of group_by, awaiting an aggregation
+type dfGroup struct {
+	frame *DataFrame
+	keys  []string
+}
+
+// NewDataFrame creates a materialized dataframe from rows
+func NewDataFrame(columns []string, rows []map[string]interface{}) *DataFrame {
+	data := &dfData{columns: columns, rows: make([]dfRow, len(rows))}
+	for i, row := range rows {
+		data.rows[i] = row
+	}
+	return &DataFrame{data: data}
+}
+
+// derive returns a new frame that applies op to this one
+func (f *DataFrame) derive(op dfOp) *DataFrame {
+	return &DataFrame{parent: f, op: op}
+}
+
+// materialize runs any pending ops and caches the result
+func (f *DataFrame) materialize(L *lua.LState) (*dfData, error) {
+	if f.data != nil {
+		return f.data, nil
+	}
+
+	in, err := f.parent.materialize(L)
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.op(L, in)
+	if err != nil {
+		return nil, err
+	}
+
+	f.data = data
+	f.parent = nil
+	return data, nil
+}
+
+// RegisterDataFrame registers the df module and the dataframe types
+func RegisterDataFrame(L *lua.LState) {
+	dfModule := L.NewTable()
+
+	mt := L.NewTypeMetatable("dataframe")
+	L.SetField(mt, "__index", L.SetFuncs(L.NewTable(), dataFrameMethods))
+
+	groupMt := L.NewTypeMetatable("dataframe_group")
+	L.SetField(groupMt, "__index", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"agg": dfAgg,
+	}))
+
+	L.SetField(dfModule, "from_csv", L.NewFunction(dfFromCSV))
+	L.SetField(dfModule, "from_json", L.NewFunction(dfFromJSON))
+	L.SetField(dfModule, "from_rows", L.NewFunction(dfFromRows))
+
+	L.SetGlobal("df", dfModule)
+}
+
+var dataFrameMethods = map[string]lua.LGFunction{
+	"filter":   dfFilter,
+	"select":   dfSelect,
+	"sort":     dfSort,
+	"head":     dfHead,
+	"group_by": dfGroupBy,
+	"join":     dfJoin,
+	"count":    dfCount,
+	"columns":  dfColumns,
+	"rows":     dfRows,
+	"to_csv":   dfToCSV,
+	"to_json":  dfToJSON,
+}
+
+// pushFrame pushes a dataframe userdata
+func pushFrame(L *lua.LState, f *DataFrame) int {
+	ud := L.NewUserData()
+	ud.Value = f
+	L.SetMetatable(ud, L.GetTypeMetatable("dataframe"))
+	L.Push(ud)
+	return 1
+}
+
+// checkFrame returns the dataframe at stack position n
+func checkFrame(L *lua.LState, n int) *DataFrame {
+	ud := L.CheckUserData(n)
+	f, ok := ud.Value.(*DataFrame)
+	if !ok {
+		L.ArgError(n, "dataframe expected")
+	}
+	return f
+}
+
+// columnArgs reads column names given as varargs or as a single list
+func columnArgs(L *lua.LState, start int) []string {
+	if tbl, ok := L.Get(start).(*lua.LTable); ok {
+		return luaStrings(tbl)
+	}
+	var cols []string
+	for i := start; i <= L.GetTop(); i++ {
+		cols = append(cols, L.CheckString(i))
+	}
+	return cols
+}
+
+// parseCell turns CSV text into a number when it looks like one
+func parseCell(s string) interface{} {
+	if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+	return s
+}
+
+// dfFromCSV parses CSV text with a header row
+// Usage: frame, err = df.from_csv(text, [{delimiter = ","}])
+func dfFromCSV(L *lua.LState) int {
+	text := L.CheckString(1)
+	opts := L.OptTable(2, L.NewTable())
+
+	r := csv.NewReader(strings.NewReader(text))
+	if d := lua.LVAsString(opts.RawGetString("delimiter")); d != "" {
+		r.Comma = []rune(d)[0]
+	}
+	records, err := r.ReadAll()
+	if err != nil {
+		return pushError(L, fmt.Errorf("invalid CSV: %w", err))
+	}
+	if len(records) == 0 {
+		return pushFrame(L, NewDataFrame(nil, nil))
+	}
+
+	columns := records[0]
+	rows := make([]map[string]interface{}, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			if i < len(record) {
+				row[col] = parseCell(record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return pushFrame(L, NewDataFrame(columns, rows))
+}
+
+// dfFromJSON parses a JSON array of objects
+// Usage: frame, err = df.from_json(text)
+func dfFromJSON(L *lua.LState) int {
+	text := L.CheckString(1)
+
+	var rows []map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &rows); err != nil {
+		return pushError(L, fmt.Errorf("expected a JSON array of objects: %w", err))
+	}
+
+	return pushFrame(L, NewDataFrame(rowColumns(rows), rows))
+}
+
+// dfFromRows builds a frame from a Lua list of row tables
+// Usage: frame, err = df.from_rows({{name = "a", n = 1}, ...})
+func dfFromRows(L *lua.LState) int {
+	list := L.CheckTable(1)
+
+	rows := make([]map[string]interface{}, 0, list.Len())
+	for i := 1; i <= list.Len(); i++ {
+		tbl, ok := list.RawGetInt(i).(*lua.LTable)
+		if !ok {
+			return pushError(L, fmt.Errorf("row %d is not a table", i))
+		}
+		row := make(map[string]interface{})
+		tbl.ForEach(func(k, v lua.LValue) {
+			row[lua.LVAsString(k)] = luaToGo(v)
+		})
+		rows = append(rows, row)
+	}
+
+	return pushFrame(L, NewDataFrame(rowColumns(rows), rows))
+}
+
+// rowColumns returns every key used by the rows, sorted
+func rowColumns(rows []map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, row := range rows {
+		for col := range row {
+			if !seen[col] {
+				seen[col] = true
+				columns = append(columns, col)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// rowToLua converts a row to a Lua table
+func rowToLua(L *lua.LState, row dfRow) *lua.LTable {
+	tbl := L.NewTable()
+	for k, v := range row {
+		tbl.RawSetString(k, goToLua(L, v))
+	}
+	return tbl
+}
+
+// dfFilter keeps the rows for which the predicate returns true
+// Usage: frame = frame:filter(function(row) return row.total > 10 end)
+func dfFilter(L *lua.LState) int {
+	f := checkFrame(L, 1)
+	pred := L.CheckFunction(2)
+
+	return pushFrame(L, f.derive(func(L *lua.LState, in *dfData) (*dfData, error) {
+		out := &dfData{columns: in.columns}
+		for _, row := range in.rows {
+			if err := L.CallByParam(lua.P{Fn: pred, NRet: 1, Protect: true}, rowToLua(L, row)); err != nil {
+				return nil, fmt.Errorf("filter failed: %w", err)
+			}
+			keep := lua.LVAsBool(L.Get(-1))
+			L.Pop(1)
+			if keep {
+				out.rows = append(out.rows, row)
+			}
+		}
+		return out, nil
+	}))
+}
+
+// dfSelect keeps only the named columns, in the given order
+// Usage: frame = frame:select("name", "total") or frame:select({"name", "total"})
+func dfSelect(L *lua.LState) int {
+	f := checkFrame(L, 1)
+	cols := columnArgs(L, 2)
+
+	return pushFrame(L, f.derive(func(L *lua.LState, in *dfData) (*dfData, error) {
+		out := &dfData{columns: cols, rows: make([]dfRow, len(in.rows))}
+		for i, row := range in.rows {
+			picked := make(dfRow, len(cols))
+			for _, col := range cols {
+				if v, ok := row[col]; ok {
+					picked[col] = v
+				}
+			}
+			out.rows[i] = picked
+		}
+		return out, nil
+	}))
+}
+
+// compareValues orders nil first, then numbers, then strings, then booleans
+func compareValues(a, b interface{}) int {
+	rank := func(v interface{}) int {
+		switch v.(type) {
+		case nil:
+			return 0
+		case float64:
+			return 1
+		case string:
+			return 2
+		default:
+			return 3
+		}
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+
+	switch av := a.(type) {
+	case float64:
+		bv := b.(float64)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+	case string:
+		return strings.Compare(av, b.(string))
+	case bool:
+		if av != b.(bool) {
+			if av {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+// dfSort orders rows by one or more columns (stable)
+// Usage: frame = frame:sort("total", [descending]) or frame:sort({"region", "total"}, [descending])
+func dfSort(L *lua.LState) int {
+	f := checkFrame(L, 1)
+	var cols []string
+	if tbl, ok := L.Get(2).(*lua.LTable); ok {
+		cols = luaStrings(tbl)
+	} else {
+		cols = []string{L.CheckString(2)}
+	}
+	desc := L.OptBool(3, false)
+
+	return pushFrame(L, f.derive(func(L *lua.LState, in *dfData) (*dfData, error) {
+		rows := append([]dfRow(nil), in.rows...)
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, col := range cols {
+				if c := compareValues(rows[i][col], rows[j][col]); c != 0 {
+					return (c < 0) != desc
+				}
+			}
+			return false
+		})
+		return &dfData{columns: in.columns, rows: rows}, nil
+	}))
+}
+
+// dfHead keeps the first n rows
+// Usage: frame = frame:head(10)
+func dfHead(L *lua.LState) int {
+	f := checkFrame(L, 1)
+	n := L.CheckInt(2)
+
+	return pushFrame(L, f.derive(func(L *lua.LState, in *dfData) (*dfData, error) {
+		end := min(max(n, 0), len(in.rows))
+		return &dfData{columns: in.columns, rows: in.rows[:end]}, nil
+	}))
+}
+
+// dfGroupBy groups rows by key columns; call agg on the result
+// Usage: grouped = frame:group_by("region")
+func dfGroupBy(L *lua.LState) int {
+	f := checkFrame(L, 1)
+	keys := columnArgs(L, 2)
+	if len(keys) == 0 {
+		L.ArgError(2, "at least one column expected")
+	}
+
+	ud := L.NewUserData()
+	ud.Value = &dfGroup{frame: f, keys: keys}
+	L.SetMetatable(ud, L.GetTypeMetatable("dataframe_group"))
+	L.Push(ud)
+	return 1
+}
+
+// dfAggregate is one output column of an aggregation
+type dfAggregate struct {
+	name   string
+	fn     string
+	column string
+}
+
+// aggregators compute a summary of one column over a group
+var aggregators = map[string]func(values []interface{}) interface{}{
+	"count": func(values []interface{}) interface{} {
+		return float64(len(values))
+	},
+	"sum": func(values []interface{}) interface{} {
+		total := 0.0
+		for _, v := range values {
+			if n, ok := v.(float64); ok {
+				total += n
+			}
+		}
+		return total
+	},
+	"mean": func(values []interface{}) interface{} {
+		total, n := 0.0, 0
+		for _, v := range values {
+			if f, ok := v.(float64); ok {
+				total += f
+				n++
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+		return total / float64(n)
+	},
+	"min": func(values []interface{}) interface{} {
+		return extreme(values, -1)
+	},
+	"max": func(values []interface{}) interface{} {
+		return extreme(values, 1)
+	},
+	"first": func(values []interface{}) interface{} {
+		if len(values) == 0 {
+			return nil
+		}
+		return values[0]
+	},
+	"last": func(values []interface{}) interface{} {
+		if len(values) == 0 {
+			return nil
+		}
+		return values[len(values)-1]
+	},
+}
+
+// extreme returns the smallest (sign -1) or largest (sign 1) non-nil value
+func extreme(values []interface{}, sign int) interface{} {
+	var best interface{}
+	for _, v := range values {
+		if v != nil && (best == nil || compareValues(v, best)*sign > 0) {
+			best = v
+		}
+	}
+	return best
+}
+
+// dfAgg summarizes each group. Specs map an output column to {fn, column},
+// or to "count".
+// Usage: frame = grouped:agg({total = {"sum", "amount"}, orders = "count"})
+func dfAgg(L *lua.LState) int {
+	ud := L.CheckUserData(1)
+	g, ok := ud.Value.(*dfGroup)
+	if !ok {
+		L.ArgError(1, "grouped dataframe expected")
+	}
+	specs := L.CheckTable(2)
+
+	var aggs []dfAggregate
+	var specErr error
+	specs.ForEach(func(k, v lua.LValue) {
+		agg := dfAggregate{name: lua.LVAsString(k)}
+		if tbl, ok := v.(*lua.LTable); ok {
+			agg.fn = lua.LVAsString(tbl.RawGetInt(1))
+			agg.column = lua.LVAsString(tbl.RawGetInt(2))
+		} else {
+			agg.fn = lua.LVAsString(v)
+		}
+		if _, ok := aggregators[agg.fn]; !ok && specErr == nil {
+			specErr = fmt.Errorf("unknown aggregate %q for %s (use count, sum, mean, min, max, first, or last)", agg.fn, agg.name)
+		}
+		aggs = append(aggs, agg)
+	})
+	if specErr != nil {
+		return pushError(L, specErr)
+	}
+	sort.Slice(aggs, func(i, j int) bool { return aggs[i].name < aggs[j].name })
+
+	keys := g.keys
+	return pushFrame(L, g.frame.derive(func(L *lua.LState, in *dfData) (*dfData, error) {
+		// Groups keep first-seen order
+		var order []string
+		groups := make(map[string][]dfRow)
+		for _, row := range in.rows {
+			id := groupID(row, keys)
+			if _, ok := groups[id]; !ok {
+				order = append(order, id)
+			}
+			groups[id] = append(groups[id], row)
+		}
+
+		out := &dfData{columns: append([]string(nil), keys...)}
+		for _, agg := range aggs {
+			out.columns = append(out.columns, agg.name)
+		}
+		for _, id := range order {
+			members := groups[id]
+			row := make(dfRow, len(out.columns))
+			for _, key := range keys {
+				row[key] = members[0][key]
+			}
+			for _, agg := range aggs {
+				values := make([]interface{}, 0, len(members))
+				for _, m := range members {
+					if agg.column == "" {
+						values = append(values, true)
+					} else if v, ok := m[agg.column]; ok {
+						values = append(values, v)
+					}
+				}
+				row[agg.name] = aggregators[agg.fn](values)
+			}
+			out.rows = append(out.rows, row)
+		}
+		return out, nil
+	}))
+}
+
+// groupID builds a map key from a row's key-column values
+func groupID(row dfRow, keys []string) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%T:%v", row[key], row[key])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// dfJoin joins two frames on a shared column. Right-hand columns that clash
+// with left-hand ones are suffixed with "_right".
+// Usage: frame = left:join(right, "id", ["inner"|"left"])
+func dfJoin(L *lua.LState) int {
+	left := checkFrame(L, 1)
+	right := checkFrame(L, 2)
+	on := L.CheckString(3)
+	how := L.OptString(4, "inner")
+	if how != "inner" && how != "left" {
+		L.ArgError(4, "join type must be inner or left")
+	}
+
+	return pushFrame(L, left.derive(func(L *lua.LState, in *dfData) (*dfData, error) {
+		other, err := right.materialize(L)
+		if err != nil {
+			return nil, err
+		}
+
+		index := make(map[string][]dfRow)
+		for _, row := range other.rows {
+			id := groupID(row, []string{on})
+			index[id] = append(index[id], row)
+		}
+
+		// Output columns: all left, then right minus the join key
+		out := &dfData{columns: append([]string(nil), in.columns...)}
+		leftCols := make(map[string]bool)
+		for _, col := range in.columns {
+			leftCols[col] = true
+		}
+		rename := make(map[string]string)
+		for _, col := range other.columns {
+			if col == on {
+				continue
+			}
+			name := col
+			if leftCols[col] {
+				name = col + "_right"
+			}
+			rename[col] = name
+			out.columns = append(out.columns, name)
+		}
+
+		for _, row := range in.rows {
+			matches := index[groupID(row, []string{on})]
+			if len(matches) == 0 && how == "left" {
+				out.rows = append(out.rows, row)
+			}
+			for _, match := range matches {
+				joined := make(dfRow, len(out.columns))
+				for k, v := range row {
+					joined[k] = v
+				}
+				for col, name := range rename {
+					if v, ok := match[col]; ok {
+						joined[name] = v
+					}
+				}
+				out.rows = append(out.rows, joined)
+			}
+		}
+		return out, nil
+	}))
+}
+
+// dfCount returns the number of rows
+func dfCount(L *lua.LState) int {
+	data, err := checkFrame(L, 1).materialize(L)
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lua.LNumber(len(data.rows)))
+	return 1
+}
+
+// dfColumns returns the column names in order
+func dfColumns(L *lua.LState) int {
+	data, err := checkFrame(L, 1).materialize(L)
+	if err != nil {
+		return pushError(L, err)
+	}
+	tbl := L.NewTable()
+	for _, col := range data.columns {
+		tbl.Append(lua.LString(col))
+	}
+	L.Push(tbl)
+	return 1
+}
+
+// dfRows returns the rows as a list of tables
+func dfRows(L *lua.LState) int {
+	data, err := checkFrame(L, 1).materialize(L)
+	if err != nil {
+		return pushError(L, err)
+	}
+	tbl := L.CreateTable(len(data.rows), 0)
+	for _, row := range data.rows {
+		tbl.Append(rowToLua(L, row))
+	}
+	L.Push(tbl)
+	return 1
+}
+
+// formatCell renders a value for CSV output
+func formatCell(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// dfToCSV renders the frame as CSV with a header row
+func dfToCSV(L *lua.LState) int {
+	data, err := checkFrame(L, 1).materialize(L)
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	_ = w.Write(data.columns)
+	for _, row := range data.rows {
+		record := make([]string, len(data.columns))
+		for i, col := range data.columns {
+			record[i] = formatCell(row[col])
+		}
+		_ = w.Write(record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lua.LString(b.String()))
+	return 1
+}
+
+// dfToJSON renders the frame as a JSON array of objects
+func dfToJSON(L *lua.LState) int {
+	data, err := checkFrame(L, 1).materialize(L)
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	rows := data.rows
+	if rows == nil {
+		rows = []dfRow{}
+	}
+	out, err := json.Marshal(rows)
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lua.LString(out))
+	return 1
+}
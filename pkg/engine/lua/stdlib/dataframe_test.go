@@ -0,0 +1,73 @@
+// ABOUTME: Tests for the dataframe module
+// ABOUTME: Verifies loading, chained filter/select/sort/group_by/join, laziness, and output formats
+
+package stdlib
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestDataFrame(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	RegisterDataFrame(L)
+
+	err := L.DoString(`
+		local orders = assert(df.from_csv("id,region,amount\n1,EU,10\n2,US,25\n3,EU,5\n4,APAC,40\n5,US,15\n"))
+		assert(orders:count() == 5)
+		local cols = orders:columns()
+		assert(cols[1] == "id" and cols[3] == "amount", "Expected header order")
+
+		local big = orders:filter(function(row) return row.amount >= 10 end):sort("amount", true):select("region", "amount")
+		local rows = big:rows()
+		assert(#rows == 4 and rows[1].amount == 40 and rows[1].id == nil, "Expected filtered, sorted, selected rows")
+		assert(big:to_csv() == "region,amount\nAPAC,40\nUS,25\nUS,15\nEU,10\n", big:to_csv())
+
+		local totals = orders:group_by("region"):agg({total = {"sum", "amount"}, avg = {"mean", "amount"}, n = "count"}):sort("region")
+		local t = totals:rows()
+		assert(#t == 3 and t[2].region == "EU" and t[2].total == 15 and t[2].avg == 7.5 and t[2].n == 2)
+		assert(totals:columns()[2] == "avg", "Expected sorted aggregate columns")
+
+		local regions = assert(df.from_json('[{"region": "EU", "name": "Europe"}, {"region": "US", "name": "United States"}]'))
+		local joined = orders:join(regions, "region"):sort("id")
+		assert(joined:count() == 4 and joined:rows()[1].name == "Europe")
+		assert(orders:join(regions, "region", "left"):count() == 5)
+
+		local top = df.from_rows({{n = 3}, {n = 1}, {n = 2}}):sort("n"):head(2)
+		assert(top:to_json() == '[{"n":1},{"n":2}]', top:to_json())
+
+		local res, err = orders:group_by("region"):agg({x = {"median", "amount"}})
+		assert(res == nil and err:find("unknown aggregate"))
+
+		res, err = df.from_json("{}")
+		assert(res == nil and err:find("array of objects"))
+	`)
+	if err != nil {
+		t.Fatalf("Dataframe script failed: %v", err)
+	}
+}
+
+func TestDataFrameLazy(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	RegisterDataFrame(L)
+
+	err := L.DoString(`
+		calls = 0
+		local frame = df.from_rows({{n = 1}, {n = 2}, {n = 3}})
+		local odd = frame:filter(function(row) calls = calls + 1; return row.n % 2 == 1 end)
+		assert(calls == 0, "Expected filter to be deferred")
+
+		assert(odd:count() == 2 and odd:count() == 2)
+		assert(calls == 3, "Expected filter to run once, got " .. calls)
+
+		local failing = frame:filter(function(row) error("boom") end)
+		local res, err = failing:rows()
+		assert(res == nil and err:find("boom"))
+	`)
+	if err != nil {
+		t.Fatalf("Lazy dataframe script failed: %v", err)
+	}
+}
@@ -0,0 +1,557 @@
+// ABOUTME: Filesystem module for Lua scripts restricted to an allow-list of paths and named roots
+// ABOUTME: Provides fs.read(), write(), glob(), list_dir(), temp_dir(), temp_file() with run-scoped cleanup, streaming and background I/O, and fs.watch()
+
+package stdlib
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// FSConfig holds configuration for the fs module
+type FSConfig struct {
+	// AllowedPaths are the directory trees scripts may access.
+	// The run's temp directory is always allowed.
+	AllowedPaths []string
+
+	// TempRoot is where the run's temp directory is created (os.TempDir() when empty)
+	TempRoot string
+
+	// Roots are directories scripts address by name, as "name:path"; they
+	// are allowed like AllowedPaths
+	Roots []FSRoot
+
+	// DeniedPaths are patterns of paths scripts may not access, matched
+	// against each file and directory name and against the path relative
+	// to its root
+	DeniedPaths []string
+
+	// ReadOnly keeps scripts from writing anywhere but the run's temp
+	// directory
+	ReadOnly bool
+
+	// WriteQuota caps the bytes a run may write; zero means no limit
+	WriteQuota int64
+}
+
+// FSRoot is a named directory, which a read-only root keeps scripts from
+// writing to
+type FSRoot struct {
+	Name     string
+	Path     string
+	ReadOnly bool
+}
+
+// DefaultFSConfig returns a default fs configuration allowing the working directory
+func DefaultFSConfig() *FSConfig {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return &FSConfig{}
+	}
+	return &FSConfig{
+		AllowedPaths: []string{cwd},
+	}
+}
+
+// FS provides allow-listed filesystem access for Lua scripts
+type FS struct {
+	config  *FSConfig
+	mu      sync.Mutex
+	tempDir string
+
+	watches   map[int]*fsWatch
+	nextWatch int
+	events    chan fsEvent
+
+	// written is how many bytes the run has written, against WriteQuota
+	written int64
+}
+
+// NewFS creates a new fs instance
+func NewFS(config *FSConfig) *FS {
+	if config == nil {
+		config = DefaultFSConfig()
+	}
+
+	return &FS{
+		config: config,
+	}
+}
+
+// RegisterFS registers the fs module and arranges for its watches and temp
+// files to be released when the state is cleaned up
+func RegisterFS(L *lua.LState, fsys *FS) {
+	fsModule := L.NewTable()
+
+	L.SetField(fsModule, "read", L.NewClosure(fsys.readFn))
+	L.SetField(fsModule, "write", L.NewClosure(fsys.writeFn))
+	L.SetField(fsModule, "stats", L.NewClosure(fsys.statsFn))
+	L.SetField(fsModule, "glob", L.NewClosure(fsys.globFn))
+	L.SetField(fsModule, "list_dir", L.NewClosure(fsys.listDirFn))
+	L.SetField(fsModule, "read_lines", L.NewClosure(fsys.readLinesFn))
+	L.SetField(fsModule, "read_chunks", L.NewClosure(fsys.readChunksFn))
+	L.SetField(fsModule, "append_line", L.NewClosure(fsys.appendLineFn))
+	L.SetField(fsModule, "read_async", L.NewClosure(fsys.readAsyncFn))
+	L.SetField(fsModule, "write_async", L.NewClosure(fsys.writeAsyncFn))
+	L.SetField(fsModule, "temp_dir", L.NewClosure(fsys.tempDirFn))
+	L.SetField(fsModule, "temp_file", L.NewClosure(fsys.tempFileFn))
+	L.SetField(fsModule, "watch", L.NewClosure(fsys.watchFn))
+	L.SetField(fsModule, "process_events", L.NewClosure(fsys.processEventsFn))
+
+	L.SetGlobal("fs", fsModule)
+
+	OnCleanup(L, func() {
+		_ = fsys.Cleanup()
+	})
+}
+
+// Cleanup stops all watches and removes the run's temp directory and
+// everything allocated in it
+func (f *FS) Cleanup() error {
+	f.stopAllWatches()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.tempDir == "" {
+		return nil
+	}
+
+	err := os.RemoveAll(f.tempDir)
+	f.tempDir = ""
+	return err
+}
+
+// runTempDir returns the run-scoped temp directory, creating it on first use
+func (f *FS) runTempDir() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.tempDir != "" {
+		return f.tempDir, nil
+	}
+
+	dir, err := os.MkdirTemp(f.config.TempRoot, "llmspell-run-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	f.tempDir = dir
+	return dir, nil
+}
+
+// CheckPath resolves a path, which may be "name:path" in a named root,
+// and ensures it lies within an allowed directory or the run's temp
+// directory and is not denied
+func (f *FS) CheckPath(path string) (string, error) {
+	absPath, _, err := f.resolve(path)
+	return absPath, err
+}
+
+// fsArea is a directory tree scripts may access
+type fsArea struct {
+	dir      string
+	readOnly bool
+}
+
+// resolve returns the absolute path path names, with symlinks followed,
+// and the area it lies in
+func (f *FS) resolve(path string) (string, fsArea, error) {
+	absPath, err := f.absPath(path)
+	if err != nil {
+		return "", fsArea{}, err
+	}
+	// Links must not lead out of an area or around a denied path
+	if absPath, err = realPath(absPath, 0); err != nil {
+		return "", fsArea{}, fmt.Errorf("invalid path %q: %w", path, err)
+	}
+
+	// Of nested areas the innermost decides, so a read-only root inside a
+	// writable path stays read-only; a path denied in any of them is denied
+	var found *fsArea
+	for _, area := range f.areas() {
+		rel, ok := within(area.dir, absPath)
+		if !ok {
+			continue
+		}
+		if f.denied(rel) {
+			return "", fsArea{}, fmt.Errorf("access denied: %s matches a denied path", path)
+		}
+		if found == nil || len(area.dir) > len(found.dir) || (len(area.dir) == len(found.dir) && area.readOnly) {
+			found = &area
+		}
+	}
+	if found == nil {
+		return "", fsArea{}, fmt.Errorf("access denied: %s is outside the allowed paths", path)
+	}
+	return absPath, *found, nil
+}
+
+// absPath makes path absolute; in a named root, ".." cannot climb out
+// of the root
+func (f *FS) absPath(path string) (string, error) {
+	if root, rest, ok := f.splitRoot(path); ok {
+		dir, err := filepath.Abs(root.Path)
+		if err != nil {
+			return "", fmt.Errorf("invalid root %q: %w", root.Name, err)
+		}
+		return filepath.Join(dir, filepath.Clean(string(filepath.Separator)+filepath.FromSlash(rest))), nil
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path %q: %w", path, err)
+	}
+	return absPath, nil
+}
+
+// maxLinks is how many symlinks realPath follows before giving up
+const maxLinks = 255
+
+// realPath follows the symlinks in an absolute path. The parts that do not
+// exist yet are kept as they are after the deepest existing directory, and
+// a link to a missing file resolves to where writing it would create it.
+func realPath(path string, links int) (string, error) {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real, nil
+	}
+	if target, err := os.Readlink(path); err == nil {
+		if links++; links > maxLinks {
+			return "", fmt.Errorf("too many links")
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		return realPath(target, links)
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+	dir, err := realPath(parent, links)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// splitRoot splits "name:path" into a named root and the path in it
+func (f *FS) splitRoot(path string) (FSRoot, string, bool) {
+	name, rest, ok := strings.Cut(path, ":")
+	if !ok {
+		return FSRoot{}, "", false
+	}
+	for _, root := range f.config.Roots {
+		if root.Name == name {
+			return root, rest, true
+		}
+	}
+	return FSRoot{}, "", false
+}
+
+// areas lists the run's temp directory, the allowed paths, and the roots
+func (f *FS) areas() []fsArea {
+	f.mu.Lock()
+	tempDir := f.tempDir
+	f.mu.Unlock()
+
+	areas := make([]fsArea, 0, 1+len(f.config.AllowedPaths)+len(f.config.Roots))
+	if tempDir != "" {
+		areas = append(areas, fsArea{dir: tempDir})
+	}
+	for _, dir := range f.config.AllowedPaths {
+		areas = append(areas, fsArea{dir: dir, readOnly: f.config.ReadOnly})
+	}
+	for _, root := range f.config.Roots {
+		areas = append(areas, fsArea{dir: root.Path, readOnly: f.config.ReadOnly || root.ReadOnly})
+	}
+
+	for i := range areas {
+		if abs, err := filepath.Abs(areas[i].dir); err == nil {
+			areas[i].dir = abs
+		}
+		if real, err := realPath(areas[i].dir, 0); err == nil {
+			areas[i].dir = real
+		}
+	}
+	return areas
+}
+
+// within returns the slash-separated path of absPath relative to dir, if
+// it is dir or lies below it
+func within(dir, absPath string) (string, bool) {
+	if absPath == dir {
+		return ".", true
+	}
+	if !strings.HasPrefix(absPath, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)) {
+		return "", false
+	}
+	rel, err := filepath.Rel(dir, absPath)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// denied reports whether a path relative to its area, or a directory it
+// lies in, matches a denied pattern by name or by relative path
+func (f *FS) denied(rel string) bool {
+	if rel == "." || len(f.config.DeniedPaths) == 0 {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i, name := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		for _, pattern := range f.config.DeniedPaths {
+			if matchName(pattern, name) || matchName(pattern, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// virtualPath returns absPath as "name:path" when it lies in a named root
+func (f *FS) virtualPath(absPath string) string {
+	for _, root := range f.config.Roots {
+		dir, err := filepath.Abs(root.Path)
+		if err != nil {
+			continue
+		}
+		if rel, ok := within(dir, absPath); ok {
+			return root.Name + ":" + rel
+		}
+		// Resolved paths lie in the root with its symlinks followed
+		if real, err := realPath(dir, 0); err == nil {
+			if rel, ok := within(real, absPath); ok {
+				return root.Name + ":" + rel
+			}
+		}
+	}
+	return absPath
+}
+
+// FileEntry describes a file returned by Glob and ListDir
+type FileEntry struct {
+	Path    string
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+// newFileEntry builds an entry from a path and its file info
+func newFileEntry(path string, info fs.FileInfo) FileEntry {
+	return FileEntry{
+		Path:    path,
+		Name:    info.Name(),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}
+}
+
+// Glob returns the files matching a pattern, leaving out any match outside
+// the allowed paths
+func (f *FS) Glob(pattern string) ([]FileEntry, error) {
+	_, _, virtual := f.splitRoot(pattern)
+	if virtual {
+		absPattern, err := f.absPath(pattern)
+		if err != nil {
+			return nil, err
+		}
+		pattern = absPattern
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	entries := []FileEntry{}
+	for _, match := range matches {
+		if _, err := f.CheckPath(match); err != nil {
+			continue
+		}
+		info, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		if virtual {
+			match = f.virtualPath(match)
+		}
+		entries = append(entries, newFileEntry(match, info))
+	}
+
+	return entries, nil
+}
+
+// ListDir returns the entries of a directory, optionally descending into
+// subdirectories and keeping only names that match pattern
+func (f *FS) ListDir(path string, recursive bool, pattern string) ([]FileEntry, error) {
+	absPath, err := f.CheckPath(path)
+	if err != nil {
+		return nil, err
+	}
+	_, _, virtual := f.splitRoot(path)
+	if virtual {
+		path = absPath
+	}
+	if pattern != "" {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	entries := []FileEntry{}
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == path {
+			return nil
+		}
+		if _, err := f.CheckPath(p); err != nil {
+			// Denied entries, and everything in denied directories, are left out
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if pattern == "" || matchName(pattern, d.Name()) {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			entryPath := p
+			if virtual {
+				entryPath = f.virtualPath(p)
+			}
+			entries = append(entries, newFileEntry(entryPath, info))
+		}
+
+		if d.IsDir() && !recursive {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// matchName reports whether a file name matches a validated glob pattern
+func matchName(pattern, name string) bool {
+	matched, _ := filepath.Match(pattern, name)
+	return matched
+}
+
+// pushEntries pushes file entries as a Lua array of tables
+func pushEntries(L *lua.LState, entries []FileEntry) {
+	table := L.NewTable()
+	for _, entry := range entries {
+		item := L.NewTable()
+		L.SetField(item, "path", lua.LString(entry.Path))
+		L.SetField(item, "name", lua.LString(entry.Name))
+		L.SetField(item, "size", lua.LNumber(entry.Size))
+		L.SetField(item, "mod_time", lua.LNumber(entry.ModTime.Unix()))
+		L.SetField(item, "is_dir", lua.LBool(entry.IsDir))
+		table.Append(item)
+	}
+	L.Push(table)
+}
+
+// globFn lists the files matching a glob pattern
+// Usage: entries, err = fs.glob("docs/*.md")
+func (f *FS) globFn(L *lua.LState) int {
+	pattern := L.CheckString(1)
+
+	entries, err := f.Glob(pattern)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	pushEntries(L, entries)
+	return 1
+}
+
+// listDirFn lists a directory
+// Usage: entries, err = fs.list_dir(path, {recursive = true, pattern = "*.txt"})
+func (f *FS) listDirFn(L *lua.LState) int {
+	path := L.CheckString(1)
+	opts := L.OptTable(2, L.NewTable())
+
+	recursive := lua.LVAsBool(opts.RawGetString("recursive"))
+	pattern := ""
+	if p, ok := opts.RawGetString("pattern").(lua.LString); ok {
+		pattern = string(p)
+	}
+
+	entries, err := f.ListDir(path, recursive, pattern)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	pushEntries(L, entries)
+	return 1
+}
+
+// tempDirFn allocates a new directory inside the run's temp directory
+// Usage: path, err = fs.temp_dir([prefix])
+func (f *FS) tempDirFn(L *lua.LState) int {
+	prefix := L.OptString(1, "dir-")
+
+	root, err := f.runTempDir()
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	dir, err := os.MkdirTemp(root, prefix)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(lua.LString(dir))
+	return 1
+}
+
+// tempFileFn allocates a new empty file inside the run's temp directory.
+// A "*" in the pattern is replaced by a random string, as in os.CreateTemp.
+// Usage: path, err = fs.temp_file([pattern])
+func (f *FS) tempFileFn(L *lua.LState) int {
+	pattern := L.OptString(1, "file-*")
+
+	root, err := f.runTempDir()
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	file, err := os.CreateTemp(root, pattern)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	_ = file.Close()
+
+	L.Push(lua.LString(file.Name()))
+	return 1
+}
@@ -0,0 +1,50 @@
+// ABOUTME: Background file reads and writes for the fs module
+// ABOUTME: Provides fs.read_async() and write_async(), which return futures instead of blocking the spell
+
+package stdlib
+
+import (
+	"context"
+	"os"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// readAsyncFn reads a whole allowed file in the background
+// Usage: f = fs.read_async(path); content, err = f:await()
+func (f *FS) readAsyncFn(L *lua.LState) int {
+	path := L.CheckString(1)
+
+	future := bridge.Async(luaContext(L), func(ctx context.Context, _ func(interface{})) (interface{}, error) {
+		absPath, err := f.CheckPath(path)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(absPath)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	})
+	PushFuture(L, future, func(v interface{}) lua.LValue {
+		return lua.LString(v.(string))
+	})
+	return 1
+}
+
+// writeAsyncFn writes content to an allowed file in the background,
+// replacing it if it exists
+// Usage: f = fs.write_async(path, content); ok, err = f:await()
+func (f *FS) writeAsyncFn(L *lua.LState) int {
+	path := L.CheckString(1)
+	content := L.CheckString(2)
+
+	future := bridge.Async(luaContext(L), func(ctx context.Context, _ func(interface{})) (interface{}, error) {
+		return true, f.WriteFile(path, []byte(content))
+	})
+	PushFuture(L, future, func(v interface{}) lua.LValue {
+		return lua.LBool(v == true)
+	})
+	return 1
+}
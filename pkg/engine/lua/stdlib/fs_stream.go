@@ -0,0 +1,133 @@
+// ABOUTME: Streaming file access for the fs module
+// ABOUTME: Provides fs.read_lines(), read_chunks(), append_line() without loading whole files
+
+package stdlib
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// errStopped is returned internally when a callback asks to stop reading
+var errStopped = errors.New("stopped by callback")
+
+// streamFile opens an allowed file and passes each piece returned by read to
+// the script callback, checking for cancellation before every read. read
+// reports whether it produced a piece, since empty lines are valid pieces.
+func (f *FS) streamFile(L *lua.LState, path string, read func(r *bufio.Reader) (string, bool, error)) (int, error) {
+	absPath, err := f.CheckPath(path)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(absPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	callback := L.CheckFunction(L.GetTop())
+	reader := bufio.NewReader(file)
+	count := 0
+
+	for {
+		if ctx := L.Context(); ctx != nil && ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+
+		piece, ok, readErr := read(reader)
+		if ok {
+			count++
+			L.Push(callback)
+			L.Push(lua.LString(piece))
+			L.Push(lua.LNumber(count))
+			L.Call(2, 1)
+			ret := L.Get(-1)
+			L.Pop(1)
+			if ret == lua.LFalse {
+				return count, errStopped
+			}
+		}
+
+		if readErr == io.EOF {
+			return count, nil
+		}
+		if readErr != nil {
+			return count, readErr
+		}
+	}
+}
+
+// pushStreamResult pushes the count, treating a callback stop as success
+func pushStreamResult(L *lua.LState, count int, err error) int {
+	if err != nil && !errors.Is(err, errStopped) {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(lua.LNumber(count))
+	return 1
+}
+
+// readLinesFn calls callback(line, number) for each line, without the line
+// ending; returning false from the callback stops reading
+// Usage: count, err = fs.read_lines(path, function(line, n) ... end)
+func (f *FS) readLinesFn(L *lua.LState) int {
+	path := L.CheckString(1)
+	L.CheckFunction(2)
+
+	count, err := f.streamFile(L, path, func(r *bufio.Reader) (string, bool, error) {
+		line, err := r.ReadString('\n')
+		// A final line without a newline still counts; nothing at EOF does not
+		ok := err == nil || line != ""
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		return line, ok, err
+	})
+
+	return pushStreamResult(L, count, err)
+}
+
+// readChunksFn calls callback(chunk, number) for each block of up to size
+// bytes; returning false from the callback stops reading
+// Usage: count, err = fs.read_chunks(path, 65536, function(chunk, n) ... end)
+func (f *FS) readChunksFn(L *lua.LState) int {
+	path := L.CheckString(1)
+	size := L.CheckInt(2)
+	L.CheckFunction(3)
+
+	if size <= 0 {
+		L.ArgError(2, "chunk size must be positive")
+		return 0
+	}
+
+	buf := make([]byte, size)
+	count, err := f.streamFile(L, path, func(r *bufio.Reader) (string, bool, error) {
+		n, err := io.ReadFull(r, buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return string(buf[:n]), n > 0, err
+	})
+
+	return pushStreamResult(L, count, err)
+}
+
+// appendLineFn appends text and a newline to a file, creating it if needed
+// Usage: err = fs.append_line(path, text)
+func (f *FS) appendLineFn(L *lua.LState) int {
+	path := L.CheckString(1)
+	text := L.CheckString(2)
+
+	if err := f.appendFile(path, text+"\n"); err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+
+	return 0
+}
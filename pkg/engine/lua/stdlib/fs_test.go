@@ -0,0 +1,400 @@
+// ABOUTME: Tests for the fs module
+// ABOUTME: Verifies temp allocation, cleanup, and allow-list enforcement, symlinks included
+
+package stdlib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestFSTempCleanup(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	fs := NewFS(&FSConfig{TempRoot: t.TempDir()})
+	RegisterFS(L, fs)
+
+	err := L.DoString(`
+		dir, err = fs.temp_dir("work-")
+		assert(err == nil, err)
+		file, err = fs.temp_file("out-*.txt")
+		assert(err == nil, err)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to allocate temps: %v", err)
+	}
+
+	dir := L.GetGlobal("dir").String()
+	file := L.GetGlobal("file").String()
+	if !strings.HasPrefix(filepath.Base(dir), "work-") {
+		t.Errorf("Expected temp dir with prefix, got %s", dir)
+	}
+	if !strings.HasSuffix(file, ".txt") {
+		t.Errorf("Expected temp file matching pattern, got %s", file)
+	}
+	if filepath.Dir(dir) != filepath.Dir(file) {
+		t.Errorf("Expected temps to share the run directory, got %s and %s", dir, file)
+	}
+	for _, path := range []string{dir, file} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to exist: %v", path, err)
+		}
+		if _, err := fs.CheckPath(path); err != nil {
+			t.Errorf("Expected temp path to be allowed: %v", err)
+		}
+	}
+
+	Cleanup(L)
+
+	runDir := filepath.Dir(dir)
+	if _, err := os.Stat(runDir); !os.IsNotExist(err) {
+		t.Errorf("Expected run directory %s to be removed, got %v", runDir, err)
+	}
+}
+
+func TestFSCheckPath(t *testing.T) {
+	allowed := t.TempDir()
+	fs := NewFS(&FSConfig{AllowedPaths: []string{allowed}})
+
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{allowed, true},
+		{filepath.Join(allowed, "sub", "file.txt"), true},
+		{filepath.Join(allowed, "..", "escape.txt"), false},
+		{allowed + "-sibling", false},
+		{"/etc/passwd", false},
+	}
+
+	for _, tt := range tests {
+		_, err := fs.CheckPath(tt.path)
+		if (err == nil) != tt.allowed {
+			t.Errorf("CheckPath(%q) error = %v, want allowed = %v", tt.path, err, tt.allowed)
+		}
+	}
+}
+
+func TestFSSymlinks(t *testing.T) {
+	base := t.TempDir()
+	allowed := filepath.Join(base, "allowed")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(allowed, "sub"), filepath.Join(allowed, "secret"), outside} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"out":   outside,
+		"new":   filepath.Join(outside, "missing.txt"),
+		"inner": "sub",
+		"alias": "secret",
+		"loop":  "loop",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(allowed, name)); err != nil {
+			t.Skipf("Symlinks unavailable: %v", err)
+		}
+	}
+	fs := NewFS(&FSConfig{AllowedPaths: []string{allowed}, DeniedPaths: []string{"secret"}})
+
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{filepath.Join(allowed, "sub", "file.txt"), true},
+		{filepath.Join(allowed, "inner", "new", "file.txt"), true},
+		{filepath.Join(allowed, "out"), false},
+		{filepath.Join(allowed, "out", "file.txt"), false},
+		{filepath.Join(allowed, "new"), false},
+		{filepath.Join(allowed, "alias", "key"), false},
+		{filepath.Join(allowed, "loop"), false},
+	}
+	for _, tt := range tests {
+		_, err := fs.CheckPath(tt.path)
+		if (err == nil) != tt.allowed {
+			t.Errorf("CheckPath(%q) error = %v, want allowed = %v", tt.path, err, tt.allowed)
+		}
+	}
+
+	if err := fs.WriteFile(filepath.Join(allowed, "new"), []byte("escaped")); err == nil {
+		t.Error("Expected writing through a link out of the allowed paths to fail")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "missing.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file written outside, got %v", err)
+	}
+
+	// An allowed path that is itself a link allows what it leads to
+	if err := os.Symlink(allowed, filepath.Join(base, "linked")); err != nil {
+		t.Fatal(err)
+	}
+	linked := NewFS(&FSConfig{AllowedPaths: []string{filepath.Join(base, "linked")}})
+	for _, path := range []string{filepath.Join(base, "linked", "sub"), filepath.Join(allowed, "sub")} {
+		if _, err := linked.CheckPath(path); err != nil {
+			t.Errorf("CheckPath(%q) through a linked allowed path: %v", path, err)
+		}
+	}
+}
+
+func TestFSWatch(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	dir := t.TempDir()
+	fs := NewFS(&FSConfig{AllowedPaths: []string{dir}})
+	RegisterFS(L, fs)
+	L.SetGlobal("dir", lua.LString(dir))
+
+	err := L.DoString(`
+		seen = {}
+		handle, err = fs.watch(dir, function(event)
+			table.insert(seen, event)
+		end)
+		assert(handle, err)
+		assert(fs.process_events() == 0, "No events should be queued yet")
+	`)
+	if err != nil {
+		t.Fatalf("Failed to start watch: %v", err)
+	}
+
+	target := filepath.Join(dir, "new.txt")
+	if err := os.WriteFile(target, []byte("hello"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	err = L.DoString(`
+		assert(fs.process_events(2) > 0, "Expected at least one event")
+		assert(seen[1].op == "create", "Expected create event, got " .. tostring(seen[1].op))
+		handle:stop()
+	`)
+	if err != nil {
+		t.Fatalf("Failed to process events: %v", err)
+	}
+	if got := L.GetGlobal("seen").(*lua.LTable).RawGetInt(1).(*lua.LTable).RawGetString("path").String(); got != target {
+		t.Errorf("Expected event path %s, got %s", target, got)
+	}
+
+	// Events after stop are not delivered
+	if err := os.Remove(target); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	err = L.DoString(`assert(fs.process_events(0.2) == 0, "Stopped watch should not deliver events")`)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Paths outside the allow-list are refused
+	err = L.DoString(`
+		local h, err = fs.watch("/etc", function() end)
+		assert(h == nil and err:find("access denied"), "Expected access denied")
+	`)
+	if err != nil {
+		t.Error(err)
+	}
+
+	Cleanup(L)
+}
+
+func TestFSGlobAndListDir(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.md", filepath.Join("sub", "c.txt")} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	RegisterFS(L, NewFS(&FSConfig{AllowedPaths: []string{dir}}))
+	L.SetGlobal("dir", lua.LString(dir))
+
+	err := L.DoString(`
+		local matches = fs.glob(dir .. "/*.txt")
+		assert(#matches == 1, "Expected one top-level txt file")
+		assert(matches[1].name == "a.txt" and matches[1].size == 4 and not matches[1].is_dir)
+		assert(matches[1].mod_time > 0, "Expected a modification time")
+
+		local top = fs.list_dir(dir)
+		assert(#top == 3, "Expected a.txt, b.md, and sub, got " .. #top)
+
+		local txt = fs.list_dir(dir, {recursive = true, pattern = "*.txt"})
+		assert(#txt == 2, "Expected two txt files recursively, got " .. #txt)
+
+		local entries, err = fs.list_dir("/etc")
+		assert(entries == nil and err:find("access denied"), "Expected access denied")
+
+		assert(#fs.glob("/etc/*") == 0, "Matches outside the allow-list should be dropped")
+	`)
+	if err != nil {
+		t.Fatalf("Glob/list_dir script failed: %v", err)
+	}
+}
+
+func TestFSStreaming(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	dir := t.TempDir()
+	RegisterFS(L, NewFS(&FSConfig{AllowedPaths: []string{dir}}))
+	L.SetGlobal("path", lua.LString(filepath.Join(dir, "data.txt")))
+
+	err := L.DoString(`
+		assert(fs.append_line(path, "first") == nil)
+		assert(fs.append_line(path, "") == nil)
+		assert(fs.append_line(path, "third") == nil)
+
+		local lines = {}
+		local count, err = fs.read_lines(path, function(line, n)
+			lines[n] = line
+		end)
+		assert(err == nil, err)
+		assert(count == 3, "Expected 3 lines, got " .. tostring(count))
+		assert(lines[1] == "first" and lines[2] == "" and lines[3] == "third")
+
+		-- Returning false stops early
+		count = fs.read_lines(path, function(line, n) return false end)
+		assert(count == 1, "Expected reading to stop after 1 line")
+
+		local chunks = {}
+		count = fs.read_chunks(path, 4, function(chunk) table.insert(chunks, chunk) end)
+		assert(count == 4, "Expected 4 chunks of 13 bytes, got " .. tostring(count))
+		assert(table.concat(chunks) == "first\n\nthird\n")
+		assert(#chunks[4] == 1, "Last chunk should hold the remainder")
+
+		local c, err = fs.read_lines("/etc/passwd", function() end)
+		assert(c == nil and err:find("access denied"))
+		assert(fs.append_line("/etc/blocked", "x"):find("access denied"))
+	`)
+	if err != nil {
+		t.Fatalf("Streaming script failed: %v", err)
+	}
+}
+
+func TestFSRoots(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	data, docs := t.TempDir(), t.TempDir()
+	for _, name := range []string{"notes.txt", ".env", filepath.Join(".git", "config"), filepath.Join("keys", "id.pem")} {
+		path := filepath.Join(data, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(docs, "guide.md"), []byte("# Guide"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	RegisterFS(L, NewFS(&FSConfig{
+		Roots:       []FSRoot{{Name: "data", Path: data}, {Name: "docs", Path: docs, ReadOnly: true}},
+		DeniedPaths: []string{".env", ".git", "*.pem"},
+	}))
+	L.SetGlobal("data", lua.LString(data))
+
+	err := L.DoString(`
+		assert(fs.read("data:notes.txt") == "data")
+		assert(fs.read(data .. "/notes.txt") == "data", "Real paths in a root work too")
+		assert(fs.read("docs:/guide.md") == "# Guide")
+
+		assert(fs.write("data:out/../result.txt", "done") == true)
+		assert(fs.read("data:result.txt") == "done")
+		assert(fs.write("data:result.txt", "!", {append = true}))
+		assert(fs.read("data:result.txt") == "done!")
+
+		local ok, err = fs.write("docs:guide.md", "changed")
+		assert(ok == nil and err:find("read%-only"), err)
+		assert(fs.read("docs:guide.md") == "# Guide")
+
+		local content
+		content, err = fs.read("data:../../etc/passwd")
+		assert(content == nil, "Paths in a root cannot climb out of it")
+
+		for _, denied in ipairs({"data:.env", "data:.git/config", "data:keys/id.pem"}) do
+			content, err = fs.read(denied)
+			assert(content == nil and err:find("denied path"), denied .. ": " .. tostring(err))
+		end
+
+		content, err = fs.read("/etc/hostname")
+		assert(content == nil and err:find("outside the allowed paths"))
+
+		local names = {}
+		for _, entry in ipairs(fs.list_dir("data:", {recursive = true})) do
+			names[entry.path] = true
+		end
+		assert(names["data:notes.txt"] and names["data:result.txt"] and names["data:keys"])
+		assert(not names["data:.env"] and not names["data:.git"] and not names["data:.git/config"] and not names["data:keys/id.pem"])
+
+		local matches = fs.glob("data:*.txt")
+		assert(#matches == 2 and matches[1].path == "data:notes.txt", matches[1].path)
+		assert(#fs.glob("data:.e*") == 0, "Denied matches should be dropped")
+	`)
+	if err != nil {
+		t.Fatalf("Roots script failed: %v", err)
+	}
+}
+
+func TestFSNestedReadOnlyRoot(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	if err := os.MkdirAll(docs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	fs := NewFS(&FSConfig{AllowedPaths: []string{dir}, Roots: []FSRoot{{Name: "docs", Path: docs, ReadOnly: true}}})
+
+	for _, path := range []string{filepath.Join(docs, "guide.md"), "docs:guide.md"} {
+		if err := fs.WriteFile(path, []byte("changed")); err == nil || !strings.Contains(err.Error(), "read-only") {
+			t.Errorf("WriteFile(%q) error = %v, want read-only", path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(docs, "guide.md")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing written in the read-only root, got %v", err)
+	}
+	if err := fs.WriteFile(filepath.Join(dir, "notes.md"), []byte("ok")); err != nil {
+		t.Errorf("Expected the writable path around the root to stay writable: %v", err)
+	}
+}
+
+func TestFSWriteQuota(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	dir := t.TempDir()
+	fs := NewFS(&FSConfig{AllowedPaths: []string{dir}, TempRoot: t.TempDir(), ReadOnly: true, WriteQuota: 10})
+	RegisterFiles(L, fs, nil)
+	L.SetGlobal("dir", lua.LString(dir))
+
+	err := L.DoString(`
+		local ok, err = fs.write(dir .. "/a.txt", "x")
+		assert(ok == nil and err:find("read%-only"), "Read-only config refuses writes outside the temp directory")
+
+		local path = fs.temp_file()
+		assert(fs.write(path, "12345678") == true)
+		assert(fs.append_line(path, "9") == nil)
+
+		ok, err = fs.write(path, "more")
+		assert(ok == nil and err:find("write quota of 10 bytes exceeded"), err)
+		assert(compress.gzip_file(path, path .. ".gz"):find("write quota"))
+
+		local stats = fs.stats()
+		assert(stats.written == 10 and stats.write_quota == 10)
+	`)
+	if err != nil {
+		t.Fatalf("Quota script failed: %v", err)
+	}
+	if got := fs.Written(); got != 10 {
+		t.Errorf("Expected 10 bytes written, got %d", got)
+	}
+}
@@ -0,0 +1,229 @@
+// ABOUTME: File watching for the fs module backed by fsnotify
+// ABOUTME: Queues filesystem events and dispatches them to script callbacks on fs.process_events()
+
+package stdlib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// maxQueuedEvents bounds the event queue; events beyond it are dropped
+const maxQueuedEvents = 256
+
+// fsWatch is one active fs.watch registration
+type fsWatch struct {
+	id       int
+	path     string
+	watcher  *fsnotify.Watcher
+	callback *lua.LFunction
+}
+
+// fsEvent is a filesystem event waiting to be delivered to a script
+type fsEvent struct {
+	watchID int
+	path    string
+	op      string
+	err     string
+}
+
+// opName converts an fsnotify operation into the name scripts see
+func opName(op fsnotify.Op) string {
+	switch {
+	case op.Has(fsnotify.Create):
+		return "create"
+	case op.Has(fsnotify.Write):
+		return "write"
+	case op.Has(fsnotify.Remove):
+		return "remove"
+	case op.Has(fsnotify.Rename):
+		return "rename"
+	default:
+		return "chmod"
+	}
+}
+
+// Watch starts watching a file or directory, queuing its events for callback
+func (f *FS) Watch(path string, callback *lua.LFunction) (int, error) {
+	absPath, err := f.CheckPath(path)
+	if err != nil {
+		return 0, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	if err := watcher.Add(absPath); err != nil {
+		_ = watcher.Close()
+		return 0, fmt.Errorf("failed to watch %s: %w", path, err)
+	}
+
+	f.mu.Lock()
+	if f.watches == nil {
+		f.watches = make(map[int]*fsWatch)
+		f.events = make(chan fsEvent, maxQueuedEvents)
+	}
+	f.nextWatch++
+	w := &fsWatch{
+		id:       f.nextWatch,
+		path:     absPath,
+		watcher:  watcher,
+		callback: callback,
+	}
+	f.watches[w.id] = w
+	events := f.events
+	f.mu.Unlock()
+
+	go forwardEvents(w, events)
+
+	return w.id, nil
+}
+
+// forwardEvents moves events from the watcher to the queue until the watcher is closed
+func forwardEvents(w *fsWatch, events chan<- fsEvent) {
+	for {
+		var ev fsEvent
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			ev = fsEvent{watchID: w.id, path: event.Name, op: opName(event.Op)}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			ev = fsEvent{watchID: w.id, path: w.path, op: "error", err: err.Error()}
+		}
+
+		select {
+		case events <- ev:
+		default:
+			// Queue is full, drop event
+		}
+	}
+}
+
+// StopWatch stops a watch; stopping an unknown or stopped watch is a no-op
+func (f *FS) StopWatch(id int) {
+	f.mu.Lock()
+	w, exists := f.watches[id]
+	delete(f.watches, id)
+	f.mu.Unlock()
+
+	if exists {
+		_ = w.watcher.Close()
+	}
+}
+
+// stopAllWatches stops every active watch
+func (f *FS) stopAllWatches() {
+	f.mu.Lock()
+	ids := make([]int, 0, len(f.watches))
+	for id := range f.watches {
+		ids = append(ids, id)
+	}
+	f.mu.Unlock()
+
+	for _, id := range ids {
+		f.StopWatch(id)
+	}
+}
+
+// watchFn starts watching a path and returns a handle with a stop() function
+// Usage: handle, err = fs.watch(path, function(event) ... end); handle:stop()
+func (f *FS) watchFn(L *lua.LState) int {
+	path := L.CheckString(1)
+	callback := L.CheckFunction(2)
+
+	id, err := f.Watch(path, callback)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	handle := L.NewTable()
+	L.SetField(handle, "id", lua.LNumber(id))
+	L.SetField(handle, "path", lua.LString(path))
+	L.SetField(handle, "stop", L.NewFunction(func(L *lua.LState) int {
+		f.StopWatch(id)
+		return 0
+	}))
+
+	L.Push(handle)
+	return 1
+}
+
+// processEventsFn delivers queued events to their callbacks, waiting up to
+// timeout seconds for the first one, and returns how many were delivered
+// Usage: count = fs.process_events([timeout])
+func (f *FS) processEventsFn(L *lua.LState) int {
+	timeout := time.Duration(float64(L.OptNumber(1, 0)) * float64(time.Second))
+
+	f.mu.Lock()
+	events := f.events
+	f.mu.Unlock()
+
+	if events == nil {
+		L.Push(lua.LNumber(0))
+		return 1
+	}
+
+	var cancelled <-chan struct{}
+	if ctx := L.Context(); ctx != nil {
+		cancelled = ctx.Done()
+	}
+
+	pending := []fsEvent{}
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		select {
+		case ev := <-events:
+			pending = append(pending, ev)
+		case <-timer.C:
+		case <-cancelled:
+		}
+		timer.Stop()
+	}
+
+	// Drain whatever else is already queued
+	for drained := false; !drained; {
+		select {
+		case ev := <-events:
+			pending = append(pending, ev)
+		default:
+			drained = true
+		}
+	}
+
+	delivered := 0
+	for _, ev := range pending {
+		f.mu.Lock()
+		w, exists := f.watches[ev.watchID]
+		f.mu.Unlock()
+		if !exists {
+			// Stopped after the event was queued
+			continue
+		}
+
+		event := L.NewTable()
+		L.SetField(event, "path", lua.LString(ev.path))
+		L.SetField(event, "op", lua.LString(ev.op))
+		if ev.err != "" {
+			L.SetField(event, "error", lua.LString(ev.err))
+		}
+
+		L.Push(w.callback)
+		L.Push(event)
+		L.Call(1, 0)
+		delivered++
+	}
+
+	L.Push(lua.LNumber(delivered))
+	return 1
+}
@@ -0,0 +1,149 @@
+// ABOUTME: Whole-file reads and writes for the fs module, and the checks every write goes through
+// ABOUTME: Writes are refused in read-only roots and once the run has written its quota of bytes
+
+package stdlib
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// CheckWrite resolves a path like CheckPath and ensures it may be written
+func (f *FS) CheckWrite(path string) (string, error) {
+	absPath, area, err := f.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if area.readOnly {
+		return "", fmt.Errorf("access denied: %s is read-only", path)
+	}
+	return absPath, nil
+}
+
+// reserve counts n more bytes against the write quota, failing without
+// counting them when they do not fit
+func (f *FS) reserve(n int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if quota := f.config.WriteQuota; quota > 0 && f.written+n > quota {
+		return fmt.Errorf("write quota of %d bytes exceeded", quota)
+	}
+	f.written += n
+	return nil
+}
+
+// Written returns how many bytes the run has written
+func (f *FS) Written() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.written
+}
+
+// WriteFile writes data to a path that may be written, replacing the file
+func (f *FS) WriteFile(path string, data []byte) error {
+	absPath, err := f.CheckWrite(path)
+	if err != nil {
+		return err
+	}
+	if err := f.reserve(int64(len(data))); err != nil {
+		return err
+	}
+	return os.WriteFile(absPath, data, 0644)
+}
+
+// openWrite opens a path that may be written, with flag as in os.OpenFile;
+// writes to the file count against the quota
+func (f *FS) openWrite(path string, flag int) (io.WriteCloser, error) {
+	absPath, err := f.CheckWrite(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(absPath, flag|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaFile{file: file, fs: f}, nil
+}
+
+// quotaFile is a file whose writes count against the write quota. It
+// hides the file's other methods, so io.Copy cannot write around Write.
+type quotaFile struct {
+	file *os.File
+	fs   *FS
+}
+
+// Write writes p if it fits in the quota
+func (q *quotaFile) Write(p []byte) (int, error) {
+	if err := q.fs.reserve(int64(len(p))); err != nil {
+		return 0, err
+	}
+	return q.file.Write(p)
+}
+
+// Close closes the file
+func (q *quotaFile) Close() error {
+	return q.file.Close()
+}
+
+// readFn reads a whole allowed file
+// Usage: content, err = fs.read(path)
+func (f *FS) readFn(L *lua.LState) int {
+	absPath, err := f.CheckPath(L.CheckString(1))
+	if err != nil {
+		return pushError(L, err)
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return pushError(L, err)
+	}
+	L.Push(lua.LString(data))
+	return 1
+}
+
+// writeFn writes content to a file, replacing it, or adding to it with
+// append = true
+// Usage: ok, err = fs.write(path, content[, {append = true}])
+func (f *FS) writeFn(L *lua.LState) int {
+	path := L.CheckString(1)
+	content := L.CheckString(2)
+	opts := L.OptTable(3, L.NewTable())
+
+	var err error
+	if lua.LVAsBool(opts.RawGetString("append")) {
+		err = f.appendFile(path, content)
+	} else {
+		err = f.WriteFile(path, []byte(content))
+	}
+	if err != nil {
+		return pushError(L, err)
+	}
+	L.Push(lua.LTrue)
+	return 1
+}
+
+// appendFile adds content to the end of a file, creating it if needed
+func (f *FS) appendFile(path, content string) error {
+	file, err := f.openWrite(path, os.O_APPEND|os.O_CREATE)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// statsFn reports how much the run has written and its quota
+// Usage: stats = fs.stats() -- {written = bytes, write_quota = bytes or 0}
+func (f *FS) statsFn(L *lua.LState) int {
+	stats := L.NewTable()
+	L.SetField(stats, "written", lua.LNumber(f.Written()))
+	L.SetField(stats, "write_quota", lua.LNumber(f.config.WriteQuota))
+	L.Push(stats)
+	return 1
+}
@@ -0,0 +1,349 @@
+// ABOUTME: Lua handles for bridge futures and the cooperative scheduler behind async.run()
+// ABOUTME: Awaiting yields the calling coroutine; on the main thread it runs tasks until the future is ready
+
+package stdlib
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// futureTypeName is the Lua metatable name of future handles
+const futureTypeName = "llmspell.future"
+
+// luaFuture is the value of a future handle: the future and how to convert
+// its items and result to Lua
+type luaFuture struct {
+	future  *bridge.Future
+	convert func(interface{}) lua.LValue
+}
+
+// schedulerSource is the cooperative scheduler, built once per state from
+// the Go primitives it is called with.
+//
+// Awaiting a future that is not ready yields (future, mode) from the
+// calling coroutine, where mode says whether it waits for the future to
+// resolve ("done") or for its next item ("item"). Tasks started with
+// async.run are coroutines resumed by the scheduler once what they yielded
+// is ready; a task that yields anything else is resumed on the next round.
+// Awaiting on the main thread runs the tasks until the future is ready,
+// blocking in Go only while every task is waiting on a future too.
+const schedulerSource = `
+local poll, take, ready, wait_any, is_future, new_task = ...
+local tasks = {}
+
+local function resume_task(task, ...)
+  local ok, yielded, mode = coroutine.resume(task.co, ...)
+  if coroutine.status(task.co) == "dead" then
+    task.resolve(ok, yielded)
+    return true
+  end
+  if is_future(yielded) then
+    task.waiting, task.mode = yielded, mode
+  else
+    task.waiting, task.mode = nil, nil
+  end
+  return false
+end
+
+local function run_tasks()
+  local i = 1
+  while i <= #tasks do
+    local task = tasks[i]
+    if (task.waiting == nil or ready(task.waiting, task.mode)) and resume_task(task) then
+      table.remove(tasks, i)
+    else
+      i = i + 1
+    end
+  end
+end
+
+local function drive(f, mode)
+  run_tasks()
+  if ready(f, mode) then return end
+  local futures, modes = {f}, {mode}
+  for _, task in ipairs(tasks) do
+    if task.waiting == nil then return end
+    futures[#futures + 1], modes[#modes + 1] = task.waiting, task.mode
+  end
+  wait_any(futures, modes)
+end
+
+local function settle(f, step, mode)
+  while true do
+    local done, value, err, info = step(f)
+    if done then return value, err, info end
+    if coroutine.running() then coroutine.yield(f, mode) else drive(f, mode) end
+  end
+end
+
+local function run(fn, ...)
+  local handle, resolve = new_task()
+  local task = {co = coroutine.create(fn), resolve = resolve}
+  if not resume_task(task, ...) then tasks[#tasks + 1] = task end
+  return handle
+end
+
+local function await_all(handles)
+  local results, errors = {}, nil
+  for i, handle in ipairs(handles) do
+    local value, err = handle:await()
+    results[i] = value
+    if err ~= nil then
+      errors = errors or {}
+      errors[i] = err
+    end
+  end
+  return results, errors
+end
+
+return function(f) return settle(f, poll, "done") end,
+       function(f) return settle(f, take, "item") end,
+       run, await_all
+`
+
+// PushFuture pushes a Lua handle for f, whose items and result are
+// converted with convert. Scripts use it as:
+//
+//	value, err = f:await()       -- the result, once the call finishes
+//	item = f:next()              -- the next item, or nil once there are no more
+//	done, value, err = f:poll()  -- never waits
+//	f:cancel()
+//
+// A failed call returns nil and its error; a stream that broke off also
+// returns a table like llm.stream_chat's, to keep or resume the text.
+func PushFuture(L *lua.LState, f *bridge.Future, convert func(interface{}) lua.LValue) {
+	ud := L.NewUserData()
+	ud.Value = &luaFuture{future: f, convert: convert}
+	L.SetMetatable(ud, futureMetatable(L))
+	L.Push(ud)
+}
+
+// RegisterAsyncScheduler adds async.run and async.await_all to the async
+// module, which must be registered already
+func RegisterAsyncScheduler(L *lua.LState) {
+	asyncMod, ok := L.GetGlobal("async").(*lua.LTable)
+	if !ok {
+		return
+	}
+	mt := futureMetatable(L)
+	L.SetField(asyncMod, "run", L.GetField(mt, "run"))
+	L.SetField(asyncMod, "await_all", L.GetField(mt, "await_all"))
+}
+
+// StreamPositionToLua converts where a stream stopped to a Lua table
+func StreamPositionToLua(L *lua.LState, position bridge.StreamPosition) *lua.LTable {
+	info := L.NewTable()
+	info.RawSetString("partial", lua.LString(position.Partial))
+	info.RawSetString("chunks", lua.LNumber(position.Chunks))
+	info.RawSetString("offset", lua.LNumber(position.Offset))
+	return info
+}
+
+// futureMetatable returns the metatable of future handles in L, building it
+// and the scheduler the first time. The scheduler's run and await_all are
+// kept in the metatable for RegisterAsyncScheduler.
+func futureMetatable(L *lua.LState) *lua.LTable {
+	if mt, ok := L.GetTypeMetatable(futureTypeName).(*lua.LTable); ok {
+		return mt
+	}
+
+	fn, err := L.LoadString(schedulerSource)
+	if err != nil {
+		panic(err)
+	}
+	L.Push(fn)
+	L.Push(L.NewFunction(futurePoll))
+	L.Push(L.NewFunction(futureTake))
+	L.Push(L.NewFunction(futureReady))
+	L.Push(L.NewFunction(futureWaitAny))
+	L.Push(L.NewFunction(futureIsFuture))
+	L.Push(L.NewFunction(futureNewTask))
+	L.Call(6, 4)
+	await, next, run, awaitAll := L.Get(-4), L.Get(-3), L.Get(-2), L.Get(-1)
+	L.Pop(4)
+
+	methods := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"poll":   futurePoll,
+		"done":   futureDone,
+		"cancel": futureCancel,
+	})
+	methods.RawSetString("await", await)
+	methods.RawSetString("next", next)
+
+	mt := L.NewTypeMetatable(futureTypeName)
+	L.SetField(mt, "__index", methods)
+	L.SetField(mt, "__tostring", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString("future"))
+		return 1
+	}))
+	L.SetField(mt, "run", run)
+	L.SetField(mt, "await_all", awaitAll)
+	return mt
+}
+
+// IsFuture reports whether a Lua value is a future handle
+func IsFuture(v lua.LValue) bool {
+	_, ok := toFuture(v)
+	return ok
+}
+
+// toFuture returns the future a Lua value is a handle for, if it is one
+func toFuture(v lua.LValue) (*luaFuture, bool) {
+	ud, ok := v.(*lua.LUserData)
+	if !ok {
+		return nil, false
+	}
+	f, ok := ud.Value.(*luaFuture)
+	return f, ok
+}
+
+// checkFuture returns the future handle at argument n
+func checkFuture(L *lua.LState, n int) *luaFuture {
+	f, ok := toFuture(L.Get(n))
+	if !ok {
+		L.ArgError(n, "future expected")
+	}
+	return f
+}
+
+// pushOutcome pushes a value, or nil and the error, as bridge calls return
+// them; a cancelled spell's error says why it was cancelled
+func (f *luaFuture) pushOutcome(L *lua.LState, result interface{}, err error) int {
+	if err == nil {
+		L.Push(f.convert(result))
+		return 1
+	}
+
+	ctx := L.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	L.Push(lua.LNil)
+	L.Push(lua.LString(engine.WrapCancel(ctx, err).Error()))
+	if position, ok := bridge.StreamPositionOf(err); ok {
+		L.Push(StreamPositionToLua(L, position))
+		return 3
+	}
+	return 2
+}
+
+// futurePoll implements f:poll() -> done, value, err
+func futurePoll(L *lua.LState) int {
+	f := checkFuture(L, 1)
+	done, result, err := f.future.Poll()
+	L.Push(lua.LBool(done))
+	if !done {
+		return 1
+	}
+	return 1 + f.pushOutcome(L, result, err)
+}
+
+// futureTake is next's step: true and the next item, or true and nil (with
+// the error, if the call failed) once no more items can come
+func futureTake(L *lua.LState) int {
+	f := checkFuture(L, 1)
+	item, ok, done := f.future.Next()
+	switch {
+	case ok:
+		L.Push(lua.LTrue)
+		L.Push(f.convert(item))
+		return 2
+	case done:
+		L.Push(lua.LTrue)
+		_, _, err := f.future.Poll()
+		if err == nil {
+			L.Push(lua.LNil)
+			return 2
+		}
+		return 1 + f.pushOutcome(L, nil, err)
+	}
+	L.Push(lua.LFalse)
+	return 1
+}
+
+// futureReady reports whether a future is ready for a mode: resolved for
+// "done", or with an item to take for "item"
+func futureReady(L *lua.LState) int {
+	f := checkFuture(L, 1).future
+	done, _, _ := f.Poll()
+	L.Push(lua.LBool(done || (L.OptString(2, "done") == "item" && f.Pending() > 0)))
+	return 1
+}
+
+// futureWaitAny blocks until one of a list of futures is ready for its
+// mode, or the spell is stopped
+func futureWaitAny(L *lua.LState) int {
+	futures, modes := L.CheckTable(1), L.CheckTable(2)
+
+	var cases []reflect.SelectCase
+	for i := 1; i <= futures.Len(); i++ {
+		f, ok := toFuture(futures.RawGetInt(i))
+		if !ok {
+			continue
+		}
+		ch := f.future.Done()
+		if lua.LVAsString(modes.RawGetInt(i)) == "item" {
+			updated := f.future.Updated()
+			if f.future.Pending() > 0 {
+				return 0
+			}
+			ch = updated
+		}
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+	}
+	if ctx := L.Context(); ctx != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+	}
+	if len(cases) > 0 {
+		reflect.Select(cases)
+	}
+	return 0
+}
+
+// futureIsFuture reports whether a value is a future handle
+func futureIsFuture(L *lua.LState) int {
+	_, ok := toFuture(L.Get(1))
+	L.Push(lua.LBool(ok))
+	return 1
+}
+
+// futureNewTask creates the future of a task started with async.run and
+// the function the scheduler resolves it with: resolve(ok, value), where
+// value is the task's first return value, or its error when ok is false
+func futureNewTask(L *lua.LState) int {
+	future, resolve := bridge.NewFuture()
+	PushFuture(L, future, func(v interface{}) lua.LValue {
+		if lv, ok := v.(lua.LValue); ok {
+			return lv
+		}
+		return lua.LNil
+	})
+	L.Push(L.NewFunction(func(L *lua.LState) int {
+		if L.ToBool(1) {
+			resolve(L.Get(2), nil)
+		} else {
+			resolve(nil, errors.New(L.ToString(2)))
+		}
+		return 0
+	}))
+	return 2
+}
+
+// futureDone implements f:done()
+func futureDone(L *lua.LState) int {
+	done, _, _ := checkFuture(L, 1).future.Poll()
+	L.Push(lua.LBool(done))
+	return 1
+}
+
+// futureCancel implements f:cancel()
+func futureCancel(L *lua.LState) int {
+	checkFuture(L, 1).future.Cancel()
+	return 0
+}
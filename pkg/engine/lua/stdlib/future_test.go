@@ -0,0 +1,146 @@
+// ABOUTME: Tests for future handles and the cooperative scheduler
+// ABOUTME: Verifies async.run tasks interleave on futures from http and fs, and report errors
+
+package stdlib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func newSchedulerState(t *testing.T, dir string) *lua.LState {
+	t.Helper()
+	L := lua.NewState()
+	t.Cleanup(L.Close)
+	RegisterAsyncCallback(L)
+	RegisterAsyncScheduler(L)
+	RegisterFS(L, NewFS(&FSConfig{AllowedPaths: []string{dir}}))
+	RegisterHTTP(L, NewHTTPClient(nil))
+	return L
+}
+
+func TestAsyncRunInterleavesTasks(t *testing.T) {
+	dir := t.TempDir()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = w.Write([]byte("slow"))
+	}))
+	defer server.Close()
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	L := newSchedulerState(t, dir)
+	L.SetGlobal("url", lua.LString(server.URL))
+	L.SetGlobal("dir", lua.LString(dir))
+	L.SetGlobal("release", L.NewFunction(func(L *lua.LState) int {
+		close(release)
+		return 0
+	}))
+
+	err := L.DoString(`
+		order = {}
+		local slow = async.run(function()
+			local body, err = http.get_async(url):await()
+			table.insert(order, "http")
+			return body
+		end)
+		local fast = async.run(function(path)
+			local content = fs.read_async(path):await()
+			table.insert(order, "fs")
+			fs.write_async(dir .. "/out.txt", content .. "!"):await()
+			release()
+			return content
+		end, dir .. "/in.txt")
+
+		results, errors = async.await_all({slow, fast})
+	`)
+	if err != nil {
+		t.Fatalf("Failed to run tasks: %v", err)
+	}
+
+	order := L.GetGlobal("order").(*lua.LTable)
+	if order.Len() != 2 || order.RawGetInt(1).String() != "fs" || order.RawGetInt(2).String() != "http" {
+		t.Errorf("Expected the fs task to finish while the http task waited, got %v, %v", order.RawGetInt(1), order.RawGetInt(2))
+	}
+	results := L.GetGlobal("results").(*lua.LTable)
+	if results.RawGetInt(1).String() != "slow" || results.RawGetInt(2).String() != "hello" {
+		t.Errorf("Expected both results, got %v, %v", results.RawGetInt(1), results.RawGetInt(2))
+	}
+	if L.GetGlobal("errors") != lua.LNil {
+		t.Errorf("Expected no errors, got %v", L.GetGlobal("errors"))
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "out.txt")); err != nil || string(data) != "hello!" {
+		t.Errorf("Expected the written file, got %q, %v", data, err)
+	}
+}
+
+func TestAsyncRunErrors(t *testing.T) {
+	L := newSchedulerState(t, t.TempDir())
+
+	err := L.DoString(`
+		local failing = async.run(function() error("task failed") end)
+		local denied = fs.read_async("/definitely/not/allowed")
+		local yielding = async.run(function()
+			coroutine.yield()
+			return "after yield"
+		end)
+
+		results, errors = async.await_all({failing, denied, yielding})
+	`)
+	if err != nil {
+		t.Fatalf("Failed to run tasks: %v", err)
+	}
+
+	errs := L.GetGlobal("errors").(*lua.LTable)
+	if errs.RawGetInt(1) == lua.LNil || errs.RawGetInt(2) == lua.LNil {
+		t.Errorf("Expected errors for the failing task and denied read, got %v, %v", errs.RawGetInt(1), errs.RawGetInt(2))
+	}
+	if errs.RawGetInt(3) != lua.LNil {
+		t.Errorf("Expected no error for the yielding task, got %v", errs.RawGetInt(3))
+	}
+	if got := L.GetGlobal("results").(*lua.LTable).RawGetInt(3).String(); got != "after yield" {
+		t.Errorf("Expected the yielding task to finish, got %q", got)
+	}
+}
+
+func TestHTTPRequestAsync(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	L := newSchedulerState(t, t.TempDir())
+	L.SetGlobal("url", lua.LString(server.URL))
+	done := make(chan error, 1)
+	go func() {
+		done <- L.DoString(`
+			local f = http.request_async({method = "put", url = url})
+			response, err = f:await()
+		`)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Failed to request: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the request to finish")
+	}
+
+	response := L.GetGlobal("response").(*lua.LTable)
+	if status := response.RawGetString("status"); status != lua.LNumber(201) {
+		t.Errorf("Expected status 201, got %v", status)
+	}
+	if method := response.RawGetString("headers").(*lua.LTable).RawGetString("X-Method"); method.String() != "PUT" {
+		t.Errorf("Expected a PUT request, got %v", method)
+	}
+}
@@ -1,10 +1,12 @@
 // ABOUTME: HTTP client module for Lua scripts
-// ABOUTME: Provides http.get(), post(), request() functions
+// ABOUTME: Provides http.get(), post(), request(), JSON helpers, and get_async(), request_async() futures, with retries, vetted destinations, and secret headers
 
 package stdlib
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,15 +14,26 @@ import (
 	"strings"
 	"time"
 
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
 	lua "github.com/yuin/gopher-lua"
 )
 
 // HTTPConfig holds configuration for the HTTP module
 type HTTPConfig struct {
+	// Timeout is how long each attempt of a request may take, unless the
+	// request sets its own timeout
 	Timeout         time.Duration
 	MaxResponseSize int64
 	AllowedSchemes  []string
 	UserAgent       string
+
+	// MaxRetries caps the retries a request may ask for
+	MaxRetries int
+
+	// CheckURL, when set, vets every destination, including each redirect;
+	// an error refuses the request. Security profiles restrict where spells
+	// may send requests this way.
+	CheckURL func(*url.URL) error
 }
 
 // DefaultHTTPConfig returns a default HTTP configuration
@@ -30,9 +43,16 @@ func DefaultHTTPConfig() *HTTPConfig {
 		MaxResponseSize: 10 * 1024 * 1024, // 10MB
 		AllowedSchemes:  []string{"http", "https"},
 		UserAgent:       "llmspell/1.0",
+		MaxRetries:      5,
 	}
 }
 
+// maxRedirects is how many redirects a request follows
+const maxRedirects = 10
+
+// defaultBackoff is the wait before the first retry, doubling after each
+const defaultBackoff = 500 * time.Millisecond
+
 // HTTPClient provides HTTP functionality for Lua scripts
 type HTTPClient struct {
 	config *HTTPConfig
@@ -45,12 +65,28 @@ func NewHTTPClient(config *HTTPConfig) *HTTPClient {
 		config = DefaultHTTPConfig()
 	}
 
-	return &HTTPClient{
-		config: config,
-		client: &http.Client{
-			Timeout: config.Timeout,
+	h := &HTTPClient{config: config}
+	// Each attempt has its own deadline, so the client sets none
+	h.client = &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if err := h.checkURL(req.URL); err != nil {
+				return err
+			}
+			// Secrets only follow redirects to hosts they may be sent to
+			if secrets, ok := req.Context().Value(secretHeadersKey{}).(map[string]*bridge.SecretHandle); ok {
+				for key, handle := range secrets {
+					if req.URL.Host != via[0].URL.Host && !handle.Allows(req.URL.Hostname()) {
+						req.Header.Del(key)
+					}
+				}
+			}
+			return nil
 		},
 	}
+	return h
 }
 
 // RegisterHTTP registers the HTTP module with all functions
@@ -62,19 +98,41 @@ func RegisterHTTP(L *lua.LState, httpClient *HTTPClient) {
 	L.SetField(httpModule, "get", L.NewClosure(httpClient.get))
 	L.SetField(httpModule, "post", L.NewClosure(httpClient.post))
 	L.SetField(httpModule, "request", L.NewClosure(httpClient.request))
+	L.SetField(httpModule, "get_json", L.NewClosure(httpClient.getJSON))
+	L.SetField(httpModule, "post_json", L.NewClosure(httpClient.postJSON))
+	L.SetField(httpModule, "get_async", L.NewClosure(httpClient.getAsync))
+	L.SetField(httpModule, "request_async", L.NewClosure(httpClient.requestAsync))
 
 	// Register the module
 	L.SetGlobal("http", httpModule)
 }
 
+// refusedError is a destination the scheme list or CheckURL refused;
+// retrying will not help
+type refusedError struct {
+	error
+}
+
+// Unwrap returns why the destination was refused
+func (e refusedError) Unwrap() error {
+	return e.error
+}
+
 // validateURL validates and parses a URL
 func (h *HTTPClient) validateURL(urlStr string) (*url.URL, error) {
 	u, err := url.Parse(urlStr)
 	if err != nil {
 		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
+	if err := h.checkURL(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
 
-	// Check scheme
+// checkURL refuses destinations with a scheme that is not allowed, or
+// that CheckURL refuses
+func (h *HTTPClient) checkURL(u *url.URL) error {
 	schemeAllowed := false
 	for _, allowed := range h.config.AllowedSchemes {
 		if u.Scheme == allowed {
@@ -83,196 +141,399 @@ func (h *HTTPClient) validateURL(urlStr string) (*url.URL, error) {
 		}
 	}
 	if !schemeAllowed {
-		return nil, fmt.Errorf("scheme %s not allowed", u.Scheme)
+		return refusedError{fmt.Errorf("scheme %s not allowed", u.Scheme)}
 	}
-
-	return u, nil
+	if h.config.CheckURL != nil {
+		if err := h.config.CheckURL(u); err != nil {
+			return refusedError{err}
+		}
+	}
+	return nil
 }
 
-// get performs an HTTP GET request
-// Usage: content, err = http.get(url)
-func (h *HTTPClient) get(L *lua.LState) int {
-	urlStr := L.CheckString(1)
+// secretHeadersKey carries a request's secret headers to its redirects
+type secretHeadersKey struct{}
+
+// httpRequest is a request as a script described it
+type httpRequest struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+	HasBody bool
+
+	// Secrets are headers whose values are secret handles, revealed for
+	// the host the request goes to
+	Secrets map[string]*bridge.SecretHandle
+
+	// Timeout bounds each attempt; zero uses the configured timeout
+	Timeout time.Duration
+	// Retries is how many times a failed attempt is repeated, waiting
+	// Backoff before the first retry and twice as long before each next
+	Retries int
+	Backoff time.Duration
+}
 
-	_, err := h.validateURL(urlStr)
-	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+// readOptions reads headers, body, json, timeout, retries, and backoff
+// from a Lua options table into req. json is encoded as the body, sent as
+// application/json unless the headers say otherwise.
+func (h *HTTPClient) readOptions(L *lua.LState, options *lua.LTable, req *httpRequest) error {
+	if options == nil {
+		return nil
+	}
+	if t, ok := L.GetField(options, "headers").(*lua.LTable); ok {
+		t.ForEach(func(key, value lua.LValue) {
+			keyStr, ok := key.(lua.LString)
+			if !ok {
+				return
+			}
+			if ud, ok := value.(*lua.LUserData); ok {
+				if handle, ok := ud.Value.(*bridge.SecretHandle); ok {
+					if req.Secrets == nil {
+						req.Secrets = make(map[string]*bridge.SecretHandle)
+					}
+					req.Secrets[string(keyStr)] = handle
+					return
+				}
+			}
+			req.Headers[string(keyStr)] = lua.LVAsString(value)
+		})
+	}
+	if v := L.GetField(options, "body"); v != lua.LNil {
+		req.Body, req.HasBody = lua.LVAsString(v), true
+	}
+	if v := L.GetField(options, "json"); v != lua.LNil {
+		data, err := json.Marshal(luaToGo(v))
+		if err != nil {
+			return fmt.Errorf("json: %w", err)
+		}
+		req.Body, req.HasBody = string(data), true
+		req.setDefaultHeader("Content-Type", "application/json")
+	}
+	if v, ok := L.GetField(options, "timeout").(lua.LNumber); ok && v > 0 {
+		req.Timeout = time.Duration(float64(v) * float64(time.Second))
+	}
+	if v, ok := L.GetField(options, "retries").(lua.LNumber); ok && v > 0 {
+		req.Retries = min(int(v), h.config.MaxRetries)
 	}
+	if v, ok := L.GetField(options, "backoff").(lua.LNumber); ok && v >= 0 {
+		req.Backoff = time.Duration(float64(v) * float64(time.Second))
+	}
+	return nil
+}
 
-	req, err := http.NewRequest("GET", urlStr, nil)
-	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+// setDefaultHeader sets a header the script did not set itself, in any
+// capitalization
+func (req *httpRequest) setDefaultHeader(key, value string) {
+	for k := range req.Headers {
+		if strings.EqualFold(k, key) {
+			return
+		}
 	}
+	req.Headers[key] = value
+}
 
-	req.Header.Set("User-Agent", h.config.UserAgent)
+// newRequest starts a request to urlStr with the default backoff
+func newRequest(method, urlStr string) httpRequest {
+	return httpRequest{Method: method, URL: urlStr, Headers: make(map[string]string), Backoff: defaultBackoff}
+}
 
-	resp, err := h.client.Do(req)
-	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+// get performs an HTTP GET request
+// Usage: content, err = http.get(url[, {headers = {...}, timeout = seconds, retries = n, backoff = seconds}])
+func (h *HTTPClient) get(L *lua.LState) int {
+	req := newRequest("GET", L.CheckString(1))
+	if err := h.readOptions(L, L.OptTable(2, nil), &req); err != nil {
+		return pushError(L, err)
 	}
-	defer resp.Body.Close()
-
-	// Read response with size limit
-	body, err := io.ReadAll(io.LimitReader(resp.Body, h.config.MaxResponseSize))
+	result, err := h.do(luaContext(L), req)
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return pushError(L, err)
 	}
-
-	// Check status code
-	if resp.StatusCode >= 400 {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(fmt.Sprintf("HTTP %d: %s", resp.StatusCode, resp.Status)))
-		return 2
+	if result.Status >= 400 {
+		return pushError(L, fmt.Errorf("HTTP %d: %s", result.Status, result.StatusLine))
 	}
-
-	L.Push(lua.LString(string(body)))
+	L.Push(lua.LString(result.Body))
 	return 1
 }
 
 // post performs an HTTP POST request
-// Usage: response, err = http.post(url, body, content_type)
+// Usage: response, err = http.post(url, body[, content_type][, options])
 func (h *HTTPClient) post(L *lua.LState) int {
-	urlStr := L.CheckString(1)
-	body := L.CheckString(2)
-	contentType := L.OptString(3, "application/json")
+	req := newRequest("POST", L.CheckString(1))
+	req.Body, req.HasBody = L.CheckString(2), true
+	contentType, options := "application/json", L.Get(3)
+	if s, ok := options.(lua.LString); ok {
+		contentType, options = string(s), L.Get(4)
+	}
+	if table, ok := options.(*lua.LTable); ok {
+		if err := h.readOptions(L, table, &req); err != nil {
+			return pushError(L, err)
+		}
+	}
+	req.setDefaultHeader("Content-Type", contentType)
 
-	_, err := h.validateURL(urlStr)
+	result, err := h.do(luaContext(L), req)
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return pushError(L, err)
+	}
+	if result.Status >= 400 {
+		return pushError(L, fmt.Errorf("HTTP %d: %s - %s", result.Status, result.StatusLine, result.Body))
 	}
+	L.Push(lua.LString(result.Body))
+	return 1
+}
 
-	req, err := http.NewRequest("POST", urlStr, bytes.NewBufferString(body))
+// request performs a custom HTTP request
+// Usage: response, err = http.request({method="GET", url="...", headers={...}, body="..." or json=value, timeout=seconds, retries=n, backoff=seconds})
+func (h *HTTPClient) request(L *lua.LState) int {
+	req, err := h.requestOptions(L, L.CheckTable(1))
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return pushError(L, err)
 	}
 
-	req.Header.Set("User-Agent", h.config.UserAgent)
-	req.Header.Set("Content-Type", contentType)
-
-	resp, err := h.client.Do(req)
+	result, err := h.do(luaContext(L), req)
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return pushError(L, err)
 	}
-	defer resp.Body.Close()
 
-	// Read response with size limit
-	respBody, err := io.ReadAll(io.LimitReader(resp.Body, h.config.MaxResponseSize))
-	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+	L.Push(result.toLua(L))
+	return 1
+}
+
+// getJSON fetches a JSON document and decodes it; a status of 400 or more
+// is an error
+// Usage: value, err = http.get_json(url[, options])
+func (h *HTTPClient) getJSON(L *lua.LState) int {
+	req := newRequest("GET", L.CheckString(1))
+	if err := h.readOptions(L, L.OptTable(2, nil), &req); err != nil {
+		return pushError(L, err)
 	}
+	return h.doJSON(L, req)
+}
 
-	// Check status code
-	if resp.StatusCode >= 400 {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(fmt.Sprintf("HTTP %d: %s - %s", resp.StatusCode, resp.Status, string(respBody))))
-		return 2
+// postJSON sends value as JSON and decodes the JSON response; a response
+// without a body returns true
+// Usage: value, err = http.post_json(url, value[, options])
+func (h *HTTPClient) postJSON(L *lua.LState) int {
+	req := newRequest("POST", L.CheckString(1))
+	options := L.OptTable(3, L.NewTable())
+	L.SetField(options, "json", L.CheckAny(2))
+	if err := h.readOptions(L, options, &req); err != nil {
+		return pushError(L, err)
 	}
+	return h.doJSON(L, req)
+}
 
-	L.Push(lua.LString(string(respBody)))
+// doJSON sends a request accepting JSON and pushes the decoded response
+func (h *HTTPClient) doJSON(L *lua.LState, req httpRequest) int {
+	req.setDefaultHeader("Accept", "application/json")
+	result, err := h.do(luaContext(L), req)
+	if err != nil {
+		return pushError(L, err)
+	}
+	if result.Status >= 400 {
+		return pushError(L, fmt.Errorf("HTTP %d: %s - %s", result.Status, result.StatusLine, result.Body))
+	}
+	if strings.TrimSpace(result.Body) == "" {
+		L.Push(lua.LTrue)
+		return 1
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(result.Body), &value); err != nil {
+		return pushError(L, fmt.Errorf("invalid JSON response: %w", err))
+	}
+	L.Push(goToLua(L, value))
 	return 1
 }
 
-// request performs a custom HTTP request
-// Usage: response, err = http.request({method="GET", url="...", headers={...}, body="..."})
-func (h *HTTPClient) request(L *lua.LState) int {
-	options := L.CheckTable(1)
+// getAsync starts an HTTP GET in the background and returns a future for
+// the body; like http.get, a status of 400 or more is an error
+// Usage: f = http.get_async(url[, options]); content, err = f:await()
+func (h *HTTPClient) getAsync(L *lua.LState) int {
+	req := newRequest("GET", L.CheckString(1))
+	optErr := h.readOptions(L, L.OptTable(2, nil), &req)
 
-	// Extract options
+	future := bridge.Async(luaContext(L), func(ctx context.Context, _ func(interface{})) (interface{}, error) {
+		if optErr != nil {
+			return nil, optErr
+		}
+		result, err := h.do(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if result.Status >= 400 {
+			return nil, fmt.Errorf("HTTP %d: %s", result.Status, result.StatusLine)
+		}
+		return result.Body, nil
+	})
+	PushFuture(L, future, func(v interface{}) lua.LValue {
+		return lua.LString(v.(string))
+	})
+	return 1
+}
+
+// requestAsync starts a custom HTTP request in the background and returns
+// a future for the response table http.request returns
+// Usage: f = http.request_async({method="GET", url="...", headers={...}, body="..."})
+func (h *HTTPClient) requestAsync(L *lua.LState) int {
+	req, err := h.requestOptions(L, L.CheckTable(1))
+	future := bridge.Async(luaContext(L), func(ctx context.Context, _ func(interface{})) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		return h.do(ctx, req)
+	})
+	PushFuture(L, future, func(v interface{}) lua.LValue {
+		return v.(*httpResult).toLua(L)
+	})
+	return 1
+}
+
+// requestOptions reads a request from its Lua options table: the method
+// and URL, and the options readOptions reads
+func (h *HTTPClient) requestOptions(L *lua.LState, options *lua.LTable) (httpRequest, error) {
 	method := "GET"
 	if v := L.GetField(options, "method"); v != lua.LNil {
 		method = strings.ToUpper(lua.LVAsString(v))
 	}
 
-	urlStr := ""
-	if v := L.GetField(options, "url"); v != lua.LNil {
-		urlStr = lua.LVAsString(v)
-	} else {
-		L.Push(lua.LNil)
-		L.Push(lua.LString("url is required"))
-		return 2
+	v := L.GetField(options, "url")
+	if v == lua.LNil {
+		return httpRequest{}, fmt.Errorf("url is required")
 	}
+	req := newRequest(method, lua.LVAsString(v))
+	if err := h.readOptions(L, options, &req); err != nil {
+		return httpRequest{}, err
+	}
+	return req, nil
+}
 
-	_, err := h.validateURL(urlStr)
+// httpResult is a response read in full, so it can be handed to Lua after
+// a request that ran in the background
+type httpResult struct {
+	Status     int
+	StatusLine string
+	Body       string
+	Headers    map[string]string
+}
+
+// do sends a request. Attempts that fail to connect or time out, and
+// responses with status 429, 502, 503, or 504, are retried up to
+// req.Retries times; a refused destination or a stopped spell is not.
+func (h *HTTPClient) do(ctx context.Context, req httpRequest) (*httpResult, error) {
+	if _, err := h.validateURL(req.URL); err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		result, err := h.fetch(ctx, req)
+		if attempt >= req.Retries || ctx.Err() != nil || !retryable(result, err) {
+			return result, err
+		}
+		select {
+		case <-time.After(req.Backoff << attempt):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// retryable reports whether another attempt might succeed
+func retryable(result *httpResult, err error) bool {
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		var refused refusedError
+		return !errors.As(err, &refused)
+	}
+	switch result.Status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// fetch makes one attempt at a request and reads its response, up to the
+// size limit
+func (h *HTTPClient) fetch(ctx context.Context, req httpRequest) (*httpResult, error) {
+	timeout := req.Timeout
+	if timeout == 0 {
+		timeout = h.config.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
 	var body io.Reader
-	if v := L.GetField(options, "body"); v != lua.LNil {
-		body = bytes.NewBufferString(lua.LVAsString(v))
+	if req.HasBody {
+		body = strings.NewReader(req.Body)
 	}
-
-	req, err := http.NewRequest(method, urlStr, body)
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, body)
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return nil, err
 	}
 
-	// Set default User-Agent
-	req.Header.Set("User-Agent", h.config.UserAgent)
-
-	// Set custom headers
-	if v := L.GetField(options, "headers"); v != lua.LNil {
-		if headers, ok := v.(*lua.LTable); ok {
-			headers.ForEach(func(key, value lua.LValue) {
-				if keyStr, ok := key.(lua.LString); ok {
-					req.Header.Set(string(keyStr), lua.LVAsString(value))
-				}
-			})
+	// Set default User-Agent, then custom headers
+	httpReq.Header.Set("User-Agent", h.config.UserAgent)
+	for key, value := range req.Headers {
+		httpReq.Header.Set(key, value)
+	}
+	if len(req.Secrets) > 0 {
+		for key, handle := range req.Secrets {
+			value, err := handle.Reveal(httpReq.URL.Hostname())
+			if err != nil {
+				return nil, refusedError{err}
+			}
+			httpReq.Header.Set(key, value)
 		}
+		httpReq = httpReq.WithContext(context.WithValue(ctx, secretHeadersKey{}, req.Secrets))
 	}
 
-	resp, err := h.client.Do(req)
+	resp, err := h.client.Do(httpReq)
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// Read response with size limit
 	respBody, err := io.ReadAll(io.LimitReader(resp.Body, h.config.MaxResponseSize))
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return nil, err
 	}
 
-	// Create response table
-	respTable := L.NewTable()
-	L.SetField(respTable, "status", lua.LNumber(resp.StatusCode))
-	L.SetField(respTable, "body", lua.LString(string(respBody)))
-
-	// Add headers
-	headersTable := L.NewTable()
+	result := &httpResult{
+		Status:     resp.StatusCode,
+		StatusLine: resp.Status,
+		Body:       string(respBody),
+		Headers:    make(map[string]string),
+	}
 	for key, values := range resp.Header {
 		if len(values) > 0 {
-			L.SetField(headersTable, key, lua.LString(values[0]))
+			result.Headers[key] = values[0]
 		}
 	}
+	return result, nil
+}
+
+// toLua converts a response to the table http.request returns
+func (r *httpResult) toLua(L *lua.LState) *lua.LTable {
+	respTable := L.NewTable()
+	L.SetField(respTable, "status", lua.LNumber(r.Status))
+	L.SetField(respTable, "body", lua.LString(r.Body))
+
+	headersTable := L.NewTable()
+	for key, value := range r.Headers {
+		L.SetField(headersTable, key, lua.LString(value))
+	}
 	L.SetField(respTable, "headers", headersTable)
+	return respTable
+}
 
-	L.Push(respTable)
-	return 1
+// luaContext returns the context of the spell running in L
+func luaContext(L *lua.LState) context.Context {
+	if ctx := L.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
 }
 
 // RegisterSimpleHTTP registers a simplified HTTP get function (used in examples)
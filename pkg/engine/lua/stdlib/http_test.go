@@ -0,0 +1,208 @@
+// ABOUTME: Tests for the http module against a local server
+// ABOUTME: Covers headers, secret headers, JSON helpers, timeouts, retries, and destinations the config refuses
+
+package stdlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func newHTTPTestState(t *testing.T, config *HTTPConfig, handler http.Handler) *lua.LState {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	L := lua.NewState()
+	t.Cleanup(L.Close)
+	if config == nil {
+		config = DefaultHTTPConfig()
+	}
+	RegisterHTTP(L, NewHTTPClient(config))
+	L.SetGlobal("base", lua.LString(server.URL))
+	return L
+}
+
+func TestHTTPRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"method":       r.Method,
+			"token":        r.Header.Get("X-Token"),
+			"accept":       r.Header.Get("Accept"),
+			"content_type": r.Header.Get("Content-Type"),
+			"body":         string(body),
+		})
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	L := newHTTPTestState(t, nil, mux)
+
+	err := L.DoString(`
+		local body = assert(http.get(base .. "/echo", {headers = {["X-Token"] = "secret"}}))
+		assert(body:find('"token":"secret"'), body)
+
+		local echo = assert(http.get_json(base .. "/echo"))
+		assert(echo.method == "GET" and echo.accept == "application/json")
+
+		echo = assert(http.post_json(base .. "/echo", {name = "spell"}))
+		assert(echo.method == "POST" and echo.content_type == "application/json")
+		assert(echo.body == '{"name":"spell"}', echo.body)
+
+		assert(http.post_json(base .. "/empty", {}) == true)
+
+		local resp = assert(http.request({method = "put", url = base .. "/echo", json = {1, 2}}))
+		assert(resp.status == 200 and resp.body:find('"method":"PUT"'))
+
+		local value, err = http.get_json(base .. "/missing")
+		assert(value == nil and err:find("HTTP 404"), err)
+
+		value, err = http.get(base .. "/slow", {timeout = 0.05})
+		assert(value == nil and err:find("deadline exceeded"), err)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHTTPRetries(t *testing.T) {
+	var calls atomic.Int32
+	L := newHTTPTestState(t, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+
+	if err := L.DoString(`
+		local value, err = http.get(base, {retries = 1, backoff = 0})
+		assert(value == nil and err:find("HTTP 503"), err)
+	`); err != nil {
+		t.Fatal(err)
+	}
+	calls.Store(0)
+	if err := L.DoString(`assert(http.get(base, {retries = 3, backoff = 0}) == "ok")`); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("Expected 3 attempts, got %d", got)
+	}
+}
+
+func TestHTTPCheckURL(t *testing.T) {
+	var calls atomic.Int32
+	errRefused := errors.New("not allowed here")
+	config := DefaultHTTPConfig()
+	config.CheckURL = func(u *url.URL) error {
+		if u.Path == "/secret" {
+			return errRefused
+		}
+		return nil
+	}
+	L := newHTTPTestState(t, config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/secret", http.StatusFound)
+		}
+	}))
+
+	err := L.DoString(`
+		local value, err = http.get(base .. "/secret", {retries = 3, backoff = 0})
+		assert(value == nil and err:find("not allowed here"), err)
+
+		value, err = http.get(base .. "/redirect", {retries = 3, backoff = 0})
+		assert(value == nil and err:find("not allowed here"), err)
+
+		value, err = http.get("file:///etc/passwd")
+		assert(value == nil and err:find("scheme file not allowed"), err)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected only the redirect to reach the server, once, got %d calls", got)
+	}
+}
+
+func TestHTTPSecretHeaders(t *testing.T) {
+	received := make(chan http.Header, 10)
+	L := newHTTPTestState(t, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+			return
+		}
+		received <- r.Header.Clone()
+	}))
+	base := L.GetGlobal("base").String()
+	L.SetGlobal("other", lua.LString(strings.Replace(base, "127.0.0.1", "localhost", 1)))
+
+	secrets := bridge.NewSecretsBridge(bridge.SecretsConfig{Secrets: map[string]bridge.Secret{
+		"api":  {Value: "s3cret", Hosts: []string{"127.0.0.1"}},
+		"both": {Value: "shared", Hosts: []string{"127.0.0.1", "localhost"}},
+		"open": {Value: "anywhere", Hosts: []string{"*"}},
+		"none": {Value: "nowhere"},
+	}})
+	for _, name := range []string{"api", "both", "open", "none"} {
+		handle, err := secrets.Handle(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ud := L.NewUserData()
+		ud.Value = handle
+		L.SetGlobal(name, ud)
+	}
+	bearer, _ := secrets.Handle(context.Background(), "api")
+	bearer, _ = bearer.Format("Bearer %s")
+	ud := L.NewUserData()
+	ud.Value = bearer
+	L.SetGlobal("bearer", ud)
+
+	err := L.DoString(`
+		assert(http.get(base .. "/echo", {headers = {Authorization = bearer, ["X-Open"] = open}}))
+
+		local value, err = http.get(other .. "/echo", {headers = {["X-Api"] = api}})
+		assert(value == nil and err:find("may not be sent to localhost"), err)
+		local value, err = http.get(base .. "/echo", {headers = {["X-None"] = none}})
+		assert(value == nil and err:find("lists no hosts"), err)
+
+		assert(http.get(base .. "/redirect?to=" .. other .. "/echo", {headers = {["X-Api"] = api, ["X-Both"] = both, ["X-Open"] = open}}))
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := <-received
+	if first.Get("Authorization") != "Bearer s3cret" || first.Get("X-Open") != "anywhere" {
+		t.Errorf("Expected the secrets in the headers, got %v", first)
+	}
+	redirected := <-received
+	if redirected.Get("X-Api") != "" || redirected.Get("X-Open") != "anywhere" || redirected.Get("X-Both") != "shared" {
+		t.Errorf("Expected only secrets listing the new host to follow the redirect, got %v", redirected)
+	}
+	if len(received) != 0 {
+		t.Error("Expected the refused request not to reach the server")
+	}
+}
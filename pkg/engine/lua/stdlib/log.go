@@ -1,38 +1,253 @@
 // ABOUTME: Logging module for Lua scripts using slog
-// ABOUTME: Provides log.info(), error(), debug(), warn() functions
+// ABOUTME: Provides log.info(), error(), debug(), warn(), assert() and trace() functions
 
 package stdlib
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	lua "github.com/yuin/gopher-lua"
 )
 
+// AssertMode controls what log.assert does when a condition fails
+type AssertMode int
+
+const (
+	// AssertRaise raises a script error with the message and a traceback (development)
+	AssertRaise AssertMode = iota
+
+	// AssertLog logs the failure at error level and lets the spell continue (production)
+	AssertLog
+
+	// AssertOff disables assertion checks entirely
+	AssertOff
+)
+
+// String returns the name of the assert mode
+func (m AssertMode) String() string {
+	switch m {
+	case AssertRaise:
+		return "raise"
+	case AssertLog:
+		return "log"
+	case AssertOff:
+		return "off"
+	default:
+		return fmt.Sprintf("AssertMode(%d)", int(m))
+	}
+}
+
+// ParseAssertMode returns the assert mode String names; empty is
+// AssertRaise
+func ParseAssertMode(name string) (AssertMode, error) {
+	switch name {
+	case "", "raise":
+		return AssertRaise, nil
+	case "log":
+		return AssertLog, nil
+	case "off":
+		return AssertOff, nil
+	}
+	return AssertRaise, fmt.Errorf("unknown assert mode %q", name)
+}
+
+// TraceEntry is a manual trace point emitted by a script through log.trace
+type TraceEntry struct {
+	// Sequence is a monotonic counter scoped to the logger (starts at 1)
+	Sequence uint64 `json:"seq"`
+
+	// TraceID correlates all entries emitted during one spell execution
+	TraceID string `json:"trace_id"`
+
+	// Spell is the name of the spell that emitted the entry
+	Spell string `json:"spell"`
+
+	// Message is the trace message
+	Message string `json:"message"`
+
+	// Where is the script call site (e.g. "main.lua:12")
+	Where string `json:"where"`
+
+	// Data holds optional structured fields
+	Data map[string]interface{} `json:"data,omitempty"`
+
+	// Timestamp is when the entry was emitted
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TraceSink receives trace entries emitted by scripts
+type TraceSink func(entry TraceEntry)
+
+// LevelOff is a level above every standard level, used to silence a component
+const LevelOff = slog.Level(12)
+
 // Logger provides logging functionality for Lua scripts
 type Logger struct {
-	logger *slog.Logger
-	ctx    context.Context
+	logger     *slog.Logger
+	ctx        context.Context
+	name       string
+	assertMode AssertMode
+	traceID    string
+	traceSeq   atomic.Uint64
+	traceSink  TraceSink
+
+	levelMu      sync.RWMutex
+	defaultLevel slog.Level
+	levels       map[string]slog.Level
 }
 
 // NewLogger creates a new logger instance
 func NewLogger(name string, level slog.Level) *Logger {
+	// The handler lets everything through; level gating happens per component
 	opts := &slog.HandlerOptions{
-		Level: level,
+		Level: slog.LevelDebug,
 	}
 
-	handler := slog.NewTextHandler(os.Stderr, opts)
+	logger := NewLoggerWithHandler(name, slog.NewTextHandler(os.Stderr, opts))
+	logger.SetLevel("*", level)
+	return logger
+}
+
+// NewLoggerWithHandler creates a new logger that writes through the given handler.
+// The default level is debug, so the handler's own level decides what is written
+// until SetLevel narrows it.
+func NewLoggerWithHandler(name string, handler slog.Handler) *Logger {
 	logger := slog.New(handler).With("spell", name)
 
 	return &Logger{
-		logger: logger,
-		ctx:    context.Background(),
+		logger:       logger,
+		ctx:          context.Background(),
+		name:         name,
+		traceID:      newTraceID(),
+		defaultLevel: slog.LevelDebug,
+		levels:       make(map[string]slog.Level),
 	}
 }
 
+// SetLevel sets the minimum level for a component. Components are dotted
+// paths ("agent.tools") that inherit from their parents ("agent"); the
+// wildcard "*" (or "") sets the default for components without an override.
+func (l *Logger) SetLevel(component string, level slog.Level) {
+	l.levelMu.Lock()
+	defer l.levelMu.Unlock()
+
+	if component == "*" || component == "" {
+		l.defaultLevel = level
+		return
+	}
+	l.levels[component] = level
+}
+
+// EffectiveLevel resolves the minimum level for a component by walking up
+// its dotted path until an explicit level is found
+func (l *Logger) EffectiveLevel(component string) slog.Level {
+	l.levelMu.RLock()
+	defer l.levelMu.RUnlock()
+
+	for component != "" {
+		if level, ok := l.levels[component]; ok {
+			return level
+		}
+		idx := strings.LastIndex(component, ".")
+		if idx < 0 {
+			break
+		}
+		component = component[:idx]
+	}
+
+	return l.defaultLevel
+}
+
+// Enabled reports whether a message at level from component would be emitted
+func (l *Logger) Enabled(component string, level slog.Level) bool {
+	return level >= l.EffectiveLevel(component)
+}
+
+// LevelConfig returns the default level and the resolved level of every
+// component that has an explicit setting
+func (l *Logger) LevelConfig() (slog.Level, map[string]slog.Level) {
+	l.levelMu.RLock()
+	names := make([]string, 0, len(l.levels))
+	for name := range l.levels {
+		names = append(names, name)
+	}
+	defaultLevel := l.defaultLevel
+	l.levelMu.RUnlock()
+
+	resolved := make(map[string]slog.Level, len(names))
+	for _, name := range names {
+		resolved[name] = l.EffectiveLevel(name)
+	}
+
+	return defaultLevel, resolved
+}
+
+// ParseLevel converts a level name used by scripts into a slog level
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	case "off", "none":
+		return LevelOff, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// levelName converts a slog level into the name used by scripts
+func levelName(level slog.Level) string {
+	if level >= LevelOff {
+		return "off"
+	}
+	return strings.ToLower(level.String())
+}
+
+// newTraceID generates a random identifier for correlating trace entries
+func newTraceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// TraceID returns the identifier shared by all trace entries from this logger
+func (l *Logger) TraceID() string {
+	return l.traceID
+}
+
+// SetTraceID makes trace entries join an existing trace, such as the one
+// of the spell that started this one
+func (l *Logger) SetTraceID(id string) {
+	l.traceID = id
+}
+
+// SetTraceSink routes trace entries to the given sink instead of the log output
+func (l *Logger) SetTraceSink(sink TraceSink) {
+	l.traceSink = sink
+}
+
+// SetAssertMode sets how failed assertions are handled
+func (l *Logger) SetAssertMode(mode AssertMode) {
+	l.assertMode = mode
+}
+
 // RegisterLog registers the log module with all functions
 func RegisterLog(L *lua.LState, logger *Logger) {
 	// Create log module table
@@ -43,6 +258,12 @@ func RegisterLog(L *lua.LState, logger *Logger) {
 	L.SetField(logModule, "info", L.NewClosure(logger.info))
 	L.SetField(logModule, "warn", L.NewClosure(logger.warn))
 	L.SetField(logModule, "error", L.NewClosure(logger.error))
+	L.SetField(logModule, "assert", L.NewClosure(logger.assert))
+	L.SetField(logModule, "trace", L.NewClosure(logger.trace))
+	L.SetField(logModule, "component", L.NewClosure(logger.component))
+	L.SetField(logModule, "set_level", L.NewClosure(logger.setLevel))
+	L.SetField(logModule, "get_level", L.NewClosure(logger.getLevel))
+	L.SetField(logModule, "get_config", L.NewClosure(logger.getConfig))
 
 	// Register the module
 	L.SetGlobal("log", logModule)
@@ -71,31 +292,179 @@ func (l *Logger) formatMessage(L *lua.LState) (string, []slog.Attr) {
 	return msg, attrs
 }
 
-// debug logs a debug message
-func (l *Logger) debug(L *lua.LState) int {
+// logAt logs the message on the Lua stack if the component's level allows it
+func (l *Logger) logAt(L *lua.LState, component string, level slog.Level) int {
+	if !l.Enabled(component, level) {
+		return 0
+	}
+
 	msg, attrs := l.formatMessage(L)
-	l.logger.LogAttrs(l.ctx, slog.LevelDebug, msg, attrs...)
+	if component != "" {
+		attrs = append(attrs, slog.String("component", component))
+	}
+	l.logger.LogAttrs(l.ctx, level, msg, attrs...)
 	return 0
 }
 
+// debug logs a debug message
+func (l *Logger) debug(L *lua.LState) int {
+	return l.logAt(L, "", slog.LevelDebug)
+}
+
 // info logs an info message
 func (l *Logger) info(L *lua.LState) int {
-	msg, attrs := l.formatMessage(L)
-	l.logger.LogAttrs(l.ctx, slog.LevelInfo, msg, attrs...)
-	return 0
+	return l.logAt(L, "", slog.LevelInfo)
 }
 
 // warn logs a warning message
 func (l *Logger) warn(L *lua.LState) int {
-	msg, attrs := l.formatMessage(L)
-	l.logger.LogAttrs(l.ctx, slog.LevelWarn, msg, attrs...)
-	return 0
+	return l.logAt(L, "", slog.LevelWarn)
 }
 
 // error logs an error message
 func (l *Logger) error(L *lua.LState) int {
-	msg, attrs := l.formatMessage(L)
-	l.logger.LogAttrs(l.ctx, slog.LevelError, msg, attrs...)
+	return l.logAt(L, "", slog.LevelError)
+}
+
+// component returns a logger table whose messages are tagged with, and
+// filtered by, the given component
+// Usage: agentLog = log.component("agent.tools"); agentLog.debug("picked tool")
+func (l *Logger) component(L *lua.LState) int {
+	name := L.CheckString(1)
+
+	levels := map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"info":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	}
+
+	mod := L.NewTable()
+	for fnName, level := range levels {
+		level := level
+		L.SetField(mod, fnName, L.NewFunction(func(L *lua.LState) int {
+			return l.logAt(L, name, level)
+		}))
+	}
+	L.SetField(mod, "name", lua.LString(name))
+
+	L.Push(mod)
+	return 1
+}
+
+// setLevel sets the level for a component, or the default when only a level is given
+// Usage: err = log.set_level("debug") or log.set_level("agent.tools", "debug")
+func (l *Logger) setLevel(L *lua.LState) int {
+	component, levelStr := "*", L.CheckString(1)
+	if L.GetTop() >= 2 {
+		component, levelStr = levelStr, L.CheckString(2)
+	}
+
+	level, err := ParseLevel(levelStr)
+	if err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+
+	l.SetLevel(component, level)
+	return 0
+}
+
+// getLevel returns the effective level name for a component (default when omitted)
+// Usage: level = log.get_level("agent.tools")
+func (l *Logger) getLevel(L *lua.LState) int {
+	L.Push(lua.LString(levelName(l.EffectiveLevel(L.OptString(1, "")))))
+	return 1
+}
+
+// getConfig returns the default level and the resolved component levels
+// Usage: cfg = log.get_config() -- {default = "info", components = {agent = "debug"}}
+func (l *Logger) getConfig(L *lua.LState) int {
+	defaultLevel, resolved := l.LevelConfig()
+
+	names := make([]string, 0, len(resolved))
+	for name := range resolved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	components := L.NewTable()
+	for _, name := range names {
+		L.SetField(components, name, lua.LString(levelName(resolved[name])))
+	}
+
+	cfg := L.NewTable()
+	L.SetField(cfg, "default", lua.LString(levelName(defaultLevel)))
+	L.SetField(cfg, "components", components)
+	L.SetField(cfg, "assert_mode", lua.LString(l.assertMode.String()))
+
+	L.Push(cfg)
+	return 1
+}
+
+// assert checks a condition and handles failures according to the assert mode
+// Usage: ok = log.assert(condition, message)
+func (l *Logger) assert(L *lua.LState) int {
+	ok := lua.LVAsBool(L.Get(1))
+	if ok || l.assertMode == AssertOff {
+		L.Push(lua.LBool(ok))
+		return 1
+	}
+
+	msg := L.OptString(2, "assertion failed!")
+
+	if l.assertMode == AssertRaise {
+		// RaiseError prefixes the caller's position and the engine's
+		// protected call attaches the stack traceback
+		L.RaiseError("%s", msg)
+		return 0
+	}
+
+	l.logger.LogAttrs(l.ctx, slog.LevelError, msg,
+		slog.String("assertion", "failed"),
+		slog.String("where", strings.TrimSuffix(L.Where(1), ":")))
+	L.Push(lua.LFalse)
+	return 1
+}
+
+// trace emits a trace entry with the call site and a sequence number
+// Usage: log.trace(message, data)
+func (l *Logger) trace(L *lua.LState) int {
+	entry := TraceEntry{
+		Sequence:  l.traceSeq.Add(1),
+		TraceID:   l.traceID,
+		Spell:     l.name,
+		Message:   L.CheckString(1),
+		Where:     strings.TrimSuffix(L.Where(1), ":"),
+		Timestamp: ClockOf(L).Now(),
+	}
+
+	if L.GetTop() >= 2 && L.Get(2) != lua.LNil {
+		if fields, ok := luaToGo(L.Get(2)).(map[string]interface{}); ok {
+			entry.Data = fields
+		} else {
+			entry.Data = map[string]interface{}{"value": luaToGo(L.Get(2))}
+		}
+	}
+
+	if l.traceSink != nil {
+		l.traceSink(entry)
+		return 0
+	}
+
+	if !l.Enabled("", slog.LevelDebug) {
+		return 0
+	}
+
+	attrs := []slog.Attr{
+		slog.String("trace_id", entry.TraceID),
+		slog.Uint64("seq", entry.Sequence),
+		slog.String("where", entry.Where),
+	}
+	if len(entry.Data) > 0 {
+		attrs = append(attrs, slog.Any("data", entry.Data))
+	}
+	l.logger.LogAttrs(l.ctx, slog.LevelDebug, entry.Message, attrs...)
 	return 0
 }
 
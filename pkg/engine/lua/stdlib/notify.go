@@ -0,0 +1,531 @@
+// ABOUTME: Notification module for Lua scripts with pluggable delivery sinks
+// ABOUTME: Provides notify.send() over webhook, Slack-style webhook, and SMTP channels
+
+package stdlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// NotifyChannel configures one named notification channel. String secrets
+// may be given as "env:NAME" to read them from the environment, or as
+// "secret:NAME" to look them up through NotifyConfig.Secret when the
+// channel is first used.
+type NotifyChannel struct {
+	Type string `json:"type"` // "webhook", "slack", or "smtp"
+
+	// Webhook and Slack channels
+	URL string `json:"url,omitempty"`
+
+	// SMTP channels
+	SMTPHost string   `json:"smtp_host,omitempty"`
+	SMTPPort int      `json:"smtp_port,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+}
+
+// NotifySecret looks up the named secret, returning its value and whether
+// it may be sent to a host
+type NotifySecret func(ctx context.Context, name string) (value string, allows func(host string) bool, err error)
+
+// NotifyConfig holds configuration for the notify module
+type NotifyConfig struct {
+	Channels map[string]NotifyChannel `json:"channels"`
+
+	// AllowedHosts restricts which hosts notifications may be sent to (empty allows all)
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+
+	// CheckURL, when set, vets every webhook URL, as the http module's
+	// does its destinations
+	CheckURL func(*url.URL) error `json:"-"`
+
+	// Secret looks up "secret:NAME" settings; nil makes channels that use
+	// them fail
+	Secret NotifySecret `json:"-"`
+
+	Timeout time.Duration `json:"-"`
+}
+
+// DefaultNotifyConfig returns a default notify configuration with no channels
+func DefaultNotifyConfig() *NotifyConfig {
+	return &NotifyConfig{
+		Channels: map[string]NotifyChannel{},
+		Timeout:  30 * time.Second,
+	}
+}
+
+// LoadNotifyConfig reads notification channels from a JSON file:
+//
+//	{"allowed_hosts": ["hooks.slack.com"],
+//	 "channels": {"team": {"type": "slack", "url": "secret:slack_team"}}}
+func LoadNotifyConfig(path string) (*NotifyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := DefaultNotifyConfig()
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid notify file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Notification is a message delivered through a channel
+type Notification struct {
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Attachment is a named file sent along with a notification
+type Attachment struct {
+	Name    string
+	Content []byte
+}
+
+// NotifySink delivers notifications for a channel
+type NotifySink interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// Notifier routes notifications to named sinks
+type Notifier struct {
+	config *NotifyConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	sinks   map[string]NotifySink
+	pending map[string]NotifyChannel
+	secrets []string
+}
+
+// NewNotifier creates a notifier with a sink for every configured channel.
+// Channels with "secret:" settings are checked now but built on first use,
+// so a spell that sends nothing looks up no secrets.
+func NewNotifier(config *NotifyConfig) (*Notifier, error) {
+	if config == nil {
+		config = DefaultNotifyConfig()
+	}
+
+	n := &Notifier{
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		sinks:   make(map[string]NotifySink),
+		pending: make(map[string]NotifyChannel),
+	}
+
+	for name, ch := range config.Channels {
+		if ch.usesSecrets() {
+			if err := n.checkChannel(ch); err != nil {
+				return nil, fmt.Errorf("notify channel %s: %w", name, err)
+			}
+			n.pending[name] = ch
+			continue
+		}
+		sink, err := n.newSink(context.Background(), ch)
+		if err != nil {
+			return nil, fmt.Errorf("notify channel %s: %w", name, err)
+		}
+		n.sinks[name] = sink
+	}
+
+	return n, nil
+}
+
+// AddSink registers a custom sink under a channel name
+func (n *Notifier) AddSink(name string, sink NotifySink) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sinks[name] = sink
+}
+
+// usesSecrets reports whether any setting of the channel names a secret
+func (ch NotifyChannel) usesSecrets() bool {
+	for _, value := range []string{ch.URL, ch.Username, ch.Password} {
+		if strings.HasPrefix(value, "secret:") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSecret reads "env:NAME" values from the environment and
+// "secret:NAME" ones through the config's Secret, and remembers every
+// secret so it can be redacted from error messages. allows reports
+// whether the value may be sent to a host; only secrets restrict it.
+func (n *Notifier) resolveSecret(ctx context.Context, value string) (resolved string, allows func(host string) bool, err error) {
+	allows = func(string) bool { return true }
+	if name, ok := strings.CutPrefix(value, "env:"); ok {
+		value = os.Getenv(name)
+	} else if name, ok := strings.CutPrefix(value, "secret:"); ok {
+		if n.config.Secret == nil {
+			return "", nil, fmt.Errorf("secret %q: no secrets are configured", name)
+		}
+		if value, allows, err = n.config.Secret(ctx, name); err != nil {
+			return "", nil, err
+		}
+	}
+	if value != "" {
+		n.mu.Lock()
+		n.secrets = append(n.secrets, value)
+		n.mu.Unlock()
+	}
+	return value, allows, nil
+}
+
+// checkChannel checks the settings of a channel that are given as they
+// are, rather than read from the environment or a secret
+func (n *Notifier) checkChannel(ch NotifyChannel) error {
+	switch ch.Type {
+	case "webhook", "slack":
+		if strings.HasPrefix(ch.URL, "env:") || strings.HasPrefix(ch.URL, "secret:") {
+			return nil
+		}
+		return n.checkURL(ch.URL)
+	case "smtp":
+		if ch.SMTPHost == "" || ch.From == "" || len(ch.To) == 0 {
+			return fmt.Errorf("smtp channels need a host, from, and to")
+		}
+		return n.checkHost(ch.SMTPHost)
+	default:
+		return fmt.Errorf("unknown channel type %q", ch.Type)
+	}
+}
+
+// newSink builds the sink for a configured channel. A secret the channel
+// uses must allow the host it is sent to.
+func (n *Notifier) newSink(ctx context.Context, ch NotifyChannel) (NotifySink, error) {
+	if err := n.checkChannel(ch); err != nil {
+		return nil, err
+	}
+	switch ch.Type {
+	case "webhook", "slack":
+		endpoint, allows, err := n.resolveSecret(ctx, ch.URL)
+		if err != nil {
+			return nil, err
+		}
+		if err := n.checkURL(endpoint); err != nil {
+			return nil, err
+		}
+		if u, _ := url.Parse(endpoint); !allows(u.Hostname()) {
+			return nil, fmt.Errorf("the channel's secret may not be sent to %s", u.Hostname())
+		}
+		return &webhookSink{client: n.client, url: endpoint, slack: ch.Type == "slack"}, nil
+	default: // smtp
+		port := ch.SMTPPort
+		if port == 0 {
+			port = 587
+		}
+		sink := &smtpSink{
+			addr: net.JoinHostPort(ch.SMTPHost, strconv.Itoa(port)),
+			host: ch.SMTPHost,
+			from: ch.From,
+			to:   ch.To,
+		}
+		for _, field := range []struct {
+			setting string
+			value   *string
+		}{{ch.Username, &sink.username}, {ch.Password, &sink.password}} {
+			value, allows, err := n.resolveSecret(ctx, field.setting)
+			if err != nil {
+				return nil, err
+			}
+			if !allows(ch.SMTPHost) {
+				return nil, fmt.Errorf("the channel's secret may not be sent to %s", ch.SMTPHost)
+			}
+			*field.value = value
+		}
+		return sink, nil
+	}
+}
+
+// checkURL validates a webhook URL against the allowed schemes and hosts
+func (n *Notifier) checkURL(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid webhook URL")
+	}
+	if err := n.checkHost(u.Hostname()); err != nil {
+		return err
+	}
+	if n.config.CheckURL != nil {
+		if err := n.config.CheckURL(u); err != nil {
+			return fmt.Errorf("host %s not allowed: %w", u.Hostname(), err)
+		}
+	}
+	return nil
+}
+
+// checkHost enforces the host allow-list
+func (n *Notifier) checkHost(host string) error {
+	if len(n.config.AllowedHosts) == 0 {
+		return nil
+	}
+	for _, allowed := range n.config.AllowedHosts {
+		if strings.EqualFold(host, allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %s not allowed", host)
+}
+
+// redact replaces every known secret in a message
+func (n *Notifier) redact(msg string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, secret := range n.secrets {
+		msg = strings.ReplaceAll(msg, secret, "[REDACTED]")
+	}
+	return msg
+}
+
+// sink returns the sink of a channel, building it on first use
+func (n *Notifier) sink(ctx context.Context, channel string) (NotifySink, error) {
+	n.mu.Lock()
+	sink, exists := n.sinks[channel]
+	ch, pending := n.pending[channel]
+	n.mu.Unlock()
+	if exists {
+		return sink, nil
+	}
+	if !pending {
+		return nil, fmt.Errorf("notify channel %q not configured", channel)
+	}
+
+	sink, err := n.newSink(ctx, ch)
+	if err != nil {
+		return nil, fmt.Errorf("notify channel %s: %w", channel, err)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sinks[channel] = sink
+	delete(n.pending, channel)
+	return sink, nil
+}
+
+// Send delivers a notification through a named channel
+func (n *Notifier) Send(ctx context.Context, channel string, msg Notification) error {
+	sink, err := n.sink(ctx, channel)
+	if err == nil {
+		err = sink.Send(ctx, msg)
+	}
+	if err != nil {
+		return fmt.Errorf("%s", n.redact(err.Error()))
+	}
+	return nil
+}
+
+// RegisterNotify registers the notify module with all functions
+func RegisterNotify(L *lua.LState, notifier *Notifier) {
+	notifyModule := L.NewTable()
+
+	L.SetField(notifyModule, "send", L.NewClosure(notifier.send))
+	L.SetField(notifyModule, "channels", L.NewClosure(notifier.channels))
+
+	L.SetGlobal("notify", notifyModule)
+}
+
+// send delivers a notification
+// Usage: ok, err = notify.send("team", {subject = "Report", body = text, attachments = {{name = "r.md", content = md}}})
+func (n *Notifier) send(L *lua.LState) int {
+	channel := L.CheckString(1)
+	opts := L.CheckTable(2)
+
+	msg := Notification{
+		Subject: lua.LVAsString(opts.RawGetString("subject")),
+		Body:    lua.LVAsString(opts.RawGetString("body")),
+	}
+	if attachments, ok := opts.RawGetString("attachments").(*lua.LTable); ok {
+		attachments.ForEach(func(_, v lua.LValue) {
+			if att, ok := v.(*lua.LTable); ok {
+				msg.Attachments = append(msg.Attachments, Attachment{
+					Name:    lua.LVAsString(att.RawGetString("name")),
+					Content: []byte(lua.LVAsString(att.RawGetString("content"))),
+				})
+			}
+		})
+	}
+
+	ctx := L.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := n.Send(ctx, channel, msg); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(lua.LTrue)
+	return 1
+}
+
+// channels lists the configured channel names
+// Usage: names = notify.channels()
+func (n *Notifier) channels(L *lua.LState) int {
+	n.mu.Lock()
+	names := make([]string, 0, len(n.sinks)+len(n.pending))
+	for name := range n.sinks {
+		names = append(names, name)
+	}
+	for name := range n.pending {
+		names = append(names, name)
+	}
+	n.mu.Unlock()
+	sort.Strings(names)
+
+	table := L.NewTable()
+	for _, name := range names {
+		table.Append(lua.LString(name))
+	}
+	L.Push(table)
+	return 1
+}
+
+// webhookSink posts notifications as JSON, either in a generic shape or as
+// a Slack-style incoming webhook message
+type webhookSink struct {
+	client *http.Client
+	url    string
+	slack  bool
+}
+
+// Send posts the notification
+func (s *webhookSink) Send(ctx context.Context, n Notification) error {
+	var payload interface{}
+	if s.slack {
+		text := n.Body
+		if n.Subject != "" {
+			text = "*" + n.Subject + "*\n" + n.Body
+		}
+		payload = map[string]string{"text": text}
+	} else {
+		attachments := make([]map[string]string, len(n.Attachments))
+		for i, att := range n.Attachments {
+			attachments[i] = map[string]string{
+				"name":    att.Name,
+				"content": base64.StdEncoding.EncodeToString(att.Content),
+			}
+		}
+		payload = map[string]interface{}{
+			"subject":     n.Subject,
+			"body":        n.Body,
+			"attachments": attachments,
+		}
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// smtpSink emails notifications
+type smtpSink struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// Send emails the notification
+func (s *smtpSink) Send(ctx context.Context, n Notification) error {
+	msg, err := buildMailMessage(s.from, s.to, n)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+	return smtp.SendMail(s.addr, auth, s.from, s.to, msg)
+}
+
+// buildMailMessage renders a notification as a MIME email, using a
+// multipart body when there are attachments
+func buildMailMessage(from string, to []string, n Notification) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", n.Subject)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(n.Attachments) == 0 {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		buf.WriteString(n.Body)
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write([]byte(n.Body)); err != nil {
+		return nil, err
+	}
+
+	for _, att := range n.Attachments {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/octet-stream"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", att.Name)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write([]byte(base64.StdEncoding.EncodeToString(att.Content))); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
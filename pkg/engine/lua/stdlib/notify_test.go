@@ -0,0 +1,200 @@
+// ABOUTME: Tests for the notify module
+// ABOUTME: Verifies webhook and Slack delivery, host allow-listing, secret redaction, and MIME rendering
+
+package stdlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestNotifyWebhooks(t *testing.T) {
+	var received []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &payload)
+		received = append(received, payload)
+		if strings.HasSuffix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("TEST_SLACK_HOOK", server.URL+"/slack/secret-token")
+	notifier, err := NewNotifier(&NotifyConfig{
+		Channels: map[string]NotifyChannel{
+			"hook":  {Type: "webhook", URL: server.URL + "/hook"},
+			"slack": {Type: "slack", URL: "env:TEST_SLACK_HOOK"},
+			"fail":  {Type: "webhook", URL: server.URL + "/secret-token/fail"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+	RegisterNotify(L, notifier)
+
+	err = L.DoString(`
+		local names = notify.channels()
+		assert(#names == 3 and names[1] == "fail", "Expected sorted channel names")
+
+		assert(notify.send("hook", {subject = "Done", body = "All good", attachments = {{name = "a.txt", content = "hi"}}}))
+		assert(notify.send("slack", {subject = "Done", body = "All good"}))
+
+		local ok, err = notify.send("missing", {body = "x"})
+		assert(ok == nil and err:find("not configured"))
+	`)
+	if err != nil {
+		t.Fatalf("Notify script failed: %v", err)
+	}
+
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 deliveries, got %d", len(received))
+	}
+	if received[0]["subject"] != "Done" || len(received[0]["attachments"].([]interface{})) != 1 {
+		t.Errorf("Unexpected webhook payload: %v", received[0])
+	}
+	if received[1]["text"] != "*Done*\nAll good" {
+		t.Errorf("Unexpected Slack payload: %v", received[1])
+	}
+
+	// Errors never reveal the channel URL
+	err = notifier.Send(context.Background(), "fail", Notification{Body: "x"})
+	if err == nil || !strings.Contains(err.Error(), "HTTP 500") {
+		t.Errorf("Expected HTTP 500 error, got %v", err)
+	}
+	sendErr := (&Notifier{secrets: []string{server.URL + "/slack/secret-token"}}).redact("Post " + server.URL + "/slack/secret-token: refused")
+	if strings.Contains(sendErr, "secret-token") {
+		t.Errorf("Expected secret to be redacted, got %q", sendErr)
+	}
+}
+
+func TestNotifyAllowedHosts(t *testing.T) {
+	_, err := NewNotifier(&NotifyConfig{
+		Channels:     map[string]NotifyChannel{"hook": {Type: "webhook", URL: "https://evil.example.com/x"}},
+		AllowedHosts: []string{"hooks.slack.com"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Expected host to be rejected, got %v", err)
+	}
+
+	_, err = NewNotifier(&NotifyConfig{
+		Channels: map[string]NotifyChannel{"mail": {Type: "smtp", SMTPHost: "smtp.example.com"}},
+	})
+	if err == nil {
+		t.Error("Expected incomplete smtp channel to be rejected")
+	}
+}
+
+func TestNotifySecrets(t *testing.T) {
+	delivered := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered++
+	}))
+	defer server.Close()
+
+	var lookups []string
+	notifier, err := NewNotifier(&NotifyConfig{
+		Channels: map[string]NotifyChannel{
+			"team":  {Type: "webhook", URL: "secret:team"},
+			"wrong": {Type: "webhook", URL: "secret:wrong"},
+			"mail":  {Type: "smtp", SMTPHost: "smtp.example.com", From: "bot@example.com", To: []string{"a@example.com"}, Password: "secret:team"},
+			"gone":  {Type: "slack", URL: "secret:missing"},
+		},
+		Secret: func(ctx context.Context, name string) (string, func(string) bool, error) {
+			lookups = append(lookups, name)
+			if name == "missing" {
+				return "", nil, errors.New("no secret \"missing\" is configured")
+			}
+			allowed := map[string]string{"team": "127.0.0.1", "wrong": "hooks.slack.com"}[name]
+			return server.URL + "/" + name + "-token", func(host string) bool { return host == allowed }, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	if len(lookups) != 0 {
+		t.Errorf("Expected secrets to be looked up on first use, got %v", lookups)
+	}
+
+	if err := notifier.Send(context.Background(), "team", Notification{Body: "x"}); err != nil || delivered != 1 {
+		t.Errorf("Expected the team channel to deliver, got %v", err)
+	}
+	_ = notifier.Send(context.Background(), "team", Notification{Body: "x"})
+	if len(lookups) != 1 {
+		t.Errorf("Expected the secret to be looked up once, got %v", lookups)
+	}
+
+	for channel, want := range map[string]string{
+		"wrong": "may not be sent to 127.0.0.1",
+		"mail":  "may not be sent to smtp.example.com",
+		"gone":  "is configured",
+	} {
+		err := notifier.Send(context.Background(), channel, Notification{Body: "x"})
+		if err == nil || !strings.Contains(err.Error(), want) || strings.Contains(err.Error(), "-token") {
+			t.Errorf("Expected %s to fail with %q, got %v", channel, want, err)
+		}
+	}
+	if delivered != 2 {
+		t.Errorf("Expected only the team channel to deliver, got %d deliveries", delivered)
+	}
+}
+
+func TestNotifyCustomSink(t *testing.T) {
+	notifier, _ := NewNotifier(nil)
+	notifier.secrets = []string{"hunter2"}
+	notifier.AddSink("custom", sinkFunc(func(ctx context.Context, n Notification) error {
+		return errors.New("auth failed for hunter2")
+	}))
+
+	err := notifier.Send(context.Background(), "custom", Notification{})
+	if err == nil || strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("Expected redacted error, got %v", err)
+	}
+}
+
+type sinkFunc func(ctx context.Context, n Notification) error
+
+func (f sinkFunc) Send(ctx context.Context, n Notification) error {
+	return f(ctx, n)
+}
+
+func TestBuildMailMessage(t *testing.T) {
+	plain, err := buildMailMessage("bot@example.com", []string{"a@example.com", "b@example.com"}, Notification{
+		Subject: "Report",
+		Body:    "See below",
+	})
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	for _, want := range []string{"To: a@example.com, b@example.com\r\n", "Subject: Report\r\n", "text/plain", "See below"} {
+		if !strings.Contains(string(plain), want) {
+			t.Errorf("Expected message to contain %q", want)
+		}
+	}
+
+	withAttachment, err := buildMailMessage("bot@example.com", []string{"a@example.com"}, Notification{
+		Subject:     "Report",
+		Body:        "Attached",
+		Attachments: []Attachment{{Name: "report.md", Content: []byte("# Report")}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	for _, want := range []string{"multipart/mixed", `filename="report.md"`, "IyBSZXBvcnQ="} {
+		if !strings.Contains(string(withAttachment), want) {
+			t.Errorf("Expected multipart message to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// ABOUTME: Seeded replacement for Lua's math.random so spell runs can be repeated
+// ABOUTME: Each Lua state gets its own generator instead of the process-wide one
+
+package stdlib
+
+import (
+	"math/rand"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// SeedRandom makes math.random in L return the same sequence for the same
+// seed. gopher-lua's math.randomseed seeds Go's global generator, which
+// has no effect since Go 1.24, so both functions are replaced with ones
+// backed by a generator that belongs to L.
+func SeedRandom(L *lua.LState, seed int64) {
+	var mu sync.Mutex
+	gen := rand.New(rand.NewSource(seed))
+
+	math, ok := L.GetGlobal("math").(*lua.LTable)
+	if !ok {
+		return
+	}
+
+	math.RawSetString("random", L.NewFunction(func(L *lua.LState) int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch L.GetTop() {
+		case 0:
+			L.Push(lua.LNumber(gen.Float64()))
+		case 1:
+			n := L.CheckInt(1)
+			if n < 1 {
+				L.ArgError(1, "interval is empty")
+			}
+			L.Push(lua.LNumber(gen.Intn(n) + 1))
+		default:
+			low, high := L.CheckInt(1), L.CheckInt(2)
+			if low > high {
+				L.ArgError(2, "interval is empty")
+			}
+			L.Push(lua.LNumber(gen.Intn(high-low+1) + low))
+		}
+		return 1
+	}))
+
+	math.RawSetString("randomseed", L.NewFunction(func(L *lua.LState) int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		gen.Seed(L.CheckInt64(1))
+		return 0
+	}))
+}
@@ -0,0 +1,341 @@
+// ABOUTME: Report rendering module for Lua scripts
+// ABOUTME: Renders structured data through HTML templates, with PDF output via a host renderer or Chromium/wkhtmltopdf
+
+package stdlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// PDFRenderer converts rendered HTML into a PDF document
+type PDFRenderer func(html []byte) ([]byte, error)
+
+// ReportConfig holds configuration for the report module
+type ReportConfig struct {
+	// PDFRenderer enables report.pdf; without it PDF output is unavailable
+	PDFRenderer PDFRenderer
+}
+
+// DefaultReportConfig returns a default report configuration (HTML only)
+func DefaultReportConfig() *ReportConfig {
+	return &ReportConfig{}
+}
+
+// pdfTimeout bounds how long an external PDF converter may run
+const pdfTimeout = 60 * time.Second
+
+// pdfCommands are the converters CommandPDFRenderer looks for, in order.
+// Each gets the HTML file and the PDF path, and is kept off the network:
+// reports embed their images, and a spell's HTML must not reach hosts its
+// HTTP policy would refuse.
+var pdfCommands = []struct {
+	name string
+	args func(in, out string) []string
+}{
+	{"chromium", chromiumArgs},
+	{"chromium-browser", chromiumArgs},
+	{"google-chrome", chromiumArgs},
+	{"wkhtmltopdf", func(in, out string) []string {
+		return []string{"--quiet", "--disable-javascript", "--disable-local-file-access", "--proxy", "http://127.0.0.1:9", in, out}
+	}},
+}
+
+func chromiumArgs(in, out string) []string {
+	args := []string{"--headless", "--disable-gpu", "--no-pdf-header-footer",
+		"--host-resolver-rules=MAP * ~NOTFOUND", "--print-to-pdf=" + out}
+	// Chromium refuses to run as root inside its own sandbox
+	if os.Geteuid() == 0 {
+		args = append(args, "--no-sandbox")
+	}
+	return append(args, "file://"+in)
+}
+
+// CommandPDFRenderer returns a renderer that converts HTML with the first
+// of headless Chromium or wkhtmltopdf found on PATH, or nil if neither is
+// installed
+func CommandPDFRenderer() PDFRenderer {
+	for _, c := range pdfCommands {
+		path, err := exec.LookPath(c.name)
+		if err != nil {
+			continue
+		}
+		args := c.args
+		return func(html []byte) ([]byte, error) {
+			return runPDFCommand(path, args, html)
+		}
+	}
+	return nil
+}
+
+// runPDFCommand converts html in a temporary directory with the converter
+// at path
+func runPDFCommand(path string, args func(in, out string) []string, html []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "llmspell-pdf-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PDF work directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "report.html")
+	out := filepath.Join(dir, "report.pdf")
+	if err := os.WriteFile(in, html, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write report HTML: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pdfTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, args(in, out)...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", filepath.Base(path), err, strings.TrimSpace(string(output)))
+	}
+
+	pdf, err := os.ReadFile(out)
+	if err != nil {
+		return nil, fmt.Errorf("%s produced no PDF: %w", filepath.Base(path), err)
+	}
+	return pdf, nil
+}
+
+// defaultReportTemplate renders {title, summary, sections = {{heading, body, html, table, columns, image}}}
+const defaultReportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 960px; margin: 2em auto; color: #222; }
+h1 { border-bottom: 2px solid #444; padding-bottom: .3em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: .4em .8em; text-align: left; }
+th { background: #f4f4f4; }
+.summary { font-size: 1.1em; color: #444; }
+figure { margin: 1em 0; }
+</style>
+</head>
+<body>
+<h1>{{.title}}</h1>
+{{with .summary}}<p class="summary">{{.}}</p>{{end}}
+{{range .sections}}<section>
+{{with .heading}}<h2>{{.}}</h2>{{end}}
+{{with .body}}{{paragraphs .}}{{end}}
+{{with .html}}{{safe .}}{{end}}
+{{if .table}}{{table .table .columns}}{{end}}
+{{with .image}}<figure>{{safe .}}</figure>{{end}}
+</section>
+{{end}}
+</body>
+</html>
+`
+
+// Reporter renders reports for Lua scripts
+type Reporter struct {
+	config *ReportConfig
+	fs     *FS
+}
+
+// NewReporter creates a reporter whose file output goes through fs
+func NewReporter(config *ReportConfig, fs *FS) *Reporter {
+	if config == nil {
+		config = DefaultReportConfig()
+	}
+	if fs == nil {
+		fs = NewFS(nil)
+	}
+
+	return &Reporter{
+		config: config,
+		fs:     fs,
+	}
+}
+
+// RegisterReport registers the report module with all functions
+func RegisterReport(L *lua.LState, r *Reporter) {
+	reportModule := L.NewTable()
+
+	L.SetField(reportModule, "html", L.NewClosure(r.html))
+	L.SetField(reportModule, "pdf", L.NewClosure(r.pdf))
+	L.SetField(reportModule, "save", L.NewClosure(r.save))
+	L.SetField(reportModule, "image", L.NewClosure(r.image))
+
+	L.SetGlobal("report", reportModule)
+}
+
+// reportFuncs are the helpers available inside report templates
+var reportFuncs = template.FuncMap{
+	// safe marks trusted markup, such as generated SVG charts, as HTML
+	"safe": func(s string) template.HTML {
+		return template.HTML(s)
+	},
+	// json renders a value as indented JSON
+	"json": func(v interface{}) (string, error) {
+		data, err := json.MarshalIndent(v, "", "  ")
+		return string(data), err
+	},
+	// paragraphs renders text with blank-line-separated paragraphs
+	"paragraphs": func(s string) template.HTML {
+		var b strings.Builder
+		for _, p := range strings.Split(strings.TrimSpace(s), "\n\n") {
+			b.WriteString("<p>")
+			b.WriteString(strings.ReplaceAll(template.HTMLEscapeString(p), "\n", "<br>"))
+			b.WriteString("</p>\n")
+		}
+		return template.HTML(b.String())
+	},
+	// table renders a list of rows (objects) as an HTML table
+	"table": renderTable,
+}
+
+// renderTable renders rows as an HTML table. Columns follow the given list,
+// or every key in sorted order when it is empty.
+func renderTable(rows interface{}, columnList interface{}) template.HTML {
+	list, ok := rows.([]interface{})
+	if !ok || len(list) == 0 {
+		return ""
+	}
+
+	var columns []string
+	if cols, ok := columnList.([]interface{}); ok {
+		for _, col := range cols {
+			columns = append(columns, fmt.Sprint(col))
+		}
+	}
+	if len(columns) == 0 {
+		seen := make(map[string]bool)
+		for _, row := range list {
+			if m, ok := row.(map[string]interface{}); ok {
+				for col := range m {
+					if !seen[col] {
+						seen[col] = true
+						columns = append(columns, col)
+					}
+				}
+			}
+		}
+		sort.Strings(columns)
+	}
+
+	var b strings.Builder
+	b.WriteString("<table>\n<tr>")
+	for _, col := range columns {
+		b.WriteString("<th>" + template.HTMLEscapeString(col) + "</th>")
+	}
+	b.WriteString("</tr>\n")
+	for _, row := range list {
+		m, _ := row.(map[string]interface{})
+		b.WriteString("<tr>")
+		for _, col := range columns {
+			cell := ""
+			if v, ok := m[col]; ok && v != nil {
+				cell = fmt.Sprint(v)
+			}
+			b.WriteString("<td>" + template.HTMLEscapeString(cell) + "</td>")
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</table>")
+	return template.HTML(b.String())
+}
+
+// Render executes a template (the default report layout when empty) with data
+func (r *Reporter) Render(tmpl string, data interface{}) ([]byte, error) {
+	if tmpl == "" {
+		tmpl = defaultReportTemplate
+	}
+
+	t, err := template.New("report").Funcs(reportFuncs).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// PDF converts rendered HTML into a PDF using the configured renderer
+func (r *Reporter) PDF(html []byte) ([]byte, error) {
+	if r.config.PDFRenderer == nil {
+		return nil, fmt.Errorf("PDF rendering is not configured")
+	}
+	return r.config.PDFRenderer(html)
+}
+
+// renderArgs reads (data, [template]) from the Lua stack
+func (r *Reporter) renderArgs(L *lua.LState) ([]byte, error) {
+	data := luaToGo(L.CheckTable(1))
+	tmpl := L.OptString(2, "")
+	return r.Render(tmpl, data)
+}
+
+// html renders a report as HTML
+// Usage: html, err = report.html({title = "...", sections = {...}}, [template])
+func (r *Reporter) html(L *lua.LState) int {
+	out, err := r.renderArgs(L)
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lua.LString(out))
+	return 1
+}
+
+// pdf renders a report and converts it to PDF
+// Usage: pdf, err = report.pdf(data, [template])
+func (r *Reporter) pdf(L *lua.LState) int {
+	out, err := r.renderArgs(L)
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	pdf, err := r.PDF(out)
+	if err != nil {
+		return pushError(L, err)
+	}
+
+	L.Push(lua.LString(pdf))
+	return 1
+}
+
+// save writes rendered report bytes to a file inside the fs allow-list
+// Usage: err = report.save(path, content)
+func (r *Reporter) save(L *lua.LState) int {
+	path := L.CheckString(1)
+	content := L.CheckString(2)
+
+	return pushOptionalError(L, r.fs.WriteFile(path, []byte(content)))
+}
+
+// image turns image bytes into an <img> tag with a data URI, for embedding
+// in a report section
+// Usage: tag = report.image(png_bytes, [alt])
+func (r *Reporter) image(L *lua.LState) int {
+	data := L.CheckString(1)
+	alt := L.OptString(2, "")
+
+	mime := http.DetectContentType([]byte(data))
+	if strings.HasPrefix(strings.TrimSpace(data), "<svg") {
+		mime = "image/svg+xml"
+	}
+
+	tag := fmt.Sprintf(`<img alt="%s" src="data:%s;base64,%s">`,
+		template.HTMLEscapeString(alt), mime, base64.StdEncoding.EncodeToString([]byte(data)))
+	L.Push(lua.LString(tag))
+	return 1
+}
@@ -0,0 +1,128 @@
+// ABOUTME: Tests for the report module
+// ABOUTME: Verifies default and custom templates, escaping, image embedding, PDF hooks and converters, and file output
+
+package stdlib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestReportHTML(t *testing.T) {
+	dir := t.TempDir()
+	reporter := NewReporter(nil, NewFS(&FSConfig{AllowedPaths: []string{dir}}))
+
+	L := lua.NewState()
+	defer L.Close()
+	RegisterReport(L, reporter)
+	L.SetGlobal("out_dir", lua.LString(dir))
+
+	err := L.DoString(`
+		local html = assert(report.html({
+			title = "Sales <Q3>",
+			summary = "Up and to the right",
+			sections = {
+				{heading = "Notes", body = "First paragraph.\n\nSecond paragraph."},
+				{heading = "Figures", table = {{region = "EU", total = 3}, {region = "US", total = 5}}, columns = {"region", "total"}},
+				{image = report.image("<svg xmlns='http://www.w3.org/2000/svg'></svg>", "chart")},
+			},
+		}))
+		assert(html:find("<title>Sales &lt;Q3&gt;</title>", 1, true), "Expected escaped title")
+		assert(html:find("<p>Second paragraph.</p>", 1, true), "Expected paragraphs")
+		assert(html:find("<th>region</th><th>total</th>", 1, true), "Expected ordered columns")
+		assert(html:find("<td>US</td><td>5</td>", 1, true), "Expected table rows")
+		assert(html:find('src="data:image/svg+xml;base64,', 1, true), "Expected embedded image")
+
+		local custom = assert(report.html({name = "World"}, "<p>Hello {{.name}}</p>"))
+		assert(custom == "<p>Hello World</p>", custom)
+
+		local res, err = report.html({}, "{{.broken")
+		assert(res == nil and err:find("invalid template"))
+
+		assert(report.save(out_dir .. "/report.html", custom) == nil)
+		assert(report.save("/etc/report.html", custom) ~= nil, "Expected disallowed path")
+
+		local pdf, err = report.pdf({title = "x"})
+		assert(pdf == nil and err:find("not configured"))
+	`)
+	if err != nil {
+		t.Fatalf("Report script failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "report.html"))
+	if err != nil || string(content) != "<p>Hello World</p>" {
+		t.Errorf("Unexpected saved report: %q, %v", content, err)
+	}
+}
+
+func TestReportPDF(t *testing.T) {
+	var rendered string
+	reporter := NewReporter(&ReportConfig{
+		PDFRenderer: func(html []byte) ([]byte, error) {
+			rendered = string(html)
+			if strings.Contains(rendered, "fail") {
+				return nil, errors.New("renderer failed")
+			}
+			return []byte("%PDF-1.4"), nil
+		},
+	}, nil)
+
+	L := lua.NewState()
+	defer L.Close()
+	RegisterReport(L, reporter)
+
+	err := L.DoString(`
+		local pdf = assert(report.pdf({title = "Quarterly"}))
+		assert(pdf == "%PDF-1.4")
+
+		local res, err = report.pdf({title = "fail"})
+		assert(res == nil and err == "renderer failed")
+	`)
+	if err != nil {
+		t.Fatalf("Report PDF script failed: %v", err)
+	}
+	if !strings.Contains(rendered, "<h1>fail</h1>") {
+		t.Errorf("Expected renderer to receive the HTML, got %q", rendered)
+	}
+}
+
+func TestCommandPDFRenderer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Fake converter is a shell script")
+	}
+
+	bin := t.TempDir()
+	t.Setenv("PATH", bin)
+	if CommandPDFRenderer() != nil {
+		t.Fatal("Expected no renderer without a converter on PATH")
+	}
+
+	// A fake wkhtmltopdf that copies its input HTML to the output path
+	script := "#!/bin/sh\nfor a; do in=$out; out=$a; done\n/bin/cp \"$in\" \"$out\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "wkhtmltopdf"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake converter: %v", err)
+	}
+	render := CommandPDFRenderer()
+	if render == nil {
+		t.Fatal("Expected a renderer with wkhtmltopdf on PATH")
+	}
+
+	pdf, err := render([]byte("<h1>Quarterly</h1>"))
+	if err != nil || string(pdf) != "<h1>Quarterly</h1>" {
+		t.Errorf("Expected the converter's output, got %q, %v", pdf, err)
+	}
+
+	// A failing converter's output says why
+	if err := os.WriteFile(filepath.Join(bin, "wkhtmltopdf"), []byte("#!/bin/sh\necho broken >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake converter: %v", err)
+	}
+	if _, err := render([]byte("x")); err == nil || !strings.Contains(err.Error(), "wkhtmltopdf failed") || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Expected the converter's error, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+// ABOUTME: The result module: {ok, value, error} tables for handling errors without multiple returns
+// ABOUTME: Provides result.ok(), err(), of(), is_ok(), unwrap(), unwrap_or(), also callable as methods
+
+package stdlib
+
+import (
+	lua "github.com/yuin/gopher-lua"
+)
+
+// resultTypeName is the Lua metatable name of result tables
+const resultTypeName = "llmspell.result"
+
+// RegisterResult registers the result module. Result tables share a
+// metatable whose methods are the module's functions, so result.unwrap(r)
+// and r:unwrap() are the same call.
+func RegisterResult(L *lua.LState) {
+	L.SetGlobal("result", L.GetField(resultMetatable(L), "__index"))
+}
+
+// resultMetatable returns the metatable of result tables in L, creating it
+// and the module table the first time
+func resultMetatable(L *lua.LState) *lua.LTable {
+	if mt, ok := L.GetTypeMetatable(resultTypeName).(*lua.LTable); ok {
+		return mt
+	}
+
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"ok":        resultOk,
+		"err":       resultErr,
+		"of":        resultOf,
+		"is_ok":     resultIsOk,
+		"unwrap":    resultUnwrap,
+		"unwrap_or": resultUnwrapOr,
+	})
+	mt := L.NewTypeMetatable(resultTypeName)
+	L.SetField(mt, "__index", mod)
+	return mt
+}
+
+// NewResult creates a result table: {ok = true, value = value} on success,
+// or {ok = false, error = message}
+func NewResult(L *lua.LState, ok bool, value lua.LValue, message string) *lua.LTable {
+	r := L.NewTable()
+	r.RawSetString("ok", lua.LBool(ok))
+	if ok {
+		r.RawSetString("value", value)
+	} else {
+		r.RawSetString("error", lua.LString(message))
+	}
+	L.SetMetatable(r, resultMetatable(L))
+	return r
+}
+
+// ResultFromReturns makes a result from the values a function returned,
+// following the bridge conventions: nil or false followed by an error
+// message is a failure, and otherwise the first value is the result. With
+// errorFirst, the function returns only an error, or nothing on success.
+func ResultFromReturns(L *lua.LState, values []lua.LValue, errorFirst bool) *lua.LTable {
+	if errorFirst {
+		if len(values) > 0 && values[0] != lua.LNil {
+			return NewResult(L, false, lua.LNil, lua.LVAsString(values[0]))
+		}
+		return NewResult(L, true, lua.LNil, "")
+	}
+	if len(values) >= 2 && lua.LVIsFalse(values[0]) && values[1].Type() == lua.LTString {
+		return NewResult(L, false, lua.LNil, lua.LVAsString(values[1]))
+	}
+	if len(values) == 0 {
+		return NewResult(L, true, lua.LNil, "")
+	}
+	return NewResult(L, true, values[0], "")
+}
+
+// resultOk creates a successful result
+// Usage: r = result.ok(value)
+func resultOk(L *lua.LState) int {
+	L.Push(NewResult(L, true, L.Get(1), ""))
+	return 1
+}
+
+// resultErr creates a failed result
+// Usage: r = result.err(message)
+func resultErr(L *lua.LState) int {
+	L.Push(NewResult(L, false, lua.LNil, L.CheckString(1)))
+	return 1
+}
+
+// resultOf calls fn and turns what it returns, or the error it raises,
+// into a result
+// Usage: r = result.of(fn, ...)
+func resultOf(L *lua.LState) int {
+	fn := L.CheckFunction(1)
+	args := make([]lua.LValue, 0, L.GetTop()-1)
+	for i := 2; i <= L.GetTop(); i++ {
+		args = append(args, L.Get(i))
+	}
+
+	top := L.GetTop()
+	L.Push(fn)
+	for _, arg := range args {
+		L.Push(arg)
+	}
+	if err := L.PCall(len(args), lua.MultRet, nil); err != nil {
+		message := err.Error()
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			message = lua.LVAsString(apiErr.Object)
+		}
+		L.Push(NewResult(L, false, lua.LNil, message))
+		return 1
+	}
+
+	values := make([]lua.LValue, 0, L.GetTop()-top)
+	for i := top + 1; i <= L.GetTop(); i++ {
+		values = append(values, L.Get(i))
+	}
+	L.SetTop(top)
+	L.Push(ResultFromReturns(L, values, false))
+	return 1
+}
+
+// checkResult returns the result table at argument 1
+func checkResult(L *lua.LState) *lua.LTable {
+	r := L.CheckTable(1)
+	if _, ok := r.RawGetString("ok").(lua.LBool); !ok {
+		L.ArgError(1, "result expected")
+	}
+	return r
+}
+
+// resultIsOk reports whether a result succeeded
+// Usage: ok = result.is_ok(r) or r:is_ok()
+func resultIsOk(L *lua.LState) int {
+	L.Push(checkResult(L).RawGetString("ok"))
+	return 1
+}
+
+// resultUnwrap returns a result's value, raising its error if it failed
+// Usage: value = result.unwrap(r) or r:unwrap()
+func resultUnwrap(L *lua.LState) int {
+	r := checkResult(L)
+	if r.RawGetString("ok") != lua.LTrue {
+		L.RaiseError("%s", lua.LVAsString(r.RawGetString("error")))
+		return 0
+	}
+	L.Push(r.RawGetString("value"))
+	return 1
+}
+
+// resultUnwrapOr returns a result's value, or fallback if it failed
+// Usage: value = result.unwrap_or(r, fallback) or r:unwrap_or(fallback)
+func resultUnwrapOr(L *lua.LState) int {
+	r := checkResult(L)
+	if r.RawGetString("ok") != lua.LTrue {
+		L.Push(L.Get(2))
+		return 1
+	}
+	L.Push(r.RawGetString("value"))
+	return 1
+}
@@ -0,0 +1,47 @@
+// ABOUTME: Tests for the result module
+// ABOUTME: Verifies constructors, result.of() conventions, and unwrapping
+
+package stdlib
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestResultModule(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	RegisterResult(L)
+
+	err := L.DoString(`
+		local r = result.ok(42)
+		assert(r.ok and r:is_ok() and result.is_ok(r))
+		assert(r:unwrap() == 42 and result.unwrap(r) == 42)
+
+		local e = result.err("boom")
+		assert(not e.ok and e.error == "boom")
+		assert(e:unwrap_or(7) == 7)
+		local ok, msg = pcall(e.unwrap, e)
+		assert(not ok and msg:find("boom"), "unwrap should raise the error")
+
+		-- result.of follows the value-and-error convention
+		local nilErr = result.of(function() return nil, "not found" end)
+		assert(not nilErr.ok and nilErr.error == "not found")
+		local falseErr = result.of(function() return false, "denied" end)
+		assert(not falseErr.ok and falseErr.error == "denied")
+		local value = result.of(function(a, b) return a + b end, 1, 2)
+		assert(value.ok and value.value == 3)
+		local empty = result.of(function() end)
+		assert(empty.ok and empty.value == nil)
+		local raised = result.of(function() error({code = 1}) end)
+		assert(not raised.ok)
+		local raisedMsg = result.of(function() error("exploded", 0) end)
+		assert(raisedMsg.error == "exploded", raisedMsg.error)
+
+		assert(not pcall(result.unwrap, {}), "non-results should be rejected")
+	`)
+	if err != nil {
+		t.Fatalf("Result module failed: %v", err)
+	}
+}
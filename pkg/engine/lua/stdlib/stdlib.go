@@ -1,20 +1,37 @@
 // ABOUTME: Main entry point for registering all standard library modules
-// ABOUTME: Provides RegisterAll() to register json, log, storage, http modules
+// ABOUTME: Provides RegisterAll() to register json, log, time, storage, http, fs, compress, notify, report, chart, df modules
 
 package stdlib
 
 import (
 	"log/slog"
+	"sync"
 
+	"github.com/lexlapax/go-llmspell/pkg/engine"
 	lua "github.com/yuin/gopher-lua"
 )
 
 // Config holds configuration for all stdlib modules
 type Config struct {
-	Storage   *StorageConfig
-	HTTP      *HTTPConfig
-	LogLevel  slog.Level
-	SpellName string
+	Storage    *StorageConfig
+	HTTP       *HTTPConfig
+	FS         *FSConfig
+	Compress   *CompressConfig
+	Notify     *NotifyConfig
+	Report     *ReportConfig
+	LogLevel   slog.Level
+	SpellName  string
+	AssertMode AssertMode
+	TraceSink  TraceSink
+
+	// TraceID, when set, is the trace log.trace entries belong to
+	TraceID string
+
+	// ComponentLevels overrides LogLevel for specific (dotted) components
+	ComponentLevels map[string]slog.Level
+
+	// WarnSink receives warnings raised with warn(); nil logs them
+	WarnSink WarnSink
 }
 
 // DefaultConfig returns a default stdlib configuration
@@ -22,6 +39,10 @@ func DefaultConfig() *Config {
 	return &Config{
 		Storage:   DefaultStorageConfig(),
 		HTTP:      DefaultHTTPConfig(),
+		FS:        DefaultFSConfig(),
+		Compress:  DefaultCompressConfig(),
+		Notify:    DefaultNotifyConfig(),
+		Report:    DefaultReportConfig(),
 		LogLevel:  slog.LevelInfo,
 		SpellName: "spell",
 	}
@@ -38,8 +59,25 @@ func RegisterAll(L *lua.LState, config *Config) error {
 
 	// Register Log module
 	logger := NewLogger(config.SpellName, config.LogLevel)
+	logger.SetAssertMode(config.AssertMode)
+	logger.SetTraceSink(config.TraceSink)
+	if config.TraceID != "" {
+		logger.SetTraceID(config.TraceID)
+	}
+	for component, level := range config.ComponentLevels {
+		logger.SetLevel(component, level)
+	}
 	RegisterLog(L, logger)
 
+	// Register warn() for non-fatal warnings
+	RegisterWarn(L, config.WarnSink)
+
+	// Register result tables for handling errors as values
+	RegisterResult(L)
+
+	// Register Time module, reading the clock set with SetClock
+	RegisterTime(L)
+
 	// Register Storage module
 	storage, err := NewStorage(config.Storage)
 	if err != nil {
@@ -51,18 +89,56 @@ func RegisterAll(L *lua.LState, config *Config) error {
 	httpClient := NewHTTPClient(config.HTTP)
 	RegisterHTTP(L, httpClient)
 
+	// Register FS module and the modules writing files through it
+	RegisterFiles(L, NewFS(config.FS), config)
+
+	// Register Notify module
+	notifier, err := NewNotifier(config.Notify)
+	if err != nil {
+		return err
+	}
+	RegisterNotify(L, notifier)
+
+	// Register dataframe module
+	RegisterDataFrame(L)
+
 	// Register Promise module for async operations
 	RegisterPromise(L)
 
 	// Register Async callback module
 	RegisterAsyncCallback(L)
 
+	// Register async.run and async.await_all for cooperative tasks
+	RegisterAsyncScheduler(L)
+
 	// Register Promise-Async integration
 	RegisterPromiseAsync(L)
 
 	return nil
 }
 
+// Modules lists the global modules RegisterAll registers, which hosts may
+// restrict as they do bridge modules
+func Modules() []string {
+	return []string{
+		"json", "log", "result", "time", "storage", "http", "fs", "compress",
+		"report", "chart", "notify", "df", "promise", "async",
+	}
+}
+
+// RegisterFiles registers the fs module and the modules that read and
+// write files through its allow-list: compress, report, and chart. Hosts
+// call it again to restrict the files a spell may touch.
+func RegisterFiles(L *lua.LState, fs *FS, config *Config) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	RegisterFS(L, fs)
+	RegisterCompress(L, NewCompressor(config.Compress, fs))
+	RegisterReport(L, NewReporter(config.Report, fs))
+	RegisterChart(L, fs)
+}
+
 // RegisterMinimal registers only the essential modules without external dependencies
 // This is useful for testing or restricted environments
 func RegisterMinimal(L *lua.LState) {
@@ -75,3 +151,68 @@ func RegisterMinimal(L *lua.LState) {
 	// Register simple HTTP module
 	RegisterSimpleHTTP(L)
 }
+
+// Per-state cleanup functions, run by Cleanup when a spell finishes, and
+// the error each spell finished with
+var (
+	cleanupsMu sync.Mutex
+	cleanups   = make(map[*lua.LState][]func())
+	exitErrs   = make(map[*lua.LState]error)
+)
+
+// OnCleanup registers a function to run when the Lua state is cleaned up.
+// The function can ask ExitError how the spell ended and CancelCause why it
+// stopped early.
+func OnCleanup(L *lua.LState, fn func()) {
+	cleanupsMu.Lock()
+	defer cleanupsMu.Unlock()
+
+	cleanups[L] = append(cleanups[L], fn)
+}
+
+// CancelCause reports why the spell running in L was cancelled, such as
+// engine.ErrInterrupted, or nil if it was not
+func CancelCause(L *lua.LState) error {
+	ctx := L.Context()
+	if ctx == nil {
+		return nil
+	}
+	return engine.CancelCause(ctx)
+}
+
+// SetExitError records the error the spell in L finished with, or nil if
+// it succeeded; engines call it when a script finishes running
+func SetExitError(L *lua.LState, err error) {
+	cleanupsMu.Lock()
+	defer cleanupsMu.Unlock()
+
+	exitErrs[L] = err
+}
+
+// ExitError returns the error the spell in L finished with, or nil if it
+// succeeded or has not finished
+func ExitError(L *lua.LState) error {
+	cleanupsMu.Lock()
+	defer cleanupsMu.Unlock()
+
+	return exitErrs[L]
+}
+
+// Cleanup releases the resources stdlib modules hold for a Lua state, such
+// as temp files. Call it when the spell finishes,
+// whether it succeeded or not, before closing the state.
+func Cleanup(L *lua.LState) {
+	cleanupsMu.Lock()
+	fns := cleanups[L]
+	delete(cleanups, L)
+	cleanupsMu.Unlock()
+
+	// Run in reverse registration order
+	for i := len(fns) - 1; i >= 0; i-- {
+		fns[i]()
+	}
+
+	cleanupsMu.Lock()
+	delete(exitErrs, L)
+	cleanupsMu.Unlock()
+}
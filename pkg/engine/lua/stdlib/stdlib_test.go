@@ -1,6 +1,9 @@
 package stdlib
 
 import (
+	"bytes"
+	"io"
+	"log/slog"
 	"os"
 	"strings"
 	"testing"
@@ -229,3 +232,317 @@ func TestRegisterAll(t *testing.T) {
 		t.Fatalf("Failed to test all modules: %v", err)
 	}
 }
+
+func TestLogAssert(t *testing.T) {
+	t.Run("raise mode", func(t *testing.T) {
+		L := lua.NewState()
+		defer L.Close()
+
+		var buf bytes.Buffer
+		logger := NewLoggerWithHandler("test", slog.NewTextHandler(&buf, nil))
+		RegisterLog(L, logger)
+
+		err := L.DoString(`ok = log.assert(1 == 1, "math works")`)
+		if err != nil {
+			t.Fatalf("Passing assertion should not error: %v", err)
+		}
+		if L.GetGlobal("ok") != lua.LTrue {
+			t.Errorf("Expected passing assertion to return true")
+		}
+
+		err = L.DoString(`
+			local function check(x)
+				log.assert(x > 10, "x must be greater than 10")
+			end
+			check(5)
+		`)
+		if err == nil {
+			t.Fatal("Expected failing assertion to raise an error")
+		}
+		if !strings.Contains(err.Error(), "x must be greater than 10") {
+			t.Errorf("Expected assertion message in error, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "stack traceback:") {
+			t.Errorf("Expected traceback in error, got %v", err)
+		}
+	})
+
+	t.Run("log mode", func(t *testing.T) {
+		L := lua.NewState()
+		defer L.Close()
+
+		var buf bytes.Buffer
+		logger := NewLoggerWithHandler("test", slog.NewTextHandler(&buf, nil))
+		logger.SetAssertMode(AssertLog)
+		RegisterLog(L, logger)
+
+		err := L.DoString(`
+			ok = log.assert(false, "value missing")
+			continued = true
+		`)
+		if err != nil {
+			t.Fatalf("Failing assertion should not raise in log mode: %v", err)
+		}
+		if L.GetGlobal("ok") != lua.LFalse {
+			t.Errorf("Expected failing assertion to return false")
+		}
+		if L.GetGlobal("continued") != lua.LTrue {
+			t.Errorf("Expected script to continue after failed assertion")
+		}
+		if !strings.Contains(buf.String(), "value missing") {
+			t.Errorf("Expected assertion failure to be logged, got %q", buf.String())
+		}
+	})
+
+	t.Run("off mode", func(t *testing.T) {
+		L := lua.NewState()
+		defer L.Close()
+
+		var buf bytes.Buffer
+		logger := NewLoggerWithHandler("test", slog.NewTextHandler(&buf, nil))
+		logger.SetAssertMode(AssertOff)
+		RegisterLog(L, logger)
+
+		err := L.DoString(`ok = log.assert(false, "ignored")`)
+		if err != nil {
+			t.Fatalf("Assertions should be skipped in off mode: %v", err)
+		}
+		if L.GetGlobal("ok") != lua.LFalse {
+			t.Errorf("Expected assertion result to still be returned")
+		}
+		if buf.Len() != 0 {
+			t.Errorf("Expected nothing to be logged in off mode, got %q", buf.String())
+		}
+	})
+
+	t.Run("parse", func(t *testing.T) {
+		for _, mode := range []AssertMode{AssertRaise, AssertLog, AssertOff} {
+			if parsed, err := ParseAssertMode(mode.String()); err != nil || parsed != mode {
+				t.Errorf("Expected %s to parse, got %v, %v", mode, parsed, err)
+			}
+		}
+		if mode, err := ParseAssertMode(""); err != nil || mode != AssertRaise {
+			t.Errorf("Expected empty to raise, got %v, %v", mode, err)
+		}
+		if _, err := ParseAssertMode("sometimes"); err == nil {
+			t.Error("Expected an unknown mode to fail")
+		}
+	})
+}
+
+func TestLogTrace(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	logger := NewLoggerWithHandler("trace-spell", slog.NewTextHandler(io.Discard, nil))
+	var entries []TraceEntry
+	logger.SetTraceSink(func(entry TraceEntry) {
+		entries = append(entries, entry)
+	})
+	RegisterLog(L, logger)
+
+	err := L.DoString(`
+		log.trace("start")
+		log.trace("step", {item = "a", count = 2})
+		log.trace("raw", 42)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to emit traces: %v", err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 trace entries, got %d", len(entries))
+	}
+
+	for i, entry := range entries {
+		if entry.Sequence != uint64(i+1) {
+			t.Errorf("Expected sequence %d, got %d", i+1, entry.Sequence)
+		}
+		if entry.TraceID != logger.TraceID() {
+			t.Errorf("Expected trace ID %s, got %s", logger.TraceID(), entry.TraceID)
+		}
+		if entry.Spell != "trace-spell" {
+			t.Errorf("Expected spell name trace-spell, got %s", entry.Spell)
+		}
+	}
+
+	if entries[0].Where != "<string>:2" {
+		t.Errorf("Expected call site <string>:2, got %s", entries[0].Where)
+	}
+	if entries[1].Data["item"] != "a" || entries[1].Data["count"] != float64(2) {
+		t.Errorf("Expected structured data, got %v", entries[1].Data)
+	}
+	if entries[2].Data["value"] != float64(42) {
+		t.Errorf("Expected non-table data under value, got %v", entries[2].Data)
+	}
+}
+
+func TestLogTraceJoinsTrace(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	var entries []TraceEntry
+	config := DefaultConfig()
+	config.TraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	config.TraceSink = func(entry TraceEntry) {
+		entries = append(entries, entry)
+	}
+	if err := RegisterAll(L, config); err != nil {
+		t.Fatalf("Failed to register stdlib: %v", err)
+	}
+	defer Cleanup(L)
+
+	if err := L.DoString(`log.trace("sub-spell step")`); err != nil {
+		t.Fatalf("Failed to emit trace: %v", err)
+	}
+	if len(entries) != 1 || entries[0].TraceID != config.TraceID {
+		t.Errorf("Expected the entry to join trace %s, got %+v", config.TraceID, entries)
+	}
+}
+
+func TestLogTraceDefaultOutput(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	RegisterLog(L, NewLoggerWithHandler("test", handler))
+
+	if err := L.DoString(`log.trace("checkpoint", {phase = "load"})`); err != nil {
+		t.Fatalf("Failed to emit trace: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"checkpoint", "seq=1", "trace_id=", "where=<string>:1", "phase"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected trace output to contain %q, got %q", want, out)
+		}
+	}
+}
+
+func TestLogComponentLevels(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	logger := NewLoggerWithHandler("test", handler)
+	logger.SetLevel("*", slog.LevelWarn)
+	RegisterLog(L, logger)
+
+	err := L.DoString(`
+		assert(log.set_level("agent", "debug") == nil)
+		assert(log.set_level("agent.llm", "error") == nil)
+		assert(log.set_level("agent", "loud") ~= nil)
+
+		log.info("root info")
+		log.component("agent.tools").debug("tools debug")
+		log.component("agent.llm").warn("llm warn")
+		log.component("agent.llm").error("llm error")
+
+		assert(log.get_level() == "warn")
+		assert(log.get_level("agent.tools.fetch") == "debug")
+		assert(log.get_level("agent.llm") == "error")
+
+		local cfg = log.get_config()
+		assert(cfg.default == "warn")
+		assert(cfg.components.agent == "debug")
+		assert(cfg.components["agent.llm"] == "error")
+
+		log.set_level("*", "off")
+		log.error("silenced")
+	`)
+	if err != nil {
+		t.Fatalf("Failed to run component level script: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"tools debug", "component=agent.tools", "llm error"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got %q", want, out)
+		}
+	}
+	for _, unwanted := range []string{"root info", "llm warn", "silenced"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("Expected output not to contain %q, got %q", unwanted, out)
+		}
+	}
+}
+
+func TestSeedRandom(t *testing.T) {
+	draw := func(seed int64) string {
+		L := lua.NewState()
+		defer L.Close()
+
+		SeedRandom(L, seed)
+		if err := L.DoString(`
+			local values = {}
+			for i = 1, 5 do
+				table.insert(values, math.random(1000))
+			end
+			table.insert(values, math.random(5, 6))
+			result = table.concat(values, ",")
+		`); err != nil {
+			t.Fatalf("Failed to draw random numbers: %v", err)
+		}
+		return L.GetGlobal("result").String()
+	}
+
+	if first, second := draw(42), draw(42); first != second {
+		t.Errorf("Expected the same sequence for the same seed, got %s and %s", first, second)
+	}
+	if draw(42) == draw(43) {
+		t.Error("Expected different sequences for different seeds")
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+	SeedRandom(L, 1)
+	if err := L.DoString(`
+		math.randomseed(7)
+		local a = math.random()
+		math.randomseed(7)
+		assert(math.random() == a, "randomseed should restart the sequence")
+	`); err != nil {
+		t.Fatalf("randomseed failed: %v", err)
+	}
+}
+
+func TestWarn(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	type warning struct {
+		message string
+		data    map[string]interface{}
+	}
+	var warnings []warning
+	config := DefaultConfig()
+	config.WarnSink = func(message string, data map[string]interface{}) {
+		warnings = append(warnings, warning{message, data})
+	}
+	if err := RegisterAll(L, config); err != nil {
+		t.Fatalf("Failed to register stdlib: %v", err)
+	}
+
+	if err := L.DoString(`
+		warn("deprecated option", {option = "fast"})
+		warn("no data")
+		warn("list data", {1, 2})
+	`); err != nil {
+		t.Fatalf("warn failed: %v", err)
+	}
+
+	if len(warnings) != 3 {
+		t.Fatalf("Expected 3 warnings, got %d", len(warnings))
+	}
+	if warnings[0].message != "deprecated option" || warnings[0].data["option"] != "fast" {
+		t.Errorf("Unexpected first warning: %+v", warnings[0])
+	}
+	if warnings[1].data != nil {
+		t.Errorf("Expected no data, got %v", warnings[1].data)
+	}
+	if _, ok := warnings[2].data["value"]; !ok {
+		t.Errorf("Expected list data under value, got %v", warnings[2].data)
+	}
+}
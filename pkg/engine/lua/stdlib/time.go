@@ -0,0 +1,164 @@
+// ABOUTME: Time module for Lua spells: time.now() and an os.date-style time.date()
+// ABOUTME: Reads the clock set for the Lua state, so runs can be pinned to a fixed time
+
+package stdlib
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/clock"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Clocks set per Lua state; states without one use the system clock
+var (
+	clocksMu sync.Mutex
+	clocks   = make(map[*lua.LState]clock.Clock)
+)
+
+// SetClock makes L tell time by c: time.now(), time.date(), log trace
+// timestamps, and the call durations bridges record. It is dropped when L
+// is cleaned up.
+func SetClock(L *lua.LState, c clock.Clock) {
+	clocksMu.Lock()
+	defer clocksMu.Unlock()
+
+	if _, set := clocks[L]; !set {
+		OnCleanup(L, func() {
+			clocksMu.Lock()
+			defer clocksMu.Unlock()
+			delete(clocks, L)
+		})
+	}
+	clocks[L] = c
+}
+
+// ClockOf returns the clock L tells time by
+func ClockOf(L *lua.LState) clock.Clock {
+	clocksMu.Lock()
+	defer clocksMu.Unlock()
+
+	if c, ok := clocks[L]; ok {
+		return c
+	}
+	return clock.Real
+}
+
+// RegisterTime registers the time module:
+//
+//	time.now()               seconds since the Unix epoch, with fractions
+//	time.date([format[, t]]) t (default now) formatted like os.date
+//
+// format takes strftime directives such as %Y-%m-%d %H:%M:%S and defaults
+// to %c. A leading "!" formats in UTC, and "*t" returns a table with
+// year, month, day, hour, min, sec, wday, yday and isdst.
+func RegisterTime(L *lua.LState) {
+	mod := L.NewTable()
+	L.SetFuncs(mod, map[string]lua.LGFunction{
+		"now":  timeNow,
+		"date": timeDate,
+	})
+	L.SetGlobal("time", mod)
+}
+
+func timeNow(L *lua.LState) int {
+	now := ClockOf(L).Now()
+	L.Push(lua.LNumber(float64(now.UnixNano()) / 1e9))
+	return 1
+}
+
+func timeDate(L *lua.LState) int {
+	format := L.OptString(1, "%c")
+	t := ClockOf(L).Now()
+	if L.GetTop() >= 2 && L.Get(2) != lua.LNil {
+		secs := float64(L.CheckNumber(2))
+		whole, frac := math.Modf(secs)
+		t = time.Unix(int64(whole), int64(frac*1e9))
+	}
+
+	if strings.HasPrefix(format, "!") {
+		format, t = format[1:], t.UTC()
+	} else {
+		t = t.Local()
+	}
+
+	if format == "*t" {
+		tbl := L.NewTable()
+		tbl.RawSetString("year", lua.LNumber(t.Year()))
+		tbl.RawSetString("month", lua.LNumber(t.Month()))
+		tbl.RawSetString("day", lua.LNumber(t.Day()))
+		tbl.RawSetString("hour", lua.LNumber(t.Hour()))
+		tbl.RawSetString("min", lua.LNumber(t.Minute()))
+		tbl.RawSetString("sec", lua.LNumber(t.Second()))
+		tbl.RawSetString("wday", lua.LNumber(t.Weekday()+1))
+		tbl.RawSetString("yday", lua.LNumber(t.YearDay()))
+		tbl.RawSetString("isdst", lua.LBool(t.IsDST()))
+		L.Push(tbl)
+		return 1
+	}
+
+	formatted, err := strftime(t, format)
+	if err != nil {
+		L.ArgError(1, err.Error())
+	}
+	L.Push(lua.LString(formatted))
+	return 1
+}
+
+// strftimeLayouts maps the strftime directives time.date understands to
+// Go layouts
+var strftimeLayouts = map[byte]string{
+	'a': "Mon",
+	'A': "Monday",
+	'b': "Jan",
+	'B': "January",
+	'c': "Mon Jan  2 15:04:05 2006",
+	'd': "02",
+	'H': "15",
+	'I': "03",
+	'm': "01",
+	'M': "04",
+	'p': "PM",
+	'S': "05",
+	'x': "01/02/06",
+	'X': "15:04:05",
+	'y': "06",
+	'Y': "2006",
+	'z': "-0700",
+	'Z': "MST",
+}
+
+// strftime formats t as C's strftime would for the directives above, plus
+// %j (day of the year), %w (weekday, Sunday is 0) and %%
+func strftime(t time.Time, format string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		if i == len(format) {
+			return "", fmt.Errorf("format ends with '%%'")
+		}
+		switch c := format[i]; c {
+		case '%':
+			b.WriteByte('%')
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'w':
+			fmt.Fprintf(&b, "%d", t.Weekday())
+		default:
+			layout, ok := strftimeLayouts[c]
+			if !ok {
+				return "", fmt.Errorf("unsupported directive '%%%c'", c)
+			}
+			b.WriteString(t.Format(layout))
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,57 @@
+// ABOUTME: Tests for the time module
+// ABOUTME: Verifies time.now and time.date against a stopped clock and the system clock
+
+package stdlib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/clock"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestTimeModule(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	RegisterTime(L)
+
+	fixed := clock.NewManual(time.Date(2024, 3, 1, 9, 30, 15, 500e6, time.UTC))
+	SetClock(L, fixed)
+
+	err := L.DoString(`
+		assert(time.now() == 1709285415.5, tostring(time.now()))
+		assert(time.date("!%Y-%m-%d %H:%M:%S") == "2024-03-01 09:30:15", time.date("!%Y-%m-%d %H:%M:%S"))
+		assert(time.date("!%a %b %d %j %w %p %%") == "Fri Mar 01 061 5 AM %")
+		assert(time.date("!%c", 0) == "Thu Jan  1 00:00:00 1970")
+
+		local t = time.date("!*t")
+		assert(t.year == 2024 and t.month == 3 and t.day == 1)
+		assert(t.hour == 9 and t.min == 30 and t.sec == 15)
+		assert(t.wday == 6 and t.yday == 61 and t.isdst == false)
+
+		assert(not pcall(time.date, "%Q"), "unknown directives should be rejected")
+		assert(not pcall(time.date, "100%"), "a trailing % should be rejected")
+	`)
+	if err != nil {
+		t.Fatalf("Time module failed: %v", err)
+	}
+
+	// The module reads the clock on every call
+	fixed.Advance(time.Minute)
+	if err := L.DoString(`assert(time.date("!%M:%S") == "31:15")`); err != nil {
+		t.Errorf("Expected time.date to follow the clock: %v", err)
+	}
+
+	Cleanup(L)
+	if ClockOf(L) != clock.Real {
+		t.Error("Expected cleanup to drop the clock")
+	}
+	before := time.Now()
+	if err := L.DoString(`now = time.now()`); err != nil {
+		t.Fatal(err)
+	}
+	if now := float64(L.GetGlobal("now").(lua.LNumber)); now < float64(before.Unix()) {
+		t.Errorf("Expected the system clock, got %v", now)
+	}
+}
@@ -0,0 +1,39 @@
+// ABOUTME: The warn() global for raising non-fatal warnings from scripts
+// ABOUTME: Warnings go to a sink the host provides and are reported apart from errors
+
+package stdlib
+
+import (
+	"log"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// WarnSink receives warnings scripts raise with warn(message, data)
+type WarnSink func(message string, data map[string]interface{})
+
+// RegisterWarn defines warn(message[, data]) in L, replacing any earlier
+// definition. data may be any table; one that is not a map is passed as
+// {value = data}. With a nil sink warnings are logged.
+func RegisterWarn(L *lua.LState, sink WarnSink) {
+	L.SetGlobal("warn", L.NewFunction(func(L *lua.LState) int {
+		message := L.CheckString(1)
+
+		var data map[string]interface{}
+		if L.GetTop() >= 2 && L.Get(2) != lua.LNil {
+			switch value := luaToGo(L.Get(2)).(type) {
+			case map[string]interface{}:
+				data = value
+			default:
+				data = map[string]interface{}{"value": value}
+			}
+		}
+
+		if sink == nil {
+			log.Printf("Warning: %s", message)
+			return 0
+		}
+		sink(message, data)
+		return 0
+	}))
+}
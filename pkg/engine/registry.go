@@ -170,6 +170,11 @@ func (r *Registry) GetMetadata(name string) (EngineMetadata, error) {
 // Global registry instance
 var globalRegistry = NewRegistry()
 
+// DefaultRegistry returns the global registry
+func DefaultRegistry() *Registry {
+	return globalRegistry
+}
+
 // RegisterEngine registers an engine factory in the global registry
 func RegisterEngine(name string, factory EngineFactory) error {
 	return globalRegistry.Register(name, factory)
@@ -209,3 +214,9 @@ func DiscoverEngineByExtension(ext string) (string, error) {
 func DiscoverEngineByMimeType(mimeType string) (string, error) {
 	return globalRegistry.DiscoverByMimeType(mimeType)
 }
+
+// DetectEngine finds the engine for a script file in the global registry,
+// by its #!llmspell:<language> line or its extension
+func DetectEngine(path string) (string, error) {
+	return globalRegistry.Detect(path)
+}
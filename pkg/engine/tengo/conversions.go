@@ -0,0 +1,116 @@
+// ABOUTME: Type conversion between Go values and Tengo objects
+// ABOUTME: Extends Tengo's own conversions to the slice and map types the bridges return
+
+package tengo
+
+import (
+	"fmt"
+
+	"github.com/d5/tengo/v2"
+)
+
+// ToObject converts a Go value to a Tengo object. Beyond what
+// tengo.FromInterface takes, it converts string slices, slices of maps,
+// string maps, and the integer and float widths bridges return.
+func ToObject(value interface{}) (tengo.Object, error) {
+	switch v := value.(type) {
+	case tengo.Object:
+		return v, nil
+	case []string:
+		arr := make([]tengo.Object, len(v))
+		for i, s := range v {
+			arr[i] = &tengo.String{Value: s}
+		}
+		return &tengo.Array{Value: arr}, nil
+	case []map[string]interface{}:
+		arr := make([]tengo.Object, len(v))
+		for i, m := range v {
+			obj, err := ToObject(m)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = obj
+		}
+		return &tengo.Array{Value: arr}, nil
+	case map[string]string:
+		m := make(map[string]tengo.Object, len(v))
+		for k, s := range v {
+			m[k] = &tengo.String{Value: s}
+		}
+		return &tengo.Map{Value: m}, nil
+	case map[string]interface{}:
+		m := make(map[string]tengo.Object, len(v))
+		for k, item := range v {
+			obj, err := ToObject(item)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = obj
+		}
+		return &tengo.Map{Value: m}, nil
+	case []interface{}:
+		arr := make([]tengo.Object, len(v))
+		for i, item := range v {
+			obj, err := ToObject(item)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = obj
+		}
+		return &tengo.Array{Value: arr}, nil
+	case int32:
+		return &tengo.Int{Value: int64(v)}, nil
+	case uint:
+		return &tengo.Int{Value: int64(v)}, nil
+	case float32:
+		return &tengo.Float{Value: float64(v)}, nil
+	}
+
+	obj, err := tengo.FromInterface(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert %T to a Tengo value", value)
+	}
+	return obj, nil
+}
+
+// ToInterface converts a Tengo object to a Go value: maps to
+// map[string]interface{}, arrays to []interface{}, and undefined to nil.
+// Errors become their message.
+func ToInterface(obj tengo.Object) interface{} {
+	switch o := obj.(type) {
+	case nil:
+		return nil
+	case *tengo.Error:
+		return fmt.Sprint(ToInterface(o.Value))
+	}
+	return tengo.ToInterface(obj)
+}
+
+// ToMap converts a Tengo map to a Go map, or nil and false if obj is not one
+func ToMap(obj tengo.Object) (map[string]interface{}, bool) {
+	switch obj.(type) {
+	case *tengo.Map, *tengo.ImmutableMap:
+		m, ok := tengo.ToInterface(obj).(map[string]interface{})
+		return m, ok
+	}
+	return nil, false
+}
+
+// errorObject is how module functions report failures: a Tengo error
+// value, which the script checks with is_error rather than being aborted
+func errorObject(err error) tengo.Object {
+	return &tengo.Error{Value: &tengo.String{Value: err.Error()}}
+}
+
+// stringArg returns args[i] as a string, or an error naming the argument
+// for a script passing something else
+func stringArg(args []tengo.Object, i int, name string) (string, error) {
+	if len(args) <= i {
+		return "", tengo.ErrWrongNumArguments
+	}
+	s, ok := args[i].(*tengo.String)
+	if !ok {
+		return "", tengo.ErrInvalidArgumentType{Name: name, Expected: "string", Found: args[i].TypeName()}
+	}
+	return s.Value, nil
+}
@@ -0,0 +1,332 @@
+// ABOUTME: Tengo script engine implementation using d5/tengo
+// ABOUTME: Runs sandboxed Tengo spells with Go functions, variables, and bridge modules
+
+package tengo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/d5/tengo/v2"
+	tengostdlib "github.com/d5/tengo/v2/stdlib"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+)
+
+func init() {
+	// Make Tengo available to engine discovery, e.g. for sub-spells
+	_ = engine.RegisterEngineWithMetadata("tengo", func(config engine.Config) (engine.Engine, error) {
+		return NewTengoEngine(&config)
+	}, engine.EngineMetadata{
+		Description:    "Tengo via d5/tengo",
+		FileExtensions: []string{".tengo"},
+		MimeTypes:      []string{"text/x-tengo"},
+	})
+}
+
+// SafeModules are the Tengo standard library modules spells may import.
+// The os module is left out, as it reaches the file system, environment,
+// and processes.
+var SafeModules = []string{"base64", "enum", "fmt", "hex", "json", "math", "rand", "text", "times"}
+
+// ResultVariable is the global a Tengo spell assigns the value it hands
+// back to, since a Tengo script cannot return from its top level
+const ResultVariable = "result"
+
+// allocsPerMB converts the engine's memory limit into the number of object
+// allocations a run may make, Tengo's nearest limit
+const allocsPerMB = 16 * 1024
+
+// TengoEngine implements the Engine interface for Tengo scripts. Each run
+// compiles the loaded script with the variables, functions, and modules
+// registered so far.
+type TengoEngine struct {
+	config *engine.Config
+
+	mu       sync.Mutex
+	source   []byte
+	loaded   bool
+	globals  map[string]tengo.Object
+	modules  *tengo.ModuleMap
+	compiled *tengo.Compiled
+	ctx      context.Context
+}
+
+// NewTengoEngine creates a new Tengo engine instance
+func NewTengoEngine(config *engine.Config) (*TengoEngine, error) {
+	if config == nil {
+		config = &engine.Config{
+			MaxExecutionTime: 30,               // 30 seconds default
+			MaxMemory:        64 * 1024 * 1024, // 64MB default
+		}
+	}
+
+	return &TengoEngine{
+		config:  config,
+		globals: make(map[string]tengo.Object),
+		modules: tengostdlib.GetModuleMap(SafeModules...),
+		ctx:     context.Background(),
+	}, nil
+}
+
+// Name returns the name of the engine
+func (e *TengoEngine) Name() string {
+	return "tengo"
+}
+
+// LoadScript loads a script from a reader. It is compiled when it runs,
+// once every variable it may use is known. A #! first line, which Tengo
+// would reject, is skipped.
+func (e *TengoEngine) LoadScript(reader io.Reader) error {
+	script, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read script: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.source, e.loaded = engine.StripShebang(script), true
+	return nil
+}
+
+// LoadScriptFile loads a script from a file path
+func (e *TengoEngine) LoadScriptFile(path string) error {
+	script, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to load script file: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.source, e.loaded = engine.StripShebang(script), true
+	return nil
+}
+
+// Execute runs the loaded script
+func (e *TengoEngine) Execute(ctx context.Context) error {
+	_, err := e.run(ctx)
+	return err
+}
+
+// ExecuteResult runs the loaded script and returns the value it assigned
+// to ResultVariable, or nil if it assigned none
+func (e *TengoEngine) ExecuteResult(ctx context.Context) (interface{}, error) {
+	compiled, err := e.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !compiled.IsDefined(ResultVariable) {
+		return nil, nil
+	}
+	return ToInterface(compiled.Get(ResultVariable).Object()), nil
+}
+
+// run compiles the loaded script and runs it within the engine's time and
+// allocation limits
+func (e *TengoEngine) run(ctx context.Context) (*tengo.Compiled, error) {
+	e.mu.Lock()
+	if !e.loaded {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("no script loaded")
+	}
+
+	script := tengo.NewScript(e.source)
+	script.SetImports(e.modules)
+	script.SetMaxAllocs(e.config.MaxMemory / (1024 * 1024) * allocsPerMB)
+	if e.config.MaxMemory <= 0 {
+		script.SetMaxAllocs(-1)
+	}
+	for name, value := range e.globals {
+		if err := script.Add(name, value); err != nil {
+			e.mu.Unlock()
+			return nil, fmt.Errorf("failed to add variable %s: %w", name, err)
+		}
+	}
+	// Declared up front so the script can assign its result
+	if _, ok := e.globals[ResultVariable]; !ok {
+		_ = script.Add(ResultVariable, nil)
+	}
+	e.mu.Unlock()
+
+	compiled, err := script.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile script: %w", err)
+	}
+
+	if e.config.MaxExecutionTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, time.Duration(e.config.MaxExecutionTime)*time.Second, engine.ErrExecutionTimeout)
+		defer cancel()
+	}
+
+	e.setContext(ctx)
+	defer e.setContext(context.Background())
+
+	// A cancelled script says why it stopped, not just "context canceled"
+	if err := engine.WrapCancel(ctx, compiled.RunContext(ctx)); err != nil {
+		return nil, fmt.Errorf("script execution failed: %w", err)
+	}
+
+	e.mu.Lock()
+	e.compiled = compiled
+	e.mu.Unlock()
+	return compiled, nil
+}
+
+// Context returns the context of the run in progress, for module functions
+// that make calls on the script's behalf, or context.Background between
+// runs
+func (e *TengoEngine) Context() context.Context {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.ctx
+}
+
+func (e *TengoEngine) setContext(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ctx = ctx
+}
+
+// RegisterFunction registers a Go function to be callable from Tengo. It
+// takes the signatures the Lua engine does, as well as tengo.CallableFunc.
+func (e *TengoEngine) RegisterFunction(name string, fn interface{}) error {
+	callable, err := wrapGoFunction(fn)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.globals[name] = &tengo.UserFunction{Name: name, Value: callable}
+	return nil
+}
+
+// SetVariable sets a variable in the script context
+func (e *TengoEngine) SetVariable(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return fmt.Errorf("failed to convert value: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.globals[name] = obj
+	return nil
+}
+
+// GetVariable gets a variable from the script context: its value at the
+// end of the last run, or as it was set before any run
+func (e *TengoEngine) GetVariable(name string) (interface{}, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.compiled != nil && e.compiled.IsDefined(name) {
+		return ToInterface(e.compiled.Get(name).Object()), nil
+	}
+	if value, ok := e.globals[name]; ok {
+		return ToInterface(value), nil
+	}
+	return nil, nil
+}
+
+// RegisterModule makes a module of Go functions and values importable by
+// scripts, as in llm := import("llm")
+func (e *TengoEngine) RegisterModule(name string, attrs map[string]tengo.Object) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.modules.AddBuiltinModule(name, attrs)
+}
+
+// RegisterModuleLoader makes a module importable whose functions are only
+// built when a script first imports it, so a spell pays only for the
+// bridges it uses. An error from load fails the script's compilation.
+func (e *TengoEngine) RegisterModuleLoader(name string, load func() (map[string]tengo.Object, error)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.modules.Add(name, &moduleLoader{load: load})
+}
+
+// moduleLoader is an importable module built on first import
+type moduleLoader struct {
+	once   sync.Once
+	load   func() (map[string]tengo.Object, error)
+	module tengo.Object
+	err    error
+}
+
+// Import builds the module, once
+func (m *moduleLoader) Import(string) (interface{}, error) {
+	m.once.Do(func() {
+		attrs, err := m.load()
+		m.module, m.err = &tengo.ImmutableMap{Value: attrs}, err
+	})
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.module, nil
+}
+
+// Close releases the last run's state
+func (e *TengoEngine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.compiled = nil
+	e.loaded = false
+	return nil
+}
+
+// wrapGoFunction wraps a Go function to be callable from Tengo
+func wrapGoFunction(fn interface{}) (tengo.CallableFunc, error) {
+	switch f := fn.(type) {
+	case tengo.CallableFunc:
+		return f, nil
+	case func(string) string:
+		return func(args ...tengo.Object) (tengo.Object, error) {
+			arg, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			return &tengo.String{Value: f(arg)}, nil
+		}, nil
+	case func() string:
+		return func(args ...tengo.Object) (tengo.Object, error) {
+			return &tengo.String{Value: f()}, nil
+		}, nil
+	case func(string, int) string:
+		return func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) != 2 {
+				return nil, tengo.ErrWrongNumArguments
+			}
+			arg, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			n, ok := tengo.ToInt(args[1])
+			if !ok {
+				return nil, tengo.ErrInvalidArgumentType{Name: "second", Expected: "int", Found: args[1].TypeName()}
+			}
+			return &tengo.String{Value: f(arg, n)}, nil
+		}, nil
+	case func() []string:
+		return func(args ...tengo.Object) (tengo.Object, error) {
+			return ToObject(f())
+		}, nil
+	case func():
+		return func(args ...tengo.Object) (tengo.Object, error) {
+			f()
+			return tengo.UndefinedValue, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported function signature: %T", fn)
+}
@@ -0,0 +1,407 @@
+// ABOUTME: Tests for the Tengo script engine implementation
+// ABOUTME: Validates execution, type conversion, function registration, modules, and sandbox limits
+
+package tengo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/d5/tengo/v2"
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/engine"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+// newTestEngine creates an engine with script loaded
+func newTestEngine(t *testing.T, config *engine.Config, script string) *TengoEngine {
+	t.Helper()
+	eng, err := NewTengoEngine(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := eng.LoadScript(strings.NewReader(script)); err != nil {
+		t.Fatalf("LoadScript() error = %v", err)
+	}
+	t.Cleanup(func() { _ = eng.Close() })
+	return eng
+}
+
+// TestEngineRegistered tests that .tengo scripts find the Tengo engine
+func TestEngineRegistered(t *testing.T) {
+	name, err := engine.DiscoverEngineByExtension(".tengo")
+	if err != nil || name != "tengo" {
+		t.Fatalf("expected .tengo to map to the tengo engine, got %q, %v", name, err)
+	}
+	eng, err := engine.CreateEngine(name, engine.Config{MaxExecutionTime: 5})
+	if err != nil {
+		t.Fatalf("CreateEngine() error = %v", err)
+	}
+	if eng.Name() != "tengo" {
+		t.Errorf("Name() = %q", eng.Name())
+	}
+}
+
+// TestExecuteResult tests variables in, the result out, and conversions both ways
+func TestExecuteResult(t *testing.T) {
+	eng := newTestEngine(t, nil, `
+		text := import("text")
+		total := 0
+		for n in params.numbers { total += n }
+		result = {name: text.to_upper(params.name), total: total, tags: params.tags}
+	`)
+	if err := eng.SetVariable("params", map[string]interface{}{
+		"name":    "ada",
+		"numbers": []interface{}{1, 2, 3},
+		"tags":    []string{"a", "b"},
+	}); err != nil {
+		t.Fatalf("SetVariable() error = %v", err)
+	}
+
+	result, err := eng.ExecuteResult(context.Background())
+	if err != nil {
+		t.Fatalf("ExecuteResult() error = %v", err)
+	}
+	got, ok := result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a map result, got %T", result)
+	}
+	if got["name"] != "ADA" || got["total"] != int64(6) {
+		t.Errorf("unexpected result %v", got)
+	}
+	if tags, _ := got["tags"].([]interface{}); len(tags) != 2 || tags[1] != "b" {
+		t.Errorf("expected tags to round-trip, got %v", got["tags"])
+	}
+
+	total, err := eng.GetVariable("total")
+	if err != nil || total != int64(6) {
+		t.Errorf("GetVariable(total) = %v, %v", total, err)
+	}
+}
+
+// TestRegisterFunction tests calling Go functions from Tengo
+func TestRegisterFunction(t *testing.T) {
+	eng := newTestEngine(t, nil, `result = greet("world") + " " + repeat("ab", 2)`)
+	if err := eng.RegisterFunction("greet", func(name string) string { return "hello " + name }); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.RegisterFunction("repeat", func(s string, n int) string { return strings.Repeat(s, n) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.RegisterFunction("bad", func(int) int { return 0 }); err == nil {
+		t.Error("expected an unsupported signature to be rejected")
+	}
+
+	result, err := eng.ExecuteResult(context.Background())
+	if err != nil || result != "hello world abab" {
+		t.Errorf("ExecuteResult() = %v, %v", result, err)
+	}
+}
+
+// TestSandbox tests that scripts cannot reach the os module or run past their limits
+func TestSandbox(t *testing.T) {
+	t.Run("no os module", func(t *testing.T) {
+		eng := newTestEngine(t, nil, `os := import("os"); result = os.getenv("HOME")`)
+		if err := eng.Execute(context.Background()); err == nil {
+			t.Error("expected importing os to fail")
+		}
+	})
+
+	t.Run("execution time", func(t *testing.T) {
+		eng := newTestEngine(t, &engine.Config{MaxExecutionTime: 1}, `for {}`)
+		start := time.Now()
+		err := eng.Execute(context.Background())
+		if !errors.Is(err, engine.ErrExecutionTimeout) {
+			t.Errorf("expected a timeout, got %v", err)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("script ran for %s", time.Since(start))
+		}
+	})
+
+	t.Run("cancellation", func(t *testing.T) {
+		eng := newTestEngine(t, nil, `for {}`)
+		ctx, cancel := context.WithCancelCause(context.Background())
+		time.AfterFunc(50*time.Millisecond, func() { cancel(engine.ErrInterrupted) })
+		if err := eng.Execute(ctx); !errors.Is(err, engine.ErrInterrupted) {
+			t.Errorf("expected the run to be cancelled, got %v", err)
+		}
+	})
+
+	t.Run("allocations", func(t *testing.T) {
+		eng := newTestEngine(t, &engine.Config{MaxMemory: 1024 * 1024}, `
+			a := []
+			for i := 0; i < 1000000; i++ { a = append(a, [i]) }
+		`)
+		if err := eng.Execute(context.Background()); !errors.Is(err, tengo.ErrObjectAllocLimit) {
+			t.Errorf("expected the allocation limit, got %v", err)
+		}
+	})
+}
+
+// fakeLLM answers chats by echoing the prompt, or fails for "fail"
+type fakeLLM struct {
+	provider string
+}
+
+func (f *fakeLLM) Chat(ctx context.Context, prompt string) (string, error) {
+	if prompt == "fail" {
+		return "", errors.New("provider unavailable")
+	}
+	return "echo: " + prompt, nil
+}
+
+func (f *fakeLLM) ChatMessages(ctx context.Context, messages []bridge.ChatMessage) (string, error) {
+	return f.Chat(ctx, bridge.Transcript(messages))
+}
+
+func (f *fakeLLM) Complete(ctx context.Context, prompt string, maxTokens int) (string, error) {
+	return prompt, nil
+}
+
+func (f *fakeLLM) GetCurrentProvider() string    { return f.provider }
+func (f *fakeLLM) ListProviders() []string       { return []string{"a", "b"} }
+func (f *fakeLLM) SetProvider(name string) error { f.provider = name; return nil }
+func (f *fakeLLM) GetModel() string              { return "" }
+func (f *fakeLLM) SetModel(name string) error    { return nil }
+
+// TestModules tests the bridge modules, their error values, and their restrictions
+func TestModules(t *testing.T) {
+	eng := newTestEngine(t, nil, `
+		llm := import("llm")
+		state := import("state")
+		state.set("answer", llm.chat("hi"))
+		failed := llm.chat("fail")
+		chat := llm.chat([{role: "user", content: "again"}])
+		result = {
+			answer: state.get("answer"),
+			failed: is_error(failed),
+			chat: chat,
+			denied: string(llm.set_provider("b")),
+			providers: llm.list_providers()
+		}
+	`)
+	llm := &fakeLLM{provider: "a"}
+	stats := bridge.NewCallStats()
+	loads := 0
+	eng.RegisterModuleLoader("llm", func() (map[string]tengo.Object, error) {
+		loads++
+		attrs := LLMModule(eng, llm)
+		ApplyMethodPolicy("llm", attrs, &security.MethodPolicy{Deny: []string{"llm.set_provider"}})
+		ApplyCallStats("llm", attrs, stats)
+		return attrs, nil
+	})
+	eng.RegisterModule("state", StateModule(bridge.NewSharedState(), nil, nil))
+
+	for i := 0; i < 2; i++ {
+		if _, err := eng.ExecuteResult(context.Background()); err != nil {
+			t.Fatalf("ExecuteResult() error = %v", err)
+		}
+	}
+	result, _ := eng.GetVariable("result")
+	got := result.(map[string]interface{})
+	if got["answer"] != "echo: hi" || got["failed"] != true {
+		t.Errorf("unexpected result %v", got)
+	}
+	if chat, _ := got["chat"].(string); !strings.Contains(chat, "again") {
+		t.Errorf("expected a conversation to reach the bridge, got %v", got["chat"])
+	}
+	if denied, _ := got["denied"].(string); !strings.Contains(denied, "set_provider") || llm.provider != "a" {
+		t.Errorf("expected set_provider to be denied, got %v", got["denied"])
+	}
+	if loads != 1 {
+		t.Errorf("expected the module to be built once, got %d", loads)
+	}
+
+	for _, stat := range stats.Snapshot() {
+		if stat.Name == "llm.chat" && (stat.Calls != 6 || stat.Failures != 2) {
+			t.Errorf("expected 6 chats with 2 failures, got %+v", stat)
+		}
+	}
+}
+
+// TestCallBudgetCost tests that a batch spends a call per prompt
+func TestCallBudgetCost(t *testing.T) {
+	prompts := &tengo.Array{Value: []tengo.Object{&tengo.String{Value: "a"}, &tengo.String{Value: "b"}, &tengo.String{Value: "c"}}}
+	if got := bridge.CallCost("llm.batch", tengoCallArgs{prompts}); got != 3 {
+		t.Errorf("expected a batch of 3 prompts to cost 3, got %d", got)
+	}
+	options := &tengo.Map{Value: map[string]tengo.Object{"retries": &tengo.Int{Value: 0}}}
+	if got := bridge.CallCost("llm.generate_structured", tengoCallArgs{&tengo.String{Value: "a"}, tengo.UndefinedValue, options}); got != 1 {
+		t.Errorf("expected generate_structured without retries to cost 1, got %d", got)
+	}
+}
+
+// TestStateLocks tests locking state keys from Tengo
+func TestStateLocks(t *testing.T) {
+	parent := bridge.NewSharedState()
+	held, err := parent.Lock(context.Background(), "held", bridge.LockOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eng := newTestEngine(t, nil, `
+		state := import("state")
+		token := state.lock("queue", {ttl: 60})
+		result = {
+			locked: state.is_locked("queue"),
+			again: is_error(state.lock("queue")),
+			wrong: is_error(state.unlock("queue", "wrong")),
+			unlocked: state.unlock("queue", token),
+			free: state.is_locked("queue"),
+			busy: string(state.lock("held", {timeout: 0}))
+		}
+	`)
+	eng.RegisterModule("state", StateModule(parent.Child(bridge.StateInheritance{}), nil, nil))
+
+	result, err := eng.ExecuteResult(context.Background())
+	if err != nil {
+		t.Fatalf("ExecuteResult() error = %v", err)
+	}
+	got := result.(map[string]interface{})
+	if got["locked"] != true || got["again"] != true || got["wrong"] != true || got["unlocked"] != true || got["free"] != false {
+		t.Errorf("unexpected result %v", got)
+	}
+	if busy, _ := got["busy"].(string); !strings.Contains(busy, "timed out") {
+		t.Errorf("expected a lock held elsewhere to time out, got %v", got["busy"])
+	}
+	if err := parent.Unlock("held", held); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestStateHistory tests listing and replaying state changes from Tengo
+func TestStateHistory(t *testing.T) {
+	eng := newTestEngine(t, nil, `
+		state := import("state")
+		state.set("task.1", "open")
+		state.set("note", "hi")
+		state.set("task.1", "done")
+		tasks := state.history({keys: "task.*"})
+		result = {
+			tasks: len(tasks),
+			last: tasks[1].value,
+			latest: state.history({limit: 1})[0].key,
+			before: state.replay(1),
+			seq: state.last_seq(),
+			keys: state.stats().keys
+		}
+	`)
+	eng.RegisterModule("state", StateModule(bridge.NewSharedState(), nil, nil))
+
+	result, err := eng.ExecuteResult(context.Background())
+	if err != nil {
+		t.Fatalf("ExecuteResult() error = %v", err)
+	}
+	got := result.(map[string]interface{})
+	if got["tasks"] != int64(2) || got["last"] != "done" || got["latest"] != "task.1" || got["seq"] != int64(3) || got["keys"] != int64(2) {
+		t.Errorf("unexpected result %v", got)
+	}
+	if before, _ := got["before"].(map[string]interface{}); len(before) != 1 || before["task.1"] != "open" {
+		t.Errorf("expected replay to rebuild the first change, got %v", got["before"])
+	}
+}
+
+// TestStateSchema tests attaching a schema to state from Tengo
+func TestStateSchema(t *testing.T) {
+	eng := newTestEngine(t, nil, `
+		state := import("state")
+		state.set_schema({type: "object", properties: {count: {type: "integer"}}}, {strict: true})
+		bad := state.set("count", "many")
+		state.set("count", 3)
+		result = {
+			rejected: is_error(bad),
+			count: state.get("count"),
+			strict: state.get_schema().strict,
+			valid: state.validate()
+		}
+	`)
+	eng.RegisterModule("state", StateModule(bridge.NewSharedState(), nil, nil))
+
+	result, err := eng.ExecuteResult(context.Background())
+	if err != nil {
+		t.Fatalf("ExecuteResult() error = %v", err)
+	}
+	got := result.(map[string]interface{})
+	if got["rejected"] != true || got["count"] != int64(3) || got["strict"] != true || got["valid"] != true {
+		t.Errorf("unexpected result %v", got)
+	}
+}
+
+// TestStateExport tests handing state from one Tengo spell to another
+func TestStateExport(t *testing.T) {
+	eng := newTestEngine(t, nil, `
+		state := import("state")
+		state.set("topic", "tides")
+		state.set("tags", ["a", "b"])
+		result = {yaml: state.export_state("yaml"), packed: state.export_state("msgpack"), bad: is_error(state.export_state("xml"))}
+	`)
+	eng.RegisterModule("state", StateModule(bridge.NewSharedState(), nil, nil))
+	result, err := eng.ExecuteResult(context.Background())
+	if err != nil {
+		t.Fatalf("ExecuteResult() error = %v", err)
+	}
+	exported := result.(map[string]interface{})
+	if exported["bad"] != true {
+		t.Errorf("Expected an unknown format to return an error, got %v", exported)
+	}
+
+	for _, format := range []string{"yaml", "packed"} {
+		target := bridge.NewSharedState()
+		eng := newTestEngine(t, nil, `
+			state := import("state")
+			result = state.import_state(params.data)
+		`)
+		if err := eng.SetVariable("params", map[string]interface{}{"data": exported[format]}); err != nil {
+			t.Fatal(err)
+		}
+		eng.RegisterModule("state", StateModule(target, nil, nil))
+		if result, err := eng.ExecuteResult(context.Background()); err != nil || result != true {
+			t.Fatalf("import_state(%s) = %v, %v", format, result, err)
+		}
+		if topic, _ := target.Get("topic"); topic != "tides" {
+			t.Errorf("Expected the %s document's values set, got %v", format, target.Values())
+		}
+	}
+}
+
+// TestStateChannels tests Tengo spells sharing state through a channel
+func TestStateChannels(t *testing.T) {
+	channels := bridge.NewStateChannels(security.ChannelPolicy{Deny: []string{"private"}}, nil)
+	shared, err := channels.Attach("jobs", bridge.StateInheritance{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = shared.Set("next", "summarize")
+
+	eng := newTestEngine(t, nil, `
+		state := import("state")
+		jobs := state.attach("jobs")
+		peek := state.attach("jobs", {read_only: true})
+		peek.set("next", "draft")
+		jobs.set("done", jobs.get("next"))
+		result = {
+			name: jobs.name,
+			next: jobs.get("next"),
+			changes: len(jobs.history()),
+			denied: is_error(state.attach("private")),
+			channels: state.channels()
+		}
+	`)
+	eng.RegisterModule("state", StateModule(bridge.NewSharedState(), nil, channels))
+	result, err := eng.ExecuteResult(context.Background())
+	if err != nil {
+		t.Fatalf("ExecuteResult() error = %v", err)
+	}
+	want := map[string]interface{}{"name": "jobs", "next": "summarize", "changes": int64(2), "denied": true, "channels": []interface{}{"jobs"}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("Result = %#v, want %#v", result, want)
+	}
+	if done, _ := shared.Get("done"); done != "summarize" {
+		t.Errorf("Expected the spell's write in the channel, got %v", done)
+	}
+}
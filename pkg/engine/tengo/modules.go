@@ -0,0 +1,671 @@
+// ABOUTME: Bridge modules Tengo spells import: llm, tools, and state
+// ABOUTME: Wraps the Go bridges as Tengo functions that return error values on failure
+
+package tengo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/d5/tengo/v2"
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+)
+
+// LLM is what the llm module needs of an LLM bridge
+type LLM interface {
+	Chat(ctx context.Context, prompt string) (string, error)
+	ChatMessages(ctx context.Context, messages []bridge.ChatMessage) (string, error)
+	Complete(ctx context.Context, prompt string, maxTokens int) (string, error)
+	GetCurrentProvider() string
+	ListProviders() []string
+	SetProvider(name string) error
+	GetModel() string
+	SetModel(name string) error
+}
+
+// Tools is what the tools module needs of a tool bridge
+type Tools interface {
+	ExecuteTool(ctx context.Context, name string, params map[string]interface{}) (interface{}, error)
+	GetTool(name string) (map[string]interface{}, error)
+	ListTools() []map[string]interface{}
+}
+
+// LLMModule returns the llm module for a spell run by e:
+//
+//	llm := import("llm")
+//	answer := llm.chat("Hello")
+//	if is_error(answer) { ... }
+//
+// chat takes a prompt or an array of messages, as llm.chat does in Lua.
+func LLMModule(e *TengoEngine, llm LLM) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"chat": &tengo.UserFunction{Name: "chat", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) != 1 {
+				return nil, tengo.ErrWrongNumArguments
+			}
+			var response string
+			var err error
+			switch arg := args[0].(type) {
+			case *tengo.String:
+				response, err = llm.Chat(e.Context(), arg.Value)
+			case *tengo.Array, *tengo.ImmutableArray:
+				var messages []bridge.ChatMessage
+				if messages, err = bridge.ParseChatMessages(ToInterface(arg)); err == nil {
+					response, err = llm.ChatMessages(e.Context(), messages)
+				}
+			default:
+				return nil, tengo.ErrInvalidArgumentType{Name: "first", Expected: "string or array", Found: arg.TypeName()}
+			}
+			if err != nil {
+				return errorObject(err), nil
+			}
+			return &tengo.String{Value: response}, nil
+		}},
+		"complete": &tengo.UserFunction{Name: "complete", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			prompt, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			maxTokens := 100
+			if len(args) > 1 {
+				n, ok := tengo.ToInt(args[1])
+				if !ok {
+					return nil, tengo.ErrInvalidArgumentType{Name: "second", Expected: "int", Found: args[1].TypeName()}
+				}
+				maxTokens = n
+			}
+			response, err := llm.Complete(e.Context(), prompt, maxTokens)
+			if err != nil {
+				return errorObject(err), nil
+			}
+			return &tengo.String{Value: response}, nil
+		}},
+		"get_provider": &tengo.UserFunction{Name: "get_provider", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			return &tengo.String{Value: llm.GetCurrentProvider()}, nil
+		}},
+		"list_providers": &tengo.UserFunction{Name: "list_providers", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			return ToObject(llm.ListProviders())
+		}},
+		"set_provider": &tengo.UserFunction{Name: "set_provider", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			name, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			if err := llm.SetProvider(name); err != nil {
+				return errorObject(err), nil
+			}
+			return tengo.TrueValue, nil
+		}},
+		"get_model": &tengo.UserFunction{Name: "get_model", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			return &tengo.String{Value: llm.GetModel()}, nil
+		}},
+		"set_model": &tengo.UserFunction{Name: "set_model", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			name, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			if err := llm.SetModel(name); err != nil {
+				return errorObject(err), nil
+			}
+			return tengo.TrueValue, nil
+		}},
+	}
+}
+
+// ToolsModule returns the tools module for a spell run by e, with execute,
+// get, and list as in Lua. Tools are defined in Go or Lua; a Tengo spell
+// can only call them.
+func ToolsModule(e *TengoEngine, tools Tools) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"execute": &tengo.UserFunction{Name: "execute", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			name, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			params := map[string]interface{}{}
+			if len(args) > 1 {
+				var ok bool
+				if params, ok = ToMap(args[1]); !ok {
+					return nil, tengo.ErrInvalidArgumentType{Name: "second", Expected: "map", Found: args[1].TypeName()}
+				}
+			}
+			result, err := tools.ExecuteTool(e.Context(), name, params)
+			if err != nil {
+				return errorObject(err), nil
+			}
+			return ToObject(result)
+		}},
+		"get": &tengo.UserFunction{Name: "get", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			name, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			info, err := tools.GetTool(name)
+			if err != nil {
+				return errorObject(err), nil
+			}
+			return ToObject(info)
+		}},
+		"list": &tengo.UserFunction{Name: "list", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			return ToObject(tools.ListTools())
+		}},
+	}
+}
+
+// StateModule returns the state module over a spell's shared state, the one
+// its sub-spells inherit from. State is saved to and loaded from store; a
+// nil store makes persist and the other saving functions fail. Spells
+// attach to the named states in channels; nil makes attach fail.
+func StateModule(state *bridge.SharedState, store *bridge.SavedStates, channels *bridge.StateChannels) map[string]tengo.Object {
+	attrs := stateValues(state)
+	for name, fn := range stateSchema(state) {
+		attrs[name] = fn
+	}
+	for name, fn := range stateLocks(state) {
+		attrs[name] = fn
+	}
+	for name, fn := range stateHistory(state) {
+		attrs[name] = fn
+	}
+	for name, fn := range statePersistence(state, store) {
+		attrs[name] = fn
+	}
+	for name, fn := range stateExport(state) {
+		attrs[name] = fn
+	}
+	for name, fn := range stateChannels(channels) {
+		attrs[name] = fn
+	}
+	return attrs
+}
+
+// stateValues returns get, set, delete, keys, and stats, which work on the
+// values of state
+func stateValues(state *bridge.SharedState) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"get": &tengo.UserFunction{Name: "get", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			key, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			value, ok := state.Get(key)
+			if !ok {
+				return tengo.UndefinedValue, nil
+			}
+			return ToObject(value)
+		}},
+		"set": &tengo.UserFunction{Name: "set", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			key, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			if len(args) != 2 {
+				return nil, tengo.ErrWrongNumArguments
+			}
+			if err := state.Set(key, ToInterface(args[1])); err != nil {
+				return errorObject(err), nil
+			}
+			return tengo.UndefinedValue, nil
+		}},
+		"delete": &tengo.UserFunction{Name: "delete", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			key, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			if err := state.Delete(key); err != nil {
+				return errorObject(err), nil
+			}
+			return tengo.UndefinedValue, nil
+		}},
+		"keys": &tengo.UserFunction{Name: "keys", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			keys := state.Keys()
+			sort.Strings(keys)
+			return ToObject(keys)
+		}},
+		"stats": &tengo.UserFunction{Name: "stats", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			return ToObject(state.Stats().ToMap())
+		}},
+	}
+}
+
+// stateChannels returns attach, which returns a map with the value, lock,
+// and history functions over a named channel that other spells of the run
+// can attach to as well, and channels, which lists the channels attached
+// to so far. attach takes an optional map with read_only: true, which
+// keeps the handle's writes to itself.
+func stateChannels(channels *bridge.StateChannels) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"attach": &tengo.UserFunction{Name: "attach", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			name, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			var inherit bridge.StateInheritance
+			if len(args) > 1 {
+				options, _ := ToMap(args[1])
+				inherit.ReadOnly, _ = options["read_only"].(bool)
+			}
+			if channels == nil {
+				return errorObject(errors.New("state channels are not available")), nil
+			}
+			state, err := channels.Attach(name, inherit)
+			if err != nil {
+				return errorObject(err), nil
+			}
+
+			handle := stateValues(state)
+			for name, fn := range stateLocks(state) {
+				handle[name] = fn
+			}
+			for name, fn := range stateHistory(state) {
+				handle[name] = fn
+			}
+			handle["name"] = &tengo.String{Value: name}
+			return &tengo.ImmutableMap{Value: handle}, nil
+		}},
+		"channels": &tengo.UserFunction{Name: "channels", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			var names []string
+			if channels != nil {
+				names = channels.Names()
+			}
+			return ToObject(names)
+		}},
+	}
+}
+
+// stateSchema returns set_schema, get_schema, and validate, which attach a
+// JSON schema to the state and check its values against it. With
+// {strict: true}, set and delete return an error instead of breaking the
+// schema.
+func stateSchema(state *bridge.SharedState) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"set_schema": &tengo.UserFunction{Name: "set_schema", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) == 0 {
+				return nil, tengo.ErrWrongNumArguments
+			}
+			var schema bridge.StateSchema
+			if args[0] != tengo.UndefinedValue {
+				var ok bool
+				if schema.Schema, ok = ToMap(args[0]); !ok {
+					return nil, tengo.ErrInvalidArgumentType{Name: "first", Expected: "map", Found: args[0].TypeName()}
+				}
+			}
+			if len(args) > 1 {
+				options, _ := ToMap(args[1])
+				schema.Strict, _ = options["strict"].(bool)
+				if version, ok := options["version"].(int64); ok {
+					schema.Version = int(version)
+				}
+			}
+			if err := state.SetSchema(schema); err != nil {
+				return errorObject(err), nil
+			}
+			return tengo.TrueValue, nil
+		}},
+		"get_schema": &tengo.UserFunction{Name: "get_schema", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			schema, ok := state.Schema()
+			if !ok {
+				return tengo.UndefinedValue, nil
+			}
+			return ToObject(map[string]interface{}{"schema": schema.Schema, "strict": schema.Strict, "version": schema.Version})
+		}},
+		"validate": &tengo.UserFunction{Name: "validate", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if err := state.Validate(); err != nil {
+				return errorObject(err), nil
+			}
+			return tengo.TrueValue, nil
+		}},
+	}
+}
+
+// stateLocks returns lock, unlock, and is_locked, advisory locks on keys
+// that the spell and its sub-spells take turns with. lock takes an
+// optional map with timeout, how many seconds to wait, and ttl, after how
+// many seconds the lock releases itself.
+func stateLocks(state *bridge.SharedState) map[string]tengo.Object {
+	// seconds reads a number of seconds from an options map
+	seconds := func(options map[string]interface{}, name string) (time.Duration, bool) {
+		var n float64
+		switch v := options[name].(type) {
+		case int64:
+			n = float64(v)
+		case float64:
+			n = v
+		default:
+			return 0, false
+		}
+		return time.Duration(n * float64(time.Second)), true
+	}
+
+	return map[string]tengo.Object{
+		"lock": &tengo.UserFunction{Name: "lock", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			key, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			var opts bridge.LockOptions
+			if len(args) > 1 {
+				options, _ := ToMap(args[1])
+				if wait, ok := seconds(options, "timeout"); ok {
+					opts.Wait = wait
+					if opts.Wait == 0 {
+						opts.Wait = -1
+					}
+				}
+				opts.TTL, _ = seconds(options, "ttl")
+			}
+			token, err := state.Lock(context.Background(), key, opts)
+			if err != nil {
+				return errorObject(err), nil
+			}
+			return &tengo.String{Value: token}, nil
+		}},
+		"unlock": &tengo.UserFunction{Name: "unlock", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			key, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			token, err := stringArg(args, 1, "second")
+			if err != nil {
+				return nil, err
+			}
+			if err := state.Unlock(key, token); err != nil {
+				return errorObject(err), nil
+			}
+			return tengo.TrueValue, nil
+		}},
+		"is_locked": &tengo.UserFunction{Name: "is_locked", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			key, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			if _, locked := state.LockHolder(key); locked {
+				return tengo.TrueValue, nil
+			}
+			return tengo.FalseValue, nil
+		}},
+	}
+}
+
+// stateHistory returns history, which lists the changes to the keys the
+// spell sees, replay, which rebuilds the values as they were after a
+// change, and last_seq, the number of the latest change. history takes an
+// optional map with keys, a pattern or array of patterns, op, since, and
+// limit.
+func stateHistory(state *bridge.SharedState) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"history": &tengo.UserFunction{Name: "history", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			var filter bridge.EventFilter
+			if len(args) > 0 {
+				options, _ := ToMap(args[0])
+				switch keys := options["keys"].(type) {
+				case string:
+					filter.Keys = []string{keys}
+				case []interface{}:
+					for _, pattern := range keys {
+						if pattern, ok := pattern.(string); ok {
+							filter.Keys = append(filter.Keys, pattern)
+						}
+					}
+				}
+				filter.Op, _ = options["op"].(string)
+				if since, ok := options["since"].(int64); ok && since > 0 {
+					filter.Since = uint64(since)
+				}
+				if limit, ok := options["limit"].(int64); ok {
+					filter.Limit = int(limit)
+				}
+			}
+
+			events := state.History(filter)
+			list := make([]interface{}, len(events))
+			for i, event := range events {
+				entry := map[string]interface{}{
+					"seq":    int64(event.Seq),
+					"op":     event.Op,
+					"key":    event.Key,
+					"value":  event.Value,
+					"time":   event.Time.Unix(),
+					"source": event.Source,
+				}
+				if event.Reason != "" {
+					entry["reason"] = event.Reason
+				}
+				list[i] = entry
+			}
+			return ToObject(list)
+		}},
+		"replay": &tengo.UserFunction{Name: "replay", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			seq := state.LastSeq()
+			if len(args) > 0 {
+				n, ok := tengo.ToInt64(args[0])
+				if !ok || n < 0 {
+					return nil, tengo.ErrInvalidArgumentType{Name: "first", Expected: "non-negative int", Found: args[0].TypeName()}
+				}
+				seq = uint64(n)
+			}
+			values, err := state.Replay(seq)
+			if err != nil {
+				return errorObject(err), nil
+			}
+			return ToObject(values)
+		}},
+		"last_seq": &tengo.UserFunction{Name: "last_seq", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			return &tengo.Int{Value: int64(state.LastSeq())}, nil
+		}},
+	}
+}
+
+// stateExport returns export_state, which returns the state as a JSON or
+// YAML string or msgpack bytes, and import_state, which sets the values of
+// such a document. Tengo reserves export and import, so the names differ
+// from Lua's.
+func stateExport(state *bridge.SharedState) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"export_state": &tengo.UserFunction{Name: "export_state", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			format := bridge.StateFormatJSON
+			if len(args) > 0 {
+				var err error
+				if format, err = stringArg(args, 0, "first"); err != nil {
+					return nil, err
+				}
+			}
+			schema, _ := state.Schema()
+			var buf bytes.Buffer
+			export := bridge.StateExport{Values: state.Values(), SchemaVersion: schema.Version}
+			if err := bridge.ExportState(&buf, format, export); err != nil {
+				return errorObject(err), nil
+			}
+			if format == bridge.StateFormatMsgpack {
+				return &tengo.Bytes{Value: buf.Bytes()}, nil
+			}
+			return &tengo.String{Value: buf.String()}, nil
+		}},
+		"import_state": &tengo.UserFunction{Name: "import_state", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) == 0 {
+				return nil, tengo.ErrWrongNumArguments
+			}
+			var data []byte
+			switch v := args[0].(type) {
+			case *tengo.String:
+				data = []byte(v.Value)
+			case *tengo.Bytes:
+				data = v.Value
+			default:
+				return nil, tengo.ErrInvalidArgumentType{Name: "first", Expected: "string or bytes", Found: args[0].TypeName()}
+			}
+			format := ""
+			if len(args) > 1 {
+				var err error
+				if format, err = stringArg(args, 1, "second"); err != nil {
+					return nil, err
+				}
+			}
+			export, err := bridge.ImportState(bytes.NewReader(data), format)
+			if err != nil {
+				return errorObject(err), nil
+			}
+			if err := state.SetValues(export.Values); err != nil {
+				return errorObject(err), nil
+			}
+			return tengo.TrueValue, nil
+		}},
+	}
+}
+
+// statePersistence returns persist, load, list_persisted, and
+// delete_persisted, which save the state under a name across runs, and
+// diff and diff_versions, which compare saved versions
+func statePersistence(state *bridge.SharedState, store *bridge.SavedStates) map[string]tengo.Object {
+	// versionArg reads the optional version after the name; zero means the
+	// latest, or every version
+	versionArg := func(args []tengo.Object) (int, error) {
+		if len(args) < 2 {
+			return 0, nil
+		}
+		n, ok := tengo.ToInt(args[1])
+		if !ok {
+			return 0, tengo.ErrInvalidArgumentType{Name: "second", Expected: "int", Found: args[1].TypeName()}
+		}
+		return n, nil
+	}
+	// deepArg reads the deep field of an options map at args[i]
+	deepArg := func(args []tengo.Object, i int) bool {
+		if len(args) <= i {
+			return false
+		}
+		options, ok := ToInterface(args[i]).(map[string]interface{})
+		deep, _ := options["deep"].(bool)
+		return ok && deep
+	}
+	checkStore := func() error {
+		if store == nil {
+			return errors.New("saving state is not available")
+		}
+		return nil
+	}
+
+	return map[string]tengo.Object{
+		"persist": &tengo.UserFunction{Name: "persist", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			name, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			if err := checkStore(); err != nil {
+				return errorObject(err), nil
+			}
+			version, err := store.Persist(name, state)
+			if err != nil {
+				return errorObject(err), nil
+			}
+			return &tengo.Int{Value: int64(version)}, nil
+		}},
+		"load": &tengo.UserFunction{Name: "load", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			name, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			version, err := versionArg(args)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkStore(); err != nil {
+				return errorObject(err), nil
+			}
+			if version, err = store.Load(name, version, state); err != nil {
+				return errorObject(err), nil
+			}
+			return &tengo.Int{Value: int64(version)}, nil
+		}},
+		"list_persisted": &tengo.UserFunction{Name: "list_persisted", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if err := checkStore(); err != nil {
+				return errorObject(err), nil
+			}
+			saved, err := store.List()
+			if err != nil {
+				return errorObject(err), nil
+			}
+			list := make([]interface{}, len(saved))
+			for i, s := range saved {
+				versions := make([]interface{}, len(s.Versions))
+				for j, v := range s.Versions {
+					versions[j] = v
+				}
+				list[i] = map[string]interface{}{
+					"name":     s.Name,
+					"versions": versions,
+					"latest":   s.Latest,
+					"saved":    s.Saved.Unix(),
+				}
+			}
+			return ToObject(list)
+		}},
+		"diff": &tengo.UserFunction{Name: "diff", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			name, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			version, err := versionArg(args)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkStore(); err != nil {
+				return errorObject(err), nil
+			}
+			saved, _, err := store.Values(name, version)
+			if err != nil {
+				return errorObject(err), nil
+			}
+			return ToObject(bridge.DiffStates(saved, state.Values(), deepArg(args, 2)).ToMap())
+		}},
+		"diff_versions": &tengo.UserFunction{Name: "diff_versions", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			name, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			if len(args) < 3 {
+				return nil, tengo.ErrWrongNumArguments
+			}
+			from, ok := tengo.ToInt(args[1])
+			if !ok {
+				return nil, tengo.ErrInvalidArgumentType{Name: "second", Expected: "int", Found: args[1].TypeName()}
+			}
+			to, ok := tengo.ToInt(args[2])
+			if !ok {
+				return nil, tengo.ErrInvalidArgumentType{Name: "third", Expected: "int", Found: args[2].TypeName()}
+			}
+			if err := checkStore(); err != nil {
+				return errorObject(err), nil
+			}
+			fromValues, _, err := store.Values(name, from)
+			if err != nil {
+				return errorObject(err), nil
+			}
+			toValues, _, err := store.Values(name, to)
+			if err != nil {
+				return errorObject(err), nil
+			}
+			return ToObject(bridge.DiffStates(fromValues, toValues, deepArg(args, 3)).ToMap())
+		}},
+		"delete_persisted": &tengo.UserFunction{Name: "delete_persisted", Value: func(args ...tengo.Object) (tengo.Object, error) {
+			name, err := stringArg(args, 0, "first")
+			if err != nil {
+				return nil, err
+			}
+			version, err := versionArg(args)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkStore(); err != nil {
+				return errorObject(err), nil
+			}
+			if err := store.Delete(name, version); err != nil {
+				return errorObject(err), nil
+			}
+			return tengo.TrueValue, nil
+		}},
+	}
+}
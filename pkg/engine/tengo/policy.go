@@ -0,0 +1,154 @@
+// ABOUTME: Enforces method policies, rate limits, and call budgets on Tengo bridge modules
+// ABOUTME: Also counts and profiles module calls, as the Lua bridges do, for run summaries
+
+package tengo
+
+import (
+	"time"
+
+	"github.com/d5/tengo/v2"
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/lexlapax/go-llmspell/pkg/security"
+)
+
+// ApplyMethodPolicy enforces a method policy on the functions of a module
+// (e.g. "tools"). Functions the policy denies are replaced so that calling
+// them returns a permission error value instead of reaching the bridge.
+func ApplyMethodPolicy(module string, attrs map[string]tengo.Object, policy *security.MethodPolicy) {
+	if policy == nil {
+		return
+	}
+	wrapFunctions(attrs, func(name string) bool {
+		return !policy.Allows(module, name)
+	}, func(name string, fn tengo.CallableFunc) tengo.CallableFunc {
+		err := policy.Check(module, name)
+		return func(args ...tengo.Object) (tengo.Object, error) {
+			return errorObject(err), nil
+		}
+	})
+}
+
+// ApplyRateLimits checks each call to a limited function of a module
+// against the limiter. Calls over a limit return a rate-limit error value
+// without reaching the bridge.
+func ApplyRateLimits(module string, attrs map[string]tengo.Object, limiter *security.RateLimiter) {
+	if limiter == nil {
+		return
+	}
+	wrapFunctions(attrs, func(name string) bool {
+		return limiter.Limits(module, name)
+	}, func(name string, fn tengo.CallableFunc) tengo.CallableFunc {
+		return func(args ...tengo.Object) (tengo.Object, error) {
+			if err := limiter.Allow(module, name); err != nil {
+				return errorObject(err), nil
+			}
+			return fn(args...)
+		}
+	})
+}
+
+// ApplyCallBudget spends the calls bridge.CallCost prices from budget
+// before each call to a module function that draws on it. The call that
+// would go over budget returns a budget error value, and the run is
+// cancelled so the spell stops.
+func ApplyCallBudget(module string, attrs map[string]tengo.Object, budget *bridge.CallBudget) {
+	if budget == nil {
+		return
+	}
+	wrapFunctions(attrs, func(name string) bool {
+		return budget.Counts(module + "." + name)
+	}, func(name string, fn tengo.CallableFunc) tengo.CallableFunc {
+		return func(args ...tengo.Object) (tengo.Object, error) {
+			method := module + "." + name
+			if err := budget.SpendN(method, bridge.CallCost(method, tengoCallArgs(args))); err != nil {
+				return errorObject(err), nil
+			}
+			return fn(args...)
+		}
+	})
+}
+
+// tengoCallArgs are the arguments of a Tengo call, as bridge.CallCost
+// reads them
+type tengoCallArgs []tengo.Object
+
+// Len returns the length of argument i, if it is an array
+func (a tengoCallArgs) Len(i int) (int, bool) {
+	if i >= len(a) {
+		return 0, false
+	}
+	switch list := a[i].(type) {
+	case *tengo.Array:
+		return len(list.Value), true
+	case *tengo.ImmutableArray:
+		return len(list.Value), true
+	}
+	return 0, false
+}
+
+// Number returns field of argument i, if it is a map holding a number
+// there
+func (a tengoCallArgs) Number(i int, field string) (float64, bool) {
+	if i >= len(a) {
+		return 0, false
+	}
+	var value tengo.Object
+	switch m := a[i].(type) {
+	case *tengo.Map:
+		value = m.Value[field]
+	case *tengo.ImmutableMap:
+		value = m.Value[field]
+	}
+	switch n := value.(type) {
+	case *tengo.Int:
+		return float64(n.Value), true
+	case *tengo.Float:
+		return n.Value, true
+	}
+	return 0, false
+}
+
+// ApplyCallStats records each call to a module function in stats as
+// "module.function". A call counts as failed when it returns an error value
+// or raises a runtime error.
+func ApplyCallStats(module string, attrs map[string]tengo.Object, stats *bridge.CallStats) {
+	if stats == nil {
+		return
+	}
+	wrapFunctions(attrs, nil, func(name string, fn tengo.CallableFunc) tengo.CallableFunc {
+		return func(args ...tengo.Object) (tengo.Object, error) {
+			start := time.Now()
+			result, err := fn(args...)
+			_, failed := result.(*tengo.Error)
+			stats.Record(module+"."+name, failed || err != nil, time.Since(start))
+			return result, err
+		}
+	})
+}
+
+// ApplyProfile times each call to a module function with p as
+// "module.function"
+func ApplyProfile(module string, attrs map[string]tengo.Object, p *bridge.Profiler) {
+	if p == nil {
+		return
+	}
+	wrapFunctions(attrs, nil, func(name string, fn tengo.CallableFunc) tengo.CallableFunc {
+		return func(args ...tengo.Object) (tengo.Object, error) {
+			p.Begin(module + "." + name)
+			defer p.End()
+			return fn(args...)
+		}
+	})
+}
+
+// wrapFunctions replaces each Go function of a module that selected
+// accepts, or every one if selected is nil, with what wrap makes of it
+func wrapFunctions(attrs map[string]tengo.Object, selected func(name string) bool, wrap func(name string, fn tengo.CallableFunc) tengo.CallableFunc) {
+	for name, value := range attrs {
+		fn, ok := value.(*tengo.UserFunction)
+		if !ok || (selected != nil && !selected(name)) {
+			continue
+		}
+		attrs[name] = &tengo.UserFunction{Name: fn.Name, Value: wrap(name, fn.Value)}
+	}
+}
@@ -0,0 +1,185 @@
+// ABOUTME: Message catalogs for translating user-facing text
+// ABOUTME: Loads embedded locale files, applies override files, and falls back to English
+
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is used when no language is configured and for any
+// message a catalog lacks
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var embedded embed.FS
+
+// Catalog translates message IDs into one language
+type Catalog struct {
+	lang     string
+	messages map[string]string
+	fallback map[string]string
+}
+
+// New loads the catalog for a language. Messages come from the embedded
+// locale file, then from <lang>.json in each override directory in order,
+// so later files win. Unknown languages fall back to English entirely.
+func New(lang string, overrideDirs ...string) (*Catalog, error) {
+	lang = NormalizeLanguage(lang)
+
+	fallback, err := loadEmbedded(DefaultLanguage)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := loadEmbedded(lang)
+	if err != nil {
+		messages = make(map[string]string)
+	}
+
+	for _, dir := range overrideDirs {
+		if dir == "" {
+			continue
+		}
+		overrides, err := loadFile(filepath.Join(dir, lang+".json"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for id, text := range overrides {
+			messages[id] = text
+		}
+	}
+
+	return &Catalog{lang: lang, messages: messages, fallback: fallback}, nil
+}
+
+// Language returns the catalog's language code
+func (c *Catalog) Language() string {
+	return c.lang
+}
+
+// T returns the message for id, formatted with args like fmt.Sprintf.
+// Missing messages fall back to English, then to the ID itself.
+func (c *Catalog) T(id string, args ...interface{}) string {
+	text, ok := c.messages[id]
+	if !ok {
+		text, ok = c.fallback[id]
+	}
+	if !ok {
+		text = id
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// NormalizeLanguage reduces a locale such as "es_ES.UTF-8" to "es"
+func NormalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "_-."); i >= 0 {
+		lang = lang[:i]
+	}
+	if lang == "" || lang == "c" || lang == "posix" {
+		return DefaultLanguage
+	}
+	return lang
+}
+
+// DetectLanguage picks the language from an explicit choice (such as a
+// --lang flag), then LLMSPELL_LANG, then English
+func DetectLanguage(explicit string) string {
+	if explicit != "" {
+		return NormalizeLanguage(explicit)
+	}
+	if env := os.Getenv("LLMSPELL_LANG"); env != "" {
+		return NormalizeLanguage(env)
+	}
+	return DefaultLanguage
+}
+
+// Languages lists the languages with embedded catalogs
+func Languages() []string {
+	entries, _ := embedded.ReadDir("locales")
+	langs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		langs = append(langs, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return langs
+}
+
+func loadEmbedded(lang string) (map[string]string, error) {
+	data, err := embedded.ReadFile("locales/" + lang + ".json")
+	if err != nil {
+		return nil, err
+	}
+	return parseMessages(data, lang+".json")
+}
+
+func loadFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseMessages(data, path)
+}
+
+func parseMessages(data []byte, source string) (map[string]string, error) {
+	messages := make(map[string]string)
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, fmt.Errorf("invalid message catalog %s: %w", source, err)
+	}
+	return messages, nil
+}
+
+var (
+	defaultMu      sync.RWMutex
+	defaultCatalog *Catalog
+)
+
+// SetDefault sets the catalog used by the package-level T
+func SetDefault(c *Catalog) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultCatalog = c
+}
+
+// Default returns the catalog used by the package-level T, loading the
+// English catalog if none has been set
+func Default() *Catalog {
+	defaultMu.RLock()
+	c := defaultCatalog
+	defaultMu.RUnlock()
+	if c != nil {
+		return c
+	}
+
+	c, err := New(DefaultLanguage)
+	if err != nil {
+		// The embedded English catalog is part of the build
+		panic(err)
+	}
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultCatalog == nil {
+		defaultCatalog = c
+	}
+	return defaultCatalog
+}
+
+// T translates a message with the default catalog
+func T(id string, args ...interface{}) string {
+	return Default().T(id, args...)
+}
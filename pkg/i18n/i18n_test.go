@@ -0,0 +1,121 @@
+// ABOUTME: Tests for message catalogs
+// ABOUTME: Covers fallback to English, override files, and language detection
+
+package i18n
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestCatalogTranslate(t *testing.T) {
+	es, err := New("es_ES.UTF-8")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if es.Language() != "es" {
+		t.Errorf("Expected language es, got %s", es.Language())
+	}
+	if got := es.T("docs.column.type"); got != "Tipo" {
+		t.Errorf("Expected Tipo, got %q", got)
+	}
+	if got := es.T("docs.version", "1.2"); got != "Versión: 1.2" {
+		t.Errorf("Expected formatted message, got %q", got)
+	}
+	if got := es.T("no.such.message"); got != "no.such.message" {
+		t.Errorf("Expected unknown ID to be returned as-is, got %q", got)
+	}
+
+	unknown, err := New("xx")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if got := unknown.T("docs.column.type"); got != "Type" {
+		t.Errorf("Expected English fallback, got %q", got)
+	}
+}
+
+func TestCatalogOverrides(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+	writeCatalog(t, first, "fr", map[string]string{"docs.yes": "oui", "docs.no": "non"})
+	writeCatalog(t, second, "fr", map[string]string{"docs.no": "NON"})
+
+	c, err := New("fr", first, "", filepath.Join(first, "missing"), second)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if got := c.T("docs.yes"); got != "oui" {
+		t.Errorf("Expected override, got %q", got)
+	}
+	if got := c.T("docs.no"); got != "NON" {
+		t.Errorf("Expected later override to win, got %q", got)
+	}
+	if got := c.T("docs.column.type"); got != "Type" {
+		t.Errorf("Expected English fallback, got %q", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(first, "de.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New("de", first); err == nil {
+		t.Error("Expected error for invalid override file")
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	t.Setenv("LLMSPELL_LANG", "es-MX")
+
+	if got := DetectLanguage("fr"); got != "fr" {
+		t.Errorf("Expected explicit language to win, got %s", got)
+	}
+	if got := DetectLanguage(""); got != "es" {
+		t.Errorf("Expected LLMSPELL_LANG, got %s", got)
+	}
+
+	t.Setenv("LLMSPELL_LANG", "")
+	if got := DetectLanguage(""); got != DefaultLanguage {
+		t.Errorf("Expected default language, got %s", got)
+	}
+	if got := NormalizeLanguage("C"); got != DefaultLanguage {
+		t.Errorf("Expected C locale to map to default, got %s", got)
+	}
+}
+
+func TestEmbeddedCatalogsComplete(t *testing.T) {
+	en, err := loadEmbedded(DefaultLanguage)
+	if err != nil {
+		t.Fatalf("Failed to load English catalog: %v", err)
+	}
+
+	for _, lang := range Languages() {
+		messages, err := loadEmbedded(lang)
+		if err != nil {
+			t.Fatalf("Failed to load %s catalog: %v", lang, err)
+		}
+		var missing []string
+		for id := range en {
+			if _, ok := messages[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		sort.Strings(missing)
+		if len(missing) > 0 {
+			t.Errorf("%s catalog is missing %v", lang, missing)
+		}
+	}
+}
+
+func writeCatalog(t *testing.T, dir, lang string, messages map[string]string) {
+	t.Helper()
+	data, err := json.Marshal(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, lang+".json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
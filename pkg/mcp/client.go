@@ -0,0 +1,273 @@
+// ABOUTME: Client for the Model Context Protocol: initializes a session with a server and lists and calls its tools
+// ABOUTME: Also lists and reads the server's resources; messages travel over a stdio or HTTP Transport
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// ProtocolVersion is the MCP revision the client asks servers for
+const ProtocolVersion = "2025-03-26"
+
+// Request is a JSON-RPC request, or a notification when ID is nil
+type Request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int64      `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// Response is a JSON-RPC response
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+// Transport carries messages to a server. RoundTrip returns the response
+// to a request, and nil for a notification.
+type Transport interface {
+	RoundTrip(ctx context.Context, req *Request) (*Response, error)
+	Close() error
+}
+
+// ServerInfo is what a server says about itself when initialized
+type ServerInfo struct {
+	Name         string                 `json:"name"`
+	Version      string                 `json:"version"`
+	Protocol     string                 `json:"protocol"`
+	Instructions string                 `json:"instructions,omitempty"`
+	Capabilities map[string]interface{} `json:"capabilities,omitempty"`
+}
+
+// Tool is a tool a server offers
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// Content is an item of a tool result: text, or an image, audio, or
+// resource with its data
+type Content struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	Data     string          `json:"data,omitempty"`
+	MimeType string          `json:"mimeType,omitempty"`
+	Resource json.RawMessage `json:"resource,omitempty"`
+}
+
+// ToolResult is the outcome of a tool call. IsError marks a failure the
+// tool reported, as opposed to one of the protocol.
+type ToolResult struct {
+	Content           []Content   `json:"content"`
+	StructuredContent interface{} `json:"structuredContent,omitempty"`
+	IsError           bool        `json:"isError,omitempty"`
+}
+
+// Text joins the text items of the result
+func (r *ToolResult) Text() string {
+	var texts []string
+	for _, content := range r.Content {
+		if content.Type == "text" {
+			texts = append(texts, content.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Resource is a resource a server offers
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceContents is the content of a resource, as text or as base64
+// encoded binary data
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// Client speaks MCP with one server. Create it with Connect or NewClient
+// and Initialize. It is safe for concurrent use when its transport is.
+type Client struct {
+	transport Transport
+	nextID    atomic.Int64
+	info      ServerInfo
+}
+
+// NewClient uses transport, which must be initialized before other calls
+func NewClient(transport Transport) *Client {
+	return &Client{transport: transport}
+}
+
+// Connect starts a session with the server config describes
+func Connect(ctx context.Context, config ServerConfig) (*Client, error) {
+	transport, err := NewTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	client := NewClient(transport)
+	if err := client.Initialize(ctx); err != nil {
+		transport.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// Initialize negotiates the session and tells the server it is ready
+func (c *Client) Initialize(ctx context.Context) error {
+	var result struct {
+		ProtocolVersion string                 `json:"protocolVersion"`
+		Capabilities    map[string]interface{} `json:"capabilities"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+		Instructions string `json:"instructions"`
+	}
+	err := c.call(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]interface{}{"name": "llmspell", "version": "0.1.0"},
+	}, &result)
+	if err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+	c.info = ServerInfo{
+		Name:         result.ServerInfo.Name,
+		Version:      result.ServerInfo.Version,
+		Protocol:     result.ProtocolVersion,
+		Instructions: result.Instructions,
+		Capabilities: result.Capabilities,
+	}
+	_, err = c.transport.RoundTrip(ctx, &Request{JSONRPC: "2.0", Method: "notifications/initialized"})
+	return err
+}
+
+// Info returns what the server said about itself when initialized
+func (c *Client) Info() ServerInfo {
+	return c.info
+}
+
+// ListTools returns every tool of the server, following pages
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	err := c.paginate(ctx, "tools/list", func(page json.RawMessage) (string, error) {
+		var result struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		err := json.Unmarshal(page, &result)
+		tools = append(tools, result.Tools...)
+		return result.NextCursor, err
+	})
+	return tools, err
+}
+
+// CallTool calls the tool name with args
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (*ToolResult, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	var result ToolResult
+	if err := c.call(ctx, "tools/call", map[string]interface{}{"name": name, "arguments": args}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListResources returns every resource of the server, following pages
+func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
+	var resources []Resource
+	err := c.paginate(ctx, "resources/list", func(page json.RawMessage) (string, error) {
+		var result struct {
+			Resources  []Resource `json:"resources"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		err := json.Unmarshal(page, &result)
+		resources = append(resources, result.Resources...)
+		return result.NextCursor, err
+	})
+	return resources, err
+}
+
+// ReadResource returns the contents of the resource at uri
+func (c *Client) ReadResource(ctx context.Context, uri string) ([]ResourceContents, error) {
+	var result struct {
+		Contents []ResourceContents `json:"contents"`
+	}
+	if err := c.call(ctx, "resources/read", map[string]interface{}{"uri": uri}, &result); err != nil {
+		return nil, err
+	}
+	return result.Contents, nil
+}
+
+// Close ends the session
+func (c *Client) Close() error {
+	return c.transport.Close()
+}
+
+// paginate calls a list method until read returns no cursor
+func (c *Client) paginate(ctx context.Context, method string, read func(json.RawMessage) (string, error)) error {
+	cursor := ""
+	for {
+		var params interface{}
+		if cursor != "" {
+			params = map[string]interface{}{"cursor": cursor}
+		}
+		var page json.RawMessage
+		if err := c.call(ctx, method, params, &page); err != nil {
+			return err
+		}
+		next, err := read(page)
+		if err != nil {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+		if next == "" || next == cursor {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// call sends a request and decodes its result into out
+func (c *Client) call(ctx context.Context, method string, params, out interface{}) error {
+	id := c.nextID.Add(1)
+	resp, err := c.transport.RoundTrip(ctx, &Request{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return fmt.Errorf("%s: no response", method)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, out)
+}
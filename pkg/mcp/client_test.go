@@ -0,0 +1,218 @@
+// ABOUTME: Tests for the MCP client over its stdio and HTTP transports
+// ABOUTME: A fake server answers initialize, paged tool and resource listings, and tool calls
+
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeServer answers requests the way an MCP server would
+type fakeServer struct {
+	initialized bool
+}
+
+// handle returns the result of a request, or an error
+func (s *fakeServer) handle(method string, params json.RawMessage) (interface{}, *Error) {
+	var p struct {
+		Cursor    string                 `json:"cursor"`
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+		URI       string                 `json:"uri"`
+	}
+	json.Unmarshal(params, &p)
+
+	switch method {
+	case "initialize":
+		return map[string]interface{}{
+			"protocolVersion": ProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": "fake", "version": "1.2.3"},
+		}, nil
+	case "tools/list":
+		if p.Cursor == "" {
+			return map[string]interface{}{
+				"tools":      []interface{}{map[string]interface{}{"name": "echo", "description": "Echo text", "inputSchema": map[string]interface{}{"type": "object"}}},
+				"nextCursor": "2",
+			}, nil
+		}
+		return map[string]interface{}{"tools": []interface{}{map[string]interface{}{"name": "fail", "inputSchema": map[string]interface{}{"type": "object"}}}}, nil
+	case "tools/call":
+		if p.Name == "fail" {
+			return map[string]interface{}{"content": []interface{}{map[string]interface{}{"type": "text", "text": "it failed"}}, "isError": true}, nil
+		}
+		if p.Name != "echo" {
+			return nil, &Error{Code: -32602, Message: "unknown tool " + p.Name}
+		}
+		return map[string]interface{}{"content": []interface{}{
+			map[string]interface{}{"type": "text", "text": fmt.Sprint(p.Arguments["text"])},
+			map[string]interface{}{"type": "text", "text": fmt.Sprint(s.initialized)},
+		}}, nil
+	case "resources/list":
+		return map[string]interface{}{"resources": []interface{}{map[string]interface{}{"uri": "file:///readme", "name": "readme", "mimeType": "text/plain"}}}, nil
+	case "resources/read":
+		return map[string]interface{}{"contents": []interface{}{map[string]interface{}{"uri": p.URI, "text": "hello"}}}, nil
+	}
+	return nil, &Error{Code: -32601, Message: "method not found"}
+}
+
+// serveStdio answers requests read from r on w, asking the client for a
+// ping before each response
+func (s *fakeServer) serveStdio(r io.Reader, w io.Writer) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		json.Unmarshal(scanner.Bytes(), &msg)
+		if msg.Method == "notifications/initialized" {
+			s.initialized = true
+		}
+		if msg.Method == "" || len(msg.ID) == 0 {
+			continue
+		}
+		fmt.Fprintln(w, `{"jsonrpc":"2.0","method":"notifications/message","params":{}}`)
+		fmt.Fprintln(w, `{"jsonrpc":"2.0","id":"server-1","method":"ping"}`)
+		result, rpcErr := s.handle(msg.Method, msg.Params)
+		data, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": result, "error": rpcErr})
+		fmt.Fprintln(w, strings.ReplaceAll(string(data), `,"error":null`, ""))
+	}
+}
+
+// serveHTTP answers requests posted to it, streaming the responses to tool
+// calls as events
+func (s *fakeServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		return
+	}
+	var msg struct {
+		ID     *int64          `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&msg)
+	if msg.Method == "initialize" {
+		w.Header().Set("Mcp-Session-Id", "session-1")
+	} else if r.Header.Get("Mcp-Session-Id") != "session-1" {
+		http.Error(w, "missing session", http.StatusBadRequest)
+		return
+	}
+	if msg.ID == nil {
+		s.initialized = msg.Method == "notifications/initialized"
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	result, rpcErr := s.handle(msg.Method, msg.Params)
+	response := Response{JSONRPC: "2.0", ID: msg.ID, Error: rpcErr}
+	response.Result, _ = json.Marshal(result)
+	data, _ := json.Marshal(response)
+	if msg.Method == "tools/call" {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func TestClient(t *testing.T) {
+	transports := map[string]func(t *testing.T) Transport{
+		"stdio": func(t *testing.T) Transport {
+			clientR, serverW := io.Pipe()
+			serverR, clientW := io.Pipe()
+			go (&fakeServer{}).serveStdio(serverR, serverW)
+			return NewStdioTransport(clientR, clientW, func() error { return serverW.Close() })
+		},
+		"http": func(t *testing.T) Transport {
+			server := httptest.NewServer(http.HandlerFunc((&fakeServer{}).serveHTTP))
+			t.Cleanup(server.Close)
+			return NewHTTPTransport(server.URL, map[string]string{"Authorization": "Bearer token"}, nil)
+		},
+	}
+
+	for name, newTransport := range transports {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewClient(newTransport(t))
+			defer client.Close()
+
+			if err := client.Initialize(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if info := client.Info(); info.Name != "fake" || info.Version != "1.2.3" || info.Protocol != ProtocolVersion {
+				t.Errorf("Info() = %+v", info)
+			}
+
+			tools, err := client.ListTools(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tools) != 2 || tools[0].Name != "echo" || tools[1].Name != "fail" || string(tools[0].InputSchema) != `{"type":"object"}` {
+				t.Errorf("ListTools() = %+v", tools)
+			}
+
+			result, err := client.CallTool(ctx, "echo", map[string]interface{}{"text": "hi"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.IsError || result.Text() != "hi\ntrue" {
+				t.Errorf("Expected the echo after the initialized notification, got %+v", result)
+			}
+			if result, err := client.CallTool(ctx, "fail", nil); err != nil || !result.IsError || result.Text() != "it failed" {
+				t.Errorf("CallTool(fail) = %+v, %v", result, err)
+			}
+			if _, err := client.CallTool(ctx, "missing", nil); err == nil || !strings.Contains(err.Error(), "unknown tool missing") {
+				t.Errorf("Expected a protocol error, got %v", err)
+			}
+
+			resources, err := client.ListResources(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(resources, []Resource{{URI: "file:///readme", Name: "readme", MimeType: "text/plain"}}) {
+				t.Errorf("ListResources() = %+v", resources)
+			}
+			contents, err := client.ReadResource(ctx, "file:///readme")
+			if err != nil || len(contents) != 1 || contents[0].Text != "hello" {
+				t.Errorf("ReadResource() = %+v, %v", contents, err)
+			}
+		})
+	}
+}
+
+func TestStdioTransportServerExit(t *testing.T) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	transport := NewStdioTransport(clientR, clientW, nil)
+	serverW.Close()
+	serverR.Close()
+
+	id := int64(1)
+	if _, err := transport.RoundTrip(context.Background(), &Request{JSONRPC: "2.0", ID: &id, Method: "tools/list"}); err == nil {
+		t.Error("Expected an error once the server is gone")
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	for _, config := range []ServerConfig{{}, {Command: "server", URL: "http://localhost"}} {
+		if _, err := NewTransport(config); err == nil {
+			t.Errorf("Expected %+v to be refused", config)
+		}
+	}
+	if _, err := Connect(context.Background(), ServerConfig{Command: "llmspell-no-such-server"}); err == nil {
+		t.Error("Expected a missing command to fail")
+	}
+}
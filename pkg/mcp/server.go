@@ -0,0 +1,228 @@
+// ABOUTME: MCP server: offers tools to MCP hosts over newline-delimited JSON-RPC, as a stdio server does
+// ABOUTME: Requests are answered concurrently; a cancellation notification cancels the call it names
+
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// supportedVersions are the MCP revisions the server can speak. Its
+// features, tools without list changes, are the same in each.
+var supportedVersions = map[string]bool{"2024-11-05": true, ProtocolVersion: true, "2025-06-18": true}
+
+// ToolHandler runs a call of a served tool. An error is reported to the
+// host as a failed tool result, which the model can read.
+type ToolHandler func(ctx context.Context, arguments map[string]interface{}) (*ToolResult, error)
+
+// Server offers tools to MCP hosts. Add tools with AddTool, then Serve.
+type Server struct {
+	name, version string
+
+	mu       sync.Mutex
+	tools    map[string]Tool
+	handlers map[string]ToolHandler
+}
+
+// NewServer creates a server that introduces itself as name and version
+func NewServer(name, version string) *Server {
+	return &Server{
+		name:     name,
+		version:  version,
+		tools:    make(map[string]Tool),
+		handlers: make(map[string]ToolHandler),
+	}
+}
+
+// AddTool offers tool, running its calls with handler. A tool added again
+// under the same name replaces the first.
+func (s *Server) AddTool(tool Tool, handler ToolHandler) {
+	if len(tool.InputSchema) == 0 {
+		tool.InputSchema = json.RawMessage(`{"type":"object"}`)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tools[tool.Name] = tool
+	s.handlers[tool.Name] = handler
+}
+
+// Tools lists the offered tools, sorted by name
+func (s *Server) Tools() []Tool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]Tool, 0, len(s.tools))
+	for _, tool := range s.tools {
+		result = append(result, tool)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// message is a request, notification, or response read from a host
+type message struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// reply is the server's response to a request
+type reply struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Serve answers the messages read from r, one per line, writing responses
+// to w. It returns once r ends or ctx is done, after the calls in progress
+// have been cancelled and answered.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		writeMu  sync.Mutex
+		wg       sync.WaitGroup
+		callsMu  sync.Mutex
+		inFlight = make(map[string]context.CancelFunc)
+	)
+	defer wg.Wait()
+
+	send := func(msg reply) {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			data, _ = json.Marshal(reply{JSONRPC: "2.0", ID: msg.ID, Error: &Error{Code: -32603, Message: err.Error()}})
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		w.Write(append(data, '\n'))
+	}
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		var line []byte
+		select {
+		case line = <-lines:
+		case err := <-readErr:
+			cancel()
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			send(reply{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: -32700, Message: "parse error: " + err.Error()}})
+			continue
+		}
+		switch {
+		case msg.Method == "":
+			// A response to a request of ours; the server sends none
+		case len(msg.ID) == 0 || string(msg.ID) == "null":
+			if msg.Method == "notifications/cancelled" {
+				var params struct {
+					RequestID json.RawMessage `json:"requestId"`
+				}
+				json.Unmarshal(msg.Params, &params)
+				callsMu.Lock()
+				if cancelCall, ok := inFlight[string(params.RequestID)]; ok {
+					cancelCall()
+				}
+				callsMu.Unlock()
+			}
+		default:
+			callCtx, cancelCall := context.WithCancel(ctx)
+			key := string(msg.ID)
+			callsMu.Lock()
+			inFlight[key] = cancelCall
+			callsMu.Unlock()
+
+			wg.Add(1)
+			go func(msg message) {
+				defer wg.Done()
+				result, rpcErr := s.handle(callCtx, msg.Method, msg.Params)
+				callsMu.Lock()
+				delete(inFlight, key)
+				callsMu.Unlock()
+				cancelCall()
+				send(reply{JSONRPC: "2.0", ID: msg.ID, Result: result, Error: rpcErr})
+			}(msg)
+		}
+	}
+}
+
+// handle answers a request
+func (s *Server) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, *Error) {
+	switch method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(params, &p)
+		version := ProtocolVersion
+		if supportedVersions[p.ProtocolVersion] {
+			version = p.ProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": s.name, "version": s.version},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": s.Tools()}, nil
+	case "tools/call":
+		var p struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &Error{Code: -32602, Message: "invalid params: " + err.Error()}
+		}
+		s.mu.Lock()
+		handler, ok := s.handlers[p.Name]
+		s.mu.Unlock()
+		if !ok {
+			return nil, &Error{Code: -32602, Message: fmt.Sprintf("unknown tool %q", p.Name)}
+		}
+		if p.Arguments == nil {
+			p.Arguments = map[string]interface{}{}
+		}
+
+		result, err := handler(ctx, p.Arguments)
+		if err != nil {
+			return &ToolResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+		}
+		if result.Content == nil {
+			result.Content = []Content{}
+		}
+		return result, nil
+	}
+	return nil, &Error{Code: -32601, Message: fmt.Sprintf("method %q not found", method)}
+}
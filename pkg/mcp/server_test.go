@@ -0,0 +1,128 @@
+// ABOUTME: Tests for the MCP server, driven by the client over pipes and by raw messages
+// ABOUTME: Covers initializing, listing and calling tools, failed and unknown tools, and cancellation
+
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer offers an echo tool, a tool that fails, and one that waits
+// until it is cancelled
+func newTestServer() *Server {
+	server := NewServer("llmspell", "0.1.0")
+	server.AddTool(Tool{Name: "echo", Description: "Echo text", InputSchema: json.RawMessage(`{"type":"object","properties":{"text":{"type":"string"}}}`)},
+		func(ctx context.Context, arguments map[string]interface{}) (*ToolResult, error) {
+			return &ToolResult{Content: []Content{{Type: "text", Text: fmt.Sprint(arguments["text"])}}}, nil
+		})
+	server.AddTool(Tool{Name: "fail"}, func(ctx context.Context, arguments map[string]interface{}) (*ToolResult, error) {
+		return nil, errors.New("it failed")
+	})
+	server.AddTool(Tool{Name: "wait"}, func(ctx context.Context, arguments map[string]interface{}) (*ToolResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	return server
+}
+
+func TestServer(t *testing.T) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- newTestServer().Serve(context.Background(), serverR, serverW)
+		serverW.Close()
+	}()
+
+	ctx := context.Background()
+	client := NewClient(NewStdioTransport(clientR, clientW, func() error { return clientW.Close() }))
+	if err := client.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if info := client.Info(); info.Name != "llmspell" || info.Version != "0.1.0" || info.Protocol != ProtocolVersion {
+		t.Errorf("Info() = %+v", info)
+	}
+
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools) != 3 || tools[0].Name != "echo" || tools[1].Name != "fail" || string(tools[1].InputSchema) != `{"type":"object"}` {
+		t.Errorf("ListTools() = %+v", tools)
+	}
+
+	if result, err := client.CallTool(ctx, "echo", map[string]interface{}{"text": "hi"}); err != nil || result.IsError || result.Text() != "hi" {
+		t.Errorf("CallTool(echo) = %+v, %v", result, err)
+	}
+	if result, err := client.CallTool(ctx, "fail", nil); err != nil || !result.IsError || result.Text() != "it failed" {
+		t.Errorf("Expected a failed result, got %+v, %v", result, err)
+	}
+	if _, err := client.CallTool(ctx, "missing", nil); err == nil || !strings.Contains(err.Error(), "unknown tool") {
+		t.Errorf("Expected an unknown tool to be a protocol error, got %v", err)
+	}
+	if _, err := client.ListResources(ctx); err == nil {
+		t.Error("Expected resources to be unsupported")
+	}
+
+	client.Close()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return when its input ended")
+	}
+}
+
+func TestServerMessages(t *testing.T) {
+	serverR, clientW := io.Pipe()
+	clientR, serverW := io.Pipe()
+	go newTestServer().Serve(context.Background(), serverR, serverW)
+	defer clientW.Close()
+
+	replies := bufio.NewScanner(clientR)
+	exchange := func(line string) map[string]interface{} {
+		t.Helper()
+		if _, err := io.WriteString(clientW, line+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		if !replies.Scan() {
+			t.Fatal("no reply")
+		}
+		var msg map[string]interface{}
+		json.Unmarshal(replies.Bytes(), &msg)
+		return msg
+	}
+
+	reply := exchange(`{"jsonrpc":"2.0","id":"a","method":"initialize","params":{"protocolVersion":"2024-11-05"}}`)
+	if result, _ := reply["result"].(map[string]interface{}); reply["id"] != "a" || result["protocolVersion"] != "2024-11-05" {
+		t.Errorf("Expected the host's revision, got %v", reply)
+	}
+	if reply := exchange(`{not json`); reply["error"] == nil || reply["id"] != nil {
+		t.Errorf("Expected a parse error, got %v", reply)
+	}
+	if reply := exchange(`{"jsonrpc":"2.0","id":2,"method":"resources/list"}`); reply["error"].(map[string]interface{})["code"] != float64(-32601) {
+		t.Errorf("Expected an unknown method, got %v", reply)
+	}
+
+	// A cancelled call is answered as a failure
+	io.WriteString(clientW, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"wait"}}`+"\n")
+	reply = exchange(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":3}}` + "\n" + `{"jsonrpc":"2.0","id":4,"method":"ping"}`)
+	if reply["id"] == float64(4) {
+		// The ping may be answered first
+		replies.Scan()
+		json.Unmarshal(replies.Bytes(), &reply)
+	}
+	if result, _ := reply["result"].(map[string]interface{}); reply["id"] != float64(3) || result["isError"] != true {
+		t.Errorf("Expected the cancelled call to fail, got %v", reply)
+	}
+}
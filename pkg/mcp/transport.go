@@ -0,0 +1,367 @@
+// ABOUTME: MCP transports: newline-delimited JSON-RPC over a server process's stdio, and streamable HTTP
+// ABOUTME: The stdio transport matches responses to requests by ID; the HTTP one reads JSON or event-stream replies
+
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxMessageSize bounds a message read from a server or a host
+const maxMessageSize = 16 << 20
+
+// ServerConfig says how to reach a server: by starting Command, which
+// speaks over its stdin and stdout, or at URL
+type ServerConfig struct {
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Client posts to a server at a URL; nil uses http.DefaultClient
+	Client *http.Client `json:"-"`
+}
+
+// NewTransport starts the transport config describes
+func NewTransport(config ServerConfig) (Transport, error) {
+	switch {
+	case config.Command != "" && config.URL != "":
+		return nil, fmt.Errorf("a server has a command or a url, not both")
+	case config.Command != "":
+		return StartStdio(config)
+	case config.URL != "":
+		return NewHTTPTransport(config.URL, config.Headers, config.Client), nil
+	}
+	return nil, fmt.Errorf("a server needs a command or a url")
+}
+
+// StdioTransport exchanges messages with a server over a pair of streams,
+// usually the stdin and stdout of a process it started
+type StdioTransport struct {
+	w      io.WriteCloser
+	writeM sync.Mutex
+	stop   func() error
+
+	mu      sync.Mutex
+	pending map[int64]chan *Response
+	err     error
+	done    chan struct{}
+}
+
+// StartStdio starts config.Command with config.Args, adding config.Env to
+// the environment. The server's stderr is discarded.
+func StartStdio(config ServerConfig) (*StdioTransport, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Env = os.Environ()
+	for key, value := range config.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", config.Command, err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	// Servers exit when their input closes; those that do not are killed
+	stop := func() error {
+		select {
+		case <-exited:
+		case <-time.After(2 * time.Second):
+			cmd.Process.Kill()
+			<-exited
+		}
+		return nil
+	}
+	return NewStdioTransport(stdout, stdin, stop), nil
+}
+
+// NewStdioTransport reads messages from r and writes them to w. Close
+// closes w, then calls stop when it is not nil.
+func NewStdioTransport(r io.Reader, w io.WriteCloser, stop func() error) *StdioTransport {
+	t := &StdioTransport{
+		w:       w,
+		stop:    stop,
+		pending: make(map[int64]chan *Response),
+		done:    make(chan struct{}),
+	}
+	go t.read(r)
+	return t
+}
+
+// incoming is any message from a server: a response, a request, or a
+// notification
+type incoming struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Response
+}
+
+// read dispatches messages until r ends
+func (t *StdioTransport) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		var msg incoming
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Method != "" {
+			if len(msg.ID) > 0 {
+				// Answered aside, so a server waiting for us to read cannot
+				// stall the reply
+				go t.answer(msg)
+			}
+			continue
+		}
+		var id int64
+		if json.Unmarshal(msg.ID, &id) != nil {
+			continue
+		}
+		t.mu.Lock()
+		ch, ok := t.pending[id]
+		delete(t.pending, id)
+		t.mu.Unlock()
+		if ok {
+			response := msg.Response
+			ch <- &response
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = errors.New("the server closed the connection")
+	}
+	t.mu.Lock()
+	t.err = err
+	t.mu.Unlock()
+	close(t.done)
+}
+
+// answer replies to a request from the server: pings succeed, and other
+// requests are not supported
+func (t *StdioTransport) answer(msg incoming) {
+	reply := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID}
+	if msg.Method == "ping" {
+		reply["result"] = map[string]interface{}{}
+	} else {
+		reply["error"] = &Error{Code: -32601, Message: "method not supported by the client: " + msg.Method}
+	}
+	t.write(reply)
+}
+
+// write sends a message on a line of its own
+func (t *StdioTransport) write(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.writeM.Lock()
+	defer t.writeM.Unlock()
+	_, err = t.w.Write(append(data, '\n'))
+	return err
+}
+
+// RoundTrip sends req and waits for its response
+func (t *StdioTransport) RoundTrip(ctx context.Context, req *Request) (*Response, error) {
+	if req.ID == nil {
+		return nil, t.write(req)
+	}
+
+	ch := make(chan *Response, 1)
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return nil, t.err
+	}
+	t.pending[*req.ID] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, *req.ID)
+		t.mu.Unlock()
+	}()
+
+	if err := t.write(req); err != nil {
+		return nil, fmt.Errorf("%s: %w", req.Method, err)
+	}
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-t.done:
+		return nil, fmt.Errorf("%s: %w", req.Method, t.err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the server's input and stops it
+func (t *StdioTransport) Close() error {
+	err := t.w.Close()
+	if t.stop != nil {
+		t.stop()
+	}
+	return err
+}
+
+// HTTPTransport posts messages to a server's endpoint, keeping the session
+// ID the server assigns
+type HTTPTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu      sync.Mutex
+	session string
+}
+
+// NewHTTPTransport posts to url with headers, such as Authorization, using
+// client, or http.DefaultClient when it is nil
+func NewHTTPTransport(url string, headers map[string]string, client *http.Client) *HTTPTransport {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPTransport{url: url, headers: headers, client: client}
+}
+
+// RoundTrip posts req and reads the response from the reply, which is JSON
+// or a stream of events
+func (t *HTTPTransport) RoundTrip(ctx context.Context, req *Request) (*Response, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := t.request(ctx, http.MethodPost, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", req.Method, err)
+	}
+	defer resp.Body.Close()
+
+	if session := resp.Header.Get("Mcp-Session-Id"); session != "" {
+		t.mu.Lock()
+		t.session = session
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s: status %d: %s", req.Method, resp.StatusCode, bytes.TrimSpace(body))
+	}
+	if req.ID == nil {
+		return nil, nil
+	}
+
+	body := io.LimitReader(resp.Body, maxMessageSize)
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return readEvents(body, *req.ID, req.Method)
+	}
+	var response Response
+	if err := json.NewDecoder(body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%s: %w", req.Method, err)
+	}
+	return &response, nil
+}
+
+// readEvents reads server-sent events until the response with id
+func readEvents(r io.Reader, id int64, method string) (*Response, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	var data strings.Builder
+	// event returns the response the event's data holds, if it is the one
+	event := func() *Response {
+		defer data.Reset()
+		var response Response
+		if json.Unmarshal([]byte(data.String()), &response) == nil && response.ID != nil && *response.ID == id {
+			return &response
+		}
+		return nil
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(value, " "))
+		} else if line == "" && data.Len() > 0 {
+			if response := event(); response != nil {
+				return response, nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", method, err)
+	}
+	if response := event(); response != nil {
+		return response, nil
+	}
+	return nil, fmt.Errorf("%s: the event stream ended without a response", method)
+}
+
+// request builds a request to the endpoint carrying the configured headers
+// and the session ID
+func (t *HTTPTransport) request(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	t.mu.Lock()
+	if t.session != "" {
+		req.Header.Set("Mcp-Session-Id", t.session)
+	}
+	t.mu.Unlock()
+	return req, nil
+}
+
+// Close ends the session on the server, if it assigned one
+func (t *HTTPTransport) Close() error {
+	t.mu.Lock()
+	session := t.session
+	t.mu.Unlock()
+	if session == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := t.request(ctx, http.MethodDelete, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,120 @@
+// ABOUTME: Confirmation of destructive tools before they run, by asking the user or by the profile's policy
+// ABOUTME: A tool the user allows for the rest of the run is not asked about again
+
+package security
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNotConfirmed is returned when a tool that requires confirmation was
+// not confirmed
+var ErrNotConfirmed = errors.New("not confirmed")
+
+// Confirmation modes
+const (
+	// ConfirmPrompt asks the user, and refuses the call when there is no
+	// one to ask
+	ConfirmPrompt = "prompt"
+	// ConfirmAllow runs tools without asking
+	ConfirmAllow = "allow"
+	// ConfirmDeny refuses every call that requires confirmation
+	ConfirmDeny = "deny"
+)
+
+// ConfirmationPolicy decides what happens when a spell calls a tool that
+// requires confirmation, such as one that runs commands or writes files
+type ConfirmationPolicy struct {
+	// Mode is ConfirmPrompt, ConfirmAllow, or ConfirmDeny; empty prompts
+	Mode string `json:"mode,omitempty"`
+
+	// Allow names tools that run without confirmation even though they
+	// require it
+	Allow []string `json:"allow,omitempty"`
+
+	// Require names tools that require confirmation even though they do
+	// not say so
+	Require []string `json:"require,omitempty"`
+}
+
+// Requires reports whether a call to tool needs confirmation; declared
+// says whether the tool requires it itself
+func (p ConfirmationPolicy) Requires(tool string, declared bool) bool {
+	if matchAny(p.Allow, tool) {
+		return false
+	}
+	return declared || matchAny(p.Require, tool)
+}
+
+// Answer is the user's reply to a confirmation prompt
+type Answer int
+
+// Answers to a confirmation prompt
+const (
+	// AnswerNo refuses the call
+	AnswerNo Answer = iota
+	// AnswerYes allows this call
+	AnswerYes
+	// AnswerAlways allows this call and later calls to the same tool
+	AnswerAlways
+)
+
+// Prompter asks the user whether a tool may run with params
+type Prompter func(ctx context.Context, tool string, params map[string]interface{}) (Answer, error)
+
+// ToolConfirmer applies a ConfirmationPolicy over one spell run. Prompts
+// are asked one at a time. It is safe for concurrent use, and a nil
+// confirmer allows every call.
+type ToolConfirmer struct {
+	policy ConfirmationPolicy
+	prompt Prompter
+
+	// mu serializes prompts and guards always
+	mu     sync.Mutex
+	always map[string]bool
+}
+
+// NewToolConfirmer creates a confirmer that asks prompt when the policy
+// says to; a nil prompt means there is no one to ask
+func NewToolConfirmer(policy ConfirmationPolicy, prompt Prompter) *ToolConfirmer {
+	return &ToolConfirmer{policy: policy, prompt: prompt, always: make(map[string]bool)}
+}
+
+// Confirm returns nil when a call to tool may go ahead, or an error
+// wrapping ErrNotConfirmed. declared says whether the tool requires
+// confirmation itself.
+func (c *ToolConfirmer) Confirm(ctx context.Context, tool string, declared bool, params map[string]interface{}) error {
+	if c == nil || !c.policy.Requires(tool, declared) {
+		return nil
+	}
+	switch c.policy.Mode {
+	case ConfirmAllow:
+		return nil
+	case ConfirmDeny:
+		return fmt.Errorf("%w: %s requires confirmation, which the security profile refuses", ErrNotConfirmed, tool)
+	}
+	if c.prompt == nil {
+		return fmt.Errorf("%w: %s requires confirmation and there is no terminal to ask", ErrNotConfirmed, tool)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.always[tool] {
+		return nil
+	}
+	answer, err := c.prompt(ctx, tool, params)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrNotConfirmed, tool, err)
+	}
+	switch answer {
+	case AnswerAlways:
+		c.always[tool] = true
+		return nil
+	case AnswerYes:
+		return nil
+	}
+	return fmt.Errorf("%w: the user declined to run %s", ErrNotConfirmed, tool)
+}
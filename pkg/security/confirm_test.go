@@ -0,0 +1,77 @@
+// ABOUTME: Tests for confirming destructive tools before they run
+// ABOUTME: Validates policy modes, allow and require patterns, remembered answers, and nil confirmers
+
+package security
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestToolConfirmer(t *testing.T) {
+	ctx := context.Background()
+	var asked []string
+	answers := map[string]Answer{"file_write": AnswerYes, "execute_command": AnswerAlways}
+	prompt := func(_ context.Context, tool string, _ map[string]interface{}) (Answer, error) {
+		asked = append(asked, tool)
+		return answers[tool], nil
+	}
+	c := NewToolConfirmer(ConfirmationPolicy{Allow: []string{"file_write_tmp"}, Require: []string{"db_*"}}, prompt)
+
+	if err := c.Confirm(ctx, "web_fetch", false, nil); err != nil {
+		t.Errorf("A tool that does not require confirmation should run: %v", err)
+	}
+	if err := c.Confirm(ctx, "file_write_tmp", true, nil); err != nil {
+		t.Errorf("An allowed tool should run without asking: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.Confirm(ctx, "file_write", true, nil); err != nil {
+			t.Errorf("Expected the user to confirm: %v", err)
+		}
+		if err := c.Confirm(ctx, "execute_command", true, nil); err != nil {
+			t.Errorf("Expected the user to confirm: %v", err)
+		}
+	}
+	if err := c.Confirm(ctx, "db_drop", false, nil); !errors.Is(err, ErrNotConfirmed) {
+		t.Errorf("Expected a tool the policy requires confirmation for to be declined, got %v", err)
+	}
+	want := []string{"file_write", "execute_command", "file_write", "db_drop"}
+	if len(asked) != len(want) {
+		t.Fatalf("Expected prompts %v, got %v", want, asked)
+	}
+	for i := range want {
+		if asked[i] != want[i] {
+			t.Errorf("Expected prompts %v, got %v", want, asked)
+		}
+	}
+
+	failing := NewToolConfirmer(ConfirmationPolicy{}, func(context.Context, string, map[string]interface{}) (Answer, error) {
+		return AnswerNo, context.Canceled
+	})
+	if err := failing.Confirm(ctx, "file_write", true, nil); !errors.Is(err, ErrNotConfirmed) || !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a failed prompt to decline, got %v", err)
+	}
+}
+
+func TestToolConfirmerModes(t *testing.T) {
+	ctx := context.Background()
+	prompt := func(context.Context, string, map[string]interface{}) (Answer, error) {
+		t.Error("The policy should decide without asking")
+		return AnswerYes, nil
+	}
+	if err := NewToolConfirmer(ConfirmationPolicy{Mode: ConfirmAllow}, prompt).Confirm(ctx, "file_write", true, nil); err != nil {
+		t.Errorf("Expected allow to run the tool: %v", err)
+	}
+	if err := NewToolConfirmer(ConfirmationPolicy{Mode: ConfirmDeny}, prompt).Confirm(ctx, "file_write", true, nil); !errors.Is(err, ErrNotConfirmed) {
+		t.Errorf("Expected deny to refuse the tool, got %v", err)
+	}
+	if err := NewToolConfirmer(ConfirmationPolicy{}, nil).Confirm(ctx, "file_write", true, nil); !errors.Is(err, ErrNotConfirmed) {
+		t.Errorf("Expected a prompt without a terminal to refuse the tool, got %v", err)
+	}
+
+	var c *ToolConfirmer
+	if err := c.Confirm(ctx, "file_write", true, nil); err != nil {
+		t.Errorf("A nil confirmer should allow every call: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+// ABOUTME: External commands the exec module may run, with argument templates, timeouts, and resource limits
+// ABOUTME: Only allowlisted commands run, directly and without a shell; each template fills exactly one argument
+
+package security
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Defaults for commands whose policy leaves them out
+const (
+	DefaultExecTimeout   = 30 * time.Second
+	DefaultExecMaxOutput = 1 << 20
+)
+
+// execNamePattern matches command and parameter names
+var execNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// execParamPattern matches {{name}} placeholders in argument templates
+var execParamPattern = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+// ExecPolicy lists the external commands spells may run with the exec
+// module, which also needs PermissionExec. A spell names a command and
+// gives values for its parameters; it cannot choose the program or add
+// arguments.
+type ExecPolicy struct {
+	// Commands are the commands spells may run, by the name they use
+	Commands map[string]ExecCommand `json:"commands,omitempty"`
+
+	// Timeout bounds a command that sets no timeout of its own; zero means
+	// DefaultExecTimeout
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// MaxOutput caps the bytes kept of each of stdout and stderr; zero
+	// means DefaultExecMaxOutput
+	MaxOutput int64 `json:"max_output,omitempty"`
+
+	// Limits restrict the resources of every command
+	Limits ExecLimits `json:"limits,omitempty"`
+}
+
+// ExecCommand is a command spells may run. Args are templates in which
+// {{name}} stands for the value of the parameter name. However a value
+// reads, it stays inside its argument: there is no shell, and a value may
+// not start an argument with "-", so it cannot pass an option.
+type ExecCommand struct {
+	// Path is the program: an absolute path, or a name looked up in PATH
+	Path string `json:"path"`
+
+	Args []string `json:"args,omitempty"`
+
+	// Description tells spell authors what the command does
+	Description string `json:"description,omitempty"`
+
+	// Dir is the working directory, relative to the profile file; empty
+	// uses llmspell's
+	Dir string `json:"dir,omitempty"`
+
+	// Env holds KEY=VALUE pairs the command gets in addition to PATH,
+	// HOME, and LANG; llmspell's other variables, such as API keys, are
+	// not passed on
+	Env []string `json:"env,omitempty"`
+
+	// Timeout bounds each run; zero uses the policy's
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// ExecLimits restrict the resources of a command's process. Limits of zero
+// are left unchanged. They are set before the program runs, and only on
+// Linux.
+type ExecLimits struct {
+	// CPUTime caps the CPU time the process may use (RLIMIT_CPU)
+	CPUTime time.Duration `json:"cpu_time,omitempty"`
+
+	// Memory caps the address space in bytes (RLIMIT_AS)
+	Memory uint64 `json:"memory,omitempty"`
+
+	// OpenFiles caps the number of open file descriptors (RLIMIT_NOFILE)
+	OpenFiles uint64 `json:"open_files,omitempty"`
+
+	// FileSize caps the size of files the process writes (RLIMIT_FSIZE)
+	FileSize uint64 `json:"file_size,omitempty"`
+}
+
+// IsZero reports whether the limits leave every resource unchanged
+func (l ExecLimits) IsZero() bool {
+	return l == ExecLimits{}
+}
+
+// Names lists the commands the policy allows
+func (p ExecPolicy) Names() []string {
+	names := make([]string, 0, len(p.Commands))
+	for name := range p.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TimeoutOf returns how long a run of command may take
+func (p ExecPolicy) TimeoutOf(command ExecCommand) time.Duration {
+	switch {
+	case command.Timeout > 0:
+		return command.Timeout
+	case p.Timeout > 0:
+		return p.Timeout
+	}
+	return DefaultExecTimeout
+}
+
+// OutputLimit returns how many bytes of each output stream are kept
+func (p ExecPolicy) OutputLimit() int64 {
+	if p.MaxOutput > 0 {
+		return p.MaxOutput
+	}
+	return DefaultExecMaxOutput
+}
+
+// Validate reports commands with invalid names, no program, or malformed
+// templates
+func (p ExecPolicy) Validate() error {
+	for _, name := range p.Names() {
+		command := p.Commands[name]
+		if !execNamePattern.MatchString(name) {
+			return fmt.Errorf("exec command %q: names are lowercase letters, digits, and _", name)
+		}
+		if command.Path == "" {
+			return fmt.Errorf("exec command %q has no path", name)
+		}
+		for _, arg := range command.Args {
+			for _, match := range execParamPattern.FindAllStringSubmatch(arg, -1) {
+				if !execNamePattern.MatchString(match[1]) {
+					return fmt.Errorf("exec command %q: invalid parameter %q in %q", name, match[1], arg)
+				}
+			}
+		}
+		for _, pair := range command.Env {
+			if key, _, ok := strings.Cut(pair, "="); !ok || key == "" {
+				return fmt.Errorf("exec command %q: env entries are KEY=VALUE, not %q", name, pair)
+			}
+		}
+	}
+	return nil
+}
+
+// Params lists the parameters the command's templates use, in the order
+// they first appear
+func (c ExecCommand) Params() []string {
+	var params []string
+	seen := make(map[string]bool)
+	for _, arg := range c.Args {
+		for _, match := range execParamPattern.FindAllStringSubmatch(arg, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				params = append(params, match[1])
+			}
+		}
+	}
+	return params
+}
+
+// Expand fills the argument templates with params. Every parameter the
+// templates use must be given, and no others.
+func (c ExecCommand) Expand(params map[string]string) ([]string, error) {
+	used := make(map[string]bool)
+	for _, name := range c.Params() {
+		if _, ok := params[name]; !ok {
+			return nil, fmt.Errorf("missing parameter %q", name)
+		}
+		used[name] = true
+	}
+	for name := range params {
+		if !used[name] {
+			return nil, fmt.Errorf("unknown parameter %q (the command takes: %s)", name, strings.Join(c.Params(), ", "))
+		}
+	}
+
+	args := make([]string, len(c.Args))
+	for i, template := range c.Args {
+		args[i] = execParamPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+			return params[execParamPattern.FindStringSubmatch(placeholder)[1]]
+		})
+		if strings.ContainsRune(args[i], 0) {
+			return nil, fmt.Errorf("argument %q contains a NUL byte", template)
+		}
+		// Only the template may make an argument an option
+		if strings.HasPrefix(args[i], "-") && !strings.HasPrefix(template, "-") {
+			return nil, fmt.Errorf("argument %q may not start with - from a parameter", template)
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,83 @@
+// ABOUTME: Starts external commands on Linux in a process group of their own, with resource limits set before they run
+// ABOUTME: A limited command waits in /bin/sh until prlimit has restricted it, then execs the program in its place
+
+//go:build linux
+
+package security
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// execTrampoline waits for a line on fd 3, which llmspell sends once the
+// limits are set, and then runs the program. Should llmspell exit first, the
+// program does not run.
+const execTrampoline = `IFS= read -r _ <&3 || exit 126; exec 3<&-; exec "$@"`
+
+// StartExec starts cmd in a process group of its own, which cancelling cmd
+// kills whole, so the processes it starts end with it. Its program runs
+// only once limits are in place.
+func StartExec(cmd *exec.Cmd, limits ExecLimits) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	if limits.IsZero() {
+		return cmd.Start()
+	}
+
+	ready, release, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer release.Close()
+	cmd.Args = append([]string{"sh", "-c", execTrampoline, "sh", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	cmd.ExtraFiles = []*os.File{ready}
+	err = cmd.Start()
+	ready.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := limits.apply(cmd.Process.Pid); err != nil {
+		// The shell has written nothing yet, so Wait returns
+		_ = cmd.Cancel()
+		_ = cmd.Wait()
+		return err
+	}
+	_, err = release.Write([]byte("\n"))
+	return err
+}
+
+// apply sets the limits on the process pid
+func (l ExecLimits) apply(pid int) error {
+	limits := []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{"CPU time", unix.RLIMIT_CPU, cpuSeconds(l.CPUTime)},
+		{"memory", unix.RLIMIT_AS, l.Memory},
+		{"open files", unix.RLIMIT_NOFILE, l.OpenFiles},
+		{"file size", unix.RLIMIT_FSIZE, l.FileSize},
+	}
+	for _, limit := range limits {
+		if limit.value == 0 {
+			continue
+		}
+		rlimit := unix.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := unix.Prlimit(pid, limit.resource, &rlimit, nil); err != nil {
+			return fmt.Errorf("failed to limit %s: %w", limit.name, err)
+		}
+	}
+	return nil
+}
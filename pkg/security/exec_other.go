@@ -0,0 +1,19 @@
+// ABOUTME: Starts external commands on platforms without prlimit, where they cannot be given resource limits
+// ABOUTME: A profile that sets limits fails the command instead of running it unrestricted
+
+//go:build !linux
+
+package security
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// StartExec starts cmd, unless limits are set, as they cannot be here
+func StartExec(cmd *exec.Cmd, limits ExecLimits) error {
+	if !limits.IsZero() {
+		return errors.New("resource limits for commands are only supported on Linux")
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,107 @@
+// ABOUTME: Tests for the exec policy of security profiles
+// ABOUTME: Validates command names and templates, how parameters fill arguments, and defaults from profile files
+
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ExecPolicy
+		valid  bool
+	}{
+		{"empty", ExecPolicy{}, true},
+		{"commands", ExecPolicy{Commands: map[string]ExecCommand{
+			"git_log": {Path: "git", Args: []string{"log", "-n", "{{count}}", "--", "{{ path }}"}, Env: []string{"GIT_PAGER=cat"}},
+		}}, true},
+		{"bad name", ExecPolicy{Commands: map[string]ExecCommand{"Git": {Path: "git"}}}, false},
+		{"no path", ExecPolicy{Commands: map[string]ExecCommand{"git": {}}}, false},
+		{"bad parameter", ExecPolicy{Commands: map[string]ExecCommand{"git": {Path: "git", Args: []string{"{{a-b}}"}}}}, false},
+		{"bad env", ExecPolicy{Commands: map[string]ExecCommand{"git": {Path: "git", Env: []string{"PAGER"}}}}, false},
+	}
+	for _, test := range tests {
+		if err := test.policy.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %t, got %v", test.name, test.valid, err)
+		}
+	}
+
+	policy := ExecPolicy{Timeout: time.Minute}
+	if policy.TimeoutOf(ExecCommand{}) != time.Minute || policy.TimeoutOf(ExecCommand{Timeout: time.Second}) != time.Second {
+		t.Error("Expected a command's timeout to override the policy's")
+	}
+	if (ExecPolicy{}).TimeoutOf(ExecCommand{}) != DefaultExecTimeout || (ExecPolicy{}).OutputLimit() != DefaultExecMaxOutput {
+		t.Error("Expected the defaults for an empty policy")
+	}
+}
+
+func TestExecCommandExpand(t *testing.T) {
+	command := ExecCommand{Path: "grep", Args: []string{"-n", "--max-count={{count}}", "-e", "{{pattern}}", "{{file}}", "{{pattern}}.txt"}}
+	if got := strings.Join(command.Params(), ","); got != "count,pattern,file" {
+		t.Errorf("Unexpected params %s", got)
+	}
+
+	args, err := command.Expand(map[string]string{"count": "3", "pattern": "a b; rm -rf /", "file": "notes.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-n", "--max-count=3", "-e", "a b; rm -rf /", "notes.md", "a b; rm -rf /.txt"}
+	if strings.Join(args, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %q, got %q", want, args)
+	}
+
+	tests := []struct {
+		name   string
+		params map[string]string
+		err    string
+	}{
+		{"missing", map[string]string{"count": "3", "pattern": "x"}, `missing parameter "file"`},
+		{"unknown", map[string]string{"count": "3", "pattern": "x", "file": "f", "extra": "y"}, `unknown parameter "extra"`},
+		{"option", map[string]string{"count": "3", "pattern": "x", "file": "--exec=sh"}, "may not start with -"},
+		{"nul", map[string]string{"count": "3", "pattern": "x\x00", "file": "f"}, "NUL byte"},
+	}
+	for _, test := range tests {
+		if _, err := command.Expand(test.params); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected %q, got %v", test.name, test.err, err)
+		}
+	}
+
+	// A template that starts with - may take a value that does too
+	if _, err := command.Expand(map[string]string{"count": "-1", "pattern": "x", "file": "f"}); err != nil {
+		t.Errorf("Expected an option template to take any value, got %v", err)
+	}
+}
+
+func TestLoadProfileExec(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tools.json")
+	data := `{"exec": {"commands": {"build": {"path": "make", "dir": "project"}, "list": {"path": "ls", "dir": "/srv"}}, "limits": {"open_files": 64}}}`
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := LoadProfile(file)
+	if err != nil {
+		t.Fatalf("LoadProfile failed: %v", err)
+	}
+	if dir := profile.Exec.Commands["build"].Dir; dir != filepath.Join(filepath.Dir(file), "project") {
+		t.Errorf("Expected a relative directory to be relative to the file, got %s", dir)
+	}
+	if profile.Exec.Commands["list"].Dir != "/srv" || profile.Exec.Limits.OpenFiles != 64 {
+		t.Errorf("Unexpected exec policy %+v", profile.Exec)
+	}
+
+	data = `{"exec": {"commands": {"build": {"args": ["all"]}}}}`
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProfile(file); err == nil {
+		t.Error("Expected error for a command without a path")
+	}
+}
@@ -0,0 +1,71 @@
+// ABOUTME: Directories the fs module may reach, as named virtual roots, with denied paths and a write quota
+// ABOUTME: Security profiles declare the roots; spells address files in them as "name:path"
+
+package security
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// FSPolicy limits the files spells may read and write through the fs
+// module and the modules that write files through it
+type FSPolicy struct {
+	// Roots, when set, replace the working directory as the directories
+	// spells may access; the run's temp directory is always allowed
+	Roots []FSRoot `json:"roots,omitempty"`
+
+	// Deny lists path patterns spells may not access. A pattern matches a
+	// file or directory name, such as ".env" or "*.pem", or a path
+	// relative to its root, such as "config/secrets/*"; denying a
+	// directory denies everything in it.
+	Deny []string `json:"deny,omitempty"`
+
+	// ReadOnly makes every root read-only, so spells write only to their
+	// temp directory
+	ReadOnly bool `json:"read_only,omitempty"`
+
+	// WriteQuota caps the bytes a run may write; zero means no limit
+	WriteQuota int64 `json:"write_quota,omitempty"`
+}
+
+// FSRoot is a directory spells address by name, as "name:path"
+type FSRoot struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+// rootName is what a root may be called: long enough not to be read as a
+// drive letter
+var rootName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]+$`)
+
+// IsZero reports whether the policy leaves the fs module's defaults alone
+func (p FSPolicy) IsZero() bool {
+	return len(p.Roots) == 0 && len(p.Deny) == 0 && !p.ReadOnly && p.WriteQuota == 0
+}
+
+// Validate checks that roots have usable, distinct names and a path
+func (p FSPolicy) Validate() error {
+	seen := make(map[string]bool)
+	for _, root := range p.Roots {
+		if !rootName.MatchString(root.Name) {
+			return fmt.Errorf("fs root name %q must be two or more letters, digits, _ or -, starting with a letter", root.Name)
+		}
+		if seen[root.Name] {
+			return fmt.Errorf("fs root %q is declared twice", root.Name)
+		}
+		seen[root.Name] = true
+		if root.Path == "" {
+			return fmt.Errorf("fs root %q has no path", root.Name)
+		}
+	}
+	if p.WriteQuota < 0 {
+		return fmt.Errorf("fs write quota must not be negative")
+	}
+	return nil
+}
+
+// secretPaths are files that hold credentials, which guarded spells may
+// not read or overwrite
+var secretPaths = []string{".env", ".env.*", ".git", ".ssh", ".aws", ".netrc", "*.pem", "*.key"}
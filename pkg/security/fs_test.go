@@ -0,0 +1,61 @@
+// ABOUTME: Tests for the fs policy of security profiles
+// ABOUTME: Validates root names and paths, and how profile files place relative roots
+
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFSPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy FSPolicy
+		valid  bool
+	}{
+		{"empty", FSPolicy{}, true},
+		{"roots", FSPolicy{Roots: []FSRoot{{Name: "data", Path: "/srv/data"}, {Name: "out_2", Path: "/srv/out"}}}, true},
+		{"drive letter", FSPolicy{Roots: []FSRoot{{Name: "c", Path: "/srv"}}}, false},
+		{"bad name", FSPolicy{Roots: []FSRoot{{Name: "my data", Path: "/srv"}}}, false},
+		{"duplicate", FSPolicy{Roots: []FSRoot{{Name: "data", Path: "/a"}, {Name: "data", Path: "/b"}}}, false},
+		{"no path", FSPolicy{Roots: []FSRoot{{Name: "data"}}}, false},
+		{"negative quota", FSPolicy{WriteQuota: -1}, false},
+	}
+	for _, test := range tests {
+		if err := test.policy.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %t, got %v", test.name, test.valid, err)
+		}
+	}
+
+	if !(FSPolicy{}).IsZero() || (FSPolicy{ReadOnly: true}).IsZero() {
+		t.Error("Expected only the empty policy to be zero")
+	}
+}
+
+func TestLoadProfileFSRoots(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "team.json")
+	data := `{"fs": {"roots": [{"name": "data", "path": "data"}, {"name": "shared", "path": "/srv/shared", "read_only": true}]}}`
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := LoadProfile(file)
+	if err != nil {
+		t.Fatalf("LoadProfile failed: %v", err)
+	}
+	roots := profile.FS.Roots
+	if len(roots) != 2 || roots[0].Path != filepath.Join(dir, "data") || roots[1].Path != "/srv/shared" || !roots[1].ReadOnly {
+		t.Errorf("Unexpected roots %+v", roots)
+	}
+
+	data = `{"fs": {"roots": [{"name": "x", "path": "data"}]}}`
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProfile(file); err == nil {
+		t.Error("Expected error for an invalid root name")
+	}
+}
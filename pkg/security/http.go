@@ -0,0 +1,106 @@
+// ABOUTME: Destinations the http module may send requests to, by host pattern or URL prefix
+// ABOUTME: Security profiles list allowed and denied destinations; redirects are checked like the first request
+
+package security
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ErrHTTPDenied is returned for a request to a destination the security
+// profile does not allow
+var ErrHTTPDenied = errors.New("destination not allowed")
+
+// HTTPPolicy limits where spells may send HTTP requests. A pattern is a
+// host, which may contain wildcards, such as "api.example.com" or
+// "*.example.com", or a URL prefix such as "https://api.example.com/v1/".
+// Deny wins over Allow; with no Allow patterns, every destination that is
+// not denied is allowed.
+type HTTPPolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// IsZero reports whether the policy allows every destination
+func (p HTTPPolicy) IsZero() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
+
+// Check returns nil when u may be requested, or an error wrapping
+// ErrHTTPDenied
+func (p HTTPPolicy) Check(u *url.URL) error {
+	if matchDestination(p.Deny, u) {
+		return fmt.Errorf("%w: %s is denied by the security profile", ErrHTTPDenied, u.Redacted())
+	}
+	if len(p.Allow) > 0 && !matchDestination(p.Allow, u) {
+		return fmt.Errorf("%w: %s is not in the security profile's allowlist", ErrHTTPDenied, u.Redacted())
+	}
+	return nil
+}
+
+// matchDestination reports whether u matches any of the patterns
+func matchDestination(patterns []string, u *url.URL) bool {
+	host := hostName(u)
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "://") {
+			if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+				return true
+			}
+			continue
+		}
+		if matchPrefix(pattern, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostName returns the host of u in lower case, without the trailing dot
+// of a fully qualified name, which reaches the same server
+func hostName(u *url.URL) string {
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// matchPrefix reports whether u is at or below the URL prefix. The scheme
+// and host, with its port, must be the same, a default port written out
+// matching one left out; the path must start with the
+// prefix's path, and end there or continue below it. Paths are compared
+// decoded and cleaned, so encoded dot segments cannot climb out of the
+// prefix.
+func matchPrefix(prefix string, u *url.URL) bool {
+	p, err := url.Parse(prefix)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(p.Scheme, u.Scheme) || hostName(p) != hostName(u) || portOf(p) != portOf(u) {
+		return false
+	}
+	base := p.Path
+	if base == "" || base == "/" {
+		return true
+	}
+	target := path.Clean("/" + u.Path)
+	if strings.HasSuffix(base, "/") {
+		return strings.HasPrefix(target+"/", base)
+	}
+	return target == base || strings.HasPrefix(target, base+"/")
+}
+
+// portOf returns the port of u, or the default port of its scheme when it
+// names none
+func portOf(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+// ABOUTME: Tests for the destinations the http module may reach
+// ABOUTME: Covers host patterns, URL prefixes on path boundaries, and deny precedence
+
+package security
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestHTTPPolicy(t *testing.T) {
+	policy := HTTPPolicy{
+		Allow: []string{"api.example.com", "*.cdn.example.com", "https://docs.example.org/v1/", "https://files.example.org/pub"},
+		Deny:  []string{"private.cdn.example.com"},
+	}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://api.example.com/users", true},
+		{"http://API.Example.com:8080/", true},
+		{"https://img.cdn.example.com/a.png", true},
+		{"https://private.cdn.example.com/a.png", false},
+		{"https://example.com/", false},
+		{"https://api.example.com.evil.test/", false},
+		{"https://api.example.com@evil.test/", false},
+		{"https://docs.example.org/v1/guide", true},
+		{"https://docs.example.org/v1/", true},
+		{"https://docs.example.org/v2/guide", false},
+		{"https://docs.example.org/v1/../admin", false},
+		{"http://docs.example.org/v1/guide", false},
+		{"https://files.example.org/pub", true},
+		{"https://files.example.org/pub/a.txt", true},
+		{"https://files.example.org/public", false},
+		{"https://docs.example.org/v1/%2e%2e/admin", false},
+		{"https://docs.example.org/v1/%2E%2E/%2e%2e/v2/guide", false},
+		{"https://docs.example.org/v1%2f..%2fadmin", false},
+		{"https://docs.example.org./v1/guide", true},
+		{"https://private.cdn.example.com./a.png", false},
+		{"https://api.example.com./users", true},
+		{"https://docs.example.org:443/v1/guide", true},
+		{"https://docs.example.org:8443/v1/guide", false},
+		{"http://docs.example.org:443/v1/guide", false},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", test.url, err)
+		}
+		err = policy.Check(u)
+		if test.allowed && err != nil {
+			t.Errorf("Expected %s to be allowed, got %v", test.url, err)
+		}
+		if !test.allowed && !errors.Is(err, ErrHTTPDenied) {
+			t.Errorf("Expected %s to be denied, got %v", test.url, err)
+		}
+	}
+}
+
+func TestHTTPPolicyDenyOnly(t *testing.T) {
+	if !(HTTPPolicy{}).IsZero() || (HTTPPolicy{Deny: []string{"*"}}).IsZero() {
+		t.Error("Expected only the empty policy to be zero")
+	}
+
+	u, _ := url.Parse("https://anywhere.test/")
+	if err := (HTTPPolicy{Deny: []string{"internal.test"}}).Check(u); err != nil {
+		t.Errorf("Expected a deny-only policy to allow other hosts, got %v", err)
+	}
+	if err := (HTTPPolicy{Deny: []string{"*"}}).Check(u); !errors.Is(err, ErrHTTPDenied) {
+		t.Errorf("Expected * to deny every host, got %v", err)
+	}
+
+	deny := HTTPPolicy{Deny: []string{"internal.example.com", "https://api.example.com/admin"}}
+	for _, raw := range []string{
+		"http://internal.example.com./",
+		"http://INTERNAL.example.com.:8080/",
+		"https://api.example.com./admin/users",
+		"https://api.example.com/%61dmin",
+		"https://api.example.com/public/%2e%2e/admin",
+		"https://api.example.com:443/admin/x",
+	} {
+		u, _ := url.Parse(raw)
+		if err := deny.Check(u); !errors.Is(err, ErrHTTPDenied) {
+			t.Errorf("Expected %s to be denied, got %v", raw, err)
+		}
+	}
+
+	// A prefix with its default port written out matches URLs without one
+	explicit := HTTPPolicy{Allow: []string{"https://api.example.com:443/v1/"}}
+	for raw, allowed := range map[string]bool{
+		"https://api.example.com/v1/users":     true,
+		"https://api.example.com:443/v1/users": true,
+		"https://api.example.com:444/v1/users": false,
+	} {
+		u, _ := url.Parse(raw)
+		if err := explicit.Check(u); (err == nil) != allowed {
+			t.Errorf("Check(%s) = %v, want allowed = %v", raw, err, allowed)
+		}
+	}
+	u, _ = url.Parse("http://api.example.com/admin/x")
+	if err := (HTTPPolicy{Deny: []string{"http://api.example.com:80/admin"}}).Check(u); !errors.Is(err, ErrHTTPDenied) {
+		t.Errorf("Expected %s to be denied by a prefix with its default port, got %v", u, err)
+	}
+}
@@ -0,0 +1,84 @@
+// ABOUTME: Settings for running spells in a separate, restricted OS process
+// ABOUTME: Carries resource limits, privilege dropping, and seccomp choices from parent to child
+
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrIsolationUnsupported is returned on platforms that cannot restrict a
+// child process
+var ErrIsolationUnsupported = errors.New("process isolation is not supported on this platform")
+
+// IsolationEnv is the environment variable an isolated child reads its
+// restrictions from
+const IsolationEnv = "LLMSPELL_ISOLATION"
+
+// Isolation restricts the process a spell runs in. Limits of zero are left
+// unchanged.
+type Isolation struct {
+	// CPUTime caps the CPU time the process may use (RLIMIT_CPU)
+	CPUTime time.Duration `json:"cpu_time,omitempty"`
+
+	// Memory caps the address space in bytes (RLIMIT_AS)
+	Memory uint64 `json:"memory,omitempty"`
+
+	// OpenFiles caps the number of open file descriptors (RLIMIT_NOFILE)
+	OpenFiles uint64 `json:"open_files,omitempty"`
+
+	// Seccomp blocks system calls a spell never needs, such as mount,
+	// ptrace, and module loading. It only takes effect on Linux.
+	Seccomp bool `json:"seccomp,omitempty"`
+
+	// DropPrivileges runs the process as nobody when started as root
+	DropPrivileges bool `json:"drop_privileges,omitempty"`
+}
+
+// DefaultIsolation returns the restrictions used by --isolated
+func DefaultIsolation() Isolation {
+	return Isolation{
+		CPUTime:        time.Minute,
+		Memory:         4 << 30, // Go reserves address space well beyond its heap
+		OpenFiles:      256,
+		Seccomp:        true,
+		DropPrivileges: true,
+	}
+}
+
+// cpuSeconds converts a CPU time limit to RLIMIT_CPU seconds, rounding up so
+// a limit under a second still applies
+func cpuSeconds(d time.Duration) uint64 {
+	if d <= 0 {
+		return 0
+	}
+	return uint64((d + time.Second - 1) / time.Second)
+}
+
+// Setenv passes the restrictions to a child through its environment
+func (i Isolation) Setenv(env []string) ([]string, error) {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode isolation settings: %w", err)
+	}
+	return append(env, IsolationEnv+"="+string(data)), nil
+}
+
+// IsolationFromEnv returns the restrictions a parent passed to this process,
+// and false if it was not started as an isolated child
+func IsolationFromEnv() (Isolation, bool, error) {
+	data := os.Getenv(IsolationEnv)
+	if data == "" {
+		return Isolation{}, false, nil
+	}
+
+	var isolation Isolation
+	if err := json.Unmarshal([]byte(data), &isolation); err != nil {
+		return Isolation{}, true, fmt.Errorf("invalid %s: %w", IsolationEnv, err)
+	}
+	return isolation, true, nil
+}
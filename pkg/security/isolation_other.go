@@ -0,0 +1,31 @@
+// ABOUTME: Process isolation stubs for platforms without Unix resource limits
+// ABOUTME: Every call reports that isolation is unsupported
+
+//go:build !unix
+
+package security
+
+import (
+	"os"
+	"os/exec"
+)
+
+// PrepareCommand reports that isolation is unsupported
+func (i Isolation) PrepareCommand(cmd *exec.Cmd) (func(), error) {
+	return nil, ErrIsolationUnsupported
+}
+
+// GiveToChild does nothing, as children never drop privileges
+func (i Isolation) GiveToChild(paths ...string) error {
+	return nil
+}
+
+// Apply reports that isolation is unsupported
+func (i Isolation) Apply() error {
+	return ErrIsolationUnsupported
+}
+
+// KilledByLimit reports false, as there are no resource limits to exceed
+func KilledByLimit(state *os.ProcessState) bool {
+	return false
+}
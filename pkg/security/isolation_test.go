@@ -0,0 +1,70 @@
+// ABOUTME: Tests for spell process isolation settings
+// ABOUTME: Validates passing restrictions to a child, CPU time rounding, and the production profile
+
+package security
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCPUSeconds(t *testing.T) {
+	tests := map[time.Duration]uint64{
+		0:                       0,
+		-time.Second:            0,
+		time.Millisecond:        1,
+		500 * time.Millisecond:  1,
+		time.Second:             1,
+		1500 * time.Millisecond: 2,
+		time.Minute:             60,
+	}
+	for limit, want := range tests {
+		if got := cpuSeconds(limit); got != want {
+			t.Errorf("cpuSeconds(%v) = %d, want %d", limit, got, want)
+		}
+	}
+}
+
+func TestIsolationEnvRoundTrip(t *testing.T) {
+	want := Isolation{CPUTime: 30 * time.Second, Memory: 1 << 30, OpenFiles: 64, Seccomp: true}
+	env, err := want.Setenv(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env) != 1 || !strings.HasPrefix(env[0], IsolationEnv+"=") {
+		t.Fatalf("Unexpected environment: %v", env)
+	}
+
+	t.Setenv(IsolationEnv, strings.TrimPrefix(env[0], IsolationEnv+"="))
+	got, isolated, err := IsolationFromEnv()
+	if err != nil || !isolated || got != want {
+		t.Errorf("Expected %+v, got %+v (isolated %v, err %v)", want, got, isolated, err)
+	}
+
+	t.Setenv(IsolationEnv, "{bad")
+	if _, isolated, err := IsolationFromEnv(); !isolated || err == nil {
+		t.Error("Expected an error for malformed settings")
+	}
+
+	os.Unsetenv(IsolationEnv)
+	if _, isolated, _ := IsolationFromEnv(); isolated {
+		t.Error("Expected no isolation without the variable")
+	}
+}
+
+func TestProductionProfileIsolates(t *testing.T) {
+	profile, err := LookupProfile("production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Isolation == nil || *profile.Isolation != DefaultIsolation() {
+		t.Errorf("Expected default isolation, got %+v", profile.Isolation)
+	}
+
+	standard, _ := LookupProfile("standard")
+	if standard.Isolation != nil {
+		t.Error("Expected the standard profile to run in-process")
+	}
+}
@@ -0,0 +1,110 @@
+// ABOUTME: Process isolation on Unix: resource limits and an unprivileged child user
+// ABOUTME: Parents prepare the child command; children restrict themselves before running a spell
+
+//go:build unix
+
+package security
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// nobody is the conventional unprivileged user and group ID
+const nobody = 65534
+
+// PrepareCommand configures cmd to start as an isolated child. When it
+// drops privileges the child gets a private home directory, since it can no
+// longer use the caller's; the returned cleanup removes it after the child exits.
+func (i Isolation) PrepareCommand(cmd *exec.Cmd) (func(), error) {
+	env, err := i.Setenv(cmd.Environ())
+	if err != nil {
+		return nil, err
+	}
+	cmd.Env = env
+
+	if !i.DropPrivileges || os.Geteuid() != 0 {
+		return func() {}, nil
+	}
+
+	home, err := os.MkdirTemp("", "llmspell-isolated-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create isolated home: %w", err)
+	}
+	cleanup := func() { _ = os.RemoveAll(home) }
+	if err := os.Chown(home, nobody, nobody); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to create isolated home: %w", err)
+	}
+	cmd.Env = append(cmd.Env, "HOME="+home)
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: nobody, Gid: nobody}
+	return cleanup, nil
+}
+
+// GiveToChild hands files the parent prepared for a child, such as a
+// spell it wrote out, to the user the child runs as, so the child can still
+// read them once it has dropped privileges
+func (i Isolation) GiveToChild(paths ...string) error {
+	if !i.DropPrivileges || os.Geteuid() != 0 {
+		return nil
+	}
+	for _, path := range paths {
+		if err := os.Chown(path, nobody, nobody); err != nil {
+			return fmt.Errorf("failed to hand %s to the isolated child: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Apply restricts the current process. It cannot be undone, so only an
+// isolated child calls it, before running any spell code.
+func (i Isolation) Apply() error {
+	limits := []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{"CPU time", unix.RLIMIT_CPU, cpuSeconds(i.CPUTime)},
+		{"memory", unix.RLIMIT_AS, i.Memory},
+		{"open files", unix.RLIMIT_NOFILE, i.OpenFiles},
+	}
+	for _, limit := range limits {
+		if limit.value == 0 {
+			continue
+		}
+		rlimit := unix.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := unix.Setrlimit(limit.resource, &rlimit); err != nil {
+			return fmt.Errorf("failed to limit %s: %w", limit.name, err)
+		}
+	}
+
+	if i.Seccomp {
+		if err := applySeccomp(); err != nil {
+			return fmt.Errorf("failed to install seccomp filter: %w", err)
+		}
+	}
+	return nil
+}
+
+// KilledByLimit reports whether an isolated child was killed for exceeding
+// a resource limit: SIGXCPU or SIGKILL at the CPU time limit, SIGXFSZ at a
+// file size limit, or SIGKILL from the kernel when out of memory
+func KilledByLimit(state *os.ProcessState) bool {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return false
+	}
+	switch status.Signal() {
+	case syscall.SIGXCPU, syscall.SIGXFSZ, syscall.SIGKILL:
+		return true
+	}
+	return false
+}
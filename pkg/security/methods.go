@@ -0,0 +1,288 @@
+// ABOUTME: Method-level allow/deny policies for script bridges
+// ABOUTME: Defines named security profiles that restrict which bridge methods scripts may call
+
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrMethodDenied is returned when a security policy forbids a bridge method
+var ErrMethodDenied = errors.New("permission denied")
+
+// MethodPolicy restricts the bridge methods scripts may call. Entries are
+// "bridge.method" patterns where * matches any run of characters, e.g.
+// "tools.*" or "tools.list_*". Deny entries win over allow entries; an empty
+// allow list permits everything that is not denied.
+type MethodPolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Allows reports whether the policy permits calling bridge.method
+func (p *MethodPolicy) Allows(bridge, method string) bool {
+	if p == nil {
+		return true
+	}
+
+	name := bridge + "." + method
+	if matchAny(p.Deny, name) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchAny(p.Allow, name)
+}
+
+// Check returns an error wrapping ErrMethodDenied when bridge.method is not allowed
+func (p *MethodPolicy) Check(bridge, method string) error {
+	if p.Allows(bridge, method) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s.%s is not allowed by the security policy", ErrMethodDenied, bridge, method)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Profile is a named set of restrictions operators can select for a run
+type Profile struct {
+	// Path is the file the profile was read from; empty for built-in
+	// profiles
+	Path string `json:"-"`
+
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Methods     MethodPolicy `json:"methods"`
+	RateLimits  []RateLimit  `json:"rate_limits,omitempty"`
+
+	// ToolLimits and CircuitBreakers apply to each tool separately
+	ToolLimits      []ToolLimit      `json:"tool_limits,omitempty"`
+	CircuitBreakers []CircuitBreaker `json:"circuit_breakers,omitempty"`
+
+	// Confirmation decides whether tools that require confirmation run
+	Confirmation ConfirmationPolicy `json:"confirmation,omitempty"`
+
+	// HTTP limits where the http module may send requests
+	HTTP HTTPPolicy `json:"http,omitempty"`
+
+	// FS limits the files the fs module may read and write
+	FS FSPolicy `json:"fs,omitempty"`
+
+	// Exec lists the commands the exec module may run
+	Exec ExecPolicy `json:"exec,omitempty"`
+
+	// Permissions grants capabilities such as PermissionDatabase
+	Permissions []Permission `json:"permissions,omitempty"`
+
+	// Isolation, when set, runs spells in a separate restricted process
+	Isolation *Isolation `json:"isolation,omitempty"`
+
+	// State, when set, limits the shared state of each spell
+	State *StateQuota `json:"state,omitempty"`
+
+	// Channels restricts the state channels spells may attach to
+	Channels ChannelPolicy `json:"channels,omitempty"`
+
+	// Asserts is what a failed log.assert does: AssertRaise, AssertLog, or
+	// AssertOff; empty raises
+	Asserts string `json:"asserts,omitempty"`
+}
+
+// Assertion modes
+const (
+	// AssertRaise fails the spell with the assertion's message
+	AssertRaise = "raise"
+	// AssertLog logs the failure and lets the spell continue
+	AssertLog = "log"
+	// AssertOff skips assertions
+	AssertOff = "off"
+)
+
+// DefaultProfile is used when no profile is selected
+const DefaultProfile = "standard"
+
+var profiles = map[string]Profile{
+	"standard": {
+		Name:        "standard",
+		Description: "All methods of enabled bridges are available",
+		Permissions: []Permission{PermissionDatabase, PermissionExec},
+	},
+	"guarded": {
+		Name:        "guarded",
+		Description: "All methods are available, with rate limits on tool, agent, and LLM calls",
+		RateLimits: []RateLimit{
+			{Method: "tools.execute*", Calls: 60, Per: time.Minute},
+			{Method: "agents.execute", Calls: 30, Per: time.Minute},
+			{Method: "llm.*", Calls: 30, Per: time.Minute},
+		},
+		CircuitBreakers: []CircuitBreaker{toolBreaker},
+		State:           &StateQuota{MaxKeys: 10000, MaxBytes: 64 << 20},
+		FS:              FSPolicy{Deny: secretPaths, WriteQuota: 1 << 30},
+		Permissions:     []Permission{PermissionDatabase, PermissionExec},
+	},
+	"production": {
+		Name:        "production",
+		Description: "Rate-limited calls, with each spell run in an isolated, resource-limited process",
+		RateLimits: []RateLimit{
+			{Method: "tools.execute*", Calls: 60, Per: time.Minute},
+			{Method: "agents.execute", Calls: 30, Per: time.Minute},
+			{Method: "llm.*", Calls: 30, Per: time.Minute},
+		},
+		CircuitBreakers: []CircuitBreaker{toolBreaker},
+		// Production runs are unattended, so there is no one to ask
+		Confirmation: ConfirmationPolicy{Mode: ConfirmDeny},
+		// A failed assertion is logged rather than stopping a service
+		Asserts:   AssertLog,
+		Isolation: isolation(DefaultIsolation()),
+		// Long-running daemons keep state small by forgetting idle keys
+		State:       &StateQuota{TTL: time.Hour, MaxKeys: 10000, MaxBytes: 64 << 20, Eviction: EvictLRU},
+		FS:          FSPolicy{Deny: secretPaths, WriteQuota: 1 << 30},
+		Permissions: []Permission{PermissionDatabase, PermissionExec},
+	},
+	"strict": {
+		Name:        "strict",
+		Description: "Read-only tool discovery and LLM calls; tools cannot be run or changed",
+		Methods: MethodPolicy{
+			Allow: []string{
+				"tools.list", "tools.list_*", "tools.get", "tools.search",
+				"tools.validate", "tools.doc", "tools.docs", "tools.doc_*", "tools.scaffold_input",
+				"agents.list", "agents.get",
+				"llm.*", "state.*", "cache.*", "spell.on_exit",
+				// The standard library, but for storage, notify, and http,
+				// which write outside the run or reach the network
+				"json.*", "log.*", "result.*", "time.*", "fs.*", "compress.*",
+				"report.*", "chart.*", "df.*", "promise.*", "async.*",
+			},
+			// Saving state writes files, which strict spells may not do
+			Deny: []string{"llm.set_provider", "state.persist", "state.delete_persisted", "state.migrate"},
+		},
+		RateLimits: []RateLimit{
+			{Method: "llm.*", Calls: 30, Per: time.Minute},
+		},
+		State: &StateQuota{MaxKeys: 1000, MaxBytes: 16 << 20},
+		// Spells keep to the state of their own run
+		Channels: ChannelPolicy{Deny: []string{"*"}},
+		// Spells reach the network only through LLM calls
+		HTTP: HTTPPolicy{Deny: []string{"*"}},
+		// Spells write files only to their temp directory
+		FS: FSPolicy{Deny: secretPaths, ReadOnly: true, WriteQuota: 16 << 20},
+	},
+}
+
+// toolBreaker stops calling a tool that fails five times in a minute for
+// thirty seconds, so a flaky tool cannot stall an agent loop
+var toolBreaker = CircuitBreaker{Tool: "*", Failures: 5, Window: time.Minute, Cooldown: 30 * time.Second}
+
+// isolation returns a pointer to i
+func isolation(i Isolation) *Isolation {
+	return &i
+}
+
+// LookupProfile returns a built-in profile by name
+func LookupProfile(name string) (Profile, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown security profile %q (available: %v)", name, ProfileNames())
+	}
+	return profile, nil
+}
+
+// LoadProfile reads a profile from a JSON file. The built-in profile its
+// "base" field names, or DefaultProfile, provides what the file leaves
+// out; its name defaults to the file's name without the extension.
+// Durations are in nanoseconds, and relative fs root paths and exec
+// command directories are relative to the file.
+func LoadProfile(file string) (Profile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Profile{}, err
+	}
+	var head struct {
+		Base string `json:"base"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return Profile{}, fmt.Errorf("invalid security profile %s: %w", file, err)
+	}
+	base, err := LookupProfile(head.Base)
+	if err != nil {
+		return Profile{}, fmt.Errorf("invalid security profile %s: %w", file, err)
+	}
+	// A copy of the base, so the file cannot change the built-in profile
+	var profile Profile
+	baseData, err := json.Marshal(base)
+	if err == nil {
+		err = json.Unmarshal(baseData, &profile)
+	}
+	if err != nil {
+		return Profile{}, err
+	}
+	profile.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return Profile{}, fmt.Errorf("invalid security profile %s: %w", file, err)
+	}
+	if err := profile.Exec.Validate(); err != nil {
+		return Profile{}, fmt.Errorf("invalid security profile %s: %w", file, err)
+	}
+	if err := profile.FS.Validate(); err != nil {
+		return Profile{}, fmt.Errorf("invalid security profile %s: %w", file, err)
+	}
+	switch profile.Asserts {
+	case "", AssertRaise, AssertLog, AssertOff:
+	default:
+		return Profile{}, fmt.Errorf("invalid security profile %s: asserts must be %q, %q, or %q, not %q", file, AssertRaise, AssertLog, AssertOff, profile.Asserts)
+	}
+	if profile.Path, err = filepath.Abs(file); err != nil {
+		return Profile{}, err
+	}
+	// Roots and command directories are relative to the file
+	for i, root := range profile.FS.Roots {
+		if !filepath.IsAbs(root.Path) {
+			profile.FS.Roots[i].Path = filepath.Join(filepath.Dir(profile.Path), root.Path)
+		}
+	}
+	for name, command := range profile.Exec.Commands {
+		if command.Dir != "" && !filepath.IsAbs(command.Dir) {
+			command.Dir = filepath.Join(filepath.Dir(profile.Path), command.Dir)
+			profile.Exec.Commands[name] = command
+		}
+	}
+	return profile, nil
+}
+
+// ProfileNames lists the built-in profiles
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DetectProfile picks the profile name from an explicit choice (such as a
+// flag), then LLMSPELL_SECURITY_PROFILE, then DefaultProfile
+func DetectProfile(explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+	if env := os.Getenv("LLMSPELL_SECURITY_PROFILE"); env != "" {
+		return env
+	}
+	return DefaultProfile
+}
@@ -0,0 +1,147 @@
+// ABOUTME: Tests for bridge method policies and security profiles
+// ABOUTME: Validates pattern matching, deny precedence, and profile lookup
+
+package security
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMethodPolicy(t *testing.T) {
+	policy := &MethodPolicy{
+		Allow: []string{"tools.list*", "tools.get", "llm.*"},
+		Deny:  []string{"llm.set_provider"},
+	}
+
+	tests := []struct {
+		bridge, method string
+		allowed        bool
+	}{
+		{"tools", "list", true},
+		{"tools", "list_by_tag", true},
+		{"tools", "get", true},
+		{"tools", "execute", false},
+		{"llm", "chat", true},
+		{"llm", "set_provider", false},
+		{"agents", "create", false},
+	}
+	for _, tt := range tests {
+		if got := policy.Allows(tt.bridge, tt.method); got != tt.allowed {
+			t.Errorf("Allows(%s, %s) = %v, want %v", tt.bridge, tt.method, got, tt.allowed)
+		}
+	}
+
+	err := policy.Check("tools", "execute")
+	if !errors.Is(err, ErrMethodDenied) {
+		t.Errorf("Expected ErrMethodDenied, got %v", err)
+	}
+	if err := policy.Check("tools", "get"); err != nil {
+		t.Errorf("Expected allowed method, got %v", err)
+	}
+
+	denyOnly := &MethodPolicy{Deny: []string{"tools.execute"}}
+	if !denyOnly.Allows("agents", "create") || denyOnly.Allows("tools", "execute") {
+		t.Error("Expected deny-only policy to allow everything except denied methods")
+	}
+
+	var none *MethodPolicy
+	if !none.Allows("tools", "execute") {
+		t.Error("Expected nil policy to allow everything")
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	standard, err := LookupProfile("")
+	if err != nil || standard.Name != DefaultProfile {
+		t.Fatalf("Expected default profile, got %+v, %v", standard, err)
+	}
+	if !standard.Methods.Allows("tools", "execute") {
+		t.Error("Expected standard profile to allow tools.execute")
+	}
+
+	strict, err := LookupProfile("strict")
+	if err != nil {
+		t.Fatalf("LookupProfile failed: %v", err)
+	}
+	if strict.Methods.Allows("tools", "execute") || !strict.Methods.Allows("tools", "list") {
+		t.Error("Expected strict profile to allow listing but not execution")
+	}
+	if strict.Channels.Allows("jobs") || !standard.Channels.Allows("jobs") {
+		t.Error("Expected only the standard profile to allow state channels")
+	}
+
+	if !standard.Grants(PermissionDatabase) || strict.Grants(PermissionDatabase) {
+		t.Error("Expected only the standard profile to grant the database permission")
+	}
+	if !standard.Grants(PermissionExec) || strict.Grants(PermissionExec) || len(standard.Exec.Commands) != 0 {
+		t.Error("Expected only the standard profile to grant the exec permission, with no commands")
+	}
+	if err := strict.Require(PermissionDatabase); !errors.Is(err, ErrMethodDenied) {
+		t.Errorf("Expected ErrMethodDenied from a missing permission, got %v", err)
+	}
+	if err := standard.Require(PermissionDatabase); err != nil {
+		t.Errorf("Expected the database permission, got %v", err)
+	}
+
+	channels := ChannelPolicy{Allow: []string{"team.*"}, Deny: []string{"team.secret"}}
+	if !channels.Allows("team.jobs") || channels.Allows("team.secret") || channels.Allows("other") {
+		t.Errorf("Unexpected channel policy decisions for %+v", channels)
+	}
+
+	if _, err := LookupProfile("nope"); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+
+	t.Setenv("LLMSPELL_SECURITY_PROFILE", "strict")
+	if got := DetectProfile(""); got != "strict" {
+		t.Errorf("Expected profile from environment, got %s", got)
+	}
+	if got := DetectProfile("standard"); got != "standard" {
+		t.Errorf("Expected explicit profile to win, got %s", got)
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "team.json")
+	data := `{"base": "guarded", "description": "Team spells", "http": {"allow": ["api.example.com"]}}`
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := LoadProfile(file)
+	if err != nil {
+		t.Fatalf("LoadProfile failed: %v", err)
+	}
+	if profile.Name != "team" || profile.Path != file || profile.Description != "Team spells" {
+		t.Errorf("Unexpected profile %+v", profile)
+	}
+	if len(profile.RateLimits) == 0 {
+		t.Error("Expected rate limits from the guarded base")
+	}
+	if len(profile.HTTP.Allow) != 1 || profile.HTTP.Allow[0] != "api.example.com" {
+		t.Errorf("Unexpected HTTP policy %+v", profile.HTTP)
+	}
+
+	data = `{"base": "nope"}`
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProfile(file); err == nil {
+		t.Error("Expected error for an unknown base profile")
+	}
+	data = `{"asserts": "sometimes"}`
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProfile(file); err == nil || !strings.Contains(err.Error(), "asserts must be") {
+		t.Errorf("Expected error for an unknown assert mode, got %v", err)
+	}
+	if _, err := LoadProfile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected error for a missing file")
+	}
+}
@@ -0,0 +1,39 @@
+// ABOUTME: Permissions for capabilities spells only get when their security profile grants them
+// ABOUTME: PermissionDatabase lets spells open SQL databases with the db module, PermissionExec run allowlisted commands
+
+package security
+
+import "fmt"
+
+// Permission is a capability beyond the bridges every spell has, which a
+// profile must grant
+type Permission string
+
+// Permissions profiles can grant
+const (
+	// PermissionDatabase lets spells open SQLite and Postgres databases
+	PermissionDatabase Permission = "database"
+
+	// PermissionExec lets spells run the commands the profile's ExecPolicy
+	// lists
+	PermissionExec Permission = "exec"
+)
+
+// Grants reports whether the profile grants perm
+func (p Profile) Grants(perm Permission) bool {
+	for _, granted := range p.Permissions {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Require returns nil when the profile grants perm, or an error wrapping
+// ErrMethodDenied
+func (p Profile) Require(perm Permission) error {
+	if p.Grants(perm) {
+		return nil
+	}
+	return fmt.Errorf("%w: the security profile does not grant the %s permission", ErrMethodDenied, perm)
+}
@@ -0,0 +1,89 @@
+// ABOUTME: Per-method rate limits for script bridge calls
+// ABOUTME: Tracks calls per spell run in sliding windows and rejects calls over the limit
+
+package security
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a call exceeds a rate limit
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimit caps the calls to methods matching a "bridge.method" pattern
+// (as in MethodPolicy). All methods matching one pattern share its budget,
+// so "llm.*" limits the total number of LLM calls.
+type RateLimit struct {
+	Method string        `json:"method"`
+	Calls  int           `json:"calls"`
+	Per    time.Duration `json:"per"`
+}
+
+// RateLimiter enforces rate limits over one spell run. It is safe for
+// concurrent use.
+type RateLimiter struct {
+	limits []RateLimit
+	now    func() time.Time
+
+	mu    sync.Mutex
+	calls [][]time.Time
+}
+
+// NewRateLimiter creates a limiter with its own call counts
+func NewRateLimiter(limits []RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limits: limits,
+		now:    time.Now,
+		calls:  make([][]time.Time, len(limits)),
+	}
+}
+
+// Limits reports whether any limit applies to bridge.method
+func (rl *RateLimiter) Limits(bridge, method string) bool {
+	name := bridge + "." + method
+	for _, limit := range rl.limits {
+		if matchAny([]string{limit.Method}, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow records a call to bridge.method, or returns an error wrapping
+// ErrRateLimited without recording it if any matching limit is used up
+func (rl *RateLimiter) Allow(bridge, method string) error {
+	name := bridge + "." + method
+	now := rl.now()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	var matched []int
+	for i, limit := range rl.limits {
+		if !matchAny([]string{limit.Method}, name) {
+			continue
+		}
+		rl.calls[i] = pruneCalls(rl.calls[i], now.Add(-limit.Per))
+		if len(rl.calls[i]) >= limit.Calls {
+			return fmt.Errorf("%w: %s allows %d calls per %s", ErrRateLimited, limit.Method, limit.Calls, limit.Per)
+		}
+		matched = append(matched, i)
+	}
+
+	for _, i := range matched {
+		rl.calls[i] = append(rl.calls[i], now)
+	}
+	return nil
+}
+
+// pruneCalls drops calls made at or before cutoff
+func pruneCalls(calls []time.Time, cutoff time.Time) []time.Time {
+	keep := 0
+	for keep < len(calls) && !calls[keep].After(cutoff) {
+		keep++
+	}
+	return calls[keep:]
+}
@@ -0,0 +1,83 @@
+// ABOUTME: Tests for per-method rate limits
+// ABOUTME: Validates shared budgets, window expiry, and rejected calls not being counted
+
+package security
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl := NewRateLimiter([]RateLimit{
+		{Method: "tools.execute", Calls: 2, Per: time.Minute},
+		{Method: "llm.*", Calls: 3, Per: time.Minute},
+	})
+	rl.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := rl.Allow("tools", "execute"); err != nil {
+			t.Fatalf("Call %d should be allowed: %v", i, err)
+		}
+	}
+	err := rl.Allow("tools", "execute")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected ErrRateLimited, got %v", err)
+	}
+
+	// Unlimited methods are never rejected
+	for i := 0; i < 10; i++ {
+		if err := rl.Allow("tools", "list"); err != nil {
+			t.Fatalf("Unlimited method rejected: %v", err)
+		}
+	}
+	if rl.Limits("tools", "list") || !rl.Limits("llm", "chat") {
+		t.Error("Limits reported the wrong methods")
+	}
+
+	// Methods matching one pattern share its budget
+	for _, method := range []string{"chat", "complete", "chat"} {
+		if err := rl.Allow("llm", method); err != nil {
+			t.Fatalf("llm.%s should be allowed: %v", method, err)
+		}
+	}
+	if err := rl.Allow("llm", "complete"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected shared llm budget to be used up, got %v", err)
+	}
+
+	// The window slides
+	now = now.Add(time.Minute + time.Second)
+	if err := rl.Allow("tools", "execute"); err != nil {
+		t.Errorf("Expected call to be allowed after the window passed: %v", err)
+	}
+}
+
+func TestRateLimiterRejectedCallsNotCounted(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl := NewRateLimiter([]RateLimit{
+		{Method: "tools.*", Calls: 5, Per: time.Minute},
+		{Method: "tools.execute", Calls: 1, Per: time.Minute},
+	})
+	rl.now = func() time.Time { return now }
+
+	if err := rl.Allow("tools", "execute"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := rl.Allow("tools", "execute"); err == nil {
+			t.Fatal("Expected tools.execute limit to be hit")
+		}
+	}
+
+	// Only the one successful execute counted against tools.*
+	for i := 0; i < 4; i++ {
+		if err := rl.Allow("tools", "list"); err != nil {
+			t.Fatalf("Call %d should fit the tools.* budget: %v", i, err)
+		}
+	}
+	if err := rl.Allow("tools", "list"); err == nil {
+		t.Error("Expected tools.* budget to be used up")
+	}
+}
@@ -0,0 +1,90 @@
+// ABOUTME: Tests for the Linux seccomp filter and resource limits
+// ABOUTME: Applies isolation in a re-executed test process so the test runner stays unrestricted
+
+//go:build linux && (amd64 || arm64)
+
+package security
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSeccompFilterLayout(t *testing.T) {
+	const checks = 10
+	filter := seccompFilter()
+	if want := checks + len(deniedSyscalls) + 2; len(filter) != want {
+		t.Fatalf("Expected %d instructions, got %d", want, len(filter))
+	}
+
+	allow, deny := len(filter)-2, len(filter)-1
+	if target := 4 + 1 + int(filter[4].Jt); target != deny {
+		t.Errorf("x32 check jumps to %d, want %d", target, deny)
+	}
+	if filter[6].K != seccompRetErrno|uint32(unix.ENOSYS) {
+		t.Errorf("Expected clone3 to return ENOSYS, got %#x", filter[6].K)
+	}
+	if target := 7 + 1 + int(filter[7].Jf); target != checks {
+		t.Errorf("Clone check skips to %d, want %d", target, checks)
+	}
+	if target := 9 + 1 + int(filter[9].Jt); target != deny {
+		t.Errorf("Namespace flags jump to %d, want %d", target, deny)
+	}
+	if target := 9 + 1 + int(filter[9].Jf); target != allow {
+		t.Errorf("Other clone flags jump to %d, want %d", target, allow)
+	}
+	for i := range deniedSyscalls {
+		pos := checks + i
+		if target := pos + 1 + int(filter[pos].Jt); target != deny {
+			t.Errorf("Check %d jumps to %d, want %d", i, target, deny)
+		}
+	}
+}
+
+func TestIsolationApply(t *testing.T) {
+	if os.Getenv("SECURITY_ISOLATION_CHILD") == "1" {
+		isolation := Isolation{OpenFiles: 64, Seccomp: true}
+		if err := isolation.Apply(); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		var rlimit unix.Rlimit
+		if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rlimit); err != nil || rlimit.Cur != 64 {
+			t.Errorf("Expected 64 open files, got %d (%v)", rlimit.Cur, err)
+		}
+		if err := unix.Unshare(unix.CLONE_NEWNS); !errors.Is(err, unix.EPERM) {
+			t.Errorf("Expected unshare to be denied, got %v", err)
+		}
+		// Invalid flag combinations fail before a process is created, so
+		// EINVAL shows a call got past the filter
+		if _, _, errno := unix.RawSyscall(unix.SYS_CLONE, unix.CLONE_NEWNS|unix.CLONE_FS, 0, 0); errno != unix.EPERM {
+			t.Errorf("Expected a clone into a new namespace to be denied, got %v", errno)
+		}
+		if _, _, errno := unix.RawSyscall(unix.SYS_CLONE, unix.CLONE_THREAD, 0, 0); errno != unix.EINVAL {
+			t.Errorf("Expected other clones to be allowed, got %v", errno)
+		}
+		if _, _, errno := unix.RawSyscall(unix.SYS_CLONE3, 0, 0, 0); errno != unix.ENOSYS {
+			t.Errorf("Expected clone3 to be unavailable, got %v", errno)
+		}
+		if runtime.GOARCH == "amd64" {
+			if _, _, errno := unix.Syscall(x32SyscallBit|unix.SYS_UNSHARE, unix.CLONE_NEWNS, 0, 0); errno != unix.EPERM {
+				t.Errorf("Expected the x32 unshare to be denied, got %v", errno)
+			}
+		}
+		if _, err := os.Getwd(); err != nil {
+			t.Errorf("Expected ordinary calls to work, got %v", err)
+		}
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestIsolationApply$")
+	cmd.Env = append(os.Environ(), "SECURITY_ISOLATION_CHILD=1")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Isolated child failed: %v\n%s", err, output)
+	}
+}
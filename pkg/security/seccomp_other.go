@@ -0,0 +1,11 @@
+// ABOUTME: No-op seccomp for Unix platforms without a syscall filter
+// ABOUTME: Resource limits still apply; only the syscall deny list is skipped
+
+//go:build unix && !(linux && (amd64 || arm64))
+
+package security
+
+// applySeccomp does nothing where seccomp is unavailable
+func applySeccomp() error {
+	return nil
+}
@@ -0,0 +1,58 @@
+// ABOUTME: Quotas on the shared state of each spell: key lifetime, key count, and size
+// ABOUTME: Names the eviction policies for writes over quota, and which named state channels spells may attach to
+
+package security
+
+import "time"
+
+// Eviction policies of a StateQuota
+const (
+	// EvictReject fails writes that would go over quota
+	EvictReject = "reject"
+
+	// EvictLRU makes room by deleting the least recently used keys
+	EvictLRU = "lru"
+)
+
+// StateQuota limits the state of each spell and sub-spell. Zero fields
+// are not limited.
+type StateQuota struct {
+	// TTL is how long a key lasts after it was last set
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// MaxKeys caps the number of keys
+	MaxKeys int `json:"max_keys,omitempty"`
+
+	// MaxBytes caps the size of the keys and values, as JSON
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+
+	// Eviction is EvictReject, the default, or EvictLRU
+	Eviction string `json:"eviction,omitempty"`
+}
+
+// IsZero reports whether the quota limits nothing
+func (q StateQuota) IsZero() bool {
+	return q.TTL <= 0 && q.MaxKeys <= 0 && q.MaxBytes <= 0
+}
+
+// ChannelPolicy restricts the named state channels spells may attach to,
+// to share state with other spells in the same process. Entries are name
+// patterns where * matches any run of characters. Deny entries win over
+// allow entries; an empty allow list permits every channel not denied.
+type ChannelPolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Allows reports whether spells may attach to the channel name
+func (p ChannelPolicy) Allows(name string) bool {
+	if matchAny(p.Deny, name) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchAny(p.Allow, name)
+}
+
+// IsZero reports whether the policy permits every channel
+func (p ChannelPolicy) IsZero() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
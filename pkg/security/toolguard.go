@@ -0,0 +1,161 @@
+// ABOUTME: Per-tool rate limits and circuit breakers for tool executions
+// ABOUTME: A tool that keeps failing is refused until a cooldown passes, then probed with a single call
+
+package security
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a tool's circuit breaker refuses a call
+var ErrCircuitOpen = errors.New("circuit open")
+
+// ToolLimit caps the calls to each tool whose name matches the Tool
+// pattern. Unlike a RateLimit, every matching tool has a budget of its own.
+type ToolLimit struct {
+	Tool  string        `json:"tool"`
+	Calls int           `json:"calls"`
+	Per   time.Duration `json:"per"`
+}
+
+// CircuitBreaker stops calling a tool matching the Tool pattern once it
+// has failed Failures times within Window. After Cooldown a single probe
+// call goes through: if it succeeds the tool is called again as usual, if
+// it fails the tool is refused for another Cooldown.
+type CircuitBreaker struct {
+	Tool     string        `json:"tool"`
+	Failures int           `json:"failures"`
+	Window   time.Duration `json:"window"`
+	Cooldown time.Duration `json:"cooldown"`
+}
+
+// circuit is the breaker state of one tool
+type circuit struct {
+	failures []time.Time
+	// openedAt is when the circuit opened; zero while it is closed
+	openedAt time.Time
+	// probing is set while the probe call of a half-open circuit runs
+	probing bool
+}
+
+// ToolGuard enforces tool limits and circuit breakers over one spell run.
+// Each call Allow lets through must be reported to Done. It is safe for
+// concurrent use, and a nil guard allows every call.
+type ToolGuard struct {
+	limits   []ToolLimit
+	breakers []CircuitBreaker
+	now      func() time.Time
+
+	mu       sync.Mutex
+	calls    map[string][]time.Time
+	circuits map[string]*circuit
+}
+
+// NewToolGuard creates a guard with its own call counts and circuits
+func NewToolGuard(limits []ToolLimit, breakers []CircuitBreaker) *ToolGuard {
+	return &ToolGuard{
+		limits:   limits,
+		breakers: breakers,
+		now:      time.Now,
+		calls:    make(map[string][]time.Time),
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// breaker returns the first breaker matching tool, or nil
+func (g *ToolGuard) breaker(tool string) *CircuitBreaker {
+	for i := range g.breakers {
+		if matchAny([]string{g.breakers[i].Tool}, tool) {
+			return &g.breakers[i]
+		}
+	}
+	return nil
+}
+
+// Allow records a call to tool, or returns an error wrapping
+// ErrCircuitOpen or ErrRateLimited without recording it
+func (g *ToolGuard) Allow(tool string) error {
+	if g == nil {
+		return nil
+	}
+	now := g.now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if breaker := g.breaker(tool); breaker != nil {
+		if c := g.circuits[tool]; c != nil && !c.openedAt.IsZero() {
+			if c.probing || now.Sub(c.openedAt) < breaker.Cooldown {
+				return fmt.Errorf("%w: %s failed %d times within %s", ErrCircuitOpen, tool, breaker.Failures, breaker.Window)
+			}
+		}
+	}
+
+	var matched []int
+	for i, limit := range g.limits {
+		if !matchAny([]string{limit.Tool}, tool) {
+			continue
+		}
+		key := fmt.Sprintf("%d\x00%s", i, tool)
+		g.calls[key] = pruneCalls(g.calls[key], now.Add(-limit.Per))
+		if len(g.calls[key]) >= limit.Calls {
+			return fmt.Errorf("%w: %s allows %d calls per %s", ErrRateLimited, tool, limit.Calls, limit.Per)
+		}
+		matched = append(matched, i)
+	}
+	for _, i := range matched {
+		key := fmt.Sprintf("%d\x00%s", i, tool)
+		g.calls[key] = append(g.calls[key], now)
+	}
+
+	// The call after the cooldown is the probe of a half-open circuit
+	if c := g.circuits[tool]; c != nil && !c.openedAt.IsZero() {
+		c.probing = true
+	}
+	return nil
+}
+
+// Done records the outcome of a call Allow let through
+func (g *ToolGuard) Done(tool string, failed bool) {
+	if g == nil {
+		return
+	}
+	breaker := g.breaker(tool)
+	if breaker == nil {
+		return
+	}
+	now := g.now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c := g.circuits[tool]
+	if c == nil {
+		if !failed {
+			return
+		}
+		c = &circuit{}
+		g.circuits[tool] = c
+	}
+
+	if c.probing {
+		c.probing = false
+		if failed {
+			c.openedAt = now
+		} else {
+			delete(g.circuits, tool)
+		}
+		return
+	}
+	if !failed {
+		return
+	}
+	c.failures = append(pruneCalls(c.failures, now.Add(-breaker.Window)), now)
+	if len(c.failures) >= breaker.Failures && c.openedAt.IsZero() {
+		c.openedAt = now
+		c.failures = nil
+	}
+}
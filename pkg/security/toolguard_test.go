@@ -0,0 +1,96 @@
+// ABOUTME: Tests for per-tool rate limits and circuit breakers
+// ABOUTME: Validates separate tool budgets, opening after failures, half-open probes, and nil guards
+
+package security
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestToolGuardLimits(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := NewToolGuard([]ToolLimit{{Tool: "web_*", Calls: 2, Per: time.Minute}}, nil)
+	g.now = func() time.Time { return now }
+
+	// Each matching tool has its own budget
+	for _, tool := range []string{"web_fetch", "web_fetch", "web_search", "web_search", "file_read", "file_read", "file_read"} {
+		if err := g.Allow(tool); err != nil {
+			t.Fatalf("%s should be allowed: %v", tool, err)
+		}
+		g.Done(tool, false)
+	}
+	if err := g.Allow("web_fetch"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected ErrRateLimited, got %v", err)
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	if err := g.Allow("web_fetch"); err != nil {
+		t.Errorf("Expected a call after the window passed: %v", err)
+	}
+}
+
+func TestToolGuardCircuitBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := NewToolGuard(nil, []CircuitBreaker{{Tool: "*", Failures: 3, Window: time.Minute, Cooldown: 30 * time.Second}})
+	g.now = func() time.Time { return now }
+
+	call := func(tool string, failed bool) error {
+		t.Helper()
+		if err := g.Allow(tool); err != nil {
+			return err
+		}
+		g.Done(tool, failed)
+		return nil
+	}
+
+	// Failures spread beyond the window do not open the circuit
+	call("flaky", true)
+	call("flaky", true)
+	now = now.Add(2 * time.Minute)
+	call("flaky", true)
+	if err := call("flaky", false); err != nil {
+		t.Fatalf("Expected the circuit to stay closed: %v", err)
+	}
+
+	call("flaky", true)
+	call("flaky", true)
+	if err := g.Allow("flaky"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if err := call("steady", false); err != nil {
+		t.Errorf("Other tools have circuits of their own: %v", err)
+	}
+
+	// After the cooldown one probe goes through; while it runs, and after
+	// it fails, the tool is refused again
+	now = now.Add(31 * time.Second)
+	if err := g.Allow("flaky"); err != nil {
+		t.Fatalf("Expected a probe after the cooldown: %v", err)
+	}
+	if err := g.Allow("flaky"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected only one probe, got %v", err)
+	}
+	g.Done("flaky", true)
+	if err := g.Allow("flaky"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected a failed probe to open the circuit again, got %v", err)
+	}
+
+	// A successful probe closes the circuit
+	now = now.Add(31 * time.Second)
+	if err := call("flaky", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := call("flaky", true); err != nil {
+		t.Errorf("Expected the circuit to be closed, got %v", err)
+	}
+}
+
+func TestToolGuardNil(t *testing.T) {
+	var g *ToolGuard
+	if err := g.Allow("anything"); err != nil {
+		t.Errorf("A nil guard should allow every call: %v", err)
+	}
+	g.Done("anything", true)
+}
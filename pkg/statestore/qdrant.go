@@ -0,0 +1,292 @@
+// ABOUTME: VectorStore keeping vector records in Qdrant through its REST API, a collection per namespace
+// ABOUTME: Collections are created with cosine distance on first upsert; record IDs map to UUIDs Qdrant accepts
+
+package statestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+)
+
+// qdrantTimeout bounds each request, so an unreachable server fails a
+// call instead of hanging the spell
+const qdrantTimeout = 30 * time.Second
+
+// errQdrantNotFound is returned for a collection that does not exist
+var errQdrantNotFound = errors.New("not found")
+
+// QdrantOptions configure a QdrantVectorStore
+type QdrantOptions struct {
+	// URL is the root of the REST API, as in http://localhost:6333
+	URL string
+
+	// APIKey is sent in the api-key header when set
+	APIKey string
+
+	// Prefix starts the name of every collection; defaults to "llmspell_"
+	Prefix string
+
+	// Client sends requests; defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// QdrantVectorStore keeps each namespace in a Qdrant collection named
+// <prefix><namespace>, which instances anywhere can share
+type QdrantVectorStore struct {
+	opts QdrantOptions
+
+	mu      sync.Mutex
+	created map[string]bool
+}
+
+// NewQdrantVectorStore uses the Qdrant server opts names
+func NewQdrantVectorStore(opts QdrantOptions) *QdrantVectorStore {
+	if opts.Prefix == "" {
+		opts.Prefix = "llmspell_"
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	opts.URL = strings.TrimSuffix(opts.URL, "/")
+	return &QdrantVectorStore{opts: opts, created: make(map[string]bool)}
+}
+
+// qdrantPayload is what a point carries besides its vector
+type qdrantPayload struct {
+	ID       string                 `json:"id"`
+	Text     string                 `json:"text,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Upsert stores records, creating the namespace's collection with the
+// dimension of the first record when it does not exist
+func (q *QdrantVectorStore) Upsert(ctx context.Context, namespace string, records []bridge.VectorRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	collection := q.collection(namespace)
+	if err := q.ensureCollection(ctx, collection, len(records[0].Vector)); err != nil {
+		return err
+	}
+
+	type point struct {
+		ID      string        `json:"id"`
+		Vector  []float64     `json:"vector"`
+		Payload qdrantPayload `json:"payload"`
+	}
+	points := make([]point, len(records))
+	for i, record := range records {
+		points[i] = point{
+			ID:      qdrantPointID(record.ID),
+			Vector:  record.Vector,
+			Payload: qdrantPayload{ID: record.ID, Text: record.Text, Metadata: record.Metadata},
+		}
+	}
+	return q.do(ctx, "PUT", "/collections/"+collection+"/points?wait=true", map[string]interface{}{"points": points}, nil)
+}
+
+// Query searches the namespace's collection
+func (q *QdrantVectorStore) Query(ctx context.Context, namespace string, query bridge.VectorQuery) ([]bridge.VectorMatch, error) {
+	body := map[string]interface{}{
+		"vector":       query.Vector,
+		"limit":        query.TopK,
+		"with_payload": true,
+		"with_vector":  true,
+	}
+	if len(query.Filter) > 0 {
+		filter, err := qdrantFilter(query.Filter)
+		if err != nil {
+			return nil, err
+		}
+		body["filter"] = filter
+	}
+
+	var result []struct {
+		Score   float64       `json:"score"`
+		Vector  []float64     `json:"vector"`
+		Payload qdrantPayload `json:"payload"`
+	}
+	err := q.do(ctx, "POST", "/collections/"+q.collection(namespace)+"/points/search", body, &result)
+	if errors.Is(err, errQdrantNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]bridge.VectorMatch, len(result))
+	for i, point := range result {
+		matches[i] = bridge.VectorMatch{
+			VectorRecord: bridge.VectorRecord{
+				ID:       point.Payload.ID,
+				Vector:   point.Vector,
+				Text:     point.Payload.Text,
+				Metadata: point.Payload.Metadata,
+			},
+			Score: point.Score,
+		}
+	}
+	return matches, nil
+}
+
+// Delete removes records by ID
+func (q *QdrantVectorStore) Delete(ctx context.Context, namespace string, ids []string) error {
+	points := make([]string, len(ids))
+	for i, id := range ids {
+		points[i] = qdrantPointID(id)
+	}
+	err := q.do(ctx, "POST", "/collections/"+q.collection(namespace)+"/points/delete?wait=true", map[string]interface{}{"points": points}, nil)
+	if errors.Is(err, errQdrantNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Namespaces lists the namespaces that have a collection
+func (q *QdrantVectorStore) Namespaces(ctx context.Context) ([]string, error) {
+	var result struct {
+		Collections []struct {
+			Name string `json:"name"`
+		} `json:"collections"`
+	}
+	if err := q.do(ctx, "GET", "/collections", nil, &result); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, collection := range result.Collections {
+		if name, ok := strings.CutPrefix(collection.Name, q.opts.Prefix); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Drop deletes the namespace's collection
+func (q *QdrantVectorStore) Drop(ctx context.Context, namespace string) error {
+	collection := q.collection(namespace)
+	q.mu.Lock()
+	delete(q.created, collection)
+	q.mu.Unlock()
+
+	err := q.do(ctx, "DELETE", "/collections/"+collection, nil, nil)
+	if errors.Is(err, errQdrantNotFound) {
+		return nil
+	}
+	return err
+}
+
+// collection returns the name of namespace's collection
+func (q *QdrantVectorStore) collection(namespace string) string {
+	return q.opts.Prefix + namespace
+}
+
+// ensureCollection creates collection for vectors of size unless it
+// exists; collections known to exist are not checked again
+func (q *QdrantVectorStore) ensureCollection(ctx context.Context, collection string, size int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.created[collection] {
+		return nil
+	}
+	err := q.do(ctx, "GET", "/collections/"+collection, nil, nil)
+	if errors.Is(err, errQdrantNotFound) {
+		config := map[string]interface{}{"vectors": map[string]interface{}{"size": size, "distance": "Cosine"}}
+		err = q.do(ctx, "PUT", "/collections/"+collection, config, nil)
+	}
+	if err != nil {
+		return err
+	}
+	q.created[collection] = true
+	return nil
+}
+
+// do sends a request and decodes the result of the response into out.
+// A 404 is returned as errQdrantNotFound.
+func (q *QdrantVectorStore) do(ctx context.Context, method, path string, body, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, qdrantTimeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, q.opts.URL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if q.opts.APIKey != "" {
+		req.Header.Set("api-key", q.opts.APIKey)
+	}
+
+	resp, err := q.opts.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("qdrant %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if resp.StatusCode == http.StatusNotFound {
+		return errQdrantNotFound
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("qdrant %s %s: status %d: %s", method, path, resp.StatusCode, bytes.TrimSpace(data[:min(len(data), 512)]))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("qdrant %s %s: %w", method, path, err)
+	}
+	return json.Unmarshal(envelope.Result, out)
+}
+
+// qdrantFilter turns an equality filter on metadata into Qdrant's form
+func qdrantFilter(filter map[string]interface{}) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(filter))
+	for key := range filter {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	must := make([]interface{}, len(keys))
+	for i, key := range keys {
+		switch filter[key].(type) {
+		case string, bool, float64, int, int64:
+		default:
+			return nil, fmt.Errorf("filter %s: qdrant matches only strings, numbers, and booleans", key)
+		}
+		must[i] = map[string]interface{}{"key": "metadata." + key, "match": map[string]interface{}{"value": filter[key]}}
+	}
+	return map[string]interface{}{"must": must}, nil
+}
+
+// qdrantPointID turns a record ID into the UUID Qdrant identifies points
+// by, the same for the same ID
+func qdrantPointID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
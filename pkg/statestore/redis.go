@@ -0,0 +1,120 @@
+// ABOUTME: StateStore keeping saved spell state in Redis, a hash of versions per state
+// ABOUTME: HSETNX saves a version only if no instance saved it first; a set lists the states
+
+package statestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisPrefix starts the keys RedisStore uses unless given another
+const DefaultRedisPrefix = "llmspell:"
+
+// redisTimeout bounds each command, so an unreachable server fails a save
+// instead of hanging the spell
+const redisTimeout = 10 * time.Second
+
+// RedisStore keeps saved states in Redis: the versions of a state in the
+// hash <prefix>state:<name>, keyed by version, and the names in the set
+// <prefix>states
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore keeps states through client under keys starting with prefix
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Close closes the client
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
+
+// Names lists the states with at least one version
+func (r *RedisStore) Names() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	names, err := r.client.SMembers(ctx, r.prefix+"states").Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Versions lists the versions of a state, oldest first
+func (r *RedisStore) Versions(name string) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	fields, err := r.client.HKeys(ctx, r.key(name)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]int, 0, len(fields))
+	for _, field := range fields {
+		if version, err := strconv.Atoi(field); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// Read returns the data of a version
+func (r *RedisStore) Read(name string, version int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	data, err := r.client.HGet(ctx, r.key(name), strconv.Itoa(version)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("%w: %s version %d", bridge.ErrStateNotFound, name, version)
+	}
+	return data, err
+}
+
+// Create stores a new version
+func (r *RedisStore) Create(name string, version int, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	created, err := r.client.HSetNX(ctx, r.key(name), strconv.Itoa(version), data).Result()
+	if err != nil {
+		return err
+	}
+	if !created {
+		return fmt.Errorf("%w: %s version %d", bridge.ErrVersionExists, name, version)
+	}
+	return r.client.SAdd(ctx, r.prefix+"states", name).Err()
+}
+
+// Remove deletes a version, and the state's name with its last one
+func (r *RedisStore) Remove(name string, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := r.client.HDel(ctx, r.key(name), strconv.Itoa(version)).Err(); err != nil {
+		return err
+	}
+	// Redis drops a hash with its last field
+	left, err := r.client.Exists(ctx, r.key(name)).Result()
+	if err != nil || left > 0 {
+		return err
+	}
+	return r.client.SRem(ctx, r.prefix+"states", name).Err()
+}
+
+// key returns the hash holding the versions of name
+func (r *RedisStore) key(name string) string {
+	return r.prefix + "state:" + name
+}
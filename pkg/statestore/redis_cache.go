@@ -0,0 +1,112 @@
+// ABOUTME: ResponseStore keeping cached LLM responses in Redis, one key per entry with Redis expiring it
+// ABOUTME: OpenResponseStore picks a directory or Redis backend for the response cache from a location URL
+
+package statestore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisScanCount is how many keys each SCAN asks for
+const redisScanCount = 100
+
+// RedisResponseStore keeps cached responses in Redis under the keys
+// <prefix>llm:<key>
+type RedisResponseStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisResponseStore keeps responses through client under keys starting
+// with prefix
+func NewRedisResponseStore(client *redis.Client, prefix string) *RedisResponseStore {
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	return &RedisResponseStore{client: client, prefix: prefix + "llm:"}
+}
+
+// Close closes the client
+func (r *RedisResponseStore) Close() error {
+	return r.client.Close()
+}
+
+// Get returns the value of key; Redis has already dropped expired ones
+func (r *RedisResponseStore) Get(key string) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	data, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	return data, err == nil
+}
+
+// Set stores value under key for ttl, or until purged when ttl is zero
+func (r *RedisResponseStore) Set(key string, value []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return r.client.Set(ctx, r.prefix+key, value, ttl).Err()
+}
+
+// Delete removes key
+func (r *RedisResponseStore) Delete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	r.client.Del(ctx, r.prefix+key)
+}
+
+// Keys lists the keys of the cached responses
+func (r *RedisResponseStore) Keys() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	var keys []string
+	iter := r.client.Scan(ctx, 0, r.prefix+"*", redisScanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, strings.TrimPrefix(iter.Val(), r.prefix))
+	}
+	return keys, iter.Err()
+}
+
+// Purge deletes every cached response
+func (r *RedisResponseStore) Purge() (int, error) {
+	keys, err := r.Keys()
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = r.prefix + key
+	}
+	deleted, err := r.client.Del(ctx, full...).Result()
+	return int(deleted), err
+}
+
+// OpenResponseStore returns the response cache store at location: a
+// directory, file:///path/to/dir, or redis://[:password@]host:port/db with
+// ?prefix= setting the key prefix
+func OpenResponseStore(location string) (bridge.ResponseStore, error) {
+	scheme, rest, found := strings.Cut(location, "://")
+	if !found {
+		return bridge.NewFileResponseStore(location), nil
+	}
+
+	switch scheme {
+	case "file":
+		return bridge.NewFileResponseStore(rest), nil
+	case "redis", "rediss":
+		opts, prefix, err := redisOptions(location)
+		if err != nil {
+			return nil, fmt.Errorf("response cache %q: %w", location, err)
+		}
+		return NewRedisResponseStore(redis.NewClient(opts), prefix), nil
+	}
+	return nil, fmt.Errorf("response cache %q: unknown scheme %q, use a directory or redis://", location, scheme)
+}
@@ -0,0 +1,268 @@
+// ABOUTME: StateStore keeping saved spell state as objects in an S3 bucket or compatible store
+// ABOUTME: Conditional puts save a version only if no instance saved it first; listings find the rest
+
+package statestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+)
+
+// s3Timeout bounds each request, so an unreachable bucket fails a save
+// instead of hanging the spell
+const s3Timeout = 30 * time.Second
+
+// S3Options configure an S3Store
+type S3Options struct {
+	Bucket string
+
+	// Prefix starts the key of every object, as in "team/state/"
+	Prefix string
+
+	// Region signs requests; defaults to us-east-1
+	Region string
+
+	// Endpoint is the URL of an S3-compatible store, such as MinIO, which
+	// is addressed path-style; empty for AWS
+	Endpoint string
+
+	// Credentials sign requests; requests are anonymous without an access
+	// key
+	Credentials aws.Credentials
+
+	// Client sends requests; defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// S3Store keeps saved states as objects <prefix><name>/<version>.json,
+// which instances anywhere can share
+type S3Store struct {
+	opts   S3Options
+	signer *v4.Signer
+}
+
+// NewS3Store keeps states in the bucket opts names
+func NewS3Store(opts S3Options) *S3Store {
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	return &S3Store{opts: opts, signer: v4.NewSigner()}
+}
+
+// Names lists the states with at least one version
+func (s *S3Store) Names() ([]string, error) {
+	_, prefixes, err := s.list(s.opts.Prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		names = append(names, strings.TrimSuffix(strings.TrimPrefix(prefix, s.opts.Prefix), "/"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Versions lists the versions of a state, oldest first
+func (s *S3Store) Versions(name string) ([]int, error) {
+	prefix := s.opts.Prefix + name + "/"
+	keys, _, err := s.list(prefix, "")
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int, 0, len(keys))
+	for _, key := range keys {
+		base := strings.TrimSuffix(strings.TrimPrefix(key, prefix), ".json")
+		if version, err := strconv.Atoi(base); err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// Read returns the data of a version
+func (s *S3Store) Read(name string, version int) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, s.key(name, version), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s version %d", bridge.ErrStateNotFound, name, version)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Create stores a new version with a put that fails if the object exists
+func (s *S3Store) Create(name string, version int, data []byte) error {
+	header := http.Header{"If-None-Match": {"*"}}
+	resp, err := s.do(http.MethodPut, s.key(name, version), nil, header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// A conflict is another put of the same version still in flight
+		return fmt.Errorf("%w: %s version %d", bridge.ErrVersionExists, name, version)
+	}
+	return s3Error(resp)
+}
+
+// Remove deletes a version
+func (s *S3Store) Remove(name string, version int) error {
+	resp, err := s.do(http.MethodDelete, s.key(name, version), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// key returns the object holding a version
+func (s *S3Store) key(name string, version int) string {
+	return s.opts.Prefix + name + "/" + strconv.Itoa(version) + ".json"
+}
+
+// listResult is the part of a ListObjectsV2 response the store reads
+type listResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct{ Key string }
+	CommonPrefixes        []struct{ Prefix string }
+}
+
+// list returns the keys under prefix, and with a delimiter the common
+// prefixes up to it, following every page
+func (s *S3Store) list(prefix, delimiter string) (keys, prefixes []string, err error) {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	for {
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error(resp)
+			resp.Body.Close()
+			return nil, nil, err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot read bucket listing: %w", err)
+		}
+
+		for _, content := range result.Contents {
+			keys = append(keys, content.Key)
+		}
+		for _, common := range result.CommonPrefixes {
+			prefixes = append(prefixes, common.Prefix)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, prefixes, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// do sends a signed request for key, or for the bucket when key is empty
+func (s *S3Store) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+
+	req, err := http.NewRequestWithContext(ctx, method, s.url(key, query), bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.opts.Credentials.AccessKeyID != "" {
+		sum := sha256.Sum256(body)
+		payloadHash := hex.EncodeToString(sum[:])
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+		if err := s.signer.SignHTTP(ctx, s.opts.Credentials, req, payloadHash, "s3", s.opts.Region, time.Now()); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// url returns the URL of key: path-style at an endpoint, and
+// virtual-hosted at AWS
+func (s *S3Store) url(key string, query url.Values) string {
+	u := &url.URL{Scheme: "https", Host: s.opts.Bucket + ".s3." + s.opts.Region + ".amazonaws.com", Path: "/" + key}
+	if s.opts.Endpoint != "" {
+		endpoint, err := url.Parse(s.opts.Endpoint)
+		if err == nil {
+			u.Scheme, u.Host = endpoint.Scheme, endpoint.Host
+			u.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + s.opts.Bucket + "/" + key
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// cancelBody ends a request's timeout once its response is read
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// s3Error describes a failed request from its status and error code
+func s3Error(resp *http.Response) error {
+	var body struct {
+		Code    string
+		Message string
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		return fmt.Errorf("s3 %s %s: %s: %s", resp.Request.Method, resp.Request.URL.Path, body.Code, body.Message)
+	}
+	return fmt.Errorf("s3 %s %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status)
+}
@@ -0,0 +1,132 @@
+// ABOUTME: StateStore keeping saved spell state in a SQLite database, one row per version
+// ABOUTME: The primary key on name and version makes a version that exists fail to save again
+
+package statestore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore keeps saved states in a table of a SQLite database, which
+// instances on one host can share
+type SQLiteStore struct {
+	db *sql.DB
+
+	// The table is created before the first use
+	once    sync.Once
+	initErr error
+}
+
+// NewSQLiteStore opens the database at path, which is created when the
+// first state is saved
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	// Waiting on a lock beats failing when another instance is writing
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// init creates the table if it does not exist yet
+func (s *SQLiteStore) init() error {
+	s.once.Do(func() {
+		_, s.initErr = s.db.Exec(`CREATE TABLE IF NOT EXISTS llmspell_state (
+			name TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			data BLOB NOT NULL,
+			PRIMARY KEY (name, version)
+		)`)
+	})
+	return s.initErr
+}
+
+// Names lists the states with at least one version
+func (s *SQLiteStore) Names() ([]string, error) {
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT DISTINCT name FROM llmspell_state ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Versions lists the versions of a state, oldest first
+func (s *SQLiteStore) Versions(name string) ([]int, error) {
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT version FROM llmspell_state WHERE name = ? ORDER BY version`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// Read returns the data of a version
+func (s *SQLiteStore) Read(name string, version int) ([]byte, error) {
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM llmspell_state WHERE name = ? AND version = ?`, name, version).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s version %d", bridge.ErrStateNotFound, name, version)
+	}
+	return data, err
+}
+
+// Create stores a new version
+func (s *SQLiteStore) Create(name string, version int, data []byte) error {
+	if err := s.init(); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO llmspell_state (name, version, data) VALUES (?, ?, ?)`, name, version, data)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		return fmt.Errorf("%w: %s version %d", bridge.ErrVersionExists, name, version)
+	}
+	return err
+}
+
+// Remove deletes a version
+func (s *SQLiteStore) Remove(name string, version int) error {
+	if err := s.init(); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`DELETE FROM llmspell_state WHERE name = ? AND version = ?`, name, version)
+	return err
+}
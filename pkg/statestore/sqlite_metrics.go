@@ -0,0 +1,114 @@
+// ABOUTME: ToolMetricsStore keeping tool statistics of past runs in a SQLite database, one row per tool per run
+// ABOUTME: Rows are indexed by time, so reports over recent windows and pruning old rows stay fast
+
+package statestore
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+)
+
+// SQLiteToolMetrics keeps tool statistics in a table of a SQLite
+// database, which the runs on one host share
+type SQLiteToolMetrics struct {
+	db *sql.DB
+
+	// The table is created before the first use
+	once    sync.Once
+	initErr error
+}
+
+// NewSQLiteToolMetrics opens the database at path, which is created when
+// the first run is recorded
+func NewSQLiteToolMetrics(path string) (*SQLiteToolMetrics, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteToolMetrics{db: db}, nil
+}
+
+// Close closes the database
+func (s *SQLiteToolMetrics) Close() error {
+	return s.db.Close()
+}
+
+// init creates the table and its index if they do not exist yet
+func (s *SQLiteToolMetrics) init() error {
+	s.once.Do(func() {
+		_, s.initErr = s.db.Exec(`CREATE TABLE IF NOT EXISTS llmspell_tool_runs (
+			run_id TEXT NOT NULL,
+			spell TEXT NOT NULL,
+			time INTEGER NOT NULL,
+			tool TEXT NOT NULL,
+			calls INTEGER NOT NULL,
+			failures INTEGER NOT NULL,
+			cache_hits INTEGER NOT NULL,
+			duration_ns INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS llmspell_tool_runs_time ON llmspell_tool_runs (time)`)
+	})
+	return s.initErr
+}
+
+// RecordToolRuns adds the statistics of a run in one transaction
+func (s *SQLiteToolMetrics) RecordToolRuns(runs []bridge.ToolRun) error {
+	if err := s.init(); err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, run := range runs {
+		if _, err := tx.Exec(`INSERT INTO llmspell_tool_runs (run_id, spell, time, tool, calls, failures, cache_hits, duration_ns)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			run.RunID, run.Spell, run.Time.UnixNano(), run.Name, run.Calls, run.Failures, run.CacheHits, int64(run.Duration)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ToolRuns returns the statistics recorded at or after since, oldest first
+func (s *SQLiteToolMetrics) ToolRuns(since time.Time) ([]bridge.ToolRun, error) {
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT run_id, spell, time, tool, calls, failures, cache_hits, duration_ns
+		FROM llmspell_tool_runs WHERE time >= ? ORDER BY time, rowid`, since.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []bridge.ToolRun
+	for rows.Next() {
+		var run bridge.ToolRun
+		var at, duration int64
+		if err := rows.Scan(&run.RunID, &run.Spell, &at, &run.Name, &run.Calls, &run.Failures, &run.CacheHits, &duration); err != nil {
+			return nil, err
+		}
+		run.Time = time.Unix(0, at)
+		run.Duration = time.Duration(duration)
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// PruneToolRuns deletes the statistics recorded before before
+func (s *SQLiteToolMetrics) PruneToolRuns(before time.Time) (int, error) {
+	if err := s.init(); err != nil {
+		return 0, err
+	}
+	result, err := s.db.Exec(`DELETE FROM llmspell_tool_runs WHERE time < ?`, before.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
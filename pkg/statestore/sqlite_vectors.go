@@ -0,0 +1,183 @@
+// ABOUTME: VectorStore keeping vector records in a SQLite database, one row per record
+// ABOUTME: Vectors are stored as float64 blobs and ranked in Go, without needing the sqlite-vec extension
+
+package statestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+)
+
+// SQLiteVectorStore keeps vector records in a table of a SQLite database.
+// A query reads every record of its namespace and ranks them with
+// bridge.RankRecords, which suits the thousands of chunks a spell indexes
+// rather than millions.
+type SQLiteVectorStore struct {
+	db *sql.DB
+
+	// The table is created before the first use
+	once    sync.Once
+	initErr error
+}
+
+// NewSQLiteVectorStore opens the database at path, which is created when
+// the first record is stored
+func NewSQLiteVectorStore(path string) (*SQLiteVectorStore, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteVectorStore{db: db}, nil
+}
+
+// Close closes the database
+func (s *SQLiteVectorStore) Close() error {
+	return s.db.Close()
+}
+
+// init creates the table if it does not exist yet
+func (s *SQLiteVectorStore) init() error {
+	s.once.Do(func() {
+		_, s.initErr = s.db.Exec(`CREATE TABLE IF NOT EXISTS llmspell_vectors (
+			namespace TEXT NOT NULL,
+			id TEXT NOT NULL,
+			vector BLOB NOT NULL,
+			text TEXT NOT NULL DEFAULT '',
+			metadata TEXT NOT NULL DEFAULT '{}',
+			PRIMARY KEY (namespace, id)
+		)`)
+	})
+	return s.initErr
+}
+
+// Upsert stores records, replacing those with the same IDs, in one
+// transaction
+func (s *SQLiteVectorStore) Upsert(ctx context.Context, namespace string, records []bridge.VectorRecord) error {
+	if err := s.init(); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, record := range records {
+		metadata, err := json.Marshal(record.Metadata)
+		if err != nil {
+			return fmt.Errorf("record %s: %w", record.ID, err)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO llmspell_vectors (namespace, id, vector, text, metadata)
+			VALUES (?, ?, ?, ?, ?)`, namespace, record.ID, encodeVector(record.Vector), record.Text, string(metadata))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Query ranks the records of namespace against query
+func (s *SQLiteVectorStore) Query(ctx context.Context, namespace string, query bridge.VectorQuery) ([]bridge.VectorMatch, error) {
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, vector, text, metadata FROM llmspell_vectors WHERE namespace = ? ORDER BY id`, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []bridge.VectorRecord
+	for rows.Next() {
+		var record bridge.VectorRecord
+		var vector []byte
+		var metadata string
+		if err := rows.Scan(&record.ID, &vector, &record.Text, &metadata); err != nil {
+			return nil, err
+		}
+		record.Vector = decodeVector(vector)
+		if err := json.Unmarshal([]byte(metadata), &record.Metadata); err != nil {
+			return nil, fmt.Errorf("record %s: %w", record.ID, err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return bridge.RankRecords(records, query)
+}
+
+// Delete removes records by ID
+func (s *SQLiteVectorStore) Delete(ctx context.Context, namespace string, ids []string) error {
+	if err := s.init(); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM llmspell_vectors WHERE namespace = ? AND id = ?`, namespace, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Namespaces lists the namespaces with records
+func (s *SQLiteVectorStore) Namespaces(ctx context.Context) ([]string, error) {
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT namespace FROM llmspell_vectors ORDER BY namespace`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Drop deletes a namespace
+func (s *SQLiteVectorStore) Drop(ctx context.Context, namespace string) error {
+	if err := s.init(); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM llmspell_vectors WHERE namespace = ?`, namespace)
+	return err
+}
+
+// encodeVector packs a vector as little-endian float64s
+func encodeVector(vector []float64) []byte {
+	data := make([]byte, 8*len(vector))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(value))
+	}
+	return data
+}
+
+// decodeVector unpacks a vector packed by encodeVector
+func decodeVector(data []byte) []float64 {
+	vector := make([]float64, len(data)/8)
+	for i := range vector {
+		vector[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[8*i:]))
+	}
+	return vector
+}
@@ -0,0 +1,144 @@
+// ABOUTME: Backends beyond the file system for saved spell state, so instances can share it
+// ABOUTME: Open picks a directory, SQLite, Redis, or S3 backend from a location URL; OpenVectorStore does so for vectors
+
+package statestore
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/redis/go-redis/v9"
+)
+
+// Open returns the store at location:
+//
+//	/path/to/dir or file:///path/to/dir     files in a directory
+//	sqlite:///path/to/state.db               a SQLite database
+//	redis://[:password@]host:port/db         Redis; ?prefix= sets the key prefix
+//	s3://bucket/prefix                       S3; ?region= and ?endpoint= as for S3Options
+//
+// S3 credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and
+// AWS_SESSION_TOKEN, and the region from AWS_REGION without ?region=.
+func Open(location string) (bridge.StateStore, error) {
+	scheme, rest, found := strings.Cut(location, "://")
+	if !found {
+		return bridge.NewFileStateStore(location), nil
+	}
+
+	switch scheme {
+	case "file":
+		return bridge.NewFileStateStore(rest), nil
+	case "sqlite", "sqlite3":
+		if rest == "" {
+			return nil, fmt.Errorf("state store %q: missing database path", location)
+		}
+		return NewSQLiteStore(rest)
+	case "redis", "rediss":
+		return openRedis(location)
+	case "s3":
+		return openS3(location)
+	}
+	return nil, fmt.Errorf("state store %q: unknown scheme %q, use a directory, sqlite://, redis://, or s3://", location, scheme)
+}
+
+// OpenVectorStore returns the vector store at location:
+//
+//	memory                                   in memory, for the run only
+//	sqlite:///path/to/vectors.db             a SQLite database
+//	qdrant://host:port or qdrants://host     Qdrant over HTTP or HTTPS; ?prefix= sets the collection prefix
+//
+// The Qdrant API key comes from QDRANT_API_KEY.
+func OpenVectorStore(location string) (bridge.VectorStore, error) {
+	if location == "memory" {
+		return bridge.NewMemoryVectorStore(), nil
+	}
+	scheme, rest, found := strings.Cut(location, "://")
+	if !found {
+		return nil, fmt.Errorf("vector store %q: use memory, sqlite://, or qdrant://", location)
+	}
+
+	switch scheme {
+	case "sqlite", "sqlite3":
+		if rest == "" {
+			return nil, fmt.Errorf("vector store %q: missing database path", location)
+		}
+		return NewSQLiteVectorStore(rest)
+	case "qdrant", "qdrants":
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("vector store %q: %w", location, err)
+		}
+		u.Scheme = "http"
+		if scheme == "qdrants" {
+			u.Scheme = "https"
+		}
+		prefix := u.Query().Get("prefix")
+		u.RawQuery = ""
+		return NewQdrantVectorStore(QdrantOptions{URL: u.String(), APIKey: os.Getenv("QDRANT_API_KEY"), Prefix: prefix}), nil
+	case "postgres", "postgresql":
+		return nil, fmt.Errorf("vector store %q: pgvector needs a PostgreSQL driver, which this build does not include", location)
+	}
+	return nil, fmt.Errorf("vector store %q: unknown scheme %q, use memory, sqlite://, or qdrant://", location, scheme)
+}
+
+// openRedis opens a Redis store
+func openRedis(location string) (bridge.StateStore, error) {
+	opts, prefix, err := redisOptions(location)
+	if err != nil {
+		return nil, fmt.Errorf("state store %q: %w", location, err)
+	}
+	return NewRedisStore(redis.NewClient(opts), prefix), nil
+}
+
+// redisOptions parses a Redis URL, taking the key prefix out of it before
+// the client reads the rest
+func redisOptions(location string) (*redis.Options, string, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, "", err
+	}
+	query := u.Query()
+	prefix := query.Get("prefix")
+	query.Del("prefix")
+	u.RawQuery = query.Encode()
+
+	opts, err := redis.ParseURL(u.String())
+	if err != nil {
+		return nil, "", err
+	}
+	return opts, prefix, nil
+}
+
+// openS3 opens an S3 store with credentials from the environment
+func openS3(location string) (bridge.StateStore, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("state store %q: %w", location, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("state store %q: missing bucket", location)
+	}
+
+	opts := S3Options{
+		Bucket:   u.Host,
+		Prefix:   strings.TrimPrefix(u.Path, "/"),
+		Region:   u.Query().Get("region"),
+		Endpoint: u.Query().Get("endpoint"),
+		Credentials: aws.Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		},
+	}
+	if opts.Region == "" {
+		opts.Region = os.Getenv("AWS_REGION")
+	}
+	if opts.Prefix != "" && !strings.HasSuffix(opts.Prefix, "/") {
+		opts.Prefix += "/"
+	}
+	return NewS3Store(opts), nil
+}
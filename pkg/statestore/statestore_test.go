@@ -0,0 +1,589 @@
+// ABOUTME: Tests that every saved state backend behaves alike: files, a temp database,
+// ABOUTME: an in-memory Redis, and a fake S3 server; plus choosing a backend from a URL
+
+package statestore
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/lexlapax/go-llmspell/pkg/bridge"
+	"github.com/redis/go-redis/v9"
+)
+
+// testStore checks the StateStore contract, then that SavedStates works on
+// the store
+func testStore(t *testing.T, store bridge.StateStore) {
+	t.Helper()
+
+	if names, err := store.Names(); err != nil || len(names) != 0 {
+		t.Fatalf("Names() of an empty store = %v, %v", names, err)
+	}
+	if versions, err := store.Versions("job"); err != nil || len(versions) != 0 {
+		t.Fatalf("Versions() of a missing state = %v, %v", versions, err)
+	}
+	if _, err := store.Read("job", 1); !errors.Is(err, bridge.ErrStateNotFound) {
+		t.Fatalf("Read() of a missing version error = %v, want ErrStateNotFound", err)
+	}
+
+	for _, version := range []int{2, 1, 10} {
+		if err := store.Create("job", version, []byte(`{"v":1}`)); err != nil {
+			t.Fatalf("Create(%d) error = %v", version, err)
+		}
+	}
+	if err := store.Create("job", 2, []byte("other")); !errors.Is(err, bridge.ErrVersionExists) {
+		t.Errorf("Create() of an existing version error = %v, want ErrVersionExists", err)
+	}
+	if data, err := store.Read("job", 2); err != nil || string(data) != `{"v":1}` {
+		t.Errorf("Read() = %q, %v, want the first data saved", data, err)
+	}
+	if versions, _ := store.Versions("job"); !reflect.DeepEqual(versions, []int{1, 2, 10}) {
+		t.Errorf("Versions() = %v, want [1 2 10]", versions)
+	}
+	if err := store.Create("other", 1, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := store.Names(); !reflect.DeepEqual(names, []string{"job", "other"}) {
+		t.Errorf("Names() = %v, want [job other]", names)
+	}
+
+	for _, version := range []int{1, 2, 10, 10} {
+		if err := store.Remove("job", version); err != nil {
+			t.Errorf("Remove(%d) error = %v", version, err)
+		}
+	}
+	if names, _ := store.Names(); !reflect.DeepEqual(names, []string{"other"}) {
+		t.Errorf("Names() after removing every version of job = %v", names)
+	}
+	if err := store.Remove("other", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saved states on top: compressed data goes through as it is
+	saved := bridge.NewSavedStates(store, bridge.SavedStatesOptions{Compress: true, Keep: 2})
+	state := bridge.NewSharedState()
+	for i := 1; i <= 3; i++ {
+		state.Set("step", float64(i))
+		if version, err := saved.Persist("run", state); err != nil || version != i {
+			t.Fatalf("Persist() = %d, %v, want version %d", version, err, i)
+		}
+	}
+	loaded := bridge.NewSharedState()
+	if version, err := saved.Load("run", 0, loaded); err != nil || version != 3 {
+		t.Fatalf("Load() = %d, %v, want version 3", version, err)
+	}
+	if step, _ := loaded.Get("step"); step != float64(3) {
+		t.Errorf("step = %v, want 3", step)
+	}
+	if list, _ := saved.List(); len(list) != 1 || !reflect.DeepEqual(list[0].Versions, []int{2, 3}) {
+		t.Errorf("List() = %+v, want run with versions 2 and 3", list)
+	}
+
+	// Instances saving at once each get their own version
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			other := bridge.NewSavedStates(store, bridge.SavedStatesOptions{})
+			if _, err := other.Persist("race", bridge.NewSharedState()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if versions, _ := store.Versions("race"); !reflect.DeepEqual(versions, []int{1, 2, 3, 4}) {
+		t.Errorf("Versions() after concurrent saves = %v, want [1 2 3 4]", versions)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	testStore(t, bridge.NewFileStateStore(t.TempDir()))
+}
+
+func TestSQLiteStore(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	testStore(t, store)
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "test:")
+	defer store.Close()
+	testStore(t, store)
+
+	if !server.Exists("test:states") {
+		t.Error("Expected keys to start with the prefix")
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	bucket := newFakeS3(t)
+	store := NewS3Store(S3Options{
+		Bucket:      "spells",
+		Prefix:      "team/",
+		Endpoint:    bucket.server.URL,
+		Credentials: aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"},
+	})
+	testStore(t, store)
+
+	if !bucket.signed {
+		t.Error("Expected requests to be signed")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		location string
+		want     interface{}
+	}{
+		{dir, &bridge.FileStateStore{}},
+		{"file://" + dir, &bridge.FileStateStore{}},
+		{"sqlite://" + filepath.Join(dir, "state.db"), &SQLiteStore{}},
+		{"redis://localhost:6379/0?prefix=team:", &RedisStore{}},
+		{"s3://bucket/team?region=eu-west-1", &S3Store{}},
+	}
+	for _, tt := range tests {
+		store, err := Open(tt.location)
+		if err != nil {
+			t.Errorf("Open(%q) error = %v", tt.location, err)
+			continue
+		}
+		if reflect.TypeOf(store) != reflect.TypeOf(tt.want) {
+			t.Errorf("Open(%q) = %T, want %T", tt.location, store, tt.want)
+		}
+	}
+
+	if store, _ := Open("redis://localhost:6379/0?prefix=team:"); store.(*RedisStore).prefix != "team:" {
+		t.Error("Expected ?prefix= to set the Redis key prefix")
+	}
+	if store, _ := Open("s3://bucket/team?region=eu-west-1"); store.(*S3Store).opts.Prefix != "team/" || store.(*S3Store).opts.Region != "eu-west-1" {
+		t.Errorf("S3 options = %+v", store.(*S3Store).opts)
+	}
+
+	for _, location := range []string{"ftp://host/dir", "sqlite://", "s3:///prefix"} {
+		if _, err := Open(location); err == nil {
+			t.Errorf("Open(%q) should fail", location)
+		}
+	}
+}
+
+// testResponseStore checks the bridge.ResponseStore contract
+func testResponseStore(t *testing.T, store bridge.ResponseStore) {
+	t.Helper()
+
+	if keys, err := store.Keys(); err != nil || len(keys) != 0 {
+		t.Fatalf("Keys() of an empty store = %v, %v", keys, err)
+	}
+	if err := store.Set("a1", []byte(`{"response":"one"}`), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("b2", []byte(`{"response":"two"}`), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := store.Get("a1"); !ok || string(data) != `{"response":"one"}` {
+		t.Errorf("Get() = %s, %v", data, ok)
+	}
+	keys, err := store.Keys()
+	sort.Strings(keys)
+	if err != nil || !reflect.DeepEqual(keys, []string{"a1", "b2"}) {
+		t.Errorf("Keys() = %v, %v", keys, err)
+	}
+
+	store.Delete("a1")
+	if _, ok := store.Get("a1"); ok {
+		t.Error("Expected a1 to be deleted")
+	}
+	if n, err := store.Purge(); err != nil || n != 1 {
+		t.Errorf("Purge() = %d, %v", n, err)
+	}
+	if keys, _ := store.Keys(); len(keys) != 0 {
+		t.Errorf("Expected no keys after Purge(), got %v", keys)
+	}
+}
+
+func TestResponseStores(t *testing.T) {
+	t.Run("files", func(t *testing.T) {
+		testResponseStore(t, bridge.NewFileResponseStore(t.TempDir()))
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		store := NewRedisResponseStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "test:")
+		defer store.Close()
+		testResponseStore(t, store)
+
+		_ = store.Set("c3", []byte(`{}`), time.Minute)
+		if !server.Exists("test:llm:c3") || server.TTL("test:llm:c3") != time.Minute {
+			t.Error("Expected the prefixed key to expire with the TTL")
+		}
+	})
+
+	dir := t.TempDir()
+	for location, want := range map[string]interface{}{
+		dir:                                  &bridge.FileResponseStore{},
+		"file://" + dir:                      &bridge.FileResponseStore{},
+		"redis://localhost:6379/0?prefix=a:": &RedisResponseStore{},
+	} {
+		store, err := OpenResponseStore(location)
+		if err != nil || reflect.TypeOf(store) != reflect.TypeOf(want) {
+			t.Errorf("OpenResponseStore(%q) = %T, %v", location, store, err)
+		}
+	}
+	if _, err := OpenResponseStore("s3://bucket"); err == nil {
+		t.Error("Expected an unsupported scheme to fail")
+	}
+}
+
+// testVectorStore checks the bridge.VectorStore contract
+func testVectorStore(t *testing.T, store bridge.VectorStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	if matches, err := store.Query(ctx, "docs", bridge.VectorQuery{Vector: []float64{1, 0}, TopK: 5}); err != nil || len(matches) != 0 {
+		t.Fatalf("Query() of an empty store = %v, %v", matches, err)
+	}
+	err := store.Upsert(ctx, "docs", []bridge.VectorRecord{
+		{ID: "cats", Vector: []float64{1, 0}, Text: "Cats purr.", Metadata: map[string]interface{}{"lang": "en"}},
+		{ID: "dogs", Vector: []float64{0, 1}, Text: "Dogs bark.", Metadata: map[string]interface{}{"lang": "en"}},
+		{ID: "chats", Vector: []float64{1, 0.2}, Text: "Les chats ronronnent.", Metadata: map[string]interface{}{"lang": "fr"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Upsert(ctx, "notes", []bridge.VectorRecord{{ID: "n1", Vector: []float64{1, 1}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := store.Query(ctx, "docs", bridge.VectorQuery{Vector: []float64{1, 0}, TopK: 2})
+	if err != nil || len(matches) != 2 || matches[0].ID != "cats" || matches[1].ID != "chats" {
+		t.Fatalf("Query() = %+v, %v", matches, err)
+	}
+	if matches[0].Text != "Cats purr." || matches[0].Metadata["lang"] != "en" || len(matches[0].Vector) != 2 {
+		t.Errorf("Expected the record back with its match, got %+v", matches[0])
+	}
+	matches, err = store.Query(ctx, "docs", bridge.VectorQuery{Vector: []float64{1, 0}, TopK: 5, Filter: map[string]interface{}{"lang": "en"}})
+	if err != nil || len(matches) != 2 || matches[1].ID != "dogs" {
+		t.Errorf("Filtered Query() = %+v, %v", matches, err)
+	}
+
+	if err := store.Delete(ctx, "docs", []string{"cats", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Upsert(ctx, "docs", []bridge.VectorRecord{{ID: "dogs", Vector: []float64{1, 0}}}); err != nil {
+		t.Fatal(err)
+	}
+	matches, _ = store.Query(ctx, "docs", bridge.VectorQuery{Vector: []float64{1, 0}, TopK: 5})
+	if len(matches) != 2 || matches[0].ID != "dogs" {
+		t.Errorf("Expected the delete and the replaced record, got %+v", matches)
+	}
+
+	if namespaces, err := store.Namespaces(ctx); err != nil || !reflect.DeepEqual(namespaces, []string{"docs", "notes"}) {
+		t.Errorf("Namespaces() = %v, %v", namespaces, err)
+	}
+	if err := store.Drop(ctx, "notes"); err != nil {
+		t.Fatal(err)
+	}
+	if namespaces, _ := store.Namespaces(ctx); !reflect.DeepEqual(namespaces, []string{"docs"}) {
+		t.Errorf("Expected notes to be dropped, got %v", namespaces)
+	}
+}
+
+func TestVectorStores(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testVectorStore(t, bridge.NewMemoryVectorStore())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		store, err := NewSQLiteVectorStore(filepath.Join(t.TempDir(), "vectors.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		testVectorStore(t, store)
+	})
+
+	t.Run("qdrant", func(t *testing.T) {
+		fake := newFakeQdrant(t)
+		testVectorStore(t, NewQdrantVectorStore(QdrantOptions{URL: fake.server.URL, APIKey: "secret", Prefix: "test_"}))
+		if fake.sizes["test_docs"] != 2 || fake.keyErrors > 0 {
+			t.Errorf("Expected a 2-dimension collection created with the API key, got %v", fake.sizes)
+		}
+	})
+
+	for location, want := range map[string]interface{}{
+		"memory":                            &bridge.MemoryVectorStore{},
+		"sqlite:///tmp/vectors.db":          &SQLiteVectorStore{},
+		"qdrant://localhost:6333":           &QdrantVectorStore{},
+		"qdrants://cloud.example?prefix=a_": &QdrantVectorStore{},
+	} {
+		store, err := OpenVectorStore(location)
+		if err != nil || reflect.TypeOf(store) != reflect.TypeOf(want) {
+			t.Errorf("OpenVectorStore(%q) = %T, %v", location, store, err)
+		}
+	}
+	if store, _ := OpenVectorStore("qdrants://cloud.example?prefix=a_"); store.(*QdrantVectorStore).opts.URL != "https://cloud.example" {
+		t.Errorf("Unexpected Qdrant URL %q", store.(*QdrantVectorStore).opts.URL)
+	}
+	for _, location := range []string{"postgres://localhost/db", "/tmp/vectors", "sqlite://"} {
+		if _, err := OpenVectorStore(location); err == nil {
+			t.Errorf("Expected OpenVectorStore(%q) to fail", location)
+		}
+	}
+}
+
+// testToolMetrics checks the ToolMetricsStore contract
+func testToolMetrics(t *testing.T, store bridge.ToolMetricsStore) {
+	t.Helper()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stats := []bridge.CallStat{
+		{Name: "web_fetch", Calls: 3, Failures: 1, Duration: 300 * time.Millisecond},
+		{Name: "summarize", Calls: 2, CacheHits: 1, Duration: 50 * time.Millisecond},
+	}
+	for i, runID := range []string{"run-2", "run-1", "run-3"} {
+		at := start.Add(time.Duration(2-i) * time.Hour)
+		if err := store.RecordToolRuns(bridge.ToolRunsOf(runID, "research", at, stats)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := store.ToolRuns(start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 4 || runs[0].RunID != "run-1" || runs[3].RunID != "run-2" {
+		t.Fatalf("ToolRuns() = %+v, want run-1 then run-2, oldest first", runs)
+	}
+	if got := runs[0]; !got.Time.Equal(start.Add(time.Hour)) || got.Spell != "research" || got.CallStat != stats[0] {
+		t.Errorf("ToolRuns()[0] = %+v", got)
+	}
+
+	if n, err := store.PruneToolRuns(start.Add(2 * time.Hour)); err != nil || n != 4 {
+		t.Errorf("PruneToolRuns() = %d, %v, want 4", n, err)
+	}
+	if runs, _ := store.ToolRuns(start); len(runs) != 2 || runs[0].RunID != "run-2" {
+		t.Errorf("Expected only run-2 to remain, got %+v", runs)
+	}
+}
+
+func TestToolMetricsStores(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testToolMetrics(t, bridge.NewMemoryToolMetrics())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		store, err := NewSQLiteToolMetrics(filepath.Join(t.TempDir(), "metrics.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		testToolMetrics(t, store)
+	})
+}
+
+// fakeS3 is a bucket served path-style with the calls S3Store makes
+type fakeS3 struct {
+	server *httptest.Server
+	mu     sync.Mutex
+	bucket map[string][]byte
+	signed bool
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	f := &fakeS3{bucket: make(map[string][]byte)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		f.signed = true
+	}
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/spells"), "/")
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter"))
+	case r.Method == http.MethodGet:
+		data, ok := f.bucket[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	case r.Method == http.MethodPut:
+		if _, ok := f.bucket[key]; ok && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, _ = io.WriteString(w, "<Error><Code>PreconditionFailed</Code></Error>")
+			return
+		}
+		f.bucket[key], _ = io.ReadAll(r.Body)
+	case r.Method == http.MethodDelete:
+		delete(f.bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix, delimiter string) {
+	var result struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Contents       []struct{ Key string }
+		CommonPrefixes []struct{ Prefix string }
+	}
+	seen := make(map[string]bool)
+	var keys []string
+	for key := range f.bucket {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(key, prefix)
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			common := prefix + rest[:i+len(delimiter)]
+			if !seen[common] {
+				seen[common] = true
+				result.CommonPrefixes = append(result.CommonPrefixes, struct{ Prefix string }{common})
+			}
+			continue
+		}
+		result.Contents = append(result.Contents, struct{ Key string }{key})
+	}
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+// fakeQdrant serves the calls QdrantVectorStore makes, ranking searches
+// with bridge.RankRecords
+type fakeQdrant struct {
+	server    *httptest.Server
+	mu        sync.Mutex
+	sizes     map[string]int
+	points    map[string]map[string]fakeQdrantPoint
+	keyErrors int
+}
+
+type fakeQdrantPoint struct {
+	ID      string                 `json:"id"`
+	Vector  []float64              `json:"vector"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+func newFakeQdrant(t *testing.T) *fakeQdrant {
+	f := &fakeQdrant{sizes: make(map[string]int), points: make(map[string]map[string]fakeQdrantPoint)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeQdrant) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("api-key") != "secret" {
+		f.keyErrors++
+	}
+	reply := func(result interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "status": "ok"})
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/collections"), "/")
+	if len(parts) == 1 {
+		var collections []map[string]string
+		for name := range f.sizes {
+			collections = append(collections, map[string]string{"name": name})
+		}
+		reply(map[string]interface{}{"collections": collections})
+		return
+	}
+	name := parts[1]
+	if _, ok := f.sizes[name]; !ok && !(len(parts) == 2 && r.Method == "PUT") {
+		http.Error(w, `{"status": {"error": "Not found"}}`, http.StatusNotFound)
+		return
+	}
+
+	var body struct {
+		Vectors struct {
+			Size int `json:"size"`
+		} `json:"vectors"`
+		Points json.RawMessage        `json:"points"`
+		Vector []float64              `json:"vector"`
+		Limit  int                    `json:"limit"`
+		Filter map[string]interface{} `json:"filter"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	switch action := strings.Join(parts[2:], "/"); {
+	case action == "" && r.Method == "GET":
+		reply(map[string]interface{}{"status": "green"})
+	case action == "" && r.Method == "PUT":
+		f.sizes[name] = body.Vectors.Size
+		f.points[name] = make(map[string]fakeQdrantPoint)
+		reply(true)
+	case action == "" && r.Method == "DELETE":
+		delete(f.sizes, name)
+		delete(f.points, name)
+		reply(true)
+	case action == "points":
+		var points []fakeQdrantPoint
+		_ = json.Unmarshal(body.Points, &points)
+		for _, point := range points {
+			f.points[name][point.ID] = point
+		}
+		reply(map[string]string{"status": "completed"})
+	case action == "points/delete":
+		var ids []string
+		_ = json.Unmarshal(body.Points, &ids)
+		for _, id := range ids {
+			delete(f.points[name], id)
+		}
+		reply(map[string]string{"status": "completed"})
+	case action == "points/search":
+		filter := make(map[string]interface{})
+		if must, ok := body.Filter["must"].([]interface{}); ok {
+			for _, condition := range must {
+				c := condition.(map[string]interface{})
+				filter[strings.TrimPrefix(c["key"].(string), "metadata.")] = c["match"].(map[string]interface{})["value"]
+			}
+		}
+		var records []bridge.VectorRecord
+		payloads := make(map[string]map[string]interface{})
+		for id, point := range f.points[name] {
+			metadata, _ := point.Payload["metadata"].(map[string]interface{})
+			records = append(records, bridge.VectorRecord{ID: id, Vector: point.Vector, Metadata: metadata})
+			payloads[id] = point.Payload
+		}
+		sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+		matches, _ := bridge.RankRecords(records, bridge.VectorQuery{Vector: body.Vector, TopK: body.Limit, Filter: filter})
+		result := make([]map[string]interface{}, len(matches))
+		for i, match := range matches {
+			result[i] = map[string]interface{}{"id": match.ID, "score": match.Score, "vector": match.Vector, "payload": payloads[match.ID]}
+		}
+		reply(result)
+	default:
+		http.Error(w, "unexpected call", http.StatusBadRequest)
+	}
+}
@@ -53,6 +53,38 @@ func (a *LLMSToolAdapter) Parameters() json.RawMessage {
 	return data
 }
 
+// builtinCategories maps go-llms built-in tools to their categories
+var builtinCategories = map[string]string{
+	"web_fetch":       "web",
+	"execute_command": "system",
+	"file_read":       "file",
+	"file_write":      "file",
+}
+
+// destructiveBuiltins are the go-llms built-in tools that change things
+// outside the spell
+var destructiveBuiltins = map[string]bool{
+	"execute_command": true,
+	"file_write":      true,
+}
+
+// RequiresConfirmation reports whether the tool runs commands or writes
+// files, and so should be confirmed before it runs
+func (a *LLMSToolAdapter) RequiresConfirmation() bool {
+	return destructiveBuiltins[a.Name()]
+}
+
+// Metadata returns the tool's metadata, tagged as a built-in
+func (a *LLMSToolAdapter) Metadata() Metadata {
+	return Metadata{
+		Name:        a.Name(),
+		Description: a.Description(),
+		Category:    builtinCategories[a.Name()],
+		Tags:        []string{"builtin"},
+		Parameters:  a.Parameters(),
+	}
+}
+
 // Execute runs the tool with the given parameters
 func (a *LLMSToolAdapter) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	return a.tool.Execute(ctx, params)
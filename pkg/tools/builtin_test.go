@@ -69,6 +69,14 @@ func TestLLMSToolAdapter(t *testing.T) {
 	}
 }
 
+func TestLLMSToolAdapterConfirmation(t *testing.T) {
+	for name, want := range map[string]bool{"web_fetch": false, "file_read": false, "file_write": true, "execute_command": true} {
+		if got := RequiresConfirmation(NewLLMSToolAdapter(tools.MustGetTool(name))); got != want {
+			t.Errorf("%s: expected RequiresConfirmation %t, got %t", name, want, got)
+		}
+	}
+}
+
 func TestRegisterBuiltinTools(t *testing.T) {
 	tests := []struct {
 		name          string
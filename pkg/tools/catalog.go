@@ -0,0 +1,93 @@
+// ABOUTME: Implements a cached view of a tool registry for cheap repeated discovery
+// ABOUTME: Snapshots the tool list and invalidates it when tools are registered or removed
+
+package tools
+
+import (
+	"sort"
+	"sync"
+)
+
+// Catalog wraps a Registry and caches its tool list, so listing and
+// searching a large catalog repeatedly does not rebuild it each time.
+// Registering or removing tools through the catalog invalidates the cache;
+// call Refresh after changing the underlying registry directly.
+type Catalog struct {
+	registry Registry
+
+	mu      sync.RWMutex
+	tools   []Tool
+	valid   bool
+	version uint64
+}
+
+// NewCatalog creates a catalog over a registry
+func NewCatalog(registry Registry) *Catalog {
+	return &Catalog{registry: registry}
+}
+
+// Register adds a tool to the underlying registry
+func (c *Catalog) Register(tool Tool) error {
+	if err := c.registry.Register(tool); err != nil {
+		return err
+	}
+	c.Refresh()
+	return nil
+}
+
+// Get retrieves a tool by name from the underlying registry
+func (c *Catalog) Get(name string) (Tool, error) {
+	return c.registry.Get(name)
+}
+
+// List returns all tools sorted by name, from the cache when it is current
+func (c *Catalog) List() []Tool {
+	c.mu.RLock()
+	if c.valid {
+		list := append([]Tool(nil), c.tools...)
+		c.mu.RUnlock()
+		return list
+	}
+	c.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Another caller may have rebuilt it while we waited
+	if !c.valid {
+		c.tools = c.registry.List()
+		sort.Slice(c.tools, func(i, j int) bool {
+			return c.tools[i].Name() < c.tools[j].Name()
+		})
+		c.valid = true
+	}
+	return append([]Tool(nil), c.tools...)
+}
+
+// Remove unregisters a tool from the underlying registry
+func (c *Catalog) Remove(name string) error {
+	if err := c.registry.Remove(name); err != nil {
+		return err
+	}
+	c.Refresh()
+	return nil
+}
+
+// Refresh discards the cached listing; the next List re-reads the registry
+func (c *Catalog) Refresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.valid = false
+	c.tools = nil
+	c.version++
+}
+
+// Version changes every time the cache is invalidated, so callers can key
+// their own derived caches on it
+func (c *Catalog) Version() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.version
+}
@@ -0,0 +1,67 @@
+// ABOUTME: Tests for the cached tool catalog
+// ABOUTME: Verifies sorted listing, invalidation on changes, and explicit refresh
+
+package tools
+
+import (
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	reg := NewRegistry()
+	catalog := NewCatalog(reg)
+
+	if err := catalog.Register(createTestTool("beta", "Second")); err != nil {
+		t.Fatalf("Failed to register tool: %v", err)
+	}
+	if err := catalog.Register(createTestTool("alpha", "First")); err != nil {
+		t.Fatalf("Failed to register tool: %v", err)
+	}
+
+	list := catalog.List()
+	if len(list) != 2 || list[0].Name() != "alpha" {
+		t.Fatalf("Expected tools sorted by name, got %v", list)
+	}
+
+	// Callers get their own copy of the cached list
+	list[0] = nil
+	if catalog.List()[0] == nil {
+		t.Error("Expected List to return a copy")
+	}
+
+	version := catalog.Version()
+	if err := catalog.Remove("alpha"); err != nil {
+		t.Fatalf("Failed to remove tool: %v", err)
+	}
+	if catalog.Version() == version {
+		t.Error("Expected removal to bump the version")
+	}
+	if len(catalog.List()) != 1 {
+		t.Error("Expected removal to invalidate the listing")
+	}
+
+	// A failed change leaves the cache alone
+	version = catalog.Version()
+	if err := catalog.Register(createTestTool("beta", "Duplicate")); err == nil {
+		t.Error("Expected duplicate registration to fail")
+	}
+	if catalog.Version() != version {
+		t.Error("Expected failed registration to keep the version")
+	}
+
+	// Direct registry changes show up after Refresh
+	if err := reg.Register(createTestTool("gamma", "Direct")); err != nil {
+		t.Fatalf("Failed to register tool: %v", err)
+	}
+	if len(catalog.List()) != 1 {
+		t.Error("Expected cached listing before refresh")
+	}
+	catalog.Refresh()
+	if len(catalog.List()) != 2 {
+		t.Error("Expected refreshed listing")
+	}
+
+	if tool, err := catalog.Get("gamma"); err != nil || tool.Name() != "gamma" {
+		t.Errorf("Expected Get to reach the registry, got %v, %v", tool, err)
+	}
+}
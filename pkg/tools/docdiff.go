@@ -0,0 +1,215 @@
+// ABOUTME: Keeps per-version documentation snapshots of tools and compares them
+// ABOUTME: Reports added, removed, and changed parameters and flags breaking changes
+
+package tools
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// DocHistory retains the documentation of every tool version it has seen,
+// keyed by tool name and Metadata.Version
+type DocHistory struct {
+	mu       sync.RWMutex
+	versions map[string]map[string]ToolDoc
+	order    map[string][]string
+}
+
+// NewDocHistory creates an empty history
+func NewDocHistory() *DocHistory {
+	return &DocHistory{
+		versions: make(map[string]map[string]ToolDoc),
+		order:    make(map[string][]string),
+	}
+}
+
+// Record stores a doc snapshot. A later snapshot of the same version
+// replaces the earlier one.
+func (h *DocHistory) Record(doc ToolDoc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.versions[doc.Name] == nil {
+		h.versions[doc.Name] = make(map[string]ToolDoc)
+	}
+	if _, seen := h.versions[doc.Name][doc.Version]; !seen {
+		h.order[doc.Name] = append(h.order[doc.Name], doc.Version)
+	}
+	h.versions[doc.Name][doc.Version] = doc
+}
+
+// Versions lists the recorded versions of a tool in the order first seen
+func (h *DocHistory) Versions(name string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return append([]string{}, h.order[name]...)
+}
+
+// Get returns the recorded doc for a tool version
+func (h *DocHistory) Get(name, version string) (ToolDoc, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	doc, ok := h.versions[name][version]
+	return doc, ok
+}
+
+// Diff compares two recorded versions of a tool
+func (h *DocHistory) Diff(name, from, to string) (DocDiff, error) {
+	fromDoc, ok := h.Get(name, from)
+	if !ok {
+		return DocDiff{}, fmt.Errorf("no documentation recorded for %s version %q", name, from)
+	}
+	toDoc, ok := h.Get(name, to)
+	if !ok {
+		return DocDiff{}, fmt.Errorf("no documentation recorded for %s version %q", name, to)
+	}
+	return DiffDocs(fromDoc, toDoc), nil
+}
+
+// ParameterChange describes how one parameter differs between versions
+type ParameterChange struct {
+	Name     string   `json:"name"`
+	Changes  []string `json:"changes"`
+	Breaking bool     `json:"breaking"`
+}
+
+// DocDiff is the difference between two versions of a tool's documentation
+type DocDiff struct {
+	Tool               string            `json:"tool"`
+	From               string            `json:"from"`
+	To                 string            `json:"to"`
+	Added              []ParameterDoc    `json:"added"`
+	Removed            []ParameterDoc    `json:"removed"`
+	Changed            []ParameterChange `json:"changed"`
+	DescriptionChanged bool              `json:"description_changed"`
+	CategoryChanged    bool              `json:"category_changed"`
+	TagsChanged        bool              `json:"tags_changed"`
+
+	// Breaking is set when callers of the old version may fail against the
+	// new one: a parameter was removed, became required, changed type, or
+	// lost allowed values, or a new required parameter was added
+	Breaking bool `json:"breaking"`
+}
+
+// DiffDocs compares two tool docs
+func DiffDocs(from, to ToolDoc) DocDiff {
+	diff := DocDiff{
+		Tool:               to.Name,
+		From:               from.Version,
+		To:                 to.Version,
+		Added:              []ParameterDoc{},
+		Removed:            []ParameterDoc{},
+		Changed:            []ParameterChange{},
+		DescriptionChanged: from.Description != to.Description,
+		CategoryChanged:    from.Category != to.Category,
+		TagsChanged:        !sameStrings(from.Tags, to.Tags),
+	}
+
+	oldParams := make(map[string]ParameterDoc)
+	for _, p := range from.Parameters {
+		oldParams[p.Name] = p
+	}
+	newParams := make(map[string]ParameterDoc)
+	for _, p := range to.Parameters {
+		newParams[p.Name] = p
+	}
+
+	for _, p := range to.Parameters {
+		old, existed := oldParams[p.Name]
+		if !existed {
+			diff.Added = append(diff.Added, p)
+			if p.Required {
+				diff.Breaking = true
+			}
+			continue
+		}
+		if change, ok := diffParameter(old, p); ok {
+			diff.Changed = append(diff.Changed, change)
+			if change.Breaking {
+				diff.Breaking = true
+			}
+		}
+	}
+	for _, p := range from.Parameters {
+		if _, kept := newParams[p.Name]; !kept {
+			diff.Removed = append(diff.Removed, p)
+			diff.Breaking = true
+		}
+	}
+
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Name < diff.Changed[j].Name
+	})
+	return diff
+}
+
+// diffParameter describes the changes to one parameter, if any
+func diffParameter(old, new ParameterDoc) (ParameterChange, bool) {
+	change := ParameterChange{Name: new.Name, Changes: []string{}}
+
+	if old.Type != new.Type {
+		change.Changes = append(change.Changes, fmt.Sprintf("type changed from %q to %q", old.Type, new.Type))
+		change.Breaking = true
+	}
+	if old.Required != new.Required {
+		if new.Required {
+			change.Changes = append(change.Changes, "became required")
+			change.Breaking = true
+		} else {
+			change.Changes = append(change.Changes, "became optional")
+		}
+	}
+	if !reflect.DeepEqual(old.Default, new.Default) {
+		change.Changes = append(change.Changes, fmt.Sprintf("default changed from %v to %v", old.Default, new.Default))
+	}
+	if !reflect.DeepEqual(old.Enum, new.Enum) {
+		change.Changes = append(change.Changes, fmt.Sprintf("allowed values changed from %v to %v", old.Enum, new.Enum))
+		// Narrowing (or newly restricting) the allowed values can reject old input
+		if len(new.Enum) > 0 && !enumSuperset(new.Enum, old.Enum) {
+			change.Breaking = true
+		}
+	}
+	if old.Description != new.Description {
+		change.Changes = append(change.Changes, "description changed")
+	}
+
+	return change, len(change.Changes) > 0
+}
+
+// enumSuperset reports whether every value of sub is in super. An empty sub
+// (no restriction) is only covered by an empty super.
+func enumSuperset(super, sub []interface{}) bool {
+	if len(sub) == 0 {
+		return len(super) == 0
+	}
+	for _, v := range sub {
+		found := false
+		for _, s := range super {
+			if reflect.DeepEqual(v, s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// sameStrings reports whether two string lists hold the same values
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
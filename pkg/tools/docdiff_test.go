@@ -0,0 +1,91 @@
+// ABOUTME: Tests for documentation version history and diffing
+// ABOUTME: Verifies parameter change detection and breaking-change classification
+
+package tools
+
+import (
+	"testing"
+)
+
+func TestDiffDocs(t *testing.T) {
+	from := ToolDoc{
+		Name:        "convert",
+		Version:     "1.0",
+		Description: "Convert units",
+		Tags:        []string{"math", "units"},
+		Parameters: []ParameterDoc{
+			{Name: "value", Type: "number", Required: true},
+			{Name: "unit", Type: "string", Enum: []interface{}{"m", "ft"}},
+			{Name: "precision", Type: "integer"},
+			{Name: "legacy", Type: "boolean"},
+		},
+	}
+	to := ToolDoc{
+		Name:        "convert",
+		Version:     "2.0",
+		Description: "Convert units",
+		Tags:        []string{"units", "math"},
+		Parameters: []ParameterDoc{
+			{Name: "value", Type: "number", Required: true},
+			{Name: "unit", Type: "string", Enum: []interface{}{"m", "ft", "yd"}},
+			{Name: "precision", Type: "string", Required: true},
+			{Name: "round", Type: "boolean", Default: true},
+		},
+	}
+
+	diff := DiffDocs(from, to)
+	if diff.From != "1.0" || diff.To != "2.0" || diff.DescriptionChanged || diff.TagsChanged {
+		t.Errorf("Unexpected header fields: %+v", diff)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Name != "round" {
+		t.Errorf("Expected round to be added, got %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Name != "legacy" {
+		t.Errorf("Expected legacy to be removed, got %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 2 || diff.Changed[0].Name != "precision" || diff.Changed[1].Name != "unit" {
+		t.Fatalf("Expected precision and unit to change, got %+v", diff.Changed)
+	}
+	if !diff.Changed[0].Breaking || len(diff.Changed[0].Changes) != 2 {
+		t.Errorf("Expected type change and new requirement to be breaking: %+v", diff.Changed[0])
+	}
+	if diff.Changed[1].Breaking {
+		t.Errorf("Expected widening an enum to be compatible: %+v", diff.Changed[1])
+	}
+	if !diff.Breaking {
+		t.Error("Expected the diff to be breaking")
+	}
+
+	// Optional additions and widening changes are compatible
+	compatible := DiffDocs(to, ToolDoc{
+		Name:       "convert",
+		Version:    "2.1",
+		Parameters: append(append([]ParameterDoc{}, to.Parameters...), ParameterDoc{Name: "note", Type: "string"}),
+	})
+	if compatible.Breaking || !compatible.DescriptionChanged {
+		t.Errorf("Expected a compatible diff, got %+v", compatible)
+	}
+}
+
+func TestDocHistory(t *testing.T) {
+	gen := NewDocGenerator()
+	gen.Doc(NewFunctionTool("tool", "One", nil, nil).WithVersion("1"))
+	gen.Doc(NewFunctionTool("tool", "Two", nil, nil).WithVersion("2"))
+	gen.Doc(NewFunctionTool("tool", "Two again", nil, nil).WithVersion("2"))
+
+	history := gen.History()
+	if versions := history.Versions("tool"); len(versions) != 2 || versions[0] != "1" {
+		t.Errorf("Expected versions in first-seen order, got %v", versions)
+	}
+	if doc, _ := history.Get("tool", "2"); doc.Description != "Two again" {
+		t.Errorf("Expected the latest snapshot of a version, got %q", doc.Description)
+	}
+
+	diff, err := history.Diff("tool", "1", "2")
+	if err != nil || !diff.DescriptionChanged {
+		t.Errorf("Expected description change, got %+v (%v)", diff, err)
+	}
+	if _, err := history.Diff("tool", "1", "3"); err == nil {
+		t.Error("Expected error for unknown version")
+	}
+}
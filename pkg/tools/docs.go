@@ -0,0 +1,259 @@
+// ABOUTME: Generates reference documentation for tools from their metadata and schemas
+// ABOUTME: Caches generated docs per tool and can stream a whole catalog concurrently
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lexlapax/go-llmspell/pkg/i18n"
+)
+
+// ParameterDoc documents one top-level tool parameter
+type ParameterDoc struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Description string        `json:"description,omitempty"`
+	Required    bool          `json:"required"`
+	Default     interface{}   `json:"default,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+}
+
+// ToolDoc is the generated documentation for a tool
+type ToolDoc struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Version     string         `json:"version,omitempty"`
+	Category    string         `json:"category,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Parameters  []ParameterDoc `json:"parameters"`
+	Markdown    string         `json:"markdown"`
+}
+
+// GenerateDoc builds the documentation for a tool. Parameters are listed
+// required first, then alphabetically.
+func GenerateDoc(tool Tool) ToolDoc {
+	meta := MetadataFor(tool)
+	doc := ToolDoc{
+		Name:        tool.Name(),
+		Description: tool.Description(),
+		Version:     meta.Version,
+		Category:    meta.Category,
+		Tags:        meta.Tags,
+		Parameters:  parameterDocs(tool.Parameters()),
+	}
+	doc.Markdown = renderDocMarkdown(doc)
+	return doc
+}
+
+// parameterDocs extracts the top-level properties of a JSON schema
+func parameterDocs(schema json.RawMessage) []ParameterDoc {
+	params := []ParameterDoc{}
+	if len(schema) == 0 {
+		return params
+	}
+
+	if resolved, err := ResolveRefs(schema); err == nil {
+		schema = resolved
+	}
+
+	var parsed struct {
+		Properties map[string]map[string]interface{} `json:"properties"`
+		Required   []string                          `json:"required"`
+	}
+	if err := json.Unmarshal(schema, &parsed); err != nil {
+		return params
+	}
+
+	required := make(map[string]bool)
+	for _, name := range parsed.Required {
+		required[name] = true
+	}
+
+	for name, prop := range parsed.Properties {
+		param := ParameterDoc{Name: name, Required: required[name], Default: prop["default"]}
+		param.Type, _ = prop["type"].(string)
+		param.Description, _ = prop["description"].(string)
+		param.Enum, _ = prop["enum"].([]interface{})
+		params = append(params, param)
+	}
+
+	sort.Slice(params, func(i, j int) bool {
+		if params[i].Required != params[j].Required {
+			return params[i].Required
+		}
+		return params[i].Name < params[j].Name
+	})
+	return params
+}
+
+// renderDocMarkdown formats a tool doc as a Markdown section, with headings
+// in the language of the default message catalog
+func renderDocMarkdown(doc ToolDoc) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n\n", doc.Name)
+	if doc.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", doc.Description)
+	}
+
+	var facts []string
+	if doc.Version != "" {
+		facts = append(facts, i18n.T("docs.version", doc.Version))
+	}
+	if doc.Category != "" {
+		facts = append(facts, i18n.T("docs.category", doc.Category))
+	}
+	if len(doc.Tags) > 0 {
+		facts = append(facts, i18n.T("docs.tags", strings.Join(doc.Tags, ", ")))
+	}
+	if len(facts) > 0 {
+		fmt.Fprintf(&b, "%s\n\n", strings.Join(facts, " | "))
+	}
+
+	if len(doc.Parameters) == 0 {
+		b.WriteString(i18n.T("docs.no_parameters") + "\n")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", i18n.T("docs.column.parameter"), i18n.T("docs.column.type"),
+		i18n.T("docs.column.required"), i18n.T("docs.column.description"))
+	b.WriteString("|-----------|------|----------|-------------|\n")
+	for _, p := range doc.Parameters {
+		required := i18n.T("docs.no")
+		if p.Required {
+			required = i18n.T("docs.yes")
+		}
+		description := p.Description
+		if p.Default != nil {
+			description = strings.TrimSpace(description + " " + i18n.T("docs.default", p.Default))
+		}
+		if len(p.Enum) > 0 {
+			values := make([]string, len(p.Enum))
+			for i, v := range p.Enum {
+				values[i] = fmt.Sprint(v)
+			}
+			description = strings.TrimSpace(description + " " + i18n.T("docs.one_of", strings.Join(values, ", ")))
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", p.Name, p.Type, required, strings.ReplaceAll(description, "|", "\\|"))
+	}
+	return b.String()
+}
+
+// DocGenerator caches generated tool docs. A cached doc is reused only while
+// the registry still holds the same tool, so re-registering a tool under the
+// same name regenerates its docs. Every generated doc is also kept in a
+// per-version history for diffing.
+type DocGenerator struct {
+	mu      sync.Mutex
+	cache   map[string]cachedDoc
+	history *DocHistory
+}
+
+type cachedDoc struct {
+	tool Tool
+	doc  ToolDoc
+}
+
+// NewDocGenerator creates an empty doc cache
+func NewDocGenerator() *DocGenerator {
+	return &DocGenerator{
+		cache:   make(map[string]cachedDoc),
+		history: NewDocHistory(),
+	}
+}
+
+// History returns the version history of the docs generated so far
+func (g *DocGenerator) History() *DocHistory {
+	return g.history
+}
+
+// Doc returns the documentation for a tool, generating it on first use
+func (g *DocGenerator) Doc(tool Tool) ToolDoc {
+	name := tool.Name()
+
+	g.mu.Lock()
+	cached, ok := g.cache[name]
+	g.mu.Unlock()
+	if ok && cached.tool == tool {
+		return cached.doc
+	}
+
+	doc := GenerateDoc(tool)
+	g.history.Record(doc)
+
+	g.mu.Lock()
+	g.cache[name] = cachedDoc{tool: tool, doc: doc}
+	g.mu.Unlock()
+	return doc
+}
+
+// Invalidate drops the cached docs for a tool
+func (g *DocGenerator) Invalidate(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.cache, name)
+}
+
+// Stream documents the given tools on a pool of workers and calls fn with
+// each doc as it completes, so callers can show results before the whole
+// catalog is done. Docs arrive in completion order, not input order. fn runs
+// on the calling goroutine; returning an error from it stops the stream.
+func (g *DocGenerator) Stream(ctx context.Context, list []Tool, workers int, fn func(ToolDoc) error) error {
+	if workers <= 0 {
+		workers = 4
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan Tool)
+	docs := make(chan ToolDoc)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tool := range jobs {
+				select {
+				case docs <- g.Doc(tool):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, tool := range list {
+			select {
+			case jobs <- tool:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(docs)
+	}()
+
+	for doc := range docs {
+		if err := fn(doc); err != nil {
+			cancel()
+			// Drain so the workers can exit
+			for range docs {
+			}
+			return err
+		}
+	}
+	return ctx.Err()
+}
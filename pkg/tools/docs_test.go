@@ -0,0 +1,121 @@
+// ABOUTME: Tests for tool documentation generation
+// ABOUTME: Verifies parameter extraction, Markdown output, caching, and streaming
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGenerateDoc(t *testing.T) {
+	tool := NewFunctionTool("fetch", "Fetch a URL", json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"url": {"type": "string", "description": "Address to fetch"},
+			"method": {"type": "string", "enum": ["GET", "POST"], "default": "GET"},
+			"a_timeout": {"type": "number"}
+		},
+		"required": ["url"]
+	}`), nil).WithMetadata("web", "http")
+
+	doc := GenerateDoc(tool)
+	if doc.Category != "web" || len(doc.Tags) != 1 {
+		t.Errorf("Expected metadata in doc, got %+v", doc)
+	}
+
+	names := []string{}
+	for _, p := range doc.Parameters {
+		names = append(names, p.Name)
+	}
+	if strings.Join(names, ",") != "url,a_timeout,method" {
+		t.Errorf("Expected required parameters first, got %v", names)
+	}
+
+	for _, want := range []string{
+		"## fetch",
+		"Category: web | Tags: http",
+		"| url | string | yes | Address to fetch |",
+		"| method | string | no | (default: GET) One of: GET, POST. |",
+	} {
+		if !strings.Contains(doc.Markdown, want) {
+			t.Errorf("Expected Markdown to contain %q, got:\n%s", want, doc.Markdown)
+		}
+	}
+
+	empty := GenerateDoc(NewFunctionTool("noop", "Does nothing", nil, nil))
+	if len(empty.Parameters) != 0 || !strings.Contains(empty.Markdown, "takes no parameters") {
+		t.Errorf("Unexpected doc for parameterless tool: %+v", empty)
+	}
+}
+
+func TestDocGeneratorCache(t *testing.T) {
+	gen := NewDocGenerator()
+
+	v1 := NewFunctionTool("tool", "Version one", nil, nil)
+	if doc := gen.Doc(v1); doc.Description != "Version one" {
+		t.Fatalf("Unexpected doc: %+v", doc)
+	}
+
+	// Cached docs are reused while the tool is unchanged
+	gen.mu.Lock()
+	cached := gen.cache["tool"]
+	cached.doc.Markdown = "cached"
+	gen.cache["tool"] = cached
+	gen.mu.Unlock()
+	if doc := gen.Doc(v1); doc.Markdown != "cached" {
+		t.Error("Expected cached doc to be reused")
+	}
+
+	// A replacement tool with the same name regenerates
+	v2 := NewFunctionTool("tool", "Version two", nil, nil)
+	if doc := gen.Doc(v2); doc.Description != "Version two" {
+		t.Errorf("Expected regenerated doc, got %+v", doc)
+	}
+
+	gen.Invalidate("tool")
+	if doc := gen.Doc(v2); doc.Markdown == "cached" {
+		t.Error("Expected invalidated doc to be regenerated")
+	}
+}
+
+func TestDocGeneratorStream(t *testing.T) {
+	gen := NewDocGenerator()
+
+	var list []Tool
+	for i := 0; i < 50; i++ {
+		list = append(list, NewFunctionTool(fmt.Sprintf("tool_%02d", i), "Streamed", nil, nil))
+	}
+
+	seen := make(map[string]bool)
+	err := gen.Stream(context.Background(), list, 4, func(doc ToolDoc) error {
+		seen[doc.Name] = true
+		return nil
+	})
+	if err != nil || len(seen) != 50 {
+		t.Fatalf("Expected 50 docs, got %d (%v)", len(seen), err)
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	err = gen.Stream(context.Background(), list, 4, func(doc ToolDoc) error {
+		count++
+		if count == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || count != 3 {
+		t.Errorf("Expected stream to stop after 3 docs, got %d (%v)", count, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := gen.Stream(ctx, list, 4, func(ToolDoc) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancellation error, got %v", err)
+	}
+}
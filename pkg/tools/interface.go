@@ -29,8 +29,60 @@ type Metadata struct {
 	Description string          `json:"description"`
 	Version     string          `json:"version"`
 	Author      string          `json:"author"`
+	Category    string          `json:"category,omitempty"`
 	Tags        []string        `json:"tags"`
 	Parameters  json.RawMessage `json:"parameters"`
+	Output      json.RawMessage `json:"output,omitempty"`
+
+	// Source says where a tool comes from when it is not built in, such
+	// as "mcp:<server>" for a tool of an MCP server
+	Source string `json:"source,omitempty"`
+}
+
+// MetadataProvider is implemented by tools that can describe themselves
+// beyond the basic Tool interface (category, tags, version)
+type MetadataProvider interface {
+	Metadata() Metadata
+}
+
+// Deterministic is implemented by tools that can say whether their result
+// depends only on their parameters, so it may be cached
+type Deterministic interface {
+	IsDeterministic() bool
+}
+
+// IsDeterministic reports whether a tool says its results may be cached
+func IsDeterministic(tool Tool) bool {
+	d, ok := tool.(Deterministic)
+	return ok && d.IsDeterministic()
+}
+
+// Confirmable is implemented by tools that can say whether they change
+// things outside the spell, such as files or running processes, and so
+// should be confirmed before they run
+type Confirmable interface {
+	RequiresConfirmation() bool
+}
+
+// RequiresConfirmation reports whether a tool asks to be confirmed before
+// it runs
+func RequiresConfirmation(tool Tool) bool {
+	c, ok := tool.(Confirmable)
+	return ok && c.RequiresConfirmation()
+}
+
+// MetadataFor returns the metadata for a tool, falling back to the fields
+// of the Tool interface when the tool does not provide its own
+func MetadataFor(tool Tool) Metadata {
+	if provider, ok := tool.(MetadataProvider); ok {
+		return provider.Metadata()
+	}
+
+	return Metadata{
+		Name:        tool.Name(),
+		Description: tool.Description(),
+		Parameters:  tool.Parameters(),
+	}
 }
 
 // Result represents the result of a tool execution
@@ -48,7 +100,15 @@ type FunctionTool struct {
 	name        string
 	description string
 	parameters  json.RawMessage
+	output      json.RawMessage
 	fn          ToolFunc
+	category    string
+	tags        []string
+	version     string
+	source      string
+
+	deterministic bool
+	confirm       bool
 }
 
 // NewFunctionTool creates a new tool from a function
@@ -76,6 +136,75 @@ func (t *FunctionTool) Parameters() json.RawMessage {
 	return t.parameters
 }
 
+// WithMetadata sets the tool's category and tags and returns the tool
+func (t *FunctionTool) WithMetadata(category string, tags ...string) *FunctionTool {
+	t.category = category
+	t.tags = tags
+	return t
+}
+
+// WithVersion sets the tool's version and returns the tool
+func (t *FunctionTool) WithVersion(version string) *FunctionTool {
+	t.version = version
+	return t
+}
+
+// WithSource sets where the tool comes from and returns the tool
+func (t *FunctionTool) WithSource(source string) *FunctionTool {
+	t.source = source
+	return t
+}
+
+// WithOutput sets the JSON schema of the tool's results and returns the tool
+func (t *FunctionTool) WithOutput(schema json.RawMessage) *FunctionTool {
+	t.output = schema
+	return t
+}
+
+// WithDeterministic says whether the tool's result depends only on its
+// parameters and returns the tool
+func (t *FunctionTool) WithDeterministic(deterministic bool) *FunctionTool {
+	t.deterministic = deterministic
+	return t
+}
+
+// IsDeterministic reports whether the tool's results may be cached
+func (t *FunctionTool) IsDeterministic() bool {
+	return t.deterministic
+}
+
+// WithConfirmation says whether the tool should be confirmed before it
+// runs and returns the tool
+func (t *FunctionTool) WithConfirmation(confirm bool) *FunctionTool {
+	t.confirm = confirm
+	return t
+}
+
+// RequiresConfirmation reports whether the tool should be confirmed
+// before it runs
+func (t *FunctionTool) RequiresConfirmation() bool {
+	return t.confirm
+}
+
+// Output returns the tool's result schema, nil if it has none
+func (t *FunctionTool) Output() json.RawMessage {
+	return t.output
+}
+
+// Metadata returns the tool's metadata
+func (t *FunctionTool) Metadata() Metadata {
+	return Metadata{
+		Name:        t.name,
+		Description: t.description,
+		Version:     t.version,
+		Category:    t.category,
+		Tags:        t.tags,
+		Parameters:  t.parameters,
+		Output:      t.output,
+		Source:      t.source,
+	}
+}
+
 // Execute runs the tool function
 func (t *FunctionTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	return t.fn(ctx, params)
@@ -228,3 +228,23 @@ func TestMetadata(t *testing.T) {
 		t.Errorf("Tags length = %v, want %v", len(unmarshaledMetadata.Tags), len(metadata.Tags))
 	}
 }
+
+func TestIsDeterministic(t *testing.T) {
+	tool := NewFunctionTool("add", "Adds", nil, nil)
+	if IsDeterministic(tool) {
+		t.Error("Tools are not deterministic unless they say so")
+	}
+	if !IsDeterministic(tool.WithDeterministic(true)) {
+		t.Error("Expected the tool to be deterministic")
+	}
+}
+
+func TestRequiresConfirmation(t *testing.T) {
+	tool := NewFunctionTool("rm", "Removes", nil, nil)
+	if RequiresConfirmation(tool) {
+		t.Error("Tools do not require confirmation unless they say so")
+	}
+	if !RequiresConfirmation(tool.WithConfirmation(true)) {
+		t.Error("Expected the tool to require confirmation")
+	}
+}
@@ -0,0 +1,148 @@
+// ABOUTME: Generates an OpenAPI document describing tools as HTTP operations
+// ABOUTME: Streams the document to a writer one operation at a time to bound memory use
+
+package tools
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// OpenAPIInfo describes the API in the generated document
+type OpenAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+	// ServerURL is listed under servers when set
+	ServerURL string
+}
+
+// DefaultOpenAPIInfo returns the info used by the CLI
+func DefaultOpenAPIInfo() OpenAPIInfo {
+	return OpenAPIInfo{
+		Title:   "llmspell tools",
+		Version: "0.1.0",
+	}
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	RequestBody openAPIBody                `json:"requestBody"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema json.RawMessage `json:"schema"`
+}
+
+var (
+	emptyObjectSchema = json.RawMessage(`{"type":"object"}`)
+	anySchema         = json.RawMessage(`{}`)
+)
+
+// WriteOpenAPI writes an OpenAPI 3.0 document with one POST /tools/{name}
+// operation per tool. Each operation is encoded and flushed on its own, so
+// the full document is never held in memory; this keeps large catalogs
+// cheap to serve over HTTP or write to a file.
+func WriteOpenAPI(w io.Writer, list []Tool, info OpenAPIInfo) error {
+	bw := bufio.NewWriter(w)
+
+	header := map[string]interface{}{
+		"title":   info.Title,
+		"version": info.Version,
+	}
+	if info.Description != "" {
+		header["description"] = info.Description
+	}
+	infoJSON, err := json.MarshalIndent(header, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(bw, "{\n  \"openapi\": \"3.0.3\",\n  \"info\": %s,\n", infoJSON)
+
+	if info.ServerURL != "" {
+		serverJSON, err := json.Marshal(info.ServerURL)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "  \"servers\": [\n    {\n      \"url\": %s\n    }\n  ],\n", serverJSON)
+	}
+
+	bw.WriteString("  \"paths\": {")
+	for i, tool := range list {
+		path, err := json.Marshal("/tools/" + url.PathEscape(tool.Name()))
+		if err != nil {
+			return err
+		}
+		op, err := json.MarshalIndent(map[string]openAPIOperation{"post": toolOperation(tool)}, "    ", "  ")
+		if err != nil {
+			return fmt.Errorf("tool %s: %w", tool.Name(), err)
+		}
+
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		fmt.Fprintf(bw, "\n    %s: %s", path, op)
+
+		// Hand each operation to the writer as it is produced
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(list) > 0 {
+		bw.WriteString("\n  ")
+	}
+	bw.WriteString("}\n}\n")
+
+	return bw.Flush()
+}
+
+// toolOperation describes one tool as an OpenAPI operation
+func toolOperation(tool Tool) openAPIOperation {
+	meta := MetadataFor(tool)
+
+	schema := tool.Parameters()
+	if len(schema) == 0 || !json.Valid(schema) {
+		schema = emptyObjectSchema
+	}
+	output := meta.Output
+	if len(output) == 0 || !json.Valid(output) {
+		output = anySchema
+	}
+
+	op := openAPIOperation{
+		OperationID: tool.Name(),
+		Summary:     tool.Description(),
+		RequestBody: openAPIBody{
+			Required: true,
+			Content:  map[string]openAPIMediaType{"application/json": {Schema: schema}},
+		},
+		Responses: map[string]openAPIResponse{
+			"200": {
+				Description: "Tool result",
+				Content:     map[string]openAPIMediaType{"application/json": {Schema: output}},
+			},
+			"400": {Description: "Invalid parameters"},
+			"500": {Description: "Tool execution failed"},
+		},
+	}
+	if meta.Category != "" {
+		op.Tags = []string{meta.Category}
+	}
+	return op
+}
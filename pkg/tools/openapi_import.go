@@ -0,0 +1,574 @@
+// ABOUTME: Generates callable tools from an OpenAPI 3 document, one per operation
+// ABOUTME: Parameters and JSON request bodies become the tool's schema; calls send the HTTP request and decode the reply
+
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxOpenAPIResponse bounds the reply an imported operation reads
+const maxOpenAPIResponse = 10 << 20
+
+// openAPIMethods are the operations a path item can hold, in the order
+// tools are generated
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// OpenAPIImportOptions says which operations of a document OpenAPITools
+// turns into tools and how their requests are made
+type OpenAPIImportOptions struct {
+	// Prefix is prepended to every tool's name
+	Prefix string
+
+	// BaseURL replaces the document's servers. SpecURL, where the document
+	// was fetched from, resolves relative server URLs.
+	BaseURL string
+	SpecURL string
+
+	// Operations and Tags, when set, keep only the operations with one of
+	// these operationIds or generated names, or with one of these tags
+	Operations []string
+	Tags       []string
+
+	// Headers are added to every request, then Authorize adds credentials
+	Headers   map[string]string
+	Authorize func(req *http.Request) error
+
+	// Client sends the requests; nil uses a client with a 30 second timeout
+	Client *http.Client
+}
+
+// ParseOpenAPI decodes an OpenAPI 3 document written in JSON or YAML
+func ParseOpenAPI(data []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		var raw interface{}
+		if yamlErr := yaml.Unmarshal(data, &raw); yamlErr != nil {
+			return nil, fmt.Errorf("invalid OpenAPI document: %w", yamlErr)
+		}
+		doc, _ = stringKeys(raw).(map[string]interface{})
+	}
+	version, _ := doc["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("not an OpenAPI 3 document")
+	}
+	return doc, nil
+}
+
+// stringKeys converts the maps YAML decodes with non-string keys, such as
+// response codes, to maps with string keys
+func stringKeys(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = stringKeys(item)
+		}
+		return value
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			result[fmt.Sprint(key)] = stringKeys(item)
+		}
+		return result
+	case []interface{}:
+		for i, item := range value {
+			value[i] = stringKeys(item)
+		}
+	}
+	return v
+}
+
+// openAPIParam is a parameter of an operation
+type openAPIParam struct {
+	name, in string
+	// key is the tool parameter holding its value
+	key string
+}
+
+// openAPIOp is an operation turned into a tool
+type openAPIOp struct {
+	method, path string
+	params       []openAPIParam
+	// body is the media type of the request body, or "" for none
+	body string
+}
+
+// OpenAPITools generates a tool per operation of doc, as ParseOpenAPI
+// returns it. A tool's parameters are the operation's path, query, header
+// and cookie parameters, by name, and its request body as body. Calling it
+// sends the request and returns the reply, decoded when it is JSON; a reply
+// with an error status is an error.
+func OpenAPITools(doc map[string]interface{}, opts OpenAPIImportOptions) ([]*FunctionTool, error) {
+	baseURL, err := openAPIBaseURL(doc, opts)
+	if err != nil {
+		return nil, err
+	}
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	info, _ := doc["info"].(map[string]interface{})
+	title, _ := info["title"].(string)
+	version, _ := info["version"].(string)
+	source := "openapi"
+	if title != "" {
+		source += ":" + title
+	}
+	resolver := refResolver{root: doc, resolving: make(map[string]bool)}
+
+	paths, _ := doc["paths"].(map[string]interface{})
+	pathNames := make([]string, 0, len(paths))
+	for path := range paths {
+		pathNames = append(pathNames, path)
+	}
+	sort.Strings(pathNames)
+
+	var result []*FunctionTool
+	names := make(map[string]bool)
+	for _, path := range pathNames {
+		item := resolver.deref(paths[path])
+		for _, method := range openAPIMethods {
+			operation, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name := openAPIOperationName(operation, method, path)
+			tags := stringList(operation["tags"])
+			operationID, _ := operation["operationId"].(string)
+			if !openAPISelected(opts, operationID, name, tags) {
+				continue
+			}
+
+			schema, op := openAPISchema(&resolver, item, operation, method, path)
+			name = opts.Prefix + name
+			for i := 2; names[name]; i++ {
+				name = fmt.Sprintf("%s%s_%d", opts.Prefix, openAPIOperationName(operation, method, path), i)
+			}
+			names[name] = true
+
+			parameters, err := json.Marshal(schema)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+			}
+			tool := NewFunctionTool(name, openAPIDescription(operation, method, path), parameters,
+				func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+					return callOpenAPI(ctx, client, baseURL, op, params, opts)
+				},
+			).WithMetadata("openapi", append([]string{"openapi"}, tags...)...).WithSource(source)
+			if version != "" {
+				tool.WithVersion(version)
+			}
+			if output := openAPIOutput(&resolver, operation); output != nil {
+				tool.WithOutput(output)
+			}
+			result = append(result, tool)
+		}
+	}
+	return result, nil
+}
+
+// openAPIBaseURL returns the URL operations' paths are appended to: the
+// BaseURL option, or the first server of the document with its variables
+// at their defaults
+func openAPIBaseURL(doc map[string]interface{}, opts OpenAPIImportOptions) (string, error) {
+	base := opts.BaseURL
+	if base == "" {
+		servers, _ := doc["servers"].([]interface{})
+		if len(servers) == 0 {
+			return "", fmt.Errorf("the document lists no servers; give a base URL")
+		}
+		server, _ := servers[0].(map[string]interface{})
+		base, _ = server["url"].(string)
+		variables, _ := server["variables"].(map[string]interface{})
+		for name, variable := range variables {
+			value, _ := variable.(map[string]interface{})
+			base = strings.ReplaceAll(base, "{"+name+"}", fmt.Sprint(value["default"]))
+		}
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL %q: %w", base, err)
+	}
+	if !u.IsAbs() {
+		spec, err := url.Parse(opts.SpecURL)
+		if err != nil || !spec.IsAbs() {
+			return "", fmt.Errorf("server URL %q is relative; give a base URL", base)
+		}
+		u = spec.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("server URL %q is not http or https", base)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// openAPIOperationName returns an operation's operationId, or a name made
+// of its method and path, with characters tool names cannot hold replaced
+func openAPIOperationName(operation map[string]interface{}, method, path string) string {
+	name, _ := operation["operationId"].(string)
+	if name == "" {
+		name = method + "_" + path
+	}
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+	for strings.Contains(name, "__") {
+		name = strings.ReplaceAll(name, "__", "_")
+	}
+	return strings.Trim(name, "_")
+}
+
+// openAPISelected reports whether the options keep an operation, named by
+// its operationId or by its tool name
+func openAPISelected(opts OpenAPIImportOptions, operationID, name string, tags []string) bool {
+	if len(opts.Operations) > 0 && !containsString(opts.Operations, operationID) && !containsString(opts.Operations, name) {
+		return false
+	}
+	if len(opts.Tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		if containsString(opts.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// openAPIDescription describes an operation by its summary, its
+// description, or its method and path
+func openAPIDescription(operation map[string]interface{}, method, path string) string {
+	for _, key := range []string{"summary", "description"} {
+		if text, _ := operation[key].(string); text != "" {
+			return text
+		}
+	}
+	return strings.ToUpper(method) + " " + path
+}
+
+// openAPISchema builds the parameter schema of an operation and records
+// where each parameter goes in the request. A parameter whose name another
+// already took is keyed <in>_<name>.
+func openAPISchema(resolver *refResolver, item, operation map[string]interface{}, method, path string) (map[string]interface{}, openAPIOp) {
+	op := openAPIOp{method: strings.ToUpper(method), path: path}
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	// Operation parameters override the path item's of the same name and
+	// location
+	declared := map[string]map[string]interface{}{}
+	var order []string
+	for _, list := range []interface{}{item["parameters"], operation["parameters"]} {
+		params, _ := list.([]interface{})
+		for _, p := range params {
+			param := resolver.deref(p)
+			name, _ := param["name"].(string)
+			in, _ := param["in"].(string)
+			if name == "" || in == "" {
+				continue
+			}
+			id := in + ":" + name
+			if _, ok := declared[id]; !ok {
+				order = append(order, id)
+			}
+			declared[id] = param
+		}
+	}
+
+	for _, id := range order {
+		param := declared[id]
+		name, in := param["name"].(string), param["in"].(string)
+		key := name
+		if _, taken := properties[key]; taken || key == "body" {
+			key = in + "_" + name
+		}
+		schema, _ := resolver.resolveValue(param["schema"]).(map[string]interface{})
+		if schema == nil {
+			schema = map[string]interface{}{"type": "string"}
+		}
+		if description, _ := param["description"].(string); description != "" {
+			schema["description"] = description
+		}
+		properties[key] = schema
+		if mandatory, _ := param["required"].(bool); mandatory || in == "path" {
+			required = append(required, key)
+		}
+		op.params = append(op.params, openAPIParam{name: name, in: in, key: key})
+	}
+
+	if body := resolver.deref(operation["requestBody"]); body != nil {
+		content, _ := body["content"].(map[string]interface{})
+		mediaTypes := make([]string, 0, len(content))
+		for mediaType := range content {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+		sort.Slice(mediaTypes, func(i, j int) bool {
+			return openAPIMediaRank(mediaTypes[i]) < openAPIMediaRank(mediaTypes[j])
+		})
+		if len(mediaTypes) > 0 {
+			op.body = mediaTypes[0]
+			media, _ := content[op.body].(map[string]interface{})
+			schema, _ := resolver.resolveValue(media["schema"]).(map[string]interface{})
+			if openAPIMediaRank(op.body) == 2 {
+				schema = map[string]interface{}{"type": "string"}
+			} else if schema == nil {
+				schema = map[string]interface{}{}
+			}
+			if description, _ := body["description"].(string); description != "" {
+				schema["description"] = description
+			}
+			properties["body"] = schema
+			if bodyRequired, _ := body["required"].(bool); bodyRequired {
+				required = append(required, "body")
+			}
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema, op
+}
+
+// openAPIMediaRank orders the request body media types an operation may
+// take: JSON first, then forms, then anything else, sent as text
+func openAPIMediaRank(mediaType string) int {
+	switch {
+	case strings.Contains(mediaType, "json"):
+		return 0
+	case mediaType == "application/x-www-form-urlencoded":
+		return 1
+	}
+	return 2
+}
+
+// openAPIOutput returns the JSON schema of an operation's first successful
+// response, or nil
+func openAPIOutput(resolver *refResolver, operation map[string]interface{}) json.RawMessage {
+	responses, _ := operation["responses"].(map[string]interface{})
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		response := resolver.deref(responses[code])
+		content, _ := response["content"].(map[string]interface{})
+		for mediaType, media := range content {
+			if !strings.Contains(mediaType, "json") {
+				continue
+			}
+			media, _ := media.(map[string]interface{})
+			schema, _ := resolver.resolveValue(media["schema"]).(map[string]interface{})
+			if schema == nil {
+				continue
+			}
+			data, err := json.Marshal(schema)
+			if err == nil {
+				return data
+			}
+		}
+	}
+	return nil
+}
+
+// resolveValue returns a copy of a part of the document with its
+// references inlined, or nil when they cannot be, as in a recursive schema
+func (r *refResolver) resolveValue(v interface{}) interface{} {
+	resolved, err := r.resolve(v)
+	if err != nil {
+		return nil
+	}
+	return resolved
+}
+
+// deref follows the reference a part of the document may be, without
+// inlining the references inside it
+func (r *refResolver) deref(v interface{}) map[string]interface{} {
+	value, _ := v.(map[string]interface{})
+	for i := 0; i < 10; i++ {
+		ref, ok := value["$ref"].(string)
+		if !ok {
+			return value
+		}
+		target, err := r.lookup(ref)
+		if err != nil {
+			return nil
+		}
+		value, _ = target.(map[string]interface{})
+	}
+	return nil
+}
+
+// callOpenAPI sends the request of an operation with a tool's parameters
+func callOpenAPI(ctx context.Context, client *http.Client, baseURL string, op openAPIOp, params map[string]interface{}, opts OpenAPIImportOptions) (interface{}, error) {
+	path := op.path
+	query := url.Values{}
+	header := http.Header{}
+	var cookies []*http.Cookie
+	for _, param := range op.params {
+		value, ok := params[param.key]
+		if !ok || value == nil {
+			if param.in == "path" {
+				return nil, fmt.Errorf("parameter %q is required", param.key)
+			}
+			continue
+		}
+		switch param.in {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+param.name+"}", url.PathEscape(openAPIJoin(value)))
+		case "query":
+			if list, ok := value.([]interface{}); ok {
+				for _, item := range list {
+					query.Add(param.name, openAPIString(item))
+				}
+			} else {
+				query.Set(param.name, openAPIString(value))
+			}
+		case "header":
+			header.Set(param.name, openAPIJoin(value))
+		case "cookie":
+			cookies = append(cookies, &http.Cookie{Name: param.name, Value: openAPIJoin(value)})
+		}
+	}
+
+	var body io.Reader
+	if value, ok := params["body"]; ok && op.body != "" {
+		switch openAPIMediaRank(op.body) {
+		case 0:
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("body: %w", err)
+			}
+			body = bytes.NewReader(data)
+		case 1:
+			form := url.Values{}
+			fields, _ := value.(map[string]interface{})
+			for key, item := range fields {
+				form.Set(key, openAPIString(item))
+			}
+			body = strings.NewReader(form.Encode())
+		default:
+			body = strings.NewReader(openAPIString(value))
+		}
+		header.Set("Content-Type", op.body)
+	}
+
+	target := baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, op.method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, */*;q=0.5")
+	for key, value := range opts.Headers {
+		req.Header.Set(key, value)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	if opts.Authorize != nil {
+		if err := opts.Authorize(req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOpenAPIResponse))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		text := strings.TrimSpace(string(data))
+		if len(text) > 500 {
+			text = text[:500] + "..."
+		}
+		return nil, fmt.Errorf("%s %s: %s: %s", op.method, op.path, resp.Status, text)
+	}
+	if len(data) > 0 && strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		var result interface{}
+		if err := json.Unmarshal(data, &result); err == nil {
+			return result, nil
+		}
+	}
+	return string(data), nil
+}
+
+// openAPIString formats a parameter value: strings as they are, numbers
+// without exponents, and anything else as JSON
+func openAPIString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool, int, int64:
+		return fmt.Sprint(v)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// openAPIJoin formats a path, header, or cookie value, joining lists with
+// commas as the simple style does
+func openAPIJoin(value interface{}) string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return openAPIString(value)
+	}
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = openAPIString(item)
+	}
+	return strings.Join(items, ",")
+}
+
+// stringList returns the strings of a list from a decoded document
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+// ABOUTME: Tests for generating tools from OpenAPI documents
+// ABOUTME: Verifies names, schemas, filters, and requests sent to a test server
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const petstoreYAML = `
+openapi: 3.0.3
+info:
+  title: Petstore
+  version: 1.2.0
+servers:
+  - url: /v1
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      summary: List pets
+      tags: [pets]
+      parameters:
+        - name: limit
+          in: query
+          schema: {type: integer}
+        - name: tag
+          in: query
+          schema: {type: array, items: {type: string}}
+      responses:
+        200:
+          description: The pets
+          content:
+            application/json:
+              schema:
+                type: array
+                items: {$ref: '#/components/schemas/Pet'}
+    post:
+      operationId: createPet
+      tags: [pets, admin]
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/Pet'}
+      responses:
+        201: {description: Created}
+  /pets/{id}:
+    parameters:
+      - $ref: '#/components/parameters/PetID'
+    delete:
+      description: Remove a pet
+      parameters:
+        - name: X-Reason
+          in: header
+          schema: {type: string}
+      responses:
+        204: {description: Removed}
+components:
+  parameters:
+    PetID:
+      name: id
+      in: path
+      description: The pet's id
+      schema: {type: string}
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name: {type: string}
+        parent: {$ref: '#/components/schemas/Pet'}
+`
+
+func TestParseOpenAPI(t *testing.T) {
+	doc, err := ParseOpenAPI([]byte(petstoreYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := doc["paths"].(map[string]interface{})["/pets"].(map[string]interface{})["get"].(map[string]interface{})["responses"]
+	if _, ok := responses.(map[string]interface{})["200"]; !ok {
+		t.Errorf("Expected response codes as string keys, got %v", responses)
+	}
+
+	if _, err := ParseOpenAPI([]byte(`{"swagger": "2.0"}`)); err == nil {
+		t.Error("Expected a Swagger 2 document to be refused")
+	}
+	if _, err := ParseOpenAPI([]byte("openapi: [")); err == nil {
+		t.Error("Expected invalid YAML to fail")
+	}
+}
+
+func TestOpenAPITools(t *testing.T) {
+	doc, err := ParseOpenAPI([]byte(petstoreYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenAPITools(doc, OpenAPIImportOptions{}); err == nil || !strings.Contains(err.Error(), "relative") {
+		t.Errorf("Expected a relative server to need a base URL, got %v", err)
+	}
+
+	list, err := OpenAPITools(doc, OpenAPIImportOptions{Prefix: "pet_", SpecURL: "https://example.com/openapi.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range list {
+		names = append(names, tool.Name())
+	}
+	if strings.Join(names, ",") != "pet_listPets,pet_createPet,pet_delete_pets_id" {
+		t.Fatalf("Unexpected tools: %v", names)
+	}
+
+	meta := list[1].Metadata()
+	if meta.Category != "openapi" || meta.Version != "1.2.0" || meta.Source != "openapi:Petstore" || strings.Join(meta.Tags, ",") != "openapi,pets,admin" {
+		t.Errorf("Unexpected metadata: %+v", meta)
+	}
+	if list[0].Description() != "List pets" || list[2].Description() != "Remove a pet" || list[1].Description() != "POST /pets" {
+		t.Errorf("Unexpected descriptions: %q, %q, %q", list[0].Description(), list[1].Description(), list[2].Description())
+	}
+
+	var schema struct {
+		Properties map[string]map[string]interface{} `json:"properties"`
+		Required   []string                          `json:"required"`
+	}
+	json.Unmarshal(list[2].Parameters(), &schema)
+	if schema.Properties["id"]["description"] != "The pet's id" || schema.Properties["X-Reason"]["type"] != "string" || len(schema.Required) != 1 || schema.Required[0] != "id" {
+		t.Errorf("Unexpected delete schema: %+v", schema)
+	}
+	// The recursive Pet schema cannot be inlined, so the body takes any value
+	json.Unmarshal(list[1].Parameters(), &schema)
+	if body, ok := schema.Properties["body"]; !ok || len(body) != 0 || schema.Required[0] != "body" {
+		t.Errorf("Unexpected create schema: %+v", schema)
+	}
+
+	filtered, err := OpenAPITools(doc, OpenAPIImportOptions{BaseURL: "http://localhost", Tags: []string{"admin"}})
+	if err != nil || len(filtered) != 1 || filtered[0].Name() != "createPet" {
+		t.Errorf("Expected only the admin operation, got %v, %v", filtered, err)
+	}
+	filtered, _ = OpenAPITools(doc, OpenAPIImportOptions{BaseURL: "http://localhost", Operations: []string{"listPets", "delete_pets_id"}})
+	if len(filtered) != 2 {
+		t.Errorf("Expected two operations, got %d", len(filtered))
+	}
+}
+
+func TestOpenAPIToolRequests(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		data, _ := io.ReadAll(r.Body)
+		gotBody = string(data)
+		switch {
+		case r.Method == http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `[{"name":"rex"}]`)
+		case r.Method == http.MethodDelete && r.URL.Path == "/v1/pets/missing":
+			http.Error(w, "no such pet", http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, "created")
+		}
+	}))
+	defer server.Close()
+
+	doc, err := ParseOpenAPI([]byte(petstoreYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := OpenAPITools(doc, OpenAPIImportOptions{
+		SpecURL: server.URL + "/openapi.yaml",
+		Headers: map[string]string{"User-Agent": "llmspell"},
+		Authorize: func(req *http.Request) error {
+			req.Header.Set("Authorization", "Bearer token")
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	result, err := list[0].Execute(ctx, map[string]interface{}{"limit": float64(10), "tag": []interface{}{"dog", "cat"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pets, ok := result.([]interface{}); !ok || pets[0].(map[string]interface{})["name"] != "rex" {
+		t.Errorf("Expected the decoded reply, got %v", result)
+	}
+	if got.URL.Path != "/v1/pets" || got.URL.RawQuery != "limit=10&tag=dog&tag=cat" || got.Header.Get("Authorization") != "Bearer token" || got.Header.Get("User-Agent") != "llmspell" {
+		t.Errorf("Unexpected request: %s %s %v", got.Method, got.URL, got.Header)
+	}
+
+	result, err = list[1].Execute(ctx, map[string]interface{}{"body": map[string]interface{}{"name": "tom"}})
+	if err != nil || result != "created" {
+		t.Errorf("Expected the text reply, got %v, %v", result, err)
+	}
+	if gotBody != `{"name":"tom"}` || got.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected body %q with %q", gotBody, got.Header.Get("Content-Type"))
+	}
+
+	if _, err := list[2].Execute(ctx, map[string]interface{}{"id": "a b", "X-Reason": "sold"}); err != nil {
+		t.Fatal(err)
+	}
+	if got.URL.EscapedPath() != "/v1/pets/a%20b" || got.Header.Get("X-Reason") != "sold" {
+		t.Errorf("Unexpected request: %s %v", got.URL.EscapedPath(), got.Header)
+	}
+	if _, err := list[2].Execute(ctx, map[string]interface{}{"id": "missing"}); err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "no such pet") {
+		t.Errorf("Expected the error status and reply, got %v", err)
+	}
+	if _, err := list[2].Execute(ctx, map[string]interface{}{}); err == nil {
+		t.Error("Expected a missing path parameter to fail")
+	}
+}
@@ -0,0 +1,133 @@
+// ABOUTME: Tests for OpenAPI document generation
+// ABOUTME: Verifies the streamed document is valid and that write errors surface
+
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestWriteOpenAPI(t *testing.T) {
+	list := []Tool{
+		NewFunctionTool("fetch", "Fetch a URL", json.RawMessage(`{
+			"type": "object",
+			"properties": {"url": {"type": "string"}},
+			"required": ["url"]
+		}`), nil).WithMetadata("web"),
+		NewFunctionTool("a b", "Name needs escaping", nil, nil),
+	}
+
+	info := DefaultOpenAPIInfo()
+	info.ServerURL = "http://localhost:8080"
+
+	var buf bytes.Buffer
+	if err := WriteOpenAPI(&buf, list, info); err != nil {
+		t.Fatalf("WriteOpenAPI failed: %v", err)
+	}
+
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title string `json:"title"`
+		} `json:"info"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths map[string]map[string]struct {
+			OperationID string   `json:"operationId"`
+			Tags        []string `json:"tags"`
+			RequestBody struct {
+				Content map[string]struct {
+					Schema map[string]interface{} `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &spec); err != nil {
+		t.Fatalf("Generated document is not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	if spec.OpenAPI != "3.0.3" || spec.Info.Title != info.Title {
+		t.Errorf("Unexpected header: %+v", spec)
+	}
+	if len(spec.Servers) != 1 || spec.Servers[0].URL != info.ServerURL {
+		t.Errorf("Expected server URL, got %+v", spec.Servers)
+	}
+
+	fetch := spec.Paths["/tools/fetch"]["post"]
+	if fetch.OperationID != "fetch" || len(fetch.Tags) != 1 || fetch.Tags[0] != "web" {
+		t.Errorf("Unexpected fetch operation: %+v", fetch)
+	}
+	if fetch.RequestBody.Content["application/json"].Schema["required"] == nil {
+		t.Error("Expected tool schema as the request body")
+	}
+
+	escaped := spec.Paths["/tools/a%20b"]["post"]
+	if escaped.RequestBody.Content["application/json"].Schema["type"] != "object" {
+		t.Errorf("Expected empty object schema for tool without parameters, got %+v", escaped)
+	}
+}
+
+func TestWriteOpenAPIEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteOpenAPI(&buf, nil, DefaultOpenAPIInfo()); err != nil {
+		t.Fatalf("WriteOpenAPI failed: %v", err)
+	}
+
+	var spec map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &spec); err != nil {
+		t.Fatalf("Generated document is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if paths, ok := spec["paths"].(map[string]interface{}); !ok || len(paths) != 0 {
+		t.Errorf("Expected empty paths, got %v", spec["paths"])
+	}
+}
+
+// failingWriter accepts a fixed number of bytes and then fails
+type failingWriter struct {
+	remaining int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.remaining {
+		n := w.remaining
+		w.remaining = 0
+		return n, errors.New("disk full")
+	}
+	w.remaining -= len(p)
+	return len(p), nil
+}
+
+func TestWriteOpenAPIWriteError(t *testing.T) {
+	list := make([]Tool, 200)
+	for i := range list {
+		list[i] = NewFunctionTool(fmt.Sprintf("tool_%d", i), "A tool", nil, nil)
+	}
+
+	err := WriteOpenAPI(&failingWriter{remaining: 1024}, list, DefaultOpenAPIInfo())
+	if err == nil || err.Error() != "disk full" {
+		t.Errorf("Expected write error, got %v", err)
+	}
+}
+
+func BenchmarkWriteOpenAPI(b *testing.B) {
+	list := make([]Tool, 500)
+	for i := range list {
+		list[i] = NewFunctionTool(fmt.Sprintf("tool_%d", i), "A tool", json.RawMessage(`{
+			"type": "object",
+			"properties": {"input": {"type": "string"}}
+		}`), nil)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := WriteOpenAPI(io.Discard, list, DefaultOpenAPIInfo()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
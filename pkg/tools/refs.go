@@ -0,0 +1,154 @@
+// ABOUTME: Resolves local $ref pointers in tool schemas by inlining the schemas they reference
+// ABOUTME: Supports #/definitions and #/$defs (any local JSON pointer) and rejects circular references
+
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ResolveRefs returns a copy of a JSON schema with every local $ref
+// replaced by the schema it points to, so code that walks properties, items
+// and the like sees the full schema. Keywords next to a $ref, such as a
+// description, override the referenced schema's. The definitions and $defs
+// sections are dropped once inlined.
+//
+// Only references within the schema ("#/definitions/Address",
+// "#/$defs/Address" or any other JSON pointer) are supported; a reference
+// that is remote, dangling or circular is an error.
+func ResolveRefs(schema json.RawMessage) (json.RawMessage, error) {
+	if len(schema) == 0 {
+		return schema, nil
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	resolved, err := ResolveSchemaRefs(root)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resolved)
+}
+
+// ResolveSchemaRefs is ResolveRefs for a schema already decoded into a map.
+// The map is not modified.
+func ResolveSchemaRefs(schema map[string]interface{}) (map[string]interface{}, error) {
+	r := refResolver{root: schema, resolving: make(map[string]bool)}
+	resolved, err := r.resolve(schema)
+	if err != nil {
+		return nil, err
+	}
+	result := resolved.(map[string]interface{})
+	delete(result, "definitions")
+	delete(result, "$defs")
+	return result, nil
+}
+
+// refResolver inlines references against the root schema; resolving holds
+// the references being inlined, to detect cycles
+type refResolver struct {
+	root      map[string]interface{}
+	resolving map[string]bool
+}
+
+// resolve returns a copy of a schema value with its references inlined
+func (r *refResolver) resolve(v interface{}) (interface{}, error) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := value["$ref"].(string); ok {
+			return r.inline(ref, value)
+		}
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			resolved, err := r.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = resolved
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			resolved, err := r.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = resolved
+		}
+		return result, nil
+	}
+	return v, nil
+}
+
+// inline resolves the schema a $ref points to and merges the keywords of
+// the referencing schema over it
+func (r *refResolver) inline(ref string, schema map[string]interface{}) (interface{}, error) {
+	if r.resolving[ref] {
+		return nil, fmt.Errorf("circular $ref: %s", ref)
+	}
+	target, err := r.lookup(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	r.resolving[ref] = true
+	resolved, err := r.resolve(target)
+	delete(r.resolving, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, ok := resolved.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("$ref %s does not point to a schema", ref)
+	}
+	for key, item := range schema {
+		if key == "$ref" {
+			continue
+		}
+		value, err := r.resolve(item)
+		if err != nil {
+			return nil, err
+		}
+		merged[key] = value
+	}
+	return merged, nil
+}
+
+// lookup follows a local JSON pointer from the root schema
+func (r *refResolver) lookup(ref string) (interface{}, error) {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %s: only local references are supported", ref)
+	}
+
+	var current interface{} = r.root
+	if pointer == "" {
+		return current, nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("unresolved $ref: %s", ref)
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("unresolved $ref: %s", ref)
+			}
+			current = node[i]
+		default:
+			return nil, fmt.Errorf("unresolved $ref: %s", ref)
+		}
+	}
+	return current, nil
+}
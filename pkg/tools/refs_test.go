@@ -0,0 +1,117 @@
+// ABOUTME: Tests for resolving $ref pointers in tool schemas
+// ABOUTME: Covers definitions, $defs, sibling keywords, and remote, dangling and circular references
+
+package tools
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveRefs(t *testing.T) {
+	raw := json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"from": {"$ref": "#/definitions/address", "description": "Sender"},
+			"to": {"$ref": "#/$defs/address"},
+			"stops": {"type": "array", "items": {"$ref": "#/$defs/address"}},
+			"mode": {"$ref": "#/definitions/mode"}
+		},
+		"definitions": {
+			"address": {"$ref": "#/$defs/address"},
+			"mode": {"type": "string", "enum": ["air", "sea"]}
+		},
+		"$defs": {
+			"address": {
+				"type": "object",
+				"properties": {"city": {"type": "string"}, "zip~/code": {"type": "string"}},
+				"required": ["city"]
+			}
+		}
+	}`)
+
+	resolved, err := ResolveRefs(raw)
+	if err != nil {
+		t.Fatalf("ResolveRefs failed: %v", err)
+	}
+	schema := decodeSchema(t, resolved)
+
+	if _, ok := schema["definitions"]; ok {
+		t.Error("definitions should be dropped once inlined")
+	}
+	if _, ok := schema["$defs"]; ok {
+		t.Error("$defs should be dropped once inlined")
+	}
+
+	address := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"city":      map[string]interface{}{"type": "string"},
+			"zip~/code": map[string]interface{}{"type": "string"},
+		},
+		"required": []interface{}{"city"},
+	}
+	props := schema["properties"].(map[string]interface{})
+	if !reflect.DeepEqual(props["to"], address) {
+		t.Errorf("expected to to be the address schema, got %v", props["to"])
+	}
+	if !reflect.DeepEqual(props["stops"].(map[string]interface{})["items"], address) {
+		t.Errorf("expected stops items to be the address schema, got %v", props["stops"])
+	}
+	from := props["from"].(map[string]interface{})
+	if from["description"] != "Sender" || from["type"] != "object" {
+		t.Errorf("expected sibling keywords merged over the reference, got %v", from)
+	}
+	if props["mode"].(map[string]interface{})["type"] != "string" {
+		t.Errorf("expected mode to be resolved, got %v", props["mode"])
+	}
+
+	// Escaped pointer tokens and the original schema are left intact
+	pointer, err := ResolveSchemaRefs(map[string]interface{}{
+		"properties": map[string]interface{}{
+			"zip": map[string]interface{}{"$ref": "#/$defs/address/properties/zip~0~1code"},
+		},
+		"$defs": map[string]interface{}{
+			"address": map[string]interface{}{
+				"properties": map[string]interface{}{"zip~/code": map[string]interface{}{"type": "string"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ResolveSchemaRefs failed: %v", err)
+	}
+	zip := pointer["properties"].(map[string]interface{})["zip"]
+	if !reflect.DeepEqual(zip, map[string]interface{}{"type": "string"}) {
+		t.Errorf("expected escaped pointer to resolve, got %v", zip)
+	}
+
+	if empty, err := ResolveRefs(nil); err != nil || empty != nil {
+		t.Errorf("expected an empty schema to stay empty, got %s, %v", empty, err)
+	}
+}
+
+func TestResolveRefsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{"circular", `{"properties": {"a": {"$ref": "#/definitions/a"}}, "definitions": {"a": {"$ref": "#/definitions/b"}, "b": {"$ref": "#/definitions/a"}}}`, "circular $ref"},
+		{"recursive", `{"definitions": {"node": {"properties": {"next": {"$ref": "#/definitions/node"}}}}}`, "circular $ref"},
+		{"dangling", `{"properties": {"a": {"$ref": "#/definitions/missing"}}}`, "unresolved $ref"},
+		{"remote", `{"properties": {"a": {"$ref": "https://example.com/schema.json"}}}`, "only local references"},
+		{"not a schema", `{"properties": {"a": {"$ref": "#/definitions/n"}}, "definitions": {"n": 3}}`, "does not point to a schema"},
+		{"invalid", `{`, "failed to parse schema"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ResolveRefs(json.RawMessage(tt.schema))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+// ABOUTME: Derives JSON schemas for tool parameters and results from Go struct types
+// ABOUTME: NewTypedTool builds a tool from a typed Go function, keeping its schemas in sync with its structs
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf returns the JSON schema of the type of v, which is usually a
+// struct (or a pointer to one) describing a tool's parameters or result.
+//
+// Property names and omissions follow the json tags, as encoding/json
+// does, and embedded structs are flattened. A description tag documents a
+// property. The validate tag adds constraints: required, min and max
+// (minimum and maximum for numbers, lengths for strings, item counts for
+// slices), and oneof, a space-separated enum. Recursive types are not
+// supported.
+func SchemaOf(v interface{}) (json.RawMessage, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, fmt.Errorf("cannot derive a schema from nil")
+	}
+	schema, err := schemaFor(t, make(map[reflect.Type]bool))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(schema)
+}
+
+// schemaFor builds the schema of t; seen holds the struct types being
+// built, to reject recursive ones
+func schemaFor(t reflect.Type, seen map[reflect.Type]bool) (map[string]interface{}, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	case t.Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem()):
+		return map[string]interface{}{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json writes []byte as base64
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}, nil
+		}
+		items, err := schemaFor(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map keys of %s must be strings", t)
+		}
+		values, err := schemaFor(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		schema := map[string]interface{}{"type": "object"}
+		if len(values) > 0 {
+			schema["additionalProperties"] = values
+		}
+		return schema, nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil
+	case reflect.Struct:
+		return structSchema(t, seen)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// structSchema builds the object schema of a struct type
+func structSchema(t reflect.Type, seen map[reflect.Type]bool) (map[string]interface{}, error) {
+	if seen[t] {
+		return nil, fmt.Errorf("recursive type %s", t)
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	properties := make(map[string]interface{})
+	required := []string{}
+	if err := addFields(t, properties, &required, seen); err != nil {
+		return nil, err
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema, nil
+}
+
+// addFields adds the properties of a struct's fields, flattening embedded
+// structs without a json name as encoding/json does
+func addFields(t reflect.Type, properties map[string]interface{}, required *[]string, seen map[reflect.Type]bool) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := jsonName(field)
+		if !ok {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if err := addFields(embedded, properties, required, seen); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop, err := schemaFor(field.Type, seen)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if desc := field.Tag.Get("description"); desc != "" {
+			prop["description"] = desc
+		}
+		isRequired, err := applyValidate(prop, field.Tag.Get("validate"))
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if isRequired {
+			*required = append(*required, name)
+		}
+		properties[name] = prop
+	}
+	return nil
+}
+
+// jsonName returns the name encoding/json gives a field, empty for an
+// untagged one; ok is false for fields it skips
+func jsonName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() && !field.Anonymous {
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, true
+}
+
+// applyValidate adds the constraints of a validate tag to prop and reports
+// whether it marks the property required
+func applyValidate(prop map[string]interface{}, tag string) (bool, error) {
+	if tag == "" {
+		return false, nil
+	}
+
+	isRequired := false
+	for _, rule := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch key {
+		case "required":
+			isRequired = true
+		case "min", "max":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return false, fmt.Errorf("invalid %s=%q", key, value)
+			}
+			prop[boundKeyword(prop["type"], key)] = n
+		case "oneof":
+			var enum []interface{}
+			for _, option := range strings.Fields(value) {
+				enum = append(enum, enumValue(prop["type"], option))
+			}
+			prop["enum"] = enum
+		}
+	}
+	return isRequired, nil
+}
+
+// boundKeyword is the JSON schema keyword for a min or max rule on a
+// property of the given type
+func boundKeyword(schemaType interface{}, rule string) string {
+	var prefix string
+	switch schemaType {
+	case "string":
+		prefix = "Length"
+	case "array":
+		prefix = "Items"
+	case "object":
+		prefix = "Properties"
+	default:
+		if rule == "min" {
+			return "minimum"
+		}
+		return "maximum"
+	}
+	if rule == "min" {
+		return "min" + prefix
+	}
+	return "max" + prefix
+}
+
+// enumValue converts a oneof option to the property's type
+func enumValue(schemaType interface{}, option string) interface{} {
+	switch schemaType {
+	case "integer", "number":
+		if n, err := strconv.ParseFloat(option, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(option); err == nil {
+			return b
+		}
+	}
+	return option
+}
+
+// NewTypedTool creates a tool from a function taking a parameter struct.
+// The tool's parameter schema is derived from P and its output schema from
+// R with SchemaOf. Parameters are decoded into P through their JSON form,
+// after checking the required ones are present, and the result is returned
+// in its JSON form, so scripts see the json field names.
+func NewTypedTool[P, R any](name, description string, fn func(ctx context.Context, params P) (R, error)) (*FunctionTool, error) {
+	var params P
+	var result R
+	paramSchema, err := SchemaOf(&params)
+	if err != nil {
+		return nil, fmt.Errorf("tool %s parameters: %w", name, err)
+	}
+	outputSchema, err := SchemaOf(&result)
+	if err != nil {
+		return nil, fmt.Errorf("tool %s result: %w", name, err)
+	}
+
+	var schema struct {
+		Required []string `json:"required"`
+	}
+	_ = json.Unmarshal(paramSchema, &schema)
+
+	tool := NewFunctionTool(name, description, paramSchema, func(ctx context.Context, raw map[string]interface{}) (interface{}, error) {
+		for _, field := range schema.Required {
+			if _, ok := raw[field]; !ok {
+				return nil, fmt.Errorf("missing required parameter: %s", field)
+			}
+		}
+
+		var params P
+		if err := convertJSON(raw, &params); err != nil {
+			return nil, fmt.Errorf("invalid parameters: %w", err)
+		}
+		result, err := fn(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		var out interface{}
+		if err := convertJSON(result, &out); err != nil {
+			return nil, fmt.Errorf("invalid result: %w", err)
+		}
+		return out, nil
+	})
+	return tool.WithOutput(outputSchema), nil
+}
+
+// convertJSON converts from into to through their JSON encoding
+func convertJSON(from, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
@@ -0,0 +1,173 @@
+// ABOUTME: Tests for deriving tool schemas from Go structs
+// ABOUTME: Covers json and validate tags, nested types, and tools built with NewTypedTool
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type schemaBase struct {
+	ID string `json:"id"`
+}
+
+type schemaParams struct {
+	schemaBase
+	Query   string         `json:"query" validate:"required,min=1,max=100" description:"Search terms"`
+	Limit   int            `json:"limit,omitempty" validate:"min=1,max=50"`
+	Sort    string         `json:"sort,omitempty" validate:"oneof=relevance date"`
+	Ratio   *float64       `json:"ratio,omitempty"`
+	Tags    []string       `json:"tags,omitempty" validate:"max=5"`
+	Labels  map[string]int `json:"labels,omitempty"`
+	Address schemaAddress  `json:"address"`
+	Since   time.Time      `json:"since"`
+	Extra   interface{}    `json:"extra"`
+	Skipped string         `json:"-"`
+	hidden  string
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+type schemaNode struct {
+	Children []schemaNode `json:"children"`
+}
+
+func decodeSchema(t *testing.T, raw json.RawMessage) map[string]interface{} {
+	t.Helper()
+	var schema map[string]interface{}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	return schema
+}
+
+func TestSchemaOf(t *testing.T) {
+	raw, err := SchemaOf(schemaParams{})
+	if err != nil {
+		t.Fatalf("SchemaOf failed: %v", err)
+	}
+	schema := decodeSchema(t, raw)
+
+	if schema["type"] != "object" {
+		t.Errorf("expected object schema, got %v", schema["type"])
+	}
+	if !reflect.DeepEqual(schema["required"], []interface{}{"query"}) {
+		t.Errorf("expected query to be the only required field, got %v", schema["required"])
+	}
+
+	props := schema["properties"].(map[string]interface{})
+	for _, name := range []string{"Skipped", "hidden", "schemaBase"} {
+		if _, ok := props[name]; ok {
+			t.Errorf("property %s should not be in the schema", name)
+		}
+	}
+
+	tests := []struct {
+		property string
+		want     map[string]interface{}
+	}{
+		{"id", map[string]interface{}{"type": "string"}},
+		{"query", map[string]interface{}{"type": "string", "description": "Search terms", "minLength": 1.0, "maxLength": 100.0}},
+		{"limit", map[string]interface{}{"type": "integer", "minimum": 1.0, "maximum": 50.0}},
+		{"sort", map[string]interface{}{"type": "string", "enum": []interface{}{"relevance", "date"}}},
+		{"ratio", map[string]interface{}{"type": "number"}},
+		{"tags", map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "maxItems": 5.0}},
+		{"labels", map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "integer"}}},
+		{"since", map[string]interface{}{"type": "string", "format": "date-time"}},
+		{"extra", map[string]interface{}{}},
+		{"address", map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}},
+			"required":   []interface{}{"city"},
+		}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(props[tt.property], tt.want) {
+			t.Errorf("property %s: expected %v, got %v", tt.property, tt.want, props[tt.property])
+		}
+	}
+}
+
+func TestSchemaOfErrors(t *testing.T) {
+	if _, err := SchemaOf(nil); err == nil {
+		t.Error("expected an error for nil")
+	}
+	if _, err := SchemaOf(schemaNode{}); err == nil || !strings.Contains(err.Error(), "recursive") {
+		t.Errorf("expected a recursive type error, got %v", err)
+	}
+	if _, err := SchemaOf(struct {
+		Handler func() `json:"handler"`
+	}{}); err == nil || !strings.Contains(err.Error(), "field Handler") {
+		t.Errorf("expected an unsupported field error, got %v", err)
+	}
+	if _, err := SchemaOf(struct {
+		N int `json:"n" validate:"min=low"`
+	}{}); err == nil {
+		t.Error("expected an error for an invalid min")
+	}
+}
+
+type greetParams struct {
+	Name  string `json:"name" validate:"required"`
+	Times int    `json:"times,omitempty"`
+}
+
+type greetResult struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestNewTypedTool(t *testing.T) {
+	tool, err := NewTypedTool("greet", "Greet someone", func(ctx context.Context, p greetParams) (greetResult, error) {
+		return greetResult{Greeting: strings.Repeat("hello "+p.Name+" ", max(p.Times, 1))}, nil
+	})
+	if err != nil {
+		t.Fatalf("NewTypedTool failed: %v", err)
+	}
+
+	params := decodeSchema(t, tool.Parameters())
+	if !reflect.DeepEqual(params["required"], []interface{}{"name"}) {
+		t.Errorf("unexpected parameter schema: %s", tool.Parameters())
+	}
+	if meta := tool.Metadata(); string(meta.Output) != string(tool.Output()) || len(meta.Output) == 0 {
+		t.Errorf("expected the output schema in the metadata, got %s", meta.Output)
+	}
+
+	result, err := tool.Execute(context.Background(), map[string]interface{}{"name": "Ada", "times": 2.0})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	want := map[string]interface{}{"greeting": "hello Ada hello Ada "}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("expected %v, got %v", want, result)
+	}
+
+	if _, err := tool.Execute(context.Background(), map[string]interface{}{}); err == nil || !strings.Contains(err.Error(), "name") {
+		t.Errorf("expected a missing parameter error, got %v", err)
+	}
+	if _, err := tool.Execute(context.Background(), map[string]interface{}{"name": 3}); err == nil {
+		t.Error("expected an error for a parameter of the wrong type")
+	}
+
+	if _, err := NewTypedTool("bad", "Bad", func(ctx context.Context, p schemaNode) (string, error) {
+		return "", nil
+	}); err == nil {
+		t.Error("expected an error for a recursive parameter type")
+	}
+}
+
+func TestOpenAPIUsesOutputSchema(t *testing.T) {
+	tool := NewFunctionTool("echo", "Echo", nil, nil).WithOutput(json.RawMessage(`{"type":"string"}`))
+	op := toolOperation(tool)
+	schema := op.Responses["200"].Content["application/json"].Schema
+	if string(schema) != `{"type":"string"}` {
+		t.Errorf("expected the output schema for the response, got %s", schema)
+	}
+}
@@ -0,0 +1,244 @@
+// ABOUTME: Implements ranked, typo-tolerant search and faceted browsing over tools
+// ABOUTME: Scores tools by relevance and groups them by category and tag
+
+package tools
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchResult is a tool matched by Search together with its relevance score
+type SearchResult struct {
+	Tool     Tool
+	Metadata Metadata
+	Score    float64
+}
+
+// Field weights: a match in the name counts more than one in the description
+const (
+	nameWeight        = 4.0
+	tagWeight         = 3.0
+	categoryWeight    = 3.0
+	descriptionWeight = 1.0
+)
+
+// Search returns the tools in the registry that match the query, best match
+// first. Each query term is scored against the tool's name, tags, category,
+// and description; exact word matches score highest, then prefixes and
+// substrings, then words within a small edit distance.
+func Search(registry Registry, query string) []SearchResult {
+	terms := searchWords(query)
+	if len(terms) == 0 {
+		return []SearchResult{}
+	}
+
+	results := []SearchResult{}
+	for _, tool := range registry.List() {
+		meta := MetadataFor(tool)
+		score := scoreMetadata(meta, terms)
+		if score > 0 {
+			results = append(results, SearchResult{
+				Tool:     tool,
+				Metadata: meta,
+				Score:    score,
+			})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Metadata.Name < results[j].Metadata.Name
+	})
+
+	return results
+}
+
+// scoreMetadata sums the best field score of every query term. A term that
+// matches nothing contributes zero, so partial matches still rank.
+func scoreMetadata(meta Metadata, terms []string) float64 {
+	nameWords := searchWords(meta.Name)
+	descriptionWords := searchWords(meta.Description)
+	categoryWords := searchWords(meta.Category)
+	tagWords := []string{}
+	for _, tag := range meta.Tags {
+		tagWords = append(tagWords, searchWords(tag)...)
+	}
+
+	total := 0.0
+	for _, term := range terms {
+		best := 0.0
+		for _, field := range []struct {
+			words  []string
+			weight float64
+		}{
+			{nameWords, nameWeight},
+			{tagWords, tagWeight},
+			{categoryWords, categoryWeight},
+			{descriptionWords, descriptionWeight},
+		} {
+			if score := matchWords(term, field.words) * field.weight; score > best {
+				best = score
+			}
+		}
+		total += best
+	}
+
+	// A full-name match outranks a tool that merely mentions every term
+	if strings.EqualFold(strings.Join(terms, "_"), meta.Name) {
+		total += nameWeight
+	}
+
+	return total
+}
+
+// matchWords returns how well a term matches the best of the given words,
+// from 1 (exact) down to 0 (no match)
+func matchWords(term string, words []string) float64 {
+	best := 0.0
+	for _, word := range words {
+		var score float64
+		switch {
+		case word == term:
+			score = 1.0
+		case strings.HasPrefix(word, term):
+			score = 0.8
+		case strings.Contains(word, term):
+			score = 0.6
+		default:
+			if distance := levenshtein(term, word); distance <= maxTypos(term) {
+				score = 0.5 - 0.1*float64(distance)
+			}
+		}
+		if score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+// maxTypos is the edit distance tolerated for a term, scaled by its length
+// so short terms must match closely
+func maxTypos(term string) int {
+	switch n := len([]rune(term)); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// searchWords lowercases text and splits it into words on any
+// non-alphanumeric character, so "web_fetch" yields "web" and "fetch"
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// FacetCount is a category or tag together with the number of tools using it
+type FacetCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Categories returns the distinct categories across the registry's tools
+// with how many tools are in each, sorted by name. Uncategorized tools are
+// not counted.
+func Categories(registry Registry) []FacetCount {
+	counts := make(map[string]int)
+	for _, tool := range registry.List() {
+		if category := MetadataFor(tool).Category; category != "" {
+			counts[category]++
+		}
+	}
+	return sortedFacets(counts)
+}
+
+// Tags returns the distinct tags across the registry's tools with how many
+// tools carry each, sorted by name
+func Tags(registry Registry) []FacetCount {
+	counts := make(map[string]int)
+	for _, tool := range registry.List() {
+		for _, tag := range MetadataFor(tool).Tags {
+			counts[tag]++
+		}
+	}
+	return sortedFacets(counts)
+}
+
+// ListByCategory returns the tools in a category, sorted by name
+func ListByCategory(registry Registry, category string) []Tool {
+	return filterTools(registry, func(meta Metadata) bool {
+		return meta.Category == category
+	})
+}
+
+// ListByTag returns the tools carrying a tag, sorted by name
+func ListByTag(registry Registry, tag string) []Tool {
+	return filterTools(registry, func(meta Metadata) bool {
+		for _, t := range meta.Tags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// filterTools returns the tools whose metadata satisfies match, sorted by name
+func filterTools(registry Registry, match func(Metadata) bool) []Tool {
+	matched := []Tool{}
+	for _, tool := range registry.List() {
+		if match(MetadataFor(tool)) {
+			matched = append(matched, tool)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Name() < matched[j].Name()
+	})
+	return matched
+}
+
+// sortedFacets converts a count map into facets sorted by name
+func sortedFacets(counts map[string]int) []FacetCount {
+	facets := make([]FacetCount, 0, len(counts))
+	for name, count := range counts {
+		facets = append(facets, FacetCount{Name: name, Count: count})
+	}
+
+	sort.Slice(facets, func(i, j int) bool {
+		return facets[i].Name < facets[j].Name
+	})
+	return facets
+}
@@ -0,0 +1,145 @@
+// ABOUTME: Tests for ranked tool search
+// ABOUTME: Verifies field weighting, typo tolerance, and result ordering
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func createCategorizedTool(name, description, category string, tags ...string) Tool {
+	return NewFunctionTool(
+		name,
+		description,
+		json.RawMessage(`{"type":"object"}`),
+		func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			return nil, nil
+		},
+	).WithMetadata(category, tags...)
+}
+
+func TestSearch(t *testing.T) {
+	reg := NewRegistry()
+	for _, tool := range []Tool{
+		createCategorizedTool("web_fetch", "Fetches content from a URL", "web", "http"),
+		createCategorizedTool("file_read", "Reads a file from disk", "file", "io"),
+		createCategorizedTool("summarize", "Summarizes text fetched from the web", "text"),
+		createTestTool("plain", "A tool without metadata"),
+	} {
+		if err := reg.Register(tool); err != nil {
+			t.Fatalf("Failed to register tool: %v", err)
+		}
+	}
+
+	t.Run("name match ranks first", func(t *testing.T) {
+		results := Search(reg, "fetch")
+		if len(results) < 2 {
+			t.Fatalf("Expected at least 2 results, got %d", len(results))
+		}
+		if results[0].Metadata.Name != "web_fetch" {
+			t.Errorf("Expected web_fetch first, got %s", results[0].Metadata.Name)
+		}
+		if results[0].Score <= results[1].Score {
+			t.Errorf("Expected descending scores, got %v then %v", results[0].Score, results[1].Score)
+		}
+	})
+
+	t.Run("typo tolerance", func(t *testing.T) {
+		results := Search(reg, "summarise")
+		if len(results) == 0 || results[0].Metadata.Name != "summarize" {
+			t.Errorf("Expected summarize for misspelled query, got %v", results)
+		}
+	})
+
+	t.Run("tag and category match", func(t *testing.T) {
+		results := Search(reg, "http")
+		if len(results) != 1 || results[0].Metadata.Name != "web_fetch" {
+			t.Errorf("Expected only web_fetch for tag query, got %v", results)
+		}
+
+		results = Search(reg, "file")
+		if len(results) == 0 || results[0].Metadata.Name != "file_read" {
+			t.Errorf("Expected file_read first for category query, got %v", results)
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		if results := Search(reg, "zzz"); len(results) != 0 {
+			t.Errorf("Expected no results, got %d", len(results))
+		}
+		if results := Search(reg, "  "); len(results) != 0 {
+			t.Errorf("Expected no results for empty query, got %d", len(results))
+		}
+	})
+}
+
+func TestFacets(t *testing.T) {
+	reg := NewRegistry()
+	for _, tool := range []Tool{
+		createCategorizedTool("web_fetch", "Fetches a URL", "web", "http", "builtin"),
+		createCategorizedTool("web_post", "Posts to a URL", "web", "http"),
+		createCategorizedTool("file_read", "Reads a file", "file", "builtin"),
+		createTestTool("plain", "A tool without metadata"),
+	} {
+		if err := reg.Register(tool); err != nil {
+			t.Fatalf("Failed to register tool: %v", err)
+		}
+	}
+
+	categories := Categories(reg)
+	wantCategories := []FacetCount{{"file", 1}, {"web", 2}}
+	if len(categories) != len(wantCategories) {
+		t.Fatalf("Categories = %v, want %v", categories, wantCategories)
+	}
+	for i, want := range wantCategories {
+		if categories[i] != want {
+			t.Errorf("Categories[%d] = %v, want %v", i, categories[i], want)
+		}
+	}
+
+	tags := Tags(reg)
+	wantTags := []FacetCount{{"builtin", 2}, {"http", 2}}
+	if len(tags) != len(wantTags) {
+		t.Fatalf("Tags = %v, want %v", tags, wantTags)
+	}
+	for i, want := range wantTags {
+		if tags[i] != want {
+			t.Errorf("Tags[%d] = %v, want %v", i, tags[i], want)
+		}
+	}
+
+	web := ListByCategory(reg, "web")
+	if len(web) != 2 || web[0].Name() != "web_fetch" || web[1].Name() != "web_post" {
+		t.Errorf("ListByCategory(web) returned unexpected tools: %v", web)
+	}
+
+	builtin := ListByTag(reg, "builtin")
+	if len(builtin) != 2 || builtin[0].Name() != "file_read" || builtin[1].Name() != "web_fetch" {
+		t.Errorf("ListByTag(builtin) returned unexpected tools: %v", builtin)
+	}
+
+	if none := ListByTag(reg, "missing"); len(none) != 0 {
+		t.Errorf("Expected no tools for unknown tag, got %d", len(none))
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"fetch", "fetch", 0},
+		{"fetch", "fecth", 2},
+		{"summarise", "summarize", 1},
+		{"", "abc", 3},
+	}
+
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
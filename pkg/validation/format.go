@@ -0,0 +1,79 @@
+// ABOUTME: Renders validation results as human-readable messages, tersely or in detail
+// ABOUTME: Terse output fits on one line; verbose output groups errors by field, one per line
+
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Formatter renders a Result. The terse form joins the errors on one line,
+// as in "field 'temperature' must be ≤ 2, got 5; field 'name' is
+// required". The verbose form counts the errors, groups them by field and
+// lists each error and its details on their own lines.
+type Formatter struct {
+	Verbose bool
+}
+
+// Format renders r; a valid result renders as an empty string
+func (f Formatter) Format(r *Result) string {
+	if r.Valid() {
+		return ""
+	}
+	if !f.Verbose {
+		messages := make([]string, len(r.Errors))
+		for i, err := range r.Errors {
+			messages[i] = err.Error()
+		}
+		return strings.Join(messages, "; ")
+	}
+
+	var b strings.Builder
+	if len(r.Errors) == 1 {
+		b.WriteString("1 validation error")
+	} else {
+		fmt.Fprintf(&b, "%d validation errors", len(r.Errors))
+	}
+	for _, group := range groupByField(r.Errors) {
+		name := group[0].Field
+		if name == "" {
+			name = "(input)"
+		}
+		if len(group) == 1 {
+			fmt.Fprintf(&b, "\n  %s: %s", name, group[0].Message)
+			writeDetails(&b, group[0].Details, "    ")
+			continue
+		}
+		fmt.Fprintf(&b, "\n  %s:", name)
+		for _, err := range group {
+			fmt.Fprintf(&b, "\n    - %s", err.Message)
+			writeDetails(&b, err.Details, "      ")
+		}
+	}
+	return b.String()
+}
+
+// writeDetails lists details below their error
+func writeDetails(b *strings.Builder, details []string, indent string) {
+	for _, detail := range details {
+		b.WriteString("\n" + indent + "- " + detail)
+	}
+}
+
+// groupByField groups errors by field, keeping the order in which fields
+// first appear
+func groupByField(errors []Error) [][]Error {
+	var groups [][]Error
+	index := make(map[string]int)
+	for _, err := range errors {
+		i, ok := index[err.Field]
+		if !ok {
+			i = len(groups)
+			index[err.Field] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], err)
+	}
+	return groups
+}
@@ -0,0 +1,88 @@
+// ABOUTME: Tests for rendering validation results
+// ABOUTME: Covers terse one-line output, verbose grouping by field, and result helpers
+
+package validation
+
+import (
+	"errors"
+	"testing"
+)
+
+func sampleResult() *Result {
+	r := &Result{}
+	r.Addf("temperature", CodeMaximum, "must be ≤ 2, got %g", 5.0)
+	r.Add(Required("name"))
+	r.Add(Error{Field: "", Code: CodeOneOf, Message: "must match one of 2 alternatives",
+		Details: []string{"alternative 1: field 'id' is required", "alternative 2: field 'url' is required"}})
+	r.Addf("temperature", CodeType, "must be a number, got %s", TypeName("hot"))
+	return r
+}
+
+func TestFormatTerse(t *testing.T) {
+	want := "field 'temperature' must be ≤ 2, got 5; field 'name' is required; " +
+		"input must match one of 2 alternatives (alternative 1: field 'id' is required; alternative 2: field 'url' is required); " +
+		"field 'temperature' must be a number, got string"
+	if got := (Formatter{}).Format(sampleResult()); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+	if got := sampleResult().Error(); got != want {
+		t.Errorf("expected Error to be terse, got %s", got)
+	}
+}
+
+func TestFormatVerbose(t *testing.T) {
+	want := `4 validation errors
+  temperature:
+    - must be ≤ 2, got 5
+    - must be a number, got string
+  name: is required
+  (input): must match one of 2 alternatives
+    - alternative 1: field 'id' is required
+    - alternative 2: field 'url' is required`
+	if got := (Formatter{Verbose: true}).Format(sampleResult()); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	single := &Result{}
+	single.Add(Required("model"))
+	if got := (Formatter{Verbose: true}).Format(single); got != "1 validation error\n  model: is required" {
+		t.Errorf("unexpected single error output: %q", got)
+	}
+}
+
+func TestResult(t *testing.T) {
+	var empty *Result
+	if !empty.Valid() || empty.Err() != nil || (Formatter{}).Format(empty) != "" {
+		t.Error("expected a nil result to be valid")
+	}
+
+	r := &Result{}
+	if r.Err() != nil {
+		t.Error("expected an empty result to have no error")
+	}
+	r.Merge(sampleResult())
+	err := r.Err()
+	var result *Result
+	if !errors.As(err, &result) || len(result.Errors) != 4 {
+		t.Errorf("expected Err to return the result, got %v", err)
+	}
+
+	if got := Required("to.city").RelativeTo("to"); got != "field 'to.city' is required" {
+		t.Errorf("expected a nested error to keep its field, got %q", got)
+	}
+	if got := Required("to").RelativeTo("to"); got != "is required" {
+		t.Errorf("expected the field to be left out, got %q", got)
+	}
+
+	for value, want := range map[interface{}]string{nil: "null", true: "boolean", 3: "number", 2.5: "number", "s": "string"} {
+		if got := TypeName(value); got != want {
+			t.Errorf("TypeName(%v): expected %s, got %s", value, want, got)
+		}
+	}
+	if TypeName([]string{}) != "array" || TypeName(map[string]int{}) != "object" {
+		t.Error("expected arrays and objects to be named")
+	}
+	if FormatValue("a") != `"a"` || FormatValue(2.5) != "2.5" || FormatValue(nil) != "null" {
+		t.Error("unexpected FormatValue output")
+	}
+}
@@ -0,0 +1,152 @@
+// ABOUTME: Structured validation results shared by tool schemas, agent configs and other validators
+// ABOUTME: Each error has a field path, a code and a message; Result.Error renders them for people
+
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Codes of the problems validators report
+const (
+	CodeRequired  = "required"
+	CodeType      = "type"
+	CodeEnum      = "enum"
+	CodeConst     = "const"
+	CodeMinimum   = "minimum"
+	CodeMaximum   = "maximum"
+	CodeMinLength = "min_length"
+	CodeMaxLength = "max_length"
+	CodeMinItems  = "min_items"
+	CodeMaxItems  = "max_items"
+	CodePattern   = "pattern"
+	CodeAnyOf     = "any_of"
+	CodeOneOf     = "one_of"
+	CodeNot       = "not"
+	CodeCondition = "condition"
+	CodeRule      = "rule"
+	CodeInvalid   = "invalid"
+)
+
+// Error is one problem found in a value. Field is the path of the value
+// that has it, such as "to.city" or "tags[2]", and empty for the whole
+// value. Message says what is wrong without naming the field, as in
+// "must be ≤ 2, got 5". Details explain a failure with several causes,
+// such as why each alternative of a oneOf schema did not match.
+type Error struct {
+	Field   string   `json:"field"`
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+}
+
+// Error renders the error on its own, naming the field
+func (e Error) Error() string {
+	return subject(e.Field) + " " + e.Message + e.detailSuffix()
+}
+
+// RelativeTo renders the error as a cause of a failure at field, leaving
+// out the field when it is the same
+func (e Error) RelativeTo(field string) string {
+	if e.Field == field {
+		return e.Message + e.detailSuffix()
+	}
+	return e.Error()
+}
+
+func (e Error) detailSuffix() string {
+	if len(e.Details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(e.Details, "; ") + ")"
+}
+
+// subject names a field in a message
+func subject(field string) string {
+	if field == "" {
+		return "input"
+	}
+	return "field '" + field + "'"
+}
+
+// Result collects the errors found validating a value. Its Error method
+// renders them tersely on one line; use a Formatter for other forms.
+type Result struct {
+	Errors []Error `json:"errors"`
+}
+
+// Add records an error
+func (r *Result) Add(err Error) {
+	r.Errors = append(r.Errors, err)
+}
+
+// Addf records an error with a formatted message
+func (r *Result) Addf(field, code, format string, args ...interface{}) {
+	r.Add(Error{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// Merge records the errors of another result
+func (r *Result) Merge(other *Result) {
+	if other != nil {
+		r.Errors = append(r.Errors, other.Errors...)
+	}
+}
+
+// Valid reports whether no errors were found
+func (r *Result) Valid() bool {
+	return r == nil || len(r.Errors) == 0
+}
+
+// Err returns the result as an error, or nil if it is valid
+func (r *Result) Err() error {
+	if r.Valid() {
+		return nil
+	}
+	return r
+}
+
+// Error renders the errors tersely
+func (r *Result) Error() string {
+	return Formatter{}.Format(r)
+}
+
+// Required is the error for a missing field
+func Required(field string) Error {
+	return Error{Field: field, Code: CodeRequired, Message: "is required"}
+}
+
+// TypeName is the JSON name of a value's type, used in messages
+func TypeName(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// FormatValue renders a value in a message: strings quoted, others as Go
+// prints them
+func FormatValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	if value == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%v", value)
+}